@@ -0,0 +1,93 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Command loadgen replays conversations against the agent loop with a mock
+// provider and reports latency, allocations and store write throughput, to
+// check performance work on the boards PicoClaw runs on:
+//
+//	loadgen -concurrency 8 -rounds 5 -latency 200ms
+//	loadgen -conversations ~/.picoclaw/workspace/sessions -store file -json
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/loadgen"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+func main() {
+	conversations := flag.String("conversations", "", "session file or directory of them to replay (default: built-in samples)")
+	concurrency := flag.Int("concurrency", 4, "chats answered side by side")
+	rounds := flag.Int("rounds", 3, "times each chat replays all conversations")
+	latency := flag.Duration("latency", 0, "how long the mock provider takes to answer")
+	store := flag.String("store", "sqlite", "session store backend: sqlite or file")
+	workspace := flag.String("workspace", "", "workspace to run in (default: a temporary one, removed afterwards)")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	convs := loadgen.SampleConversations()
+	if *conversations != "" {
+		var err error
+		if convs, err = loadgen.LoadConversations(*conversations); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *workspace == "" {
+		dir, err := os.MkdirTemp("", "picoclaw-loadgen-")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		*workspace = dir
+	}
+
+	// What the agent logs per message would be measured too.
+	logger.SetLevel(logger.WARN)
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = *workspace
+	cfg.Agents.Defaults.Model = "loadgen-mock"
+	cfg.Session.Store.Backend = *store
+	al, err := agent.NewAgentLoop(cfg, bus.NewMessageBus(), loadgen.NewProvider(convs, *latency))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if !*asJSON {
+		fmt.Printf("Replaying %d conversations in %d chats, %d rounds, provider latency %s\n",
+			len(convs), *concurrency, *rounds, *latency)
+	}
+	result := loadgen.Run(ctx, al, *workspace, convs, loadgen.Options{Concurrency: *concurrency, Rounds: *rounds})
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(struct {
+			loadgen.Result
+			PerSecond           float64 `json:"per_second"`
+			StoreBytesPerSecond float64 `json:"store_bytes_per_second"`
+			Latency             string  `json:"provider_latency"`
+		}{result, result.PerSecond(), result.StoreBytesPerSecond(), latency.String()})
+	} else {
+		result.Write(os.Stdout)
+	}
+	if result.Errors > 0 {
+		os.Exit(1)
+	}
+}
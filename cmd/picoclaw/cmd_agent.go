@@ -70,7 +70,11 @@ func agentCmd() {
 	}
 
 	msgBus := bus.NewMessageBus()
-	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agentLoop, err := agent.NewAgentLoop(cfg, msgBus, provider)
+	if err != nil {
+		fmt.Printf("Error starting agent: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Print agent startup info (only for interactive mode)
 	startupInfo := agentLoop.GetStartupInfo()
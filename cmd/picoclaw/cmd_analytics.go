@@ -0,0 +1,95 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+)
+
+func analyticsCmd() {
+	asJSON := false
+	days := 7
+	var since time.Time
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--json":
+			asJSON = true
+		case "--days":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fmt.Printf("Invalid --days: %s\n", args[i+1])
+					os.Exit(1)
+				}
+				days = n
+				i++
+			}
+		case "--since":
+			if i+1 < len(args) {
+				t, err := time.ParseInLocation("2006-01-02", args[i+1], time.Local)
+				if err != nil {
+					fmt.Printf("Invalid --since, want a date like 2026-01-31: %s\n", args[i+1])
+					os.Exit(1)
+				}
+				since = t
+				i++
+			}
+		case "--help", "-h":
+			analyticsHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			analyticsHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	loc, err := cfg.Gateway.Analytics.Location()
+	if err != nil {
+		fmt.Printf("Error: gateway.analytics: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	if since.IsZero() {
+		since = now.AddDate(0, 0, -days)
+	}
+	report, err := agent.WorkspaceAnalytics(cfg, since, now, loc)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+	fmt.Print(report.Text())
+}
+
+func analyticsHelp() {
+	fmt.Println("\nUsage: picoclaw analytics [--days <n>] [--since <date>] [--json]")
+	fmt.Println("  Sums up how the agents were used from the traces, LLM events and sessions:")
+	fmt.Println("  the busiest hours, the most used tools, tokens per run, the most frequent")
+	fmt.Println("  errors and what each persona cost. With gateway.analytics.weekly_summary")
+	fmt.Println("  the gateway posts a summary of the last seven days to the admin chat.")
+	fmt.Println()
+	fmt.Println("  --days      How many days back to look (default 7)")
+	fmt.Println("  --since     Look back to this date instead, e.g. 2026-01-31")
+	fmt.Println("  --json      Print the report as JSON")
+	fmt.Println()
+}
@@ -0,0 +1,94 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func auditHelp() {
+	fmt.Println("\nAudit commands:")
+	fmt.Println("  show [n]    Show the last n entries of the audit log (default 20)")
+	fmt.Println("  verify      Check that no entry was changed, removed or reordered")
+	fmt.Println()
+	fmt.Println("The audit log records privileged commands, approvals, refusals, config")
+	fmt.Println("reloads, erasures and plugin installs in <workspace>/state/audit.jsonl.")
+}
+
+func auditCmd() {
+	if len(os.Args) < 3 {
+		auditHelp()
+		return
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	log := state.NewAuditLog(cfg.WorkspacePath())
+
+	switch os.Args[2] {
+	case "show":
+		n := 20
+		if len(os.Args) > 3 {
+			if n, err = strconv.Atoi(os.Args[3]); err != nil || n < 0 {
+				fmt.Println("Usage: picoclaw audit show [n]")
+				return
+			}
+		}
+		auditShowCmd(log, n)
+	case "verify":
+		n, head, err := log.Verify()
+		if err != nil {
+			fmt.Printf("✗ The audit log does not check after %d entries: %v\n", n, err)
+			os.Exit(1)
+		}
+		if n == 0 {
+			fmt.Println("The audit log is empty.")
+			return
+		}
+		fmt.Printf("✓ %d entries check. The last one's hash is %s\n", n, head)
+		fmt.Println("  Note it elsewhere to tell later whether entries were cut from the end.")
+	default:
+		fmt.Printf("Unknown audit command: %s\n", os.Args[2])
+		auditHelp()
+	}
+}
+
+func auditShowCmd(log *state.AuditLog, n int) {
+	entries, err := log.Recent(n)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(entries) == 0 {
+		fmt.Println("The audit log is empty.")
+		return
+	}
+	for _, e := range entries {
+		line := fmt.Sprintf("%5d  %s  %-15s %-7s", e.Seq, e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, e.Outcome)
+		if e.Actor != "" {
+			line += "  by " + e.Actor
+		}
+		if e.Target != "" {
+			line += "  " + e.Target
+		}
+		if e.Detail != "" {
+			line += ": " + e.Detail
+		}
+		fmt.Println(line)
+	}
+}
+
+// auditCLI records something done from the command line in the audit log.
+func auditCLI(workspace string, e state.AuditEntry) {
+	e.Actor = "cli"
+	if _, err := state.NewAuditLog(workspace).Append(e); err != nil {
+		fmt.Printf("Warning: failed to write the audit log: %v\n", err)
+	}
+}
@@ -119,7 +119,7 @@ func authLoginOpenAI(useDeviceCode bool) {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := config.LoadConfigFile(getConfigPath())
 	if err == nil {
 		// Update Providers (legacy format)
 		appCfg.Providers.OpenAI.AuthMethod = "oauth"
@@ -193,7 +193,7 @@ func authLoginGoogleAntigravity() {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := config.LoadConfigFile(getConfigPath())
 	if err == nil {
 		// Update Providers (legacy format, for backward compatibility)
 		appCfg.Providers.Antigravity.AuthMethod = "oauth"
@@ -270,7 +270,7 @@ func authLoginPasteToken(provider string) {
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
+	appCfg, err := config.LoadConfigFile(getConfigPath())
 	if err == nil {
 		switch provider {
 		case "anthropic":
@@ -343,7 +343,7 @@ func authLogoutCmd() {
 			os.Exit(1)
 		}
 
-		appCfg, err := loadConfig()
+		appCfg, err := config.LoadConfigFile(getConfigPath())
 		if err == nil {
 			// Clear AuthMethod in ModelList
 			for i := range appCfg.ModelList {
@@ -381,7 +381,7 @@ func authLogoutCmd() {
 			os.Exit(1)
 		}
 
-		appCfg, err := loadConfig()
+		appCfg, err := config.LoadConfigFile(getConfigPath())
 		if err == nil {
 			// Clear all AuthMethods in ModelList
 			for i := range appCfg.ModelList {
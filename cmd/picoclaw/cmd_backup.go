@@ -0,0 +1,247 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/backup"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func backupCmd() {
+	home := filepath.Dir(getConfigPath())
+	output, dir, keep := "", filepath.Join(home, "backups"), 0
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--output", "-o":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "--dir":
+			if i+1 < len(args) {
+				dir = args[i+1]
+				i++
+			}
+		case "--keep":
+			if i+1 < len(args) {
+				keep, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "--help", "-h":
+			backupHelp()
+			return
+		default:
+			fmt.Printf("Unknown flag: %s\n", args[i])
+			backupHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if output == "" {
+		output = filepath.Join(dir, backup.FileName(time.Now()))
+	}
+	m, err := writeBackup(cfg, home, output)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Backed up %d files (%.1f MB) to %s\n", m.Files, float64(m.Bytes)/(1<<20), output)
+	for _, src := range m.Sources {
+		fmt.Printf("  • %-14s %s\n", src.Name, src.Path)
+	}
+	if backend := cfg.Session.Store.Backend; backend == "postgres" || backend == "redis" {
+		fmt.Printf("⚠ Sessions are kept in %s and are not in the backup; back them up with its own tools.\n", backend)
+	}
+	if keep > 0 {
+		removed, err := backup.Prune(filepath.Dir(output), keep)
+		if err != nil {
+			fmt.Printf("Error removing old backups: %v\n", err)
+			os.Exit(1)
+		}
+		if len(removed) > 0 {
+			fmt.Printf("✓ Removed %d older backups\n", len(removed))
+		}
+	}
+}
+
+// writeBackup writes the backup of this installation to output.
+func writeBackup(cfg *config.Config, home, output string) (*backup.Manifest, error) {
+	if err := os.MkdirAll(filepath.Dir(output), 0o700); err != nil {
+		return nil, err
+	}
+
+	// The archive holds API keys, so only its owner may read it.
+	tempFile := output + ".tmp"
+	f, err := os.OpenFile(tempFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	m, err := backup.Create(f, backupSources(cfg, home), version)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile, output)
+	}
+	if err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+	return m, nil
+}
+
+// backupSources lists what a backup holds: the config, its conf.d
+// fragments and overlay, the credentials, the default workspace (sessions, memory,
+// cron jobs, skills, state), the workspaces of agents that keep their own,
+// and the global skills.
+func backupSources(cfg *config.Config, home string) []backup.Source {
+	workspace := cfg.WorkspacePath()
+	sources := []backup.Source{
+		{Name: "config", Path: getConfigPath()},
+		{Name: "conf.d", Path: config.ConfDir(getConfigPath())},
+		{Name: "overlay", Path: config.OverlayPath(getConfigPath())},
+		{Name: "auth", Path: filepath.Join(home, "auth.json")},
+		{Name: "workspace", Path: workspace},
+	}
+	workspaces := agent.Workspaces(cfg)
+	ids := make([]string, 0, len(workspaces))
+	for id := range workspaces {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		ws := workspaces[id]
+		if ws == workspace || strings.HasPrefix(ws, workspace+string(filepath.Separator)) {
+			continue
+		}
+		sources = append(sources, backup.Source{Name: "agents/" + id, Path: ws})
+	}
+	return append(sources, backup.Source{Name: "skills", Path: filepath.Join(home, "skills")})
+}
+
+func backupHelp() {
+	fmt.Println("\nUsage: picoclaw backup [--output <file> | --dir <dir>] [--keep <n>]")
+	fmt.Println("  Writes the config, credentials, workspaces (sessions, memory, scheduled")
+	fmt.Println("  tasks, skills) and global skills into one archive.")
+	fmt.Println()
+	fmt.Println("  --output, -o   Archive to write")
+	fmt.Println("  --dir          Directory to write a timestamped archive to (default: ~/.picoclaw/backups)")
+	fmt.Println("  --keep         Keep only the newest n archives in that directory")
+	fmt.Println()
+}
+
+func restoreCmd() {
+	var archive string
+	force := false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--force":
+			force = true
+		case "--help", "-h":
+			restoreHelp()
+			return
+		default:
+			if strings.HasPrefix(arg, "-") || archive != "" {
+				fmt.Printf("Unknown flag: %s\n", arg)
+				restoreHelp()
+				os.Exit(1)
+			}
+			archive = arg
+		}
+	}
+	if archive == "" {
+		restoreHelp()
+		os.Exit(1)
+	}
+
+	configPath := getConfigPath()
+	if _, err := os.Stat(configPath); err == nil && !force {
+		fmt.Printf("%s already exists. Use --force to overwrite this installation with the backup.\n", configPath)
+		os.Exit(1)
+	}
+	m, target, err := restoreBackup(archive, force)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✓ Restored %d files from a backup of %s\n", m.Files, m.Created.Local().Format("2006-01-02 15:04"))
+	for _, src := range m.Sources {
+		if dest := target(src.Name); dest != "" {
+			fmt.Printf("  • %-14s %s\n", src.Name, dest)
+		} else {
+			fmt.Printf("  • %-14s skipped, no such agent in the config\n", src.Name)
+		}
+	}
+}
+
+// restoreBackup restores the archive over this installation, and returns
+// where each of its sources went.
+func restoreBackup(archive string, overwrite bool) (*backup.Manifest, func(name string) string, error) {
+	configPath := getConfigPath()
+	home := filepath.Dir(configPath)
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	// The workspaces go where the restored config puts them on this
+	// device, which the archive has before them.
+	var restored *config.Config
+	target := func(name string) string {
+		switch name {
+		case "config":
+			return configPath
+		case "conf.d":
+			return config.ConfDir(configPath)
+		case "overlay":
+			return config.OverlayPath(configPath)
+		case "auth":
+			return filepath.Join(home, "auth.json")
+		case "skills":
+			return filepath.Join(home, "skills")
+		}
+		if restored == nil {
+			if restored, err = config.LoadConfig(configPath); err != nil {
+				fmt.Printf("⚠ Could not read the restored config (%v); using the default workspace\n", err)
+				restored = config.DefaultConfig()
+			}
+		}
+		if name == "workspace" {
+			return restored.WorkspacePath()
+		}
+		if id, ok := strings.CutPrefix(name, "agents/"); ok {
+			return agent.Workspaces(restored)[id]
+		}
+		return ""
+	}
+	m, err := backup.Restore(f, target, overwrite)
+	return m, target, err
+}
+
+func restoreHelp() {
+	fmt.Println("\nUsage: picoclaw restore <archive> [--force]")
+	fmt.Println("  Restores a backup made with picoclaw backup. Workspaces are written to")
+	fmt.Println("  the paths the restored config gives them on this device.")
+	fmt.Println()
+	fmt.Println("  --force   Overwrite an existing config and files")
+	fmt.Println()
+}
@@ -0,0 +1,222 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// chatCmd runs an interactive REPL against the local agent. Input is sent
+// through the message bus and a terminal channel, so it exercises the same
+// routing, commands and streaming as the gateway.
+func chatCmd() {
+	session := "default"
+	modelOverride := ""
+	debug := false
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--debug", "-d":
+			debug = true
+		case "-s", "--session":
+			if i+1 < len(args) {
+				session = args[i+1]
+				i++
+			}
+		case "--model", "-model":
+			if i+1 < len(args) {
+				modelOverride = args[i+1]
+				i++
+			}
+		case "-h", "--help":
+			chatHelp()
+			return
+		}
+	}
+
+	// Keep routine logs from interleaving with the conversation.
+	if debug {
+		logger.SetLevel(logger.DEBUG)
+	} else {
+		logger.SetLevel(logger.WARN)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if modelOverride != "" {
+		cfg.Agents.Defaults.ModelName = modelOverride
+	}
+
+	provider, modelID, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	if modelID != "" {
+		cfg.Agents.Defaults.ModelName = modelID
+	}
+
+	msgBus := bus.NewMessageBus()
+	agentLoop, err := agent.NewAgentLoop(cfg, msgBus, provider)
+	if err != nil {
+		fmt.Printf("Error starting agent: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Only the terminal is attached; configured chat apps stay offline.
+	managerCfg := *cfg
+	managerCfg.Channels = config.ChannelsConfig{}
+	channelManager, err := channels.NewManager(&managerCfg, msgBus)
+	if err != nil {
+		fmt.Printf("Error creating channel manager: %v\n", err)
+		os.Exit(1)
+	}
+	terminal := channels.NewTerminalChannel(msgBus, os.Stdout, logo)
+	channelManager.RegisterChannel(terminal.Name(), terminal)
+	agentLoop.SetChannelManager(channelManager)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := channelManager.StartAll(ctx); err != nil {
+		fmt.Printf("Error starting terminal channel: %v\n", err)
+		os.Exit(1)
+	}
+	go agentLoop.Run(ctx)
+
+	fmt.Printf("%s Chat session %q (model: %s)\n", logo, session, cfg.Agents.Defaults.ModelName)
+	fmt.Println("End a line with \\ or wrap text in \"\"\" for multi-line input. /exit quits.")
+	fmt.Println()
+
+	chatLoop(ctx, terminal, session)
+
+	agentLoop.Stop()
+	channelManager.StopAll(context.Background())
+}
+
+func chatLoop(ctx context.Context, terminal *channels.TerminalChannel, session string) {
+	prompt := fmt.Sprintf("%s You: ", logo)
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          prompt,
+		HistoryFile:     filepath.Join(filepath.Dir(getConfigPath()), "chat_history"),
+		HistoryLimit:    1000,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "/exit",
+	})
+	if err != nil {
+		fmt.Printf("Error initializing readline: %v\n", err)
+		return
+	}
+	defer rl.Close()
+
+	for {
+		input, err := readChatInput(rl, prompt)
+		if err != nil {
+			if errors.Is(err, readline.ErrInterrupt) || errors.Is(err, io.EOF) {
+				fmt.Println("Goodbye!")
+				return
+			}
+			fmt.Printf("Error reading input: %v\n", err)
+			continue
+		}
+
+		input = strings.TrimSpace(input)
+		switch input {
+		case "":
+			continue
+		case "/exit", "/quit", "exit", "quit":
+			fmt.Println("Goodbye!")
+			return
+		}
+
+		// Drop late notices (e.g. history compression) from the previous turn
+		// so they aren't mistaken for this turn's answer.
+		for len(terminal.Replies()) > 0 {
+			<-terminal.Replies()
+		}
+		terminal.Submit(session, input)
+		if !waitForReply(ctx, terminal) {
+			fmt.Println("\nGoodbye!")
+			return
+		}
+	}
+}
+
+// readChatInput reads one message. A trailing backslash continues the line,
+// and a line consisting of """ opens a block that runs until the next """.
+func readChatInput(rl *readline.Instance, prompt string) (string, error) {
+	defer rl.SetPrompt(prompt)
+
+	var lines []string
+	inBlock := false
+	for {
+		line, err := rl.Readline()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case strings.TrimSpace(line) == `"""`:
+			if inBlock {
+				return strings.Join(lines, "\n"), nil
+			}
+			inBlock = true
+		case inBlock:
+			lines = append(lines, line)
+		case strings.HasSuffix(line, `\`):
+			lines = append(lines, strings.TrimSuffix(line, `\`))
+		default:
+			lines = append(lines, line)
+			return strings.Join(lines, "\n"), nil
+		}
+		rl.SetPrompt("... ")
+	}
+}
+
+// waitForReply blocks until the agent has answered. It returns false if the
+// user pressed Ctrl+C while waiting.
+func waitForReply(ctx context.Context, terminal *channels.TerminalChannel) bool {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	select {
+	case <-terminal.Replies():
+		return true
+	case <-interrupt:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func chatHelp() {
+	fmt.Println("Usage: picoclaw chat [options]")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -s, --session <name>  Conversation to resume (default: default)")
+	fmt.Println("  --model <model>       Override the configured model")
+	fmt.Println("  -d, --debug           Show debug logs")
+}
@@ -0,0 +1,88 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func configCmd() {
+	if len(os.Args) < 3 {
+		configHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "validate":
+		path := getConfigPath()
+		if len(os.Args) > 3 {
+			path = os.Args[3]
+		}
+		configValidateCmd(path)
+	case "schema":
+		schema, err := config.Schema()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(schema)
+	default:
+		fmt.Printf("Unknown config command: %s\n", os.Args[2])
+		configHelp()
+	}
+}
+
+// configValidateCmd checks the config at path and its layers strictly and
+// then loads it as the gateway would, so mistakes show before a restart
+// rather than after it.
+func configValidateCmd(path string) {
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("✗ %v\n  Run picoclaw onboard to create a config.\n", err)
+		os.Exit(1)
+	}
+
+	files := config.LayerFiles(path)
+	problems := 0
+	for _, file := range files {
+		found, err := config.CheckFile(file)
+		if err != nil {
+			fmt.Printf("✗ %v\n", err)
+			problems++
+			continue
+		}
+		for _, p := range found {
+			fmt.Printf("✗ %s\n", p)
+		}
+		problems += len(found)
+	}
+
+	// Secret references and the checks across settings need the layers
+	// put together.
+	if problems == 0 {
+		if _, err := config.LoadConfig(path); err != nil {
+			fmt.Printf("✗ %v\n", err)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		fmt.Printf("\n%d problem(s) found\n", problems)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Config is valid (%d file(s) checked)\n", len(files))
+	for _, file := range files {
+		fmt.Printf("  • %s\n", file)
+	}
+}
+
+func configHelp() {
+	fmt.Println("\nConfig commands:")
+	fmt.Println("  validate [path]   Check the config and its layers for unknown keys, wrong types,")
+	fmt.Println("                    unresolved secret references and invalid settings")
+	fmt.Println("  schema            Print the JSON Schema of the config file")
+	fmt.Println()
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/cron"
@@ -34,6 +36,8 @@ func cronCmd() {
 		cronListCmd(cronStorePath)
 	case "add":
 		cronAddCmd(cronStorePath)
+	case "preview":
+		cronPreviewCmd()
 	case "remove":
 		if len(os.Args) < 4 {
 			fmt.Println("Usage: picoclaw cron remove <job_id>")
@@ -54,6 +58,7 @@ func cronHelp() {
 	fmt.Println("\nCron commands:")
 	fmt.Println("  list              List all scheduled jobs")
 	fmt.Println("  add              Add a new scheduled job")
+	fmt.Println("  preview <when>   Show how a schedule is read and its next runs")
 	fmt.Println("  remove <id>       Remove a job by ID")
 	fmt.Println("  enable <id>      Enable a job")
 	fmt.Println("  disable <id>     Disable a job")
@@ -63,6 +68,9 @@ func cronHelp() {
 	fmt.Println("  -m, --message    Message for agent")
 	fmt.Println("  -e, --every      Run every N seconds")
 	fmt.Println("  -c, --cron       Cron expression (e.g. '0 9 * * *')")
+	fmt.Println("  -w, --when       Schedule in words (e.g. 'every weekday at 8')")
+	fmt.Println("  --tz             Time zone for --when (e.g. Europe/Berlin)")
+	fmt.Println("  --catch-up       Runs missed while down: once or skip")
 	fmt.Println("  -d, --deliver     Deliver response to channel")
 	fmt.Println("  --to             Recipient for delivery")
 	fmt.Println("  --channel        Channel for delivery")
@@ -80,15 +88,6 @@ func cronListCmd(storePath string) {
 	fmt.Println("\nScheduled Jobs:")
 	fmt.Println("----------------")
 	for _, job := range jobs {
-		var schedule string
-		if job.Schedule.Kind == "every" && job.Schedule.EveryMS != nil {
-			schedule = fmt.Sprintf("every %ds", *job.Schedule.EveryMS/1000)
-		} else if job.Schedule.Kind == "cron" {
-			schedule = job.Schedule.Expr
-		} else {
-			schedule = "one-time"
-		}
-
 		nextRun := "scheduled"
 		if job.State.NextRunAtMS != nil {
 			nextTime := time.UnixMilli(*job.State.NextRunAtMS)
@@ -101,9 +100,20 @@ func cronListCmd(storePath string) {
 		}
 
 		fmt.Printf("  %s (%s)\n", job.Name, job.ID)
-		fmt.Printf("    Schedule: %s\n", schedule)
+		fmt.Printf("    Schedule: %s\n", job.Schedule)
 		fmt.Printf("    Status: %s\n", status)
 		fmt.Printf("    Next run: %s\n", nextRun)
+		if run, ok := job.LastRun(); ok {
+			fmt.Printf("    Last run: %s at %s, task %s\n", run.Status,
+				time.UnixMilli(run.StartedAtMS).Format("2006-01-02 15:04"), run.TaskID)
+			if n := job.State.ConsecutiveFailures; n > 0 {
+				fmt.Printf("    Failing: %d in a row, last error: %s\n", n, job.State.LastError)
+			}
+		}
+		if job.State.MissedAtMS != nil {
+			fmt.Printf("    Catching up: %d run(s) missed since %s\n", job.State.MissedRuns,
+				time.UnixMilli(*job.State.MissedAtMS).Format("2006-01-02 15:04"))
+		}
 	}
 }
 
@@ -112,6 +122,9 @@ func cronAddCmd(storePath string) {
 	message := ""
 	var everySec *int64
 	cronExpr := ""
+	when := ""
+	tz := ""
+	catchUp := ""
 	deliver := false
 	channel := ""
 	to := ""
@@ -141,6 +154,21 @@ func cronAddCmd(storePath string) {
 				cronExpr = args[i+1]
 				i++
 			}
+		case "-w", "--when":
+			if i+1 < len(args) {
+				when = args[i+1]
+				i++
+			}
+		case "--tz":
+			if i+1 < len(args) {
+				tz = args[i+1]
+				i++
+			}
+		case "--catch-up":
+			if i+1 < len(args) {
+				catchUp = args[i+1]
+				i++
+			}
 		case "-d", "--deliver":
 			deliver = true
 		case "--to":
@@ -166,13 +194,24 @@ func cronAddCmd(storePath string) {
 		return
 	}
 
-	if everySec == nil && cronExpr == "" {
-		fmt.Println("Error: Either --every or --cron must be specified")
+	if everySec == nil && cronExpr == "" && when == "" {
+		fmt.Println("Error: One of --every, --cron or --when must be specified")
+		return
+	}
+
+	if catchUp != "" && !slices.Contains(cron.CatchUpPolicies, catchUp) {
+		fmt.Printf("Error: --catch-up must be one of %s\n", strings.Join(cron.CatchUpPolicies, ", "))
 		return
 	}
 
 	var schedule cron.CronSchedule
-	if everySec != nil {
+	if when != "" {
+		var err error
+		if schedule, err = parseWhen(when, tz); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	} else if everySec != nil {
 		everyMS := *everySec * 1000
 		schedule = cron.CronSchedule{
 			Kind:    "every",
@@ -191,8 +230,77 @@ func cronAddCmd(storePath string) {
 		fmt.Printf("Error adding job: %v\n", err)
 		return
 	}
+	if catchUp != "" {
+		job.CatchUp = catchUp
+		if err := cs.UpdateJob(job); err != nil {
+			fmt.Printf("Error saving job: %v\n", err)
+			return
+		}
+	}
 
 	fmt.Printf("✓ Added job '%s' (%s)\n", job.Name, job.ID)
+	printNextRuns(schedule)
+}
+
+// cronPreviewCmd shows how picoclaw reads a schedule, without adding it.
+func cronPreviewCmd() {
+	var words []string
+	tz := ""
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--tz" && i+1 < len(args) {
+			tz = args[i+1]
+			i++
+			continue
+		}
+		words = append(words, args[i])
+	}
+	if len(words) == 0 {
+		fmt.Println("Usage: picoclaw cron preview <when> [--tz <zone>]")
+		return
+	}
+	schedule, err := parseWhen(strings.Join(words, " "), tz)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if schedule.Kind == "cron" {
+		fmt.Printf("Read as: %s (cron: %s)\n", schedule, schedule.Expr)
+	} else {
+		fmt.Printf("Read as: %s\n", schedule)
+	}
+	printNextRuns(schedule)
+}
+
+// parseWhen reads a schedule in words in the time zone tz, or the local one.
+func parseWhen(when, tz string) (cron.CronSchedule, error) {
+	loc := time.Local
+	if tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return cron.CronSchedule{}, fmt.Errorf("unknown time zone %q", tz)
+		}
+	}
+	return cron.ParseSchedule(when, loc, time.Now())
+}
+
+// printNextRuns prints the next three runs of schedule in its time zone.
+func printNextRuns(schedule cron.CronSchedule) {
+	runs := cron.NextRuns(schedule, time.Now(), 3)
+	if len(runs) == 0 {
+		fmt.Println("  It will not run again.")
+		return
+	}
+	loc := time.Local
+	if schedule.TZ != "" {
+		if l, err := time.LoadLocation(schedule.TZ); err == nil {
+			loc = l
+		}
+	}
+	fmt.Println("  Next runs:")
+	for _, run := range runs {
+		fmt.Printf("    %s\n", run.In(loc).Format("Mon 2006-01-02 15:04 MST"))
+	}
 }
 
 func cronRemoveCmd(storePath, jobID string) {
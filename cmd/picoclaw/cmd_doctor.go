@@ -0,0 +1,134 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/doctor"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+func doctorCmd() {
+	live, asJSON := true, false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--offline":
+			live = false
+		case "--json":
+			asJSON = true
+		case "--help", "-h":
+			doctorHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", arg)
+			doctorHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report := doctor.Run(ctx, cfg, doctor.Options{Live: live})
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printDoctorReport(report)
+	}
+	if report.Failed() {
+		os.Exit(1)
+	}
+}
+
+func doctorHelp() {
+	fmt.Println("\nUsage: picoclaw doctor [--offline] [--json]")
+	fmt.Println("  Checks every model_list provider with a short request, the credentials")
+	fmt.Println("  of the enabled channels, and the workspace and session databases.")
+	fmt.Println()
+	fmt.Println("  --offline   Check only the config and local files, without requests")
+	fmt.Println("  --json      Print the report as JSON")
+	fmt.Println()
+}
+
+var doctorSections = []struct{ key, title string }{
+	{"provider", "Providers"},
+	{"channel", "Channels"},
+	{"storage", "Storage"},
+}
+
+func printDoctorReport(report *doctor.Report) {
+	fmt.Printf("%s picoclaw doctor\n", logo)
+	width := 0
+	for _, c := range report.Checks {
+		width = max(width, len(c.Name))
+	}
+	for _, section := range doctorSections {
+		printed := false
+		for _, c := range report.Checks {
+			if c.Section != section.key {
+				continue
+			}
+			if !printed {
+				fmt.Printf("\n%s:\n", section.title)
+				printed = true
+			}
+			fmt.Printf("  %s %-*s  %s\n", doctorMark(c.Status), width, c.Name, c.Detail)
+		}
+	}
+
+	fmt.Println()
+	switch n := len(report.Problems()); n {
+	case 0:
+		fmt.Println("No problems found.")
+	case 1:
+		fmt.Println("1 problem found.")
+	default:
+		fmt.Printf("%d problems found.\n", n)
+	}
+	if !report.Live {
+		fmt.Println("Providers and channel tokens were not contacted; run without --offline to check them.")
+	}
+}
+
+func doctorMark(s doctor.Status) string {
+	switch s {
+	case doctor.StatusOK:
+		return "✓"
+	case doctor.StatusWarn:
+		return "!"
+	case doctor.StatusSkip:
+		return "-"
+	}
+	return "✗"
+}
+
+// logStartupChecks warns about the problems the offline checks found when
+// the gateway starts, so a missing token shows up in the log before the
+// first message fails.
+func logStartupChecks(report *doctor.Report) {
+	problems := report.Problems()
+	if len(problems) == 0 {
+		return
+	}
+	fmt.Println("\n⚠️  Configuration problems (run 'picoclaw doctor' for details):")
+	for _, c := range problems {
+		fmt.Printf("  • %s %s: %s\n", c.Section, c.Name, c.Detail)
+		logger.WarnCF("doctor", "Startup check "+strings.ToUpper(string(c.Status)),
+			map[string]any{"section": c.Section, "name": c.Name, "detail": c.Detail})
+	}
+}
@@ -6,45 +6,89 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/adminapi"
 	"github.com/sipeed/picoclaw/pkg/agent"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/dnd"
+	"github.com/sipeed/picoclaw/pkg/doctor"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/handoff"
 	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/plugins"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/providers/ratelimit"
+	"github.com/sipeed/picoclaw/pkg/service"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/triggers"
 	"github.com/sipeed/picoclaw/pkg/voice"
+	"github.com/sipeed/picoclaw/pkg/workflow"
 )
 
 func gatewayCmd() {
-	// Check for --debug flag
+	// Check for --debug and --strict flags
 	args := os.Args[2:]
+	strict, debugLog := false, false
 	for _, arg := range args {
-		if arg == "--debug" || arg == "-d" {
+		switch arg {
+		case "--debug", "-d":
+			debugLog = true
 			logger.SetLevel(logger.DEBUG)
 			fmt.Println("🔍 Debug mode enabled")
-			break
+		case "--strict":
+			strict = true
 		}
 	}
 
-	cfg, err := loadConfig()
+	// Under the Windows service manager the gateway has no console; its
+	// output goes to a log file, as under launchd.
+	serviceStop, serviceStopped := service.Attach()
+	defer serviceStopped()
+	if serviceStop != nil {
+		logToFile()
+	}
+
+	load := loadConfig
+	if strict {
+		// Unknown keys, usually misspelt settings, stop the gateway instead
+		// of being ignored.
+		load = func() (*config.Config, error) { return config.LoadConfigStrict(getConfigPath()) }
+	}
+	cfg, err := load()
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
+	applyLogConfig(cfg.Gateway.Log, debugLog)
+	logStartupChecks(doctor.Run(context.Background(), cfg, doctor.Options{}))
+
+	if cfg.RuntimeProfile == "low-resource" && os.Getenv("GOGC") == "" {
+		// Collect garbage twice as often, trading some CPU for a smaller
+		// heap on boards with little memory.
+		debug.SetGCPercent(50)
+	}
+
 	provider, modelID, err := providers.CreateProvider(cfg)
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
@@ -56,7 +100,18 @@ func gatewayCmd() {
 	}
 
 	msgBus := bus.NewMessageBus()
-	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agentLoop, err := agent.NewAgentLoop(cfg, msgBus, provider)
+	if err != nil {
+		fmt.Printf("Error starting gateway: %v\n", err)
+		os.Exit(1)
+	}
+	eventBus := agentLoop.Events()
+	eventBus.SubscribeAll(func(topic string, ev any) {
+		if logger.Enabled("events", logger.DEBUG) {
+			logger.DebugCF("events", topic, map[string]any{"event": ev})
+		}
+	})
+	events.Publish(eventBus, events.GatewayStatus, events.Status{State: events.GatewayStarting, Time: time.Now()})
 
 	// Print agent startup info
 	fmt.Println("\n📦 Agent Status:")
@@ -87,13 +142,40 @@ func gatewayCmd() {
 		cfg,
 	)
 
+	// Gateways sharing chats and sessions take turns on each chat and run
+	// each cron job once.
+	if backend := cfg.Gateway.Coordination.Backend; backend != "" {
+		coordinator, err := session.OpenCoordinator(cfg.Gateway.Coordination, cfg.Session.Store)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer coordinator.Close()
+		agentLoop.SetCoordinator(coordinator)
+		cronService.SetClaimer(func(jobID string, ttl time.Duration) bool {
+			ok, err := coordinator.Claim("cron:"+jobID, ttl)
+			if err != nil {
+				// A run twice beats a reminder never sent.
+				logger.WarnCF("cron", "Failed to claim job, running it anyway",
+					map[string]any{"job_id": jobID, "error": err.Error()})
+				return true
+			}
+			return ok
+		})
+		fmt.Printf("✓ Coordinating with other gateways through %s\n", backend)
+	}
+
 	heartbeatService := heartbeat.NewHeartbeatService(
 		cfg.WorkspacePath(),
 		cfg.Heartbeat.Interval,
 		cfg.Heartbeat.Enabled,
 	)
 	heartbeatService.SetBus(msgBus)
+	heartbeatService.SetDeviceAlerts(tools.NewDeviceTool(cfg.WorkspacePath(), cfg.Tools.Device).Alerts)
 	heartbeatService.SetHandler(func(prompt, channel, chatID string) *tools.ToolResult {
+		if !agentLoop.ProactiveEnabled() {
+			return tools.SilentResult("Heartbeat skipped: proactive runs are off")
+		}
 		// Use cli:direct as fallback if no valid channel
 		if channel == "" || chatID == "" {
 			channel, chatID = "cli", "direct"
@@ -112,6 +194,18 @@ func gatewayCmd() {
 		return tools.SilentResult(response)
 	})
 
+	if digest := cfg.Heartbeat.Digest; digest.Enabled {
+		// Checked when the config was loaded.
+		schedule, _ := digest.ParseSchedule(time.Now())
+		heartbeatService.SetDigest(schedule, func() error {
+			if !agentLoop.ProactiveEnabled() {
+				return fmt.Errorf("skipped, proactive runs are off")
+			}
+			return agentLoop.RunDigest(context.Background(), digest, time.Now().In(schedule.Location()))
+		})
+		fmt.Printf("✓ Digest to %s:%s %s\n", digest.Channel, digest.ChatID, schedule)
+	}
+
 	channelManager, err := channels.NewManager(cfg, msgBus)
 	if err != nil {
 		fmt.Printf("Error creating channel manager: %v\n", err)
@@ -120,6 +214,25 @@ func gatewayCmd() {
 
 	// Inject channel manager into agent loop for command handling
 	agentLoop.SetChannelManager(channelManager)
+	channelManager.SetEvents(eventBus)
+
+	// Messages scheduled for later wait in the outbox of the channels.
+	agentLoop.RegisterTool(tools.NewScheduleMessageTool(func(channel, chatID, content string, at time.Time, by string) (string, error) {
+		msg := bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: content}
+		scheduled, err := agentLoop.ScheduleMessage(msg, at, by)
+		return scheduled.ID, err
+	}))
+
+	// Hooks of the plugins installed in the workspace; their tools were
+	// registered with the agents.
+	for _, p := range plugins.Load(filepath.Join(cfg.WorkspacePath(), "plugins")) {
+		for _, hook := range p.OutboundHooks() {
+			channelManager.AddOutboundHook(hook)
+		}
+		logger.InfoCF("plugins", "Loaded plugin", map[string]any{
+			"plugin": p.Name, "version": p.Version, "tools": len(p.Tools), "hooks": len(p.Hooks), "skills": len(p.Skills),
+		})
+	}
 
 	var transcriber *voice.GroqTranscriber
 	groqAPIKey := cfg.Providers.Groq.APIKey
@@ -137,23 +250,29 @@ func gatewayCmd() {
 	}
 
 	if transcriber != nil {
-		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
-			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
-				tc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Telegram channel")
-			}
-		}
-		if discordChannel, ok := channelManager.GetChannel("discord"); ok {
-			if dc, ok := discordChannel.(*channels.DiscordChannel); ok {
-				dc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Discord channel")
-			}
-		}
-		if slackChannel, ok := channelManager.GetChannel("slack"); ok {
-			if sc, ok := slackChannel.(*channels.SlackChannel); ok {
-				sc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Slack channel")
+		// Every instance of a channel type gets the transcriber, including
+		// those configured under channels.accounts.
+		for _, name := range channelManager.GetEnabledChannels() {
+			channel, _ := channelManager.GetChannel(name)
+			switch c := channel.(type) {
+			case *channels.TelegramChannel:
+				c.SetTranscriber(transcriber)
+			case *channels.DiscordChannel:
+				c.SetTranscriber(transcriber)
+			case *channels.SlackChannel:
+				c.SetTranscriber(transcriber)
+			case *channels.WhatsAppNativeChannel:
+				c.SetTranscriber(transcriber)
+			case *channels.MatrixChannel:
+				c.SetTranscriber(transcriber)
+			case *channels.SignalChannel:
+				c.SetTranscriber(transcriber)
+			case *channels.VoiceChannel:
+				c.SetTranscriber(transcriber)
+			default:
+				continue
 			}
+			logger.InfoCF("voice", "Groq transcription attached to channel", map[string]any{"channel": name})
 		}
 	}
 
@@ -192,35 +311,197 @@ func gatewayCmd() {
 		fmt.Println("✓ Device event service started")
 	}
 
+	triggerService := triggers.NewService(cfg, func(ctx context.Context, t config.TriggerConfig, prompt string) (string, error) {
+		if !agentLoop.ProactiveEnabled() {
+			return "", triggers.ErrOff
+		}
+		return agentLoop.RunTrigger(ctx, t.Name, t.Persona, prompt, t.Channel, t.ChatID)
+	})
+	channelManager.OnEvent(triggerService.ChannelEvent)
+	if triggerService.Len() > 0 {
+		triggerService.Start(ctx)
+		fmt.Printf("✓ %d triggers watching\n", triggerService.Len())
+	}
+
+	// Proactive messages wait while the user is in a meeting or a focus
+	// block, or has turned on /dnd.
+	if cfg.Gateway.DND.Enabled {
+		dndSchedule, err := dnd.New(cfg.Gateway.DND, cfg.WorkspacePath())
+		if err != nil {
+			fmt.Printf("Error setting up do-not-disturb: %v\n", err)
+			os.Exit(1)
+		}
+		channelManager.SetDoNotDisturb(dndSchedule)
+		agentLoop.SetDoNotDisturb(dndSchedule)
+		go dndSchedule.Run(ctx)
+		fmt.Println("✓ Do-not-disturb enabled")
+	}
+
 	if err := channelManager.StartAll(ctx); err != nil {
 		fmt.Printf("Error starting channels: %v\n", err)
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	healthServer.RegisterGauge("picoclaw_inbound_queue_depth", "Inbound messages waiting to be processed.",
+		func() float64 { return float64(agentLoop.QueueDepth()) })
+	healthServer.RegisterGauge("picoclaw_inbound_active_chats", "Chats with a message queued or being processed.",
+		func() float64 { return float64(agentLoop.ActiveChats()) })
+	healthServer.RegisterGauge("picoclaw_inbound_batched_messages", "Group messages held back until their chat goes quiet.",
+		func() float64 { return float64(agentLoop.BatchedMessages()) })
+	healthServer.RegisterGauge("picoclaw_llm_background_waiting",
+		"LLM requests of cron jobs and heartbeats waiting for interactive ones to finish.",
+		func() float64 { return float64(agentLoop.BackgroundWaiting()) })
+	healthServer.RegisterGauge("picoclaw_runs_running", "Agent runs holding a run slot.",
+		func() float64 { running, _ := agentLoop.RunSlots(); return float64(running) })
+	healthServer.RegisterGauge("picoclaw_runs_waiting", "Agent runs waiting for a run slot.",
+		func() float64 { _, waiting := agentLoop.RunSlots(); return float64(waiting) })
+	healthServer.RegisterGauge("picoclaw_subprocesses_running", "Commands started by tools that are running.",
+		func() float64 { running, _ := tools.Subprocesses(); return float64(running) })
+	healthServer.RegisterGauge("picoclaw_subprocesses_waiting", "Commands started by tools waiting for a subprocess slot.",
+		func() float64 { _, waiting := tools.Subprocesses(); return float64(waiting) })
+	healthServer.RegisterGauge("picoclaw_outbound_pending_deliveries", "Messages waiting to be sent again after a failed delivery.",
+		func() float64 { return float64(channelManager.PendingDeliveries()) })
+	healthServer.RegisterGaugeVec("picoclaw_channel_up", "Whether a channel is connected (1) or down (0).", "channel",
+		func() map[string]float64 {
+			values := make(map[string]float64)
+			for _, h := range channelManager.ChannelHealth() {
+				values[h.Name] = 0
+				if h.Up {
+					values[h.Name] = 1
+				}
+			}
+			return values
+		})
+	healthServer.RegisterGaugeVec("picoclaw_channel_reconnects", "Reconnect attempts per channel since startup.", "channel",
+		func() map[string]float64 {
+			values := make(map[string]float64)
+			for _, h := range channelManager.ChannelHealth() {
+				values[h.Name] = float64(h.Reconnects)
+			}
+			return values
+		})
+	healthServer.RegisterGaugeVec("picoclaw_llm_ratelimit_remaining_requests",
+		"Requests left in the current rate limit window, as last reported by the API.", "model",
+		func() map[string]float64 {
+			return rateLimitHeadroom(func(b ratelimit.Budget) int { return b.RemainingRequests })
+		})
+	healthServer.RegisterGaugeVec("picoclaw_llm_ratelimit_remaining_tokens",
+		"Tokens left in the current rate limit window, as last reported by the API.", "model",
+		func() map[string]float64 {
+			return rateLimitHeadroom(func(b ratelimit.Budget) int { return b.RemainingTokens })
+		})
+	registerProcessMetrics(healthServer, agentLoop)
+	registerEventMetrics(healthServer, eventBus)
+	events.Subscribe(eventBus, events.GatewayStatus, func(s events.Status) {
+		if s.State == events.GatewayDraining {
+			healthServer.SetReady(false)
+		}
+	})
+	healthServer.Handle("/triggers/", triggerService)
+	healthServer.SetStatus(func() any { return agentLoop.Status() })
+	if checker, ok := provider.(providers.HealthChecker); ok {
+		go watchProviderHealth(ctx, healthServer, checker)
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]any{"error": err.Error()})
 		}
 	}()
-	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	fmt.Printf("✓ Health endpoints available at http://%s:%d/health, /ready, /status and /metrics\n", cfg.Gateway.Host, cfg.Gateway.Port)
 
+	reload := watchConfig(ctx, getConfigPath(), strict, debugLog, cfg, agentLoop, channelManager)
+	adminServer := startAdminAPI(cfg.Gateway.Admin.API, agentLoop)
 	go agentLoop.Run(ctx)
+	if m := cfg.Gateway.SelfReportMinutes; m > 0 {
+		go agentLoop.RunSelfReports(ctx, time.Duration(m)*time.Minute)
+	}
+	if a := cfg.Gateway.Analytics; a.WeeklySummary {
+		// Validated with the config.
+		schedule, _ := a.ParseSchedule(time.Now())
+		loc, _ := a.Location()
+		go agentLoop.RunAnalyticsSummaries(ctx, schedule, loc)
+	}
 
+	notifyService("READY=1\nSTATUS=Serving " + strings.Join(enabledChannels, ", "))
+	handoff.Ready()
+	events.Publish(eventBus, events.GatewayStatus, events.Status{State: events.GatewayReady, Time: time.Now()})
+	// After a restart, what the old process kept is handled once it is
+	// gone, as it keeps some until the end.
+	go func() {
+		handoff.WaitParent(ctx)
+		agentLoop.ResumeHeld()
+		channelManager.ResumeHeld()
+	}()
+	// The watchdog is fed from here rather than from a goroutine of its
+	// own, so a gateway stuck in its main loop is restarted.
+	var watchdog <-chan time.Time
+	if interval := service.WatchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+	if cfg.Gateway.Shutdown.Handoff {
+		if handoff.RestartSignal != nil {
+			signals = append(signals, handoff.RestartSignal)
+		} else {
+			logger.WarnC("gateway", "gateway.shutdown.handoff is not supported on this system")
+		}
+	}
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
-	<-sigChan
+	signal.Notify(sigChan, signals...)
+	restarted := false
+	for running := true; running; {
+		select {
+		case sig := <-sigChan:
+			switch {
+			case sig == syscall.SIGHUP:
+				reloadOnSignal(reload)
+			case handoff.RestartSignal != nil && sig == handoff.RestartSignal:
+				restarted = restartGateway()
+				running = !restarted
+			default:
+				running = false
+			}
+		case <-serviceStop:
+			running = false
+		case <-watchdog:
+			if agentLoop.Running() {
+				notifyService("WATCHDOG=1")
+			}
+		}
+	}
 
 	fmt.Println("\nShutting down...")
+	notifyService("STOPPING=1")
+	events.Publish(eventBus, events.GatewayStatus, events.Status{State: events.GatewayDraining, Time: time.Now()})
+	if restarted {
+		// The new gateway answers on the shared sockets alone. Chat
+		// apps' webhooks stay open for the replies of running answers;
+		// messages that still come in are kept for the new gateway.
+		healthServer.Stop(context.Background())
+		if adminServer != nil {
+			adminServer.Stop(context.Background())
+		}
+	}
+	deviceService.Stop()
+	triggerService.Stop()
+	heartbeatService.Stop()
+	cronService.Stop()
+	drainGateway(agentLoop, channelManager, time.Duration(cfg.Gateway.Shutdown.DrainTimeoutSeconds)*time.Second)
 	if cp, ok := provider.(providers.StatefulProvider); ok {
 		cp.Close()
 	}
 	cancel()
 	healthServer.Stop(context.Background())
-	deviceService.Stop()
-	heartbeatService.Stop()
-	cronService.Stop()
-	agentLoop.Stop()
+	if adminServer != nil {
+		adminServer.Stop(context.Background())
+	}
 	channelManager.StopAll(ctx)
+	channelManager.HoldUnsent()
+	agentLoop.Stop()
+	events.Publish(eventBus, events.GatewayStatus, events.Status{State: events.GatewayStopped, Time: time.Now()})
 	fmt.Println("✓ Gateway stopped")
 }
 
@@ -236,16 +517,409 @@ func setupCronTool(
 
 	// Create cron service
 	cronService := cron.NewCronService(cronStorePath, nil)
+	cronService.SetPolicy(cron.Policy{
+		CatchUp:       cfg.Tools.Cron.CatchUp,
+		Jitter:        time.Duration(cfg.Tools.Cron.JitterSeconds) * time.Second,
+		MaxConcurrent: cfg.Tools.Cron.MaxConcurrent,
+	})
+	agentLoop.SetCronService(cronService)
 
 	// Create and register CronTool
 	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace, restrict, execTimeout, cfg)
 	agentLoop.RegisterTool(cronTool)
+	agentLoop.RegisterTool(tools.NewFollowUpTool(cronService))
 
 	// Set the onJob handler
 	cronService.SetOnJob(func(job *cron.CronJob) (string, error) {
-		result := cronTool.ExecuteJob(context.Background(), job)
-		return result, nil
+		if !agentLoop.ProactiveEnabled() {
+			logger.InfoCF("cron", "Proactive runs are off, skipping job", map[string]any{"job_id": job.ID})
+			return "skipped: proactive runs are off", nil
+		}
+		return cronTool.ExecuteJob(context.Background(), job)
+	})
+
+	// Workflows with a schedule run as cron jobs, with the same history,
+	// catch-up and failure alerts as the others.
+	workflows := workflow.NewService(workspace, agentLoop.WorkflowEnv())
+	agentLoop.SetWorkflows(workflows)
+	cronTool.SetWorkflowRunner(workflows)
+	if err := workflows.Schedule(cronService); err != nil {
+		logger.WarnCF("workflow", "Some workflows are not scheduled", map[string]any{"error": err.Error()})
+	}
+
+	// Jobs that keep failing, at 3 a.m. too, are reported to the admin.
+	events := state.NewEventLog(cfg.WorkspacePath())
+	cronService.SetAlerter(cfg.Tools.Cron.AlertAfter, func(job cron.CronJob) {
+		ev := state.RunEvent{Kind: "cron_failing", Source: job.ID}
+		content := fmt.Sprintf("⚠️ The scheduled job %q (%s) failed %d times in a row. Last error: %s\nSee /jobs %s",
+			job.Name, job.ID, job.State.ConsecutiveFailures, job.State.LastError, job.ID)
+		if job.State.ConsecutiveFailures == 0 {
+			ev.Kind = "cron_recovered"
+			content = fmt.Sprintf("✅ The scheduled job %q (%s) runs again.", job.Name, job.ID)
+		}
+		ev.Message = job.State.LastError
+		if err := events.Append(ev); err != nil {
+			logger.WarnCF("cron", "Failed to record run event", map[string]any{"error": err.Error()})
+		}
+		if sup := cfg.Gateway.Supervisor; sup.AlertChannel != "" && sup.AlertChatID != "" {
+			msgBus.PublishOutbound(bus.OutboundMessage{
+				Channel: sup.AlertChannel, ChatID: sup.AlertChatID, Content: content, Proactive: true, Urgent: true,
+			})
+		}
 	})
 
 	return cronService
 }
+
+// watchConfig applies edits of the config file and its layers to the
+// running gateway: agent settings, tool policies and allowlists take
+// effect right away, other changes are logged as waiting for a restart.
+// Edits that do not load or validate, or in strict mode have unknown keys,
+// are refused and reported to the admin chat, and the running config stays
+// as it was. /reload in an admin chat applies edits right away.
+func watchConfig(
+	ctx context.Context,
+	path string,
+	strict, debug bool,
+	cfg *config.Config,
+	agentLoop *agent.AgentLoop,
+	channelManager *channels.Manager,
+) func() ([]config.Change, error) {
+	watcher, err := config.NewWatcher(path)
+	if err != nil {
+		logger.WarnCF("config", "Not watching the config for changes", map[string]any{"error": err.Error()})
+		return nil
+	}
+	watcher.Strict = strict
+	record := func(ev state.RunEvent) {
+		events.Publish(agentLoop.Events(), events.RunEvent, ev)
+	}
+
+	apply := func(next *config.Config, changes []config.Change) {
+		var live, later []string
+		for _, c := range changes {
+			logger.InfoCF("config", "Config changed", map[string]any{
+				"path": c.Path,
+				"old":  c.Old,
+				"new":  c.New,
+				"live": c.Live(),
+			})
+			if c.Live() {
+				live = append(live, c.Path)
+			} else {
+				later = append(later, c.Path)
+			}
+		}
+		if len(live) > 0 {
+			// The default provider was made at startup for the default
+			// model, which takes a restart to change.
+			next.Agents.Defaults.ModelName = cfg.Agents.Defaults.ModelName
+			next.Agents.Defaults.Model = cfg.Agents.Defaults.Model
+			next.Agents.Defaults.Provider = cfg.Agents.Defaults.Provider
+			agentLoop.ReloadConfig(next)
+			channelManager.SetAllowLists(next)
+			if slices.ContainsFunc(live, func(path string) bool { return strings.HasPrefix(path, "gateway.log") }) {
+				applyLogConfig(next.Gateway.Log, debug)
+			}
+			record(state.RunEvent{Kind: "config_reloaded", Source: path, Message: "Applied " + strings.Join(live, ", ")})
+		}
+		if len(changes) > 0 {
+			events.Publish(agentLoop.Events(), events.ConfigReloaded, events.Reload{Path: path, Live: live, Later: later})
+		}
+		if len(changes) > 0 {
+			agentLoop.Audit(state.AuditEntry{
+				Action:  "config_reloaded",
+				Target:  path,
+				Outcome: "ok",
+				Detail:  "Applied " + strings.Join(live, ", ") + "; after a restart " + strings.Join(later, ", "),
+			})
+		}
+		if len(later) > 0 {
+			logger.WarnCF("config", "Some config changes take effect after a restart",
+				map[string]any{"paths": strings.Join(later, ", ")})
+		}
+	}
+	refuse := func(err error) {
+		logger.ErrorCF("config", "Refused the edited config, keeping the running one",
+			map[string]any{"path": path, "error": err.Error()})
+		record(state.RunEvent{Kind: "config_rejected", Source: path, Message: err.Error()})
+		agentLoop.Audit(state.AuditEntry{Action: "config_reloaded", Target: path, Outcome: "failed", Detail: err.Error()})
+	}
+	reject := func(err error) {
+		refuse(err)
+		if sup := cfg.Gateway.Supervisor; sup.AlertChannel != "" && sup.AlertChatID != "" {
+			content := fmt.Sprintf("⚠️ The edited config was not applied: %v", err)
+			if err := channelManager.SendToChannel(ctx, sup.AlertChannel, sup.AlertChatID, content); err != nil {
+				logger.WarnCF("config", "Failed to report the refused config", map[string]any{"error": err.Error()})
+			}
+		}
+	}
+	// The operator who asked for /reload gets the error as the reply.
+	reload := func() ([]config.Change, error) {
+		changes, err := watcher.Reload(apply)
+		if err != nil {
+			refuse(err)
+		}
+		return changes, err
+	}
+	agentLoop.SetConfigReloader(reload)
+	go watcher.Run(ctx, configCheckInterval, apply, reject)
+	return reload
+}
+
+// startAdminAPI serves the admin API when gateway.admin.api has a port,
+// returning nil when it does not or its certificates fail to load.
+func startAdminAPI(cfg config.AdminAPIConfig, agentLoop *agent.AgentLoop) *adminapi.Server {
+	if !cfg.Enabled() {
+		return nil
+	}
+	server, err := adminapi.NewServer(cfg, agentLoop)
+	if err != nil {
+		fmt.Printf("Error starting the admin API: %v\n", err)
+		return nil
+	}
+	go func() {
+		if err := server.Start(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("admin_api", "Admin API server error", map[string]any{"error": err.Error()})
+		}
+	}()
+	scheme := "http"
+	if cfg.CertFile != "" {
+		scheme = "https"
+	}
+	fmt.Printf("✓ Admin API available at %s://%s:%d/v1/\n", scheme, cfg.Host, cfg.Port)
+	return server
+}
+
+// drainGateway lets the running answers finish, for up to timeout, and
+// sends their replies. Messages that arrive meanwhile are kept for the
+// next start.
+func drainGateway(agentLoop *agent.AgentLoop, channelManager *channels.Manager, timeout time.Duration) {
+	if timeout > 0 {
+		fmt.Printf("Letting running answers finish (up to %s)...\n", timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if n := agentLoop.Drain(ctx); n > 0 {
+		logger.WarnCF("gateway", "Stopping runs that did not finish in time", map[string]any{"runs": n})
+	}
+	// Replies get a few seconds of their own to go out.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	channelManager.Flush(flushCtx)
+}
+
+// restartGateway starts a new gateway on the listening sockets of this
+// one, for gateway.shutdown.handoff, and reports whether it did: this one
+// then drains and stops. It keeps running when the new one fails to start.
+func restartGateway() bool {
+	fmt.Println("\nRestarting...")
+	proc, err := handoff.Restart(2 * time.Minute)
+	if err != nil {
+		logger.ErrorCF("gateway", "Restart failed, still running", map[string]any{"error": err.Error()})
+		fmt.Printf("✗ Restart failed, still running: %v\n", err)
+		return false
+	}
+	// systemd follows the new process from here on.
+	notifyService(fmt.Sprintf("MAINPID=%d", proc.Pid))
+	logger.InfoCF("gateway", "Handed over to a new gateway", map[string]any{"pid": proc.Pid})
+	fmt.Printf("✓ The new gateway (pid %d) is serving\n", proc.Pid)
+	return true
+}
+
+// reloadOnSignal reloads the config on SIGHUP, which systemctl reload
+// sends, telling systemd while it does.
+func reloadOnSignal(reload func() ([]config.Change, error)) {
+	if reload == nil {
+		logger.WarnC("config", "SIGHUP ignored: the config is not watched")
+		return
+	}
+	notifyService("RELOADING=1")
+	changes, err := reload()
+	if err != nil {
+		notifyService("READY=1\nSTATUS=Kept the running config: " + err.Error())
+		return
+	}
+	logger.InfoCF("config", "Reloaded the config on SIGHUP", map[string]any{"changes": len(changes)})
+	notifyService("READY=1")
+}
+
+// applyLogConfig sets the log levels and format of c; with --debug the
+// default level stays debug. It replaces levels set with /loglevel. The
+// entries kept for /logs are kept again only when keep_recent changes.
+func applyLogConfig(c config.LogConfig, debug bool) {
+	if c.KeepRecent != logger.KeptRecent() {
+		logger.KeepRecent(c.KeepRecent)
+	}
+	level := logger.INFO
+	if c.Level != "" {
+		level, _ = logger.ParseLevel(c.Level)
+	}
+	if debug {
+		level = logger.DEBUG
+	}
+	logger.SetLevel(level)
+	components := make(map[string]logger.LogLevel, len(c.Components))
+	for component, name := range c.Components {
+		components[component], _ = logger.ParseLevel(name)
+	}
+	logger.SetComponentLevels(components)
+	if err := logger.SetFormat(c.Format); err != nil {
+		logger.WarnCF("config", "Keeping the log format", map[string]any{"error": err.Error()})
+	}
+}
+
+// logToFile sends what the gateway prints to
+// ~/.picoclaw/logs/gateway.log.
+func logToFile() {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".picoclaw", "logs")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "gateway.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	os.Stdout, os.Stderr = f, f
+	log.SetOutput(f)
+}
+
+// notifyService tells systemd about the gateway's state when systemd
+// started it.
+func notifyService(state string) {
+	if _, err := service.Notify(state); err != nil {
+		logger.WarnCF("service", "Failed to notify the service manager", map[string]any{"error": err.Error()})
+	}
+}
+
+// configCheckInterval is how often the gateway looks for config edits.
+const configCheckInterval = 2 * time.Second
+
+// watchProviderHealth checks a provider's backend, such as a local Ollama
+// server, every 30 seconds. A failing check makes /ready report not ready.
+func watchProviderHealth(ctx context.Context, healthServer *health.Server, checker providers.HealthChecker) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	up := true
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := checker.CheckHealth(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		healthServer.RegisterCheck("provider", func() (bool, string) {
+			if err != nil {
+				return false, err.Error()
+			}
+			return true, "reachable"
+		})
+		if (err == nil) != up {
+			up = err == nil
+			if up {
+				logger.InfoC("gateway", "LLM provider is reachable again")
+			} else {
+				logger.WarnCF("gateway", "LLM provider is unreachable", map[string]any{"error": err.Error()})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// registerProcessMetrics exports the gateway's own memory, goroutines,
+// garbage collection, open files and store sizes on /metrics, so a leak
+// shows before the system runs out of memory.
+func registerProcessMetrics(healthServer *health.Server, agentLoop *agent.AgentLoop) {
+	process := func(value func(p agent.ProcessStatus) float64) func() float64 {
+		return func() float64 { return value(agent.ReadProcessStatus()) }
+	}
+	healthServer.RegisterGauge("picoclaw_process_goroutines", "Goroutines of the gateway process.",
+		process(func(p agent.ProcessStatus) float64 { return float64(p.Goroutines) }))
+	healthServer.RegisterGauge("picoclaw_process_heap_bytes", "Bytes of allocated heap objects.",
+		process(func(p agent.ProcessStatus) float64 { return float64(p.HeapBytes) }))
+	healthServer.RegisterGauge("picoclaw_process_sys_bytes", "Bytes of memory obtained from the OS.",
+		process(func(p agent.ProcessStatus) float64 { return float64(p.SysBytes) }))
+	healthServer.RegisterGauge("picoclaw_process_gc_runs", "Garbage collections since the gateway started.",
+		process(func(p agent.ProcessStatus) float64 { return float64(p.GCRuns) }))
+	healthServer.RegisterGauge("picoclaw_process_gc_pause_last_seconds", "How long the last garbage collection stopped the program.",
+		process(func(p agent.ProcessStatus) float64 { return p.GCPauseLast.Seconds() }))
+	healthServer.RegisterGauge("picoclaw_process_gc_pause_seconds_total", "How long garbage collections stopped the program in all.",
+		process(func(p agent.ProcessStatus) float64 { return p.GCPauseTotal.Seconds() }))
+	if agent.ReadProcessStatus().OpenFiles >= 0 {
+		healthServer.RegisterGauge("picoclaw_process_open_fds", "File descriptors the gateway process has open.",
+			process(func(p agent.ProcessStatus) float64 { return float64(p.OpenFiles) }))
+	}
+	healthServer.RegisterGauge("picoclaw_process_uptime_seconds", "Seconds since the gateway process started.",
+		process(func(p agent.ProcessStatus) float64 { return float64(p.UptimeSeconds) }))
+	healthServer.RegisterGaugeVec("picoclaw_store_bytes", "Size of a workspace store, read at most once a minute.", "store",
+		func() map[string]float64 {
+			values := make(map[string]float64)
+			for _, s := range agentLoop.StoreSizes() {
+				values[s.Name] = float64(s.Bytes)
+			}
+			return values
+		})
+}
+
+// registerEventMetrics counts what is published on the event bus since
+// the gateway started: finished runs by outcome, tool calls and failed
+// ones by tool, and LLM requests by model.
+func registerEventMetrics(healthServer *health.Server, eventBus *events.Bus) {
+	runs, toolCalls, toolErrors, llmRequests := newEventCounts(), newEventCounts(), newEventCounts(), newEventCounts()
+	events.Subscribe(eventBus, events.RunFinished, func(r events.Run) {
+		runs.add(r.Exit)
+	})
+	events.Subscribe(eventBus, events.ToolExecuted, func(c events.ToolCall) {
+		toolCalls.add(c.Tool)
+		if c.Error != "" {
+			toolErrors.add(c.Tool)
+		}
+	})
+	events.Subscribe(eventBus, events.LLMRequested, func(ev state.LLMEvent) {
+		llmRequests.add(ev.Model)
+	})
+	healthServer.RegisterGaugeVec("picoclaw_runs_finished", "Agent runs finished since startup, by outcome: ok, error or panic.", "outcome", runs.values)
+	healthServer.RegisterGaugeVec("picoclaw_tool_calls", "Tool calls since startup, by tool.", "tool", toolCalls.values)
+	healthServer.RegisterGaugeVec("picoclaw_tool_errors", "Tool calls that failed since startup, by tool.", "tool", toolErrors.values)
+	healthServer.RegisterGaugeVec("picoclaw_llm_requests", "LLM requests since startup, by model.", "model", llmRequests.values)
+}
+
+// eventCounts counts events by a label value.
+type eventCounts struct {
+	mu sync.Mutex
+	n  map[string]float64
+}
+
+func newEventCounts() *eventCounts {
+	return &eventCounts{n: make(map[string]float64)}
+}
+
+func (c *eventCounts) add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n[key]++
+}
+
+func (c *eventCounts) values() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.n)
+}
+
+// rateLimitHeadroom returns what is left of a rate limit per API host and
+// model, for those the API reported it for.
+func rateLimitHeadroom(remaining func(ratelimit.Budget) int) map[string]float64 {
+	values := make(map[string]float64)
+	for _, b := range ratelimit.Default.Budgets() {
+		if n := remaining(b); n >= 0 {
+			values[b.Key] = float64(n)
+		}
+	}
+	return values
+}
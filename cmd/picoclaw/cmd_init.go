@@ -0,0 +1,370 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// setupProvider is a provider the setup wizard offers, by the model_list
+// entry of the default config it configures.
+type setupProvider struct {
+	name      string
+	modelName string
+	keyURL    string // where to get an API key; "" when none is needed
+	login     string // picoclaw auth login --provider, for sign-in providers
+	local     bool   // runs on this machine or the network: asks for its address
+}
+
+var setupProviders = []setupProvider{
+	{name: "OpenRouter (100+ models with one key)", modelName: "openrouter-auto", keyURL: "https://openrouter.ai/keys"},
+	{name: "OpenAI", modelName: "gpt-5.2", keyURL: "https://platform.openai.com/api-keys"},
+	{name: "Anthropic", modelName: "claude-sonnet-4.6", keyURL: "https://console.anthropic.com/settings/keys"},
+	{name: "Google Gemini", modelName: "gemini-2.0-flash", keyURL: "https://ai.google.dev/"},
+	{name: "DeepSeek", modelName: "deepseek-chat", keyURL: "https://platform.deepseek.com/"},
+	{name: "Zhipu AI (GLM)", modelName: "glm-4.7", keyURL: "https://open.bigmodel.cn/usercenter/apikeys"},
+	{name: "Qwen", modelName: "qwen-plus", keyURL: "https://dashscope.console.aliyun.com/apiKey"},
+	{name: "Groq", modelName: "llama-3.3-70b", keyURL: "https://console.groq.com/keys"},
+	{name: "Mistral AI", modelName: "mistral-small", keyURL: "https://console.mistral.ai/api-keys"},
+	{name: "Ollama (local, free)", modelName: "llama3", local: true},
+	{name: "Google Antigravity (sign in with Google)", modelName: "gemini-flash", login: "google-antigravity"},
+}
+
+// initCmd runs the setup wizard: it asks for a provider, the chat apps to
+// connect and the guards to keep, then writes a config that passed the same
+// checks as picoclaw config validate.
+func initCmd() {
+	if err := runInit(newWizard(os.Stdin, os.Stdout), getConfigPath()); err != nil {
+		fmt.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runInit runs the setup wizard for the config at configPath.
+func runInit(w *wizard, configPath string) error {
+	fmt.Fprintf(w.out, "%s picoclaw setup\n", logo)
+	fmt.Fprintln(w.out, "Press Enter to take the value in brackets. Ctrl+C quits without writing anything.")
+
+	cfg := config.DefaultConfig()
+	if _, err := os.Stat(configPath); err == nil {
+		choice := w.choose(fmt.Sprintf("A config already exists at %s.", configPath),
+			[]string{"Change it", "Start over with the defaults", "Quit"}, 0)
+		switch choice {
+		case 0:
+			if cfg, err = config.LoadConfigFile(configPath); err != nil {
+				return fmt.Errorf("failed to load the config: %w", err)
+			}
+		case 2:
+			fmt.Fprintln(w.out, "Aborted.")
+			return nil
+		}
+	}
+
+	var next []string
+	next = append(next, w.setupProvider(cfg)...)
+	next = append(next, w.setupChannels(cfg)...)
+	w.setupGuards(cfg)
+
+	if !w.confirm(fmt.Sprintf("\nWrite the config to %s?", configPath), true) {
+		fmt.Fprintln(w.out, "Aborted.")
+		return nil
+	}
+	if err := writeValidatedConfig(configPath, cfg); err != nil {
+		return fmt.Errorf("the config was not written: %w", err)
+	}
+	createWorkspaceTemplates(cfg.WorkspacePath())
+
+	fmt.Fprintf(w.out, "\n%s picoclaw is ready! Config: %s\n", logo, configPath)
+	fmt.Fprintln(w.out, "\nNext steps:")
+	next = append(next, `picoclaw agent -m "Hello!" to try it`)
+	if cfg.Channels.Telegram.Enabled || cfg.Channels.Discord.Enabled ||
+		cfg.Channels.Slack.Enabled || cfg.Channels.WhatsApp.Enabled {
+		next = append(next, "picoclaw gateway to connect the chat apps")
+	}
+	for i, step := range next {
+		fmt.Fprintf(w.out, "  %d. %s\n", i+1, step)
+	}
+	return nil
+}
+
+// setupProvider makes one provider the default model and returns the steps
+// left to do for it.
+func (w *wizard) setupProvider(cfg *config.Config) []string {
+	names := make([]string, len(setupProviders))
+	def := 0
+	for i, p := range setupProviders {
+		names[i] = p.name
+		if p.modelName == cfg.Agents.Defaults.GetModelName() {
+			def = i
+		}
+	}
+	p := setupProviders[w.choose("\nWhich AI provider should answer?", names, def)]
+	entry := modelListEntry(cfg, p.modelName)
+
+	var next []string
+	switch {
+	case p.login != "":
+		next = append(next, "picoclaw auth login --provider "+p.login+" to sign in")
+	case p.local:
+		entry.APIBase = w.ask("Address of the server", entry.APIBase)
+		model := w.ask("Model to run", strings.TrimPrefix(entry.Model, "ollama/"))
+		entry.Model = "ollama/" + model
+		next = append(next, "ollama pull "+model+" on the server, if it is not there yet")
+	default:
+		fmt.Fprintf(w.out, "Get an API key at %s\n", p.keyURL)
+		entry.APIKey = w.secret("API key", entry.APIKey)
+		if entry.APIKey == "" {
+			next = append(next, fmt.Sprintf("add the API key to the %q entry of model_list", entry.ModelName))
+		}
+	}
+	cfg.Agents.Defaults.ModelName = entry.ModelName
+	cfg.Agents.Defaults.Model = ""
+	return next
+}
+
+// modelListEntry returns the model_list entry named name, adding the one of
+// the default config when the list no longer has it.
+func modelListEntry(cfg *config.Config, name string) *config.ModelConfig {
+	for i := range cfg.ModelList {
+		if cfg.ModelList[i].ModelName == name {
+			return &cfg.ModelList[i]
+		}
+	}
+	for _, m := range config.DefaultConfig().ModelList {
+		if m.ModelName == name {
+			cfg.ModelList = append(cfg.ModelList, m)
+			return &cfg.ModelList[len(cfg.ModelList)-1]
+		}
+	}
+	cfg.ModelList = append(cfg.ModelList, config.ModelConfig{ModelName: name})
+	return &cfg.ModelList[len(cfg.ModelList)-1]
+}
+
+// setupChannels connects the chat apps the user picks and returns the
+// steps left to do for them.
+func (w *wizard) setupChannels(cfg *config.Config) []string {
+	fmt.Fprintln(w.out, "\nChat apps let you talk to the agent from your phone. Without one, use picoclaw chat.")
+	ch := &cfg.Channels
+	var next []string
+
+	if w.confirm("Connect Telegram?", ch.Telegram.Enabled) {
+		fmt.Fprintln(w.out, "Create a bot with @BotFather and paste the token it gives you.")
+		ch.Telegram.Enabled = true
+		ch.Telegram.Token = w.secret("Bot token", ch.Telegram.Token)
+		ch.Telegram.AllowFrom = w.allowFrom("Your Telegram user ID (@userinfobot tells you)", ch.Telegram.AllowFrom)
+	}
+	if w.confirm("Connect Discord?", ch.Discord.Enabled) {
+		fmt.Fprintln(w.out, "Create a bot at https://discord.com/developers/applications and enable the Message Content intent.")
+		ch.Discord.Enabled = true
+		ch.Discord.Token = w.secret("Bot token", ch.Discord.Token)
+		ch.Discord.AllowFrom = w.allowFrom("Your Discord user ID", ch.Discord.AllowFrom)
+	}
+	if w.confirm("Connect Slack?", ch.Slack.Enabled) {
+		fmt.Fprintln(w.out, "Create an app with Socket Mode at https://api.slack.com/apps.")
+		ch.Slack.Enabled = true
+		ch.Slack.BotToken = w.secret("Bot token (xoxb-...)", ch.Slack.BotToken)
+		ch.Slack.AppToken = w.secret("App token (xapp-...)", ch.Slack.AppToken)
+		ch.Slack.AllowFrom = w.allowFrom("Your Slack member ID", ch.Slack.AllowFrom)
+	}
+	if w.confirm("Connect WhatsApp?", ch.WhatsApp.Enabled) {
+		ch.WhatsApp.Enabled = true
+		next = append(next, w.setupWhatsApp(&ch.WhatsApp)...)
+		ch.WhatsApp.AllowFrom = w.allowFrom("Your phone number, with the country code", ch.WhatsApp.AllowFrom)
+	}
+	return next
+}
+
+// setupWhatsApp links picoclaw as a WhatsApp device by QR code, or uses the
+// bridge when this build has no native WhatsApp or the user prefers it.
+func (w *wizard) setupWhatsApp(wa *config.WhatsAppConfig) []string {
+	if !w.confirm("Link picoclaw as a device of your WhatsApp now, by QR code?", true) {
+		wa.UseNative = false
+		wa.BridgeURL = w.ask("Address of the WhatsApp bridge", wa.BridgeURL)
+		return nil
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	if err := channels.PairWhatsApp(ctx, *wa, w.out); err != nil {
+		fmt.Fprintf(w.out, "✗ WhatsApp was not linked: %v\n", err)
+		if w.confirm("Use the WhatsApp bridge instead?", true) {
+			wa.UseNative = false
+			wa.BridgeURL = w.ask("Address of the WhatsApp bridge", wa.BridgeURL)
+			return nil
+		}
+		wa.UseNative = true
+		return []string{"picoclaw whatsapp login to link WhatsApp"}
+	}
+	wa.UseNative = true
+	fmt.Fprintln(w.out, "✓ WhatsApp linked.")
+	return nil
+}
+
+// allowFrom asks who may talk to the agent in a chat app. An empty answer
+// lets everyone, after a warning.
+func (w *wizard) allowFrom(prompt string, current config.FlexibleStringSlice) config.FlexibleStringSlice {
+	fmt.Fprintln(w.out, "Only the people you list can talk to the agent. Separate several with commas.")
+	answer := w.ask(prompt, strings.Join(current, ","))
+	var ids config.FlexibleStringSlice
+	for _, id := range strings.Split(answer, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(w.out, "! Nobody listed: anyone who finds the bot can use it and your API key.")
+	}
+	return ids
+}
+
+// setupGuards asks which of the built-in guards to keep.
+func (w *wizard) setupGuards(cfg *config.Config) {
+	fmt.Fprintln(w.out, "\nGuards limit what the agent can do on this machine.")
+	d := &cfg.Agents.Defaults
+	d.RestrictToWorkspace = w.confirm("Keep file and shell tools inside the workspace?", d.RestrictToWorkspace)
+	exec := &cfg.Tools.Exec
+	exec.EnableDenyPatterns = w.confirm("Block dangerous shell commands (rm -rf, shutdown, dd, ...)?",
+		exec.EnableDenyPatterns)
+	c := &cfg.Memory.Consolidation
+	was := c.Enabled
+	c.Enabled = w.confirm("Let the agent tidy what it remembers once a day?", was)
+	if c.Enabled {
+		// New to consolidation, approving the first rounds is the safe start.
+		c.RequireApproval = w.confirm("Only with your approval (/memories approve)?", c.RequireApproval || !was)
+	}
+}
+
+// writeValidatedConfig writes cfg to path only once it loads and validates
+// like a config the gateway would start with.
+func writeValidatedConfig(path string, cfg *config.Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := config.SaveConfig(tmp.Name(), cfg); err != nil {
+		return err
+	}
+	if _, err := config.LoadConfig(tmp.Name()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// wizard asks the setup questions on a terminal, or reads the answers line
+// by line from a pipe.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int // terminal to read secrets from without echo; -1 when in is not one
+}
+
+func newWizard(in *os.File, out io.Writer) *wizard {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		fd = -1
+	}
+	return &wizard{in: bufio.NewReader(in), out: out, fd: fd}
+}
+
+// ask asks for a value and returns def for an empty answer or at the end of
+// the input.
+func (w *wizard) ask(prompt, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(w.out)
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// secret asks for a token without echoing it. An empty answer keeps
+// current, which is shown masked.
+func (w *wizard) secret(prompt, current string) string {
+	if current != "" {
+		prompt += " [" + maskSecret(current) + "]"
+	}
+	if w.fd < 0 {
+		if answer := w.ask(prompt, ""); answer != "" {
+			return answer
+		}
+		return current
+	}
+	fmt.Fprintf(w.out, "%s: ", prompt)
+	answer, err := term.ReadPassword(w.fd)
+	fmt.Fprintln(w.out)
+	if s := strings.TrimSpace(string(answer)); err == nil && s != "" {
+		return s
+	}
+	return current
+}
+
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:4] + "…" + s[len(s)-4:]
+}
+
+// confirm asks a yes/no question.
+func (w *wizard) confirm(prompt string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		switch strings.ToLower(w.ask(prompt+" ("+hint+")", "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Fprintln(w.out, "Please answer y or n.")
+	}
+}
+
+// choose asks for one of options by number and returns its index.
+func (w *wizard) choose(prompt string, options []string, def int) int {
+	fmt.Fprintln(w.out, prompt)
+	for i, o := range options {
+		fmt.Fprintf(w.out, "  %d) %s\n", i+1, o)
+	}
+	for {
+		answer := w.ask("Choice", strconv.Itoa(def+1))
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return n - 1
+		}
+		fmt.Fprintf(w.out, "Please enter a number from 1 to %d.\n", len(options))
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// scriptedWizard answers the wizard's questions with lines, one per
+// question, as when the input is piped.
+func scriptedWizard(lines ...string) (*wizard, *strings.Builder) {
+	out := &strings.Builder{}
+	in := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	return &wizard{in: bufio.NewReader(in), out: out, fd: -1}, out
+}
+
+// setHome points the home directory, where the workspace goes, at a
+// temporary one.
+func setHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+}
+
+func TestRunInit_WritesTheConfig(t *testing.T) {
+	setHome(t)
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	w, out := scriptedWizard(
+		"3",           // Anthropic
+		"sk-ant-test", // API key
+		"y",           // Telegram
+		"123:abc",     // bot token
+		" 42, 43 ,",   // allowlist
+		"n",           // Discord
+		"",            // Slack, no by default
+		"n",           // WhatsApp
+		"",            // keep tools in the workspace
+		"n",           // do not block dangerous commands
+		"y",           // tidy memories
+		"",            // only with approval
+		"y",           // write the config
+	)
+	if err := runInit(w, configPath); err != nil {
+		t.Fatalf("runInit: %v\n%s", err, out)
+	}
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("the written config does not load: %v", err)
+	}
+	if cfg.Agents.Defaults.ModelName != "claude-sonnet-4.6" {
+		t.Errorf("default model = %q", cfg.Agents.Defaults.ModelName)
+	}
+	if m, err := cfg.GetModelConfig("claude-sonnet-4.6"); err != nil || m.APIKey != "sk-ant-test" {
+		t.Errorf("model_list entry = %+v, %v", m, err)
+	}
+	tg := cfg.Channels.Telegram
+	if !tg.Enabled || tg.Token != "123:abc" || !slices.Equal(tg.AllowFrom, config.FlexibleStringSlice{"42", "43"}) {
+		t.Errorf("telegram = enabled %v, token %q, allow_from %v", tg.Enabled, tg.Token, tg.AllowFrom)
+	}
+	if cfg.Channels.Discord.Enabled || cfg.Channels.Slack.Enabled || cfg.Channels.WhatsApp.Enabled {
+		t.Error("a chat app that was declined is enabled")
+	}
+	if !cfg.Agents.Defaults.RestrictToWorkspace || cfg.Tools.Exec.EnableDenyPatterns {
+		t.Errorf("guards: restrict_to_workspace %v, deny patterns %v",
+			cfg.Agents.Defaults.RestrictToWorkspace, cfg.Tools.Exec.EnableDenyPatterns)
+	}
+	if c := cfg.Memory.Consolidation; !c.Enabled || !c.RequireApproval {
+		t.Errorf("consolidation = %+v", c)
+	}
+	if _, err := os.Stat(cfg.WorkspacePath()); err != nil {
+		t.Errorf("workspace not created: %v", err)
+	}
+	if !strings.Contains(out.String(), "picoclaw gateway to connect the chat apps") {
+		t.Errorf("next steps missing:\n%s", out)
+	}
+}
+
+func TestRunInit_ChangesAnExistingConfig(t *testing.T) {
+	setHome(t)
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.DefaultConfig()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.Channels.Telegram.Token = "123:secret-token"
+	cfg.Channels.Telegram.AllowFrom = config.FlexibleStringSlice{"42"}
+	if err := config.SaveConfig(configPath, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quitting leaves the config alone.
+	before, _ := os.ReadFile(configPath)
+	w, _ := scriptedWizard("3")
+	if err := runInit(w, configPath); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(configPath); string(after) != string(before) {
+		t.Error("quitting changed the config")
+	}
+
+	// Enter keeps what the config has; the token is not shown in full.
+	w, out := scriptedWizard(
+		"1",  // change it
+		"10", // Ollama
+		"",   // server address
+		"",   // model
+		"",   // Telegram stays connected
+		"",   // bot token
+		"",   // allowlist
+		"n",  // Discord
+		"n",  // Slack
+		"n",  // WhatsApp
+		"",   // keep tools in the workspace
+		"",   // block dangerous commands
+		"",   // no memory tidying, as before
+		"",   // write the config
+	)
+	if err := runInit(w, configPath); err != nil {
+		t.Fatalf("runInit: %v\n%s", err, out)
+	}
+	if strings.Contains(out.String(), "secret-token") || !strings.Contains(out.String(), "Bot token [123:…oken]") {
+		t.Errorf("the token is not masked:\n%s", out)
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := cfg.Channels.Telegram
+	if !tg.Enabled || tg.Token != "123:secret-token" || !slices.Equal(tg.AllowFrom, config.FlexibleStringSlice{"42"}) {
+		t.Errorf("telegram = enabled %v, token %q, allow_from %v", tg.Enabled, tg.Token, tg.AllowFrom)
+	}
+	if m, _ := cfg.GetModelConfig(cfg.Agents.Defaults.ModelName); m == nil || m.Model != "ollama/llama3" {
+		t.Errorf("default model = %q, %+v", cfg.Agents.Defaults.ModelName, m)
+	}
+}
+
+func TestRunInit_AbortWritesNothing(t *testing.T) {
+	setHome(t)
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	w, out := scriptedWizard("1", "", "n", "n", "n", "n", "", "", "", "n")
+	if err := runInit(w, configPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		t.Errorf("a config was written after declining: %v", err)
+	}
+	if !strings.Contains(out.String(), "Aborted.") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+func TestWizard_RejectsInvalidAnswers(t *testing.T) {
+	w, out := scriptedWizard("0", "two", "2")
+	if got := w.choose("Pick one", []string{"a", "b", "c"}, 0); got != 1 {
+		t.Errorf("choose = %d, want 1", got)
+	}
+	if n := strings.Count(out.String(), "Please enter a number from 1 to 3."); n != 2 {
+		t.Errorf("choose warned %d times:\n%s", n, out)
+	}
+
+	w, out = scriptedWizard("maybe", "YES")
+	if !w.confirm("Sure?", false) {
+		t.Error("confirm = false after YES")
+	}
+	if !strings.Contains(out.String(), "Please answer y or n.") {
+		t.Errorf("confirm did not ask again:\n%s", out)
+	}
+
+	// At the end of the input, the defaults are taken.
+	w, _ = scriptedWizard()
+	if !w.confirm("Sure?", true) || w.choose("Pick one", []string{"a", "b"}, 1) != 1 || w.ask("Name", "pico") != "pico" {
+		t.Error("defaults not taken at the end of the input")
+	}
+}
+
+func TestWizard_WarnsAboutAnEmptyAllowlist(t *testing.T) {
+	const warning = "! Nobody listed: anyone who finds the bot can use it and your API key."
+	w, out := scriptedWizard(" , ")
+	if ids := w.allowFrom("Your user ID", nil); len(ids) != 0 {
+		t.Errorf("allowFrom = %v", ids)
+	}
+	if !strings.Contains(out.String(), warning) {
+		t.Errorf("no warning for an empty allowlist:\n%s", out)
+	}
+
+	w, out = scriptedWizard("7")
+	if ids := w.allowFrom("Your user ID", nil); !slices.Equal(ids, config.FlexibleStringSlice{"7"}) {
+		t.Errorf("allowFrom = %v", ids)
+	}
+	if strings.Contains(out.String(), warning) {
+		t.Errorf("warned about a non-empty allowlist:\n%s", out)
+	}
+}
+
+func TestWriteValidatedConfig_RefusesAnInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Admin.Chats = config.FlexibleStringSlice{"telegram:42"}
+	if err := writeValidatedConfig(path, cfg); err == nil {
+		t.Fatal("wrote a config that does not validate")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the invalid config is there: %v", err)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".config-*")); len(tmp) != 0 {
+		t.Errorf("temporary files left: %v", tmp)
+	}
+}
@@ -0,0 +1,162 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func ollamaCmd() {
+	if len(os.Args) < 3 {
+		ollamaHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	provider := providers.NewOllamaProvider(ollamaAPIBase(cfg), "")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch os.Args[2] {
+	case "list":
+		ollamaListCmd(ctx, provider)
+	case "pull":
+		models := os.Args[3:]
+		if len(models) == 0 {
+			models = configuredOllamaModels(cfg)
+		}
+		if len(models) == 0 {
+			fmt.Println("Usage: picoclaw ollama pull <model>")
+			fmt.Println("Without a model, the ollama/ models of model_list are pulled; there are none.")
+			return
+		}
+		for _, model := range models {
+			if err := ollamaPullCmd(ctx, provider, model); err != nil {
+				fmt.Printf("\nError: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	case "status":
+		ollamaStatusCmd(ctx, cfg, provider)
+	default:
+		fmt.Printf("Unknown ollama command: %s\n", os.Args[2])
+		ollamaHelp()
+	}
+}
+
+func ollamaHelp() {
+	fmt.Println("\nOllama commands:")
+	fmt.Println("  list              List the models on the Ollama server")
+	fmt.Println("  pull [model...]   Download models (default: the ollama/ models in model_list)")
+	fmt.Println("  status            Check the server and whether the configured models are there")
+	fmt.Println()
+}
+
+// ollamaAPIBase returns the server address of the first ollama/ entry in
+// model_list.
+func ollamaAPIBase(cfg *config.Config) string {
+	for _, m := range cfg.ModelList {
+		if protocol, _ := providers.ExtractProtocol(m.Model); protocol == "ollama" && m.APIBase != "" {
+			return m.APIBase
+		}
+	}
+	return cfg.Providers.Ollama.APIBase
+}
+
+func configuredOllamaModels(cfg *config.Config) []string {
+	var models []string
+	seen := make(map[string]bool)
+	for _, m := range cfg.ModelList {
+		protocol, id := providers.ExtractProtocol(m.Model)
+		if protocol == "ollama" && !seen[id] {
+			seen[id] = true
+			models = append(models, id)
+		}
+	}
+	return models
+}
+
+func ollamaListCmd(ctx context.Context, provider *providers.OllamaProvider) {
+	models, err := provider.List(ctx)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(models) == 0 {
+		fmt.Println("No models on the server. Pull one with: picoclaw ollama pull <model>")
+		return
+	}
+	for _, m := range models {
+		fmt.Printf("  %-32s %8s  %-6s %-8s %s\n", m.Name, formatBytes(m.Size), m.ParameterSize, m.Quantization,
+			m.ModifiedAt.Format("2006-01-02"))
+	}
+}
+
+func ollamaPullCmd(ctx context.Context, provider *providers.OllamaProvider, model string) error {
+	fmt.Printf("Pulling %s\n", model)
+	last := time.Time{}
+	err := provider.Pull(ctx, model, func(p providers.OllamaPullProgress) {
+		if p.Total > 0 {
+			// Redraw the progress line at most a few times a second.
+			if time.Since(last) < 200*time.Millisecond && p.Completed < p.Total {
+				return
+			}
+			last = time.Now()
+			fmt.Printf("\r  %-40s %3d%% of %s", p.Status, p.Completed*100/p.Total, formatBytes(p.Total))
+			return
+		}
+		fmt.Printf("\r%s\r  %s\n", strings.Repeat(" ", 70), p.Status)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ %s is ready\n", model)
+	return nil
+}
+
+func ollamaStatusCmd(ctx context.Context, cfg *config.Config, provider *providers.OllamaProvider) {
+	models, err := provider.List(ctx)
+	if err != nil {
+		fmt.Printf("✗ Ollama at %s: %v\n", provider.BaseURL(), err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Ollama at %s (%d models)\n", provider.BaseURL(), len(models))
+
+	available := make(map[string]bool)
+	for _, m := range models {
+		available[m.Name] = true
+		available[strings.TrimSuffix(m.Name, ":latest")] = true
+	}
+	for _, model := range configuredOllamaModels(cfg) {
+		if available[model] {
+			fmt.Printf("  ✓ %s\n", model)
+		} else {
+			fmt.Printf("  ✗ %s is not pulled (picoclaw ollama pull %s)\n", model, model)
+		}
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.0f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+}
@@ -51,6 +51,8 @@ func onboard() {
 	fmt.Println("     See README.md for 17+ supported providers.")
 	fmt.Println("")
 	fmt.Println("  2. Chat: picoclaw agent -m \"Hello!\"")
+	fmt.Println("")
+	fmt.Println("Or run picoclaw init to set up the provider, chat apps and guards step by step.")
 }
 
 func copyEmbeddedToTarget(targetDir string) error {
@@ -0,0 +1,163 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/plugins"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func pluginHelp() {
+	fmt.Println("\nPlugin commands:")
+	fmt.Println("  list                                  List installed plugins")
+	fmt.Println("  install <url|path> [--sha256 <hex>]   Install a plugin archive")
+	fmt.Println("  update <name> [--sha256 <hex>]        Install a plugin again from where it came from")
+	fmt.Println("  remove <name>                         Remove an installed plugin")
+	fmt.Println()
+	fmt.Println("An archive is installed when it has the given SHA-256 checksum, or when")
+	fmt.Println("<url|path>.sig holds its signature by a key in plugins.trusted_keys.")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw plugin install https://example.com/weather-1.2.0.zip")
+	fmt.Println("  picoclaw plugin install ./weather.zip --sha256 9f86d081884c7d65...")
+	fmt.Println("  picoclaw plugin update weather")
+}
+
+func pluginCmd() {
+	if len(os.Args) < 3 {
+		pluginHelp()
+		return
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	installer, err := plugins.NewInstaller(filepath.Join(cfg.WorkspacePath(), "plugins"), cfg.Plugins.TrustedKeys)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	args, checksum := pluginArgs(os.Args[3:])
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch os.Args[2] {
+	case "list":
+		pluginListCmd(installer)
+	case "install":
+		if len(args) != 1 {
+			fmt.Println("Usage: picoclaw plugin install <url|path> [--sha256 <hex>]")
+			return
+		}
+		p, err := installer.Install(ctx, args[0], checksum)
+		auditPlugin(cfg.WorkspacePath(), "plugin_installed", args[0], p, err)
+		if err != nil {
+			fmt.Printf("✗ Failed to install plugin: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Installed plugin %s %s (%s)\n", p.Name, p.Version, pluginSummary(p))
+		fmt.Println("  Restart the gateway to load it.")
+	case "update":
+		if len(args) != 1 {
+			fmt.Println("Usage: picoclaw plugin update <name> [--sha256 <hex>]")
+			return
+		}
+		p, err := installer.Update(ctx, args[0], checksum)
+		auditPlugin(cfg.WorkspacePath(), "plugin_updated", args[0], p, err)
+		if err != nil {
+			fmt.Printf("✗ Failed to update plugin: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Updated plugin %s to %s (%s)\n", p.Name, p.Version, pluginSummary(p))
+		fmt.Println("  Restart the gateway to load it.")
+	case "remove", "uninstall":
+		if len(args) != 1 {
+			fmt.Println("Usage: picoclaw plugin remove <name>")
+			return
+		}
+		err := installer.Remove(args[0])
+		auditPlugin(cfg.WorkspacePath(), "plugin_removed", args[0], nil, err)
+		if err != nil {
+			fmt.Printf("✗ Failed to remove plugin: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Removed plugin %s. Restart the gateway to unload it.\n", args[0])
+	default:
+		fmt.Printf("Unknown plugin command: %s\n", os.Args[2])
+		pluginHelp()
+	}
+}
+
+// pluginArgs takes --sha256 <hex> out of args.
+func pluginArgs(args []string) (rest []string, checksum string) {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--sha256" && i+1 < len(args) {
+			checksum = args[i+1]
+			i++
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return rest, checksum
+}
+
+func pluginListCmd(installer *plugins.Installer) {
+	installed := installer.List()
+	if len(installed) == 0 {
+		fmt.Println("No plugins installed.")
+		return
+	}
+	fmt.Println("\nInstalled Plugins:")
+	fmt.Println("------------------")
+	for _, p := range installed {
+		fmt.Printf("  ✓ %s %s (%s)\n", p.Name, p.Version, pluginSummary(p))
+		if p.Description != "" {
+			fmt.Printf("    %s\n", p.Description)
+		}
+		if p.Origin.Source != "" {
+			fmt.Printf("    from %s, verified by %s\n", p.Origin.Source, p.Origin.VerifiedBy)
+		}
+	}
+}
+
+// auditPlugin records an install, update or removal of a plugin.
+func auditPlugin(workspace, action, target string, p *plugins.Plugin, err error) {
+	e := state.AuditEntry{Action: action, Target: target, Outcome: "ok"}
+	switch {
+	case err != nil:
+		e.Outcome, e.Detail = "failed", err.Error()
+	case p != nil:
+		e.Target = p.Name
+		e.Detail = fmt.Sprintf("%s from %s, sha256 %s, verified by %s",
+			p.Version, p.Origin.Source, p.Origin.SHA256, p.Origin.VerifiedBy)
+	}
+	auditCLI(workspace, e)
+}
+
+// pluginSummary lists what a plugin provides.
+func pluginSummary(p *plugins.Plugin) string {
+	var parts []string
+	for _, t := range p.Tools {
+		parts = append(parts, "tool "+t.Name)
+	}
+	if n := len(p.Hooks); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d outbound hooks", n))
+	}
+	for _, s := range p.Skills {
+		parts = append(parts, "skill "+s)
+	}
+	if len(parts) == 0 {
+		return "nothing to load"
+	}
+	return strings.Join(parts, ", ")
+}
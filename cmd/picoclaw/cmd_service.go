@@ -0,0 +1,230 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/sipeed/picoclaw/pkg/service"
+)
+
+func serviceCmd() {
+	if len(os.Args) < 3 {
+		serviceHelp()
+		return
+	}
+
+	opts := service.Options{Args: []string{"gateway"}, WatchdogSeconds: 60}
+	dryRun := false
+	for _, arg := range os.Args[3:] {
+		switch arg {
+		case "--system":
+			opts.System = true
+		case "--print":
+			dryRun = true
+		case "--strict":
+			opts.Args = append(opts.Args, "--strict")
+		case "--no-watchdog":
+			opts.WatchdogSeconds = 0
+		default:
+			fmt.Printf("Unknown option: %s\n", arg)
+			serviceHelp()
+			os.Exit(1)
+		}
+	}
+
+	var err error
+	switch os.Args[2] {
+	case "install":
+		err = serviceInstall(opts, dryRun)
+	case "uninstall":
+		err = serviceUninstall(opts.System)
+	default:
+		fmt.Printf("Unknown service command: %s\n", os.Args[2])
+		serviceHelp()
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serviceInstall writes the systemd unit, or the launchd plist on macOS,
+// for the running executable and starts the service. On Windows it creates
+// a Windows service.
+func serviceInstall(opts service.Options, dryRun bool) error {
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if binary, err = filepath.EvalSymlinks(binary); err != nil {
+		return err
+	}
+	opts.Binary = binary
+	// sudo picoclaw service install --system runs the gateway as the user
+	// who asked, with their ~/.picoclaw.
+	if opts.System {
+		opts.User = os.Getenv("SUDO_USER")
+	}
+
+	var path, content string
+	var start [][]string
+	switch runtime.GOOS {
+	case "linux":
+		if path, err = service.SystemdUnitPath(opts.System); err != nil {
+			return err
+		}
+		content = service.SystemdUnit(opts)
+		systemctl := []string{"systemctl"}
+		if !opts.System {
+			systemctl = append(systemctl, "--user")
+		}
+		start = [][]string{
+			slices.Concat(systemctl, []string{"daemon-reload"}),
+			slices.Concat(systemctl, []string{"enable", "--now", service.Name + ".service"}),
+		}
+	case "darwin":
+		if path, err = service.LaunchdPlistPath(opts.System); err != nil {
+			return err
+		}
+		home, _ := os.UserHomeDir()
+		opts.LogDir = filepath.Join(home, ".picoclaw", "logs")
+		content = service.LaunchdPlist(opts)
+		start = [][]string{{"launchctl", "load", "-w", path}}
+	case "windows":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		opts.LogDir = filepath.Join(home, ".picoclaw", "logs")
+		start = service.WindowsServiceCommands(opts, home)
+	default:
+		return fmt.Errorf("services are only supported with systemd, launchd and Windows, not on %s", runtime.GOOS)
+	}
+
+	if dryRun {
+		if path == "" {
+			for _, cmd := range start {
+				fmt.Println(service.WindowsCommandLine(cmd))
+			}
+			return nil
+		}
+		fmt.Printf("# %s\n%s", path, content)
+		return nil
+	}
+	if opts.LogDir != "" {
+		if err := os.MkdirAll(opts.LogDir, 0o755); err != nil {
+			return err
+		}
+	}
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Wrote %s\n", path)
+	}
+	for _, cmd := range start {
+		if err := runServiceCommand(cmd); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("✓ The gateway runs as a service and starts again after a failure or reboot.")
+	if runtime.GOOS == "linux" {
+		scope := "--user "
+		if opts.System {
+			scope = ""
+		}
+		fmt.Printf("  Logs:   journalctl %s-u %s -f\n", scope, service.Name)
+		fmt.Printf("  Reload: systemctl %sreload %s\n", scope, service.Name)
+		if !opts.System {
+			fmt.Println("  To keep it running after you log out: loginctl enable-linger $USER")
+		}
+	} else {
+		fmt.Printf("  Logs: %s\n", filepath.Join(opts.LogDir, "gateway.log"))
+	}
+	return nil
+}
+
+// serviceUninstall stops the service and removes what serviceInstall wrote.
+func serviceUninstall(system bool) error {
+	var path string
+	var stop [][]string
+	var err error
+	switch runtime.GOOS {
+	case "linux":
+		if path, err = service.SystemdUnitPath(system); err != nil {
+			return err
+		}
+		systemctl := []string{"systemctl"}
+		if !system {
+			systemctl = append(systemctl, "--user")
+		}
+		stop = [][]string{slices.Concat(systemctl, []string{"disable", "--now", service.Name + ".service"})}
+		defer runServiceCommand(slices.Concat(systemctl, []string{"daemon-reload"}))
+	case "darwin":
+		if path, err = service.LaunchdPlistPath(system); err != nil {
+			return err
+		}
+		stop = [][]string{{"launchctl", "unload", "-w", path}}
+	case "windows":
+		cmds := service.WindowsUninstallCommands()
+		// The service may be stopped already.
+		runServiceCommand(cmds[0])
+		if err := runServiceCommand(cmds[1]); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Removed the %s service\n", service.Name)
+		return nil
+	default:
+		return fmt.Errorf("services are only supported with systemd, launchd and Windows, not on %s", runtime.GOOS)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("no service installed: %w", err)
+	}
+	for _, cmd := range stop {
+		if err := runServiceCommand(cmd); err != nil {
+			fmt.Printf("⚠ %v\n", err)
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Removed %s\n", path)
+	return nil
+}
+
+func runServiceCommand(args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %w", args, err)
+	}
+	return nil
+}
+
+func serviceHelp() {
+	fmt.Println("\nService commands:")
+	fmt.Println("  install       Run the gateway as a systemd service (launchd on macOS, a Windows service from an")
+	fmt.Println("                administrator shell on Windows) and start it")
+	fmt.Println("  uninstall     Stop the service and remove it")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --system      Install for the whole system (run with sudo) instead of for your user")
+	fmt.Println("  --strict      Start the gateway with --strict")
+	fmt.Println("  --no-watchdog Do not restart the gateway when it stops responding")
+	fmt.Println("  --print       Print the unit, plist or sc.exe commands instead of installing")
+	fmt.Println()
+}
@@ -4,19 +4,92 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/sipeed/picoclaw/pkg/agent"
 	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 func statusCmd() {
+	asJSON := false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "--help", "-h":
+			statusHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", arg)
+			statusHelp()
+			os.Exit(1)
+		}
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
-		return
+		os.Exit(1)
+	}
+
+	status := gatewayStatus(cfg)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(status)
+	} else {
+		printConfigStatus(cfg)
+		fmt.Println()
+		fmt.Println(status)
+	}
+	if !status.Healthy() {
+		os.Exit(1)
 	}
+}
+
+func statusHelp() {
+	fmt.Println("\nUsage: picoclaw status [--json]")
+	fmt.Println("  Shows the config and, from the running gateway, its channels, providers,")
+	fmt.Println("  queues, active runs, stores and cron jobs. Exits with 1 when the gateway")
+	fmt.Println("  is not running or a channel is down.")
+	fmt.Println()
+	fmt.Println("  --json      Print the gateway status as JSON")
+	fmt.Println()
+}
+
+// gatewayStatus asks the running gateway for its status, or reads what
+// the workspace tells when there is none.
+func gatewayStatus(cfg *config.Config) agent.Status {
+	client := &http.Client{Timeout: 3 * time.Second}
+	if resp, err := client.Get(gatewayURL(cfg, "/status")); err == nil {
+		defer resp.Body.Close()
+		var status agent.Status
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&status) == nil {
+			return status
+		}
+	}
+	return agent.WorkspaceStatus(cfg)
+}
+
+// gatewayURL is the address of path on the gateway's health server, as
+// reached from this machine.
+func gatewayURL(cfg *config.Config, path string) string {
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Gateway.Port)) + path
+}
 
+// printConfigStatus prints the config, workspace and provider credentials.
+func printConfigStatus(cfg *config.Config) {
 	configPath := getConfigPath()
 
 	fmt.Printf("%s picoclaw Status\n", logo)
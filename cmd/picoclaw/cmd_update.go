@@ -0,0 +1,318 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/backup"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/service"
+	"github.com/sipeed/picoclaw/pkg/update"
+)
+
+func updateCmd() {
+	var check, force, allowUnsigned, noRestart bool
+	feedURL := ""
+	args := os.Args[2:]
+	if len(args) > 0 && args[0] == "rollback" {
+		updateRollbackCmd()
+		return
+	}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--check":
+			check = true
+		case "--force":
+			force = true
+		case "--allow-unsigned":
+			allowUnsigned = true
+		case "--no-restart":
+			noRestart = true
+		case "--feed":
+			if i+1 < len(args) {
+				feedURL = args[i+1]
+				i++
+			}
+		case "--help", "-h":
+			updateHelp()
+			return
+		default:
+			fmt.Printf("Unknown flag: %s\n", args[i])
+			updateHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if feedURL == "" {
+		feedURL = cfg.Update.FeedURL
+	}
+	if feedURL == "" {
+		fmt.Println("No release feed configured. Set update.feed_url in the config, or pass --feed <url>.")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	client := &http.Client{Timeout: 10 * time.Minute}
+	feed, err := update.Fetch(ctx, client, feedURL)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !update.Newer(feed.Version, version) {
+		if update.IsRelease(version) {
+			fmt.Printf("✓ picoclaw %s is up to date (latest release: %s)\n", version, feed.Version)
+			return
+		}
+		if !force {
+			fmt.Printf("This is a %s build; the latest release is %s. Use --force to install it.\n", version, feed.Version)
+			return
+		}
+	}
+	fmt.Printf("New version: %s (this is %s)\n", feed.Version, version)
+	if feed.Notes != "" {
+		fmt.Printf("  %s\n", strings.ReplaceAll(strings.TrimSpace(feed.Notes), "\n", "\n  "))
+	}
+	if check {
+		return
+	}
+
+	if err := installUpdate(ctx, cfg, feed, client, allowUnsigned, noRestart); err != nil {
+		fmt.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// installUpdate downloads and verifies the release, checks that it runs
+// and takes this config, backs up the installation and swaps the
+// binaries. When the gateway runs as a service, it restarts it and rolls
+// everything back if the gateway does not become ready: the new version
+// may have migrated the stores to a schema the old one refuses.
+func installUpdate(ctx context.Context, cfg *config.Config, feed *update.Feed, client *http.Client,
+	allowUnsigned, noRestart bool,
+) error {
+	asset, err := feed.Asset(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if binary, err = filepath.EvalSymlinks(binary); err != nil {
+		return err
+	}
+	u, err := update.NewUpdater(binary, cfg.Update.TrustedKeys, client)
+	if err != nil {
+		return err
+	}
+	u.Current = version
+	u.AllowUnsigned = allowUnsigned
+
+	verifiedBy, err := u.Download(ctx, feed.Version, asset)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Downloaded %s (verified by %s)\n", asset.URL, verifiedBy)
+	if _, err := u.Check(ctx); err != nil {
+		os.Remove(u.NewPath())
+		return err
+	}
+	validate := exec.CommandContext(ctx, u.NewPath(), "config", "validate", getConfigPath())
+	if out, err := validate.CombinedOutput(); err != nil {
+		os.Remove(u.NewPath())
+		return fmt.Errorf("%s does not accept this config:\n%s", feed.Version, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("✓ %s runs and accepts the config\n", feed.Version)
+
+	home := filepath.Dir(getConfigPath())
+	archive := filepath.Join(home, "backups", backup.FileName(time.Now()))
+	if _, err := writeBackup(cfg, home, archive); err != nil {
+		os.Remove(u.NewPath())
+		return fmt.Errorf("failed to back up before updating: %w", err)
+	}
+	fmt.Printf("✓ Backed up to %s\n", archive)
+
+	if err := u.Swap(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Installed %s at %s\n", feed.Version, binary)
+
+	installed, system := service.Installed(runtime.GOOS)
+	if !installed || noRestart {
+		fmt.Printf("  Restart the gateway to run %s. If it misbehaves: picoclaw update rollback\n", feed.Version)
+		return nil
+	}
+
+	fmt.Println("Restarting the gateway...")
+	restarted := time.Now()
+	restartErr := restartService(cfg, system, nil)
+	if restartErr == nil {
+		restartErr = waitForGateway(cfg, restarted, cfg.Update.HealthTimeout())
+	}
+	if restartErr == nil {
+		fmt.Printf("✓ The gateway runs %s\n", feed.Version)
+		return nil
+	}
+
+	fmt.Printf("✗ The gateway did not come back: %v\n", restartErr)
+	fmt.Println("Rolling back...")
+	restarted = time.Now()
+	err = restartService(cfg, system, func() error {
+		if err := u.Rollback(); err != nil {
+			return err
+		}
+		_, _, err := restoreBackup(archive, true)
+		return err
+	})
+	if err == nil {
+		err = waitForGateway(cfg, restarted, cfg.Update.HealthTimeout())
+	}
+	if err != nil {
+		return fmt.Errorf("rolling back failed too: %w; the backup is %s", err, archive)
+	}
+	return fmt.Errorf("rolled back to %s, the gateway runs again", version)
+}
+
+// updateRollbackCmd puts back the binary the last update replaced and
+// restarts the service on it.
+func updateRollbackCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	binary, err := os.Executable()
+	if err == nil {
+		binary, err = filepath.EvalSymlinks(binary)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	u, _ := update.NewUpdater(binary, nil, nil)
+
+	installed, system := service.Installed(runtime.GOOS)
+	if !installed {
+		err = u.Rollback()
+	} else {
+		restarted := time.Now()
+		if err = restartService(cfg, system, u.Rollback); err == nil {
+			err = waitForGateway(cfg, restarted, cfg.Update.HealthTimeout())
+		}
+	}
+	if err != nil {
+		fmt.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Rolled back %s to the previous version\n", binary)
+	fmt.Println("  Sessions and memory are as the new version left them. To return them to before")
+	fmt.Printf("  the update: picoclaw restore --force <archive in %s>\n", filepath.Join(filepath.Dir(getConfigPath()), "backups"))
+}
+
+// restartService stops the service, runs between, if set, and starts the
+// service again.
+func restartService(cfg *config.Config, system bool, between func() error) error {
+	stop, err := service.ControlCommand(runtime.GOOS, "stop", system)
+	if err != nil {
+		return err
+	}
+	start, err := service.ControlCommand(runtime.GOOS, "start", system)
+	if err != nil {
+		return err
+	}
+	// The service may have stopped already.
+	if err := runServiceCommand(stop); err != nil {
+		fmt.Printf("⚠ %v\n", err)
+	}
+	// sc.exe returns before the service has stopped.
+	waitForGatewayDown(cfg, 30*time.Second)
+	if between != nil {
+		if err := between(); err != nil {
+			runServiceCommand(start)
+			return err
+		}
+	}
+	return runServiceCommand(start)
+}
+
+// waitForGateway waits until a gateway started after since answers that
+// it is ready.
+func waitForGateway(cfg *config.Config, since time.Time, timeout time.Duration) error {
+	client := &http.Client{Timeout: 3 * time.Second}
+	deadline := time.Now().Add(timeout)
+	last := "it did not answer"
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		var status agent.Status
+		resp, err := client.Get(gatewayURL(cfg, "/status"))
+		if err != nil {
+			continue
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		// A gateway up for longer is the one from before the restart.
+		if err != nil || !status.Running || status.Process == nil ||
+			time.Duration(status.Process.UptimeSeconds)*time.Second > time.Since(since)+time.Second {
+			last = "the gateway from before the restart still answers"
+			continue
+		}
+		resp, err = client.Get(gatewayURL(cfg, "/ready"))
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+		last = fmt.Sprintf("it is not ready (HTTP %d)", resp.StatusCode)
+	}
+	return fmt.Errorf("not ready within %s: %s", timeout, last)
+}
+
+// waitForGatewayDown waits up to timeout for the gateway to stop
+// answering.
+func waitForGatewayDown(cfg *config.Config, timeout time.Duration) {
+	client := &http.Client{Timeout: time.Second}
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		resp, err := client.Get(gatewayURL(cfg, "/health"))
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+	}
+}
+
+func updateHelp() {
+	fmt.Println("\nUsage: picoclaw update [--check] [--force] [--allow-unsigned] [--no-restart] [--feed <url>]")
+	fmt.Println("       picoclaw update rollback")
+	fmt.Println("  Installs the latest release from the feed in update.feed_url, signed with a")
+	fmt.Println("  key in update.trusted_keys. It backs up the installation, swaps the binary and")
+	fmt.Println("  restarts the service; if the gateway is not ready within")
+	fmt.Println("  update.health_timeout_seconds, the old binary and the backup are put back.")
+	fmt.Println()
+	fmt.Println("  --check            Only say whether there is a newer release")
+	fmt.Println("  --force            Install the latest release on a build with no release version")
+	fmt.Println("  --allow-unsigned   Trust the feed's checksum when no trusted keys are configured")
+	fmt.Println("  --no-restart       Leave restarting the gateway to you")
+	fmt.Println("  --feed             Release feed to read instead of update.feed_url")
+	fmt.Println("  rollback           Put back the binary the last update replaced")
+	fmt.Println()
+}
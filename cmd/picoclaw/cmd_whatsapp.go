@@ -0,0 +1,52 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+func whatsappCmd() {
+	if len(os.Args) < 3 {
+		whatsappHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "login", "pair":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		defer cancel()
+
+		fmt.Printf("Session store: %s\n", cfg.Channels.WhatsApp.StorePath())
+		if err := channels.PairWhatsApp(ctx, cfg.Channels.WhatsApp, os.Stdout); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✓ WhatsApp linked. Set channels.whatsapp.use_native to true and run 'picoclaw gateway'.")
+	default:
+		fmt.Printf("Unknown whatsapp command: %s\n", os.Args[2])
+		whatsappHelp()
+	}
+}
+
+func whatsappHelp() {
+	fmt.Println("\nWhatsApp commands:")
+	fmt.Println("  login       Link picoclaw as a WhatsApp device by scanning a QR code")
+	fmt.Println()
+	fmt.Println("Requires a build with '-tags whatsapp_native'.")
+}
@@ -0,0 +1,127 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/workflow"
+)
+
+func workflowCmd() {
+	if len(os.Args) < 3 {
+		workflowHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	dir := workflow.Dir(cfg.WorkspacePath())
+
+	switch os.Args[2] {
+	case "list":
+		workflows, err := workflow.Load(dir)
+		if len(workflows) == 0 && err == nil {
+			fmt.Printf("No workflows in %s\n", dir)
+		}
+		for _, w := range workflows {
+			fmt.Printf("%s (%d steps)", w.Name, len(w.Steps))
+			if w.Schedule != "" {
+				fmt.Printf(", %s", w.Schedule)
+			}
+			if w.Description != "" {
+				fmt.Printf("\n  %s", w.Description)
+			}
+			fmt.Println()
+		}
+		if err != nil {
+			fmt.Printf("\nNot loaded:\n%v\n", err)
+		}
+	case "check":
+		workflows, err := workflow.Load(dir)
+		if err != nil {
+			fmt.Printf("✗ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %d workflows in %s are valid\n", len(workflows), dir)
+	case "run":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: picoclaw workflow run <name> [input]")
+			return
+		}
+		workflowRunCmd(cfg, os.Args[3], strings.Join(os.Args[4:], " "))
+	default:
+		fmt.Printf("Unknown workflow command: %s\n", os.Args[2])
+		workflowHelp()
+	}
+}
+
+func workflowHelp() {
+	fmt.Println("\nWorkflow commands:")
+	fmt.Println("  list                  List the workflows of the workspace")
+	fmt.Println("  check                 Validate the workflow files")
+	fmt.Println("  run <name> [input]    Run a workflow now and print its trace")
+	fmt.Println()
+	fmt.Println("Workflows are YAML files in <workspace>/workflows. Messages their")
+	fmt.Println("send steps would post are printed instead.")
+}
+
+// printSends runs workflow steps like the gateway does, but prints what
+// they send: there are no channels outside the gateway.
+type printSends struct {
+	workflow.Env
+}
+
+func (printSends) Send(ctx context.Context, channel, chatID, text string) error {
+	fmt.Printf("→ %s:%s\n%s\n\n", channel, chatID, text)
+	return nil
+}
+
+func workflowRunCmd(cfg *config.Config, name, input string) {
+	provider, modelID, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	if modelID != "" {
+		cfg.Agents.Defaults.ModelName = modelID
+	}
+	agentLoop, err := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	if err != nil {
+		fmt.Printf("Error starting agent: %v\n", err)
+		os.Exit(1)
+	}
+
+	ws := workflow.NewService(cfg.WorkspacePath(), printSends{agentLoop.WorkflowEnv()})
+	tr, err := ws.Run(context.Background(), name, input, "cli", "cli", "direct")
+	if tr.TaskID == "" {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, st := range tr.Steps {
+		fmt.Printf("%-8s %s (%s), %s", st.Status, st.ID, st.Kind, time.Duration(st.DurationMS)*time.Millisecond)
+		if st.Attempts > 1 {
+			fmt.Printf(", %d attempts", st.Attempts)
+		}
+		fmt.Println()
+		if st.Error != "" {
+			fmt.Printf("         %s\n", st.Error)
+		}
+	}
+	fmt.Printf("\nTask %s %s in %s\n", tr.TaskID, tr.Status, time.Duration(tr.DurationMS)*time.Millisecond)
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -103,18 +103,46 @@ func main() {
 	switch command {
 	case "onboard":
 		onboard()
+	case "init":
+		initCmd()
 	case "agent":
 		agentCmd()
+	case "chat":
+		chatCmd()
 	case "gateway":
 		gatewayCmd()
+	case "service":
+		serviceCmd()
 	case "status":
 		statusCmd()
+	case "doctor":
+		doctorCmd()
+	case "config":
+		configCmd()
 	case "migrate":
 		migrateCmd()
+	case "backup":
+		backupCmd()
+	case "restore":
+		restoreCmd()
+	case "update":
+		updateCmd()
 	case "auth":
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "workflow", "workflows":
+		workflowCmd()
+	case "whatsapp":
+		whatsappCmd()
+	case "ollama":
+		ollamaCmd()
+	case "plugin", "plugins":
+		pluginCmd()
+	case "audit":
+		auditCmd()
+	case "analytics":
+		analyticsCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -178,14 +206,28 @@ func printHelp() {
 	fmt.Println("Usage: picoclaw <command>")
 	fmt.Println()
 	fmt.Println("Commands:")
+	fmt.Println("  init        Set up picoclaw step by step: provider, chat apps and guards")
 	fmt.Println("  onboard     Initialize picoclaw configuration and workspace")
 	fmt.Println("  agent       Interact with the agent directly")
+	fmt.Println("  chat        Interactive chat REPL with streaming output")
 	fmt.Println("  auth        Manage authentication (login, logout, status)")
 	fmt.Println("  gateway     Start picoclaw gateway")
-	fmt.Println("  status      Show picoclaw status")
+	fmt.Println("  service     Run the gateway as a systemd or launchd service (install, uninstall)")
+	fmt.Println("  status      Show the config and the gateway's health (--json for scripts)")
+	fmt.Println("  doctor      Check providers, channel credentials and storage")
+	fmt.Println("  config      Validate the config or print its JSON Schema")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  workflow    List, check and run the workflows of the workspace")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
+	fmt.Println("  backup      Write config, sessions, memory, tasks and skills to one archive")
+	fmt.Println("  restore     Restore a backup on this device")
+	fmt.Println("  update      Install the latest release, rolling back if the gateway fails to start")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
+	fmt.Println("  plugin      Manage plugins of tools, hooks and skills (install, list, update, remove)")
+	fmt.Println("  audit       Show or verify the audit log of privileged actions")
+	fmt.Println("  analytics   Show usage insights: busiest hours, tools, tokens, errors, cost")
+	fmt.Println("  whatsapp    Pair the native WhatsApp channel (login)")
+	fmt.Println("  ollama      Manage local Ollama models (list, pull, status)")
 	fmt.Println("  version     Show version information")
 }
 
@@ -0,0 +1,435 @@
+// Package adminapi serves the operations of the admin chats over HTTP, so
+// fleet tooling and web frontends can manage a gateway without a chat:
+//
+//	GET    /v1/status        the gateway's status, as picoclaw status shows it
+//	POST   /v1/reload        load the edited config, as /reload does
+//	GET    /v1/flags         the kill switches, as /flags lists them
+//	PUT    /v1/flags/{name}  set a flag: {"on": true|false}
+//	DELETE /v1/flags         let all flags follow the config again
+//	GET    /v1/usage         LLM usage per agent, since=RFC 3339 (default today)
+//	GET    /v1/events/llm    LLM requests: since, agent, session, limit
+//	GET    /v1/events/run    run events: since, kind, limit
+//	GET    /v1/logs          the latest log entries: since, level, component, q (text), limit
+//	GET    /v1/messages/scheduled       messages waiting to be sent later
+//	POST   /v1/messages/scheduled       schedule one: {"channel", "chat_id", "content", "send_at"}
+//	DELETE /v1/messages/scheduled/{id}  cancel one
+//	POST   /v1/senders/{id}/erase       delete what is kept about a sender, as /erase does
+//
+// limit defaults to 100 events. Requests authenticate with a bearer token,
+// a client certificate, or both, see config.AdminAPIConfig. Changes are
+// logged and recorded in the run events like those made in a chat.
+package adminapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/handoff"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// defaultLimit is how many events are returned when a query sets no limit.
+const defaultLimit = 100
+
+// maxBodyBytes caps request bodies; the API only takes small JSON objects.
+const maxBodyBytes = 64 << 10
+
+// Admin is what the API manages, implemented by *agent.AgentLoop.
+type Admin interface {
+	Status() agent.Status
+	Reload() ([]config.Change, error)
+	Flags() []agent.Flag
+	SetFlag(who, name string, on bool) error
+	ResetFlags(who string) ([]string, error)
+	Usage(since time.Time) ([]agent.AgentUsage, error)
+	LLMEvents(q agent.EventQuery) ([]state.LLMEvent, error)
+	RunEvents(q agent.EventQuery) ([]state.RunEvent, error)
+	ScheduleMessage(msg bus.OutboundMessage, at time.Time, by string) (channels.ScheduledMessage, error)
+	ScheduledMessages() []channels.ScheduledMessage
+	CancelScheduled(id string) (channels.ScheduledMessage, error)
+	EraseSender(sender, requestedBy string) (agent.ErasureReport, error)
+	Audit(e state.AuditEntry)
+}
+
+// Change is a setting a reload changed.
+type Change struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+	// Live is set when the running gateway applied the change; others
+	// take effect after a restart.
+	Live bool `json:"live"`
+}
+
+type Server struct {
+	cfg    config.AdminAPIConfig
+	admin  Admin
+	server *http.Server
+}
+
+// NewServer creates the admin API server, loading its certificates.
+func NewServer(cfg config.AdminAPIConfig, admin Admin) (*Server, error) {
+	s := &Server{cfg: cfg, admin: admin}
+	s.server = &http.Server{
+		Addr:         net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Handler:      s.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	if cfg.CertFile == "" {
+		return s, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the admin API certificate: %w", err)
+	}
+	s.server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the admin API client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.ClientCAFile)
+		}
+		s.server.TLSConfig.ClientCAs = pool
+		s.server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return s, nil
+}
+
+// Start serves the API until Stop is called.
+func (s *Server) Start() error {
+	if s.server.TLSConfig != nil {
+		return handoff.ListenAndServeTLS(s.server, "", "")
+	}
+	return handoff.ListenAndServe(s.server)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Handler returns the API's routes, each behind authentication.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.handleStatus)
+	mux.HandleFunc("POST /v1/reload", s.handleReload)
+	mux.HandleFunc("GET /v1/flags", s.handleFlags)
+	mux.HandleFunc("PUT /v1/flags/{name}", s.handleSetFlag)
+	mux.HandleFunc("DELETE /v1/flags", s.handleResetFlags)
+	mux.HandleFunc("GET /v1/usage", s.handleUsage)
+	mux.HandleFunc("GET /v1/events/llm", s.handleLLMEvents)
+	mux.HandleFunc("GET /v1/events/run", s.handleRunEvents)
+	mux.HandleFunc("GET /v1/logs", s.handleLogs)
+	mux.HandleFunc("GET /v1/messages/scheduled", s.handleScheduledMessages)
+	mux.HandleFunc("POST /v1/messages/scheduled", s.handleScheduleMessage)
+	mux.HandleFunc("DELETE /v1/messages/scheduled/{id}", s.handleCancelScheduled)
+	mux.HandleFunc("POST /v1/senders/{id}/erase", s.handleEraseSender)
+	return s.authenticate(mux)
+}
+
+// authenticate lets a request through when it carries the token and, if
+// a client CA is set, a certificate it signed; the TLS handshake has
+// verified the certificate by then.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.ClientCAFile != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			s.refuse(w, r, "a client certificate is required")
+			return
+		}
+		if s.cfg.Token != "" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+				s.refuse(w, r, "invalid token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refuse answers a request that failed authentication, recording it in
+// the audit log.
+func (s *Server) refuse(w http.ResponseWriter, r *http.Request, reason string) {
+	s.admin.Audit(state.AuditEntry{
+		Action:  "admin_api",
+		Actor:   who(r),
+		Target:  r.Method + " " + r.URL.Path,
+		Outcome: "denied",
+		Detail:  reason,
+	})
+	writeError(w, http.StatusUnauthorized, reason)
+}
+
+// who names the client of r for logs and run events: the common name of
+// its certificate, else its address.
+func who(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return "admin_api:" + r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "admin_api:" + host
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.admin.Status())
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.admin.Reload()
+	logger.InfoCF("admin_api", "Reload requested", map[string]any{"by": who(r), "changes": len(changes)})
+	entry := state.AuditEntry{Action: "admin_api", Actor: who(r), Target: "POST /v1/reload", Outcome: "ok"}
+	if err != nil {
+		entry.Outcome, entry.Detail = "failed", err.Error()
+	}
+	s.admin.Audit(entry)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	resp := make([]Change, 0, len(changes))
+	for _, c := range changes {
+		resp = append(resp, Change{Path: c.Path, Old: c.Old, New: c.New, Live: c.Live()})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"changes": resp})
+}
+
+func (s *Server) handleFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"flags": s.admin.Flags()})
+}
+
+func (s *Server) handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		On *bool `json:"on"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&body); err != nil || body.On == nil {
+		writeError(w, http.StatusBadRequest, `the body must be {"on": true} or {"on": false}`)
+		return
+	}
+	if err := s.admin.SetFlag(who(r), r.PathValue("name"), *body.On); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, agent.ErrInvalidFlag) {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	s.handleFlags(w, r)
+}
+
+func (s *Server) handleResetFlags(w http.ResponseWriter, r *http.Request) {
+	reset, err := s.admin.ResetFlags(who(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"reset": reset, "flags": s.admin.Flags()})
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	since, ok := parseSince(w, r, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	if !ok {
+		return
+	}
+	usage, err := s.admin.Usage(since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var total float64
+	for _, u := range usage {
+		total += u.CostUSD
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"since": since, "agents": usage, "total_cost_usd": total})
+}
+
+func (s *Server) handleLLMEvents(w http.ResponseWriter, r *http.Request) {
+	q, ok := eventQuery(w, r)
+	if !ok {
+		return
+	}
+	q.AgentID = r.URL.Query().Get("agent")
+	q.SessionKey = r.URL.Query().Get("session")
+	events, err := s.admin.LLMEvents(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events})
+}
+
+func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	q, ok := eventQuery(w, r)
+	if !ok {
+		return
+	}
+	q.Kind = r.URL.Query().Get("kind")
+	events, err := s.admin.RunEvents(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events})
+}
+
+// handleLogs returns the log entries kept in memory, see
+// config.LogConfig.KeepRecent, oldest first.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	eq, ok := eventQuery(w, r)
+	if !ok {
+		return
+	}
+	q := logger.Query{Since: eq.Since, Limit: eq.Limit, Component: r.URL.Query().Get("component"), Text: r.URL.Query().Get("q")}
+	if v := r.URL.Query().Get("level"); v != "" {
+		level, err := logger.ParseLevel(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.Level = level
+	}
+	entries := logger.Recent(q)
+	if entries == nil {
+		entries = []logger.Entry{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries, "kept": logger.KeptRecent()})
+}
+
+func (s *Server) handleScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	messages := s.admin.ScheduledMessages()
+	if messages == nil {
+		messages = []channels.ScheduledMessage{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages})
+}
+
+func (s *Server) handleScheduleMessage(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Channel string    `json:"channel"`
+		ChatID  string    `json:"chat_id"`
+		Content string    `json:"content"`
+		SendAt  time.Time `json:"send_at"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, `the body must be {"channel", "chat_id", "content", "send_at"} with an RFC 3339 send_at`)
+		return
+	}
+	msg := bus.OutboundMessage{Channel: body.Channel, ChatID: body.ChatID, Content: body.Content}
+	scheduled, err := s.admin.ScheduleMessage(msg, body.SendAt, who(r))
+	entry := state.AuditEntry{Action: "admin_api", Actor: who(r), Target: "POST /v1/messages/scheduled", Outcome: "ok"}
+	if err != nil {
+		entry.Outcome, entry.Detail = "failed", err.Error()
+	} else {
+		entry.Detail = scheduled.ID + " to " + body.Channel + ":" + body.ChatID
+	}
+	s.admin.Audit(entry)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, scheduled)
+}
+
+func (s *Server) handleCancelScheduled(w http.ResponseWriter, r *http.Request) {
+	cancelled, err := s.admin.CancelScheduled(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.admin.Audit(state.AuditEntry{
+		Action: "admin_api", Actor: who(r), Target: "DELETE /v1/messages/scheduled/" + cancelled.ID, Outcome: "ok",
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"cancelled": cancelled})
+}
+
+// handleEraseSender erases the sender {id}, a profile ID such as
+// "telegram:123456". EraseSender records the erasure in the audit log
+// with the client as the one who asked for it.
+func (s *Server) handleEraseSender(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	report, err := s.admin.EraseSender(id, who(r))
+	logger.InfoCF("admin_api", "Erasure requested", map[string]any{"by": who(r), "sender": id})
+	if report.Sender == "" {
+		s.admin.Audit(state.AuditEntry{
+			Action: "erase", Actor: who(r), Target: id, Outcome: "failed", Detail: err.Error(),
+		})
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"erased": report, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"erased": report})
+}
+
+// eventQuery reads since and limit from the query string, answering the
+// request itself when they are invalid.
+func eventQuery(w http.ResponseWriter, r *http.Request) (agent.EventQuery, bool) {
+	q := agent.EventQuery{Limit: defaultLimit}
+	since, ok := parseSince(w, r, time.Time{})
+	if !ok {
+		return q, false
+	}
+	q.Since = since
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return q, false
+		}
+		q.Limit = n
+	}
+	return q, true
+}
+
+// parseSince reads since from the query string, def if it is unset,
+// answering the request itself when it is invalid.
+func parseSince(w http.ResponseWriter, r *http.Request, def time.Time) (time.Time, bool) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return def, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+		return t, false
+	}
+	return t, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,321 @@
+package adminapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+type fakeAdmin struct {
+	flags     map[string]bool
+	who       string
+	query     agent.EventQuery
+	audit     []state.AuditEntry
+	scheduled []channels.ScheduledMessage
+}
+
+func (a *fakeAdmin) Status() agent.Status { return agent.Status{} }
+
+func (a *fakeAdmin) Reload() ([]config.Change, error) {
+	return []config.Change{{Path: "gateway.flags.read_only", Old: "false", New: "true"}}, nil
+}
+
+func (a *fakeAdmin) Flags() []agent.Flag {
+	var flags []agent.Flag
+	for name, on := range a.flags {
+		flags = append(flags, agent.Flag{Name: name, On: on, Source: "/flags"})
+	}
+	return flags
+}
+
+func (a *fakeAdmin) SetFlag(who, name string, on bool) error {
+	if name != "read_only" {
+		return fmt.Errorf("%w: unknown", agent.ErrInvalidFlag)
+	}
+	a.who = who
+	a.flags[name] = on
+	return nil
+}
+
+func (a *fakeAdmin) ResetFlags(who string) ([]string, error) {
+	a.flags = map[string]bool{}
+	return []string{"read_only"}, nil
+}
+
+func (a *fakeAdmin) Usage(since time.Time) ([]agent.AgentUsage, error) {
+	return []agent.AgentUsage{{AgentID: "main", Requests: 2, CostUSD: 0.5}}, nil
+}
+
+func (a *fakeAdmin) LLMEvents(q agent.EventQuery) ([]state.LLMEvent, error) {
+	a.query = q
+	return []state.LLMEvent{{AgentID: q.AgentID, Model: "gpt"}}, nil
+}
+
+func (a *fakeAdmin) RunEvents(q agent.EventQuery) ([]state.RunEvent, error) {
+	a.query = q
+	return nil, nil
+}
+
+func (a *fakeAdmin) ScheduleMessage(msg bus.OutboundMessage, at time.Time, by string) (channels.ScheduledMessage, error) {
+	if at.IsZero() {
+		return channels.ScheduledMessage{}, fmt.Errorf("no time")
+	}
+	sm := channels.ScheduledMessage{ID: "m1", Message: msg, SendAt: at, By: by}
+	a.scheduled = append(a.scheduled, sm)
+	return sm, nil
+}
+
+func (a *fakeAdmin) ScheduledMessages() []channels.ScheduledMessage { return a.scheduled }
+
+func (a *fakeAdmin) CancelScheduled(id string) (channels.ScheduledMessage, error) {
+	for i, sm := range a.scheduled {
+		if sm.ID == id {
+			a.scheduled = append(a.scheduled[:i], a.scheduled[i+1:]...)
+			return sm, nil
+		}
+	}
+	return channels.ScheduledMessage{}, channels.ErrNoScheduledMessage
+}
+
+func (a *fakeAdmin) EraseSender(sender, requestedBy string) (agent.ErasureReport, error) {
+	channel, id, ok := strings.Cut(sender, ":")
+	if !ok || channel == "" || id == "" {
+		return agent.ErasureReport{}, fmt.Errorf("%q is not a sender of the form channel:id", sender)
+	}
+	a.audit = append(a.audit, state.AuditEntry{Action: "erase", Actor: requestedBy, Target: sender, Outcome: "ok"})
+	return agent.ErasureReport{Sender: sender, Sessions: 1, Facts: 2}, nil
+}
+
+func (a *fakeAdmin) Audit(e state.AuditEntry) { a.audit = append(a.audit, e) }
+
+func TestHandler(t *testing.T) {
+	admin := &fakeAdmin{flags: map[string]bool{}}
+	s, err := NewServer(config.AdminAPIConfig{Port: 1, Token: "s3cret"}, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	do := func(method, path, token, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got map[string]any
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+
+	if code, _ := do("GET", "/v1/status", "", ""); code != http.StatusUnauthorized {
+		t.Errorf("no token: status %d", code)
+	}
+	if code, _ := do("GET", "/v1/status", "wrong", ""); code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d", code)
+	}
+	if code, _ := do("GET", "/v1/status", "s3cret", ""); code != http.StatusOK {
+		t.Errorf("status: %d", code)
+	}
+	if len(admin.audit) != 2 || admin.audit[1].Outcome != "denied" || admin.audit[1].Detail != "invalid token" {
+		t.Errorf("audited %+v", admin.audit)
+	}
+
+	code, got := do("POST", "/v1/reload", "s3cret", "")
+	changes, _ := got["changes"].([]any)
+	if code != http.StatusOK || len(changes) != 1 || changes[0].(map[string]any)["live"] != true {
+		t.Errorf("reload: %d %v", code, got)
+	}
+
+	if code, _ := do("PUT", "/v1/flags/tool:nope", "s3cret", `{"on": false}`); code != http.StatusBadRequest {
+		t.Errorf("invalid flag: status %d", code)
+	}
+	if code, _ := do("PUT", "/v1/flags/read_only", "s3cret", `{}`); code != http.StatusBadRequest {
+		t.Errorf("missing on: status %d", code)
+	}
+	code, got = do("PUT", "/v1/flags/read_only", "s3cret", `{"on": true}`)
+	if code != http.StatusOK || !admin.flags["read_only"] || !strings.HasPrefix(admin.who, "admin_api:") {
+		t.Errorf("set flag: %d %v, who %q", code, got, admin.who)
+	}
+	if code, got = do("DELETE", "/v1/flags", "s3cret", ""); code != http.StatusOK || len(admin.flags) != 0 {
+		t.Errorf("reset flags: %d %v", code, got)
+	}
+
+	if code, got = do("GET", "/v1/usage", "s3cret", ""); code != http.StatusOK || got["total_cost_usd"] != 0.5 {
+		t.Errorf("usage: %d %v", code, got)
+	}
+	if code, _ := do("GET", "/v1/usage?since=yesterday", "s3cret", ""); code != http.StatusBadRequest {
+		t.Errorf("bad since: status %d", code)
+	}
+
+	code, got = do("GET", "/v1/events/llm?agent=main&limit=5&since=2026-01-02T00:00:00Z", "s3cret", "")
+	if code != http.StatusOK || admin.query.AgentID != "main" || admin.query.Limit != 5 || admin.query.Since.Year() != 2026 {
+		t.Errorf("llm events: %d %v, query %+v", code, got, admin.query)
+	}
+	if code, _ := do("GET", "/v1/events/run?kind=flag_changed", "s3cret", ""); code != http.StatusOK ||
+		admin.query.Kind != "flag_changed" || admin.query.Limit != defaultLimit {
+		t.Errorf("run events: %d, query %+v", code, admin.query)
+	}
+	if code, _ := do("GET", "/v1/events/run?limit=0", "s3cret", ""); code != http.StatusBadRequest {
+		t.Errorf("bad limit: status %d", code)
+	}
+
+	if code, _ := do("POST", "/v1/messages/scheduled", "s3cret", `{"channel": "telegram", "chat_id": "1", "content": "hi"}`); code != http.StatusBadRequest {
+		t.Errorf("schedule without a time: status %d", code)
+	}
+	code, got = do("POST", "/v1/messages/scheduled", "s3cret",
+		`{"channel": "telegram", "chat_id": "1", "content": "Dinner!", "send_at": "2026-05-01T18:00:00+02:00"}`)
+	if code != http.StatusCreated || got["id"] != "m1" || !strings.HasPrefix(admin.scheduled[0].By, "admin_api:") {
+		t.Errorf("schedule: %d %v", code, got)
+	}
+	if code, got = do("GET", "/v1/messages/scheduled", "s3cret", ""); code != http.StatusOK || len(got["messages"].([]any)) != 1 {
+		t.Errorf("scheduled: %d %v", code, got)
+	}
+	if code, _ := do("DELETE", "/v1/messages/scheduled/m1", "s3cret", ""); code != http.StatusOK || len(admin.scheduled) != 0 {
+		t.Errorf("cancel: status %d", code)
+	}
+	if code, _ := do("DELETE", "/v1/messages/scheduled/m1", "s3cret", ""); code != http.StatusNotFound {
+		t.Errorf("cancel twice: status %d", code)
+	}
+
+	code, got = do("POST", "/v1/senders/telegram:123456/erase", "s3cret", "")
+	erased, _ := got["erased"].(map[string]any)
+	if code != http.StatusOK || erased["sender"] != "telegram:123456" || erased["facts"] != 2.0 {
+		t.Errorf("erase: %d %v", code, got)
+	}
+	if last := admin.audit[len(admin.audit)-1]; last.Action != "erase" || last.Target != "telegram:123456" ||
+		!strings.HasPrefix(last.Actor, "admin_api:") {
+		t.Errorf("erasure audited as %+v", last)
+	}
+	if code, _ := do("POST", "/v1/senders/123456/erase", "s3cret", ""); code != http.StatusBadRequest {
+		t.Errorf("erase without a channel: status %d", code)
+	}
+	if last := admin.audit[len(admin.audit)-1]; last.Outcome != "failed" || last.Target != "123456" {
+		t.Errorf("refused erasure audited as %+v", last)
+	}
+
+	defer logger.KeepRecent(logger.KeptRecent())
+	logger.KeepRecent(10)
+	logger.WarnCF("channels", "Reconnecting", map[string]any{"error": "EOF"})
+	logger.InfoCF("channels", "Connected", nil)
+	code, got = do("GET", "/v1/logs?level=warn&component=channels", "s3cret", "")
+	entries, _ := got["entries"].([]any)
+	if code != http.StatusOK || len(entries) != 1 || entries[0].(map[string]any)["level"] != "WARN" || got["kept"] != 10.0 {
+		t.Errorf("logs: %d %v", code, got)
+	}
+	if code, _ := do("GET", "/v1/logs?level=loud", "s3cret", ""); code != http.StatusBadRequest {
+		t.Errorf("bad level: status %d", code)
+	}
+}
+
+func TestServer_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newCert(t, dir, "ca", nil, nil)
+	newCert(t, dir, "server", ca, caKey)
+	newCert(t, dir, "client", ca, caKey)
+
+	admin := &fakeAdmin{flags: map[string]bool{}}
+	s, err := NewServer(config.AdminAPIConfig{
+		Port:         1,
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(s.Handler())
+	ts.TLS = s.server.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+
+	if _, err := client().Get(ts.URL + "/v1/status"); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("PUT", ts.URL+"/v1/flags/read_only", strings.NewReader(`{"on": true}`))
+	resp, err := client(cert).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || admin.who != "admin_api:client" {
+		t.Errorf("status %d, who %q", resp.StatusCode, admin.who)
+	}
+}
+
+// newCert writes <name>.pem and <name>.key to dir: a CA when parent is
+// nil, else a certificate for 127.0.0.1 it signs.
+func newCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
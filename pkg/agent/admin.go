@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// isAdminChat reports whether msg comes from an admin chat, the chat the
+// supervisor sends its alerts to or one in gateway.admin.chats, and from
+// one of gateway.admin.senders. Without an admin chat and senders, no chat
+// is one and the admin commands are refused everywhere.
+func (al *AgentLoop) isAdminChat(msg bus.InboundMessage) bool {
+	sup := al.cfg.Gateway.Supervisor
+	admin := al.cfg.Gateway.Admin
+	inChat := sup.AlertChannel != "" && msg.Channel == sup.AlertChannel && msg.ChatID == sup.AlertChatID
+	for _, chat := range admin.Chats {
+		if chat == msg.Channel+":"+msg.ChatID {
+			inChat = true
+		}
+	}
+	if !inChat {
+		return false
+	}
+	for _, entry := range admin.Senders {
+		channel, sender, _ := strings.Cut(entry, ":")
+		if channel == msg.Channel && channels.SenderMatches(msg.SenderID, sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetConfigReloader lets /reload load the config again: reload applies
+// the edited config and returns what changed.
+func (al *AgentLoop) SetConfigReloader(reload func() ([]config.Change, error)) {
+	al.reloadConfig = reload
+}
+
+// handleAdminCommand handles the operator commands that only work in an
+// admin chat:
+//
+//	/reload       load the edited config now and apply what can be applied
+//	/tools        list the tools of the agent the chat is routed to
+//	/hooks        count the hooks registered on messages and attachments
+//	/approve [n]  apply one or all of the changes waiting for approval
+//	/flags        show or flip the kill switches, see flagsCommand
+//	/loglevel     show or change what is logged, see logLevelCommand
+//	/logs         the latest log entries, see logsCommand
+//
+// /status, /usage and /broadcast are handled with the other commands.
+func (al *AgentLoop) handleAdminCommand(agent *AgentInstance, msg bus.InboundMessage) (string, bool) {
+	fields := strings.Fields(msg.Content)
+	if len(fields) == 0 {
+		return "", false
+	}
+	switch fields[0] {
+	case "/reload", "/tools", "/hooks", "/approve", "/flags", "/loglevel", "/logs":
+	default:
+		return "", false
+	}
+	if !al.isAdminChat(msg) {
+		return al.adminOnly(msg, fields[0]), true
+	}
+	al.auditCommand(msg, "ok")
+
+	switch fields[0] {
+	case "/reload":
+		return al.reloadReport(), true
+	case "/tools":
+		names := agent.Tools.List()
+		return fmt.Sprintf("Tools of agent %s (%d): %s", agent.ID, len(names), strings.Join(names, ", ")), true
+	case "/flags":
+		return al.flagsCommand(msg, fields[1:]), true
+	case "/loglevel":
+		return al.logLevelCommand(msg, fields[1:]), true
+	case "/logs":
+		return al.logsCommand(msg, fields[1:]), true
+	case "/hooks":
+		if al.channelManager == nil {
+			return "Channel manager not initialized", true
+		}
+		outbound, attachment := al.channelManager.HookCounts()
+		return fmt.Sprintf("Outbound message hooks: %d\nInbound attachment hooks: %d", outbound, attachment), true
+	default: // "/approve"
+		if len(agent.ContextBuilder.memory.consolidation.Pending()) == 0 {
+			return al.t(msg, "Nothing is waiting for approval."), true
+		}
+		return al.reviewPendingMemories(agent, msg, "approve", fields[1:]), true
+	}
+}
+
+// errNoReloader is returned by Reload outside the gateway, which is the
+// only place the config is watched.
+var errNoReloader = errors.New("the config can only be reloaded in the gateway")
+
+// Reload loads the edited config, applies what can be applied while
+// running and returns what changed.
+func (al *AgentLoop) Reload() ([]config.Change, error) {
+	if al.reloadConfig == nil {
+		return nil, errNoReloader
+	}
+	return al.reloadConfig()
+}
+
+// reloadReport reloads the config for /reload and says what changed.
+func (al *AgentLoop) reloadReport() string {
+	if al.reloadConfig == nil {
+		return "The config can only be reloaded in the gateway."
+	}
+	changes, err := al.Reload()
+	if err != nil {
+		return fmt.Sprintf("The config was not reloaded: %v", err)
+	}
+	if len(changes) == 0 {
+		return "The config has not changed."
+	}
+	var live, later []string
+	for _, c := range changes {
+		if c.Live() {
+			live = append(live, "- "+c.String())
+		} else {
+			later = append(later, "- "+c.String())
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Reloaded the config: %d changes.", len(changes))
+	if len(live) > 0 {
+		b.WriteString("\nApplied now:\n" + strings.Join(live, "\n"))
+	}
+	if len(later) > 0 {
+		b.WriteString("\nAfter a restart:\n" + strings.Join(later, "\n"))
+	}
+	return b.String()
+}
+
+// EventQuery selects events from the event logs. Zero fields select all.
+type EventQuery struct {
+	Since      time.Time
+	AgentID    string // LLM events only
+	SessionKey string // LLM events only
+	Kind       string // run events only
+	Limit      int    // the latest this many
+}
+
+// LLMEvents returns the LLM requests q selects, oldest first.
+func (al *AgentLoop) LLMEvents(q EventQuery) ([]state.LLMEvent, error) {
+	if al.llmEvents == nil {
+		return nil, nil
+	}
+	events, err := al.llmEvents.Since(q.Since)
+	if err != nil {
+		return nil, err
+	}
+	events = slices.DeleteFunc(events, func(ev state.LLMEvent) bool {
+		return (q.AgentID != "" && ev.AgentID != q.AgentID) ||
+			(q.SessionKey != "" && ev.SessionKey != q.SessionKey)
+	})
+	return latest(events, q.Limit), nil
+}
+
+// RunEvents returns the run events q selects, oldest first.
+func (al *AgentLoop) RunEvents(q EventQuery) ([]state.RunEvent, error) {
+	if al.runEvents == nil {
+		return nil, nil
+	}
+	events, err := al.runEvents.Recent(0)
+	if err != nil {
+		return nil, err
+	}
+	events = slices.DeleteFunc(events, func(ev state.RunEvent) bool {
+		return ev.Time.Before(q.Since) || (q.Kind != "" && ev.Kind != q.Kind)
+	})
+	return latest(events, q.Limit), nil
+}
+
+// latest returns the last n events, all of them for n <= 0.
+func latest[T any](events []T, n int) []T {
+	if n > 0 && len(events) > n {
+		return events[len(events)-n:]
+	}
+	return events
+}
@@ -0,0 +1,218 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestAdminCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cfg.Gateway.Admin.Chats = []string{"telegram:ops", "slack:C42"}
+	cfg.Gateway.Admin.Senders = []string{"telegram:7", "slack:U1"}
+
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &historyProvider{})
+	h := testHelper{al: al}
+	ctx := context.Background()
+	send := func(channel, sender, chatID, content string) string {
+		return h.executeAndGetResponse(t, ctx, bus.InboundMessage{
+			Channel: channel, SenderID: sender, ChatID: chatID, Content: content,
+		})
+	}
+
+	// Both the chat and the sender have to be an admin's.
+	if got := send("telegram", "7", "elsewhere", "/tools"); got != "/tools is only available in the admin chat" {
+		t.Errorf("/tools from another chat = %q", got)
+	}
+	if got := send("telegram", "8", "ops", "/status"); got != "/status is only available in the admin chat" {
+		t.Errorf("/status from another sender = %q", got)
+	}
+	if got := send("slack", "7", "C42", "/hooks"); !strings.Contains(got, "only available") {
+		t.Errorf("/hooks from a sender of another channel = %q", got)
+	}
+	if got := send("telegram", "7|alice", "ops", "/tools"); !strings.HasPrefix(got, "Tools of agent main (") ||
+		!strings.Contains(got, "exec") {
+		t.Errorf("/tools = %q", got)
+	}
+	if got := send("slack", "U1", "C42", "/hooks"); got != "Channel manager not initialized" {
+		t.Errorf("/hooks = %q", got)
+	}
+	if got := send("telegram", "7", "ops", "/approve"); got != "Nothing is waiting for approval." {
+		t.Errorf("/approve = %q", got)
+	}
+
+	if got := send("telegram", "7", "ops", "/reload"); got != "The config can only be reloaded in the gateway." {
+		t.Errorf("/reload without a reloader = %q", got)
+	}
+	reloads := []struct {
+		changes []config.Change
+		err     error
+	}{
+		{nil, errors.New("config.json: unexpected end of JSON input")},
+		{nil, nil},
+		{[]config.Change{
+			{Path: "agents.defaults.temperature", Old: "0.7", New: "0.2"},
+			{Path: "agents.defaults.workspace", Old: `"/a"`, New: `"/b"`},
+		}, nil},
+	}
+	al.SetConfigReloader(func() ([]config.Change, error) {
+		r := reloads[0]
+		reloads = reloads[1:]
+		return r.changes, r.err
+	})
+	want := []string{
+		"The config was not reloaded: config.json: unexpected end of JSON input",
+		"The config has not changed.",
+		"Reloaded the config: 2 changes.\n" +
+			"Applied now:\n- agents.defaults.temperature: 0.7 -> 0.2\n" +
+			"After a restart:\n- agents.defaults.workspace: \"/a\" -> \"/b\"",
+	}
+	for _, w := range want {
+		if got := send("telegram", "7", "ops", "/reload"); got != w {
+			t.Errorf("/reload = %q, want %q", got, w)
+		}
+	}
+
+	// Refused and privileged commands both go to the audit log.
+	entries, err := state.NewAuditLog(cfg.WorkspacePath()).Recent(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var denied, ok int
+	for _, e := range entries {
+		if e.Action != "command" {
+			t.Errorf("audited %+v", e)
+		}
+		switch e.Outcome {
+		case "denied":
+			denied++
+		case "ok":
+			ok++
+		}
+	}
+	if denied != 3 || ok != 7 || entries[0].Actor != "telegram:7 in elsewhere" || entries[0].Target != "/tools" {
+		t.Errorf("audited %d denied and %d ok commands: %+v", denied, ok, entries)
+	}
+}
+
+func TestEventQueries(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: t.TempDir(), Model: "test-model"},
+		},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &simpleMockProvider{})
+	now := time.Now()
+	for i, ev := range []state.LLMEvent{
+		{AgentID: "main", SessionKey: "a", Model: "m1"},
+		{AgentID: "coder", SessionKey: "b", Model: "m2"},
+		{AgentID: "main", SessionKey: "b", Model: "m3"},
+		{AgentID: "main", SessionKey: "a", Model: "m4"},
+	} {
+		ev.Time = now.Add(time.Duration(i-3) * time.Hour)
+		al.recordLLMEvent(ev)
+	}
+	models := func(q EventQuery) string {
+		events, err := al.LLMEvents(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ev := range events {
+			names = append(names, ev.Model)
+		}
+		return strings.Join(names, ",")
+	}
+	for q, want := range map[EventQuery]string{
+		{}:                                  "m1,m2,m3,m4",
+		{AgentID: "main"}:                   "m1,m3,m4",
+		{AgentID: "main", Limit: 2}:         "m3,m4",
+		{SessionKey: "b"}:                   "m2,m3",
+		{Since: now.Add(-90 * time.Minute)}: "m3,m4",
+	} {
+		if got := models(q); got != want {
+			t.Errorf("LLMEvents(%+v) = %s, want %s", q, got, want)
+		}
+	}
+
+	if err := al.SetFlag("admin_api:ops", "read_only", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := al.SetFlag("admin_api:ops", "tool:nope", false); !errors.Is(err, ErrInvalidFlag) {
+		t.Errorf("SetFlag(tool:nope) = %v, want ErrInvalidFlag", err)
+	}
+	events, err := al.RunEvents(EventQuery{Kind: "flag_changed"})
+	if err != nil || len(events) != 1 || events[0].Source != "admin_api:ops" || events[0].Message != "read_only on" {
+		t.Errorf("RunEvents() = %+v, %v", events, err)
+	}
+}
+
+func TestLogLevelCommand(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+	defer logger.SetComponentLevels(logger.ComponentLevels())
+	logger.SetComponentLevels(nil)
+	al := &AgentLoop{}
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "ops"}
+
+	if got := al.logLevelCommand(msg, []string{"warn"}); got != "Logging at warn." || logger.GetLevel() != logger.WARN {
+		t.Errorf("/loglevel warn = %q", got)
+	}
+	if got := al.logLevelCommand(msg, []string{"channels", "debug"}); got != "channels logs at debug." ||
+		!logger.Enabled("channels", logger.DEBUG) || logger.Enabled("agent", logger.INFO) {
+		t.Errorf("/loglevel channels debug = %q", got)
+	}
+	if got := al.logLevelCommand(msg, nil); got != "Log level: warn (console format)\n- channels: debug" {
+		t.Errorf("/loglevel = %q", got)
+	}
+	if got := al.logLevelCommand(msg, []string{"channels", "loud"}); !strings.Contains(got, "unknown log level") {
+		t.Errorf("/loglevel channels loud = %q", got)
+	}
+	al.logLevelCommand(msg, []string{"channels", "reset"})
+	if logger.Enabled("channels", logger.DEBUG) {
+		t.Error("channels still logs debug after reset")
+	}
+}
+
+func TestLogsCommand(t *testing.T) {
+	al := &AgentLoop{profiles: state.NewProfileStore(t.TempDir())}
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "ops"}
+	if got := al.logsCommand(msg, nil); !strings.Contains(got, "keep_recent") {
+		t.Errorf("/logs without kept entries = %q", got)
+	}
+
+	defer logger.KeepRecent(0)
+	logger.KeepRecent(10)
+	logger.InfoCF("channels", "Connected", map[string]any{"account": "work"})
+	logger.WarnCF("channels", "Reconnecting", map[string]any{"error": "EOF", "account": "work"})
+	logger.WarnCF("cron", "Job failed", map[string]any{"task_id": "9c41e0a2"})
+
+	if got := al.logsCommand(msg, []string{"warn", "channels"}); !strings.HasSuffix(got, " WARN channels: Reconnecting {account=work, error=EOF}") ||
+		strings.Contains(got, "\n") {
+		t.Errorf("/logs warn channels = %q", got)
+	}
+	if got := al.logsCommand(msg, []string{"find", "9c41e0a2"}); !strings.Contains(got, "cron: Job failed") || strings.Contains(got, "\n") {
+		t.Errorf("/logs find = %q", got)
+	}
+	if got := al.logsCommand(msg, []string{"1"}); !strings.Contains(got, "Job failed") || strings.Contains(got, "\n") {
+		t.Errorf("/logs 1 = %q", got)
+	}
+	if got := al.logsCommand(msg, []string{"agent"}); got != "No log entries match." {
+		t.Errorf("/logs agent = %q", got)
+	}
+}
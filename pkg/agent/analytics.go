@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/analytics"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// analyticsPeriod is how far back the weekly summary looks.
+const analyticsPeriod = 7 * 24 * time.Hour
+
+// Analytics sums up the runs, tool calls, LLM requests and conversations
+// from from up to to, reading hours of the day in loc.
+func (al *AgentLoop) Analytics(from, to time.Time, loc *time.Location) (*analytics.Report, error) {
+	traces, err := al.traces.Since(from)
+	if err != nil {
+		return nil, err
+	}
+	llm, err := al.llmEvents.Since(from)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []analytics.Session
+	for _, id := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(id)
+		if !ok {
+			continue
+		}
+		for _, info := range agent.Sessions.UpdatedSince(from) {
+			sessions = append(sessions, analytics.Session{AgentID: agent.ID, Key: info.Key, Updated: info.Updated})
+		}
+	}
+	return analytics.Compute(from, to, loc, traces, llm, sessions), nil
+}
+
+// WorkspaceAnalytics is Analytics read from the workspace and the session
+// stores, for when no gateway runs in this process.
+func WorkspaceAnalytics(cfg *config.Config, from, to time.Time, loc *time.Location) (*analytics.Report, error) {
+	workspace := cfg.WorkspacePath()
+	traces, err := state.NewTraceLog(workspace).Since(from)
+	if err != nil {
+		return nil, err
+	}
+	llm, err := state.NewLLMEventLog(workspace).Since(from)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []analytics.Session
+	for id, dir := range Workspaces(cfg) {
+		dir = filepath.Join(dir, "sessions")
+		// A local store that was never written has no sessions to read,
+		// and opening it would create it.
+		if b := session.Backend(cfg.Session.Store); b == "sqlite" || b == "file" {
+			if _, err := os.Stat(dir); err != nil {
+				continue
+			}
+		}
+		store, err := session.OpenStore(cfg.Session.Store, dir, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the sessions of agent %s: %w", id, err)
+		}
+		stored, err := store.Load()
+		store.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the sessions of agent %s: %w", id, err)
+		}
+		for _, s := range stored {
+			sessions = append(sessions, analytics.Session{AgentID: id, Key: s.Key, Updated: s.Updated})
+		}
+	}
+	return analytics.Compute(from, to, loc, traces, llm, sessions), nil
+}
+
+// RunAnalyticsSummaries posts a summary of the last seven days to the
+// admin chat at each run of schedule until ctx ends.
+func (al *AgentLoop) RunAnalyticsSummaries(ctx context.Context, schedule cron.CronSchedule, loc *time.Location) {
+	for {
+		runs := cron.NextRuns(schedule, time.Now(), 1)
+		if len(runs) == 0 {
+			logger.ErrorCF("agent", "The analytics schedule has no next run", nil)
+			return
+		}
+		timer := time.NewTimer(time.Until(runs[0]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := al.postAnalyticsSummary(time.Now(), loc); err != nil {
+			logger.WarnCF("agent", "Failed to post the analytics summary", map[string]any{"error": err.Error()})
+		}
+	}
+}
+
+// postAnalyticsSummary posts the summary of the seven days before now to
+// the admin chat.
+func (al *AgentLoop) postAnalyticsSummary(now time.Time, loc *time.Location) error {
+	channel, chatID, ok := al.cfg.AdminChat()
+	if !ok {
+		return nil
+	}
+	report, err := al.Analytics(now.Add(-analyticsPeriod), now, loc)
+	if err != nil {
+		return err
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:   channel,
+		ChatID:    chatID,
+		Proactive: true,
+		Content:   report.Summary(),
+	})
+	return nil
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Audit records a security-relevant event in the audit log of the
+// workspace, logging when that fails: the audit never stops what it
+// records.
+func (al *AgentLoop) Audit(e state.AuditEntry) {
+	if al.auditLog == nil {
+		return
+	}
+	if _, err := al.auditLog.Append(e); err != nil {
+		logger.ErrorCF("agent", "Failed to write the audit log", map[string]any{
+			"action": e.Action,
+			"target": e.Target,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// auditCommand records a privileged command sent in a chat. outcome is
+// "ok" or "denied"; the arguments of a refused command are left out, as
+// they may be anything the sender wrote.
+func (al *AgentLoop) auditCommand(msg bus.InboundMessage, outcome string) {
+	command, args, _ := strings.Cut(strings.TrimSpace(msg.Content), " ")
+	if outcome != "ok" {
+		args = ""
+	}
+	al.Audit(state.AuditEntry{
+		Action:  "command",
+		Actor:   auditActor(msg),
+		Target:  command,
+		Outcome: outcome,
+		Detail:  strings.TrimSpace(args),
+	})
+}
+
+// auditActor names the sender of msg in the audit log, with the chat
+// when that is not their direct chat.
+func auditActor(msg bus.InboundMessage) string {
+	actor := msg.Channel + ":" + msg.SenderID
+	if msg.ChatID != msg.SenderID {
+		actor += " in " + msg.ChatID
+	}
+	return actor
+}
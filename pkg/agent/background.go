@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// llmQueue holds back background LLM requests, from cron jobs and
+// heartbeats, while interactive ones are in flight, so scheduled work does
+// not eat into the rate limits a user is waiting on. Interactive requests
+// never wait.
+type llmQueue struct {
+	maxBackground int
+	maxWait       time.Duration
+	serviceTier   string
+
+	mu          sync.Mutex
+	interactive int
+	background  int
+	waiting     int
+	changed     chan struct{} // closed and replaced whenever a request finishes
+}
+
+func newLLMQueue(cfg config.BackgroundQueueConfig) *llmQueue {
+	return &llmQueue{
+		maxBackground: max(cfg.MaxConcurrency, 1),
+		maxWait:       time.Duration(cfg.MaxWaitSeconds) * time.Second,
+		serviceTier:   cfg.ServiceTier,
+		changed:       make(chan struct{}),
+	}
+}
+
+// acquire admits a request and returns the function that ends it. A
+// background request waits until no interactive request runs and fewer than
+// maxBackground background ones do; after maxWait it only waits for the
+// latter. It fails if ctx ends first.
+func (q *llmQueue) acquire(ctx context.Context, background bool) (func(), error) {
+	q.mu.Lock()
+	if !background {
+		q.interactive++
+		q.mu.Unlock()
+		return func() { q.release(&q.interactive) }, nil
+	}
+
+	var deadline <-chan time.Time
+	if q.maxWait > 0 {
+		timer := time.NewTimer(q.maxWait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	overdue := false
+	q.waiting++
+	for q.background >= q.maxBackground || (q.interactive > 0 && !overdue) {
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-deadline:
+			overdue, deadline = true, nil
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.waiting--
+			q.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		q.mu.Lock()
+	}
+	q.waiting--
+	q.background++
+	q.mu.Unlock()
+	return func() { q.release(&q.background) }, nil
+}
+
+func (q *llmQueue) release(count *int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	*count--
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// queued returns the number of background requests waiting their turn.
+func (q *llmQueue) queued() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// acquireAsync starts a background request and reports when it is admitted.
+func acquireAsync(ctx context.Context, q *llmQueue) (<-chan func(), <-chan error) {
+	admitted := make(chan func(), 1)
+	failed := make(chan error, 1)
+	go func() {
+		done, err := q.acquire(ctx, true)
+		if err != nil {
+			failed <- err
+			return
+		}
+		admitted <- done
+	}()
+	return admitted, failed
+}
+
+func waitQueued(t *testing.T, q *llmQueue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for q.queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", q.queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLLMQueue_BackgroundWaitsForInteractive(t *testing.T) {
+	q := newLLMQueue(config.BackgroundQueueConfig{MaxConcurrency: 1})
+	ctx := context.Background()
+
+	chat, _ := q.acquire(ctx, false)
+	admitted, _ := acquireAsync(ctx, q)
+	waitQueued(t, q, 1)
+
+	// Interactive requests are never held back, not even by each other.
+	chat2, _ := q.acquire(ctx, false)
+	chat()
+	select {
+	case <-admitted:
+		t.Fatal("background request ran while a chat was answered")
+	case <-time.After(20 * time.Millisecond):
+	}
+	chat2()
+
+	var job func()
+	select {
+	case job = <-admitted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("background request was not admitted")
+	}
+
+	// Only one background request at a time.
+	second, _ := acquireAsync(ctx, q)
+	waitQueued(t, q, 1)
+	job()
+	select {
+	case done := <-second:
+		done()
+	case <-time.After(2 * time.Second):
+		t.Fatal("second background request was not admitted")
+	}
+	if q.queued() != 0 {
+		t.Errorf("queued = %d after all finished", q.queued())
+	}
+}
+
+func TestLLMQueue_MaxWait(t *testing.T) {
+	q := newLLMQueue(config.BackgroundQueueConfig{MaxConcurrency: 1})
+	q.maxWait = 20 * time.Millisecond
+	chat, _ := q.acquire(context.Background(), false)
+	defer chat()
+
+	admitted, _ := acquireAsync(context.Background(), q)
+	select {
+	case done := <-admitted:
+		done()
+	case <-time.After(2 * time.Second):
+		t.Fatal("background request waited past max_wait_seconds")
+	}
+}
+
+func TestLLMQueue_Canceled(t *testing.T) {
+	q := newLLMQueue(config.BackgroundQueueConfig{})
+	chat, _ := q.acquire(context.Background(), false)
+	defer chat()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, failed := acquireAsync(ctx, q)
+	waitQueued(t, q, 1)
+	cancel()
+	select {
+	case err := <-failed:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("canceled request kept waiting")
+	}
+	if q.queued() != 0 {
+		t.Errorf("queued = %d", q.queued())
+	}
+}
@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// batcher holds back non-urgent group messages until the chat has been
+// quiet for a while, then hands them to the dispatcher as one message so
+// a busy group costs one run instead of one per message.
+type batcher struct {
+	cfg     config.GroupBatchesConfig
+	quiet   time.Duration
+	maxWait time.Duration
+	submit  func(ctx context.Context, msg bus.InboundMessage) bool
+	ack     func(ctx context.Context, msg bus.InboundMessage)
+
+	mu      sync.Mutex
+	batches map[string]*batch
+}
+
+type batch struct {
+	msgs  []bus.InboundMessage
+	first time.Time
+	timer *time.Timer
+}
+
+func newBatcher(
+	cfg config.GroupBatchesConfig,
+	submit func(ctx context.Context, msg bus.InboundMessage) bool,
+	ack func(ctx context.Context, msg bus.InboundMessage),
+) *batcher {
+	return &batcher{
+		cfg:     cfg,
+		quiet:   time.Duration(max(cfg.QuietSeconds, 1)) * time.Second,
+		maxWait: time.Duration(max(cfg.MaxWaitSeconds, cfg.QuietSeconds, 1)) * time.Second,
+		submit:  submit,
+		ack:     ack,
+		batches: make(map[string]*batch),
+	}
+}
+
+// add holds msg back for a later batch and acknowledges it. It returns
+// false, without doing anything, if msg should be handled right away.
+func (b *batcher) add(ctx context.Context, msg bus.InboundMessage) bool {
+	if !b.cfg.Enabled || b.urgent(msg) {
+		return false
+	}
+	b.ack(ctx, msg)
+
+	key := msg.Channel + ":" + msg.ChatID
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bt, ok := b.batches[key]
+	if !ok {
+		bt = &batch{first: now}
+		b.batches[key] = bt
+	}
+	bt.msgs = append(bt.msgs, msg)
+
+	delay := min(b.quiet, max(bt.first.Add(b.maxWait).Sub(now), 0))
+	if bt.timer != nil {
+		bt.timer.Stop()
+	}
+	bt.timer = time.AfterFunc(delay, func() { b.flush(ctx, key, bt) })
+	return true
+}
+
+// pending returns the number of messages held back.
+func (b *batcher) pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, bt := range b.batches {
+		n += len(bt.msgs)
+	}
+	return n
+}
+
+// dropWhere removes the held-back messages match returns true for and
+// returns how many it removed. A batch left empty is not flushed.
+func (b *batcher) dropWhere(match func(msg bus.InboundMessage) bool) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for key, bt := range b.batches {
+		before := len(bt.msgs)
+		bt.msgs = slices.DeleteFunc(bt.msgs, match)
+		n += before - len(bt.msgs)
+		if len(bt.msgs) == 0 {
+			bt.timer.Stop()
+			delete(b.batches, key)
+		}
+	}
+	return n
+}
+
+// takeAll removes the held-back messages and returns them, so no batch is
+// flushed.
+func (b *batcher) takeAll() []bus.InboundMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var taken []bus.InboundMessage
+	for key, bt := range b.batches {
+		bt.timer.Stop()
+		taken = append(taken, bt.msgs...)
+		delete(b.batches, key)
+	}
+	return taken
+}
+
+func (b *batcher) flush(ctx context.Context, key string, bt *batch) {
+	b.mu.Lock()
+	if b.batches[key] != bt {
+		// Already flushed by an earlier timer.
+		b.mu.Unlock()
+		return
+	}
+	delete(b.batches, key)
+	msgs := bt.msgs
+	b.mu.Unlock()
+
+	if ctx.Err() != nil {
+		logger.WarnCF("agent", "Dropped batched messages on shutdown", map[string]any{
+			"chat":     key,
+			"messages": len(msgs),
+		})
+		return
+	}
+	logger.InfoCF("agent", "Processing batched group messages", map[string]any{
+		"chat":     key,
+		"messages": len(msgs),
+	})
+	b.submit(ctx, mergeBatch(msgs))
+}
+
+// urgent reports whether msg skips batching: anything outside group
+// chats, commands, mentions of the bot and messages with an urgent keyword.
+func (b *batcher) urgent(msg bus.InboundMessage) bool {
+	kind := msg.Metadata["peer_kind"]
+	if msg.Channel == "system" || kind == "" || kind == "direct" {
+		return true
+	}
+	content := strings.TrimSpace(msg.Content)
+	if strings.HasPrefix(content, "/") {
+		return true
+	}
+	if msg.Metadata["is_mention"] == "true" || msg.Metadata["is_mentioned"] == "true" {
+		return true
+	}
+	lower := strings.ToLower(content)
+	for _, keyword := range b.cfg.UrgentKeywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeBatch joins the messages of a batch. When several people wrote,
+// each line is prefixed with its sender's name so the agent can tell them apart.
+func mergeBatch(msgs []bus.InboundMessage) bus.InboundMessage {
+	merged := mergeMessages(msgs)
+	senders := make(map[string]bool)
+	for _, m := range msgs {
+		senders[m.SenderID] = true
+	}
+	if len(senders) < 2 {
+		return merged
+	}
+	lines := make([]string, 0, len(msgs))
+	speakers := make([]string, 0, len(senders))
+	for _, m := range msgs {
+		name := speakerName(m)
+		if m.Content != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, m.Content))
+		}
+		if senders[m.SenderID] {
+			speakers = append(speakers, speakerID(m.SenderID)+"\t"+name)
+			senders[m.SenderID] = false
+		}
+	}
+	merged.Content = strings.Join(lines, "\n")
+	// The speakers let the agent record every participant of the batch, not
+	// only the last one.
+	metadata := make(map[string]string, len(merged.Metadata)+1)
+	for k, v := range merged.Metadata {
+		metadata[k] = v
+	}
+	metadata["batch_speakers"] = strings.Join(speakers, "\n")
+	merged.Metadata = metadata
+	return merged
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func groupMessage(chatID, sender, content string) bus.InboundMessage {
+	msg := inbound(chatID, sender, content)
+	msg.Metadata = map[string]string{"peer_kind": "group", "message_id": content}
+	return msg
+}
+
+func TestBatcherMergesQuietGroup(t *testing.T) {
+	var mu sync.Mutex
+	var acked []string
+	submitted := make(chan bus.InboundMessage, 4)
+	b := newBatcher(config.GroupBatchesConfig{Enabled: true, UrgentKeywords: []string{"urgent"}},
+		func(ctx context.Context, msg bus.InboundMessage) bool {
+			submitted <- msg
+			return true
+		},
+		func(ctx context.Context, msg bus.InboundMessage) {
+			mu.Lock()
+			acked = append(acked, msg.Metadata["message_id"])
+			mu.Unlock()
+		})
+	b.quiet = 50 * time.Millisecond
+	ctx := context.Background()
+
+	if !b.add(ctx, groupMessage("g", "alice", "lunch?")) || !b.add(ctx, groupMessage("g", "bob", "sure")) {
+		t.Fatal("group messages were not batched")
+	}
+	if b.add(ctx, inbound("dm", "alice", "hi")) {
+		t.Error("direct message was batched")
+	}
+	if b.add(ctx, groupMessage("g", "carol", "/help")) {
+		t.Error("command was batched")
+	}
+	if b.add(ctx, groupMessage("g", "carol", "URGENT: server down")) {
+		t.Error("urgent message was batched")
+	}
+	if b.pending() != 2 {
+		t.Errorf("pending = %d, want 2", b.pending())
+	}
+
+	select {
+	case msg := <-submitted:
+		if msg.Content != "alice: lunch?\nbob: sure" {
+			t.Errorf("merged content = %q", msg.Content)
+		}
+		if msg.Metadata["message_id"] != "sure" {
+			t.Errorf("merged message should reply to the last one, got %v", msg.Metadata)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("batch was never submitted")
+	}
+	select {
+	case msg := <-submitted:
+		t.Errorf("unexpected second submit: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(acked) != 2 {
+		t.Errorf("acked = %v, want both batched messages", acked)
+	}
+}
+
+func TestBatcherMaxWait(t *testing.T) {
+	submitted := make(chan bus.InboundMessage, 4)
+	b := newBatcher(config.GroupBatchesConfig{Enabled: true},
+		func(ctx context.Context, msg bus.InboundMessage) bool {
+			submitted <- msg
+			return true
+		},
+		func(context.Context, bus.InboundMessage) {})
+	b.quiet = time.Hour
+	b.maxWait = 50 * time.Millisecond
+
+	b.add(context.Background(), groupMessage("g", "alice", "one"))
+	select {
+	case msg := <-submitted:
+		if msg.Content != "one" {
+			t.Errorf("content = %q", msg.Content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("max wait did not flush the batch")
+	}
+}
+
+func TestBatcherDisabled(t *testing.T) {
+	b := newBatcher(config.GroupBatchesConfig{}, nil, nil)
+	if b.add(context.Background(), groupMessage("g", "alice", "hi")) {
+		t.Error("disabled batcher held a message back")
+	}
+}
@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+// Why a run was cancelled, as reported by context.Cause.
+var (
+	errStopped        = errors.New("stopped by the user")
+	errMessageDeleted = errors.New("message deleted")
+	errSenderErased   = errors.New("sender's data erased")
+)
+
+// activeRun is a message being answered. /stop, deleting the message or
+// the watchdog cancels it.
+type activeRun struct {
+	messageID string
+	sender    string // profile ID, see profileID
+	started   time.Time
+	cancel    context.CancelCauseFunc
+
+	mu    sync.Mutex // guards stage and calls, see enterStage
+	stage string
+	calls []*toolCall
+}
+
+// startRun registers the run of msg and returns its context and the
+// function that ends it. The dispatcher runs one message per chat at a time,
+// so a chat has at most one run.
+func (al *AgentLoop) startRun(ctx context.Context, msg bus.InboundMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := msg.Channel + ":" + msg.ChatID
+	run := &activeRun{
+		messageID: msg.Metadata["message_id"], sender: profileID(msg), started: time.Now(), cancel: cancel,
+		stage: "preparing",
+	}
+	ctx = context.WithValue(ctx, activeRunKey{}, run)
+
+	al.runsMu.Lock()
+	al.runs[key] = run
+	al.runsMu.Unlock()
+	return ctx, func() {
+		al.runsMu.Lock()
+		if al.runs[key] == run {
+			delete(al.runs, key)
+		}
+		al.runsMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancelRun cancels the run of a chat, if it answers messageID or
+// messageID is empty. It reports whether a run was cancelled.
+func (al *AgentLoop) cancelRun(key, messageID string, cause error) bool {
+	al.runsMu.Lock()
+	defer al.runsMu.Unlock()
+	run, ok := al.runs[key]
+	if !ok || (messageID != "" && run.messageID != messageID) {
+		return false
+	}
+	run.cancel(cause)
+	delete(al.runs, key)
+	return true
+}
+
+// cancelSenderRuns cancels the runs answering sender and returns how many
+// it cancelled.
+func (al *AgentLoop) cancelSenderRuns(sender string, cause error) int {
+	al.runsMu.Lock()
+	defer al.runsMu.Unlock()
+	n := 0
+	for key, run := range al.runs {
+		if run.sender == sender {
+			run.cancel(cause)
+			delete(al.runs, key)
+			n++
+		}
+	}
+	return n
+}
+
+// interrupt handles the messages that act on a chat's run instead of
+// waiting behind it in the queue: /stop, and reports of a deleted message.
+// It returns false for all other messages.
+func (al *AgentLoop) interrupt(msg bus.InboundMessage) bool {
+	key := msg.Channel + ":" + msg.ChatID
+	if msg.Metadata["event"] == bus.EventMessageDeleted {
+		id := msg.Metadata["message_id"]
+		if id == "" {
+			return true
+		}
+		dropped := al.dispatcher.drop(key, id)
+		cancelled := al.cancelRun(key, id, errMessageDeleted)
+		if dropped || cancelled {
+			logger.InfoCF("agent", "Message deleted, not answering it", map[string]any{
+				"channel":    msg.Channel,
+				"chat_id":    msg.ChatID,
+				"message_id": id,
+				"running":    cancelled,
+			})
+		}
+		return true
+	}
+
+	if strings.TrimSpace(msg.Content) != "/stop" {
+		return false
+	}
+	reply := al.t(msg, "Nothing to stop.")
+	if al.cancelRun(key, "", errStopped) {
+		reply = al.t(msg, "Stopped.")
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply})
+	return true
+}
+
+// runCancellation returns why the run of ctx was cancelled, or nil if it
+// was not cancelled by /stop, a deleted message or the watchdog.
+func runCancellation(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, errStopped) || errors.Is(cause, errMessageDeleted) || errors.Is(cause, errSenderErased) ||
+		asTimeout(cause) != nil {
+		return cause
+	}
+	return nil
+}
+
+// finishCancelled closes a cancelled run. A stopped or timed out answer is
+// noted in the session, so the model knows it never got through; a deleted
+// message is taken out of the session along with everything the run added.
+// The session of a sender being erased is left to the erasure.
+func (al *AgentLoop) finishCancelled(
+	agent *AgentInstance,
+	opts processOptions,
+	before []providers.Message,
+	iteration int,
+	cause error,
+) {
+	switch {
+	case errors.Is(cause, errSenderErased):
+		logger.InfoCF("agent", "Run cancelled for an erasure",
+			map[string]any{"agent_id": agent.ID, "iterations": iteration})
+		return
+	case errors.Is(cause, errMessageDeleted):
+		agent.Sessions.SetHistory(opts.SessionKey, before)
+	case asTimeout(cause) != nil:
+		agent.Sessions.AddMessage(opts.SessionKey, "assistant",
+			fmt.Sprintf("(Stopped before finishing the answer: %s.)", cause))
+	default:
+		agent.Sessions.AddMessage(opts.SessionKey, "assistant", "(Stopped by the user before finishing the answer.)")
+	}
+	agent.Sessions.Save(opts.SessionKey)
+
+	kind := "cancelled"
+	if asTimeout(cause) != nil {
+		kind = "timeout"
+	}
+	al.recordRunEvent(state.RunEvent{
+		Kind:    kind,
+		Source:  agent.ID,
+		Message: fmt.Sprintf("%s: %s after %d iterations", opts.SessionKey, cause, iteration),
+	})
+	logger.InfoCF("agent", "Run cancelled", map[string]any{
+		"agent_id":    agent.ID,
+		"session_key": opts.SessionKey,
+		"iterations":  iteration,
+		"reason":      cause.Error(),
+	})
+}
+
+// setCancelledUsage fills in ev for a request cut off by a cancelled run.
+// The provider reports no usage then, but bills the prompt it started on
+// and what it streamed back so far, so both are estimated.
+func setCancelledUsage(ctx context.Context, ev *state.LLMEvent, model string, promptTokens int, streamed string) {
+	ev.Cancelled = true
+	ev.Error = context.Cause(ctx).Error()
+	ev.PromptTokens = promptTokens
+	if streamed != "" {
+		ev.CompletionTokens = tokenizer.Count(model, streamed)
+	}
+}
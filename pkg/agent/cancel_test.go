@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// hangingProvider blocks until the request is cancelled, like a slow API.
+type hangingProvider struct {
+	started chan struct{}
+	err     chan error
+}
+
+func (p *hangingProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+	p.err <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (p *hangingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func newCancelTestLoop(t *testing.T) (*AgentLoop, *hangingProvider, *bus.MessageBus, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &hangingProvider{started: make(chan struct{}, 1), err: make(chan error, 1)}
+	msgBus := bus.NewMessageBus()
+	return newTestLoop(t, cfg, msgBus, provider), provider, msgBus, workspace
+}
+
+// startHanging handles msg in the background until the provider is asked.
+func startHanging(t *testing.T, al *AgentLoop, p *hangingProvider, msg bus.InboundMessage) <-chan struct{} {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		al.handleInbound(context.Background(), msg)
+		close(done)
+	}()
+	select {
+	case <-p.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("provider was not called")
+	}
+	return done
+}
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("run kept going after it was cancelled")
+	}
+}
+
+func TestAgentLoop_StopCancelsRun(t *testing.T) {
+	al, provider, msgBus, workspace := newCancelTestLoop(t)
+	msg := bus.InboundMessage{
+		Channel: "telegram", ChatID: "c1", SenderID: "u1", Content: "Write me a long essay.",
+		SessionKey: "agent:main:stop", Metadata: map[string]string{"message_id": "10"},
+	}
+	done := startHanging(t, al, provider, msg)
+
+	if !al.interrupt(bus.InboundMessage{Channel: "telegram", ChatID: "c1", Content: "/stop"}) {
+		t.Fatal("/stop was not handled")
+	}
+	waitDone(t, done)
+	if err := <-provider.err; !errors.Is(err, context.Canceled) {
+		t.Errorf("provider request ended with %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if out, ok := msgBus.SubscribeOutbound(ctx); !ok || out.Content != "Stopped." {
+		t.Errorf("reply = %+v", out)
+	}
+	// The cancelled run itself replies nothing, not even an error.
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	if out, ok := msgBus.SubscribeOutbound(short); ok {
+		t.Errorf("unexpected reply %+v", out)
+	}
+
+	history := al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:stop")
+	if len(history) != 2 || history[1].Role != "assistant" {
+		t.Errorf("history = %+v", history)
+	}
+
+	llmEvents, err := state.NewLLMEventLog(workspace).Recent(5)
+	if err != nil || len(llmEvents) != 1 {
+		t.Fatalf("llm events = %+v, %v", llmEvents, err)
+	}
+	if ev := llmEvents[0]; !ev.Cancelled || ev.PromptTokens == 0 || ev.Error != errStopped.Error() {
+		t.Errorf("llm event = %+v", ev)
+	}
+	runEvents, err := state.NewEventLog(workspace).Recent(5)
+	if err != nil || len(runEvents) != 1 || runEvents[0].Kind != "cancelled" {
+		t.Errorf("run events = %+v, %v", runEvents, err)
+	}
+
+	if al.interrupt(bus.InboundMessage{Channel: "telegram", ChatID: "c1", Content: "hello"}) {
+		t.Error("a plain message was taken as an interrupt")
+	}
+	al.interrupt(bus.InboundMessage{Channel: "telegram", ChatID: "c1", Content: "/stop"})
+	if out, _ := msgBus.SubscribeOutbound(ctx); out.Content != "Nothing to stop." {
+		t.Errorf("second reply = %+v", out)
+	}
+}
+
+func TestAgentLoop_DeletedMessageCancelsRun(t *testing.T) {
+	al, provider, _, _ := newCancelTestLoop(t)
+	msg := bus.InboundMessage{
+		Channel: "discord", ChatID: "c1", SenderID: "u1", Content: "my password is hunter2",
+		SessionKey: "agent:main:deleted", Metadata: map[string]string{"message_id": "10"},
+	}
+	done := startHanging(t, al, provider, msg)
+
+	deleted := func(id string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "discord", ChatID: "c1", Metadata: map[string]string{
+			"event": bus.EventMessageDeleted, "message_id": id,
+		}}
+	}
+	// Deleting another message leaves the run alone.
+	if !al.interrupt(deleted("9")) {
+		t.Fatal("deletion was not handled")
+	}
+	select {
+	case <-done:
+		t.Fatal("run ended when an unrelated message was deleted")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	al.interrupt(deleted("10"))
+	waitDone(t, done)
+	if history := al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:deleted"); len(history) != 0 {
+		t.Errorf("deleted message kept in history: %+v", history)
+	}
+}
+
+func TestDispatcher_Drop(t *testing.T) {
+	rec := newRecorder("c1")
+	d := newDispatcher(config.QueueConfig{MaxPending: 10}, newScheduler(0, 1), rec.handle, nil)
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		d.submit(ctx, bus.InboundMessage{
+			Channel: "discord", ChatID: "c1", Content: id, Metadata: map[string]string{"message_id": id},
+		})
+	}
+	<-rec.started
+	if !d.drop("discord:c1", "2") || d.drop("discord:c1", "2") {
+		t.Fatal("drop did not remove the queued message exactly once")
+	}
+	close(rec.hold["c1"])
+	if got := rec.wait(t, 2); len(got) != 2 || got[0] != "c1:1" || got[1] != "c1:3" {
+		t.Errorf("handled = %v", got)
+	}
+	if d.depth() != 0 {
+		t.Errorf("depth = %d", d.depth())
+	}
+}
@@ -0,0 +1,312 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// consolidationCheckInterval is how often the consolidation job looks
+	// for agents that are due.
+	consolidationCheckInterval = 10 * time.Minute
+	// What of the sessions updated since the last run is reviewed: the
+	// most recent sessions, their latest messages, each cut short.
+	maxConsolidationSessions = 20
+	maxConsolidationMessages = 40
+	maxConsolidationChars    = 1000
+)
+
+const consolidationInstructions = `You maintain the long-term memory of an AI assistant. You are given the facts it remembers, each with its ID, and its recent conversations, each with a number.
+
+First, find durable facts in the conversations that are worth knowing in future conversations: about the people, their plans, decisions and preferences, and the projects discussed. Skip small talk, one-off requests and anything already remembered.
+Then, find remembered facts that the conversations contradict or that no longer hold, such as plans whose date has passed.
+
+Reply with JSON only, in this form:
+{"remember": [{"fact": "one self-contained sentence", "source": "a short quote it was learned from", "session": 1}], "forget": [{"id": 3, "reason": "why it no longer holds"}]}`
+
+// consolidationProposal is what the consolidation model suggests.
+type consolidationProposal struct {
+	Remember []struct {
+		Fact    string `json:"fact"`
+		Source  string `json:"source"`
+		Session int    `json:"session"`
+	} `json:"remember"`
+	Forget []struct {
+		ID     int    `json:"id"`
+		Reason string `json:"reason"`
+	} `json:"forget"`
+}
+
+// parseConsolidation reads the JSON object in a reply, ignoring any text
+// or code fence around it.
+func parseConsolidation(content string) (consolidationProposal, error) {
+	var p consolidationProposal
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return p, fmt.Errorf("no JSON object in the reply")
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &p); err != nil {
+		return p, fmt.Errorf("failed to parse the reply: %w", err)
+	}
+	return p, nil
+}
+
+// runConsolidation consolidates the memory of every agent whose last run
+// is older than the configured interval, until ctx ends.
+func (al *AgentLoop) runConsolidation(ctx context.Context) {
+	interval := time.Duration(al.cfg.Memory.Consolidation.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	ticker := time.NewTicker(consolidationCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, id := range al.registry.ListAgentIDs() {
+			agent, ok := al.registry.GetAgent(id)
+			if !ok || time.Since(agent.ContextBuilder.memory.consolidation.LastRun()) < interval {
+				continue
+			}
+			if err := al.consolidateMemories(ctx, agent); err != nil {
+				logger.WarnCF("agent", "Memory consolidation failed",
+					map[string]any{"agent_id": agent.ID, "error": err.Error()})
+			}
+		}
+	}
+}
+
+// consolidateMemories has the consolidation model review the agent's
+// sessions updated since the last run, then writes the facts it finds and
+// forgets those it finds stale, or holds the changes for approval.
+// Duplicates of remembered or pending facts are dropped. Every change is
+// recorded as a run event.
+func (al *AgentLoop) consolidateMemories(ctx context.Context, agent *AgentInstance) error {
+	cfg := al.cfg.Memory.Consolidation
+	mem := agent.ContextBuilder.memory
+	started := time.Now()
+
+	transcript, keys := consolidationTranscript(agent, mem.consolidation.LastRun())
+	if len(keys) == 0 {
+		return mem.consolidation.Finish(started, nil)
+	}
+	var known strings.Builder
+	for _, f := range mem.facts.All() {
+		fmt.Fprintf(&known, "- [#%d] %s (learned %s)\n", f.ID, f.Text, f.Learned.Format("2006-01-02"))
+	}
+	if known.Len() == 0 {
+		known.WriteString("(none)\n")
+	}
+	messages := []providers.Message{
+		{Role: "system", Content: consolidationInstructions},
+		{Role: "user", Content: fmt.Sprintf("Today is %s.\n\nRemembered facts:\n%s\nConversations:\n%s",
+			started.Format("2006-01-02"), known.String(), transcript)},
+	}
+
+	ctx = providers.WithBackground(ctx)
+	done, err := al.llmQueue.acquire(ctx, true)
+	if err != nil {
+		return err
+	}
+	model, provider, vendor, route, _ := al.requestModel(agent, cfg.Model)
+	callCtx, cancel := agent.llmContext(ctx)
+	resp, err := provider.Chat(callCtx, messages, nil, model, map[string]any{
+		"max_tokens":  2048,
+		"temperature": 0.0,
+	})
+	cancel()
+	done()
+	ev := state.LLMEvent{
+		AgentID: agent.ID, Provider: vendor, Model: model, Route: route, Background: true,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	setLLMUsage(&ev, resp)
+	al.recordLLMEvent(ev)
+	if err != nil {
+		return err
+	}
+	providers.SeparateReasoning(resp)
+	proposal, err := parseConsolidation(resp.Content)
+	if err != nil {
+		return err
+	}
+
+	changes := consolidationChanges(proposal, keys, mem, started)
+	if cfg.RequireApproval {
+		if err := mem.consolidation.Finish(started, changes); err != nil {
+			return err
+		}
+		for _, c := range changes {
+			al.recordRunEvent(state.RunEvent{
+				Kind:    "memory_proposed",
+				Source:  agent.ID,
+				Message: describeFactChange(mem, c),
+			})
+		}
+		al.announcePendingMemories(agent, len(changes))
+		return nil
+	}
+	for _, c := range changes {
+		if err := al.applyFactChange(agent, c); err != nil {
+			return err
+		}
+	}
+	return mem.consolidation.Finish(started, nil)
+}
+
+// consolidationTranscript renders the latest messages of the sessions
+// updated after since, numbered, and returns it with their keys in that
+// order. Subagent sessions are left out.
+func consolidationTranscript(agent *AgentInstance, since time.Time) (string, []string) {
+	var sb strings.Builder
+	var keys []string
+	for _, info := range agent.Sessions.UpdatedSince(since) {
+		if len(keys) == maxConsolidationSessions {
+			break
+		}
+		if routing.IsSubagentSessionKey(info.Key) {
+			continue
+		}
+		var lines []string
+		for _, m := range agent.Sessions.GetHistory(info.Key) {
+			if (m.Role == "user" || m.Role == "assistant") && strings.TrimSpace(m.Content) != "" {
+				lines = append(lines, fmt.Sprintf("%s: %s", m.Role, utils.Truncate(m.Content, maxConsolidationChars)))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		keys = append(keys, info.Key)
+		fmt.Fprintf(&sb, "\n### Conversation %d\n", len(keys))
+		for _, line := range lines[max(len(lines)-maxConsolidationMessages, 0):] {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String(), keys
+}
+
+// consolidationChanges turns a proposal into changes, dropping facts that
+// are empty, already remembered or pending, or proposed twice, and
+// forgetting only facts that exist.
+func consolidationChanges(
+	p consolidationProposal,
+	keys []string,
+	mem *MemoryStore,
+	now time.Time,
+) []state.FactChange {
+	seen := make(map[string]bool)
+	forgetting := make(map[int]bool)
+	for _, c := range mem.consolidation.Pending() {
+		if c.Add != nil {
+			seen[state.NormalizeFact(c.Add.Text)] = true
+		} else {
+			forgetting[c.Forget] = true
+		}
+	}
+
+	var changes []state.FactChange
+	for _, r := range p.Remember {
+		text := strings.TrimSpace(r.Fact)
+		key := state.NormalizeFact(text)
+		if _, known := mem.facts.Find(text); text == "" || known || seen[key] {
+			continue
+		}
+		seen[key] = true
+		f := state.Fact{Text: text, Source: strings.TrimSpace(r.Source)}
+		if r.Session >= 1 && r.Session <= len(keys) {
+			f.Session = keys[r.Session-1]
+		}
+		changes = append(changes, state.FactChange{Add: &f, Proposed: now})
+	}
+	for _, fg := range p.Forget {
+		if _, ok := mem.facts.Get(fg.ID); !ok || forgetting[fg.ID] {
+			continue
+		}
+		forgetting[fg.ID] = true
+		changes = append(changes, state.FactChange{Forget: fg.ID, Reason: strings.TrimSpace(fg.Reason), Proposed: now})
+	}
+	return changes
+}
+
+// applyFactChange writes a change to the agent's facts and records it as a
+// run event. Facts remembered or forgotten since it was proposed are left
+// alone.
+func (al *AgentLoop) applyFactChange(agent *AgentInstance, c state.FactChange) error {
+	facts := agent.ContextBuilder.memory.facts
+	if c.Add != nil {
+		if _, known := facts.Find(c.Add.Text); known {
+			return nil
+		}
+		f, err := facts.Add(*c.Add)
+		if err != nil {
+			return err
+		}
+		al.recordRunEvent(state.RunEvent{Kind: "memory_added", Source: agent.ID, Message: FormatFact(f)})
+		return nil
+	}
+	f, ok := facts.Get(c.Forget)
+	if !ok {
+		return nil
+	}
+	if _, err := facts.Forget(c.Forget); err != nil {
+		return err
+	}
+	al.recordRunEvent(state.RunEvent{
+		Kind:    "memory_expired",
+		Source:  agent.ID,
+		Message: strings.TrimSuffix(fmt.Sprintf("#%d %s: %s", f.ID, f.Text, c.Reason), ": "),
+	})
+	return nil
+}
+
+// describeFactChange renders a change for /memories pending and run
+// events.
+func describeFactChange(mem *MemoryStore, c state.FactChange) string {
+	if c.Add != nil {
+		s := "remember: " + c.Add.Text
+		if c.Add.Source != "" {
+			s += fmt.Sprintf(" (from %q)", c.Add.Source)
+		}
+		return s
+	}
+	s := fmt.Sprintf("forget #%d", c.Forget)
+	if f, ok := mem.facts.Get(c.Forget); ok {
+		s += " " + f.Text
+	}
+	if c.Reason != "" {
+		s += ": " + c.Reason
+	}
+	return s
+}
+
+// announcePendingMemories tells the admin chat, if there is one, that
+// consolidation has changes waiting for approval.
+func (al *AgentLoop) announcePendingMemories(agent *AgentInstance, n int) {
+	sup := al.cfg.Gateway.Supervisor
+	if n == 0 || sup.AlertChannel == "" || sup.AlertChatID == "" {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:   sup.AlertChannel,
+		ChatID:    sup.AlertChatID,
+		Proactive: true,
+		Content: fmt.Sprintf("Memory consolidation of agent %s proposes %d changes. "+
+			"Review them with /memories pending.", agent.ID, n),
+	})
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// consolidationProvider answers consolidation requests with a fixed
+// proposal and counts them, and welcomes everyone else.
+type consolidationProvider struct {
+	calls int
+}
+
+func (p *consolidationProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	if messages[0].Content != consolidationInstructions {
+		return &providers.LLMResponse{Content: "Welcome to Hamburg!"}, nil
+	}
+	p.calls++
+	if !strings.Contains(messages[1].Content, "I moved to Hamburg") {
+		return &providers.LLMResponse{Content: "{}"}, nil
+	}
+	return &providers.LLMResponse{Content: "```json\n" + `{
+		"remember": [
+			{"fact": "Alice lives in Hamburg", "source": "I moved to Hamburg", "session": 1},
+			{"fact": "alice lives in  hamburg.", "session": 1},
+			{"fact": "Alice is vegetarian", "session": 1}
+		],
+		"forget": [{"id": 1, "reason": "she moved"}, {"id": 99}]
+	}` + "\n```"}, nil
+}
+
+func (p *consolidationProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func newConsolidationLoop(t *testing.T, requireApproval bool) (*AgentLoop, *AgentInstance, *consolidationProvider) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cfg.Memory.Consolidation = config.ConsolidationConfig{Enabled: true, RequireApproval: requireApproval}
+	cfg.Gateway.Supervisor.AlertChannel = "telegram"
+	cfg.Gateway.Supervisor.AlertChatID = "1"
+	cfg.Gateway.Admin.Senders = []string{"telegram:7"}
+	provider := &consolidationProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	agent := al.registry.GetDefaultAgent()
+
+	facts := agent.ContextBuilder.memory.facts
+	for _, text := range []string{"Alice lives in Berlin", "Alice is vegetarian"} {
+		if _, err := facts.Add(state.Fact{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testHelper{al: al}.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "7", ChatID: "42", Content: "I moved to Hamburg last week",
+	})
+	return al, agent, provider
+}
+
+func TestConsolidateMemories_WritesDeduplicatedChanges(t *testing.T) {
+	al, agent, provider := newConsolidationLoop(t, false)
+	if err := al.consolidateMemories(context.Background(), agent); err != nil {
+		t.Fatal(err)
+	}
+
+	facts := agent.ContextBuilder.memory.facts.All()
+	if len(facts) != 2 || facts[0].Text != "Alice is vegetarian" || facts[1].Text != "Alice lives in Hamburg" ||
+		facts[1].Session == "" || facts[1].Source != "I moved to Hamburg" {
+		t.Fatalf("facts = %+v", facts)
+	}
+	events, err := state.NewEventLog(al.cfg.WorkspacePath()).Recent(10)
+	if err != nil || len(events) != 2 || events[0].Kind != "memory_added" || events[1].Kind != "memory_expired" ||
+		events[1].Message != "#1 Alice lives in Berlin: she moved" {
+		t.Errorf("run events = %+v, %v", events, err)
+	}
+
+	// Nothing was said since, so the next run has nothing to review.
+	if err := al.consolidateMemories(context.Background(), agent); err != nil || provider.calls != 1 {
+		t.Errorf("second run: err = %v, model calls = %d", err, provider.calls)
+	}
+	if last := agent.ContextBuilder.memory.consolidation.LastRun(); time.Since(last) > time.Minute {
+		t.Errorf("last run = %v", last)
+	}
+}
+
+func TestConsolidateMemories_RequireApproval(t *testing.T) {
+	al, agent, _ := newConsolidationLoop(t, true)
+	if err := al.consolidateMemories(context.Background(), agent); err != nil {
+		t.Fatal(err)
+	}
+	if facts := agent.ContextBuilder.memory.facts.All(); len(facts) != 2 || facts[0].Text != "Alice lives in Berlin" {
+		t.Fatalf("facts written before approval: %+v", facts)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, ok := al.bus.SubscribeOutbound(ctx)
+	if !ok || out.ChatID != "1" || !strings.Contains(out.Content, "2 changes") {
+		t.Errorf("announcement = %+v", out)
+	}
+
+	h := testHelper{al: al}
+	in := func(chatID, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: chatID, Content: content}
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("42", "/memories pending")); !strings.Contains(got, "admin chat") {
+		t.Errorf("/memories pending outside the admin chat = %q", got)
+	}
+	got := h.executeAndGetResponse(t, ctx, in("1", "/memories pending"))
+	if !strings.Contains(got, `1. remember: Alice lives in Hamburg (from "I moved to Hamburg")`) ||
+		!strings.Contains(got, "2. forget #1 Alice lives in Berlin: she moved") {
+		t.Errorf("/memories pending = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("1", "/memories approve 1")); got != "Applied 1 memory changes." {
+		t.Errorf("/memories approve 1 = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("1", "/memories reject")); got != "Rejected 1 memory changes." {
+		t.Errorf("/memories reject = %q", got)
+	}
+	facts := agent.ContextBuilder.memory.facts.All()
+	if len(facts) != 3 || facts[2].Text != "Alice lives in Hamburg" {
+		t.Errorf("facts after review = %+v", facts)
+	}
+	// The chat the fact came from sees it in /memories.
+	if got := h.executeAndGetResponse(t, ctx, in("42", "/memories")); !strings.Contains(got, "Alice lives in Hamburg") {
+		t.Errorf("/memories in the chat the fact came from = %q", got)
+	}
+}
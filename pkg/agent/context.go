@@ -4,9 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -19,6 +17,11 @@ type ContextBuilder struct {
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+	// channelNotes describes how a channel shows replies, for the
+	// Current Session section.
+	channelNotes func(channel string) string
+	// template is the workspace's SYSTEM_PROMPT.tmpl, if any.
+	template promptTemplate
 }
 
 func getGlobalConfigDir() string {
@@ -48,40 +51,10 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
-func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
-	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
-	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
-
-	// Build tools section dynamically
-	toolsSection := cb.buildToolsSection()
-
-	return fmt.Sprintf(`# picoclaw 🦞
-
-You are picoclaw, a helpful AI assistant.
-
-## Current Time
-%s
-
-## Runtime
-%s
-
-## Workspace
-Your workspace is at: %s
-- Memory: %s/memory/MEMORY.md
-- Daily Notes: %s/memory/YYYYMM/YYYYMMDD.md
-- Skills: %s/skills/{skill-name}/SKILL.md
-
-%s
-
-## Important Rules
-
-1. **ALWAYS use tools** - When you need to perform an action (schedule reminders, send messages, execute commands, etc.), you MUST call the appropriate tool. Do NOT just say you'll do it or pretend to do it.
-
-2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
-
-3. **Memory** - When interacting with me if something seems memorable, update %s/memory/MEMORY.md`,
-		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
+// SetChannelNotes sets the function that describes a channel's formatting
+// and limits to the model.
+func (cb *ContextBuilder) SetChannelNotes(notes func(channel string) string) {
+	cb.channelNotes = notes
 }
 
 func (cb *ContextBuilder) buildToolsSection() string {
@@ -108,36 +81,11 @@ func (cb *ContextBuilder) buildToolsSection() string {
 	return sb.String()
 }
 
+// BuildSystemPrompt renders the workspace's system prompt template, or the
+// built-in one, with the current time, tools, bootstrap files, skills and
+// memory.
 func (cb *ContextBuilder) BuildSystemPrompt() string {
-	parts := []string{}
-
-	// Core identity section
-	parts = append(parts, cb.getIdentity())
-
-	// Bootstrap files
-	bootstrapContent := cb.LoadBootstrapFiles()
-	if bootstrapContent != "" {
-		parts = append(parts, bootstrapContent)
-	}
-
-	// Skills - show summary, AI can read full content with read_file tool
-	skillsSummary := cb.skillsLoader.BuildSkillsSummary()
-	if skillsSummary != "" {
-		parts = append(parts, fmt.Sprintf(`# Skills
-
-The following skills extend your capabilities. To use a skill, read its SKILL.md file using the read_file tool.
-
-%s`, skillsSummary))
-	}
-
-	// Memory context
-	memoryContext := cb.memory.GetMemoryContext()
-	if memoryContext != "" {
-		parts = append(parts, "# Memory\n\n"+memoryContext)
-	}
-
-	// Join with "---" separator
-	return strings.Join(parts, "\n\n---\n\n")
+	return cb.renderPrompt()
 }
 
 func (cb *ContextBuilder) LoadBootstrapFiles() string {
@@ -177,51 +125,59 @@ func (cb *ContextBuilder) BuildMessages(
 	currentMessage string,
 	media []string,
 	channel, chatID string,
+	sessionNotes string,
 ) []providers.Message {
-	messages := []providers.Message{}
-
 	systemPrompt := cb.BuildSystemPrompt()
 
 	// Add Current Session info if provided
 	if channel != "" && chatID != "" {
 		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
+		if cb.channelNotes != nil {
+			if notes := cb.channelNotes(channel); notes != "" {
+				systemPrompt += "\n" + notes
+			}
+		}
+		systemPrompt += sessionNotes
 	}
 
 	// Log system prompt summary for debugging (debug mode only)
-	logger.DebugCF("agent", "System prompt built",
-		map[string]any{
-			"total_chars":   len(systemPrompt),
-			"total_lines":   strings.Count(systemPrompt, "\n") + 1,
-			"section_count": strings.Count(systemPrompt, "\n\n---\n\n") + 1,
-		})
-
-	// Log preview of system prompt (avoid logging huge content)
-	preview := systemPrompt
-	if len(preview) > 500 {
-		preview = preview[:500] + "... (truncated)"
+	if logger.Enabled("agent", logger.DEBUG) {
+		logger.DebugCF("agent", "System prompt built",
+			map[string]any{
+				"total_chars":   len(systemPrompt),
+				"total_lines":   strings.Count(systemPrompt, "\n") + 1,
+				"section_count": strings.Count(systemPrompt, "\n\n---\n\n") + 1,
+			})
+
+		// Log preview of system prompt (avoid logging huge content)
+		preview := systemPrompt
+		if len(preview) > 500 {
+			preview = preview[:500] + "... (truncated)"
+		}
+		logger.DebugCF("agent", "System prompt preview",
+			map[string]any{
+				"preview": preview,
+			})
 	}
-	logger.DebugCF("agent", "System prompt preview",
-		map[string]any{
-			"preview": preview,
-		})
 
 	if summary != "" {
 		systemPrompt += "\n\n## Summary of Previous Conversation\n\n" + summary
 	}
 
-	history = sanitizeHistoryForProvider(history)
-
+	// Room for the system prompt, the history, the current message and the
+	// assistant's answer, so the iterations do not grow it right away.
+	messages := make([]providers.Message, 0, len(history)+3)
 	messages = append(messages, providers.Message{
 		Role:    "system",
 		Content: systemPrompt,
 	})
-
-	messages = append(messages, history...)
+	messages = appendSanitizedHistory(messages, history)
 
 	if strings.TrimSpace(currentMessage) != "" {
 		messages = append(messages, providers.Message{
 			Role:    "user",
 			Content: currentMessage,
+			Media:   media,
 		})
 	}
 
@@ -232,29 +188,34 @@ func sanitizeHistoryForProvider(history []providers.Message) []providers.Message
 	if len(history) == 0 {
 		return history
 	}
+	return appendSanitizedHistory(make([]providers.Message, 0, len(history)), history)
+}
 
-	sanitized := make([]providers.Message, 0, len(history))
+// appendSanitizedHistory appends history to dst without the turns a
+// provider would refuse, see sanitizeHistoryForProvider.
+func appendSanitizedHistory(dst, history []providers.Message) []providers.Message {
+	start := len(dst)
 	for _, msg := range history {
 		switch msg.Role {
 		case "tool":
-			if len(sanitized) == 0 {
+			if len(dst) == start {
 				logger.DebugCF("agent", "Dropping orphaned leading tool message", map[string]any{})
 				continue
 			}
-			last := sanitized[len(sanitized)-1]
+			last := dst[len(dst)-1]
 			if last.Role != "assistant" || len(last.ToolCalls) == 0 {
 				logger.DebugCF("agent", "Dropping orphaned tool message", map[string]any{})
 				continue
 			}
-			sanitized = append(sanitized, msg)
+			dst = append(dst, msg)
 
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
-				if len(sanitized) == 0 {
+				if len(dst) == start {
 					logger.DebugCF("agent", "Dropping assistant tool-call turn at history start", map[string]any{})
 					continue
 				}
-				prev := sanitized[len(sanitized)-1]
+				prev := dst[len(dst)-1]
 				if prev.Role != "user" && prev.Role != "tool" {
 					logger.DebugCF(
 						"agent",
@@ -264,14 +225,14 @@ func sanitizeHistoryForProvider(history []providers.Message) []providers.Message
 					continue
 				}
 			}
-			sanitized = append(sanitized, msg)
+			dst = append(dst, msg)
 
 		default:
-			sanitized = append(sanitized, msg)
+			dst = append(dst, msg)
 		}
 	}
 
-	return sanitized
+	return dst
 }
 
 func (cb *ContextBuilder) AddToolResult(
@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+// ollamaContextWindow is the context Ollama gives a model unless told
+// otherwise. Prompts beyond it are cut from the front without an error,
+// taking the system prompt with them.
+const ollamaContextWindow = 4096
+
+const evictedToolResult = "[tool result removed to fit the context window]"
+
+// resolveContextWindow returns the context window of modelID: the one set
+// in agents.defaults, the one of its model_list entry, or the one in the
+// built-in table. Ollama models get Ollama's default context, which is
+// what they run with unless a window is configured.
+func resolveContextWindow(defaults *config.AgentDefaults, entry *config.ModelConfig, modelID string) int {
+	if defaults != nil && defaults.ContextWindow > 0 {
+		return defaults.ContextWindow
+	}
+	if entry != nil {
+		if entry.ContextWindow > 0 {
+			return entry.ContextWindow
+		}
+		if protocol, _ := providers.ExtractProtocol(entry.Model); protocol == "ollama" {
+			return ollamaContextWindow
+		}
+	}
+	if w := tokenizer.ContextWindow(modelID); w > 0 {
+		return w
+	}
+	return tokenizer.DefaultContextWindow
+}
+
+// findModelEntry returns the model_list entry named name, or else the
+// first one for modelID; the gateway replaces the default model name by
+// its model ID at startup.
+func findModelEntry(cfg *config.Config, name, modelID string) *config.ModelConfig {
+	if cfg == nil {
+		return nil
+	}
+	if entry, err := cfg.GetModelConfig(name); err == nil {
+		return entry
+	}
+	for i := range cfg.ModelList {
+		m := cfg.ModelList[i].Model
+		if m == modelID || strings.HasSuffix(m, "/"+modelID) {
+			return &cfg.ModelList[i]
+		}
+	}
+	return nil
+}
+
+// promptBudget is the number of prompt tokens that fit in window while
+// leaving room for an answer of maxTokens.
+func promptBudget(window, maxTokens int) int {
+	return window - min(maxTokens, window/2)
+}
+
+func messageTokens(model string, m providers.Message) int {
+	n := 4 + tokenizer.Count(model, m.Content) // role and framing
+	for _, tc := range m.ToolCalls {
+		n += 8 + tokenizer.Count(model, tc.Name)
+		if tc.Function != nil {
+			n += tokenizer.Count(model, tc.Function.Arguments)
+		} else if args, err := json.Marshal(tc.Arguments); err == nil {
+			n += tokenizer.Count(model, string(args))
+		}
+	}
+	return n
+}
+
+func toolDefTokens(model string, defs []providers.ToolDefinition) int {
+	n := 0
+	for _, def := range defs {
+		n += toolTokens.get(model, def.Function)
+	}
+	return n
+}
+
+// toolTokens caches the tokens of each tool definition per model, as every
+// iteration of every run counts them. The definitions come from
+// ToProviderDefs, which hands out the same parameters until the tool is
+// registered again, so their identity tells a changed definition apart.
+var toolTokens = &toolTokenCache{tokens: make(map[toolTokenKey]int)}
+
+type toolTokenKey struct {
+	model, name, description string
+	parameters               uintptr
+}
+
+type toolTokenCache struct {
+	mu     sync.Mutex
+	tokens map[toolTokenKey]int
+}
+
+func (c *toolTokenCache) get(model string, fn providers.ToolFunctionDefinition) int {
+	key := toolTokenKey{model, fn.Name, fn.Description, reflect.ValueOf(fn.Parameters).Pointer()}
+	c.mu.Lock()
+	n, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok {
+		return n
+	}
+	data, err := json.Marshal(fn)
+	if err != nil {
+		return 0
+	}
+	n = 8 + tokenizer.Count(model, string(data))
+	c.mu.Lock()
+	// Definitions registered again leave their old entries behind.
+	if len(c.tokens) >= 4096 {
+		clear(c.tokens)
+	}
+	c.tokens[key] = n
+	c.mu.Unlock()
+	return n
+}
+
+func historyTokens(model string, messages []providers.Message) int {
+	n := 0
+	for _, m := range messages {
+		n += messageTokens(model, m)
+	}
+	return n
+}
+
+// fitContext evicts from messages until the prompt fits budget, and returns
+// the messages and their estimated prompt tokens, tool definitions
+// included. The system prompt and the current turn (from the last user
+// message on) are kept. Unless strategy is "drop_oldest", the tool results
+// of earlier iterations are emptied first; "summarize" has made its summary
+// at the start of the turn. Then the oldest history is dropped, and as a
+// last resort the latest tool results are cut short. messages itself is
+// not changed.
+func fitContext(
+	model string,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	budget int,
+	strategy string,
+) ([]providers.Message, int) {
+	fixed := toolDefTokens(model, defs)
+	sizes := make([]int, len(messages))
+	total := fixed
+	for i, m := range messages {
+		sizes[i] = messageTokens(model, m)
+		total += sizes[i]
+	}
+	if total <= budget || len(messages) < 2 {
+		return messages, total
+	}
+
+	out := make([]providers.Message, len(messages))
+	copy(out, messages)
+
+	turnStart := len(out) - 1
+	for i := len(out) - 1; i > 0; i-- {
+		if out[i].Role == "user" {
+			turnStart = i
+			break
+		}
+	}
+	// Tool results of the latest iteration are what the model is about to
+	// read; they are only cut as a last resort.
+	latest := len(out)
+	for latest > 0 && out[latest-1].Role == "tool" {
+		latest--
+	}
+
+	evictToolResults := func(from, to int) {
+		for i := from; i < to && total > budget; i++ {
+			if out[i].Role != "tool" || out[i].Content == evictedToolResult {
+				continue
+			}
+			out[i].Content = evictedToolResult
+			size := messageTokens(model, out[i])
+			total -= sizes[i] - size
+			sizes[i] = size
+		}
+	}
+
+	if strategy != "drop_oldest" {
+		evictToolResults(1, latest)
+	}
+
+	// Drop the oldest history, with the tool results that answered a
+	// dropped assistant message.
+	dropped := 0
+	for total > budget && turnStart > 1 {
+		total -= sizes[1]
+		out = append(out[:1], out[2:]...)
+		sizes = append(sizes[:1], sizes[2:]...)
+		turnStart--
+		latest--
+		dropped++
+		for turnStart > 1 && out[1].Role == "tool" {
+			total -= sizes[1]
+			out = append(out[:1], out[2:]...)
+			sizes = append(sizes[:1], sizes[2:]...)
+			turnStart--
+			latest--
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		out[0].Content += fmt.Sprintf(
+			"\n\n[System Note: %d older messages were left out to fit the context window]", dropped)
+		total += messageTokens(model, out[0]) - sizes[0]
+		sizes[0] = messageTokens(model, out[0])
+	}
+
+	evictToolResults(turnStart, latest)
+	for i := latest; i < len(out) && total > budget; i++ {
+		if out[i].Role != "tool" {
+			continue
+		}
+		// Token counts do not scale exactly with length; keep a margin.
+		over := total - budget
+		keep := max(len(out[i].Content)*(sizes[i]-over)/max(sizes[i], 1)*9/10, 0)
+		out[i].Content = strings.ToValidUTF8(out[i].Content[:keep], "") + "\n[... cut to fit the context window]"
+		size := messageTokens(model, out[i])
+		total -= sizes[i] - size
+		sizes[i] = size
+	}
+
+	if total > budget {
+		logger.WarnCF("agent", "Prompt does not fit the context window",
+			map[string]any{"model": model, "tokens": total, "budget": budget})
+	}
+	return out, total
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func turnWithTools() []providers.Message {
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 200)
+	return []providers.Message{
+		{Role: "system", Content: "You are a helpful assistant."},
+		{Role: "user", Content: "old question " + long},
+		{Role: "assistant", Content: "old answer " + long},
+		{Role: "user", Content: "look this up"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Name: "web_fetch", Arguments: map[string]any{"url": "a"}}}},
+		{Role: "tool", ToolCallID: "1", Content: "first page " + long},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "2", Name: "web_fetch", Arguments: map[string]any{"url": "b"}}}},
+		{Role: "tool", ToolCallID: "2", Content: "second page " + long},
+	}
+}
+
+func TestFitContext_DropToolResultsFirst(t *testing.T) {
+	messages := turnWithTools()
+	_, full := fitContext("gpt-4o", messages, nil, 1<<20, "")
+	budget := full - 500
+
+	out, tokens := fitContext("gpt-4o", messages, nil, budget, "drop_tool_results")
+	if tokens > budget {
+		t.Fatalf("tokens = %d, budget %d", tokens, budget)
+	}
+	if len(out) != len(messages) || out[5].Content != evictedToolResult {
+		t.Errorf("earlier tool result was not evicted: %q", out[5].Content[:20])
+	}
+	if out[7].Content != messages[7].Content || out[1].Content != messages[1].Content {
+		t.Error("evicted more than needed")
+	}
+	if messages[5].Content == evictedToolResult {
+		t.Error("fitContext changed its input")
+	}
+}
+
+func TestFitContext_DropOldest(t *testing.T) {
+	messages := turnWithTools()
+	_, full := fitContext("gpt-4o", messages, nil, 1<<20, "")
+
+	out, tokens := fitContext("gpt-4o", messages, nil, full-500, "drop_oldest")
+	if tokens > full-500 {
+		t.Fatalf("tokens = %d", tokens)
+	}
+	if len(out) != len(messages)-1 || out[1].Content != messages[2].Content || out[4].Content != messages[5].Content {
+		t.Errorf("got %d messages, second is %q", len(out), out[1].Role)
+	}
+	if !strings.Contains(out[0].Content, "1 older messages were left out") {
+		t.Errorf("system prompt = %q", out[0].Content)
+	}
+
+	// With no history left to drop, the latest tool result is cut.
+	out, tokens = fitContext("gpt-4o", messages, nil, 600, "drop_oldest")
+	if tokens > 600 || out[len(out)-1].Role != "tool" || !strings.HasSuffix(out[len(out)-1].Content, "cut to fit the context window]") {
+		t.Errorf("tokens = %d, messages = %d", tokens, len(out))
+	}
+	if out[1].Content != "look this up" {
+		t.Errorf("the current turn was dropped: %q", out[1].Content)
+	}
+}
+
+func TestResolveContextWindow(t *testing.T) {
+	defaults := &config.AgentDefaults{}
+	if got := resolveContextWindow(defaults, nil, "gpt-4o"); got != 128000 {
+		t.Errorf("gpt-4o = %d", got)
+	}
+	if got := resolveContextWindow(defaults, &config.ModelConfig{Model: "ollama/llama3.2"}, "llama3.2"); got != ollamaContextWindow {
+		t.Errorf("ollama = %d", got)
+	}
+	if got := resolveContextWindow(defaults, &config.ModelConfig{Model: "ollama/llama3.2", ContextWindow: 16384}, "llama3.2"); got != 16384 {
+		t.Errorf("configured = %d", got)
+	}
+	if got := resolveContextWindow(&config.AgentDefaults{ContextWindow: 8000}, nil, "gpt-4o"); got != 8000 {
+		t.Errorf("defaults = %d", got)
+	}
+	if got := resolveContextWindow(defaults, nil, "my-finetune"); got != 32768 {
+		t.Errorf("unknown = %d", got)
+	}
+}
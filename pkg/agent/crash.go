@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// CrashReport is what a run that panicked leaves in
+// <workspace>/state/crashes/<id>.json, see config.CrashConfig.
+type CrashReport struct {
+	ID         string            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Panic      string            `json:"panic"`
+	Exit       string            `json:"exit"` // always events.RunPanicked
+	AgentID    string            `json:"agent_id"`
+	SessionKey string            `json:"session_key,omitempty"`
+	Channel    string            `json:"channel,omitempty"`
+	ChatID     string            `json:"chat_id,omitempty"`
+	TaskID     string            `json:"task_id,omitempty"`
+	Background bool              `json:"background,omitempty"`
+	Running    time.Duration     `json:"running"`
+	Stage      string            `json:"stage,omitempty"` // of a run answering a message
+	Message    string            `json:"message,omitempty"`
+	Fields     map[string]any    `json:"fields,omitempty"` // logged with the run
+	Tools      []events.ToolCall `json:"tools,omitempty"`  // the latest, oldest first
+	Stacks     string            `json:"stacks"`
+}
+
+// crashTrailSize is how many tool calls of a run a crash report shows.
+const crashTrailSize = 10
+
+// runTrail keeps the latest tool calls of a run, for its crash report.
+type runTrail struct {
+	mu    sync.Mutex
+	calls []events.ToolCall
+}
+
+type runTrailKey struct{}
+
+func trailFrom(ctx context.Context) *runTrail {
+	trail, _ := ctx.Value(runTrailKey{}).(*runTrail)
+	return trail
+}
+
+// add notes call; a nil trail drops it.
+func (t *runTrail) add(call events.ToolCall) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, call)
+	if len(t.calls) > crashTrailSize {
+		t.calls = slices.Delete(t.calls, 0, len(t.calls)-crashTrailSize)
+	}
+}
+
+// list returns the calls of the trail, with what looks like a credential in
+// their errors redacted.
+func (t *runTrail) list() []events.ToolCall {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	calls := slices.Clone(t.calls)
+	for i := range calls {
+		calls[i].Error = redactSecrets(calls[i].Error)
+	}
+	return calls
+}
+
+// toolPanic is a panic of a tool call that ran in a goroutine of its own,
+// passed on to the run with the stack it panicked on.
+type toolPanic struct {
+	tool  string
+	value any
+	stack []byte
+}
+
+func (p *toolPanic) String() string {
+	return fmt.Sprintf("tool %s: %v", p.tool, p.value)
+}
+
+// runGuarded runs agent like runAgent. A panic ends the run with an error
+// and a crash report rather than taking the gateway down, and sets the
+// exit of run.
+func (al *AgentLoop) runGuarded(
+	ctx context.Context, agent *AgentInstance, opts processOptions, run *events.Run,
+) (content string, err error) {
+	trail := &runTrail{}
+	ctx = context.WithValue(ctx, runTrailKey{}, trail)
+	defer func() {
+		if r := recover(); r != nil {
+			run.Exit = events.RunPanicked
+			err = al.crashed(ctx, opts, *run, trail, r)
+		}
+	}()
+	return al.runAgent(ctx, agent, opts)
+}
+
+// crashed writes the crash report of a run that panicked with value,
+// records a "crash" run event and returns the error the run ends with.
+func (al *AgentLoop) crashed(ctx context.Context, opts processOptions, run events.Run, trail *runTrail, value any) error {
+	report := CrashReport{
+		ID:         newCrashID(),
+		Time:       time.Now(),
+		Panic:      fmt.Sprint(value),
+		Exit:       events.RunPanicked,
+		AgentID:    run.AgentID,
+		SessionKey: run.SessionKey,
+		Channel:    run.Channel,
+		ChatID:     run.ChatID,
+		TaskID:     run.TaskID,
+		Background: run.Background,
+		Running:    time.Since(run.Started),
+		Message:    redactSecrets(utils.Truncate(opts.UserMessage, 500)),
+		Tools:      trail.list(),
+		Stacks:     allStacks(),
+	}
+	if p, ok := value.(*toolPanic); ok {
+		report.Stacks = "tool " + p.tool + " panicked on:\n" + string(p.stack) + "\n" + report.Stacks
+	}
+	if r := runFrom(ctx); r != nil {
+		r.mu.Lock()
+		report.Stage = r.stage
+		r.mu.Unlock()
+	}
+	if fields := logger.FieldsFrom(ctx); len(fields) > 0 {
+		report.Fields = make(map[string]any, len(fields))
+		for k, v := range fields {
+			if s, ok := v.(string); ok {
+				v = redactSecrets(s)
+			}
+			report.Fields[k] = v
+		}
+	}
+
+	logger.ErrorCtx(ctx, "agent", "Run panicked", map[string]any{"panic": report.Panic, "crash_report": report.ID})
+	path, err := al.saveCrashReport(report)
+	if err != nil {
+		logger.ErrorCF("agent", "Failed to write crash report", map[string]any{"error": err.Error()})
+	}
+	al.recordRunEvent(state.RunEvent{Kind: "crash", Source: run.AgentID, Message: report.Panic + " (" + path + ")"})
+	if url := al.cfg.Gateway.Crash.WebhookURL; url != "" {
+		go postCrashReport(url, report)
+	}
+	return fmt.Errorf("crashed: %s (crash report %s)", report.Panic, report.ID)
+}
+
+// saveCrashReport writes report to state/crashes and removes the oldest
+// reports beyond gateway.crash.keep. It returns the report's path.
+func (al *AgentLoop) saveCrashReport(report CrashReport) (string, error) {
+	dir := filepath.Join(al.cfg.WorkspacePath(), "state", "crashes")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal crash report: %w", err)
+	}
+	path := filepath.Join(dir, report.ID+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	keep := al.cfg.Gateway.Crash.Keep
+	if keep <= 0 {
+		keep = 20
+	}
+	// IDs start with the time, so they sort oldest first.
+	reports, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	slices.Sort(reports)
+	for len(reports) > keep {
+		os.Remove(reports[0])
+		reports = reports[1:]
+	}
+	return path, nil
+}
+
+// postCrashReport sends report to the webhook at url.
+func postCrashReport(url string, report CrashReport) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		logger.WarnCF("agent", "Failed to post crash report", map[string]any{"error": err.Error()})
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.WarnCF("agent", "Crash report webhook refused the report", map[string]any{"status": resp.Status})
+	}
+}
+
+// newCrashID names a crash report by its time, e.g. 20260105-093012-9c41e0a2.
+func newCrashID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// allStacks returns the stacks of all goroutines, cut at 1 MiB.
+func allStacks() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 1<<20 {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// secretPattern matches what looks like a credential in text: API keys and
+// tokens with a well-known prefix, bearer tokens, and values of settings
+// named like a secret.
+var secretPattern = regexp.MustCompile(
+	`(?i)\b(sk-[a-z0-9_-]{8,}|gh[pousr]_[a-z0-9]{16,}|xox[abprs]-[a-z0-9-]{8,}|AKIA[A-Z0-9]{16})` +
+		`|(bearer\s+)[a-z0-9._~+/=-]{8,}` +
+		`|((?:api[_-]?key|token|secret|password)\s*[=:]\s*)\S+`,
+)
+
+// redactSecrets replaces what looks like a credential in s with ***.
+func redactSecrets(s string) string {
+	return secretPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := secretPattern.FindStringSubmatch(m)
+		switch {
+		case sub[2] != "":
+			return sub[2] + "***"
+		case sub[3] != "":
+			return sub[3] + "***"
+		}
+		return "***"
+	})
+}
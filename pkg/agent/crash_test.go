@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// crashProvider calls the tool "crash" on every request.
+type crashProvider struct{}
+
+func (crashProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+		ID: "call_1", Type: "function", Name: "crash", Arguments: map[string]any{},
+	}}}, nil
+}
+
+func (crashProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+type crashTool struct{}
+
+func (crashTool) Name() string               { return "crash" }
+func (crashTool) Description() string        { return "Panics." }
+func (crashTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+
+func (crashTool) Execute(context.Context, map[string]any) *tools.ToolResult {
+	var m map[string]int
+	m["boom"]++
+	return nil
+}
+
+func TestCrash_ReportedAndSurvived(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Gateway: config.GatewayConfig{Crash: config.CrashConfig{Keep: 1}},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), crashProvider{})
+	al.RegisterTool(crashTool{})
+	var finished []events.Run
+	events.Subscribe(al.Events(), events.RunFinished, func(r events.Run) { finished = append(finished, r) })
+
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "42", ChatID: "42", Content: "Use api_key=sk-abcdef123456 please"}
+	for range 2 {
+		_, err := al.processMessage(context.Background(), msg)
+		if err == nil || !strings.Contains(err.Error(), "crash report") {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	if len(finished) != 2 || finished[0].Exit != events.RunPanicked {
+		t.Fatalf("finished runs = %+v", finished)
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(workspace, "state", "crashes", "*.json"))
+	if len(reports) != 1 {
+		t.Fatalf("kept %d crash reports, want 1", len(reports))
+	}
+	data, err := os.ReadFile(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report CrashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.Panic, "nil map") || report.Exit != events.RunPanicked || report.Channel != "telegram" {
+		t.Errorf("report = %+v", report)
+	}
+	if strings.Contains(report.Message, "sk-abcdef") || !strings.Contains(report.Message, "api_key=***") {
+		t.Errorf("message not redacted: %q", report.Message)
+	}
+	if !strings.Contains(report.Stacks, "crashTool") {
+		t.Error("stacks miss the tool that panicked")
+	}
+}
+
+func TestRunTrail_RedactsErrors(t *testing.T) {
+	trail := &runTrail{}
+	trail.add(events.ToolCall{Tool: "web_fetch", Error: "401 for Authorization: Bearer abc.def.ghi1"})
+	trail.add(events.ToolCall{Tool: "exec", Error: "exit status 1"})
+
+	calls := trail.list()
+	if len(calls) != 2 || calls[0].Error != "401 for Authorization: Bearer ***" || calls[1].Error != "exit status 1" {
+		t.Errorf("calls = %+v", calls)
+	}
+	if trail.calls[0].Error != "401 for Authorization: Bearer abc.def.ghi1" {
+		t.Error("list changed the trail")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	for in, want := range map[string]string{
+		"key sk-proj-abcdefgh12 here":        "key *** here",
+		"Authorization: Bearer abc.def.ghi1": "Authorization: Bearer ***",
+		"password: hunter22":                 "password: ***",
+		"nothing secret here":                "nothing secret here",
+	} {
+		if got := redactSecrets(in); got != want {
+			t.Errorf("redactSecrets(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultCritiqueRubric is what answers are judged against when the
+// critique config has no rubric of its own.
+const defaultCritiqueRubric = `- Does the answer do everything the user asked?
+- Is it correct? Point out claims that are wrong or not backed by the conversation.
+- Is it clear, and no longer than it needs to be?`
+
+const critiqueInstructions = `You review an AI assistant's answer before it is sent to the user. Judge it against this rubric:
+
+%s
+
+If the answer can be sent as it is, reply with APPROVE on the first line. Otherwise reply with REVISE on the first line, followed by what must change, as concrete instructions to the assistant. Do not write the answer yourself.`
+
+// critique is a reviewer model's verdict on an answer.
+type critique struct {
+	model    string
+	revise   bool
+	feedback string
+}
+
+// parseCritique reads a reviewer's reply. A reply that neither approves
+// nor asks for a revision approves: the answer is not held back because
+// the reviewer wandered off.
+func parseCritique(content string) (revise bool, feedback string) {
+	content = strings.TrimSpace(content)
+	first, rest, _ := strings.Cut(content, "\n")
+	verdict := strings.ToUpper(strings.Trim(strings.TrimSpace(first), "*#:. "))
+	switch {
+	case strings.HasPrefix(verdict, "REVISE"):
+		// "REVISE: shorten it" carries the feedback on the same line.
+		inline := strings.TrimLeft(strings.TrimSpace(first)[len("REVISE"):], "*:.- ")
+		return true, strings.TrimSpace(inline + "\n" + rest)
+	case strings.HasPrefix(verdict, "APPROVE"):
+		return false, strings.TrimSpace(rest)
+	}
+	return false, content
+}
+
+// critiqueAnswer has the agent's critique model review answer to the
+// turn's request.
+func (al *AgentLoop) critiqueAnswer(
+	ctx context.Context,
+	agent *AgentInstance,
+	opts processOptions,
+	answer string,
+) (*critique, error) {
+	rubric := strings.TrimSpace(agent.Critique.Rubric)
+	if rubric == "" {
+		rubric = defaultCritiqueRubric
+	}
+	messages := []providers.Message{
+		{Role: "system", Content: fmt.Sprintf(critiqueInstructions, rubric)},
+		{Role: "user", Content: fmt.Sprintf("User request:\n%s\n\nAnswer:\n%s", opts.UserMessage, answer)},
+	}
+
+	model, provider, vendor, route, _ := al.requestModel(agent, agent.Critique.Model)
+	callCtx, cancel := agent.llmContext(ctx)
+	defer cancel()
+	started := time.Now()
+	resp, err := provider.Chat(callCtx, messages, nil, model, map[string]any{
+		"max_tokens":  1024,
+		"temperature": 0.0,
+	})
+	ev := state.LLMEvent{
+		AgentID: agent.ID, SessionKey: opts.SessionKey, Provider: vendor, Model: model, Route: route,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	setLLMUsage(&ev, resp)
+	al.recordLLMEvent(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	providers.SeparateReasoning(resp)
+	revise, feedback := parseCritique(resp.Content)
+	return &critique{model: agent.Critique.Model, revise: revise, feedback: feedback}, nil
+}
+
+// reviewAnswer runs the agent's critique of answer and, if the reviewer
+// asks for it, one revision pass with its feedback. It returns the answer
+// to send, its reasoning and the iterations of the turn so far. The
+// critique is recorded as a run event; a reviewer or revision that fails
+// leaves the first answer in place.
+func (al *AgentLoop) reviewAnswer(
+	ctx context.Context,
+	agent *AgentInstance,
+	opts processOptions,
+	answer, reasoning string,
+	iteration int,
+) (string, string, int) {
+	review, err := al.critiqueAnswer(ctx, agent, opts, answer)
+	if err != nil {
+		logger.WarnCF("agent", "Critique failed, sending the answer unreviewed",
+			map[string]any{"agent_id": agent.ID, "model": agent.Critique.Model, "error": err.Error()})
+		return answer, reasoning, iteration
+	}
+	if !review.revise {
+		al.recordRunEvent(state.RunEvent{
+			Kind:    "critique",
+			Source:  agent.ID,
+			Message: strings.TrimSpace(fmt.Sprintf("%s approved the answer. %s", review.model, utils.Truncate(review.feedback, 500))),
+		})
+		return answer, reasoning, iteration
+	}
+
+	logger.InfoCF("agent", "Critique asked for a revision",
+		map[string]any{"agent_id": agent.ID, "model": review.model, "feedback": utils.Truncate(review.feedback, 200)})
+
+	// The draft is shown to the model with the feedback, but neither is
+	// kept in the session: the history holds only the answer sent.
+	history := []providers.Message{{Role: "user", Content: opts.UserMessage}}
+	var summary string
+	if !opts.NoHistory {
+		history = agent.Sessions.GetHistory(opts.SessionKey)
+		summary = agent.Sessions.GetSummary(opts.SessionKey)
+	}
+	history = append(history, providers.Message{Role: "assistant", Content: answer})
+	messages := agent.ContextBuilder.BuildMessages(
+		history,
+		summary,
+		"[Review of your answer, not shown to the user]\n"+review.feedback+
+			"\n\nWrite your answer again with this feedback applied. Reply with the new answer only.",
+		nil,
+		opts.Channel,
+		opts.ChatID,
+		opts.SessionNotes,
+	)
+	revised, revisedReasoning, n, err := al.runLLMIteration(ctx, agent, messages, opts)
+	event := state.RunEvent{
+		Kind:    "critique",
+		Source:  agent.ID,
+		Message: fmt.Sprintf("%s asked for a revision: %s", review.model, utils.Truncate(review.feedback, 500)),
+	}
+	if err != nil || revised == "" {
+		event.Message += " (revision failed, first answer sent)"
+		al.recordRunEvent(event)
+		return answer, reasoning, iteration + n
+	}
+	al.recordRunEvent(event)
+	return revised, revisedReasoning, iteration + n
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestParseCritique(t *testing.T) {
+	tests := []struct {
+		content      string
+		wantRevise   bool
+		wantFeedback string
+	}{
+		{"APPROVE", false, ""},
+		{"**Approve.**\nLooks fine.", false, "Looks fine."},
+		{"REVISE\n- cite the source\n- shorter", true, "- cite the source\n- shorter"},
+		{"REVISE: the date is wrong", true, "the date is wrong"},
+		{"The answer seems good to me.", false, "The answer seems good to me."},
+	}
+	for _, tt := range tests {
+		revise, feedback := parseCritique(tt.content)
+		if revise != tt.wantRevise || feedback != tt.wantFeedback {
+			t.Errorf("parseCritique(%q) = %v, %q; want %v, %q",
+				tt.content, revise, feedback, tt.wantRevise, tt.wantFeedback)
+		}
+	}
+}
+
+// critiqueMockProvider answers as the agent's model with a draft and,
+// once it has seen a review, a revised answer; as the reviewer model it
+// asks for a revision.
+type critiqueMockProvider struct {
+	reviewed []string // the answers the reviewer saw
+}
+
+func (m *critiqueMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	last := messages[len(messages)-1].Content
+	switch {
+	case model == "reviewer":
+		m.reviewed = append(m.reviewed, last)
+		return &providers.LLMResponse{Content: "REVISE\nMention the weekend."}, nil
+	case strings.Contains(last, "Mention the weekend."):
+		return &providers.LLMResponse{Content: "Open 9-5, weekends too."}, nil
+	}
+	return &providers.LLMResponse{Content: "Open 9-5."}, nil
+}
+
+func (m *critiqueMockProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAgentLoop_RevisesAfterCritique(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Critique:          &config.CritiqueConfig{Model: "reviewer", Rubric: "Covers opening hours on all days."},
+			},
+		},
+	}
+	provider := &critiqueMockProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+
+	response, err := al.ProcessDirectWithChannel(context.Background(), "When are you open?", "agent:main:critique", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error = %v", err)
+	}
+	if response != "Open 9-5, weekends too." {
+		t.Errorf("response = %q", response)
+	}
+	if len(provider.reviewed) != 1 || !strings.Contains(provider.reviewed[0], "Answer:\nOpen 9-5.") {
+		t.Errorf("reviewer saw %q", provider.reviewed)
+	}
+
+	// Only the revised answer is kept.
+	var assistant []string
+	for _, m := range al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:critique") {
+		if m.Role == "assistant" {
+			assistant = append(assistant, m.Content)
+		}
+	}
+	if len(assistant) != 1 || assistant[0] != response {
+		t.Errorf("stored answers = %q", assistant)
+	}
+
+	events, err := state.NewEventLog(workspace).Recent(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != "critique" ||
+		events[0].Message != "reviewer asked for a revision: Mention the weekend." {
+		t.Errorf("run events = %+v", events)
+	}
+}
+
+func TestNewAgentInstance_CritiqueOverride(t *testing.T) {
+	defaults := &config.AgentDefaults{
+		Workspace: t.TempDir(),
+		Model:     "test-model",
+		Critique:  &config.CritiqueConfig{Model: "reviewer"},
+	}
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: *defaults}}
+	provider := &simpleMockProvider{}
+
+	if a := newTestInstance(t, nil, defaults, cfg, provider); a.Critique == nil || a.Critique.Model != "reviewer" {
+		t.Errorf("default agent critique = %+v", a.Critique)
+	}
+	off := &config.AgentConfig{ID: "casual", Workspace: t.TempDir(), Critique: &config.CritiqueConfig{}}
+	if a := newTestInstance(t, off, defaults, cfg, provider); a.Critique != nil {
+		t.Errorf("critique not turned off: %+v", a.Critique)
+	}
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// CommandData is what the prompts of custom commands are rendered with.
+// For "/standup yesterday frontend", Args is "yesterday frontend" and
+// {{.Arg 2}} is "frontend".
+type CommandData struct {
+	Args    string   // everything after the command
+	Fields  []string // Args split on white space
+	Sender  string   // the sender's name from their profile, else their ID
+	Channel string
+	ChatID  string
+	Now     string // local time as "2006-01-02 15:04 (Monday)"
+}
+
+// Arg returns the nth argument, counting from 1, or "" if there is none.
+func (d CommandData) Arg(n int) string {
+	if n < 1 || n > len(d.Fields) {
+		return ""
+	}
+	return d.Fields[n-1]
+}
+
+// customCommand is a command from the config's commands.
+type customCommand struct {
+	config.CommandConfig
+	prompt *template.Template
+}
+
+// commandRun is a custom command a message asked for: the prompt it
+// stands for and who answers it how.
+type commandRun struct {
+	name    string // "/standup"
+	content string
+	persona string
+	model   string
+	tools   []string
+}
+
+// newCustomCommands parses the prompts of the configured commands. One
+// that does not parse is left out; the config check reports it.
+func newCustomCommands(cfgs []config.CommandConfig) map[string]*customCommand {
+	commands := make(map[string]*customCommand, len(cfgs))
+	for _, c := range cfgs {
+		tmpl, err := template.New(c.Name).Parse(c.Prompt)
+		if err != nil {
+			logger.WarnCF("agent", "Skipping custom command", map[string]any{"command": c.Name, "error": err.Error()})
+			continue
+		}
+		commands["/"+c.Name] = &customCommand{CommandConfig: c, prompt: tmpl}
+	}
+	return commands
+}
+
+// allows reports whether the sender of msg may use the command.
+func (al *AgentLoop) allows(cmd *customCommand, msg bus.InboundMessage) bool {
+	if len(cmd.Allow) == 0 {
+		return true
+	}
+	for _, entry := range cmd.Allow {
+		if entry == "admin" {
+			if al.isAdminChat(msg) {
+				return true
+			}
+			continue
+		}
+		channel, sender, _ := strings.Cut(entry, ":")
+		if channel == msg.Channel && channels.SenderMatches(msg.SenderID, sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandCommand turns a custom command into the prompt it stands for. It
+// returns a nil run for other messages, and a reply instead of a run when
+// the sender may not use the command or its prompt fails to render.
+func (al *AgentLoop) expandCommand(msg bus.InboundMessage) (run *commandRun, reply string) {
+	text := strings.TrimSpace(msg.Content)
+	name, args, _ := strings.Cut(text, " ")
+	cmd, ok := al.commands[name]
+	if !ok {
+		return nil, ""
+	}
+	if !al.allows(cmd, msg) {
+		al.auditCommand(msg, "denied")
+		return nil, al.t(msg, "You may not use %s here.", name)
+	}
+
+	args = strings.TrimSpace(args)
+	data := CommandData{
+		Args:    args,
+		Fields:  strings.Fields(args),
+		Sender:  msg.SenderID,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Now:     time.Now().Format("2006-01-02 15:04 (Monday)"),
+	}
+	if id := profileID(msg); id != "" {
+		if p := al.profiles.Get(id); p.Name != "" {
+			data.Sender = p.Name
+		}
+	}
+	var b strings.Builder
+	if err := cmd.prompt.Execute(&b, data); err != nil {
+		return nil, al.t(msg, "Failed to run %s: %v", name, err)
+	}
+	return &commandRun{
+		name:    name,
+		content: strings.TrimSpace(b.String()),
+		persona: cmd.Persona,
+		model:   cmd.Model,
+		tools:   cmd.Tools,
+	}, ""
+}
+
+// customCommandHelp lists the custom commands the sender of msg may use,
+// for /help.
+func (al *AgentLoop) customCommandHelp(msg bus.InboundMessage) string {
+	var lines []string
+	for _, c := range al.cfg.Commands {
+		cmd, ok := al.commands["/"+c.Name]
+		if !ok || !al.allows(cmd, msg) {
+			continue
+		}
+		line := "/" + c.Name
+		if c.Description != "" {
+			line += " - " + c.Description
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return al.t(msg, "Commands of this assistant:") + "\n" + strings.Join(lines, "\n")
+}
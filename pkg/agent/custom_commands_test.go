@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// commandProvider records the last user message, model and tools of the
+// requests it gets.
+type commandProvider struct {
+	message string
+	model   string
+	tools   []string
+}
+
+func (p *commandProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.message = messages[len(messages)-1].Content
+	p.model = model
+	p.tools = nil
+	for _, d := range tools {
+		p.tools = append(p.tools, d.Function.Name)
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *commandProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestCustomCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true},
+				{ID: "scrum", Workspace: t.TempDir(), Model: &config.AgentModelConfig{Primary: "scrum-model"}},
+			},
+		},
+		Gateway: config.GatewayConfig{Admin: config.AdminConfig{Chats: []string{"telegram:1"}, Senders: []string{"telegram:7"}}},
+		Commands: []config.CommandConfig{
+			{
+				Name:        "standup",
+				Description: "write the stand-up notes",
+				Prompt:      "Write {{.Sender}}'s stand-up for {{.Arg 1}} about {{.Args}}.",
+				Persona:     "scrum",
+				Tools:       []string{"message", "read_file", "no_such_tool"},
+			},
+			{Name: "deploy", Prompt: "Deploy {{.Arg 1}}.", Model: "big-model", Allow: []string{"admin", "slack:U1"}},
+		},
+	}
+	provider := &commandProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	in := func(chatID, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "7|ann", ChatID: chatID, Content: content}
+	}
+
+	h.executeAndGetResponse(t, ctx, in("2", "/profile name Ann"))
+	h.executeAndGetResponse(t, ctx, in("2", "/standup today frontend"))
+	if provider.message != "Write Ann's stand-up for today about today frontend." {
+		t.Errorf("prompt = %q", provider.message)
+	}
+	if provider.model != "scrum-model" {
+		t.Errorf("/standup answered by %s, want the scrum persona", provider.model)
+	}
+	if !slices.Equal(slices.Sorted(slices.Values(provider.tools)), []string{"message", "read_file"}) {
+		t.Errorf("tools = %v", provider.tools)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("2", "/whoami")); !strings.Contains(got, "chosen by /standup") {
+		t.Errorf("/whoami = %q", got)
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, in("2", "/deploy web")); got != "You may not use /deploy here." {
+		t.Errorf("/deploy outside the admin chat = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("2", "/help")); !strings.Contains(got, "/standup - write the stand-up notes") ||
+		strings.Contains(got, "/deploy") {
+		t.Errorf("/help = %q", got)
+	}
+	h.executeAndGetResponse(t, ctx, in("1", "/deploy web"))
+	if provider.message != "Deploy web." || provider.model != "big-model" || len(provider.tools) < 3 {
+		t.Errorf("/deploy in the admin chat sent %q to %s with tools %v", provider.message, provider.model, provider.tools)
+	}
+}
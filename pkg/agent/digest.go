@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// digestFacts caps the recently remembered facts a digest lists.
+const digestFacts = 10
+
+// RunDigest has the agent write the digest d configures and send it to
+// its chat. The agent is given what the sections cover, so it needs no
+// tools to find it; it may only use d.Tools, and its run stops once it
+// cost d.MaxCostUSD.
+func (al *AgentLoop) RunDigest(ctx context.Context, d config.DigestConfig, now time.Time) error {
+	agent, ok := al.registry.GetAgent(d.Persona)
+	if d.Persona == "" || !ok {
+		agent = al.registry.GetDefaultAgent()
+	}
+	started := time.Now()
+	_, err := al.runAgentLoop(providers.WithBackground(ctx), agent, processOptions{
+		SessionKey:      "digest",
+		Channel:         d.Channel,
+		ChatID:          d.ChatID,
+		UserMessage:     al.digestPrompt(agent, d, now),
+		DefaultResponse: "Nothing to report today.",
+		SendResponse:    true,
+		NoHistory:       true,
+		Tools:           d.Tools,
+		NoTools:         len(d.Tools) == 0,
+		MaxCostUSD:      d.MaxCostUSD,
+	})
+	ev := state.RunEvent{Kind: "digest_sent", Source: d.Channel + ":" + d.ChatID, Duration: time.Since(started)}
+	if err != nil {
+		ev.Kind, ev.Message = "digest_failed", err.Error()
+	}
+	al.recordRunEvent(ev)
+	return err
+}
+
+// digestPrompt is what the agent is asked to write the digest from.
+func (al *AgentLoop) digestPrompt(agent *AgentInstance, d config.DigestConfig, now time.Time) string {
+	sections := d.Sections
+	if len(sections) == 0 {
+		sections = config.DigestSections
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Digest\n\nCurrent time: %s\n\n", now.Format("Mon 2006-01-02 15:04 MST"))
+	b.WriteString("Write the digest for this chat from what follows. Keep it short, in plain lists, " +
+		"leave out the parts with nothing worth telling and add nothing that is not here.\n")
+	if d.Prompt != "" {
+		b.WriteString("\n" + d.Prompt + "\n")
+	}
+	for _, section := range sections {
+		switch section {
+		case "reminders":
+			b.WriteString("\n## Scheduled in the next 24 hours\n\n" + al.digestReminders(now))
+		case "usage":
+			b.WriteString("\n## Yesterday's LLM usage\n\n" + al.digestUsage(now))
+		case "health":
+			b.WriteString("\n## Gateway health\n\n" + al.digestHealth(now))
+		case "memories":
+			b.WriteString("\n## Remembered lately\n\n" + digestMemories(agent, now))
+		}
+	}
+	return b.String()
+}
+
+// digestReminders lists the cron jobs due in the next 24 hours.
+func (al *AgentLoop) digestReminders(now time.Time) string {
+	if al.cronService == nil {
+		return "Nothing scheduled.\n"
+	}
+	var b strings.Builder
+	for _, job := range al.cronService.ListJobs(false) {
+		next := fromMS(job.State.NextRunAtMS)
+		if next.IsZero() || next.After(now.Add(24*time.Hour)) {
+			continue
+		}
+		fmt.Fprintf(&b, "- %s: %s", next.In(now.Location()).Format("Mon 15:04"), job.Payload.Message)
+		if job.Payload.Channel != "" {
+			fmt.Fprintf(&b, " (to %s:%s)", job.Payload.Channel, job.Payload.To)
+		}
+		b.WriteString("\n")
+	}
+	if b.Len() == 0 {
+		return "Nothing scheduled.\n"
+	}
+	return b.String()
+}
+
+// digestUsage sums up the LLM requests of the day before now.
+func (al *AgentLoop) digestUsage(now time.Time) string {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	usages, err := al.usageBetween(midnight.AddDate(0, 0, -1), midnight)
+	if err != nil {
+		return fmt.Sprintf("Unknown: %v\n", err)
+	}
+	if len(usages) == 0 {
+		return "No LLM requests.\n"
+	}
+	var b strings.Builder
+	var total float64
+	for _, u := range usages {
+		total += u.CostUSD
+		fmt.Fprintf(&b, "- %s: %d requests, %s tokens, $%.4f\n", u.AgentID, u.Requests, formatTokens(u.Tokens), u.CostUSD)
+	}
+	fmt.Fprintf(&b, "Total: $%.4f\n", total)
+	return b.String()
+}
+
+// digestHealth tells which channels are down, which providers failed and
+// what happened in the last 24 hours.
+func (al *AgentLoop) digestHealth(now time.Time) string {
+	st := al.Status()
+	var b strings.Builder
+	for _, ch := range st.Channels {
+		if !ch.Up {
+			fmt.Fprintf(&b, "- channel %s is down: %s\n", ch.Name, ch.LastError)
+		}
+	}
+	for _, p := range st.Providers {
+		if p.Failures > 0 {
+			fmt.Fprintf(&b, "- %s failed %d of its last %d requests: %s\n", p.Name, p.Failures, p.Requests, p.LastError)
+		}
+	}
+	if al.runEvents != nil {
+		events, _ := al.runEvents.Recent(200)
+		counts := map[string]int{}
+		for _, ev := range events {
+			if ev.Time.After(now.Add(-24*time.Hour)) && ev.Kind != "self_report" && !strings.HasPrefix(ev.Kind, "digest_") {
+				counts[ev.Kind]++
+			}
+		}
+		kinds := make([]string, 0, len(counts))
+		for kind := range counts {
+			kinds = append(kinds, kind)
+		}
+		slices.Sort(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(&b, "- %s: %d times\n", kind, counts[kind])
+		}
+	}
+	if p := st.Process; p != nil {
+		fmt.Fprintf(&b, "- up for %s, %s of memory\n",
+			(time.Duration(p.UptimeSeconds) * time.Second).String(), formatSize(int64(p.SysBytes)))
+	}
+	if b.Len() == 0 {
+		return "All well.\n"
+	}
+	return b.String()
+}
+
+// digestMemories lists the facts the agent learned in the last day, and
+// one older one picked at random to bring back to mind.
+func digestMemories(agent *AgentInstance, now time.Time) string {
+	facts := agent.ContextBuilder.memory.Facts().All()
+	var recent, older []state.Fact
+	for _, f := range facts {
+		if f.Learned.After(now.Add(-24 * time.Hour)) {
+			recent = append(recent, f)
+		} else {
+			older = append(older, f)
+		}
+	}
+	if len(recent) > digestFacts {
+		recent = recent[len(recent)-digestFacts:]
+	}
+	var b strings.Builder
+	for _, f := range recent {
+		b.WriteString("- " + FormatFact(f) + "\n")
+	}
+	if len(older) > 0 {
+		b.WriteString("From further back: " + FormatFact(older[rand.IntN(len(older))]) + "\n")
+	}
+	if b.Len() == 0 {
+		return "Nothing new.\n"
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// digestProvider records the prompt and tools it gets. With toolLoop set
+// it keeps calling list_dir at $0.02 a request.
+type digestProvider struct {
+	prompt   string
+	tools    []string
+	requests int
+	toolLoop bool
+}
+
+func (p *digestProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.requests++
+	if p.requests == 1 {
+		p.prompt = messages[len(messages)-1].Content
+	}
+	p.tools = nil
+	for _, d := range tools {
+		p.tools = append(p.tools, d.Function.Name)
+	}
+	resp := &providers.LLMResponse{Content: "Your digest", Usage: &providers.UsageInfo{Cost: 0.02}}
+	if p.toolLoop {
+		resp.ToolCalls = []providers.ToolCall{{ID: "1", Name: "list_dir", Arguments: map[string]any{"path": "."}}}
+	}
+	return resp, nil
+}
+
+func (p *digestProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestRunDigest(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: workspace, Model: "test-model", MaxTokens: 4096, MaxToolIterations: 10},
+		},
+	}
+	provider := &digestProvider{}
+	msgBus := bus.NewMessageBus()
+	al := newTestLoop(t, cfg, msgBus, provider)
+	now := time.Now()
+
+	cs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	at := now.Add(2 * time.Hour).UnixMilli()
+	if _, err := cs.AddJob("dentist", cron.CronSchedule{Kind: "at", AtMS: &at}, "Dentist at 11", true, "telegram", "1"); err != nil {
+		t.Fatal(err)
+	}
+	al.SetCronService(cs)
+	al.recordLLMEvent(state.LLMEvent{Time: now.AddDate(0, 0, -1), AgentID: "main", Model: "m", PromptTokens: 2000, CostUSD: 0.5})
+	al.recordLLMEvent(state.LLMEvent{Time: now, AgentID: "main", Model: "m", PromptTokens: 10, CostUSD: 9})
+	mem := al.registry.GetDefaultAgent().ContextBuilder.memory
+	mem.Facts().Add(state.Fact{Text: "Ann moved to Lyon", Learned: now.Add(-time.Hour)})
+
+	digest := config.DigestConfig{Enabled: true, Channel: "telegram", ChatID: "1", Prompt: "Be cheerful.", MaxCostUSD: 0.05}
+	if err := al.RunDigest(context.Background(), digest, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Be cheerful.", "Dentist at 11 (to telegram:1)", "Total: $0.5000", "Ann moved to Lyon"} {
+		if !strings.Contains(provider.prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, provider.prompt)
+		}
+	}
+	if len(provider.tools) != 0 {
+		t.Errorf("the digest was offered tools %v", provider.tools)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if out, ok := msgBus.SubscribeOutbound(ctx); !ok || out.ChatID != "1" || out.Content != "Your digest" {
+		t.Errorf("sent %+v, %v", out, ok)
+	}
+
+	// Only the allowed tools, and no more than the cap.
+	*provider = digestProvider{toolLoop: true}
+	digest.Sections, digest.Tools = []string{"usage"}, []string{"list_dir"}
+	err := al.RunDigest(context.Background(), digest, now)
+	if err == nil || !strings.Contains(err.Error(), "cost cap") {
+		t.Errorf("err = %v, want the cost cap reached", err)
+	}
+	if provider.requests != 3 {
+		t.Errorf("%d requests, want 3 to pass $0.05", provider.requests)
+	}
+	if len(provider.tools) != 1 || provider.tools[0] != "list_dir" {
+		t.Errorf("tools = %v, want only list_dir", provider.tools)
+	}
+	if strings.Contains(provider.prompt, "Scheduled") {
+		t.Errorf("a section not asked for is in the prompt:\n%s", provider.prompt)
+	}
+}
@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// dispatcher queues inbound messages per chat. Each chat is drained by one
+// worker at a time, so its messages are handled in order, while a worker
+// holds one of the scheduler's run slots, of which chats get up to
+// MaxConcurrency.
+type dispatcher struct {
+	handle   func(ctx context.Context, msg bus.InboundMessage)
+	queued   func(msg bus.InboundMessage, position int) // may be nil
+	runs     *scheduler
+	pending  chan struct{} // one token per queued message, for backpressure
+	coalesce bool
+
+	mu     sync.Mutex
+	queues map[string][]bus.InboundMessage // a key is present while its worker runs
+}
+
+// newDispatcher returns a dispatcher taking its workers' slots from runs.
+// queued, when not nil, is called with the first message of a chat whose
+// worker has to wait for a slot and its place in the line.
+func newDispatcher(
+	cfg config.QueueConfig,
+	runs *scheduler,
+	handle func(ctx context.Context, msg bus.InboundMessage),
+	queued func(msg bus.InboundMessage, position int),
+) *dispatcher {
+	return &dispatcher{
+		handle:   handle,
+		queued:   queued,
+		runs:     runs,
+		pending:  make(chan struct{}, max(cfg.MaxPending, 1)),
+		coalesce: cfg.Coalesce,
+		queues:   make(map[string][]bus.InboundMessage),
+	}
+}
+
+// submit queues msg. It blocks while the queue is full and returns false if
+// ctx ends first.
+func (d *dispatcher) submit(ctx context.Context, msg bus.InboundMessage) bool {
+	select {
+	case d.pending <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	key := msg.Channel + ":" + msg.ChatID
+	d.mu.Lock()
+	queue, running := d.queues[key]
+	d.queues[key] = append(queue, msg)
+	d.mu.Unlock()
+
+	if !running {
+		go d.drain(ctx, key)
+	}
+	return true
+}
+
+// depth returns the number of messages waiting to be handled.
+func (d *dispatcher) depth() int {
+	return len(d.pending)
+}
+
+// activeChats returns the number of chats with queued or running messages.
+func (d *dispatcher) activeChats() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queues)
+}
+
+func (d *dispatcher) drain(ctx context.Context, key string) {
+	var queued func(position int)
+	if d.queued != nil {
+		queued = func(position int) {
+			d.mu.Lock()
+			queue := d.queues[key]
+			d.mu.Unlock()
+			if len(queue) > 0 {
+				d.queued(queue[0], position)
+			}
+		}
+	}
+	release, err := d.runs.acquire(ctx, false, queued)
+	if err != nil {
+		d.mu.Lock()
+		dropped := len(d.queues[key])
+		delete(d.queues, key)
+		d.mu.Unlock()
+		d.release(dropped)
+		return
+	}
+	defer release()
+	ctx = withRunSlot(ctx)
+
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 || ctx.Err() != nil {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			d.release(len(queue))
+			return
+		}
+		n := 1
+		if d.coalesce {
+			n = coalescible(queue)
+		}
+		d.queues[key] = queue[n:]
+		d.mu.Unlock()
+		d.release(n)
+
+		msg := queue[0]
+		if n > 1 {
+			msg = mergeMessages(queue[:n])
+			logger.InfoCF("agent", "Coalesced queued messages", map[string]any{
+				"channel":  msg.Channel,
+				"chat_id":  msg.ChatID,
+				"messages": n,
+			})
+		}
+		d.handle(ctx, msg)
+	}
+}
+
+// drop removes the queued message with messageID from the queue of key and
+// reports whether there was one.
+func (d *dispatcher) drop(key, messageID string) bool {
+	d.mu.Lock()
+	queue := d.queues[key]
+	for i, msg := range queue {
+		if msg.Metadata["message_id"] == messageID {
+			d.queues[key] = append(queue[:i:i], queue[i+1:]...)
+			d.mu.Unlock()
+			d.release(1)
+			return true
+		}
+	}
+	d.mu.Unlock()
+	return false
+}
+
+// dropWhere removes the queued messages match returns true for and returns
+// how many it removed.
+func (d *dispatcher) dropWhere(match func(msg bus.InboundMessage) bool) int {
+	d.mu.Lock()
+	n := 0
+	for key, queue := range d.queues {
+		kept := slices.DeleteFunc(queue, match)
+		n += len(queue) - len(kept)
+		d.queues[key] = kept
+	}
+	d.mu.Unlock()
+	d.release(n)
+	return n
+}
+
+// takeQueued removes the messages waiting behind the running ones and
+// returns them.
+func (d *dispatcher) takeQueued() []bus.InboundMessage {
+	d.mu.Lock()
+	var taken []bus.InboundMessage
+	for key, queue := range d.queues {
+		taken = append(taken, queue...)
+		d.queues[key] = nil
+	}
+	d.mu.Unlock()
+	d.release(len(taken))
+	return taken
+}
+
+func (d *dispatcher) release(n int) {
+	for i := 0; i < n; i++ {
+		<-d.pending
+	}
+}
+
+// coalescible returns how many messages at the head of queue can be handled
+// as one run: consecutive plain messages from the same sender. Commands and
+// system messages always run on their own.
+func coalescible(queue []bus.InboundMessage) int {
+	first := queue[0]
+	if !canCoalesce(first) {
+		return 1
+	}
+	n := 1
+	for n < len(queue) {
+		next := queue[n]
+		if !canCoalesce(next) || next.SenderID != first.SenderID || next.SessionKey != first.SessionKey {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+func canCoalesce(msg bus.InboundMessage) bool {
+	return msg.Channel != "system" && !strings.HasPrefix(strings.TrimSpace(msg.Content), "/")
+}
+
+// mergeMessages joins msgs into one message. Metadata comes from the last
+// message, so replies and reactions refer to the most recent one.
+func mergeMessages(msgs []bus.InboundMessage) bus.InboundMessage {
+	merged := msgs[len(msgs)-1]
+	contents := make([]string, 0, len(msgs))
+	var mediaPaths []string
+	var attachments []bus.Attachment
+	for _, m := range msgs {
+		if m.Content != "" {
+			contents = append(contents, m.Content)
+		}
+		mediaPaths = append(mediaPaths, m.Media...)
+		attachments = append(attachments, m.Attachments...)
+	}
+	merged.Content = strings.Join(contents, "\n")
+	merged.Media = mediaPaths
+	merged.Attachments = attachments
+	return merged
+}
@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// recorder collects handled messages. Handling blocks while a chat is
+// listed in hold.
+type recorder struct {
+	mu      sync.Mutex
+	handled []string
+	hold    map[string]chan struct{}
+	started chan string
+}
+
+func newRecorder(hold ...string) *recorder {
+	r := &recorder{hold: make(map[string]chan struct{}), started: make(chan string, 16)}
+	for _, chat := range hold {
+		r.hold[chat] = make(chan struct{})
+	}
+	return r
+}
+
+func (r *recorder) handle(ctx context.Context, msg bus.InboundMessage) {
+	r.started <- msg.ChatID
+	if ch, ok := r.hold[msg.ChatID]; ok {
+		<-ch
+	}
+	r.mu.Lock()
+	r.handled = append(r.handled, msg.ChatID+":"+msg.Content)
+	r.mu.Unlock()
+}
+
+func (r *recorder) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.handled) >= n {
+			got := append([]string(nil), r.handled...)
+			r.mu.Unlock()
+			return got
+		}
+		r.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d messages, got %v", n, r.handled)
+	return nil
+}
+
+func inbound(chatID, sender, content string) bus.InboundMessage {
+	return bus.InboundMessage{Channel: "test", ChatID: chatID, SenderID: sender, Content: content}
+}
+
+func TestDispatcherOrdersWithinChat(t *testing.T) {
+	r := newRecorder()
+	d := newDispatcher(config.QueueConfig{MaxPending: 10}, newScheduler(0, 4), r.handle, nil)
+	ctx := context.Background()
+
+	for _, c := range []string{"one", "two", "three"} {
+		d.submit(ctx, inbound("a", "u1", c))
+	}
+
+	want := []string{"a:one", "a:two", "a:three"}
+	if got := r.wait(t, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("handled = %v, want %v", got, want)
+	}
+}
+
+func TestDispatcherRunsChatsInParallel(t *testing.T) {
+	r := newRecorder("slow")
+	d := newDispatcher(config.QueueConfig{MaxPending: 10}, newScheduler(0, 2), r.handle, nil)
+	ctx := context.Background()
+
+	d.submit(ctx, inbound("slow", "u1", "long task"))
+	<-r.started
+	d.submit(ctx, inbound("fast", "u2", "hi"))
+
+	if got := r.wait(t, 1); got[0] != "fast:hi" {
+		t.Errorf("handled = %v, want the other chat to run meanwhile", got)
+	}
+	if d.activeChats() != 1 {
+		t.Errorf("activeChats = %d, want 1", d.activeChats())
+	}
+	close(r.hold["slow"])
+	r.wait(t, 2)
+}
+
+func TestDispatcherCoalescesQueuedMessages(t *testing.T) {
+	r := newRecorder("a")
+	d := newDispatcher(config.QueueConfig{MaxPending: 10, Coalesce: true}, newScheduler(0, 1), r.handle, nil)
+	ctx := context.Background()
+
+	d.submit(ctx, inbound("a", "u1", "first"))
+	<-r.started
+	d.submit(ctx, inbound("a", "u1", "also"))
+	d.submit(ctx, inbound("a", "u1", "and this"))
+	d.submit(ctx, inbound("a", "u1", "/reset"))
+	d.submit(ctx, inbound("a", "u2", "from someone else"))
+	if d.depth() != 4 {
+		t.Errorf("depth = %d, want 4", d.depth())
+	}
+
+	close(r.hold["a"])
+
+	want := []string{"a:first", "a:also\nand this", "a:/reset", "a:from someone else"}
+	if got := r.wait(t, 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("handled = %q, want %q", got, want)
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	r := newRecorder("a")
+	d := newDispatcher(config.QueueConfig{MaxPending: 1}, newScheduler(0, 1), r.handle, nil)
+
+	d.submit(context.Background(), inbound("a", "u1", "running"))
+	<-r.started
+	if !d.submit(context.Background(), inbound("a", "u1", "queued")) {
+		t.Fatal("second message should fit in the queue")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if d.submit(ctx, inbound("a", "u1", "overflow")) {
+		t.Error("submit should block while the queue is full")
+	}
+	close(r.hold["a"])
+	r.wait(t, 2)
+}
+
+// fakeCoordinator holds locks in a map, as another gateway would.
+type fakeCoordinator struct {
+	mu    sync.Mutex
+	held  map[string]bool
+	taken []string
+}
+
+func (c *fakeCoordinator) TryLock(key string) (func(), bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.held[key] {
+		return nil, false, nil
+	}
+	c.held[key] = true
+	c.taken = append(c.taken, key)
+	return func() { c.set(key, false) }, true, nil
+}
+
+func (c *fakeCoordinator) set(key string, held bool) {
+	c.mu.Lock()
+	c.held[key] = held
+	c.mu.Unlock()
+}
+
+func (c *fakeCoordinator) Claim(string, time.Duration) (bool, error) { return true, nil }
+func (c *fakeCoordinator) Close() error                              { return nil }
+
+func TestHandleInboundWaitsForChatLock(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &mockProvider{})
+	coordinator := &fakeCoordinator{held: map[string]bool{"chat:telegram:42": true}}
+	al.SetCoordinator(coordinator)
+
+	// Another gateway is answering the chat; this one waits its turn.
+	done := make(chan struct{})
+	go func() {
+		al.handleInbound(context.Background(), bus.InboundMessage{
+			Channel: "telegram", SenderID: "7", ChatID: "42", Content: "hello",
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("message handled while another gateway held the chat")
+	case <-time.After(100 * time.Millisecond):
+	}
+	coordinator.set("chat:telegram:42", false)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not handled after the lock was released")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if out, ok := al.bus.SubscribeOutbound(ctx); !ok || out.Content != "Mock response" {
+		t.Errorf("reply = %+v", out)
+	}
+	coordinator.mu.Lock()
+	defer coordinator.mu.Unlock()
+	if !reflect.DeepEqual(coordinator.taken, []string{"chat:telegram:42"}) || coordinator.held["chat:telegram:42"] {
+		t.Errorf("locks taken %v, held %v", coordinator.taken, coordinator.held)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	msgBus := bus.NewMessageBus()
+	al := newTestLoop(t, cfg, msgBus, &simpleMockProvider{response: "ok"})
+	r := newRecorder("a")
+	al.dispatcher = newDispatcher(cfg.Gateway.Queue, newScheduler(0, cfg.Gateway.Queue.MaxConcurrency), r.handle, nil)
+
+	ctx := context.Background()
+	al.dispatcher.submit(ctx, inbound("a", "u", "running"))
+	<-r.started
+	al.dispatcher.submit(ctx, inbound("a", "u", "queued"))
+
+	// The drain timeout ends the wait, not the running message; the one
+	// queued behind it is kept.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(r.hold["a"])
+	}()
+	drainCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	al.Drain(drainCtx)
+	if got := r.wait(t, 1); !reflect.DeepEqual(got, []string{"a:running"}) {
+		t.Errorf("handled %v", got)
+	}
+
+	// Messages that arrive while draining are kept too.
+	runCtx, stop := context.WithCancel(ctx)
+	go al.Run(runCtx)
+	msgBus.PublishInbound(inbound("b", "u", "late"))
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	al.Stop()
+
+	if n := al.ResumeHeld(); n != 2 {
+		t.Fatalf("ResumeHeld() = %d, want 2", n)
+	}
+	var resumed []string
+	for range 2 {
+		msg, _ := msgBus.ConsumeInbound(ctx)
+		resumed = append(resumed, msg.Content)
+	}
+	if !reflect.DeepEqual(resumed, []string{"queued", "late"}) {
+		t.Errorf("resumed %v", resumed)
+	}
+	if n := al.ResumeHeld(); n != 0 {
+		t.Errorf("ResumeHeld() again = %d", n)
+	}
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/dnd"
+)
+
+// defaultDND is how long /dnd on lasts without a time.
+const defaultDND = time.Hour
+
+// SetDoNotDisturb lets /dnd show and change when proactive messages are
+// held back.
+func (al *AgentLoop) SetDoNotDisturb(s *dnd.Schedule) {
+	al.dnd = s
+}
+
+// handleDNDCommand shows or changes do-not-disturb:
+//
+//	/dnd                    whether it is on, and the busy times of today
+//	/dnd on [2h|<when>]     on for an hour, a duration or until e.g. "tomorrow at 9"
+//	/dnd off                off again; meetings and focus blocks still count
+func (al *AgentLoop) handleDNDCommand(msg bus.InboundMessage, args []string) string {
+	if al.dnd == nil {
+		return al.t(msg, "Do-not-disturb is not set up. Enable gateway.dnd in the config.")
+	}
+	loc := al.senderLocation(msg)
+	now := time.Now()
+	if len(args) == 0 {
+		return al.dndStatus(msg, now, loc)
+	}
+	switch args[0] {
+	case "on":
+		until, err := dndUntil(strings.Join(args[1:], " "), now, loc)
+		if err != nil {
+			return al.t(msg, "Usage: /dnd on [2h|tomorrow at 9]") + "\n" + err.Error()
+		}
+		if err := al.dnd.SetManual(until); err != nil {
+			return al.t(msg, "Could not turn do-not-disturb on: %v", err)
+		}
+		return al.t(msg, "Do not disturb until %s. Urgent alerts still come through.", formatRun(until, loc))
+	case "off":
+		if err := al.dnd.SetManual(time.Time{}); err != nil {
+			return al.t(msg, "Could not turn do-not-disturb off: %v", err)
+		}
+		if busy, ok := al.dnd.BusyAt(now); ok {
+			return al.t(msg, "Do-not-disturb is off, but you are busy with %s until %s.", busy.Reason, formatRun(busy.Until, loc))
+		}
+		return al.t(msg, "Do-not-disturb is off.")
+	default:
+		return al.t(msg, "Usage: /dnd [on [2h|tomorrow at 9]|off]")
+	}
+}
+
+// dndStatus tells whether proactive messages are held back now, the busy
+// times left today and how reading the calendar went.
+func (al *AgentLoop) dndStatus(msg bus.InboundMessage, now time.Time, loc *time.Location) string {
+	var b strings.Builder
+	if busy, ok := al.dnd.BusyAt(now); ok {
+		b.WriteString(al.t(msg, "Do not disturb: %s, until %s.", busy.Reason, formatRun(busy.Until, loc)))
+	} else {
+		b.WriteString(al.t(msg, "You can be disturbed now."))
+	}
+
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+	if periods := al.dnd.Periods(now, midnight); len(periods) > 0 {
+		b.WriteString("\n" + al.t(msg, "Busy today:"))
+		for _, p := range periods {
+			fmt.Fprintf(&b, "\n- %s–%s %s", p.Start.In(loc).Format("15:04"), p.End.In(loc).Format("15:04"), p.Reason)
+		}
+	}
+
+	if cal := al.dnd.Calendar(); cal != nil {
+		read, err := cal.Status()
+		switch {
+		case err != nil:
+			b.WriteString("\n" + al.t(msg, "⚠️ The calendar could not be read: %v", err))
+		case read.IsZero():
+			b.WriteString("\n" + al.t(msg, "The calendar has not been read yet."))
+		default:
+			b.WriteString("\n" + al.t(msg, "Calendar read %s.", formatRun(read, loc)))
+		}
+	}
+	return b.String()
+}
+
+// dndUntil reads when /dnd on ends: after a duration such as "90m", at a
+// time in words such as "tomorrow at 9", or in an hour without either.
+func dndUntil(text string, now time.Time, loc *time.Location) (time.Time, error) {
+	text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "for "))
+	text = strings.TrimPrefix(text, "until ")
+	if text == "" {
+		return now.Add(defaultDND), nil
+	}
+	if d, err := time.ParseDuration(text); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("%s is not a duration ahead", text)
+		}
+		return now.Add(d), nil
+	}
+	schedule, err := cron.ParseSchedule(text, loc, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if schedule.Kind != "at" || schedule.AtMS == nil {
+		return time.Time{}, fmt.Errorf("%q repeats; use focus blocks in the config for that", text)
+	}
+	until := time.UnixMilli(*schedule.AtMS)
+	if !until.After(now) {
+		return time.Time{}, fmt.Errorf("%s has passed", formatRun(until, loc))
+	}
+	return until, nil
+}
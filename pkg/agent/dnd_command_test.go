@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/dnd"
+)
+
+func TestDNDCommand(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: workspace, Model: "test-model", MaxTokens: 4096, MaxToolIterations: 10},
+		},
+		Gateway: config.GatewayConfig{Admin: config.AdminConfig{Chats: []string{"telegram:admin"}, Senders: []string{"telegram:1"}}},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &simpleMockProvider{response: "ok"})
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "chat1", Content: "/dnd"}
+	admin := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "admin"}
+
+	if got := al.handleDNDCommand(admin, nil); !strings.Contains(got, "gateway.dnd") {
+		t.Errorf("/dnd without a schedule = %q", got)
+	}
+	s, err := dnd.New(config.DNDConfig{Enabled: true}, workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	al.SetDoNotDisturb(s)
+	if got, _ := al.handleCommand(t.Context(), msg); !strings.Contains(got, "admin") {
+		t.Errorf("/dnd outside the admin chat = %q", got)
+	}
+
+	if got := al.handleDNDCommand(admin, nil); got != "You can be disturbed now." {
+		t.Errorf("/dnd = %q", got)
+	}
+	if got := al.handleDNDCommand(admin, []string{"on", "for", "2h"}); !strings.HasPrefix(got, "Do not disturb until ") {
+		t.Errorf("/dnd on for 2h = %q", got)
+	}
+	busy, ok := s.BusyAt(time.Now())
+	if !ok || busy.Until.Sub(time.Now()) < 119*time.Minute {
+		t.Errorf("busy = %+v, %v", busy, ok)
+	}
+	if got := al.handleDNDCommand(admin, nil); !strings.Contains(got, "Do not disturb: /dnd") || !strings.Contains(got, "Busy today:") {
+		t.Errorf("/dnd while on = %q", got)
+	}
+	if got := al.handleDNDCommand(admin, []string{"on", "every", "day"}); !strings.Contains(got, "repeats") {
+		t.Errorf("/dnd on every day = %q", got)
+	}
+	if got := al.handleDNDCommand(admin, []string{"off"}); got != "Do-not-disturb is off." {
+		t.Errorf("/dnd off = %q", got)
+	}
+}
+
+func TestDNDUntil(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	for text, want := range map[string]time.Time{
+		"":                    now.Add(time.Hour),
+		"90m":                 now.Add(90 * time.Minute),
+		"in 2 hours":          now.Add(2 * time.Hour),
+		"until tomorrow at 9": time.Date(2026, 3, 3, 9, 0, 0, 0, time.UTC),
+		"for 30m":             now.Add(30 * time.Minute),
+	} {
+		got, err := dndUntil(text, now, time.UTC)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("dndUntil(%q) = %v, %v; want %v", text, got, err, want)
+		}
+	}
+	if _, err := dndUntil("-1h", now, time.UTC); err == nil {
+		t.Error("accepted a duration in the past")
+	}
+}
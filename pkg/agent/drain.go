@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// heldInbound names the messages the gateway set aside when it stopped,
+// see state.Hold.
+const heldInbound = "inbound"
+
+// Drain stops starting runs before the gateway stops: messages that arrive
+// from now on, and those held back for a group batch, are set aside for
+// the next start. The running and queued runs get until ctx ends to
+// finish; what is still queued then is set aside too. It returns how many
+// runs were still going.
+func (al *AgentLoop) Drain(ctx context.Context) int {
+	al.draining.Store(true)
+	al.hold(al.batcher.takeAll())
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for al.dispatcher.activeChats() > 0 {
+		select {
+		case <-ctx.Done():
+			al.hold(al.dispatcher.takeQueued())
+			al.runsMu.Lock()
+			defer al.runsMu.Unlock()
+			return len(al.runs)
+		case <-ticker.C:
+		}
+	}
+	return 0
+}
+
+// Draining reports whether Drain was called.
+func (al *AgentLoop) Draining() bool {
+	return al.draining.Load()
+}
+
+// hold sets msgs aside for the next start.
+func (al *AgentLoop) hold(msgs []bus.InboundMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	if err := state.Hold(al.cfg.WorkspacePath(), heldInbound, msgs); err != nil {
+		logger.ErrorCF("agent", "Failed to keep messages for the next start", map[string]any{
+			"messages": len(msgs),
+			"error":    err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("agent", "Kept messages for the next start", map[string]any{"messages": len(msgs)})
+}
+
+// ResumeHeld handles the messages set aside when the gateway last
+// stopped. It returns how many there were.
+func (al *AgentLoop) ResumeHeld() int {
+	msgs, err := state.TakeHeld[bus.InboundMessage](al.cfg.WorkspacePath(), heldInbound)
+	if err != nil {
+		logger.ErrorCF("agent", "Failed to read the messages kept at the last stop", map[string]any{"error": err.Error()})
+		return 0
+	}
+	if len(msgs) > 0 {
+		logger.InfoCF("agent", "Handling the messages kept at the last stop", map[string]any{"messages": len(msgs)})
+		// The bus is consumed by Run, which may not be started yet.
+		go func() {
+			for _, msg := range msgs {
+				al.bus.PublishInbound(msg)
+			}
+		}()
+	}
+	return len(msgs)
+}
@@ -0,0 +1,363 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// ErasureReport counts what EraseSender removed.
+type ErasureReport struct {
+	Sender        string `json:"sender"`
+	Sessions      int    `json:"sessions"`       // direct sessions deleted
+	GroupSessions int    `json:"group_sessions"` // group sessions the sender was taken out of
+	GroupMessages int    `json:"group_messages"` // messages in those that were theirs or answered them
+	Facts         int    `json:"facts"`          // remembered facts
+	PendingFacts  int    `json:"pending_facts"`  // consolidation changes awaiting approval
+	Profile       bool   `json:"profile"`        // whether there was a profile
+	PersonNotes   int    `json:"person_notes"`   // notes about them in memory/people
+	LLMEvents     int    `json:"llm_events"`
+	Traces        int    `json:"traces"`
+	RunEvents     int    `json:"run_events"`
+	Queued        int    `json:"queued"`       // messages not answered yet
+	Running       int    `json:"running"`      // answers stopped
+	Undelivered   int    `json:"undelivered"`  // replies to their chats waiting to be sent again
+	DeadLetters   int    `json:"dead_letters"` // replies to their chats given up on
+	Scheduled     int    `json:"scheduled"`    // messages scheduled to or by them, cancelled
+	FollowUps     int    `json:"follow_ups"`   // follow-ups the agent planned in their direct chat
+}
+
+func (r ErasureReport) String() string {
+	var parts []string
+	add := func(n int, what string) {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, what))
+		}
+	}
+	add(r.Sessions, "sessions")
+	if r.GroupSessions > 0 {
+		parts = append(parts, fmt.Sprintf("%d messages in %d group sessions", r.GroupMessages, r.GroupSessions))
+	}
+	add(r.Facts, "facts")
+	add(r.PendingFacts, "pending facts")
+	if r.Profile {
+		parts = append(parts, "the profile")
+	}
+	add(r.PersonNotes, "person notes")
+	add(r.LLMEvents, "LLM events")
+	add(r.Traces, "traces")
+	add(r.RunEvents, "run events")
+	add(r.Queued, "queued messages")
+	add(r.Running, "running answers")
+	add(r.Undelivered, "undelivered replies")
+	add(r.DeadLetters, "dead letters")
+	add(r.Scheduled, "scheduled messages")
+	add(r.FollowUps, "follow-ups")
+	if len(parts) == 0 {
+		return "nothing"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EraseSender deletes what the gateway keeps about sender, a profile ID
+// such as "telegram:123456": their queued and running messages, their
+// direct sessions, their lines in group sessions, the facts learned from
+// them, their profile and person notes, the events recorded about their
+// sessions, the replies to their direct chat that wait in the outbox or
+// were given up on as dead letters, and the messages scheduled for their
+// direct chat or from it, which it cancels, as it does the follow-ups the
+// agent planned there. It records the erasure, with who
+// asked for it, as a run event and in the audit log, which it does not
+// erase from: the audit log names the sender but holds nothing they said.
+//
+// Notes the agent wrote into MEMORY.md or other workspace files are free
+// text and are left alone.
+func (al *AgentLoop) EraseSender(sender, requestedBy string) (ErasureReport, error) {
+	channel, id, ok := strings.Cut(sender, ":")
+	if !ok || channel == "" || id == "" {
+		return ErasureReport{}, fmt.Errorf("%q is not a sender of the form channel:id", sender)
+	}
+	id = speakerID(id)
+	sender = channel + ":" + id
+	r := ErasureReport{Sender: sender}
+	bySender := func(msg bus.InboundMessage) bool { return profileID(msg) == sender }
+
+	// Stop their messages first, so no run saves what is being erased.
+	r.Queued = al.batcher.dropWhere(bySender) + al.dispatcher.dropWhere(bySender)
+	r.Running = al.cancelSenderRuns(sender, errSenderErased)
+
+	// Their direct chat has their ID as its chat ID.
+	chat := func(chatChannel, chatID string) bool {
+		chatType, _ := channels.SplitAccount(chatChannel)
+		return chatType == channel && speakerID(chatID) == id
+	}
+
+	var errs []error
+	if al.channelManager != nil {
+		var err error
+		if r.Undelivered, r.DeadLetters, err = al.channelManager.EraseUndelivered(chat); err != nil {
+			errs = append(errs, err)
+		}
+		// A message the agent scheduled names the chat it was asked in as
+		// By, one scheduled by a person names them.
+		r.Scheduled = al.channelManager.DropScheduled(func(m channels.ScheduledMessage) bool {
+			byChannel, byChat, _ := strings.Cut(m.By, ":")
+			return chat(m.Message.Channel, m.Message.ChatID) || m.By == sender || chat(byChannel, byChat)
+		})
+	}
+	// Follow-ups go before the sessions, so none brings one back or keeps
+	// what the agent noted about them.
+	if al.cronService != nil {
+		n, err := al.cronService.RemoveWhere(func(job *cron.CronJob) bool {
+			if job.Payload.Session == "" {
+				return false
+			}
+			sessionChannel, peer := sessionPeer(job.Payload.Session)
+			return chat(job.Payload.Channel, job.Payload.To) ||
+				(peer == "direct:"+strings.ToLower(id) && (sessionChannel == "" || sessionChannel == channel))
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		r.FollowUps = n
+	}
+	erased := make(map[string]bool) // deleted session keys
+	var facts []string
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		for _, info := range agent.Sessions.UpdatedSince(time.Time{}) {
+			switch sessionChannel, peer := sessionPeer(info.Key); {
+			case sessionChannel != "" && sessionChannel != channel:
+			case peer == "direct:"+strings.ToLower(id):
+				if err := agent.Sessions.Delete(info.Key); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				erased[info.Key] = true
+				r.Sessions++
+			case strings.HasPrefix(peer, "group:") || strings.HasPrefix(peer, "channel:"):
+				n, ok := eraseFromGroup(agent.Sessions, info.Key, id)
+				if !ok {
+					continue
+				}
+				if err := agent.Sessions.Save(info.Key); err != nil {
+					errs = append(errs, err)
+				}
+				r.GroupSessions++
+				r.GroupMessages += n
+			}
+		}
+
+		mem := agent.ContextBuilder.memory
+		switch err := os.Remove(mem.PersonFile(channel, id)); {
+		case err == nil:
+			r.PersonNotes++
+		case !os.IsNotExist(err):
+			errs = append(errs, err)
+		}
+		forgotten, err := mem.facts.ForgetWhere(func(f state.Fact) bool {
+			return f.Sender == sender || erased[f.Session]
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, f := range forgotten {
+			facts = append(facts, f.Text)
+		}
+		r.Facts += len(forgotten)
+		dropped, err := mem.consolidation.Drop(func(c state.FactChange) bool {
+			if c.Add != nil && (c.Add.Sender == sender || erased[c.Add.Session]) {
+				facts = append(facts, c.Add.Text)
+				return true
+			}
+			return false
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		r.PendingFacts += dropped
+	}
+
+	if r.Profile = !al.profiles.Get(sender).Empty(); r.Profile {
+		if err := al.profiles.Delete(sender); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// LLM events and traces name the sessions they were made for; run
+	// events about memories quote the facts.
+	n, err := al.llmEvents.Remove(func(ev state.LLMEvent) bool { return erased[ev.SessionKey] })
+	if err != nil {
+		errs = append(errs, err)
+	}
+	r.LLMEvents = n
+	n, err = al.traces.Remove(func(tr state.Trace) bool { return erased[tr.SessionKey] })
+	if err != nil {
+		errs = append(errs, err)
+	}
+	r.Traces = n
+	n, err = al.runEvents.Remove(func(ev state.RunEvent) bool {
+		for key := range erased {
+			if strings.Contains(ev.Message, key) {
+				return true
+			}
+		}
+		if strings.HasPrefix(ev.Kind, "memory_") {
+			for _, text := range facts {
+				if strings.Contains(ev.Message, text) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	r.RunEvents = n
+
+	al.recordRunEvent(state.RunEvent{
+		Kind:    "data_erased",
+		Source:  sender,
+		Message: fmt.Sprintf("Erased %s, as asked by %s", r, requestedBy),
+	})
+	err = errors.Join(errs...)
+	outcome, detail := "ok", r.String()
+	if err != nil {
+		outcome, detail = "failed", detail+"; "+err.Error()
+	}
+	al.Audit(state.AuditEntry{Action: "erase", Actor: requestedBy, Target: sender, Outcome: outcome, Detail: detail})
+	return r, err
+}
+
+// sessionPeer returns the channel a routed session key names, if any, and
+// its peer, e.g. "telegram" and "direct:123" for
+// "agent:main:telegram:direct:123#1700000000".
+func sessionPeer(key string) (channel, peer string) {
+	base, _, _ := strings.Cut(key, "#")
+	parsed := routing.ParseAgentSessionKey(base)
+	if parsed == nil {
+		return "", ""
+	}
+	parts := strings.Split(parsed.Rest, ":")
+	for i := len(parts) - 2; i >= 0; i-- {
+		switch parts[i] {
+		case "direct", "group", "channel":
+			if i > 0 {
+				channel, _ = channels.SplitAccount(parts[0])
+			}
+			peer := parts[i] + ":" + parts[i+1]
+			if parts[i] == "direct" {
+				peer = parts[i] + ":" + speakerID(parts[i+1])
+			}
+			return channel, peer
+		}
+	}
+	return "", ""
+}
+
+// eraseFromGroup takes the participant id out of a group session. Their
+// lines leave the user messages they are in; a message left empty goes
+// with the replies to it. The summary goes too, as it may retell what they
+// said. It returns how many messages it changed or removed, and false if
+// id never spoke in the session.
+func eraseFromGroup(sessions *session.SessionManager, key, id string) (int, bool) {
+	participants := sessions.Participants(key)
+	speakers := make(map[string]string, len(participants)) // "Name: " -> ID
+	found := false
+	for _, p := range participants {
+		speakers[p.Name+": "] = p.ID
+		found = found || p.ID == id
+	}
+	if !found {
+		return 0, false
+	}
+
+	history := sessions.GetHistory(key)
+	kept := make([]providers.Message, 0, len(history))
+	changed, dropping := 0, false
+	for _, m := range history {
+		if m.Role != "user" {
+			if dropping {
+				changed++
+			} else {
+				kept = append(kept, m)
+			}
+			continue
+		}
+		content, ok := dropSpeakerLines(m.Content, speakers, id)
+		dropping = ok && strings.TrimSpace(content) == ""
+		if ok {
+			changed++
+		}
+		if !dropping {
+			m.Content = content
+			kept = append(kept, m)
+		}
+	}
+	sessions.SetHistory(key, kept)
+	sessions.SetSummary(key, "")
+	sessions.RemoveParticipant(key, id)
+	return changed, true
+}
+
+// dropSpeakerLines removes the lines of id from a group message, where
+// each speaker's lines start with "Name: ". It reports whether there were
+// any.
+func dropSpeakerLines(content string, speakers map[string]string, id string) (string, bool) {
+	var kept []string
+	current, dropped := "", false
+	for _, line := range strings.Split(content, "\n") {
+		for prefix, who := range speakers {
+			if strings.HasPrefix(line, prefix) {
+				current = who
+				break
+			}
+		}
+		if current == id {
+			dropped = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n"), dropped
+}
+
+// handleEraseCommand handles /erase <channel:id> [confirm] in the admin
+// chat. Without confirm it says what would go.
+func (al *AgentLoop) handleEraseCommand(msg bus.InboundMessage, args []string) string {
+	if !al.isAdminChat(msg) {
+		return al.adminOnly(msg, "/erase")
+	}
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "confirm") {
+		return "Usage: /erase <channel:sender-id> [confirm]"
+	}
+	if len(args) == 1 {
+		return fmt.Sprintf("This deletes what is kept about %s: their direct sessions, their messages in groups, "+
+			"the facts learned from them, their profile, the events about them, the undelivered replies to them, "+
+			"the messages scheduled for or by them and the follow-ups planned with them. It cannot be undone.\n"+
+			"Send /erase %s confirm to go ahead.", args[0], args[0])
+	}
+	r, err := al.EraseSender(args[0], profileID(msg))
+	if r.Sender == "" {
+		return err.Error()
+	}
+	reply := fmt.Sprintf("Erased %s for %s.", r, r.Sender)
+	if err != nil {
+		reply += "\nSome of it could not be erased: " + err.Error()
+	}
+	return reply
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestEraseSender(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cfg.Session.DMScope = "per-channel-peer"
+	cfg.Gateway.Supervisor.AlertChannel = "telegram"
+	cfg.Gateway.Supervisor.AlertChatID = "1"
+	cfg.Gateway.Admin.Senders = []string{"telegram:1"}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &mockProvider{})
+	agent := al.registry.GetDefaultAgent()
+	h := testHelper{al: al}
+	ctx := context.Background()
+
+	direct := func(sender, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: sender, ChatID: sender, Content: content,
+			Metadata: map[string]string{"peer_kind": "direct"}}
+	}
+	group := func(sender, name, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: sender, ChatID: "-100", Content: content,
+			Metadata: map[string]string{"peer_kind": "group", "first_name": name}}
+	}
+	h.executeAndGetResponse(t, ctx, direct("7", "my doctor's appointment is on Friday"))
+	h.executeAndGetResponse(t, ctx, direct("8", "hello"))
+	h.executeAndGetResponse(t, ctx, group("7", "Alice", "I'm at the clinic"))
+	h.executeAndGetResponse(t, ctx, group("8", "Bob", "lunch anyone?"))
+
+	facts := agent.ContextBuilder.memory.facts
+	facts.Add(state.Fact{Text: "Alice sees a doctor on Friday", Sender: "telegram:7"})
+	facts.Add(state.Fact{Text: "Bob likes lunch", Sender: "telegram:8"})
+	al.profiles.Update("telegram:7", func(p *state.Profile) { p.Name = "Alice" })
+	personFile := agent.ContextBuilder.memory.PersonFile("telegram", "7")
+	os.MkdirAll(filepath.Dir(personFile), 0o755)
+	os.WriteFile(personFile, []byte("- pregnant\n"), 0o644)
+
+	// Replies waiting in the outbox and given up on, to both senders.
+	stateDir := filepath.Join(cfg.WorkspacePath(), "state")
+	os.MkdirAll(stateDir, 0o755)
+	os.WriteFile(filepath.Join(stateDir, "outbox.json"), []byte(`[
+		{"id": "1", "message": {"channel": "telegram", "chat_id": "7", "content": "your appointment"}, "attempts": 1},
+		{"id": "2", "message": {"channel": "telegram", "chat_id": "8", "content": "lunch"}, "attempts": 1}
+	]`), 0o600)
+	deadLetters := filepath.Join(stateDir, "dead_letters.jsonl")
+	os.WriteFile(deadLetters, []byte(
+		`{"id":"3","message":{"channel":"telegram","chat_id":"7","content":"about the clinic"},"attempts":5}`+"\n"+
+			`{"id":"4","message":{"channel":"telegram","chat_id":"8","content":"lunch"},"attempts":5}`+"\n"), 0o600)
+	cm, err := channels.NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	telegram := &recordingStreamChannel{BaseChannel: channels.NewBaseChannel("telegram", nil, nil, nil)}
+	cm.RegisterChannel("telegram", telegram)
+	al.SetChannelManager(cm)
+	soon := time.Now().Add(time.Hour)
+	for _, s := range []struct{ chatID, by string }{
+		{"7", "telegram:1"},    // to them
+		{"-100", "telegram:7"}, // asked for in their chat
+		{"-100", "telegram:8"},
+	} {
+		msg := bus.OutboundMessage{Channel: "telegram", ChatID: s.chatID, Content: "reminder"}
+		if _, err := cm.ScheduleMessage(msg, soon, s.by); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cs := cron.NewCronService(filepath.Join(cfg.WorkspacePath(), "cron", "jobs.json"), nil)
+	al.SetCronService(cs)
+	atMS := soon.UnixMilli()
+	for _, sender := range []string{"7", "8"} {
+		job, err := cs.AddJob("follow-up", cron.CronSchedule{Kind: "at", AtMS: &atMS}, "check", false, "telegram", sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.Payload.Session = "agent:main:telegram:direct:" + sender
+		job.Payload.Context = "the appointment of " + sender
+		if err := cs.UpdateJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "1"}
+	erase := func(msg bus.InboundMessage, content string) string {
+		msg.Content = content
+		return h.executeAndGetResponse(t, ctx, msg)
+	}
+	if got := erase(direct("8", ""), "/erase telegram:7 confirm"); !strings.Contains(got, "admin chat") {
+		t.Errorf("/erase outside the admin chat = %q", got)
+	}
+	if got := erase(admin, "/erase telegram:7"); !strings.Contains(got, "/erase telegram:7 confirm") {
+		t.Errorf("/erase without confirm = %q", got)
+	}
+	got := erase(admin, "/erase telegram:7 confirm")
+	want := "Erased 1 sessions, 2 messages in 1 group sessions, 1 facts, the profile, 1 person notes, 1 LLM events"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("/erase confirm = %q, want it to start with %q", got, want)
+	}
+
+	if history := agent.Sessions.GetHistory("agent:main:telegram:direct:7"); len(history) != 0 {
+		t.Errorf("direct session survived: %+v", history)
+	}
+	if history := agent.Sessions.GetHistory("agent:main:telegram:direct:8"); len(history) != 2 {
+		t.Errorf("another sender's session = %+v", history)
+	}
+	groupHistory := agent.Sessions.GetHistory("agent:main:telegram:group:-100")
+	if len(groupHistory) != 2 || groupHistory[0].Content != "Bob: lunch anyone?" {
+		t.Errorf("group history = %+v", groupHistory)
+	}
+	if p := agent.Sessions.Participants("agent:main:telegram:group:-100"); len(p) != 1 || p[0].ID != "8" {
+		t.Errorf("participants = %+v", p)
+	}
+	if all := facts.All(); len(all) != 1 || all[0].Sender != "telegram:8" {
+		t.Errorf("facts = %+v", all)
+	}
+	if !al.profiles.Get("telegram:7").Empty() {
+		t.Error("profile survived")
+	}
+	if _, err := os.Stat(personFile); !os.IsNotExist(err) {
+		t.Errorf("person notes survived: %v", err)
+	}
+	llmEvents, _ := al.llmEvents.Recent(0)
+	for _, ev := range llmEvents {
+		if strings.Contains(ev.SessionKey, "direct:7") {
+			t.Errorf("LLM event of an erased session: %+v", ev)
+		}
+	}
+	if !strings.Contains(got, "1 undelivered replies, 1 dead letters") {
+		t.Errorf("/erase confirm = %q, want the outbox counted", got)
+	}
+	if !strings.Contains(got, "2 scheduled messages") {
+		t.Errorf("/erase confirm = %q, want the scheduled messages counted", got)
+	}
+	if left := cm.ScheduledMessages(); len(left) != 1 || left[0].By != "telegram:8" {
+		t.Errorf("scheduled messages left = %+v", left)
+	}
+	if !strings.Contains(got, "1 follow-ups") {
+		t.Errorf("/erase confirm = %q, want the follow-ups counted", got)
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 1 || jobs[0].Payload.To != "8" {
+		t.Errorf("follow-ups left = %+v", jobs)
+	}
+	jobsFile, _ := os.ReadFile(filepath.Join(cfg.WorkspacePath(), "cron", "jobs.json"))
+	if strings.Contains(string(jobsFile), "appointment of 7") {
+		t.Errorf("the follow-up's note survived: %s", jobsFile)
+	}
+	if n := cm.PendingDeliveries(); n != 1 {
+		t.Errorf("%d undelivered replies left, want 1", n)
+	}
+	outbox, _ := os.ReadFile(filepath.Join(stateDir, "outbox.json"))
+	dead, _ := os.ReadFile(deadLetters)
+	for _, data := range [][]byte{outbox, dead} {
+		if strings.Contains(string(data), "appointment") || strings.Contains(string(data), "clinic") ||
+			!strings.Contains(string(data), "lunch") {
+			t.Errorf("outbox after the erasure = %s", data)
+		}
+	}
+	runEvents, _ := al.runEvents.Recent(1)
+	if len(runEvents) != 1 || runEvents[0].Kind != "data_erased" || runEvents[0].Source != "telegram:7" ||
+		!strings.HasSuffix(runEvents[0].Message, "as asked by telegram:1") {
+		t.Errorf("audit record = %+v", runEvents)
+	}
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Events returns the bus the loop publishes what happens in runs on: runs
+// starting and finishing, tool calls, LLM requests and run events. The
+// gateway shares it with the channels and subscribes its metrics to it.
+func (al *AgentLoop) Events() *events.Bus {
+	return al.eventBus
+}
+
+// subscribeEventLogs writes the LLM requests, run events, finished runs
+// and tool calls published on the bus to the workspace's event logs.
+func (al *AgentLoop) subscribeEventLogs() {
+	events.Subscribe(al.eventBus, events.LLMRequested, func(ev state.LLMEvent) {
+		if al.llmEvents == nil {
+			return
+		}
+		if err := al.llmEvents.Append(ev); err != nil {
+			logger.WarnCF("agent", "Failed to record LLM event", map[string]any{"error": err.Error()})
+		}
+	})
+	events.Subscribe(al.eventBus, events.RunEvent, func(ev state.RunEvent) {
+		if al.runEvents == nil {
+			return
+		}
+		if err := al.runEvents.Append(ev); err != nil {
+			logger.WarnCF("agent", "Failed to record run event", map[string]any{"error": err.Error()})
+		}
+	})
+	events.Subscribe(al.eventBus, events.RunFinished, func(run events.Run) {
+		al.appendTrace(state.Trace{
+			Time:       run.Started.Add(run.Duration),
+			Kind:       state.TraceRun,
+			AgentID:    run.AgentID,
+			SessionKey: run.SessionKey,
+			Channel:    run.Channel,
+			TaskID:     run.TaskID,
+			Background: run.Background,
+			DurationMS: run.Duration.Milliseconds(),
+			Exit:       run.Exit,
+			Error:      run.Error,
+		})
+	})
+	events.Subscribe(al.eventBus, events.ToolExecuted, func(call events.ToolCall) {
+		al.appendTrace(state.Trace{
+			Kind:       state.TraceTool,
+			AgentID:    call.AgentID,
+			SessionKey: call.SessionKey,
+			TaskID:     call.TaskID,
+			Tool:       call.Tool,
+			DurationMS: call.Duration.Milliseconds(),
+			Error:      call.Error,
+		})
+	})
+}
+
+func (al *AgentLoop) appendTrace(tr state.Trace) {
+	if al.traces == nil {
+		return
+	}
+	if err := al.traces.Append(tr); err != nil {
+		logger.WarnCF("agent", "Failed to record trace", map[string]any{"error": err.Error()})
+	}
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestEvents_PublishedForRuns(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &profileProvider{})
+	var started, finished []events.Run
+	var calls []events.ToolCall
+	var requests int
+	events.Subscribe(al.Events(), events.RunStarted, func(r events.Run) { started = append(started, r) })
+	events.Subscribe(al.Events(), events.RunFinished, func(r events.Run) { finished = append(finished, r) })
+	events.Subscribe(al.Events(), events.ToolExecuted, func(c events.ToolCall) { calls = append(calls, c) })
+	events.Subscribe(al.Events(), events.LLMRequested, func(state.LLMEvent) { requests++ })
+
+	h := testHelper{al: al}
+	h.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "42", ChatID: "42", Content: "I live in Berlin",
+	})
+
+	if len(started) != 1 || len(finished) != 1 {
+		t.Fatalf("runs started %d, finished %d", len(started), len(finished))
+	}
+	if r := finished[0]; r.AgentID != started[0].AgentID || r.Channel != "telegram" || r.ChatID != "42" || r.Error != "" {
+		t.Errorf("finished run = %+v", r)
+	}
+	if len(calls) != 1 || calls[0].Tool != "update_profile" || calls[0].Error != "" {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if requests != 2 {
+		t.Errorf("LLM requests = %d, want 2", requests)
+	}
+}
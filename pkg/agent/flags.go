@@ -0,0 +1,274 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// readOnlyTools are the tools agents keep in read-only mode: they read
+// files or the board's sensors, search and fetch the web, or send
+// messages, and change nothing.
+var readOnlyTools = []string{"read_file", "list_dir", "web_search", "web_fetch", "find_skills", "message", "send_message", "device"}
+
+// flags are the kill switches of the gateway: gateway.flags in the
+// config, overridden by what an admin set with /flags. A flag is named
+//
+//	read_only          on: agents only have readOnlyTools
+//	proactive          off: cron jobs and the heartbeat do not run
+//	tool:<name>        off: no agent may use the tool
+//	channel:<name>     off: messages on the channel are not answered
+type flags struct {
+	store *state.FlagStore
+
+	mu  sync.RWMutex
+	cfg config.FlagsConfig
+}
+
+func newFlags(cfg config.FlagsConfig, workspace string) *flags {
+	return &flags{store: state.NewFlagStore(workspace), cfg: cfg}
+}
+
+// setConfig replaces the flags of the config, for a reload.
+func (f *flags) setConfig(cfg config.FlagsConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cfg = cfg
+}
+
+// configured returns the value the config gives the flag called name.
+func (f *flags) configured(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	kind, arg, _ := strings.Cut(name, ":")
+	switch kind {
+	case "read_only":
+		return f.cfg.ReadOnly
+	case "proactive":
+		return !f.cfg.NoProactive
+	case "tool":
+		return !slices.Contains(f.cfg.DisabledTools, arg)
+	default: // "channel"
+		return !slices.Contains(f.cfg.PausedChannels, arg)
+	}
+}
+
+// on returns the value of the flag called name.
+func (f *flags) on(name string) bool {
+	if value, set := f.store.Get(name); set {
+		return value
+	}
+	return f.configured(name)
+}
+
+// toolBlocked returns why the tool called name may not be used, or "".
+func (f *flags) toolBlocked(name string) string {
+	if !f.on("tool:" + name) {
+		return fmt.Sprintf("The tool %s is disabled by the operator.", name)
+	}
+	if f.on("read_only") && !slices.Contains(readOnlyTools, name) {
+		return fmt.Sprintf("The tool %s is not available: the agent is in read-only mode.", name)
+	}
+	return ""
+}
+
+// filterTools leaves out the tools the model may not use.
+func (f *flags) filterTools(defs []providers.ToolDefinition) []providers.ToolDefinition {
+	return slices.DeleteFunc(defs, func(d providers.ToolDefinition) bool {
+		return f.toolBlocked(d.Function.Name) != ""
+	})
+}
+
+// channelPaused reports whether channel, or for an account such as
+// "telegram@work" its channel type, is paused.
+func (f *flags) channelPaused(channel string) bool {
+	channelType, _ := channels.SplitAccount(channel)
+	return !f.on("channel:"+channel) || !f.on("channel:"+channelType)
+}
+
+// ProactiveEnabled reports whether cron jobs and the heartbeat may run,
+// which the proactive flag turns off.
+func (al *AgentLoop) ProactiveEnabled() bool {
+	return al.flags.on("proactive")
+}
+
+// paused reports whether msg arrived on a paused channel and is not from
+// an admin chat, which is answered so the channel can be resumed.
+func (al *AgentLoop) paused(msg bus.InboundMessage) bool {
+	if !al.flags.channelPaused(msg.Channel) || al.isAdminChat(msg) {
+		return false
+	}
+	logger.DebugCF("agent", "Channel paused, not answering",
+		map[string]any{"channel": msg.Channel, "chat_id": msg.ChatID})
+	return true
+}
+
+// flagsCommand handles /flags in an admin chat:
+//
+//	/flags                 list the flags, see flagsReport
+//	/flags <flag> on|off   set a flag until /flags reset
+//	/flags reset           let all flags follow the config again
+//
+// Every change is recorded as a flag_changed run event.
+func (al *AgentLoop) flagsCommand(msg bus.InboundMessage, args []string) string {
+	who := msg.Channel + ":" + msg.SenderID
+	switch {
+	case len(args) == 0:
+		return al.flagsReport()
+	case len(args) == 1 && args[0] == "reset":
+		names, err := al.ResetFlags(who)
+		if err != nil {
+			return fmt.Sprintf("Failed to reset the flags: %v", err)
+		}
+		if len(names) == 0 {
+			return "No flags were set; they follow the config."
+		}
+		return "Reset " + strings.Join(names, ", ") + "; the flags follow the config again."
+	case len(args) != 2 || (args[1] != "on" && args[1] != "off"):
+		return "Usage: /flags [<flag> on|off | reset]\n" +
+			"Flags: read_only, proactive, tool:<name>, channel:<name>"
+	}
+
+	name := args[0]
+	if problem := al.flagProblem(name); problem != "" {
+		return problem
+	}
+	if err := al.SetFlag(who, name, args[1] == "on"); err != nil {
+		return fmt.Sprintf("Failed to set %s: %v", name, err)
+	}
+	return fmt.Sprintf("Set %s %s.", name, args[1])
+}
+
+// ErrInvalidFlag is returned by SetFlag for a name that is not a flag, or
+// not one of a tool or channel that exists.
+var ErrInvalidFlag = errors.New("invalid flag")
+
+// SetFlag sets the flag called name until the flags are reset, and
+// records who did as a flag_changed run event.
+func (al *AgentLoop) SetFlag(who, name string, on bool) error {
+	if problem := al.flagProblem(name); problem != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidFlag, problem)
+	}
+	if err := al.flags.store.Set(name, on); err != nil {
+		return err
+	}
+	al.recordFlagChange(who, name+" "+onOff(on))
+	return nil
+}
+
+// ResetFlags lets all flags follow the config again and returns the ones
+// that were set, sorted.
+func (al *AgentLoop) ResetFlags(who string) ([]string, error) {
+	reset, err := al.flags.store.Reset()
+	if err != nil || len(reset) == 0 {
+		return nil, err
+	}
+	names := slices.Sorted(maps.Keys(reset))
+	al.recordFlagChange(who, "reset "+strings.Join(names, ", "))
+	return names, nil
+}
+
+// flagProblem says why name is not a flag, or not one of a tool or
+// channel that exists, or returns "".
+func (al *AgentLoop) flagProblem(name string) string {
+	kind, arg, _ := strings.Cut(name, ":")
+	switch {
+	case name == "read_only" || name == "proactive":
+		return ""
+	case kind == "tool" && arg != "":
+		for _, id := range al.registry.ListAgentIDs() {
+			if a, ok := al.registry.GetAgent(id); ok {
+				if _, ok := a.Tools.Get(arg); ok {
+					return ""
+				}
+			}
+		}
+		return fmt.Sprintf("No agent has a tool called %s.", arg)
+	case kind == "channel" && arg != "":
+		if al.channelManager == nil {
+			return ""
+		}
+		if _, ok := al.channelManager.GetChannel(arg); ok {
+			return ""
+		}
+		for _, enabled := range al.channelManager.GetEnabledChannels() {
+			if channelType, _ := channels.SplitAccount(enabled); channelType == arg {
+				return ""
+			}
+		}
+		return fmt.Sprintf("The channel %s is not enabled.", arg)
+	}
+	return fmt.Sprintf("Unknown flag %q: use read_only, proactive, tool:<name> or channel:<name>.", name)
+}
+
+// Flag is the value of a kill switch and where it comes from: "config"
+// or "/flags", which covers flags set over the admin API too.
+type Flag struct {
+	Name   string `json:"name"`
+	On     bool   `json:"on"`
+	Source string `json:"source"`
+}
+
+// Flags lists read_only and proactive, and the tools and channels that
+// are turned off or were set at runtime.
+func (al *AgentLoop) Flags() []Flag {
+	al.flags.mu.RLock()
+	names := []string{"read_only", "proactive"}
+	for _, tool := range al.flags.cfg.DisabledTools {
+		names = append(names, "tool:"+tool)
+	}
+	for _, channel := range al.flags.cfg.PausedChannels {
+		names = append(names, "channel:"+channel)
+	}
+	al.flags.mu.RUnlock()
+	set := al.flags.store.All()
+	for name := range set {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names[2:])
+
+	flags := make([]Flag, 0, len(names))
+	for _, name := range names {
+		flag := Flag{Name: name, On: al.flags.on(name), Source: "config"}
+		if _, ok := set[name]; ok {
+			flag.Source = "/flags"
+		}
+		flags = append(flags, flag)
+	}
+	return flags
+}
+
+// flagsReport lists the flags for /flags, see Flags.
+func (al *AgentLoop) flagsReport() string {
+	var b strings.Builder
+	b.WriteString("Flags:")
+	for _, f := range al.Flags() {
+		fmt.Fprintf(&b, "\n- %s: %s (%s)", f.Name, onOff(f.On), f.Source)
+	}
+	return b.String()
+}
+
+func (al *AgentLoop) recordFlagChange(who, change string) {
+	logger.InfoCF("agent", "Flag changed", map[string]any{"by": who, "change": change})
+	al.Audit(state.AuditEntry{Action: "flag_changed", Actor: who, Outcome: "ok", Detail: change})
+	al.recordRunEvent(state.RunEvent{Kind: "flag_changed", Source: who, Message: change})
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
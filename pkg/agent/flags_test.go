@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestFlags(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cfg.Gateway.Admin.Chats = []string{"telegram:ops"}
+	cfg.Gateway.Admin.Senders = []string{"telegram:7"}
+	cfg.Gateway.Flags.DisabledTools = []string{"spawn"}
+
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &historyProvider{})
+	h := testHelper{al: al}
+	ctx := context.Background()
+	send := func(chatID, content string) string {
+		return h.executeAndGetResponse(t, ctx, bus.InboundMessage{
+			Channel: "telegram", SenderID: "7", ChatID: chatID, Content: content,
+		})
+	}
+
+	if got := send("elsewhere", "/flags read_only on"); got != "/flags is only available in the admin chat" {
+		t.Errorf("/flags from another chat = %q", got)
+	}
+	if got := send("ops", "/flags"); got != "Flags:\n- read_only: off (config)\n- proactive: on (config)\n- tool:spawn: off (config)" {
+		t.Errorf("/flags = %q", got)
+	}
+	if reason := al.flags.toolBlocked("spawn"); reason != "The tool spawn is disabled by the operator." {
+		t.Errorf("spawn blocked for %q", reason)
+	}
+
+	for _, tt := range []struct{ command, want string }{
+		{"/flags tool:nope off", "No agent has a tool called nope."},
+		{"/flags writes off", `Unknown flag "writes": use read_only, proactive, tool:<name> or channel:<name>.`},
+		{"/flags read_only maybe", "Usage: /flags [<flag> on|off | reset]\nFlags: read_only, proactive, tool:<name>, channel:<name>"},
+		{"/flags read_only on", "Set read_only on."},
+		{"/flags proactive off", "Set proactive off."},
+		{"/flags tool:spawn on", "Set tool:spawn on."},
+		{"/flags channel:discord off", "Set channel:discord off."},
+	} {
+		if got := send("ops", tt.command); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+
+	if al.ProactiveEnabled() {
+		t.Error("proactive runs are still on")
+	}
+	if reason := al.flags.toolBlocked("spawn"); !strings.Contains(reason, "read-only mode") {
+		t.Errorf("spawn in read-only mode blocked for %q", reason)
+	}
+	if reason := al.flags.toolBlocked("read_file"); reason != "" {
+		t.Errorf("read_file in read-only mode blocked for %q", reason)
+	}
+	defs := al.flags.filterTools([]providers.ToolDefinition{
+		{Function: providers.ToolFunctionDefinition{Name: "exec"}},
+		{Function: providers.ToolFunctionDefinition{Name: "web_fetch"}},
+	})
+	if len(defs) != 1 || defs[0].Function.Name != "web_fetch" {
+		t.Errorf("tools in read-only mode = %v", defs)
+	}
+	if !al.paused(bus.InboundMessage{Channel: "discord@work", ChatID: "1"}) ||
+		al.paused(bus.InboundMessage{Channel: "telegram", ChatID: "1"}) {
+		t.Error("discord is not the paused channel")
+	}
+
+	// A reload changes what the config says, not what /flags set.
+	next := *cfg
+	next.Gateway.Flags = config.FlagsConfig{PausedChannels: []string{"telegram"}}
+	al.ReloadConfig(&next)
+	if !al.paused(bus.InboundMessage{Channel: "telegram", ChatID: "1"}) ||
+		al.paused(bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "ops"}) {
+		t.Error("telegram is not paused outside the admin chat")
+	}
+	if reason := al.flags.toolBlocked("spawn"); !strings.Contains(reason, "read-only mode") {
+		t.Errorf("read_only did not survive the reload: %q", reason)
+	}
+
+	// Flags set at runtime outlive a restart until they are reset.
+	restarted := newTestLoop(t, cfg, bus.NewMessageBus(), &historyProvider{})
+	if restarted.ProactiveEnabled() {
+		t.Error("proactive flag lost on restart")
+	}
+	if got := send("ops", "/flags reset"); got !=
+		"Reset channel:discord, proactive, read_only, tool:spawn; the flags follow the config again." {
+		t.Errorf("/flags reset = %q", got)
+	}
+	if !al.ProactiveEnabled() {
+		t.Error("proactive runs are still off after the reset")
+	}
+
+	events, err := al.runEvents.Recent(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []string
+	for _, ev := range events {
+		if ev.Kind == "flag_changed" && ev.Source == "telegram:7" {
+			changes = append(changes, ev.Message)
+		}
+	}
+	want := "read_only on|proactive off|tool:spawn on|channel:discord off|reset channel:discord, proactive, read_only, tool:spawn"
+	if got := strings.Join(changes, "|"); got != want {
+		t.Errorf("recorded changes %q, want %q", got, want)
+	}
+}
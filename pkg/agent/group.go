@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// maxListedParticipants caps the participants named in the prompt of busy
+// groups; the most recent speakers are kept.
+const maxListedParticipants = 20
+
+// speakerNameKeys are the metadata keys channels put the sender's name in,
+// best first.
+var speakerNameKeys = []string{"display_name", "sender_name", "user_name", "nickname", "first_name", "username"}
+
+// isGroupChat reports whether msg comes from a chat with several people.
+func isGroupChat(msg bus.InboundMessage) bool {
+	switch msg.Metadata["peer_kind"] {
+	case "group", "channel":
+		return true
+	}
+	return false
+}
+
+// speakerID returns the stable part of a sender ID. Telegram appends
+// "|username", which changes when the user renames themselves.
+func speakerID(senderID string) string {
+	id, _, _ := strings.Cut(senderID, "|")
+	return id
+}
+
+// speakerName returns the name the sender of msg goes by, or their ID.
+func speakerName(msg bus.InboundMessage) string {
+	for _, key := range speakerNameKeys {
+		if name := strings.TrimSpace(msg.Metadata[key]); name != "" {
+			return name
+		}
+	}
+	return speakerID(msg.SenderID)
+}
+
+// batchSpeakers returns the "id\tname" lines mergeBatch records for a batch
+// with several senders.
+func batchSpeakers(msg bus.InboundMessage) [][2]string {
+	var speakers [][2]string
+	for _, line := range strings.Split(msg.Metadata["batch_speakers"], "\n") {
+		if id, name, ok := strings.Cut(line, "\t"); ok {
+			speakers = append(speakers, [2]string{id, name})
+		}
+	}
+	return speakers
+}
+
+// joinGroupTurn records who spoke in a group session and returns the user
+// message with each line attributed to its speaker, so the history keeps
+// track of who said what. Batches with several senders come attributed.
+func joinGroupTurn(sessions *session.SessionManager, sessionKey string, msg bus.InboundMessage, content string) string {
+	if speakers := batchSpeakers(msg); len(speakers) > 0 {
+		for _, s := range speakers {
+			sessions.AddParticipant(sessionKey, s[0], s[1])
+		}
+		return content
+	}
+	name := speakerName(msg)
+	sessions.AddParticipant(sessionKey, speakerID(msg.SenderID), name)
+	return name + ": " + content
+}
+
+// groupNotes describes a group session to the model: who takes part, who
+// is speaking now and what the agent remembers about them.
+func groupNotes(memory *MemoryStore, participants []session.Participant, msg bus.InboundMessage) string {
+	channelType, _ := channels.SplitAccount(msg.Channel)
+	id := speakerID(msg.SenderID)
+
+	var sb strings.Builder
+	sb.WriteString("\n\n## Group Chat\n")
+	sb.WriteString("Several people talk in this chat. Each user message starts with the name of the person who wrote it. ")
+	sb.WriteString("Keep track of who said what, and answer the current speaker unless they ask you to address someone else.\n")
+
+	if len(participants) > 0 {
+		sb.WriteString("\nParticipants, most recent first:\n")
+		now := time.Now()
+		for i, p := range participants {
+			if i == maxListedParticipants {
+				fmt.Fprintf(&sb, "- and %d more\n", len(participants)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "- %s (id %s), %d messages, last %s\n",
+				p.Name, p.ID, p.Messages, sinceText(now.Sub(p.LastSeen)))
+		}
+	}
+
+	fmt.Fprintf(&sb, "\nCurrent speaker: %s (id %s)\n", speakerName(msg), id)
+	if memory != nil {
+		fmt.Fprintf(&sb, "\nNotes about individual people belong in their own file, not MEMORY.md. "+
+			"The current speaker's file is %s.", memory.PersonFile(channelType, id))
+		if notes := strings.TrimSpace(memory.ReadPerson(channelType, id)); notes != "" {
+			sb.WriteString(" It says:\n\n")
+			sb.WriteString(notes)
+		}
+	}
+	return sb.String()
+}
+
+func sinceText(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d h ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+}
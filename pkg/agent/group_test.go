@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func TestGroupTurnAttribution(t *testing.T) {
+	sessions := session.NewSessionManager("")
+	key := "agent:main:telegram:group:-100"
+
+	alice := groupMessage("-100", "42|alice", "who's in for lunch?")
+	alice.Channel = "telegram"
+	alice.Metadata["first_name"] = "Alice"
+	if got := joinGroupTurn(sessions, key, alice, alice.Content); got != "Alice: who's in for lunch?" {
+		t.Errorf("attributed = %q", got)
+	}
+
+	bob := groupMessage("-100", "7", "me")
+	carol := groupMessage("-100", "9", "me too")
+	carol.Metadata["display_name"] = "Carol"
+	batch := mergeBatch([]bus.InboundMessage{bob, carol})
+	if batch.Content != "7: me\nCarol: me too" {
+		t.Errorf("batch content = %q", batch.Content)
+	}
+	if got := joinGroupTurn(sessions, key, batch, batch.Content); got != batch.Content {
+		t.Errorf("batch was attributed twice: %q", got)
+	}
+	if _, ok := carol.Metadata["batch_speakers"]; ok {
+		t.Error("mergeBatch changed the metadata of a batched message")
+	}
+
+	participants := sessions.Participants(key)
+	if len(participants) != 3 || participants[0].Name != "Carol" || participants[2].ID != "42" {
+		t.Errorf("participants = %+v", participants)
+	}
+}
+
+func TestGroupNotes(t *testing.T) {
+	workspace := t.TempDir()
+	memory := NewMemoryStore(workspace)
+	sessions := session.NewSessionManager("")
+	key := "agent:main:discord:channel:c1"
+
+	msg := groupMessage("c1", "u1", "remember that I'm vegetarian")
+	msg.Channel = "discord"
+	msg.Metadata["display_name"] = "Dana"
+	joinGroupTurn(sessions, key, msg, msg.Content)
+
+	personFile := memory.PersonFile("discord", "u1")
+	if filepath.Dir(personFile) != filepath.Join(workspace, "memory", "people") {
+		t.Fatalf("person file = %s", personFile)
+	}
+	os.MkdirAll(filepath.Dir(personFile), 0o755)
+	os.WriteFile(personFile, []byte("- vegetarian\n"), 0o644)
+
+	notes := groupNotes(memory, sessions.Participants(key), msg)
+	for _, want := range []string{"## Group Chat", "- Dana (id u1), 1 messages, last just now", "Current speaker: Dana (id u1)", personFile, "- vegetarian"} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("notes lack %q:\n%s", want, notes)
+		}
+	}
+
+	if got := memory.PersonFile("telegram@work", "../../etc/passwd"); filepath.Dir(got) != filepath.Dir(personFile) {
+		t.Errorf("user ID escaped the people directory: %s", got)
+	}
+}
@@ -1,11 +1,14 @@
 package agent
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
@@ -15,37 +18,48 @@ import (
 // AgentInstance represents a fully configured agent with its own workspace,
 // session manager, context builder, and tool registry.
 type AgentInstance struct {
-	ID             string
-	Name           string
-	Model          string
-	Fallbacks      []string
-	Workspace      string
-	MaxIterations  int
-	MaxTokens      int
-	Temperature    float64
-	ContextWindow  int
-	Provider       providers.LLMProvider
-	Sessions       *session.SessionManager
-	ContextBuilder *ContextBuilder
-	Tools          *tools.ToolRegistry
-	Subagents      *config.SubagentsConfig
-	SkillsFilter   []string
-	Candidates     []providers.FallbackCandidate
+	ID            string
+	Name          string
+	Model         string
+	Fallbacks     []string
+	Workspace     string
+	MaxIterations int
+	MaxTokens     int
+	Temperature   float64
+	// ReasoningEffort is passed to models that think before answering,
+	// empty for the provider's default.
+	ReasoningEffort string
+	ContextWindow   int                    // tokens of prompt and answer the model takes
+	ContextStrategy string                 // what to evict first when the prompt is too long, see config.ContextStrategies
+	OverflowModel   string                 // model_list name or vendor/model to use when a prompt overflows even so
+	KeepReasoning   bool                   // store reasoning in the session history, not just the answers
+	Critique        *config.CritiqueConfig // second model that reviews answers, nil for none
+	Provider        providers.LLMProvider
+	Sessions        *session.SessionManager
+	ContextBuilder  *ContextBuilder
+	Tools           *tools.ToolRegistry
+	Subagents       *config.SubagentsConfig
+	SkillsFilter    []string
+	Candidates      []providers.FallbackCandidate
+	// Routes holds the providers of candidates that name a model_list
+	// entry, keyed by providers.ModelKey. Other candidates use Provider.
+	Routes     map[string]providers.LLMProvider
+	LLMTimeout time.Duration           // per LLM request, 0 = none
+	Generation config.GenerationParams // top_p, stop sequences, penalties, seed and logit bias
 }
 
-// NewAgentInstance creates an agent instance from config.
+// NewAgentInstance creates an agent instance from config. It fails when
+// the session store cannot be opened: answering without history would
+// lose every conversation at the next restart.
 func NewAgentInstance(
 	agentCfg *config.AgentConfig,
 	defaults *config.AgentDefaults,
 	cfg *config.Config,
 	provider providers.LLMProvider,
-) *AgentInstance {
+) (*AgentInstance, error) {
 	workspace := resolveAgentWorkspace(agentCfg, defaults)
 	os.MkdirAll(workspace, 0o755)
 
-	model := resolveAgentModel(agentCfg, defaults)
-	fallbacks := resolveAgentFallbacks(agentCfg, defaults)
-
 	restrict := defaults.RestrictToWorkspace
 	toolsRegistry := tools.NewToolRegistry()
 	toolsRegistry.Register(tools.NewReadFileTool(workspace, restrict))
@@ -55,19 +69,49 @@ func NewAgentInstance(
 	toolsRegistry.Register(tools.NewEditFileTool(workspace, restrict))
 	toolsRegistry.Register(tools.NewAppendFileTool(workspace, restrict))
 
-	sessionsDir := filepath.Join(workspace, "sessions")
-	sessionsManager := session.NewSessionManager(sessionsDir)
-
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
 
 	agentID := routing.DefaultAgentID
+	if agentCfg != nil {
+		agentID = routing.NormalizeAgentID(agentCfg.ID)
+	}
+
+	sessionsDir := filepath.Join(workspace, "sessions")
+	sessionsManager, err := session.Open(cfg.Session.Store, sessionsDir, agentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: failed to open the %s session store: %w", agentID, session.Backend(cfg.Session.Store), err)
+	}
+
+	agent := &AgentInstance{
+		ID:             agentID,
+		Workspace:      workspace,
+		Sessions:       sessionsManager,
+		ContextBuilder: contextBuilder,
+		Tools:          toolsRegistry,
+	}
+	agent.configure(agentCfg, defaults, cfg, provider)
+	return agent, nil
+}
+
+// configure sets what the agent takes from its config besides its ID,
+// workspace, sessions and tools: its model and provider, sampling settings,
+// limits and subagents. provider is the default one, for agents without a
+// model of their own.
+func (a *AgentInstance) configure(
+	agentCfg *config.AgentConfig,
+	defaults *config.AgentDefaults,
+	cfg *config.Config,
+	provider providers.LLMProvider,
+) {
+	modelName := resolveAgentModel(agentCfg, defaults)
+	provider, model := resolveAgentProvider(agentCfg, cfg, provider, modelName)
+	fallbacks := resolveAgentFallbacks(agentCfg, defaults)
+
 	agentName := ""
 	var subagents *config.SubagentsConfig
 	var skillsFilter []string
-
 	if agentCfg != nil {
-		agentID = routing.NormalizeAgentID(agentCfg.ID)
 		agentName = agentCfg.Name
 		subagents = agentCfg.Subagents
 		skillsFilter = agentCfg.Skills
@@ -79,6 +123,9 @@ func NewAgentInstance(
 	}
 
 	maxTokens := defaults.MaxTokens
+	if agentCfg != nil && agentCfg.MaxTokens > 0 {
+		maxTokens = agentCfg.MaxTokens
+	}
 	if maxTokens == 0 {
 		maxTokens = 8192
 	}
@@ -87,32 +134,58 @@ func NewAgentInstance(
 	if defaults.Temperature != nil {
 		temperature = *defaults.Temperature
 	}
+	if agentCfg != nil && agentCfg.Temperature != nil {
+		temperature = *agentCfg.Temperature
+	}
+
+	reasoningEffort := defaults.ReasoningEffort
+	defaultProvider := defaults.Provider
+	critique := defaults.Critique
+	generation := defaults.GenerationParams
+	if agentCfg != nil {
+		generation = generation.Merge(agentCfg.GenerationParams)
+		if agentCfg.Critique != nil {
+			critique = agentCfg.Critique
+		}
+		if agentCfg.ReasoningEffort != "" {
+			reasoningEffort = agentCfg.ReasoningEffort
+		}
+		if agentCfg.Provider != "" {
+			defaultProvider = agentCfg.Provider
+		}
+	}
+
+	// An agent turns off the default critique with an empty model.
+	if critique != nil && strings.TrimSpace(critique.Model) == "" {
+		critique = nil
+	}
 
 	// Resolve fallback candidates
 	modelCfg := providers.ModelConfig{
 		Primary:   model,
 		Fallbacks: fallbacks,
 	}
-	candidates := providers.ResolveCandidates(modelCfg, defaults.Provider)
+	candidates, routes := providers.ResolveRoutes(cfg, modelCfg, defaultProvider)
 
-	return &AgentInstance{
-		ID:             agentID,
-		Name:           agentName,
-		Model:          model,
-		Fallbacks:      fallbacks,
-		Workspace:      workspace,
-		MaxIterations:  maxIter,
-		MaxTokens:      maxTokens,
-		Temperature:    temperature,
-		ContextWindow:  maxTokens,
-		Provider:       provider,
-		Sessions:       sessionsManager,
-		ContextBuilder: contextBuilder,
-		Tools:          toolsRegistry,
-		Subagents:      subagents,
-		SkillsFilter:   skillsFilter,
-		Candidates:     candidates,
-	}
+	a.Name = agentName
+	a.Model = model
+	a.Fallbacks = fallbacks
+	a.MaxIterations = maxIter
+	a.MaxTokens = maxTokens
+	a.Temperature = temperature
+	a.ReasoningEffort = reasoningEffort
+	a.Generation = generation
+	a.ContextWindow = resolveContextWindow(defaults, findModelEntry(cfg, modelName, model), model)
+	a.ContextStrategy = defaults.ContextStrategy
+	a.OverflowModel = defaults.OverflowModel
+	a.KeepReasoning = defaults.KeepReasoning
+	a.Critique = critique
+	a.Provider = provider
+	a.Subagents = subagents
+	a.SkillsFilter = skillsFilter
+	a.Candidates = candidates
+	a.Routes = routes
+	a.LLMTimeout = time.Duration(defaults.LLMTimeoutSeconds) * time.Second
 }
 
 // resolveAgentWorkspace determines the workspace directory for an agent.
@@ -128,6 +201,20 @@ func resolveAgentWorkspace(agentCfg *config.AgentConfig, defaults *config.AgentD
 	return filepath.Join(home, ".picoclaw", "workspace-"+id)
 }
 
+// Workspaces returns the workspace of every agent cfg defines, by agent
+// ID, without creating the agents.
+func Workspaces(cfg *config.Config) map[string]string {
+	if len(cfg.Agents.List) == 0 {
+		return map[string]string{"main": resolveAgentWorkspace(nil, &cfg.Agents.Defaults)}
+	}
+	workspaces := make(map[string]string, len(cfg.Agents.List))
+	for i := range cfg.Agents.List {
+		ac := &cfg.Agents.List[i]
+		workspaces[routing.NormalizeAgentID(ac.ID)] = resolveAgentWorkspace(ac, &cfg.Agents.Defaults)
+	}
+	return workspaces
+}
+
 // resolveAgentModel resolves the primary model for an agent.
 func resolveAgentModel(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) string {
 	if agentCfg != nil && agentCfg.Model != nil && strings.TrimSpace(agentCfg.Model.Primary) != "" {
@@ -136,6 +223,42 @@ func resolveAgentModel(agentCfg *config.AgentConfig, defaults *config.AgentDefau
 	return defaults.GetModelName()
 }
 
+// resolveAgentProvider gives an agent with a model of its own from
+// model_list, or with a model at a provider of its own, a provider for
+// that model, so agents can use different APIs, e.g. Anthropic natively
+// for one persona and a local model for another. Other agents share the
+// default provider. It returns the provider and the
+// model ID to request.
+func resolveAgentProvider(
+	agentCfg *config.AgentConfig,
+	cfg *config.Config,
+	provider providers.LLMProvider,
+	model string,
+) (providers.LLMProvider, string) {
+	if agentCfg == nil || agentCfg.Model == nil || strings.TrimSpace(agentCfg.Model.Primary) == "" || cfg == nil {
+		return provider, model
+	}
+	modelCfg, err := cfg.GetModelConfig(model)
+	if err != nil {
+		vendorCfg, ok := cfg.VendorModelConfig(agentCfg.Provider, model)
+		if agentCfg.Provider == "" || !ok {
+			return provider, model
+		}
+		modelCfg = vendorCfg
+	}
+	entry := *modelCfg
+	if entry.Workspace == "" {
+		entry.Workspace = cfg.WorkspacePath()
+	}
+	own, modelID, err := providers.CreateProviderFromConfig(&entry)
+	if err != nil {
+		logger.WarnCF("agent", "Using the default provider for agent",
+			map[string]any{"agent_id": agentCfg.ID, "model": model, "error": err.Error()})
+		return provider, model
+	}
+	return own, modelID
+}
+
 // resolveAgentFallbacks resolves the fallback models for an agent.
 func resolveAgentFallbacks(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) []string {
 	if agentCfg != nil && agentCfg.Model != nil && agentCfg.Model.Fallbacks != nil {
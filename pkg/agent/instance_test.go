@@ -2,9 +2,13 @@ package agent
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 func TestNewAgentInstance_UsesDefaultsTemperatureAndMaxTokens(t *testing.T) {
@@ -29,7 +33,7 @@ func TestNewAgentInstance_UsesDefaultsTemperatureAndMaxTokens(t *testing.T) {
 	cfg.Agents.Defaults.Temperature = &configuredTemp
 
 	provider := &mockProvider{}
-	agent := NewAgentInstance(nil, &cfg.Agents.Defaults, cfg, provider)
+	agent := newTestInstance(t, nil, &cfg.Agents.Defaults, cfg, provider)
 
 	if agent.MaxTokens != 1234 {
 		t.Fatalf("MaxTokens = %d, want %d", agent.MaxTokens, 1234)
@@ -61,7 +65,7 @@ func TestNewAgentInstance_DefaultsTemperatureWhenZero(t *testing.T) {
 	cfg.Agents.Defaults.Temperature = &configuredTemp
 
 	provider := &mockProvider{}
-	agent := NewAgentInstance(nil, &cfg.Agents.Defaults, cfg, provider)
+	agent := newTestInstance(t, nil, &cfg.Agents.Defaults, cfg, provider)
 
 	if agent.Temperature != 0.0 {
 		t.Fatalf("Temperature = %f, want %f", agent.Temperature, 0.0)
@@ -87,9 +91,129 @@ func TestNewAgentInstance_DefaultsTemperatureWhenUnset(t *testing.T) {
 	}
 
 	provider := &mockProvider{}
-	agent := NewAgentInstance(nil, &cfg.Agents.Defaults, cfg, provider)
+	agent := newTestInstance(t, nil, &cfg.Agents.Defaults, cfg, provider)
 
 	if agent.Temperature != 0.7 {
 		t.Fatalf("Temperature = %f, want %f", agent.Temperature, 0.7)
 	}
 }
+
+func TestNewAgentInstance_OwnModelGetsOwnProvider(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: tmpDir, Model: "test-model"},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "claude", Model: "anthropic/claude-sonnet-4.6", APIKey: "sk-ant-test"},
+		},
+	}
+	shared := &mockProvider{}
+
+	persona := newTestInstance(t, &config.AgentConfig{
+		ID:    "writer",
+		Model: &config.AgentModelConfig{Primary: "claude"},
+	}, &cfg.Agents.Defaults, cfg, shared)
+	if _, ok := persona.Provider.(*providers.ClaudeProvider); !ok || persona.Model != "claude-sonnet-4.6" {
+		t.Errorf("persona provider = %T, model = %q", persona.Provider, persona.Model)
+	}
+
+	main := newTestInstance(t, &config.AgentConfig{ID: "main"}, &cfg.Agents.Defaults, cfg, shared)
+	if main.Provider != shared {
+		t.Errorf("agent without a model of its own got %T", main.Provider)
+	}
+}
+
+func TestNewAgentInstance_PersonaOverrides(t *testing.T) {
+	defaultTemp := 0.7
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:       t.TempDir(),
+				Model:           "test-model",
+				MaxTokens:       8192,
+				Temperature:     &defaultTemp,
+				ReasoningEffort: "medium",
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "local", Model: "ollama/llama3.2"},
+		},
+	}
+	temp := 0.1
+
+	persona := newTestInstance(t, &config.AgentConfig{
+		ID:              "coder",
+		Provider:        "ollama",
+		Model:           &config.AgentModelConfig{Primary: "qwen2.5-coder"},
+		Temperature:     &temp,
+		MaxTokens:       2048,
+		ReasoningEffort: "high",
+	}, &cfg.Agents.Defaults, cfg, &mockProvider{})
+
+	if _, ok := persona.Provider.(*providers.OllamaProvider); !ok || persona.Model != "qwen2.5-coder" {
+		t.Errorf("provider = %T, model = %q", persona.Provider, persona.Model)
+	}
+	opts := persona.llmOptions()
+	if opts["temperature"] != 0.1 || opts["max_tokens"] != 2048 || opts["reasoning_effort"] != "high" {
+		t.Errorf("options = %v", opts)
+	}
+
+	main := newTestInstance(t, &config.AgentConfig{ID: "main"}, &cfg.Agents.Defaults, cfg, &mockProvider{})
+	if opts := main.llmOptions(); opts["temperature"] != 0.7 || opts["reasoning_effort"] != "medium" {
+		t.Errorf("defaults = %v", opts)
+	}
+}
+
+func TestNewAgentInstance_MergesGenerationParams(t *testing.T) {
+	topP, seed, penalty := 0.9, 42, 0.5
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace: t.TempDir(),
+				Model:     "test-model",
+				GenerationParams: config.GenerationParams{
+					TopP: &topP,
+					Seed: &seed,
+					Stop: []string{"\n\nUser:"},
+				},
+			},
+		},
+	}
+	agent := newTestInstance(t, &config.AgentConfig{
+		ID: "writer",
+		GenerationParams: config.GenerationParams{
+			PresencePenalty: &penalty,
+			Stop:            []string{"THE END"},
+		},
+	}, &cfg.Agents.Defaults, cfg, &mockProvider{})
+
+	opts := agent.llmOptions()
+	if opts["top_p"] != 0.9 || opts["seed"] != 42 || opts["presence_penalty"] != 0.5 {
+		t.Errorf("options = %v", opts)
+	}
+	if stop, _ := opts["stop"].([]string); len(stop) != 1 || stop[0] != "THE END" {
+		t.Errorf("stop = %v", opts["stop"])
+	}
+	for _, unset := range []string{"frequency_penalty", "logit_bias"} {
+		if _, ok := opts[unset]; ok {
+			t.Errorf("%s sent without being set", unset)
+		}
+	}
+}
+
+func TestNewAgentLoop_FailsWithoutSessionStore(t *testing.T) {
+	workspace := t.TempDir()
+	// The store's directory cannot be created where a file is.
+	if err := os.WriteFile(filepath.Join(workspace, "sessions"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Session.Store.Backend = "sqlite"
+
+	_, err := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	if err == nil || !strings.Contains(err.Error(), "session store") {
+		t.Errorf("NewAgentLoop with a broken session store = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// handleJobsCommand tells how the scheduled jobs of a chat ran:
+//
+//	/jobs        every job posting here, with its last status and next run
+//	/jobs <id>   the latest runs of a job, with their task IDs and cost
+//
+// The admin chat sees the jobs of every chat.
+func (al *AgentLoop) handleJobsCommand(msg bus.InboundMessage, args []string) string {
+	if al.cronService == nil {
+		return al.t(msg, "Scheduled jobs are only available in the gateway.")
+	}
+	loc := al.senderLocation(msg)
+	switch len(args) {
+	case 0:
+		return al.listJobs(msg, loc)
+	case 1:
+		job, ok := al.scheduledJob(msg, args[0])
+		if !ok {
+			return al.t(msg, "There is no job %s in this chat.", args[0])
+		}
+		return al.jobHistory(msg, job, loc)
+	default:
+		return al.t(msg, "Usage: /jobs [<id>]")
+	}
+}
+
+// listJobs lists the jobs of the chat of msg, or of every chat for the
+// admin, with how they last ran.
+func (al *AgentLoop) listJobs(msg bus.InboundMessage, loc *time.Location) string {
+	admin := al.isAdminChat(msg)
+	var lines []string
+	for _, job := range al.cronService.ListJobs(true) {
+		if !admin && !inScheduleChat(job, msg) {
+			continue
+		}
+		line := "- " + job.ID + ": " + job.Name + " — "
+		if run, ok := job.LastRun(); !ok {
+			line += al.t(msg, "not run yet")
+		} else if run.Status == "ok" {
+			line += "✅ " + formatRun(time.UnixMilli(run.StartedAtMS), loc)
+		} else {
+			line += "❌ " + formatRun(time.UnixMilli(run.StartedAtMS), loc)
+			if n := job.State.ConsecutiveFailures; n > 1 {
+				line += " " + al.t(msg, "(%d failures in a row)", n)
+			}
+		}
+		if job.Enabled && job.State.NextRunAtMS != nil {
+			line += ", " + al.t(msg, "next %s", formatRun(time.UnixMilli(*job.State.NextRunAtMS), loc))
+		} else {
+			line += ", " + al.t(msg, "paused")
+		}
+		if admin && !inScheduleChat(job, msg) && job.Payload.Channel != "" {
+			line += fmt.Sprintf(" (%s:%s)", job.Payload.Channel, job.Payload.To)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return al.t(msg, "Nothing is scheduled in this chat. Ask me to remind you of something, or try /schedule preview every weekday at 8.")
+	}
+	return al.t(msg, "Scheduled jobs:") + "\n" + strings.Join(lines, "\n")
+}
+
+// jobHistory lists the latest runs of job, newest first, with what their
+// LLM requests cost.
+func (al *AgentLoop) jobHistory(msg bus.InboundMessage, job cron.CronJob, loc *time.Location) string {
+	history := slices.Clone(job.State.History)
+	if len(history) == 0 {
+		return al.t(msg, "%s has not run yet.", job.Name)
+	}
+	slices.Reverse(history)
+	costs := al.taskCosts(time.UnixMilli(history[len(history)-1].StartedAtMS))
+
+	var b strings.Builder
+	b.WriteString(al.t(msg, "Latest runs of %s:", job.Name))
+	for _, run := range history {
+		status := "✅"
+		if run.Status != "ok" {
+			status = "❌"
+		}
+		duration := (time.Duration(run.DurationMS) * time.Millisecond).Round(100 * time.Millisecond)
+		fmt.Fprintf(&b, "\n%s %s, %s, task %s", status, formatRun(time.UnixMilli(run.StartedAtMS), loc), duration, run.TaskID)
+		if cost, ok := costs[run.TaskID]; ok {
+			fmt.Fprintf(&b, ", $%.4f", cost)
+		}
+		if run.Late {
+			b.WriteString(", " + al.t(msg, "late"))
+		}
+		if run.Error != "" {
+			b.WriteString("\n   " + run.Error)
+		}
+	}
+	return b.String()
+}
+
+// taskCosts sums up the cost of the LLM requests made for scheduled runs
+// since the given time, by task ID.
+func (al *AgentLoop) taskCosts(since time.Time) map[string]float64 {
+	costs := make(map[string]float64)
+	if al.llmEvents == nil {
+		return costs
+	}
+	events, err := al.llmEvents.Since(since)
+	if err != nil {
+		return costs
+	}
+	for _, ev := range events {
+		if ev.TaskID != "" {
+			costs[ev.TaskID] += ev.CostUSD
+		}
+	}
+	return costs
+}
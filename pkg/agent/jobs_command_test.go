@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestJobsCommand(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: workspace, Model: "test-model", MaxTokens: 4096, MaxToolIterations: 10},
+		},
+		Gateway: config.GatewayConfig{Admin: config.AdminConfig{Chats: []string{"telegram:admin"}, Senders: []string{"telegram:1"}}},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &simpleMockProvider{response: "ok"})
+	cs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	al.SetCronService(cs)
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "chat1"}
+	admin := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "admin"}
+
+	every := int64(3600000)
+	report, _ := cs.AddJob("report", cron.CronSchedule{Kind: "every", EveryMS: &every}, "report", false, "telegram", "chat1")
+	cs.AddJob("elsewhere", cron.CronSchedule{Kind: "every", EveryMS: &every}, "elsewhere", true, "telegram", "chat2")
+	start := time.Now().Add(-time.Hour).UnixMilli()
+	report.State.History = []cron.RunRecord{
+		{TaskID: "aaaa1111", StartedAtMS: start, DurationMS: 1200, Status: "ok"},
+		{TaskID: "bbbb2222", StartedAtMS: start + 1000, DurationMS: 300, Status: "error", Error: "LLM call failed", Late: true},
+		{TaskID: "cccc3333", StartedAtMS: start + 2000, DurationMS: 300, Status: "error", Error: "LLM call failed"},
+	}
+	report.State.ConsecutiveFailures = 2
+	cs.UpdateJob(report)
+	al.recordLLMEvent(state.LLMEvent{Time: time.UnixMilli(start + 10), AgentID: "main", Model: "m", CostUSD: 0.0123, TaskID: "aaaa1111"})
+
+	got := al.handleJobsCommand(msg, nil)
+	if !strings.Contains(got, "report — ❌") || !strings.Contains(got, "(2 failures in a row)") || strings.Contains(got, "elsewhere") {
+		t.Errorf("/jobs got %q", got)
+	}
+	if got := al.handleJobsCommand(admin, nil); !strings.Contains(got, "elsewhere — not run yet") {
+		t.Errorf("/jobs in the admin chat got %q", got)
+	}
+
+	got = al.handleJobsCommand(msg, []string{report.ID})
+	lines := strings.Split(got, "\n")
+	if len(lines) != 6 || !strings.Contains(lines[1], "task cccc3333") || !strings.Contains(lines[3], "late") {
+		t.Errorf("/jobs <id> got %q", got)
+	}
+	if !strings.Contains(got, "task aaaa1111, $0.0123") {
+		t.Errorf("the cost of the run is missing: %q", got)
+	}
+	if got := al.handleJobsCommand(msg, []string{"nope"}); !strings.Contains(got, "no job nope") {
+		t.Errorf("unknown job got %q", got)
+	}
+}
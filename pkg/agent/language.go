@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// language returns the language picoclaw speaks to the sender of msg in:
+// the locale of their profile, or else the chat's, see chatLanguage.
+func (al *AgentLoop) language(msg bus.InboundMessage) string {
+	if id := profileID(msg); id != "" {
+		if lang := i18n.Lang(al.profiles.Get(id).Locale); lang != "" {
+			return lang
+		}
+	}
+	return al.chatLanguage(msg.Channel, msg.ChatID)
+}
+
+// chatLanguage returns the language gateway.language sets for a chat,
+// English by default.
+func (al *AgentLoop) chatLanguage(channel, chatID string) string {
+	cfg := al.cfg.Gateway.Language
+	if lang := i18n.Lang(cfg.Chats[channel+":"+chatID]); lang != "" {
+		return lang
+	}
+	if lang := i18n.Lang(cfg.Default); lang != "" {
+		return lang
+	}
+	return "en"
+}
+
+// t translates text for the sender of msg, see i18n.T.
+func (al *AgentLoop) t(msg bus.InboundMessage, text string, args ...any) string {
+	return i18n.T(al.language(msg), text, args...)
+}
+
+// adminOnly is the reply to an admin command sent from another chat.
+func (al *AgentLoop) adminOnly(msg bus.InboundMessage, command string) string {
+	al.Audit(state.AuditEntry{Action: "command", Actor: auditActor(msg), Target: command, Outcome: "denied"})
+	return al.t(msg, "%s is only available in the admin chat", command)
+}
+
+// handleLanguageCommand handles /language, which shows the language
+// picoclaw answers commands in, sets it for the sender, or with
+// "default" goes back to the chat's.
+func (al *AgentLoop) handleLanguageCommand(msg bus.InboundMessage, args []string) string {
+	usage := al.t(msg, "Usage: /language [%s|default]", strings.Join(i18n.Languages, "|"))
+	if len(args) == 0 {
+		return al.t(msg, "Commands are answered in English.") + "\n" + usage
+	}
+	id := profileID(msg)
+	if id == "" {
+		return al.t(msg, "Profiles need to know who is writing, which this channel does not say.")
+	}
+	lang := i18n.Lang(args[0])
+	if len(args) > 1 || (lang == "" && args[0] != "default") {
+		return usage
+	}
+	// An English locale is kept too: it wins over a chat set to another
+	// language. "default" clears the locale.
+	if _, err := al.profiles.Update(id, func(p *state.Profile) { p.Locale = lang }); err != nil {
+		return al.t(msg, "Failed to save your profile: %v", err)
+	}
+	return al.t(msg, "Commands are answered in English.")
+}
+
+// helpText is the reply to /help: the commands every chat can use, the
+// admin chat's and the custom commands the sender may use.
+func (al *AgentLoop) helpText(msg bus.InboundMessage) string {
+	help := al.t(msg, `Commands:
+/new - start a new conversation
+/reset - clear this conversation
+/undo [turns] - take back the last turns
+/branch [turns] - continue from an earlier point, keeping the original
+/sessions - list the conversations in this chat
+/persona [<id>|default] - choose who answers
+/pin <instruction> - pin an instruction to this chat; /pins lists them
+/memories - what was remembered here; /forget <id> forgets one
+/profile - what I know about you
+/schedule - what is scheduled here and when it runs next
+/jobs - how the scheduled jobs here last ran
+/language [code|default] - the language I answer commands in
+/whoami - who answers you and why
+/stop - stop the current answer`)
+	if al.isAdminChat(msg) {
+		help += "\n" + al.t(msg, "Admin: /status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd")
+	}
+	if custom := al.customCommandHelp(msg); custom != "" {
+		help += "\n\n" + custom
+	}
+	return help
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestLanguage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Gateway: config.GatewayConfig{
+			Language: config.LanguageConfig{Default: "fr", Chats: map[string]string{"telegram:42": "zh-CN"}},
+			Admin:    config.AdminConfig{Chats: []string{"telegram:42"}, Senders: []string{"telegram:42"}},
+		},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &historyProvider{})
+	h := testHelper{al: al}
+	ctx := context.Background()
+	send := func(chatID, content string) string {
+		return h.executeAndGetResponse(t, ctx, bus.InboundMessage{
+			Channel: "telegram", SenderID: "42|alice", ChatID: chatID, Content: content,
+		})
+	}
+
+	if got := send("7", "/reset"); got != "Historique de la conversation effacé." {
+		t.Errorf("/reset in a chat without a language = %q", got)
+	}
+	if got := send("42", "/reset"); got != "对话历史已清空。" {
+		t.Errorf("/reset in a Chinese chat = %q", got)
+	}
+
+	// The sender's own language wins over the chat's.
+	if got := send("42", "/language de-DE"); got != "Befehle werden auf Deutsch beantwortet." {
+		t.Errorf("/language de-DE = %q", got)
+	}
+	if got := send("42", "/reset"); got != "Gesprächsverlauf geleert." {
+		t.Errorf("/reset after /language de = %q", got)
+	}
+	if got := send("42", "/help"); !strings.HasPrefix(got, "Befehle:\n/new - ") || !strings.Contains(got, "\nAdmin: /status") {
+		t.Errorf("/help = %q", got)
+	}
+	if got := send("42", "/language klingon"); got != "Verwendung: /language [en|de|fr|zh|default]" {
+		t.Errorf("/language klingon = %q", got)
+	}
+	if got := send("42", "/language default"); got != "命令将以中文回复。" {
+		t.Errorf("/language default = %q", got)
+	}
+	if got := send("42", "/language en"); got != "Commands are answered in English." {
+		t.Errorf("/language en = %q", got)
+	}
+}
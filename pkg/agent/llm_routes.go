@@ -0,0 +1,271 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+// chatRoute sends one request of a fallback chain to the provider of the
+// candidate's route, with the agent's request timeout.
+func (a *AgentInstance) chatRoute(
+	ctx context.Context,
+	provider, model string,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	options map[string]any,
+	onDelta func(string),
+	onToolCall func(providers.ToolCall),
+) (*providers.LLMResponse, error) {
+	p := a.Provider
+	if routed, ok := a.Routes[providers.ModelKey(provider, model)]; ok {
+		p = routed
+	}
+	ctx, cancel := a.llmContext(ctx)
+	defer cancel()
+	return chatLLM(ctx, p, messages, tools, model, options, onDelta, onToolCall)
+}
+
+// llmContext bounds a single LLM request by the agent's timeout, so a
+// provider that hangs counts as a timeout and the chain moves on.
+func (a *AgentInstance) llmContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.LLMTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.LLMTimeout)
+}
+
+// routeName returns the model_list entry the candidate provider/model was
+// configured as, if any.
+func (a *AgentInstance) routeName(provider, model string) string {
+	for _, c := range a.Candidates {
+		if c.Provider == provider && c.Model == model {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+func llmAttempts(attempts []providers.FallbackAttempt) []state.LLMAttempt {
+	if len(attempts) == 0 {
+		return nil
+	}
+	out := make([]state.LLMAttempt, 0, len(attempts))
+	for _, a := range attempts {
+		attempt := state.LLMAttempt{
+			Provider:   a.Provider,
+			Model:      a.Model,
+			Reason:     string(a.Reason),
+			Skipped:    a.Skipped,
+			DurationMS: a.Duration.Milliseconds(),
+		}
+		if a.Error != nil {
+			attempt.Error = a.Error.Error()
+		}
+		out = append(out, attempt)
+	}
+	return out
+}
+
+func setLLMUsage(ev *state.LLMEvent, resp *providers.LLMResponse) {
+	if resp == nil || resp.Usage == nil {
+		return
+	}
+	ev.PromptTokens = resp.Usage.PromptTokens
+	ev.CompletionTokens = resp.Usage.CompletionTokens
+	ev.ReasoningTokens = resp.Usage.ReasoningTokens
+	ev.CostUSD = resp.Usage.Cost
+}
+
+// recordLLMEvent publishes ev, which the LLM event log records, notes the
+// model that answered in its session and returns what the request cost.
+// Failing to write it never fails the turn.
+func (al *AgentLoop) recordLLMEvent(ev state.LLMEvent) float64 {
+	if ev.SessionKey != "" && ev.Error == "" {
+		al.lastModels.Store(ev.SessionKey, ev.Model)
+	}
+	// A cost the API reported beats the pricing table; with OpenRouter it
+	// is also right when a fallback model answered.
+	if al.pricing != nil && ev.CostUSD == 0 && (ev.PromptTokens > 0 || ev.CompletionTokens > 0) {
+		ev.CostUSD, _ = al.pricing.Cost(ev.Provider, ev.Route, ev.Model, ev.PromptTokens, ev.CompletionTokens)
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	events.Publish(al.eventBus, events.LLMRequested, ev)
+	return ev.CostUSD
+}
+
+// defaultResponseCacheKB is the size of the response cache unless
+// response_cache_kb is set.
+const defaultResponseCacheKB = 512
+
+// currentTimeSection matches the clock in the system prompt, which changes
+// every minute.
+var currentTimeSection = regexp.MustCompile(`(?m)^## Current Time\n.*\n`)
+
+// responseCacheKey identifies a request in the response cache. The clock is
+// left out of the system prompt; otherwise no prompt would repeat, and the
+// cache TTL already bounds how old an answer can be.
+func responseCacheKey(
+	model string,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	options map[string]any,
+) string {
+	if len(messages) > 0 && messages[0].Role == "system" {
+		messages = append([]providers.Message(nil), messages...)
+		messages[0].Content = currentTimeSection.ReplaceAllString(messages[0].Content, "")
+	}
+	return providers.ResponseCacheKey(model, messages, tools, options)
+}
+
+// requestModel returns the model to request for agent, the provider that
+// serves it, its vendor and model_list route, and its context window. A
+// model chosen for the session or the message (name) is sent to the
+// provider of its model_list entry, if it has one.
+func (al *AgentLoop) requestModel(
+	agent *AgentInstance,
+	name string,
+) (model string, provider providers.LLMProvider, vendor, route string, window int) {
+	if name == "" {
+		return agent.Model, agent.Provider, "", "", agent.ContextWindow
+	}
+	if r, ok := al.resolveModel(name); ok {
+		return r.model, r.provider, r.vendor, name, r.window
+	}
+	return name, agent.Provider, "", "", resolveContextWindow(&al.cfg.Agents.Defaults, nil, name)
+}
+
+// isContextOverflow reports whether err says the prompt did not fit the
+// model's context window.
+func isContextOverflow(err error) bool {
+	errMsg := strings.ToLower(err.Error())
+	// A timed-out or cancelled request is not a full context window, even
+	// though "context deadline exceeded" and "context canceled" say context.
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(errMsg, "deadline exceeded") ||
+		errors.Is(err, context.Canceled) || strings.Contains(errMsg, "context canceled") {
+		return false
+	}
+	return strings.Contains(errMsg, "token") ||
+		strings.Contains(errMsg, "context") ||
+		strings.Contains(errMsg, "invalidparameter") ||
+		strings.Contains(errMsg, "length")
+}
+
+// canOverflow reports whether a turn on model override current can move to
+// the agent's overflow model.
+func (al *AgentLoop) canOverflow(agent *AgentInstance, current string) bool {
+	if agent.OverflowModel == "" || agent.OverflowModel == current {
+		return false
+	}
+	if _, ok := al.resolveModel(agent.OverflowModel); !ok {
+		logger.WarnCF("agent", "Unknown overflow_model",
+			map[string]any{"agent_id": agent.ID, "model": agent.OverflowModel})
+		return false
+	}
+	return true
+}
+
+// recordRunEvent publishes ev, which the run event log records; failing
+// to write it never fails the turn.
+func (al *AgentLoop) recordRunEvent(ev state.RunEvent) {
+	events.Publish(al.eventBus, events.RunEvent, ev)
+}
+
+// llmOptions returns the generation parameters of the agent's requests.
+func (a *AgentInstance) llmOptions() map[string]any {
+	options := map[string]any{
+		"max_tokens":  a.MaxTokens,
+		"temperature": a.Temperature,
+	}
+	if a.ReasoningEffort != "" {
+		options["reasoning_effort"] = a.ReasoningEffort
+	}
+	g := a.Generation
+	if g.TopP != nil {
+		options["top_p"] = *g.TopP
+	}
+	if len(g.Stop) > 0 {
+		options["stop"] = g.Stop
+	}
+	if g.FrequencyPenalty != nil {
+		options["frequency_penalty"] = *g.FrequencyPenalty
+	}
+	if g.PresencePenalty != nil {
+		options["presence_penalty"] = *g.PresencePenalty
+	}
+	if g.Seed != nil {
+		options["seed"] = *g.Seed
+	}
+	if len(g.LogitBias) > 0 {
+		options["logit_bias"] = g.LogitBias
+	}
+	return options
+}
+
+// resolvedModel is a model chosen by name at runtime, with the provider
+// that serves it.
+type resolvedModel struct {
+	provider providers.LLMProvider
+	vendor   string
+	model    string // the model ID to request
+	window   int    // context window
+}
+
+// resolveModel finds the provider of a model picked for a session or a
+// single message: a model_list name, or "vendor/model" for a vendor with a
+// model_list entry. Providers are created once per name.
+func (al *AgentLoop) resolveModel(name string) (*resolvedModel, bool) {
+	if v, ok := al.models.Load(name); ok {
+		return v.(*resolvedModel), true
+	}
+	if al.cfg == nil {
+		return nil, false
+	}
+	entry, err := al.cfg.GetModelConfig(name)
+	if err != nil {
+		vendor, model, found := strings.Cut(name, "/")
+		if !found {
+			return nil, false
+		}
+		if entry, found = al.cfg.VendorModelConfig(vendor, model); !found {
+			return nil, false
+		}
+	}
+	own := *entry
+	if own.Workspace == "" {
+		own.Workspace = al.cfg.WorkspacePath()
+	}
+	provider, modelID, err := providers.CreateProviderFromConfig(&own)
+	if err != nil {
+		logger.WarnCF("agent", "Cannot create provider for model",
+			map[string]any{"model": name, "error": err.Error()})
+		return nil, false
+	}
+	protocol, _ := providers.ExtractProtocol(own.Model)
+	r := &resolvedModel{
+		provider: provider,
+		vendor:   providers.NormalizeProvider(protocol),
+		model:    modelID,
+		window:   resolveContextWindow(&al.cfg.Agents.Defaults, &own, modelID),
+	}
+	actual, _ := al.models.LoadOrStore(name, r)
+	return actual.(*resolvedModel), true
+}
+
+// calibrateTokens teaches the token counter of model the prompt tokens the
+// provider reported for a prompt estimated at estimated tokens.
+func calibrateTokens(model string, estimated int, resp *providers.LLMResponse) {
+	if resp != nil && resp.Usage != nil {
+		tokenizer.Calibrate(model, estimated, resp.Usage.PromptTokens)
+	}
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Bounds of /logs: entries shown without a count and at most, and the
+// length of one.
+const (
+	defaultLogLines = 20
+	maxLogLines     = 100
+	maxLogLineLen   = 300
+)
+
+// logLevelCommand handles /loglevel in an admin chat:
+//
+//	/loglevel                           the default level and the components at their own
+//	/loglevel <level>                   set the default level
+//	/loglevel <component> <level>       log a component such as channels at its own level
+//	/loglevel <component> reset         let it follow the default again
+//
+// The levels hold until the gateway restarts or gateway.log is edited.
+func (al *AgentLoop) logLevelCommand(msg bus.InboundMessage, args []string) string {
+	switch len(args) {
+	case 0:
+		return logLevelReport()
+	case 1:
+		level, err := logger.ParseLevel(args[0])
+		if err != nil {
+			return err.Error()
+		}
+		logger.SetLevel(level)
+		logger.InfoCF("agent", "Log level changed", map[string]any{"level": level.String(), "by": auditActor(msg)})
+		return fmt.Sprintf("Logging at %s.", strings.ToLower(level.String()))
+	case 2:
+		component := args[0]
+		if args[1] == "reset" {
+			logger.ResetComponentLevel(component)
+			return fmt.Sprintf("%s logs at the default level again.", component)
+		}
+		level, err := logger.ParseLevel(args[1])
+		if err != nil {
+			return err.Error()
+		}
+		logger.SetComponentLevel(component, level)
+		logger.InfoCF("agent", "Log level changed",
+			map[string]any{"component": component, "level": level.String(), "by": auditActor(msg)})
+		return fmt.Sprintf("%s logs at %s.", component, strings.ToLower(level.String()))
+	default:
+		return "Usage: /loglevel [<level> | <component> <level>|reset]\nLevels: debug, info, warn, error"
+	}
+}
+
+// logLevelReport lists the default log level and the components that log
+// at their own.
+func logLevelReport() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Log level: %s (%s format)", strings.ToLower(logger.GetLevel().String()), logger.Format())
+	levels := logger.ComponentLevels()
+	for _, component := range slices.Sorted(maps.Keys(levels)) {
+		fmt.Fprintf(&b, "\n- %s: %s", component, strings.ToLower(levels[component].String()))
+	}
+	return b.String()
+}
+
+// logsCommand handles /logs in an admin chat, with the latest entries
+// kept in memory, oldest first:
+//
+//	/logs [<level>] [<component>] [<n>]   the last n (20) at level or above, of a component
+//	/logs find <text>                     those with text in the message or a field, e.g. a task ID
+func (al *AgentLoop) logsCommand(msg bus.InboundMessage, args []string) string {
+	if logger.KeptRecent() == 0 {
+		return "No log entries are kept. Set gateway.log.keep_recent to keep the latest."
+	}
+	q := logger.Query{Level: logger.DEBUG, Limit: defaultLogLines}
+	if len(args) > 0 && args[0] == "find" {
+		q.Text = strings.Join(args[1:], " ")
+		if q.Text == "" {
+			return "Usage: /logs find <text>"
+		}
+		args = nil
+	}
+	for _, arg := range args {
+		if level, err := logger.ParseLevel(arg); err == nil {
+			q.Level = level
+		} else if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+			q.Limit = min(n, maxLogLines)
+		} else if q.Component == "" {
+			q.Component = arg
+		} else {
+			return "Usage: /logs [<level>] [<component>] [<n>] | /logs find <text>"
+		}
+	}
+
+	entries := logger.Recent(q)
+	if len(entries) == 0 {
+		return "No log entries match."
+	}
+	loc := al.senderLocation(msg)
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = utils.Truncate(formatLogEntry(e, loc), maxLogLineLen)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatLogEntry writes e as a line of /logs:
+//
+//	14:03:12 WARN channels: Reconnecting {account=work, error=EOF}
+func formatLogEntry(e logger.Entry, loc *time.Location) string {
+	line := e.Time.In(loc).Format("15:04:05") + " " + e.Level.String()
+	if e.Component != "" {
+		line += " " + e.Component + ":"
+	}
+	line += " " + e.Message
+	if len(e.Fields) > 0 {
+		parts := make([]string, 0, len(e.Fields))
+		for _, k := range slices.Sorted(maps.Keys(e.Fields)) {
+			parts = append(parts, fmt.Sprintf("%s=%v", k, e.Fields[k]))
+		}
+		line += " {" + strings.Join(parts, ", ") + "}"
+	}
+	return line
+}
@@ -9,24 +9,38 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/dnd"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/i18n"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/plugins"
+	"github.com/sipeed/picoclaw/pkg/pricing"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/workflow"
 )
 
 type AgentLoop struct {
@@ -35,28 +49,70 @@ type AgentLoop struct {
 	registry       *AgentRegistry
 	state          *state.Manager
 	running        atomic.Bool
+	draining       atomic.Bool // set by Drain
 	summarizing    sync.Map
 	fallback       *providers.FallbackChain
+	llmEvents      *state.LLMEventLog
+	traces         *state.TraceLog // finished runs and tool calls, for analytics
+	runEvents      *state.EventLog
+	eventBus       *events.Bus // what happens in runs, see Events
+	auditLog       *state.AuditLog
+	profiles       *state.ProfileStore
+	responses      *providers.ResponseCache
+	pricing        *pricing.Registry
+	models         sync.Map // model name -> *resolvedModel, see AgentLoop.resolveModel
+	nextModel      sync.Map // "channel:chatID" -> model for the next message, set by /model
 	channelManager *channels.Manager
+	coordinator    session.Coordinator // shared with other gateways, nil when alone
+	cronService    *cron.CronService   // scheduled jobs, for /schedule; nil without a gateway
+	workflows      *workflow.Service   // for /workflow; nil without a gateway
+	dnd            *dnd.Schedule       // for /dnd; nil when do-not-disturb is off
+	runSlots       *scheduler          // see config.BudgetConfig
+	dispatcher     *dispatcher
+	batcher        *batcher
+	llmQueue       *llmQueue
+	runsMu         sync.Mutex
+	storesMu       sync.Mutex // guards stores, cached by StoreSizes
+	stores         []StoreStatus
+	storesAt       time.Time
+	runs           map[string]*activeRun // "channel:chatID" -> message being answered
+	reloadConfig   func() ([]config.Change, error)
+	flags          *flags
+	commands       map[string]*customCommand
+	answers        sync.Map // "channel:chatID" -> answeredBy, for /whoami
+	lastModels     sync.Map // session key -> model that last answered in it
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string             // Session identifier for history/context
+	Channel         string             // Target channel for tool execution
+	ChatID          string             // Target chat ID for tool execution
+	UserMessage     string             // User message content (may include prefix)
+	DefaultResponse string             // Response when LLM returns empty
+	EnableSummary   bool               // Whether to trigger summarization
+	SendResponse    bool               // Whether to send response via bus
+	NoHistory       bool               // If true, don't load session history (for heartbeat)
+	Presence        *channels.Presence // Typing/reaction feedback for the user, may be nil
+	Model           string             // Model pinned to the session, overrides the agent's
+	SessionNotes    string             // Extra Current Session context, such as group participants
+	Media           []string           // Images and audio sent with the message, for providers that take them
+	Tools           []string           // The only tools the model may use, all of the agent's when empty
+	NoTools         bool               // Offer the model no tools at all
+	MaxCostUSD      float64            // Stop the run once its requests cost this much, 0 for no cap
 }
 
-func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
-	registry := NewAgentRegistry(cfg, provider)
+// NewAgentLoop creates the agents cfg defines and the loop that runs
+// them. It fails when an agent's session store cannot be opened.
+func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) (*AgentLoop, error) {
+	registry, err := NewAgentRegistry(cfg, provider)
+	if err != nil {
+		return nil, err
+	}
 
 	// Register shared tools to all agents
-	registerSharedTools(cfg, msgBus, registry, provider)
+	profiles := state.NewProfileStore(cfg.WorkspacePath())
+	registerSharedTools(cfg, msgBus, registry, provider, profiles)
 
 	// Set up shared fallback chain
 	cooldown := providers.NewCooldownTracker()
@@ -69,14 +125,39 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		stateManager = state.NewManager(defaultAgent.Workspace)
 	}
 
-	return &AgentLoop{
+	al := &AgentLoop{
 		bus:         msgBus,
 		cfg:         cfg,
 		registry:    registry,
 		state:       stateManager,
 		summarizing: sync.Map{},
 		fallback:    fallbackChain,
+		llmEvents:   state.NewLLMEventLog(cfg.WorkspacePath()),
+		traces:      state.NewTraceLog(cfg.WorkspacePath()),
+		runEvents:   state.NewEventLog(cfg.WorkspacePath()),
+		auditLog:    state.NewAuditLog(cfg.WorkspacePath()),
+		pricing:     newPricing(cfg.Pricing),
+		runs:        make(map[string]*activeRun),
+		profiles:    profiles,
+		flags:       newFlags(cfg.Gateway.Flags, cfg.WorkspacePath()),
+		commands:    newCustomCommands(cfg.Commands),
+		eventBus:    events.New(),
 	}
+	al.subscribeEventLogs()
+	if defaults := cfg.Agents.Defaults; defaults.ResponseCacheTTL > 0 {
+		size := defaults.ResponseCacheKB
+		if size <= 0 {
+			size = defaultResponseCacheKB
+		}
+		al.responses = providers.NewResponseCache(time.Duration(defaults.ResponseCacheTTL)*time.Minute, size*1024)
+	}
+	runs, subprocesses := cfg.Gateway.Budget.Slots(runtime.NumCPU(), machineMemoryMB())
+	tools.LimitSubprocesses(subprocesses)
+	al.runSlots = newScheduler(runs, max(cfg.Gateway.Queue.MaxConcurrency, 1))
+	al.dispatcher = newDispatcher(cfg.Gateway.Queue, al.runSlots, al.handleInbound, al.notifyQueued)
+	al.batcher = newBatcher(cfg.Gateway.GroupBatches, al.dispatcher.submit, al.ackBatched)
+	al.llmQueue = newLLMQueue(cfg.Gateway.Queue.Background)
+	return al, nil
 }
 
 // registerSharedTools registers tools that are shared across all agents (web, message, spawn).
@@ -85,6 +166,7 @@ func registerSharedTools(
 	msgBus *bus.MessageBus,
 	registry *AgentRegistry,
 	provider providers.LLMProvider,
+	profiles *state.ProfileStore,
 ) {
 	for _, agentID := range registry.ListAgentIDs() {
 		agent, ok := registry.GetAgent(agentID)
@@ -115,19 +197,40 @@ func registerSharedTools(
 		// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 		agent.Tools.Register(tools.NewI2CTool())
 		agent.Tools.Register(tools.NewSPITool())
+		agent.Tools.Register(tools.NewDeviceTool(agent.Workspace, cfg.Tools.Device))
 
 		// Message tool
 		messageTool := tools.NewMessageTool()
-		messageTool.SetSendCallback(func(channel, chatID, content string) error {
+		messageTool.SetSendCallback(func(ctx context.Context, channel, chatID, content string) error {
 			msgBus.PublishOutbound(bus.OutboundMessage{
-				Channel: channel,
-				ChatID:  chatID,
-				Content: content,
+				Channel:   channel,
+				ChatID:    chatID,
+				Content:   content,
+				Proactive: providers.IsBackground(ctx),
 			})
 			return nil
 		})
+		messageTool.SetSendFilesCallback(func(ctx context.Context, channel, chatID, content string, files []string) error {
+			attachments := make([]bus.Attachment, 0, len(files))
+			for _, path := range files {
+				attachments = append(attachments, media.FromFile(path))
+			}
+			msgBus.PublishOutbound(bus.OutboundMessage{
+				Channel:     channel,
+				ChatID:      chatID,
+				Content:     content,
+				Attachments: attachments,
+				Proactive:   providers.IsBackground(ctx),
+			})
+			return nil
+		}, agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace)
 		agent.Tools.Register(messageTool)
 
+		// Cross-channel send tool, only when destinations are configured
+		if cfg.Tools.SendMessage.Enabled() {
+			agent.Tools.Register(newSendMessageTool(msgBus, cfg.Tools.SendMessage))
+		}
+
 		// Skill discovery and installation tools
 		registryMgr := skills.NewRegistryManagerFromConfig(skills.RegistryConfig{
 			MaxConcurrentSearches: cfg.Tools.Skills.MaxConcurrentSearches,
@@ -150,6 +253,22 @@ func registerSharedTools(
 		})
 		agent.Tools.Register(spawnTool)
 
+		agent.Tools.Register(tools.NewUpdateProfileTool(profiles))
+		agent.Tools.Register(tools.NewRememberTool(agent.ContextBuilder.memory.Facts()))
+
+		// Tools of the plugins installed in the agent's workspace. A plugin
+		// does not replace a built-in tool.
+		for _, p := range plugins.Load(filepath.Join(agent.Workspace, "plugins")) {
+			for _, tool := range p.AgentTools() {
+				if _, exists := agent.Tools.Get(tool.Name()); exists {
+					logger.WarnCF("agent", "Plugin tool shadows a built-in tool, skipping",
+						map[string]any{"plugin": p.Name, "tool": tool.Name()})
+					continue
+				}
+				agent.Tools.Register(tool)
+			}
+		}
+
 		// Update context builder with the complete tools registry
 		agent.ContextBuilder.SetToolsRegistry(agent.Tools)
 	}
@@ -157,6 +276,10 @@ func registerSharedTools(
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	if al.cfg.Memory.Consolidation.Enabled {
+		go al.runConsolidation(ctx)
+	}
+	go al.runWatchdog(ctx)
 
 	for al.running.Load() {
 		select {
@@ -167,42 +290,147 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 			if !ok {
 				continue
 			}
-
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+			if al.draining.Load() {
+				al.hold([]bus.InboundMessage{msg})
+				continue
+			}
+			if al.paused(msg) || al.interrupt(msg) {
+				continue
 			}
+			if al.batcher.add(ctx, msg) {
+				continue
+			}
+			al.dispatcher.submit(ctx, msg)
+		}
+	}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				// Use default agent's tools to check (message tool is shared).
-				alreadySent := false
-				defaultAgent := al.registry.GetDefaultAgent()
-				if defaultAgent != nil {
-					if tool, ok := defaultAgent.Tools.Get("message"); ok {
-						if mt, ok := tool.(*tools.MessageTool); ok {
-							alreadySent = mt.HasSentInRound()
-						}
-					}
-				}
+	return nil
+}
 
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
+// handleInbound processes one message taken off the queue and publishes
+// the reply.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	if al.coordinator != nil {
+		unlock, err := session.Lock(ctx, al.coordinator, "chat:"+msg.Channel+":"+msg.ChatID)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			// Answering without the lock beats not answering.
+			logger.WarnCF("agent", "Failed to lock chat",
+				map[string]any{"channel": msg.Channel, "chat_id": msg.ChatID, "error": err.Error()})
+		default:
+			defer unlock()
+		}
+	}
+	runCtx, done := al.startRun(ctx, msg)
+	response, err := al.processMessage(runCtx, msg)
+	cause := runCancellation(runCtx)
+	done()
+	if timeout := asTimeout(cause); timeout != nil {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: al.timeoutNotice(msg, timeout),
+		})
+		return
+	}
+	if cause != nil {
+		return
+	}
+	if err != nil {
+		response = al.t(msg, "Error processing message: %v", err)
+	}
+
+	if response != "" {
+		// Check if the message tool already sent a response during this round.
+		// If so, skip publishing to avoid duplicate messages to the user.
+		// Use default agent's tools to check (message tool is shared).
+		alreadySent := false
+		defaultAgent := al.registry.GetDefaultAgent()
+		if defaultAgent != nil {
+			if tool, ok := defaultAgent.Tools.Get("message"); ok {
+				if mt, ok := tool.(*tools.MessageTool); ok {
+					alreadySent = mt.HasSentInRound(msg.Channel, msg.ChatID)
 				}
 			}
 		}
+
+		if !alreadySent {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: response,
+			})
+		}
 	}
+}
 
-	return nil
+// QueueDepth returns the number of inbound messages waiting to be processed.
+func (al *AgentLoop) QueueDepth() int {
+	return al.dispatcher.depth()
+}
+
+// BackgroundWaiting returns the number of LLM requests of scheduled work
+// held back for interactive ones.
+func (al *AgentLoop) BackgroundWaiting() int {
+	return al.llmQueue.queued()
+}
+
+// RunSlots returns the number of agent runs going on and of those waiting
+// for a slot, see config.BudgetConfig.
+func (al *AgentLoop) RunSlots() (running, waiting int) {
+	return al.runSlots.counts()
+}
+
+// notifyQueued tells the sender of msg that it waits for a run slot, at
+// position in the line.
+func (al *AgentLoop) notifyQueued(msg bus.InboundMessage, position int) {
+	if !al.cfg.Gateway.Budget.NotifyQueued || constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: al.t(msg, "⏳ You're #%d in the queue, I'll answer as soon as I can.", position),
+	})
+}
+
+// ActiveChats returns the number of chats with a message queued or running.
+func (al *AgentLoop) ActiveChats() int {
+	return al.dispatcher.activeChats()
+}
+
+// BatchedMessages returns the number of group messages held back until
+// their chat goes quiet.
+func (al *AgentLoop) BatchedMessages() int {
+	return al.batcher.pending()
+}
+
+// ackBatched lets the sender know a held-back message was seen.
+func (al *AgentLoop) ackBatched(ctx context.Context, msg bus.InboundMessage) {
+	if al.channelManager == nil {
+		return
+	}
+	err := al.channelManager.React(ctx, msg.Channel, msg.ChatID, msg.Metadata["message_id"], al.cfg.Gateway.GroupBatches.AckEmoji)
+	if err != nil {
+		logger.DebugCF("agent", "Acknowledging batched message failed", map[string]any{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+	}
 }
 
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	if al.draining.Load() {
+		al.hold(al.bus.TakeInbound())
+	}
+}
+
+// Running reports whether Run is taking messages off the bus.
+func (al *AgentLoop) Running() bool {
+	return al.running.Load()
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
@@ -213,8 +441,58 @@ func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	}
 }
 
+// SetCoordinator makes the loop work together with other gateways that
+// share its chats and session store: it handles a chat only while holding
+// its lock, and reads the chat's sessions from the store first.
+func (al *AgentLoop) SetCoordinator(c session.Coordinator) {
+	al.coordinator = c
+}
+
+// SetCronService gives /schedule the jobs to show and change.
+func (al *AgentLoop) SetCronService(cs *cron.CronService) {
+	al.cronService = cs
+}
+
 func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
+
+	// Let send_message reject channels that are not enabled.
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		if tool, ok := agent.Tools.Get("send_message"); ok {
+			if st, ok := tool.(*tools.SendMessageTool); ok {
+				st.SetChannelLookup(func(channel string) bool {
+					_, exists := cm.GetChannel(channel)
+					return exists
+				})
+			}
+		}
+		agent.ContextBuilder.SetChannelNotes(func(channel string) string {
+			ch, ok := cm.GetChannel(channel)
+			if !ok {
+				return ""
+			}
+			return channelNotes(ch.Capabilities())
+		})
+	}
+}
+
+// channelNotes tells the model about channel limits worth writing for:
+// Markdown that would show up literally, and short message limits.
+func channelNotes(caps channels.Capabilities) string {
+	var notes []string
+	if caps.Markdown == format.Plain {
+		notes = append(notes, "Formatting: plain text only, Markdown is not rendered.")
+	}
+	if caps.MaxMessageLength > 0 && caps.MaxMessageLength <= 2000 {
+		notes = append(notes, fmt.Sprintf(
+			"Message limit: %d characters; longer replies are split into several messages, so keep replies brief.",
+			caps.MaxMessageLength))
+	}
+	return strings.Join(notes, "\n")
 }
 
 // RecordLastChannel records the last active channel for this workspace.
@@ -258,7 +536,7 @@ func (al *AgentLoop) ProcessDirectWithChannel(
 // Each heartbeat is independent and doesn't accumulate context.
 func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, chatID string) (string, error) {
 	agent := al.registry.GetDefaultAgent()
-	return al.runAgentLoop(ctx, agent, processOptions{
+	return al.runAgentLoop(providers.WithBackground(ctx), agent, processOptions{
 		SessionKey:      "heartbeat",
 		Channel:         channel,
 		ChatID:          chatID,
@@ -297,13 +575,17 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 
 	// Route to determine agent and session key
+	// Bindings match the channel type; "telegram@work" is routed as
+	// channel "telegram", account "work".
+	channelType, _ := channels.SplitAccount(msg.Channel)
 	route := al.registry.ResolveRoute(routing.RouteInput{
-		Channel:    msg.Channel,
+		Channel:    channelType,
 		AccountID:  msg.Metadata["account_id"],
 		Peer:       extractPeer(msg),
 		ParentPeer: extractParentPeer(msg),
 		GuildID:    msg.Metadata["guild_id"],
 		TeamID:     msg.Metadata["team_id"],
+		ThreadID:   msg.Metadata["thread_id"],
 	})
 
 	agent, ok := al.registry.GetAgent(route.AgentID)
@@ -317,22 +599,153 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		sessionKey = msg.SessionKey
 	}
 
+	if al.coordinator != nil {
+		al.refreshSession(agent, sessionKey)
+	}
+	if response, handled := al.handleSessionCommand(agent, sessionKey, msg); handled {
+		return response, nil
+	}
+	if response, handled := al.handlePromptCommand(agent, msg); handled {
+		return response, nil
+	}
+	if response, handled := al.handleAdminCommand(agent, msg); handled {
+		return response, nil
+	}
+	if response, handled := al.handleMemoryCommand(agent, sessionKey, msg); handled {
+		return response, nil
+	}
+	response, model, content, handled := al.handleModelCommand(agent, msg)
+	if handled {
+		return response, nil
+	}
+	if model != "" {
+		msg.Content = content
+	} else {
+		model = al.takeNextModel(msg)
+	}
+	custom, reply := al.expandCommand(msg)
+	if reply != "" {
+		return reply, nil
+	}
+	var commandTools []string
+	if custom != nil {
+		msg.Content = custom.content
+		commandTools = custom.tools
+		if model == "" {
+			model = custom.model
+		}
+	}
+
+	// Continue in the session started by /new, if any, and apply the
+	// session's pins. A pinned agent answers with its own prompt, tools and
+	// model but keeps the history in the routed agent's session store.
+	routedKey := sessionKey
+	sessionKey = agent.Sessions.Resolve(sessionKey)
+	if al.coordinator != nil && sessionKey != routedKey {
+		al.refreshSession(agent, sessionKey)
+	}
+	pins := agent.Sessions.GetInfo(sessionKey)
+	if model == "" {
+		model = pins.Model
+	}
+	// A persona chosen with /persona wins over the routing rules.
+	personaID, chosenBy := pins.AgentID, "/persona"
+	if custom != nil && custom.persona != "" {
+		personaID, chosenBy = custom.persona, custom.name
+	}
+	if personaID == "" {
+		personaID, chosenBy = al.rulePersona(msg, time.Now())
+	}
+	if personaID != "" && personaID != agent.ID {
+		if chosen, ok := al.registry.GetAgent(personaID); ok {
+			persona := *chosen
+			persona.Sessions = agent.Sessions
+			agent = &persona
+		} else {
+			personaID = ""
+		}
+	}
+	if personaID == "" {
+		chosenBy = routedBy(route.MatchedBy)
+	}
+	answer := answeredBy{persona: agent.ID, name: agent.Name, by: chosenBy, model: model, sessionKey: sessionKey}
+	if answer.model == "" {
+		answer.model = agent.Model
+	}
+	if strings.TrimSpace(msg.Content) == "/whoami" {
+		return al.whoamiReport(msg, answer), nil
+	}
+	al.answers.Store(msg.Channel+":"+msg.ChatID, answer)
+
 	logger.InfoCF("agent", "Routed message",
 		map[string]any{
 			"agent_id":    agent.ID,
+			"account_id":  route.AccountID,
 			"session_key": sessionKey,
 			"matched_by":  route.MatchedBy,
+			"persona_by":  chosenBy,
 		})
 
-	return al.runAgentLoop(ctx, agent, processOptions{
+	userMessage := msg.Content
+	if attachments := media.Describe(msg.Attachments); attachments != "" {
+		userMessage += "\n\n" + attachments
+	}
+
+	// In groups every message says who wrote it, and the prompt lists the
+	// participants and the speaker's personal notes.
+	sessionNotes := pinnedNotes(agent.Sessions.Instructions(routedKey))
+	if isGroupChat(msg) {
+		userMessage = joinGroupTurn(agent.Sessions, sessionKey, msg, userMessage)
+		sessionNotes += groupNotes(agent.ContextBuilder.memory, agent.Sessions.Participants(sessionKey), msg)
+	}
+	if id := profileID(msg); id != "" {
+		sessionNotes += profileNotes(al.profiles.Get(id), time.Now())
+		ctx = tools.WithSender(ctx, id)
+	}
+	ctx = tools.WithSessionKey(ctx, sessionKey)
+
+	var presence *channels.Presence
+	if al.channelManager != nil {
+		presence = al.channelManager.StartPresence(ctx, msg.Channel, msg.ChatID, msg.Metadata["message_id"])
+	}
+
+	response, err := al.runAgentLoop(ctx, agent, processOptions{
 		SessionKey:      sessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
+		UserMessage:     userMessage,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		Presence:        presence,
+		Model:           model,
+		SessionNotes:    sessionNotes,
+		Media:           inputMedia(msg.Attachments),
+		Tools:           commandTools,
 	})
+	presence.Finish(context.WithoutCancel(ctx), err)
+	return response, err
+}
+
+// refreshSession reads a session from the store, where another gateway
+// may have continued it.
+func (al *AgentLoop) refreshSession(agent *AgentInstance, key string) {
+	if err := agent.Sessions.Refresh(key); err != nil {
+		logger.WarnCF("agent", "Failed to refresh session",
+			map[string]any{"session_key": key, "error": err.Error()})
+	}
+}
+
+// inputMedia returns the downloaded images and audio of a message, which
+// multimodal providers get along with its text.
+func inputMedia(atts []bus.Attachment) []string {
+	var paths []string
+	for _, att := range atts {
+		if att.Path != "" && (att.Type == bus.AttachmentImage || att.Type == bus.AttachmentAudio) {
+			paths = append(paths, att.Path)
+		}
+	}
+	return paths
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -393,10 +806,47 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 
 // runAgentLoop is the core message processing logic.
 func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opts processOptions) (string, error) {
+	// What is logged during the run tells which persona answered where.
+	ctx = logger.WithFields(ctx, map[string]any{"persona": agent.ID, "session_key": opts.SessionKey})
+
+	// A run started under another's slot, such as a message's under its
+	// chat's, shares it; waiting for a second one could deadlock.
+	if !holdsRunSlot(ctx) {
+		release, err := al.runSlots.acquire(ctx, providers.IsBackground(ctx), nil)
+		if err != nil {
+			return "", err
+		}
+		defer release()
+		ctx = withRunSlot(ctx)
+	}
+
+	run := events.Run{
+		AgentID: agent.ID, SessionKey: opts.SessionKey, Channel: opts.Channel, ChatID: opts.ChatID,
+		TaskID: state.TaskID(ctx), Background: providers.IsBackground(ctx), Started: time.Now(),
+	}
+	events.Publish(al.eventBus, events.RunStarted, run)
+	content, err := al.runGuarded(ctx, agent, opts, &run)
+	run.Duration = time.Since(run.Started)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if run.Exit == "" {
+		run.Exit = events.RunOK
+		if err != nil {
+			run.Exit = events.RunFailed
+		}
+	}
+	events.Publish(al.eventBus, events.RunFinished, run)
+	return content, err
+}
+
+// runAgent answers opts.UserMessage as agent, see runAgentLoop.
+func (al *AgentLoop) runAgent(ctx context.Context, agent *AgentInstance, opts processOptions) (string, error) {
 	// 0. Record last channel for heartbeat notifications (skip internal channels)
 	if opts.Channel != "" && opts.ChatID != "" {
-		// Don't record internal channels (cli, system, subagent)
-		if !constants.IsInternalChannel(opts.Channel) {
+		// Don't record internal channels (cli, system, subagent) or the
+		// terminal, which is gone once the chat session ends.
+		if !constants.IsInternalChannel(opts.Channel) && !constants.IsLocalChannel(opts.Channel) {
 			channelKey := fmt.Sprintf("%s:%s", opts.Channel, opts.ChatID)
 			if err := al.RecordLastChannel(channelKey); err != nil {
 				logger.WarnCF("agent", "Failed to record last channel", map[string]any{"error": err.Error()})
@@ -418,20 +868,51 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		history,
 		summary,
 		opts.UserMessage,
-		nil,
+		opts.Media,
 		opts.Channel,
 		opts.ChatID,
+		opts.SessionNotes,
 	)
 
-	// 3. Save user message to session
+	// With the "summarize" strategy, history that no longer fits the
+	// context window is summarized before the turn rather than cut.
+	if agent.ContextStrategy == "summarize" && !opts.NoHistory &&
+		historyTokens(agent.Model, messages) > promptBudget(agent.ContextWindow, agent.MaxTokens) {
+		al.summarizeSession(agent, opts.SessionKey)
+		history = agent.Sessions.GetHistory(opts.SessionKey)
+		messages = agent.ContextBuilder.BuildMessages(
+			history,
+			agent.Sessions.GetSummary(opts.SessionKey),
+			opts.UserMessage,
+			opts.Media,
+			opts.Channel,
+			opts.ChatID,
+			opts.SessionNotes,
+		)
+	}
+
+	// 3. Save user message to session. A cancelled run puts back the
+	// history it started with.
+	before := history
+	if opts.NoHistory {
+		before = agent.Sessions.GetHistory(opts.SessionKey)
+	}
 	agent.Sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
 
 	// 4. Run LLM iteration loop
-	finalContent, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
+	finalContent, reasoning, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
 	if err != nil {
+		if cause := runCancellation(ctx); cause != nil {
+			al.finishCancelled(agent, opts, before, iteration, cause)
+		}
 		return "", err
 	}
 
+	// 4b. Optional: a second model reviews the answer
+	if agent.Critique != nil && finalContent != "" {
+		finalContent, reasoning, iteration = al.reviewAnswer(ctx, agent, opts, finalContent, reasoning, iteration)
+	}
+
 	// If last tool had ForUser content and we already sent it, we might not need to send final response
 	// This is controlled by the tool's Silent flag and ForUser content
 
@@ -441,7 +922,15 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	}
 
 	// 6. Save final assistant message to session
-	agent.Sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
+	if agent.KeepReasoning && reasoning != "" {
+		agent.Sessions.AddFullMessage(opts.SessionKey, providers.Message{
+			Role:             "assistant",
+			Content:          finalContent,
+			ReasoningContent: reasoning,
+		})
+	} else {
+		agent.Sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
+	}
 	agent.Sessions.Save(opts.SessionKey)
 
 	// 7. Optional: summarization
@@ -452,15 +941,16 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	// 8. Optional: send response via bus
 	if opts.SendResponse {
 		al.bus.PublishOutbound(bus.OutboundMessage{
-			Channel: opts.Channel,
-			ChatID:  opts.ChatID,
-			Content: finalContent,
+			Channel:   opts.Channel,
+			ChatID:    opts.ChatID,
+			Content:   finalContent,
+			Proactive: providers.IsBackground(ctx),
 		})
 	}
 
 	// 9. Log response
 	responsePreview := utils.Truncate(finalContent, 120)
-	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
+	logger.InfoCtx(ctx, "agent", fmt.Sprintf("Response: %s", responsePreview),
 		map[string]any{
 			"agent_id":     agent.ID,
 			"session_key":  opts.SessionKey,
@@ -471,20 +961,34 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	return finalContent, nil
 }
 
-// runLLMIteration executes the LLM call loop with tool handling.
+// runLLMIteration executes the LLM call loop with tool handling. It returns
+// the final answer, the reasoning that led to it, if the model reported
+// any, and the number of iterations.
 func (al *AgentLoop) runLLMIteration(
 	ctx context.Context,
 	agent *AgentInstance,
 	messages []providers.Message,
 	opts processOptions,
-) (string, int, error) {
+) (string, string, int, error) {
 	iteration := 0
-	var finalContent string
+	var finalContent, finalReasoning string
+	// The model of the session or the message; after a context overflow,
+	// the agent's overflow model for the rest of the turn.
+	modelOverride := opts.Model
+	// What the requests of this run cost, as far as their price is known.
+	var spent float64
 
 	for iteration < agent.MaxIterations {
+		if err := ctx.Err(); err != nil {
+			return "", "", iteration, err
+		}
+		if opts.MaxCostUSD > 0 && spent >= opts.MaxCostUSD {
+			return "", "", iteration, fmt.Errorf("cost cap of $%.4f reached after %d requests ($%.4f)",
+				opts.MaxCostUSD, iteration, spent)
+		}
 		iteration++
 
-		logger.DebugCF("agent", "LLM iteration",
+		logger.DebugCtx(ctx, "agent", "LLM iteration",
 			map[string]any{
 				"agent_id":  agent.ID,
 				"iteration": iteration,
@@ -492,57 +996,161 @@ func (al *AgentLoop) runLLMIteration(
 			})
 
 		// Build tool definitions
-		providerToolDefs := agent.Tools.ToProviderDefs()
+		providerToolDefs := al.flags.filterTools(agent.Tools.ToProviderDefs())
+		if opts.NoTools {
+			providerToolDefs = nil
+		} else if len(opts.Tools) > 0 {
+			providerToolDefs = slices.DeleteFunc(providerToolDefs, func(d providers.ToolDefinition) bool {
+				return !slices.Contains(opts.Tools, d.Function.Name)
+			})
+		}
+
+		model, llmProvider, vendor, route, window := al.requestModel(agent, modelOverride)
+
+		var promptTokens int
+		messages, promptTokens = fitContext(model, messages, providerToolDefs,
+			promptBudget(window, agent.MaxTokens), agent.ContextStrategy)
 
 		// Log LLM request details
-		logger.DebugCF("agent", "LLM request",
+		logger.DebugCtx(ctx, "agent", "LLM request",
 			map[string]any{
 				"agent_id":          agent.ID,
 				"iteration":         iteration,
-				"model":             agent.Model,
+				"model":             model,
 				"messages_count":    len(messages),
+				"prompt_tokens":     promptTokens,
+				"context_window":    window,
 				"tools_count":       len(providerToolDefs),
 				"max_tokens":        agent.MaxTokens,
 				"temperature":       agent.Temperature,
 				"system_prompt_len": len(messages[0].Content),
 			})
 
-		// Log full messages (detailed)
-		logger.DebugCF("agent", "Full LLM request",
-			map[string]any{
-				"iteration":     iteration,
-				"messages_json": formatMessagesForLog(messages),
-				"tools_json":    formatToolsForLog(providerToolDefs),
-			})
+		// Log full messages (detailed); formatting them costs more than
+		// the rest of the request, so only when they are logged.
+		if logger.Enabled("agent", logger.DEBUG) {
+			logger.DebugCtx(ctx, "agent", "Full LLM request",
+				map[string]any{
+					"iteration":     iteration,
+					"messages_json": formatMessagesForLog(messages),
+					"tools_json":    formatToolsForLog(providerToolDefs),
+				})
+		}
 
 		// Call LLM with fallback chain if candidates are configured.
 		var response *providers.LLMResponse
 		var err error
 
-		callLLM := func() (*providers.LLMResponse, error) {
-			if len(agent.Candidates) > 1 && al.fallback != nil {
+		onDelta := al.streamSink(agent, opts)
+		// What was streamed is billed even if the run is cancelled.
+		var streamed strings.Builder
+		if sink := onDelta; sink != nil {
+			onDelta = func(delta string) {
+				streamed.WriteString(delta)
+				sink(delta)
+			}
+		}
+		prefetch := newToolPrefetch(func(tc providers.ToolCall) *tools.ToolResult {
+			return al.runTool(ctx, agent, opts, tc, iteration)
+		})
+		onToolCall := prefetch.add
+		if len(providerToolDefs) == 0 {
+			onToolCall = nil
+		}
+		llmOptions := agent.llmOptions()
+		llmOptions["context_window"] = window
+		background := providers.IsBackground(ctx)
+		if background && al.llmQueue.serviceTier != "" {
+			llmOptions["service_tier"] = al.llmQueue.serviceTier
+		}
+		requestLLM := func() (*providers.LLMResponse, error) {
+			enterStage(ctx, "waiting for the LLM queue")
+			done, err := al.llmQueue.acquire(ctx, background)
+			if err != nil {
+				return nil, err
+			}
+			defer done()
+			enterStage(ctx, "LLM request to "+model)
+			streamed.Reset()
+			started := time.Now()
+			ev := state.LLMEvent{
+				AgentID: agent.ID, SessionKey: opts.SessionKey, Iteration: iteration, Model: model,
+				Background: background, TaskID: state.TaskID(ctx),
+			}
+
+			// A model pinned to the session is used as is, without the
+			// agent's fallbacks.
+			if len(agent.Candidates) > 1 && al.fallback != nil && modelOverride == "" {
 				fbResult, fbErr := al.fallback.Execute(ctx, agent.Candidates,
 					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
-						return agent.Provider.Chat(ctx, messages, providerToolDefs, model, map[string]any{
-							"max_tokens":  agent.MaxTokens,
-							"temperature": agent.Temperature,
-						})
+						return agent.chatRoute(ctx, provider, model, messages, providerToolDefs, llmOptions, onDelta, onToolCall)
 					},
 				)
+				ev.DurationMS = time.Since(started).Milliseconds()
 				if fbErr != nil {
+					var exhausted *providers.FallbackExhaustedError
+					if errors.As(fbErr, &exhausted) {
+						ev.Attempts = llmAttempts(exhausted.Attempts)
+					}
+					ev.Error = fbErr.Error()
+					if ctx.Err() != nil {
+						setCancelledUsage(ctx, &ev, model, promptTokens, streamed.String())
+					}
+					spent += al.recordLLMEvent(ev)
 					return nil, fbErr
 				}
 				if fbResult.Provider != "" && len(fbResult.Attempts) > 0 {
-					logger.InfoCF("agent", fmt.Sprintf("Fallback: succeeded with %s/%s after %d attempts",
+					logger.InfoCtx(ctx, "agent", fmt.Sprintf("Fallback: succeeded with %s/%s after %d attempts",
 						fbResult.Provider, fbResult.Model, len(fbResult.Attempts)+1),
 						map[string]any{"agent_id": agent.ID, "iteration": iteration})
 				}
+				ev.Provider, ev.Model = fbResult.Provider, fbResult.Model
+				ev.Route = agent.routeName(fbResult.Provider, fbResult.Model)
+				ev.Attempts = llmAttempts(fbResult.Attempts)
+				setLLMUsage(&ev, fbResult.Response)
+				if fbResult.Model == model {
+					calibrateTokens(model, promptTokens, fbResult.Response)
+				}
+				spent += al.recordLLMEvent(ev)
 				return fbResult.Response, nil
 			}
-			return agent.Provider.Chat(ctx, messages, providerToolDefs, agent.Model, map[string]any{
-				"max_tokens":  agent.MaxTokens,
-				"temperature": agent.Temperature,
-			})
+
+			callCtx, cancel := agent.llmContext(ctx)
+			defer cancel()
+			resp, err := chatLLM(callCtx, llmProvider, messages, providerToolDefs, model, llmOptions, onDelta, onToolCall)
+			ev.DurationMS = time.Since(started).Milliseconds()
+			ev.Provider, ev.Route = vendor, route
+			if len(agent.Candidates) > 0 && route == "" {
+				ev.Provider = agent.Candidates[0].Provider
+			}
+			if err != nil {
+				ev.Error = err.Error()
+				if ctx.Err() != nil {
+					setCancelledUsage(ctx, &ev, model, promptTokens, streamed.String())
+				}
+			}
+			setLLMUsage(&ev, resp)
+			calibrateTokens(model, promptTokens, resp)
+			spent += al.recordLLMEvent(ev)
+			return resp, err
+		}
+		callLLM := func() (*providers.LLMResponse, error) {
+			if al.responses == nil {
+				return requestLLM()
+			}
+			key := responseCacheKey(model, messages, providerToolDefs, llmOptions)
+			if resp, ok := al.responses.Get(key); ok {
+				al.recordLLMEvent(state.LLMEvent{
+					AgentID: agent.ID, SessionKey: opts.SessionKey, Iteration: iteration,
+					Provider: vendor, Model: model, Route: route, Cached: true, TaskID: state.TaskID(ctx),
+				})
+				return resp, nil
+			}
+			resp, err := requestLLM()
+			if err == nil && (resp.Content != "" || len(resp.ToolCalls) > 0) {
+				al.responses.Put(key, resp)
+			}
+			return resp, err
 		}
 
 		// Retry loop for context/token errors
@@ -553,14 +1161,8 @@ func (al *AgentLoop) runLLMIteration(
 				break
 			}
 
-			errMsg := strings.ToLower(err.Error())
-			isContextError := strings.Contains(errMsg, "token") ||
-				strings.Contains(errMsg, "context") ||
-				strings.Contains(errMsg, "invalidparameter") ||
-				strings.Contains(errMsg, "length")
-
-			if isContextError && retry < maxRetries {
-				logger.WarnCF("agent", "Context window error detected, attempting compression", map[string]any{
+			if isContextOverflow(err) && retry < maxRetries {
+				logger.WarnCtx(ctx, "agent", "Context window error detected, attempting compression", map[string]any{
 					"error": err.Error(),
 					"retry": retry,
 				})
@@ -569,7 +1171,7 @@ func (al *AgentLoop) runLLMIteration(
 					al.bus.PublishOutbound(bus.OutboundMessage{
 						Channel: opts.Channel,
 						ChatID:  opts.ChatID,
-						Content: "Context window exceeded. Compressing history and retrying...",
+						Content: i18n.T(al.chatLanguage(opts.Channel, opts.ChatID), "Context window exceeded. Compressing history and retrying..."),
 					})
 				}
 
@@ -578,27 +1180,52 @@ func (al *AgentLoop) runLLMIteration(
 				newSummary := agent.Sessions.GetSummary(opts.SessionKey)
 				messages = agent.ContextBuilder.BuildMessages(
 					newHistory, newSummary, "",
-					nil, opts.Channel, opts.ChatID,
+					nil, opts.Channel, opts.ChatID, opts.SessionNotes,
 				)
 				continue
 			}
 			break
 		}
 
+		// Still too long after compression: rather than fail the run, move
+		// to the overflow model, which has a larger window, for the rest of
+		// the turn.
+		if err != nil && isContextOverflow(err) && al.canOverflow(agent, modelOverride) {
+			al.recordRunEvent(state.RunEvent{
+				Kind:    "model_downgrade",
+				Source:  agent.ID,
+				Message: fmt.Sprintf("context overflow on %s, retried with %s: %v", model, agent.OverflowModel, err),
+			})
+			logger.WarnCtx(ctx, "agent", "Context overflow, switching to the overflow model",
+				map[string]any{"agent_id": agent.ID, "from": model, "to": agent.OverflowModel})
+			modelOverride = agent.OverflowModel
+			model, llmProvider, vendor, route, window = al.requestModel(agent, modelOverride)
+			llmOptions["context_window"] = window
+			messages, promptTokens = fitContext(model, messages, providerToolDefs,
+				promptBudget(window, agent.MaxTokens), agent.ContextStrategy)
+			response, err = callLLM()
+		}
+
 		if err != nil {
-			logger.ErrorCF("agent", "LLM call failed",
+			prefetch.wait()
+			logger.ErrorCtx(ctx, "agent", "LLM call failed",
 				map[string]any{
 					"agent_id":  agent.ID,
 					"iteration": iteration,
 					"error":     err.Error(),
 				})
-			return "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
+			return "", "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
 		}
 
+		// Reasoning written inline in the answer is never sent to the user.
+		providers.SeparateReasoning(response)
+
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
+			prefetch.wait()
 			finalContent = response.Content
-			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
+			finalReasoning = response.ReasoningContent
+			logger.InfoCtx(ctx, "agent", "LLM response without tool calls (direct answer)",
 				map[string]any{
 					"agent_id":      agent.ID,
 					"iteration":     iteration,
@@ -617,7 +1244,7 @@ func (al *AgentLoop) runLLMIteration(
 		for _, tc := range normalizedToolCalls {
 			toolNames = append(toolNames, tc.Name)
 		}
-		logger.InfoCF("agent", "LLM requested tool calls",
+		logger.InfoCtx(ctx, "agent", "LLM requested tool calls",
 			map[string]any{
 				"agent_id":  agent.ID,
 				"tools":     toolNames,
@@ -656,56 +1283,18 @@ func (al *AgentLoop) runLLMIteration(
 		messages = append(messages, assistantMsg)
 
 		// Save assistant message with tool calls to session
-		agent.Sessions.AddFullMessage(opts.SessionKey, assistantMsg)
+		stored := assistantMsg
+		if !agent.KeepReasoning {
+			stored.ReasoningContent = ""
+		}
+		agent.Sessions.AddFullMessage(opts.SessionKey, stored)
 
-		// Execute tool calls
+		// Execute tool calls, picking up the ones already run while the
+		// response was streaming.
 		for _, tc := range normalizedToolCalls {
-			argsJSON, _ := json.Marshal(tc.Arguments)
-			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
-				map[string]any{
-					"agent_id":  agent.ID,
-					"tool":      tc.Name,
-					"iteration": iteration,
-				})
-
-			// Create async callback for tools that implement AsyncTool
-			// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
-			// Instead, they notify the agent via PublishInbound, and the agent decides
-			// whether to forward the result to the user (in processSystemMessage).
-			asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
-				// Log the async completion but don't send directly to user
-				// The agent will handle user notification via processSystemMessage
-				if !result.Silent && result.ForUser != "" {
-					logger.InfoCF("agent", "Async tool completed, agent will handle notification",
-						map[string]any{
-							"tool":        tc.Name,
-							"content_len": len(result.ForUser),
-						})
-				}
-			}
-
-			toolResult := agent.Tools.ExecuteWithContext(
-				ctx,
-				tc.Name,
-				tc.Arguments,
-				opts.Channel,
-				opts.ChatID,
-				asyncCallback,
-			)
-
-			// Send ForUser content to user immediately if not Silent
-			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
-				al.bus.PublishOutbound(bus.OutboundMessage{
-					Channel: opts.Channel,
-					ChatID:  opts.ChatID,
-					Content: toolResult.ForUser,
-				})
-				logger.DebugCF("agent", "Sent tool result to user",
-					map[string]any{
-						"tool":        tc.Name,
-						"content_len": len(toolResult.ForUser),
-					})
+			toolResult, ok := prefetch.take(tc)
+			if !ok {
+				toolResult = al.runTool(ctx, agent, opts, tc, iteration)
 			}
 
 			// Determine content for LLM based on tool result
@@ -724,9 +1313,179 @@ func (al *AgentLoop) runLLMIteration(
 			// Save tool result message to session
 			agent.Sessions.AddFullMessage(opts.SessionKey, toolResultMsg)
 		}
+		prefetch.wait()
+	}
+
+	return finalContent, finalReasoning, iteration, nil
+}
+
+// runTool executes one tool call of the model and sends what the tool has
+// for the user straight to the chat.
+func (al *AgentLoop) runTool(
+	ctx context.Context,
+	agent *AgentInstance,
+	opts processOptions,
+	tc providers.ToolCall,
+	iteration int,
+) *tools.ToolResult {
+	argsJSON, _ := json.Marshal(tc.Arguments)
+	argsPreview := utils.Truncate(string(argsJSON), 200)
+	logger.InfoCtx(ctx, "agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
+		map[string]any{
+			"agent_id":  agent.ID,
+			"tool":      tc.Name,
+			"iteration": iteration,
+		})
+
+	// Create async callback for tools that implement AsyncTool
+	// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
+	// Instead, they notify the agent via PublishInbound, and the agent decides
+	// whether to forward the result to the user (in processSystemMessage).
+	asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
+		// Log the async completion but don't send directly to user
+		// The agent will handle user notification via processSystemMessage
+		if !result.Silent && result.ForUser != "" {
+			logger.InfoCtx(ctx, "agent", "Async tool completed, agent will handle notification",
+				map[string]any{
+					"tool":        tc.Name,
+					"content_len": len(result.ForUser),
+				})
+		}
+	}
+
+	// The model may call a tool it saw before a flag took it away.
+	if reason := al.flags.toolBlocked(tc.Name); reason != "" {
+		al.Audit(state.AuditEntry{Action: "tool", Actor: "agent:" + agent.ID, Target: tc.Name, Outcome: "denied", Detail: reason})
+		return tools.ErrorResult(reason)
+	}
+	if opts.NoTools || len(opts.Tools) > 0 && !slices.Contains(opts.Tools, tc.Name) {
+		al.Audit(state.AuditEntry{
+			Action: "tool", Actor: "agent:" + agent.ID, Target: tc.Name, Outcome: "denied",
+			Detail: "not among the tools of the run",
+		})
+		return tools.ErrorResult(fmt.Sprintf("The tool %s is not available here.", tc.Name))
+	}
+
+	opts.Presence.ToolStarted(ctx)
+
+	execute := func() *tools.ToolResult {
+		return agent.Tools.ExecuteWithContext(
+			ctx,
+			tc.Name,
+			tc.Arguments,
+			opts.Channel,
+			opts.ChatID,
+			asyncCallback,
+		)
+	}
+	var toolResult *tools.ToolResult
+	started := time.Now()
+	if runFrom(ctx) == nil {
+		toolResult = execute()
+	} else {
+		// A tool that does not give up when the run is cancelled is left
+		// to finish on its own, so it cannot hold up the chat.
+		done := startToolCall(ctx, tc.Name)
+		result := make(chan *tools.ToolResult, 1)
+		panicked := make(chan *toolPanic, 1)
+		go func() {
+			// A panic is carried over to the run, which reports it.
+			defer func() {
+				if r := recover(); r != nil {
+					panicked <- &toolPanic{tool: tc.Name, value: r, stack: debug.Stack()}
+				}
+			}()
+			result <- execute()
+		}()
+		select {
+		case toolResult = <-result:
+		case p := <-panicked:
+			done()
+			panic(p)
+		case <-ctx.Done():
+			toolResult = tools.ErrorResult(fmt.Sprintf("The tool %s was cancelled: %v", tc.Name, context.Cause(ctx)))
+		}
+		done()
+	}
+	call := events.ToolCall{
+		AgentID: agent.ID, SessionKey: opts.SessionKey, TaskID: state.TaskID(ctx),
+		Tool: tc.Name, Iteration: iteration, Duration: time.Since(started),
+	}
+	if toolResult.IsError {
+		call.Error = utils.Truncate(toolResult.ForLLM, 200)
 	}
+	events.Publish(al.eventBus, events.ToolExecuted, call)
+	trailFrom(ctx).add(call)
 
-	return finalContent, iteration, nil
+	// Send ForUser content to user immediately if not Silent
+	if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:   opts.Channel,
+			ChatID:    opts.ChatID,
+			Content:   toolResult.ForUser,
+			Proactive: providers.IsBackground(ctx),
+		})
+		logger.DebugCtx(ctx, "agent", "Sent tool result to user",
+			map[string]any{
+				"tool":        tc.Name,
+				"content_len": len(toolResult.ForUser),
+			})
+	}
+
+	return toolResult
+}
+
+// streamSink returns a callback that forwards partial LLM output to the target
+// channel, or nil when the channel cannot render it.
+func (al *AgentLoop) streamSink(agent *AgentInstance, opts processOptions) func(string) {
+	if al.channelManager == nil || opts.ChatID == "" || constants.IsInternalChannel(opts.Channel) {
+		return nil
+	}
+	// An answer under review may still be replaced.
+	if agent.Critique != nil {
+		return nil
+	}
+	// Heartbeat runs (NoHistory) often end in a reply that is never delivered.
+	if opts.NoHistory {
+		return nil
+	}
+	ch, ok := al.channelManager.GetChannel(opts.Channel)
+	if !ok {
+		return nil
+	}
+	sc, ok := ch.(channels.StreamingChannel)
+	if !ok || !ch.Capabilities().Streaming {
+		return nil
+	}
+	return providers.HideThinking(func(delta string) {
+		sc.SendDelta(opts.ChatID, delta)
+	})
+}
+
+// chatLLM calls the provider, streaming through onDelta when both a sink and
+// a streaming-capable provider are available. Providers that report tool
+// calls while streaming pass them to onToolCall.
+func chatLLM(
+	ctx context.Context,
+	provider providers.LLMProvider,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(string),
+	onToolCall func(providers.ToolCall),
+) (*providers.LLMResponse, error) {
+	if onToolCall != nil {
+		if tp, ok := provider.(providers.ToolStreamingProvider); ok {
+			return tp.ChatStreamTools(ctx, messages, tools, model, options, onDelta, onToolCall)
+		}
+	}
+	if onDelta != nil {
+		if sp, ok := provider.(providers.StreamingProvider); ok {
+			return sp.ChatStream(ctx, messages, tools, model, options, onDelta)
+		}
+	}
+	return provider.Chat(ctx, messages, tools, model, options)
 }
 
 // updateToolContexts updates the context for tools that need channel/chatID info.
@@ -742,6 +1501,11 @@ func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID st
 			st.SetContext(channel, chatID)
 		}
 	}
+	if tool, ok := agent.Tools.Get("send_message"); ok {
+		if st, ok := tool.(tools.ContextualTool); ok {
+			st.SetContext(channel, chatID)
+		}
+	}
 	if tool, ok := agent.Tools.Get("subagent"); ok {
 		if st, ok := tool.(tools.ContextualTool); ok {
 			st.SetContext(channel, chatID)
@@ -751,11 +1515,13 @@ func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID st
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, chatID string) {
-	newHistory := agent.Sessions.GetHistory(sessionKey)
-	tokenEstimate := al.estimateTokens(newHistory)
+	var length, tokenEstimate int
+	agent.Sessions.ReadHistory(sessionKey, func(history []providers.Message) {
+		length, tokenEstimate = len(history), historyTokens(agent.Model, history)
+	})
 	threshold := agent.ContextWindow * 75 / 100
 
-	if len(newHistory) > 20 || tokenEstimate > threshold {
+	if length > 20 || tokenEstimate > threshold {
 		summarizeKey := agent.ID + ":" + sessionKey
 		if _, loading := al.summarizing.LoadOrStore(summarizeKey, true); !loading {
 			go func() {
@@ -764,7 +1530,7 @@ func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, c
 					al.bus.PublishOutbound(bus.OutboundMessage{
 						Channel: channel,
 						ChatID:  chatID,
-						Content: "Memory threshold reached. Optimizing conversation history...",
+						Content: i18n.T(al.chatLanguage(channel, chatID), "Memory threshold reached. Optimizing conversation history..."),
 					})
 				}
 				al.summarizeSession(agent, sessionKey)
@@ -929,7 +1695,7 @@ func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
 		if m.Role != "user" && m.Role != "assistant" {
 			continue
 		}
-		msgTokens := len(m.Content) / 2
+		msgTokens := messageTokens(agent.Model, m)
 		if msgTokens > maxMessageTokens {
 			omitted = true
 			continue
@@ -1022,18 +1788,6 @@ func (al *AgentLoop) summarizeBatch(
 	return response.Content, nil
 }
 
-// estimateTokens estimates the number of tokens in a message list.
-// Uses a safe heuristic of 2.5 characters per token to account for CJK and other
-// overheads better than the previous 3 chars/token.
-func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
-	totalChars := 0
-	for _, m := range messages {
-		totalChars += utf8.RuneCountInString(m.Content)
-	}
-	// 2.5 chars per token = totalChars * 2 / 5
-	return totalChars * 2 / 5
-}
-
 func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
 	content := strings.TrimSpace(msg.Content)
 	if !strings.HasPrefix(content, "/") {
@@ -1051,50 +1805,50 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 	switch cmd {
 	case "/show":
 		if len(args) < 1 {
-			return "Usage: /show [model|channel|agents]", true
+			return al.t(msg, "Usage: /show [model|channel|agents]"), true
 		}
 		switch args[0] {
 		case "model":
 			defaultAgent := al.registry.GetDefaultAgent()
 			if defaultAgent == nil {
-				return "No default agent configured", true
+				return al.t(msg, "No default agent configured"), true
 			}
-			return fmt.Sprintf("Current model: %s", defaultAgent.Model), true
+			return al.t(msg, "Current model: %s", defaultAgent.Model), true
 		case "channel":
-			return fmt.Sprintf("Current channel: %s", msg.Channel), true
+			return al.t(msg, "Current channel: %s", msg.Channel), true
 		case "agents":
 			agentIDs := al.registry.ListAgentIDs()
-			return fmt.Sprintf("Registered agents: %s", strings.Join(agentIDs, ", ")), true
+			return al.t(msg, "Registered agents: %s", strings.Join(agentIDs, ", ")), true
 		default:
-			return fmt.Sprintf("Unknown show target: %s", args[0]), true
+			return al.t(msg, "Unknown show target: %s", args[0]), true
 		}
 
 	case "/list":
 		if len(args) < 1 {
-			return "Usage: /list [models|channels|agents]", true
+			return al.t(msg, "Usage: /list [models|channels|agents]"), true
 		}
 		switch args[0] {
 		case "models":
-			return "Available models: configured in config.json per agent", true
+			return al.t(msg, "Available models: configured in config.json per agent"), true
 		case "channels":
 			if al.channelManager == nil {
-				return "Channel manager not initialized", true
+				return al.t(msg, "Channel manager not initialized"), true
 			}
 			channels := al.channelManager.GetEnabledChannels()
 			if len(channels) == 0 {
-				return "No channels enabled", true
+				return al.t(msg, "No channels enabled"), true
 			}
-			return fmt.Sprintf("Enabled channels: %s", strings.Join(channels, ", ")), true
+			return al.t(msg, "Enabled channels: %s", strings.Join(channels, ", ")), true
 		case "agents":
 			agentIDs := al.registry.ListAgentIDs()
-			return fmt.Sprintf("Registered agents: %s", strings.Join(agentIDs, ", ")), true
+			return al.t(msg, "Registered agents: %s", strings.Join(agentIDs, ", ")), true
 		default:
-			return fmt.Sprintf("Unknown list target: %s", args[0]), true
+			return al.t(msg, "Unknown list target: %s", args[0]), true
 		}
 
 	case "/switch":
 		if len(args) < 3 || args[1] != "to" {
-			return "Usage: /switch [model|channel] to <name>", true
+			return al.t(msg, "Usage: /switch [model|channel] to <name>"), true
 		}
 		target := args[0]
 		value := args[2]
@@ -1103,27 +1857,103 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		case "model":
 			defaultAgent := al.registry.GetDefaultAgent()
 			if defaultAgent == nil {
-				return "No default agent configured", true
+				return al.t(msg, "No default agent configured"), true
 			}
 			oldModel := defaultAgent.Model
 			defaultAgent.Model = value
-			return fmt.Sprintf("Switched model from %s to %s", oldModel, value), true
+			return al.t(msg, "Switched model from %s to %s", oldModel, value), true
 		case "channel":
 			if al.channelManager == nil {
-				return "Channel manager not initialized", true
+				return al.t(msg, "Channel manager not initialized"), true
 			}
 			if _, exists := al.channelManager.GetChannel(value); !exists && value != "cli" {
-				return fmt.Sprintf("Channel '%s' not found or not enabled", value), true
+				return al.t(msg, "Channel '%s' not found or not enabled", value), true
 			}
-			return fmt.Sprintf("Switched target channel to %s", value), true
+			return al.t(msg, "Switched target channel to %s", value), true
 		default:
-			return fmt.Sprintf("Unknown switch target: %s", target), true
+			return al.t(msg, "Unknown switch target: %s", target), true
+		}
+
+	case "/status":
+		if !al.isAdminChat(msg) {
+			return al.adminOnly(msg, cmd), true
+		}
+		return al.Status().String(), true
+
+	case "/usage":
+		if !al.isAdminChat(msg) {
+			return al.adminOnly(msg, cmd), true
+		}
+		return al.usageReport(time.Now()), true
+
+	case "/profile":
+		return al.handleProfileCommand(msg, args), true
+
+	case "/language":
+		return al.handleLanguageCommand(msg, args), true
+
+	case "/schedule":
+		return al.handleScheduleCommand(msg, args), true
+
+	case "/jobs":
+		return al.handleJobsCommand(msg, args), true
+
+	case "/workflow":
+		if !al.isAdminChat(msg) {
+			return al.adminOnly(msg, cmd), true
+		}
+		return al.handleWorkflowCommand(msg, args), true
+
+	case "/dnd":
+		if !al.isAdminChat(msg) {
+			return al.adminOnly(msg, cmd), true
+		}
+		return al.handleDNDCommand(msg, args), true
+
+	case "/help":
+		return al.helpText(msg), true
+
+	case "/erase":
+		return al.handleEraseCommand(msg, args), true
+
+	case "/broadcast":
+		if !al.isAdminChat(msg) {
+			return al.adminOnly(msg, cmd), true
 		}
+		al.auditCommand(msg, "ok")
+		if al.channelManager == nil {
+			return al.t(msg, "Channel manager not initialized"), true
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(content, cmd))
+		if text == "" {
+			return al.t(msg, "Usage: /broadcast <message>"), true
+		}
+		if len(al.cfg.Channels.Broadcast.Targets) == 0 {
+			return al.t(msg, "No broadcast targets configured"), true
+		}
+		return formatBroadcastResults(al.channelManager.Broadcast(ctx, nil, text)), true
 	}
 
 	return "", false
 }
 
+func formatBroadcastResults(results []channels.BroadcastResult) string {
+	delivered := 0
+	var failures []string
+	for _, r := range results {
+		if r.Err == nil {
+			delivered++
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("- %s: %v", r.Target, r.Err))
+	}
+	out := fmt.Sprintf("Broadcast delivered to %d of %d chats", delivered, len(results))
+	if len(failures) > 0 {
+		out += "\nFailed:\n" + strings.Join(failures, "\n")
+	}
+	return out
+}
+
 // extractPeer extracts the routing peer from inbound message metadata.
 func extractPeer(msg bus.InboundMessage) *routing.RoutePeer {
 	peerKind := msg.Metadata["peer_kind"]
@@ -3,14 +3,21 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -37,7 +44,7 @@ func TestRecordLastChannel(t *testing.T) {
 	// Create agent loop
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Test RecordLastChannel
 	testChannel := "test-channel"
@@ -53,7 +60,7 @@ func TestRecordLastChannel(t *testing.T) {
 	}
 
 	// Verify persistence by creating a new agent loop
-	al2 := NewAgentLoop(cfg, msgBus, provider)
+	al2 := newTestLoop(t, cfg, msgBus, provider)
 	if al2.state.GetLastChannel() != testChannel {
 		t.Errorf("Expected persistent channel '%s', got '%s'", testChannel, al2.state.GetLastChannel())
 	}
@@ -82,7 +89,7 @@ func TestRecordLastChatID(t *testing.T) {
 	// Create agent loop
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Test RecordLastChatID
 	testChatID := "test-chat-id-123"
@@ -98,7 +105,7 @@ func TestRecordLastChatID(t *testing.T) {
 	}
 
 	// Verify persistence by creating a new agent loop
-	al2 := NewAgentLoop(cfg, msgBus, provider)
+	al2 := newTestLoop(t, cfg, msgBus, provider)
 	if al2.state.GetLastChatID() != testChatID {
 		t.Errorf("Expected persistent chat ID '%s', got '%s'", testChatID, al2.state.GetLastChatID())
 	}
@@ -127,7 +134,7 @@ func TestNewAgentLoop_StateInitialized(t *testing.T) {
 	// Create agent loop
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Verify state manager is initialized
 	if al.state == nil {
@@ -162,7 +169,7 @@ func TestToolRegistry_ToolRegistration(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Register a custom tool
 	customTool := &mockCustomTool{}
@@ -208,7 +215,7 @@ func TestToolContext_Updates(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &simpleMockProvider{response: "OK"}
-	_ = NewAgentLoop(cfg, msgBus, provider)
+	_ = newTestLoop(t, cfg, msgBus, provider)
 
 	// Verify that ContextualTool interface is defined and can be implemented
 	// This test validates the interface contract exists
@@ -239,7 +246,7 @@ func TestToolRegistry_GetDefinitions(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Register a test tool and verify it shows up in startup info
 	testTool := &mockCustomTool{}
@@ -283,7 +290,7 @@ func TestAgentLoop_GetStartupInfo(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	info := al.GetStartupInfo()
 
@@ -330,7 +337,7 @@ func TestAgentLoop_Stop(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &mockProvider{}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Note: running is only set to true when Run() is called
 	// We can't test that without starting the event loop
@@ -419,6 +426,38 @@ func (m *mockContextualTool) SetContext(channel, chatID string) {
 }
 
 // testHelper executes a message and returns the response
+// newTestLoop is NewAgentLoop, failing the test when it fails.
+func newTestLoop(tb testing.TB, cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
+	tb.Helper()
+	al, err := NewAgentLoop(cfg, msgBus, provider)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return al
+}
+
+// newTestRegistry is NewAgentRegistry, failing the test when it fails.
+func newTestRegistry(tb testing.TB, cfg *config.Config, provider providers.LLMProvider) *AgentRegistry {
+	tb.Helper()
+	registry, err := NewAgentRegistry(cfg, provider)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return registry
+}
+
+// newTestInstance is NewAgentInstance, failing the test when it fails.
+func newTestInstance(tb testing.TB, agentCfg *config.AgentConfig, defaults *config.AgentDefaults,
+	cfg *config.Config, provider providers.LLMProvider,
+) *AgentInstance {
+	tb.Helper()
+	agent, err := NewAgentInstance(agentCfg, defaults, cfg, provider)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return agent
+}
+
 type testHelper struct {
 	al *AgentLoop
 }
@@ -458,7 +497,7 @@ func TestToolResult_SilentToolDoesNotSendUserMessage(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &simpleMockProvider{response: "File operation complete"}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 	helper := testHelper{al: al}
 
 	// ReadFileTool returns SilentResult, which should not send user message
@@ -500,7 +539,7 @@ func TestToolResult_UserFacingToolDoesSendMessage(t *testing.T) {
 
 	msgBus := bus.NewMessageBus()
 	provider := &simpleMockProvider{response: "Command output: hello world"}
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 	helper := testHelper{al: al}
 
 	// ExecTool returns UserResult, which should send user message
@@ -579,7 +618,7 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		successResp: "Recovered from context error",
 	}
 
-	al := NewAgentLoop(cfg, msgBus, provider)
+	al := newTestLoop(t, cfg, msgBus, provider)
 
 	// Inject some history to simulate a full context
 	sessionKey := "test-session-context"
@@ -631,3 +670,436 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+type streamingMockProvider struct {
+	simpleMockProvider
+	chunks []string
+}
+
+func (m *streamingMockProvider) ChatStream(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+	onDelta func(string),
+) (*providers.LLMResponse, error) {
+	for _, c := range m.chunks {
+		onDelta(c)
+	}
+	return m.Chat(ctx, messages, tools, model, opts)
+}
+
+type recordingStreamChannel struct {
+	*channels.BaseChannel
+	deltas []string
+}
+
+func (c *recordingStreamChannel) Start(ctx context.Context) error { return nil }
+func (c *recordingStreamChannel) Stop(ctx context.Context) error  { return nil }
+func (c *recordingStreamChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+
+func (c *recordingStreamChannel) Capabilities() channels.Capabilities {
+	return channels.Capabilities{Streaming: true}
+}
+
+func (c *recordingStreamChannel) SendDelta(chatID, delta string) {
+	c.deltas = append(c.deltas, chatID+":"+delta)
+}
+
+// TestAgentLoop_StreamsToStreamingChannel verifies partial output reaches
+// channels that implement StreamingChannel.
+func TestAgentLoop_StreamsToStreamingChannel(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	provider := &streamingMockProvider{
+		simpleMockProvider: simpleMockProvider{response: "Hello world"},
+		chunks:             []string{"Hello", " world"},
+	}
+	al := newTestLoop(t, cfg, msgBus, provider)
+
+	cm, err := channels.NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	streamCh := &recordingStreamChannel{BaseChannel: channels.NewBaseChannel("stream", nil, msgBus, nil)}
+	cm.RegisterChannel("stream", streamCh)
+	al.SetChannelManager(cm)
+
+	helper := testHelper{al: al}
+	response := helper.executeAndGetResponse(t, context.Background(), bus.InboundMessage{
+		Channel:    "stream",
+		SenderID:   "user1",
+		ChatID:     "chat1",
+		Content:    "hi",
+		SessionKey: "stream-session",
+	})
+
+	if response != "Hello world" {
+		t.Errorf("response = %q", response)
+	}
+	if got := fmt.Sprint(streamCh.deltas); got != "[chat1:Hello chat1: world]" {
+		t.Errorf("deltas = %s", got)
+	}
+}
+
+// toolStreamingMockProvider reports a tool call while "streaming" and only
+// finishes its response once the tool has run.
+type toolStreamingMockProvider struct {
+	simpleMockProvider
+	ran            chan struct{}
+	ranWhileStream bool
+}
+
+func (m *toolStreamingMockProvider) ChatStream(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+	onDelta func(string),
+) (*providers.LLMResponse, error) {
+	return m.ChatStreamTools(ctx, messages, tools, model, opts, onDelta, nil)
+}
+
+func (m *toolStreamingMockProvider) ChatStreamTools(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+	onDelta func(string),
+	onToolCall func(providers.ToolCall),
+) (*providers.LLMResponse, error) {
+	if messages[len(messages)-1].Role == "tool" {
+		return m.Chat(ctx, messages, tools, model, opts)
+	}
+	tc := providers.ToolCall{ID: "call_1", Name: "slow_tool", Arguments: map[string]any{"n": 1.0}}
+	onToolCall(tc)
+	select {
+	case <-m.ran:
+		m.ranWhileStream = true
+	case <-time.After(2 * time.Second):
+	}
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{tc}, FinishReason: "tool_calls"}, nil
+}
+
+type countingTool struct {
+	mu    sync.Mutex
+	calls int
+	ran   chan struct{}
+}
+
+func (t *countingTool) Name() string               { return "slow_tool" }
+func (t *countingTool) Description() string        { return "Counts its calls" }
+func (t *countingTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+
+func (t *countingTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls++
+	if t.calls == 1 {
+		close(t.ran)
+	}
+	return tools.SilentResult("ok")
+}
+
+func TestAgentLoop_RunsStreamedToolCallsEarly(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+
+	ran := make(chan struct{})
+	provider := &toolStreamingMockProvider{simpleMockProvider: simpleMockProvider{response: "done"}, ran: ran}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	tool := &countingTool{ran: ran}
+	al.RegisterTool(tool)
+
+	response, err := al.ProcessDirectWithChannel(context.Background(), "go", "early-tools", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error = %v", err)
+	}
+	if response != "done" {
+		t.Errorf("response = %q", response)
+	}
+	if !provider.ranWhileStream {
+		t.Error("tool did not run while the response was streaming")
+	}
+	if tool.calls != 1 {
+		t.Errorf("tool ran %d times, want 1", tool.calls)
+	}
+}
+
+type countingMockProvider struct {
+	simpleMockProvider
+	calls int
+}
+
+func (m *countingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	return &providers.LLMResponse{
+		Content: fmt.Sprintf("%s %d", m.response, m.calls),
+		Usage:   &providers.UsageInfo{PromptTokens: 100, CompletionTokens: 5},
+	}, nil
+}
+
+func TestAgentLoop_CachesRepeatedHeartbeats(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				ResponseCacheTTL:  60,
+			},
+		},
+	}
+
+	provider := &countingMockProvider{simpleMockProvider: simpleMockProvider{response: "checked"}}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	for range 2 {
+		response, err := al.ProcessHeartbeat(context.Background(), "check the feeds", "cli", "direct")
+		if err != nil || response != "checked 1" {
+			t.Fatalf("ProcessHeartbeat() = %q, %v", response, err)
+		}
+	}
+	if _, err := al.ProcessHeartbeat(context.Background(), "check the mail", "cli", "direct"); err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want 2", provider.calls)
+	}
+
+	events, err := state.NewLLMEventLog(workspace).Recent(10)
+	if err != nil || len(events) != 3 {
+		t.Fatalf("llm events = %+v, %v", events, err)
+	}
+	if events[0].Cached || !events[1].Cached || events[1].PromptTokens != 0 || events[2].Cached {
+		t.Errorf("cached = %v, %v, %v", events[0].Cached, events[1].Cached, events[2].Cached)
+	}
+}
+
+type overflowMockProvider struct{ calls int }
+
+func (m *overflowMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	m.calls++
+	return nil, fmt.Errorf("API request failed: This model's maximum context length is 8192 tokens")
+}
+
+func (m *overflowMockProvider) GetDefaultModel() string { return "small-model" }
+
+func TestAgentLoop_DowngradesOnContextOverflow(t *testing.T) {
+	var models []string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		models = append(models, r.URL.Path)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"from the big model"},"done":true,"done_reason":"stop"}`)
+	}))
+	defer ollama.Close()
+
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "small-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 10,
+				OverflowModel:     "big",
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "big", Model: "ollama/qwen2.5:14b", APIBase: ollama.URL, ContextWindow: 131072},
+		},
+	}
+
+	provider := &overflowMockProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	response, err := al.ProcessDirectWithChannel(context.Background(), "summarize this", "overflow", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error = %v", err)
+	}
+	if response != "from the big model" {
+		t.Errorf("response = %q", response)
+	}
+	// The first request and two retries after compression.
+	if provider.calls != 3 || len(models) != 1 {
+		t.Errorf("small model called %d times, big model %d times", provider.calls, len(models))
+	}
+
+	events, err := state.NewEventLog(workspace).Recent(10)
+	if err != nil || len(events) != 1 || events[0].Kind != "model_downgrade" || events[0].Source != "main" ||
+		!strings.Contains(events[0].Message, "small-model") {
+		t.Errorf("run events = %+v, %v", events, err)
+	}
+}
+
+func TestChannelNotes(t *testing.T) {
+	if notes := channelNotes(channels.Capabilities{Markdown: format.Discord, MaxMessageLength: 4096}); notes != "" {
+		t.Errorf("rich channel got notes %q", notes)
+	}
+	notes := channelNotes(channels.Capabilities{Markdown: format.Plain, MaxMessageLength: 160})
+	if !strings.Contains(notes, "plain text only") || !strings.Contains(notes, "160 characters") {
+		t.Errorf("notes = %q", notes)
+	}
+}
+
+// hangingMockProvider never answers, like an upstream that stopped responding.
+type hangingMockProvider struct{}
+
+func (m *hangingMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *hangingMockProvider) GetDefaultModel() string { return "hanging-model" }
+
+// TestAgentLoop_FailsOverToLocalRoute verifies that a timed-out request moves
+// on to a model_list route with its own provider, and that the serving route
+// is recorded in llm_events.jsonl.
+func TestAgentLoop_FailsOverToLocalRoute(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"from the local model"},"done":true,"done_reason":"stop"}`)
+	}))
+	defer ollama.Close()
+
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Provider:          "openrouter",
+				Model:             "openai/gpt-4o",
+				ModelFallbacks:    []string{"local"},
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				LLMTimeoutSeconds: 1,
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "local", Model: "ollama/llama3.2", APIBase: ollama.URL},
+		},
+	}
+
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &hangingMockProvider{})
+	response, err := al.ProcessDirectWithChannel(context.Background(), "hi", "failover", "cli", "direct")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error = %v", err)
+	}
+	if response != "from the local model" {
+		t.Errorf("response = %q", response)
+	}
+
+	events, err := state.NewLLMEventLog(workspace).Recent(10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("llm events = %+v, %v", events, err)
+	}
+	ev := events[0]
+	if ev.Provider != "ollama" || ev.Model != "llama3.2" || ev.Route != "local" {
+		t.Errorf("served by %s/%s (route %q)", ev.Provider, ev.Model, ev.Route)
+	}
+	if len(ev.Attempts) != 1 || ev.Attempts[0].Reason != string(providers.FailoverTimeout) {
+		t.Errorf("attempts = %+v", ev.Attempts)
+	}
+}
+
+// reasoningMockProvider calls a tool with some reasoning, then answers
+// with its reasoning inline.
+type reasoningMockProvider struct{}
+
+func (m *reasoningMockProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	if messages[len(messages)-1].Role == "tool" {
+		return &providers.LLMResponse{Content: "<think>it ran</think>\n\nDone.", FinishReason: "stop"}, nil
+	}
+	return &providers.LLMResponse{
+		ReasoningContent: "call the tool",
+		ToolCalls:        []providers.ToolCall{{ID: "call_1", Name: "slow_tool", Arguments: map[string]any{}}},
+		FinishReason:     "tool_calls",
+	}, nil
+}
+
+func (m *reasoningMockProvider) GetDefaultModel() string { return "test-model" }
+
+func TestAgentLoop_SeparatesReasoning(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		cfg := &config.Config{
+			Agents: config.AgentsConfig{
+				Defaults: config.AgentDefaults{
+					Workspace:         t.TempDir(),
+					Model:             "test-model",
+					MaxTokens:         4096,
+					MaxToolIterations: 10,
+					KeepReasoning:     keep,
+				},
+			},
+		}
+		al := newTestLoop(t, cfg, bus.NewMessageBus(), &reasoningMockProvider{})
+		al.RegisterTool(&countingTool{ran: make(chan struct{})})
+
+		response, err := al.ProcessDirectWithChannel(context.Background(), "go", "agent:main:reasoning", "cli", "direct")
+		if err != nil {
+			t.Fatalf("ProcessDirectWithChannel() error = %v", err)
+		}
+		if response != "Done." {
+			t.Errorf("keep=%v: response = %q", keep, response)
+		}
+
+		var stored []string
+		for _, m := range al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:reasoning") {
+			if m.ReasoningContent != "" {
+				stored = append(stored, m.ReasoningContent)
+			}
+		}
+		want := "[]"
+		if keep {
+			want = "[call the tool it ran]"
+		}
+		if got := fmt.Sprint(stored); got != want {
+			t.Errorf("keep=%v: stored reasoning = %s, want %s", keep, got, want)
+		}
+	}
+}
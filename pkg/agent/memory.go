@@ -12,15 +12,26 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
 )
 
+// maxPromptFacts caps how many remembered facts, the most recent, go into
+// the system prompt.
+const maxPromptFacts = 100
+
 // MemoryStore manages persistent memory for the agent.
 // - Long-term memory: memory/MEMORY.md
 // - Daily notes: memory/YYYYMM/YYYYMMDD.md
+// - Notes about people: memory/people/{channel}_{user}.md
+// - Facts with where they were learned: memory/facts.json
+// - Consolidation runs and the changes awaiting approval: memory/consolidation.json
 type MemoryStore struct {
-	workspace  string
-	memoryDir  string
-	memoryFile string
+	workspace     string
+	memoryDir     string
+	memoryFile    string
+	facts         *state.FactStore
+	consolidation *state.ConsolidationStore
 }
 
 // NewMemoryStore creates a new MemoryStore with the given workspace path.
@@ -33,9 +44,11 @@ func NewMemoryStore(workspace string) *MemoryStore {
 	os.MkdirAll(memoryDir, 0o755)
 
 	return &MemoryStore{
-		workspace:  workspace,
-		memoryDir:  memoryDir,
-		memoryFile: memoryFile,
+		workspace:     workspace,
+		memoryDir:     memoryDir,
+		memoryFile:    memoryFile,
+		facts:         state.NewFactStore(workspace),
+		consolidation: state.NewConsolidationStore(workspace),
 	}
 }
 
@@ -98,6 +111,27 @@ func (ms *MemoryStore) AppendToday(content string) error {
 	return os.WriteFile(todayFile, []byte(newContent), 0o644)
 }
 
+// PersonFile returns the path of the notes about a user of a channel. The
+// agent writes them with its file tools, like MEMORY.md.
+func (ms *MemoryStore) PersonFile(channel, userID string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+			return r
+		}
+		return '_'
+	}, channel+"_"+userID)
+	return filepath.Join(ms.memoryDir, "people", name+".md")
+}
+
+// ReadPerson reads the notes about a user.
+// Returns empty string if there are none.
+func (ms *MemoryStore) ReadPerson(channel, userID string) string {
+	if data, err := os.ReadFile(ms.PersonFile(channel, userID)); err == nil {
+		return string(data)
+	}
+	return ""
+}
+
 // GetRecentDailyNotes returns daily notes from the last N days.
 // Contents are joined with "---" separator.
 func (ms *MemoryStore) GetRecentDailyNotes(days int) string {
@@ -122,13 +156,58 @@ func (ms *MemoryStore) GetRecentDailyNotes(days int) string {
 	return sb.String()
 }
 
+// Facts returns the store of remembered facts.
+func (ms *MemoryStore) Facts() *state.FactStore {
+	return ms.facts
+}
+
+// FormatFact renders a fact with its provenance, e.g.
+// `[#3] Alice is vegetarian (learned 2026-03-01 in telegram chat 42 from telegram:7: "I don't eat meat")`.
+func FormatFact(f state.Fact) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[#%d] %s (learned %s", f.ID, f.Text, f.Learned.Format("2006-01-02"))
+	if f.Channel != "" {
+		fmt.Fprintf(&sb, " in %s chat %s", f.Channel, f.ChatID)
+	} else if f.Session != "" {
+		fmt.Fprintf(&sb, " in session %s", f.Session)
+	}
+	if f.Sender != "" {
+		fmt.Fprintf(&sb, " from %s", f.Sender)
+	}
+	if f.Source != "" {
+		fmt.Fprintf(&sb, ": %q", f.Source)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// getFactsContext lists the most recent facts with their provenance.
+func (ms *MemoryStore) getFactsContext() string {
+	facts := ms.facts.All()
+	if len(facts) == 0 {
+		return ""
+	}
+	if len(facts) > maxPromptFacts {
+		facts = facts[len(facts)-maxPromptFacts:]
+	}
+	var sb strings.Builder
+	sb.WriteString("## Remembered Facts\n\n")
+	sb.WriteString("Each fact says when, in which chat and from whom you learned it. " +
+		"When asked why you think something, answer with that provenance.\n\n")
+	for _, f := range facts {
+		sb.WriteString("- " + FormatFact(f) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
 // GetMemoryContext returns formatted memory context for the agent prompt.
-// Includes long-term memory and recent daily notes.
+// Includes long-term memory, remembered facts and recent daily notes.
 func (ms *MemoryStore) GetMemoryContext() string {
 	longTerm := ms.ReadLongTerm()
+	facts := ms.getFactsContext()
 	recentNotes := ms.GetRecentDailyNotes(3)
 
-	if longTerm == "" && recentNotes == "" {
+	if longTerm == "" && facts == "" && recentNotes == "" {
 		return ""
 	}
 
@@ -139,10 +218,17 @@ func (ms *MemoryStore) GetMemoryContext() string {
 		sb.WriteString(longTerm)
 	}
 
-	if recentNotes != "" {
+	if facts != "" {
 		if longTerm != "" {
 			sb.WriteString("\n\n---\n\n")
 		}
+		sb.WriteString(facts)
+	}
+
+	if recentNotes != "" {
+		if longTerm != "" || facts != "" {
+			sb.WriteString("\n\n---\n\n")
+		}
 		sb.WriteString("## Recent Daily Notes\n\n")
 		sb.WriteString(recentNotes)
 	}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// handleMemoryCommand handles the commands on the remembered facts of the
+// agent a chat is routed to:
+//
+//	/memories                     list the facts learned in this chat
+//	/memories all                 list every fact (admin chat only)
+//	/memories pending             list changes consolidation proposed (admin chat only)
+//	/memories approve|reject [n]  apply or drop one or all of them (admin chat only)
+//	/forget <id>                  forget a fact learned in this chat
+//
+// When an admin chat is configured, it sees and forgets facts from every
+// chat; without one, every chat does.
+func (al *AgentLoop) handleMemoryCommand(
+	agent *AgentInstance,
+	sessionKey string,
+	msg bus.InboundMessage,
+) (string, bool) {
+	fields := strings.Fields(msg.Content)
+	if len(fields) == 0 || (fields[0] != "/memories" && fields[0] != "/forget") {
+		return "", false
+	}
+	mem := agent.ContextBuilder.memory
+	facts := mem.facts
+	admin := al.isAdminChat(msg)
+	inChat := func(f state.Fact) bool {
+		if f.Channel != "" {
+			return f.Channel == msg.Channel && f.ChatID == msg.ChatID
+		}
+		return f.Session != "" && (f.Session == sessionKey || strings.HasPrefix(f.Session, sessionKey+"#"))
+	}
+
+	if fields[0] == "/forget" {
+		if len(fields) != 2 {
+			return al.t(msg, "Usage: /forget <id>, with the ID from /memories"), true
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(fields[1], "#"))
+		if err != nil {
+			return al.t(msg, "Usage: /forget <id>, with the ID from /memories"), true
+		}
+		f, ok := facts.Get(id)
+		if !ok || (!admin && !inChat(f)) {
+			return al.t(msg, "There is no memory #%d from this chat.", id), true
+		}
+		if _, err := facts.Forget(id); err != nil {
+			return al.t(msg, "Failed to forget #%d: %v", id, err), true
+		}
+		return al.t(msg, "Forgot #%d: %s", id, f.Text), true
+	}
+
+	sub := ""
+	if len(fields) > 1 {
+		sub = fields[1]
+	}
+	switch sub {
+	case "", "all":
+	case "pending", "approve", "reject":
+		if !admin {
+			return al.adminOnly(msg, "/memories "+sub), true
+		}
+		return al.reviewPendingMemories(agent, msg, sub, fields[2:]), true
+	default:
+		return al.t(msg, "Usage: /memories [all | pending | approve [n] | reject [n]]"), true
+	}
+
+	all := sub == "all"
+	if all && !admin {
+		return al.adminOnly(msg, "/memories all"), true
+	}
+	var lines []string
+	for _, f := range facts.All() {
+		if all || inChat(f) {
+			lines = append(lines, "- "+FormatFact(f))
+		}
+	}
+	if len(lines) == 0 {
+		if all {
+			return al.t(msg, "Nothing remembered yet."), true
+		}
+		return al.t(msg, "Nothing remembered from this chat yet."), true
+	}
+	header := al.t(msg, "Remembered from this chat (forget one with /forget <id>):")
+	if all {
+		header = al.t(msg, "Everything remembered (forget one with /forget <id>):")
+	}
+	return header + "\n" + strings.Join(lines, "\n"), true
+}
+
+// reviewPendingMemories lists the changes memory consolidation holds for
+// approval, or approves or rejects the one numbered in args, or all of
+// them.
+func (al *AgentLoop) reviewPendingMemories(agent *AgentInstance, msg bus.InboundMessage, action string, args []string) string {
+	mem := agent.ContextBuilder.memory
+	if action == "pending" {
+		pending := mem.consolidation.Pending()
+		if len(pending) == 0 {
+			return al.t(msg, "No memory changes are waiting for approval.")
+		}
+		lines := []string{al.t(msg, "Memory changes waiting for approval (/memories approve|reject [n]):")}
+		for i, c := range pending {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, describeFactChange(mem, c)))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	n := 0
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return al.t(msg, "Usage: /memories %s [n], with the number from /memories pending", action)
+		}
+	}
+	taken, err := mem.consolidation.Take(n)
+	if err != nil {
+		return al.t(msg, "Failed to update the pending changes: %v", err)
+	}
+	if len(taken) == 0 {
+		return al.t(msg, "No such memory change is waiting for approval.")
+	}
+	al.Audit(state.AuditEntry{
+		Action:  "approval",
+		Actor:   auditActor(msg),
+		Target:  "memory",
+		Outcome: "ok",
+		Detail:  fmt.Sprintf("%s %d memory changes for agent %s", action, len(taken), agent.ID),
+	})
+	if action == "reject" {
+		return al.t(msg, "Rejected %d memory changes.", len(taken))
+	}
+	for _, c := range taken {
+		if err := al.applyFactChange(agent, c); err != nil {
+			return al.t(msg, "Failed to apply a memory change: %v", err)
+		}
+	}
+	return al.t(msg, "Applied %d memory changes.", len(taken))
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// rememberProvider calls remember on the first request and records the
+// system prompt of every request.
+type rememberProvider struct {
+	prompts []string
+}
+
+func (p *rememberProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.prompts = append(p.prompts, messages[0].Content)
+	if len(p.prompts) == 1 {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:   "call_1",
+			Type: "function",
+			Name: "remember",
+			Arguments: map[string]any{
+				"fact":   "Alice is vegetarian",
+				"source": "I don't eat meat",
+			},
+		}}}, nil
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *rememberProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestMemories_ProvenanceListAndForget(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cfg.Gateway.Supervisor.AlertChannel = "telegram"
+	cfg.Gateway.Supervisor.AlertChatID = "1"
+	cfg.Gateway.Admin.Senders = []string{"telegram:7"}
+	provider := &rememberProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	in := func(chatID, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: chatID, Content: content}
+	}
+
+	h.executeAndGetResponse(t, ctx, in("42", "By the way, I don't eat meat"))
+	h.executeAndGetResponse(t, ctx, in("42", "Why do you think I'm vegetarian?"))
+	prompt := provider.prompts[len(provider.prompts)-1]
+	if !strings.Contains(prompt, "## Remembered Facts") ||
+		!strings.Contains(prompt, `Alice is vegetarian (learned `) ||
+		!strings.Contains(prompt, `in telegram chat 42 from telegram:7: "I don't eat meat")`) {
+		t.Errorf("fact with provenance missing from the prompt:\n%s", prompt)
+	}
+
+	got := h.executeAndGetResponse(t, ctx, in("42", "/memories"))
+	if !strings.Contains(got, "[#1] Alice is vegetarian") {
+		t.Errorf("/memories = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("99", "/memories")); !strings.Contains(got, "Nothing remembered") {
+		t.Errorf("/memories in another chat = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("99", "/forget 1")); !strings.Contains(got, "no memory #1") {
+		t.Errorf("/forget from another chat = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("99", "/memories all")); !strings.Contains(got, "admin chat") {
+		t.Errorf("/memories all outside the admin chat = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("1", "/memories all")); !strings.Contains(got, "chat 42") {
+		t.Errorf("/memories all in the admin chat = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("42", "/forget #1")); got != "Forgot #1: Alice is vegetarian" {
+		t.Errorf("/forget = %q", got)
+	}
+	if facts := al.registry.GetDefaultAgent().ContextBuilder.memory.Facts().All(); len(facts) != 0 {
+		t.Errorf("facts after /forget = %+v", facts)
+	}
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// handleModelCommand handles /model, which lets an admin answer a single
+// message with another model:
+//
+//	/model                     show the agent's model and parameters
+//	/model <name> <message>    answer <message> with <name>
+//	/model <name>              answer the next message in this chat with <name>
+//
+// For "/model <name> <message>" it returns the model and the message to
+// process instead of a reply.
+func (al *AgentLoop) handleModelCommand(agent *AgentInstance, msg bus.InboundMessage) (reply, model, content string, handled bool) {
+	text := strings.TrimSpace(msg.Content)
+	if text != "/model" && !strings.HasPrefix(text, "/model ") {
+		return "", "", "", false
+	}
+	if !al.isAdminChat(msg) {
+		return al.adminOnly(msg, "/model"), "", "", true
+	}
+
+	args := strings.TrimSpace(strings.TrimPrefix(text, "/model"))
+	if args == "" {
+		return describeAgentModel(agent, al.cfg.ModelList), "", "", true
+	}
+	name, rest, _ := strings.Cut(args, " ")
+	if _, ok := al.resolveModel(name); !ok {
+		return fmt.Sprintf("Unknown model: %s. Use a model_list name or vendor/model.", name), "", "", true
+	}
+	if rest = strings.TrimSpace(rest); rest != "" {
+		return "", name, rest, false
+	}
+	al.nextModel.Store(msg.Channel+":"+msg.ChatID, name)
+	return fmt.Sprintf("The next message in this chat is answered by %s.", name), "", "", true
+}
+
+// takeNextModel returns and clears the model /model set for the next
+// message of a chat.
+func (al *AgentLoop) takeNextModel(msg bus.InboundMessage) string {
+	if v, ok := al.nextModel.LoadAndDelete(msg.Channel + ":" + msg.ChatID); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+func describeAgentModel(agent *AgentInstance, modelList []config.ModelConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Agent %s uses %s", agent.ID, agent.Model)
+	if len(agent.Fallbacks) > 0 {
+		fmt.Fprintf(&b, " (fallbacks: %s)", strings.Join(agent.Fallbacks, ", "))
+	}
+	fmt.Fprintf(&b, "\nTemperature %.2g, max tokens %d", agent.Temperature, agent.MaxTokens)
+	if agent.ReasoningEffort != "" {
+		fmt.Fprintf(&b, ", reasoning effort %s", agent.ReasoningEffort)
+	}
+	g := agent.Generation
+	if g.TopP != nil {
+		fmt.Fprintf(&b, ", top_p %.2g", *g.TopP)
+	}
+	if g.FrequencyPenalty != nil {
+		fmt.Fprintf(&b, ", frequency penalty %.2g", *g.FrequencyPenalty)
+	}
+	if g.PresencePenalty != nil {
+		fmt.Fprintf(&b, ", presence penalty %.2g", *g.PresencePenalty)
+	}
+	if g.Seed != nil {
+		fmt.Fprintf(&b, ", seed %d", *g.Seed)
+	}
+	if len(g.Stop) > 0 {
+		fmt.Fprintf(&b, ", stop %q", g.Stop)
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range modelList {
+		if !seen[m.ModelName] {
+			seen[m.ModelName] = true
+			names = append(names, m.ModelName)
+		}
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(&b, "\nModels: %s", strings.Join(names, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestModelCommand(t *testing.T) {
+	var ollamaModels []string
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		ollamaModels = append(ollamaModels, body.Model)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"local"},"done":true}`)
+	}))
+	defer ollama.Close()
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		ModelList: []config.ModelConfig{
+			{ModelName: "local", Model: "ollama/llama3.2", APIBase: ollama.URL},
+		},
+	}
+	cfg.Gateway.Supervisor.AlertChannel = "telegram"
+	cfg.Gateway.Supervisor.AlertChatID = "admin"
+	cfg.Gateway.Admin.Senders = []string{"telegram:1"}
+
+	provider := &historyProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	inChat := func(chatID, content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: chatID, Content: content}
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, inChat("someone", "/model local hi")); !strings.Contains(got, "admin chat") {
+		t.Errorf("non-admin /model = %q", got)
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, inChat("admin", "/model local hi")); got != "local" {
+		t.Errorf("/model local hi = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, inChat("admin", "back to normal")); got != "ok" {
+		t.Errorf("override outlived its message, got %q", got)
+	}
+
+	h.executeAndGetResponse(t, ctx, inChat("admin", "/model ollama/qwen2.5"))
+	h.executeAndGetResponse(t, ctx, inChat("admin", "next one"))
+	if strings.Join(ollamaModels, ",") != "llama3.2,qwen2.5" {
+		t.Errorf("ollama models = %v", ollamaModels)
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, inChat("admin", "/model nope")); !strings.Contains(got, "Unknown model") {
+		t.Errorf("/model nope = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, inChat("admin", "/model")); !strings.Contains(got, "uses test-model") ||
+		!strings.Contains(got, "Models: local") {
+		t.Errorf("/model = %q", got)
+	}
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// processStarted is when the gateway process started, as near as this
+// package can tell.
+var processStarted = time.Now()
+
+// processCacheTTL is how long ReadProcessStatus and StoreSizes reuse what
+// they read: a scrape of /metrics asks for each value on its own, and
+// reading the memory stats briefly stops the program.
+const (
+	processCacheTTL = time.Second
+	storesCacheTTL  = time.Minute
+)
+
+var processCache struct {
+	sync.Mutex
+	at time.Time
+	st ProcessStatus
+}
+
+// ReadProcessStatus returns the memory, goroutines, garbage collection and
+// open files of this process.
+func ReadProcessStatus() ProcessStatus {
+	processCache.Lock()
+	defer processCache.Unlock()
+	if time.Since(processCache.at) < processCacheTTL {
+		return processCache.st
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	st := ProcessStatus{
+		HeapBytes:     mem.HeapAlloc,
+		SysBytes:      mem.Sys,
+		Goroutines:    runtime.NumGoroutine(),
+		GCRuns:        mem.NumGC,
+		GCPauseTotal:  time.Duration(mem.PauseTotalNs),
+		OpenFiles:     openFiles(),
+		UptimeSeconds: int64(time.Since(processStarted).Seconds()),
+	}
+	if mem.NumGC > 0 {
+		st.GCPauseLast = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+	processCache.at, processCache.st = time.Now(), st
+	return st
+}
+
+// openFiles returns how many file descriptors the process has open, or -1
+// where /proc does not tell.
+func openFiles() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	// One of them is the directory being read.
+	return len(entries) - 1
+}
+
+// StoreSizes returns the size of the workspace's stores, read at most once
+// a minute as it walks them.
+func (al *AgentLoop) StoreSizes() []StoreStatus {
+	al.storesMu.Lock()
+	defer al.storesMu.Unlock()
+	if al.stores != nil && time.Since(al.storesAt) < storesCacheTTL {
+		return al.stores
+	}
+	al.stores, al.storesAt = storeSizes(al.cfg.WorkspacePath()), time.Now()
+	return al.stores
+}
+
+// RunSelfReports records a "self_report" run event with the process's
+// memory, goroutines, open files and store sizes every interval until ctx
+// ends, so a leak shows as a trend in the event log.
+func (al *AgentLoop) RunSelfReports(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			al.selfReport()
+		}
+	}
+}
+
+// selfReport records one self report.
+func (al *AgentLoop) selfReport() {
+	al.recordRunEvent(state.RunEvent{
+		Kind: "self_report", Source: "process", Message: selfReportMessage(ReadProcessStatus(), al.StoreSizes()),
+	})
+}
+
+// selfReportMessage sums up p and stores in one line.
+func selfReportMessage(p ProcessStatus, stores []StoreStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s heap, %s from the OS, %d goroutines", formatSize(int64(p.HeapBytes)), formatSize(int64(p.SysBytes)), p.Goroutines)
+	if p.OpenFiles >= 0 {
+		fmt.Fprintf(&b, ", %d open files", p.OpenFiles)
+	}
+	fmt.Fprintf(&b, ", %d GC runs, last pause %s", p.GCRuns, p.GCPauseLast)
+	var sizes []string
+	for _, s := range stores {
+		sizes = append(sizes, fmt.Sprintf("%s %s", s.Name, formatSize(s.Bytes)))
+	}
+	if len(sizes) > 0 {
+		fmt.Fprintf(&b, "; stores: %s", strings.Join(sizes, ", "))
+	}
+	return b.String()
+}
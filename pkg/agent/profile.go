@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// profileID returns the key of the sender's profile: the channel type and
+// their stable ID, so a profile follows the person across accounts of a
+// channel but not across channels. Scheduled runs, sent as "cron", have
+// none.
+func profileID(msg bus.InboundMessage) string {
+	if msg.SenderID == "" || msg.SenderID == "cron" {
+		return ""
+	}
+	channelType, _ := channels.SplitAccount(msg.Channel)
+	return channelType + ":" + speakerID(msg.SenderID)
+}
+
+// profileNotes describes the sender's profile to the model, with their
+// local time when their time zone is known.
+func profileNotes(p state.Profile, now time.Time) string {
+	if p.Empty() {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n## User Profile\n")
+	sb.WriteString("What the user you are answering told you about themselves. " +
+		"Update it with update_profile when they tell you something new.\n")
+	if p.Name != "" {
+		fmt.Fprintf(&sb, "Name: %s\n", p.Name)
+	}
+	if p.Timezone != "" {
+		fmt.Fprintf(&sb, "Time zone: %s", p.Timezone)
+		if loc, err := time.LoadLocation(p.Timezone); err == nil {
+			fmt.Fprintf(&sb, " (their local time: %s)", now.In(loc).Format("Mon 2006-01-02 15:04"))
+		}
+		sb.WriteString("\n")
+	}
+	if p.Locale != "" {
+		fmt.Fprintf(&sb, "Locale: %s\n", p.Locale)
+	}
+	if len(p.Preferences) > 0 {
+		sb.WriteString("Preferences:\n")
+		for _, key := range slices.Sorted(maps.Keys(p.Preferences)) {
+			fmt.Fprintf(&sb, "- %s: %s\n", key, p.Preferences[key])
+		}
+	}
+	if len(p.Instructions) > 0 {
+		sb.WriteString("Standing instructions, follow them unless the user asks otherwise:\n")
+		for i, instr := range p.Instructions {
+			fmt.Fprintf(&sb, "%d. %s\n", i+1, instr)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// handleProfileCommand shows and edits the sender's profile:
+//
+//	/profile                              show it
+//	/profile name|timezone|locale <value> set a field
+//	/profile pref <key> <value>           set a preference
+//	/profile instruct <text>              add a standing instruction
+//	/profile forget <field|key|number>    remove a field, preference or instruction
+//	/profile clear                        delete the profile
+func (al *AgentLoop) handleProfileCommand(msg bus.InboundMessage, args []string) string {
+	id := profileID(msg)
+	if id == "" {
+		return al.t(msg, "Profiles need to know who is writing, which this channel does not say.")
+	}
+	if len(args) == 0 {
+		p := al.profiles.Get(id)
+		if p.Empty() {
+			return al.t(msg, "Your profile is empty. Tell me about yourself, or use /profile name|timezone|locale|pref|instruct.")
+		}
+		return strings.TrimSpace(profileNotes(p, time.Now()))
+	}
+
+	rest := strings.TrimSpace(strings.Join(args[1:], " "))
+	var reply string
+	update := func(fn func(p *state.Profile)) string {
+		if _, err := al.profiles.Update(id, fn); err != nil {
+			return al.t(msg, "Failed to save your profile: %v", err)
+		}
+		return reply
+	}
+
+	switch args[0] {
+	case "name", "locale":
+		if rest == "" {
+			return al.t(msg, "Usage: /profile %s <value>", args[0])
+		}
+		reply = al.t(msg, "Saved your name.")
+		if args[0] == "locale" {
+			reply = al.t(msg, "Saved your locale.")
+		}
+		return update(func(p *state.Profile) {
+			if args[0] == "name" {
+				p.Name = rest
+			} else {
+				p.Locale = rest
+			}
+		})
+	case "timezone":
+		if _, err := time.LoadLocation(rest); rest == "" || err != nil {
+			return al.t(msg, "Usage: /profile timezone <IANA name, e.g. Europe/Berlin>")
+		}
+		reply = al.t(msg, "Saved your time zone.")
+		return update(func(p *state.Profile) { p.Timezone = rest })
+	case "pref":
+		if len(args) < 3 {
+			return al.t(msg, "Usage: /profile pref <key> <value>")
+		}
+		value := strings.Join(args[2:], " ")
+		reply = al.t(msg, "Saved your preference for %s.", args[1])
+		return update(func(p *state.Profile) { p.SetPreference(args[1], value) })
+	case "instruct":
+		if rest == "" {
+			return al.t(msg, "Usage: /profile instruct <instruction>")
+		}
+		reply = al.t(msg, "I'll follow that from now on.")
+		return update(func(p *state.Profile) { p.Instructions = append(p.Instructions, rest) })
+	case "forget":
+		if rest == "" {
+			return al.t(msg, "Usage: /profile forget <name|timezone|locale|preference key|instruction number>")
+		}
+		forgotten := false
+		failed := update(func(p *state.Profile) {
+			forgotten = true
+			switch {
+			case rest == "name" && p.Name != "":
+				p.Name = ""
+			case rest == "timezone" && p.Timezone != "":
+				p.Timezone = ""
+			case rest == "locale" && p.Locale != "":
+				p.Locale = ""
+			case p.Preferences[rest] != "":
+				p.SetPreference(rest, "")
+			default:
+				forgotten = p.RemoveInstruction(rest)
+			}
+		})
+		switch {
+		case failed != "":
+			return failed
+		case forgotten:
+			return al.t(msg, "Forgot %s.", rest)
+		}
+		return al.t(msg, "Nothing called %q in your profile.", rest)
+	case "clear":
+		if err := al.profiles.Delete(id); err != nil {
+			return al.t(msg, "Failed to delete your profile: %v", err)
+		}
+		return al.t(msg, "Deleted your profile.")
+	}
+	return al.t(msg, "Usage: /profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]")
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// profileProvider calls update_profile on the first request and records
+// the system prompt of every request.
+type profileProvider struct {
+	prompts []string
+}
+
+func (p *profileProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.prompts = append(p.prompts, messages[0].Content)
+	if len(p.prompts) == 1 {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:   "call_1",
+			Type: "function",
+			Name: "update_profile",
+			Arguments: map[string]any{
+				"timezone":        "Europe/Berlin",
+				"add_instruction": "Answer in German",
+			},
+		}}}, nil
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *profileProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestProfile_RememberedAndInjected(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &profileProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	from := func(content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "42|alice", ChatID: "42", Content: content}
+	}
+
+	h.executeAndGetResponse(t, ctx, from("Remember that I live in Berlin and want answers in German"))
+	stored := state.NewProfileStore(workspace).Get("telegram:42")
+	if stored.Timezone != "Europe/Berlin" || len(stored.Instructions) != 1 {
+		t.Fatalf("stored profile = %+v", stored)
+	}
+
+	h.executeAndGetResponse(t, ctx, from("Wie spät ist es?"))
+	prompt := provider.prompts[len(provider.prompts)-1]
+	if !strings.Contains(prompt, "## User Profile") || !strings.Contains(prompt, "their local time") ||
+		!strings.Contains(prompt, "1. Answer in German") {
+		t.Errorf("profile missing from the prompt:\n%s", prompt)
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, from("/profile pref units metric")); !strings.Contains(got, "units") {
+		t.Errorf("/profile pref = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, from("/profile")); !strings.Contains(got, "- units: metric") {
+		t.Errorf("/profile = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, from("/profile forget 1")); got != "Forgot 1." {
+		t.Errorf("/profile forget 1 = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, from("/profile forget 1")); !strings.Contains(got, "Nothing called") {
+		t.Errorf("second /profile forget 1 = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, from("/profile timezone Mars/Olympus")); !strings.Contains(got, "Usage") {
+		t.Errorf("bad time zone = %q", got)
+	}
+	h.executeAndGetResponse(t, ctx, from("/profile clear"))
+	if p := al.profiles.Get("telegram:42"); !p.Empty() {
+		t.Errorf("profile after /profile clear = %+v", p)
+	}
+	// Another person's profile is theirs alone.
+	other := bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "7", Content: "/profile"}
+	if got := h.executeAndGetResponse(t, ctx, other); !strings.Contains(got, "empty") {
+		t.Errorf("/profile of someone else = %q", got)
+	}
+}
@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// PromptTemplateFile is the name of the file that replaces the built-in
+// system prompt template. An agent's own workspace is searched first, then
+// its shared/ directory, so a persona can override the template all agents
+// share.
+const PromptTemplateFile = "SYSTEM_PROMPT.tmpl"
+
+// defaultPromptTemplate is the system prompt used when no workspace has a
+// SYSTEM_PROMPT.tmpl. Sections are separated by "---".
+const defaultPromptTemplate = `# picoclaw 🦞
+
+You are picoclaw, a helpful AI assistant.
+
+## Current Time
+{{.Now}}
+
+## Runtime
+{{.Runtime}}
+
+## Workspace
+Your workspace is at: {{.Workspace}}
+- Memory: {{.Workspace}}/memory/MEMORY.md
+- Daily Notes: {{.Workspace}}/memory/YYYYMM/YYYYMMDD.md
+- Skills: {{.Workspace}}/skills/{skill-name}/SKILL.md
+
+{{.Tools}}
+
+## Important Rules
+
+1. **ALWAYS use tools** - When you need to perform an action (schedule reminders, send messages, execute commands, etc.), you MUST call the appropriate tool. Do NOT just say you'll do it or pretend to do it.
+
+2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
+
+3. **Memory** - When interacting with me if something seems memorable, record it with the remember tool; for longer notes, update {{.Workspace}}/memory/MEMORY.md
+{{- with .Bootstrap}}
+
+---
+
+{{.}}
+{{- end}}
+{{- with .Skills}}
+
+---
+
+# Skills
+
+The following skills extend your capabilities. To use a skill, read its SKILL.md file using the read_file tool.
+
+{{.}}
+{{- end}}
+{{- with .Memory}}
+
+---
+
+# Memory
+
+{{.}}
+{{- end}}`
+
+// PromptData is what system prompt templates are rendered with.
+type PromptData struct {
+	Time      time.Time
+	Now       string // Time as "2006-01-02 15:04 (Monday)"
+	Runtime   string // OS, architecture and Go version in one line
+	Device    DeviceInfo
+	Workspace string // absolute workspace path
+	Tools     string // the Available Tools section, empty without tools
+	Bootstrap string // the workspace's AGENTS.md, SOUL.md, ... files
+	User      string // shared/USER.md, the user's profile
+	Skills    string // summary of the installed skills
+	Memory    string // long-term memory and recent daily notes
+}
+
+// DeviceInfo describes the machine picoclaw runs on.
+type DeviceInfo struct {
+	OS        string
+	Arch      string
+	Hostname  string
+	GoVersion string
+	CPUs      int
+}
+
+var builtinPromptTemplate = template.Must(template.New("system").Parse(defaultPromptTemplate))
+
+// promptTemplate is a workspace's template file, parsed again whenever the
+// file changes so edits apply to the next message without a restart.
+type promptTemplate struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	tmpl    *template.Template
+}
+
+// promptTemplate returns the template for cb's workspace, and the file it
+// was read from ("" for the built-in one).
+func (cb *ContextBuilder) promptTemplate() (*template.Template, string) {
+	pt := &cb.template
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	for _, path := range []string{
+		filepath.Join(cb.workspace, PromptTemplateFile),
+		filepath.Join(cb.workspace, "shared", PromptTemplateFile),
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if pt.tmpl != nil && pt.path == path && pt.modTime.Equal(info.ModTime()) && pt.size == info.Size() {
+			return pt.tmpl, path
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		tmpl, err := template.New(filepath.Base(path)).Funcs(cb.promptFuncs()).Parse(string(data))
+		if err != nil {
+			logger.WarnCF("agent", "Ignoring invalid system prompt template",
+				map[string]any{"path": path, "error": err.Error()})
+			return builtinPromptTemplate, ""
+		}
+		if pt.path != "" {
+			logger.InfoCF("agent", "Reloaded system prompt template", map[string]any{"path": path})
+		}
+		pt.path, pt.modTime, pt.size, pt.tmpl = path, info.ModTime(), info.Size(), tmpl
+		return tmpl, path
+	}
+	return builtinPromptTemplate, ""
+}
+
+// promptFuncs are the functions available to template files besides the
+// text/template built-ins.
+func (cb *ContextBuilder) promptFuncs() template.FuncMap {
+	return template.FuncMap{
+		// file returns a file of the workspace, or "" if it does not exist.
+		"file": func(name string) string {
+			path := filepath.Join(cb.workspace, filepath.Clean("/"+name))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return ""
+			}
+			return string(data)
+		},
+		"trim":  strings.TrimSpace,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
+
+func (cb *ContextBuilder) promptData() PromptData {
+	now := time.Now()
+	workspacePath, _ := filepath.Abs(cb.workspace)
+	hostname, _ := os.Hostname()
+
+	var user string
+	if data, err := os.ReadFile(filepath.Join(cb.workspace, "shared", "USER.md")); err == nil {
+		user = string(data)
+	}
+
+	return PromptData{
+		Time:    now,
+		Now:     now.Format("2006-01-02 15:04 (Monday)"),
+		Runtime: fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version()),
+		Device: DeviceInfo{
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			Hostname:  hostname,
+			GoVersion: runtime.Version(),
+			CPUs:      runtime.NumCPU(),
+		},
+		Workspace: workspacePath,
+		Tools:     cb.buildToolsSection(),
+		Bootstrap: cb.LoadBootstrapFiles(),
+		User:      user,
+		Skills:    cb.skillsLoader.BuildSkillsSummary(),
+		Memory:    cb.memory.GetMemoryContext(),
+	}
+}
+
+// renderPrompt renders the system prompt. A template file that fails to
+// render is logged and the built-in template used instead, so a typo in
+// it does not leave the agent without a prompt.
+func (cb *ContextBuilder) renderPrompt() string {
+	data := cb.promptData()
+	tmpl, path := cb.promptTemplate()
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		logger.WarnCF("agent", "Failed to render system prompt template",
+			map[string]any{"path": path, "error": err.Error()})
+		sb.Reset()
+		builtinPromptTemplate.Execute(&sb, data)
+	}
+	return sb.String()
+}
+
+// handlePromptCommand handles /prompt, which shows the system prompt the
+// agent a chat is routed to currently answers with.
+func (al *AgentLoop) handlePromptCommand(agent *AgentInstance, msg bus.InboundMessage) (string, bool) {
+	if strings.TrimSpace(msg.Content) != "/prompt" {
+		return "", false
+	}
+	if !al.isAdminChat(msg) {
+		return al.adminOnly(msg, "/prompt"), true
+	}
+	_, path := agent.ContextBuilder.promptTemplate()
+	if path == "" {
+		path = "built-in"
+	}
+	return fmt.Sprintf("System prompt of agent %s (template: %s):\n\n%s",
+		agent.ID, path, agent.ContextBuilder.BuildSystemPrompt()), true
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBuildSystemPrompt_DefaultTemplate(t *testing.T) {
+	ws := t.TempDir()
+	os.MkdirAll(filepath.Join(ws, "memory"), 0o755)
+	os.WriteFile(filepath.Join(ws, "AGENTS.md"), []byte("Be brief."), 0o644)
+	os.WriteFile(filepath.Join(ws, "memory", "MEMORY.md"), []byte("Likes tea."), 0o644)
+
+	prompt := NewContextBuilder(ws).BuildSystemPrompt()
+	for _, want := range []string{
+		"# picoclaw 🦞\n",
+		"## Current Time\n",
+		"update " + ws + "/memory/MEMORY.md\n\n---\n\n## AGENTS.md\n\nBe brief.",
+		"\n\n---\n\n# Memory\n\n",
+		"Likes tea.",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestBuildSystemPrompt_TemplateFile(t *testing.T) {
+	ws := t.TempDir()
+	os.MkdirAll(filepath.Join(ws, "shared"), 0o755)
+	os.WriteFile(filepath.Join(ws, "shared", "USER.md"), []byte("  Name: Sam  \n"), 0o644)
+	os.WriteFile(filepath.Join(ws, "NOTES.md"), []byte("notes"), 0o644)
+	cb := NewContextBuilder(ws)
+
+	shared := filepath.Join(ws, "shared", PromptTemplateFile)
+	os.WriteFile(shared, []byte("shared {{.Device.OS}}"), 0o644)
+	if got := cb.BuildSystemPrompt(); !strings.HasPrefix(got, "shared ") || got == "shared " {
+		t.Errorf("shared template = %q", got)
+	}
+
+	// The persona's own template wins, and is picked up again when edited.
+	own := filepath.Join(ws, PromptTemplateFile)
+	os.WriteFile(own, []byte(`user={{trim .User}} file={{file "NOTES.md"}} outside={{file "../x"}}`), 0o644)
+	if got, want := cb.BuildSystemPrompt(), "user=Name: Sam file=notes outside="; got != want {
+		t.Errorf("persona template = %q, want %q", got, want)
+	}
+	os.WriteFile(own, []byte("edited"), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(own, later, later)
+	if got := cb.BuildSystemPrompt(); got != "edited" {
+		t.Errorf("after edit = %q", got)
+	}
+
+	// Broken templates fall back to the built-in one.
+	os.WriteFile(own, []byte("{{.Nope"), 0o644)
+	os.Chtimes(own, later.Add(time.Minute), later.Add(time.Minute))
+	if got := cb.BuildSystemPrompt(); !strings.HasPrefix(got, "# picoclaw") {
+		t.Errorf("unparsable template = %q", got)
+	}
+	os.WriteFile(own, []byte("{{.Nope}}"), 0o644)
+	os.Chtimes(own, later.Add(2*time.Minute), later.Add(2*time.Minute))
+	if got := cb.BuildSystemPrompt(); !strings.HasPrefix(got, "# picoclaw") {
+		t.Errorf("failing template = %q", got)
+	}
+}
+
+func TestPromptCommand(t *testing.T) {
+	ws := t.TempDir()
+	os.WriteFile(filepath.Join(ws, PromptTemplateFile), []byte("You are Ada."), 0o644)
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         ws,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cfg.Gateway.Supervisor.AlertChannel = "telegram"
+	cfg.Gateway.Supervisor.AlertChatID = "admin"
+	cfg.Gateway.Admin.Senders = []string{"telegram:1"}
+
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &mockProvider{})
+	h := testHelper{al: al}
+	ctx := context.Background()
+	inChat := func(chatID string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: chatID, Content: "/prompt"}
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, inChat("someone")); !strings.Contains(got, "admin chat") {
+		t.Errorf("non-admin /prompt = %q", got)
+	}
+	got := h.executeAndGetResponse(t, ctx, inChat("admin"))
+	if !strings.Contains(got, PromptTemplateFile) || !strings.HasSuffix(got, "\n\nYou are Ada.") {
+		t.Errorf("/prompt = %q", got)
+	}
+}
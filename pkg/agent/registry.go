@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"slices"
 	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/config"
@@ -13,6 +14,7 @@ import (
 type AgentRegistry struct {
 	agents   map[string]*AgentInstance
 	resolver *routing.RouteResolver
+	provider providers.LLMProvider // default one, for agents without a model of their own
 	mu       sync.RWMutex
 }
 
@@ -20,10 +22,11 @@ type AgentRegistry struct {
 func NewAgentRegistry(
 	cfg *config.Config,
 	provider providers.LLMProvider,
-) *AgentRegistry {
+) (*AgentRegistry, error) {
 	registry := &AgentRegistry{
 		agents:   make(map[string]*AgentInstance),
 		resolver: routing.NewRouteResolver(cfg),
+		provider: provider,
 	}
 
 	agentConfigs := cfg.Agents.List
@@ -32,14 +35,21 @@ func NewAgentRegistry(
 			ID:      "main",
 			Default: true,
 		}
-		instance := NewAgentInstance(implicitAgent, &cfg.Agents.Defaults, cfg, provider)
+		instance, err := NewAgentInstance(implicitAgent, &cfg.Agents.Defaults, cfg, provider)
+		if err != nil {
+			return nil, err
+		}
 		registry.agents["main"] = instance
 		logger.InfoCF("agent", "Created implicit main agent (no agents.list configured)", nil)
 	} else {
 		for i := range agentConfigs {
 			ac := &agentConfigs[i]
 			id := routing.NormalizeAgentID(ac.ID)
-			instance := NewAgentInstance(ac, &cfg.Agents.Defaults, cfg, provider)
+			instance, err := NewAgentInstance(ac, &cfg.Agents.Defaults, cfg, provider)
+			if err != nil {
+				registry.close()
+				return nil, err
+			}
 			registry.agents[id] = instance
 			logger.InfoCF("agent", "Registered agent",
 				map[string]any{
@@ -51,7 +61,38 @@ func NewAgentRegistry(
 		}
 	}
 
-	return registry
+	return registry, nil
+}
+
+// close closes the session stores of the registered agents.
+func (r *AgentRegistry) close() {
+	for _, agent := range r.agents {
+		agent.Sessions.Close()
+	}
+}
+
+// reconfigure applies cfg to the registered agents, see
+// AgentInstance.configure. Each agent is replaced by an updated copy, so
+// runs in progress finish with the settings they started with. Agents cfg
+// adds or removes are left for a restart.
+func (r *AgentRegistry) reconfigure(cfg *config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, agent := range r.agents {
+		agentCfg := &config.AgentConfig{ID: "main", Default: true}
+		if len(cfg.Agents.List) > 0 {
+			i := slices.IndexFunc(cfg.Agents.List, func(ac config.AgentConfig) bool {
+				return routing.NormalizeAgentID(ac.ID) == id
+			})
+			if i < 0 {
+				continue
+			}
+			agentCfg = &cfg.Agents.List[i]
+		}
+		updated := *agent
+		updated.configure(agentCfg, &cfg.Agents.Defaults, cfg, r.provider)
+		r.agents[id] = &updated
+	}
 }
 
 // GetAgent returns the agent instance for a given ID.
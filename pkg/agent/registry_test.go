@@ -40,7 +40,7 @@ func testCfg(agents []config.AgentConfig) *config.Config {
 
 func TestNewAgentRegistry_ImplicitMain(t *testing.T) {
 	cfg := testCfg(nil)
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	ids := registry.ListAgentIDs()
 	if len(ids) != 1 || ids[0] != "main" {
@@ -61,7 +61,7 @@ func TestNewAgentRegistry_ExplicitAgents(t *testing.T) {
 		{ID: "sales", Default: true, Name: "Sales Bot"},
 		{ID: "support", Name: "Support Bot"},
 	})
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	ids := registry.ListAgentIDs()
 	if len(ids) != 2 {
@@ -86,7 +86,7 @@ func TestAgentRegistry_GetAgent_Normalize(t *testing.T) {
 	cfg := testCfg([]config.AgentConfig{
 		{ID: "my-agent", Default: true},
 	})
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	agent, ok := registry.GetAgent("My-Agent")
 	if !ok || agent == nil {
@@ -102,7 +102,7 @@ func TestAgentRegistry_GetDefaultAgent(t *testing.T) {
 		{ID: "alpha"},
 		{ID: "beta", Default: true},
 	})
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	// GetDefaultAgent first checks for "main", then returns any
 	agent := registry.GetDefaultAgent()
@@ -124,7 +124,7 @@ func TestAgentRegistry_CanSpawnSubagent(t *testing.T) {
 		{ID: "child2"},
 		{ID: "restricted"},
 	})
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	if !registry.CanSpawnSubagent("parent", "child1") {
 		t.Error("expected parent to be allowed to spawn child1")
@@ -151,7 +151,7 @@ func TestAgentRegistry_CanSpawnSubagent_Wildcard(t *testing.T) {
 		},
 		{ID: "any-agent"},
 	})
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	if !registry.CanSpawnSubagent("admin", "any-agent") {
 		t.Error("expected wildcard to allow spawning any agent")
@@ -166,7 +166,7 @@ func TestAgentInstance_Model(t *testing.T) {
 	cfg := testCfg([]config.AgentConfig{
 		{ID: "custom", Default: true, Model: model},
 	})
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	agent, _ := registry.GetAgent("custom")
 	if agent.Model != "claude-opus" {
@@ -179,7 +179,7 @@ func TestAgentInstance_FallbackInheritance(t *testing.T) {
 		{ID: "inherit", Default: true},
 	})
 	cfg.Agents.Defaults.ModelFallbacks = []string{"openai/gpt-4o-mini", "anthropic/haiku"}
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	agent, _ := registry.GetAgent("inherit")
 	if len(agent.Fallbacks) != 2 {
@@ -196,7 +196,7 @@ func TestAgentInstance_FallbackExplicitEmpty(t *testing.T) {
 		{ID: "no-fallback", Default: true, Model: model},
 	})
 	cfg.Agents.Defaults.ModelFallbacks = []string{"should-not-inherit"}
-	registry := NewAgentRegistry(cfg, &mockRegistryProvider{})
+	registry := newTestRegistry(t, cfg, &mockRegistryProvider{})
 
 	agent, _ := registry.GetAgent("no-fallback")
 	if len(agent.Fallbacks) != 0 {
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ReloadConfig applies the agent settings and tool policies of next, the
+// parts of config.LivePaths the agent loop owns, without a restart.
+// Messages being answered finish with the settings they started with.
+func (al *AgentLoop) ReloadConfig(next *config.Config) {
+	al.registry.reconfigure(next)
+	al.flags.setConfig(next.Gateway.Flags)
+
+	// Workspace restriction takes a restart, like the file tools it
+	// applies to.
+	restrict := al.cfg.Agents.Defaults.RestrictToWorkspace
+	for _, agentID := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		agent.Tools.Register(tools.NewExecToolWithConfig(agent.Workspace, restrict, next))
+		if next.Tools.SendMessage.Enabled() {
+			agent.Tools.Register(newSendMessageTool(al.bus, next.Tools.SendMessage))
+		} else {
+			agent.Tools.Unregister("send_message")
+		}
+	}
+}
+
+// newSendMessageTool returns the send_message tool for the destinations
+// cfg allows.
+func newSendMessageTool(msgBus *bus.MessageBus, cfg config.SendMessageToolConfig) *tools.SendMessageTool {
+	return tools.NewSendMessageTool(func(ctx context.Context, channel, chatID, content string) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel:   channel,
+			ChatID:    chatID,
+			Content:   content,
+			Proactive: providers.IsBackground(ctx),
+		})
+		return nil
+	}, cfg.Destinations, cfg.Allowed)
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestReloadConfig(t *testing.T) {
+	newConfig := func(temperature float64, sendTo ...string) *config.Config {
+		return &config.Config{
+			Agents: config.AgentsConfig{
+				Defaults: config.AgentDefaults{
+					Workspace:         t.TempDir(),
+					Model:             "test-model",
+					MaxTokens:         4096,
+					MaxToolIterations: 10,
+				},
+				List: []config.AgentConfig{
+					{ID: "main", Default: true},
+					{ID: "work", Temperature: &temperature},
+				},
+			},
+			Tools: config.ToolsConfig{SendMessage: config.SendMessageToolConfig{Allowed: sendTo}},
+		}
+	}
+	al := newTestLoop(t, newConfig(0.7), bus.NewMessageBus(), &mockProvider{})
+	before, _ := al.registry.GetAgent("work")
+
+	next := newConfig(0.2, "telegram:*")
+	next.Agents.List = append(next.Agents.List, config.AgentConfig{ID: "home"})
+	al.ReloadConfig(next)
+
+	work, _ := al.registry.GetAgent("work")
+	if work.Temperature != 0.2 {
+		t.Errorf("temperature = %v, want the reloaded 0.2", work.Temperature)
+	}
+	if before.Temperature != 0.7 || work.Sessions != before.Sessions || work.Workspace != before.Workspace {
+		t.Error("the running agent was changed in place, or lost its sessions or workspace")
+	}
+	if _, ok := al.registry.GetAgent("home"); ok {
+		t.Error("an added agent was created without a restart")
+	}
+	if _, ok := work.Tools.Get("send_message"); !ok {
+		t.Error("send_message was not registered when it got destinations")
+	}
+
+	al.ReloadConfig(newConfig(0.2))
+	if _, ok := work.Tools.Get("send_message"); ok {
+		t.Error("send_message stayed registered without destinations")
+	}
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// rulePersona returns the persona the routing rules choose for msg at now
+// and why, or "" when no rule matches and there is no fallback.
+func (al *AgentLoop) rulePersona(msg bus.InboundMessage, now time.Time) (agentID, by string) {
+	routing := al.cfg.Routing
+	for i, rule := range routing.Rules {
+		if !ruleMatches(rule.Match, msg, now) {
+			continue
+		}
+		if rule.Name != "" {
+			return rule.Persona, fmt.Sprintf("rule %q", rule.Name)
+		}
+		return rule.Persona, fmt.Sprintf("rule #%d", i+1)
+	}
+	if routing.Fallback != "" {
+		return routing.Fallback, "the fallback"
+	}
+	return "", ""
+}
+
+// ruleMatches reports whether msg, arriving at now, meets every condition
+// of m.
+func ruleMatches(m config.RoutingMatch, msg bus.InboundMessage, now time.Time) bool {
+	if len(m.Channels) > 0 && !slices.ContainsFunc(m.Channels, func(c string) bool {
+		return channelMatches(c, msg.Channel)
+	}) {
+		return false
+	}
+	if len(m.Chats) > 0 && !slices.ContainsFunc(m.Chats, func(entry string) bool {
+		channel, chatID, _ := strings.Cut(entry, ":")
+		return channelMatches(channel, msg.Channel) && chatID == msg.ChatID
+	}) {
+		return false
+	}
+	if len(m.Senders) > 0 && !slices.ContainsFunc(m.Senders, func(entry string) bool {
+		channel, sender, _ := strings.Cut(entry, ":")
+		return channelMatches(channel, msg.Channel) && channels.SenderMatches(msg.SenderID, sender)
+	}) {
+		return false
+	}
+	if len(m.Keywords) > 0 {
+		text := strings.ToLower(msg.Content)
+		if !slices.ContainsFunc(m.Keywords, func(k string) bool {
+			return k != "" && strings.Contains(text, strings.ToLower(k))
+		}) {
+			return false
+		}
+	}
+	if m.Schedule != "" {
+		if m.Timezone != "" {
+			if loc, err := time.LoadLocation(m.Timezone); err == nil {
+				now = now.In(loc)
+			}
+		}
+		// Five-field schedules are due in the first second of a minute only.
+		due, err := gronx.New().IsDue(m.Schedule, now.Truncate(time.Minute))
+		if err != nil {
+			logger.WarnCF("agent", "Invalid routing schedule", map[string]any{"schedule": m.Schedule, "error": err.Error()})
+			return false
+		}
+		if !due {
+			return false
+		}
+	}
+	return true
+}
+
+// channelMatches reports whether a rule's channel, a channel type or one
+// account of it, covers the channel a message came from.
+func channelMatches(rule, channel string) bool {
+	if strings.Contains(rule, "@") {
+		return rule == channel
+	}
+	channelType, _ := channels.SplitAccount(channel)
+	return rule == channelType
+}
+
+// answeredBy is who answered the last message of a chat, for /whoami.
+type answeredBy struct {
+	persona    string
+	name       string
+	by         string
+	model      string // the model asked for; lastModels has the one that answered
+	sessionKey string
+}
+
+func (a answeredBy) String() string {
+	persona := a.persona
+	if a.name != "" && a.name != a.persona {
+		persona += " (" + a.name + ")"
+	}
+	return fmt.Sprintf("persona %s, chosen by %s, model %s", persona, a.by, a.model)
+}
+
+// routedBy describes how the bindings routed a message, for /whoami.
+func routedBy(matchedBy string) string {
+	if kind, ok := strings.CutPrefix(matchedBy, "binding."); ok {
+		return "the " + kind + " binding"
+	}
+	return "default"
+}
+
+// whoamiReport answers /whoami: which persona and model answered the last
+// message in the chat, and which would answer a message now.
+func (al *AgentLoop) whoamiReport(msg bus.InboundMessage, now answeredBy) string {
+	var b strings.Builder
+	if v, ok := al.answers.Load(msg.Channel + ":" + msg.ChatID); ok {
+		last := v.(answeredBy)
+		if model, ok := al.lastModels.Load(last.sessionKey); ok {
+			last.model = model.(string)
+		}
+		b.WriteString("Last answer: " + last.String() + "\n")
+	} else {
+		b.WriteString("Nothing has been answered in this chat since the gateway started.\n")
+	}
+	b.WriteString("Next answer: " + now.String())
+	if len(al.cfg.Routing.Rules) > 0 {
+		b.WriteString(", unless a routing rule for keywords or another time applies")
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestRoutingRules(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true},
+				{ID: "work", Name: "Work assistant", Model: &config.AgentModelConfig{Primary: "work-model"}},
+				{ID: "support", Model: &config.AgentModelConfig{Primary: "support-model"}},
+				{ID: "casual", Model: &config.AgentModelConfig{Primary: "casual-model"}},
+			},
+		},
+		Routing: config.RoutingConfig{
+			Rules: []config.RoutingRule{
+				{Name: "billing", Persona: "support", Match: config.RoutingMatch{Keywords: []string{"refund", "invoice"}}},
+				{Persona: "work", Match: config.RoutingMatch{Senders: []string{"telegram:42"}, Schedule: "* * * * *"}},
+				// February 30th never comes.
+				{Persona: "support", Match: config.RoutingMatch{Schedule: "0 0 30 2 *"}},
+			},
+			Fallback: "casual",
+		},
+	}
+	provider := &historyProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	send := func(sender, content string) string {
+		return h.executeAndGetResponse(t, ctx, bus.InboundMessage{
+			Channel: "telegram", SenderID: sender, ChatID: sender, Content: content,
+		})
+	}
+	lastModel := func() string { return provider.models[len(provider.models)-1] }
+
+	if got := send("1", "/whoami"); got != "Nothing has been answered in this chat since the gateway started.\n"+
+		`Next answer: persona casual, chosen by the fallback, model casual-model, `+
+		"unless a routing rule for keywords or another time applies" {
+		t.Errorf("/whoami before any answer = %q", got)
+	}
+	send("1", "I need a REFUND")
+	if lastModel() != "support-model" {
+		t.Errorf("keyword message answered with %q", lastModel())
+	}
+	if got := send("1", "/whoami"); !strings.HasPrefix(got,
+		`Last answer: persona support, chosen by rule "billing", model support-model`+"\n") {
+		t.Errorf("/whoami after the keyword = %q", got)
+	}
+	send("42", "hello")
+	if lastModel() != "work-model" {
+		t.Errorf("sender rule answered with %q", lastModel())
+	}
+	if got := send("42", "/whoami"); !strings.HasPrefix(got,
+		"Last answer: persona work (Work assistant), chosen by rule #2, model work-model\n") {
+		t.Errorf("/whoami after the sender rule = %q", got)
+	}
+	send("1", "hello")
+	if lastModel() != "casual-model" {
+		t.Errorf("fallback answered with %q", lastModel())
+	}
+
+	// A persona chosen in the chat wins over the rules.
+	send("1", "/persona main")
+	send("1", "another refund")
+	if lastModel() != "test-model" {
+		t.Errorf("pinned persona answered with %q", lastModel())
+	}
+	if got := send("1", "/whoami"); !strings.HasPrefix(got, "Last answer: persona main, chosen by /persona, model test-model") {
+		t.Errorf("/whoami with a pinned persona = %q", got)
+	}
+	if got := send("1", "/persona default"); got != "This conversation follows the routing rules again." {
+		t.Errorf("/persona default = %q", got)
+	}
+	send("1", "another refund")
+	if lastModel() != "support-model" {
+		t.Errorf("unpinned keyword message answered with %q", lastModel())
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	officeHours := config.RoutingMatch{
+		Channels: []string{"slack", "telegram@work"},
+		Schedule: "* 9-17 * * 1-5",
+		Timezone: "Europe/Berlin",
+	}
+	monday := time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC) // 10:30 in Berlin
+	tests := []struct {
+		channel string
+		at      time.Time
+		want    bool
+	}{
+		{"slack", monday, true},
+		{"slack@acme", monday, true},
+		{"telegram@work", monday, true},
+		{"telegram", monday, false},
+		{"slack", monday.Add(8 * time.Hour), false},       // 18:30 in Berlin
+		{"slack", monday.Add(-2 * 24 * time.Hour), false}, // Saturday
+	}
+	for _, tt := range tests {
+		msg := bus.InboundMessage{Channel: tt.channel, SenderID: "1", ChatID: "1", Content: "hi"}
+		if got := ruleMatches(officeHours, msg, tt.at); got != tt.want {
+			t.Errorf("ruleMatches(%s at %v) = %v, want %v", tt.channel, tt.at, got, tt.want)
+		}
+	}
+}
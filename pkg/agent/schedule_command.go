@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// scheduleUsage lists the forms of /schedule.
+const scheduleUsage = "Usage: /schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]"
+
+// handleScheduleCommand shows and changes the scheduled jobs of a chat:
+//
+//	/schedule                    list the jobs that post here, with their next run
+//	/schedule preview <when>     show how a schedule is read and its next runs
+//	/schedule set <id> <when>    give a job a new schedule
+//	/schedule pause|resume <id>  stop and start a job
+//	/schedule remove <id>        delete a job, or cancel a scheduled message
+//
+// Schedules are read in the sender's time zone from /profile timezone, or
+// the gateway's. The admin chat may change the jobs of every chat.
+// Messages scheduled with the schedule_message tool are listed with the
+// jobs, in the chat they go to and the one they were scheduled from.
+func (al *AgentLoop) handleScheduleCommand(msg bus.InboundMessage, args []string) string {
+	if al.cronService == nil {
+		return al.t(msg, "Scheduled jobs are only available in the gateway.")
+	}
+	loc := al.senderLocation(msg)
+	if len(args) == 0 {
+		return al.listSchedule(msg, loc)
+	}
+
+	switch args[0] {
+	case "preview":
+		when := strings.Join(args[1:], " ")
+		if when == "" {
+			return al.t(msg, scheduleUsage)
+		}
+		schedule, err := cron.ParseSchedule(when, loc, time.Now())
+		if err != nil {
+			return al.t(msg, "Could not read %q: %v", when, err)
+		}
+		return al.t(msg, "Read as: %s", schedule) + al.nextRunsText(msg, schedule, loc)
+	case "set":
+		if len(args) < 3 {
+			return al.t(msg, scheduleUsage)
+		}
+		job, ok := al.scheduledJob(msg, args[1])
+		if !ok {
+			return al.t(msg, "There is no job %s in this chat.", args[1])
+		}
+		when := strings.Join(args[2:], " ")
+		schedule, err := cron.ParseSchedule(when, loc, time.Now())
+		if err != nil {
+			return al.t(msg, "Could not read %q: %v", when, err)
+		}
+		updated, err := al.cronService.Reschedule(job.ID, schedule)
+		if err != nil {
+			return al.t(msg, "Failed to change the schedule: %v", err)
+		}
+		return al.t(msg, "%s now runs %s.", updated.Name, schedule) + al.nextRunsText(msg, schedule, loc)
+	case "pause", "resume":
+		if len(args) != 2 {
+			return al.t(msg, scheduleUsage)
+		}
+		job, ok := al.scheduledJob(msg, args[1])
+		if !ok {
+			return al.t(msg, "There is no job %s in this chat.", args[1])
+		}
+		if al.cronService.EnableJob(job.ID, args[0] == "resume") == nil {
+			return al.t(msg, "There is no job %s in this chat.", args[1])
+		}
+		if args[0] == "pause" {
+			return al.t(msg, "Paused %s.", job.Name)
+		}
+		return al.t(msg, "Resumed %s.", job.Name)
+	case "remove":
+		if len(args) != 2 {
+			return al.t(msg, scheduleUsage)
+		}
+		if job, ok := al.scheduledJob(msg, args[1]); ok && al.cronService.RemoveJob(job.ID) {
+			return al.t(msg, "Removed %s.", job.Name)
+		}
+		if sm, ok := al.scheduledMessage(msg, args[1]); ok {
+			if _, err := al.CancelScheduled(sm.ID); err == nil {
+				return al.t(msg, "Cancelled the message to %s.", sm.Message.Channel+":"+sm.Message.ChatID)
+			}
+		}
+		return al.t(msg, "There is no job %s in this chat.", args[1])
+	default:
+		return al.t(msg, scheduleUsage)
+	}
+}
+
+// senderLocation returns the time zone of the sender's profile, or the
+// gateway's when they have none.
+func (al *AgentLoop) senderLocation(msg bus.InboundMessage) *time.Location {
+	if id := profileID(msg); id != "" {
+		if tz := al.profiles.Get(id).Timezone; tz != "" {
+			if loc, err := time.LoadLocation(tz); err == nil {
+				return loc
+			}
+		}
+	}
+	return time.Local
+}
+
+// scheduledJob returns the job with the given ID if it posts to the chat
+// of msg, or to any chat when msg comes from the admin chat.
+func (al *AgentLoop) scheduledJob(msg bus.InboundMessage, id string) (cron.CronJob, bool) {
+	for _, job := range al.cronService.ListJobs(true) {
+		if job.ID == id && (inScheduleChat(job, msg) || al.isAdminChat(msg)) {
+			return job, true
+		}
+	}
+	return cron.CronJob{}, false
+}
+
+// inScheduleChat reports whether job posts to the chat of msg.
+func inScheduleChat(job cron.CronJob, msg bus.InboundMessage) bool {
+	return job.Payload.Channel == msg.Channel && job.Payload.To == msg.ChatID
+}
+
+// listSchedule lists the jobs that post to the chat of msg.
+func (al *AgentLoop) listSchedule(msg bus.InboundMessage, loc *time.Location) string {
+	var lines []string
+	for _, job := range al.cronService.ListJobs(true) {
+		if !inScheduleChat(job, msg) {
+			continue
+		}
+		next := al.t(msg, "paused")
+		if job.Enabled && job.State.NextRunAtMS != nil {
+			next = al.t(msg, "next %s", formatRun(time.UnixMilli(*job.State.NextRunAtMS), loc))
+		}
+		lines = append(lines, "- "+job.ID+": "+job.Name+" — "+job.Schedule.String()+", "+next)
+	}
+	var messages []string
+	for _, sm := range al.scheduledMessages(msg) {
+		messages = append(messages, fmt.Sprintf("- %s: %s → %s:%s, %s",
+			sm.ID, formatRun(sm.SendAt, loc), sm.Message.Channel, sm.Message.ChatID, utils.Truncate(sm.Message.Content, 60)))
+	}
+	if len(lines) == 0 && len(messages) == 0 {
+		return al.t(msg, "Nothing is scheduled in this chat. Ask me to remind you of something, or try /schedule preview every weekday at 8.")
+	}
+	var text string
+	if len(lines) > 0 {
+		text = al.t(msg, "Scheduled here:") + "\n" + strings.Join(lines, "\n")
+	}
+	if len(messages) > 0 {
+		if text != "" {
+			text += "\n\n"
+		}
+		text += al.t(msg, "Messages to send later:") + "\n" + strings.Join(messages, "\n")
+	}
+	return text
+}
+
+// errNoChannels is returned outside the gateway, which is the only place
+// scheduled messages are sent from.
+var errNoChannels = errors.New("messages can only be scheduled in the gateway")
+
+// ScheduleMessage keeps msg in the outbox until at, see
+// channels.Manager.ScheduleMessage.
+func (al *AgentLoop) ScheduleMessage(msg bus.OutboundMessage, at time.Time, by string) (channels.ScheduledMessage, error) {
+	if al.channelManager == nil {
+		return channels.ScheduledMessage{}, errNoChannels
+	}
+	return al.channelManager.ScheduleMessage(msg, at, by)
+}
+
+// ScheduledMessages returns every message waiting for its time, soonest
+// first.
+func (al *AgentLoop) ScheduledMessages() []channels.ScheduledMessage {
+	if al.channelManager == nil {
+		return nil
+	}
+	return al.channelManager.ScheduledMessages()
+}
+
+// CancelScheduled cancels the scheduled message id.
+func (al *AgentLoop) CancelScheduled(id string) (channels.ScheduledMessage, error) {
+	if al.channelManager == nil {
+		return channels.ScheduledMessage{}, channels.ErrNoScheduledMessage
+	}
+	return al.channelManager.CancelScheduled(id)
+}
+
+// scheduledMessages returns the messages scheduled to or from the chat of
+// msg, soonest first.
+func (al *AgentLoop) scheduledMessages(msg bus.InboundMessage) []channels.ScheduledMessage {
+	var out []channels.ScheduledMessage
+	for _, sm := range al.ScheduledMessages() {
+		if sm.Message.Channel == msg.Channel && sm.Message.ChatID == msg.ChatID || sm.By == msg.Channel+":"+msg.ChatID {
+			out = append(out, sm)
+		}
+	}
+	return out
+}
+
+// scheduledMessage returns the scheduled message id if it goes to or was
+// scheduled from the chat of msg, or any when msg comes from the admin
+// chat.
+func (al *AgentLoop) scheduledMessage(msg bus.InboundMessage, id string) (channels.ScheduledMessage, bool) {
+	messages := al.scheduledMessages(msg)
+	if al.isAdminChat(msg) {
+		messages = al.ScheduledMessages()
+	}
+	for _, sm := range messages {
+		if sm.ID == id {
+			return sm, true
+		}
+	}
+	return channels.ScheduledMessage{}, false
+}
+
+// nextRunsText lists the next three runs of schedule in loc, so the sender
+// can tell whether it was read as meant.
+func (al *AgentLoop) nextRunsText(msg bus.InboundMessage, schedule cron.CronSchedule, loc *time.Location) string {
+	runs := cron.NextRuns(schedule, time.Now(), 3)
+	if len(runs) == 0 {
+		return "\n" + al.t(msg, "It will not run again.")
+	}
+	text := "\n" + al.t(msg, "Next runs:")
+	for _, run := range runs {
+		text += "\n- " + formatRun(run, loc)
+	}
+	return text
+}
+
+// formatRun formats the time of a run in loc.
+func formatRun(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("Mon 2006-01-02 15:04 MST")
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestScheduleCommand(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &simpleMockProvider{response: "ok"})
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "chat1"}
+	run := func(args ...string) string { return al.handleScheduleCommand(msg, args) }
+
+	if got := run(); !strings.Contains(got, "only available in the gateway") {
+		t.Errorf("without a cron service got %q", got)
+	}
+
+	cs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	al.SetCronService(cs)
+	if _, err := al.profiles.Update(profileID(msg), func(p *state.Profile) { p.Timezone = "Europe/Berlin" }); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := run(); !strings.Contains(got, "Nothing is scheduled") {
+		t.Errorf("empty list got %q", got)
+	}
+	got := run("preview", "every", "weekday", "at", "8")
+	if !strings.Contains(got, "Read as: every weekday at 8 (Europe/Berlin)") || strings.Count(got, "\n- ") != 3 {
+		t.Errorf("preview got %q", got)
+	}
+	if got := run("preview", "whenever"); !strings.Contains(got, "Could not read") {
+		t.Errorf("unreadable preview got %q", got)
+	}
+
+	every := int64(3600000)
+	job, err := cs.AddJob("water the plants", cron.CronSchedule{Kind: "every", EveryMS: &every}, "water the plants", true, "telegram", "chat1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cs.AddJob("elsewhere", cron.CronSchedule{Kind: "every", EveryMS: &every}, "elsewhere", true, "telegram", "chat2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = run()
+	if !strings.Contains(got, job.ID+": water the plants — every 1h, next ") || strings.Contains(got, "elsewhere") {
+		t.Errorf("list got %q", got)
+	}
+
+	got = run("set", job.ID, "first", "monday", "of", "the", "month", "at", "9:30")
+	if !strings.Contains(got, "water the plants now runs first monday of the month at 9:30 (Europe/Berlin).") {
+		t.Errorf("set got %q", got)
+	}
+	jobs := cs.ListJobs(true)
+	if jobs[0].Schedule.Kind != "cron" || jobs[0].Schedule.Expr != "30 9 * * 1#1" || jobs[0].Schedule.TZ != "Europe/Berlin" {
+		t.Errorf("rescheduled job has %+v", jobs[0].Schedule)
+	}
+	if got := run("set", other.ID, "daily"); !strings.Contains(got, "There is no job") {
+		t.Errorf("set on another chat's job got %q", got)
+	}
+
+	if got := run("pause", job.ID); got != "Paused water the plants." {
+		t.Errorf("pause got %q", got)
+	}
+	if got := run(); !strings.Contains(got, ", paused") {
+		t.Errorf("list after pause got %q", got)
+	}
+	if got := run("resume", job.ID); got != "Resumed water the plants." {
+		t.Errorf("resume got %q", got)
+	}
+	if got := run("remove", job.ID); got != "Removed water the plants." {
+		t.Errorf("remove got %q", got)
+	}
+	if len(cs.ListJobs(true)) != 1 {
+		t.Errorf("jobs after remove: %+v", cs.ListJobs(true))
+	}
+}
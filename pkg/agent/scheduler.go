@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// scheduler caps the agent runs going on at once, see config.BudgetConfig.
+// Runs answering users take up to maxInteractive of the slots, the
+// dispatcher's chats; background runs, for cron jobs, heartbeats,
+// triggers and workflows, the rest. Waiting runs get a slot in order of
+// arrival, those answering users ahead of background ones. Commands take
+// subprocess slots of their own, see tools.LimitSubprocesses; there are no
+// browser slots, as there is no browser tool.
+type scheduler struct {
+	maxRuns        int // 0 for no cap
+	maxInteractive int // 0 for no cap
+
+	mu          sync.Mutex
+	running     int
+	interactive int
+	waiting     []*ticket
+}
+
+// ticket is a run waiting for a slot.
+type ticket struct {
+	background bool
+	granted    chan struct{} // closed once the run has its slot
+}
+
+func newScheduler(maxRuns, maxInteractive int) *scheduler {
+	return &scheduler{maxRuns: max(maxRuns, 0), maxInteractive: max(maxInteractive, 0)}
+}
+
+// acquire waits for a run slot and returns the function that frees it.
+// When the run has to wait, queued is called with its place in the line,
+// 1 for next. It fails if ctx ends first.
+func (s *scheduler) acquire(ctx context.Context, background bool, queued func(position int)) (func(), error) {
+	t := &ticket{background: background, granted: make(chan struct{})}
+	s.mu.Lock()
+	// Those waiting do not fit, or they would have been let in already.
+	if s.fits(t) {
+		s.admit(t)
+		s.mu.Unlock()
+		return s.releaser(t), nil
+	}
+	// Interactive runs line up behind the interactive ones already
+	// waiting, ahead of any background run.
+	i := len(s.waiting)
+	if !background {
+		i = slices.IndexFunc(s.waiting, func(w *ticket) bool { return w.background })
+		if i < 0 {
+			i = len(s.waiting)
+		}
+	}
+	s.waiting = slices.Insert(s.waiting, i, t)
+	s.mu.Unlock()
+
+	if queued != nil {
+		queued(i + 1)
+	}
+	select {
+	case <-t.granted:
+		return s.releaser(t), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if i := slices.Index(s.waiting, t); i >= 0 {
+			s.waiting = slices.Delete(s.waiting, i, i+1)
+			s.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		s.mu.Unlock()
+		// The slot was granted meanwhile; hand it on.
+		s.releaser(t)()
+		return nil, ctx.Err()
+	}
+}
+
+// fits reports whether t can run now. s.mu is held.
+func (s *scheduler) fits(t *ticket) bool {
+	if s.maxRuns > 0 && s.running >= s.maxRuns {
+		return false
+	}
+	return t.background || s.maxInteractive == 0 || s.interactive < s.maxInteractive
+}
+
+// admit counts t as running. s.mu is held.
+func (s *scheduler) admit(t *ticket) {
+	s.running++
+	if !t.background {
+		s.interactive++
+	}
+}
+
+func (s *scheduler) releaser(t *ticket) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			if !t.background {
+				s.interactive--
+			}
+			// Let in the first waiting runs that fit; an interactive run held
+			// back by maxInteractive does not block background ones behind it.
+			s.waiting = slices.DeleteFunc(s.waiting, func(w *ticket) bool {
+				if !s.fits(w) {
+					return false
+				}
+				s.admit(w)
+				close(w.granted)
+				return true
+			})
+		})
+	}
+}
+
+// counts returns the number of runs going on and of those waiting.
+func (s *scheduler) counts() (running, waiting int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, len(s.waiting)
+}
+
+// runSlotKey marks a context whose run already holds a slot, so the runs
+// it starts, such as a message's run under the dispatcher's slot, do not
+// wait for another.
+type runSlotKey struct{}
+
+func withRunSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, runSlotKey{}, true)
+}
+
+func holdsRunSlot(ctx context.Context) bool {
+	held, _ := ctx.Value(runSlotKey{}).(bool)
+	return held
+}
+
+// machineMemoryMB returns the memory picoclaw may use in MB: the lower of
+// the cgroup's limit and the machine's, 0 if neither is known.
+func machineMemoryMB() int {
+	total := 0
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rest, ok := strings.CutPrefix(scanner.Text(), "MemTotal:"); ok {
+				kb, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(rest), " kB"))
+				total = kb / 1024
+				break
+			}
+		}
+		f.Close()
+	}
+	if data, err := os.ReadFile("/sys/fs/cgroup/memory.max"); err == nil {
+		if limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			mb := int(limit >> 20)
+			if total == 0 || mb < total {
+				total = mb
+			}
+		}
+	}
+	return total
+}
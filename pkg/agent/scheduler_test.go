@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// acquireRun starts waiting for a run slot and reports the run's place in
+// the line and when it gets its slot.
+func acquireRun(ctx context.Context, s *scheduler, background bool) (<-chan int, <-chan func()) {
+	positions := make(chan int, 1)
+	admitted := make(chan func(), 1)
+	go func() {
+		release, err := s.acquire(ctx, background, func(position int) { positions <- position })
+		if err == nil {
+			admitted <- release
+		}
+	}()
+	return positions, admitted
+}
+
+func admittedWithin(t *testing.T, admitted <-chan func()) func() {
+	t.Helper()
+	select {
+	case release := <-admitted:
+		return release
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not get a slot")
+		return nil
+	}
+}
+
+func TestScheduler_InteractiveRunsGoFirst(t *testing.T) {
+	s := newScheduler(1, 0)
+	ctx := context.Background()
+
+	running, _ := s.acquire(ctx, false, nil)
+	jobPos, job := acquireRun(ctx, s, true)
+	if pos := <-jobPos; pos != 1 {
+		t.Fatalf("background run position = %d, want 1", pos)
+	}
+	chatPos, chat := acquireRun(ctx, s, false)
+	if pos := <-chatPos; pos != 1 {
+		t.Fatalf("chat position = %d, want 1, ahead of the background run", pos)
+	}
+	if _, waiting := s.counts(); waiting != 2 {
+		t.Fatalf("waiting = %d, want 2", waiting)
+	}
+
+	running()
+	release := admittedWithin(t, chat)
+	select {
+	case <-job:
+		t.Fatal("background run got a slot while the cap was reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	admittedWithin(t, job)()
+
+	if running, waiting := s.counts(); running != 0 || waiting != 0 {
+		t.Fatalf("counts = %d running, %d waiting; want none", running, waiting)
+	}
+}
+
+func TestScheduler_ChatCapLeavesRoomForBackground(t *testing.T) {
+	s := newScheduler(3, 1)
+	ctx := context.Background()
+
+	chat, _ := s.acquire(ctx, false, nil)
+	chat2Pos, chat2 := acquireRun(ctx, s, false)
+	if pos := <-chat2Pos; pos != 1 {
+		t.Fatalf("second chat position = %d, want 1", pos)
+	}
+	// The second chat waits for the first, but background runs fit.
+	job, err := s.acquire(ctx, true, func(int) { t.Error("background run had to wait") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	job()
+	chat()
+	admittedWithin(t, chat2)()
+}
+
+func TestScheduler_CanceledWhileWaiting(t *testing.T) {
+	s := newScheduler(1, 0)
+	running, _ := s.acquire(context.Background(), false, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	failed := make(chan error, 1)
+	go func() {
+		_, err := s.acquire(ctx, true, func(int) { cancel() })
+		failed <- err
+	}()
+	if err := <-failed; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	running()
+	if running, waiting := s.counts(); running != 0 || waiting != 0 {
+		t.Fatalf("counts = %d running, %d waiting; want none", running, waiting)
+	}
+}
+
+func TestDispatcher_TellsChatsTheirPlaceInLine(t *testing.T) {
+	r := newRecorder("a")
+	positions := make(chan int, 4)
+	d := newDispatcher(config.QueueConfig{MaxPending: 10}, newScheduler(0, 1), r.handle,
+		func(msg bus.InboundMessage, position int) {
+			if msg.Content != "hi from "+msg.ChatID {
+				t.Errorf("queued message = %q", msg.Content)
+			}
+			positions <- position
+		})
+	ctx := context.Background()
+
+	d.submit(ctx, inbound("a", "u1", "hi from a"))
+	<-r.started
+	for want, chat := range []string{"b", "c"} {
+		d.submit(ctx, inbound(chat, "u2", "hi from "+chat))
+		select {
+		case got := <-positions:
+			if got != want+1 {
+				t.Fatalf("chat %s position = %d, want %d", chat, got, want+1)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("chat %s was not told its position", chat)
+		}
+	}
+	close(r.hold["a"])
+	r.wait(t, 3)
+}
@@ -0,0 +1,293 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// handleSessionCommand handles the commands that act on the session a
+// message was routed to: /new, /reset, /undo, /branch, /sessions,
+// /session, /persona, and /pin and /pins for the instructions pinned to the
+// chat.
+// routedKey is the session key from routing, before any /new redirect.
+func (al *AgentLoop) handleSessionCommand(agent *AgentInstance, routedKey string, msg bus.InboundMessage) (string, bool) {
+	parts := strings.Fields(strings.TrimSpace(msg.Content))
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "/") {
+		return "", false
+	}
+	args := parts[1:]
+	sessions := agent.Sessions
+	current := sessions.Resolve(routedKey)
+
+	switch parts[0] {
+	case "/new":
+		sessions.StartNew(routedKey)
+		return al.t(msg, "Started a new conversation. Earlier ones are listed by /sessions."), true
+
+	case "/reset":
+		sessions.Reset(current)
+		return al.t(msg, "Conversation history cleared."), true
+
+	case "/undo", "/branch":
+		n := 1
+		if parts[0] == "/branch" {
+			n = 0
+		}
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return al.t(msg, "Usage: %s [turns]", parts[0]), true
+			}
+		}
+		history := sessions.GetHistory(current)
+		cut, turns := turnStart(history, n)
+		if parts[0] == "/branch" {
+			sessions.Branch(routedKey, current, cut)
+			if n == 0 {
+				return al.t(msg, "Branched this conversation; the original is kept and listed by /sessions."), true
+			}
+			return al.t(msg, "Branched this conversation as it was %d turns ago; "+
+				"the original is kept and listed by /sessions.", turns), true
+		}
+		if turns == 0 {
+			return al.t(msg, "There is nothing to undo in this conversation."), true
+		}
+		// Facts the undone turns remembered go with them, from the memory
+		// of the agent that answered.
+		answering := agent
+		if pinned, ok := al.registry.GetAgent(sessions.GetInfo(current).AgentID); ok {
+			answering = pinned
+		}
+		forgotten := 0
+		for _, id := range rememberedIn(history[cut:]) {
+			if ok, _ := answering.ContextBuilder.memory.facts.Forget(id); ok {
+				forgotten++
+			}
+		}
+		sessions.SetHistory(current, history[:cut])
+		sessions.Save(current)
+		reply := al.t(msg, "Undid the last %d turns.", turns)
+		if turns == 1 {
+			reply = al.t(msg, "Undid the last turn.")
+		}
+		if forgotten > 0 {
+			reply += al.t(msg, " Forgot %d facts remembered in them.", forgotten)
+		}
+		return reply, true
+
+	case "/sessions":
+		infos := sessions.List(routedKey)
+		if len(infos) == 0 {
+			return al.t(msg, "No conversations in this chat yet."), true
+		}
+		var b strings.Builder
+		b.WriteString(al.t(msg, "Conversations in this chat:") + "\n")
+		now := time.Now()
+		for _, info := range infos {
+			marker := "-"
+			if info.Key == current {
+				marker = "*"
+			}
+			b.WriteString(al.t(msg, "%s %d messages, last active %s ago%s",
+				marker, info.Messages, now.Sub(info.Updated).Round(time.Minute), describePins(info.AgentID, info.Model)) + "\n")
+		}
+		return strings.TrimRight(b.String(), "\n"), true
+
+	case "/persona":
+		info := sessions.GetInfo(current)
+		if len(args) == 0 {
+			answering := agent.ID
+			if info.AgentID != "" {
+				answering = info.AgentID
+			}
+			var b strings.Builder
+			b.WriteString(al.t(msg, "Personas (switch with /persona <id>, back with /persona default):") + "\n")
+			for _, id := range slices.Sorted(slices.Values(al.registry.ListAgentIDs())) {
+				marker := "-"
+				if id == answering {
+					marker = "*"
+				}
+				fmt.Fprintf(&b, "%s %s", marker, id)
+				if a, ok := al.registry.GetAgent(id); ok && a.Name != "" && a.Name != id {
+					fmt.Fprintf(&b, " (%s)", a.Name)
+				}
+				b.WriteString("\n")
+			}
+			return strings.TrimRight(b.String(), "\n"), true
+		}
+		if len(args) > 1 {
+			return al.t(msg, "Usage: /persona [<id>|default]"), true
+		}
+		persona, ok := al.registry.GetAgent(args[0])
+		// With routing rules the agent the chat is routed to is a choice of
+		// its own, not the way back to the rules.
+		rules := len(al.cfg.Routing.Rules) > 0 || al.cfg.Routing.Fallback != ""
+		if args[0] == "default" || (ok && persona.ID == agent.ID && !rules) {
+			sessions.Pin(current, "", info.Model)
+			if rules {
+				return al.t(msg, "This conversation follows the routing rules again."), true
+			}
+			return al.t(msg, "This conversation is answered by %s again.", agent.ID), true
+		}
+		if !ok {
+			return al.t(msg, "Unknown persona: %s. Personas: %s",
+				args[0], strings.Join(slices.Sorted(slices.Values(al.registry.ListAgentIDs())), ", ")), true
+		}
+		sessions.Pin(current, persona.ID, info.Model)
+		return al.t(msg, "This conversation is answered by %s until /new or /persona default.", persona.ID), true
+
+	case "/pin":
+		instruction := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(msg.Content), "/pin"))
+		if instruction == "" {
+			return al.t(msg, "Usage: /pin <instruction>, e.g. /pin always answer in German here"), true
+		}
+		if err := sessions.AddInstruction(routedKey, instruction); err != nil {
+			return al.t(msg, "Failed to pin the instruction: %v", err), true
+		}
+		return al.t(msg, "Pinned. I'll follow that in this chat; /pins lists what is pinned."), true
+
+	case "/pins":
+		if len(args) == 0 {
+			pinned := sessions.Instructions(routedKey)
+			if len(pinned) == 0 {
+				return al.t(msg, "Nothing is pinned in this chat. Pin an instruction with /pin <instruction>."), true
+			}
+			var b strings.Builder
+			b.WriteString(al.t(msg, "Pinned in this chat (remove with /pins remove <n>|all):") + "\n")
+			for i, instruction := range pinned {
+				fmt.Fprintf(&b, "%d. %s\n", i+1, instruction)
+			}
+			return strings.TrimRight(b.String(), "\n"), true
+		}
+		if len(args) != 2 || args[0] != "remove" {
+			return al.t(msg, "Usage: /pins [remove <n>|all]"), true
+		}
+		n := 0
+		if args[1] != "all" {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return al.t(msg, "Usage: /pins [remove <n>|all]"), true
+			}
+		}
+		removed, err := sessions.RemoveInstruction(routedKey, n)
+		if err != nil {
+			return al.t(msg, "Failed to unpin: %v", err), true
+		}
+		if len(removed) == 0 {
+			return al.t(msg, "There is no pinned instruction %d.", n), true
+		}
+		if n == 0 {
+			return al.t(msg, "Removed %d pinned instructions.", len(removed)), true
+		}
+		return al.t(msg, "Removed: %s", removed[0]), true
+
+	case "/session":
+		if len(args) == 0 {
+			info := sessions.GetInfo(current)
+			return al.t(msg, "Current conversation: %d messages%s", info.Messages, describePins(info.AgentID, info.Model)), true
+		}
+		info := sessions.GetInfo(current)
+		switch args[0] {
+		case "agent":
+			if len(args) < 2 {
+				return al.t(msg, "Usage: /session agent <id>"), true
+			}
+			if _, ok := al.registry.GetAgent(args[1]); !ok {
+				return al.t(msg, "Unknown agent: %s. Registered agents: %s",
+					args[1], strings.Join(al.registry.ListAgentIDs(), ", ")), true
+			}
+			sessions.Pin(current, args[1], info.Model)
+			return al.t(msg, "This conversation now uses agent %s", args[1]), true
+		case "model":
+			if len(args) < 2 {
+				return al.t(msg, "Usage: /session model <name>"), true
+			}
+			sessions.Pin(current, info.AgentID, args[1])
+			return al.t(msg, "This conversation now uses model %s", args[1]), true
+		case "unpin":
+			sessions.Pin(current, "", "")
+			return al.t(msg, "This conversation uses the default agent and model again"), true
+		default:
+			return al.t(msg, "Usage: /session [agent <id>|model <name>|unpin]"), true
+		}
+	}
+	return "", false
+}
+
+// rememberedFact matches the result of the remember tool.
+var rememberedFact = regexp.MustCompile(`^Remembered #(\d+)`)
+
+// turnStart returns where the last n turns of history begin, each turn
+// being a user message and everything after it, and how many turns there
+// are from there, fewer than n if the history is shorter. With n 0 it
+// returns the end of history.
+func turnStart(history []providers.Message, n int) (int, int) {
+	cut, turns := len(history), 0
+	for i := len(history) - 1; i >= 0 && turns < n; i-- {
+		if history[i].Role == "user" {
+			cut, turns = i, turns+1
+		}
+	}
+	return cut, turns
+}
+
+// rememberedIn returns the IDs of the facts the remember tool recorded in
+// messages.
+func rememberedIn(messages []providers.Message) []int {
+	calls := make(map[string]bool)
+	var ids []int
+	for _, m := range messages {
+		for _, tc := range m.ToolCalls {
+			name := tc.Name
+			if tc.Function != nil {
+				name = tc.Function.Name
+			}
+			if name == "remember" {
+				calls[tc.ID] = true
+			}
+		}
+		if m.Role != "tool" || !calls[m.ToolCallID] {
+			continue
+		}
+		if match := rememberedFact.FindStringSubmatch(m.Content); match != nil {
+			id, _ := strconv.Atoi(match[1])
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// pinnedNotes lists the instructions pinned to the chat for the model.
+func pinnedNotes(instructions []string) string {
+	if len(instructions) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n## Pinned Instructions\n")
+	b.WriteString("Standing instructions for this chat, pinned by its members. Follow them unless asked otherwise:\n")
+	for i, instruction := range instructions {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, instruction)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func describePins(agentID, model string) string {
+	var pins []string
+	if agentID != "" {
+		pins = append(pins, "agent "+agentID)
+	}
+	if model != "" {
+		pins = append(pins, "model "+model)
+	}
+	if len(pins) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(pins, ", ") + ")"
+}
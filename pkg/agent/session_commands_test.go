@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// historyProvider records the model, the number of messages and the
+// system prompt it was called with.
+type historyProvider struct {
+	models   []string
+	messages []int
+	prompts  []string
+}
+
+func (p *historyProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	p.messages = append(p.messages, len(messages))
+	p.prompts = append(p.prompts, messages[0].Content)
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *historyProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestSessionCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &historyProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+
+	inThread := func(thread, content string) bus.InboundMessage {
+		return bus.InboundMessage{
+			Channel:  "slack",
+			SenderID: "u1",
+			ChatID:   "C1/" + thread,
+			Content:  content,
+			Metadata: map[string]string{"peer_kind": "channel", "peer_id": "C1", "thread_id": thread},
+		}
+	}
+	lastLen := func() int { return provider.messages[len(provider.messages)-1] }
+
+	h.executeAndGetResponse(t, ctx, inThread("t1", "hello"))
+	first := lastLen()
+	h.executeAndGetResponse(t, ctx, inThread("t1", "again"))
+	if lastLen() != first+2 {
+		t.Fatalf("same thread did not continue: %d then %d messages", first, lastLen())
+	}
+	h.executeAndGetResponse(t, ctx, inThread("t2", "other thread"))
+	if lastLen() != first {
+		t.Errorf("second thread saw %d messages, want a fresh session (%d)", lastLen(), first)
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, inThread("t1", "/new")); !strings.Contains(got, "new conversation") {
+		t.Errorf("/new = %q", got)
+	}
+	h.executeAndGetResponse(t, ctx, inThread("t1", "fresh start"))
+	if lastLen() != first {
+		t.Errorf("after /new the model saw %d messages, want %d", lastLen(), first)
+	}
+
+	h.executeAndGetResponse(t, ctx, inThread("t1", "/session model pinned-model"))
+	h.executeAndGetResponse(t, ctx, inThread("t1", "which model?"))
+	if got := provider.models[len(provider.models)-1]; got != "pinned-model" {
+		t.Errorf("model = %q, want pinned-model", got)
+	}
+
+	list := h.executeAndGetResponse(t, ctx, inThread("t1", "/sessions"))
+	if strings.Count(list, "messages") != 2 || !strings.Contains(list, "* 4 messages") ||
+		!strings.Contains(list, "model pinned-model") {
+		t.Errorf("/sessions = %q", list)
+	}
+
+	h.executeAndGetResponse(t, ctx, inThread("t1", "/reset"))
+	h.executeAndGetResponse(t, ctx, inThread("t1", "after reset"))
+	if lastLen() != first {
+		t.Errorf("after /reset the model saw %d messages, want %d", lastLen(), first)
+	}
+	if got := provider.models[len(provider.models)-1]; got != "pinned-model" {
+		t.Errorf("/reset dropped the model pin, model = %q", got)
+	}
+}
+
+func TestPersonaCommand(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true},
+				{ID: "work", Name: "Work assistant", Workspace: t.TempDir(),
+					Model: &config.AgentModelConfig{Primary: "work-model"}},
+			},
+		},
+	}
+	provider := &historyProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	in := func(content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "1", Content: content}
+	}
+	lastModel := func() string { return provider.models[len(provider.models)-1] }
+
+	if got := h.executeAndGetResponse(t, ctx, in("/persona")); !strings.Contains(got, "* main\n- work (Work assistant)") {
+		t.Errorf("/persona = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("/persona home")); !strings.Contains(got, "Unknown persona") {
+		t.Errorf("/persona home = %q", got)
+	}
+	h.executeAndGetResponse(t, ctx, in("/persona work"))
+	h.executeAndGetResponse(t, ctx, in("hello"))
+	h.executeAndGetResponse(t, ctx, in("/reset"))
+	h.executeAndGetResponse(t, ctx, in("still there?"))
+	if lastModel() != "work-model" {
+		t.Errorf("model after /persona work and /reset = %q", lastModel())
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("/persona")); !strings.Contains(got, "- main\n* work") {
+		t.Errorf("/persona after switching = %q", got)
+	}
+
+	// The choice is kept in the session store, so a restarted gateway
+	// keeps answering with it.
+	restarted := testHelper{al: newTestLoop(t, cfg, bus.NewMessageBus(), provider)}
+	restarted.executeAndGetResponse(t, ctx, in("after a restart"))
+	if lastModel() != "work-model" {
+		t.Errorf("model after a restart = %q", lastModel())
+	}
+
+	h.executeAndGetResponse(t, ctx, in("/session model small"))
+	h.executeAndGetResponse(t, ctx, in("/persona default"))
+	h.executeAndGetResponse(t, ctx, in("back"))
+	if lastModel() != "small" {
+		t.Errorf("/persona default dropped the model pin, model = %q", lastModel())
+	}
+	h.executeAndGetResponse(t, ctx, in("/new"))
+	h.executeAndGetResponse(t, ctx, in("fresh"))
+	if lastModel() != "test-model" {
+		t.Errorf("model after /new = %q", lastModel())
+	}
+}
+
+func TestPinnedInstructions(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &historyProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	in := func(thread, content string) bus.InboundMessage {
+		return bus.InboundMessage{
+			Channel:  "slack",
+			SenderID: "u1",
+			ChatID:   "C1/" + thread,
+			Content:  content,
+			Metadata: map[string]string{"peer_kind": "channel", "peer_id": "C1", "thread_id": thread},
+		}
+	}
+	lastPrompt := func() string { return provider.prompts[len(provider.prompts)-1] }
+
+	h.executeAndGetResponse(t, ctx, in("t1", "/pin always answer in German here"))
+	h.executeAndGetResponse(t, ctx, in("t1", "/pin this chat is about project X"))
+	h.executeAndGetResponse(t, ctx, in("t1", "hello"))
+	if !strings.Contains(lastPrompt(), "## Pinned Instructions") ||
+		!strings.Contains(lastPrompt(), "1. always answer in German here\n2. this chat is about project X") {
+		t.Errorf("pins missing from the prompt:\n%s", lastPrompt())
+	}
+
+	// Pins belong to the chat: they outlive /reset and /new, and other
+	// threads do not see them.
+	h.executeAndGetResponse(t, ctx, in("t1", "/reset"))
+	h.executeAndGetResponse(t, ctx, in("t1", "/new"))
+	h.executeAndGetResponse(t, ctx, in("t1", "hello again"))
+	if !strings.Contains(lastPrompt(), "project X") {
+		t.Error("pins lost after /reset and /new")
+	}
+	h.executeAndGetResponse(t, ctx, in("t2", "hello"))
+	if strings.Contains(lastPrompt(), "Pinned Instructions") {
+		t.Error("another thread sees the pins of t1")
+	}
+
+	got := h.executeAndGetResponse(t, ctx, in("t1", "/pins"))
+	if !strings.Contains(got, "2. this chat is about project X") {
+		t.Errorf("/pins = %q", got)
+	}
+	got = h.executeAndGetResponse(t, ctx, in("t1", "/pins remove 1"))
+	if got != "Removed: always answer in German here" {
+		t.Errorf("/pins remove 1 = %q", got)
+	}
+	got = h.executeAndGetResponse(t, ctx, in("t1", "/pins remove 5"))
+	if !strings.Contains(got, "no pinned instruction 5") {
+		t.Errorf("/pins remove 5 = %q", got)
+	}
+	h.executeAndGetResponse(t, ctx, in("t1", "/pins remove all"))
+	if got := h.executeAndGetResponse(t, ctx, in("t1", "/pins")); !strings.Contains(got, "Nothing is pinned") {
+		t.Errorf("/pins after removing all = %q", got)
+	}
+}
+
+// undoProvider remembers a fact when told "I'm vegetarian" and records the
+// number of messages of every request.
+type undoProvider struct {
+	messages []int
+}
+
+func (p *undoProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.messages = append(p.messages, len(messages))
+	last := messages[len(messages)-1]
+	if last.Role == "user" && strings.Contains(last.Content, "I'm vegetarian") {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:        "call_1",
+			Type:      "function",
+			Name:      "remember",
+			Arguments: map[string]any{"fact": "The user is vegetarian"},
+		}}}, nil
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *undoProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestUndoAndBranch(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &undoProvider{}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), provider)
+	h := testHelper{al: al}
+	ctx := context.Background()
+	in := func(content string) bus.InboundMessage {
+		return bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "42", Content: content}
+	}
+	lastLen := func() int { return provider.messages[len(provider.messages)-1] }
+	facts := al.registry.GetDefaultAgent().ContextBuilder.memory.facts
+
+	h.executeAndGetResponse(t, ctx, in("hello"))
+	first := lastLen()
+	h.executeAndGetResponse(t, ctx, in("I'm vegetarian"))
+	if len(facts.All()) != 1 {
+		t.Fatalf("facts = %+v", facts.All())
+	}
+
+	got := h.executeAndGetResponse(t, ctx, in("/undo"))
+	if got != "Undid the last turn. Forgot 1 facts remembered in them." {
+		t.Errorf("/undo = %q", got)
+	}
+	if len(facts.All()) != 0 {
+		t.Errorf("facts after /undo = %+v", facts.All())
+	}
+	h.executeAndGetResponse(t, ctx, in("again"))
+	if lastLen() != first+2 {
+		t.Errorf("after /undo the model saw %d messages, want %d", lastLen(), first+2)
+	}
+
+	// A branch continues from the same state; the original is kept.
+	if got = h.executeAndGetResponse(t, ctx, in("/branch 1")); !strings.Contains(got, "as it was 1 turns ago") {
+		t.Errorf("/branch 1 = %q", got)
+	}
+	h.executeAndGetResponse(t, ctx, in("in the branch"))
+	if lastLen() != first+2 {
+		t.Errorf("in the branch the model saw %d messages, want %d", lastLen(), first+2)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("/sessions")); strings.Count(got, "messages") != 2 {
+		t.Errorf("/sessions = %q", got)
+	}
+
+	if got := h.executeAndGetResponse(t, ctx, in("/undo 5")); got != "Undid the last 2 turns." {
+		t.Errorf("/undo 5 = %q", got)
+	}
+	if got := h.executeAndGetResponse(t, ctx, in("/undo")); !strings.Contains(got, "nothing to undo") {
+		t.Errorf("/undo on an empty conversation = %q", got)
+	}
+}
@@ -0,0 +1,409 @@
+package agent
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Status is a snapshot of the gateway for monitoring: /status in an admin
+// chat, GET /status on the health server and picoclaw status.
+type Status struct {
+	Time time.Time `json:"time"`
+	// Running is false when the status was read from the workspace
+	// because no gateway answered; only Stores, Cron and Events are set
+	// then.
+	Running   bool             `json:"running"`
+	Channels  []ChannelStatus  `json:"channels"`
+	Providers []ProviderStatus `json:"providers"`
+	Queue     QueueStatus      `json:"queue"`
+	Runs      []RunStatus      `json:"active_runs"`
+	Stores    []StoreStatus    `json:"stores"`
+	Process   *ProcessStatus   `json:"process,omitempty"`
+	Cron      []CronStatus     `json:"cron"`
+	Events    []state.RunEvent `json:"recent_events"`
+}
+
+// ChannelStatus is the connection of a channel.
+type ChannelStatus struct {
+	Name       string    `json:"name"`
+	Up         bool      `json:"up"`
+	Since      time.Time `json:"since,omitzero"`
+	LastError  string    `json:"last_error,omitempty"`
+	Reconnects int       `json:"reconnects"`
+}
+
+// ProviderStatus sums up the recent LLM requests served by, or failed at,
+// one provider and model.
+type ProviderStatus struct {
+	Name        string    `json:"name"` // "provider/model", or the model_list entry
+	Requests    int       `json:"requests"`
+	Failures    int       `json:"failures"`
+	AvgMS       int64     `json:"avg_ms"`
+	LastOK      time.Time `json:"last_ok,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+}
+
+// QueueStatus counts the messages waiting at each stage.
+type QueueStatus struct {
+	Waiting             int `json:"waiting"`              // inbound messages not yet taken up
+	ActiveChats         int `json:"active_chats"`         // chats with a message queued or running
+	Batched             int `json:"batched"`              // group messages held until their chat is quiet
+	BackgroundWaiting   int `json:"background_waiting"`   // LLM requests of scheduled work
+	Runs                int `json:"runs"`                 // agent runs holding a slot
+	RunsWaiting         int `json:"runs_waiting"`         // agent runs waiting for a slot
+	SubprocessesWaiting int `json:"subprocesses_waiting"` // tool commands waiting for a slot
+	PendingDeliveries   int `json:"pending_deliveries"`   // replies waiting to be sent again
+	ScheduledMessages   int `json:"scheduled_messages"`   // messages waiting for the time they were scheduled for
+}
+
+// RunStatus is a message being answered.
+type RunStatus struct {
+	Chat    string    `json:"chat"` // "channel:chat_id"
+	Started time.Time `json:"started"`
+}
+
+// StoreStatus is the disk space a part of the workspace takes.
+type StoreStatus struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ProcessStatus is the memory and other resources the gateway process
+// uses.
+type ProcessStatus struct {
+	HeapBytes     uint64        `json:"heap_bytes"`
+	SysBytes      uint64        `json:"sys_bytes"` // obtained from the OS
+	Goroutines    int           `json:"goroutines"`
+	GCRuns        uint32        `json:"gc_runs"`
+	GCPauseLast   time.Duration `json:"gc_pause_last_ns"`
+	GCPauseTotal  time.Duration `json:"gc_pause_total_ns"`
+	OpenFiles     int           `json:"open_files"` // -1 where the system does not tell
+	UptimeSeconds int64         `json:"uptime_seconds"`
+}
+
+// CronStatus is the last and next run of a scheduled job.
+type CronStatus struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Enabled    bool      `json:"enabled"`
+	LastRun    time.Time `json:"last_run,omitzero"`
+	LastStatus string    `json:"last_status,omitempty"`
+	LastError  string    `json:"last_error,omitempty"`
+	NextRun    time.Time `json:"next_run,omitzero"`
+}
+
+// statusStores are the parts of a workspace whose size Status reports.
+var statusStores = []string{"sessions", "memory", "state", "attachments", "cron", "skills"}
+
+// statusLLMEvents is how many of the latest LLM requests ProviderStatus
+// sums up.
+const statusLLMEvents = 200
+
+// WorkspaceStatus returns what can be told about the gateway of cfg
+// without it: the size of its stores, its cron jobs and its run events.
+func WorkspaceStatus(cfg *config.Config) Status {
+	workspace := cfg.WorkspacePath()
+	st := Status{Time: time.Now(), Stores: storeSizes(workspace)}
+
+	jobs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil).ListJobs(true)
+	for _, job := range jobs {
+		st.Cron = append(st.Cron, CronStatus{
+			ID:         job.ID,
+			Name:       job.Name,
+			Enabled:    job.Enabled,
+			LastRun:    fromMS(job.State.LastRunAtMS),
+			LastStatus: job.State.LastStatus,
+			LastError:  job.State.LastError,
+			NextRun:    fromMS(job.State.NextRunAtMS),
+		})
+	}
+
+	// Self reports come regularly and would crowd out the events that
+	// tell something happened.
+	events, _ := state.NewEventLog(workspace).Recent(50)
+	for i := len(events) - 1; i >= 0 && len(st.Events) < 5; i-- {
+		if events[i].Kind != "self_report" {
+			st.Events = append([]state.RunEvent{events[i]}, st.Events...)
+		}
+	}
+	return st
+}
+
+// Status returns a snapshot of the running gateway.
+func (al *AgentLoop) Status() Status {
+	st := WorkspaceStatus(al.cfg)
+	st.Running = true
+
+	if al.channelManager != nil {
+		for _, h := range al.channelManager.ChannelHealth() {
+			st.Channels = append(st.Channels, ChannelStatus(h))
+		}
+		st.Queue.PendingDeliveries = al.channelManager.PendingDeliveries()
+		st.Queue.ScheduledMessages = len(al.channelManager.ScheduledMessages())
+	}
+	st.Queue.Waiting = al.QueueDepth()
+	st.Queue.ActiveChats = al.ActiveChats()
+	st.Queue.Batched = al.BatchedMessages()
+	st.Queue.BackgroundWaiting = al.BackgroundWaiting()
+	st.Queue.Runs, st.Queue.RunsWaiting = al.RunSlots()
+	_, st.Queue.SubprocessesWaiting = tools.Subprocesses()
+
+	al.runsMu.Lock()
+	for chat, run := range al.runs {
+		st.Runs = append(st.Runs, RunStatus{Chat: chat, Started: run.started})
+	}
+	al.runsMu.Unlock()
+	slices.SortFunc(st.Runs, func(a, b RunStatus) int { return a.Started.Compare(b.Started) })
+
+	if events, err := al.llmEvents.Recent(statusLLMEvents); err == nil {
+		st.Providers = providerStatus(events)
+	}
+
+	p := ReadProcessStatus()
+	st.Process = &p
+	return st
+}
+
+// providerStatus sums up LLM events by the provider and model that served
+// them, counting the candidates that failed before as failures of theirs.
+func providerStatus(events []state.LLMEvent) []ProviderStatus {
+	byName := make(map[string]*ProviderStatus)
+	totalMS := make(map[string]int64)
+	get := func(provider, model string) *ProviderStatus {
+		name := model
+		if provider != "" {
+			name = provider + "/" + model
+		}
+		if p, ok := byName[name]; ok {
+			return p
+		}
+		p := &ProviderStatus{Name: name}
+		byName[name] = p
+		return p
+	}
+	for _, ev := range events {
+		for _, a := range ev.Attempts {
+			if a.Skipped {
+				continue
+			}
+			p := get(a.Provider, a.Model)
+			p.Requests++
+			p.Failures++
+			p.LastError, p.LastErrorAt = a.Error, ev.Time
+		}
+		// A request no candidate answered is told by its attempts.
+		if ev.Cached || ev.Cancelled || (ev.Error != "" && len(ev.Attempts) > 0) {
+			continue
+		}
+		p := get(ev.Provider, ev.Model)
+		p.Requests++
+		if ev.Error != "" {
+			p.Failures++
+			p.LastError, p.LastErrorAt = ev.Error, ev.Time
+			continue
+		}
+		p.LastOK = ev.Time
+		totalMS[p.Name] += ev.DurationMS
+	}
+
+	list := make([]ProviderStatus, 0, len(byName))
+	for name, p := range byName {
+		if ok := p.Requests - p.Failures; ok > 0 {
+			p.AvgMS = totalMS[name] / int64(ok)
+		}
+		list = append(list, *p)
+	}
+	slices.SortFunc(list, func(a, b ProviderStatus) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Healthy reports whether the gateway is running with all its channels up.
+func (st Status) Healthy() bool {
+	if !st.Running {
+		return false
+	}
+	for _, ch := range st.Channels {
+		if !ch.Up {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the status for a chat or a terminal.
+func (st Status) String() string {
+	var b strings.Builder
+	if !st.Running {
+		b.WriteString("Gateway: not running\n")
+	} else {
+		b.WriteString("Channels:\n")
+		if len(st.Channels) == 0 {
+			b.WriteString("- none\n")
+		}
+		for _, ch := range st.Channels {
+			status := "up"
+			if !ch.Up {
+				status = "down"
+			}
+			fmt.Fprintf(&b, "- %s: %s", ch.Name, status)
+			if !ch.Since.IsZero() {
+				fmt.Fprintf(&b, " for %s", st.Time.Sub(ch.Since).Round(time.Second))
+			}
+			if ch.Reconnects > 0 {
+				fmt.Fprintf(&b, ", %d reconnect attempts", ch.Reconnects)
+			}
+			if ch.LastError != "" {
+				fmt.Fprintf(&b, " (%s)", ch.LastError)
+			}
+			b.WriteString("\n")
+		}
+
+		if len(st.Providers) > 0 {
+			b.WriteString("Providers:\n")
+			for _, p := range st.Providers {
+				fmt.Fprintf(&b, "- %s: %d requests, %d failed", p.Name, p.Requests, p.Failures)
+				if p.AvgMS > 0 {
+					fmt.Fprintf(&b, ", %d ms on average", p.AvgMS)
+				}
+				if p.LastError != "" && p.LastErrorAt.After(p.LastOK) {
+					fmt.Fprintf(&b, ", failing since %s (%s)", p.LastErrorAt.Format("15:04"), p.LastError)
+				}
+				b.WriteString("\n")
+			}
+		}
+
+		q := st.Queue
+		fmt.Fprintf(&b, "Queue: %d waiting, %d active chats", q.Waiting, q.ActiveChats)
+		if q.Batched > 0 {
+			fmt.Fprintf(&b, ", %d batched", q.Batched)
+		}
+		if q.BackgroundWaiting > 0 {
+			fmt.Fprintf(&b, ", %d background requests waiting", q.BackgroundWaiting)
+		}
+		if q.RunsWaiting > 0 {
+			fmt.Fprintf(&b, ", %d runs waiting for a slot", q.RunsWaiting)
+		}
+		if q.SubprocessesWaiting > 0 {
+			fmt.Fprintf(&b, ", %d commands waiting for a slot", q.SubprocessesWaiting)
+		}
+		b.WriteString("\n")
+		if q.PendingDeliveries > 0 {
+			fmt.Fprintf(&b, "Undelivered replies waiting for retry: %d\n", q.PendingDeliveries)
+		}
+		if q.ScheduledMessages > 0 {
+			fmt.Fprintf(&b, "Messages scheduled for later: %d\n", q.ScheduledMessages)
+		}
+		if len(st.Runs) > 0 {
+			b.WriteString("Active runs:\n")
+			for _, r := range st.Runs {
+				fmt.Fprintf(&b, "- %s for %s\n", r.Chat, st.Time.Sub(r.Started).Round(time.Second))
+			}
+		}
+	}
+
+	var stores []string
+	for _, s := range st.Stores {
+		if s.Bytes > 0 {
+			stores = append(stores, fmt.Sprintf("%s %s", s.Name, formatSize(s.Bytes)))
+		}
+	}
+	if len(stores) > 0 {
+		fmt.Fprintf(&b, "Stores: %s\n", strings.Join(stores, ", "))
+	}
+	if p := st.Process; p != nil {
+		fmt.Fprintf(&b, "Process: %s heap, %s from the OS, %d goroutines",
+			formatSize(int64(p.HeapBytes)), formatSize(int64(p.SysBytes)), p.Goroutines)
+		if p.OpenFiles >= 0 {
+			fmt.Fprintf(&b, ", %d open files", p.OpenFiles)
+		}
+		fmt.Fprintf(&b, ", up %s\n", (time.Duration(p.UptimeSeconds) * time.Second).String())
+	}
+
+	if len(st.Cron) > 0 {
+		b.WriteString("Cron jobs:\n")
+		for _, job := range st.Cron {
+			fmt.Fprintf(&b, "- %s", job.Name)
+			switch {
+			case !job.Enabled:
+				b.WriteString(": disabled")
+			case job.LastRun.IsZero():
+				b.WriteString(": not run yet")
+			default:
+				fmt.Fprintf(&b, ": %s at %s", job.LastStatus, job.LastRun.Format("2006-01-02 15:04"))
+				if job.LastError != "" {
+					fmt.Fprintf(&b, " (%s)", job.LastError)
+				}
+			}
+			if job.Enabled && !job.NextRun.IsZero() {
+				fmt.Fprintf(&b, ", next %s", job.NextRun.Format("2006-01-02 15:04"))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(st.Events) > 0 {
+		b.WriteString("Recent events:\n")
+		for _, ev := range st.Events {
+			fmt.Fprintf(&b, "- %s %s %s", ev.Time.Format("2006-01-02 15:04"), ev.Source, ev.Kind)
+			if ev.Duration > 0 {
+				fmt.Fprintf(&b, " after %s", ev.Duration.Round(time.Second))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// storeSizes returns the size of the stores of workspace.
+func storeSizes(workspace string) []StoreStatus {
+	stores := make([]StoreStatus, 0, len(statusStores))
+	for _, name := range statusStores {
+		path := filepath.Join(workspace, name)
+		stores = append(stores, StoreStatus{Name: name, Path: path, Bytes: diskUsage(path)})
+	}
+	return stores
+}
+
+// diskUsage returns the size of the files under path.
+func diskUsage(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+func fromMS(ms *int64) time.Time {
+	if ms == nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(*ms)
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestProviderStatus(t *testing.T) {
+	t0 := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	events := []state.LLMEvent{
+		{Time: t0, Provider: "openai", Model: "gpt-4o", DurationMS: 1000},
+		{Time: t0.Add(time.Minute), Provider: "anthropic", Model: "claude", DurationMS: 3000, Attempts: []state.LLMAttempt{
+			{Provider: "openai", Model: "gpt-4o", Error: "502 bad gateway"},
+		}},
+		{Time: t0.Add(2 * time.Minute), Error: "all candidates failed", Attempts: []state.LLMAttempt{
+			{Provider: "openai", Model: "gpt-4o", Skipped: true},
+			{Provider: "anthropic", Model: "claude", Error: "overloaded"},
+		}},
+		{Time: t0.Add(3 * time.Minute), Provider: "openai", Model: "gpt-4o", Cached: true},
+	}
+	got := providerStatus(events)
+	want := []ProviderStatus{
+		{Name: "anthropic/claude", Requests: 2, Failures: 1, AvgMS: 3000, LastOK: t0.Add(time.Minute),
+			LastError: "overloaded", LastErrorAt: t0.Add(2 * time.Minute)},
+		{Name: "openai/gpt-4o", Requests: 2, Failures: 1, AvgMS: 1000, LastOK: t0,
+			LastError: "502 bad gateway", LastErrorAt: t0.Add(time.Minute)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("providerStatus = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("providerStatus[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	cs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	every := int64(3600_000)
+	if _, err := cs.AddJob("backup reminder", cron.CronSchedule{Kind: "every", EveryMS: &every}, "back up", false, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	offline := WorkspaceStatus(cfg)
+	if offline.Running || offline.Healthy() {
+		t.Error("workspace status claims a running gateway")
+	}
+	report := offline.String()
+	if !strings.HasPrefix(report, "Gateway: not running\n") || !strings.Contains(report, "- backup reminder: not run yet, next ") {
+		t.Errorf("offline status:\n%s", report)
+	}
+
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &historyProvider{})
+	_, done := al.startRun(context.Background(), bus.InboundMessage{Channel: "telegram", ChatID: "42"})
+	defer done()
+	st := al.Status()
+	if !st.Healthy() || len(st.Runs) != 1 || st.Runs[0].Chat != "telegram:42" || st.Process == nil {
+		t.Errorf("status = %+v", st)
+	}
+	if !strings.Contains(st.String(), "Active runs:\n- telegram:42 for ") {
+		t.Errorf("status:\n%s", st)
+	}
+
+	// picoclaw status reads what the gateway serves.
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Status
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.String() != st.String() {
+		t.Errorf("decoded status differs (%v):\n%s", err, decoded)
+	}
+}
+
+func TestSelfReport(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &historyProvider{})
+	events := state.NewEventLog(workspace)
+	if err := events.Append(state.RunEvent{Kind: "channel_down", Source: "telegram"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := ReadProcessStatus()
+	if p.Goroutines == 0 || p.HeapBytes == 0 || p.OpenFiles == 0 {
+		t.Errorf("process status = %+v", p)
+	}
+
+	al.selfReport()
+	recent, err := events.Recent(1)
+	if err != nil || len(recent) != 1 {
+		t.Fatalf("Recent() = %v, %v", recent, err)
+	}
+	ev := recent[0]
+	if ev.Kind != "self_report" || !strings.Contains(ev.Message, " goroutines") || !strings.Contains(ev.Message, "; stores: sessions ") {
+		t.Errorf("self report = %+v", ev)
+	}
+
+	// The status shows the events that tell something happened.
+	st := WorkspaceStatus(cfg)
+	if len(st.Events) != 1 || st.Events[0].Kind != "channel_down" {
+		t.Errorf("status events = %+v", st.Events)
+	}
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// toolPrefetch runs the tool calls a provider reports while it is still
+// streaming its response, so that slow tools overlap the rest of the
+// generation. Calls run one at a time in the order reported, as they would
+// after the response; the loop then takes their results instead of running
+// them again.
+type toolPrefetch struct {
+	run func(providers.ToolCall) *tools.ToolResult
+
+	mu    sync.Mutex
+	calls map[string]*prefetchedCall
+	last  *prefetchedCall
+	wg    sync.WaitGroup
+}
+
+type prefetchedCall struct {
+	call   providers.ToolCall
+	result *tools.ToolResult
+	done   chan struct{}
+}
+
+func newToolPrefetch(run func(providers.ToolCall) *tools.ToolResult) *toolPrefetch {
+	return &toolPrefetch{run: run, calls: make(map[string]*prefetchedCall)}
+}
+
+// add starts tc once the calls added before it are done. Calls without an
+// ID cannot be matched to the response and are left to the loop.
+func (p *toolPrefetch) add(tc providers.ToolCall) {
+	tc = providers.NormalizeToolCall(tc)
+	if tc.ID == "" || tc.Name == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.calls[tc.ID]; ok {
+		return
+	}
+	c := &prefetchedCall{call: tc, done: make(chan struct{})}
+	prev := p.last
+	p.calls[tc.ID] = c
+	p.last = c
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(c.done)
+		if prev != nil {
+			<-prev.done
+		}
+		c.result = p.run(tc)
+	}()
+}
+
+// take waits for and returns the result of tc if it was started while
+// streaming with the same name and arguments. A call that was started
+// differently, e.g. by a request that failed over, is waited for so the
+// tools still run in order, and reported as not taken.
+func (p *toolPrefetch) take(tc providers.ToolCall) (*tools.ToolResult, bool) {
+	p.mu.Lock()
+	c, ok := p.calls[tc.ID]
+	delete(p.calls, tc.ID)
+	p.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	<-c.done
+	if c.call.Name != tc.Name || !reflect.DeepEqual(c.call.Arguments, tc.Arguments) {
+		return nil, false
+	}
+	return c.result, true
+}
+
+// wait blocks until every started call has finished.
+func (p *toolPrefetch) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// RunTrigger answers the prompt of a trigger called name as persona, the
+// default agent when empty, and sends the answer to channel and chatID
+// when set. Each trigger has a session of its own, "trigger:<name>",
+// which keeps what it was asked and answered; runs do not see the earlier
+// ones. Like cron jobs, triggers give way to interactive requests.
+func (al *AgentLoop) RunTrigger(ctx context.Context, name, persona, prompt, channel, chatID string) (string, error) {
+	agent, ok := al.registry.GetAgent(persona)
+	if persona == "" || !ok {
+		agent = al.registry.GetDefaultAgent()
+	}
+	send := channel != "" && chatID != ""
+	if !send {
+		channel, chatID = "cli", "direct"
+	}
+	return al.runAgentLoop(providers.WithBackground(ctx), agent, processOptions{
+		SessionKey:      "trigger:" + name,
+		Channel:         channel,
+		ChatID:          chatID,
+		UserMessage:     prompt,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		SendResponse:    send,
+		NoHistory:       true,
+	})
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/pricing"
+)
+
+func newPricing(overrides map[string]config.ModelPrice) *pricing.Registry {
+	prices := make(map[string]pricing.Price, len(overrides))
+	for name, p := range overrides {
+		prices[name] = pricing.Price{Input: p.Input, Output: p.Output}
+	}
+	return pricing.NewRegistry(prices)
+}
+
+// AgentUsage sums up the LLM requests of one agent.
+type AgentUsage struct {
+	AgentID         string  `json:"agent_id"`
+	Requests        int     `json:"requests"`
+	Cached          int     `json:"cached,omitempty"`
+	Tokens          int     `json:"tokens"`
+	ReasoningTokens int     `json:"reasoning_tokens,omitempty"` // included in Tokens
+	Unpriced        int     `json:"unpriced,omitempty"`         // requests with tokens but no known price
+	CostUSD         float64 `json:"cost_usd"`
+}
+
+// Usage sums up the LLM requests since the given time per agent, the
+// most expensive agent first.
+func (al *AgentLoop) Usage(since time.Time) ([]AgentUsage, error) {
+	return al.usageBetween(since, time.Time{})
+}
+
+// usageBetween is Usage for the requests from since up to until, or up
+// to now when until is zero.
+func (al *AgentLoop) usageBetween(since, until time.Time) ([]AgentUsage, error) {
+	if al.llmEvents == nil {
+		return nil, nil
+	}
+	events, err := al.llmEvents.Since(since)
+	if err != nil {
+		return nil, err
+	}
+
+	byAgent := make(map[string]*AgentUsage)
+	for _, ev := range events {
+		if !until.IsZero() && !ev.Time.Before(until) {
+			continue
+		}
+		u := byAgent[ev.AgentID]
+		if u == nil {
+			u = &AgentUsage{AgentID: ev.AgentID}
+			byAgent[ev.AgentID] = u
+		}
+		u.Requests++
+		if ev.Cached {
+			u.Cached++
+		}
+		tokens := ev.PromptTokens + ev.CompletionTokens
+		u.Tokens += tokens
+		u.ReasoningTokens += ev.ReasoningTokens
+		u.CostUSD += ev.CostUSD
+		if tokens > 0 && ev.CostUSD == 0 {
+			if _, known := al.pricing.Lookup(ev.Provider, ev.Route, ev.Model); !known {
+				u.Unpriced++
+			}
+		}
+	}
+	usages := make([]AgentUsage, 0, len(byAgent))
+	for _, u := range byAgent {
+		usages = append(usages, *u)
+	}
+	slices.SortFunc(usages, func(a, b AgentUsage) int {
+		if a.CostUSD != b.CostUSD {
+			if a.CostUSD > b.CostUSD {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.AgentID, b.AgentID)
+	})
+	return usages, nil
+}
+
+// usageReport sums up the LLM requests of today per agent, for the /usage
+// command.
+func (al *AgentLoop) usageReport(now time.Time) string {
+	if al.llmEvents == nil {
+		return "No LLM usage recorded"
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	usages, err := al.Usage(midnight)
+	if err != nil {
+		return fmt.Sprintf("Failed to read LLM events: %v", err)
+	}
+	if len(usages) == 0 {
+		return "No LLM requests today"
+	}
+
+	var b strings.Builder
+	var total float64
+	b.WriteString("Usage today:\n")
+	for _, u := range usages {
+		total += u.CostUSD
+		fmt.Fprintf(&b, "- %s: %d requests, %s tokens", u.AgentID, u.Requests, formatTokens(u.Tokens))
+		if u.ReasoningTokens > 0 {
+			fmt.Fprintf(&b, " (%s reasoning)", formatTokens(u.ReasoningTokens))
+		}
+		fmt.Fprintf(&b, ", $%.4f", u.CostUSD)
+		if u.Cached > 0 {
+			fmt.Fprintf(&b, ", %d from cache", u.Cached)
+		}
+		if u.Unpriced > 0 {
+			fmt.Fprintf(&b, " (%d without a known price)", u.Unpriced)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Total: $%.4f", total)
+	return b.String()
+}
+
+func formatTokens(n int) string {
+	if n >= 1000 {
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestUsageReport(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: t.TempDir(), Model: "test-model"},
+		},
+		Pricing: map[string]config.ModelPrice{"house-model": {Input: 1, Output: 2}},
+	}
+	al := newTestLoop(t, cfg, bus.NewMessageBus(), &simpleMockProvider{})
+	now := time.Now()
+
+	al.recordLLMEvent(state.LLMEvent{
+		Time: now.Add(-24 * time.Hour), AgentID: "main", Provider: "openai", Model: "gpt-4o", PromptTokens: 1_000_000,
+	})
+	for _, ev := range []state.LLMEvent{
+		{AgentID: "main", Provider: "openai", Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 500},
+		{AgentID: "main", Provider: "openai", Model: "gpt-4o", Cached: true},
+		{AgentID: "coder", Provider: "vllm", Model: "house-model", PromptTokens: 2000, CompletionTokens: 1000, ReasoningTokens: 800},
+		{AgentID: "coder", Provider: "openai", Model: "mystery", PromptTokens: 10},
+	} {
+		ev.Time = now
+		al.recordLLMEvent(ev)
+	}
+
+	want := "Usage today:\n" +
+		"- main: 2 requests, 1.5k tokens, $0.0075, 1 from cache\n" +
+		"- coder: 2 requests, 3.0k tokens (800 reasoning), $0.0040 (1 without a known price)\n" +
+		"Total: $0.0115"
+	if got := al.usageReport(now); got != want {
+		t.Errorf("usageReport() =\n%s\nwant\n%s", got, want)
+	}
+}
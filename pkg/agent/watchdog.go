@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// watchdogInterval is how often the watchdog looks at the runs.
+var watchdogInterval = 5 * time.Second
+
+// runTimeout is why the watchdog cancelled a run, as reported by
+// context.Cause.
+type runTimeout struct {
+	limit time.Duration // the budget that ran out
+	stage string        // what the run was doing, e.g. "tool web_fetch"
+	tool  bool          // a single tool call took too long, not the run
+}
+
+func (e *runTimeout) Error() string {
+	if e.tool {
+		return fmt.Sprintf("timed out: %s took longer than %s", e.stage, e.limit)
+	}
+	return fmt.Sprintf("timed out after %s in %s", e.limit, e.stage)
+}
+
+// asTimeout returns the watchdog's cancellation in err, if any.
+func asTimeout(err error) *runTimeout {
+	var timeout *runTimeout
+	if errors.As(err, &timeout) {
+		return timeout
+	}
+	return nil
+}
+
+// timeoutNotice tells the chat of msg that its answer was given up on.
+func (al *AgentLoop) timeoutNotice(msg bus.InboundMessage, timeout *runTimeout) string {
+	if timeout.tool {
+		return al.t(msg, "⏱️ I stopped working on this: %s took longer than %s.", timeout.stage, timeout.limit)
+	}
+	return al.t(msg, "⏱️ I stopped working on this after %s, while in %s.", timeout.limit, timeout.stage)
+}
+
+// activeRunKey marks the context of a run with its activeRun, so the
+// stages deep in the run can report where it is.
+type activeRunKey struct{}
+
+func runFrom(ctx context.Context) *activeRun {
+	run, _ := ctx.Value(activeRunKey{}).(*activeRun)
+	return run
+}
+
+// enterStage notes that the run of ctx went on to stage, e.g. an LLM
+// request. Runs not started from a message are not watched.
+func enterStage(ctx context.Context, stage string) {
+	if run := runFrom(ctx); run != nil {
+		run.mu.Lock()
+		run.stage = stage
+		run.mu.Unlock()
+	}
+}
+
+// startToolCall notes that the run of ctx waits on the tool name and
+// returns the function that ends the wait. Tool calls may run side by side.
+func startToolCall(ctx context.Context, name string) func() {
+	run := runFrom(ctx)
+	if run == nil {
+		return func() {}
+	}
+	call := &toolCall{name: name, started: time.Now()}
+	run.mu.Lock()
+	run.calls = append(run.calls, call)
+	run.mu.Unlock()
+	return func() {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		for i, c := range run.calls {
+			if c == call {
+				run.calls = append(run.calls[:i], run.calls[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+type toolCall struct {
+	name    string
+	started time.Time
+}
+
+// overdue returns why the run should be cancelled at now, or nil while it
+// is within its budgets. A limit of 0 is no limit.
+func (r *activeRun) overdue(now time.Time, runLimit, toolLimit time.Duration) *runTimeout {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The call waited on longest is what holds the run up.
+	stage := r.stage
+	var oldest *toolCall
+	for _, c := range r.calls {
+		if oldest == nil || c.started.Before(oldest.started) {
+			oldest = c
+		}
+	}
+	if oldest != nil {
+		stage = "tool " + oldest.name
+		if toolLimit > 0 && now.Sub(oldest.started) >= toolLimit {
+			return &runTimeout{limit: toolLimit, stage: stage, tool: true}
+		}
+	}
+	if runLimit > 0 && now.Sub(r.started) >= runLimit {
+		return &runTimeout{limit: runLimit, stage: stage}
+	}
+	return nil
+}
+
+// runWatchdog cancels runs that overran their budget until ctx ends.
+func (al *AgentLoop) runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			al.checkRuns(now)
+		}
+	}
+}
+
+// checkRuns cancels the runs that are overdue at now and returns how many
+// it cancelled. The run reports the timeout to its chat as it ends.
+func (al *AgentLoop) checkRuns(now time.Time) int {
+	cfg := al.cfg.Gateway.Watchdog
+	runLimit := time.Duration(cfg.RunTimeoutSeconds) * time.Second
+	toolLimit := time.Duration(cfg.ToolTimeoutSeconds) * time.Second
+	if runLimit <= 0 && toolLimit <= 0 {
+		return 0
+	}
+
+	al.runsMu.Lock()
+	defer al.runsMu.Unlock()
+	n := 0
+	for key, run := range al.runs {
+		timeout := run.overdue(now, runLimit, toolLimit)
+		if timeout == nil {
+			continue
+		}
+		logger.WarnCF("agent", "Watchdog cancelled a run", map[string]any{
+			"chat":    key,
+			"stage":   timeout.stage,
+			"running": now.Sub(run.started).Round(time.Second).String(),
+			"limit":   timeout.limit.String(),
+		})
+		run.cancel(timeout)
+		delete(al.runs, key)
+		n++
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// stuckTool never returns until released, whatever its context says.
+type stuckTool struct{ release chan struct{} }
+
+func (t *stuckTool) Name() string               { return "stuck" }
+func (t *stuckTool) Description() string        { return "Hangs" }
+func (t *stuckTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+
+func (t *stuckTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	<-t.release
+	return tools.SilentResult("finally")
+}
+
+func TestWatchdog_CancelsLongRun(t *testing.T) {
+	al, provider, msgBus, workspace := newCancelTestLoop(t)
+	al.cfg.Gateway.Watchdog.RunTimeoutSeconds = 60
+	msg := bus.InboundMessage{
+		Channel: "telegram", ChatID: "c1", SenderID: "u1", Content: "Think hard.",
+		SessionKey: "agent:main:slow",
+	}
+	done := startHanging(t, al, provider, msg)
+
+	if n := al.checkRuns(time.Now()); n != 0 {
+		t.Fatalf("cancelled %d runs within their budget", n)
+	}
+	if n := al.checkRuns(time.Now().Add(2 * time.Minute)); n != 1 {
+		t.Fatalf("cancelled %d runs", n)
+	}
+	waitDone(t, done)
+	if err := <-provider.err; !errors.Is(err, context.Canceled) {
+		t.Errorf("provider request ended with %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, _ := msgBus.SubscribeOutbound(ctx)
+	if out.ChatID != "c1" || out.Content != "⏱️ I stopped working on this after 1m0s, while in LLM request to test-model." {
+		t.Errorf("notice = %+v", out)
+	}
+	runEvents, err := state.NewEventLog(workspace).Recent(5)
+	if err != nil || len(runEvents) != 1 || runEvents[0].Kind != "timeout" ||
+		!strings.Contains(runEvents[0].Message, "in LLM request to test-model") {
+		t.Errorf("run events = %+v, %v", runEvents, err)
+	}
+	history := al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:slow")
+	if len(history) != 2 || !strings.Contains(history[1].Content, "timed out") {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestWatchdog_GivesUpOnStuckTool(t *testing.T) {
+	al, _, _, _ := newCancelTestLoop(t)
+	al.cfg.Gateway.Watchdog.ToolTimeoutSeconds = 300
+	tool := &stuckTool{release: make(chan struct{})}
+	defer close(tool.release)
+	al.RegisterTool(tool)
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "u1"}
+	ctx, end := al.startRun(context.Background(), msg)
+	defer end()
+	agent := al.registry.GetDefaultAgent()
+	result := make(chan *tools.ToolResult, 1)
+	go func() {
+		result <- al.runTool(ctx, agent, processOptions{Channel: "telegram", ChatID: "c1"}, providers.ToolCall{Name: "stuck"}, 1)
+	}()
+
+	// Wait for the call to be on record before looking past its limit.
+	deadline := time.Now().Add(2 * time.Second)
+	for runFrom(ctx).overdue(time.Now().Add(10*time.Minute), 0, time.Minute) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the tool call was not noted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := al.checkRuns(time.Now().Add(time.Minute)); n != 0 {
+		t.Fatalf("cancelled %d runs within their budget", n)
+	}
+	if n := al.checkRuns(time.Now().Add(6 * time.Minute)); n != 1 {
+		t.Fatalf("cancelled %d runs", n)
+	}
+	select {
+	case r := <-result:
+		if !r.IsError || !strings.Contains(r.ForLLM, "tool stuck took longer than 5m0s") {
+			t.Errorf("result = %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the run still waits on the tool")
+	}
+	if timeout := asTimeout(context.Cause(ctx)); timeout == nil || !timeout.tool || timeout.stage != "tool stuck" {
+		t.Errorf("cause = %v", context.Cause(ctx))
+	}
+}
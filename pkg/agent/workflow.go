@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/workflow"
+)
+
+// SetWorkflows lets /workflow list, run and trace the workflows of ws.
+func (al *AgentLoop) SetWorkflows(ws *workflow.Service) {
+	al.workflows = ws
+}
+
+// WorkflowEnv returns what runs the steps of workflows: prompts go to the
+// agents, tool calls to the default agent's tools and sends to the bus.
+func (al *AgentLoop) WorkflowEnv() workflow.Env {
+	return workflowEnv{al: al}
+}
+
+type workflowEnv struct {
+	al *AgentLoop
+}
+
+// Prompt runs persona without history, with the given tools only. The
+// answer is the step's output; a send step delivers it.
+func (e workflowEnv) Prompt(ctx context.Context, persona, prompt string, tools []string) (string, error) {
+	agent, ok := e.al.registry.GetAgent(persona)
+	if persona == "" || !ok {
+		agent = e.al.registry.GetDefaultAgent()
+	}
+	return e.al.runAgentLoop(providers.WithBackground(ctx), agent, processOptions{
+		SessionKey:  "workflow",
+		Channel:     "cli",
+		ChatID:      "direct",
+		UserMessage: prompt,
+		NoHistory:   true,
+		Tools:       tools,
+		NoTools:     len(tools) == 0,
+	})
+}
+
+// CallTool calls a tool of the default agent, with the same flags and
+// audit as a call the model makes.
+func (e workflowEnv) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
+	agent := e.al.registry.GetDefaultAgent()
+	opts := processOptions{SessionKey: "workflow", Channel: "cli", ChatID: "direct"}
+	result := e.al.runTool(ctx, agent, opts, providers.ToolCall{ID: "workflow", Name: name, Arguments: args}, 0)
+	if result.IsError {
+		return "", errors.New(result.ForLLM)
+	}
+	return result.ForLLM, nil
+}
+
+func (e workflowEnv) Send(ctx context.Context, channel, chatID, text string) error {
+	e.al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel, ChatID: chatID, Content: text, Proactive: providers.IsBackground(ctx),
+	})
+	return nil
+}
+
+// handleWorkflowCommand lists, runs and traces workflows:
+//
+//	/workflow                      the workflows, their schedules and last runs
+//	/workflow run <name> [input]   run one now; it reports back when done
+//	/workflow trace <name>         how the last run went, step by step
+func (al *AgentLoop) handleWorkflowCommand(msg bus.InboundMessage, args []string) string {
+	if al.workflows == nil {
+		return al.t(msg, "Workflows are only available in the gateway.")
+	}
+	if len(args) == 0 || args[0] == "list" {
+		return al.listWorkflows(msg)
+	}
+	if len(args) < 2 || args[0] != "run" && args[0] != "trace" {
+		return al.t(msg, "Usage: /workflow [list|run <name> [input]|trace <name>]")
+	}
+	name := args[1]
+	if _, err := al.workflows.Get(name); err != nil {
+		return al.t(msg, "There is no workflow %s.", name)
+	}
+	if args[0] == "trace" {
+		return al.workflowTrace(msg, name)
+	}
+
+	input := strings.Join(args[2:], " ")
+	go func() {
+		tr, err := al.workflows.Run(context.Background(), name, input, msg.Channel+":"+msg.ChatID, msg.Channel, msg.ChatID)
+		duration := (time.Duration(tr.DurationMS) * time.Millisecond).Round(100 * time.Millisecond)
+		content := al.t(msg, "✅ Workflow %s finished in %s.", name, duration)
+		if err != nil {
+			content = al.t(msg, "❌ Workflow %s failed: %s\nSee /workflow trace %s", name, err.Error(), name)
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: content})
+	}()
+	return al.t(msg, "Running workflow %s, I'll tell you how it went.", name)
+}
+
+// listWorkflows lists the workflows with how they last ran, and the files
+// that do not read.
+func (al *AgentLoop) listWorkflows(msg bus.InboundMessage) string {
+	workflows, err := al.workflows.List()
+	loc := al.senderLocation(msg)
+	var b strings.Builder
+	if len(workflows) == 0 {
+		b.WriteString(al.t(msg, "There are no workflows. Add them as YAML files to the workflows folder of the workspace."))
+	} else {
+		b.WriteString(al.t(msg, "Workflows:"))
+	}
+	for _, w := range workflows {
+		fmt.Fprintf(&b, "\n- %s", w.Name)
+		if w.Description != "" {
+			b.WriteString(": " + w.Description)
+		}
+		if w.Schedule != "" {
+			b.WriteString(" (" + w.Schedule + ")")
+		}
+		if traces, _ := al.workflows.Traces().Recent(w.Name, 1); len(traces) > 0 {
+			b.WriteString(" — " + traceStatus(traces[0]) + " " + formatRun(traces[0].Started, loc))
+		}
+	}
+	if err != nil {
+		b.WriteString("\n\n" + al.t(msg, "Not loaded: %s", err.Error()))
+	}
+	return b.String()
+}
+
+// workflowTrace tells how the last run of the workflow name went.
+func (al *AgentLoop) workflowTrace(msg bus.InboundMessage, name string) string {
+	traces, err := al.workflows.Traces().Recent(name, 1)
+	if err != nil {
+		return err.Error()
+	}
+	if len(traces) == 0 {
+		return al.t(msg, "%s has not run yet.", name)
+	}
+	tr := traces[0]
+	var b strings.Builder
+	b.WriteString(al.t(msg, "Last run of %s:", name))
+	fmt.Fprintf(&b, " %s %s, %s, task %s", traceStatus(tr), formatRun(tr.Started, al.senderLocation(msg)),
+		(time.Duration(tr.DurationMS) * time.Millisecond).Round(100*time.Millisecond), tr.TaskID)
+	for _, st := range tr.Steps {
+		icon := map[string]string{"ok": "✅", "failed": "❌", "skipped": "⏭"}[st.Status]
+		fmt.Fprintf(&b, "\n%s %s (%s), %s", icon, st.ID, st.Kind,
+			(time.Duration(st.DurationMS) * time.Millisecond).Round(100*time.Millisecond))
+		if st.Attempts > 1 {
+			b.WriteString(", " + al.t(msg, "%d attempts", st.Attempts))
+		}
+		if st.Error != "" {
+			b.WriteString("\n   " + st.Error)
+		} else if st.Output != "" {
+			b.WriteString("\n   " + strings.ReplaceAll(st.Output, "\n", " "))
+		}
+	}
+	return b.String()
+}
+
+func traceStatus(tr workflow.Trace) string {
+	if tr.Status == "ok" {
+		return "✅"
+	}
+	return "❌"
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/workflow"
+)
+
+func TestWorkflowCommand(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{Workspace: workspace, Model: "test-model", MaxTokens: 4096, MaxToolIterations: 10},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	al := newTestLoop(t, cfg, msgBus, &simpleMockProvider{response: "three files"})
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "chat1"}
+	if got := al.handleWorkflowCommand(msg, nil); !strings.Contains(got, "only available in the gateway") {
+		t.Errorf("/workflow without workflows got %q", got)
+	}
+
+	dir := workflow.Dir(workspace)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	daily := `description: Count the files
+steps:
+  - id: files
+    tool: list_dir
+    args: {path: "."}
+  - id: count
+    prompt: "How many files are there? {{.Steps.files.Output}}"
+  - id: post
+    send: "{{.Steps.count.Output}} ({{.Input}})"
+`
+	if err := os.WriteFile(filepath.Join(dir, "daily.yaml"), []byte(daily), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	al.SetWorkflows(workflow.NewService(workspace, al.WorkflowEnv()))
+
+	if got := al.handleWorkflowCommand(msg, []string{"run", "daily", "for", "Ann"}); !strings.Contains(got, "Running workflow daily") {
+		t.Fatalf("/workflow run got %q", got)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, want := range []string{"three files (for Ann)", "✅ Workflow daily finished"} {
+		out, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok || out.ChatID != "chat1" || !strings.HasPrefix(out.Content, want) {
+			t.Fatalf("sent %+v, %v, want %q", out, ok, want)
+		}
+	}
+
+	if got := al.handleWorkflowCommand(msg, nil); !strings.Contains(got, "- daily: Count the files — ✅") {
+		t.Errorf("/workflow got %q", got)
+	}
+	got := al.handleWorkflowCommand(msg, []string{"trace", "daily"})
+	lines := strings.Split(got, "\n")
+	if len(lines) != 7 || !strings.Contains(lines[1], "✅ files (tool)") || !strings.Contains(lines[6], "three files (for Ann)") {
+		t.Errorf("/workflow trace got %q", got)
+	}
+	if got := al.handleWorkflowCommand(msg, []string{"run", "nope"}); !strings.Contains(got, "no workflow nope") {
+		t.Errorf("unknown workflow got %q", got)
+	}
+}
@@ -0,0 +1,388 @@
+// Package analytics sums up how the agents were used over a period: when
+// they were busiest, which tools they called, how many tokens a run took,
+// what failed most often and what each persona cost. It reads the traces,
+// LLM events and sessions the gateway keeps.
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Session is a conversation of a persona, as the session stores list
+// them.
+type Session struct {
+	AgentID string
+	Key     string
+	Updated time.Time
+}
+
+// Report is what Compute makes of a period.
+type Report struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Runs            int     `json:"runs"`
+	FailedRuns      int     `json:"failed_runs"`
+	Conversations   int     `json:"conversations"` // sessions active in the period
+	Requests        int     `json:"requests"`      // LLM requests
+	Tokens          int     `json:"tokens"`
+	CostUSD         float64 `json:"cost_usd"`
+	Unpriced        int     `json:"unpriced,omitempty"` // requests with tokens but no cost
+	AvgTokensPerRun float64 `json:"avg_tokens_per_run"`
+
+	// Hours counts the runs started in each hour of the day, in the
+	// report's time zone; BusiestHours are the top ones.
+	Hours        [24]int     `json:"hours"`
+	BusiestHours []HourCount `json:"busiest_hours,omitempty"`
+
+	Tools    []ToolStats    `json:"tools,omitempty"`    // most called first
+	Errors   []ErrorCause   `json:"errors,omitempty"`   // most frequent first
+	Personas []PersonaStats `json:"personas,omitempty"` // most expensive first
+}
+
+// HourCount is the number of runs in an hour of the day.
+type HourCount struct {
+	Hour int `json:"hour"`
+	Runs int `json:"runs"`
+}
+
+// ToolStats sums up the calls of one tool.
+type ToolStats struct {
+	Tool   string `json:"tool"`
+	Calls  int    `json:"calls"`
+	Errors int    `json:"errors,omitempty"`
+	AvgMS  int64  `json:"avg_ms"`
+}
+
+// ErrorCause is a kind of failure and how often it happened. Source is
+// "run", "tool" or "llm", the latter for providers that failed before a
+// fallback answered or the run failed.
+type ErrorCause struct {
+	Source  string `json:"source"`
+	Cause   string `json:"cause"`
+	Count   int    `json:"count"`
+	Example string `json:"example,omitempty"` // the latest message
+}
+
+// PersonaStats sums up the work of one agent.
+type PersonaStats struct {
+	AgentID       string  `json:"agent_id"`
+	Runs          int     `json:"runs"`
+	Conversations int     `json:"conversations"`
+	Requests      int     `json:"requests"`
+	Tokens        int     `json:"tokens"`
+	CostUSD       float64 `json:"cost_usd"`
+}
+
+// Limits on the lists of a report.
+const (
+	busiestHours = 3
+	maxErrors    = 10
+)
+
+// Compute sums up the traces, LLM events and sessions from from up to to,
+// reading hours of the day in loc.
+func Compute(from, to time.Time, loc *time.Location, traces []state.Trace, llm []state.LLMEvent, sessions []Session) *Report {
+	r := &Report{From: from, To: to}
+	in := func(t time.Time) bool { return !t.Before(from) && t.Before(to) }
+	personas := make(map[string]*PersonaStats)
+	persona := func(id string) *PersonaStats {
+		p := personas[id]
+		if p == nil {
+			p = &PersonaStats{AgentID: id}
+			personas[id] = p
+		}
+		return p
+	}
+	tools := make(map[string]*ToolStats)
+	toolMS := make(map[string]int64)
+	errs := make(map[[2]string]*ErrorCause)
+	fail := func(source, msg string, cause string) {
+		if cause == "" {
+			cause = Cause(msg)
+		}
+		e := errs[[2]string{source, cause}]
+		if e == nil {
+			e = &ErrorCause{Source: source, Cause: cause}
+			errs[[2]string{source, cause}] = e
+		}
+		e.Count++
+		if msg != "" {
+			e.Example = firstLine(msg, 200)
+		}
+	}
+
+	for _, tr := range traces {
+		if !in(tr.Time) {
+			continue
+		}
+		switch tr.Kind {
+		case state.TraceRun:
+			r.Runs++
+			persona(tr.AgentID).Runs++
+			started := tr.Time.Add(-time.Duration(tr.DurationMS) * time.Millisecond)
+			r.Hours[started.In(loc).Hour()]++
+			if tr.Exit != "" && tr.Exit != events.RunOK {
+				r.FailedRuns++
+				fail("run", tr.Error, "")
+			}
+		case state.TraceTool:
+			t := tools[tr.Tool]
+			if t == nil {
+				t = &ToolStats{Tool: tr.Tool}
+				tools[tr.Tool] = t
+			}
+			t.Calls++
+			toolMS[tr.Tool] += tr.DurationMS
+			if tr.Error != "" {
+				t.Errors++
+				fail("tool", tr.Error, tr.Tool+": "+Cause(tr.Error))
+			}
+		}
+	}
+
+	for _, ev := range llm {
+		if !in(ev.Time) {
+			continue
+		}
+		r.Requests++
+		tokens := ev.PromptTokens + ev.CompletionTokens
+		r.Tokens += tokens
+		r.CostUSD += ev.CostUSD
+		if tokens > 0 && ev.CostUSD == 0 && !ev.Cached {
+			r.Unpriced++
+		}
+		p := persona(ev.AgentID)
+		p.Requests++
+		p.Tokens += tokens
+		p.CostUSD += ev.CostUSD
+		for _, a := range ev.Attempts {
+			if a.Skipped {
+				continue
+			}
+			fail("llm", a.Error, reasonCause(providers.FailoverReason(a.Reason)))
+		}
+	}
+
+	active := make(map[string]bool)
+	for _, s := range sessions {
+		if !in(s.Updated) || active[s.AgentID+"\x00"+s.Key] {
+			continue
+		}
+		active[s.AgentID+"\x00"+s.Key] = true
+		r.Conversations++
+		persona(s.AgentID).Conversations++
+	}
+
+	if r.Runs > 0 {
+		r.AvgTokensPerRun = float64(r.Tokens) / float64(r.Runs)
+	}
+	for hour, runs := range r.Hours {
+		if runs > 0 {
+			r.BusiestHours = append(r.BusiestHours, HourCount{Hour: hour, Runs: runs})
+		}
+	}
+	slices.SortStableFunc(r.BusiestHours, func(a, b HourCount) int { return b.Runs - a.Runs })
+	if len(r.BusiestHours) > busiestHours {
+		r.BusiestHours = r.BusiestHours[:busiestHours]
+	}
+
+	for name, t := range tools {
+		t.AvgMS = toolMS[name] / int64(t.Calls)
+		r.Tools = append(r.Tools, *t)
+	}
+	slices.SortFunc(r.Tools, func(a, b ToolStats) int {
+		if a.Calls != b.Calls {
+			return b.Calls - a.Calls
+		}
+		return strings.Compare(a.Tool, b.Tool)
+	})
+
+	for _, e := range errs {
+		r.Errors = append(r.Errors, *e)
+	}
+	slices.SortFunc(r.Errors, func(a, b ErrorCause) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Source+a.Cause, b.Source+b.Cause)
+	})
+	if len(r.Errors) > maxErrors {
+		r.Errors = r.Errors[:maxErrors]
+	}
+
+	for _, p := range personas {
+		r.Personas = append(r.Personas, *p)
+	}
+	slices.SortFunc(r.Personas, func(a, b PersonaStats) int {
+		switch {
+		case a.CostUSD > b.CostUSD:
+			return -1
+		case a.CostUSD < b.CostUSD:
+			return 1
+		case a.Tokens != b.Tokens:
+			return b.Tokens - a.Tokens
+		}
+		return strings.Compare(a.AgentID, b.AgentID)
+	})
+	return r
+}
+
+// causes map words in error messages to the kind of failure they tell
+// of, in order of precedence.
+var causes = []struct {
+	cause string
+	words []string
+}{
+	{"cancelled", []string{"context canceled", "cancelled", "canceled"}},
+	{"rate limited", []string{"rate limit", "429", "too many requests"}},
+	{"billing or quota", []string{"402", "billing", "quota", "insufficient"}},
+	{"authentication failed", []string{"401", "403", "unauthorized", "forbidden", "api key"}},
+	{"timed out", []string{"deadline exceeded", "timeout", "timed out"}},
+	{"context too long", []string{"context length", "context window", "too many tokens", "maximum context"}},
+	{"provider unavailable", []string{"500", "502", "503", "504", "overloaded", "bad gateway", "unavailable"}},
+	{"permission denied", []string{"permission denied", "not allowed", "blocked"}},
+	{"not found", []string{"no such file", "not found"}},
+}
+
+var digits = regexp.MustCompile(`[0-9]+`)
+
+// Cause names the kind of failure msg tells of. Messages without a known
+// kind are grouped by their first line, with numbers left out.
+func Cause(msg string) string {
+	lower := strings.ToLower(msg)
+	for _, c := range causes {
+		for _, w := range c.words {
+			if strings.Contains(lower, w) {
+				return c.cause
+			}
+		}
+	}
+	if strings.TrimSpace(msg) == "" {
+		return "unknown"
+	}
+	return digits.ReplaceAllString(firstLine(msg, 60), "N")
+}
+
+// reasonCause is the cause of a failover reason, "" when the reason says
+// nothing more than the message would.
+func reasonCause(reason providers.FailoverReason) string {
+	switch reason {
+	case providers.FailoverRateLimit:
+		return "rate limited"
+	case providers.FailoverBilling:
+		return "billing or quota"
+	case providers.FailoverAuth:
+		return "authentication failed"
+	case providers.FailoverTimeout:
+		return "timed out"
+	case providers.FailoverOverloaded:
+		return "provider unavailable"
+	case providers.FailoverFormat:
+		return "malformed request"
+	}
+	return ""
+}
+
+// firstLine returns the first line of s, cut to max runes.
+func firstLine(s string, max int) string {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), "\n")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+// Text renders the report as tables for a terminal.
+func (r *Report) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage from %s to %s\n\n", r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "  Runs:               %d (%d failed)\n", r.Runs, r.FailedRuns)
+	fmt.Fprintf(&b, "  Conversations:      %d\n", r.Conversations)
+	fmt.Fprintf(&b, "  LLM requests:       %d\n", r.Requests)
+	fmt.Fprintf(&b, "  Tokens:             %d (%.0f per run)\n", r.Tokens, r.AvgTokensPerRun)
+	fmt.Fprintf(&b, "  Cost:               $%.4f", r.CostUSD)
+	if r.Unpriced > 0 {
+		fmt.Fprintf(&b, " (%d requests without a known price)", r.Unpriced)
+	}
+	b.WriteString("\n")
+
+	if len(r.BusiestHours) > 0 {
+		b.WriteString("\nBusiest hours\n")
+		top := r.BusiestHours[0].Runs
+		for _, h := range r.BusiestHours {
+			fmt.Fprintf(&b, "  %02d:00  %5d  %s\n", h.Hour, h.Runs, strings.Repeat("█", max(1, h.Runs*20/top)))
+		}
+	}
+
+	if len(r.Tools) > 0 {
+		fmt.Fprintf(&b, "\n  %-24s %7s %7s %9s\n", "TOOL", "CALLS", "ERRORS", "AVG")
+		for _, t := range r.Tools {
+			fmt.Fprintf(&b, "  %-24s %7d %7d %9s\n", t.Tool, t.Calls, t.Errors, time.Duration(t.AvgMS)*time.Millisecond)
+		}
+	}
+
+	if len(r.Personas) > 0 {
+		fmt.Fprintf(&b, "\n  %-16s %6s %8s %9s %10s %10s\n", "PERSONA", "RUNS", "CHATS", "REQUESTS", "TOKENS", "COST")
+		for _, p := range r.Personas {
+			fmt.Fprintf(&b, "  %-16s %6d %8d %9d %10d %10s\n", p.AgentID, p.Runs, p.Conversations, p.Requests, p.Tokens,
+				fmt.Sprintf("$%.4f", p.CostUSD))
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "\n  %-6s %6s  %s\n", "SOURCE", "COUNT", "CAUSE")
+		for _, e := range r.Errors {
+			fmt.Fprintf(&b, "  %-6s %6d  %s\n", e.Source, e.Count, e.Cause)
+		}
+	}
+	return b.String()
+}
+
+// Summary renders the report in a few lines for a chat.
+func (r *Report) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage from %s to %s: %d runs", r.From.Format("Jan 2"), r.To.Format("Jan 2"), r.Runs)
+	if r.FailedRuns > 0 {
+		fmt.Fprintf(&b, " (%d failed)", r.FailedRuns)
+	}
+	fmt.Fprintf(&b, " in %d conversations, %d tokens (%.0f per run), $%.2f.\n",
+		r.Conversations, r.Tokens, r.AvgTokensPerRun, r.CostUSD)
+	if len(r.BusiestHours) > 0 {
+		hours := make([]string, len(r.BusiestHours))
+		for i, h := range r.BusiestHours {
+			hours[i] = fmt.Sprintf("%02d:00 (%d)", h.Hour, h.Runs)
+		}
+		fmt.Fprintf(&b, "Busiest hours: %s\n", strings.Join(hours, ", "))
+	}
+	if len(r.Tools) > 0 {
+		var tools []string
+		for _, t := range r.Tools[:min(3, len(r.Tools))] {
+			tools = append(tools, fmt.Sprintf("%s (%d)", t.Tool, t.Calls))
+		}
+		fmt.Fprintf(&b, "Most used tools: %s\n", strings.Join(tools, ", "))
+	}
+	if len(r.Personas) > 0 {
+		var personas []string
+		for _, p := range r.Personas {
+			personas = append(personas, fmt.Sprintf("%s $%.2f", p.AgentID, p.CostUSD))
+		}
+		fmt.Fprintf(&b, "Cost by persona: %s\n", strings.Join(personas, ", "))
+	}
+	if len(r.Errors) > 0 {
+		var errs []string
+		for _, e := range r.Errors[:min(3, len(r.Errors))] {
+			errs = append(errs, fmt.Sprintf("%s, %s (%d)", e.Source, e.Cause, e.Count))
+		}
+		fmt.Fprintf(&b, "Top errors: %s\n", strings.Join(errs, "; "))
+	}
+	return strings.TrimSpace(b.String())
+}
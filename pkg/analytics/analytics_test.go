@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestCompute(t *testing.T) {
+	loc := time.UTC
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, loc)
+	to := from.Add(7 * 24 * time.Hour)
+	at := func(day, hour int) time.Time { return from.Add(time.Duration(day*24+hour) * time.Hour) }
+
+	traces := []state.Trace{
+		{Time: at(0, 9), Kind: state.TraceRun, AgentID: "main", DurationMS: 1000, Exit: "ok"},
+		{Time: at(1, 9), Kind: state.TraceRun, AgentID: "main", DurationMS: 1000, Exit: "ok"},
+		{Time: at(1, 18), Kind: state.TraceRun, AgentID: "support", DurationMS: 1000, Exit: "error", Error: "context deadline exceeded"},
+		{Time: at(2, 9), Kind: state.TraceRun, AgentID: "support", DurationMS: 1000, Exit: "ok"},
+		{Time: at(0, 9), Kind: state.TraceTool, AgentID: "main", Tool: "web_search", DurationMS: 300},
+		{Time: at(1, 9), Kind: state.TraceTool, AgentID: "main", Tool: "web_search", DurationMS: 500},
+		{Time: at(1, 9), Kind: state.TraceTool, AgentID: "main", Tool: "exec", DurationMS: 50, Error: "exit status 2"},
+		{Time: at(8, 9), Kind: state.TraceRun, AgentID: "main", Exit: "ok"}, // after the period
+	}
+	llm := []state.LLMEvent{
+		{Time: at(0, 9), AgentID: "main", PromptTokens: 900, CompletionTokens: 100, CostUSD: 0.01},
+		{Time: at(1, 9), AgentID: "main", PromptTokens: 1800, CompletionTokens: 200, CostUSD: 0.02,
+			Attempts: []state.LLMAttempt{{Provider: "openai", Reason: "rate_limit", Error: "429 Too Many Requests"}}},
+		{Time: at(2, 9), AgentID: "support", PromptTokens: 500, CompletionTokens: 500, CostUSD: 0.05},
+	}
+	sessions := []Session{
+		{AgentID: "main", Key: "telegram:1", Updated: at(1, 9)},
+		{AgentID: "support", Key: "slack:C1", Updated: at(2, 9)},
+		{AgentID: "support", Key: "slack:C2", Updated: from.Add(-time.Hour)},
+	}
+
+	r := Compute(from, to, loc, traces, llm, sessions)
+	if r.Runs != 4 || r.FailedRuns != 1 || r.Requests != 3 || r.Tokens != 4000 || r.Conversations != 2 {
+		t.Errorf("totals = %d runs, %d failed, %d requests, %d tokens, %d conversations",
+			r.Runs, r.FailedRuns, r.Requests, r.Tokens, r.Conversations)
+	}
+	if r.AvgTokensPerRun != 1000 {
+		t.Errorf("AvgTokensPerRun = %v", r.AvgTokensPerRun)
+	}
+	// The runs that finished at 9 started a second before.
+	if len(r.BusiestHours) != 2 || r.BusiestHours[0] != (HourCount{Hour: 8, Runs: 3}) {
+		t.Errorf("BusiestHours = %+v", r.BusiestHours)
+	}
+	if len(r.Tools) != 2 || r.Tools[0].Tool != "web_search" || r.Tools[0].AvgMS != 400 || r.Tools[1].Errors != 1 {
+		t.Errorf("Tools = %+v", r.Tools)
+	}
+	if len(r.Personas) != 2 || r.Personas[0].AgentID != "support" || r.Personas[0].CostUSD != 0.05 ||
+		r.Personas[1].Runs != 2 || r.Personas[1].Conversations != 1 {
+		t.Errorf("Personas = %+v", r.Personas)
+	}
+	causes := map[string]int{}
+	for _, e := range r.Errors {
+		causes[e.Source+": "+e.Cause] = e.Count
+	}
+	for _, want := range []string{"run: timed out", "llm: rate limited", "tool: exec: exit status N"} {
+		if causes[want] != 1 {
+			t.Errorf("Errors lack %q: %+v", want, r.Errors)
+		}
+	}
+
+	for _, want := range []string{"Busiest hours", "web_search", "support", "rate limited"} {
+		if !strings.Contains(r.Text(), want) {
+			t.Errorf("Text lacks %q:\n%s", want, r.Text())
+		}
+	}
+	if summary := r.Summary(); !strings.Contains(summary, "4 runs (1 failed) in 2 conversations") ||
+		!strings.Contains(summary, "Cost by persona: support $0.05, main $0.03") {
+		t.Errorf("Summary =\n%s", summary)
+	}
+}
+
+func TestCause(t *testing.T) {
+	for msg, want := range map[string]string{
+		"openai: 503 Service Unavailable":               "provider unavailable",
+		"context canceled":                              "cancelled",
+		"Post \"https://x\": context deadline exceeded": "timed out",
+		"invalid api key":                               "authentication failed",
+		"file 12.txt is empty\nmore":                    "file N.txt is empty",
+		"":                                              "unknown",
+	} {
+		if got := Cause(msg); got != want {
+			t.Errorf("Cause(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+
+// Package backup writes the config and workspaces of an installation into
+// a single archive and restores them from it, to move picoclaw to another
+// device or keep copies of its state.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/sipeed/picoclaw/pkg/sqlite"
+)
+
+// FormatVersion is the version of the archive layout, recorded in the
+// manifest.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Source is a file or directory that goes into an archive under Name,
+// e.g. "config" for config.json or "workspace" for the workspace.
+type Source struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // where it was taken from
+	Dir  bool   `json:"dir"`
+}
+
+// Manifest describes an archive. It is its first entry.
+type Manifest struct {
+	Format  int       `json:"format"`
+	Created time.Time `json:"created"`
+	Version string    `json:"version,omitempty"` // of picoclaw
+	Sources []Source  `json:"sources"`
+	Files   int       `json:"files"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// Create writes a gzipped tar archive of sources to w, in their order, so
+// a restore sees the config before the workspaces it points to. Sources
+// that do not exist are left out. SQLite databases are copied with VACUUM
+// INTO, which gives a consistent copy while the gateway writes to them;
+// their -wal and -shm files and leftover *.tmp files are skipped.
+func Create(w io.Writer, sources []Source, version string) (*Manifest, error) {
+	m := &Manifest{Format: FormatVersion, Created: time.Now().UTC(), Version: version}
+	for _, src := range sources {
+		info, err := os.Stat(src.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		src.Dir = info.IsDir()
+		m.Sources = append(m.Sources, src)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	// The manifest goes first, with the counts filled in once known; the
+	// files are buffered in a temp archive until then.
+	body, err := os.CreateTemp("", "picoclaw-backup-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(body.Name())
+	defer body.Close()
+	bw := tar.NewWriter(body)
+	for _, src := range m.Sources {
+		if err := addSource(bw, src, m); err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", src.Path, err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, 0o644, m.Created, bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	br := tar.NewReader(body)
+	for {
+		hdr, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, br); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return m, gz.Close()
+}
+
+// addSource adds the files of src to tw under src.Name.
+func addSource(tw *tar.Writer, src Source, m *Manifest) error {
+	if !src.Dir {
+		return addFile(tw, src.Name+"/"+filepath.Base(src.Path), src.Path, m)
+	}
+	return filepath.WalkDir(src.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() || skipFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(src.Path, p)
+		if err != nil {
+			return err
+		}
+		return addFile(tw, src.Name+"/"+filepath.ToSlash(rel), p, m)
+	})
+}
+
+// skipFile reports whether a file is left out of archives: SQLite's
+// write-ahead log and shared memory, which VACUUM INTO already folds in,
+// and temp files of interrupted writes.
+func skipFile(name string) bool {
+	for _, suffix := range []string{"-wal", "-shm", "-journal", ".tmp"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func addFile(tw *tar.Writer, name, p string, m *Manifest) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(sqliteHeader))
+	if n, _ := io.ReadFull(f, header); n == len(header) && bytes.Equal(header, sqliteHeader) {
+		snapshot, err := snapshotSQLite(p)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(snapshot)
+		sf, err := os.Open(snapshot)
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		sinfo, err := sf.Stat()
+		if err != nil {
+			return err
+		}
+		m.Files++
+		m.Bytes += sinfo.Size()
+		return writeEntry(tw, name, info.Mode().Perm(), info.ModTime(), sf, sinfo.Size())
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	m.Files++
+	m.Bytes += info.Size()
+	return writeEntry(tw, name, info.Mode().Perm(), info.ModTime(), f, info.Size())
+}
+
+// snapshotSQLite copies the database at p into a temp file and returns
+// its path.
+func snapshotSQLite(p string) (string, error) {
+	f, err := os.CreateTemp("", "picoclaw-backup-*.db")
+	if err != nil {
+		return "", err
+	}
+	snapshot := f.Name()
+	f.Close()
+	// VACUUM INTO writes only to a file that does not exist yet.
+	os.Remove(snapshot)
+
+	db, err := sql.Open("sqlite", "file:"+p+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	if _, err := db.Exec("VACUUM INTO ?", snapshot); err != nil {
+		os.Remove(snapshot)
+		return "", fmt.Errorf("failed to copy database %s: %w", filepath.Base(p), err)
+	}
+	return snapshot, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, mode fs.FileMode, modTime time.Time, r io.Reader, size int64) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     int64(mode),
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err := io.CopyN(tw, r, size)
+	return err
+}
+
+// Restore extracts an archive written by Create. Each file goes under the
+// path target returns for the name of its source: the file itself for a
+// file source, the directory for a directory source. target is asked in
+// the order of the archive, so it can read the config restored before it.
+// Sources target returns "" for are skipped. Unless overwrite is set, a
+// file that already exists stops the restore.
+func Restore(r io.Reader, target func(name string) string, overwrite bool) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a picoclaw backup: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("not a picoclaw backup: no manifest")
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to read the manifest: %w", err)
+	}
+	if m.Format > FormatVersion {
+		return nil, fmt.Errorf("backup format %d is newer than this picoclaw reads (%d)", m.Format, FormatVersion)
+	}
+	// Longest names first, so "agents/coder" is not taken for "agents".
+	sources := append([]Source(nil), m.Sources...)
+	sort.Slice(sources, func(i, j int) bool { return len(sources[i].Name) > len(sources[j].Name) })
+	targets := make(map[string]string)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return &m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		src, rel, ok := sourceOf(sources, hdr.Name)
+		if !ok {
+			return nil, fmt.Errorf("entry %s belongs to no source of the manifest", hdr.Name)
+		}
+		dest, seen := targets[src.Name]
+		if !seen {
+			dest = target(src.Name)
+			targets[src.Name] = dest
+		}
+		if dest == "" {
+			continue
+		}
+		if src.Dir {
+			dest = filepath.Join(dest, filepath.FromSlash(rel))
+		}
+		if err := extract(tr, dest, fs.FileMode(hdr.Mode).Perm(), overwrite); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sourceOf finds the source an entry belongs to and the entry's path
+// inside it. Paths that would leave the source are refused.
+func sourceOf(sources []Source, name string) (Source, string, bool) {
+	for _, src := range sources {
+		rel, ok := strings.CutPrefix(name, src.Name+"/")
+		if !ok {
+			continue
+		}
+		clean := path.Clean(rel)
+		if rel == "" || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+			return Source{}, "", false
+		}
+		return src, clean, true
+	}
+	return Source{}, "", false
+}
+
+func extract(r io.Reader, dest string, mode fs.FileMode, overwrite bool) error {
+	if _, err := os.Stat(dest); err == nil && !overwrite {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tempFile := dest + ".tmp"
+	f, err := os.OpenFile(tempFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	if err := os.Rename(tempFile, dest); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	// The write-ahead log of a database that was replaced would be
+	// replayed into the restored copy.
+	os.Remove(dest + "-wal")
+	os.Remove(dest + "-shm")
+	return nil
+}
+
+// FileName is the name of an archive created at t.
+func FileName(t time.Time) string {
+	return "picoclaw-" + t.Format("20060102-150405") + ".tar.gz"
+}
+
+// Prune removes all but the keep newest archives named by FileName in
+// dir, and returns the paths it removed.
+func Prune(dir string, keep int) ([]string, error) {
+	archives, err := filepath.Glob(filepath.Join(dir, "picoclaw-*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+	// The names sort by the time they were created at.
+	sort.Strings(archives)
+	var removed []string
+	for _, p := range archives[:max(len(archives)-keep, 0)] {
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+	return removed, nil
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "config.json"), `{"agents":{}}`)
+	writeFile(t, filepath.Join(src, "workspace", "memory", "MEMORY.md"), "remember me")
+	writeFile(t, filepath.Join(src, "workspace", "cron", "jobs.json"), "[]")
+	writeFile(t, filepath.Join(src, "workspace", "state", "profiles.json.tmp"), "half written")
+	writeFile(t, filepath.Join(src, "coder", "AGENTS.md"), "Write Go.")
+
+	// A database in WAL mode, still open, with its last write only in the
+	// log: the backup has to carry it anyway.
+	dbPath := filepath.Join(src, "workspace", "sessions", "sessions.db")
+	os.MkdirAll(filepath.Dir(dbPath), 0o755)
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?_pragma=journal_mode(WAL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE sessions (key TEXT); INSERT INTO sessions VALUES ('agent:main:main')"); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	m, err := Create(&archive, []Source{
+		{Name: "config", Path: filepath.Join(src, "config.json")},
+		{Name: "auth", Path: filepath.Join(src, "auth.json")}, // missing, left out
+		{Name: "workspace", Path: filepath.Join(src, "workspace")},
+		{Name: "agents/coder", Path: filepath.Join(src, "coder")},
+	}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sources) != 3 || m.Files != 5 {
+		t.Errorf("manifest = %+v", m)
+	}
+
+	dst := t.TempDir()
+	var asked []string
+	target := func(name string) string {
+		asked = append(asked, name)
+		switch name {
+		case "config":
+			return filepath.Join(dst, "config.json")
+		case "workspace":
+			return filepath.Join(dst, "ws")
+		}
+		return "" // the coder agent is not on this device
+	}
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), target, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(asked, ",") != "config,workspace,agents/coder" {
+		t.Errorf("targets asked for %v, want the config first", asked)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "ws", "memory", "MEMORY.md")); string(data) != "remember me" {
+		t.Errorf("MEMORY.md = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "ws", "state", "profiles.json.tmp")); err == nil {
+		t.Error("a temp file was backed up")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "coder")); err == nil {
+		t.Error("a skipped source was restored")
+	}
+
+	restored, err := sql.Open("sqlite", filepath.Join(dst, "ws", "sessions", "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var key string
+	if err := restored.QueryRow("SELECT key FROM sessions").Scan(&key); err != nil || key != "agent:main:main" {
+		t.Errorf("restored database: key = %q, %v", key, err)
+	}
+
+	// Restoring again over the same files needs overwrite.
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), target, false); err == nil {
+		t.Error("restore overwrote existing files without overwrite")
+	}
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), target, true); err != nil {
+		t.Errorf("restore with overwrite: %v", err)
+	}
+}
+
+func TestRestore_RefusesPathsOutsideTheSource(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	manifest := `{"format":1,"sources":[{"name":"workspace","dir":true}]}`
+	writeEntry(tw, manifestName, 0o644, time.Now(), strings.NewReader(manifest), int64(len(manifest)))
+	writeEntry(tw, "workspace/../../evil", 0o644, time.Now(), strings.NewReader("x"), 1)
+	tw.Close()
+	gz.Close()
+
+	dst := t.TempDir()
+	_, err := Restore(&archive, func(string) string { return filepath.Join(dst, "ws") }, true)
+	if err == nil {
+		t.Fatal("restore accepted an entry outside its source")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "evil")); err == nil {
+		t.Error("the entry was written")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		writeFile(t, filepath.Join(dir, FileName(start.Add(time.Duration(i)*time.Hour))), "")
+	}
+	writeFile(t, filepath.Join(dir, "notes.txt"), "")
+
+	removed, err := Prune(dir, 2)
+	if err != nil || len(removed) != 2 || !strings.HasSuffix(removed[0], "20260301-120000.tar.gz") {
+		t.Fatalf("Prune = %v, %v", removed, err)
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(left) != 3 {
+		t.Errorf("left = %v", left)
+	}
+}
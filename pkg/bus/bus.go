@@ -57,6 +57,46 @@ func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, b
 	}
 }
 
+// PendingOutbound returns the number of outbound messages waiting to be
+// sent.
+func (mb *MessageBus) PendingOutbound() int {
+	return len(mb.outbound)
+}
+
+// TakeInbound removes and returns the inbound messages waiting to be
+// handled, without blocking.
+func (mb *MessageBus) TakeInbound() []InboundMessage {
+	var msgs []InboundMessage
+	for {
+		select {
+		case msg, ok := <-mb.inbound:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// TakeOutbound removes and returns the outbound messages waiting to be
+// sent, without blocking.
+func (mb *MessageBus) TakeOutbound() []OutboundMessage {
+	var msgs []OutboundMessage
+	for {
+		select {
+		case msg, ok := <-mb.outbound:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
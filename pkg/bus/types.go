@@ -1,19 +1,70 @@
 package bus
 
+import (
+	"context"
+	"io"
+)
+
 type InboundMessage struct {
-	Channel    string            `json:"channel"`
-	SenderID   string            `json:"sender_id"`
-	ChatID     string            `json:"chat_id"`
-	Content    string            `json:"content"`
-	Media      []string          `json:"media,omitempty"`
-	SessionKey string            `json:"session_key"`
-	Metadata   map[string]string `json:"metadata,omitempty"`
+	Channel  string `json:"channel"`
+	SenderID string `json:"sender_id"`
+	ChatID   string `json:"chat_id"`
+	Content  string `json:"content"`
+	// Media lists the local paths of Attachments, for consumers that only
+	// need files.
+	Media       []string          `json:"media,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	SessionKey  string            `json:"session_key"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
 }
 
+// EventMessageDeleted is the "event" metadata of an inbound message that
+// only reports that the message with the given "message_id" was deleted.
+const EventMessageDeleted = "message_deleted"
+
 type OutboundMessage struct {
-	Channel string `json:"channel"`
-	ChatID  string `json:"chat_id"`
-	Content string `json:"content"`
+	Channel     string       `json:"channel"`
+	ChatID      string       `json:"chat_id"`
+	Content     string       `json:"content"`
+	Buttons     []Button     `json:"buttons,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Proactive is set on messages sent on the gateway's own initiative,
+	// by cron jobs, heartbeats, digests and workflows, rather than in
+	// answer to one. Do-not-disturb holds them back.
+	Proactive bool `json:"proactive,omitempty"`
+	// Urgent is set on alerts, which do-not-disturb lets through on the
+	// channels it names.
+	Urgent bool `json:"urgent,omitempty"`
+}
+
+// Attachment types.
+const (
+	AttachmentImage = "image"
+	AttachmentAudio = "audio"
+	AttachmentVideo = "video"
+	AttachmentFile  = "file"
+)
+
+// Attachment is a file sent along with a message. Inbound attachments start
+// out with Fetch set and get a local Path once the media store has
+// downloaded them; outbound attachments always have a Path.
+type Attachment struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Path        string `json:"path,omitempty"`
+	// Fetch opens the remote content. It is only needed until Path is set.
+	Fetch func(ctx context.Context) (io.ReadCloser, error) `json:"-"`
+}
+
+// Button is a quick-reply choice attached to an outbound message, e.g. for
+// approval prompts. Channels that support buttons render them under the
+// message; pressing one comes back as an inbound message whose content is
+// Data. Other channels only deliver Content.
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data"`
 }
 
 type MessageHandler func(InboundMessage) error
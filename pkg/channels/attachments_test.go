@@ -0,0 +1,174 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+func TestHandleMessageWithAttachments(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, nil)
+	store := media.NewStore(t.TempDir(), 1024, time.Hour)
+	ch.SetMediaStore(store)
+
+	ch.HandleMessageWithAttachments("u1", "c1", "look", []bus.Attachment{{
+		Name: "cat.jpg",
+		Fetch: func(ctx context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("jpeg")), nil
+		},
+	}}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Type != bus.AttachmentImage {
+		t.Fatalf("Attachments = %+v", msg.Attachments)
+	}
+	if len(msg.Media) != 1 || filepath.Dir(msg.Media[0]) != store.Dir() {
+		t.Errorf("Media = %v, want a path in %s", msg.Media, store.Dir())
+	}
+}
+
+func TestHandleMessageWithAttachmentsDisallowedSender(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, []string{"someone-else"})
+	store := media.NewStore(t.TempDir(), 1024, time.Hour)
+	ch.SetMediaStore(store)
+
+	att, err := ch.FetchAttachment(context.Background(), bus.Attachment{
+		Name: "voice.ogg",
+		Fetch: func(ctx context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("ogg")), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.HandleMessageWithAttachments("u1", "c1", "", []bus.Attachment{att}, nil)
+
+	if _, err := os.Stat(att.Path); !os.IsNotExist(err) {
+		t.Error("attachment from a rejected sender was kept")
+	}
+}
+
+type fakeAttachmentChannel struct {
+	*BaseChannel
+	sent     []bus.OutboundMessage
+	uploaded []bus.Attachment
+}
+
+func (c *fakeAttachmentChannel) Start(ctx context.Context) error { return nil }
+func (c *fakeAttachmentChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *fakeAttachmentChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func (c *fakeAttachmentChannel) Capabilities() Capabilities {
+	return Capabilities{Attachments: true}
+}
+
+func (c *fakeAttachmentChannel) SendAttachment(ctx context.Context, chatID string, att bus.Attachment) error {
+	c.uploaded = append(c.uploaded, att)
+	return nil
+}
+
+type fakeTextChannel struct {
+	*BaseChannel
+	sent []bus.OutboundMessage
+}
+
+func (c *fakeTextChannel) Start(ctx context.Context) error { return nil }
+func (c *fakeTextChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *fakeTextChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func TestManagerSendAttachments(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Attachments.MaxSizeMB = 1
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := filepath.Join(t.TempDir(), "chart.png")
+	big := filepath.Join(t.TempDir(), "dump.bin")
+	os.WriteFile(small, []byte("png"), 0o600)
+	os.WriteFile(big, make([]byte, 2<<20), 0o600)
+	attachments := []bus.Attachment{media.FromFile(small), media.FromFile(big)}
+
+	uploader := &fakeAttachmentChannel{BaseChannel: NewBaseChannel("up", nil, nil, nil)}
+	err = m.send(context.Background(), uploader, bus.OutboundMessage{
+		ChatID:      "1",
+		Content:     "Results",
+		Attachments: attachments,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploader.uploaded) != 1 || uploader.uploaded[0].Name != "chart.png" {
+		t.Errorf("uploaded = %+v", uploader.uploaded)
+	}
+	if len(uploader.sent) != 1 || !strings.Contains(uploader.sent[0].Content, "[attachment not sent: dump.bin]") {
+		t.Errorf("sent = %+v", uploader.sent)
+	}
+
+	text := &fakeTextChannel{BaseChannel: NewBaseChannel("text", nil, nil, nil)}
+	err = m.send(context.Background(), text, bus.OutboundMessage{
+		ChatID:      "1",
+		Attachments: attachments[:1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(text.sent) != 1 || text.sent[0].Content != "[attachment not sent: chart.png]" {
+		t.Errorf("sent = %+v", text.sent)
+	}
+}
+
+func TestManagerOutboundHooks(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddOutboundHook(func(ctx context.Context, msg *bus.OutboundMessage) error {
+		if strings.Contains(msg.Content, "secret") {
+			return errors.New("contains a secret")
+		}
+		msg.Content = strings.ToUpper(msg.Content)
+		return nil
+	})
+
+	text := &fakeTextChannel{BaseChannel: NewBaseChannel("text", nil, nil, nil)}
+	m.RegisterChannel("text", text)
+
+	if err := m.SendToChannel(context.Background(), "text", "1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SendToChannel(context.Background(), "text", "1", "the secret"); err == nil {
+		t.Error("expected the hook to block the message")
+	}
+	if len(text.sent) != 1 || text.sent[0].Content != "HELLO" {
+		t.Errorf("sent = %+v", text.sent)
+	}
+}
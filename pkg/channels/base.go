@@ -3,8 +3,11 @@ package channels
 import (
 	"context"
 	"strings"
+	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/media"
 )
 
 type Channel interface {
@@ -14,6 +17,22 @@ type Channel interface {
 	Send(ctx context.Context, msg bus.OutboundMessage) error
 	IsRunning() bool
 	IsAllowed(senderID string) bool
+	Capabilities() Capabilities
+}
+
+// StreamingChannel is implemented by channels that can show partial agent
+// output while it is generated. The complete reply is still delivered
+// through Send afterwards.
+type StreamingChannel interface {
+	Channel
+	SendDelta(chatID, delta string)
+}
+
+// AttachmentChannel is implemented by channels that can upload files. For
+// other channels the manager mentions outbound attachments in the text.
+type AttachmentChannel interface {
+	Channel
+	SendAttachment(ctx context.Context, chatID string, att bus.Attachment) error
 }
 
 type BaseChannel struct {
@@ -21,7 +40,10 @@ type BaseChannel struct {
 	bus       *bus.MessageBus
 	running   bool
 	name      string
+	account   string
+	allowMu   sync.RWMutex
 	allowList []string
+	media     *media.Store
 }
 
 func NewBaseChannel(name string, config any, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -38,15 +60,77 @@ func (c *BaseChannel) Name() string {
 	return c.name
 }
 
+// SetAccount names the account this instance belongs to when several
+// instances of one channel type are configured. The channel is then called
+// "<type>@<account>" and its inbound messages carry an account_id.
+func (c *BaseChannel) SetAccount(account string) {
+	channelType, _ := SplitAccount(c.name)
+	c.account = account
+	c.name = AccountChannelName(channelType, account)
+}
+
+// Account returns the account name, or "" for the default instance.
+func (c *BaseChannel) Account() string {
+	return c.account
+}
+
+// AccountChannelName returns the name of the instance of channelType that
+// belongs to account.
+func AccountChannelName(channelType, account string) string {
+	if account == "" {
+		return channelType
+	}
+	return channelType + "@" + account
+}
+
+// SplitAccount splits a channel name such as "telegram@work" into the
+// channel type and account. The default instance has no account.
+func SplitAccount(name string) (channelType, account string) {
+	channelType, account, _ = strings.Cut(name, "@")
+	return channelType, account
+}
+
+// Capabilities returns what a channel supports when it does not say
+// otherwise: Markdown passed through as is, no length limit and none of
+// the optional features.
+func (c *BaseChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Markdown}
+}
+
 func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
 
+// SetAllowList replaces the senders the channel accepts, for a config
+// reload. Channels that store allowlist entries in another form than
+// configured override it.
+func (c *BaseChannel) SetAllowList(allowList []string) error {
+	c.allowMu.Lock()
+	defer c.allowMu.Unlock()
+	c.allowList = allowList
+	return nil
+}
+
 func (c *BaseChannel) IsAllowed(senderID string) bool {
+	c.allowMu.RLock()
+	defer c.allowMu.RUnlock()
 	if len(c.allowList) == 0 {
 		return true
 	}
 
+	for _, allowed := range c.allowList {
+		if SenderMatches(senderID, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SenderMatches reports whether senderID is the sender an allowlist entry
+// names. Either side may use the "id|username" form of Telegram, and the
+// entry may name the username with a leading "@".
+func SenderMatches(senderID, allowed string) bool {
 	// Extract parts from compound senderID like "123456|username"
 	idPart := senderID
 	userPart := ""
@@ -55,49 +139,108 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 		userPart = senderID[idx+1:]
 	}
 
-	for _, allowed := range c.allowList {
-		// Strip leading "@" from allowed value for username matching
-		trimmed := strings.TrimPrefix(allowed, "@")
-		allowedID := trimmed
-		allowedUser := ""
-		if idx := strings.Index(trimmed, "|"); idx > 0 {
-			allowedID = trimmed[:idx]
-			allowedUser = trimmed[idx+1:]
-		}
-
-		// Support either side using "id|username" compound form.
-		// This keeps backward compatibility with legacy Telegram allowlist entries.
-		if senderID == allowed ||
-			idPart == allowed ||
-			senderID == trimmed ||
-			idPart == trimmed ||
-			idPart == allowedID ||
-			(allowedUser != "" && senderID == allowedUser) ||
-			(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser)) {
-			return true
-		}
+	// Strip leading "@" from allowed value for username matching
+	trimmed := strings.TrimPrefix(allowed, "@")
+	allowedID := trimmed
+	allowedUser := ""
+	if idx := strings.Index(trimmed, "|"); idx > 0 {
+		allowedID = trimmed[:idx]
+		allowedUser = trimmed[idx+1:]
 	}
 
-	return false
+	// Support either side using "id|username" compound form.
+	// This keeps backward compatibility with legacy Telegram allowlist entries.
+	return senderID == allowed ||
+		idPart == allowed ||
+		senderID == trimmed ||
+		idPart == trimmed ||
+		idPart == allowedID ||
+		(allowedUser != "" && senderID == allowedUser) ||
+		(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser))
 }
 
-func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
+// HandleMessage publishes an inbound message. mediaPaths are files the
+// channel already saved; use HandleMessageWithAttachments to let the media
+// store download them instead.
+func (c *BaseChannel) HandleMessage(senderID, chatID, content string, mediaPaths []string, metadata map[string]string) {
+	var atts []bus.Attachment
+	for _, path := range mediaPaths {
+		atts = append(atts, media.FromFile(path))
+	}
+	c.HandleMessageWithAttachments(senderID, chatID, content, atts, metadata)
+}
+
+// HandleMessageWithAttachments publishes an inbound message after fetching
+// its attachments into the media store and running attachment hooks.
+func (c *BaseChannel) HandleMessageWithAttachments(
+	senderID, chatID, content string,
+	atts []bus.Attachment,
+	metadata map[string]string,
+) {
 	if !c.IsAllowed(senderID) {
+		for _, att := range atts {
+			c.MediaStore().Release(att)
+		}
 		return
 	}
 
+	if c.account != "" {
+		withAccount := make(map[string]string, len(metadata)+1)
+		for k, v := range metadata {
+			withAccount[k] = v
+		}
+		withAccount["account_id"] = c.account
+		metadata = withAccount
+	}
+
 	msg := bus.InboundMessage{
 		Channel:  c.name,
 		SenderID: senderID,
 		ChatID:   chatID,
 		Content:  content,
-		Media:    media,
 		Metadata: metadata,
 	}
+	if len(atts) > 0 {
+		msg.Attachments = c.MediaStore().Prepare(context.Background(), c.name, atts)
+		for _, att := range msg.Attachments {
+			msg.Media = append(msg.Media, att.Path)
+		}
+	}
 
 	c.bus.PublishInbound(msg)
 }
 
+// HandleDeletion reports that the message with messageID was deleted, so
+// the agent does not answer it, or stops answering it.
+func (c *BaseChannel) HandleDeletion(chatID, messageID string) {
+	metadata := map[string]string{"event": bus.EventMessageDeleted, "message_id": messageID}
+	if c.account != "" {
+		metadata["account_id"] = c.account
+	}
+	c.bus.PublishInbound(bus.InboundMessage{Channel: c.name, ChatID: chatID, Metadata: metadata})
+}
+
+// FetchAttachment downloads an attachment right away, for channels that need
+// the file before publishing (e.g. to transcribe voice notes). The media store
+// owns the file afterwards.
+func (c *BaseChannel) FetchAttachment(ctx context.Context, att bus.Attachment) (bus.Attachment, error) {
+	err := c.MediaStore().Fetch(ctx, &att)
+	return att, err
+}
+
+// MediaStore returns the store inbound attachments are saved to.
+func (c *BaseChannel) MediaStore() *media.Store {
+	if c.media == nil {
+		return media.Default()
+	}
+	return c.media
+}
+
+// SetMediaStore replaces the default media store.
+func (c *BaseChannel) SetMediaStore(store *media.Store) {
+	c.media = store
+}
+
 func (c *BaseChannel) setRunning(running bool) {
 	c.running = running
 }
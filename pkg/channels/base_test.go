@@ -1,6 +1,13 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +57,97 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseChannelAccount(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("telegram", nil, msgBus, nil)
+	ch.SetAccount("work")
+
+	if ch.Name() != "telegram@work" || ch.Account() != "work" {
+		t.Fatalf("Name = %q, Account = %q", ch.Name(), ch.Account())
+	}
+
+	metadata := map[string]string{"peer_kind": "direct"}
+	ch.HandleMessage("u1", "c1", "hi", nil, metadata)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if msg.Channel != "telegram@work" || msg.Metadata["account_id"] != "work" {
+		t.Errorf("Channel = %q, Metadata = %v", msg.Channel, msg.Metadata)
+	}
+	if _, ok := metadata["account_id"]; ok {
+		t.Error("the channel's metadata map was modified")
+	}
+
+	if typ, account := SplitAccount("telegram@work"); typ != "telegram" || account != "work" {
+		t.Errorf("SplitAccount = %q, %q", typ, account)
+	}
+	if typ, account := SplitAccount("slack"); typ != "slack" || account != "" {
+		t.Errorf("SplitAccount = %q, %q", typ, account)
+	}
+}
+
+func TestManagerStartsAccountChannels(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Webhook.Enabled = true
+	cfg.Channels.Webhook.APIKeys = config.FlexibleStringSlice{"main"}
+	work := config.DefaultConfig().Channels
+	work.Webhook.Enabled = true
+	work.Webhook.APIKeys = config.FlexibleStringSlice{"work"}
+	cfg.Channels.Accounts = config.ChannelAccounts{"work": work}
+
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary, ok := m.GetChannel("webhook")
+	if !ok {
+		t.Fatal("default webhook instance missing")
+	}
+	account, ok := m.GetChannel("webhook@work")
+	if !ok {
+		t.Fatalf("account instance missing, have %v", m.GetEnabledChannels())
+	}
+	if primary == account || account.Name() != "webhook@work" {
+		t.Errorf("account channel = %s", account.Name())
+	}
+	if !account.IsAllowed("anyone") || account.(*WebhookChannel).config.APIKeys[0] != "work" {
+		t.Error("account channel should use its own settings")
+	}
+}
+
+func TestManagerSetAllowLists(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	telegram := &fakeTextChannel{BaseChannel: NewBaseChannel("telegram", nil, msgBus, []string{"1"})}
+	work := &fakeTextChannel{BaseChannel: NewBaseChannel("telegram", nil, msgBus, []string{"1"})}
+	work.SetAccount("work")
+	sms, err := NewSMSChannel(config.SMSConfig{Provider: "modem", ModemDevice: "/dev/null"}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{channels: map[string]Channel{"telegram": telegram, "telegram@work": work, "sms": sms}}
+
+	cfg := config.DefaultConfig()
+	cfg.Channels.Telegram.AllowFrom = config.FlexibleStringSlice{"2"}
+	cfg.Channels.SMS.AllowFrom = config.FlexibleStringSlice{"+1 (555) 0100"}
+	accounts := config.DefaultConfig().Channels
+	accounts.Telegram.AllowFrom = config.FlexibleStringSlice{"3"}
+	cfg.Channels.Accounts = config.ChannelAccounts{"work": accounts}
+	m.SetAllowLists(cfg)
+
+	if telegram.IsAllowed("1") || !telegram.IsAllowed("2") {
+		t.Error("telegram kept its old allowlist")
+	}
+	if work.IsAllowed("2") || !work.IsAllowed("3") {
+		t.Error("the work account did not get its own allowlist")
+	}
+	if !sms.IsAllowed("+15550100") {
+		t.Error("sms allowlist was not normalized")
+	}
+}
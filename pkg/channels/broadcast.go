@@ -0,0 +1,63 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// BroadcastResult is the outcome of delivering a broadcast to one target.
+type BroadcastResult struct {
+	Target string // "channel:chat_id"
+	Err    error
+}
+
+// Broadcast sends content to every target, one at a time with the
+// configured interval in between. Each delivery goes through the outbound
+// hooks like any other message. With no targets, the configured broadcast
+// targets are used. It stops early, marking the remaining targets as
+// failed, if ctx ends.
+func (m *Manager) Broadcast(ctx context.Context, targets []string, content string) []BroadcastResult {
+	cfg := m.config.Channels.Broadcast
+	if len(targets) == 0 {
+		targets = cfg.Targets
+	}
+	interval := time.Duration(cfg.IntervalMS) * time.Millisecond
+
+	results := make([]BroadcastResult, 0, len(targets))
+	for i, target := range targets {
+		if i > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			results = append(results, BroadcastResult{Target: target, Err: err})
+			continue
+		}
+
+		var err error
+		channel, chatID, ok := strings.Cut(target, ":")
+		if !ok || channel == "" || chatID == "" {
+			err = fmt.Errorf("invalid target %q, expected channel:chat_id", target)
+		} else {
+			err = m.SendToChannel(ctx, channel, chatID, content)
+		}
+		if err != nil {
+			logger.WarnCF("channels", "Broadcast delivery failed", map[string]any{
+				"target": target,
+				"error":  err.Error(),
+			})
+		}
+		results = append(results, BroadcastResult{Target: target, Err: err})
+	}
+
+	logger.InfoCF("channels", "Broadcast finished", map[string]any{
+		"targets": len(targets),
+	})
+	return results
+}
@@ -0,0 +1,79 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestManagerBroadcast(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Broadcast.Targets = config.FlexibleStringSlice{"a:1", "b:2", "a:blocked", "missing:3", "bad"}
+	cfg.Channels.Broadcast.IntervalMS = 0
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &fakeTextChannel{BaseChannel: NewBaseChannel("a", nil, nil, nil)}
+	b := &fakeTextChannel{BaseChannel: NewBaseChannel("b", nil, nil, nil)}
+	m.RegisterChannel("a", a)
+	m.RegisterChannel("b", b)
+
+	var hooked []string
+	m.AddOutboundHook(func(ctx context.Context, msg *bus.OutboundMessage) error {
+		hooked = append(hooked, msg.Channel+":"+msg.ChatID)
+		if msg.ChatID == "blocked" {
+			return errors.New("quiet hours")
+		}
+		msg.Content += " (" + msg.Channel + ")"
+		return nil
+	})
+
+	results := m.Broadcast(context.Background(), nil, "maintenance tonight")
+	if len(results) != 5 {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, wantErr := range []bool{false, false, true, true, true} {
+		if (results[i].Err != nil) != wantErr {
+			t.Errorf("result %s: err = %v", results[i].Target, results[i].Err)
+		}
+	}
+	if len(hooked) != 3 {
+		t.Errorf("hooks ran for %v, want each existing destination", hooked)
+	}
+	if len(a.sent) != 1 || a.sent[0].Content != "maintenance tonight (a)" {
+		t.Errorf("a got %+v", a.sent)
+	}
+	if len(b.sent) != 1 || b.sent[0].Content != "maintenance tonight (b)" {
+		t.Errorf("b got %+v", b.sent)
+	}
+}
+
+func TestManagerBroadcastCanceled(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Broadcast.IntervalMS = 60_000
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &fakeTextChannel{BaseChannel: NewBaseChannel("a", nil, nil, nil)}
+	m.RegisterChannel("a", a)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.AddOutboundHook(func(context.Context, *bus.OutboundMessage) error {
+		cancel()
+		return nil
+	})
+	results := m.Broadcast(ctx, []string{"a:1", "a:2"}, "hi")
+	if results[0].Err != nil || !errors.Is(results[1].Err, context.Canceled) {
+		t.Errorf("results = %+v", results)
+	}
+	if len(a.sent) != 1 {
+		t.Errorf("sent = %+v", a.sent)
+	}
+}
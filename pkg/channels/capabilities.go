@@ -0,0 +1,55 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+// Capabilities describes what a channel can show and do. The manager,
+// presence indicators and the agent read it instead of assuming things
+// about particular platforms, and channels render replies with it.
+type Capabilities struct {
+	// Markdown is the rich text dialect replies are converted to.
+	Markdown format.Dialect
+	// MaxMessageLength is the longest message in bytes; longer replies are
+	// split. 0 means no limit.
+	MaxMessageLength int
+	// Streaming channels show replies while they are generated, by editing
+	// a sent message or by appending output (see StreamingChannel).
+	Streaming bool
+	// Reactions, Typing and Attachments advertise ReactionChannel,
+	// TypingChannel and AttachmentChannel support.
+	Reactions   bool
+	Typing      bool
+	Attachments bool
+	// Buttons channels render bus.OutboundMessage.Buttons. Elsewhere the
+	// manager lists the choices in the text.
+	Buttons bool
+}
+
+// Render formats md in the channel's dialect and splits it into messages
+// that fit.
+func (c Capabilities) Render(md string) []string {
+	return format.Render(md, c.Markdown, c.MaxMessageLength)
+}
+
+// buttonsAsText appends the choices of a message to its text, for channels
+// that cannot show buttons. Each choice shows what to send to pick it.
+func buttonsAsText(msg *bus.OutboundMessage) {
+	if len(msg.Buttons) == 0 {
+		return
+	}
+	lines := make([]string, 0, len(msg.Buttons))
+	for _, b := range msg.Buttons {
+		if b.Data == "" || b.Data == b.Text {
+			lines = append(lines, "• "+b.Text)
+		} else {
+			lines = append(lines, fmt.Sprintf("• %s: %s", b.Text, b.Data))
+		}
+	}
+	msg.Content = strings.TrimSpace(msg.Content + "\n\n" + strings.Join(lines, "\n"))
+	msg.Buttons = nil
+}
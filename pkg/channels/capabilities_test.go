@@ -0,0 +1,47 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+)
+
+func TestManagerListsButtonsAsText(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := &fakeTextChannel{BaseChannel: NewBaseChannel("text", nil, nil, nil)}
+	err = m.send(context.Background(), text, bus.OutboundMessage{
+		ChatID:  "1",
+		Content: "Deploy finished.",
+		Buttons: []bus.Button{{Text: "Changelog", Data: "/changelog"}, {Text: "OK", Data: "OK"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Deploy finished.\n\n• Changelog: /changelog\n• OK"
+	if len(text.sent) != 1 || text.sent[0].Content != want || text.sent[0].Buttons != nil {
+		t.Errorf("sent = %+v", text.sent)
+	}
+}
+
+func TestCapabilitiesRender(t *testing.T) {
+	caps := Capabilities{Markdown: format.Plain, MaxMessageLength: 20}
+	parts := caps.Render("**Hello** there, this is a longer reply")
+	if len(parts) < 2 || parts[0] != "Hello" || strings.Join(parts, " ") != "Hello there, this is a longer reply" {
+		t.Errorf("parts = %q", parts)
+	}
+	for _, p := range parts {
+		if len(p) > 20 {
+			t.Errorf("part over the limit: %q", p)
+		}
+	}
+}
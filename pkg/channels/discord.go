@@ -12,7 +12,9 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -75,6 +77,9 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 	c.botUserID = botUser.ID
 
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageDelete) {
+		c.HandleDeletion(m.ChannelID, m.ID)
+	})
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -109,6 +114,17 @@ func (c *DiscordChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Capabilities reports Discord's Markdown flavor and 2000 character limit.
+func (c *DiscordChannel) Capabilities() Capabilities {
+	return Capabilities{
+		Markdown:         format.Discord,
+		MaxMessageLength: 2000,
+		Reactions:        true,
+		Typing:           true,
+		Attachments:      true,
+	}
+}
+
 func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	c.stopTyping(msg.ChatID)
 
@@ -126,7 +142,7 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return nil
 	}
 
-	chunks := utils.SplitMessage(msg.Content, 2000) // Split messages into chunks, Discord length limit: 2000 chars
+	chunks := c.Capabilities().Render(msg.Content)
 
 	for _, chunk := range chunks {
 		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
@@ -137,6 +153,20 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	return nil
 }
 
+// SendAttachment uploads a file to the channel.
+func (c *DiscordChannel) SendAttachment(ctx context.Context, chatID string, att bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+	f, err := os.Open(att.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = c.session.ChannelFileSend(chatID, att.Name, f, discordgo.WithContext(ctx))
+	return err
+}
+
 func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) error {
 	// Use the passed ctx for timeout control
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
@@ -210,66 +240,54 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 
 	content := m.Content
 	content = c.stripBotMention(content)
-	mediaPaths := make([]string, 0, len(m.Attachments))
-	localFiles := make([]string, 0, len(m.Attachments))
-
-	// Ensure temp files are cleaned up when function returns
-	defer func() {
-		for _, file := range localFiles {
-			if err := os.Remove(file); err != nil {
-				logger.DebugCF("discord", "Failed to cleanup temp file", map[string]any{
-					"file":  file,
-					"error": err.Error(),
-				})
-			}
-		}
-	}()
+	attachments := make([]bus.Attachment, 0, len(m.Attachments))
 
 	for _, attachment := range m.Attachments {
-		isAudio := utils.IsAudioFile(attachment.Filename, attachment.ContentType)
-
-		if isAudio {
-			localPath := c.downloadAttachment(attachment.URL, attachment.Filename)
-			if localPath != "" {
-				localFiles = append(localFiles, localPath)
-
-				transcribedText := ""
-				if c.transcriber != nil && c.transcriber.IsAvailable() {
-					ctx, cancel := context.WithTimeout(c.getContext(), transcriptionTimeout)
-					result, err := c.transcriber.Transcribe(ctx, localPath)
-					cancel() // Release context resources immediately to avoid leaks in for loop
-
-					if err != nil {
-						logger.ErrorCF("discord", "Voice transcription failed", map[string]any{
-							"error": err.Error(),
-						})
-						transcribedText = fmt.Sprintf("[audio: %s (transcription failed)]", attachment.Filename)
-					} else {
-						transcribedText = fmt.Sprintf("[audio transcription: %s]", result.Text)
-						logger.DebugCF("discord", "Audio transcribed successfully", map[string]any{
-							"text": result.Text,
-						})
-					}
-				} else {
-					transcribedText = fmt.Sprintf("[audio: %s]", attachment.Filename)
-				}
+		att := media.FromURL(attachment.URL, attachment.Filename, attachment.ContentType, nil)
+		att.Size = int64(attachment.Size)
+
+		if att.Type != bus.AttachmentAudio {
+			attachments = append(attachments, att)
+			continue
+		}
 
-				content = appendContent(content, transcribedText)
+		att, err := c.FetchAttachment(c.getContext(), att)
+		if err != nil {
+			logger.WarnCF("discord", "Failed to download audio attachment", map[string]any{
+				"url":      attachment.URL,
+				"filename": attachment.Filename,
+				"error":    err.Error(),
+			})
+			content = appendContent(content, fmt.Sprintf("[audio: %s (download failed)]", attachment.Filename))
+			continue
+		}
+		attachments = append(attachments, att)
+
+		transcribedText := ""
+		if c.transcriber != nil && c.transcriber.IsAvailable() {
+			ctx, cancel := context.WithTimeout(c.getContext(), transcriptionTimeout)
+			result, err := c.transcriber.Transcribe(ctx, att.Path)
+			cancel() // Release context resources immediately to avoid leaks in for loop
+
+			if err != nil {
+				logger.ErrorCF("discord", "Voice transcription failed", map[string]any{
+					"error": err.Error(),
+				})
+				transcribedText = fmt.Sprintf("[audio: %s (transcription failed)]", attachment.Filename)
 			} else {
-				logger.WarnCF("discord", "Failed to download audio attachment", map[string]any{
-					"url":      attachment.URL,
-					"filename": attachment.Filename,
+				transcribedText = fmt.Sprintf("[audio transcription: %s]", result.Text)
+				logger.DebugCF("discord", "Audio transcribed successfully", map[string]any{
+					"text": result.Text,
 				})
-				mediaPaths = append(mediaPaths, attachment.URL)
-				content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
 			}
 		} else {
-			mediaPaths = append(mediaPaths, attachment.URL)
-			content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
+			transcribedText = fmt.Sprintf("[audio: %s]", attachment.Filename)
 		}
+
+		content = appendContent(content, transcribedText)
 	}
 
-	if content == "" && len(mediaPaths) == 0 {
+	if content == "" && len(attachments) == 0 {
 		return
 	}
 
@@ -277,9 +295,6 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		content = "[media only]"
 	}
 
-	// Start typing after all early returns — guaranteed to have a matching Send()
-	c.startTyping(m.ChannelID)
-
 	logger.DebugCF("discord", "Received message", map[string]any{
 		"sender_name": senderName,
 		"sender_id":   senderID,
@@ -305,7 +320,33 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"peer_id":      peerID,
 	}
 
-	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
+	c.HandleMessageWithAttachments(senderID, m.ChannelID, content, attachments, metadata)
+}
+
+// CheckHealth reports whether the gateway websocket is connected.
+func (c *DiscordChannel) CheckHealth(ctx context.Context) error {
+	c.session.RLock()
+	ready := c.session.DataReady
+	c.session.RUnlock()
+	if !ready {
+		return fmt.Errorf("discord gateway is not connected")
+	}
+	return nil
+}
+
+// StartTyping shows the typing indicator until stop is called or a reply
+// is sent to the channel.
+func (c *DiscordChannel) StartTyping(ctx context.Context, chatID string) (func(), error) {
+	c.startTyping(chatID)
+	return func() { c.stopTyping(chatID) }, nil
+}
+
+func (c *DiscordChannel) AddReaction(ctx context.Context, chatID, messageID, emoji string) error {
+	return c.session.MessageReactionAdd(chatID, messageID, emoji, discordgo.WithContext(ctx))
+}
+
+func (c *DiscordChannel) RemoveReaction(ctx context.Context, chatID, messageID, emoji string) error {
+	return c.session.MessageReactionRemove(chatID, messageID, emoji, "@me", discordgo.WithContext(ctx))
 }
 
 // startTyping starts a continuous typing indicator loop for the given chatID.
@@ -354,12 +395,6 @@ func (c *DiscordChannel) stopTyping(chatID string) {
 	}
 }
 
-func (c *DiscordChannel) downloadAttachment(url, filename string) string {
-	return utils.DownloadFile(url, filename, utils.DownloadOptions{
-		LoggerPrefix: "discord",
-	})
-}
-
 // stripBotMention removes the bot mention from the message content.
 // Discord mentions have the format <@USER_ID> or <@!USER_ID> (with nickname).
 func (c *DiscordChannel) stripBotMention(text string) string {
@@ -0,0 +1,703 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	imapclient "github.com/emersion/go-imap/client"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// EmailChannel turns a mailbox into a chat: unread mail is polled over IMAP,
+// each thread becomes its own conversation, and replies go out over SMTP with
+// the threading headers mail clients expect.
+//
+// Chat IDs have the form "<address>/<thread root Message-ID>".
+type EmailChannel struct {
+	*BaseChannel
+	config   config.EmailConfig
+	ctx      context.Context
+	cancel   context.CancelFunc
+	threadMu sync.Mutex
+	threads  map[string]*emailThread // thread root Message-ID → state
+}
+
+type emailThread struct {
+	Subject    string
+	LastID     string
+	References []string
+}
+
+type emailMessage struct {
+	From        string
+	Verified    bool // a trusted server authenticated From's domain
+	Subject     string
+	MessageID   string
+	InReplyTo   []string
+	References  []string
+	Body        string
+	Attachments []string
+	Skipped     []string
+}
+
+func NewEmailChannel(cfg config.EmailConfig, messageBus *bus.MessageBus) (*EmailChannel, error) {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" || cfg.Address == "" {
+		return nil, fmt.Errorf("email imap_host, smtp_host and address are required")
+	}
+	if len(cfg.TrustedAuthservIDs) == 0 {
+		return nil, fmt.Errorf("email trusted_authserv_ids is required: without it the From header cannot be trusted")
+	}
+
+	base := NewBaseChannel("email", cfg, messageBus, cfg.AllowFrom)
+
+	return &EmailChannel{
+		BaseChannel: base,
+		config:      cfg,
+		threads:     make(map[string]*emailThread),
+	}, nil
+}
+
+func (c *EmailChannel) Start(ctx context.Context) error {
+	logger.InfoCF("email", "Starting email channel", map[string]any{
+		"imap":    c.config.IMAPHost,
+		"mailbox": c.mailbox(),
+	})
+
+	// Fail fast on bad credentials instead of logging on every poll.
+	client, err := c.connectIMAP()
+	if err != nil {
+		return err
+	}
+	client.Logout()
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.pollLoop()
+
+	c.setRunning(true)
+	logger.InfoC("email", "Email channel started")
+	return nil
+}
+
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping email channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("email", "Email channel stopped")
+	return nil
+}
+
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("email channel not running")
+	}
+
+	to, rootID := parseEmailChatID(msg.ChatID)
+	if to == "" {
+		return fmt.Errorf("invalid email chat ID: %s", msg.ChatID)
+	}
+
+	c.threadMu.Lock()
+	thread, ok := c.threads[rootID]
+	if !ok {
+		thread = &emailThread{Subject: "Message from picoclaw"}
+		if rootID != "" {
+			thread.LastID = rootID
+			thread.References = []string{rootID}
+		}
+		c.threads[rootID] = thread
+	}
+	subject := replySubject(thread.Subject)
+	inReplyTo := thread.LastID
+	references := append([]string(nil), thread.References...)
+	c.threadMu.Unlock()
+
+	data, messageID, err := c.buildReply(to, subject, inReplyTo, references, msg.Content)
+	if err != nil {
+		return err
+	}
+
+	if err := c.sendSMTP(to, data); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	c.threadMu.Lock()
+	thread.LastID = messageID
+	thread.References = appendUnique(thread.References, messageID)
+	c.threadMu.Unlock()
+
+	logger.DebugCF("email", "Reply sent", map[string]any{
+		"to":      to,
+		"subject": subject,
+	})
+	return nil
+}
+
+func (c *EmailChannel) pollLoop() {
+	interval := time.Duration(c.config.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.poll(); err != nil {
+			logger.WarnCF("email", "Mailbox poll failed", map[string]any{
+				"error": err.Error(),
+			})
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *EmailChannel) poll() error {
+	client, err := c.connectIMAP()
+	if err != nil {
+		return err
+	}
+	defer client.Logout()
+
+	if _, err := client.Select(c.mailbox(), false); err != nil {
+		return fmt.Errorf("failed to select mailbox: %w", err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := client.UidSearch(criteria)
+	if err != nil {
+		return fmt.Errorf("failed to search mailbox: %w", err)
+	}
+	if len(uids) == 0 {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.UidFetch(seqset, items, messages)
+	}()
+
+	var parsed []*emailMessage
+	for m := range messages {
+		body := m.GetBody(section)
+		if body == nil {
+			continue
+		}
+		em, err := c.parseMessage(body)
+		if err != nil {
+			logger.WarnCF("email", "Failed to parse message", map[string]any{
+				"uid":   m.Uid,
+				"error": err.Error(),
+			})
+			continue
+		}
+		parsed = append(parsed, em)
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("failed to fetch messages: %w", err)
+	}
+
+	// Mark as seen before dispatching so a crash does not produce duplicate replies.
+	flags := []any{imap.SeenFlag}
+	if err := client.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+		return fmt.Errorf("failed to mark messages as seen: %w", err)
+	}
+
+	for _, em := range parsed {
+		c.handleEmail(em)
+	}
+	return nil
+}
+
+func (c *EmailChannel) handleEmail(em *emailMessage) {
+	if strings.EqualFold(em.From, c.config.Address) {
+		return
+	}
+
+	if !em.Verified {
+		logger.WarnCF("email", "Message dropped: no passing DKIM, SPF or DMARC result from a trusted server", map[string]any{
+			"from": em.From,
+		})
+		for _, path := range em.Attachments {
+			os.Remove(path)
+		}
+		return
+	}
+
+	if !c.IsAllowed(em.From) {
+		logger.DebugCF("email", "Message rejected by allowlist", map[string]any{
+			"from": em.From,
+		})
+		for _, path := range em.Attachments {
+			os.Remove(path)
+		}
+		return
+	}
+
+	rootID := emailThreadRoot(em)
+
+	c.threadMu.Lock()
+	thread, ok := c.threads[rootID]
+	if !ok {
+		thread = &emailThread{Subject: em.Subject}
+		c.threads[rootID] = thread
+	}
+	thread.References = appendUnique(thread.References, em.References...)
+	thread.References = appendUnique(thread.References, em.MessageID)
+	thread.LastID = em.MessageID
+	c.threadMu.Unlock()
+
+	content := stripQuotedReply(em.Body)
+	if em.Subject != "" && !ok {
+		content = fmt.Sprintf("Subject: %s\n\n%s", em.Subject, content)
+	}
+	for _, path := range em.Attachments {
+		content = appendContent(content, fmt.Sprintf("[file: %s]", filepath.Base(path)))
+	}
+	for _, name := range em.Skipped {
+		content = appendContent(content, fmt.Sprintf("[file: %s (skipped: exceeds size limit)]", name))
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	chatID := em.From + "/" + rootID
+	metadata := map[string]string{
+		"message_id":       em.MessageID,
+		"subject":          em.Subject,
+		"platform":         "email",
+		"peer_kind":        "thread",
+		"peer_id":          rootID,
+		"parent_peer_kind": "direct",
+		"parent_peer_id":   em.From,
+	}
+
+	logger.DebugCF("email", "Received email", map[string]any{
+		"from":    em.From,
+		"subject": em.Subject,
+		"preview": utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(em.From, chatID, content, em.Attachments, metadata)
+}
+
+func (c *EmailChannel) parseMessage(r io.Reader) (*emailMessage, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	em := &emailMessage{}
+	if from, err := mr.Header.AddressList("From"); err == nil && len(from) > 0 {
+		em.From = strings.ToLower(from[0].Address)
+	}
+	if em.From == "" {
+		return nil, fmt.Errorf("message has no sender")
+	}
+	em.Verified = authResultsPass(mr.Header.Values("Authentication-Results"), c.config.TrustedAuthservIDs, em.From)
+	em.Subject, _ = mr.Header.Subject()
+	em.MessageID, _ = mr.Header.MessageID()
+	if em.MessageID == "" {
+		em.MessageID = uuid.New().String() + "@picoclaw.local"
+	}
+	em.InReplyTo, _ = mr.Header.MsgIDList("In-Reply-To")
+	em.References, _ = mr.Header.MsgIDList("References")
+
+	var htmlBody string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return em, fmt.Errorf("failed to read part: %w", err)
+		}
+
+		switch h := part.Header.(type) {
+		case *mail.InlineHeader:
+			contentType, _, _ := h.ContentType()
+			data, err := io.ReadAll(io.LimitReader(part.Body, 1<<20))
+			if err != nil {
+				continue
+			}
+			switch contentType {
+			case "text/plain":
+				if em.Body == "" {
+					em.Body = string(data)
+				}
+			case "text/html":
+				if htmlBody == "" {
+					htmlBody = string(data)
+				}
+			}
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			if filename == "" {
+				filename = "attachment"
+			}
+			path, ok := c.saveAttachment(filename, part.Body)
+			if ok {
+				em.Attachments = append(em.Attachments, path)
+			} else {
+				em.Skipped = append(em.Skipped, filename)
+			}
+		}
+	}
+
+	if em.Body == "" && htmlBody != "" {
+		em.Body = htmlToText(htmlBody)
+	}
+	return em, nil
+}
+
+func (c *EmailChannel) saveAttachment(filename string, r io.Reader) (string, bool) {
+	limit := c.config.MaxAttachmentBytes
+	if limit <= 0 {
+		return "", false
+	}
+
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		return "", false
+	}
+	path := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+utils.SanitizeFilename(filename))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", false
+	}
+	written, err := io.Copy(f, io.LimitReader(r, limit+1))
+	f.Close()
+	if err != nil || written > limit {
+		os.Remove(path)
+		logger.DebugCF("email", "Attachment skipped", map[string]any{
+			"filename": filename,
+			"limit":    limit,
+		})
+		return "", false
+	}
+	return path, true
+}
+
+func (c *EmailChannel) buildReply(to, subject, inReplyTo string, references []string, body string) ([]byte, string, error) {
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Name: c.config.FromName, Address: c.config.Address}})
+	h.SetAddressList("To", []*mail.Address{{Address: to}})
+	h.SetSubject(subject)
+	h.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+
+	domain := "picoclaw.local"
+	if at := strings.LastIndex(c.config.Address, "@"); at >= 0 {
+		domain = c.config.Address[at+1:]
+	}
+	if err := h.GenerateMessageIDWithHostname(domain); err != nil {
+		return nil, "", err
+	}
+	messageID, _ := h.MessageID()
+
+	if inReplyTo != "" {
+		h.SetMsgIDList("In-Reply-To", []string{inReplyTo})
+	}
+	if len(references) > 0 {
+		h.SetMsgIDList("References", references)
+	}
+
+	var buf bytes.Buffer
+	w, err := mail.CreateSingleInlineWriter(&buf, h)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create message: %w", err)
+	}
+	if _, err := io.WriteString(w, body); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), messageID, nil
+}
+
+func (c *EmailChannel) sendSMTP(to string, data []byte) error {
+	addr := net.JoinHostPort(c.config.SMTPHost, strconv.Itoa(c.config.SMTPPort))
+	username := c.config.SMTPUsername
+	if username == "" {
+		username = c.config.Username
+	}
+	password := c.config.SMTPPassword
+	if password == "" {
+		password = c.config.Password
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, c.config.SMTPHost)
+	}
+
+	// Port 465 uses implicit TLS; other ports negotiate STARTTLS via SendMail.
+	if c.config.SMTPPort != 465 {
+		return smtp.SendMail(addr, auth, c.config.Address, []string{to}, data)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: c.config.SMTPHost})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.config.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (c *EmailChannel) connectIMAP() (*imapclient.Client, error) {
+	addr := net.JoinHostPort(c.config.IMAPHost, strconv.Itoa(c.config.IMAPPort))
+	client, err := imapclient.DialTLS(addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+	if err := client.Login(c.config.Username, c.config.Password); err != nil {
+		client.Logout()
+		return nil, fmt.Errorf("IMAP login failed: %w", err)
+	}
+	return client, nil
+}
+
+func (c *EmailChannel) mailbox() string {
+	if c.config.Mailbox == "" {
+		return "INBOX"
+	}
+	return c.config.Mailbox
+}
+
+// parseEmailChatID splits "<address>/<root Message-ID>" into its parts.
+func parseEmailChatID(chatID string) (address, rootID string) {
+	address, rootID, _ = strings.Cut(chatID, "/")
+	if !strings.Contains(address, "@") {
+		return "", ""
+	}
+	return address, rootID
+}
+
+// emailThreadRoot returns the Message-ID that identifies the thread a
+// message belongs to: the first reference, the replied-to message, or the
+// message itself when it starts a new thread.
+func emailThreadRoot(em *emailMessage) string {
+	if len(em.References) > 0 {
+		return em.References[0]
+	}
+	if len(em.InReplyTo) > 0 {
+		return em.InReplyTo[0]
+	}
+	return em.MessageID
+}
+
+func replySubject(subject string) string {
+	if subject == "" {
+		return "Re: (no subject)"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+var emailAttributionLine = regexp.MustCompile(`(?i)^on .+ wrote:\s*$`)
+
+// stripQuotedReply removes the quoted history that mail clients append to
+// replies so the agent only sees the new text.
+func stripQuotedReply(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	var kept []string
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if emailAttributionLine.MatchString(trimmed) ||
+			strings.HasPrefix(trimmed, "-----Original Message-----") {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+var (
+	htmlTagPattern   = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>`)
+)
+
+// htmlToText is a crude fallback for HTML-only mail.
+func htmlToText(html string) string {
+	text := htmlBreakPattern.ReplaceAllString(html, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	replacer := strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'")
+	return strings.TrimSpace(replacer.Replace(text))
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// authResultsPass reports whether one of the Authentication-Results
+// headers (RFC 8601) added by a trusted server has a passing DMARC, DKIM or
+// SPF result for the domain of from. The receiving server must strip such
+// headers claiming its authserv-id from incoming mail, as RFC 8601 asks.
+func authResultsPass(headers, trusted []string, from string) bool {
+	at := strings.LastIndex(from, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(from[at+1:])
+	for _, header := range headers {
+		parts := strings.Split(stripHeaderComments(header), ";")
+		fields := strings.Fields(parts[0])
+		if len(fields) == 0 || !containsFold(trusted, fields[0]) {
+			continue
+		}
+		for _, part := range parts[1:] {
+			method, result, props := parseAuthResult(part)
+			if result != "pass" {
+				continue
+			}
+			var d string
+			switch method {
+			case "dmarc":
+				d = props["header.from"]
+			case "dkim":
+				if d = props["header.d"]; d == "" {
+					d = props["header.i"]
+				}
+			case "spf":
+				d = props["smtp.mailfrom"]
+			}
+			if i := strings.LastIndex(d, "@"); i >= 0 {
+				d = d[i+1:]
+			}
+			if d != "" && (domain == d || strings.HasSuffix(domain, "."+d)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseAuthResult splits one "method=result ptype.property=value ..."
+// resinfo of an Authentication-Results header, lower-casing everything.
+func parseAuthResult(s string) (method, result string, props map[string]string) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return "", "", nil
+	}
+	method, result, _ = strings.Cut(fields[0], "=")
+	method, _, _ = strings.Cut(method, "/")
+	props = make(map[string]string)
+	for _, f := range fields[1:] {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			props[k] = strings.Trim(v, `"`)
+		}
+	}
+	return method, result, props
+}
+
+// stripHeaderComments removes the parenthesized comments of a header value.
+func stripHeaderComments(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestEmailChannel(t *testing.T, allow ...string) (*EmailChannel, *bus.MessageBus) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	ch, err := NewEmailChannel(config.EmailConfig{
+		Address:            "bot@example.com",
+		IMAPHost:           "imap.example.com",
+		SMTPHost:           "smtp.example.com",
+		MaxAttachmentBytes: 16,
+		AllowFrom:          allow,
+		TrustedAuthservIDs: []string{"mx.example.com"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewEmailChannel() error = %v", err)
+	}
+	return ch, msgBus
+}
+
+const testEmailReply = "Authentication-Results: mx.example.com;\r\n" +
+	" dkim=pass (2048-bit key) header.d=example.com header.s=sel;\r\n" +
+	" spf=fail smtp.mailfrom=example.com\r\n" +
+	"From: Alice <Alice@Example.com>\r\n" +
+	"To: bot@example.com\r\n" +
+	"Subject: Re: Plans\r\n" +
+	"Message-ID: <m2@example.com>\r\n" +
+	"In-Reply-To: <m1@example.com>\r\n" +
+	"References: <root@example.com> <m1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=XYZ\r\n" +
+	"\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Sounds good.\r\n" +
+	"\r\n" +
+	"On Mon, Jan 1, 2026 at 10:00 Bot <bot@example.com> wrote:\r\n" +
+	"> earlier text\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"small.txt\"\r\n" +
+	"\r\n" +
+	"tiny\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment; filename=\"big.bin\"\r\n" +
+	"\r\n" +
+	"this attachment is larger than the limit\r\n" +
+	"--XYZ--\r\n"
+
+func TestEmailChannel_ParseMessage(t *testing.T) {
+	ch, _ := newTestEmailChannel(t)
+
+	em, err := ch.parseMessage(strings.NewReader(testEmailReply))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	defer func() {
+		for _, p := range em.Attachments {
+			os.Remove(p)
+		}
+	}()
+
+	if em.From != "alice@example.com" {
+		t.Errorf("From = %q", em.From)
+	}
+	if !em.Verified {
+		t.Error("Verified = false, want the trusted DKIM pass to count")
+	}
+	if em.MessageID != "m2@example.com" {
+		t.Errorf("MessageID = %q", em.MessageID)
+	}
+	if got := emailThreadRoot(em); got != "root@example.com" {
+		t.Errorf("thread root = %q, want root@example.com", got)
+	}
+	if got := stripQuotedReply(em.Body); got != "Sounds good." {
+		t.Errorf("stripped body = %q", got)
+	}
+	if len(em.Attachments) != 1 || !strings.HasSuffix(em.Attachments[0], "small.txt") {
+		t.Errorf("attachments = %v", em.Attachments)
+	}
+	if len(em.Skipped) != 1 || em.Skipped[0] != "big.bin" {
+		t.Errorf("skipped = %v", em.Skipped)
+	}
+}
+
+func TestEmailChannel_HandleEmailThreads(t *testing.T) {
+	ch, msgBus := newTestEmailChannel(t, "alice@example.com")
+
+	ch.handleEmail(&emailMessage{From: "mallory@example.com", Verified: true, MessageID: "x@example.com", Body: "hi"})
+	ch.handleEmail(&emailMessage{From: "alice@example.com", MessageID: "forged@example.com", Body: "forged"})
+	ch.handleEmail(&emailMessage{
+		From:       "alice@example.com",
+		Verified:   true,
+		Subject:    "Re: Plans",
+		MessageID:  "m2@example.com",
+		References: []string{"root@example.com"},
+		Body:       "Sounds good.",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.SenderID != "alice@example.com" || msg.Content == "forged" {
+		t.Fatalf("unexpected message from %q: %q (allowlist or authentication not applied?)", msg.SenderID, msg.Content)
+	}
+	if msg.ChatID != "alice@example.com/root@example.com" {
+		t.Errorf("ChatID = %q", msg.ChatID)
+	}
+	if msg.Metadata["peer_kind"] != "thread" || msg.Metadata["peer_id"] != "root@example.com" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+
+	// The reply must continue the thread.
+	thread := ch.threads["root@example.com"]
+	data, messageID, err := ch.buildReply("alice@example.com", replySubject(thread.Subject), thread.LastID, thread.References, "Great")
+	if err != nil {
+		t.Fatalf("buildReply() error = %v", err)
+	}
+	raw := string(data)
+	for _, want := range []string{
+		"Subject: Re: Plans",
+		"In-Reply-To: <m2@example.com>",
+		"References: <root@example.com> <m2@example.com>",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("reply missing %q:\n%s", want, raw)
+		}
+	}
+	if !strings.HasSuffix(messageID, "@example.com") {
+		t.Errorf("messageID = %q, want sender domain", messageID)
+	}
+}
+
+func TestAuthResultsPass(t *testing.T) {
+	trusted := []string{"mx.example.com"}
+	tests := []struct {
+		name   string
+		header string
+		from   string
+		want   bool
+	}{
+		{"dkim pass", "mx.example.com; dkim=pass header.d=example.com", "alice@example.com", true},
+		{"dkim parent domain", "mx.example.com; dkim=pass header.d=example.com", "alice@mail.example.com", true},
+		{"dkim other domain", "mx.example.com; dkim=pass header.d=evil.test", "alice@example.com", false},
+		{"dkim child domain", "mx.example.com; dkim=pass header.d=mail.example.com", "alice@example.com", false},
+		{"spf pass", "mx.example.com 1; spf=pass smtp.mailfrom=alice@example.com", "alice@example.com", true},
+		{"dmarc pass", "MX.example.com; dmarc=pass (p=reject) header.from=example.com", "alice@example.com", true},
+		{"failing results", "mx.example.com; dkim=fail header.d=example.com; spf=softfail smtp.mailfrom=example.com", "alice@example.com", false},
+		{"untrusted server", "mx.evil.test; dkim=pass header.d=example.com", "alice@example.com", false},
+		{"comment hides nothing", "mx.example.com; dkim=none (pass header.d=example.com)", "alice@example.com", false},
+		{"no results", "mx.example.com; none", "alice@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authResultsPass([]string{tt.header}, trusted, tt.from); got != tt.want {
+				t.Errorf("authResultsPass(%q, %q) = %v, want %v", tt.header, tt.from, got, tt.want)
+			}
+		})
+	}
+	if authResultsPass(nil, trusted, "alice@example.com") {
+		t.Error("mail without Authentication-Results must not pass")
+	}
+}
+
+func TestNewEmailChannel_RequiresTrustedAuthservIDs(t *testing.T) {
+	_, err := NewEmailChannel(config.EmailConfig{
+		Address:  "bot@example.com",
+		IMAPHost: "imap.example.com",
+		SMTPHost: "smtp.example.com",
+	}, bus.NewMessageBus())
+	if err == nil {
+		t.Fatal("expected an error without trusted_authserv_ids")
+	}
+}
+
+func TestParseEmailChatID(t *testing.T) {
+	addr, root := parseEmailChatID("alice@example.com/root@example.com")
+	if addr != "alice@example.com" || root != "root@example.com" {
+		t.Errorf("got (%q, %q)", addr, root)
+	}
+	if addr, _ := parseEmailChatID("not-an-address"); addr != "" {
+		t.Errorf("expected empty address, got %q", addr)
+	}
+}
+
+func TestReplySubject(t *testing.T) {
+	tests := map[string]string{
+		"":          "Re: (no subject)",
+		"Plans":     "Re: Plans",
+		"RE: Plans": "RE: Plans",
+	}
+	for in, want := range tests {
+		if got := replySubject(in); got != want {
+			t.Errorf("replySubject(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
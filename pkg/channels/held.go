@@ -0,0 +1,70 @@
+package channels
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// heldOutbound names the replies the gateway had not sent when it
+// stopped, see state.Hold.
+const heldOutbound = "outbound"
+
+// Flush waits until the replies on the bus are sent, or ctx ends.
+func (m *Manager) Flush(ctx context.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	// Twice in a row, as a message is briefly in neither count while it
+	// is taken off the bus.
+	for idle := 0; idle < 2; {
+		if m.bus.PendingOutbound() == 0 && m.sending.Load() == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HoldUnsent keeps the replies still on the bus for the next start, which
+// sends them with ResumeHeld. Call it after StopAll.
+func (m *Manager) HoldUnsent() {
+	msgs := m.bus.TakeOutbound()
+	if len(msgs) == 0 {
+		return
+	}
+	if err := state.Hold(m.config.WorkspacePath(), heldOutbound, msgs); err != nil {
+		logger.ErrorCF("channels", "Failed to keep unsent messages for the next start", map[string]any{
+			"messages": len(msgs),
+			"error":    err.Error(),
+		})
+		return
+	}
+	logger.InfoCF("channels", "Kept unsent messages for the next start", map[string]any{"messages": len(msgs)})
+}
+
+// ResumeHeld sends the replies kept when the gateway last stopped. It
+// returns how many there were.
+func (m *Manager) ResumeHeld() int {
+	msgs, err := state.TakeHeld[bus.OutboundMessage](m.config.WorkspacePath(), heldOutbound)
+	if err != nil {
+		logger.ErrorCF("channels", "Failed to read the messages kept at the last stop", map[string]any{"error": err.Error()})
+		return 0
+	}
+	if len(msgs) > 0 {
+		logger.InfoCF("channels", "Sending the messages kept at the last stop", map[string]any{"messages": len(msgs)})
+		go func() {
+			for _, msg := range msgs {
+				m.bus.PublishOutbound(msg)
+			}
+		}()
+	}
+	return len(msgs)
+}
@@ -10,14 +10,16 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/handoff"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -104,7 +106,7 @@ func (c *LINEChannel) Start(ctx context.Context) error {
 			"addr": addr,
 			"path": path,
 		})
-		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := handoff.ListenAndServe(c.httpServer); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("line", "Webhook server error", map[string]any{
 				"error": err.Error(),
 			})
@@ -255,6 +257,7 @@ type lineMessage struct {
 	ContentProvider struct {
 		Type string `json:"type"`
 	} `json:"contentProvider"`
+	FileName string `json:"fileName"`
 }
 
 type lineMentionee struct {
@@ -306,19 +309,7 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	}
 
 	var content string
-	var mediaPaths []string
-	localFiles := []string{}
-
-	defer func() {
-		for _, file := range localFiles {
-			if err := os.Remove(file); err != nil {
-				logger.DebugCF("line", "Failed to cleanup temp file", map[string]any{
-					"file":  file,
-					"error": err.Error(),
-				})
-			}
-		}
-	}()
+	var attachments []bus.Attachment
 
 	switch msg.Type {
 	case "text":
@@ -328,27 +319,20 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 			content = c.stripBotMention(content, msg)
 		}
 	case "image":
-		localPath := c.downloadContent(msg.ID, "image.jpg")
-		if localPath != "" {
-			localFiles = append(localFiles, localPath)
-			mediaPaths = append(mediaPaths, localPath)
-			content = "[image]"
-		}
+		attachments = append(attachments, c.lineAttachment(msg.ID, "image.jpg"))
+		content = "[image]"
 	case "audio":
-		localPath := c.downloadContent(msg.ID, "audio.m4a")
-		if localPath != "" {
-			localFiles = append(localFiles, localPath)
-			mediaPaths = append(mediaPaths, localPath)
-			content = "[audio]"
-		}
+		attachments = append(attachments, c.lineAttachment(msg.ID, "audio.m4a"))
+		content = "[audio]"
 	case "video":
-		localPath := c.downloadContent(msg.ID, "video.mp4")
-		if localPath != "" {
-			localFiles = append(localFiles, localPath)
-			mediaPaths = append(mediaPaths, localPath)
-			content = "[video]"
-		}
+		attachments = append(attachments, c.lineAttachment(msg.ID, "video.mp4"))
+		content = "[video]"
 	case "file":
+		name := msg.FileName
+		if name == "" {
+			name = "file"
+		}
+		attachments = append(attachments, c.lineAttachment(msg.ID, name))
 		content = "[file]"
 	case "sticker":
 		content = "[sticker]"
@@ -385,7 +369,7 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	// Show typing/loading indicator (requires user ID, not group ID)
 	c.sendLoading(senderID)
 
-	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+	c.HandleMessageWithAttachments(senderID, chatID, content, attachments, metadata)
 }
 
 // isBotMentioned checks if the bot is mentioned in the message.
@@ -489,11 +473,18 @@ func (c *LINEChannel) resolveChatID(source lineSource) string {
 
 // Send sends a message to LINE. It first tries the Reply API (free)
 // using a cached reply token, then falls back to the Push API.
+// Capabilities reports plain text, as LINE shows Markdown literally.
+func (c *LINEChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Plain}
+}
+
 func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
 		return fmt.Errorf("line channel not running")
 	}
 
+	content := format.Format(msg.Content, c.Capabilities().Markdown)
+
 	// Load and consume quote token for this chat
 	var quoteToken string
 	if qt, ok := c.quoteTokens.LoadAndDelete(msg.ChatID); ok {
@@ -504,7 +495,7 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if entry, ok := c.replyTokens.LoadAndDelete(msg.ChatID); ok {
 		tokenEntry := entry.(replyTokenEntry)
 		if time.Since(tokenEntry.timestamp) < lineReplyTokenMaxAge {
-			if err := c.sendReply(ctx, tokenEntry.token, msg.Content, quoteToken); err == nil {
+			if err := c.sendReply(ctx, tokenEntry.token, content, quoteToken); err == nil {
 				logger.DebugCF("line", "Message sent via Reply API", map[string]any{
 					"chat_id": msg.ChatID,
 					"quoted":  quoteToken != "",
@@ -516,7 +507,7 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	}
 
 	// Fall back to Push API
-	return c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken)
+	return c.sendPush(ctx, msg.ChatID, content, quoteToken)
 }
 
 // buildTextMessage creates a text message object, optionally with quoteToken.
@@ -594,13 +585,10 @@ func (c *LINEChannel) callAPI(ctx context.Context, endpoint string, payload any)
 	return nil
 }
 
-// downloadContent downloads media content from the LINE API.
-func (c *LINEChannel) downloadContent(messageID, filename string) string {
+// lineAttachment refers to message content hosted by the LINE API.
+func (c *LINEChannel) lineAttachment(messageID, filename string) bus.Attachment {
 	url := fmt.Sprintf(lineContentEndpoint, messageID)
-	return utils.DownloadFile(url, filename, utils.DownloadOptions{
-		LoggerPrefix: "line",
-		ExtraHeaders: map[string]string{
-			"Authorization": "Bearer " + c.config.ChannelAccessToken,
-		},
+	return media.FromURL(url, filename, "", map[string]string{
+		"Authorization": "Bearer " + c.config.ChannelAccessToken,
 	})
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/handoff"
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
@@ -41,7 +42,7 @@ func (c *MaixCamChannel) Start(ctx context.Context) error {
 	logger.InfoC("maixcam", "Starting MaixCam channel server")
 
 	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
-	listener, err := net.Listen("tcp", addr)
+	listener, err := handoff.Listen(addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
@@ -8,205 +8,542 @@ package channels
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/events"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type Manager struct {
 	channels     map[string]Channel
 	bus          *bus.MessageBus
 	config       *config.Config
+	media        *media.Store
+	hooks        []OutboundHook
+	supervisor   *supervisor
+	outbox       *outbox
+	dnd          DoNotDisturb // nil when off
+	events       *events.Bus
+	unsubscribe  func() // of the run event log, see SetEvents
 	dispatchTask *asyncTask
+	sending      atomic.Int32 // messages taken off the bus and not yet sent
 	mu           sync.RWMutex
 }
 
+// OutboundHook inspects or rewrites a message before it is delivered.
+// Returning an error blocks the message.
+type OutboundHook func(ctx context.Context, msg *bus.OutboundMessage) error
+
+// DoNotDisturb holds back proactive messages while the user is busy.
+type DoNotDisturb interface {
+	// Hold returns until when msg waits, or drop to not send it at all; a
+	// zero time and false let it through. reason says why it is held.
+	Hold(msg bus.OutboundMessage, now time.Time) (until time.Time, drop bool, reason string)
+}
+
+// mediaChannel is implemented by channels embedding BaseChannel.
+type mediaChannel interface {
+	SetMediaStore(store *media.Store)
+}
+
+// accountChannel is implemented by channels embedding BaseChannel.
+type accountChannel interface {
+	Channel
+	SetAccount(account string)
+}
+
 type asyncTask struct {
 	cancel context.CancelFunc
 }
 
 func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error) {
+	// Attachments live in the workspace by default so file tools can open
+	// them when restrict_to_workspace is on.
+	attachments := cfg.Channels.Attachments
+	mediaDir := attachments.MediaDir()
+	if mediaDir == "" {
+		mediaDir = filepath.Join(cfg.WorkspacePath(), "attachments")
+	}
 	m := &Manager{
 		channels: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
+		media: media.NewStore(
+			mediaDir,
+			int64(attachments.MaxSizeMB)<<20,
+			time.Duration(attachments.RetentionMinutes)*time.Minute,
+		),
 	}
 
+	m.events = events.New()
+	runEvents := state.NewEventLog(cfg.WorkspacePath())
+	m.unsubscribe = events.Subscribe(m.events, events.RunEvent, func(ev state.RunEvent) {
+		if err := runEvents.Append(ev); err != nil {
+			logger.WarnCF("channels", "Failed to record run event", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	})
+	if cfg.Gateway.Supervisor.Enabled {
+		m.supervisor = newSupervisor(m, cfg.Gateway.Supervisor)
+	}
+	m.outbox = newOutbox(m, cfg.Channels.Retry, cfg.WorkspacePath())
+
 	if err := m.initChannels(); err != nil {
 		return nil, err
 	}
+	for _, channel := range m.channels {
+		if mc, ok := channel.(mediaChannel); ok {
+			mc.SetMediaStore(m.media)
+		}
+	}
 
 	return m, nil
 }
 
+// MediaStore returns the store all channels save inbound attachments to.
+func (m *Manager) MediaStore() *media.Store {
+	return m.media
+}
+
+// AddAttachmentHook registers a hook that sees every inbound attachment
+// before the agent does.
+func (m *Manager) AddAttachmentHook(hook media.Hook) {
+	m.media.AddHook(hook)
+}
+
+// AddOutboundHook registers a hook that runs on every outgoing message,
+// whether it is a reply, a message tool call or a cross-channel send.
+func (m *Manager) AddOutboundHook(hook OutboundHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// HookCounts returns how many outbound and attachment hooks are
+// registered.
+func (m *Manager) HookCounts() (outbound, attachment int) {
+	m.mu.RLock()
+	outbound = len(m.hooks)
+	m.mu.RUnlock()
+	return outbound, m.media.HookCount()
+}
+
+// allowListChannel is implemented by channels embedding BaseChannel.
+type allowListChannel interface {
+	SetAllowList(allowList []string) error
+}
+
+// SetAllowLists gives the running channels the allowlists cfg configures
+// for them, so a reloaded config takes effect without reconnecting.
+func (m *Manager) SetAllowLists(cfg *config.Config) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for name, channel := range m.channels {
+		ac, ok := channel.(allowListChannel)
+		if !ok {
+			continue
+		}
+		channelType, account := SplitAccount(name)
+		channels := cfg.Channels
+		if account != "" {
+			if channels, ok = cfg.Channels.Accounts[account]; !ok {
+				continue
+			}
+		}
+		allowFrom, ok := channels.AllowFrom(channelType)
+		if !ok {
+			continue
+		}
+		if err := ac.SetAllowList(allowFrom); err != nil {
+			logger.WarnCF("channels", "Keeping the previous allowlist", map[string]any{
+				"channel": name,
+				"error":   err.Error(),
+			})
+		}
+	}
+}
+
 func (m *Manager) initChannels() error {
 	logger.InfoC("channels", "Initializing channel manager")
 
-	if m.config.Channels.Telegram.Enabled && m.config.Channels.Telegram.Token != "" {
+	for name, channel := range m.newChannels(m.config) {
+		m.channels[name] = channel
+	}
+
+	for account, accountChannels := range m.config.Channels.Accounts {
+		// Shared settings always come from the top-level channels block.
+		accountChannels.Attachments = m.config.Channels.Attachments
+		accountChannels.Presence = m.config.Channels.Presence
+		accountChannels.Accounts = nil
+		cfg := *m.config
+		cfg.Channels = accountChannels
+
+		for name, channel := range m.newChannels(&cfg) {
+			ac, ok := channel.(accountChannel)
+			if !ok {
+				logger.WarnCF("channels", "Channel does not support accounts", map[string]any{
+					"channel": name,
+					"account": account,
+				})
+				continue
+			}
+			ac.SetAccount(account)
+			m.channels[ac.Name()] = channel
+			logger.InfoCF("channels", "Account channel enabled", map[string]any{
+				"channel": ac.Name(),
+			})
+		}
+	}
+
+	logger.InfoCF("channels", "Channel initialization completed", map[string]any{
+		"enabled_channels": len(m.channels),
+	})
+
+	return nil
+}
+
+// newChannels creates the channels enabled in cfg, keyed by channel type.
+func (m *Manager) newChannels(cfg *config.Config) map[string]Channel {
+	channels := make(map[string]Channel)
+
+	if cfg.Channels.Telegram.Enabled && cfg.Channels.Telegram.Token != "" {
 		logger.DebugC("channels", "Attempting to initialize Telegram channel")
-		telegram, err := NewTelegramChannel(m.config, m.bus)
+		telegram, err := NewTelegramChannel(cfg, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize Telegram channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["telegram"] = telegram
+			channels["telegram"] = telegram
 			logger.InfoC("channels", "Telegram channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.WhatsApp.Enabled && m.config.Channels.WhatsApp.BridgeURL != "" {
+	if cfg.Channels.WhatsApp.Enabled && cfg.Channels.WhatsApp.UseNative {
+		logger.DebugC("channels", "Attempting to initialize native WhatsApp channel")
+		whatsapp, err := NewWhatsAppNativeChannel(cfg.Channels.WhatsApp, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize native WhatsApp channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["whatsapp"] = whatsapp
+			logger.InfoC("channels", "Native WhatsApp channel enabled successfully")
+		}
+	} else if cfg.Channels.WhatsApp.Enabled && cfg.Channels.WhatsApp.BridgeURL != "" {
 		logger.DebugC("channels", "Attempting to initialize WhatsApp channel")
-		whatsapp, err := NewWhatsAppChannel(m.config.Channels.WhatsApp, m.bus)
+		whatsapp, err := NewWhatsAppChannel(cfg.Channels.WhatsApp, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize WhatsApp channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["whatsapp"] = whatsapp
+			channels["whatsapp"] = whatsapp
 			logger.InfoC("channels", "WhatsApp channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.Feishu.Enabled {
+	if cfg.Channels.Feishu.Enabled {
 		logger.DebugC("channels", "Attempting to initialize Feishu channel")
-		feishu, err := NewFeishuChannel(m.config.Channels.Feishu, m.bus)
+		feishu, err := NewFeishuChannel(cfg.Channels.Feishu, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize Feishu channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["feishu"] = feishu
+			channels["feishu"] = feishu
 			logger.InfoC("channels", "Feishu channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.Discord.Enabled && m.config.Channels.Discord.Token != "" {
+	if cfg.Channels.Discord.Enabled && cfg.Channels.Discord.Token != "" {
 		logger.DebugC("channels", "Attempting to initialize Discord channel")
-		discord, err := NewDiscordChannel(m.config.Channels.Discord, m.bus)
+		discord, err := NewDiscordChannel(cfg.Channels.Discord, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize Discord channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["discord"] = discord
+			channels["discord"] = discord
 			logger.InfoC("channels", "Discord channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.MaixCam.Enabled {
+	if cfg.Channels.MaixCam.Enabled {
 		logger.DebugC("channels", "Attempting to initialize MaixCam channel")
-		maixcam, err := NewMaixCamChannel(m.config.Channels.MaixCam, m.bus)
+		maixcam, err := NewMaixCamChannel(cfg.Channels.MaixCam, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize MaixCam channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["maixcam"] = maixcam
+			channels["maixcam"] = maixcam
 			logger.InfoC("channels", "MaixCam channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.QQ.Enabled {
+	if cfg.Channels.QQ.Enabled {
 		logger.DebugC("channels", "Attempting to initialize QQ channel")
-		qq, err := NewQQChannel(m.config.Channels.QQ, m.bus)
+		qq, err := NewQQChannel(cfg.Channels.QQ, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize QQ channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["qq"] = qq
+			channels["qq"] = qq
 			logger.InfoC("channels", "QQ channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.DingTalk.Enabled && m.config.Channels.DingTalk.ClientID != "" {
+	if cfg.Channels.DingTalk.Enabled && cfg.Channels.DingTalk.ClientID != "" {
 		logger.DebugC("channels", "Attempting to initialize DingTalk channel")
-		dingtalk, err := NewDingTalkChannel(m.config.Channels.DingTalk, m.bus)
+		dingtalk, err := NewDingTalkChannel(cfg.Channels.DingTalk, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize DingTalk channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["dingtalk"] = dingtalk
+			channels["dingtalk"] = dingtalk
 			logger.InfoC("channels", "DingTalk channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.Slack.Enabled && m.config.Channels.Slack.BotToken != "" {
+	if cfg.Channels.Slack.Enabled && cfg.Channels.Slack.BotToken != "" {
 		logger.DebugC("channels", "Attempting to initialize Slack channel")
-		slackCh, err := NewSlackChannel(m.config.Channels.Slack, m.bus)
+		slackCh, err := NewSlackChannel(cfg.Channels.Slack, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize Slack channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["slack"] = slackCh
+			channels["slack"] = slackCh
 			logger.InfoC("channels", "Slack channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.LINE.Enabled && m.config.Channels.LINE.ChannelAccessToken != "" {
+	if cfg.Channels.LINE.Enabled && cfg.Channels.LINE.ChannelAccessToken != "" {
 		logger.DebugC("channels", "Attempting to initialize LINE channel")
-		line, err := NewLINEChannel(m.config.Channels.LINE, m.bus)
+		line, err := NewLINEChannel(cfg.Channels.LINE, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize LINE channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["line"] = line
+			channels["line"] = line
 			logger.InfoC("channels", "LINE channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.OneBot.Enabled && m.config.Channels.OneBot.WSUrl != "" {
+	if cfg.Channels.OneBot.Enabled && cfg.Channels.OneBot.WSUrl != "" {
 		logger.DebugC("channels", "Attempting to initialize OneBot channel")
-		onebot, err := NewOneBotChannel(m.config.Channels.OneBot, m.bus)
+		onebot, err := NewOneBotChannel(cfg.Channels.OneBot, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize OneBot channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["onebot"] = onebot
+			channels["onebot"] = onebot
 			logger.InfoC("channels", "OneBot channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.WeCom.Enabled && m.config.Channels.WeCom.Token != "" {
+	if cfg.Channels.WeCom.Enabled && cfg.Channels.WeCom.Token != "" {
 		logger.DebugC("channels", "Attempting to initialize WeCom channel")
-		wecom, err := NewWeComBotChannel(m.config.Channels.WeCom, m.bus)
+		wecom, err := NewWeComBotChannel(cfg.Channels.WeCom, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize WeCom channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["wecom"] = wecom
+			channels["wecom"] = wecom
 			logger.InfoC("channels", "WeCom channel enabled successfully")
 		}
 	}
 
-	if m.config.Channels.WeComApp.Enabled && m.config.Channels.WeComApp.CorpID != "" {
+	if cfg.Channels.WeComApp.Enabled && cfg.Channels.WeComApp.CorpID != "" {
 		logger.DebugC("channels", "Attempting to initialize WeCom App channel")
-		wecomApp, err := NewWeComAppChannel(m.config.Channels.WeComApp, m.bus)
+		wecomApp, err := NewWeComAppChannel(cfg.Channels.WeComApp, m.bus)
 		if err != nil {
 			logger.ErrorCF("channels", "Failed to initialize WeCom App channel", map[string]any{
 				"error": err.Error(),
 			})
 		} else {
-			m.channels["wecom_app"] = wecomApp
+			channels["wecom_app"] = wecomApp
 			logger.InfoC("channels", "WeCom App channel enabled successfully")
 		}
 	}
 
-	logger.InfoCF("channels", "Channel initialization completed", map[string]any{
-		"enabled_channels": len(m.channels),
-	})
+	if cfg.Channels.Matrix.Enabled && cfg.Channels.Matrix.AccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Matrix channel")
+		matrix, err := NewMatrixChannel(cfg.Channels.Matrix, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Matrix channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["matrix"] = matrix
+			logger.InfoC("channels", "Matrix channel enabled successfully")
+		}
+	}
 
-	return nil
+	if cfg.Channels.Signal.Enabled && cfg.Channels.Signal.Account != "" {
+		logger.DebugC("channels", "Attempting to initialize Signal channel")
+		signal, err := NewSignalChannel(cfg.Channels.Signal, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Signal channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["signal"] = signal
+			logger.InfoC("channels", "Signal channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.Email.Enabled && cfg.Channels.Email.IMAPHost != "" {
+		logger.DebugC("channels", "Attempting to initialize Email channel")
+		email, err := NewEmailChannel(cfg.Channels.Email, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Email channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["email"] = email
+			logger.InfoC("channels", "Email channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.Webhook.Enabled {
+		logger.DebugC("channels", "Attempting to initialize Webhook API channel")
+		webhook, err := NewWebhookChannel(cfg.Channels.Webhook, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Webhook API channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["webhook"] = webhook
+			logger.InfoC("channels", "Webhook API channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.Web.Enabled {
+		logger.DebugC("channels", "Attempting to initialize Web chat channel")
+		web, err := NewWebChannel(cfg.Channels.Web, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Web chat channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["web"] = web
+			logger.InfoC("channels", "Web chat channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.XMPP.Enabled {
+		logger.DebugC("channels", "Attempting to initialize XMPP channel")
+		xmpp, err := NewXMPPChannel(cfg.Channels.XMPP, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize XMPP channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["xmpp"] = xmpp
+			logger.InfoC("channels", "XMPP channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.Mattermost.Enabled {
+		logger.DebugC("channels", "Attempting to initialize Mattermost channel")
+		mattermost, err := NewMattermostChannel(cfg.Channels.Mattermost, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Mattermost channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["mattermost"] = mattermost
+			logger.InfoC("channels", "Mattermost channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.RocketChat.Enabled {
+		logger.DebugC("channels", "Attempting to initialize Rocket.Chat channel")
+		rocketchat, err := NewRocketChatChannel(cfg.Channels.RocketChat, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Rocket.Chat channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["rocketchat"] = rocketchat
+			logger.InfoC("channels", "Rocket.Chat channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.Voice.Enabled {
+		logger.DebugC("channels", "Attempting to initialize voice channel")
+		voiceChannel, err := NewVoiceChannel(cfg.Channels.Voice, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize voice channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["voice"] = voiceChannel
+			logger.InfoC("channels", "Voice channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.MQTT.Enabled {
+		logger.DebugC("channels", "Attempting to initialize MQTT channel")
+		mqttChannel, err := NewMQTTChannel(cfg.Channels.MQTT, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize MQTT channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["mqtt"] = mqttChannel
+			logger.InfoC("channels", "MQTT channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.Nostr.Enabled {
+		logger.DebugC("channels", "Attempting to initialize Nostr channel")
+		nostrChannel, err := NewNostrChannel(cfg.Channels.Nostr, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Nostr channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["nostr"] = nostrChannel
+			logger.InfoC("channels", "Nostr channel enabled successfully")
+		}
+	}
+
+	if cfg.Channels.SMS.Enabled {
+		logger.DebugC("channels", "Attempting to initialize SMS channel")
+		smsChannel, err := NewSMSChannel(cfg.Channels.SMS, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize SMS channel", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			channels["sms"] = smsChannel
+			logger.InfoC("channels", "SMS channel enabled successfully")
+		}
+	}
+
+	return channels
 }
 
 func (m *Manager) StartAll(ctx context.Context) error {
@@ -224,6 +561,10 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
 	go m.dispatchOutbound(dispatchCtx)
+	if m.supervisor != nil {
+		go m.supervisor.run(dispatchCtx)
+	}
+	go m.outbox.run(dispatchCtx)
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]any{
@@ -281,33 +622,82 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 			if !ok {
 				continue
 			}
+			m.sending.Add(1)
+			m.dispatch(ctx, msg)
+			m.sending.Add(-1)
+		}
+	}
+}
 
-			// Silently skip internal channels
-			if constants.IsInternalChannel(msg.Channel) {
-				continue
-			}
+// dispatch sends a message taken off the bus.
+func (m *Manager) dispatch(ctx context.Context, msg bus.OutboundMessage) {
+	// Silently skip internal channels
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
 
-			m.mu.RLock()
-			channel, exists := m.channels[msg.Channel]
-			m.mu.RUnlock()
+	m.mu.RLock()
+	channel, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
 
-			if !exists {
-				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]any{
-					"channel": msg.Channel,
-				})
-				continue
-			}
+	if !exists {
+		logger.WarnCF("channels", "Unknown channel for outbound message", map[string]any{
+			"channel": msg.Channel,
+		})
+		return
+	}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]any{
-					"channel": msg.Channel,
-					"error":   err.Error(),
-				})
-			}
+	if m.hold(msg) {
+		return
+	}
+
+	if err := m.send(ctx, channel, msg); err != nil {
+		logger.ErrorCF("channels", "Error sending message to channel", map[string]any{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		if m.outbox.cfg.Enabled && !errors.Is(err, ErrBlockedByHook) && ctx.Err() == nil {
+			m.outbox.enqueue(msg, err)
 		}
 	}
 }
 
+// SetDoNotDisturb has dnd hold back proactive messages.
+func (m *Manager) SetDoNotDisturb(dnd DoNotDisturb) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dnd = dnd
+}
+
+// hold defers or drops msg while do-not-disturb asks for it, and reports
+// whether it did. A deferred message waits in the outbox like one
+// scheduled for later.
+func (m *Manager) hold(msg bus.OutboundMessage) bool {
+	m.mu.RLock()
+	dnd := m.dnd
+	m.mu.RUnlock()
+	if dnd == nil || !msg.Proactive {
+		return false
+	}
+	until, drop, reason := dnd.Hold(msg, m.outbox.now())
+	fields := map[string]any{"channel": msg.Channel, "chat_id": msg.ChatID, "reason": reason}
+	switch {
+	case drop:
+		logger.InfoCF("channels", "Do not disturb: message dropped", fields)
+		m.recordEvent(state.RunEvent{
+			Kind: "dnd_suppressed", Source: msg.Channel,
+			Message: fmt.Sprintf("%s (%s): %s", msg.ChatID, reason, utils.Truncate(msg.Content, 80)),
+		})
+		return true
+	case !until.IsZero():
+		d := m.outbox.schedule(msg, until, "dnd: "+reason)
+		fields["until"], fields["id"] = until.Format(time.RFC3339), d.ID
+		logger.InfoCF("channels", "Do not disturb: message deferred", fields)
+		return true
+	}
+	return false
+}
+
 func (m *Manager) GetChannel(name string) (Channel, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -329,6 +719,23 @@ func (m *Manager) GetStatus() map[string]any {
 	return status
 }
 
+// ChannelHealth reports the connection state of every channel, sorted by
+// name. Without the supervisor it only reflects whether each channel is
+// running.
+func (m *Manager) ChannelHealth() []ChannelHealth {
+	if m.supervisor != nil {
+		return m.supervisor.health()
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]ChannelHealth, 0, len(m.channels))
+	for name, channel := range m.channels {
+		out = append(out, ChannelHealth{Name: name, Up: channel.IsRunning()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
 func (m *Manager) GetEnabledChannels() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -343,6 +750,9 @@ func (m *Manager) GetEnabledChannels() []string {
 func (m *Manager) RegisterChannel(name string, channel Channel) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if mc, ok := channel.(mediaChannel); ok {
+		mc.SetMediaStore(m.media)
+	}
 	m.channels[name] = channel
 }
 
@@ -367,5 +777,95 @@ func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, conten
 		Content: content,
 	}
 
-	return channel.Send(ctx, msg)
+	return m.send(ctx, channel, msg)
+}
+
+// recordEvent publishes ev, which the workspace's run events record.
+func (m *Manager) recordEvent(ev state.RunEvent) {
+	events.Publish(m.events, events.RunEvent, ev)
+}
+
+// SetEvents publishes the run events of the channels on b, whose
+// subscribers record them, instead of a bus of the manager's own. It must
+// be called before OnEvent and StartAll.
+func (m *Manager) SetEvents(b *events.Bus) {
+	m.unsubscribe()
+	m.events, m.unsubscribe = b, func() {}
+}
+
+// OnEvent calls fn with the run events of the channels, such as
+// "channel_down" and "channel_up". It must be called before StartAll.
+func (m *Manager) OnEvent(fn func(state.RunEvent)) {
+	events.Subscribe(m.events, events.RunEvent, fn)
+}
+
+// deliver sends msg to the channel it names.
+func (m *Manager) deliver(ctx context.Context, msg bus.OutboundMessage) error {
+	m.mu.RLock()
+	channel, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("channel %s not found", msg.Channel)
+	}
+	return m.send(ctx, channel, msg)
+}
+
+// PendingDeliveries returns the number of messages waiting to be sent
+// again after a failed delivery.
+func (m *Manager) PendingDeliveries() int {
+	return m.outbox.size()
+}
+
+// EraseUndelivered drops the replies to the chats chat matches that wait
+// to be sent again, and removes those given up on from the dead letters.
+// It returns how many of each it removed; messages scheduled for later
+// stay.
+func (m *Manager) EraseUndelivered(chat func(channel, chatID string) bool) (pending, deadLetters int, err error) {
+	return m.outbox.dropUndelivered(chat)
+}
+
+// send runs the outbound hooks and delivers msg and its attachments.
+// Attachments over the size limit, or on channels that cannot upload files,
+// are listed in the text instead, as are buttons on channels without them.
+func (m *Manager) send(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	m.mu.RLock()
+	hooks := m.hooks
+	m.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, &msg); err != nil {
+			return fmt.Errorf("%w: %w", ErrBlockedByHook, err)
+		}
+	}
+
+	caps := channel.Capabilities()
+	if !caps.Buttons {
+		buttonsAsText(&msg)
+	}
+	uploader, canUpload := channel.(AttachmentChannel)
+	canUpload = canUpload && caps.Attachments
+
+	var uploads []bus.Attachment
+	var skipped []string
+	for _, att := range msg.Attachments {
+		if canUpload && m.media.Fetch(ctx, &att) == nil {
+			uploads = append(uploads, att)
+		} else {
+			skipped = append(skipped, fmt.Sprintf("[attachment not sent: %s]", att.Name))
+		}
+	}
+	if len(skipped) > 0 {
+		msg.Content = strings.TrimSpace(msg.Content + "\n" + strings.Join(skipped, "\n"))
+	}
+
+	if msg.Content != "" || len(uploads) == 0 {
+		if err := channel.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	for _, att := range uploads {
+		if err := uploader.SendAttachment(ctx, msg.ChatID, att); err != nil {
+			return fmt.Errorf("send attachment %s: %w", att.Name, err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,550 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const (
+	matrixSyncTimeout    = 30 * time.Second
+	matrixTypingTimeout  = 60 * time.Second
+	matrixMaxMessageSize = 16000
+)
+
+// MatrixChannel talks to a Matrix homeserver through the Client-Server API.
+//
+// Encrypted rooms are supported by pointing Homeserver at an E2EE-aware proxy
+// such as pantalaimon, which decrypts events before they reach the bot and
+// encrypts outgoing messages transparently.
+type MatrixChannel struct {
+	*BaseChannel
+	config      config.MatrixConfig
+	homeserver  string
+	httpClient  *http.Client
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	since       string
+	txnID       atomic.Int64
+	roomsMu     sync.RWMutex
+	roomMembers map[string]int // roomID → joined member count
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join   map[string]matrixJoinedRoom `json:"join"`
+		Invite map[string]json.RawMessage  `json:"invite"`
+	} `json:"rooms"`
+}
+
+type matrixJoinedRoom struct {
+	Summary struct {
+		JoinedMemberCount *int `json:"m.joined_member_count"`
+	} `json:"summary"`
+	Timeline struct {
+		Events []matrixEvent `json:"events"`
+	} `json:"timeline"`
+}
+
+type matrixEvent struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	Content  json.RawMessage `json:"content"`
+	StateKey *string         `json:"state_key,omitempty"`
+}
+
+type matrixMessageContent struct {
+	MsgType  string `json:"msgtype"`
+	Body     string `json:"body"`
+	URL      string `json:"url"`
+	FileName string `json:"filename"`
+	Info     struct {
+		MimeType string `json:"mimetype"`
+	} `json:"info"`
+	RelatesTo *struct {
+		InReplyTo *struct {
+			EventID string `json:"event_id"`
+		} `json:"m.in_reply_to,omitempty"`
+	} `json:"m.relates_to,omitempty"`
+	Mentions *struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions,omitempty"`
+}
+
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" || cfg.UserID == "" {
+		return nil, fmt.Errorf("matrix homeserver, user_id and access_token are required")
+	}
+
+	base := NewBaseChannel("matrix", cfg, messageBus, cfg.AllowFrom)
+
+	return &MatrixChannel{
+		BaseChannel: base,
+		config:      cfg,
+		homeserver:  strings.TrimRight(cfg.Homeserver, "/"),
+		httpClient:  &http.Client{Timeout: matrixSyncTimeout + 15*time.Second},
+		roomMembers: make(map[string]int),
+	}, nil
+}
+
+func (c *MatrixChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	var whoami struct {
+		UserID   string `json:"user_id"`
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("matrix whoami failed: %w", err)
+	}
+	if whoami.UserID != c.config.UserID {
+		return fmt.Errorf("matrix access token belongs to %s, expected %s", whoami.UserID, c.config.UserID)
+	}
+
+	// The initial sync only establishes a position in the timeline so that
+	// history from before startup is not replayed to the agent.
+	initial, err := c.sync(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("matrix initial sync failed: %w", err)
+	}
+	c.since = initial.NextBatch
+	c.updateRooms(initial)
+	c.acceptInvites(ctx, initial)
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.syncLoop()
+
+	c.setRunning(true)
+	logger.InfoCF("matrix", "Matrix channel started", map[string]any{
+		"user_id":   whoami.UserID,
+		"device_id": whoami.DeviceID,
+	})
+	return nil
+}
+
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("matrix", "Matrix channel stopped")
+	return nil
+}
+
+// Capabilities reports Markdown, which Matrix clients render, and typing
+// notifications.
+func (c *MatrixChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Markdown, MaxMessageLength: matrixMaxMessageSize, Typing: true}
+}
+
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix channel not running")
+	}
+
+	roomID := msg.ChatID
+	if roomID == "" {
+		return fmt.Errorf("matrix room ID is empty")
+	}
+
+	c.setTyping(ctx, roomID, false)
+
+	for _, chunk := range utils.SplitMessage(msg.Content, c.Capabilities().MaxMessageLength) {
+		content := map[string]any{
+			"msgtype": "m.text",
+			"body":    chunk,
+		}
+		path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+			url.PathEscape(roomID), c.nextTxnID())
+		if err := c.doJSON(ctx, http.MethodPut, path, content, nil); err != nil {
+			return fmt.Errorf("failed to send matrix message: %w", err)
+		}
+	}
+
+	logger.DebugCF("matrix", "Message sent", map[string]any{
+		"room_id": roomID,
+	})
+	return nil
+}
+
+func (c *MatrixChannel) syncLoop() {
+	backoff := time.Second
+	for {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		resp, err := c.sync(c.ctx, matrixSyncTimeout)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]any{
+				"error":   err.Error(),
+				"backoff": backoff.String(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+
+		c.since = resp.NextBatch
+		c.updateRooms(resp)
+		c.acceptInvites(c.ctx, resp)
+
+		for roomID, room := range resp.Rooms.Join {
+			for _, ev := range room.Timeline.Events {
+				c.handleEvent(roomID, ev)
+			}
+		}
+	}
+}
+
+func (c *MatrixChannel) sync(ctx context.Context, timeout time.Duration) (*matrixSyncResponse, error) {
+	query := url.Values{}
+	query.Set("timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	if c.since != "" {
+		query.Set("since", c.since)
+	} else {
+		// Keep the first response small: we only need the batch token.
+		query.Set("filter", `{"room":{"timeline":{"limit":1}}}`)
+	}
+
+	var resp matrixSyncResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/_matrix/client/v3/sync?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *MatrixChannel) updateRooms(resp *matrixSyncResponse) {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+	for roomID, room := range resp.Rooms.Join {
+		if room.Summary.JoinedMemberCount != nil {
+			c.roomMembers[roomID] = *room.Summary.JoinedMemberCount
+		}
+	}
+}
+
+func (c *MatrixChannel) acceptInvites(ctx context.Context, resp *matrixSyncResponse) {
+	if !c.config.JoinOnInvite {
+		return
+	}
+	for roomID := range resp.Rooms.Invite {
+		path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/join"
+		if err := c.doJSON(ctx, http.MethodPost, path, map[string]any{}, nil); err != nil {
+			logger.WarnCF("matrix", "Failed to join invited room", map[string]any{
+				"room_id": roomID,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		logger.InfoCF("matrix", "Joined room after invite", map[string]any{
+			"room_id": roomID,
+		})
+	}
+}
+
+func (c *MatrixChannel) isDirectRoom(roomID string) bool {
+	c.roomsMu.RLock()
+	defer c.roomsMu.RUnlock()
+	count, ok := c.roomMembers[roomID]
+	return ok && count <= 2
+}
+
+func (c *MatrixChannel) handleEvent(roomID string, ev matrixEvent) {
+	if ev.Sender == c.config.UserID {
+		return
+	}
+
+	if ev.Type == "m.room.encrypted" {
+		logger.WarnCF("matrix", "Received encrypted event; configure an E2EE proxy such as pantalaimon as homeserver", map[string]any{
+			"room_id":  roomID,
+			"event_id": ev.EventID,
+		})
+		return
+	}
+	if ev.Type != "m.room.message" || ev.StateKey != nil {
+		return
+	}
+
+	// check allowlist to avoid downloading attachments for rejected users
+	if !c.IsAllowed(ev.Sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]any{
+			"sender": ev.Sender,
+		})
+		return
+	}
+
+	var msg matrixMessageContent
+	if err := json.Unmarshal(ev.Content, &msg); err != nil {
+		logger.DebugCF("matrix", "Failed to decode message content", map[string]any{
+			"event_id": ev.EventID,
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	isDirect := c.isDirectRoom(roomID)
+	if !isDirect && c.config.MentionOnly && !c.isMentioned(msg) {
+		return
+	}
+
+	content, mediaPaths := c.buildContent(msg)
+	content = stripMatrixReplyFallback(content)
+	if strings.TrimSpace(content) == "" && len(mediaPaths) == 0 {
+		return
+	}
+
+	peerKind := "group"
+	peerID := roomID
+	if isDirect {
+		peerKind = "direct"
+		peerID = ev.Sender
+	}
+
+	metadata := map[string]string{
+		"message_id": ev.EventID,
+		"user_id":    ev.Sender,
+		"room_id":    roomID,
+		"platform":   "matrix",
+		"peer_kind":  peerKind,
+		"peer_id":    peerID,
+	}
+	if msg.RelatesTo != nil && msg.RelatesTo.InReplyTo != nil {
+		metadata["reply_to"] = msg.RelatesTo.InReplyTo.EventID
+	}
+
+	logger.DebugCF("matrix", "Received message", map[string]any{
+		"sender":  ev.Sender,
+		"room_id": roomID,
+		"preview": utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(ev.Sender, roomID, content, mediaPaths, metadata)
+}
+
+func (c *MatrixChannel) buildContent(msg matrixMessageContent) (string, []string) {
+	switch msg.MsgType {
+	case "m.text", "m.notice", "m.emote":
+		return msg.Body, nil
+	case "m.image", "m.audio", "m.video", "m.file":
+	default:
+		return msg.Body, nil
+	}
+
+	name := msg.FileName
+	if name == "" {
+		name = msg.Body
+	}
+
+	localPath := c.downloadMedia(msg.URL, name)
+	if localPath == "" {
+		return fmt.Sprintf("[file: %s (download failed)]", name), nil
+	}
+
+	if msg.MsgType == "m.audio" && c.transcriber != nil && c.transcriber.IsAvailable() {
+		ctx, cancel := context.WithTimeout(c.ctx, transcriptionTimeout)
+		defer cancel()
+		result, err := c.transcriber.Transcribe(ctx, localPath)
+		if err != nil {
+			logger.ErrorCF("matrix", "Voice transcription failed", map[string]any{"error": err.Error()})
+			return fmt.Sprintf("[audio: %s (transcription failed)]", name), []string{localPath}
+		}
+		return fmt.Sprintf("[voice transcription: %s]", result.Text), []string{localPath}
+	}
+
+	kind := strings.TrimPrefix(msg.MsgType, "m.")
+	return fmt.Sprintf("[%s: %s]", kind, name), []string{localPath}
+}
+
+// isMentioned reports whether the message addresses the bot, either through
+// the structured m.mentions field or by its user ID appearing in the body.
+func (c *MatrixChannel) isMentioned(msg matrixMessageContent) bool {
+	if msg.Mentions != nil {
+		for _, id := range msg.Mentions.UserIDs {
+			if id == c.config.UserID {
+				return true
+			}
+		}
+	}
+	return strings.Contains(msg.Body, c.config.UserID)
+}
+
+func (c *MatrixChannel) downloadMedia(mxcURL, filename string) string {
+	server, mediaID, ok := parseMXC(mxcURL)
+	if !ok {
+		logger.DebugCF("matrix", "Invalid media URL", map[string]any{"url": mxcURL})
+		return ""
+	}
+
+	downloadURL := fmt.Sprintf("%s/_matrix/client/v1/media/download/%s/%s",
+		c.homeserver, url.PathEscape(server), url.PathEscape(mediaID))
+
+	att, err := c.FetchAttachment(c.ctx, media.FromURL(downloadURL, filename, "", map[string]string{
+		"Authorization": "Bearer " + c.config.AccessToken,
+	}))
+	if err != nil {
+		logger.ErrorCF("matrix", "Failed to download media", map[string]any{
+			"file":  filename,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	return att.Path
+}
+
+// CheckHealth confirms the homeserver is reachable and the token is valid.
+func (c *MatrixChannel) CheckHealth(ctx context.Context) error {
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("matrix whoami failed: %w", err)
+	}
+	return nil
+}
+
+// StartTyping shows the typing notice in the room until stop is called,
+// renewing it before the server-side timeout runs out.
+func (c *MatrixChannel) StartTyping(ctx context.Context, roomID string) (func(), error) {
+	stop, err := keepTyping(ctx, matrixTypingTimeout/2, func(ctx context.Context) error {
+		c.setTyping(ctx, roomID, true)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		stop()
+		c.setTyping(c.ctx, roomID, false)
+	}, nil
+}
+
+func (c *MatrixChannel) setTyping(ctx context.Context, roomID string, typing bool) {
+	body := map[string]any{"typing": typing}
+	if typing {
+		body["timeout"] = matrixTypingTimeout.Milliseconds()
+	}
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/typing/%s",
+		url.PathEscape(roomID), url.PathEscape(c.config.UserID))
+	if err := c.doJSON(ctx, http.MethodPut, path, body, nil); err != nil {
+		logger.DebugCF("matrix", "Typing notification failed", map[string]any{
+			"room_id": roomID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+func (c *MatrixChannel) nextTxnID() string {
+	return fmt.Sprintf("picoclaw-%d-%d", time.Now().UnixNano(), c.txnID.Add(1))
+}
+
+func (c *MatrixChannel) doJSON(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.homeserver+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.ErrCode != "" {
+			return fmt.Errorf("HTTP %d: %s: %s", resp.StatusCode, apiErr.ErrCode, apiErr.Error)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, utils.Truncate(string(respBody), 200))
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseMXC splits an mxc://server/mediaID URI into its parts.
+func parseMXC(uri string) (server, mediaID string, ok bool) {
+	rest, found := strings.CutPrefix(uri, "mxc://")
+	if !found {
+		return "", "", false
+	}
+	server, mediaID, found = strings.Cut(rest, "/")
+	if !found || server == "" || mediaID == "" || strings.Contains(mediaID, "/") {
+		return "", "", false
+	}
+	return server, mediaID, true
+}
+
+// stripMatrixReplyFallback removes the quoted "> <@user> ..." block that
+// clients prepend to replies, leaving only the new text.
+func stripMatrixReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> <") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n"))
+}
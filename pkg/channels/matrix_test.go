@@ -0,0 +1,173 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParseMXC(t *testing.T) {
+	tests := []struct {
+		uri        string
+		wantServer string
+		wantID     string
+		wantOK     bool
+	}{
+		{"mxc://example.org/abc123", "example.org", "abc123", true},
+		{"mxc://example.org/", "", "", false},
+		{"mxc://example.org/a/b", "", "", false},
+		{"https://example.org/abc", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		server, id, ok := parseMXC(tt.uri)
+		if server != tt.wantServer || id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("parseMXC(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				tt.uri, server, id, ok, tt.wantServer, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestStripMatrixReplyFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"plain", "hello", "hello"},
+		{"quote without fallback", "> just a quote", "> just a quote"},
+		{"reply", "> <@alice:example.org> original\n> more\n\nmy answer", "my answer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripMatrixReplyFallback(tt.body); got != tt.want {
+				t.Errorf("stripMatrixReplyFallback() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestMatrixChannel(t *testing.T, handler http.Handler, cfg config.MatrixConfig) (*MatrixChannel, *bus.MessageBus) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.Homeserver = server.URL
+	if cfg.UserID == "" {
+		cfg.UserID = "@bot:example.org"
+	}
+	cfg.AccessToken = "token"
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMatrixChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewMatrixChannel() error = %v", err)
+	}
+	ch.ctx = context.Background()
+	return ch, msgBus
+}
+
+func TestMatrixChannel_Send(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("missing authorization header")
+		}
+		if strings.Contains(r.URL.Path, "/send/m.room.message/") {
+			data, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies = append(bodies, string(data))
+			mu.Unlock()
+			w.Write([]byte(`{"event_id":"$1"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+
+	ch, _ := newTestMatrixChannel(t, handler, config.MatrixConfig{})
+	ch.setRunning(true)
+
+	err := ch.Send(context.Background(), bus.OutboundMessage{
+		Channel: "matrix",
+		ChatID:  "!room:example.org",
+		Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(bodies))
+	}
+	var content map[string]any
+	if err := json.Unmarshal([]byte(bodies[0]), &content); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if content["msgtype"] != "m.text" || content["body"] != "hello" {
+		t.Errorf("unexpected content: %v", content)
+	}
+}
+
+func TestMatrixChannel_Send_NotRunning(t *testing.T) {
+	ch, _ := newTestMatrixChannel(t, http.NotFoundHandler(), config.MatrixConfig{})
+	err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "!room:example.org", Content: "hi"})
+	if err == nil {
+		t.Fatal("expected error when channel is not running")
+	}
+}
+
+func matrixTextEvent(sender, body string) matrixEvent {
+	content, _ := json.Marshal(map[string]any{"msgtype": "m.text", "body": body})
+	return matrixEvent{Type: "m.room.message", EventID: "$evt", Sender: sender, Content: content}
+}
+
+func TestMatrixChannel_HandleEvent(t *testing.T) {
+	ch, msgBus := newTestMatrixChannel(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}), config.MatrixConfig{MentionOnly: true})
+	ch.roomMembers["!dm:example.org"] = 2
+	ch.roomMembers["!group:example.org"] = 5
+
+	// Own messages are ignored.
+	ch.handleEvent("!dm:example.org", matrixTextEvent("@bot:example.org", "echo"))
+	// Group messages without a mention are ignored in mention-only mode.
+	ch.handleEvent("!group:example.org", matrixTextEvent("@alice:example.org", "chatter"))
+	// Direct messages always pass.
+	ch.handleEvent("!dm:example.org", matrixTextEvent("@alice:example.org", "hi bot"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.Content != "hi bot" || msg.ChatID != "!dm:example.org" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "@alice:example.org" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+
+	ch.handleEvent("!group:example.org", matrixTextEvent("@alice:example.org", "@bot:example.org ping"))
+	msg, ok = msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound group message")
+	}
+	if msg.Metadata["peer_kind"] != "group" || msg.Metadata["peer_id"] != "!group:example.org" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+}
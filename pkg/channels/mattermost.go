@@ -0,0 +1,211 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const mattermostMaxMessageLength = 16000
+
+// NewMattermostChannel creates a Mattermost channel that logs in with a bot
+// account access token and receives posts over the v4 WebSocket API.
+func NewMattermostChannel(cfg config.MattermostConfig, messageBus *bus.MessageBus) (*TeamChatChannel, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("mattermost url and token are required")
+	}
+
+	backend := &mattermostBackend{
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		token:      cfg.Token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	return newTeamChatChannel("mattermost", cfg, messageBus, cfg.AllowFrom, backend, teamChatOptions{
+		channels:      cfg.Channels,
+		mentionOnly:   cfg.MentionOnly,
+		threadReplies: cfg.ThreadReplies,
+	}), nil
+}
+
+type mattermostBackend struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	userID     string
+}
+
+// mattermostEvent is a WebSocket event envelope.
+type mattermostEvent struct {
+	Event string `json:"event"`
+	Data  struct {
+		ChannelType string `json:"channel_type"`
+		ChannelName string `json:"channel_name"`
+		SenderName  string `json:"sender_name"`
+		Post        string `json:"post"`     // JSON-encoded post
+		Mentions    string `json:"mentions"` // JSON-encoded list of user IDs
+	} `json:"data"`
+}
+
+type mattermostPost struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	RootID    string `json:"root_id"`
+	UserID    string `json:"user_id"`
+	Message   string `json:"message"`
+	Type      string `json:"type"`
+}
+
+func (b *mattermostBackend) connect(ctx context.Context) (string, string, error) {
+	var me struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := b.api(ctx, http.MethodGet, "/api/v4/users/me", nil, &me); err != nil {
+		return "", "", err
+	}
+	b.userID = me.ID
+	return me.ID, me.Username, nil
+}
+
+func (b *mattermostBackend) listen(ctx context.Context, handle func(teamChatPost)) error {
+	wsURL, err := url.Parse(b.baseURL + "/api/v4/websocket")
+	if err != nil {
+		return err
+	}
+	if wsURL.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	} else {
+		wsURL.Scheme = "ws"
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+b.token)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL.String(), header)
+	if err != nil {
+		return fmt.Errorf("websocket dial: %w", err)
+	}
+	defer conn.Close()
+
+	// Older servers ignore the header and expect an authentication challenge.
+	if err := conn.WriteJSON(map[string]any{
+		"seq":    1,
+		"action": "authentication_challenge",
+		"data":   map[string]string{"token": b.token},
+	}); err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if post, ok := b.parseEvent(data); ok {
+			handle(post)
+		}
+	}
+}
+
+func (b *mattermostBackend) parseEvent(data []byte) (teamChatPost, bool) {
+	var ev mattermostEvent
+	if err := json.Unmarshal(data, &ev); err != nil || ev.Event != "posted" {
+		return teamChatPost{}, false
+	}
+
+	var post mattermostPost
+	if err := json.Unmarshal([]byte(ev.Data.Post), &post); err != nil {
+		return teamChatPost{}, false
+	}
+	// System messages (joins, header changes, ...) have a type.
+	if post.Type != "" {
+		return teamChatPost{}, false
+	}
+
+	var mentions []string
+	if ev.Data.Mentions != "" {
+		json.Unmarshal([]byte(ev.Data.Mentions), &mentions)
+	}
+
+	return teamChatPost{
+		ID:          post.ID,
+		ChannelID:   post.ChannelID,
+		ChannelName: ev.Data.ChannelName,
+		RootID:      post.RootID,
+		UserID:      post.UserID,
+		Username:    strings.TrimPrefix(ev.Data.SenderName, "@"),
+		Text:        post.Message,
+		Direct:      ev.Data.ChannelType == "D",
+		Mentioned:   slices.Contains(mentions, b.userID),
+	}, true
+}
+
+func (b *mattermostBackend) post(ctx context.Context, channelID, rootID, text string) error {
+	return b.api(ctx, http.MethodPost, "/api/v4/posts", map[string]string{
+		"channel_id": channelID,
+		"root_id":    rootID,
+		"message":    text,
+	}, nil)
+}
+
+func (b *mattermostBackend) typing(ctx context.Context, channelID, rootID string) {
+	b.api(ctx, http.MethodPost, "/api/v4/users/me/typing", map[string]string{
+		"channel_id": channelID,
+		"parent_id":  rootID,
+	}, nil)
+}
+
+func (b *mattermostBackend) maxMessageLength() int {
+	return mattermostMaxMessageLength
+}
+
+func (b *mattermostBackend) api(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
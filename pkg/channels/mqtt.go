@@ -0,0 +1,200 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// MQTTChannel lets sensors and automations trigger the agent. Each topic a
+// message arrives on is its own chat (and session); the subscription pattern
+// that matched is passed as parent peer, so bindings can map a whole topic
+// tree such as "home/sensors/#" to one agent.
+type MQTTChannel struct {
+	*BaseChannel
+	config config.MQTTConfig
+	client mqtt.Client
+	// publish is the outbound hook; it wraps client.Publish.
+	publish func(topic string, qos byte, payload []byte) error
+	// replyTo maps chat IDs (inbound topics) to where replies go.
+	replyTo sync.Map // topic → mqttReplyTarget
+	// published remembers our own messages so a response topic that is also
+	// subscribed doesn't feed replies back to the agent.
+	published sync.Map // topic + "\x00" + payload → struct{}
+}
+
+type mqttReplyTarget struct {
+	topic string
+	qos   byte
+}
+
+// mqttPayload is the optional JSON envelope for inbound messages.
+type mqttPayload struct {
+	Message string `json:"message"`
+	ReplyTo string `json:"reply_to"`
+}
+
+func NewMQTTChannel(cfg config.MQTTConfig, messageBus *bus.MessageBus) (*MQTTChannel, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("mqtt broker is required")
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("mqtt needs at least one topic")
+	}
+	return &MQTTChannel{
+		BaseChannel: NewBaseChannel("mqtt", cfg, messageBus, nil),
+		config:      cfg,
+	}, nil
+}
+
+func (c *MQTTChannel) Start(ctx context.Context) error {
+	logger.InfoCF("mqtt", "Connecting to MQTT broker", map[string]any{
+		"broker": c.config.Broker,
+	})
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.config.Broker).
+		SetClientID(c.config.ClientID).
+		SetUsername(c.config.Username).
+		SetPassword(c.config.Password).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(c.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.WarnCF("mqtt", "Connection lost, reconnecting", map[string]any{
+				"error": err.Error(),
+			})
+		})
+
+	c.client = mqtt.NewClient(opts)
+	token := c.client.Connect()
+	if !token.WaitTimeout(30 * time.Second) {
+		return fmt.Errorf("mqtt connect to %s timed out", c.config.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+
+	c.publish = func(topic string, qos byte, payload []byte) error {
+		token := c.client.Publish(topic, qos, false, payload)
+		if !token.WaitTimeout(30 * time.Second) {
+			return fmt.Errorf("publish to %s timed out", topic)
+		}
+		return token.Error()
+	}
+
+	c.setRunning(true)
+	logger.InfoC("mqtt", "MQTT channel started")
+	return nil
+}
+
+func (c *MQTTChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mqtt", "Stopping MQTT channel")
+	if c.client != nil {
+		c.client.Disconnect(250)
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// subscribe runs on every (re)connect, since sessions are not persisted on
+// the broker.
+func (c *MQTTChannel) subscribe(client mqtt.Client) {
+	for _, t := range c.config.Topics {
+		sub := t
+		token := client.Subscribe(sub.Topic, sub.QoS, func(_ mqtt.Client, m mqtt.Message) {
+			// Retained messages are old state, not new events.
+			if m.Retained() {
+				return
+			}
+			c.handleMessage(sub, m.Topic(), m.Payload())
+		})
+		if token.WaitTimeout(30*time.Second) && token.Error() == nil {
+			logger.InfoCF("mqtt", "Subscribed", map[string]any{"topic": sub.Topic})
+			continue
+		}
+		logger.ErrorCF("mqtt", "Failed to subscribe", map[string]any{
+			"topic": sub.Topic,
+			"error": fmt.Sprint(token.Error()),
+		})
+	}
+}
+
+func (c *MQTTChannel) handleMessage(sub config.MQTTTopicConfig, topic string, payload []byte) {
+	if _, own := c.published.LoadAndDelete(topic + "\x00" + string(payload)); own {
+		return
+	}
+
+	raw := strings.TrimSpace(string(payload))
+	if raw == "" {
+		return
+	}
+
+	content := fmt.Sprintf("Message on MQTT topic %s:\n%s", topic, raw)
+	replyTopic := strings.ReplaceAll(sub.ResponseTopic, "{topic}", topic)
+
+	var envelope mqttPayload
+	if json.Unmarshal(payload, &envelope) == nil {
+		if envelope.Message != "" {
+			content = envelope.Message
+		}
+		if envelope.ReplyTo != "" {
+			replyTopic = envelope.ReplyTo
+		}
+	}
+
+	if replyTopic != "" {
+		c.replyTo.Store(topic, mqttReplyTarget{topic: replyTopic, qos: sub.QoS})
+	} else {
+		c.replyTo.Delete(topic)
+	}
+
+	logger.DebugCF("mqtt", "Received message", map[string]any{
+		"topic":   topic,
+		"preview": utils.Truncate(raw, 50),
+	})
+
+	c.HandleMessage("mqtt:"+topic, topic, content, nil, map[string]string{
+		"peer_kind":        "topic",
+		"peer_id":          topic,
+		"parent_peer_kind": "topic",
+		"parent_peer_id":   sub.Topic,
+		"reply_topic":      replyTopic,
+	})
+}
+
+func (c *MQTTChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("mqtt channel not running")
+	}
+
+	v, ok := c.replyTo.Load(msg.ChatID)
+	if !ok {
+		logger.DebugCF("mqtt", "No response topic, dropping reply", map[string]any{
+			"topic": msg.ChatID,
+		})
+		return nil
+	}
+	target := v.(mqttReplyTarget)
+
+	key := target.topic + "\x00" + msg.Content
+	c.published.Store(key, struct{}{})
+	// Replies to topics we don't subscribe to never come back; forget them.
+	time.AfterFunc(time.Minute, func() { c.published.Delete(key) })
+
+	if err := c.publish(target.topic, target.qos, []byte(msg.Content)); err != nil {
+		c.published.Delete(key)
+		return fmt.Errorf("mqtt publish: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type mqttPublished struct {
+	topic   string
+	qos     byte
+	payload string
+}
+
+func newTestMQTTChannel(t *testing.T) (*MQTTChannel, *bus.MessageBus, *[]mqttPublished) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMQTTChannel(config.MQTTConfig{
+		Broker: "tcp://localhost:1883",
+		Topics: []config.MQTTTopicConfig{{Topic: "home/+/motion", QoS: 1, ResponseTopic: "{topic}/reply"}},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewMQTTChannel() error = %v", err)
+	}
+
+	var sent []mqttPublished
+	ch.publish = func(topic string, qos byte, payload []byte) error {
+		sent = append(sent, mqttPublished{topic, qos, string(payload)})
+		return nil
+	}
+	ch.setRunning(true)
+	return ch, msgBus, &sent
+}
+
+func TestMQTTChannel_HandleMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		topic       string
+		payload     string
+		wantContent string
+		wantReply   string
+	}{
+		{
+			name:        "raw payload",
+			topic:       "home/hall/motion",
+			payload:     `{"occupancy":true}`,
+			wantContent: "Message on MQTT topic home/hall/motion:\n{\"occupancy\":true}",
+			wantReply:   "home/hall/motion/reply",
+		},
+		{
+			name:        "envelope",
+			topic:       "home/garage/motion",
+			payload:     `{"message":"Is the garage door open?","reply_to":"alerts/garage"}`,
+			wantContent: "Is the garage door open?",
+			wantReply:   "alerts/garage",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, msgBus, _ := newTestMQTTChannel(t)
+			ch.handleMessage(ch.config.Topics[0], tt.topic, []byte(tt.payload))
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			msg, ok := msgBus.ConsumeInbound(ctx)
+			if !ok {
+				t.Fatal("expected inbound message")
+			}
+			if msg.ChatID != tt.topic || msg.Content != tt.wantContent {
+				t.Errorf("got chat %q content %q", msg.ChatID, msg.Content)
+			}
+			if msg.Metadata["parent_peer_kind"] != "topic" || msg.Metadata["parent_peer_id"] != "home/+/motion" {
+				t.Errorf("unexpected parent peer: %v", msg.Metadata)
+			}
+			if msg.Metadata["reply_topic"] != tt.wantReply {
+				t.Errorf("reply_topic = %q, want %q", msg.Metadata["reply_topic"], tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestMQTTChannel_SendAndLoopGuard(t *testing.T) {
+	ch, msgBus, sent := newTestMQTTChannel(t)
+	sub := ch.config.Topics[0]
+
+	// Without a prior message there is nowhere to reply.
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "home/attic/motion", Content: "x"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(*sent) != 0 {
+		t.Fatalf("unexpected publish: %v", *sent)
+	}
+
+	ch.handleMessage(sub, "home/hall/motion", []byte("motion detected"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msgBus.ConsumeInbound(ctx)
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "home/hall/motion", Content: "Lights on"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	want := mqttPublished{"home/hall/motion/reply", 1, "Lights on"}
+	if len(*sent) != 1 || (*sent)[0] != want {
+		t.Fatalf("published = %v, want %v", *sent, want)
+	}
+
+	// Our own reply echoed back by the broker is ignored.
+	ch.handleMessage(sub, "home/hall/motion/reply", []byte("Lights on"))
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel2()
+	if msg, ok := msgBus.ConsumeInbound(ctx2); ok {
+		t.Errorf("echoed reply was processed: %+v", msg)
+	}
+}
@@ -0,0 +1,399 @@
+package channels
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	nostrKindDM       = 4
+	nostrSubscription = "picoclaw-dm"
+	// nostrSeenLimit bounds the event IDs kept to drop the copies of one DM
+	// that every relay delivers.
+	nostrSeenLimit = 1000
+)
+
+// NostrChannel receives NIP-04 encrypted direct messages addressed to the
+// bot's key on every configured relay and answers the same way. Chats are
+// keyed by the sender's hex public key.
+type NostrChannel struct {
+	*BaseChannel
+	config config.NostrConfig
+	key    *btcec.PrivateKey
+	pubKey string // hex, x-only
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	conns map[string]*nostrRelay // connected relays by URL
+
+	seenMu    sync.Mutex
+	seen      map[string]struct{}
+	seenOrder []string
+
+	// since is the created_at of the newest DM handled, so a resubscription
+	// after a reconnect does not replay older ones.
+	since atomic.Int64
+}
+
+type nostrRelay struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (r *nostrRelay) write(msg []any) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return r.conn.WriteJSON(msg)
+}
+
+func NewNostrChannel(cfg config.NostrConfig, messageBus *bus.MessageBus) (*NostrChannel, error) {
+	if cfg.PrivateKey == "" {
+		return nil, fmt.Errorf("nostr private_key is required")
+	}
+	if len(cfg.Relays) == 0 {
+		return nil, fmt.Errorf("nostr needs at least one relay")
+	}
+	key, err := parseNostrPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("nostr private_key: %w", err)
+	}
+
+	allowFrom, err := nostrAllowList(cfg.AllowFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NostrChannel{
+		BaseChannel: NewBaseChannel("nostr", cfg, messageBus, allowFrom),
+		config:      cfg,
+		key:         key,
+		pubKey:      hex.EncodeToString(schnorr.SerializePubKey(key.PubKey())),
+		conns:       make(map[string]*nostrRelay),
+		seen:        make(map[string]struct{}),
+	}, nil
+}
+
+// nostrAllowList converts the npubs in an allowlist to the hex keys
+// senders are identified by.
+func nostrAllowList(entries []string) ([]string, error) {
+	allowFrom := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		pub, err := parseNostrPubKey(entry)
+		if err != nil {
+			return nil, fmt.Errorf("nostr allow_from: %w", err)
+		}
+		allowFrom = append(allowFrom, pub)
+	}
+	return allowFrom, nil
+}
+
+// SetAllowList replaces the allowlist, which may hold npubs.
+func (c *NostrChannel) SetAllowList(entries []string) error {
+	allowFrom, err := nostrAllowList(entries)
+	if err != nil {
+		return err
+	}
+	return c.BaseChannel.SetAllowList(allowFrom)
+}
+
+func (c *NostrChannel) Start(ctx context.Context) error {
+	logger.InfoCF("nostr", "Starting Nostr channel", map[string]any{
+		"npub":   npub(c.pubKey),
+		"relays": len(c.config.Relays),
+	})
+
+	c.since.Store(time.Now().Unix())
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	for _, relay := range c.config.Relays {
+		go c.relayLoop(relay)
+	}
+
+	c.setRunning(true)
+	logger.InfoC("nostr", "Nostr channel started")
+	return nil
+}
+
+func (c *NostrChannel) Stop(ctx context.Context) error {
+	logger.InfoC("nostr", "Stopping Nostr channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Send encrypts the reply to the chat's public key and publishes it to every
+// connected relay. It fails only if no relay accepted the write.
+func (c *NostrChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("nostr channel not running")
+	}
+	recipient, err := parseNostrPubKey(msg.ChatID)
+	if err != nil {
+		return err
+	}
+	content, err := nip04Encrypt(c.key, recipient, msg.Content)
+	if err != nil {
+		return fmt.Errorf("nostr encrypt: %w", err)
+	}
+	ev := &nostrEvent{
+		CreatedAt: time.Now().Unix(),
+		Kind:      nostrKindDM,
+		Tags:      [][]string{{"p", recipient}},
+		Content:   content,
+	}
+	if err := ev.sign(c.key); err != nil {
+		return fmt.Errorf("nostr sign: %w", err)
+	}
+
+	sent := 0
+	var lastErr error
+	for url, relay := range c.connected() {
+		if err := relay.write([]any{"EVENT", ev}); err != nil {
+			lastErr = err
+			logger.WarnCF("nostr", "Failed to publish to relay", map[string]any{
+				"relay": url,
+				"error": err.Error(),
+			})
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no relay connected")
+		}
+		return fmt.Errorf("nostr send: %w", lastErr)
+	}
+	return nil
+}
+
+// CheckHealth reports an error while no relay is connected.
+func (c *NostrChannel) CheckHealth(ctx context.Context) error {
+	if len(c.connected()) == 0 {
+		return errors.New("no relay connected")
+	}
+	return nil
+}
+
+func (c *NostrChannel) connected() map[string]*nostrRelay {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conns := make(map[string]*nostrRelay, len(c.conns))
+	for url, r := range c.conns {
+		conns[url] = r
+	}
+	return conns
+}
+
+func (c *NostrChannel) relayLoop(url string) {
+	backoff := time.Second
+	for {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		started := time.Now()
+		err := c.listen(url)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		logger.WarnCF("nostr", "Relay connection lost, reconnecting", map[string]any{
+			"relay":   url,
+			"error":   fmt.Sprint(err),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 5*time.Minute)
+	}
+}
+
+// listen subscribes to DMs for the bot on one relay and handles them until
+// the connection drops.
+func (c *NostrChannel) listen(url string) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(c.ctx, url, nil)
+	if err != nil {
+		return fmt.Errorf("websocket dial: %w", err)
+	}
+	relay := &nostrRelay{conn: conn}
+	defer conn.Close()
+
+	filter := map[string]any{
+		"kinds": []int{nostrKindDM},
+		"#p":    []string{c.pubKey},
+		"since": c.since.Load(),
+	}
+	if err := relay.write([]any{"REQ", nostrSubscription, filter}); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.conns[url] = relay
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.conns, url)
+		c.mu.Unlock()
+	}()
+	logger.InfoCF("nostr", "Connected to relay", map[string]any{"relay": url})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if err := c.handleRelayMessage(url, data); err != nil {
+			return err
+		}
+	}
+}
+
+// handleRelayMessage processes one NIP-01 relay message. It returns an
+// error only when the relay closed our subscription.
+func (c *NostrChannel) handleRelayMessage(url string, data []byte) error {
+	var msg []json.RawMessage
+	if err := json.Unmarshal(data, &msg); err != nil || len(msg) == 0 {
+		return nil
+	}
+	var typ string
+	json.Unmarshal(msg[0], &typ)
+
+	switch typ {
+	case "EVENT":
+		if len(msg) < 3 {
+			return nil
+		}
+		var ev nostrEvent
+		if err := json.Unmarshal(msg[2], &ev); err != nil {
+			return nil
+		}
+		c.handleEvent(url, &ev)
+	case "NOTICE":
+		var notice string
+		if len(msg) > 1 {
+			json.Unmarshal(msg[1], &notice)
+		}
+		logger.InfoCF("nostr", "Relay notice", map[string]any{
+			"relay":  url,
+			"notice": notice,
+		})
+	case "OK":
+		var accepted bool
+		var reason string
+		if len(msg) > 3 {
+			json.Unmarshal(msg[2], &accepted)
+			json.Unmarshal(msg[3], &reason)
+		}
+		if !accepted {
+			logger.WarnCF("nostr", "Relay rejected event", map[string]any{
+				"relay":  url,
+				"reason": reason,
+			})
+		}
+	case "CLOSED":
+		var reason string
+		if len(msg) > 2 {
+			json.Unmarshal(msg[2], &reason)
+		}
+		return fmt.Errorf("subscription closed by relay: %s", reason)
+	}
+	return nil
+}
+
+func (c *NostrChannel) handleEvent(url string, ev *nostrEvent) {
+	if ev.Kind != nostrKindDM || ev.PubKey == c.pubKey || ev.tag("p") != c.pubKey {
+		return
+	}
+	// Verify before deduplicating, so a forged copy can't shadow the real one.
+	if err := ev.verify(); err != nil {
+		logger.WarnCF("nostr", "Dropping invalid event", map[string]any{
+			"relay": url,
+			"error": err.Error(),
+		})
+		return
+	}
+	if !c.markSeen(ev.ID) {
+		return
+	}
+	if !c.IsAllowed(ev.PubKey) {
+		logger.DebugCF("nostr", "Ignoring DM from sender not in allow_from", map[string]any{
+			"npub": npub(ev.PubKey),
+		})
+		return
+	}
+
+	text, err := nip04Decrypt(c.key, ev.PubKey, ev.Content)
+	if err != nil {
+		logger.WarnCF("nostr", "Failed to decrypt DM", map[string]any{
+			"npub":  npub(ev.PubKey),
+			"error": err.Error(),
+		})
+		return
+	}
+	for {
+		since := c.since.Load()
+		if ev.CreatedAt <= since || c.since.CompareAndSwap(since, ev.CreatedAt) {
+			break
+		}
+	}
+
+	logger.DebugCF("nostr", "Received DM", map[string]any{
+		"npub":  npub(ev.PubKey),
+		"relay": url,
+	})
+	c.HandleMessage(ev.PubKey, ev.PubKey, text, nil, map[string]string{
+		"message_id": ev.ID,
+		"peer_kind":  "direct",
+		"peer_id":    ev.PubKey,
+		"npub":       npub(ev.PubKey),
+	})
+}
+
+// markSeen records an event ID and reports whether it was new.
+func (c *NostrChannel) markSeen(id string) bool {
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = struct{}{}
+	c.seenOrder = append(c.seenOrder, id)
+	if len(c.seenOrder) > nostrSeenLimit {
+		delete(c.seen, c.seenOrder[0])
+		c.seenOrder = c.seenOrder[1:]
+	}
+	return true
+}
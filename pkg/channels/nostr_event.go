@@ -0,0 +1,349 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// nostrEvent is a NIP-01 event.
+type nostrEvent struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// hash returns the event ID: the SHA-256 of its canonical serialization.
+func (e *nostrEvent) hash() [32]byte {
+	var b strings.Builder
+	b.WriteString(`[0,`)
+	writeNostrString(&b, e.PubKey)
+	b.WriteString(",")
+	b.WriteString(strconv.FormatInt(e.CreatedAt, 10))
+	b.WriteString(",")
+	b.WriteString(strconv.Itoa(e.Kind))
+	b.WriteString(",[")
+	for i, tag := range e.Tags {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("[")
+		for j, v := range tag {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			writeNostrString(&b, v)
+		}
+		b.WriteString("]")
+	}
+	b.WriteString("],")
+	writeNostrString(&b, e.Content)
+	b.WriteString("]")
+	return sha256.Sum256([]byte(b.String()))
+}
+
+// writeNostrString writes s as a JSON string escaped exactly as NIP-01
+// requires. encoding/json differs (it escapes <, > and & and writes \b and
+// \f as \u0008 and \u000c), which would change the event ID.
+func writeNostrString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if c < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// sign sets the event's pubkey, ID and signature.
+func (e *nostrEvent) sign(key *btcec.PrivateKey) error {
+	e.PubKey = hex.EncodeToString(schnorr.SerializePubKey(key.PubKey()))
+	if e.Tags == nil {
+		e.Tags = [][]string{}
+	}
+	id := e.hash()
+	sig, err := schnorr.Sign(key, id[:])
+	if err != nil {
+		return err
+	}
+	e.ID = hex.EncodeToString(id[:])
+	e.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// verify checks the event ID and signature.
+func (e *nostrEvent) verify() error {
+	id := e.hash()
+	if hex.EncodeToString(id[:]) != e.ID {
+		return errors.New("event id does not match its content")
+	}
+	pubBytes, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return fmt.Errorf("invalid pubkey: %w", err)
+	}
+	pub, err := schnorr.ParsePubKey(pubBytes)
+	if err != nil {
+		return fmt.Errorf("invalid pubkey: %w", err)
+	}
+	sigBytes, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !sig.Verify(id[:], pub) {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
+// tag returns the first value of the first tag named name.
+func (e *nostrEvent) tag(name string) string {
+	for _, t := range e.Tags {
+		if len(t) >= 2 && t[0] == name {
+			return t[1]
+		}
+	}
+	return ""
+}
+
+// nip04Secret derives the NIP-04 shared secret between key and the x-only
+// public key pubHex.
+func nip04Secret(key *btcec.PrivateKey, pubHex string) ([]byte, error) {
+	pubBytes, err := hex.DecodeString(pubHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey: %w", err)
+	}
+	pub, err := schnorr.ParsePubKey(pubBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey: %w", err)
+	}
+	return btcec.GenerateSharedSecret(key, pub), nil
+}
+
+// nip04Encrypt encrypts plaintext for pubHex as "<ciphertext>?iv=<iv>".
+func nip04Encrypt(key *btcec.PrivateKey, pubHex, plaintext string) (string, error) {
+	secret, err := nip04Secret(key, pubHex)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	data := append([]byte(plaintext), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return base64.StdEncoding.EncodeToString(data) + "?iv=" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+// nip04Decrypt reverses nip04Encrypt for a message from pubHex.
+func nip04Decrypt(key *btcec.PrivateKey, pubHex, content string) (string, error) {
+	encoded, ivEncoded, ok := strings.Cut(content, "?iv=")
+	if !ok {
+		return "", errors.New("missing iv")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(ivEncoded)
+	if err != nil || len(iv) != aes.BlockSize {
+		return "", errors.New("invalid iv")
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", errors.New("invalid ciphertext length")
+	}
+	secret, err := nip04Secret(key, pubHex)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(data) {
+		return "", errors.New("invalid padding")
+	}
+	return string(data[:len(data)-pad]), nil
+}
+
+// parseNostrPrivateKey accepts an nsec or a hex private key.
+func parseNostrPrivateKey(s string) (*btcec.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+	var raw []byte
+	var err error
+	if strings.HasPrefix(s, "nsec1") {
+		raw, err = bech32Decode("nsec", s)
+	} else {
+		raw, err = hex.DecodeString(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, errors.New("private key must be 32 bytes")
+	}
+	key, _ := btcec.PrivKeyFromBytes(raw)
+	return key, nil
+}
+
+// parseNostrPubKey accepts an npub or a hex public key and returns it as
+// lowercase hex.
+func parseNostrPubKey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "npub1") {
+		raw, err := bech32Decode("npub", s)
+		if err != nil {
+			return "", err
+		}
+		s = hex.EncodeToString(raw)
+	}
+	s = strings.ToLower(s)
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("invalid public key %q", s)
+	}
+	return s, nil
+}
+
+// npub returns the NIP-19 form of a hex public key.
+func npub(pubHex string) string {
+	raw, err := hex.DecodeString(pubHex)
+	if err != nil {
+		return pubHex
+	}
+	return bech32Encode("npub", raw)
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits regroups data from fromBits-bit to toBits-bit values.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<toBits - 1
+	var out []byte
+	for _, v := range data {
+		if uint(v)>>fromBits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<fromBits | uint(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+func bech32Encode(hrp string, data []byte) string {
+	values, _ := convertBits(data, 8, 5, true)
+	polymod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+	return b.String()
+}
+
+func bech32Decode(hrp, s string) ([]byte, error) {
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || s[:pos] != hrp || len(s)-pos-1 < 6 {
+		return nil, fmt.Errorf("not a valid %s", hrp)
+	}
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		idx := strings.IndexByte(bech32Charset, s[i])
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid character %q in %s", s[i], hrp)
+		}
+		values = append(values, byte(idx))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return nil, fmt.Errorf("bad %s checksum", hrp)
+	}
+	return convertBits(values[:len(values)-6], 5, 8, false)
+}
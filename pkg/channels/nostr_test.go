@@ -0,0 +1,206 @@
+package channels
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestNostrKeyEncoding(t *testing.T) {
+	// Test vectors from NIP-19.
+	pub, err := parseNostrPubKey("npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub != "7e7e9c42a91bfef19fa929e5fda1b72e0ebc1a4c1141673e2794234d86addf4e" {
+		t.Errorf("pub = %s", pub)
+	}
+	if got := npub(pub); got != "npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptg" {
+		t.Errorf("npub = %s", got)
+	}
+
+	key, err := parseNostrPrivateKey("nsec1vl029mgpspedva04g90vltkh6fvh240zqtv9k0t9af8935ke9laqsnlfe5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key.Serialize()); got != "67dea2ed018072d675f5415ecfaed7d2597555e202d85b3d65ea4e58d2d92ffa" {
+		t.Errorf("nsec = %s", got)
+	}
+
+	if _, err := parseNostrPubKey("npub10elfcs4fr0l0r8af98jlmgdh9c8tcxjvz9qkw038js35mp4dma8qzvjptf"); err == nil {
+		t.Error("bad checksum accepted")
+	}
+}
+
+func TestNostrEventSignAndNIP04(t *testing.T) {
+	alice, _ := btcec.NewPrivateKey()
+	bob, _ := btcec.NewPrivateKey()
+	bobPub := hex.EncodeToString(schnorr.SerializePubKey(bob.PubKey()))
+	alicePub := hex.EncodeToString(schnorr.SerializePubKey(alice.PubKey()))
+
+	text := "hi <bob> & \"friends\"\n\tçà va? 🦀"
+	content, err := nip04Encrypt(alice, bobPub, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := nip04Decrypt(bob, alicePub, content)
+	if err != nil || got != text {
+		t.Fatalf("decrypt = %q, %v", got, err)
+	}
+
+	ev := &nostrEvent{CreatedAt: 1700000000, Kind: nostrKindDM, Tags: [][]string{{"p", bobPub}}, Content: content}
+	if err := ev.sign(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := ev.verify(); err != nil {
+		t.Fatal(err)
+	}
+	ev.Content += "x"
+	if ev.verify() == nil {
+		t.Error("tampered event verified")
+	}
+}
+
+// fakeRelay is a minimal NIP-01 relay that records the REQ and EVENT
+// messages it receives and can push events to the subscriber.
+type fakeRelay struct {
+	conns  chan *websocket.Conn
+	events chan nostrEvent
+	reqs   chan []json.RawMessage
+}
+
+func newFakeRelay(t *testing.T) (*fakeRelay, string) {
+	r := &fakeRelay{
+		conns:  make(chan *websocket.Conn, 1),
+		events: make(chan nostrEvent, 4),
+		reqs:   make(chan []json.RawMessage, 4),
+	}
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r.conns <- conn
+		for {
+			var msg []json.RawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			var typ string
+			json.Unmarshal(msg[0], &typ)
+			switch typ {
+			case "REQ":
+				r.reqs <- msg
+			case "EVENT":
+				var ev nostrEvent
+				json.Unmarshal(msg[1], &ev)
+				r.events <- ev
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return r, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestNostrChannelRoundTrip(t *testing.T) {
+	relay, url := newFakeRelay(t)
+	bot, _ := btcec.NewPrivateKey()
+	user, _ := btcec.NewPrivateKey()
+	botPub := hex.EncodeToString(schnorr.SerializePubKey(bot.PubKey()))
+	userPub := hex.EncodeToString(schnorr.SerializePubKey(user.PubKey()))
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewNostrChannel(config.NostrConfig{
+		PrivateKey: bech32Encode("nsec", bot.Serialize()),
+		Relays:     config.FlexibleStringSlice{url},
+		AllowFrom:  config.FlexibleStringSlice{npub(userPub)},
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Stop(ctx)
+
+	var conn *websocket.Conn
+	select {
+	case conn = <-relay.conns:
+	case <-ctx.Done():
+		t.Fatal("channel never connected")
+	}
+	req := <-relay.reqs
+	if len(req) != 3 || !strings.Contains(string(req[2]), botPub) {
+		t.Fatalf("REQ = %s", req)
+	}
+
+	content, _ := nip04Encrypt(user, botPub, "what's up?")
+	dm := nostrEvent{CreatedAt: time.Now().Unix(), Kind: nostrKindDM, Tags: [][]string{{"p", botPub}}, Content: content}
+	dm.sign(user)
+	// Relays often deliver the same event more than once.
+	for range 2 {
+		if err := conn.WriteJSON([]any{"EVENT", nostrSubscription, dm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if in.Content != "what's up?" || in.ChatID != userPub || in.Metadata["peer_kind"] != "direct" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	for ch.CheckHealth(ctx) != nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "nostr", ChatID: in.ChatID, Content: "all good"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-relay.events:
+		if err := ev.verify(); err != nil || ev.PubKey != botPub || ev.tag("p") != userPub {
+			t.Fatalf("published %+v (%v)", ev, err)
+		}
+		if got, err := nip04Decrypt(user, botPub, ev.Content); err != nil || got != "all good" {
+			t.Errorf("reply = %q, %v", got, err)
+		}
+	case <-ctx.Done():
+		t.Fatal("reply was not published")
+	}
+
+	select {
+	case dup := <-inboundAsync(msgBus):
+		t.Errorf("duplicate event was delivered twice: %+v", dup)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func inboundAsync(msgBus *bus.MessageBus) <-chan bus.InboundMessage {
+	out := make(chan bus.InboundMessage, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+			out <- msg
+		}
+	}()
+	return out
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,7 +15,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
-	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -570,8 +569,7 @@ func parseJSONString(raw json.RawMessage) string {
 type parseMessageResult struct {
 	Text           string
 	IsBotMentioned bool
-	Media          []string
-	LocalFiles     []string
+	Attachments    []bus.Attachment
 	ReplyTo        string
 }
 
@@ -602,8 +600,7 @@ func (c *OneBotChannel) parseMessageSegments(raw json.RawMessage, selfID int64)
 	var textParts []string
 	mentioned := false
 	selfIDStr := strconv.FormatInt(selfID, 10)
-	var media []string
-	var localFiles []string
+	var attachments []bus.Attachment
 	var replyTo string
 
 	for _, seg := range segments {
@@ -637,14 +634,8 @@ func (c *OneBotChannel) parseMessageSegments(raw json.RawMessage, selfID int64)
 					} else if n, ok := data["name"].(string); ok && n != "" {
 						filename = n
 					}
-					localPath := utils.DownloadFile(url, filename, utils.DownloadOptions{
-						LoggerPrefix: "onebot",
-					})
-					if localPath != "" {
-						media = append(media, localPath)
-						localFiles = append(localFiles, localPath)
-						textParts = append(textParts, fmt.Sprintf("[%s]", segType))
-					}
+					attachments = append(attachments, media.FromURL(url, filename, "", nil))
+					textParts = append(textParts, fmt.Sprintf("[%s]", segType))
 				}
 			}
 
@@ -652,27 +643,27 @@ func (c *OneBotChannel) parseMessageSegments(raw json.RawMessage, selfID int64)
 			if data != nil {
 				url, _ := data["url"].(string)
 				if url != "" {
-					localPath := utils.DownloadFile(url, "voice.amr", utils.DownloadOptions{
-						LoggerPrefix: "onebot",
-					})
-					if localPath != "" {
-						localFiles = append(localFiles, localPath)
-						if c.transcriber != nil && c.transcriber.IsAvailable() {
-							tctx, tcancel := context.WithTimeout(c.ctx, 30*time.Second)
-							result, err := c.transcriber.Transcribe(tctx, localPath)
-							tcancel()
-							if err != nil {
-								logger.WarnCF("onebot", "Voice transcription failed", map[string]any{
-									"error": err.Error(),
-								})
-								textParts = append(textParts, "[voice (transcription failed)]")
-								media = append(media, localPath)
-							} else {
-								textParts = append(textParts, fmt.Sprintf("[voice transcription: %s]", result.Text))
-							}
+					record := media.FromURL(url, "voice.amr", "audio/amr", nil)
+					if c.transcriber == nil || !c.transcriber.IsAvailable() {
+						textParts = append(textParts, "[voice]")
+						attachments = append(attachments, record)
+					} else if record, err := c.FetchAttachment(c.ctx, record); err != nil {
+						logger.WarnCF("onebot", "Failed to download voice message", map[string]any{
+							"error": err.Error(),
+						})
+					} else {
+						tctx, tcancel := context.WithTimeout(c.ctx, 30*time.Second)
+						result, err := c.transcriber.Transcribe(tctx, record.Path)
+						tcancel()
+						if err != nil {
+							logger.WarnCF("onebot", "Voice transcription failed", map[string]any{
+								"error": err.Error(),
+							})
+							textParts = append(textParts, "[voice (transcription failed)]")
+							attachments = append(attachments, record)
 						} else {
-							textParts = append(textParts, "[voice]")
-							media = append(media, localPath)
+							textParts = append(textParts, fmt.Sprintf("[voice transcription: %s]", result.Text))
+							c.MediaStore().Release(record)
 						}
 					}
 				}
@@ -702,8 +693,7 @@ func (c *OneBotChannel) parseMessageSegments(raw json.RawMessage, selfID int64)
 	return parseMessageResult{
 		Text:           strings.TrimSpace(strings.Join(textParts, "")),
 		IsBotMentioned: mentioned,
-		Media:          media,
-		LocalFiles:     localFiles,
+		Attachments:    attachments,
 		ReplyTo:        replyTo,
 	}
 }
@@ -810,7 +800,7 @@ func (c *OneBotChannel) handleMessage(raw *oneBotRawEvent) {
 		}
 	}
 
-	if parsed.Text != "" && content != parsed.Text && (len(parsed.Media) > 0 || parsed.ReplyTo != "") {
+	if parsed.Text != "" && content != parsed.Text && (len(parsed.Attachments) > 0 || parsed.ReplyTo != "") {
 		content = parsed.Text
 	}
 
@@ -824,20 +814,6 @@ func (c *OneBotChannel) handleMessage(raw *oneBotRawEvent) {
 		}
 	}
 
-	// Clean up temp files when done
-	if len(parsed.LocalFiles) > 0 {
-		defer func() {
-			for _, f := range parsed.LocalFiles {
-				if err := os.Remove(f); err != nil {
-					logger.DebugCF("onebot", "Failed to remove temp file", map[string]any{
-						"path":  f,
-						"error": err.Error(),
-					})
-				}
-			}
-		}()
-	}
-
 	if c.isDuplicate(messageID) {
 		logger.DebugCF("onebot", "Duplicate message, skipping", map[string]any{
 			"message_id": messageID,
@@ -914,7 +890,7 @@ func (c *OneBotChannel) handleMessage(raw *oneBotRawEvent) {
 		"message_id":  messageID,
 		"length":      len(content),
 		"content":     truncate(content, 100),
-		"media_count": len(parsed.Media),
+		"media_count": len(parsed.Attachments),
 	})
 
 	if sender.Nickname != "" {
@@ -928,7 +904,7 @@ func (c *OneBotChannel) handleMessage(raw *oneBotRawEvent) {
 		c.pendingEmojiMsg.Store(chatID, messageID)
 	}
 
-	c.HandleMessage(senderID, chatID, content, parsed.Media, metadata)
+	c.HandleMessageWithAttachments(senderID, chatID, content, parsed.Attachments, metadata)
 }
 
 func (c *OneBotChannel) isDuplicate(messageID string) bool {
@@ -0,0 +1,357 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// ErrBlockedByHook is returned for messages an outbound hook refused.
+// Such messages are never retried.
+var ErrBlockedByHook = errors.New("blocked by outbound hook")
+
+// pendingDelivery is a message waiting to be sent again, or for the first
+// time at SendAt when it was scheduled.
+type pendingDelivery struct {
+	ID          string              `json:"id"`
+	Message     bus.OutboundMessage `json:"message"`
+	Attempts    int                 `json:"attempts"`
+	NextAttempt time.Time           `json:"next_attempt"`
+	LastError   string              `json:"last_error"`
+	Created     time.Time           `json:"created"`
+	SendAt      time.Time           `json:"send_at,omitzero"`
+	By          string              `json:"by,omitempty"` // who scheduled it
+
+	dropped bool // taken out of the queue while being sent
+}
+
+// scheduled reports whether d waits for its time rather than a retry.
+func (d *pendingDelivery) scheduled() bool {
+	return !d.SendAt.IsZero() && d.Attempts == 0
+}
+
+// outbox keeps replies that failed to send in <workspace>/state/outbox.json
+// and retries them with exponential backoff, when retries are enabled.
+// Messages that still fail after MaxAttempts go to dead_letters.jsonl next
+// to it. Messages scheduled for later wait in the same queue.
+type outbox struct {
+	m          *Manager
+	cfg        config.OutboundRetryConfig
+	path       string
+	deadLetter string
+	now        func() time.Time
+
+	mu      sync.Mutex
+	pending []*pendingDelivery
+	seq     int
+
+	deadMu sync.Mutex // guards the dead letter file
+}
+
+func newOutbox(m *Manager, cfg config.OutboundRetryConfig, workspace string) *outbox {
+	dir := filepath.Join(workspace, "state")
+	o := &outbox{
+		m:          m,
+		cfg:        cfg,
+		path:       filepath.Join(dir, "outbox.json"),
+		deadLetter: filepath.Join(dir, "dead_letters.jsonl"),
+		now:        time.Now,
+	}
+	if data, err := os.ReadFile(o.path); err == nil {
+		if err := json.Unmarshal(data, &o.pending); err != nil {
+			logger.WarnCF("channels", "Ignoring unreadable outbox", map[string]any{
+				"path":  o.path,
+				"error": err.Error(),
+			})
+		}
+	}
+	if len(o.pending) > 0 {
+		logger.InfoCF("channels", "Loaded undelivered messages", map[string]any{
+			"count": len(o.pending),
+		})
+	}
+	return o
+}
+
+// enqueue schedules msg for another attempt after a failed send.
+func (o *outbox) enqueue(msg bus.OutboundMessage, err error) {
+	now := o.now()
+	o.mu.Lock()
+	o.seq++
+	d := &pendingDelivery{
+		ID:        fmt.Sprintf("%d-%d", now.UnixNano(), o.seq),
+		Message:   msg,
+		Attempts:  1,
+		LastError: err.Error(),
+		Created:   now,
+	}
+	d.NextAttempt = now.Add(o.backoff(d.Attempts))
+	o.pending = append(o.pending, d)
+	o.saveLocked()
+	o.mu.Unlock()
+
+	logger.WarnCF("channels", "Queued message for redelivery", map[string]any{
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+		"retry_in": d.NextAttempt.Sub(now).String(),
+		"error":    err.Error(),
+	})
+}
+
+// size returns the number of messages waiting for redelivery.
+func (o *outbox) size() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for _, d := range o.pending {
+		if !d.scheduled() {
+			n++
+		}
+	}
+	return n
+}
+
+func (o *outbox) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.retryDue(ctx)
+		}
+	}
+}
+
+// retryDue sends every message whose next attempt is due.
+func (o *outbox) retryDue(ctx context.Context) {
+	now := o.now()
+	o.mu.Lock()
+	var due []*pendingDelivery
+	for _, d := range o.pending {
+		if !now.Before(d.NextAttempt) {
+			due = append(due, d)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		o.attempt(ctx, d)
+	}
+}
+
+func (o *outbox) attempt(ctx context.Context, d *pendingDelivery) {
+	msg := d.Message
+	err := o.m.deliver(ctx, msg)
+
+	o.mu.Lock()
+	if d.dropped {
+		o.mu.Unlock()
+		return
+	}
+	d.Attempts++
+	giveUp := err != nil && (errors.Is(err, ErrBlockedByHook) || !o.cfg.Enabled || d.Attempts >= o.cfg.MaxAttempts)
+	switch {
+	case err == nil:
+		o.removeLocked(d)
+	case giveUp:
+		d.LastError = err.Error()
+		o.removeLocked(d)
+	default:
+		d.LastError = err.Error()
+		d.NextAttempt = o.now().Add(o.backoff(d.Attempts))
+	}
+	o.saveLocked()
+	attempts := d.Attempts
+	o.mu.Unlock()
+
+	switch {
+	case err == nil && attempts == 1:
+		logger.InfoCF("channels", "Sent scheduled message", map[string]any{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"id":      d.ID,
+		})
+	case err == nil:
+		logger.InfoCF("channels", "Redelivered message", map[string]any{
+			"channel":  msg.Channel,
+			"chat_id":  msg.ChatID,
+			"attempts": attempts,
+		})
+		o.m.recordEvent(state.RunEvent{
+			Kind:     "delivery_succeeded",
+			Source:   msg.Channel + ":" + msg.ChatID,
+			Message:  fmt.Sprintf("delivered after %d attempts", attempts),
+			Duration: o.now().Sub(d.Created),
+		})
+	case giveUp:
+		o.deadLetterDelivery(d)
+	default:
+		logger.DebugCF("channels", "Redelivery failed", map[string]any{
+			"channel":  msg.Channel,
+			"attempts": attempts,
+			"error":    err.Error(),
+		})
+	}
+}
+
+func (o *outbox) deadLetterDelivery(d *pendingDelivery) {
+	logger.ErrorCF("channels", "Giving up on message delivery", map[string]any{
+		"channel":  d.Message.Channel,
+		"chat_id":  d.Message.ChatID,
+		"attempts": d.Attempts,
+		"error":    d.LastError,
+	})
+	o.deadMu.Lock()
+	err := appendJSONLine(o.deadLetter, d)
+	o.deadMu.Unlock()
+	if err != nil {
+		logger.ErrorCF("channels", "Failed to write dead letter", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	o.m.recordEvent(state.RunEvent{
+		Kind:     "delivery_failed",
+		Source:   d.Message.Channel + ":" + d.Message.ChatID,
+		Message:  fmt.Sprintf("gave up after %d attempts: %s", d.Attempts, d.LastError),
+		Duration: o.now().Sub(d.Created),
+	})
+}
+
+// dropUndelivered takes the messages waiting to be sent again whose chat
+// matches out of the queue, and out of the dead letters, and returns how
+// many of each it removed.
+func (o *outbox) dropUndelivered(chat func(channel, chatID string) bool) (int, int, error) {
+	o.mu.Lock()
+	pending := o.dropLocked(func(d *pendingDelivery) bool {
+		return !d.scheduled() && chat(d.Message.Channel, d.Message.ChatID)
+	})
+	o.mu.Unlock()
+
+	o.deadMu.Lock()
+	defer o.deadMu.Unlock()
+	data, err := os.ReadFile(o.deadLetter)
+	if os.IsNotExist(err) {
+		return pending, 0, nil
+	} else if err != nil {
+		return pending, 0, err
+	}
+	var kept []byte
+	dead := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var d pendingDelivery
+		if json.Unmarshal(line, &d) == nil && chat(d.Message.Channel, d.Message.ChatID) {
+			dead++
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	if dead == 0 {
+		return pending, 0, nil
+	}
+	return pending, dead, writeFileAtomic(o.deadLetter, kept)
+}
+
+// dropLocked takes the deliveries match picks out of the queue, including
+// one being sent, and saves it. It returns how many it took. Must be
+// called with o.mu held.
+func (o *outbox) dropLocked(match func(d *pendingDelivery) bool) int {
+	n := 0
+	o.pending = slices.DeleteFunc(o.pending, func(d *pendingDelivery) bool {
+		if !match(d) {
+			return false
+		}
+		d.dropped = true
+		n++
+		return true
+	})
+	if n > 0 {
+		o.saveLocked()
+	}
+	return n
+}
+
+func (o *outbox) backoff(attempts int) time.Duration {
+	delay := time.Duration(max(o.cfg.InitialBackoffSeconds, 1)) * time.Second
+	limit := time.Duration(max(o.cfg.MaxBackoffSeconds, 1)) * time.Second
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+func (o *outbox) removeLocked(d *pendingDelivery) {
+	for i, p := range o.pending {
+		if p == d {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// saveLocked writes the queue with a temp file and rename, so a crash never
+// leaves a half-written file. Must be called with o.mu held.
+func (o *outbox) saveLocked() {
+	err := func() error {
+		if err := os.MkdirAll(filepath.Dir(o.path), 0o755); err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(o.pending, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(o.path, data)
+	}()
+	if err != nil {
+		logger.ErrorCF("channels", "Failed to save outbox", map[string]any{
+			"path":  o.path,
+			"error": err.Error(),
+		})
+	}
+}
+
+// writeFileAtomic writes data to path through a temp file and a rename.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func appendJSONLine(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,208 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+type failingChannel struct {
+	*BaseChannel
+	failures int
+	sent     []bus.OutboundMessage
+}
+
+func (c *failingChannel) Start(ctx context.Context) error { return nil }
+func (c *failingChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *failingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("rate limited")
+	}
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func newOutboxManager(t *testing.T, workspace string, maxAttempts int) (*Manager, *failingChannel, *time.Time) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Channels.Retry.MaxAttempts = maxAttempts
+	cfg.Channels.Retry.InitialBackoffSeconds = 5
+	cfg.Channels.Retry.MaxBackoffSeconds = 60
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &failingChannel{BaseChannel: NewBaseChannel("flaky", nil, nil, nil)}
+	m.RegisterChannel("flaky", ch)
+
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	m.outbox.now = func() time.Time { return clock }
+	return m, ch, &clock
+}
+
+func TestOutboxRetriesAcrossRestart(t *testing.T) {
+	workspace := t.TempDir()
+	m, _, clock := newOutboxManager(t, workspace, 5)
+	m.outbox.enqueue(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "hello"}, errors.New("offline"))
+	if m.PendingDeliveries() != 1 {
+		t.Fatalf("pending = %d", m.PendingDeliveries())
+	}
+
+	// A new manager picks the message up from disk.
+	m2, ch, clock2 := newOutboxManager(t, workspace, 5)
+	*clock2 = *clock
+	ch.failures = 1
+	ctx := context.Background()
+
+	m2.outbox.retryDue(ctx)
+	if len(ch.sent) != 0 {
+		t.Fatal("retried before the backoff expired")
+	}
+	*clock2 = clock2.Add(5 * time.Second)
+	m2.outbox.retryDue(ctx) // fails, next try in 10s
+	*clock2 = clock2.Add(5 * time.Second)
+	m2.outbox.retryDue(ctx)
+	if len(ch.sent) != 0 {
+		t.Fatal("backoff did not grow")
+	}
+	*clock2 = clock2.Add(5 * time.Second)
+	m2.outbox.retryDue(ctx)
+	if len(ch.sent) != 1 || ch.sent[0].Content != "hello" {
+		t.Fatalf("sent = %+v", ch.sent)
+	}
+	if m2.PendingDeliveries() != 0 {
+		t.Errorf("pending = %d after delivery", m2.PendingDeliveries())
+	}
+
+	events, _ := state.NewEventLog(workspace).Recent(0)
+	if len(events) != 1 || events[0].Kind != "delivery_succeeded" || events[0].Source != "flaky:1" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestOutboxDeadLetter(t *testing.T) {
+	workspace := t.TempDir()
+	m, ch, clock := newOutboxManager(t, workspace, 3)
+	ch.failures = 100
+	m.outbox.enqueue(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "lost"}, errors.New("offline"))
+
+	for i := 0; i < 5; i++ {
+		*clock = clock.Add(time.Minute)
+		m.outbox.retryDue(context.Background())
+	}
+	if m.PendingDeliveries() != 0 {
+		t.Fatalf("pending = %d, want the message dead-lettered", m.PendingDeliveries())
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspace, "state", "dead_letters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 || !strings.Contains(string(data), `"lost"`) {
+		t.Errorf("dead letters = %s", data)
+	}
+	events, _ := state.NewEventLog(workspace).Recent(0)
+	if len(events) != 1 || events[0].Kind != "delivery_failed" || !strings.Contains(events[0].Message, "3 attempts") {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestOutboxBlockedByHookIsNotRetried(t *testing.T) {
+	m, ch, clock := newOutboxManager(t, t.TempDir(), 5)
+	m.AddOutboundHook(func(context.Context, *bus.OutboundMessage) error {
+		return errors.New("quiet hours")
+	})
+	m.outbox.enqueue(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "x"}, errors.New("offline"))
+
+	*clock = clock.Add(time.Minute)
+	m.outbox.retryDue(context.Background())
+	if m.PendingDeliveries() != 0 || len(ch.sent) != 0 {
+		t.Errorf("pending = %d, sent = %+v", m.PendingDeliveries(), ch.sent)
+	}
+}
+
+func TestScheduledMessage(t *testing.T) {
+	workspace := t.TempDir()
+	m, _, clock := newOutboxManager(t, workspace, 5)
+	msg := bus.OutboundMessage{Channel: "flaky", ChatID: "family", Content: "Dinner is ready"}
+
+	if _, err := m.ScheduleMessage(msg, clock.Add(-time.Hour), "flaky:1"); err == nil {
+		t.Error("scheduled a message in the past")
+	}
+	if _, err := m.ScheduleMessage(bus.OutboundMessage{Channel: "nope", ChatID: "1", Content: "x"}, clock.Add(time.Hour), ""); err == nil {
+		t.Error("scheduled a message to an unknown channel")
+	}
+	dinner, err := m.ScheduleMessage(msg, clock.Add(6*time.Hour), "flaky:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := m.ScheduleMessage(msg, clock.Add(time.Hour), "flaky:1")
+	if _, err := m.CancelScheduled(other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.ScheduledMessages(); len(got) != 1 || got[0].ID != dinner.ID || m.PendingDeliveries() != 0 {
+		t.Fatalf("scheduled = %+v, pending = %d", got, m.PendingDeliveries())
+	}
+
+	// The message waits on disk; the hooks at send time see it.
+	m2, ch, clock2 := newOutboxManager(t, workspace, 5)
+	*clock2 = clock.Add(time.Hour)
+	m2.AddOutboundHook(func(_ context.Context, msg *bus.OutboundMessage) error {
+		msg.Content += " 🍝"
+		return nil
+	})
+	m2.outbox.retryDue(context.Background())
+	if len(ch.sent) != 0 {
+		t.Fatal("sent before its time")
+	}
+	*clock2 = clock.Add(6 * time.Hour)
+	m2.outbox.retryDue(context.Background())
+	if len(ch.sent) != 1 || ch.sent[0].Content != "Dinner is ready 🍝" || len(m2.ScheduledMessages()) != 0 {
+		t.Errorf("sent = %+v, scheduled = %+v", ch.sent, m2.ScheduledMessages())
+	}
+	if _, err := m2.CancelScheduled(dinner.ID); !errors.Is(err, ErrNoScheduledMessage) {
+		t.Errorf("cancelled a sent message: %v", err)
+	}
+}
+
+// busyUntil holds every proactive message until a given time.
+type busyUntil struct{ until time.Time }
+
+func (b busyUntil) Hold(msg bus.OutboundMessage, now time.Time) (time.Time, bool, string) {
+	if !msg.Proactive {
+		return time.Time{}, false, ""
+	}
+	return b.until, false, "Standup"
+}
+
+func TestDoNotDisturbDefers(t *testing.T) {
+	m, ch, clock := newOutboxManager(t, t.TempDir(), 5)
+	m.SetDoNotDisturb(busyUntil{until: clock.Add(30 * time.Minute)})
+
+	m.dispatch(context.Background(), bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "Answer"})
+	m.dispatch(context.Background(), bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "Digest", Proactive: true})
+	if len(ch.sent) != 1 || ch.sent[0].Content != "Answer" {
+		t.Fatalf("sent = %+v", ch.sent)
+	}
+	scheduled := m.ScheduledMessages()
+	if len(scheduled) != 1 || scheduled[0].By != "dnd: Standup" || !scheduled[0].SendAt.Equal(clock.Add(30*time.Minute)) {
+		t.Fatalf("scheduled = %+v", scheduled)
+	}
+
+	*clock = clock.Add(30 * time.Minute)
+	m.outbox.retryDue(context.Background())
+	if len(ch.sent) != 2 || ch.sent[1].Content != "Digest" {
+		t.Errorf("sent = %+v", ch.sent)
+	}
+}
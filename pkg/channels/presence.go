@@ -0,0 +1,191 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// TypingChannel is implemented by channels that can show a typing indicator.
+// StartTyping keeps the indicator up until stop is called.
+type TypingChannel interface {
+	StartTyping(ctx context.Context, chatID string) (stop func(), err error)
+}
+
+// ReactionChannel is implemented by channels that can react to a message
+// with an emoji.
+type ReactionChannel interface {
+	AddReaction(ctx context.Context, chatID, messageID, emoji string) error
+	RemoveReaction(ctx context.Context, chatID, messageID, emoji string) error
+}
+
+// maxTypingDuration bounds a typing indicator whose run never finishes.
+const maxTypingDuration = 5 * time.Minute
+
+// Presence shows a user that the agent is working on their message. A nil
+// *Presence is valid and does nothing, so callers need not check whether
+// the channel supports it.
+type Presence struct {
+	cfg        config.PresenceConfig
+	channel    string
+	chatID     string
+	messageID  string
+	reactor    ReactionChannel
+	stopTyping func()
+
+	mu       sync.Mutex
+	reaction string
+	finished bool
+}
+
+// StartPresence starts the typing indicator for chatID and returns a
+// Presence for the rest of the run. messageID is the user's message, used
+// for reactions; it may be empty. It returns nil when the channel supports
+// neither feature or both are disabled.
+func (m *Manager) StartPresence(ctx context.Context, channelName, chatID, messageID string) *Presence {
+	m.mu.RLock()
+	channel, ok := m.channels[channelName]
+	m.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	cfg := m.config.Channels.Presence
+	caps := channel.Capabilities()
+	p := &Presence{cfg: cfg, channel: channelName, chatID: chatID, messageID: messageID}
+
+	if typer, ok := channel.(TypingChannel); ok && caps.Typing && cfg.Typing {
+		stop, err := typer.StartTyping(ctx, chatID)
+		if err != nil {
+			logger.DebugCF("channels", "Typing indicator failed", map[string]any{
+				"channel": channelName,
+				"error":   err.Error(),
+			})
+		} else {
+			p.stopTyping = stop
+		}
+	}
+	if reactor, ok := channel.(ReactionChannel); ok && caps.Reactions && cfg.Reactions && messageID != "" {
+		p.reactor = reactor
+	}
+
+	if p.stopTyping == nil && p.reactor == nil {
+		return nil
+	}
+	return p
+}
+
+// React adds emoji to a message on channels that support reactions. It
+// does nothing on channels that don't.
+func (m *Manager) React(ctx context.Context, channelName, chatID, messageID, emoji string) error {
+	m.mu.RLock()
+	channel, ok := m.channels[channelName]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("channel %s not found", channelName)
+	}
+	reactor, ok := channel.(ReactionChannel)
+	if !ok || !channel.Capabilities().Reactions || messageID == "" || emoji == "" {
+		return nil
+	}
+	return reactor.AddReaction(ctx, chatID, messageID, emoji)
+}
+
+// ToolStarted marks the user's message with the working reaction.
+func (p *Presence) ToolStarted(ctx context.Context) {
+	if p == nil || p.reactor == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished || p.reaction != "" {
+		return
+	}
+	if p.react(ctx, p.cfg.WorkingEmoji) {
+		p.reaction = p.cfg.WorkingEmoji
+	}
+}
+
+// Finish stops the typing indicator and, if a tool ran, replaces the
+// working reaction with the done or error reaction.
+func (p *Presence) Finish(ctx context.Context, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished {
+		return
+	}
+	p.finished = true
+
+	if p.stopTyping != nil {
+		p.stopTyping()
+	}
+	if p.reactor == nil || p.reaction == "" {
+		return
+	}
+
+	final := p.cfg.DoneEmoji
+	if err != nil {
+		final = p.cfg.ErrorEmoji
+	}
+	if final == p.reaction {
+		return
+	}
+	if rmErr := p.reactor.RemoveReaction(ctx, p.chatID, p.messageID, p.reaction); rmErr != nil {
+		logger.DebugCF("channels", "Removing reaction failed", map[string]any{
+			"channel": p.channel,
+			"error":   rmErr.Error(),
+		})
+	}
+	p.reaction = ""
+	if p.react(ctx, final) {
+		p.reaction = final
+	}
+}
+
+func (p *Presence) react(ctx context.Context, emoji string) bool {
+	if emoji == "" {
+		return false
+	}
+	if err := p.reactor.AddReaction(ctx, p.chatID, p.messageID, emoji); err != nil {
+		logger.DebugCF("channels", "Adding reaction failed", map[string]any{
+			"channel": p.channel,
+			"emoji":   emoji,
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// keepTyping calls send now and every interval until the returned stop
+// function is called, ctx ends or maxTypingDuration passes. It is for
+// platforms whose typing indicator expires after a few seconds.
+func keepTyping(ctx context.Context, interval time.Duration, send func(ctx context.Context) error) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, maxTypingDuration)
+	if err := send(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if send(ctx) != nil {
+					return
+				}
+			}
+		}
+	}()
+	return cancel, nil
+}
@@ -0,0 +1,148 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakePresenceChannel struct {
+	*BaseChannel
+	typing atomic.Int32
+	events []string
+}
+
+func (c *fakePresenceChannel) Start(ctx context.Context) error { return nil }
+func (c *fakePresenceChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *fakePresenceChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+
+func (c *fakePresenceChannel) Capabilities() Capabilities {
+	return Capabilities{Typing: true, Reactions: true}
+}
+
+func (c *fakePresenceChannel) StartTyping(ctx context.Context, chatID string) (func(), error) {
+	c.typing.Add(1)
+	return func() { c.typing.Add(-1) }, nil
+}
+
+func (c *fakePresenceChannel) AddReaction(ctx context.Context, chatID, messageID, emoji string) error {
+	c.events = append(c.events, "+"+emoji+"@"+messageID)
+	return nil
+}
+
+func (c *fakePresenceChannel) RemoveReaction(ctx context.Context, chatID, messageID, emoji string) error {
+	c.events = append(c.events, "-"+emoji+"@"+messageID)
+	return nil
+}
+
+func newPresenceManager(t *testing.T, cfg *config.Config) (*Manager, *fakePresenceChannel) {
+	t.Helper()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &fakePresenceChannel{BaseChannel: NewBaseChannel("fake", nil, nil, nil)}
+	m.RegisterChannel("fake", ch)
+	return m, ch
+}
+
+func TestPresenceReactions(t *testing.T) {
+	m, ch := newPresenceManager(t, config.DefaultConfig())
+	ctx := context.Background()
+
+	p := m.StartPresence(ctx, "fake", "c1", "42")
+	if ch.typing.Load() != 1 {
+		t.Fatal("typing indicator not started")
+	}
+	p.ToolStarted(ctx)
+	p.ToolStarted(ctx)
+	p.Finish(ctx, nil)
+	p.Finish(ctx, nil)
+
+	if ch.typing.Load() != 0 {
+		t.Error("typing indicator not stopped")
+	}
+	want := []string{"+👀@42", "-👀@42", "+👍@42"}
+	if !reflect.DeepEqual(ch.events, want) {
+		t.Errorf("events = %v, want %v", ch.events, want)
+	}
+
+	ch.events = nil
+	p = m.StartPresence(ctx, "fake", "c1", "43")
+	p.ToolStarted(ctx)
+	p.Finish(ctx, errors.New("boom"))
+	want = []string{"+👀@43", "-👀@43", "+😢@43"}
+	if !reflect.DeepEqual(ch.events, want) {
+		t.Errorf("events = %v, want %v", ch.events, want)
+	}
+}
+
+func TestPresenceWithoutTools(t *testing.T) {
+	m, ch := newPresenceManager(t, config.DefaultConfig())
+	ctx := context.Background()
+
+	p := m.StartPresence(ctx, "fake", "c1", "42")
+	p.Finish(ctx, nil)
+	if len(ch.events) != 0 {
+		t.Errorf("a run without tools should not react, got %v", ch.events)
+	}
+}
+
+func TestPresenceDisabled(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Channels.Presence.Typing = false
+	cfg.Channels.Presence.Reactions = false
+	m, ch := newPresenceManager(t, cfg)
+	ctx := context.Background()
+
+	p := m.StartPresence(ctx, "fake", "c1", "42")
+	if p != nil {
+		t.Fatal("expected nil presence when disabled")
+	}
+	// A nil presence is safe to use.
+	p.ToolStarted(ctx)
+	p.Finish(ctx, nil)
+	if ch.typing.Load() != 0 || len(ch.events) != 0 {
+		t.Error("disabled presence touched the channel")
+	}
+	if m.StartPresence(ctx, "missing", "c1", "42") != nil {
+		t.Error("expected nil presence for an unknown channel")
+	}
+}
+
+func TestKeepTyping(t *testing.T) {
+	var sends atomic.Int32
+	stop, err := keepTyping(context.Background(), 10*time.Millisecond, func(ctx context.Context) error {
+		sends.Add(1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(55 * time.Millisecond)
+	stop()
+	n := sends.Load()
+	if n < 3 {
+		t.Errorf("indicator sent %d times, expected it to be refreshed", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if sends.Load() != n {
+		t.Error("indicator kept being sent after stop")
+	}
+
+	if _, err := keepTyping(context.Background(), time.Second, func(ctx context.Context) error {
+		return errors.New("forbidden")
+	}); err == nil {
+		t.Error("expected the first send's error")
+	}
+}
@@ -0,0 +1,275 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Rocket.Chat's default Message_MaxAllowedSize.
+const rocketChatMaxMessageLength = 5000
+
+// NewRocketChatChannel creates a Rocket.Chat channel that authenticates with
+// a bot user's personal access token and receives messages over the DDP
+// realtime API.
+func NewRocketChatChannel(cfg config.RocketChatConfig, messageBus *bus.MessageBus) (*TeamChatChannel, error) {
+	if cfg.URL == "" || cfg.UserID == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("rocketchat url, user_id and token are required")
+	}
+
+	backend := &rocketChatBackend{
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		userID:     cfg.UserID,
+		token:      cfg.Token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	return newTeamChatChannel("rocketchat", cfg, messageBus, cfg.AllowFrom, backend, teamChatOptions{
+		channels:      cfg.Channels,
+		mentionOnly:   cfg.MentionOnly,
+		threadReplies: cfg.ThreadReplies,
+	}), nil
+}
+
+type rocketChatBackend struct {
+	baseURL    string
+	userID     string
+	token      string
+	username   string
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	conn *websocket.Conn // current realtime connection, used for typing notifications
+}
+
+// rocketChatDDP is a DDP frame; only the fields we use are decoded.
+type rocketChatDDP struct {
+	Msg        string `json:"msg"`
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	Error      *struct {
+		Reason string `json:"reason"`
+	} `json:"error"`
+	Fields struct {
+		Args []json.RawMessage `json:"args"`
+	} `json:"fields"`
+}
+
+type rocketChatMessage struct {
+	ID       string `json:"_id"`
+	RoomID   string `json:"rid"`
+	Text     string `json:"msg"`
+	ThreadID string `json:"tmid"`
+	Type     string `json:"t"`
+	EditedAt any    `json:"editedAt"`
+	User     struct {
+		ID       string `json:"_id"`
+		Username string `json:"username"`
+	} `json:"u"`
+	Mentions []struct {
+		ID string `json:"_id"`
+	} `json:"mentions"`
+}
+
+type rocketChatRoomInfo struct {
+	RoomType string `json:"roomType"`
+	RoomName string `json:"roomName"`
+}
+
+func (b *rocketChatBackend) connect(ctx context.Context) (string, string, error) {
+	var me struct {
+		ID       string `json:"_id"`
+		Username string `json:"username"`
+	}
+	if err := b.api(ctx, http.MethodGet, "/api/v1/me", nil, &me); err != nil {
+		return "", "", err
+	}
+	b.username = me.Username
+	return me.ID, me.Username, nil
+}
+
+func (b *rocketChatBackend) listen(ctx context.Context, handle func(teamChatPost)) error {
+	wsURL, err := url.Parse(b.baseURL + "/websocket")
+	if err != nil {
+		return err
+	}
+	if wsURL.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	} else {
+		wsURL.Scheme = "ws"
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("websocket dial: %w", err)
+	}
+	defer conn.Close()
+
+	b.mu.Lock()
+	b.conn = conn
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+	}()
+
+	for _, frame := range []map[string]any{
+		{"msg": "connect", "version": "1", "support": []string{"1"}},
+		{"msg": "method", "method": "login", "id": "login", "params": []any{map[string]string{"resume": b.token}}},
+		{"msg": "sub", "id": "messages", "name": "stream-room-messages", "params": []any{"__my_messages__", false}},
+	} {
+		if err := b.writeFrame(frame); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var frame rocketChatDDP
+		if err := json.Unmarshal(data, &frame); err != nil {
+			continue
+		}
+		switch {
+		case frame.Msg == "ping":
+			b.writeFrame(map[string]string{"msg": "pong"})
+		case frame.Msg == "result" && frame.ID == "login" && frame.Error != nil:
+			return fmt.Errorf("realtime login failed: %s", frame.Error.Reason)
+		case frame.Msg == "changed" && frame.Collection == "stream-room-messages":
+			if post, ok := b.parseMessage(frame.Fields.Args); ok {
+				handle(post)
+			}
+		}
+	}
+}
+
+func (b *rocketChatBackend) parseMessage(args []json.RawMessage) (teamChatPost, bool) {
+	if len(args) == 0 {
+		return teamChatPost{}, false
+	}
+	var msg rocketChatMessage
+	if err := json.Unmarshal(args[0], &msg); err != nil {
+		return teamChatPost{}, false
+	}
+	// Skip system messages and edits, which are re-broadcast on the stream.
+	if msg.Type != "" || msg.EditedAt != nil {
+		return teamChatPost{}, false
+	}
+
+	var room rocketChatRoomInfo
+	if len(args) > 1 {
+		json.Unmarshal(args[1], &room)
+	}
+
+	mentioned := false
+	for _, m := range msg.Mentions {
+		if m.ID == b.userID {
+			mentioned = true
+		}
+	}
+
+	return teamChatPost{
+		ID:          msg.ID,
+		ChannelID:   msg.RoomID,
+		ChannelName: room.RoomName,
+		RootID:      msg.ThreadID,
+		UserID:      msg.User.ID,
+		Username:    msg.User.Username,
+		Text:        msg.Text,
+		Direct:      room.RoomType == "d",
+		Mentioned:   mentioned,
+	}, true
+}
+
+func (b *rocketChatBackend) post(ctx context.Context, channelID, rootID, text string) error {
+	message := map[string]string{"rid": channelID, "msg": text}
+	if rootID != "" {
+		message["tmid"] = rootID
+	}
+	return b.api(ctx, http.MethodPost, "/api/v1/chat.sendMessage", map[string]any{"message": message}, nil)
+}
+
+// typing has no REST endpoint in Rocket.Chat, so it goes over the realtime
+// connection when one is open.
+func (b *rocketChatBackend) typing(ctx context.Context, channelID, rootID string) {
+	extra := map[string]string{}
+	if rootID != "" {
+		extra["tmid"] = rootID
+	}
+	b.writeFrame(map[string]any{
+		"msg":    "method",
+		"method": "stream-notify-room",
+		"id":     "typing",
+		"params": []any{channelID + "/user-activity", b.username, []string{"user-typing"}, extra},
+	})
+}
+
+func (b *rocketChatBackend) maxMessageLength() int {
+	return rocketChatMaxMessageLength
+}
+
+func (b *rocketChatBackend) writeFrame(frame any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return fmt.Errorf("realtime connection not open")
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return b.conn.WriteJSON(frame)
+}
+
+func (b *rocketChatBackend) api(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-User-Id", b.userID)
+	req.Header.Set("X-Auth-Token", b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
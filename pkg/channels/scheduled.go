@@ -0,0 +1,126 @@
+package channels
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+)
+
+// ScheduledMessage is a message waiting in the outbox to be sent at
+// SendAt. It goes through the outbound hooks when it is sent, not when it
+// is scheduled.
+type ScheduledMessage struct {
+	ID      string              `json:"id"`
+	Message bus.OutboundMessage `json:"message"`
+	SendAt  time.Time           `json:"send_at"`
+	By      string              `json:"by,omitempty"` // e.g. "telegram:123456" or "admin_api:10.0.0.2"
+	Created time.Time           `json:"created"`
+}
+
+// ErrNoScheduledMessage is returned for an ID no message waits under.
+var ErrNoScheduledMessage = errors.New("no such scheduled message")
+
+// maxScheduleAhead is how far ahead a message may be scheduled.
+const maxScheduleAhead = 366 * 24 * time.Hour
+
+// ScheduleMessage keeps msg in the outbox until at and sends it then,
+// retried like a reply when that fails. by names who scheduled it. The
+// message survives restarts; one whose time passed while the gateway was
+// down is sent when it starts.
+func (m *Manager) ScheduleMessage(msg bus.OutboundMessage, at time.Time, by string) (ScheduledMessage, error) {
+	if strings.TrimSpace(msg.Content) == "" && len(msg.Attachments) == 0 {
+		return ScheduledMessage{}, errors.New("the message is empty")
+	}
+	if msg.ChatID == "" || constants.IsInternalChannel(msg.Channel) {
+		return ScheduledMessage{}, errors.New("a channel and chat ID to send to are needed")
+	}
+	if _, ok := m.GetChannel(msg.Channel); !ok {
+		return ScheduledMessage{}, fmt.Errorf("channel %s not found", msg.Channel)
+	}
+	now := m.outbox.now()
+	if at.Before(now.Add(-time.Minute)) {
+		return ScheduledMessage{}, fmt.Errorf("%s has passed", at.Format(time.RFC3339))
+	}
+	if at.After(now.Add(maxScheduleAhead)) {
+		return ScheduledMessage{}, errors.New("messages can be scheduled at most a year ahead")
+	}
+	return m.outbox.schedule(msg, at, by), nil
+}
+
+// ScheduledMessages returns the messages waiting for their time, soonest
+// first.
+func (m *Manager) ScheduledMessages() []ScheduledMessage {
+	return m.outbox.scheduledMessages()
+}
+
+// CancelScheduled takes the scheduled message id out of the outbox, so it
+// is never sent.
+func (m *Manager) CancelScheduled(id string) (ScheduledMessage, error) {
+	return m.outbox.cancel(id)
+}
+
+// DropScheduled takes the scheduled messages match picks out of the
+// outbox, so they are never sent, and returns how many it took.
+func (m *Manager) DropScheduled(match func(ScheduledMessage) bool) int {
+	o := m.outbox
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.dropLocked(func(d *pendingDelivery) bool {
+		return d.scheduled() && match(d.scheduledMessage())
+	})
+}
+
+func (o *outbox) schedule(msg bus.OutboundMessage, at time.Time, by string) ScheduledMessage {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	d := &pendingDelivery{
+		ID:          hex.EncodeToString(b),
+		Message:     msg,
+		NextAttempt: at,
+		Created:     o.now(),
+		SendAt:      at,
+		By:          by,
+	}
+	o.mu.Lock()
+	o.pending = append(o.pending, d)
+	o.saveLocked()
+	o.mu.Unlock()
+	return d.scheduledMessage()
+}
+
+func (o *outbox) scheduledMessages() []ScheduledMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []ScheduledMessage
+	for _, d := range o.pending {
+		if d.scheduled() {
+			out = append(out, d.scheduledMessage())
+		}
+	}
+	slices.SortFunc(out, func(a, b ScheduledMessage) int { return a.SendAt.Compare(b.SendAt) })
+	return out
+}
+
+func (o *outbox) cancel(id string) (ScheduledMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, d := range o.pending {
+		if d.ID == id && d.scheduled() {
+			o.removeLocked(d)
+			o.saveLocked()
+			return d.scheduledMessage(), nil
+		}
+	}
+	return ScheduledMessage{}, ErrNoScheduledMessage
+}
+
+func (d *pendingDelivery) scheduledMessage() ScheduledMessage {
+	return ScheduledMessage{ID: d.ID, Message: d.Message, SendAt: d.SendAt, By: d.By, Created: d.Created}
+}
@@ -0,0 +1,438 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const signalGroupPrefix = "group:"
+
+// SignalChannel talks to a signal-cli daemon started in HTTP mode
+// (signal-cli daemon --http), using JSON-RPC for requests and the
+// server-sent event stream for incoming messages.
+type SignalChannel struct {
+	*BaseChannel
+	config      config.SignalConfig
+	baseURL     string
+	httpClient  *http.Client
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	rpcID       atomic.Int64
+}
+
+type signalEnvelope struct {
+	Source       string             `json:"source"`
+	SourceNumber string             `json:"sourceNumber"`
+	SourceUUID   string             `json:"sourceUuid"`
+	SourceName   string             `json:"sourceName"`
+	Timestamp    int64              `json:"timestamp"`
+	DataMessage  *signalDataMessage `json:"dataMessage"`
+}
+
+type signalDataMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+	GroupInfo *struct {
+		GroupID string `json:"groupId"`
+	} `json:"groupInfo"`
+	Attachments []signalAttachment `json:"attachments"`
+}
+
+type signalAttachment struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+}
+
+type signalRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewSignalChannel(cfg config.SignalConfig, messageBus *bus.MessageBus) (*SignalChannel, error) {
+	if cfg.URL == "" || cfg.Account == "" {
+		return nil, fmt.Errorf("signal url and account are required")
+	}
+
+	base := NewBaseChannel("signal", cfg, messageBus, cfg.AllowFrom)
+
+	return &SignalChannel{
+		BaseChannel: base,
+		config:      cfg,
+		baseURL:     strings.TrimRight(cfg.URL, "/"),
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *SignalChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *SignalChannel) Start(ctx context.Context) error {
+	logger.InfoCF("signal", "Starting Signal channel", map[string]any{
+		"url": c.baseURL,
+	})
+
+	if err := c.call(ctx, "version", map[string]any{}, nil); err != nil {
+		return fmt.Errorf("signal-cli daemon not reachable: %w", err)
+	}
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.eventLoop()
+
+	c.setRunning(true)
+	logger.InfoC("signal", "Signal channel started")
+	return nil
+}
+
+func (c *SignalChannel) Stop(ctx context.Context) error {
+	logger.InfoC("signal", "Stopping Signal channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("signal", "Signal channel stopped")
+	return nil
+}
+
+// Capabilities reports plain text, as Signal shows Markdown literally.
+func (c *SignalChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Plain}
+}
+
+func (c *SignalChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("signal channel not running")
+	}
+	if msg.ChatID == "" {
+		return fmt.Errorf("signal chat ID is empty")
+	}
+
+	c.sendTyping(ctx, msg.ChatID, true)
+
+	params := signalTarget(msg.ChatID)
+	params["message"] = format.Format(msg.Content, c.Capabilities().Markdown)
+	if err := c.call(ctx, "send", params, nil); err != nil {
+		return fmt.Errorf("failed to send signal message: %w", err)
+	}
+
+	logger.DebugCF("signal", "Message sent", map[string]any{
+		"chat_id": msg.ChatID,
+	})
+	return nil
+}
+
+func (c *SignalChannel) eventLoop() {
+	backoff := time.Second
+	for {
+		err := c.readEvents()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.WarnCF("signal", "Event stream disconnected, reconnecting", map[string]any{
+				"error":   err.Error(),
+				"backoff": backoff.String(),
+			})
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (c *SignalChannel) readEvents() error {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.baseURL+"/api/v1/events", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The event stream is long-lived, so it must not share the client timeout.
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	logger.DebugC("signal", "Connected to event stream")
+	return readSSE(resp.Body, c.handleEventData)
+}
+
+// readSSE parses a server-sent event stream and invokes handle with the data
+// payload of each event.
+func readSSE(r io.Reader, handle func(data []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				handle(data.Bytes())
+				data.Reset()
+			}
+			continue
+		}
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(payload, " "))
+		}
+	}
+	if data.Len() > 0 {
+		handle(data.Bytes())
+	}
+	return scanner.Err()
+}
+
+func (c *SignalChannel) handleEventData(data []byte) {
+	var notification struct {
+		Method string `json:"method"`
+		Params struct {
+			Account  string         `json:"account"`
+			Envelope signalEnvelope `json:"envelope"`
+		} `json:"params"`
+		// signal-cli also emits bare envelopes on older versions
+		Envelope *signalEnvelope `json:"envelope"`
+	}
+	if err := json.Unmarshal(data, &notification); err != nil {
+		logger.DebugCF("signal", "Failed to decode event", map[string]any{"error": err.Error()})
+		return
+	}
+
+	envelope := notification.Params.Envelope
+	if notification.Envelope != nil {
+		envelope = *notification.Envelope
+	} else if notification.Method != "receive" {
+		return
+	}
+	if notification.Params.Account != "" && notification.Params.Account != c.config.Account {
+		return
+	}
+
+	c.handleEnvelope(envelope)
+}
+
+func (c *SignalChannel) handleEnvelope(env signalEnvelope) {
+	if env.DataMessage == nil {
+		return
+	}
+
+	number := env.SourceNumber
+	if number == "" {
+		number = env.Source
+	}
+	if number == "" {
+		number = env.SourceUUID
+	}
+	if number == "" || number == c.config.Account {
+		return
+	}
+
+	// Use the "id|alias" form so allowlists may list either the phone
+	// number or the account UUID.
+	senderID := number
+	if env.SourceUUID != "" && env.SourceUUID != number {
+		senderID = number + "|" + env.SourceUUID
+	}
+
+	// check allowlist to avoid handling attachments for rejected users
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("signal", "Message rejected by allowlist", map[string]any{
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	dm := env.DataMessage
+	content := dm.Message
+	var mediaPaths []string
+	for _, att := range dm.Attachments {
+		path, text := c.resolveAttachment(att)
+		if path != "" {
+			mediaPaths = append(mediaPaths, path)
+		}
+		content = appendContent(content, text)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	chatID := number
+	peerKind := "direct"
+	peerID := number
+	if dm.GroupInfo != nil && dm.GroupInfo.GroupID != "" {
+		chatID = signalGroupPrefix + dm.GroupInfo.GroupID
+		peerKind = "group"
+		peerID = dm.GroupInfo.GroupID
+	}
+
+	if c.config.SendReadReceipts {
+		c.sendReceipt(number, dm.Timestamp)
+	}
+	c.sendTyping(c.ctx, chatID, false)
+
+	metadata := map[string]string{
+		"message_id": fmt.Sprintf("%d", dm.Timestamp),
+		"user_id":    env.SourceUUID,
+		"user_name":  env.SourceName,
+		"platform":   "signal",
+		"peer_kind":  peerKind,
+		"peer_id":    peerID,
+	}
+
+	logger.DebugCF("signal", "Received message", map[string]any{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+// resolveAttachment maps an attachment to the file signal-cli stored for it
+// and returns the local path together with a text marker for the agent.
+func (c *SignalChannel) resolveAttachment(att signalAttachment) (string, string) {
+	name := att.Filename
+	if name == "" {
+		name = att.ID
+	}
+	dir := c.config.AttachmentsPath()
+	if dir == "" || att.ID == "" {
+		return "", fmt.Sprintf("[file: %s]", name)
+	}
+
+	path := filepath.Join(dir, filepath.Base(att.ID))
+	if _, err := os.Stat(path); err != nil {
+		logger.DebugCF("signal", "Attachment not found", map[string]any{
+			"path":  path,
+			"error": err.Error(),
+		})
+		return "", fmt.Sprintf("[file: %s (unavailable)]", name)
+	}
+
+	if utils.IsAudioFile(name, att.ContentType) && c.transcriber != nil && c.transcriber.IsAvailable() {
+		ctx, cancel := context.WithTimeout(c.ctx, transcriptionTimeout)
+		defer cancel()
+		result, err := c.transcriber.Transcribe(ctx, path)
+		if err != nil {
+			logger.ErrorCF("signal", "Voice transcription failed", map[string]any{"error": err.Error()})
+			return path, fmt.Sprintf("[audio: %s (transcription failed)]", name)
+		}
+		return path, fmt.Sprintf("[voice transcription: %s]", result.Text)
+	}
+
+	return path, fmt.Sprintf("[file: %s]", name)
+}
+
+func (c *SignalChannel) sendReceipt(recipient string, timestamp int64) {
+	params := map[string]any{
+		"recipient":       recipient,
+		"targetTimestamp": []int64{timestamp},
+		"type":            "read",
+	}
+	if err := c.call(c.ctx, "sendReceipt", params, nil); err != nil {
+		logger.DebugCF("signal", "Failed to send read receipt", map[string]any{"error": err.Error()})
+	}
+}
+
+func (c *SignalChannel) sendTyping(ctx context.Context, chatID string, stop bool) {
+	params := signalTarget(chatID)
+	params["stop"] = stop
+	if err := c.call(ctx, "sendTyping", params, nil); err != nil {
+		logger.DebugCF("signal", "Failed to send typing indicator", map[string]any{"error": err.Error()})
+	}
+}
+
+// signalTarget builds the recipient parameters for a chat ID, which is either
+// a phone number/UUID or "group:<groupId>".
+func signalTarget(chatID string) map[string]any {
+	if groupID, ok := strings.CutPrefix(chatID, signalGroupPrefix); ok {
+		return map[string]any{"groupId": groupID}
+	}
+	return map[string]any{"recipient": []string{chatID}}
+}
+
+func (c *SignalChannel) call(ctx context.Context, method string, params map[string]any, out any) error {
+	if params == nil {
+		params = map[string]any{}
+	}
+	params["account"] = c.config.Account
+
+	payload, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      c.rpcID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/rpc", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, utils.Truncate(string(body), 200))
+	}
+
+	var rpcResp signalRPCResponse
+	if err := json.Unmarshal(body, &rpcResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("%s (code %d)", rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+	if out != nil && len(rpcResp.Result) > 0 {
+		return json.Unmarshal(rpcResp.Result, out)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestReadSSE(t *testing.T) {
+	stream := "event: receive\ndata: {\"a\":1}\n\n: comment\ndata: line1\ndata: line2\n\ndata: tail"
+
+	var got []string
+	if err := readSSE(strings.NewReader(stream), func(data []byte) {
+		got = append(got, string(data))
+	}); err != nil {
+		t.Fatalf("readSSE() error = %v", err)
+	}
+
+	want := []string{`{"a":1}`, "line1\nline2", "tail"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSignalTarget(t *testing.T) {
+	direct := signalTarget("+15551234567")
+	if r, ok := direct["recipient"].([]string); !ok || len(r) != 1 || r[0] != "+15551234567" {
+		t.Errorf("unexpected direct target: %v", direct)
+	}
+
+	group := signalTarget("group:abc==")
+	if group["groupId"] != "abc==" {
+		t.Errorf("unexpected group target: %v", group)
+	}
+}
+
+type signalRPCRecorder struct {
+	mu    sync.Mutex
+	calls []map[string]any
+}
+
+func (r *signalRPCRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var call map[string]any
+	json.Unmarshal(body, &call)
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+	w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+}
+
+func (r *signalRPCRecorder) methods() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var methods []string
+	for _, call := range r.calls {
+		methods = append(methods, call["method"].(string))
+	}
+	return methods
+}
+
+func TestSignalChannel_HandleEventData(t *testing.T) {
+	recorder := &signalRPCRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewSignalChannel(config.SignalConfig{
+		URL:              server.URL,
+		Account:          "+10000000000",
+		SendReadReceipts: true,
+		AllowFrom:        config.FlexibleStringSlice{"uuid-alice"},
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewSignalChannel() error = %v", err)
+	}
+	ch.ctx = context.Background()
+
+	event := `{"jsonrpc":"2.0","method":"receive","params":{"account":"+10000000000","envelope":{
+		"sourceNumber":"+15551234567","sourceUuid":"uuid-alice","sourceName":"Alice","timestamp":42,
+		"dataMessage":{"timestamp":42,"message":"hello","groupInfo":{"groupId":"grp=="}}}}}`
+	ch.handleEventData([]byte(event))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.ChatID != "group:grp==" || msg.Content != "hello" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "group" || msg.Metadata["peer_id"] != "grp==" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+
+	methods := recorder.methods()
+	if len(methods) != 2 || methods[0] != "sendReceipt" || methods[1] != "sendTyping" {
+		t.Errorf("unexpected RPC calls: %v", methods)
+	}
+
+	// Messages from other accounts on a multi-account daemon are ignored.
+	other := strings.Replace(event, `"account":"+10000000000"`, `"account":"+19999999999"`, 1)
+	ch.handleEventData([]byte(other))
+	select {
+	case m := <-drainInbound(msgBus):
+		t.Errorf("unexpected message for other account: %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func drainInbound(msgBus *bus.MessageBus) <-chan bus.InboundMessage {
+	out := make(chan bus.InboundMessage, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+			out <- msg
+		}
+	}()
+	return out
+}
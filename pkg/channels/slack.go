@@ -3,9 +3,7 @@ package channels
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/slack-go/slack"
@@ -14,11 +12,17 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
+// Slack truncates messages after 40k characters but recommends staying
+// under 4k for readability.
+const slackMaxMessageLength = 4000
+
 type SlackChannel struct {
 	*BaseChannel
 	config       config.SlackConfig
@@ -29,12 +33,6 @@ type SlackChannel struct {
 	transcriber  *voice.GroqTranscriber
 	ctx          context.Context
 	cancel       context.CancelFunc
-	pendingAcks  sync.Map
-}
-
-type slackMessageRef struct {
-	ChannelID string
-	Timestamp string
 }
 
 func NewSlackChannel(cfg config.SlackConfig, messageBus *bus.MessageBus) (*SlackChannel, error) {
@@ -109,6 +107,16 @@ func (c *SlackChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Capabilities reports Slack's mrkdwn and message limit.
+func (c *SlackChannel) Capabilities() Capabilities {
+	return Capabilities{
+		Markdown:         format.Slack,
+		MaxMessageLength: slackMaxMessageLength,
+		Reactions:        true,
+		Attachments:      true,
+	}
+}
+
 func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
 		return fmt.Errorf("slack channel not running")
@@ -119,25 +127,17 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
 
-	opts := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
-	}
-
-	if threadTS != "" {
-		opts = append(opts, slack.MsgOptionTS(threadTS))
-	}
-
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
-	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
-	}
+	for _, chunk := range c.Capabilities().Render(msg.Content) {
+		opts := []slack.MsgOption{
+			slack.MsgOptionText(chunk, false),
+		}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
 
-	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
-		msgRef := ref.(slackMessageRef)
-		c.api.AddReaction("white_check_mark", slack.ItemRef{
-			Channel:   msgRef.ChannelID,
-			Timestamp: msgRef.Timestamp,
-		})
+		if _, _, err := c.api.PostMessageContext(ctx, channelID, opts...); err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
 	}
 
 	logger.DebugCF("slack", "Message sent", map[string]any{
@@ -190,6 +190,17 @@ func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 }
 
 func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
+	// Deletions carry no user; the chat is the thread the message was in.
+	if ev.SubType == "message_deleted" {
+		chatID := ev.Channel
+		if prev := ev.PreviousMessage; prev != nil {
+			if thread := prev.ThreadTimestamp; thread != "" && thread != ev.DeletedTimeStamp {
+				chatID = ev.Channel + "/" + thread
+			}
+		}
+		c.HandleDeletion(chatID, ev.DeletedTimeStamp)
+		return
+	}
 	if ev.User == c.botUserID || ev.User == "" {
 		return
 	}
@@ -218,47 +229,30 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		chatID = channelID + "/" + threadTS
 	}
 
-	c.api.AddReaction("eyes", slack.ItemRef{
-		Channel:   channelID,
-		Timestamp: messageTS,
-	})
-
-	c.pendingAcks.Store(chatID, slackMessageRef{
-		ChannelID: channelID,
-		Timestamp: messageTS,
-	})
-
 	content := ev.Text
 	content = c.stripBotMention(content)
 
-	var mediaPaths []string
-	localFiles := []string{} // track local files that need cleanup
-
-	// ensure temp files are cleaned up when function returns
-	defer func() {
-		for _, file := range localFiles {
-			if err := os.Remove(file); err != nil {
-				logger.DebugCF("slack", "Failed to cleanup temp file", map[string]any{
-					"file":  file,
-					"error": err.Error(),
-				})
-			}
-		}
-	}()
+	var attachments []bus.Attachment
 
 	if ev.Message != nil && len(ev.Message.Files) > 0 {
 		for _, file := range ev.Message.Files {
-			localPath := c.downloadSlackFile(file)
-			if localPath == "" {
+			att, ok := c.slackAttachment(file)
+			if !ok {
 				continue
 			}
-			localFiles = append(localFiles, localPath)
-			mediaPaths = append(mediaPaths, localPath)
 
-			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
+			if att.Type == bus.AttachmentAudio && c.transcriber != nil && c.transcriber.IsAvailable() {
+				fetched, err := c.FetchAttachment(c.ctx, att)
+				if err != nil {
+					logger.ErrorCF("slack", "Failed to download audio file", map[string]any{"error": err.Error()})
+					content += fmt.Sprintf("\n[audio: %s (download failed)]", file.Name)
+					continue
+				}
+				attachments = append(attachments, fetched)
+
 				ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
 				defer cancel()
-				result, err := c.transcriber.Transcribe(ctx, localPath)
+				result, err := c.transcriber.Transcribe(ctx, fetched.Path)
 
 				if err != nil {
 					logger.ErrorCF("slack", "Voice transcription failed", map[string]any{"error": err.Error()})
@@ -267,12 +261,12 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 					content += fmt.Sprintf("\n[voice transcription: %s]", result.Text)
 				}
 			} else {
-				content += fmt.Sprintf("\n[file: %s]", file.Name)
+				attachments = append(attachments, att)
 			}
 		}
 	}
 
-	if strings.TrimSpace(content) == "" {
+	if strings.TrimSpace(content) == "" && len(attachments) == 0 {
 		return
 	}
 
@@ -284,9 +278,11 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	}
 
 	metadata := map[string]string{
+		"message_id": messageTS,
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
+		"thread_id":  threadTS, // replies in a thread get their own session
 		"platform":   "slack",
 		"peer_kind":  peerKind,
 		"peer_id":    peerID,
@@ -300,7 +296,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		"has_thread": threadTS != "",
 	})
 
-	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+	c.HandleMessageWithAttachments(senderID, chatID, content, attachments, metadata)
 }
 
 func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
@@ -320,22 +316,12 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 	threadTS := ev.ThreadTimeStamp
 	messageTS := ev.TimeStamp
 
-	var chatID string
-	if threadTS != "" {
-		chatID = channelID + "/" + threadTS
-	} else {
-		chatID = channelID + "/" + messageTS
+	// The reply goes into a thread, a new one rooted at the mention if needed.
+	threadID := threadTS
+	if threadID == "" {
+		threadID = messageTS
 	}
-
-	c.api.AddReaction("eyes", slack.ItemRef{
-		Channel:   channelID,
-		Timestamp: messageTS,
-	})
-
-	c.pendingAcks.Store(chatID, slackMessageRef{
-		ChannelID: channelID,
-		Timestamp: messageTS,
-	})
+	chatID := channelID + "/" + threadID
 
 	content := c.stripBotMention(ev.Text)
 
@@ -351,9 +337,11 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 	}
 
 	metadata := map[string]string{
+		"message_id": messageTS,
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
+		"thread_id":  threadID,
 		"platform":   "slack",
 		"is_mention": "true",
 		"peer_kind":  mentionPeerKind,
@@ -409,22 +397,40 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
 
-func (c *SlackChannel) downloadSlackFile(file slack.File) string {
+// SendAttachment uploads a file into the channel or thread.
+func (c *SlackChannel) SendAttachment(ctx context.Context, chatID string, att bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+	channelID, threadTS := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+	_, err := c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		File:            att.Path,
+		FileSize:        int(att.Size),
+		Filename:        att.Name,
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+	})
+	return err
+}
+
+func (c *SlackChannel) slackAttachment(file slack.File) (bus.Attachment, bool) {
 	downloadURL := file.URLPrivateDownload
 	if downloadURL == "" {
 		downloadURL = file.URLPrivate
 	}
 	if downloadURL == "" {
 		logger.ErrorCF("slack", "No download URL for file", map[string]any{"file_id": file.ID})
-		return ""
+		return bus.Attachment{}, false
 	}
 
-	return utils.DownloadFile(downloadURL, file.Name, utils.DownloadOptions{
-		LoggerPrefix: "slack",
-		ExtraHeaders: map[string]string{
-			"Authorization": "Bearer " + c.config.BotToken,
-		},
+	att := media.FromURL(downloadURL, file.Name, file.Mimetype, map[string]string{
+		"Authorization": "Bearer " + c.config.BotToken,
 	})
+	att.Size = int64(file.Size)
+	return att, true
 }
 
 func (c *SlackChannel) stripBotMention(text string) string {
@@ -433,6 +439,53 @@ func (c *SlackChannel) stripBotMention(text string) string {
 	return strings.TrimSpace(text)
 }
 
+// CheckHealth confirms the bot token still authenticates.
+func (c *SlackChannel) CheckHealth(ctx context.Context) error {
+	if _, err := c.api.AuthTestContext(ctx); err != nil {
+		return fmt.Errorf("slack auth test failed: %w", err)
+	}
+	return nil
+}
+
+func (c *SlackChannel) AddReaction(ctx context.Context, chatID, messageID, emoji string) error {
+	channelID, _ := parseSlackChatID(chatID)
+	return c.api.AddReactionContext(ctx, slackEmojiName(emoji), slack.ItemRef{
+		Channel:   channelID,
+		Timestamp: messageID,
+	})
+}
+
+func (c *SlackChannel) RemoveReaction(ctx context.Context, chatID, messageID, emoji string) error {
+	channelID, _ := parseSlackChatID(chatID)
+	return c.api.RemoveReactionContext(ctx, slackEmojiName(emoji), slack.ItemRef{
+		Channel:   channelID,
+		Timestamp: messageID,
+	})
+}
+
+// slackEmojiNames maps emoji to the names Slack's reaction API expects.
+var slackEmojiNames = map[string]string{
+	"👀":   "eyes",
+	"👍":   "+1",
+	"👎":   "-1",
+	"😢":   "cry",
+	"✅":   "white_check_mark",
+	"❌":   "x",
+	"⏳":   "hourglass_flowing_sand",
+	"🤔":   "thinking_face",
+	"🔥":   "fire",
+	"🎉":   "tada",
+	"👨‍💻": "male-technologist",
+}
+
+// slackEmojiName accepts an emoji character, ":name:" or a bare name.
+func slackEmojiName(emoji string) string {
+	if name, ok := slackEmojiNames[emoji]; ok {
+		return name
+	}
+	return strings.Trim(emoji, ":")
+}
+
 func parseSlackChatID(chatID string) (channelID, threadTS string) {
 	parts := strings.SplitN(chatID, "/", 2)
 	channelID = parts[0]
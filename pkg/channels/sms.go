@@ -0,0 +1,448 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/handoff"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	twilioAPIBase = "https://api.twilio.com/2010-04-01"
+	// twilioMaxBody is the longest body Twilio accepts; it splits and
+	// rejoins longer texts as a concatenated SMS itself.
+	twilioMaxBody = 1600
+)
+
+// SMSChannel makes the agent reachable by plain text message, either through
+// Twilio (webhook in, REST API out) or a GSM modem driven with AT commands.
+// Each phone number is its own chat.
+type SMSChannel struct {
+	*BaseChannel
+	config     config.SMSConfig
+	httpServer *http.Server
+	httpClient *http.Client
+	apiBase    string
+	modem      *smsModem
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func NewSMSChannel(cfg config.SMSConfig, messageBus *bus.MessageBus) (*SMSChannel, error) {
+	switch cfg.Provider {
+	case "", "twilio":
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioFrom == "" {
+			return nil, fmt.Errorf("sms twilio_account_sid, twilio_auth_token and twilio_from are required")
+		}
+		cfg.Provider = "twilio"
+	case "modem":
+		if cfg.ModemDevice == "" {
+			return nil, fmt.Errorf("sms modem_device is required")
+		}
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q (want twilio or modem)", cfg.Provider)
+	}
+
+	return &SMSChannel{
+		BaseChannel: NewBaseChannel("sms", cfg, messageBus, smsAllowList(cfg.AllowFrom)),
+		config:      cfg,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		apiBase:     twilioAPIBase,
+	}, nil
+}
+
+func smsAllowList(numbers []string) []string {
+	allowFrom := make([]string, 0, len(numbers))
+	for _, number := range numbers {
+		allowFrom = append(allowFrom, normalizePhoneNumber(number))
+	}
+	return allowFrom
+}
+
+// SetAllowList replaces the allowlist, normalizing its numbers.
+func (c *SMSChannel) SetAllowList(numbers []string) error {
+	return c.BaseChannel.SetAllowList(smsAllowList(numbers))
+}
+
+func (c *SMSChannel) Start(ctx context.Context) error {
+	logger.InfoCF("sms", "Starting SMS channel", map[string]any{
+		"provider": c.config.Provider,
+	})
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	if c.config.Provider == "modem" {
+		modem, err := openSMSModem(c.config.ModemDevice, c.config.ModemBaudRate)
+		if err != nil {
+			return fmt.Errorf("sms modem: %w", err)
+		}
+		if err := modem.init(); err != nil {
+			modem.Close()
+			return fmt.Errorf("sms modem: %w", err)
+		}
+		c.modem = modem
+		go c.pollModem()
+	} else {
+		mux := http.NewServeMux()
+		mux.HandleFunc(c.config.WebhookPath, c.twilioWebhook)
+		addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
+		c.httpServer = &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			logger.InfoCF("sms", "Twilio webhook server listening", map[string]any{
+				"addr": addr,
+				"path": c.config.WebhookPath,
+			})
+			if err := handoff.ListenAndServe(c.httpServer); err != nil && err != http.ErrServerClosed {
+				logger.ErrorCF("sms", "Webhook server error", map[string]any{
+					"error": err.Error(),
+				})
+			}
+		}()
+	}
+
+	c.setRunning(true)
+	logger.InfoC("sms", "SMS channel started")
+	return nil
+}
+
+func (c *SMSChannel) Stop(ctx context.Context) error {
+	logger.InfoC("sms", "Stopping SMS channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		c.httpServer.Shutdown(shutdownCtx)
+	}
+	if c.modem != nil {
+		c.modem.Close()
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Capabilities reports plain text. The limit is one SMS on a modem, or
+// Twilio's longest body, which it sends as a concatenated SMS.
+func (c *SMSChannel) Capabilities() Capabilities {
+	if c.config.Provider == "modem" {
+		return Capabilities{Markdown: format.Plain, MaxMessageLength: 160}
+	}
+	return Capabilities{Markdown: format.Plain, MaxMessageLength: twilioMaxBody}
+}
+
+// Send delivers a reply as plain text, split into as many SMS as needed up
+// to MaxMessages.
+func (c *SMSChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("sms channel not running")
+	}
+	text := format.Format(msg.Content, c.Capabilities().Markdown)
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	if c.modem != nil {
+		for _, part := range splitSMS(text, smsSegmentLimit(text), c.config.MaxMessages) {
+			if err := c.modem.sendSMS(msg.ChatID, part); err != nil {
+				return fmt.Errorf("sms send: %w", err)
+			}
+		}
+		return nil
+	}
+	for _, part := range splitSMS(text, twilioMaxBody, c.config.MaxMessages) {
+		if err := c.sendTwilio(ctx, msg.ChatID, part); err != nil {
+			return fmt.Errorf("sms send: %w", err)
+		}
+	}
+	return nil
+}
+
+// CheckHealth checks that the modem still answers. Twilio has nothing
+// long-lived to check.
+func (c *SMSChannel) CheckHealth(ctx context.Context) error {
+	if c.modem == nil {
+		return nil
+	}
+	_, err := c.modem.command("AT", smsModemTimeout)
+	return err
+}
+
+func (c *SMSChannel) sendTwilio(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", c.config.TwilioFrom)
+	form.Set("Body", body)
+
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", c.apiBase, c.config.TwilioAccountSID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.config.TwilioAccountSID, c.config.TwilioAuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("twilio: %s (code %d)", apiErr.Message, apiErr.Code)
+		}
+		return fmt.Errorf("twilio returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// twilioWebhook receives incoming messages. Requests must carry a valid
+// X-Twilio-Signature; the reply goes out later through the REST API, so
+// the response is an empty TwiML document.
+func (c *SMSChannel) twilioWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if !c.verifyTwilioSignature(c.webhookURL(r), r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+		logger.WarnC("sms", "Invalid Twilio signature")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	io.WriteString(w, "<Response></Response>")
+
+	c.handleSMS(r.PostForm.Get("From"), r.PostForm.Get("Body"), r.PostForm.Get("MessageSid"))
+}
+
+// webhookURL is the URL Twilio signed: the configured public URL, or the
+// one the request was made to.
+func (c *SMSChannel) webhookURL(r *http.Request) string {
+	if c.config.WebhookURL != "" {
+		return c.config.WebhookURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// verifyTwilioSignature implements Twilio's request validation: an
+// HMAC-SHA1 over the URL followed by the sorted POST parameters.
+func (c *SMSChannel) verifyTwilioSignature(rawURL string, params url.Values, signature string) bool {
+	if signature == "" {
+		return false
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(rawURL)
+	for _, k := range keys {
+		for _, v := range params[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(c.config.TwilioAuthToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (c *SMSChannel) pollModem() {
+	interval := time.Duration(max(c.config.ModemPollSeconds, 1)) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.readModem()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readModem hands every stored message to the agent and deletes it from
+// the SIM, so a message is never processed twice.
+func (c *SMSChannel) readModem() {
+	msgs, err := c.modem.list()
+	if err != nil {
+		if c.ctx.Err() == nil {
+			logger.WarnCF("sms", "Failed to read messages from modem", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+	for _, m := range msgs {
+		if err := c.modem.delete(m.index); err != nil {
+			logger.WarnCF("sms", "Failed to delete message from modem", map[string]any{
+				"index": m.index,
+				"error": err.Error(),
+			})
+			continue
+		}
+		c.handleSMS(m.from, m.text, fmt.Sprintf("%s-%s", m.index, m.timestamp))
+	}
+}
+
+func (c *SMSChannel) handleSMS(from, text, messageID string) {
+	from = normalizePhoneNumber(from)
+	text = strings.TrimSpace(text)
+	if from == "" || text == "" {
+		return
+	}
+	if !c.IsAllowed(from) {
+		logger.DebugCF("sms", "Ignoring SMS from number not in allow_from", map[string]any{
+			"from": from,
+		})
+		return
+	}
+	c.HandleMessage(from, from, text, nil, map[string]string{
+		"message_id": messageID,
+		"peer_kind":  "direct",
+		"peer_id":    from,
+	})
+}
+
+// normalizePhoneNumber drops the spaces, dashes and parentheses people put
+// in numbers, so allow_from entries match what the provider reports.
+func normalizePhoneNumber(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(number))
+}
+
+// gsm7Basic and gsm7Extended are the characters of the GSM 03.38 default
+// alphabet; extended ones cost two septets.
+const (
+	gsm7Basic    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "^{}\\[~]|€\f"
+)
+
+// isGSM7 reports whether text can be sent in the GSM 7-bit alphabet. Other
+// texts are sent as UCS-2, which fits far fewer characters per SMS.
+func isGSM7(text string) bool {
+	for _, r := range text {
+		if !strings.ContainsRune(gsm7Basic, r) && !strings.ContainsRune(gsm7Extended, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// smsSegmentLimit is what fits into a single SMS, in smsCost units.
+func smsSegmentLimit(text string) int {
+	if isGSM7(text) {
+		return 160
+	}
+	return 70
+}
+
+// smsCost counts a character the way the network does: septets for GSM-7
+// texts, UTF-16 code units for UCS-2 ones.
+func smsCost(r rune, gsm bool) int {
+	if gsm {
+		if strings.ContainsRune(gsm7Extended, r) {
+			return 2
+		}
+		return 1
+	}
+	return len(utf16.Encode([]rune{r}))
+}
+
+// splitSMS splits text into parts of at most limit units, preferring to
+// break at whitespace. Parts are numbered "(1/3) " when there are several,
+// and a text needing more than maxParts parts is cut short with "…".
+func splitSMS(text string, limit, maxParts int) []string {
+	gsm := isGSM7(text)
+	cost := func(s string) int {
+		n := 0
+		for _, r := range s {
+			n += smsCost(r, gsm)
+		}
+		return n
+	}
+	if cost(text) <= limit {
+		return []string{text}
+	}
+
+	// Leave room for the "(nn/nn) " prefix.
+	budget := limit - 8
+	var parts []string
+	rest := []rune(text)
+	for len(rest) > 0 {
+		used, cut, lastSpace := 0, len(rest), -1
+		for i, r := range rest {
+			used += smsCost(r, gsm)
+			if used > budget {
+				cut = i
+				break
+			}
+			if r == ' ' || r == '\n' {
+				lastSpace = i
+			}
+		}
+		if cut < len(rest) && lastSpace > cut/2 {
+			cut = lastSpace + 1
+		}
+		parts = append(parts, strings.TrimSpace(string(rest[:cut])))
+		rest = []rune(strings.TrimLeft(string(rest[cut:]), " \n"))
+	}
+
+	if maxParts > 0 && len(parts) > maxParts {
+		// "…" is not in the GSM alphabet and would turn the whole message
+		// into UCS-2.
+		ellipsis := "…"
+		if gsm {
+			ellipsis = "..."
+		}
+		parts = parts[:maxParts]
+		last := []rune(parts[maxParts-1])
+		for len(last) > 0 && cost(string(last))+cost(ellipsis) > budget {
+			last = last[:len(last)-1]
+		}
+		parts[maxParts-1] = strings.TrimSpace(string(last)) + ellipsis
+	}
+	for i := range parts {
+		parts[i] = fmt.Sprintf("(%d/%d) %s", i+1, len(parts), parts[i])
+	}
+	return parts
+}
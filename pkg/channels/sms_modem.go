@@ -0,0 +1,299 @@
+package channels
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	smsModemTimeout = 10 * time.Second
+	// smsModemSendTimeout is longer: the modem answers AT+CMGS only once
+	// the network has accepted the message.
+	smsModemSendTimeout = 60 * time.Second
+)
+
+// smsModem talks to a GSM modem in SMS text mode with the UCS2 character
+// set, so numbers and texts in any script pass through unchanged.
+type smsModem struct {
+	rw    io.ReadWriteCloser
+	lines chan string
+	mu    sync.Mutex // one command at a time
+}
+
+// smsModemMessage is a message stored on the SIM.
+type smsModemMessage struct {
+	index     string
+	from      string
+	timestamp string
+	text      string
+}
+
+// openSMSModem opens a serial device. The line speed is set with stty,
+// which every Linux board has; a baud rate of 0 leaves the port as it is.
+func openSMSModem(device string, baud int) (*smsModem, error) {
+	if baud > 0 {
+		out, err := exec.Command("stty", "-F", device, strconv.Itoa(baud), "raw", "-echo").CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("configure %s: %v: %s", device, err, strings.TrimSpace(string(out)))
+		}
+	}
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newSMSModem(f), nil
+}
+
+func newSMSModem(rw io.ReadWriteCloser) *smsModem {
+	m := &smsModem{rw: rw, lines: make(chan string, 64)}
+	go m.readLines()
+	return m
+}
+
+func (m *smsModem) Close() error {
+	return m.rw.Close()
+}
+
+// readLines splits the modem output into lines. The "> " prompt that asks
+// for the message text has no line ending, so it is passed on by itself.
+func (m *smsModem) readLines() {
+	defer close(m.lines)
+	buf := make([]byte, 512)
+	var pending []byte
+	for {
+		n, err := m.rw.Read(buf)
+		if err != nil {
+			return
+		}
+		pending = append(pending, buf[:n]...)
+		for {
+			i := strings.IndexAny(string(pending), "\r\n")
+			if i < 0 {
+				break
+			}
+			if line := strings.TrimSpace(string(pending[:i])); line != "" {
+				m.lines <- line
+			}
+			pending = pending[i+1:]
+		}
+		if strings.TrimSpace(string(pending)) == ">" {
+			m.lines <- ">"
+			pending = pending[:0]
+		}
+	}
+}
+
+func (m *smsModem) init() error {
+	for _, cmd := range []string{"AT", "ATE0", "AT+CMGF=1", `AT+CSCS="UCS2"`} {
+		if _, err := m.command(cmd, smsModemTimeout); err != nil {
+			return fmt.Errorf("%s: %w", cmd, err)
+		}
+	}
+	return nil
+}
+
+// command runs one AT command and returns its response lines without the
+// final OK.
+func (m *smsModem) command(cmd string, timeout time.Duration) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.commandLocked(cmd, timeout)
+}
+
+func (m *smsModem) commandLocked(cmd string, timeout time.Duration) ([]string, error) {
+	m.drain()
+	if _, err := io.WriteString(m.rw, cmd+"\r"); err != nil {
+		return nil, err
+	}
+	return m.response(cmd, timeout)
+}
+
+// drain drops unsolicited output (such as +CMTI new message notices) left
+// over from before the next command.
+func (m *smsModem) drain() {
+	for {
+		select {
+		case <-m.lines:
+		default:
+			return
+		}
+	}
+}
+
+func (m *smsModem) response(cmd string, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var lines []string
+	for {
+		select {
+		case line, ok := <-m.lines:
+			if !ok {
+				return nil, errors.New("modem disconnected")
+			}
+			switch {
+			case line == "OK":
+				return lines, nil
+			case line == "ERROR", strings.HasPrefix(line, "+CMS ERROR"), strings.HasPrefix(line, "+CME ERROR"):
+				return nil, errors.New(line)
+			case line == cmd:
+				// Echo, before ATE0 took effect.
+			default:
+				lines = append(lines, line)
+			}
+		case <-timer.C:
+			return nil, fmt.Errorf("no answer to %s", strings.SplitN(cmd, "=", 2)[0])
+		}
+	}
+}
+
+// sendSMS sends one message, which must fit into a single SMS.
+func (m *smsModem) sendSMS(to, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Data coding scheme 0 is the GSM alphabet, 8 is UCS-2.
+	dcs := 8
+	if isGSM7(text) {
+		dcs = 0
+	}
+	if _, err := m.commandLocked(fmt.Sprintf("AT+CSMP=17,167,0,%d", dcs), smsModemTimeout); err != nil {
+		return err
+	}
+
+	m.drain()
+	if _, err := fmt.Fprintf(m.rw, "AT+CMGS=\"%s\"\r", ucs2Encode(to)); err != nil {
+		return err
+	}
+	if err := m.waitPrompt(); err != nil {
+		// Leave text mode input in case the prompt came late.
+		m.rw.Write([]byte{0x1b})
+		return err
+	}
+	if _, err := io.WriteString(m.rw, ucs2Encode(text)+"\x1a"); err != nil {
+		return err
+	}
+	_, err := m.response("", smsModemSendTimeout)
+	return err
+}
+
+func (m *smsModem) waitPrompt() error {
+	timer := time.NewTimer(smsModemTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-m.lines:
+			if !ok {
+				return errors.New("modem disconnected")
+			}
+			if line == ">" {
+				return nil
+			}
+			if line == "ERROR" || strings.HasPrefix(line, "+CMS ERROR") || strings.HasPrefix(line, "+CME ERROR") {
+				return errors.New(line)
+			}
+		case <-timer.C:
+			return errors.New("modem did not prompt for the message text")
+		}
+	}
+}
+
+// list returns all messages stored on the SIM.
+func (m *smsModem) list() ([]smsModemMessage, error) {
+	lines, err := m.command(`AT+CMGL="ALL"`, smsModemTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []smsModemMessage
+	var cur *smsModemMessage
+	var body []string
+	flush := func() {
+		if cur != nil {
+			cur.text = ucs2Decode(strings.Join(body, "\n"))
+			msgs = append(msgs, *cur)
+		}
+		cur, body = nil, nil
+	}
+	for _, line := range lines {
+		header, ok := strings.CutPrefix(line, "+CMGL:")
+		if !ok {
+			if cur != nil {
+				body = append(body, line)
+			}
+			continue
+		}
+		flush()
+		// +CMGL: <index>,<stat>,<oa>,[<alpha>],[<scts>]
+		fields := splitATFields(header)
+		if len(fields) < 3 {
+			continue
+		}
+		from := ucs2Decode(fields[2])
+		if strings.Trim(from, "+0123456789") != "" {
+			// A plain number that happened to be valid hex.
+			from = fields[2]
+		}
+		cur = &smsModemMessage{index: fields[0], from: from}
+		if len(fields) > 4 {
+			cur.timestamp = fields[4]
+		}
+	}
+	flush()
+	return msgs, nil
+}
+
+func (m *smsModem) delete(index string) error {
+	_, err := m.command("AT+CMGD="+index, smsModemTimeout)
+	return err
+}
+
+// splitATFields splits a comma-separated AT response, keeping commas inside
+// quotes and removing the quotes.
+func splitATFields(s string) []string {
+	var fields []string
+	var b strings.Builder
+	quoted := false
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			fields = append(fields, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(fields, b.String())
+}
+
+func ucs2Encode(s string) string {
+	var b strings.Builder
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	return b.String()
+}
+
+// ucs2Decode reverses ucs2Encode. Input that is not UCS2 hex, as some modems
+// return for numbers, is passed through.
+func ucs2Decode(s string) string {
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw)%2 != 0 {
+		return s
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,242 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSplitSMS(t *testing.T) {
+	if parts := splitSMS("short", 160, 5); len(parts) != 1 || parts[0] != "short" {
+		t.Errorf("short text = %q", parts)
+	}
+
+	long := strings.Repeat("word ", 100) // 500 GSM characters
+	parts := splitSMS(long, 160, 5)
+	if len(parts) != 4 || !strings.HasPrefix(parts[0], "(1/4) word") {
+		t.Fatalf("parts = %q", parts)
+	}
+	for _, p := range parts {
+		if len(p) > 160 || strings.HasSuffix(p, "wor") {
+			t.Errorf("bad part %q", p)
+		}
+	}
+
+	// Any character outside the GSM alphabet makes it UCS-2, with 70 units
+	// per SMS; the emoji takes two.
+	unicode := "Grüße 🙂 " + strings.Repeat("Привет ", 20)
+	if smsSegmentLimit(unicode) != 70 {
+		t.Fatal("expected UCS-2 limit")
+	}
+	for _, p := range splitSMS(unicode, 70, 0) {
+		units := 0
+		for _, r := range p {
+			units += smsCost(r, false)
+		}
+		if units > 70 {
+			t.Errorf("part has %d units: %q", units, p)
+		}
+	}
+
+	cut := splitSMS(long, 160, 2)
+	if len(cut) != 2 || !strings.HasPrefix(cut[1], "(2/2) ") || !strings.HasSuffix(cut[1], "...") || len(cut[1]) > 160 {
+		t.Errorf("truncated = %q", cut)
+	}
+}
+
+func signTwilio(token, rawURL string, form url.Values) string {
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(rawURL))
+	for _, k := range []string{"Body", "From", "MessageSid"} {
+		mac.Write([]byte(k + form.Get(k)))
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSMSTwilio(t *testing.T) {
+	var mu sync.Mutex
+	var sent []url.Values
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/Accounts/AC1/Messages.json" || user != "AC1" || pass != "secret" {
+			http.Error(w, `{"code":20003,"message":"Authenticate"}`, http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		mu.Lock()
+		sent = append(sent, r.PostForm)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer api.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewSMSChannel(config.SMSConfig{
+		Provider:         "twilio",
+		TwilioAccountSID: "AC1",
+		TwilioAuthToken:  "secret",
+		TwilioFrom:       "+15550100",
+		WebhookURL:       "https://bot.example.com/webhook/sms",
+		MaxMessages:      5,
+		AllowFrom:        config.FlexibleStringSlice{"+1 (555) 010-0199"},
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.apiBase = api.URL
+	ch.setRunning(true)
+
+	post := func(form url.Values, signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/sms", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Twilio-Signature", signature)
+		rec := httptest.NewRecorder()
+		ch.twilioWebhook(rec, req)
+		return rec.Code
+	}
+
+	form := url.Values{"From": {"+15550100199"}, "Body": {"hello"}, "MessageSid": {"SM1"}}
+	if code := post(form, "forged"); code != http.StatusForbidden {
+		t.Errorf("forged signature got %d", code)
+	}
+	if code := post(form, signTwilio("secret", "https://bot.example.com/webhook/sms", form)); code != http.StatusOK {
+		t.Fatalf("signed request got %d", code)
+	}
+	stranger := url.Values{"From": {"+15550100000"}, "Body": {"hi"}, "MessageSid": {"SM2"}}
+	post(stranger, signTwilio("secret", "https://bot.example.com/webhook/sms", stranger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	in, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || in.ChatID != "+15550100199" || in.Content != "hello" || in.Metadata["message_id"] != "SM1" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	if _, ok := msgBus.ConsumeInbound(short); ok {
+		t.Error("message from a number outside allow_from was delivered")
+	}
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: in.ChatID, Content: "**Hi** there"}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0].Get("To") != "+15550100199" || sent[0].Get("From") != "+15550100" || sent[0].Get("Body") != "Hi there" {
+		t.Errorf("sent = %v", sent)
+	}
+}
+
+// fakeModem answers AT commands on one end of a pipe like a GSM modem in
+// text mode with the UCS2 character set.
+type fakeModem struct {
+	mu      sync.Mutex
+	stored  map[string][2]string // index → number, text
+	sent    [][2]string
+	dcs     string
+	network net.Conn
+}
+
+func (f *fakeModem) serve() {
+	r := bufio.NewReader(f.network)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			f.network.Write([]byte("\r\n" + l + "\r\n"))
+		}
+	}
+	for {
+		line, err := r.ReadString('\r')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSuffix(line, "\r")
+		f.mu.Lock()
+		switch {
+		case strings.HasPrefix(cmd, "AT+CSMP="):
+			f.dcs = cmd[strings.LastIndex(cmd, ",")+1:]
+			reply("OK")
+		case strings.HasPrefix(cmd, "AT+CMGS="):
+			to := ucs2Decode(strings.Trim(strings.TrimPrefix(cmd, "AT+CMGS="), `"`))
+			f.network.Write([]byte("\r\n> "))
+			text, _ := r.ReadString('\x1a')
+			f.sent = append(f.sent, [2]string{to, ucs2Decode(strings.TrimSuffix(text, "\x1a"))})
+			reply("+CMGS: 7", "OK")
+		case cmd == `AT+CMGL="ALL"`:
+			var lines []string
+			for idx, m := range f.stored {
+				lines = append(lines,
+					`+CMGL: `+idx+`,"REC UNREAD","`+ucs2Encode(m[0])+`","","24/05/01,10:00:00+08"`,
+					ucs2Encode(m[1]))
+			}
+			reply(append(lines, "OK")...)
+		case strings.HasPrefix(cmd, "AT+CMGD="):
+			delete(f.stored, strings.TrimPrefix(cmd, "AT+CMGD="))
+			reply("OK")
+		default:
+			reply("OK")
+		}
+		f.mu.Unlock()
+	}
+}
+
+func TestSMSModem(t *testing.T) {
+	local, network := net.Pipe()
+	fake := &fakeModem{
+		stored:  map[string][2]string{"3": {"+491701234567", "Wie spät ist es? ⏰"}},
+		network: network,
+	}
+	go fake.serve()
+
+	modem := newSMSModem(local)
+	defer modem.Close()
+	if err := modem.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewSMSChannel(config.SMSConfig{Provider: "modem", ModemDevice: "/dev/null"}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.modem = modem
+	ch.ctx = context.Background()
+	ch.setRunning(true)
+
+	ch.readModem()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	in, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || in.ChatID != "+491701234567" || in.Content != "Wie spät ist es? ⏰" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	fake.mu.Lock()
+	if len(fake.stored) != 0 {
+		t.Error("message was not deleted from the SIM")
+	}
+	fake.mu.Unlock()
+
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: in.ChatID, Content: "Es ist 10 Uhr"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.CheckHealth(context.Background()); err != nil {
+		t.Errorf("health: %v", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.sent) != 1 || fake.sent[0] != [2]string{"+491701234567", "Es ist 10 Uhr"} || fake.dcs != "0" {
+		t.Errorf("sent = %q, dcs = %s", fake.sent, fake.dcs)
+	}
+}
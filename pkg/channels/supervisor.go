@@ -0,0 +1,283 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// HealthChecker is implemented by channels that can tell whether their
+// connection to the platform still works. Channels without it are judged
+// by IsRunning alone.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// ChannelHealth is the supervisor's view of one channel.
+type ChannelHealth struct {
+	Name       string
+	Up         bool
+	Since      time.Time // when the channel last went up or down
+	LastError  string
+	Reconnects int // restart attempts since the gateway started
+}
+
+const (
+	healthCheckTimeout = 10 * time.Second
+	minReconnectDelay  = 2 * time.Second
+	supervisorTick     = time.Second
+)
+
+var errNotRunning = errors.New("channel is not running")
+
+type channelState struct {
+	ChannelHealth
+	nextCheck time.Time
+	backoff   time.Duration
+	alerted   bool
+}
+
+// supervisor checks every channel on an interval and restarts the ones that
+// dropped, backing off exponentially while a channel stays down. Outages
+// are recorded as run events.
+type supervisor struct {
+	m   *Manager
+	cfg config.SupervisorConfig
+	now func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*channelState
+}
+
+func newSupervisor(m *Manager, cfg config.SupervisorConfig) *supervisor {
+	return &supervisor{
+		m:      m,
+		cfg:    cfg,
+		now:    time.Now,
+		states: make(map[string]*channelState),
+	}
+}
+
+func (s *supervisor) run(ctx context.Context) {
+	logger.InfoC("channels", "Channel supervisor started")
+	ticker := time.NewTicker(supervisorTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll checks every channel whose next check is due.
+func (s *supervisor) checkAll(ctx context.Context) {
+	s.m.mu.RLock()
+	channels := make(map[string]Channel, len(s.m.channels))
+	for name, ch := range s.m.channels {
+		channels[name] = ch
+	}
+	s.m.mu.RUnlock()
+
+	for name, ch := range channels {
+		if ctx.Err() != nil {
+			return
+		}
+		st := s.state(name)
+		if s.now().Before(st.nextCheck) {
+			continue
+		}
+		s.check(ctx, name, ch, st)
+	}
+}
+
+func (s *supervisor) state(name string) *channelState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.states[name]
+	if !ok {
+		// Channels are assumed up until a check says otherwise, so one that
+		// failed to start is reported as an outage on the first check.
+		st = &channelState{ChannelHealth: ChannelHealth{Name: name, Up: true, Since: s.now()}}
+		s.states[name] = st
+	}
+	return st
+}
+
+func (s *supervisor) check(ctx context.Context, name string, ch Channel, st *channelState) {
+	err := probe(ctx, ch)
+	if err == nil {
+		s.markUp(name, st)
+		return
+	}
+
+	s.markDown(name, st, err)
+	if ctx.Err() != nil {
+		return
+	}
+
+	logger.InfoCF("channels", "Reconnecting channel", map[string]any{
+		"channel": name,
+		"attempt": st.Reconnects + 1,
+	})
+	// Stop errors are expected from a half-dead connection.
+	_ = ch.Stop(ctx)
+	err = ch.Start(ctx)
+	if err == nil {
+		err = probe(ctx, ch)
+	}
+
+	s.mu.Lock()
+	st.Reconnects++
+	s.mu.Unlock()
+
+	if err == nil {
+		s.markUp(name, st)
+		return
+	}
+
+	s.mu.Lock()
+	st.LastError = err.Error()
+	st.backoff = min(max(st.backoff*2, minReconnectDelay), s.maxBackoff())
+	st.nextCheck = s.now().Add(st.backoff)
+	retry := st.backoff
+	down := s.now().Sub(st.Since)
+	alert := !st.alerted && s.cfg.AlertChannel != "" && s.cfg.AlertChatID != "" &&
+		s.cfg.AlertChannel != name && down >= time.Duration(s.cfg.AlertAfterSeconds)*time.Second
+	if alert {
+		st.alerted = true
+	}
+	s.mu.Unlock()
+
+	logger.WarnCF("channels", "Channel reconnect failed", map[string]any{
+		"channel":  name,
+		"error":    err.Error(),
+		"retry_in": retry.String(),
+	})
+	if alert {
+		s.alert(ctx, name, down, err)
+	}
+}
+
+func probe(ctx context.Context, ch Channel) error {
+	if !ch.IsRunning() {
+		return errNotRunning
+	}
+	if hc, ok := ch.(HealthChecker); ok {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		return hc.CheckHealth(ctx)
+	}
+	return nil
+}
+
+func (s *supervisor) markUp(name string, st *channelState) {
+	now := s.now()
+	s.mu.Lock()
+	wasUp := st.Up
+	outage := now.Sub(st.Since)
+	st.Up = true
+	st.LastError = ""
+	st.backoff = 0
+	st.alerted = false
+	st.nextCheck = now.Add(s.interval())
+	if !wasUp {
+		st.Since = now
+	}
+	s.mu.Unlock()
+
+	if wasUp {
+		return
+	}
+	logger.InfoCF("channels", "Channel reconnected", map[string]any{
+		"channel": name,
+		"outage":  outage.Round(time.Second).String(),
+	})
+	s.m.recordEvent(state.RunEvent{
+		Time:     now,
+		Kind:     "channel_up",
+		Source:   name,
+		Message:  "channel reconnected",
+		Duration: outage,
+	})
+}
+
+func (s *supervisor) markDown(name string, st *channelState, err error) {
+	now := s.now()
+	s.mu.Lock()
+	wasUp := st.Up
+	st.Up = false
+	st.LastError = err.Error()
+	if wasUp {
+		st.Since = now
+	}
+	s.mu.Unlock()
+
+	if !wasUp {
+		return
+	}
+	logger.WarnCF("channels", "Channel down", map[string]any{
+		"channel": name,
+		"error":   err.Error(),
+	})
+	s.m.recordEvent(state.RunEvent{
+		Time:    now,
+		Kind:    "channel_down",
+		Source:  name,
+		Message: err.Error(),
+	})
+}
+
+func (s *supervisor) alert(ctx context.Context, name string, down time.Duration, err error) {
+	content := fmt.Sprintf("⚠️ Channel %s has been down for %s: %v", name, down.Round(time.Second), err)
+	if s.m.hold(bus.OutboundMessage{
+		Channel: s.cfg.AlertChannel, ChatID: s.cfg.AlertChatID, Content: content, Proactive: true, Urgent: true,
+	}) {
+		return
+	}
+	if sendErr := s.m.SendToChannel(ctx, s.cfg.AlertChannel, s.cfg.AlertChatID, content); sendErr != nil {
+		logger.ErrorCF("channels", "Failed to send channel alert", map[string]any{
+			"channel":       name,
+			"alert_channel": s.cfg.AlertChannel,
+			"error":         sendErr.Error(),
+		})
+	}
+}
+
+func (s *supervisor) interval() time.Duration {
+	return time.Duration(max(s.cfg.CheckIntervalSeconds, 1)) * time.Second
+}
+
+func (s *supervisor) maxBackoff() time.Duration {
+	return max(time.Duration(s.cfg.MaxBackoffSeconds)*time.Second, minReconnectDelay)
+}
+
+// health returns the status of every channel, sorted by name.
+func (s *supervisor) health() []ChannelHealth {
+	s.m.mu.RLock()
+	names := make([]string, 0, len(s.m.channels))
+	for name := range s.m.channels {
+		names = append(names, name)
+	}
+	s.m.mu.RUnlock()
+	sort.Strings(names)
+
+	out := make([]ChannelHealth, 0, len(names))
+	for _, name := range names {
+		st := s.state(name)
+		s.mu.Lock()
+		out = append(out, st.ChannelHealth)
+		s.mu.Unlock()
+	}
+	return out
+}
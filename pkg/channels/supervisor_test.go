@@ -0,0 +1,151 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+type flakyChannel struct {
+	*BaseChannel
+	startErr error
+	healthy  bool
+	starts   int
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error {
+	c.starts++
+	if c.startErr != nil {
+		return c.startErr
+	}
+	c.setRunning(true)
+	c.healthy = true
+	return nil
+}
+
+func (c *flakyChannel) Stop(ctx context.Context) error {
+	c.setRunning(false)
+	return nil
+}
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+
+func (c *flakyChannel) CheckHealth(ctx context.Context) error {
+	if !c.healthy {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func TestSupervisorReconnectsWithBackoff(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Gateway.Supervisor.AlertAfterSeconds = 5
+	cfg.Gateway.Supervisor.AlertChannel = "admin"
+	cfg.Gateway.Supervisor.AlertChatID = "ops"
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("flaky", nil, nil, nil)}
+	admin := &fakeTextChannel{BaseChannel: NewBaseChannel("admin", nil, nil, nil)}
+	m.RegisterChannel("flaky", ch)
+	m.RegisterChannel("admin", admin)
+	ch.Start(context.Background())
+	admin.setRunning(true)
+
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sup := m.supervisor
+	sup.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	sup.checkAll(ctx)
+	if h := m.ChannelHealth(); !h[1].Up || h[1].Name != "flaky" {
+		t.Fatalf("health = %+v", h)
+	}
+
+	// The connection drops and the platform refuses to reconnect.
+	ch.healthy = false
+	ch.startErr = errors.New("dial failed")
+	clock = clock.Add(time.Minute)
+	sup.checkAll(ctx)
+	if ch.starts != 2 {
+		t.Fatalf("starts = %d, want a reconnect attempt", ch.starts)
+	}
+	h := m.ChannelHealth()[1]
+	if h.Up || h.Reconnects != 1 || h.LastError != "dial failed" {
+		t.Fatalf("health = %+v", h)
+	}
+
+	// No retry before the backoff expires.
+	clock = clock.Add(time.Second)
+	sup.checkAll(ctx)
+	if ch.starts != 2 {
+		t.Errorf("retried after 1s, starts = %d", ch.starts)
+	}
+	clock = clock.Add(2 * time.Second)
+	sup.checkAll(ctx)
+	if ch.starts != 3 {
+		t.Errorf("starts = %d, want retry after backoff", ch.starts)
+	}
+	if got := sup.states["flaky"].backoff; got != 4*time.Second {
+		t.Errorf("backoff = %v, want 4s", got)
+	}
+	if len(admin.sent) != 0 {
+		t.Errorf("alerted too early: %+v", admin.sent)
+	}
+
+	clock = clock.Add(4 * time.Second)
+	sup.checkAll(ctx)
+	if len(admin.sent) != 1 || admin.sent[0].ChatID != "ops" || !strings.Contains(admin.sent[0].Content, "flaky") {
+		t.Fatalf("alerts = %+v", admin.sent)
+	}
+	clock = clock.Add(time.Minute)
+	sup.checkAll(ctx)
+	if len(admin.sent) != 1 {
+		t.Errorf("alert repeated: %d", len(admin.sent))
+	}
+
+	ch.startErr = nil
+	clock = clock.Add(5 * time.Minute)
+	sup.checkAll(ctx)
+	if h := m.ChannelHealth()[1]; !h.Up || h.LastError != "" {
+		t.Fatalf("health after recovery = %+v", h)
+	}
+
+	events, err := state.NewEventLog(cfg.WorkspacePath()).Recent(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Kind != "channel_down" || events[1].Kind != "channel_up" {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[1].Duration <= 0 {
+		t.Errorf("outage duration not recorded: %+v", events[1])
+	}
+}
+
+func TestManagerChannelHealthWithoutSupervisor(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Gateway.Supervisor.Enabled = false
+	m, err := NewManager(cfg, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.RegisterChannel("b", &fakeTextChannel{BaseChannel: NewBaseChannel("b", nil, nil, nil)})
+	running := &fakeTextChannel{BaseChannel: NewBaseChannel("a", nil, nil, nil)}
+	running.setRunning(true)
+	m.RegisterChannel("a", running)
+
+	h := m.ChannelHealth()
+	if len(h) != 2 || h[0].Name != "a" || !h[0].Up || h[1].Up {
+		t.Errorf("health = %+v", h)
+	}
+}
@@ -0,0 +1,246 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// teamChatBackend is the server-specific half of a self-hosted team chat
+// channel (Mattermost, Rocket.Chat). TeamChatChannel implements allowlists,
+// mention gating and thread sessions on top of it.
+type teamChatBackend interface {
+	// connect verifies the bot credentials and returns the bot's identity.
+	connect(ctx context.Context) (userID, username string, err error)
+	// listen delivers new posts to handle until ctx ends or the realtime
+	// connection fails.
+	listen(ctx context.Context, handle func(teamChatPost)) error
+	post(ctx context.Context, channelID, rootID, text string) error
+	typing(ctx context.Context, channelID, rootID string)
+	maxMessageLength() int
+}
+
+// teamChatPost is a new message as reported by a backend.
+type teamChatPost struct {
+	ID          string
+	ChannelID   string
+	ChannelName string
+	RootID      string // thread root; empty for top-level posts
+	UserID      string
+	Username    string
+	Text        string
+	Direct      bool
+	Mentioned   bool
+}
+
+type teamChatOptions struct {
+	channels      []string // allowed channel IDs or names; empty allows all
+	mentionOnly   bool
+	threadReplies bool
+}
+
+// TeamChatChannel is the shared implementation behind the Mattermost and
+// Rocket.Chat channels.
+//
+// With thread replies enabled, every channel conversation lives in a thread
+// and the chat ID is "<channelID>/<rootPostID>", which gives each thread its
+// own session. Direct messages use the plain channel ID.
+type TeamChatChannel struct {
+	*BaseChannel
+	backend  teamChatBackend
+	opts     teamChatOptions
+	botID    string
+	botName  string
+	threads  sync.Map // "<channelID>/<rootID>" → struct{}, threads the bot takes part in
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mentionR *regexp.Regexp
+}
+
+func newTeamChatChannel(
+	name string,
+	cfg any,
+	messageBus *bus.MessageBus,
+	allowFrom []string,
+	backend teamChatBackend,
+	opts teamChatOptions,
+) *TeamChatChannel {
+	return &TeamChatChannel{
+		BaseChannel: NewBaseChannel(name, cfg, messageBus, allowFrom),
+		backend:     backend,
+		opts:        opts,
+	}
+}
+
+func (c *TeamChatChannel) Start(ctx context.Context) error {
+	logger.InfoC(c.Name(), "Starting team chat channel")
+
+	userID, username, err := c.backend.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("%s login failed: %w", c.Name(), err)
+	}
+	c.botID, c.botName = userID, username
+	c.mentionR = regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(username) + `\b:?`)
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.listenLoop()
+
+	c.setRunning(true)
+	logger.InfoCF(c.Name(), "Team chat channel started", map[string]any{
+		"bot": username,
+	})
+	return nil
+}
+
+func (c *TeamChatChannel) Stop(ctx context.Context) error {
+	logger.InfoC(c.Name(), "Stopping team chat channel")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Capabilities reports Markdown and the backend's message limit.
+func (c *TeamChatChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Markdown, MaxMessageLength: c.backend.maxMessageLength()}
+}
+
+func (c *TeamChatChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("%s channel not running", c.Name())
+	}
+
+	channelID, rootID, _ := strings.Cut(msg.ChatID, "/")
+	for _, chunk := range utils.SplitMessage(msg.Content, c.Capabilities().MaxMessageLength) {
+		if err := c.backend.post(ctx, channelID, rootID, chunk); err != nil {
+			return fmt.Errorf("%s send: %w", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (c *TeamChatChannel) listenLoop() {
+	backoff := time.Second
+	for {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		started := time.Now()
+		err := c.backend.listen(c.ctx, c.handlePost)
+		if c.ctx.Err() != nil {
+			return
+		}
+		// A connection that stayed up for a while was healthy.
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		logger.WarnCF(c.Name(), "Realtime connection lost, reconnecting", map[string]any{
+			"error":   fmt.Sprint(err),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (c *TeamChatChannel) handlePost(p teamChatPost) {
+	if p.UserID == "" || p.UserID == c.botID {
+		return
+	}
+
+	text := strings.TrimSpace(p.Text)
+	if c.mentionR != nil {
+		text = strings.TrimSpace(c.mentionR.ReplaceAllString(text, ""))
+	}
+	if text == "" {
+		return
+	}
+
+	if !p.Direct && !c.channelAllowed(p) {
+		return
+	}
+
+	senderID := p.UserID
+	if p.Username != "" {
+		senderID = p.UserID + "|" + p.Username
+	}
+	if !c.IsAllowed(senderID) {
+		return
+	}
+
+	chatID := p.ChannelID
+	metadata := map[string]string{
+		"message_id": p.ID,
+		"user_name":  p.Username,
+	}
+
+	if p.Direct {
+		// Keep direct conversations in a single session, but answer inside
+		// a thread if the user started one.
+		if p.RootID != "" {
+			chatID = p.ChannelID + "/" + p.RootID
+		}
+		metadata["peer_kind"] = "direct"
+		metadata["peer_id"] = p.UserID
+	} else {
+		root := p.RootID
+		if root == "" {
+			root = p.ID
+		}
+		threadKey := p.ChannelID + "/" + root
+		_, inThread := c.threads.Load(threadKey)
+
+		// Threads the bot already takes part in don't need a fresh mention.
+		if c.opts.mentionOnly && !p.Mentioned && !inThread {
+			return
+		}
+
+		if c.opts.threadReplies {
+			chatID = threadKey
+			c.threads.Store(threadKey, struct{}{})
+			metadata["peer_kind"] = "thread"
+			metadata["peer_id"] = threadKey
+			metadata["parent_peer_kind"] = "channel"
+			metadata["parent_peer_id"] = p.ChannelID
+		} else {
+			metadata["peer_kind"] = "channel"
+			metadata["peer_id"] = p.ChannelID
+		}
+	}
+
+	channelID, rootID, _ := strings.Cut(chatID, "/")
+	go c.backend.typing(c.ctx, channelID, rootID)
+
+	logger.DebugCF(c.Name(), "Received message", map[string]any{
+		"chat_id": chatID,
+		"sender":  senderID,
+		"preview": utils.Truncate(text, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, text, nil, metadata)
+}
+
+func (c *TeamChatChannel) channelAllowed(p teamChatPost) bool {
+	if len(c.opts.channels) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(c.opts.channels, func(allowed string) bool {
+		allowed = strings.TrimPrefix(allowed, "#")
+		return allowed == p.ChannelID || (p.ChannelName != "" && strings.EqualFold(allowed, p.ChannelName))
+	})
+}
@@ -0,0 +1,233 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakeTeamChatBackend struct {
+	mu    sync.Mutex
+	posts []string // "channel/root: text"
+}
+
+func (b *fakeTeamChatBackend) connect(ctx context.Context) (string, string, error) {
+	return "bot-id", "picobot", nil
+}
+
+func (b *fakeTeamChatBackend) listen(ctx context.Context, handle func(teamChatPost)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *fakeTeamChatBackend) post(ctx context.Context, channelID, rootID, text string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.posts = append(b.posts, channelID+"/"+rootID+": "+text)
+	return nil
+}
+
+func (b *fakeTeamChatBackend) typing(ctx context.Context, channelID, rootID string) {}
+
+func (b *fakeTeamChatBackend) maxMessageLength() int { return 100 }
+
+func newTestTeamChat(t *testing.T, opts teamChatOptions, allow ...string) (*TeamChatChannel, *fakeTeamChatBackend, *bus.MessageBus) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	backend := &fakeTeamChatBackend{}
+	ch := newTeamChatChannel("mattermost", nil, msgBus, allow, backend, opts)
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+	return ch, backend, msgBus
+}
+
+func consumeOrNil(msgBus *bus.MessageBus) *bus.InboundMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+		return &msg
+	}
+	return nil
+}
+
+func TestTeamChatChannel_ThreadSessions(t *testing.T) {
+	ch, backend, msgBus := newTestTeamChat(t, teamChatOptions{
+		channels:      []string{"town-square"},
+		mentionOnly:   true,
+		threadReplies: true,
+	})
+
+	// Not mentioned: ignored.
+	ch.handlePost(teamChatPost{ID: "p0", ChannelID: "c1", ChannelName: "town-square", UserID: "u1", Text: "hello"})
+	if msg := consumeOrNil(msgBus); msg != nil {
+		t.Fatalf("unexpected message without mention: %+v", msg)
+	}
+
+	// Channel not in the allowlist: ignored.
+	ch.handlePost(teamChatPost{ID: "p1", ChannelID: "c2", ChannelName: "random", UserID: "u1", Text: "@picobot hi", Mentioned: true})
+	if msg := consumeOrNil(msgBus); msg != nil {
+		t.Fatalf("unexpected message from unlisted channel: %+v", msg)
+	}
+
+	// Mention starts a thread rooted at the post.
+	ch.handlePost(teamChatPost{
+		ID: "p2", ChannelID: "c1", ChannelName: "town-square", UserID: "u1", Username: "alice",
+		Text: "@picobot: what's up?", Mentioned: true,
+	})
+	msg := consumeOrNil(msgBus)
+	if msg == nil {
+		t.Fatal("expected inbound message")
+	}
+	if msg.ChatID != "c1/p2" || msg.Content != "what's up?" || msg.SenderID != "u1|alice" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "thread" || msg.Metadata["parent_peer_id"] != "c1" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+
+	// Follow-ups in that thread don't need a mention.
+	ch.handlePost(teamChatPost{ID: "p3", ChannelID: "c1", ChannelName: "town-square", RootID: "p2", UserID: "u1", Text: "and then?"})
+	if msg := consumeOrNil(msgBus); msg == nil || msg.ChatID != "c1/p2" {
+		t.Fatalf("expected follow-up in thread, got %+v", msg)
+	}
+
+	// Replies go into the thread.
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "c1/p2", Content: "reply"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(backend.posts) != 1 || backend.posts[0] != "c1/p2: reply" {
+		t.Errorf("posts = %v", backend.posts)
+	}
+}
+
+func TestTeamChatChannel_DirectAndAllowlist(t *testing.T) {
+	ch, _, msgBus := newTestTeamChat(t, teamChatOptions{mentionOnly: true, threadReplies: true}, "alice")
+
+	ch.handlePost(teamChatPost{ID: "p1", ChannelID: "dm1", UserID: "u2", Username: "mallory", Text: "hi", Direct: true})
+	if msg := consumeOrNil(msgBus); msg != nil {
+		t.Fatalf("unexpected message from unlisted user: %+v", msg)
+	}
+
+	ch.handlePost(teamChatPost{ID: "p2", ChannelID: "dm1", UserID: "u1", Username: "alice", Text: "hi", Direct: true})
+	msg := consumeOrNil(msgBus)
+	if msg == nil {
+		t.Fatal("expected direct message")
+	}
+	if msg.ChatID != "dm1" || msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "u1" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	// Our own posts are never processed.
+	ch.handlePost(teamChatPost{ID: "p3", ChannelID: "dm1", UserID: "bot-id", Text: "echo", Direct: true})
+	if msg := consumeOrNil(msgBus); msg != nil {
+		t.Fatalf("unexpected own message: %+v", msg)
+	}
+}
+
+func TestMattermostBackend_ParseEvent(t *testing.T) {
+	b := &mattermostBackend{userID: "bot-id"}
+	post, _ := json.Marshal(mattermostPost{ID: "p1", ChannelID: "c1", RootID: "r1", UserID: "u1", Message: "@bot hi"})
+	event, _ := json.Marshal(map[string]any{
+		"event": "posted",
+		"data": map[string]string{
+			"channel_type": "O",
+			"channel_name": "town-square",
+			"sender_name":  "@alice",
+			"post":         string(post),
+			"mentions":     `["bot-id"]`,
+		},
+	})
+
+	got, ok := b.parseEvent(event)
+	if !ok {
+		t.Fatal("expected post")
+	}
+	want := teamChatPost{
+		ID: "p1", ChannelID: "c1", ChannelName: "town-square", RootID: "r1",
+		UserID: "u1", Username: "alice", Text: "@bot hi", Mentioned: true,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, ok := b.parseEvent([]byte(`{"event":"typing"}`)); ok {
+		t.Error("expected non-post events to be ignored")
+	}
+}
+
+func TestMattermostBackend_ConnectAndPost(t *testing.T) {
+	var posted map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v4/users/me":
+			w.Write([]byte(`{"id":"bot-id","username":"picobot"}`))
+		case "/api/v4/posts":
+			json.NewDecoder(r.Body).Decode(&posted)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ch, err := NewMattermostChannel(config.MattermostConfig{URL: server.URL + "/", Token: "tok"}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatalf("NewMattermostChannel() error = %v", err)
+	}
+	b := ch.backend.(*mattermostBackend)
+
+	id, name, err := b.connect(context.Background())
+	if err != nil || id != "bot-id" || name != "picobot" {
+		t.Fatalf("connect() = %q, %q, %v", id, name, err)
+	}
+	if err := b.post(context.Background(), "c1", "r1", "hello"); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+	if posted["channel_id"] != "c1" || posted["root_id"] != "r1" || posted["message"] != "hello" {
+		t.Errorf("posted = %v", posted)
+	}
+}
+
+func TestRocketChatBackend_ParseMessage(t *testing.T) {
+	b := &rocketChatBackend{userID: "bot-id"}
+	args := []json.RawMessage{
+		json.RawMessage(`{"_id":"m1","rid":"r1","msg":"@picobot hi","tmid":"t1",` +
+			`"u":{"_id":"u1","username":"alice"},"mentions":[{"_id":"bot-id","username":"picobot"}]}`),
+		json.RawMessage(`{"roomType":"c","roomName":"general"}`),
+	}
+
+	got, ok := b.parseMessage(args)
+	if !ok {
+		t.Fatal("expected message")
+	}
+	want := teamChatPost{
+		ID: "m1", ChannelID: "r1", ChannelName: "general", RootID: "t1",
+		UserID: "u1", Username: "alice", Text: "@picobot hi", Mentioned: true,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	edited := []json.RawMessage{json.RawMessage(`{"_id":"m1","rid":"r1","msg":"x","editedAt":{"$date":1}}`)}
+	if _, ok := b.parseMessage(edited); ok {
+		t.Error("expected edits to be ignored")
+	}
+	system := []json.RawMessage{json.RawMessage(`{"_id":"m2","rid":"r1","msg":"alice","t":"uj"}`)}
+	if _, ok := b.parseMessage(system); ok {
+		t.Error("expected system messages to be ignored")
+	}
+}
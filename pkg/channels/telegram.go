@@ -3,10 +3,12 @@ package channels
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,7 +20,9 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -32,8 +36,26 @@ type TelegramChannel struct {
 	transcriber  *voice.GroqTranscriber
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
+	streams      sync.Map // chatID -> *telegramStream
 }
 
+// telegramStream tracks a reply that is being edited in place while the
+// model generates it.
+type telegramStream struct {
+	mu       sync.Mutex
+	text     strings.Builder
+	lastEdit time.Time
+	editing  bool
+	done     bool
+	editMu   sync.Mutex // held for the duration of an edit request
+}
+
+const (
+	telegramMaxMessageLength = 4096
+	// Telegram allows roughly one edit per second per chat before throttling.
+	telegramStreamInterval = 1500 * time.Millisecond
+)
+
 type thinkingCancel struct {
 	fn context.CancelFunc
 }
@@ -105,10 +127,6 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create bot handler: %w", err)
 	}
 
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		c.commands.Help(ctx, message)
-		return nil
-	}, th.CommandEqual("help"))
 	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
 		return c.commands.Start(ctx, message)
 	}, th.CommandEqual("start"))
@@ -125,6 +143,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallbackQuery(ctx, query)
+	}, th.AnyCallbackQueryWithMessage())
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]any{
 		"username": c.bot.Username(),
@@ -151,7 +173,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("telegram bot not running")
 	}
 
-	chatID, err := parseChatID(msg.ChatID)
+	chatID, threadID, err := parseTelegramChatKey(msg.ChatID)
 	if err != nil {
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
@@ -164,35 +186,203 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.stopThinking.Delete(msg.ChatID)
 	}
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
+	// Finish a streamed reply and wait for an in-flight edit, so it can't
+	// overwrite the final text.
+	if v, ok := c.streams.LoadAndDelete(msg.ChatID); ok {
+		stream := v.(*telegramStream)
+		stream.mu.Lock()
+		stream.done = true
+		stream.mu.Unlock()
+		stream.editMu.Lock()
+		stream.editMu.Unlock()
+	}
 
-	// Try to edit placeholder
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
-		c.placeholders.Delete(msg.ChatID)
-		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
-		editMsg.ParseMode = telego.ModeHTML
+	caps := c.Capabilities()
+	_, parseMode := c.dialect()
+	pieces := format.Split(msg.Content, caps.Markdown, caps.MaxMessageLength)
+	if len(pieces) == 0 {
+		return nil
+	}
+	keyboard := telegramKeyboard(msg.Buttons)
 
-		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
-			return nil
+	for i, piece := range pieces {
+		text := format.Format(piece, caps.Markdown)
+		var markup telego.ReplyMarkup
+		if i == len(pieces)-1 && keyboard != nil {
+			markup = keyboard
+		}
+
+		// The first piece replaces the placeholder if there is one.
+		if i == 0 {
+			if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+				editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), text)
+				editMsg.ParseMode = parseMode
+				if keyboard != nil && len(pieces) == 1 {
+					editMsg.ReplyMarkup = keyboard
+				}
+				if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
+					continue
+				}
+				// Fallback to new message if edit fails
+			}
+		}
+
+		tgMsg := tu.Message(tu.ID(chatID), text)
+		tgMsg.ParseMode = parseMode
+		tgMsg.MessageThreadID = threadID
+		tgMsg.ReplyMarkup = markup
+
+		if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+			logger.ErrorCF("telegram", "Formatted message rejected, falling back to plain text", map[string]any{
+				"error": err.Error(),
+			})
+			tgMsg.Text = format.Format(piece, format.Plain)
+			tgMsg.ParseMode = ""
+			if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+				return err
+			}
 		}
-		// Fallback to new message if edit fails
 	}
 
-	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
-	tgMsg.ParseMode = telego.ModeHTML
+	return nil
+}
 
-	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
-		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]any{
-			"error": err.Error(),
-		})
-		tgMsg.ParseMode = ""
-		_, err = c.bot.SendMessage(ctx, tgMsg)
-		return err
+// Capabilities reports the configured parse mode and Telegram's limits.
+func (c *TelegramChannel) Capabilities() Capabilities {
+	dialect, _ := c.dialect()
+	return Capabilities{
+		Markdown:         dialect,
+		MaxMessageLength: telegramMaxMessageLength,
+		Streaming:        true,
+		Reactions:        true,
+		Typing:           true,
+		Attachments:      true,
+		Buttons:          true,
+	}
+}
+
+// dialect returns the formatter dialect and matching Telegram parse mode.
+func (c *TelegramChannel) dialect() (format.Dialect, string) {
+	if strings.EqualFold(c.config.Channels.Telegram.ParseMode, "markdownv2") {
+		return format.TelegramMarkdownV2, telego.ModeMarkdownV2
 	}
+	return format.TelegramHTML, telego.ModeHTML
+}
 
+// CheckHealth calls getMe to confirm the bot API is reachable.
+func (c *TelegramChannel) CheckHealth(ctx context.Context) error {
+	if _, err := c.bot.GetMe(ctx); err != nil {
+		return fmt.Errorf("telegram getMe failed: %w", err)
+	}
 	return nil
 }
 
+// StartTyping shows "typing..." in the chat until stop is called. Telegram
+// clears the indicator after five seconds, so it is resent every four.
+func (c *TelegramChannel) StartTyping(ctx context.Context, chatKey string) (func(), error) {
+	chatID, threadID, err := parseTelegramChatKey(chatKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chat ID: %w", err)
+	}
+	return keepTyping(ctx, 4*time.Second, func(ctx context.Context) error {
+		action := tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping)
+		action.MessageThreadID = threadID
+		return c.bot.SendChatAction(ctx, action)
+	})
+}
+
+// AddReaction sets the bot's reaction on a message. Bots have one reaction
+// per message, so this replaces any earlier one.
+func (c *TelegramChannel) AddReaction(ctx context.Context, chatKey, messageID, emoji string) error {
+	return c.setReaction(ctx, chatKey, messageID, []telego.ReactionType{tu.ReactionEmoji(emoji)})
+}
+
+func (c *TelegramChannel) RemoveReaction(ctx context.Context, chatKey, messageID, emoji string) error {
+	return c.setReaction(ctx, chatKey, messageID, nil)
+}
+
+func (c *TelegramChannel) setReaction(ctx context.Context, chatKey, messageID string, reaction []telego.ReactionType) error {
+	chatID, _, err := parseTelegramChatKey(chatKey)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	msgID, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %w", err)
+	}
+	return c.bot.SetMessageReaction(ctx, &telego.SetMessageReactionParams{
+		ChatID:    tu.ID(chatID),
+		MessageID: msgID,
+		Reaction:  reaction,
+	})
+}
+
+// SendDelta implements StreamingChannel by periodically editing the
+// placeholder message with the text generated so far.
+func (c *TelegramChannel) SendDelta(chatID, delta string) {
+	if !c.config.Channels.Telegram.StreamReplies {
+		return
+	}
+
+	v, _ := c.streams.LoadOrStore(chatID, &telegramStream{})
+	stream := v.(*telegramStream)
+
+	stream.mu.Lock()
+	stream.text.WriteString(delta)
+	if stream.done || stream.editing || time.Since(stream.lastEdit) < telegramStreamInterval {
+		stream.mu.Unlock()
+		return
+	}
+	stream.editing = true
+	text := stream.text.String()
+	stream.mu.Unlock()
+
+	go c.flushStream(chatID, stream, text)
+}
+
+func (c *TelegramChannel) flushStream(chatKey string, stream *telegramStream, text string) {
+	stream.editMu.Lock()
+	defer stream.editMu.Unlock()
+	defer func() {
+		stream.mu.Lock()
+		stream.editing = false
+		stream.lastEdit = time.Now()
+		stream.mu.Unlock()
+	}()
+
+	stream.mu.Lock()
+	done := stream.done
+	stream.mu.Unlock()
+	if done {
+		return
+	}
+
+	chatID, threadID, err := parseTelegramChatKey(chatKey)
+	if err != nil {
+		return
+	}
+
+	// Partial Markdown can't be converted reliably, so previews are plain.
+	preview := utils.Truncate(strings.TrimSpace(text), telegramMaxMessageLength-2) + " ▍"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if pID, ok := c.placeholders.Load(chatKey); ok {
+		if _, err := c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), preview)); err != nil {
+			logger.DebugCF("telegram", "Failed to update streamed reply", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	params := tu.Message(tu.ID(chatID), preview)
+	params.MessageThreadID = threadID
+	if pMsg, err := c.bot.SendMessage(ctx, params); err == nil {
+		c.placeholders.Store(chatKey, pMsg.MessageID)
+	}
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -216,24 +406,23 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		return nil
 	}
 
+	isGroup := message.Chat.Type != "private"
+	if isGroup && c.config.Channels.Telegram.MentionOnly && !isAddressedToBot(message, c.bot.ID(), c.bot.Username()) {
+		return nil
+	}
+
 	chatID := message.Chat.ID
 	c.chatIDs[senderID] = chatID
 
-	content := ""
-	mediaPaths := []string{}
-	localFiles := []string{} // track local files that need cleanup
+	// Forum topics are separate conversations within the group.
+	threadID := 0
+	if message.IsTopicMessage {
+		threadID = message.MessageThreadID
+	}
+	chatKey := telegramChatKey(chatID, threadID)
 
-	// ensure temp files are cleaned up when function returns
-	defer func() {
-		for _, file := range localFiles {
-			if err := os.Remove(file); err != nil {
-				logger.DebugCF("telegram", "Failed to cleanup temp file", map[string]any{
-					"file":  file,
-					"error": err.Error(),
-				})
-			}
-		}
-	}()
+	content := ""
+	var attachments []bus.Attachment
 
 	if message.Text != "" {
 		content += message.Text
@@ -246,35 +435,34 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		content += message.Caption
 	}
 
+	if isGroup && c.bot.Username() != "" {
+		content = stripBotMention(content, c.bot.Username())
+	}
+
 	if len(message.Photo) > 0 {
 		photo := message.Photo[len(message.Photo)-1]
-		photoPath := c.downloadPhoto(ctx, photo.FileID)
-		if photoPath != "" {
-			localFiles = append(localFiles, photoPath)
-			mediaPaths = append(mediaPaths, photoPath)
-			if content != "" {
-				content += "\n"
-			}
-			content += "[image: photo]"
-		}
+		attachments = append(attachments, c.telegramAttachment(photo.FileID, "photo.jpg", "image/jpeg"))
 	}
 
 	if message.Voice != nil {
-		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
-		if voicePath != "" {
-			localFiles = append(localFiles, voicePath)
-			mediaPaths = append(mediaPaths, voicePath)
+		voiceNote, err := c.FetchAttachment(ctx, c.telegramAttachment(message.Voice.FileID, "voice.ogg", message.Voice.MimeType))
+		if err != nil {
+			logger.ErrorCF("telegram", "Failed to download voice message", map[string]any{
+				"error": err.Error(),
+			})
+		} else {
+			attachments = append(attachments, voiceNote)
 
 			transcribedText := ""
 			if c.transcriber != nil && c.transcriber.IsAvailable() {
 				transcriberCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 				defer cancel()
 
-				result, err := c.transcriber.Transcribe(transcriberCtx, voicePath)
+				result, err := c.transcriber.Transcribe(transcriberCtx, voiceNote.Path)
 				if err != nil {
 					logger.ErrorCF("telegram", "Voice transcription failed", map[string]any{
 						"error": err.Error(),
-						"path":  voicePath,
+						"path":  voiceNote.Path,
 					})
 					transcribedText = "[voice (transcription failed)]"
 				} else {
@@ -295,27 +483,23 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	}
 
 	if message.Audio != nil {
-		audioPath := c.downloadFile(ctx, message.Audio.FileID, ".mp3")
-		if audioPath != "" {
-			localFiles = append(localFiles, audioPath)
-			mediaPaths = append(mediaPaths, audioPath)
-			if content != "" {
-				content += "\n"
-			}
-			content += "[audio]"
+		name := message.Audio.FileName
+		if name == "" {
+			name = "audio.mp3"
 		}
+		attachments = append(attachments, c.telegramAttachment(message.Audio.FileID, name, message.Audio.MimeType))
 	}
 
 	if message.Document != nil {
-		docPath := c.downloadFile(ctx, message.Document.FileID, "")
-		if docPath != "" {
-			localFiles = append(localFiles, docPath)
-			mediaPaths = append(mediaPaths, docPath)
-			if content != "" {
-				content += "\n"
-			}
-			content += "[file]"
+		name := message.Document.FileName
+		if name == "" {
+			name = "document"
 		}
+		attachments = append(attachments, c.telegramAttachment(message.Document.FileID, name, message.Document.MimeType))
+	}
+
+	if content == "" && len(attachments) > 0 {
+		content = "[attachment]"
 	}
 
 	if content == "" {
@@ -324,21 +508,12 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 
 	logger.DebugCF("telegram", "Received message", map[string]any{
 		"sender_id": senderID,
-		"chat_id":   fmt.Sprintf("%d", chatID),
+		"chat_id":   chatKey,
 		"preview":   utils.Truncate(content, 50),
 	})
 
-	// Thinking indicator
-	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
-	if err != nil {
-		logger.ErrorCF("telegram", "Failed to send chat action", map[string]any{
-			"error": err.Error(),
-		})
-	}
-
 	// Stop any previous thinking animation
-	chatIDStr := fmt.Sprintf("%d", chatID)
-	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
+	if prevStop, ok := c.stopThinking.Load(chatKey); ok {
 		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
 			cf.Cancel()
 		}
@@ -346,184 +521,235 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 
 	// Create cancel function for thinking state
 	_, thinkCancel := context.WithTimeout(ctx, 5*time.Minute)
-	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
+	c.stopThinking.Store(chatKey, &thinkingCancel{fn: thinkCancel})
+
+	// A new request starts a new streamed reply.
+	c.streams.Delete(chatKey)
 
-	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭"))
+	placeholder := tu.Message(tu.ID(chatID), "Thinking... 💭")
+	placeholder.MessageThreadID = threadID
+	pMsg, err := c.bot.SendMessage(ctx, placeholder)
 	if err == nil {
 		pID := pMsg.MessageID
-		c.placeholders.Store(chatIDStr, pID)
+		c.placeholders.Store(chatKey, pID)
 	}
 
-	peerKind := "direct"
-	peerID := fmt.Sprintf("%d", user.ID)
-	if message.Chat.Type != "private" {
-		peerKind = "group"
-		peerID = fmt.Sprintf("%d", chatID)
-	}
+	metadata := telegramPeerMetadata(message.Chat, threadID, user.ID)
+	metadata["message_id"] = fmt.Sprintf("%d", message.MessageID)
+	metadata["user_id"] = fmt.Sprintf("%d", user.ID)
+	metadata["username"] = user.Username
+	metadata["first_name"] = user.FirstName
 
-	metadata := map[string]string{
-		"message_id": fmt.Sprintf("%d", message.MessageID),
-		"user_id":    fmt.Sprintf("%d", user.ID),
-		"username":   user.Username,
-		"first_name": user.FirstName,
-		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
-		"peer_kind":  peerKind,
-		"peer_id":    peerID,
-	}
-
-	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
+	c.HandleMessageWithAttachments(fmt.Sprintf("%d", user.ID), chatKey, content, attachments, metadata)
 	return nil
 }
 
-func (c *TelegramChannel) downloadPhoto(ctx context.Context, fileID string) string {
-	file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
-	if err != nil {
-		logger.ErrorCF("telegram", "Failed to get photo file", map[string]any{
-			"error": err.Error(),
-		})
-		return ""
+// handleCallbackQuery turns an inline button press into an inbound message
+// carrying the button's data.
+func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, query telego.CallbackQuery) error {
+	senderID := fmt.Sprintf("%d", query.From.ID)
+	if query.From.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", query.From.ID, query.From.Username)
 	}
-
-	return c.downloadFileWithInfo(file, ".jpg")
-}
-
-func (c *TelegramChannel) downloadFileWithInfo(file *telego.File, ext string) string {
-	if file.FilePath == "" {
-		return ""
+	if !c.IsAllowed(senderID) {
+		return c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID).WithText("Not allowed"))
 	}
 
-	url := c.bot.FileDownloadURL(file.FilePath)
-	logger.DebugCF("telegram", "File URL", map[string]any{"url": url})
-
-	// Use FilePath as filename for better identification
-	filename := file.FilePath + ext
-	return utils.DownloadFile(url, filename, utils.DownloadOptions{
-		LoggerPrefix: "telegram",
-	})
-}
-
-func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string) string {
-	file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
-	if err != nil {
-		logger.ErrorCF("telegram", "Failed to get file", map[string]any{
-			"error": err.Error(),
-		})
-		return ""
+	message, ok := query.Message.(*telego.Message)
+	if !ok || query.Data == "" {
+		return c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID))
 	}
 
-	return c.downloadFileWithInfo(file, ext)
-}
-
-func parseChatID(chatIDStr string) (int64, error) {
-	var id int64
-	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
-	return id, err
-}
-
-func markdownToTelegramHTML(text string) string {
-	if text == "" {
-		return ""
+	choice := query.Data
+	if message.ReplyMarkup != nil {
+		for _, row := range message.ReplyMarkup.InlineKeyboard {
+			for _, b := range row {
+				if b.CallbackData == query.Data {
+					choice = b.Text
+				}
+			}
+		}
+	}
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID).WithText(choice)); err != nil {
+		logger.DebugCF("telegram", "Failed to answer callback query", map[string]any{"error": err.Error()})
 	}
 
-	codeBlocks := extractCodeBlocks(text)
-	text = codeBlocks.text
-
-	inlineCodes := extractInlineCodes(text)
-	text = inlineCodes.text
-
-	text = regexp.MustCompile(`^#{1,6}\s+(.+)$`).ReplaceAllString(text, "$1")
-
-	text = regexp.MustCompile(`^>\s*(.*)$`).ReplaceAllString(text, "$1")
+	// Remove the buttons so a prompt can only be answered once.
+	if _, err := c.bot.EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+		ChatID:    tu.ID(message.Chat.ID),
+		MessageID: message.MessageID,
+	}); err != nil {
+		logger.DebugCF("telegram", "Failed to remove inline keyboard", map[string]any{"error": err.Error()})
+	}
 
-	text = escapeHTML(text)
+	threadID := 0
+	if message.IsTopicMessage {
+		threadID = message.MessageThreadID
+	}
 
-	text = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`).ReplaceAllString(text, `<a href="$2">$1</a>`)
+	metadata := telegramPeerMetadata(message.Chat, threadID, query.From.ID)
+	metadata["callback_query"] = "true"
+	metadata["message_id"] = fmt.Sprintf("%d", message.MessageID)
+	metadata["user_id"] = fmt.Sprintf("%d", query.From.ID)
+	metadata["username"] = query.From.Username
+	metadata["first_name"] = query.From.FirstName
 
-	text = regexp.MustCompile(`\*\*(.+?)\*\*`).ReplaceAllString(text, "<b>$1</b>")
+	logger.DebugCF("telegram", "Button pressed", map[string]any{
+		"sender_id": senderID,
+		"data":      query.Data,
+	})
 
-	text = regexp.MustCompile(`__(.+?)__`).ReplaceAllString(text, "<b>$1</b>")
+	c.HandleMessage(fmt.Sprintf("%d", query.From.ID), telegramChatKey(message.Chat.ID, threadID), query.Data, nil, metadata)
+	return nil
+}
 
-	reItalic := regexp.MustCompile(`_([^_]+)_`)
-	text = reItalic.ReplaceAllStringFunc(text, func(s string) string {
-		match := reItalic.FindStringSubmatch(s)
-		if len(match) < 2 {
-			return s
+// telegramAttachment describes a Telegram file; it is only looked up and
+// downloaded when the media store fetches it.
+func (c *TelegramChannel) telegramAttachment(fileID, name, contentType string) bus.Attachment {
+	att := media.FromURL("", name, contentType, nil)
+	att.Fetch = func(ctx context.Context) (io.ReadCloser, error) {
+		file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
+		if err != nil {
+			return nil, fmt.Errorf("get file: %w", err)
 		}
-		return "<i>" + match[1] + "</i>"
-	})
-
-	text = regexp.MustCompile(`~~(.+?)~~`).ReplaceAllString(text, "<s>$1</s>")
+		if file.FilePath == "" {
+			return nil, fmt.Errorf("file %s is not downloadable", fileID)
+		}
+		return media.HTTPFetch(c.bot.FileDownloadURL(file.FilePath), nil)(ctx)
+	}
+	return att
+}
 
-	text = regexp.MustCompile(`^[-*]\s+`).ReplaceAllString(text, "• ")
+// SendAttachment uploads a file; images are sent as photos so Telegram
+// shows them inline.
+func (c *TelegramChannel) SendAttachment(ctx context.Context, chatID string, att bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+	cid, threadID, err := parseTelegramChatKey(chatID)
+	if err != nil {
+		return err
+	}
 
-	for i, code := range inlineCodes.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), fmt.Sprintf("<code>%s</code>", escaped))
+	f, err := os.Open(att.Path)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+	file := tu.FileFromReader(f, att.Name)
 
-	for i, code := range codeBlocks.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(
-			text,
-			fmt.Sprintf("\x00CB%d\x00", i),
-			fmt.Sprintf("<pre><code>%s</code></pre>", escaped),
-		)
+	if att.Type == bus.AttachmentImage {
+		photo := tu.Photo(tu.ID(cid), file)
+		photo.MessageThreadID = threadID
+		_, err = c.bot.SendPhoto(ctx, photo)
+	} else {
+		doc := tu.Document(tu.ID(cid), file)
+		doc.MessageThreadID = threadID
+		_, err = c.bot.SendDocument(ctx, doc)
 	}
+	return err
+}
 
-	return text
+// telegramChatKey is the chat ID used on the bus: the numeric chat ID, or
+// "<chatID>/<topicID>" for forum topics so each topic gets its own session.
+func telegramChatKey(chatID int64, threadID int) string {
+	if threadID != 0 {
+		return fmt.Sprintf("%d/%d", chatID, threadID)
+	}
+	return fmt.Sprintf("%d", chatID)
 }
 
-type codeBlockMatch struct {
-	text  string
-	codes []string
+func parseTelegramChatKey(key string) (int64, int, error) {
+	chatPart, threadPart, hasThread := strings.Cut(key, "/")
+	chatID, err := parseChatID(chatPart)
+	if err != nil || !hasThread {
+		return chatID, 0, err
+	}
+	var threadID int
+	if _, err := fmt.Sscanf(threadPart, "%d", &threadID); err != nil {
+		return 0, 0, fmt.Errorf("invalid topic ID %q", threadPart)
+	}
+	return chatID, threadID, nil
 }
 
-func extractCodeBlocks(text string) codeBlockMatch {
-	re := regexp.MustCompile("```[\\w]*\\n?([\\s\\S]*?)```")
-	matches := re.FindAllStringSubmatch(text, -1)
+// telegramPeerMetadata describes the routing peer: the user in private
+// chats, the group otherwise, and the topic (with the group as parent) in
+// forums.
+func telegramPeerMetadata(chat telego.Chat, threadID int, userID int64) map[string]string {
+	isGroup := chat.Type != "private"
+	metadata := map[string]string{
+		"is_group":  fmt.Sprintf("%t", isGroup),
+		"peer_kind": "direct",
+		"peer_id":   fmt.Sprintf("%d", userID),
+	}
+	if !isGroup {
+		return metadata
+	}
+
+	groupID := fmt.Sprintf("%d", chat.ID)
+	if threadID != 0 {
+		metadata["peer_kind"] = "topic"
+		metadata["peer_id"] = telegramChatKey(chat.ID, threadID)
+		metadata["parent_peer_kind"] = "group"
+		metadata["parent_peer_id"] = groupID
+		metadata["topic_id"] = fmt.Sprintf("%d", threadID)
+	} else {
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = groupID
+	}
+	return metadata
+}
 
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
+// isAddressedToBot reports whether a group message mentions the bot, is a
+// command addressed to it, or replies to one of its messages.
+func isAddressedToBot(message *telego.Message, botID int64, botUsername string) bool {
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == botID {
+		// In forums every message "replies" to the topic's opening message.
+		if !message.IsTopicMessage || reply.MessageID != message.MessageThreadID {
+			return true
+		}
 	}
 
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00CB%d\x00", i)
-		i++
-		return placeholder
-	})
+	entities := append(append([]telego.MessageEntity{}, message.Entities...), message.CaptionEntities...)
+	for _, e := range entities {
+		if e.Type == "text_mention" && e.User != nil && e.User.ID == botID {
+			return true
+		}
+	}
 
-	return codeBlockMatch{text: text, codes: codes}
+	if botUsername == "" {
+		return false
+	}
+	text := strings.ToLower(message.Text + "\n" + message.Caption)
+	return strings.Contains(text, "@"+strings.ToLower(botUsername))
 }
 
-type inlineCodeMatch struct {
-	text  string
-	codes []string
+func stripBotMention(content, botUsername string) string {
+	re := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(botUsername) + `\b`)
+	return strings.TrimSpace(re.ReplaceAllString(content, ""))
 }
 
-func extractInlineCodes(text string) inlineCodeMatch {
-	re := regexp.MustCompile("`([^`]+)`")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
+// telegramKeyboard renders buttons as an inline keyboard, three per row.
+// Telegram limits callback data to 64 bytes; longer buttons are dropped.
+func telegramKeyboard(buttons []bus.Button) *telego.InlineKeyboardMarkup {
+	var keys []telego.InlineKeyboardButton
+	for _, b := range buttons {
+		if b.Data == "" || len(b.Data) > 64 {
+			logger.WarnCF("telegram", "Skipping button with invalid callback data", map[string]any{
+				"text": b.Text,
+			})
+			continue
+		}
+		keys = append(keys, tu.InlineKeyboardButton(b.Text).WithCallbackData(b.Data))
 	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return inlineCodeMatch{text: text, codes: codes}
+	if len(keys) == 0 {
+		return nil
+	}
+	return tu.InlineKeyboard(tu.InlineKeyboardCols(3, keys...)...)
 }
 
-func escapeHTML(text string) string {
-	text = strings.ReplaceAll(text, "&", "&amp;")
-	text = strings.ReplaceAll(text, "<", "&lt;")
-	text = strings.ReplaceAll(text, ">", "&gt;")
-	return text
+func parseChatID(chatIDStr string) (int64, error) {
+	var id int64
+	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
+	return id, err
 }
@@ -0,0 +1,264 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestTelegramChatKey(t *testing.T) {
+	tests := []struct {
+		chatID   int64
+		threadID int
+		key      string
+	}{
+		{chatID: 12345, key: "12345"},
+		{chatID: -1001234567890, threadID: 42, key: "-1001234567890/42"},
+	}
+	for _, tt := range tests {
+		if got := telegramChatKey(tt.chatID, tt.threadID); got != tt.key {
+			t.Errorf("telegramChatKey(%d, %d) = %q, want %q", tt.chatID, tt.threadID, got, tt.key)
+		}
+		chatID, threadID, err := parseTelegramChatKey(tt.key)
+		if err != nil || chatID != tt.chatID || threadID != tt.threadID {
+			t.Errorf("parseTelegramChatKey(%q) = %d, %d, %v", tt.key, chatID, threadID, err)
+		}
+	}
+
+	if _, _, err := parseTelegramChatKey("-100/abc"); err == nil {
+		t.Error("expected error for invalid topic ID")
+	}
+}
+
+func TestTelegramPeerMetadata(t *testing.T) {
+	private := telegramPeerMetadata(telego.Chat{ID: 7, Type: "private"}, 0, 7)
+	if private["peer_kind"] != "direct" || private["peer_id"] != "7" {
+		t.Errorf("private = %v", private)
+	}
+
+	group := telegramPeerMetadata(telego.Chat{ID: -100, Type: "supergroup"}, 0, 7)
+	if group["peer_kind"] != "group" || group["peer_id"] != "-100" || group["parent_peer_id"] != "" {
+		t.Errorf("group = %v", group)
+	}
+
+	topic := telegramPeerMetadata(telego.Chat{ID: -100, Type: "supergroup"}, 42, 7)
+	if topic["peer_kind"] != "topic" || topic["peer_id"] != "-100/42" ||
+		topic["parent_peer_kind"] != "group" || topic["parent_peer_id"] != "-100" {
+		t.Errorf("topic = %v", topic)
+	}
+}
+
+func TestIsAddressedToBot(t *testing.T) {
+	const botID = 999
+	bot := &telego.User{ID: botID, Username: "pico_bot"}
+	other := &telego.User{ID: 1}
+
+	tests := []struct {
+		name    string
+		message telego.Message
+		want    bool
+	}{
+		{"plain", telego.Message{Text: "hello everyone"}, false},
+		{"mention", telego.Message{Text: "hey @Pico_Bot what's up"}, true},
+		{"mention in caption", telego.Message{Caption: "@pico_bot look"}, true},
+		{"command for bot", telego.Message{Text: "/show@pico_bot model"}, true},
+		{
+			"text mention",
+			telego.Message{Text: "Pico?", Entities: []telego.MessageEntity{{Type: "text_mention", User: bot}}},
+			true,
+		},
+		{"reply to bot", telego.Message{Text: "and?", ReplyToMessage: &telego.Message{MessageID: 5, From: bot}}, true},
+		{"reply to someone else", telego.Message{Text: "and?", ReplyToMessage: &telego.Message{MessageID: 5, From: other}}, false},
+		{
+			"topic root is not a reply",
+			telego.Message{
+				Text: "hi", IsTopicMessage: true, MessageThreadID: 5,
+				ReplyToMessage: &telego.Message{MessageID: 5, From: bot},
+			},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAddressedToBot(&tt.message, botID, "pico_bot"); got != tt.want {
+				t.Errorf("isAddressedToBot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := stripBotMention("@PICO_BOT summarize this", "pico_bot"); got != "summarize this" {
+		t.Errorf("stripBotMention() = %q", got)
+	}
+}
+
+func TestTelegramKeyboard(t *testing.T) {
+	if telegramKeyboard(nil) != nil {
+		t.Error("expected no keyboard without buttons")
+	}
+
+	kb := telegramKeyboard([]bus.Button{
+		{Text: "Approve", Data: "/approve 1"},
+		{Text: "Deny", Data: "/deny 1"},
+		{Text: "Later", Data: "/later 1"},
+		{Text: "Details", Data: "/details 1"},
+		{Text: "Too long", Data: strings.Repeat("x", 65)},
+	})
+	if kb == nil || len(kb.InlineKeyboard) != 2 || len(kb.InlineKeyboard[0]) != 3 || len(kb.InlineKeyboard[1]) != 1 {
+		t.Fatalf("unexpected keyboard: %+v", kb)
+	}
+	if kb.InlineKeyboard[0][0].CallbackData != "/approve 1" {
+		t.Errorf("callback data = %q", kb.InlineKeyboard[0][0].CallbackData)
+	}
+}
+
+// fakeTelegramAPI records Bot API calls and answers them with a minimal
+// message object.
+type fakeTelegramAPI struct {
+	mu    sync.Mutex
+	calls []fakeTelegramCall
+}
+
+type fakeTelegramCall struct {
+	method string
+	params map[string]any
+}
+
+func (f *fakeTelegramAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	body, _ := io.ReadAll(r.Body)
+	params := map[string]any{}
+	json.Unmarshal(body, &params)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeTelegramCall{method, params})
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true,"result":{"message_id":77,"date":0,"chat":{"id":-100,"type":"supergroup"}}}`))
+}
+
+func (f *fakeTelegramAPI) snapshot() []fakeTelegramCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeTelegramCall(nil), f.calls...)
+}
+
+func TestTelegramChannel_StreamsIntoPlaceholder(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	bot, err := telego.NewBot("123456:"+strings.Repeat("A", 35), telego.WithAPIServer(server.URL), telego.WithDiscardLogger())
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	cfg := config.DefaultConfig()
+	ch := &TelegramChannel{
+		BaseChannel: NewBaseChannel("telegram", cfg.Channels.Telegram, bus.NewMessageBus(), nil),
+		bot:         bot,
+		config:      cfg,
+		chatIDs:     map[string]int64{},
+	}
+	ch.setRunning(true)
+	ch.placeholders.Store("-100/42", 77)
+
+	ch.SendDelta("-100/42", "Checking ")
+	ch.SendDelta("-100/42", "the logs")
+
+	// Wait for the first preview edit.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(api.snapshot()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = ch.Send(context.Background(), bus.OutboundMessage{
+		ChatID:  "-100/42",
+		Content: "Checking the logs: **all good**",
+		Buttons: []bus.Button{{Text: "Restart", Data: "/restart"}},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	calls := api.snapshot()
+	if len(calls) != 2 {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if calls[0].method != "editMessageText" || calls[0].params["text"] != "Checking ▍" {
+		t.Errorf("preview call = %+v", calls[0])
+	}
+	final := calls[1]
+	if final.method != "editMessageText" || final.params["parse_mode"] != "HTML" ||
+		!strings.Contains(final.params["text"].(string), "<b>all good</b>") {
+		t.Errorf("final call = %+v", final)
+	}
+	if _, ok := final.params["reply_markup"]; !ok {
+		t.Errorf("final call has no buttons: %+v", final)
+	}
+
+	// A new reply in the topic without a placeholder goes to the thread.
+	if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "-100/42", Content: "again"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	last := api.snapshot()[2]
+	if last.method != "sendMessage" || last.params["message_thread_id"] != float64(42) {
+		t.Errorf("send call = %+v", last)
+	}
+}
+
+func TestTelegramChannel_SplitsLongReplies(t *testing.T) {
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	bot, err := telego.NewBot("123456:"+strings.Repeat("A", 35), telego.WithAPIServer(server.URL), telego.WithDiscardLogger())
+	if err != nil {
+		t.Fatalf("NewBot() error = %v", err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Channels.Telegram.ParseMode = "markdownv2"
+	ch := &TelegramChannel{
+		BaseChannel: NewBaseChannel("telegram", cfg.Channels.Telegram, bus.NewMessageBus(), nil),
+		bot:         bot,
+		config:      cfg,
+		chatIDs:     map[string]int64{},
+	}
+	ch.setRunning(true)
+
+	content := strings.Repeat("Version 1.2.3 is out (finally)!\n", 300)
+	err = ch.Send(context.Background(), bus.OutboundMessage{
+		ChatID:  "-100",
+		Content: content,
+		Buttons: []bus.Button{{Text: "Changelog", Data: "/changelog"}},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	calls := api.snapshot()
+	if len(calls) < 3 {
+		t.Fatalf("expected the reply to be split, got %d calls", len(calls))
+	}
+	for i, call := range calls {
+		text := call.params["text"].(string)
+		if call.params["parse_mode"] != "MarkdownV2" || len(text) > telegramMaxMessageLength {
+			t.Errorf("call %d: parse_mode=%v, %d bytes", i, call.params["parse_mode"], len(text))
+		}
+		_, hasButtons := call.params["reply_markup"]
+		if hasButtons != (i == len(calls)-1) {
+			t.Errorf("call %d: buttons = %v, want them only on the last message", i, hasButtons)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// TerminalChannel backs the interactive `picoclaw chat` REPL. Unlike the
+// internal "cli" channel it goes through the message bus like any other
+// gateway, so routing, commands and streaming behave exactly as they do for
+// remote users.
+type TerminalChannel struct {
+	*BaseChannel
+	out    io.Writer
+	prefix string
+
+	mu       sync.Mutex
+	streamed strings.Builder // deltas printed since the last complete reply
+	replies  chan string
+}
+
+// NewTerminalChannel creates a terminal channel that prints replies to out,
+// each introduced by prefix.
+func NewTerminalChannel(messageBus *bus.MessageBus, out io.Writer, prefix string) *TerminalChannel {
+	return &TerminalChannel{
+		BaseChannel: NewBaseChannel("terminal", nil, messageBus, nil),
+		out:         out,
+		prefix:      prefix,
+		replies:     make(chan string, 16),
+	}
+}
+
+func (c *TerminalChannel) Start(ctx context.Context) error {
+	c.setRunning(true)
+	return nil
+}
+
+func (c *TerminalChannel) Stop(ctx context.Context) error {
+	c.setRunning(false)
+	return nil
+}
+
+// Submit hands a line of user input to the agent.
+func (c *TerminalChannel) Submit(session, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+
+	logger.DebugCF("terminal", "Received message", map[string]any{
+		"session": session,
+		"length":  len(content),
+	})
+
+	c.HandleMessage("terminal:"+session, session, content, nil, map[string]string{
+		"peer_kind": "direct",
+		"peer_id":   session,
+	})
+}
+
+// Replies delivers every complete reply after it has been printed, so the
+// REPL can wait for the agent before prompting again.
+func (c *TerminalChannel) Replies() <-chan string {
+	return c.replies
+}
+
+// Capabilities reports streaming; replies are printed as written.
+func (c *TerminalChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Markdown, Streaming: true}
+}
+
+func (c *TerminalChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("terminal channel not running")
+	}
+
+	c.mu.Lock()
+	streamed := strings.TrimSpace(c.streamed.String())
+	c.streamed.Reset()
+	content := strings.TrimSpace(msg.Content)
+	switch {
+	case streamed != "" && strings.HasSuffix(streamed, content):
+		// Already on screen; just finish the line.
+		fmt.Fprint(c.out, "\n\n")
+	case streamed != "":
+		fmt.Fprintf(c.out, "\n\n%s %s\n\n", c.prefix, content)
+	default:
+		fmt.Fprintf(c.out, "\n%s %s\n\n", c.prefix, content)
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.replies <- msg.Content:
+	default:
+	}
+	return nil
+}
+
+// SendDelta implements StreamingChannel.
+func (c *TerminalChannel) SendDelta(chatID, delta string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.streamed.Len() == 0 {
+		fmt.Fprintf(c.out, "\n%s ", c.prefix)
+	}
+	c.streamed.WriteString(delta)
+	fmt.Fprint(c.out, delta)
+}
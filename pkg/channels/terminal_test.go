@@ -0,0 +1,85 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestTerminalChannel_Submit(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewTerminalChannel(msgBus, &strings.Builder{}, ">")
+	ch.Start(context.Background())
+
+	ch.Submit("work", "  hello\nworld  ")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.Channel != "terminal" || msg.ChatID != "work" || msg.Content != "hello\nworld" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "work" {
+		t.Errorf("unexpected metadata: %v", msg.Metadata)
+	}
+}
+
+func TestTerminalChannel_Output(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		reply  string
+		want   string
+	}{
+		{
+			name:  "no streaming",
+			reply: "hi there",
+			want:  "\n> hi there\n\n",
+		},
+		{
+			name:   "streamed reply is not repeated",
+			deltas: []string{"hi ", "there"},
+			reply:  "hi there",
+			want:   "\n> hi there\n\n",
+		},
+		{
+			name:   "reply differs from stream",
+			deltas: []string{"let me check"},
+			reply:  "done",
+			want:   "\n> let me check\n\n> done\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			ch := NewTerminalChannel(bus.NewMessageBus(), &out, ">")
+			ch.Start(context.Background())
+
+			for _, d := range tt.deltas {
+				ch.SendDelta("default", d)
+			}
+			if err := ch.Send(context.Background(), bus.OutboundMessage{ChatID: "default", Content: tt.reply}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+			select {
+			case got := <-ch.Replies():
+				if got != tt.reply {
+					t.Errorf("reply = %q, want %q", got, tt.reply)
+				}
+			default:
+				t.Error("expected reply notification")
+			}
+		})
+	}
+}
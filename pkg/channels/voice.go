@@ -0,0 +1,272 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// 30 ms of 16 kHz mono PCM, the frame size wake-word engines work with.
+const voiceChunkBytes = voice.SampleRate * 2 * 30 / 1000
+
+// VoiceChannel turns a device with a microphone and speaker into a voice
+// assistant: wake word → record until silence → transcribe → agent → speak.
+// It has a single local user, so every request lands in the same chat.
+type VoiceChannel struct {
+	*BaseChannel
+	config      config.VoiceConfig
+	source      voice.AudioSource
+	sink        voice.AudioSink
+	synth       voice.Synthesizer
+	transcriber voice.Transcriber
+	// newWakeWord is nil when no wake word is configured; any speech then
+	// starts a request.
+	newWakeWord func(ctx context.Context) (voice.WakeWordDetector, error)
+	speaking    atomic.Bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+func NewVoiceChannel(cfg config.VoiceConfig, messageBus *bus.MessageBus) (*VoiceChannel, error) {
+	source, err := voice.NewCommandSource(cfg.InputCommand)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := voice.NewCommandSink(cfg.OutputCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	var synth voice.Synthesizer
+	switch {
+	case cfg.TTSCommand != "":
+		if synth, err = voice.NewCommandSynthesizer(cfg.TTSCommand); err != nil {
+			return nil, err
+		}
+	case cfg.TTSAPIKey != "" || cfg.TTSAPIBase != "":
+		synth = voice.NewSpeechSynthesizer(cfg.TTSAPIBase, cfg.TTSAPIKey, cfg.TTSModel, cfg.TTSVoice)
+	default:
+		return nil, fmt.Errorf("voice channel needs tts_command or tts_api_key")
+	}
+
+	c := &VoiceChannel{
+		BaseChannel: NewBaseChannel("voice", cfg, messageBus, nil),
+		config:      cfg,
+		source:      source,
+		sink:        sink,
+		synth:       synth,
+	}
+	if cfg.WakeWordCommand != "" {
+		c.newWakeWord = func(ctx context.Context) (voice.WakeWordDetector, error) {
+			return voice.NewCommandWakeWord(ctx, cfg.WakeWordCommand)
+		}
+	}
+	return c, nil
+}
+
+// SetTranscriber sets the speech-to-text backend. The channel cannot start
+// without one.
+func (c *VoiceChannel) SetTranscriber(transcriber voice.Transcriber) {
+	c.transcriber = transcriber
+}
+
+func (c *VoiceChannel) Start(ctx context.Context) error {
+	if c.transcriber == nil {
+		return fmt.Errorf("voice channel requires a transcriber (configure a Groq API key)")
+	}
+
+	logger.InfoCF("voice", "Starting voice assistant", map[string]any{
+		"wake_word": c.newWakeWord != nil,
+	})
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.listenLoop()
+	c.setRunning(true)
+	return nil
+}
+
+func (c *VoiceChannel) Stop(ctx context.Context) error {
+	logger.InfoC("voice", "Stopping voice assistant")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.setRunning(false)
+	return nil
+}
+
+// Capabilities reports plain text, which is what gets spoken.
+func (c *VoiceChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Plain}
+}
+
+func (c *VoiceChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("voice channel not running")
+	}
+
+	text := speakableText(msg.Content)
+	if text == "" {
+		return nil
+	}
+
+	audio, err := c.synth.Synthesize(ctx, text)
+	if err != nil {
+		return fmt.Errorf("voice synthesis: %w", err)
+	}
+
+	// Don't listen to ourselves.
+	c.speaking.Store(true)
+	defer c.speaking.Store(false)
+	if err := c.sink.Play(ctx, audio); err != nil {
+		return fmt.Errorf("voice playback: %w", err)
+	}
+	return nil
+}
+
+func (c *VoiceChannel) listenLoop() {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := c.listen(c.ctx)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		logger.WarnCF("voice", "Audio input stopped, restarting", map[string]any{
+			"error":   fmt.Sprint(err),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (c *VoiceChannel) listen(ctx context.Context) error {
+	stream, err := c.source.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	var detector voice.WakeWordDetector
+	if c.newWakeWord != nil {
+		if detector, err = c.newWakeWord(ctx); err != nil {
+			return err
+		}
+		defer detector.Close()
+	}
+
+	ep := &voice.Endpointer{
+		Threshold:   c.config.SilenceThreshold,
+		Silence:     time.Duration(c.config.SilenceMS) * time.Millisecond,
+		MaxDuration: time.Duration(c.config.MaxUtteranceSeconds) * time.Second,
+	}
+	if detector != nil {
+		// After the wake word, give up if the user doesn't say anything.
+		ep.Timeout = 5 * time.Second
+	}
+
+	recording := detector == nil
+	chunk := make([]byte, voiceChunkBytes)
+	for {
+		if _, err := io.ReadFull(stream, chunk); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				err = io.EOF
+			}
+			return err
+		}
+
+		// The detector sees the whole stream so its internal state stays
+		// consistent; detections while busy are ignored.
+		woke := false
+		if detector != nil {
+			if woke, err = detector.Process(chunk); err != nil {
+				return err
+			}
+		}
+		if c.speaking.Load() {
+			continue
+		}
+
+		if !recording {
+			if woke {
+				logger.InfoC("voice", "Wake word heard, listening")
+				recording = true
+				ep.Reset()
+			}
+			continue
+		}
+
+		if !ep.Add(chunk) {
+			continue
+		}
+		if pcm := ep.Utterance(); pcm != nil {
+			go c.handleUtterance(append([]byte(nil), pcm...))
+		}
+		ep.Reset()
+		recording = detector == nil
+	}
+}
+
+func (c *VoiceChannel) handleUtterance(pcm []byte) {
+	f, err := os.CreateTemp("", "picoclaw-voice-*.wav")
+	if err != nil {
+		logger.ErrorCF("voice", "Failed to create audio file", map[string]any{"error": err.Error()})
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(voice.EncodeWAV(pcm, voice.SampleRate))
+	f.Close()
+	if err != nil {
+		logger.ErrorCF("voice", "Failed to write audio file", map[string]any{"error": err.Error()})
+		return
+	}
+
+	result, err := c.transcriber.Transcribe(c.ctx, f.Name())
+	if err != nil {
+		logger.ErrorCF("voice", "Transcription failed", map[string]any{"error": err.Error()})
+		return
+	}
+	text := strings.TrimSpace(result.Text)
+	if text == "" {
+		return
+	}
+
+	logger.InfoCF("voice", "Heard request", map[string]any{
+		"preview": utils.Truncate(text, 50),
+	})
+
+	c.HandleMessage("voice:local", "local", text, nil, map[string]string{
+		"peer_kind": "direct",
+		"peer_id":   "local",
+	})
+}
+
+// speakableText drops markdown syntax that TTS engines would read aloud.
+// Link targets are dropped as well; nobody wants to hear a URL.
+func speakableText(s string) string {
+	s = reMarkdownLink.ReplaceAllString(s, "$1")
+	s = format.Format(s, format.Plain)
+	s = strings.NewReplacer("• ", "", "───", "").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+var reMarkdownLink = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
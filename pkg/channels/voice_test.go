@@ -0,0 +1,179 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+type fakeAudioSource struct {
+	pcm    []byte
+	opened bool
+}
+
+func (s *fakeAudioSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if s.opened {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	s.opened = true
+	return io.NopCloser(bytes.NewReader(s.pcm)), nil
+}
+
+// fakeWakeWord fires once, after the given number of chunks.
+type fakeWakeWord struct{ after int }
+
+func (w *fakeWakeWord) Process(pcm []byte) (bool, error) {
+	w.after--
+	return w.after == 0, nil
+}
+
+func (w *fakeWakeWord) Close() error { return nil }
+
+type fakeTranscriber struct {
+	mu      sync.Mutex
+	seconds float64
+}
+
+func (t *fakeTranscriber) Transcribe(ctx context.Context, path string) (*voice.TranscriptionResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.seconds = float64(len(data)-44) / 2 / voice.SampleRate
+	t.mu.Unlock()
+	return &voice.TranscriptionResponse{Text: " turn on the lights "}, nil
+}
+
+type fakeSpeaker struct {
+	said   []string
+	played [][]byte
+}
+
+func (s *fakeSpeaker) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	s.said = append(s.said, text)
+	return []byte("wav:" + text), nil
+}
+
+func (s *fakeSpeaker) Play(ctx context.Context, wav []byte) error {
+	s.played = append(s.played, wav)
+	return nil
+}
+
+func voiceAudio(ms int, amplitude int16) []byte {
+	n := voice.SampleRate * ms / 1000
+	buf := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		s := amplitude
+		if i%2 == 1 {
+			s = -amplitude
+		}
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func newTestVoiceChannel(pcm []byte, wake voice.WakeWordDetector) (*VoiceChannel, *fakeTranscriber, *fakeSpeaker, *bus.MessageBus) {
+	msgBus := bus.NewMessageBus()
+	speaker := &fakeSpeaker{}
+	transcriber := &fakeTranscriber{}
+	cfg := config.VoiceConfig{SilenceThreshold: 500, SilenceMS: 300, MaxUtteranceSeconds: 10}
+	c := &VoiceChannel{
+		BaseChannel: NewBaseChannel("voice", cfg, msgBus, nil),
+		config:      cfg,
+		source:      &fakeAudioSource{pcm: pcm},
+		sink:        speaker,
+		synth:       speaker,
+		transcriber: transcriber,
+	}
+	if wake != nil {
+		c.newWakeWord = func(ctx context.Context) (voice.WakeWordDetector, error) { return wake, nil }
+	}
+	return c, transcriber, speaker, msgBus
+}
+
+func TestVoiceChannel_WakeWordToRequest(t *testing.T) {
+	var pcm []byte
+	pcm = append(pcm, voiceAudio(600, 3000)...) // speech before the wake word is ignored
+	pcm = append(pcm, voiceAudio(300, 0)...)
+	pcm = append(pcm, voiceAudio(900, 3000)...) // the request
+	pcm = append(pcm, voiceAudio(600, 0)...)
+
+	// Wake after the first 900 ms (30 chunks).
+	c, transcriber, _, msgBus := newTestVoiceChannel(pcm, &fakeWakeWord{after: 30})
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer c.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.Channel != "voice" || msg.ChatID != "local" || msg.Content != "turn on the lights" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	// 900 ms of speech plus the 300 ms of trailing silence.
+	transcriber.mu.Lock()
+	defer transcriber.mu.Unlock()
+	if transcriber.seconds < 1.1 || transcriber.seconds > 1.3 {
+		t.Errorf("recorded %.2fs, want ~1.2s", transcriber.seconds)
+	}
+}
+
+func TestVoiceChannel_NoWakeWord(t *testing.T) {
+	pcm := append(voiceAudio(600, 3000), voiceAudio(600, 0)...)
+	c, _, _, msgBus := newTestVoiceChannel(pcm, nil)
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer c.Stop(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, ok := msgBus.ConsumeInbound(ctx); !ok {
+		t.Fatal("expected inbound message")
+	}
+}
+
+func TestVoiceChannel_Send(t *testing.T) {
+	c, _, speaker, _ := newTestVoiceChannel(nil, nil)
+	c.setRunning(true)
+
+	err := c.Send(context.Background(), bus.OutboundMessage{
+		ChatID:  "local",
+		Content: "## Weather\nIt is **sunny**, see [the forecast](https://example.com).",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	want := "Weather\nIt is sunny, see the forecast."
+	if len(speaker.said) != 1 || speaker.said[0] != want {
+		t.Errorf("said = %q, want %q", speaker.said, want)
+	}
+	if len(speaker.played) != 1 || string(speaker.played[0]) != "wav:"+want {
+		t.Errorf("played = %q", speaker.played)
+	}
+}
+
+func TestVoiceChannel_RequiresTranscriber(t *testing.T) {
+	c, _, _, _ := newTestVoiceChannel(nil, nil)
+	c.transcriber = nil
+	if err := c.Start(context.Background()); err == nil {
+		t.Fatal("expected error without transcriber")
+	}
+}
@@ -0,0 +1,394 @@
+package channels
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/handoff"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+//go:embed webui/index.html
+var webUIPage []byte
+
+const (
+	webClientBuffer    = 256
+	webPingInterval    = 30 * time.Second
+	webPongWait        = 60 * time.Second
+	webWriteWait       = 10 * time.Second
+	webMaxMessageBytes = 64 << 10
+)
+
+var webSessionPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// WebChannel serves a minimal browser chat page and streams the agent's
+// output to it as it is generated.
+//
+//	GET  /          embedded chat page
+//	GET  /ws        WebSocket: send {"type":"message","content":"..."}, receive events
+//	GET  /events    server-sent events, for clients that cannot use WebSocket
+//	POST /messages  submit a message when using the SSE stream
+//
+// Every browser tab picks a session ID (the ?session= query parameter) which
+// becomes the chat ID, so each session keeps its own conversation history.
+type WebChannel struct {
+	*BaseChannel
+	config     config.WebConfig
+	httpServer *http.Server
+	upgrader   websocket.Upgrader
+	mu         sync.RWMutex
+	clients    map[string]map[*webClient]struct{} // session → connected clients
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+type webClient struct {
+	events chan webEvent
+}
+
+// webEvent is sent to the browser over WebSocket or SSE.
+type webEvent struct {
+	Type    string `json:"type"` // "delta", "message", "typing" or "error"
+	Content string `json:"content,omitempty"`
+}
+
+type webInbound struct {
+	Type    string `json:"type"`
+	Session string `json:"session,omitempty"`
+	Content string `json:"content"`
+}
+
+func NewWebChannel(cfg config.WebConfig, messageBus *bus.MessageBus) (*WebChannel, error) {
+	if cfg.Port <= 0 {
+		return nil, fmt.Errorf("web port must be positive")
+	}
+
+	base := NewBaseChannel("web", cfg, messageBus, nil)
+
+	return &WebChannel{
+		BaseChannel: base,
+		config:      cfg,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+		},
+		clients: make(map[string]map[*webClient]struct{}),
+	}, nil
+}
+
+func (c *WebChannel) Start(ctx context.Context) error {
+	logger.InfoC("web", "Starting web chat channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	c.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           c.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.InfoCF("web", "Web chat listening", map[string]any{
+			"url": fmt.Sprintf("http://%s/", addr),
+		})
+		if err := handoff.ListenAndServe(c.httpServer); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("web", "Web chat server error", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	logger.InfoC("web", "Web chat channel started")
+	return nil
+}
+
+func (c *WebChannel) Stop(ctx context.Context) error {
+	logger.InfoC("web", "Stopping web chat channel")
+
+	// Cancelling the context also closes hijacked WebSocket and SSE connections,
+	// which Shutdown would otherwise wait on.
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("web", "Web chat shutdown error", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	c.setRunning(false)
+	logger.InfoC("web", "Web chat channel stopped")
+	return nil
+}
+
+// Send delivers the complete reply. Clients that already rendered streamed
+// deltas replace them with this content.
+// Capabilities reports Markdown, which the chat page renders, and streaming.
+func (c *WebChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Markdown, Streaming: true}
+}
+
+func (c *WebChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("web channel not running")
+	}
+	c.broadcast(msg.ChatID, webEvent{Type: "message", Content: msg.Content})
+	return nil
+}
+
+// SendDelta implements StreamingChannel.
+func (c *WebChannel) SendDelta(chatID, delta string) {
+	c.broadcast(chatID, webEvent{Type: "delta", Content: delta})
+}
+
+func (c *WebChannel) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", c.handleIndex)
+	mux.HandleFunc("GET /ws", c.handleWebSocket)
+	mux.HandleFunc("GET /events", c.handleEvents)
+	mux.HandleFunc("POST /messages", c.handlePostMessage)
+	return mux
+}
+
+func (c *WebChannel) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(webUIPage)
+}
+
+func (c *WebChannel) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	session, ok := c.authorize(w, r, r.URL.Query().Get("session"))
+	if !ok {
+		return
+	}
+
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.DebugCF("web", "WebSocket upgrade failed", map[string]any{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer conn.Close()
+
+	client := c.addClient(session)
+	defer c.removeClient(session, client)
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.writeWebSocket(conn, client, done)
+
+	conn.SetReadLimit(webMaxMessageBytes)
+	conn.SetReadDeadline(time.Now().Add(webPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(webPongWait))
+	})
+
+	for {
+		var in webInbound
+		if err := conn.ReadJSON(&in); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.DebugCF("web", "WebSocket read error", map[string]any{
+					"session": session,
+					"error":   err.Error(),
+				})
+			}
+			return
+		}
+		if in.Type != "" && in.Type != "message" {
+			continue
+		}
+		c.handleInbound(session, in.Content)
+	}
+}
+
+func (c *WebChannel) writeWebSocket(conn *websocket.Conn, client *webClient, done <-chan struct{}) {
+	ticker := time.NewTicker(webPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(webWriteWait))
+			conn.Close()
+			return
+		case ev := <-client.events:
+			conn.SetWriteDeadline(time.Now().Add(webWriteWait))
+			if err := conn.WriteJSON(ev); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webWriteWait)); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *WebChannel) handleEvents(w http.ResponseWriter, r *http.Request) {
+	session, ok := c.authorize(w, r, r.URL.Query().Get("session"))
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	client := c.addClient(session)
+	defer c.removeClient(session, client)
+
+	ticker := time.NewTicker(webPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.ctx.Done():
+			return
+		case ev := <-client.events:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (c *WebChannel) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	var in webInbound
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webMaxMessageBytes)).Decode(&in); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	session, ok := c.authorize(w, r, in.Session)
+	if !ok {
+		return
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		http.Error(w, "content is required", http.StatusBadRequest)
+		return
+	}
+
+	c.handleInbound(session, in.Content)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorize checks the optional token and validates the session ID, writing
+// an error response when either is rejected.
+func (c *WebChannel) authorize(w http.ResponseWriter, r *http.Request, session string) (string, bool) {
+	if c.config.Token != "" {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.config.Token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return "", false
+		}
+	}
+
+	if !webSessionPattern.MatchString(session) {
+		http.Error(w, "invalid session", http.StatusBadRequest)
+		return "", false
+	}
+	return session, true
+}
+
+func (c *WebChannel) handleInbound(session, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+
+	c.broadcast(session, webEvent{Type: "typing"})
+
+	metadata := map[string]string{
+		"peer_kind": "direct",
+		"peer_id":   session,
+	}
+
+	logger.DebugCF("web", "Received message", map[string]any{
+		"session": session,
+		"length":  len(content),
+	})
+
+	c.HandleMessage("web:"+session, session, content, nil, metadata)
+}
+
+func (c *WebChannel) addClient(session string) *webClient {
+	client := &webClient{events: make(chan webEvent, webClientBuffer)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients[session] == nil {
+		c.clients[session] = make(map[*webClient]struct{})
+	}
+	c.clients[session][client] = struct{}{}
+	return client
+}
+
+func (c *WebChannel) removeClient(session string, client *webClient) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clients[session], client)
+	if len(c.clients[session]) == 0 {
+		delete(c.clients, session)
+	}
+}
+
+// broadcast fans an event out to every client of a session. Slow clients
+// drop events rather than block the agent.
+func (c *WebChannel) broadcast(session string, ev webEvent) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for client := range c.clients[session] {
+		select {
+		case client.events <- ev:
+		default:
+			logger.WarnCF("web", "Dropping event for slow client", map[string]any{
+				"session": session,
+				"type":    ev.Type,
+			})
+		}
+	}
+}
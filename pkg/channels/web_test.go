@@ -0,0 +1,177 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestWebChannel(t *testing.T, token string) (*WebChannel, *bus.MessageBus, *httptest.Server) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	ch, err := NewWebChannel(config.WebConfig{Port: 18795, Token: token}, msgBus)
+	if err != nil {
+		t.Fatalf("NewWebChannel() error = %v", err)
+	}
+	ch.ctx, ch.cancel = context.WithCancel(context.Background())
+	ch.setRunning(true)
+	t.Cleanup(ch.cancel)
+
+	server := httptest.NewServer(ch.handler())
+	t.Cleanup(server.Close)
+	return ch, msgBus, server
+}
+
+// waitForClient blocks until a client for session has subscribed, so events
+// are not broadcast before anyone listens.
+func waitForClient(t *testing.T, ch *WebChannel, session string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		ch.mu.RLock()
+		n := len(ch.clients[session])
+		ch.mu.RUnlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no client subscribed for session %q", session)
+}
+
+func TestWebChannel_WebSocketStreaming(t *testing.T) {
+	ch, msgBus, server := newTestWebChannel(t, "")
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?session=tab1"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(webInbound{Type: "message", Content: "hello"}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.Channel != "web" || msg.ChatID != "tab1" || msg.Content != "hello" {
+		t.Errorf("unexpected inbound: %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "tab1" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+
+	ch.SendDelta("tab1", "Hi")
+	ch.SendDelta("tab1", " there")
+	ch.SendDelta("other", "not for us")
+	ch.Send(ctx, bus.OutboundMessage{Channel: "web", ChatID: "tab1", Content: "Hi there"})
+
+	want := []webEvent{
+		{Type: "typing"},
+		{Type: "delta", Content: "Hi"},
+		{Type: "delta", Content: " there"},
+		{Type: "message", Content: "Hi there"},
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i, w := range want {
+		var got webEvent
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatalf("event %d: read failed: %v", i, err)
+		}
+		if got != w {
+			t.Errorf("event %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestWebChannel_SSEFallback(t *testing.T) {
+	ch, msgBus, server := newTestWebChannel(t, "s3cret")
+
+	resp, err := http.Get(server.URL + "/events?session=tab2&token=s3cret")
+	if err != nil {
+		t.Fatalf("GET /events failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	waitForClient(t, ch, "tab2")
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/messages",
+		strings.NewReader(`{"session":"tab2","content":"ping"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	postResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /messages failed: %v", err)
+	}
+	postResp.Body.Close()
+	if postResp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST status = %d", postResp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if msg, ok := msgBus.ConsumeInbound(ctx); !ok || msg.Content != "ping" {
+		t.Fatalf("unexpected inbound: %+v", msg)
+	}
+	ch.Send(ctx, bus.OutboundMessage{Channel: "web", ChatID: "tab2", Content: "pong"})
+
+	var events []webEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for len(events) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev webEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("bad event %q: %v", data, err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 || events[0].Type != "typing" || events[1] != (webEvent{Type: "message", Content: "pong"}) {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestWebChannel_Authorize(t *testing.T) {
+	_, _, server := newTestWebChannel(t, "s3cret")
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"page is public", "/", http.StatusOK},
+		{"missing token", "/events?session=abc", http.StatusUnauthorized},
+		{"wrong token", "/events?session=abc&token=nope", http.StatusUnauthorized},
+		{"bad session", "/events?session=../etc&token=s3cret", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
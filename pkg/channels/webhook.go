@@ -0,0 +1,545 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/handoff"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	webhookResultTTL    = time.Hour
+	webhookMaxBodyBytes = 1 << 20
+	webhookCallbackWait = 10 * time.Second
+)
+
+// WebhookChannel exposes the agent over a small REST API so scripts and other
+// services can send messages and receive replies.
+//
+//	POST /v1/messages       submit a message (sync or async)
+//	GET  /v1/messages/{id}  poll the result of an async message
+type WebhookChannel struct {
+	*BaseChannel
+	config     config.WebhookConfig
+	httpServer *http.Server
+	limiter    *rateLimiter
+	httpClient *http.Client
+	mu         sync.Mutex
+	requests   map[string]*webhookRequest // request ID → state
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+type webhookRequest struct {
+	done        chan string // receives the reply in sync mode
+	key         string      // the API key that sent it, the only one that may poll it
+	async       bool
+	callbackURL string
+	status      string
+	content     string
+	created     time.Time
+}
+
+// webhookMetadataPrefix is put before the keys of a request's metadata.
+const webhookMetadataPrefix = "meta_"
+
+type webhookMessageRequest struct {
+	Content     string            `json:"content"`
+	SenderID    string            `json:"sender_id,omitempty"`
+	Session     string            `json:"session,omitempty"`
+	Mode        string            `json:"mode,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type webhookMessageResponse struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Content string `json:"content,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
+	if len(cfg.APIKeys) == 0 {
+		return nil, fmt.Errorf("webhook api_keys must not be empty")
+	}
+
+	base := NewBaseChannel("webhook", cfg, messageBus, cfg.AllowFrom)
+
+	return &WebhookChannel{
+		BaseChannel: base,
+		config:      cfg,
+		limiter:     newRateLimiter(cfg.RateLimit, time.Minute),
+		httpClient:  newCallbackClient(len(cfg.CallbackHosts) == 0),
+		requests:    make(map[string]*webhookRequest),
+	}, nil
+}
+
+// newCallbackClient returns the client callbacks are posted with. It
+// follows no redirects, and with publicOnly it connects only to public
+// addresses, whatever the callback's host resolves to at the time.
+func newCallbackClient(publicOnly bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if publicOnly {
+		// A proxy would be the address checked, not the callback's.
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{
+			Timeout: webhookCallbackWait,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return fmt.Errorf("callback to %s refused: not a public address", host)
+				}
+				return nil
+			},
+		}).DialContext
+	}
+	return &http.Client{
+		Timeout:   webhookCallbackWait,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace is carrier-grade NAT, RFC 6598.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is reachable on the internet, as opposed
+// to the gateway itself or its local network.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+func (c *WebhookChannel) Start(ctx context.Context) error {
+	logger.InfoC("webhook", "Starting webhook API channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	c.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           c.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.InfoCF("webhook", "Webhook API listening", map[string]any{
+			"addr": addr,
+		})
+		if err := handoff.ListenAndServe(c.httpServer); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("webhook", "Webhook API server error", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	go c.cleanupLoop()
+
+	c.setRunning(true)
+	logger.InfoC("webhook", "Webhook API channel started")
+	return nil
+}
+
+func (c *WebhookChannel) Stop(ctx context.Context) error {
+	logger.InfoC("webhook", "Stopping webhook API channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("webhook", "Webhook API shutdown error", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	c.setRunning(false)
+	logger.InfoC("webhook", "Webhook API channel stopped")
+	return nil
+}
+
+// Send delivers the agent's reply to whoever is waiting for the request: the
+// blocked HTTP handler in sync mode, or the result store and optional
+// callback in async mode.
+func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	req, ok := c.requests[msg.ChatID]
+	var async bool
+	var callbackURL string
+	if ok {
+		if req.status == "pending" {
+			req.status = "done"
+			req.content = msg.Content
+		}
+		// The sync handler turns the request async when it gives up.
+		async, callbackURL = req.async, req.callbackURL
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no pending webhook request %s", msg.ChatID)
+	}
+
+	if !async {
+		select {
+		case req.done <- msg.Content:
+		default:
+		}
+		return nil
+	}
+
+	if callbackURL != "" {
+		go c.deliverCallback(callbackURL, webhookMessageResponse{
+			ID:      msg.ChatID,
+			Status:  "done",
+			Content: msg.Content,
+		})
+	}
+	return nil
+}
+
+func (c *WebhookChannel) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", c.handlePostMessage)
+	mux.HandleFunc("GET /v1/messages/{id}", c.handleGetMessage)
+	return mux
+}
+
+func (c *WebhookChannel) handlePostMessage(w http.ResponseWriter, r *http.Request) {
+	key, ok := c.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var body webhookMessageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, webhookMaxBodyBytes)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, webhookMessageResponse{Error: "invalid JSON body"})
+		return
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		writeJSON(w, http.StatusBadRequest, webhookMessageResponse{Error: "content is required"})
+		return
+	}
+
+	async := false
+	switch body.Mode {
+	case "", "sync":
+	case "async":
+		async = true
+	default:
+		writeJSON(w, http.StatusBadRequest, webhookMessageResponse{Error: "mode must be sync or async"})
+		return
+	}
+	if body.CallbackURL != "" {
+		if !async {
+			writeJSON(w, http.StatusBadRequest, webhookMessageResponse{Error: "callback_url requires async mode"})
+			return
+		}
+		if msg := c.checkCallbackURL(body.CallbackURL); msg != "" {
+			writeJSON(w, http.StatusBadRequest, webhookMessageResponse{Error: msg})
+			return
+		}
+	}
+
+	senderID := "api:" + keyFingerprint(key)
+	if body.SenderID != "" {
+		if !slices.Contains(c.config.KeySenders[key], body.SenderID) {
+			writeJSON(w, http.StatusForbidden, webhookMessageResponse{Error: "sender_id not allowed for this API key"})
+			return
+		}
+		senderID = body.SenderID
+	}
+	if !c.IsAllowed(senderID) {
+		writeJSON(w, http.StatusForbidden, webhookMessageResponse{Error: "sender not allowed"})
+		return
+	}
+
+	id := uuid.New().String()
+	req := &webhookRequest{
+		done:        make(chan string, 1),
+		key:         key,
+		async:       async,
+		callbackURL: body.CallbackURL,
+		status:      "pending",
+		created:     time.Now(),
+	}
+	c.mu.Lock()
+	c.requests[id] = req
+	c.mu.Unlock()
+
+	// A session belongs to its sender, so no key can write into the
+	// conversations of another.
+	peerID := senderID
+	if body.Session != "" {
+		peerID = senderID + "/" + body.Session
+	}
+	// The client's metadata is namespaced so it cannot set the keys the
+	// agent routes and binds by, such as guild_id or parent_peer_id.
+	metadata := map[string]string{}
+	for k, v := range body.Metadata {
+		metadata[webhookMetadataPrefix+k] = v
+	}
+	metadata["platform"] = "webhook"
+	metadata["request_id"] = id
+	metadata["peer_kind"] = "direct"
+	metadata["peer_id"] = peerID
+
+	logger.DebugCF("webhook", "Received message", map[string]any{
+		"request_id": id,
+		"sender_id":  senderID,
+		"async":      async,
+		"preview":    utils.Truncate(body.Content, 50),
+	})
+
+	c.HandleMessage(senderID, id, body.Content, nil, metadata)
+
+	if async {
+		writeJSON(w, http.StatusAccepted, webhookMessageResponse{ID: id, Status: "pending"})
+		return
+	}
+
+	timeout := time.Duration(c.config.SyncTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+
+	select {
+	case content := <-req.done:
+		c.forget(id)
+		writeJSON(w, http.StatusOK, webhookMessageResponse{ID: id, Status: "done", Content: content})
+	case <-time.After(timeout):
+		// Keep the request so the reply can still be fetched later.
+		c.mu.Lock()
+		req.async = true
+		c.mu.Unlock()
+		writeJSON(w, http.StatusGatewayTimeout, webhookMessageResponse{
+			ID:     id,
+			Status: "pending",
+			Error:  "timed out waiting for reply; poll GET /v1/messages/" + id,
+		})
+	case <-r.Context().Done():
+		c.forget(id)
+	}
+}
+
+func (c *WebhookChannel) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	key, ok := c.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.PathValue("id")
+	c.mu.Lock()
+	req, ok := c.requests[id]
+	var resp webhookMessageResponse
+	// Messages of other keys are as unknown as those that never were.
+	if ok && subtle.ConstantTimeCompare([]byte(req.key), []byte(key)) != 1 {
+		ok = false
+	}
+	if ok {
+		resp = webhookMessageResponse{ID: id, Status: req.status, Content: req.content}
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, webhookMessageResponse{ID: id, Error: "unknown message id"})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// authenticate checks the API key (Authorization: Bearer or X-API-Key) and
+// the per-key rate limit, writing an error response when either fails.
+func (c *WebhookChannel) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	valid := false
+	for _, candidate := range c.config.APIKeys {
+		if candidate != "" && subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			valid = true
+		}
+	}
+	if !valid {
+		writeJSON(w, http.StatusUnauthorized, webhookMessageResponse{Error: "invalid API key"})
+		return "", false
+	}
+
+	if !c.limiter.Allow(key) {
+		w.Header().Set("Retry-After", "60")
+		writeJSON(w, http.StatusTooManyRequests, webhookMessageResponse{Error: "rate limit exceeded"})
+		return "", false
+	}
+	return key, true
+}
+
+// checkCallbackURL returns why replies may not be posted to raw, or "" if
+// they may. Without callback_hosts, the client checks the addresses a
+// host resolves to when it connects; addresses given literally are
+// refused here already.
+func (c *WebhookChannel) checkCallbackURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "callback_url must be an http(s) URL"
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(c.config.CallbackHosts) > 0 {
+		if !slices.ContainsFunc(c.config.CallbackHosts, func(h string) bool { return strings.EqualFold(h, host) }) {
+			return "callback_url host is not in callback_hosts"
+		}
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !isPublicIP(ip)) {
+		return "callback_url must not name a local address"
+	}
+	return ""
+}
+
+func (c *WebhookChannel) deliverCallback(callbackURL string, payload webhookMessageResponse) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, webhookCallbackWait)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		logger.WarnCF("webhook", "Callback delivery failed", map[string]any{
+			"id":    payload.ID,
+			"error": err.Error(),
+		})
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.WarnCF("webhook", "Callback returned non-success status", map[string]any{
+			"id":     payload.ID,
+			"status": resp.StatusCode,
+		})
+	}
+}
+
+func (c *WebhookChannel) forget(id string) {
+	c.mu.Lock()
+	delete(c.requests, id)
+	c.mu.Unlock()
+}
+
+func (c *WebhookChannel) cleanupLoop() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-webhookResultTTL)
+			c.mu.Lock()
+			for id, req := range c.requests {
+				if req.created.Before(cutoff) {
+					delete(c.requests, id)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// keyFingerprint identifies an API key in sender IDs and logs without
+// revealing it.
+func keyFingerprint(key string) string {
+	if len(key) <= 4 {
+		return "key"
+	}
+	return "..." + key[len(key)-4:]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// rateLimiter is a per-key token bucket allowing limit requests per window.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		window:  window,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow consumes a token for key. A non-positive limit disables limiting.
+func (l *rateLimiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit), last: now}
+		l.buckets[key] = b
+	}
+
+	refill := now.Sub(b.last).Seconds() / l.window.Seconds() * float64(l.limit)
+	b.tokens = min(float64(l.limit), b.tokens+refill)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
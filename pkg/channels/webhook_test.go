@@ -0,0 +1,255 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestWebhookChannel(t *testing.T, rateLimit int, edits ...func(*config.WebhookConfig)) (*WebhookChannel, *bus.MessageBus, *httptest.Server) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	cfg := config.WebhookConfig{
+		APIKeys:       config.FlexibleStringSlice{"secret-key", "other-key"},
+		RateLimit:     rateLimit,
+		SyncTimeout:   5,
+		KeySenders:    map[string]config.FlexibleStringSlice{"secret-key": {"script"}},
+		CallbackHosts: config.FlexibleStringSlice{"127.0.0.1"},
+	}
+	for _, edit := range edits {
+		edit(&cfg)
+	}
+	ch, err := NewWebhookChannel(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewWebhookChannel() error = %v", err)
+	}
+	ch.ctx, ch.cancel = context.WithCancel(context.Background())
+	t.Cleanup(ch.cancel)
+
+	server := httptest.NewServer(ch.handler())
+	t.Cleanup(server.Close)
+	return ch, msgBus, server
+}
+
+func postWebhookMessage(t *testing.T, url, key, body string) (*http.Response, webhookMessageResponse) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/v1/messages", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var out webhookMessageResponse
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func TestWebhookChannel_RequiresAPIKey(t *testing.T) {
+	_, _, server := newTestWebhookChannel(t, 0)
+
+	resp, _ := postWebhookMessage(t, server.URL, "", `{"content":"hi"}`)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+	resp, _ = postWebhookMessage(t, server.URL, "wrong", `{"content":"hi"}`)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestWebhookChannel_SyncMode(t *testing.T) {
+	ch, msgBus, server := newTestWebhookChannel(t, 0)
+
+	// Play the agent: answer the inbound message through Send.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		msg, ok := msgBus.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		ch.Send(ctx, bus.OutboundMessage{Channel: "webhook", ChatID: msg.ChatID, Content: "echo: " + msg.Content})
+	}()
+
+	resp, out := postWebhookMessage(t, server.URL, "secret-key", `{"content":"ping","sender_id":"script"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body = %+v", resp.StatusCode, out)
+	}
+	if out.Content != "echo: ping" || out.Status != "done" {
+		t.Errorf("unexpected response: %+v", out)
+	}
+}
+
+func TestWebhookChannel_AsyncModeWithCallback(t *testing.T) {
+	ch, msgBus, server := newTestWebhookChannel(t, 0)
+
+	callbacks := make(chan webhookMessageResponse, 1)
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookMessageResponse
+		json.NewDecoder(r.Body).Decode(&payload)
+		callbacks <- payload
+	}))
+	defer callbackServer.Close()
+
+	body := `{"content":"later","mode":"async","callback_url":"` + callbackServer.URL + `"}`
+	resp, out := postWebhookMessage(t, server.URL, "secret-key", body)
+	if resp.StatusCode != http.StatusAccepted || out.ID == "" {
+		t.Fatalf("status = %d, body = %+v", resp.StatusCode, out)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || msg.ChatID != out.ID {
+		t.Fatalf("unexpected inbound message: %+v", msg)
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{Channel: "webhook", ChatID: out.ID, Content: "result"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case cb := <-callbacks:
+		if cb.ID != out.ID || cb.Content != "result" {
+			t.Errorf("unexpected callback: %+v", cb)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback not delivered")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/messages/"+out.ID, nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	getResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer getResp.Body.Close()
+	var polled webhookMessageResponse
+	json.NewDecoder(getResp.Body).Decode(&polled)
+	if polled.Status != "done" || polled.Content != "result" {
+		t.Errorf("unexpected poll result: %+v", polled)
+	}
+}
+
+func TestWebhookChannel_RateLimit(t *testing.T) {
+	_, _, server := newTestWebhookChannel(t, 2)
+
+	for i := 0; i < 2; i++ {
+		resp, _ := postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async"}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("request %d: status = %d", i, resp.StatusCode)
+		}
+	}
+	resp, _ := postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async"}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", resp.StatusCode)
+	}
+}
+
+func TestWebhookChannel_RejectsCallbackInSyncMode(t *testing.T) {
+	_, _, server := newTestWebhookChannel(t, 0)
+
+	resp, _ := postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","callback_url":"http://example.com"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestWebhookChannel_SenderBoundToKey(t *testing.T) {
+	_, msgBus, server := newTestWebhookChannel(t, 0)
+
+	resp, out := postWebhookMessage(t, server.URL, "other-key", `{"content":"x","mode":"async","sender_id":"script"}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("sender_id of another key: status = %d, body = %+v", resp.StatusCode, out)
+	}
+
+	resp, _ = postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async","sender_id":"script","session":"ci"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("own sender_id: status = %d", resp.StatusCode)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || msg.SenderID != "script" || msg.Metadata["peer_id"] != "script/ci" {
+		t.Errorf("inbound message = %+v", msg)
+	}
+}
+
+func TestWebhookChannel_NamespacesClientMetadata(t *testing.T) {
+	_, msgBus, server := newTestWebhookChannel(t, 0)
+
+	body := `{"content":"x","mode":"async","metadata":{"build":"42","guild_id":"g1","parent_peer_id":"p1","peer_id":"other","account_id":"a1"}}`
+	resp, _ := postWebhookMessage(t, server.URL, "secret-key", body)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	for _, key := range []string{"guild_id", "parent_peer_id", "account_id"} {
+		if v, set := msg.Metadata[key]; set {
+			t.Errorf("client set %s = %q", key, v)
+		}
+	}
+	if msg.Metadata["peer_id"] != msg.SenderID || msg.Metadata["meta_build"] != "42" || msg.Metadata["meta_guild_id"] != "g1" {
+		t.Errorf("metadata = %v", msg.Metadata)
+	}
+}
+
+func TestWebhookChannel_PollsOnlyOwnMessages(t *testing.T) {
+	_, _, server := newTestWebhookChannel(t, 0)
+
+	_, out := postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async"}`)
+	for key, want := range map[string]int{"secret-key": http.StatusOK, "other-key": http.StatusNotFound} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/messages/"+out.ID, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET with %s: status = %d, want %d", key, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestWebhookChannel_RefusesLocalCallbacks(t *testing.T) {
+	publicOnly := func(cfg *config.WebhookConfig) { cfg.CallbackHosts = nil }
+	_, _, server := newTestWebhookChannel(t, 0, publicOnly)
+	for _, callback := range []string{"http://127.0.0.1:8080/", "http://10.1.2.3/", "http://[::1]/", "http://localhost/", "http://169.254.169.254/"} {
+		resp, out := postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async","callback_url":"`+callback+`"}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("callback to %s: status = %d, body = %+v", callback, resp.StatusCode, out)
+		}
+	}
+	resp, _ := postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async","callback_url":"https://hooks.example.com/x"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("public callback: status = %d", resp.StatusCode)
+	}
+
+	// A public name that resolves to a local address is refused on connect.
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer local.Close()
+	if _, err := newCallbackClient(true).Post(local.URL, "application/json", nil); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("callback client reached %s: %v", local.URL, err)
+	}
+
+	_, _, server = newTestWebhookChannel(t, 0)
+	resp, _ = postWebhookMessage(t, server.URL, "secret-key", `{"content":"x","mode":"async","callback_url":"https://hooks.example.com/x"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("callback to a host not in callback_hosts: status = %d", resp.StatusCode)
+	}
+}
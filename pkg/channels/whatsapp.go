@@ -12,6 +12,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -78,6 +79,11 @@ func (c *WhatsAppChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Capabilities reports WhatsApp formatting; the bridge sends replies whole.
+func (c *WhatsAppChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.WhatsApp}
+}
+
 func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -89,7 +95,7 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	payload := map[string]any{
 		"type":    "message",
 		"to":      msg.ChatID,
-		"content": msg.Content,
+		"content": format.Format(msg.Content, c.Capabilities().Markdown),
 	}
 
 	data, err := json.Marshal(payload)
@@ -0,0 +1,430 @@
+//go:build whatsapp_native
+
+package channels
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/mdp/qrterminal/v3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+	_ "modernc.org/sqlite"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const whatsappMaxMessageSize = 4096
+
+// WhatsAppNativeChannel connects to WhatsApp directly as a linked device using
+// the multi-device protocol, without an external bridge process.
+type WhatsAppNativeChannel struct {
+	*BaseChannel
+	config      config.WhatsAppConfig
+	container   *sqlstore.Container
+	client      *whatsmeow.Client
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+}
+
+func NewWhatsAppNativeChannel(cfg config.WhatsAppConfig, messageBus *bus.MessageBus) (*WhatsAppNativeChannel, error) {
+	base := NewBaseChannel("whatsapp", cfg, messageBus, cfg.AllowFrom)
+
+	return &WhatsAppNativeChannel{
+		BaseChannel: base,
+		config:      cfg,
+	}, nil
+}
+
+func (c *WhatsAppNativeChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *WhatsAppNativeChannel) Start(ctx context.Context) error {
+	logger.InfoC("whatsapp", "Starting native WhatsApp channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	container, client, err := openWhatsAppClient(c.ctx, c.config.StorePath())
+	if err != nil {
+		return err
+	}
+	client.AddEventHandler(c.handleEvent)
+
+	c.mu.Lock()
+	c.container = container
+	c.client = client
+	c.mu.Unlock()
+
+	if client.Store.ID == nil {
+		// Not paired yet: show the QR code in the gateway's terminal so the
+		// user can link the device without a separate step.
+		qrChan, err := client.GetQRChannel(c.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get WhatsApp QR channel: %w", err)
+		}
+		if err := client.Connect(); err != nil {
+			return fmt.Errorf("failed to connect to WhatsApp: %w", err)
+		}
+		go func() {
+			if err := printWhatsAppQR(qrChan, os.Stdout); err != nil {
+				logger.ErrorCF("whatsapp", "WhatsApp pairing failed", map[string]any{
+					"error": err.Error(),
+				})
+			}
+		}()
+	} else if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to WhatsApp: %w", err)
+	}
+
+	c.setRunning(true)
+	logger.InfoC("whatsapp", "Native WhatsApp channel started")
+	return nil
+}
+
+func (c *WhatsAppNativeChannel) Stop(ctx context.Context) error {
+	logger.InfoC("whatsapp", "Stopping native WhatsApp channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		c.client.Disconnect()
+		c.client = nil
+	}
+	if c.container != nil {
+		if err := c.container.Close(); err != nil {
+			logger.DebugCF("whatsapp", "Failed to close session store", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		c.container = nil
+	}
+
+	c.setRunning(false)
+	return nil
+}
+
+// Capabilities reports WhatsApp formatting and message size.
+func (c *WhatsAppNativeChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.WhatsApp, MaxMessageLength: whatsappMaxMessageSize}
+}
+
+func (c *WhatsAppNativeChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+
+	if client == nil || !client.IsLoggedIn() {
+		return fmt.Errorf("whatsapp client not logged in")
+	}
+
+	jid, err := types.ParseJID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid whatsapp chat ID %q: %w", msg.ChatID, err)
+	}
+
+	_ = client.SendChatPresence(ctx, jid, types.ChatPresencePaused, types.ChatPresenceMediaText)
+
+	for _, chunk := range c.Capabilities().Render(msg.Content) {
+		message := &waE2E.Message{Conversation: proto.String(chunk)}
+		if _, err := client.SendMessage(ctx, jid, message); err != nil {
+			return fmt.Errorf("failed to send whatsapp message: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *WhatsAppNativeChannel) handleEvent(rawEvt any) {
+	switch evt := rawEvt.(type) {
+	case *events.Message:
+		c.handleMessage(evt)
+	case *events.Connected:
+		logger.InfoC("whatsapp", "Connected to WhatsApp")
+	case *events.LoggedOut:
+		logger.WarnCF("whatsapp", "WhatsApp session was logged out; run 'picoclaw whatsapp login' to pair again", map[string]any{
+			"reason": evt.Reason.String(),
+		})
+	}
+}
+
+func (c *WhatsAppNativeChannel) handleMessage(evt *events.Message) {
+	info := evt.Info
+	if ignoreWhatsAppMessage(info) {
+		return
+	}
+	senderID := whatsappSender(info).User
+
+	// check allowlist to avoid downloading attachments for rejected users
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("whatsapp", "Message rejected by allowlist", map[string]any{
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	content, mediaPaths := c.extractContent(evt.Message)
+	if content == "" && len(mediaPaths) == 0 {
+		return
+	}
+
+	chatID := info.Chat.String()
+
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client != nil {
+		if err := client.MarkRead(c.ctx, []types.MessageID{info.ID}, info.Timestamp, info.Chat, info.Sender); err != nil {
+			logger.DebugCF("whatsapp", "Failed to send read receipt", map[string]any{"error": err.Error()})
+		}
+		_ = client.SendChatPresence(c.ctx, info.Chat, types.ChatPresenceComposing, types.ChatPresenceMediaText)
+	}
+
+	logger.DebugCF("whatsapp", "Received message", map[string]any{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, content, mediaPaths, whatsappMetadata(info, senderID))
+}
+
+// ignoreWhatsAppMessage reports whether a message is one of our own or a
+// status broadcast, which are never answered.
+func ignoreWhatsAppMessage(info types.MessageInfo) bool {
+	return info.IsFromMe || info.Chat.Server == types.BroadcastServer
+}
+
+// whatsappSender returns the JID a message's sender is matched against the
+// allowlist by. Allowlists are written with phone numbers, so the
+// phone-number JID is preferred when the message is addressed by LID.
+func whatsappSender(info types.MessageInfo) types.JID {
+	if info.Sender.Server == types.HiddenUserServer && !info.SenderAlt.IsEmpty() {
+		return info.SenderAlt
+	}
+	return info.Sender
+}
+
+func whatsappMetadata(info types.MessageInfo, senderID string) map[string]string {
+	metadata := map[string]string{
+		"message_id": info.ID,
+		"user_name":  info.PushName,
+	}
+	if info.IsGroup {
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = info.Chat.String()
+	} else {
+		metadata["peer_kind"] = "direct"
+		metadata["peer_id"] = senderID
+	}
+	return metadata
+}
+
+// whatsappMedia is an attachment of a message, still to be downloaded.
+type whatsappMedia struct {
+	media    whatsmeow.DownloadableMessage
+	mimeType string
+	fileName string
+	caption  string
+	kind     string // "image", "video", "file" or "voice"
+}
+
+// parseWhatsAppMessage returns the text of msg, or the attachment it carries.
+// Both are empty for the kinds of message that are not handled.
+func parseWhatsAppMessage(msg *waE2E.Message) (string, *whatsappMedia) {
+	if msg == nil {
+		return "", nil
+	}
+
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation(), nil
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText(), nil
+	case msg.GetImageMessage() != nil:
+		img := msg.GetImageMessage()
+		return "", &whatsappMedia{media: img, mimeType: img.GetMimetype(), caption: img.GetCaption(), kind: "image"}
+	case msg.GetVideoMessage() != nil:
+		video := msg.GetVideoMessage()
+		return "", &whatsappMedia{media: video, mimeType: video.GetMimetype(), caption: video.GetCaption(), kind: "video"}
+	case msg.GetDocumentMessage() != nil:
+		doc := msg.GetDocumentMessage()
+		return "", &whatsappMedia{
+			media:    doc,
+			mimeType: doc.GetMimetype(),
+			fileName: doc.GetFileName(),
+			caption:  doc.GetCaption(),
+			kind:     "file",
+		}
+	case msg.GetAudioMessage() != nil:
+		audio := msg.GetAudioMessage()
+		return "", &whatsappMedia{media: audio, mimeType: audio.GetMimetype(), kind: "voice"}
+	}
+	return "", nil
+}
+
+func (c *WhatsAppNativeChannel) extractContent(msg *waE2E.Message) (string, []string) {
+	text, media := parseWhatsAppMessage(msg)
+	switch {
+	case media == nil:
+		return text, nil
+	case media.kind == "voice":
+		return c.audioContent(media)
+	}
+	return c.withMedia(media)
+}
+
+func (c *WhatsAppNativeChannel) withMedia(m *whatsappMedia) (string, []string) {
+	localPath := c.downloadMedia(m.media, m.mimeType, m.fileName)
+	if localPath == "" {
+		return appendContent(m.caption, fmt.Sprintf("[%s (download failed)]", m.kind)), nil
+	}
+	return appendContent(m.caption, fmt.Sprintf("[%s: %s]", m.kind, filepath.Base(localPath))), []string{localPath}
+}
+
+func (c *WhatsAppNativeChannel) audioContent(audio *whatsappMedia) (string, []string) {
+	localPath := c.downloadMedia(audio.media, audio.mimeType, "")
+	if localPath == "" {
+		return "[voice (download failed)]", nil
+	}
+
+	if c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return "[voice]", []string{localPath}
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, transcriptionTimeout)
+	defer cancel()
+	result, err := c.transcriber.Transcribe(ctx, localPath)
+	if err != nil {
+		logger.ErrorCF("whatsapp", "Voice transcription failed", map[string]any{"error": err.Error()})
+		return "[voice (transcription failed)]", []string{localPath}
+	}
+	return fmt.Sprintf("[voice transcription: %s]", result.Text), []string{localPath}
+}
+
+func (c *WhatsAppNativeChannel) downloadMedia(media whatsmeow.DownloadableMessage, mimeType, fileName string) string {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return ""
+	}
+
+	data, err := client.Download(c.ctx, media)
+	if err != nil {
+		logger.ErrorCF("whatsapp", "Failed to download media", map[string]any{"error": err.Error()})
+		return ""
+	}
+
+	if fileName == "" {
+		fileName = "media"
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			fileName += exts[0]
+		}
+	}
+
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0o700); err != nil {
+		logger.ErrorCF("whatsapp", "Failed to create media directory", map[string]any{"error": err.Error()})
+		return ""
+	}
+	localPath := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+utils.SanitizeFilename(fileName))
+	if err := os.WriteFile(localPath, data, 0o600); err != nil {
+		logger.ErrorCF("whatsapp", "Failed to write media file", map[string]any{"error": err.Error()})
+		return ""
+	}
+	return localPath
+}
+
+// PairWhatsApp links picoclaw as a new WhatsApp device by printing QR codes to
+// out until the user scans one with their phone.
+func PairWhatsApp(ctx context.Context, cfg config.WhatsAppConfig, out io.Writer) error {
+	container, client, err := openWhatsAppClient(ctx, cfg.StorePath())
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+
+	if client.Store.ID != nil {
+		fmt.Fprintf(out, "Already paired as %s\n", client.Store.ID.String())
+		return nil
+	}
+
+	qrChan, err := client.GetQRChannel(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get QR channel: %w", err)
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to WhatsApp: %w", err)
+	}
+	defer client.Disconnect()
+
+	if err := printWhatsAppQR(qrChan, out); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Paired as %s\n", client.Store.ID.String())
+	return nil
+}
+
+func printWhatsAppQR(qrChan <-chan whatsmeow.QRChannelItem, out io.Writer) error {
+	for item := range qrChan {
+		switch item.Event {
+		case whatsmeow.QRChannelEventCode:
+			fmt.Fprintln(out, "Scan this QR code with WhatsApp (Settings → Linked Devices → Link a Device):")
+			qrterminal.GenerateHalfBlock(item.Code, qrterminal.L, out)
+		case whatsmeow.QRChannelEventError:
+			return fmt.Errorf("pairing error: %w", item.Error)
+		case whatsmeow.QRChannelSuccess.Event:
+			return nil
+		default:
+			return fmt.Errorf("pairing ended: %s", item.Event)
+		}
+	}
+	return fmt.Errorf("pairing channel closed")
+}
+
+func openWhatsAppClient(ctx context.Context, storePath string) (*sqlstore.Container, *whatsmeow.Client, error) {
+	if err := os.MkdirAll(filepath.Dir(storePath), 0o700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session store directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+storePath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open session store: %w", err)
+	}
+	container := sqlstore.NewWithDB(db, "sqlite3", nil)
+	if err := container.Upgrade(ctx); err != nil {
+		container.Close()
+		return nil, nil, fmt.Errorf("failed to upgrade session store: %w", err)
+	}
+
+	device, err := container.GetFirstDevice(ctx)
+	if err != nil {
+		container.Close()
+		return nil, nil, fmt.Errorf("failed to load WhatsApp device: %w", err)
+	}
+
+	return container, whatsmeow.NewClient(device, nil), nil
+}
@@ -0,0 +1,50 @@
+//go:build !whatsapp_native
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+var errWhatsAppNativeDisabled = errors.New(
+	"native WhatsApp support is not compiled in. Rebuild with '-tags whatsapp_native' or use the bridge (bridge_url)",
+)
+
+// WhatsAppNativeChannel is a stub used when picoclaw is built without the whatsapp_native tag
+type WhatsAppNativeChannel struct {
+	*BaseChannel
+}
+
+// NewWhatsAppNativeChannel returns an error because native WhatsApp support is not compiled in
+func NewWhatsAppNativeChannel(cfg config.WhatsAppConfig, bus *bus.MessageBus) (*WhatsAppNativeChannel, error) {
+	return nil, errWhatsAppNativeDisabled
+}
+
+// SetTranscriber is a stub method matching the native implementation
+func (c *WhatsAppNativeChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {}
+
+// Start is a stub method to satisfy the Channel interface
+func (c *WhatsAppNativeChannel) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop is a stub method to satisfy the Channel interface
+func (c *WhatsAppNativeChannel) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Send is a stub method to satisfy the Channel interface
+func (c *WhatsAppNativeChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return errWhatsAppNativeDisabled
+}
+
+// PairWhatsApp returns an error because native WhatsApp support is not compiled in
+func PairWhatsApp(ctx context.Context, cfg config.WhatsAppConfig, out io.Writer) error {
+	return errWhatsAppNativeDisabled
+}
@@ -0,0 +1,171 @@
+//go:build whatsapp_native
+
+package channels
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParseWhatsAppMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      *waE2E.Message
+		wantText string
+		wantKind string
+		wantFile string
+		caption  string
+	}{
+		{name: "nil"},
+		{name: "unhandled", msg: &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{Text: proto.String("👍")}}},
+		{name: "conversation", msg: &waE2E.Message{Conversation: proto.String("hello")}, wantText: "hello"},
+		{
+			name:     "extended text",
+			msg:      &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String("see https://example.com")}},
+			wantText: "see https://example.com",
+		},
+		{
+			name:     "image",
+			msg:      &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Mimetype: proto.String("image/jpeg"), Caption: proto.String("look")}},
+			wantKind: "image",
+			caption:  "look",
+		},
+		{
+			name:     "video",
+			msg:      &waE2E.Message{VideoMessage: &waE2E.VideoMessage{Mimetype: proto.String("video/mp4")}},
+			wantKind: "video",
+		},
+		{
+			name: "document",
+			msg: &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+				Mimetype: proto.String("application/pdf"),
+				FileName: proto.String("report.pdf"),
+				Caption:  proto.String("Q3"),
+			}},
+			wantKind: "file",
+			wantFile: "report.pdf",
+			caption:  "Q3",
+		},
+		{
+			name:     "voice",
+			msg:      &waE2E.Message{AudioMessage: &waE2E.AudioMessage{Mimetype: proto.String("audio/ogg; codecs=opus")}},
+			wantKind: "voice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, media := parseWhatsAppMessage(tt.msg)
+			if text != tt.wantText {
+				t.Errorf("text = %q, want %q", text, tt.wantText)
+			}
+			if tt.wantKind == "" {
+				if media != nil {
+					t.Errorf("media = %+v, want none", media)
+				}
+				return
+			}
+			if media == nil {
+				t.Fatalf("no media, want %s", tt.wantKind)
+			}
+			if media.kind != tt.wantKind || media.fileName != tt.wantFile || media.caption != tt.caption || media.media == nil {
+				t.Errorf("media = %+v, want kind %q, file %q, caption %q", media, tt.wantKind, tt.wantFile, tt.caption)
+			}
+		})
+	}
+}
+
+func TestWhatsAppSender(t *testing.T) {
+	phone := types.NewJID("4915112345678", types.DefaultUserServer)
+	lid := types.NewJID("123456789012345", types.HiddenUserServer)
+
+	tests := []struct {
+		name string
+		info types.MessageInfo
+		want types.JID
+	}{
+		{name: "phone number", info: whatsappInfo(phone, types.EmptyJID), want: phone},
+		{name: "LID with phone number", info: whatsappInfo(lid, phone), want: phone},
+		{name: "LID alone", info: whatsappInfo(lid, types.EmptyJID), want: lid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := whatsappSender(tt.info); got != tt.want {
+				t.Errorf("whatsappSender() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhatsAppSender_MatchesThePhoneNumberAllowlist(t *testing.T) {
+	phone := types.NewJID("4915112345678", types.DefaultUserServer)
+	lid := types.NewJID("123456789012345", types.HiddenUserServer)
+	ch := NewBaseChannel("whatsapp", config.WhatsAppConfig{}, bus.NewMessageBus(), []string{"4915112345678"})
+
+	if id := whatsappSender(whatsappInfo(lid, phone)).User; !ch.IsAllowed(id) {
+		t.Errorf("a listed sender addressed by LID is rejected as %q", id)
+	}
+	if id := whatsappSender(whatsappInfo(phone, types.EmptyJID)).User; !ch.IsAllowed(id) {
+		t.Errorf("a listed sender is rejected as %q", id)
+	}
+	if id := whatsappSender(whatsappInfo(lid, types.EmptyJID)).User; ch.IsAllowed(id) {
+		t.Errorf("an unlisted LID %q is allowed", id)
+	}
+	other := types.NewJID("4915199999999", types.DefaultUserServer)
+	if id := whatsappSender(whatsappInfo(other, types.EmptyJID)).User; ch.IsAllowed(id) {
+		t.Errorf("an unlisted sender %q is allowed", id)
+	}
+}
+
+func TestIgnoreWhatsAppMessage(t *testing.T) {
+	sender := types.NewJID("4915112345678", types.DefaultUserServer)
+
+	info := whatsappInfo(sender, types.EmptyJID)
+	if ignoreWhatsAppMessage(info) {
+		t.Error("a direct message is ignored")
+	}
+	info.IsFromMe = true
+	if !ignoreWhatsAppMessage(info) {
+		t.Error("our own message is not ignored")
+	}
+	info = whatsappInfo(sender, types.EmptyJID)
+	info.Chat = types.StatusBroadcastJID
+	if !ignoreWhatsAppMessage(info) {
+		t.Error("a status broadcast is not ignored")
+	}
+}
+
+func TestWhatsAppMetadata(t *testing.T) {
+	sender := types.NewJID("4915112345678", types.DefaultUserServer)
+
+	info := whatsappInfo(sender, types.EmptyJID)
+	if md := whatsappMetadata(info, sender.User); md["peer_kind"] != "direct" || md["peer_id"] != sender.User ||
+		md["message_id"] != "MSG1" || md["user_name"] != "Ada" {
+		t.Errorf("direct metadata = %v", md)
+	}
+
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	info.Chat = group
+	info.IsGroup = true
+	if md := whatsappMetadata(info, sender.User); md["peer_kind"] != "group" || md["peer_id"] != group.String() {
+		t.Errorf("group metadata = %v", md)
+	}
+}
+
+func whatsappInfo(sender, senderAlt types.JID) types.MessageInfo {
+	return types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:      sender,
+			Sender:    sender,
+			SenderAlt: senderAlt,
+		},
+		ID:       "MSG1",
+		PushName: "Ada",
+	}
+}
@@ -0,0 +1,535 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/format"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	nsMUC        = "http://jabber.org/protocol/muc"
+	nsChatStates = "http://jabber.org/protocol/chatstates"
+
+	xmppKeepaliveInterval = 60 * time.Second
+	xmppMaxMessageLength  = 16000
+
+	xmppOMEMONotice = "I can't read OMEMO-encrypted messages. Please turn off encryption for this chat and send your message again."
+)
+
+// XMPPChannel connects to an XMPP server as a regular client account. It
+// answers direct chats, joins multi-user chat rooms (XEP-0045) and handles
+// roster subscription requests from allowed users.
+//
+// Chat IDs are bare JIDs: a contact for direct chats or a room for group
+// chats. Private messages from room occupants use the occupant's full JID.
+type XMPPChannel struct {
+	*BaseChannel
+	config    config.XMPPConfig
+	mu        sync.RWMutex
+	session   *xmppSession
+	rooms     map[string]string // bare room JID → our nick in it
+	occupants map[string]string // "room/nick" → occupant's real bare JID, when the room discloses it
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+type xmppMessage struct {
+	From      string    `xml:"from,attr"`
+	To        string    `xml:"to,attr"`
+	Type      string    `xml:"type,attr"`
+	ID        string    `xml:"id,attr"`
+	Body      string    `xml:"body"`
+	Delay     *struct{} `xml:"urn:xmpp:delay delay"`
+	Encrypted *struct{} `xml:"eu.siacs.conversations.axolotl encrypted"`
+	MUCUser   *struct {
+		Invite *struct {
+			From string `xml:"from,attr"`
+		} `xml:"invite"`
+	} `xml:"http://jabber.org/protocol/muc#user x"`
+	Conference *struct {
+		JID string `xml:"jid,attr"`
+	} `xml:"jabber:x:conference x"`
+}
+
+type xmppPresence struct {
+	From    string `xml:"from,attr"`
+	Type    string `xml:"type,attr"`
+	MUCUser *struct {
+		Items []struct {
+			JID string `xml:"jid,attr"`
+		} `xml:"item"`
+	} `xml:"http://jabber.org/protocol/muc#user x"`
+	Error *struct {
+		Conflict *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-stanzas conflict"`
+	} `xml:"error"`
+}
+
+type xmppIQ struct {
+	From string    `xml:"from,attr"`
+	Type string    `xml:"type,attr"`
+	ID   string    `xml:"id,attr"`
+	Ping *struct{} `xml:"urn:xmpp:ping ping"`
+}
+
+func NewXMPPChannel(cfg config.XMPPConfig, messageBus *bus.MessageBus) (*XMPPChannel, error) {
+	if local, domain, _ := splitJID(cfg.JID); local == "" || domain == "" {
+		return nil, fmt.Errorf("xmpp jid must look like user@example.com")
+	}
+	if cfg.Password == "" {
+		return nil, fmt.Errorf("xmpp password is required")
+	}
+	if cfg.Resource == "" {
+		cfg.Resource = "picoclaw"
+	}
+	if cfg.Nick == "" {
+		cfg.Nick = "picoclaw"
+	}
+
+	base := NewBaseChannel("xmpp", cfg, messageBus, cfg.AllowFrom)
+
+	rooms := make(map[string]string)
+	for _, room := range cfg.Rooms {
+		if room = strings.TrimSpace(room); room != "" {
+			rooms[bareJID(room)] = cfg.Nick
+		}
+	}
+
+	return &XMPPChannel{
+		BaseChannel: base,
+		config:      cfg,
+		rooms:       rooms,
+		occupants:   make(map[string]string),
+	}, nil
+}
+
+func (c *XMPPChannel) Start(ctx context.Context) error {
+	logger.InfoCF("xmpp", "Starting XMPP channel", map[string]any{
+		"jid":   c.config.JID,
+		"rooms": len(c.rooms),
+	})
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	go c.runLoop()
+
+	c.setRunning(true)
+	logger.InfoC("xmpp", "XMPP channel started")
+	return nil
+}
+
+func (c *XMPPChannel) Stop(ctx context.Context) error {
+	logger.InfoC("xmpp", "Stopping XMPP channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	if s := c.getSession(); s != nil {
+		s.write(`<presence type='unavailable'/>`)
+		s.close()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("xmpp", "XMPP channel stopped")
+	return nil
+}
+
+// Capabilities reports plain text: most XMPP clients don't render Markdown.
+func (c *XMPPChannel) Capabilities() Capabilities {
+	return Capabilities{Markdown: format.Plain, MaxMessageLength: xmppMaxMessageLength}
+}
+
+func (c *XMPPChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("xmpp channel not running")
+	}
+	s := c.getSession()
+	if s == nil {
+		return fmt.Errorf("xmpp not connected")
+	}
+
+	msgType := "chat"
+	c.mu.RLock()
+	if _, isRoom := c.rooms[bareJID(msg.ChatID)]; isRoom && !strings.Contains(msg.ChatID, "/") {
+		msgType = "groupchat"
+	}
+	c.mu.RUnlock()
+
+	for _, chunk := range c.Capabilities().Render(msg.Content) {
+		if err := c.sendMessage(s, msg.ChatID, msgType, chunk); err != nil {
+			return fmt.Errorf("xmpp send: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *XMPPChannel) sendMessage(s *xmppSession, to, msgType, body string) error {
+	var state string
+	if msgType == "chat" {
+		state = fmt.Sprintf(`<active xmlns='%s'/>`, nsChatStates)
+	}
+	return s.write(`<message to='%s' type='%s' id='%s'><body>%s</body>%s</message>`,
+		xmlEscape(to), msgType, uuid.New().String()[:8], xmlEscape(body), state)
+}
+
+func (c *XMPPChannel) getSession() *xmppSession {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.session
+}
+
+func (c *XMPPChannel) runLoop() {
+	backoff := time.Second
+	for {
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		connected, err := c.connectAndServe()
+		if c.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		logger.WarnCF("xmpp", "Connection lost, reconnecting", map[string]any{
+			"error":   fmt.Sprint(err),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func (c *XMPPChannel) connectAndServe() (bool, error) {
+	s, err := dialXMPP(c.ctx, c.config.JID, c.config.Password, c.config.Resource, c.config.Server)
+	if err != nil {
+		return false, err
+	}
+	defer s.close()
+
+	c.mu.Lock()
+	c.session = s
+	c.occupants = make(map[string]string)
+	rooms := make(map[string]string, len(c.rooms))
+	for room, nick := range c.rooms {
+		rooms[room] = nick
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		if c.session == s {
+			c.session = nil
+		}
+		c.mu.Unlock()
+	}()
+
+	logger.InfoCF("xmpp", "Connected", map[string]any{"jid": s.jid})
+
+	if err := c.sendPresence(s); err != nil {
+		return true, err
+	}
+	for room, nick := range rooms {
+		if err := c.joinRoom(s, room, nick); err != nil {
+			return true, err
+		}
+	}
+
+	go c.keepalive(s)
+	return true, c.readLoop(s)
+}
+
+// keepalive sends whitespace pings so NATs and servers keep the idle stream
+// open; a failed write makes the read loop notice the dead connection.
+func (c *XMPPChannel) keepalive(s *xmppSession) {
+	ticker := time.NewTicker(xmppKeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if c.getSession() != s {
+				return
+			}
+			if err := s.write(" "); err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *XMPPChannel) readLoop(s *xmppSession) error {
+	for {
+		se, err := s.nextStart()
+		if err != nil {
+			return err
+		}
+
+		switch se.Name.Local {
+		case "message":
+			var m xmppMessage
+			if err := s.dec.DecodeElement(&m, &se); err != nil {
+				return err
+			}
+			c.handleMessage(s, &m)
+		case "presence":
+			var p xmppPresence
+			if err := s.dec.DecodeElement(&p, &se); err != nil {
+				return err
+			}
+			c.handlePresence(s, &p)
+		case "iq":
+			var iq xmppIQ
+			if err := s.dec.DecodeElement(&iq, &se); err != nil {
+				return err
+			}
+			c.handleIQ(s, &iq)
+		case "error":
+			var streamErr struct {
+				Inner string `xml:",innerxml"`
+			}
+			s.dec.DecodeElement(&streamErr, &se)
+			return fmt.Errorf("stream error: %s", streamErr.Inner)
+		default:
+			if err := s.dec.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *XMPPChannel) sendPresence(s *xmppSession) error {
+	if c.config.Status == "" {
+		return s.write(`<presence/>`)
+	}
+	return s.write(`<presence><status>%s</status></presence>`, xmlEscape(c.config.Status))
+}
+
+func (c *XMPPChannel) joinRoom(s *xmppSession, room, nick string) error {
+	logger.InfoCF("xmpp", "Joining room", map[string]any{"room": room, "nick": nick})
+	// Ask for no history so old messages are not answered again after a reconnect.
+	return s.write(`<presence to='%s/%s'><x xmlns='%s'><history maxstanzas='0'/></x></presence>`,
+		xmlEscape(room), xmlEscape(nick), nsMUC)
+}
+
+func (c *XMPPChannel) handleMessage(s *xmppSession, m *xmppMessage) {
+	if m.Type == "error" {
+		return
+	}
+
+	// Mediated (XEP-0045) and direct (XEP-0249) room invitations.
+	if m.MUCUser != nil && m.MUCUser.Invite != nil {
+		c.handleInvite(s, bareJID(m.From), m.MUCUser.Invite.From)
+		return
+	}
+	if m.Conference != nil && m.Conference.JID != "" {
+		c.handleInvite(s, bareJID(m.Conference.JID), m.From)
+		return
+	}
+
+	room := bareJID(m.From)
+	_, _, resource := splitJID(m.From)
+	c.mu.RLock()
+	ourNick, inRoom := c.rooms[room]
+	realJID := c.occupants[room+"/"+resource]
+	c.mu.RUnlock()
+
+	if m.Type == "groupchat" {
+		// Skip room history, subject changes and our own echoed messages.
+		if m.Delay != nil || resource == "" || resource == ourNick {
+			return
+		}
+		c.handleGroupMessage(s, m, room, resource, realJID, ourNick)
+		return
+	}
+
+	// Direct chat, or a private message from a room occupant.
+	chatID := bareJID(m.From)
+	senderID := chatID
+	if inRoom && resource != "" {
+		chatID = m.From
+		senderID = m.From
+		if realJID != "" {
+			senderID = realJID + "|" + m.From
+		}
+	}
+
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("xmpp", "Ignoring message from unlisted sender", map[string]any{"from": m.From})
+		return
+	}
+
+	if m.Encrypted != nil {
+		logger.WarnCF("xmpp", "Received OMEMO-encrypted message, which is not supported", map[string]any{
+			"from": m.From,
+		})
+		c.sendMessage(s, chatID, "chat", xmppOMEMONotice)
+		return
+	}
+
+	body := strings.TrimSpace(m.Body)
+	if body == "" {
+		return
+	}
+
+	s.write(`<message to='%s' type='chat'><composing xmlns='%s'/></message>`, xmlEscape(chatID), nsChatStates)
+
+	metadata := map[string]string{
+		"message_id": m.ID,
+		"peer_kind":  "direct",
+		"peer_id":    chatID,
+	}
+	c.HandleMessage(senderID, chatID, body, nil, metadata)
+}
+
+func (c *XMPPChannel) handleGroupMessage(s *xmppSession, m *xmppMessage, room, nick, realJID, ourNick string) {
+	body := strings.TrimSpace(m.Body)
+	if body == "" {
+		return
+	}
+
+	if c.config.MentionOnly {
+		if !strings.Contains(strings.ToLower(body), strings.ToLower(ourNick)) {
+			return
+		}
+		body = stripNickPrefix(body, ourNick)
+	}
+
+	if m.Encrypted != nil {
+		logger.WarnCF("xmpp", "Received OMEMO-encrypted room message, which is not supported", map[string]any{
+			"room": room,
+		})
+		return
+	}
+
+	// Rooms that disclose real JIDs let allow_from match the account, not
+	// just the nickname.
+	senderID := room + "/" + nick
+	if realJID != "" {
+		senderID = realJID + "|" + nick
+	}
+
+	metadata := map[string]string{
+		"message_id": m.ID,
+		"nick":       nick,
+		"peer_kind":  "group",
+		"peer_id":    room,
+	}
+	c.HandleMessage(senderID, room, body, nil, metadata)
+}
+
+func (c *XMPPChannel) handleInvite(s *xmppSession, room, inviter string) {
+	if !c.config.JoinOnInvite {
+		return
+	}
+	if !c.IsAllowed(bareJID(inviter)) {
+		logger.InfoCF("xmpp", "Ignoring room invite from unlisted user", map[string]any{
+			"room":    room,
+			"inviter": inviter,
+		})
+		return
+	}
+
+	c.mu.Lock()
+	_, joined := c.rooms[room]
+	if !joined {
+		c.rooms[room] = c.config.Nick
+	}
+	c.mu.Unlock()
+	if joined {
+		return
+	}
+
+	if err := c.joinRoom(s, room, c.config.Nick); err != nil {
+		logger.ErrorCF("xmpp", "Failed to join room", map[string]any{"room": room, "error": err.Error()})
+	}
+}
+
+func (c *XMPPChannel) handlePresence(s *xmppSession, p *xmppPresence) {
+	from := bareJID(p.From)
+	_, _, resource := splitJID(p.From)
+
+	c.mu.Lock()
+	nick, isRoom := c.rooms[from]
+	if isRoom && resource != "" && p.MUCUser != nil {
+		key := from + "/" + resource
+		if p.Type == "unavailable" {
+			delete(c.occupants, key)
+		} else {
+			for _, item := range p.MUCUser.Items {
+				if item.JID != "" {
+					c.occupants[key] = bareJID(item.JID)
+				}
+			}
+		}
+	}
+	// On a nickname conflict, retry once with a suffixed nick.
+	retryNick := ""
+	if isRoom && p.Type == "error" && p.Error != nil && p.Error.Conflict != nil && nick == c.config.Nick {
+		retryNick = nick + "_"
+		c.rooms[from] = retryNick
+	}
+	c.mu.Unlock()
+
+	switch {
+	case isRoom && p.Type == "error":
+		logger.WarnCF("xmpp", "Room presence error", map[string]any{"room": from, "nick": nick})
+		if retryNick != "" {
+			c.joinRoom(s, from, retryNick)
+		}
+	case isRoom && resource == nick && p.Type == "":
+		logger.InfoCF("xmpp", "Joined room", map[string]any{"room": from})
+	case p.Type == "subscribe":
+		if c.IsAllowed(from) {
+			logger.InfoCF("xmpp", "Accepting presence subscription", map[string]any{"from": from})
+			s.write(`<presence to='%s' type='subscribed'/>`, xmlEscape(from))
+			s.write(`<presence to='%s' type='subscribe'/>`, xmlEscape(from))
+		} else {
+			logger.InfoCF("xmpp", "Declining presence subscription from unlisted user", map[string]any{"from": from})
+			s.write(`<presence to='%s' type='unsubscribed'/>`, xmlEscape(from))
+		}
+	case p.Type == "unsubscribe":
+		s.write(`<presence to='%s' type='unsubscribed'/>`, xmlEscape(from))
+	}
+}
+
+func (c *XMPPChannel) handleIQ(s *xmppSession, iq *xmppIQ) {
+	if iq.Type != "get" && iq.Type != "set" {
+		return
+	}
+	if iq.Ping != nil {
+		s.write(`<iq to='%s' id='%s' type='result'/>`, xmlEscape(iq.From), xmlEscape(iq.ID))
+		return
+	}
+	// Every request must be answered (RFC 6120 §8.2.3).
+	s.write(`<iq to='%s' id='%s' type='error'><error type='cancel'>`+
+		`<service-unavailable xmlns='urn:ietf:params:xml:ns:xmpp-stanzas'/></error></iq>`,
+		xmlEscape(iq.From), xmlEscape(iq.ID))
+}
+
+// stripNickPrefix removes a leading "nick:" or "nick," address from a room
+// message.
+func stripNickPrefix(body, nick string) string {
+	if len(body) <= len(nick) || !strings.EqualFold(body[:len(nick)], nick) {
+		return body
+	}
+	rest := body[len(nick):]
+	if rest[0] == ':' || rest[0] == ',' {
+		return strings.TrimSpace(rest[1:])
+	}
+	return body
+}
@@ -0,0 +1,450 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	nsXMPPStream  = "http://etherx.jabber.org/streams"
+	nsXMPPTLS     = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsXMPPSASL    = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsXMPPBind    = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsXMPPSession = "urn:ietf:params:xml:ns:xmpp-session"
+
+	xmppDialTimeout = 15 * time.Second
+)
+
+// xmppSession is an authenticated, resource-bound client stream.
+type xmppSession struct {
+	conn   net.Conn
+	dec    *xml.Decoder
+	w      io.Writer
+	wmu    sync.Mutex
+	jid    string // full JID assigned by the server
+	domain string
+}
+
+type xmppFeatures struct {
+	StartTLS *struct {
+		Required *struct{} `xml:"required"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms *struct {
+		Mechanism []string `xml:"mechanism"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind    *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Session *struct {
+		Optional *struct{} `xml:"optional"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-session session"`
+}
+
+type xmppSASLReply struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
+
+// dialXMPP connects, upgrades to TLS, authenticates and binds a resource.
+// server overrides the host:port otherwise found through DNS SRV records.
+func dialXMPP(ctx context.Context, jid, password, resource, server string) (*xmppSession, error) {
+	local, domain, _ := splitJID(jid)
+	if local == "" || domain == "" {
+		return nil, fmt.Errorf("invalid JID %q", jid)
+	}
+
+	addr := server
+	if addr == "" {
+		addr = net.JoinHostPort(domain, "5222")
+		if _, srvs, err := net.DefaultResolver.LookupSRV(ctx, "xmpp-client", "tcp", domain); err == nil && len(srvs) > 0 {
+			addr = net.JoinHostPort(strings.TrimSuffix(srvs[0].Target, "."), strconv.Itoa(int(srvs[0].Port)))
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: xmppDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	s := &xmppSession{domain: domain}
+	s.reset(conn)
+
+	// Bound the handshake; the read loop clears the deadline afterwards.
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if err := s.negotiate(jid, password, resource); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return s, nil
+}
+
+func (s *xmppSession) reset(conn net.Conn) {
+	s.conn = conn
+	s.w = conn
+	s.dec = xml.NewDecoder(conn)
+}
+
+func (s *xmppSession) negotiate(jid, password, resource string) error {
+	features, err := s.openStream()
+	if err != nil {
+		return err
+	}
+
+	if features.StartTLS == nil {
+		return fmt.Errorf("server does not offer STARTTLS; refusing to authenticate in plaintext")
+	}
+	if err := s.write(`<starttls xmlns='%s'/>`, nsXMPPTLS); err != nil {
+		return err
+	}
+	reply, err := s.nextElement()
+	if err != nil {
+		return err
+	}
+	if reply.Name.Local != "proceed" {
+		return fmt.Errorf("STARTTLS rejected by server")
+	}
+	tlsConn := tls.Client(s.conn, &tls.Config{ServerName: s.domain, MinVersion: tls.VersionTLS12})
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("TLS handshake: %w", err)
+	}
+	s.reset(tlsConn)
+
+	if features, err = s.openStream(); err != nil {
+		return err
+	}
+	if err := s.authenticate(features, jid, password); err != nil {
+		return err
+	}
+	// The server starts a fresh XML document after SASL success.
+	s.dec = xml.NewDecoder(s.conn)
+
+	if features, err = s.openStream(); err != nil {
+		return err
+	}
+	if features.Bind == nil {
+		return fmt.Errorf("server does not offer resource binding")
+	}
+	if err := s.bind(resource); err != nil {
+		return err
+	}
+
+	// RFC 3921 session establishment, still required by some older servers.
+	if features.Session != nil && features.Session.Optional == nil {
+		if err := s.write(`<iq type='set' id='sess1'><session xmlns='%s'/></iq>`, nsXMPPSession); err != nil {
+			return err
+		}
+		if _, err := s.nextElement(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *xmppSession) openStream() (*xmppFeatures, error) {
+	if err := s.write(`<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' `+
+		`xmlns:stream='%s' version='1.0'>`, xmlEscape(s.domain), nsXMPPStream); err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("read stream header: %w", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Space == nsXMPPStream && se.Name.Local == "stream" {
+			break
+		}
+	}
+
+	se, err := s.nextStart()
+	if err != nil {
+		return nil, err
+	}
+	if se.Name.Space != nsXMPPStream || se.Name.Local != "features" {
+		return nil, fmt.Errorf("expected stream features, got <%s>", se.Name.Local)
+	}
+	var features xmppFeatures
+	if err := s.dec.DecodeElement(&features, &se); err != nil {
+		return nil, fmt.Errorf("decode stream features: %w", err)
+	}
+	return &features, nil
+}
+
+func (s *xmppSession) authenticate(features *xmppFeatures, jid, password string) error {
+	local, _, _ := splitJID(jid)
+
+	var mechanisms []string
+	if features.Mechanisms != nil {
+		mechanisms = features.Mechanisms.Mechanism
+	}
+	has := func(name string) bool {
+		for _, m := range mechanisms {
+			if strings.EqualFold(m, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("SCRAM-SHA-1"):
+		return s.authSCRAM(local, password)
+	case has("PLAIN"):
+		payload := base64.StdEncoding.EncodeToString([]byte("\x00" + local + "\x00" + password))
+		if err := s.write(`<auth xmlns='%s' mechanism='PLAIN'>%s</auth>`, nsXMPPSASL, payload); err != nil {
+			return err
+		}
+		reply, err := s.readSASL()
+		if err != nil {
+			return err
+		}
+		if reply.XMLName.Local != "success" {
+			return fmt.Errorf("authentication failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("no supported SASL mechanism (server offers %v)", mechanisms)
+	}
+}
+
+func (s *xmppSession) authSCRAM(username, password string) error {
+	nonceBytes := make([]byte, 18)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	scram := newSCRAMClient(username, password, hex.EncodeToString(nonceBytes))
+
+	first := base64.StdEncoding.EncodeToString([]byte(scram.clientFirst()))
+	if err := s.write(`<auth xmlns='%s' mechanism='SCRAM-SHA-1'>%s</auth>`, nsXMPPSASL, first); err != nil {
+		return err
+	}
+
+	reply, err := s.readSASL()
+	if err != nil {
+		return err
+	}
+	if reply.XMLName.Local != "challenge" {
+		return fmt.Errorf("authentication failed")
+	}
+	serverFirst, err := base64.StdEncoding.DecodeString(strings.TrimSpace(reply.Text))
+	if err != nil {
+		return fmt.Errorf("decode SCRAM challenge: %w", err)
+	}
+	final, err := scram.clientFinal(string(serverFirst))
+	if err != nil {
+		return err
+	}
+	if err := s.write(`<response xmlns='%s'>%s</response>`, nsXMPPSASL,
+		base64.StdEncoding.EncodeToString([]byte(final))); err != nil {
+		return err
+	}
+
+	reply, err = s.readSASL()
+	if err != nil {
+		return err
+	}
+	if reply.XMLName.Local != "success" {
+		return fmt.Errorf("authentication failed")
+	}
+	serverFinal, err := base64.StdEncoding.DecodeString(strings.TrimSpace(reply.Text))
+	if err != nil {
+		return fmt.Errorf("decode SCRAM success: %w", err)
+	}
+	return scram.verifyServer(string(serverFinal))
+}
+
+func (s *xmppSession) readSASL() (*xmppSASLReply, error) {
+	se, err := s.nextStart()
+	if err != nil {
+		return nil, err
+	}
+	var reply xmppSASLReply
+	if err := s.dec.DecodeElement(&reply, &se); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (s *xmppSession) bind(resource string) error {
+	if err := s.write(`<iq type='set' id='bind1'><bind xmlns='%s'><resource>%s</resource></bind></iq>`,
+		nsXMPPBind, xmlEscape(resource)); err != nil {
+		return err
+	}
+
+	se, err := s.nextStart()
+	if err != nil {
+		return err
+	}
+	var iq struct {
+		Type string `xml:"type,attr"`
+		Bind struct {
+			JID string `xml:"jid"`
+		} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	}
+	if err := s.dec.DecodeElement(&iq, &se); err != nil {
+		return err
+	}
+	if iq.Type != "result" || iq.Bind.JID == "" {
+		return fmt.Errorf("resource binding failed")
+	}
+	s.jid = iq.Bind.JID
+	return nil
+}
+
+// nextStart returns the next top-level start element, skipping whitespace.
+func (s *xmppSession) nextStart() (xml.StartElement, error) {
+	for {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsXMPPStream && t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+// nextElement consumes the next element and returns its start tag.
+func (s *xmppSession) nextElement() (xml.StartElement, error) {
+	se, err := s.nextStart()
+	if err != nil {
+		return se, err
+	}
+	return se, s.dec.Skip()
+}
+
+func (s *xmppSession) write(format string, args ...any) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, err := fmt.Fprintf(s.w, format, args...)
+	return err
+}
+
+func (s *xmppSession) close() {
+	s.write("</stream:stream>")
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// scramClient implements the client side of SCRAM-SHA-1 (RFC 5802) without
+// channel binding.
+type scramClient struct {
+	username, password, nonce string
+	clientFirstBare           string
+	serverSignature           []byte
+}
+
+func newSCRAMClient(username, password, nonce string) *scramClient {
+	escaped := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+	return &scramClient{
+		username:        username,
+		password:        password,
+		nonce:           nonce,
+		clientFirstBare: "n=" + escaped + ",r=" + nonce,
+	}
+}
+
+func (c *scramClient) clientFirst() string {
+	return "n,," + c.clientFirstBare
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := parseSCRAMAttrs(serverFirst)
+	nonce, salt64, iterStr := attrs["r"], attrs["s"], attrs["i"]
+	if !strings.HasPrefix(nonce, c.nonce) {
+		return "", fmt.Errorf("SCRAM server nonce does not extend client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return "", fmt.Errorf("decode SCRAM salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(iterStr)
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("invalid SCRAM iteration count %q", iterStr)
+	}
+
+	salted, err := pbkdf2.Key(sha1.New, c.password, salt, iterations, sha1.Size)
+	if err != nil {
+		return "", err
+	}
+	clientKey := hmacSHA1(salted, "Client Key")
+	storedKey := sha1.Sum(clientKey)
+
+	finalWithoutProof := "c=biws,r=" + nonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + finalWithoutProof
+
+	clientSig := hmacSHA1(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSig[i]
+	}
+
+	c.serverSignature = hmacSHA1(hmacSHA1(salted, "Server Key"), authMessage)
+	return finalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServer(serverFinal string) error {
+	v, err := base64.StdEncoding.DecodeString(parseSCRAMAttrs(serverFinal)["v"])
+	if err != nil || !hmac.Equal(v, c.serverSignature) {
+		return fmt.Errorf("SCRAM server signature mismatch")
+	}
+	return nil
+}
+
+func parseSCRAMAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+func hmacSHA1(key []byte, msg string) []byte {
+	h := hmac.New(sha1.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+// splitJID splits "local@domain/resource" into its parts.
+func splitJID(jid string) (local, domain, resource string) {
+	bare, resource, _ := strings.Cut(jid, "/")
+	if at := strings.Index(bare, "@"); at >= 0 {
+		return bare[:at], bare[at+1:], resource
+	}
+	return "", bare, resource
+}
+
+// bareJID strips the resource from a JID and lowercases it.
+func bareJID(jid string) string {
+	bare, _, _ := strings.Cut(jid, "/")
+	return strings.ToLower(bare)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
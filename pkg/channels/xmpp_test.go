@@ -0,0 +1,267 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSCRAMClient_RFC5802Vector(t *testing.T) {
+	scram := newSCRAMClient("user", "pencil", "fyko+d2lbbFgONRv9qkxdawL")
+	if got := scram.clientFirst(); got != "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL" {
+		t.Fatalf("clientFirst() = %q", got)
+	}
+
+	final, err := scram.clientFinal("r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096")
+	if err != nil {
+		t.Fatalf("clientFinal() error = %v", err)
+	}
+	want := "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts="
+	if final != want {
+		t.Errorf("clientFinal() = %q, want %q", final, want)
+	}
+
+	if err := scram.verifyServer("v=rmF9pqV8S7suAoZWja4dJRkFsKQ="); err != nil {
+		t.Errorf("verifyServer() error = %v", err)
+	}
+	if err := scram.verifyServer("v=AAAAAAAAAAAAAAAAAAAAAAAAAAA="); err == nil {
+		t.Error("expected signature mismatch")
+	}
+}
+
+func TestSCRAMClient_RejectsForeignNonce(t *testing.T) {
+	scram := newSCRAMClient("user", "pencil", "abc")
+	if _, err := scram.clientFinal("r=xyz123,s=QSXCR+Q6sek8bf92,i=4096"); err == nil {
+		t.Error("expected error for server nonce not extending client nonce")
+	}
+}
+
+func TestSplitJID(t *testing.T) {
+	local, domain, resource := splitJID("Alice@Example.com/phone")
+	if local != "Alice" || domain != "Example.com" || resource != "phone" {
+		t.Errorf("got (%q, %q, %q)", local, domain, resource)
+	}
+	if got := bareJID("Alice@Example.com/phone"); got != "alice@example.com" {
+		t.Errorf("bareJID() = %q", got)
+	}
+}
+
+func TestStripNickPrefix(t *testing.T) {
+	tests := map[string]string{
+		"picoclaw: hello":  "hello",
+		"PicoClaw, hi":     "hi",
+		"hey picoclaw":     "hey picoclaw",
+		"picoclawish talk": "picoclawish talk",
+	}
+	for in, want := range tests {
+		if got := stripNickPrefix(in, "picoclaw"); got != want {
+			t.Errorf("stripNickPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func newTestXMPPChannel(t *testing.T, allow ...string) (*XMPPChannel, *bus.MessageBus, *xmppSession, *bytes.Buffer) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	ch, err := NewXMPPChannel(config.XMPPConfig{
+		JID:          "bot@example.com",
+		Password:     "secret",
+		Rooms:        config.FlexibleStringSlice{"lounge@conference.example.com"},
+		Nick:         "picoclaw",
+		MentionOnly:  true,
+		JoinOnInvite: true,
+		AllowFrom:    allow,
+	}, msgBus)
+	if err != nil {
+		t.Fatalf("NewXMPPChannel() error = %v", err)
+	}
+	out := &bytes.Buffer{}
+	return ch, msgBus, &xmppSession{w: out}, out
+}
+
+func decodeStanza[T any](t *testing.T, raw string) *T {
+	t.Helper()
+	var v T
+	if err := xml.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("unmarshal %q: %v", raw, err)
+	}
+	return &v
+}
+
+func TestXMPPChannel_DirectMessage(t *testing.T) {
+	ch, msgBus, s, out := newTestXMPPChannel(t, "alice@example.com")
+
+	ch.handleMessage(s, decodeStanza[xmppMessage](t,
+		`<message from='mallory@example.com/pc' type='chat'><body>hi</body></message>`))
+	ch.handleMessage(s, decodeStanza[xmppMessage](t,
+		`<message from='Alice@example.com/phone' type='chat' id='m1'><body> hello </body></message>`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.SenderID != "alice@example.com" || msg.ChatID != "alice@example.com" || msg.Content != "hello" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Metadata["peer_kind"] != "direct" || msg.Metadata["peer_id"] != "alice@example.com" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+	if !strings.Contains(out.String(), "<composing") {
+		t.Errorf("expected composing chat state, wrote %q", out.String())
+	}
+}
+
+func TestXMPPChannel_GroupMessage(t *testing.T) {
+	ch, msgBus, s, _ := newTestXMPPChannel(t)
+
+	// Occupant presence discloses the real JID.
+	ch.handlePresence(s, decodeStanza[xmppPresence](t,
+		`<presence from='lounge@conference.example.com/alice'>`+
+			`<x xmlns='http://jabber.org/protocol/muc#user'><item jid='alice@example.com/pc'/></x></presence>`))
+
+	for _, raw := range []string{
+		// Not addressed to us (mention_only).
+		`<message from='lounge@conference.example.com/alice' type='groupchat'><body>hello all</body></message>`,
+		// Our own echo.
+		`<message from='lounge@conference.example.com/picoclaw' type='groupchat'><body>picoclaw: hi</body></message>`,
+		// Room history.
+		`<message from='lounge@conference.example.com/alice' type='groupchat'><body>picoclaw: old</body>` +
+			`<delay xmlns='urn:xmpp:delay' stamp='2020-01-01T00:00:00Z'/></message>`,
+		`<message from='lounge@conference.example.com/alice' type='groupchat'><body>picoclaw: status?</body></message>`,
+	} {
+		ch.handleMessage(s, decodeStanza[xmppMessage](t, raw))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected inbound message")
+	}
+	if msg.Content != "status?" || msg.ChatID != "lounge@conference.example.com" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.SenderID != "alice@example.com|alice" {
+		t.Errorf("SenderID = %q", msg.SenderID)
+	}
+	if msg.Metadata["peer_kind"] != "group" || msg.Metadata["peer_id"] != "lounge@conference.example.com" {
+		t.Errorf("unexpected peer metadata: %v", msg.Metadata)
+	}
+}
+
+func TestXMPPChannel_OMEMONotice(t *testing.T) {
+	ch, _, s, out := newTestXMPPChannel(t)
+
+	ch.handleMessage(s, decodeStanza[xmppMessage](t,
+		`<message from='alice@example.com/pc' type='chat'><body>fallback</body>`+
+			`<encrypted xmlns='eu.siacs.conversations.axolotl'/></message>`))
+
+	if !strings.Contains(out.String(), "OMEMO") {
+		t.Errorf("expected OMEMO notice, wrote %q", out.String())
+	}
+}
+
+func TestXMPPChannel_InviteAndPresence(t *testing.T) {
+	ch, _, s, out := newTestXMPPChannel(t, "alice@example.com")
+
+	ch.handleMessage(s, decodeStanza[xmppMessage](t,
+		`<message from='dev@conference.example.com'><x xmlns='http://jabber.org/protocol/muc#user'>`+
+			`<invite from='alice@example.com/pc'/></x></message>`))
+	if _, ok := ch.rooms["dev@conference.example.com"]; !ok {
+		t.Error("expected room to be joined after invite")
+	}
+	if !strings.Contains(out.String(), "to='dev@conference.example.com/picoclaw'") {
+		t.Errorf("expected join presence, wrote %q", out.String())
+	}
+
+	out.Reset()
+	ch.handlePresence(s, decodeStanza[xmppPresence](t, `<presence from='alice@example.com' type='subscribe'/>`))
+	if !strings.Contains(out.String(), "type='subscribed'") {
+		t.Errorf("expected subscription approval, wrote %q", out.String())
+	}
+
+	out.Reset()
+	ch.handlePresence(s, decodeStanza[xmppPresence](t, `<presence from='mallory@example.com' type='subscribe'/>`))
+	if !strings.Contains(out.String(), "type='unsubscribed'") {
+		t.Errorf("expected subscription refusal, wrote %q", out.String())
+	}
+
+	out.Reset()
+	ch.handleIQ(s, decodeStanza[xmppIQ](t, `<iq from='example.com' id='p1' type='get'><ping xmlns='urn:xmpp:ping'/></iq>`))
+	if out.String() != "<iq to='example.com' id='p1' type='result'/>" {
+		t.Errorf("unexpected ping reply %q", out.String())
+	}
+}
+
+func TestXMPPSession_AuthenticateAndBind(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		dec := xml.NewDecoder(server)
+		expect := func(local string) {
+			for {
+				tok, err := dec.Token()
+				if err != nil {
+					return
+				}
+				if se, ok := tok.(xml.StartElement); ok && se.Name.Local == local {
+					if local != "stream" {
+						dec.Skip()
+					}
+					return
+				}
+			}
+		}
+		header := `<?xml version='1.0'?><stream:stream xmlns='jabber:client' ` +
+			`xmlns:stream='http://etherx.jabber.org/streams' from='example.com' version='1.0'>`
+
+		expect("stream")
+		io.WriteString(server, header+`<stream:features><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'>`+
+			`<mechanism>PLAIN</mechanism></mechanisms></stream:features>`)
+		expect("auth")
+		io.WriteString(server, `<success xmlns='urn:ietf:params:xml:ns:xmpp-sasl'/>`)
+
+		dec = xml.NewDecoder(server)
+		expect("stream")
+		io.WriteString(server, header+`<stream:features><bind xmlns='urn:ietf:params:xml:ns:xmpp-bind'/></stream:features>`)
+		expect("iq")
+		io.WriteString(server, `<iq type='result' id='bind1'><bind xmlns='urn:ietf:params:xml:ns:xmpp-bind'>`+
+			`<jid>bot@example.com/picoclaw</jid></bind></iq>`)
+	}()
+
+	s := &xmppSession{domain: "example.com"}
+	s.reset(client)
+
+	features, err := s.openStream()
+	if err != nil {
+		t.Fatalf("openStream() error = %v", err)
+	}
+	if err := s.authenticate(features, "bot@example.com", "secret"); err != nil {
+		t.Fatalf("authenticate() error = %v", err)
+	}
+	s.dec = xml.NewDecoder(client)
+	if features, err = s.openStream(); err != nil {
+		t.Fatalf("openStream() after auth error = %v", err)
+	}
+	if features.Bind == nil {
+		t.Fatal("expected bind feature")
+	}
+	if err := s.bind("picoclaw"); err != nil {
+		t.Fatalf("bind() error = %v", err)
+	}
+	if s.jid != "bot@example.com/picoclaw" {
+		t.Errorf("jid = %q", s.jid)
+	}
+}
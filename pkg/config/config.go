@@ -1,13 +1,26 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"text/template"
+	"time"
 
+	"github.com/adhocore/gronx"
 	"github.com/caarlos0/env/v11"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/i18n"
 )
 
 // rrCounter is a global counter for round-robin load balancing across models.
@@ -47,16 +60,34 @@ func (f *FlexibleStringSlice) UnmarshalJSON(data []byte) error {
 }
 
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Bindings  []AgentBinding  `json:"bindings,omitempty"`
-	Session   SessionConfig   `json:"session,omitempty"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers,omitempty"`
-	ModelList []ModelConfig   `json:"model_list"` // New model-centric provider configuration
-	Gateway   GatewayConfig   `json:"gateway"`
-	Tools     ToolsConfig     `json:"tools"`
-	Heartbeat HeartbeatConfig `json:"heartbeat"`
-	Devices   DevicesConfig   `json:"devices"`
+	Agents    AgentsConfig          `json:"agents"`
+	Bindings  []AgentBinding        `json:"bindings,omitempty"`
+	Routing   RoutingConfig         `json:"routing,omitempty"`
+	Commands  []CommandConfig       `json:"commands,omitempty"`
+	Triggers  []TriggerConfig       `json:"triggers,omitempty"`
+	Session   SessionConfig         `json:"session,omitempty"`
+	Channels  ChannelsConfig        `json:"channels"`
+	Providers ProvidersConfig       `json:"providers,omitempty"`
+	ModelList []ModelConfig         `json:"model_list"` // New model-centric provider configuration
+	Gateway   GatewayConfig         `json:"gateway"`
+	Tools     ToolsConfig           `json:"tools"`
+	Plugins   PluginsConfig         `json:"plugins,omitempty"`
+	Update    UpdateConfig          `json:"update,omitempty"`
+	Heartbeat HeartbeatConfig       `json:"heartbeat"`
+	Memory    MemoryConfig          `json:"memory,omitempty"`
+	Devices   DevicesConfig         `json:"devices"`
+	Pricing   map[string]ModelPrice `json:"pricing,omitempty"` // by model_list name, vendor/model or model ID
+	Fixtures  FixturesConfig        `json:"fixtures,omitempty"`
+	// RuntimeProfile presets the defaults for the hardware picoclaw runs
+	// on, see RuntimeProfiles.
+	RuntimeProfile string `json:"runtime_profile,omitempty" env:"PICOCLAW_RUNTIME_PROFILE"`
+}
+
+// ModelPrice overrides what a model costs, in US dollars per million
+// tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
 }
 
 // MarshalJSON implements custom JSON marshaling for Config
@@ -77,7 +108,7 @@ func (c Config) MarshalJSON() ([]byte, error) {
 	}
 
 	// Only include session if not empty
-	if c.Session.DMScope != "" || len(c.Session.IdentityLinks) > 0 {
+	if c.Session.DMScope != "" || len(c.Session.IdentityLinks) > 0 || c.Session.Store != (SessionStoreConfig{}) {
 		aux.Session = &c.Session
 	}
 
@@ -136,6 +167,86 @@ type AgentConfig struct {
 	Model     *AgentModelConfig `json:"model,omitempty"`
 	Skills    []string          `json:"skills,omitempty"`
 	Subagents *SubagentsConfig  `json:"subagents,omitempty"`
+
+	// Overrides of the agent defaults. Provider is the vendor of a model
+	// that is not a model_list name, e.g. "openrouter" for "gpt-4o-mini";
+	// the API key and base come from a model_list entry of that vendor.
+	Provider        string          `json:"provider,omitempty"`
+	Temperature     *float64        `json:"temperature,omitempty"`
+	MaxTokens       int             `json:"max_tokens,omitempty"`
+	ReasoningEffort string          `json:"reasoning_effort,omitempty"`
+	Critique        *CritiqueConfig `json:"critique,omitempty"`
+	GenerationParams
+}
+
+// GenerationParams are sampling settings beyond temperature, set next to
+// it in agents.defaults or an agent. Unset ones are left to the provider,
+// and each provider sends only those its API takes.
+type GenerationParams struct {
+	TopP             *float64           `json:"top_p,omitempty"`
+	Stop             []string           `json:"stop,omitempty"` // stop sequences
+	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	Seed             *int               `json:"seed,omitempty"`
+	LogitBias        map[string]float64 `json:"logit_bias,omitempty"` // token ID -> bias
+}
+
+// Merge returns p with the parameters override sets replacing its own.
+func (p GenerationParams) Merge(override GenerationParams) GenerationParams {
+	if override.TopP != nil {
+		p.TopP = override.TopP
+	}
+	if override.Stop != nil {
+		p.Stop = override.Stop
+	}
+	if override.FrequencyPenalty != nil {
+		p.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.PresencePenalty != nil {
+		p.PresencePenalty = override.PresencePenalty
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	if override.LogitBias != nil {
+		p.LogitBias = override.LogitBias
+	}
+	return p
+}
+
+// Validate checks the parameters against the ranges OpenAI documents,
+// which the other APIs share.
+func (p GenerationParams) Validate() error {
+	if p.TopP != nil && (*p.TopP <= 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p %v is outside 0 to 1", *p.TopP)
+	}
+	if v := p.FrequencyPenalty; v != nil && (*v < -2 || *v > 2) {
+		return fmt.Errorf("frequency_penalty %v is outside -2 to 2", *v)
+	}
+	if v := p.PresencePenalty; v != nil && (*v < -2 || *v > 2) {
+		return fmt.Errorf("presence_penalty %v is outside -2 to 2", *v)
+	}
+	if slices.Contains(p.Stop, "") {
+		return fmt.Errorf("stop has an empty sequence")
+	}
+	for token, bias := range p.LogitBias {
+		if _, err := strconv.Atoi(token); err != nil {
+			return fmt.Errorf("logit_bias key %q is not a token ID", token)
+		}
+		if bias < -100 || bias > 100 {
+			return fmt.Errorf("logit_bias for %s is outside -100 to 100", token)
+		}
+	}
+	return nil
+}
+
+// CritiqueConfig has a second model review an agent's answers before they
+// are sent. Model is a model_list name or vendor/model, usually a cheaper
+// one than the agent's. Rubric is what answers are judged against; empty
+// for a general check of correctness and completeness.
+type CritiqueConfig struct {
+	Model  string `json:"model"`
+	Rubric string `json:"rubric,omitempty"`
 }
 
 type SubagentsConfig struct {
@@ -161,23 +272,155 @@ type AgentBinding struct {
 	Match   BindingMatch `json:"match"`
 }
 
+// RoutingConfig chooses the persona, one of the agents, that answers each
+// inbound message. Rules are tried in order and the first that matches
+// picks the persona; when none does, Fallback answers, or else the agent
+// the bindings route to. The answering persona keeps the conversation in
+// the routed agent's session, as with /persona, and a persona chosen with
+// /persona wins over the rules.
+type RoutingConfig struct {
+	Rules    []RoutingRule `json:"rules,omitempty"`
+	Fallback string        `json:"fallback,omitempty"`
+}
+
+// CommandConfig defines a slash command of its own, such as /standup,
+// that sends a canned prompt to the agent. The prompt is a Go template
+// rendered with the command's arguments, see agent.CommandData.
+type CommandConfig struct {
+	Name        string `json:"name"`                  // without the slash, e.g. "standup"
+	Description string `json:"description,omitempty"` // shown by /help
+	Prompt      string `json:"prompt"`
+	// Persona answers the command instead of the chat's agent, and Model
+	// instead of its model.
+	Persona string `json:"persona,omitempty"`
+	Model   string `json:"model,omitempty"`
+	// Tools are the only tools the agent may use for the command; all of
+	// its own when empty.
+	Tools FlexibleStringSlice `json:"tools,omitempty"`
+	// Allow lists who may use the command: "admin" for the admin chats or
+	// "channel:sender_id". Everyone may when empty.
+	Allow FlexibleStringSlice `json:"allow,omitempty"`
+}
+
+// TriggerConfig starts a run when something happens: a file changes in
+// the folder Path (kind "file"), a message arrives on an MQTT Topic
+// ("mqtt"), /triggers/<name> is called on the gateway ("webhook"), the
+// feed at URL has a new item ("rss"), or a channel connects or drops
+// ("presence"). The prompt is a Go template rendered with triggers.Event.
+type TriggerConfig struct {
+	Name    string `json:"name"` // lowercase, also the path of a webhook
+	Kind    string `json:"kind"`
+	Prompt  string `json:"prompt"`
+	Persona string `json:"persona,omitempty"` // answers instead of the default agent
+	// Channel and ChatID get the answer; without them it is only kept in
+	// the trigger's session, "trigger:<name>".
+	Channel string `json:"channel,omitempty"`
+	ChatID  string `json:"chat_id,omitempty"`
+	// Path is the folder a file trigger watches, and Pattern the names of
+	// the files in it that count, e.g. "*.pdf"; all when empty.
+	Path    string `json:"path,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// Broker, Topic, Username and Password are those of an MQTT trigger.
+	// The topic may hold wildcards.
+	Broker   string `json:"broker,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// URL is the RSS or Atom feed of an rss trigger.
+	URL string `json:"url,omitempty"`
+	// Secret must be sent by the callers of a webhook trigger, as a bearer
+	// token or in the X-Trigger-Secret header.
+	Secret string `json:"secret,omitempty"`
+	// Channels are those a presence trigger watches; all when empty.
+	Channels FlexibleStringSlice `json:"channels,omitempty"`
+	// IntervalSeconds is how often file and rss triggers look for changes;
+	// 30 and 900 when unset.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+}
+
+// TriggerKinds are the kinds of trigger.
+var TriggerKinds = []string{"file", "mqtt", "webhook", "rss", "presence"}
+
+// RoutingRule picks Persona for the messages Match matches. Name is shown
+// by /whoami; without one the rule is called by its number.
+type RoutingRule struct {
+	Name    string       `json:"name,omitempty"`
+	Persona string       `json:"persona"`
+	Match   RoutingMatch `json:"match"`
+}
+
+// RoutingMatch is met by a message that meets every condition set in it.
+// Within a list, any one entry will do. Channels name a channel type, such
+// as "telegram", or one account, as "telegram@work"; chats and senders are
+// "channel:id" in the same way. Keywords are found anywhere in the text,
+// ignoring case. Schedule is a cron expression of the minutes the rule
+// holds, e.g. "* 9-17 * * 1-5" for office hours, in Timezone or local time.
+type RoutingMatch struct {
+	Channels []string `json:"channels,omitempty"`
+	Chats    []string `json:"chats,omitempty"`
+	Senders  []string `json:"senders,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+	Schedule string   `json:"schedule,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
 type SessionConfig struct {
 	DMScope       string              `json:"dm_scope,omitempty"`
 	IdentityLinks map[string][]string `json:"identity_links,omitempty"`
+	Store         SessionStoreConfig  `json:"store,omitempty"`
+}
+
+// SessionStoreConfig chooses where conversations are kept between restarts.
+type SessionStoreConfig struct {
+	Backend     string `json:"backend,omitempty"      env:"PICOCLAW_SESSION_STORE_BACKEND"`      // one of SessionStoreBackends; "" = sqlite, or file where SQLite is not available
+	DSN         string `json:"dsn,omitempty"          env:"PICOCLAW_SESSION_STORE_DSN"`          // postgres:// or redis:// URL
+	Namespace   string `json:"namespace,omitempty"    env:"PICOCLAW_SESSION_STORE_NAMESPACE"`    // keeps installs sharing a server apart
+	MaxMessages int    `json:"max_messages,omitempty" env:"PICOCLAW_SESSION_STORE_MAX_MESSAGES"` // per session; 0 = 500
+	MaxConns    int    `json:"max_conns,omitempty"    env:"PICOCLAW_SESSION_STORE_MAX_CONNS"`    // SQLite connections kept open; 0 = no limit
+	CacheKB     int    `json:"cache_kb,omitempty"     env:"PICOCLAW_SESSION_STORE_CACHE_KB"`     // SQLite page cache per connection; 0 = SQLite's 2 MB
+}
+
+// SessionStoreBackends are the values backend accepts. "file" keeps one
+// JSON file per session, as older versions did; "memory" keeps sessions
+// only until the gateway stops, for tests.
+var SessionStoreBackends = []string{"sqlite", "postgres", "redis", "file", "memory"}
+
+// Validate reports a backend that is not known or lacks its DSN.
+func (c SessionStoreConfig) Validate() error {
+	switch {
+	case c.Backend != "" && !slices.Contains(SessionStoreBackends, c.Backend):
+		return fmt.Errorf("session.store: backend %q is not one of %s",
+			c.Backend, strings.Join(SessionStoreBackends, ", "))
+	case (c.Backend == "postgres" || c.Backend == "redis") && c.DSN == "":
+		return fmt.Errorf("session.store: the %s backend needs a dsn", c.Backend)
+	case c.MaxMessages < 0:
+		return fmt.Errorf("session.store: max_messages must not be negative")
+	}
+	return nil
 }
 
 type AgentDefaults struct {
-	Workspace           string   `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool     `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string   `json:"provider"                        env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	ModelName           string   `json:"model_name,omitempty"            env:"PICOCLAW_AGENTS_DEFAULTS_MODEL_NAME"`
-	Model               string   `json:"model,omitempty"                 env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"` // Deprecated: use model_name instead
-	ModelFallbacks      []string `json:"model_fallbacks,omitempty"`
-	ImageModel          string   `json:"image_model,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
-	ImageModelFallbacks []string `json:"image_model_fallbacks,omitempty"`
-	MaxTokens           int      `json:"max_tokens"                      env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         *float64 `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int      `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace           string          `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace bool            `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider            string          `json:"provider"                        env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	ModelName           string          `json:"model_name,omitempty"            env:"PICOCLAW_AGENTS_DEFAULTS_MODEL_NAME"`
+	Model               string          `json:"model,omitempty"                 env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"` // Deprecated: use model_name instead
+	ModelFallbacks      []string        `json:"model_fallbacks,omitempty"`
+	ImageModel          string          `json:"image_model,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
+	ImageModelFallbacks []string        `json:"image_model_fallbacks,omitempty"`
+	MaxTokens           int             `json:"max_tokens"                      env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	Temperature         *float64        `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations   int             `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	LLMTimeoutSeconds   int             `json:"llm_timeout_seconds,omitempty"   env:"PICOCLAW_AGENTS_DEFAULTS_LLM_TIMEOUT_SECONDS"` // per request; 0 = no limit
+	ReasoningEffort     string          `json:"reasoning_effort,omitempty"      env:"PICOCLAW_AGENTS_DEFAULTS_REASONING_EFFORT"`    // one of ReasoningEfforts
+	ContextWindow       int             `json:"context_window,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"`      // overrides the model's window
+	ContextStrategy     string          `json:"context_strategy,omitempty"      env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_STRATEGY"`    // one of ContextStrategies
+	ResponseCacheTTL    int             `json:"response_cache_ttl,omitempty"    env:"PICOCLAW_AGENTS_DEFAULTS_RESPONSE_CACHE_TTL"`  // minutes; 0 = no cache
+	ResponseCacheKB     int             `json:"response_cache_kb,omitempty"     env:"PICOCLAW_AGENTS_DEFAULTS_RESPONSE_CACHE_KB"`   // total size of the cached responses
+	OverflowModel       string          `json:"overflow_model,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_OVERFLOW_MODEL"`      // larger-window model for prompts that overflow
+	KeepReasoning       bool            `json:"keep_reasoning,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_KEEP_REASONING"`      // store the model's reasoning in the session history
+	Critique            *CritiqueConfig `json:"critique,omitempty"`
+	GenerationParams
 }
 
 // GetModelName returns the effective model name for the agent defaults.
@@ -190,31 +433,142 @@ func (d *AgentDefaults) GetModelName() string {
 }
 
 type ChannelsConfig struct {
-	WhatsApp WhatsAppConfig `json:"whatsapp"`
-	Telegram TelegramConfig `json:"telegram"`
-	Feishu   FeishuConfig   `json:"feishu"`
-	Discord  DiscordConfig  `json:"discord"`
-	MaixCam  MaixCamConfig  `json:"maixcam"`
-	QQ       QQConfig       `json:"qq"`
-	DingTalk DingTalkConfig `json:"dingtalk"`
-	Slack    SlackConfig    `json:"slack"`
-	LINE     LINEConfig     `json:"line"`
-	OneBot   OneBotConfig   `json:"onebot"`
-	WeCom    WeComConfig    `json:"wecom"`
-	WeComApp WeComAppConfig `json:"wecom_app"`
+	WhatsApp   WhatsAppConfig   `json:"whatsapp"`
+	Telegram   TelegramConfig   `json:"telegram"`
+	Feishu     FeishuConfig     `json:"feishu"`
+	Discord    DiscordConfig    `json:"discord"`
+	MaixCam    MaixCamConfig    `json:"maixcam"`
+	QQ         QQConfig         `json:"qq"`
+	DingTalk   DingTalkConfig   `json:"dingtalk"`
+	Slack      SlackConfig      `json:"slack"`
+	LINE       LINEConfig       `json:"line"`
+	OneBot     OneBotConfig     `json:"onebot"`
+	WeCom      WeComConfig      `json:"wecom"`
+	WeComApp   WeComAppConfig   `json:"wecom_app"`
+	Matrix     MatrixConfig     `json:"matrix"`
+	Signal     SignalConfig     `json:"signal"`
+	Email      EmailConfig      `json:"email"`
+	Webhook    WebhookConfig    `json:"webhook"`
+	Web        WebConfig        `json:"web"`
+	XMPP       XMPPConfig       `json:"xmpp"`
+	Mattermost MattermostConfig `json:"mattermost"`
+	RocketChat RocketChatConfig `json:"rocketchat"`
+	Voice      VoiceConfig      `json:"voice"`
+	MQTT       MQTTConfig       `json:"mqtt"`
+	Nostr      NostrConfig      `json:"nostr"`
+	SMS        SMSConfig        `json:"sms"`
+	// Attachments applies to files received and sent on every channel.
+	Attachments AttachmentsConfig `json:"attachments"`
+	// Presence controls typing indicators and progress reactions.
+	Presence PresenceConfig `json:"presence"`
+	// Broadcast lists the chats /broadcast announcements go to.
+	Broadcast BroadcastConfig `json:"broadcast"`
+	// Retry controls redelivery of replies that failed to send.
+	Retry OutboundRetryConfig `json:"retry"`
+	// Accounts configures further instances of the channels above, e.g. a
+	// second Telegram bot, under an account name.
+	Accounts ChannelAccounts `json:"accounts,omitempty"`
+}
+
+// AllowFrom returns the allowlist of the channel type, such as
+// "telegram", and false for channels without one.
+func (c ChannelsConfig) AllowFrom(channelType string) ([]string, bool) {
+	switch channelType {
+	case "whatsapp":
+		return c.WhatsApp.AllowFrom, true
+	case "telegram":
+		return c.Telegram.AllowFrom, true
+	case "feishu":
+		return c.Feishu.AllowFrom, true
+	case "discord":
+		return c.Discord.AllowFrom, true
+	case "maixcam":
+		return c.MaixCam.AllowFrom, true
+	case "qq":
+		return c.QQ.AllowFrom, true
+	case "dingtalk":
+		return c.DingTalk.AllowFrom, true
+	case "slack":
+		return c.Slack.AllowFrom, true
+	case "line":
+		return c.LINE.AllowFrom, true
+	case "onebot":
+		return c.OneBot.AllowFrom, true
+	case "wecom":
+		return c.WeCom.AllowFrom, true
+	case "wecom_app":
+		return c.WeComApp.AllowFrom, true
+	case "matrix":
+		return c.Matrix.AllowFrom, true
+	case "signal":
+		return c.Signal.AllowFrom, true
+	case "email":
+		return c.Email.AllowFrom, true
+	case "webhook":
+		return c.Webhook.AllowFrom, true
+	case "xmpp":
+		return c.XMPP.AllowFrom, true
+	case "mattermost":
+		return c.Mattermost.AllowFrom, true
+	case "rocketchat":
+		return c.RocketChat.AllowFrom, true
+	case "nostr":
+		return c.Nostr.AllowFrom, true
+	case "sms":
+		return c.SMS.AllowFrom, true
+	}
+	return nil, false
+}
+
+// ChannelAccounts maps an account name to the channels configured for it.
+// Each account starts from the default channel settings; attachments,
+// presence and nested accounts are taken from the top-level block only.
+type ChannelAccounts map[string]ChannelsConfig
+
+func (a *ChannelAccounts) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	accounts := make(ChannelAccounts, len(raw))
+	for name, msg := range raw {
+		if name == "" || strings.ContainsAny(name, "@: ") {
+			return fmt.Errorf("invalid channel account name %q", name)
+		}
+		channels := DefaultConfig().Channels
+		if err := json.Unmarshal(msg, &channels); err != nil {
+			return fmt.Errorf("channel account %s: %w", name, err)
+		}
+		accounts[name] = channels
+	}
+	*a = accounts
+	return nil
 }
 
 type WhatsAppConfig struct {
-	Enabled   bool                `json:"enabled"    env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
-	BridgeURL string              `json:"bridge_url" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
-	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
+	Enabled          bool                `json:"enabled"            env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
+	BridgeURL        string              `json:"bridge_url"         env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
+	UseNative        bool                `json:"use_native"         env:"PICOCLAW_CHANNELS_WHATSAPP_USE_NATIVE"`
+	SessionStorePath string              `json:"session_store_path" env:"PICOCLAW_CHANNELS_WHATSAPP_SESSION_STORE_PATH"`
+	AllowFrom        FlexibleStringSlice `json:"allow_from"         env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
+}
+
+// StorePath returns the expanded path of the native WhatsApp session database.
+func (c WhatsAppConfig) StorePath() string {
+	if c.SessionStorePath == "" {
+		return expandHome("~/.picoclaw/whatsapp/session.db")
+	}
+	return expandHome(c.SessionStorePath)
 }
 
 type TelegramConfig struct {
-	Enabled   bool                `json:"enabled"    env:"PICOCLAW_CHANNELS_TELEGRAM_ENABLED"`
-	Token     string              `json:"token"      env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
-	Proxy     string              `json:"proxy"      env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
-	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	Enabled       bool                `json:"enabled"        env:"PICOCLAW_CHANNELS_TELEGRAM_ENABLED"`
+	Token         string              `json:"token"          env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
+	Proxy         string              `json:"proxy"          env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
+	MentionOnly   bool                `json:"mention_only"   env:"PICOCLAW_CHANNELS_TELEGRAM_MENTION_ONLY"`   // in groups, answer only mentions and replies
+	StreamReplies bool                `json:"stream_replies" env:"PICOCLAW_CHANNELS_TELEGRAM_STREAM_REPLIES"` // edit the reply while it is generated
+	ParseMode     string              `json:"parse_mode"     env:"PICOCLAW_CHANNELS_TELEGRAM_PARSE_MODE"`     // "html" (default) or "markdownv2"
+	AllowFrom     FlexibleStringSlice `json:"allow_from"     env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
 }
 
 type FeishuConfig struct {
@@ -306,11 +660,336 @@ type WeComAppConfig struct {
 	ReplyTimeout   int                 `json:"reply_timeout"    env:"PICOCLAW_CHANNELS_WECOM_APP_REPLY_TIMEOUT"`
 }
 
+type MatrixConfig struct {
+	Enabled      bool                `json:"enabled"        env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver   string              `json:"homeserver"     env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"`
+	UserID       string              `json:"user_id"        env:"PICOCLAW_CHANNELS_MATRIX_USER_ID"`
+	AccessToken  string              `json:"access_token"   env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	JoinOnInvite bool                `json:"join_on_invite" env:"PICOCLAW_CHANNELS_MATRIX_JOIN_ON_INVITE"`
+	MentionOnly  bool                `json:"mention_only"   env:"PICOCLAW_CHANNELS_MATRIX_MENTION_ONLY"`
+	AllowFrom    FlexibleStringSlice `json:"allow_from"     env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+}
+
+type SignalConfig struct {
+	Enabled          bool                `json:"enabled"            env:"PICOCLAW_CHANNELS_SIGNAL_ENABLED"`
+	URL              string              `json:"url"                env:"PICOCLAW_CHANNELS_SIGNAL_URL"`
+	Account          string              `json:"account"            env:"PICOCLAW_CHANNELS_SIGNAL_ACCOUNT"`
+	AttachmentsDir   string              `json:"attachments_dir"    env:"PICOCLAW_CHANNELS_SIGNAL_ATTACHMENTS_DIR"`
+	SendReadReceipts bool                `json:"send_read_receipts" env:"PICOCLAW_CHANNELS_SIGNAL_SEND_READ_RECEIPTS"`
+	AllowFrom        FlexibleStringSlice `json:"allow_from"         env:"PICOCLAW_CHANNELS_SIGNAL_ALLOW_FROM"`
+}
+
+// AttachmentsPath returns the expanded directory where signal-cli stores
+// received attachments.
+func (c SignalConfig) AttachmentsPath() string {
+	return expandHome(c.AttachmentsDir)
+}
+
+type EmailConfig struct {
+	Enabled            bool                `json:"enabled"              env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	Address            string              `json:"address"              env:"PICOCLAW_CHANNELS_EMAIL_ADDRESS"`
+	FromName           string              `json:"from_name"            env:"PICOCLAW_CHANNELS_EMAIL_FROM_NAME"`
+	IMAPHost           string              `json:"imap_host"            env:"PICOCLAW_CHANNELS_EMAIL_IMAP_HOST"`
+	IMAPPort           int                 `json:"imap_port"            env:"PICOCLAW_CHANNELS_EMAIL_IMAP_PORT"`
+	Username           string              `json:"username"             env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password           string              `json:"password"             env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	Mailbox            string              `json:"mailbox"              env:"PICOCLAW_CHANNELS_EMAIL_MAILBOX"`
+	PollInterval       int                 `json:"poll_interval"        env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"` // seconds
+	SMTPHost           string              `json:"smtp_host"            env:"PICOCLAW_CHANNELS_EMAIL_SMTP_HOST"`
+	SMTPPort           int                 `json:"smtp_port"            env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PORT"`
+	SMTPUsername       string              `json:"smtp_username"        env:"PICOCLAW_CHANNELS_EMAIL_SMTP_USERNAME"`
+	SMTPPassword       string              `json:"smtp_password"        env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PASSWORD"`
+	MaxAttachmentBytes int64               `json:"max_attachment_bytes" env:"PICOCLAW_CHANNELS_EMAIL_MAX_ATTACHMENT_BYTES"`
+	AllowFrom          FlexibleStringSlice `json:"allow_from"           env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+	// TrustedAuthservIDs names the mail servers whose Authentication-Results
+	// headers are believed; mail without a passing DKIM, SPF or DMARC
+	// result from one of them is dropped.
+	TrustedAuthservIDs FlexibleStringSlice `json:"trusted_authserv_ids" env:"PICOCLAW_CHANNELS_EMAIL_TRUSTED_AUTHSERV_IDS"`
+}
+
+type WebhookConfig struct {
+	Enabled     bool                `json:"enabled"      env:"PICOCLAW_CHANNELS_WEBHOOK_ENABLED"`
+	Host        string              `json:"host"         env:"PICOCLAW_CHANNELS_WEBHOOK_HOST"`
+	Port        int                 `json:"port"         env:"PICOCLAW_CHANNELS_WEBHOOK_PORT"`
+	APIKeys     FlexibleStringSlice `json:"api_keys"     env:"PICOCLAW_CHANNELS_WEBHOOK_API_KEYS"`
+	RateLimit   int                 `json:"rate_limit"   env:"PICOCLAW_CHANNELS_WEBHOOK_RATE_LIMIT"`   // requests per minute per key
+	SyncTimeout int                 `json:"sync_timeout" env:"PICOCLAW_CHANNELS_WEBHOOK_SYNC_TIMEOUT"` // seconds
+	AllowFrom   FlexibleStringSlice `json:"allow_from"   env:"PICOCLAW_CHANNELS_WEBHOOK_ALLOW_FROM"`
+	// KeySenders lists, by API key, the sender_id values requests with
+	// that key may give. A key not listed may only send as itself,
+	// "api:" and the key's last four characters.
+	KeySenders map[string]FlexibleStringSlice `json:"key_senders,omitempty"`
+	// CallbackHosts are the hosts callback_url may name. When empty, any
+	// host is accepted that does not resolve to a loopback, private or
+	// link-local address.
+	CallbackHosts FlexibleStringSlice `json:"callback_hosts,omitempty" env:"PICOCLAW_CHANNELS_WEBHOOK_CALLBACK_HOSTS"`
+}
+
+type WebConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_CHANNELS_WEB_ENABLED"`
+	Host    string `json:"host"    env:"PICOCLAW_CHANNELS_WEB_HOST"`
+	Port    int    `json:"port"    env:"PICOCLAW_CHANNELS_WEB_PORT"`
+	Token   string `json:"token"   env:"PICOCLAW_CHANNELS_WEB_TOKEN"` // optional shared secret for the page and API
+}
+
+type XMPPConfig struct {
+	Enabled      bool                `json:"enabled"        env:"PICOCLAW_CHANNELS_XMPP_ENABLED"`
+	JID          string              `json:"jid"            env:"PICOCLAW_CHANNELS_XMPP_JID"`
+	Password     string              `json:"password"       env:"PICOCLAW_CHANNELS_XMPP_PASSWORD"`
+	Server       string              `json:"server"         env:"PICOCLAW_CHANNELS_XMPP_SERVER"` // host:port, defaults to DNS SRV lookup
+	Resource     string              `json:"resource"       env:"PICOCLAW_CHANNELS_XMPP_RESOURCE"`
+	Status       string              `json:"status"         env:"PICOCLAW_CHANNELS_XMPP_STATUS"`
+	Rooms        FlexibleStringSlice `json:"rooms"          env:"PICOCLAW_CHANNELS_XMPP_ROOMS"`
+	Nick         string              `json:"nick"           env:"PICOCLAW_CHANNELS_XMPP_NICK"`
+	MentionOnly  bool                `json:"mention_only"   env:"PICOCLAW_CHANNELS_XMPP_MENTION_ONLY"`
+	JoinOnInvite bool                `json:"join_on_invite" env:"PICOCLAW_CHANNELS_XMPP_JOIN_ON_INVITE"`
+	AllowFrom    FlexibleStringSlice `json:"allow_from"     env:"PICOCLAW_CHANNELS_XMPP_ALLOW_FROM"`
+}
+
+type MattermostConfig struct {
+	Enabled       bool                `json:"enabled"        env:"PICOCLAW_CHANNELS_MATTERMOST_ENABLED"`
+	URL           string              `json:"url"            env:"PICOCLAW_CHANNELS_MATTERMOST_URL"`
+	Token         string              `json:"token"          env:"PICOCLAW_CHANNELS_MATTERMOST_TOKEN"`
+	Channels      FlexibleStringSlice `json:"channels"       env:"PICOCLAW_CHANNELS_MATTERMOST_CHANNELS"`
+	MentionOnly   bool                `json:"mention_only"   env:"PICOCLAW_CHANNELS_MATTERMOST_MENTION_ONLY"`
+	ThreadReplies bool                `json:"thread_replies" env:"PICOCLAW_CHANNELS_MATTERMOST_THREAD_REPLIES"`
+	AllowFrom     FlexibleStringSlice `json:"allow_from"     env:"PICOCLAW_CHANNELS_MATTERMOST_ALLOW_FROM"`
+}
+
+type RocketChatConfig struct {
+	Enabled       bool                `json:"enabled"        env:"PICOCLAW_CHANNELS_ROCKETCHAT_ENABLED"`
+	URL           string              `json:"url"            env:"PICOCLAW_CHANNELS_ROCKETCHAT_URL"`
+	UserID        string              `json:"user_id"        env:"PICOCLAW_CHANNELS_ROCKETCHAT_USER_ID"`
+	Token         string              `json:"token"          env:"PICOCLAW_CHANNELS_ROCKETCHAT_TOKEN"`
+	Channels      FlexibleStringSlice `json:"channels"       env:"PICOCLAW_CHANNELS_ROCKETCHAT_CHANNELS"`
+	MentionOnly   bool                `json:"mention_only"   env:"PICOCLAW_CHANNELS_ROCKETCHAT_MENTION_ONLY"`
+	ThreadReplies bool                `json:"thread_replies" env:"PICOCLAW_CHANNELS_ROCKETCHAT_THREAD_REPLIES"`
+	AllowFrom     FlexibleStringSlice `json:"allow_from"     env:"PICOCLAW_CHANNELS_ROCKETCHAT_ALLOW_FROM"`
+}
+
+// VoiceConfig drives the local voice assistant. Audio devices, the wake word
+// engine and local TTS are external commands, so any backend that can speak
+// raw 16 kHz mono PCM or WAV over stdin/stdout can be plugged in.
+type VoiceConfig struct {
+	Enabled             bool    `json:"enabled"               env:"PICOCLAW_CHANNELS_VOICE_ENABLED"`
+	InputCommand        string  `json:"input_command"         env:"PICOCLAW_CHANNELS_VOICE_INPUT_COMMAND"`
+	OutputCommand       string  `json:"output_command"        env:"PICOCLAW_CHANNELS_VOICE_OUTPUT_COMMAND"`
+	WakeWordCommand     string  `json:"wake_word_command"     env:"PICOCLAW_CHANNELS_VOICE_WAKE_WORD_COMMAND"` // empty: any speech starts a request
+	SilenceThreshold    float64 `json:"silence_threshold"     env:"PICOCLAW_CHANNELS_VOICE_SILENCE_THRESHOLD"`
+	SilenceMS           int     `json:"silence_ms"            env:"PICOCLAW_CHANNELS_VOICE_SILENCE_MS"`
+	MaxUtteranceSeconds int     `json:"max_utterance_seconds" env:"PICOCLAW_CHANNELS_VOICE_MAX_UTTERANCE_SECONDS"`
+	TTSCommand          string  `json:"tts_command"           env:"PICOCLAW_CHANNELS_VOICE_TTS_COMMAND"`
+	TTSAPIBase          string  `json:"tts_api_base"          env:"PICOCLAW_CHANNELS_VOICE_TTS_API_BASE"`
+	TTSAPIKey           string  `json:"tts_api_key"           env:"PICOCLAW_CHANNELS_VOICE_TTS_API_KEY"`
+	TTSModel            string  `json:"tts_model"             env:"PICOCLAW_CHANNELS_VOICE_TTS_MODEL"`
+	TTSVoice            string  `json:"tts_voice"             env:"PICOCLAW_CHANNELS_VOICE_TTS_VOICE"`
+}
+
+type MQTTConfig struct {
+	Enabled  bool              `json:"enabled"   env:"PICOCLAW_CHANNELS_MQTT_ENABLED"`
+	Broker   string            `json:"broker"    env:"PICOCLAW_CHANNELS_MQTT_BROKER"` // tcp://, ssl:// or ws:// URL
+	ClientID string            `json:"client_id" env:"PICOCLAW_CHANNELS_MQTT_CLIENT_ID"`
+	Username string            `json:"username"  env:"PICOCLAW_CHANNELS_MQTT_USERNAME"`
+	Password string            `json:"password"  env:"PICOCLAW_CHANNELS_MQTT_PASSWORD"`
+	Topics   []MQTTTopicConfig `json:"topics"`
+}
+
+// MQTTTopicConfig is one subscription. ResponseTopic may contain "{topic}",
+// which is replaced by the topic the triggering message arrived on; when it
+// is empty, replies are only published if the payload names a reply_to topic.
+type MQTTTopicConfig struct {
+	Topic         string `json:"topic"`
+	QoS           byte   `json:"qos"`
+	ResponseTopic string `json:"response_topic"`
+}
+
+// NostrConfig is a Nostr identity that takes NIP-04 direct messages on the
+// given relays. PrivateKey is an nsec or hex key; AllowFrom takes npubs or
+// hex public keys.
+type NostrConfig struct {
+	Enabled    bool                `json:"enabled"     env:"PICOCLAW_CHANNELS_NOSTR_ENABLED"`
+	PrivateKey string              `json:"private_key" env:"PICOCLAW_CHANNELS_NOSTR_PRIVATE_KEY"`
+	Relays     FlexibleStringSlice `json:"relays"      env:"PICOCLAW_CHANNELS_NOSTR_RELAYS"`
+	AllowFrom  FlexibleStringSlice `json:"allow_from"  env:"PICOCLAW_CHANNELS_NOSTR_ALLOW_FROM"`
+}
+
+// SMSConfig sends and receives text messages through Twilio (Provider
+// "twilio") or a GSM modem on a serial port (Provider "modem").
+type SMSConfig struct {
+	Enabled          bool                `json:"enabled"            env:"PICOCLAW_CHANNELS_SMS_ENABLED"`
+	Provider         string              `json:"provider"           env:"PICOCLAW_CHANNELS_SMS_PROVIDER"`
+	MaxMessages      int                 `json:"max_messages"       env:"PICOCLAW_CHANNELS_SMS_MAX_MESSAGES"` // replies longer than this many SMS are cut
+	TwilioAccountSID string              `json:"twilio_account_sid" env:"PICOCLAW_CHANNELS_SMS_TWILIO_ACCOUNT_SID"`
+	TwilioAuthToken  string              `json:"twilio_auth_token"  env:"PICOCLAW_CHANNELS_SMS_TWILIO_AUTH_TOKEN"`
+	TwilioFrom       string              `json:"twilio_from"        env:"PICOCLAW_CHANNELS_SMS_TWILIO_FROM"`
+	WebhookHost      string              `json:"webhook_host"       env:"PICOCLAW_CHANNELS_SMS_WEBHOOK_HOST"`
+	WebhookPort      int                 `json:"webhook_port"       env:"PICOCLAW_CHANNELS_SMS_WEBHOOK_PORT"`
+	WebhookPath      string              `json:"webhook_path"       env:"PICOCLAW_CHANNELS_SMS_WEBHOOK_PATH"`
+	WebhookURL       string              `json:"webhook_url"        env:"PICOCLAW_CHANNELS_SMS_WEBHOOK_URL"` // public URL configured in Twilio, used to check signatures
+	ModemDevice      string              `json:"modem_device"       env:"PICOCLAW_CHANNELS_SMS_MODEM_DEVICE"`
+	ModemBaudRate    int                 `json:"modem_baud_rate"    env:"PICOCLAW_CHANNELS_SMS_MODEM_BAUD_RATE"`
+	ModemPollSeconds int                 `json:"modem_poll_seconds" env:"PICOCLAW_CHANNELS_SMS_MODEM_POLL_SECONDS"`
+	AllowFrom        FlexibleStringSlice `json:"allow_from"         env:"PICOCLAW_CHANNELS_SMS_ALLOW_FROM"`
+}
+
+// AttachmentsConfig limits and places the files that travel with messages.
+// Downloads are deleted RetentionMinutes after they arrive.
+type AttachmentsConfig struct {
+	MaxSizeMB        int    `json:"max_size_mb"       env:"PICOCLAW_CHANNELS_ATTACHMENTS_MAX_SIZE_MB"`
+	RetentionMinutes int    `json:"retention_minutes" env:"PICOCLAW_CHANNELS_ATTACHMENTS_RETENTION_MINUTES"`
+	Dir              string `json:"dir"               env:"PICOCLAW_CHANNELS_ATTACHMENTS_DIR"` // default: <workspace>/attachments
+}
+
+// MediaDir returns the expanded attachment directory, or "" for the default.
+func (c AttachmentsConfig) MediaDir() string {
+	if c.Dir == "" {
+		return ""
+	}
+	return expandHome(c.Dir)
+}
+
+// PresenceConfig shows users that the agent is working: a typing indicator
+// for the whole run, and a reaction on their message while tools run that is
+// replaced by DoneEmoji or ErrorEmoji at the end.
+type PresenceConfig struct {
+	Typing       bool   `json:"typing"        env:"PICOCLAW_CHANNELS_PRESENCE_TYPING"`
+	Reactions    bool   `json:"reactions"     env:"PICOCLAW_CHANNELS_PRESENCE_REACTIONS"`
+	WorkingEmoji string `json:"working_emoji" env:"PICOCLAW_CHANNELS_PRESENCE_WORKING_EMOJI"`
+	DoneEmoji    string `json:"done_emoji"    env:"PICOCLAW_CHANNELS_PRESENCE_DONE_EMOJI"`
+	ErrorEmoji   string `json:"error_emoji"   env:"PICOCLAW_CHANNELS_PRESENCE_ERROR_EMOJI"`
+}
+
+// BroadcastConfig controls announcements sent to many chats at once.
+// Targets are "channel:chat_id"; IntervalMS spaces out the sends so a long
+// list does not trip platform rate limits.
+type BroadcastConfig struct {
+	Targets    FlexibleStringSlice `json:"targets"     env:"PICOCLAW_CHANNELS_BROADCAST_TARGETS"`
+	IntervalMS int                 `json:"interval_ms" env:"PICOCLAW_CHANNELS_BROADCAST_INTERVAL_MS"`
+}
+
+// OutboundRetryConfig keeps replies that failed to send in a queue on disk
+// and retries them with exponential backoff, so they survive restarts. After
+// MaxAttempts a message is moved to the dead-letter file.
+type OutboundRetryConfig struct {
+	Enabled               bool `json:"enabled"                 env:"PICOCLAW_CHANNELS_RETRY_ENABLED"`
+	MaxAttempts           int  `json:"max_attempts"            env:"PICOCLAW_CHANNELS_RETRY_MAX_ATTEMPTS"`
+	InitialBackoffSeconds int  `json:"initial_backoff_seconds" env:"PICOCLAW_CHANNELS_RETRY_INITIAL_BACKOFF_SECONDS"`
+	MaxBackoffSeconds     int  `json:"max_backoff_seconds"     env:"PICOCLAW_CHANNELS_RETRY_MAX_BACKOFF_SECONDS"`
+}
+
 type HeartbeatConfig struct {
-	Enabled  bool `json:"enabled"  env:"PICOCLAW_HEARTBEAT_ENABLED"`
-	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
+	Enabled  bool         `json:"enabled"          env:"PICOCLAW_HEARTBEAT_ENABLED"`
+	Interval int          `json:"interval"         env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
+	Digest   DigestConfig `json:"digest,omitempty"`
+}
+
+// DigestConfig has the agent send a digest to one chat on a schedule:
+// what is scheduled next, what yesterday cost, how the gateway is doing
+// and what it recently remembered. The agent writes it from those facts
+// with only the tools in Tools, and stops once its requests cost
+// MaxCostUSD.
+type DigestConfig struct {
+	Enabled bool   `json:"enabled"            env:"PICOCLAW_HEARTBEAT_DIGEST_ENABLED"`
+	Channel string `json:"channel"            env:"PICOCLAW_HEARTBEAT_DIGEST_CHANNEL"`
+	ChatID  string `json:"chat_id"            env:"PICOCLAW_HEARTBEAT_DIGEST_CHAT_ID"`
+	// Schedule is when the digest is sent, in words as the cron tool
+	// takes them ("every day at 8", "mondays at 9"); Timezone is the
+	// IANA zone it is read in, the gateway's when empty.
+	Schedule string `json:"schedule,omitempty"  env:"PICOCLAW_HEARTBEAT_DIGEST_SCHEDULE"`
+	Timezone string `json:"timezone,omitempty"  env:"PICOCLAW_HEARTBEAT_DIGEST_TIMEZONE"`
+	// Sections are what the digest covers, of DigestSections; all of
+	// them when empty.
+	Sections []string `json:"sections,omitempty"`
+	// Prompt is added to the instructions, e.g. "Keep it under 10 lines."
+	Prompt  string `json:"prompt,omitempty"`
+	Persona string `json:"persona,omitempty"` // the default agent when empty
+	// Tools are the only tools the agent may use; none when empty.
+	Tools      []string `json:"tools,omitempty"`
+	MaxCostUSD float64  `json:"max_cost_usd,omitempty" env:"PICOCLAW_HEARTBEAT_DIGEST_MAX_COST_USD"` // 0 = no cap
+}
+
+// DigestSections are the parts a digest may cover.
+var DigestSections = []string{"reminders", "usage", "health", "memories"}
+
+// ValidateDigest checks the digest settings.
+func (c *Config) ValidateDigest() error {
+	d := c.Heartbeat.Digest
+	if !d.Enabled {
+		return nil
+	}
+	for _, s := range d.Sections {
+		if !slices.Contains(DigestSections, s) {
+			return fmt.Errorf("heartbeat.digest: section %q is not one of %s", s, strings.Join(DigestSections, ", "))
+		}
+	}
+	switch {
+	case d.Channel == "" || d.ChatID == "":
+		return fmt.Errorf("heartbeat.digest: channel and chat_id are needed")
+	case d.Persona != "" && !c.knownAgent(d.Persona):
+		return fmt.Errorf("heartbeat.digest: persona %q is not in agents.list", d.Persona)
+	case d.MaxCostUSD < 0:
+		return fmt.Errorf("heartbeat.digest: max_cost_usd must not be negative")
+	}
+	if _, err := d.ParseSchedule(time.Now()); err != nil {
+		return fmt.Errorf("heartbeat.digest: %w", err)
+	}
+	return nil
+}
+
+// ParseSchedule reads the schedule of the digest in its time zone.
+func (d DigestConfig) ParseSchedule(now time.Time) (cron.CronSchedule, error) {
+	loc := time.Local
+	if d.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(d.Timezone); err != nil {
+			return cron.CronSchedule{}, fmt.Errorf("timezone: %w", err)
+		}
+	}
+	schedule, err := cron.ParseSchedule(d.Schedule, loc, now)
+	if err != nil {
+		return cron.CronSchedule{}, fmt.Errorf("schedule: %w", err)
+	}
+	if schedule.Kind == "at" {
+		return cron.CronSchedule{}, fmt.Errorf("schedule: %q runs once, the digest needs a repeating schedule", d.Schedule)
+	}
+	return schedule, nil
+}
+
+// MemoryConfig controls what agents do with their long-term memory on
+// their own.
+type MemoryConfig struct {
+	Consolidation ConsolidationConfig `json:"consolidation,omitempty"`
+}
+
+// ConsolidationConfig has every agent periodically review its recent
+// conversations, remember the durable facts in them and forget remembered
+// facts that no longer hold. With RequireApproval the changes wait for
+// /memories approve instead of being written.
+type ConsolidationConfig struct {
+	Enabled         bool   `json:"enabled"                    env:"PICOCLAW_MEMORY_CONSOLIDATION_ENABLED"`
+	IntervalHours   int    `json:"interval_hours,omitempty"   env:"PICOCLAW_MEMORY_CONSOLIDATION_INTERVAL_HOURS"` // 0 = 24
+	Model           string `json:"model,omitempty"            env:"PICOCLAW_MEMORY_CONSOLIDATION_MODEL"`          // "" = the agent's
+	RequireApproval bool   `json:"require_approval,omitempty" env:"PICOCLAW_MEMORY_CONSOLIDATION_REQUIRE_APPROVAL"`
 }
 
+// FixturesConfig records every LLM request and response to a file, or
+// answers requests from such a file instead of the providers, so that runs
+// can be reproduced without network or API keys.
+type FixturesConfig struct {
+	Mode string `json:"mode,omitempty" env:"PICOCLAW_FIXTURES_MODE"` // one of FixtureModes; empty = off
+	Path string `json:"path,omitempty" env:"PICOCLAW_FIXTURES_PATH"` // default: <workspace>/fixtures/llm.jsonl
+}
+
+// FixtureModes are the accepted values of fixtures.mode: record every
+// exchange, replay recorded ones only, or replay what was recorded and
+// record the rest.
+var FixtureModes = []string{"record", "replay", "auto"}
+
+// RuntimeProfiles are the accepted values of runtime_profile. The
+// "low-resource" profile suits boards with 256 to 512 MB of memory, see
+// applyLowResource; "" is the default.
+var RuntimeProfiles = []string{"default", "low-resource"}
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled"     env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
@@ -406,6 +1085,18 @@ type ModelConfig struct {
 	// Optional optimizations
 	RPM            int    `json:"rpm,omitempty"`              // Requests per minute limit
 	MaxTokensField string `json:"max_tokens_field,omitempty"` // Field name for max tokens (e.g., "max_completion_tokens")
+	ContextWindow  int    `json:"context_window,omitempty"`   // Prompt + output tokens the model takes, if not in the built-in table
+	ToolMode       string `json:"tool_mode,omitempty"`        // one of ToolModes; "text" for models without function calling
+
+	// Gemini harm category -> block threshold, e.g. "harassment": "only_high"
+	SafetySettings map[string]string `json:"safety_settings,omitempty"`
+
+	// OpenRouter provider preferences and fallback models
+	OpenRouter *OpenRouterConfig `json:"openrouter,omitempty"`
+
+	// Cloud platforms
+	APIVersion string `json:"api_version,omitempty"` // Azure OpenAI API version
+	Region     string `json:"region,omitempty"`      // AWS region for Bedrock
 }
 
 // Validate checks if the ModelConfig has all required fields.
@@ -416,12 +1107,605 @@ func (c *ModelConfig) Validate() error {
 	if c.Model == "" {
 		return fmt.Errorf("model is required")
 	}
+	if c.ToolMode != "" && !slices.Contains(ToolModes, c.ToolMode) {
+		return fmt.Errorf("tool_mode %q is not one of %s", c.ToolMode, strings.Join(ToolModes, ", "))
+	}
+	if c.OpenRouter != nil {
+		protocol, _, _ := strings.Cut(c.Model, "/")
+		if protocol != "openrouter" && !strings.Contains(c.APIBase, "openrouter.ai") {
+			return fmt.Errorf("openrouter is set for a %s model", protocol)
+		}
+		return c.OpenRouter.validate()
+	}
+	return nil
+}
+
+// OpenRouterConfig asks OpenRouter to route a model_list entry: Provider
+// picks and orders the providers that may serve the model, and Fallbacks
+// are models OpenRouter tries, in order, when the model fails.
+type OpenRouterConfig struct {
+	Provider  *OpenRouterProviderPrefs `json:"provider,omitempty"`
+	Fallbacks []string                 `json:"fallbacks,omitempty"`
+}
+
+// OpenRouterProviderPrefs are OpenRouter's provider routing preferences,
+// sent as they are.
+type OpenRouterProviderPrefs struct {
+	Order             []string `json:"order,omitempty"`           // providers to try first, by slug
+	Only              []string `json:"only,omitempty"`            // providers allowed at all
+	Ignore            []string `json:"ignore,omitempty"`          // providers never used
+	AllowFallbacks    *bool    `json:"allow_fallbacks,omitempty"` // false: fail rather than leave Order
+	Sort              string   `json:"sort,omitempty"`            // one of OpenRouterSorts
+	DataCollection    string   `json:"data_collection,omitempty"` // "deny" skips providers that keep prompts
+	RequireParameters bool     `json:"require_parameters,omitempty"`
+}
+
+// OpenRouterSorts are the accepted values of openrouter.provider.sort.
+var OpenRouterSorts = []string{"price", "throughput", "latency"}
+
+func (c *OpenRouterConfig) validate() error {
+	if p := c.Provider; p != nil {
+		if p.Sort != "" && !slices.Contains(OpenRouterSorts, p.Sort) {
+			return fmt.Errorf("openrouter.provider.sort %q is not one of %s", p.Sort, strings.Join(OpenRouterSorts, ", "))
+		}
+		if p.DataCollection != "" && p.DataCollection != "allow" && p.DataCollection != "deny" {
+			return fmt.Errorf("openrouter.provider.data_collection %q is not allow or deny", p.DataCollection)
+		}
+	}
+	if slices.Contains(c.Fallbacks, "") {
+		return fmt.Errorf("openrouter.fallbacks has an empty model")
+	}
 	return nil
 }
 
+// ToolModes are the accepted values of tool_mode: tools offered through
+// the API's function calling, or described in the prompt and parsed from
+// the model's text.
+var ToolModes = []string{"native", "text"}
+
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host         string             `json:"host"  env:"PICOCLAW_GATEWAY_HOST"`
+	Port         int                `json:"port"  env:"PICOCLAW_GATEWAY_PORT"`
+	Queue        QueueConfig        `json:"queue"`
+	Supervisor   SupervisorConfig   `json:"supervisor"`
+	GroupBatches GroupBatchesConfig `json:"group_batches"`
+	Coordination CoordinationConfig `json:"coordination,omitempty"`
+	Admin        AdminConfig        `json:"admin,omitempty"`
+	Flags        FlagsConfig        `json:"flags,omitempty"`
+	Language     LanguageConfig     `json:"language,omitempty"`
+	Shutdown     ShutdownConfig     `json:"shutdown"`
+	Watchdog     WatchdogConfig     `json:"watchdog"`
+	DND          DNDConfig          `json:"dnd,omitempty"`
+	Log          LogConfig          `json:"log,omitempty"`
+	Crash        CrashConfig        `json:"crash,omitempty"`
+	Budget       BudgetConfig       `json:"budget"`
+	Analytics    AnalyticsConfig    `json:"analytics,omitempty"`
+	// SelfReportMinutes is how often the gateway records a "self_report"
+	// run event with its memory, goroutines, open files and store sizes;
+	// 0 turns it off.
+	SelfReportMinutes int `json:"self_report_minutes" env:"PICOCLAW_GATEWAY_SELF_REPORT_MINUTES"`
+}
+
+// ShutdownConfig sets how the gateway stops. On SIGTERM it starts no new
+// runs and gives those running or queued DrainTimeoutSeconds to finish;
+// messages that arrive meanwhile, those still queued and replies not yet
+// sent are kept and handled after the next start. With Handoff, SIGUSR2
+// restarts the gateway without closing its listening sockets: a new
+// process of the binary takes them over and serves while this one drains.
+type ShutdownConfig struct {
+	DrainTimeoutSeconds int  `json:"drain_timeout_seconds" env:"PICOCLAW_GATEWAY_SHUTDOWN_DRAIN_TIMEOUT_SECONDS"`
+	Handoff             bool `json:"handoff"               env:"PICOCLAW_GATEWAY_SHUTDOWN_HANDOFF"`
+}
+
+func (c ShutdownConfig) Validate() error {
+	if c.DrainTimeoutSeconds < 0 || c.DrainTimeoutSeconds > 3600 {
+		return fmt.Errorf("gateway.shutdown: drain_timeout_seconds must be between 0 and 3600")
+	}
+	return nil
+}
+
+// WatchdogConfig bounds how long an answer to a message may run. A run
+// still going after RunTimeoutSeconds, or waiting on one tool call for
+// ToolTimeoutSeconds, is cancelled, its chat is told and a "timeout" run
+// event names the stage it was stuck in. 0 turns a limit off.
+type WatchdogConfig struct {
+	RunTimeoutSeconds  int `json:"run_timeout_seconds"  env:"PICOCLAW_GATEWAY_WATCHDOG_RUN_TIMEOUT_SECONDS"`
+	ToolTimeoutSeconds int `json:"tool_timeout_seconds" env:"PICOCLAW_GATEWAY_WATCHDOG_TOOL_TIMEOUT_SECONDS"`
+}
+
+func (c WatchdogConfig) Validate() error {
+	if c.RunTimeoutSeconds < 0 || c.ToolTimeoutSeconds < 0 {
+		return fmt.Errorf("gateway.watchdog: timeouts must not be negative")
+	}
+	return nil
+}
+
+// DNDConfig holds back proactive messages, those of cron jobs, heartbeats,
+// digests and workflows, while the user is busy: in the minutes matched by
+// a Focus cron expression, e.g. "* 9-10 * * 1-5" for 9:00 to 10:59 on
+// weekdays, read in Timezone; during the events of the iCalendar feed
+// Calendar, a URL or file, read every RefreshMinutes; or after /dnd on.
+// Mode "defer" sends them when the busy time ends, "suppress" drops them.
+// Urgent alerts still go out right away on UrgentChannels.
+type DNDConfig struct {
+	Enabled        bool     `json:"enabled"                   env:"PICOCLAW_GATEWAY_DND_ENABLED"`
+	Mode           string   `json:"mode,omitempty"            env:"PICOCLAW_GATEWAY_DND_MODE"` // one of DNDModes, "defer" when empty
+	Timezone       string   `json:"timezone,omitempty"        env:"PICOCLAW_GATEWAY_DND_TIMEZONE"`
+	Focus          []string `json:"focus,omitempty"`
+	Calendar       string   `json:"calendar,omitempty"        env:"PICOCLAW_GATEWAY_DND_CALENDAR"`
+	RefreshMinutes int      `json:"refresh_minutes,omitempty" env:"PICOCLAW_GATEWAY_DND_REFRESH_MINUTES"` // 0 = 15
+	UrgentChannels []string `json:"urgent_channels,omitempty"`
+}
+
+// DNDModes are what do-not-disturb does with a proactive message.
+var DNDModes = []string{"defer", "suppress"}
+
+func (c DNDConfig) Validate() error {
+	if c.Mode != "" && !slices.Contains(DNDModes, c.Mode) {
+		return fmt.Errorf("gateway.dnd: mode %q is not one of %s", c.Mode, strings.Join(DNDModes, ", "))
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("gateway.dnd: timezone: %w", err)
+		}
+	}
+	for _, expr := range c.Focus {
+		if !gronx.New().IsValid(expr) {
+			return fmt.Errorf("gateway.dnd: focus %q is not a cron expression", expr)
+		}
+	}
+	if c.RefreshMinutes < 0 {
+		return fmt.Errorf("gateway.dnd: refresh_minutes must not be negative")
+	}
+	return nil
+}
+
+// LogConfig sets what the gateway logs and how. Level applies to every
+// component not in Components, which maps a component such as "channels"
+// or "agent" to its own level; /loglevel changes both while running.
+// Format is how the console gets entries, "console" lines or "json".
+// --debug sets Level to debug. The latest KeepRecent entries logged are
+// kept in memory for /logs and the admin API; 0 keeps none.
+type LogConfig struct {
+	Level      string            `json:"level,omitempty"  env:"PICOCLAW_GATEWAY_LOG_LEVEL"`  // one of LogLevels, "info" when empty
+	Format     string            `json:"format,omitempty" env:"PICOCLAW_GATEWAY_LOG_FORMAT"` // one of LogFormats, "console" when empty
+	Components map[string]string `json:"components,omitempty"`
+	KeepRecent int               `json:"keep_recent"      env:"PICOCLAW_GATEWAY_LOG_KEEP_RECENT"`
+}
+
+// LogLevels and LogFormats are the levels and console formats of the log.
+var (
+	LogLevels  = []string{"debug", "info", "warn", "error"}
+	LogFormats = []string{"console", "json"}
+)
+
+func (c LogConfig) Validate() error {
+	if c.Level != "" && !slices.Contains(LogLevels, c.Level) {
+		return fmt.Errorf("gateway.log: level %q is not one of %s", c.Level, strings.Join(LogLevels, ", "))
+	}
+	if c.Format != "" && !slices.Contains(LogFormats, c.Format) {
+		return fmt.Errorf("gateway.log: format %q is not one of %s", c.Format, strings.Join(LogFormats, ", "))
+	}
+	for component, level := range c.Components {
+		if !slices.Contains(LogLevels, level) {
+			return fmt.Errorf("gateway.log: level %q of %s is not one of %s", level, component, strings.Join(LogLevels, ", "))
+		}
+	}
+	if c.KeepRecent < 0 || c.KeepRecent > 100000 {
+		return fmt.Errorf("gateway.log: keep_recent must be between 0 and 100000")
+	}
+	return nil
+}
+
+// CrashConfig sets what happens when a run panics. The run ends with an
+// error instead of taking the gateway down, and a crash report with the
+// stacks of all goroutines, the run's latest tool calls and its redacted
+// context is written to state/crashes, of which the newest Keep are kept.
+// The report is also posted as JSON to WebhookURL when set.
+type CrashConfig struct {
+	Keep       int    `json:"keep"                  env:"PICOCLAW_GATEWAY_CRASH_KEEP"` // 0 = 20
+	WebhookURL string `json:"webhook_url,omitempty" env:"PICOCLAW_GATEWAY_CRASH_WEBHOOK_URL"`
+}
+
+func (c CrashConfig) Validate() error {
+	if c.Keep < 0 || c.Keep > 1000 {
+		return fmt.Errorf("gateway.crash: keep must be between 0 and 1000")
+	}
+	if c.WebhookURL != "" {
+		if u, err := url.Parse(c.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("gateway.crash: webhook_url %q is not an http(s) URL", c.WebhookURL)
+		}
+	}
+	return nil
+}
+
+// BudgetConfig caps how much of the machine picoclaw uses at once. Every
+// agent run, for a chat as well as for a cron job, heartbeat, trigger or
+// workflow, takes a run slot, and every command a tool starts takes a
+// subprocess slot; what finds none free waits in line. Unless MaxRuns and
+// MaxSubprocesses are set, the slots follow from CPUs and MemoryMB, by
+// default the machine's, and the memory one run or command is expected to
+// take. With NotifyQueued a user whose message has to wait is told their
+// place in the line. There is no cap on browser instances, since there is
+// no browser tool.
+type BudgetConfig struct {
+	CPUs               int  `json:"cpus"                 env:"PICOCLAW_GATEWAY_BUDGET_CPUS"`                 // 0 = all
+	MemoryMB           int  `json:"memory_mb"            env:"PICOCLAW_GATEWAY_BUDGET_MEMORY_MB"`            // 0 = all
+	RunMemoryMB        int  `json:"run_memory_mb"        env:"PICOCLAW_GATEWAY_BUDGET_RUN_MEMORY_MB"`        // 0 = 32
+	SubprocessMemoryMB int  `json:"subprocess_memory_mb" env:"PICOCLAW_GATEWAY_BUDGET_SUBPROCESS_MEMORY_MB"` // 0 = 64
+	MaxRuns            int  `json:"max_runs"             env:"PICOCLAW_GATEWAY_BUDGET_MAX_RUNS"`             // 0 = from the budget
+	MaxSubprocesses    int  `json:"max_subprocesses"     env:"PICOCLAW_GATEWAY_BUDGET_MAX_SUBPROCESSES"`     // 0 = from the budget
+	NotifyQueued       bool `json:"notify_queued"        env:"PICOCLAW_GATEWAY_BUDGET_NOTIFY_QUEUED"`
+}
+
+func (c BudgetConfig) Validate() error {
+	for name, v := range map[string]int{
+		"cpus": c.CPUs, "memory_mb": c.MemoryMB, "run_memory_mb": c.RunMemoryMB,
+		"subprocess_memory_mb": c.SubprocessMemoryMB, "max_runs": c.MaxRuns, "max_subprocesses": c.MaxSubprocesses,
+	} {
+		if v < 0 {
+			return fmt.Errorf("gateway.budget: %s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// Slots returns how many agent runs and tool subprocesses may run at
+// once. Runs mostly wait on LLM requests, so four fit on a CPU; commands
+// get one each. Both are limited by the memory they are expected to take
+// and are at least 1. cpus and memoryMB are the machine's, used where the
+// budget leaves them 0; a memoryMB of 0 means unknown.
+func (c BudgetConfig) Slots(cpus, memoryMB int) (runs, subprocesses int) {
+	if c.CPUs > 0 {
+		cpus = c.CPUs
+	}
+	if c.MemoryMB > 0 {
+		memoryMB = c.MemoryMB
+	}
+	runMB, subprocessMB := c.RunMemoryMB, c.SubprocessMemoryMB
+	if runMB <= 0 {
+		runMB = 32
+	}
+	if subprocessMB <= 0 {
+		subprocessMB = 64
+	}
+
+	runs, subprocesses = 4*max(cpus, 1), max(cpus, 1)
+	if memoryMB > 0 {
+		runs = min(runs, memoryMB/runMB)
+		subprocesses = min(subprocesses, memoryMB/subprocessMB)
+	}
+	if c.MaxRuns > 0 {
+		runs = c.MaxRuns
+	}
+	if c.MaxSubprocesses > 0 {
+		subprocesses = c.MaxSubprocesses
+	}
+	return max(runs, 1), max(subprocesses, 1)
+}
+
+// LanguageConfig sets the language of the messages picoclaw itself sends,
+// such as command replies and errors: "en", "de", "fr" or "zh". A sender
+// who set a locale with /language or /profile locale gets theirs; other
+// messages go out in the chat's language from Chats, keyed
+// "channel:chat_id", or else in Default.
+type LanguageConfig struct {
+	Default string            `json:"default,omitempty" env:"PICOCLAW_GATEWAY_LANGUAGE_DEFAULT"`
+	Chats   map[string]string `json:"chats,omitempty"`
+}
+
+func (c LanguageConfig) Validate() error {
+	if c.Default != "" && i18n.Lang(c.Default) == "" {
+		return fmt.Errorf("gateway.language: default %q is not one of %s", c.Default, strings.Join(i18n.Languages, ", "))
+	}
+	for chat, lang := range c.Chats {
+		if channel, id, ok := strings.Cut(chat, ":"); !ok || channel == "" || id == "" {
+			return fmt.Errorf("gateway.language: chat %q is not channel:chat_id", chat)
+		}
+		if i18n.Lang(lang) == "" {
+			return fmt.Errorf("gateway.language: %s: %q is not one of %s", chat, lang, strings.Join(i18n.Languages, ", "))
+		}
+	}
+	return nil
+}
+
+// PluginsConfig sets which plugins picoclaw plugin install accepts
+// without a checksum: those whose archive is signed with one of
+// TrustedKeys, base64 ed25519 public keys.
+type PluginsConfig struct {
+	TrustedKeys FlexibleStringSlice `json:"trusted_keys,omitempty" env:"PICOCLAW_PLUGINS_TRUSTED_KEYS"`
+}
+
+func (c PluginsConfig) Validate() error {
+	for _, k := range c.TrustedKeys {
+		if key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(k)); err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("plugins: trusted key %q is not a base64 ed25519 public key", k)
+		}
+	}
+	return nil
+}
+
+// UpdateConfig sets where picoclaw update looks for releases and which
+// it installs: those signed with one of TrustedKeys, base64 ed25519
+// public keys.
+type UpdateConfig struct {
+	FeedURL     string              `json:"feed_url,omitempty"     env:"PICOCLAW_UPDATE_FEED_URL"`
+	TrustedKeys FlexibleStringSlice `json:"trusted_keys,omitempty" env:"PICOCLAW_UPDATE_TRUSTED_KEYS"`
+	// HealthTimeoutSeconds is how long the restarted gateway has to
+	// become ready before the update is rolled back; 0 = 60.
+	HealthTimeoutSeconds int `json:"health_timeout_seconds,omitempty" env:"PICOCLAW_UPDATE_HEALTH_TIMEOUT_SECONDS"`
+}
+
+func (c UpdateConfig) Validate() error {
+	for _, k := range c.TrustedKeys {
+		if key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(k)); err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("update: trusted key %q is not a base64 ed25519 public key", k)
+		}
+	}
+	if c.HealthTimeoutSeconds < 0 {
+		return fmt.Errorf("update: health_timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// HealthTimeout is how long the gateway has to become ready after an
+// update.
+func (c UpdateConfig) HealthTimeout() time.Duration {
+	if c.HealthTimeoutSeconds <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(c.HealthTimeoutSeconds) * time.Second
+}
+
+// FlagsConfig holds the kill switches the gateway starts with. An admin
+// can flip each of them at runtime with /flags, which overrides the
+// setting here until /flags reset.
+type FlagsConfig struct {
+	// DisabledTools are tools no agent may use, by name, e.g. "exec".
+	DisabledTools FlexibleStringSlice `json:"disabled_tools,omitempty"  env:"PICOCLAW_GATEWAY_FLAGS_DISABLED_TOOLS"`
+	// PausedChannels are channels whose messages are not answered, e.g.
+	// "telegram" or "telegram@work". Admin chats are still answered.
+	PausedChannels FlexibleStringSlice `json:"paused_channels,omitempty" env:"PICOCLAW_GATEWAY_FLAGS_PAUSED_CHANNELS"`
+	// ReadOnly leaves agents only the tools that change nothing: reading
+	// files and the board's sensors, searching and fetching the web, and
+	// sending messages.
+	ReadOnly bool `json:"read_only,omitempty" env:"PICOCLAW_GATEWAY_FLAGS_READ_ONLY"`
+	// NoProactive keeps cron jobs and the heartbeat from running, so the
+	// agent only speaks when spoken to.
+	NoProactive bool `json:"no_proactive,omitempty" env:"PICOCLAW_GATEWAY_FLAGS_NO_PROACTIVE"`
+}
+
+// AnalyticsConfig has the gateway post a summary of the last seven days,
+// as picoclaw analytics shows them, to the admin chat: the supervisor's
+// alert chat, else the first of gateway.admin.chats.
+type AnalyticsConfig struct {
+	WeeklySummary bool `json:"weekly_summary" env:"PICOCLAW_GATEWAY_ANALYTICS_WEEKLY_SUMMARY"`
+	// Schedule is when the summary is posted, in words as the cron tool
+	// takes them; Timezone is the IANA zone it is read in, and the hours
+	// of the summary, the gateway's when empty.
+	Schedule string `json:"schedule,omitempty" env:"PICOCLAW_GATEWAY_ANALYTICS_SCHEDULE"`
+	Timezone string `json:"timezone,omitempty" env:"PICOCLAW_GATEWAY_ANALYTICS_TIMEZONE"`
+}
+
+// ValidateAnalytics checks the analytics settings.
+func (c *Config) ValidateAnalytics() error {
+	a := c.Gateway.Analytics
+	if !a.WeeklySummary {
+		return nil
+	}
+	if _, _, ok := c.AdminChat(); !ok {
+		return fmt.Errorf("gateway.analytics: weekly_summary needs an admin chat, set gateway.supervisor.alert_chat_id or gateway.admin.chats")
+	}
+	if _, err := a.ParseSchedule(time.Now()); err != nil {
+		return fmt.Errorf("gateway.analytics: %w", err)
+	}
+	return nil
+}
+
+// Location returns the time zone of the summary.
+func (a AnalyticsConfig) Location() (*time.Location, error) {
+	if a.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// ParseSchedule reads the schedule of the summary in its time zone.
+func (a AnalyticsConfig) ParseSchedule(now time.Time) (cron.CronSchedule, error) {
+	loc, err := a.Location()
+	if err != nil {
+		return cron.CronSchedule{}, err
+	}
+	schedule, err := cron.ParseSchedule(a.Schedule, loc, now)
+	if err != nil {
+		return cron.CronSchedule{}, fmt.Errorf("schedule: %w", err)
+	}
+	if schedule.Kind == "at" {
+		return cron.CronSchedule{}, fmt.Errorf("schedule: %q runs once, the summary needs a repeating schedule", a.Schedule)
+	}
+	return schedule, nil
+}
+
+// AdminChat returns the chat operator notices go to: the supervisor's
+// alert chat, else the first of gateway.admin.chats.
+func (c *Config) AdminChat() (channel, chatID string, ok bool) {
+	if sup := c.Gateway.Supervisor; sup.AlertChannel != "" && sup.AlertChatID != "" {
+		return sup.AlertChannel, sup.AlertChatID, true
+	}
+	for _, chat := range c.Gateway.Admin.Chats {
+		if channel, chatID, ok := strings.Cut(chat, ":"); ok && channel != "" && chatID != "" {
+			return channel, chatID, true
+		}
+	}
+	return "", "", false
+}
+
+// AdminConfig names the admin chats, where the operator commands such as
+// /status, /reload and /broadcast work, as "channel:chat_id". The
+// supervisor's alert chat is always one of them. A command counts only
+// from one of Senders, as "channel:sender_id", which an admin chat needs,
+// so an admin chat can be a group. Without admin chats the commands work
+// nowhere.
+type AdminConfig struct {
+	Chats   FlexibleStringSlice `json:"chats,omitempty"   env:"PICOCLAW_GATEWAY_ADMIN_CHATS"`
+	Senders FlexibleStringSlice `json:"senders,omitempty" env:"PICOCLAW_GATEWAY_ADMIN_SENDERS"`
+	API     AdminAPIConfig      `json:"api,omitempty"`
+}
+
+// AdminAPIConfig serves the operations of the admin chats over HTTP, for
+// fleet tooling and web frontends, on a port of its own so it is never
+// exposed along with /health. Port 0 turns it off.
+//
+// Every request must carry Token as a bearer token, a client certificate
+// signed by ClientCAFile, or both when both are set. With CertFile and
+// KeyFile the API is served over TLS, which a client CA requires.
+type AdminAPIConfig struct {
+	Host         string `json:"host,omitempty"           env:"PICOCLAW_GATEWAY_ADMIN_API_HOST"`
+	Port         int    `json:"port,omitempty"           env:"PICOCLAW_GATEWAY_ADMIN_API_PORT"`
+	Token        string `json:"token,omitempty"          env:"PICOCLAW_GATEWAY_ADMIN_API_TOKEN"`
+	CertFile     string `json:"cert_file,omitempty"      env:"PICOCLAW_GATEWAY_ADMIN_API_CERT_FILE"`
+	KeyFile      string `json:"key_file,omitempty"       env:"PICOCLAW_GATEWAY_ADMIN_API_KEY_FILE"`
+	ClientCAFile string `json:"client_ca_file,omitempty" env:"PICOCLAW_GATEWAY_ADMIN_API_CLIENT_CA_FILE"`
+}
+
+// Enabled reports whether the admin API is served.
+func (c AdminAPIConfig) Enabled() bool {
+	return c.Port != 0
+}
+
+func (c AdminAPIConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	switch {
+	case c.Port < 0 || c.Port > 65535:
+		return fmt.Errorf("gateway.admin.api: port %d is out of range", c.Port)
+	case c.Token == "" && c.ClientCAFile == "":
+		return fmt.Errorf("gateway.admin.api: set a token or a client_ca_file, the API is not served without authentication")
+	case (c.CertFile == "") != (c.KeyFile == ""):
+		return fmt.Errorf("gateway.admin.api: cert_file and key_file go together")
+	case c.ClientCAFile != "" && c.CertFile == "":
+		return fmt.Errorf("gateway.admin.api: client_ca_file needs cert_file and key_file, client certificates need TLS")
+	}
+	return nil
+}
+
+func (c AdminConfig) Validate() error {
+	for _, entry := range c.Chats {
+		if channel, id, ok := strings.Cut(entry, ":"); !ok || channel == "" || id == "" {
+			return fmt.Errorf("gateway.admin: chat %q is not channel:chat_id", entry)
+		}
+	}
+	for _, entry := range c.Senders {
+		if channel, id, ok := strings.Cut(entry, ":"); !ok || channel == "" || id == "" {
+			return fmt.Errorf("gateway.admin: sender %q is not channel:sender_id", entry)
+		}
+	}
+	return c.API.Validate()
+}
+
+// ValidateAdmin checks gateway.admin and that an admin chat, including the
+// supervisor's alert chat, comes with the senders allowed to use it.
+func (c *Config) ValidateAdmin() error {
+	if err := c.Gateway.Admin.Validate(); err != nil {
+		return err
+	}
+	if _, _, ok := c.AdminChat(); ok && len(c.Gateway.Admin.Senders) == 0 {
+		return fmt.Errorf("gateway.admin: an admin chat is configured but no senders; " +
+			"set senders to the channel:sender_id of the operators, anyone in the chat could run the admin commands otherwise")
+	}
+	return nil
+}
+
+// CoordinationConfig lets several gateways serve the same chats from a
+// shared session store: a chat is handled by one of them at a time, and
+// each cron job run happens on only one. DSN defaults to the session
+// store's when it uses the same backend.
+type CoordinationConfig struct {
+	Backend   string `json:"backend,omitempty"   env:"PICOCLAW_GATEWAY_COORDINATION_BACKEND"`   // "redis" or "postgres"; "" = off
+	DSN       string `json:"dsn,omitempty"       env:"PICOCLAW_GATEWAY_COORDINATION_DSN"`       // redis:// or postgres:// URL
+	Namespace string `json:"namespace,omitempty" env:"PICOCLAW_GATEWAY_COORDINATION_NAMESPACE"` // "" = session.store.namespace
+}
+
+// CoordinationBackends are the values backend accepts.
+var CoordinationBackends = []string{"redis", "postgres"}
+
+// WithDefaults fills DSN and Namespace in from the session store.
+func (c CoordinationConfig) WithDefaults(store SessionStoreConfig) CoordinationConfig {
+	if c.DSN == "" && c.Backend == store.Backend {
+		c.DSN = store.DSN
+	}
+	if c.Namespace == "" {
+		c.Namespace = store.Namespace
+	}
+	return c
+}
+
+// Validate reports a backend that is not known or has no DSN.
+func (c CoordinationConfig) Validate(store SessionStoreConfig) error {
+	switch {
+	case c.Backend == "":
+		return nil
+	case !slices.Contains(CoordinationBackends, c.Backend):
+		return fmt.Errorf("gateway.coordination: backend %q is not one of %s",
+			c.Backend, strings.Join(CoordinationBackends, ", "))
+	case c.WithDefaults(store).DSN == "":
+		return fmt.Errorf("gateway.coordination: the %s backend needs a dsn", c.Backend)
+	}
+	return nil
+}
+
+// GroupBatchesConfig delays non-urgent group messages: each one is
+// acknowledged with AckEmoji right away, and once the group has been quiet
+// for QuietSeconds (or MaxWaitSeconds after the first message) they are
+// answered together in one reply. Direct chats, commands, mentions and
+// messages containing one of UrgentKeywords are handled immediately.
+type GroupBatchesConfig struct {
+	Enabled        bool                `json:"enabled"          env:"PICOCLAW_GATEWAY_GROUP_BATCHES_ENABLED"`
+	QuietSeconds   int                 `json:"quiet_seconds"    env:"PICOCLAW_GATEWAY_GROUP_BATCHES_QUIET_SECONDS"`
+	MaxWaitSeconds int                 `json:"max_wait_seconds" env:"PICOCLAW_GATEWAY_GROUP_BATCHES_MAX_WAIT_SECONDS"`
+	AckEmoji       string              `json:"ack_emoji"        env:"PICOCLAW_GATEWAY_GROUP_BATCHES_ACK_EMOJI"`
+	UrgentKeywords FlexibleStringSlice `json:"urgent_keywords"  env:"PICOCLAW_GATEWAY_GROUP_BATCHES_URGENT_KEYWORDS"`
+}
+
+// SupervisorConfig controls the channel supervisor, which checks every
+// channel's connection and restarts dropped ones with exponential backoff.
+// When AlertChannel and AlertChatID are set, an alert is sent there once a
+// channel has been down for AlertAfterSeconds.
+type SupervisorConfig struct {
+	Enabled              bool   `json:"enabled"                env:"PICOCLAW_GATEWAY_SUPERVISOR_ENABLED"`
+	CheckIntervalSeconds int    `json:"check_interval_seconds" env:"PICOCLAW_GATEWAY_SUPERVISOR_CHECK_INTERVAL_SECONDS"`
+	MaxBackoffSeconds    int    `json:"max_backoff_seconds"    env:"PICOCLAW_GATEWAY_SUPERVISOR_MAX_BACKOFF_SECONDS"`
+	AlertAfterSeconds    int    `json:"alert_after_seconds"    env:"PICOCLAW_GATEWAY_SUPERVISOR_ALERT_AFTER_SECONDS"`
+	AlertChannel         string `json:"alert_channel"          env:"PICOCLAW_GATEWAY_SUPERVISOR_ALERT_CHANNEL"`
+	AlertChatID          string `json:"alert_chat_id"          env:"PICOCLAW_GATEWAY_SUPERVISOR_ALERT_CHAT_ID"`
+}
+
+// QueueConfig controls how inbound messages are scheduled. Messages in one
+// chat are always handled in order; different chats run in parallel up to
+// MaxConcurrency. Once MaxPending messages are waiting, channels are held
+// back until the queue drains.
+type QueueConfig struct {
+	MaxConcurrency int                   `json:"max_concurrency" env:"PICOCLAW_GATEWAY_QUEUE_MAX_CONCURRENCY"`
+	MaxPending     int                   `json:"max_pending"     env:"PICOCLAW_GATEWAY_QUEUE_MAX_PENDING"`
+	Coalesce       bool                  `json:"coalesce"        env:"PICOCLAW_GATEWAY_QUEUE_COALESCE"` // merge messages a user sent while waiting
+	Background     BackgroundQueueConfig `json:"background"`
+}
+
+// BackgroundQueueConfig holds back the LLM requests of scheduled jobs and
+// heartbeats while answers for users are being generated, so they do not
+// compete for rate limits. At most MaxConcurrency of them run at once; one
+// that has waited MaxWaitSeconds goes ahead anyway. ServiceTier is sent
+// with them to OpenAI-compatible APIs, e.g. "flex" for cheaper, slower
+// processing.
+type BackgroundQueueConfig struct {
+	MaxConcurrency int    `json:"max_concurrency"  env:"PICOCLAW_GATEWAY_QUEUE_BACKGROUND_MAX_CONCURRENCY"`
+	MaxWaitSeconds int    `json:"max_wait_seconds" env:"PICOCLAW_GATEWAY_QUEUE_BACKGROUND_MAX_WAIT_SECONDS"`
+	ServiceTier    string `json:"service_tier"     env:"PICOCLAW_GATEWAY_QUEUE_BACKGROUND_SERVICE_TIER"`
 }
 
 type BraveConfig struct {
@@ -460,18 +1744,99 @@ type WebToolsConfig struct {
 
 type CronToolsConfig struct {
 	ExecTimeoutMinutes int `json:"exec_timeout_minutes" env:"PICOCLAW_TOOLS_CRON_EXEC_TIMEOUT_MINUTES"` // 0 means no timeout
+	// CatchUp is what happens to jobs that missed runs while the gateway
+	// was down, one of CronCatchUps: "once" runs them once soon after the
+	// start, "skip" waits for their next run. Jobs may set their own.
+	CatchUp string `json:"catch_up,omitempty" env:"PICOCLAW_TOOLS_CRON_CATCH_UP"`
+	// JitterSeconds delays each run by up to this many seconds, picked at
+	// random, so jobs set for the same minute do not start together.
+	JitterSeconds int `json:"jitter_seconds,omitempty" env:"PICOCLAW_TOOLS_CRON_JITTER_SECONDS"`
+	// MaxConcurrent is how many jobs run at once; 0 means one.
+	MaxConcurrent int `json:"max_concurrent,omitempty" env:"PICOCLAW_TOOLS_CRON_MAX_CONCURRENT"`
+	// AlertAfter is how many runs of a job must fail in a row before the
+	// supervisor's alert chat is told; 0 never tells.
+	AlertAfter int `json:"alert_after,omitempty" env:"PICOCLAW_TOOLS_CRON_ALERT_AFTER"`
+}
+
+// CronCatchUps are the accepted values of tools.cron.catch_up.
+var CronCatchUps = []string{"once", "skip"}
+
+// Validate checks the catch-up policy and the limits.
+func (c CronToolsConfig) Validate() error {
+	switch {
+	case c.CatchUp != "" && !slices.Contains(CronCatchUps, c.CatchUp):
+		return fmt.Errorf("tools.cron: catch_up %q is not one of %s", c.CatchUp, strings.Join(CronCatchUps, ", "))
+	case c.ExecTimeoutMinutes < 0:
+		return fmt.Errorf("tools.cron: exec_timeout_minutes must not be negative")
+	case c.JitterSeconds < 0:
+		return fmt.Errorf("tools.cron: jitter_seconds must not be negative")
+	case c.MaxConcurrent < 0:
+		return fmt.Errorf("tools.cron: max_concurrent must not be negative")
+	case c.AlertAfter < 0:
+		return fmt.Errorf("tools.cron: alert_after must not be negative")
+	}
+	return nil
 }
 
 type ExecConfig struct {
 	EnableDenyPatterns bool     `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
 	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	// Shell runs the commands of the exec tool, one of ExecShells; empty
+	// means sh, or PowerShell on Windows.
+	Shell string `json:"shell,omitempty" env:"PICOCLAW_TOOLS_EXEC_SHELL"`
 }
 
+// ExecShells are the accepted values of tools.exec.shell. "cmd" is only
+// available on Windows.
+var ExecShells = []string{"sh", "bash", "powershell", "pwsh", "cmd"}
+
 type ToolsConfig struct {
-	Web    WebToolsConfig    `json:"web"`
-	Cron   CronToolsConfig   `json:"cron"`
-	Exec   ExecConfig        `json:"exec"`
-	Skills SkillsToolsConfig `json:"skills"`
+	Web         WebToolsConfig        `json:"web"`
+	Cron        CronToolsConfig       `json:"cron"`
+	Exec        ExecConfig            `json:"exec"`
+	Skills      SkillsToolsConfig     `json:"skills"`
+	SendMessage SendMessageToolConfig `json:"send_message"`
+	Device      DeviceToolConfig      `json:"device"`
+}
+
+// DeviceToolConfig sets what the device tool may read and when the
+// heartbeat warns about the board's temperature.
+type DeviceToolConfig struct {
+	// GPIOPins are the only GPIO pins the agent may read, by their
+	// number in /sys/class/gpio; none when empty.
+	GPIOPins []int `json:"gpio_pins,omitempty"`
+	// WarnTemperatureC is the temperature the heartbeat warns at; 0 means
+	// where the kernel starts throttling the CPU, or 80°C if it does not
+	// say.
+	WarnTemperatureC float64 `json:"warn_temperature_c,omitempty" env:"PICOCLAW_TOOLS_DEVICE_WARN_TEMPERATURE_C"`
+}
+
+func (c DeviceToolConfig) Validate() error {
+	for _, pin := range c.GPIOPins {
+		if pin < 0 {
+			return fmt.Errorf("tools.device: gpio pin %d is negative", pin)
+		}
+	}
+	if c.WarnTemperatureC < 0 {
+		return fmt.Errorf("tools.device: warn_temperature_c must not be negative")
+	}
+	return nil
+}
+
+// SendMessageToolConfig controls where the send_message tool may deliver
+// messages. The tool is only registered when at least one destination or
+// allowlist entry is configured.
+type SendMessageToolConfig struct {
+	// Destinations maps a name the agent can use ("work") to "channel:chat_id".
+	Destinations map[string]string `json:"destinations"`
+	// Allowed lists other targets the agent may address directly, as
+	// "channel:chat_id", "channel:*" or "*".
+	Allowed FlexibleStringSlice `json:"allowed" env:"PICOCLAW_TOOLS_SEND_MESSAGE_ALLOWED"`
+}
+
+// Enabled reports whether any destination is configured.
+func (c SendMessageToolConfig) Enabled() bool {
+	return len(c.Destinations) > 0 || len(c.Allowed) > 0
 }
 
 type SkillsToolsConfig struct {
@@ -501,7 +1866,22 @@ type ClawHubRegistryConfig struct {
 	MaxResponseSize int    `json:"max_response_size" env:"PICOCLAW_SKILLS_REGISTRIES_CLAWHUB_MAX_RESPONSE_SIZE"`
 }
 
+// LoadConfig loads the config at path with its layers: the file, its
+// conf.d fragments, the per-device overlay and environment variables, in
+// that order, with ${env:...} and ${file:...} references resolved.
 func LoadConfig(path string) (*Config, error) {
+	return loadConfig(path, true)
+}
+
+// LoadConfigFile loads the config file at path alone, as written: without
+// the other layers and with references left in place. Commands that change
+// the file and save it back use it, so the other layers and the secrets
+// are not written into it.
+func LoadConfigFile(path string) (*Config, error) {
+	return loadConfig(path, false)
+}
+
+func loadConfig(path string, layered bool) (*Config, error) {
 	cfg := DefaultConfig()
 
 	data, err := os.ReadFile(path)
@@ -525,13 +1905,32 @@ func LoadConfig(path string) (*Config, error) {
 	if len(tmp.ModelList) > 0 {
 		cfg.ModelList = nil
 	}
+	// A runtime profile changes the defaults, so what the file sets still
+	// wins.
+	profile := tmp.RuntimeProfile
+	if v, ok := os.LookupEnv("PICOCLAW_RUNTIME_PROFILE"); ok && layered {
+		profile = v
+	}
+	if profile == "low-resource" {
+		applyLowResource(cfg)
+	}
 
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
 
-	if err := env.Parse(cfg); err != nil {
-		return nil, err
+	if layered {
+		// Fragments in conf.d, such as one file per persona, and then the
+		// device's own overlay go over the main file.
+		if err := mergeLayers(cfg, path); err != nil {
+			return nil, err
+		}
+		if err := env.Parse(cfg); err != nil {
+			return nil, err
+		}
+		if err := resolveRefs(cfg, filepath.Dir(path)); err != nil {
+			return nil, err
+		}
 	}
 
 	// Auto-migrate: if only legacy providers config exists, convert to model_list
@@ -544,6 +1943,100 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.ValidateAgents(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateRouting(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateCommands(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateTriggers(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateDigest(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateAnalytics(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Tools.Cron.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Tools.Device.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Update.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Plugins.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Session.Store.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Coordination.Validate(cfg.Session.Store); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ValidateAdmin(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Language.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Shutdown.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Watchdog.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.DND.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Log.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Crash.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Gateway.Budget.Validate(); err != nil {
+		return nil, err
+	}
+
+	if m := cfg.Gateway.SelfReportMinutes; m < 0 || m > 10080 {
+		return nil, fmt.Errorf("gateway: self_report_minutes must be between 0 and 10080")
+	}
+
+	if sh := cfg.Tools.Exec.Shell; sh != "" && !slices.Contains(ExecShells, sh) {
+		return nil, fmt.Errorf("tools.exec: shell %q is not one of %s", sh, strings.Join(ExecShells, ", "))
+	}
+
+	if p := cfg.RuntimeProfile; p != "" && !slices.Contains(RuntimeProfiles, p) {
+		return nil, fmt.Errorf("runtime_profile: %q is not one of %s", p, strings.Join(RuntimeProfiles, ", "))
+	}
+
+	if m := cfg.Fixtures.Mode; m != "" && !slices.Contains(FixtureModes, m) {
+		return nil, fmt.Errorf("fixtures: mode %q is not one of %s", m, strings.Join(FixtureModes, ", "))
+	}
+
 	return cfg, nil
 }
 
@@ -565,6 +2058,16 @@ func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// TriggerPath returns the folder the file trigger t watches: its path
+// with ~ expanded, relative paths being in the workspace.
+func (c *Config) TriggerPath(t TriggerConfig) string {
+	path := expandHome(t.Path)
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(c.WorkspacePath(), path)
+	}
+	return path
+}
+
 func (c *Config) GetAPIKey() string {
 	if c.Providers.OpenRouter.APIKey != "" {
 		return c.Providers.OpenRouter.APIKey
@@ -688,3 +2191,208 @@ func (c *Config) ValidateModelList() error {
 	}
 	return nil
 }
+
+// ContextStrategies are the accepted values of context_strategy: what to
+// evict first when a prompt does not fit the model's context window.
+var ContextStrategies = []string{"drop_tool_results", "drop_oldest", "summarize"}
+
+// ReasoningEfforts are the accepted values of reasoning_effort.
+var ReasoningEfforts = []string{"minimal", "low", "medium", "high"}
+
+// ValidateAgents checks the model and parameter overrides of the agent
+// defaults and of each agent in agents.list.
+func (c *Config) ValidateAgents() error {
+	d := c.Agents.Defaults
+	if err := validateAgentParams(d.Temperature, d.MaxTokens, d.ReasoningEffort); err != nil {
+		return fmt.Errorf("agents.defaults: %w", err)
+	}
+	if err := d.GenerationParams.Validate(); err != nil {
+		return fmt.Errorf("agents.defaults: %w", err)
+	}
+	if d.ContextStrategy != "" && !slices.Contains(ContextStrategies, d.ContextStrategy) {
+		return fmt.Errorf("agents.defaults: context_strategy %q is not one of %s",
+			d.ContextStrategy, strings.Join(ContextStrategies, ", "))
+	}
+	if d.ContextWindow < 0 {
+		return fmt.Errorf("agents.defaults: context_window %d is negative", d.ContextWindow)
+	}
+	for i, a := range c.Agents.List {
+		if err := validateAgentParams(a.Temperature, a.MaxTokens, a.ReasoningEffort); err != nil {
+			return fmt.Errorf("agents.list[%d] (%s): %w", i, a.ID, err)
+		}
+		if err := a.GenerationParams.Validate(); err != nil {
+			return fmt.Errorf("agents.list[%d] (%s): %w", i, a.ID, err)
+		}
+		if a.Provider == "" {
+			continue
+		}
+		if _, ok := c.VendorModelConfig(a.Provider, ""); !ok {
+			return fmt.Errorf("agents.list[%d] (%s): no model_list entry uses provider %q", i, a.ID, a.Provider)
+		}
+		if a.Model == nil || strings.TrimSpace(a.Model.Primary) == "" {
+			return fmt.Errorf("agents.list[%d] (%s): provider %q is set without a model", i, a.ID, a.Provider)
+		}
+	}
+	return nil
+}
+
+// ValidateRouting checks that the routing rules name configured agents
+// and that their conditions parse.
+// knownAgent reports whether id names an agent of the config.
+func (c *Config) knownAgent(id string) bool {
+	if len(c.Agents.List) == 0 {
+		return strings.EqualFold(id, "main")
+	}
+	return slices.ContainsFunc(c.Agents.List, func(a AgentConfig) bool { return strings.EqualFold(a.ID, id) })
+}
+
+func (c *Config) ValidateRouting() error {
+	known := c.knownAgent
+	for i, rule := range c.Routing.Rules {
+		name := fmt.Sprintf("routing.rules[%d]", i)
+		if rule.Name != "" {
+			name += " (" + rule.Name + ")"
+		}
+		m := rule.Match
+		switch {
+		case rule.Persona == "":
+			return fmt.Errorf("%s: persona is missing", name)
+		case !known(rule.Persona):
+			return fmt.Errorf("%s: persona %q is not in agents.list", name, rule.Persona)
+		case m.Schedule != "" && !gronx.New().IsValid(m.Schedule):
+			return fmt.Errorf("%s: schedule %q is not a cron expression", name, m.Schedule)
+		}
+		if m.Timezone != "" {
+			if _, err := time.LoadLocation(m.Timezone); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		for _, entry := range slices.Concat(m.Chats, m.Senders) {
+			if channel, id, ok := strings.Cut(entry, ":"); !ok || channel == "" || id == "" {
+				return fmt.Errorf("%s: %q is not channel:id", name, entry)
+			}
+		}
+	}
+	if f := c.Routing.Fallback; f != "" && !known(f) {
+		return fmt.Errorf("routing: fallback %q is not in agents.list", f)
+	}
+	return nil
+}
+
+// commandName is what a custom command may be called, which is what
+// Telegram allows for bot commands.
+var commandName = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ValidateCommands checks the custom commands.
+func (c *Config) ValidateCommands() error {
+	seen := map[string]bool{}
+	for i, cmd := range c.Commands {
+		name := fmt.Sprintf("commands[%d]", i)
+		if cmd.Name != "" {
+			name += " (" + cmd.Name + ")"
+		}
+		switch {
+		case !commandName.MatchString(cmd.Name):
+			return fmt.Errorf("%s: name must be 1 to 32 lowercase letters, digits or underscores", name)
+		case seen[cmd.Name]:
+			return fmt.Errorf("%s: defined twice", name)
+		case strings.TrimSpace(cmd.Prompt) == "":
+			return fmt.Errorf("%s: prompt is missing", name)
+		case cmd.Persona != "" && !c.knownAgent(cmd.Persona):
+			return fmt.Errorf("%s: persona %q is not in agents.list", name, cmd.Persona)
+		}
+		seen[cmd.Name] = true
+		if _, err := template.New(cmd.Name).Parse(cmd.Prompt); err != nil {
+			return fmt.Errorf("%s: prompt: %w", name, err)
+		}
+		for _, entry := range cmd.Allow {
+			if channel, id, ok := strings.Cut(entry, ":"); entry != "admin" && (!ok || channel == "" || id == "") {
+				return fmt.Errorf("%s: allow entry %q is neither \"admin\" nor channel:sender_id", name, entry)
+			}
+		}
+	}
+	return nil
+}
+
+// triggerName is what a trigger may be called; it is part of the URL of a
+// webhook trigger.
+var triggerName = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// ValidateTriggers checks the triggers.
+func (c *Config) ValidateTriggers() error {
+	seen := map[string]bool{}
+	for i, t := range c.Triggers {
+		name := fmt.Sprintf("triggers[%d]", i)
+		if t.Name != "" {
+			name += " (" + t.Name + ")"
+		}
+		switch {
+		case !triggerName.MatchString(t.Name):
+			return fmt.Errorf("%s: name must be 1 to 64 lowercase letters, digits, dashes or underscores", name)
+		case seen[t.Name]:
+			return fmt.Errorf("%s: defined twice", name)
+		case !slices.Contains(TriggerKinds, t.Kind):
+			return fmt.Errorf("%s: kind %q is not one of %s", name, t.Kind, strings.Join(TriggerKinds, ", "))
+		case strings.TrimSpace(t.Prompt) == "":
+			return fmt.Errorf("%s: prompt is missing", name)
+		case t.Persona != "" && !c.knownAgent(t.Persona):
+			return fmt.Errorf("%s: persona %q is not in agents.list", name, t.Persona)
+		case (t.Channel == "") != (t.ChatID == ""):
+			return fmt.Errorf("%s: channel and chat_id go together", name)
+		case t.IntervalSeconds < 0:
+			return fmt.Errorf("%s: interval_seconds %d is negative", name, t.IntervalSeconds)
+		case t.Kind == "file" && t.Path == "":
+			return fmt.Errorf("%s: a file trigger needs a path", name)
+		case t.Kind == "mqtt" && (t.Broker == "" || t.Topic == ""):
+			return fmt.Errorf("%s: an mqtt trigger needs a broker and a topic", name)
+		case t.Kind == "webhook" && t.Secret == "":
+			return fmt.Errorf("%s: a webhook trigger needs a secret", name)
+		case t.Kind == "rss" && !strings.HasPrefix(t.URL, "http://") && !strings.HasPrefix(t.URL, "https://"):
+			return fmt.Errorf("%s: an rss trigger needs an http(s) url", name)
+		}
+		if t.Pattern != "" {
+			if _, err := filepath.Match(t.Pattern, ""); err != nil {
+				return fmt.Errorf("%s: pattern: %w", name, err)
+			}
+		}
+		seen[t.Name] = true
+		if _, err := template.New(t.Name).Parse(t.Prompt); err != nil {
+			return fmt.Errorf("%s: prompt: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateAgentParams(temperature *float64, maxTokens int, effort string) error {
+	if temperature != nil && (*temperature < 0 || *temperature > 2) {
+		return fmt.Errorf("temperature %v is outside 0 to 2", *temperature)
+	}
+	if maxTokens < 0 {
+		return fmt.Errorf("max_tokens %d is negative", maxTokens)
+	}
+	if effort != "" && !slices.Contains(ReasoningEfforts, effort) {
+		return fmt.Errorf("reasoning_effort %q is not one of %s", effort, strings.Join(ReasoningEfforts, ", "))
+	}
+	return nil
+}
+
+// VendorModelConfig returns a model config for model at the given vendor,
+// with the API key and base of the first model_list entry of that vendor.
+// It lets an agent name a vendor and a model without a model_list entry of
+// its own. Models without a vendor prefix count as "openai".
+func (c *Config) VendorModelConfig(vendor, model string) (*ModelConfig, bool) {
+	for _, entry := range c.ModelList {
+		protocol, _, found := strings.Cut(entry.Model, "/")
+		if !found {
+			protocol = "openai"
+		}
+		if protocol != vendor {
+			continue
+		}
+		own := entry
+		own.ModelName = model
+		own.Model = vendor + "/" + model
+		return &own, true
+	}
+	return nil, false
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -413,3 +414,422 @@ func TestLoadConfig_WebToolsProxy(t *testing.T) {
 		t.Fatalf("Tools.Web.Proxy = %q, want %q", cfg.Tools.Web.Proxy, "http://127.0.0.1:7890")
 	}
 }
+
+func TestWhatsAppConfig_StorePath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	cfg := WhatsAppConfig{}
+	if got, want := cfg.StorePath(), filepath.Join(home, ".picoclaw", "whatsapp", "session.db"); got != want {
+		t.Errorf("default StorePath() = %q, want %q", got, want)
+	}
+
+	cfg.SessionStorePath = "/var/lib/picoclaw/wa.db"
+	if got := cfg.StorePath(); got != "/var/lib/picoclaw/wa.db" {
+		t.Errorf("StorePath() = %q, want explicit path", got)
+	}
+}
+
+func TestChannelAccounts_UnmarshalAppliesDefaults(t *testing.T) {
+	jsonData := `{
+		"channels": {
+			"webhook": {"enabled": true, "api_keys": ["main"]},
+			"accounts": {
+				"work": {
+					"webhook": {"enabled": true, "port": 18800, "api_keys": ["work"], "allow_from": ["alice"]}
+				}
+			}
+		}
+	}`
+
+	cfg := DefaultConfig()
+	if err := json.Unmarshal([]byte(jsonData), cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	work, ok := cfg.Channels.Accounts["work"]
+	if !ok {
+		t.Fatalf("accounts = %v", cfg.Channels.Accounts)
+	}
+	if work.Webhook.Port != 18800 || work.Webhook.APIKeys[0] != "work" || work.Webhook.AllowFrom[0] != "alice" {
+		t.Errorf("work webhook = %+v", work.Webhook)
+	}
+	if work.Webhook.RateLimit != 60 {
+		t.Errorf("RateLimit = %d, want the default 60", work.Webhook.RateLimit)
+	}
+	if work.Telegram.Enabled {
+		t.Error("channels not configured for the account should stay disabled")
+	}
+	if cfg.Channels.Webhook.APIKeys[0] != "main" {
+		t.Errorf("top-level webhook = %+v", cfg.Channels.Webhook)
+	}
+}
+
+func TestChannelAccounts_RejectsInvalidNames(t *testing.T) {
+	cfg := DefaultConfig()
+	err := json.Unmarshal([]byte(`{"channels": {"accounts": {"a@b": {}}}}`), cfg)
+	if err == nil {
+		t.Error("expected an error for an account name containing @")
+	}
+}
+
+func TestLoadConfig_ValidatesAgentOverrides(t *testing.T) {
+	base := `"model_list": [{"model_name":"cloud","model":"openrouter/openai/gpt-4o","api_key":"x"}]`
+	tests := []struct {
+		name    string
+		agents  string
+		wantErr string
+	}{
+		{"valid", `{"list":[{"id":"work","provider":"openrouter","model":"openai/gpt-4o-mini","temperature":0.2,"max_tokens":2048,"reasoning_effort":"low"}]}`, ""},
+		{"temperature", `{"list":[{"id":"work","temperature":3}]}`, "temperature"},
+		{"max tokens", `{"list":[{"id":"work","max_tokens":-1}]}`, "max_tokens"},
+		{"effort", `{"defaults":{"reasoning_effort":"extreme"}}`, "reasoning_effort"},
+		{"provider", `{"list":[{"id":"work","provider":"groq","model":"llama-3"}]}`, `provider "groq"`},
+		{"provider without model", `{"list":[{"id":"work","provider":"openrouter"}]}`, "without a model"},
+		{"generation", `{"defaults":{"top_p":0.9,"stop":["END"],"seed":7,"logit_bias":{"50256":-100}}}`, ""},
+		{"top_p", `{"list":[{"id":"work","top_p":1.5}]}`, "top_p"},
+		{"penalty", `{"defaults":{"presence_penalty":-3}}`, "presence_penalty"},
+		{"logit bias key", `{"defaults":{"logit_bias":{"hello":5}}}`, "not a token ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(configPath, []byte(`{"agents":`+tt.agents+`,`+base+`}`), 0o600); err != nil {
+				t.Fatalf("os.WriteFile() error: %v", err)
+			}
+			_, err := LoadConfig(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionStoreConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     SessionStoreConfig
+		wantErr string
+	}{
+		{SessionStoreConfig{}, ""},
+		{SessionStoreConfig{Backend: "postgres", DSN: "postgres://localhost/picoclaw", MaxMessages: 200}, ""},
+		{SessionStoreConfig{Backend: "mysql"}, "not one of"},
+		{SessionStoreConfig{Backend: "redis"}, "needs a dsn"},
+		{SessionStoreConfig{MaxMessages: -1}, "max_messages"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("Validate(%+v) = %v", tt.cfg, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVendorModelConfig(t *testing.T) {
+	cfg := &Config{ModelList: []ModelConfig{
+		{ModelName: "cloud", Model: "openrouter/openai/gpt-4o", APIKey: "sk-or", APIBase: "https://openrouter.ai/api/v1"},
+	}}
+	mc, ok := cfg.VendorModelConfig("openrouter", "openai/gpt-4o-mini")
+	if !ok || mc.Model != "openrouter/openai/gpt-4o-mini" || mc.APIKey != "sk-or" {
+		t.Fatalf("VendorModelConfig() = %+v, %v", mc, ok)
+	}
+	if cfg.ModelList[0].Model != "openrouter/openai/gpt-4o" {
+		t.Error("VendorModelConfig changed model_list")
+	}
+	if _, ok := cfg.VendorModelConfig("anthropic", "claude"); ok {
+		t.Error("found a vendor without a model_list entry")
+	}
+}
+
+func TestValidateRouting(t *testing.T) {
+	agents := AgentsConfig{List: []AgentConfig{{ID: "main"}, {ID: "support"}}}
+	tests := []struct {
+		routing RoutingConfig
+		wantErr string
+	}{
+		{RoutingConfig{}, ""},
+		{RoutingConfig{
+			Rules: []RoutingRule{{Persona: "Support", Match: RoutingMatch{
+				Chats: []string{"telegram:-100"}, Schedule: "* 9-17 * * 1-5", Timezone: "Europe/Berlin",
+			}}},
+			Fallback: "main",
+		}, ""},
+		{RoutingConfig{Rules: []RoutingRule{{Name: "x"}}}, "routing.rules[0] (x): persona is missing"},
+		{RoutingConfig{Rules: []RoutingRule{{Persona: "sales"}}}, `persona "sales" is not in agents.list`},
+		{RoutingConfig{Rules: []RoutingRule{{Persona: "main", Match: RoutingMatch{Schedule: "9-17"}}}}, "cron"},
+		{RoutingConfig{Rules: []RoutingRule{{Persona: "main", Match: RoutingMatch{Timezone: "Mars/Base"}}}}, "Mars"},
+		{RoutingConfig{Rules: []RoutingRule{{Persona: "main", Match: RoutingMatch{Senders: []string{"42"}}}}}, "channel:id"},
+		{RoutingConfig{Fallback: "sales"}, `fallback "sales"`},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Agents: agents, Routing: tt.routing}
+		err := cfg.ValidateRouting()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("ValidateRouting(%+v) = %v", tt.routing, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("ValidateRouting(%+v) = %v, want %q", tt.routing, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateCommands(t *testing.T) {
+	tests := []struct {
+		cmd     CommandConfig
+		wantErr string
+	}{
+		{CommandConfig{Name: "standup", Prompt: "Summarize {{.Args}}", Persona: "main", Allow: []string{"admin", "slack:U1"}}, ""},
+		{CommandConfig{Name: "Stand-up", Prompt: "x"}, "lowercase"},
+		{CommandConfig{Name: "standup"}, "prompt is missing"},
+		{CommandConfig{Name: "standup", Prompt: "{{.Args"}, "prompt:"},
+		{CommandConfig{Name: "standup", Prompt: "x", Persona: "sales"}, `persona "sales"`},
+		{CommandConfig{Name: "standup", Prompt: "x", Allow: []string{"U1"}}, "channel:sender_id"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Commands: []CommandConfig{tt.cmd}}
+		err := cfg.ValidateCommands()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("ValidateCommands(%+v) = %v", tt.cmd, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("ValidateCommands(%+v) = %v, want %q", tt.cmd, err, tt.wantErr)
+		}
+	}
+	twice := &Config{Commands: []CommandConfig{{Name: "a", Prompt: "x"}, {Name: "a", Prompt: "y"}}}
+	if err := twice.ValidateCommands(); err == nil || !strings.Contains(err.Error(), "defined twice") {
+		t.Errorf("duplicate command: %v", err)
+	}
+}
+
+func TestValidateTriggers(t *testing.T) {
+	tests := []struct {
+		trigger TriggerConfig
+		wantErr string
+	}{
+		{TriggerConfig{Name: "inbox", Kind: "file", Path: "~/inbox", Pattern: "*.pdf", Prompt: "Summarize {{range .Files}}{{.Path}}{{end}}"}, ""},
+		{TriggerConfig{Name: "ci", Kind: "webhook", Secret: "s", Prompt: "x", Channel: "telegram", ChatID: "1"}, ""},
+		{TriggerConfig{Name: "Inbox", Kind: "file", Path: "x", Prompt: "x"}, "lowercase"},
+		{TriggerConfig{Name: "x", Kind: "cron", Prompt: "x"}, `kind "cron"`},
+		{TriggerConfig{Name: "x", Kind: "presence"}, "prompt is missing"},
+		{TriggerConfig{Name: "x", Kind: "presence", Prompt: "{{.Up"}, "prompt:"},
+		{TriggerConfig{Name: "x", Kind: "presence", Prompt: "x", Channel: "telegram"}, "go together"},
+		{TriggerConfig{Name: "x", Kind: "file", Prompt: "x"}, "needs a path"},
+		{TriggerConfig{Name: "x", Kind: "file", Path: "x", Pattern: "[", Prompt: "x"}, "pattern"},
+		{TriggerConfig{Name: "x", Kind: "mqtt", Broker: "tcp://h:1883", Prompt: "x"}, "broker and a topic"},
+		{TriggerConfig{Name: "x", Kind: "webhook", Prompt: "x"}, "needs a secret"},
+		{TriggerConfig{Name: "x", Kind: "rss", URL: "example.com/feed", Prompt: "x"}, "http(s) url"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Triggers: []TriggerConfig{tt.trigger}}
+		err := cfg.ValidateTriggers()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("ValidateTriggers(%+v) = %v", tt.trigger, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("ValidateTriggers(%+v) = %v, want %q", tt.trigger, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadConfig_LowResourceProfile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	configJSON := `{"runtime_profile": "low-resource", "gateway": {"queue": {"max_pending": 50}}}`
+	if err := os.WriteFile(configPath, []byte(configJSON), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if q := cfg.Gateway.Queue; q.MaxConcurrency != 1 || q.MaxPending != 50 {
+		t.Errorf("queue = %+v, want the profile's concurrency and the file's max_pending", q)
+	}
+	if cfg.Session.Store.MaxConns != 1 || len(cfg.Gateway.Flags.DisabledTools) != 1 || cfg.Agents.Defaults.MaxTokens != 2048 {
+		t.Errorf("low-resource defaults not applied: store %+v, flags %+v, max_tokens %d",
+			cfg.Session.Store, cfg.Gateway.Flags, cfg.Agents.Defaults.MaxTokens)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"runtime_profile": "tiny"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "runtime_profile") {
+		t.Errorf("unknown profile: %v", err)
+	}
+}
+
+func TestAdminAPIConfig_Validate(t *testing.T) {
+	tests := []struct {
+		cfg     AdminAPIConfig
+		wantErr string
+	}{
+		{AdminAPIConfig{}, ""},
+		{AdminAPIConfig{Port: 18797, Token: "s3cret"}, ""},
+		{AdminAPIConfig{Port: 18797, CertFile: "c.pem", KeyFile: "k.pem", ClientCAFile: "ca.pem"}, ""},
+		{AdminAPIConfig{Port: 18797}, "without authentication"},
+		{AdminAPIConfig{Port: 70000, Token: "s3cret"}, "out of range"},
+		{AdminAPIConfig{Port: 18797, Token: "s3cret", CertFile: "c.pem"}, "go together"},
+		{AdminAPIConfig{Port: 18797, ClientCAFile: "ca.pem"}, "need TLS"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("Validate(%+v) = %v", tt.cfg, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfig_ValidateAdmin(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.ValidateAdmin(); err != nil {
+		t.Fatalf("without admin chats: %v", err)
+	}
+	cfg.Gateway.Admin.Chats = FlexibleStringSlice{"telegram:42"}
+	if err := cfg.ValidateAdmin(); err == nil || !strings.Contains(err.Error(), "no senders") {
+		t.Errorf("an admin chat without senders: %v", err)
+	}
+	cfg.Gateway.Admin.Chats = nil
+	cfg.Gateway.Supervisor.AlertChannel, cfg.Gateway.Supervisor.AlertChatID = "slack", "C1"
+	if err := cfg.ValidateAdmin(); err == nil || !strings.Contains(err.Error(), "no senders") {
+		t.Errorf("an alert chat without senders: %v", err)
+	}
+	cfg.Gateway.Admin.Senders = FlexibleStringSlice{"slack:U1"}
+	if err := cfg.ValidateAdmin(); err != nil {
+		t.Errorf("an alert chat with senders: %v", err)
+	}
+	cfg.Gateway.Admin.Senders = FlexibleStringSlice{"U1"}
+	if err := cfg.ValidateAdmin(); err == nil || !strings.Contains(err.Error(), "channel:sender_id") {
+		t.Errorf("a sender without a channel: %v", err)
+	}
+}
+
+func TestPluginsConfig_Validate(t *testing.T) {
+	valid := PluginsConfig{TrustedKeys: []string{"11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	for _, key := range []string{"not base64!", "c2hvcnQ="} {
+		cfg := PluginsConfig{TrustedKeys: []string{key}}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "ed25519") {
+			t.Errorf("Validate(%q) = %v", key, err)
+		}
+	}
+}
+
+func TestCronToolsConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Tools.Cron.Validate(); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+	tests := []struct {
+		cfg     CronToolsConfig
+		wantErr string
+	}{
+		{CronToolsConfig{CatchUp: "skip", JitterSeconds: 30, MaxConcurrent: 2}, ""},
+		{CronToolsConfig{CatchUp: "all"}, `catch_up "all"`},
+		{CronToolsConfig{JitterSeconds: -1}, "jitter_seconds"},
+		{CronToolsConfig{MaxConcurrent: -1}, "max_concurrent"},
+		{CronToolsConfig{AlertAfter: -1}, "alert_after"},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("Validate(%+v) = %v", tt.cfg, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateDigest(t *testing.T) {
+	ok := DigestConfig{Enabled: true, Channel: "telegram", ChatID: "1", Schedule: "weekdays at 7:30", Timezone: "Europe/Berlin"}
+	tests := []struct {
+		edit    func(d *DigestConfig)
+		wantErr string
+	}{
+		{func(d *DigestConfig) {}, ""},
+		{func(d *DigestConfig) { d.Enabled, d.Channel = false, "" }, ""},
+		{func(d *DigestConfig) { d.ChatID = "" }, "chat_id"},
+		{func(d *DigestConfig) { d.Sections = []string{"usage", "weather"} }, `section "weather"`},
+		{func(d *DigestConfig) { d.Schedule = "tomorrow at 8" }, "repeating"},
+		{func(d *DigestConfig) { d.Schedule = "whenever" }, "schedule:"},
+		{func(d *DigestConfig) { d.Timezone = "Mars/Olympus" }, "timezone"},
+		{func(d *DigestConfig) { d.Persona = "sales" }, `persona "sales"`},
+		{func(d *DigestConfig) { d.MaxCostUSD = -1 }, "max_cost_usd"},
+	}
+	for i, tt := range tests {
+		cfg := &Config{}
+		cfg.Heartbeat.Digest = ok
+		tt.edit(&cfg.Heartbeat.Digest)
+		err := cfg.ValidateDigest()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("case %d: %v", i, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("case %d: %v, want %q", i, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateAnalytics(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.ValidateAnalytics(); err != nil {
+		t.Fatalf("default settings: %v", err)
+	}
+	cfg.Gateway.Analytics.WeeklySummary = true
+	if err := cfg.ValidateAnalytics(); err == nil || !strings.Contains(err.Error(), "admin chat") {
+		t.Errorf("without an admin chat: %v", err)
+	}
+	cfg.Gateway.Admin.Chats = FlexibleStringSlice{"telegram:42"}
+	if err := cfg.ValidateAnalytics(); err != nil {
+		t.Errorf("weekly summary to telegram:42: %v", err)
+	}
+	if channel, chatID, _ := cfg.AdminChat(); channel != "telegram" || chatID != "42" {
+		t.Errorf("AdminChat = %s:%s", channel, chatID)
+	}
+	cfg.Gateway.Supervisor.AlertChannel, cfg.Gateway.Supervisor.AlertChatID = "slack", "C1"
+	if channel, chatID, _ := cfg.AdminChat(); channel != "slack" || chatID != "C1" {
+		t.Errorf("AdminChat with an alert chat = %s:%s", channel, chatID)
+	}
+	cfg.Gateway.Analytics.Schedule = "tomorrow at 9"
+	if err := cfg.ValidateAnalytics(); err == nil || !strings.Contains(err.Error(), "repeating") {
+		t.Errorf("a schedule that runs once: %v", err)
+	}
+}
+
+func TestBudgetSlots(t *testing.T) {
+	tests := []struct {
+		name             string
+		budget           BudgetConfig
+		cpus, memoryMB   int
+		runs, subprocess int
+	}{
+		{"from cpus", BudgetConfig{}, 2, 0, 8, 2},
+		{"small board", BudgetConfig{}, 4, 256, 8, 4},
+		{"tiny board", BudgetConfig{}, 1, 48, 1, 1},
+		{"budget overrides machine", BudgetConfig{CPUs: 1, MemoryMB: 128, RunMemoryMB: 64}, 8, 0, 2, 1},
+		{"explicit caps", BudgetConfig{MaxRuns: 10, MaxSubprocesses: 3}, 1, 64, 10, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, subprocesses := tt.budget.Slots(tt.cpus, tt.memoryMB)
+			if runs != tt.runs || subprocesses != tt.subprocess {
+				t.Fatalf("Slots = %d runs, %d subprocesses; want %d, %d", runs, subprocesses, tt.runs, tt.subprocess)
+			}
+		})
+	}
+}
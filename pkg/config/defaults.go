@@ -25,14 +25,19 @@ func DefaultConfig() *Config {
 		},
 		Channels: ChannelsConfig{
 			WhatsApp: WhatsAppConfig{
-				Enabled:   false,
-				BridgeURL: "ws://localhost:3001",
-				AllowFrom: FlexibleStringSlice{},
+				Enabled:          false,
+				BridgeURL:        "ws://localhost:3001",
+				UseNative:        false,
+				SessionStorePath: "",
+				AllowFrom:        FlexibleStringSlice{},
 			},
 			Telegram: TelegramConfig{
-				Enabled:   false,
-				Token:     "",
-				AllowFrom: FlexibleStringSlice{},
+				Enabled:       false,
+				Token:         "",
+				MentionOnly:   true,
+				StreamReplies: true,
+				ParseMode:     "html",
+				AllowFrom:     FlexibleStringSlice{},
 			},
 			Feishu: FeishuConfig{
 				Enabled:           false,
@@ -113,6 +118,129 @@ func DefaultConfig() *Config {
 				AllowFrom:      FlexibleStringSlice{},
 				ReplyTimeout:   5,
 			},
+			Matrix: MatrixConfig{
+				Enabled:      false,
+				Homeserver:   "https://matrix.org",
+				UserID:       "",
+				AccessToken:  "",
+				JoinOnInvite: true,
+				MentionOnly:  false,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			Signal: SignalConfig{
+				Enabled:          false,
+				URL:              "http://127.0.0.1:8080",
+				Account:          "",
+				AttachmentsDir:   "~/.local/share/signal-cli/attachments",
+				SendReadReceipts: true,
+				AllowFrom:        FlexibleStringSlice{},
+			},
+			Email: EmailConfig{
+				Enabled:            false,
+				Address:            "",
+				FromName:           "PicoClaw",
+				IMAPHost:           "",
+				IMAPPort:           993,
+				Mailbox:            "INBOX",
+				PollInterval:       60,
+				SMTPHost:           "",
+				SMTPPort:           587,
+				MaxAttachmentBytes: 10 * 1024 * 1024,
+				AllowFrom:          FlexibleStringSlice{},
+				TrustedAuthservIDs: FlexibleStringSlice{},
+			},
+			Webhook: WebhookConfig{
+				Enabled:     false,
+				Host:        "127.0.0.1",
+				Port:        18794,
+				APIKeys:     FlexibleStringSlice{},
+				RateLimit:   60,
+				SyncTimeout: 120,
+				AllowFrom:   FlexibleStringSlice{},
+			},
+			Web: WebConfig{
+				Enabled: false,
+				Host:    "127.0.0.1",
+				Port:    18795,
+			},
+			XMPP: XMPPConfig{
+				Enabled:      false,
+				Resource:     "picoclaw",
+				Rooms:        FlexibleStringSlice{},
+				Nick:         "picoclaw",
+				MentionOnly:  true,
+				JoinOnInvite: true,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			Mattermost: MattermostConfig{
+				Enabled:       false,
+				Channels:      FlexibleStringSlice{},
+				MentionOnly:   true,
+				ThreadReplies: true,
+				AllowFrom:     FlexibleStringSlice{},
+			},
+			RocketChat: RocketChatConfig{
+				Enabled:       false,
+				Channels:      FlexibleStringSlice{},
+				MentionOnly:   true,
+				ThreadReplies: true,
+				AllowFrom:     FlexibleStringSlice{},
+			},
+			Voice: VoiceConfig{
+				Enabled:             false,
+				InputCommand:        "arecord -q -f S16_LE -r 16000 -c 1 -t raw",
+				OutputCommand:       "aplay -q",
+				SilenceThreshold:    500,
+				SilenceMS:           800,
+				MaxUtteranceSeconds: 15,
+				TTSModel:            "tts-1",
+				TTSVoice:            "alloy",
+			},
+			MQTT: MQTTConfig{
+				Enabled:  false,
+				Broker:   "tcp://localhost:1883",
+				ClientID: "picoclaw",
+				Topics:   []MQTTTopicConfig{},
+			},
+			Nostr: NostrConfig{
+				Enabled:    false,
+				PrivateKey: "",
+				Relays:     FlexibleStringSlice{"wss://relay.damus.io", "wss://nos.lol"},
+				AllowFrom:  FlexibleStringSlice{},
+			},
+			SMS: SMSConfig{
+				Enabled:          false,
+				Provider:         "twilio",
+				MaxMessages:      5,
+				WebhookHost:      "0.0.0.0",
+				WebhookPort:      18796,
+				WebhookPath:      "/webhook/sms",
+				ModemDevice:      "/dev/ttyUSB2",
+				ModemBaudRate:    115200,
+				ModemPollSeconds: 10,
+				AllowFrom:        FlexibleStringSlice{},
+			},
+			Attachments: AttachmentsConfig{
+				MaxSizeMB:        20,
+				RetentionMinutes: 60,
+			},
+			Presence: PresenceConfig{
+				Typing:       true,
+				Reactions:    true,
+				WorkingEmoji: "👀",
+				DoneEmoji:    "👍",
+				ErrorEmoji:   "😢",
+			},
+			Broadcast: BroadcastConfig{
+				Targets:    FlexibleStringSlice{},
+				IntervalMS: 1000,
+			},
+			Retry: OutboundRetryConfig{
+				Enabled:               true,
+				MaxAttempts:           8,
+				InitialBackoffSeconds: 5,
+				MaxBackoffSeconds:     900,
+			},
 		},
 		Providers: ProvidersConfig{
 			OpenAI: OpenAIProviderConfig{WebSearch: true},
@@ -251,7 +379,7 @@ func DefaultConfig() *Config {
 			{
 				ModelName: "llama3",
 				Model:     "ollama/llama3",
-				APIBase:   "http://localhost:11434/v1",
+				APIBase:   "http://localhost:11434",
 				APIKey:    "ollama",
 			},
 
@@ -274,6 +402,45 @@ func DefaultConfig() *Config {
 		Gateway: GatewayConfig{
 			Host: "127.0.0.1",
 			Port: 18790,
+			Queue: QueueConfig{
+				MaxConcurrency: 4,
+				MaxPending:     100,
+				Coalesce:       true,
+				Background: BackgroundQueueConfig{
+					MaxConcurrency: 1,
+					MaxWaitSeconds: 600,
+				},
+			},
+			Watchdog: WatchdogConfig{
+				RunTimeoutSeconds:  900,
+				ToolTimeoutSeconds: 300,
+			},
+			Log:   LogConfig{KeepRecent: 500},
+			Crash: CrashConfig{Keep: 20},
+			Budget: BudgetConfig{
+				RunMemoryMB:        32,
+				SubprocessMemoryMB: 64,
+				NotifyQueued:       true,
+			},
+			Supervisor: SupervisorConfig{
+				Enabled:              true,
+				CheckIntervalSeconds: 30,
+				MaxBackoffSeconds:    300,
+				AlertAfterSeconds:    300,
+			},
+			Admin: AdminConfig{
+				API: AdminAPIConfig{Host: "127.0.0.1"},
+			},
+			GroupBatches: GroupBatchesConfig{
+				Enabled:        false,
+				QuietSeconds:   60,
+				MaxWaitSeconds: 600,
+				AckEmoji:       "👀",
+				UrgentKeywords: FlexibleStringSlice{"urgent", "asap"},
+			},
+			Shutdown:          ShutdownConfig{DrainTimeoutSeconds: 30},
+			Analytics:         AnalyticsConfig{Schedule: "mondays at 9"},
+			SelfReportMinutes: 60,
 		},
 		Tools: ToolsConfig{
 			Web: WebToolsConfig{
@@ -294,6 +461,9 @@ func DefaultConfig() *Config {
 			},
 			Cron: CronToolsConfig{
 				ExecTimeoutMinutes: 5,
+				CatchUp:            "once",
+				MaxConcurrent:      1,
+				AlertAfter:         3,
 			},
 			Exec: ExecConfig{
 				EnableDenyPatterns: true,
@@ -315,6 +485,10 @@ func DefaultConfig() *Config {
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
 			Interval: 30,
+			Digest: DigestConfig{
+				Schedule:   "every day at 8",
+				MaxCostUSD: 0.05,
+			},
 		},
 		Devices: DevicesConfig{
 			Enabled:    false,
@@ -322,3 +496,29 @@ func DefaultConfig() *Config {
 		},
 	}
 }
+
+// applyLowResource changes the defaults for boards with 256 to 512 MB of
+// memory, for runtime_profile "low-resource": one message is answered at
+// a time, tools run one command at a time, spawn (which starts more runs
+// alongside) is off, the session store and caches are small, and requests
+// are kept short, which suits the small models such boards run locally.
+// There is no browser tool to disable.
+func applyLowResource(cfg *Config) {
+	cfg.Gateway.Queue.MaxConcurrency = 1
+	cfg.Gateway.Queue.MaxPending = 20
+	cfg.Gateway.Queue.Background.MaxConcurrency = 1
+	cfg.Gateway.Budget.MaxSubprocesses = 1
+	cfg.Gateway.Flags.DisabledTools = FlexibleStringSlice{"spawn"}
+
+	cfg.Session.Store.MaxConns = 1
+	cfg.Session.Store.CacheKB = 256
+	cfg.Session.Store.MaxMessages = 100
+	cfg.Agents.Defaults.ResponseCacheKB = 64
+	cfg.Tools.Skills.MaxConcurrentSearches = 1
+	cfg.Tools.Skills.SearchCache.MaxSize = 10
+	cfg.Tools.Cron.JitterSeconds = 30
+
+	cfg.Agents.Defaults.MaxTokens = 2048
+	cfg.Agents.Defaults.MaxToolIterations = 10
+	cfg.Agents.Defaults.ContextStrategy = "drop_oldest"
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ConfDir returns the directory of config fragments that go with the
+// config file at path: conf.d next to it.
+func ConfDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "conf.d")
+}
+
+// OverlayPath returns the per-device overlay that goes over the config file
+// at path: $PICOCLAW_CONFIG_OVERLAY if set, else config.local.json next to
+// it.
+func OverlayPath(path string) string {
+	if overlay := os.Getenv("PICOCLAW_CONFIG_OVERLAY"); overlay != "" {
+		return expandHome(overlay)
+	}
+	return filepath.Join(filepath.Dir(path), "config.local.json")
+}
+
+// LayerFiles lists the files the config at path is read from, in the
+// order they apply: the file itself, its conf.d fragments in name order and
+// the overlay. Files that do not exist are left out.
+func LayerFiles(path string) []string {
+	fragments, _ := filepath.Glob(filepath.Join(ConfDir(path), "*.json"))
+	files := append([]string{path}, fragments...)
+	files = append(files, OverlayPath(path))
+	return slices.DeleteFunc(files, func(file string) bool {
+		_, err := os.Stat(file)
+		return err != nil
+	})
+}
+
+// mergeLayers applies the conf.d fragments and the overlay that go with the
+// config file at path to cfg. Objects merge key by key; lists and values
+// replace what was there. An overlay named by $PICOCLAW_CONFIG_OVERLAY must
+// exist; config.local.json is optional.
+func mergeLayers(cfg *Config, path string) error {
+	fragments, err := filepath.Glob(filepath.Join(ConfDir(path), "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, fragment := range fragments {
+		if err := mergeFile(cfg, fragment); err != nil {
+			return fmt.Errorf("conf.d: %w", err)
+		}
+	}
+
+	overlay := OverlayPath(path)
+	if _, err := os.Stat(overlay); os.IsNotExist(err) && os.Getenv("PICOCLAW_CONFIG_OVERLAY") == "" {
+		return nil
+	}
+	if err := mergeFile(cfg, overlay); err != nil {
+		return fmt.Errorf("overlay: %w", err)
+	}
+	return nil
+}
+
+func mergeFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// As with the main file, a model_list replaces the one before it rather
+	// than being decoded over its entries.
+	var tmp Config
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if len(tmp.ModelList) > 0 {
+		cfg.ModelList = nil
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// refPattern matches a secret reference: ${env:NAME} for an environment
+// variable or ${file:PATH} for the contents of a file.
+var refPattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// resolveRefs replaces the secret references in cfg's settings with what
+// they refer to. A relative ${file:...} path is taken from dir, the config
+// file's directory. Errors name the setting by its JSON path.
+func resolveRefs(cfg *Config, dir string) error {
+	return resolveValue(reflect.ValueOf(cfg).Elem(), "", dir)
+}
+
+func resolveValue(v reflect.Value, path, dir string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return resolveValue(v.Elem(), path, dir)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				if name == "" {
+					name = field.Name
+				}
+				fieldPath = joinPath(path, name)
+			}
+			if err := resolveValue(v.Field(i), fieldPath, dir); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), dir); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Map values cannot be set in place, so each is resolved as a copy
+		// and stored back.
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := resolveValue(elem, joinPath(path, fmt.Sprint(key)), dir); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.String:
+		s, err := expandRefs(v.String(), dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if s != v.String() && v.CanSet() {
+			v.SetString(s)
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// expandRefs replaces the references in s. File contents lose their
+// trailing newlines, as files written by editors and secret managers
+// usually end in one.
+func expandRefs(s, dir string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var firstErr error
+	expanded := refPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := refPattern.FindStringSubmatch(ref)
+		value, err := lookupRef(m[1], m[2], dir)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+	return expanded, firstErr
+}
+
+func lookupRef(kind, name, dir string) (string, error) {
+	if kind == "env" {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+	path := expandHome(name)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_LayersAndReferences(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	write := func(name, content string) {
+		t.Helper()
+		os.MkdirAll(filepath.Dir(name), 0o755)
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(path, `{
+		"agents": {"defaults": {"temperature": 0.5, "max_tokens": 1000}},
+		"channels": {"telegram": {"token": "${file:secrets/telegram}", "allow_from": ["1"]}},
+		"model_list": [{"model_name": "gpt", "model": "openai/gpt-4o", "api_key": "${env:TEST_OPENAI_KEY}"}]
+	}`)
+	write(filepath.Join(ConfDir(path), "limits.json"), `{"agents": {"defaults": {"max_tokens": 2000}}}`)
+	write(filepath.Join(dir, "config.local.json"), `{
+		"agents": {"defaults": {"temperature": 0.1}},
+		"channels": {"telegram": {"allow_from": ["${env:TEST_OWNER}"]}}
+	}`)
+	write(filepath.Join(dir, "secrets", "telegram"), "123:abc\n")
+	t.Setenv("TEST_OPENAI_KEY", "sk-test")
+	t.Setenv("TEST_OWNER", "42")
+	t.Setenv("PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS", "3000")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Agents.Defaults.Temperature == nil || *cfg.Agents.Defaults.Temperature != 0.1 {
+		t.Errorf("temperature = %v, want the overlay's 0.1", cfg.Agents.Defaults.Temperature)
+	}
+	if cfg.Agents.Defaults.MaxTokens != 3000 {
+		t.Errorf("max_tokens = %d, want the environment's 3000", cfg.Agents.Defaults.MaxTokens)
+	}
+	if cfg.Channels.Telegram.Token != "123:abc" {
+		t.Errorf("token = %q, want the secret file's contents", cfg.Channels.Telegram.Token)
+	}
+	if got := cfg.Channels.Telegram.AllowFrom; len(got) != 1 || got[0] != "42" {
+		t.Errorf("allow_from = %v", got)
+	}
+	if cfg.ModelList[0].APIKey != "sk-test" {
+		t.Errorf("api_key = %q", cfg.ModelList[0].APIKey)
+	}
+
+	// The file alone keeps its references and ignores the other layers.
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Channels.Telegram.Token != "${file:secrets/telegram}" || file.Agents.Defaults.MaxTokens != 1000 {
+		t.Errorf("LoadConfigFile = token %q, max_tokens %d", file.Channels.Telegram.Token, file.Agents.Defaults.MaxTokens)
+	}
+
+	// A named overlay replaces config.local.json and must exist.
+	t.Setenv("PICOCLAW_CONFIG_OVERLAY", filepath.Join(dir, "missing.json"))
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "overlay") {
+		t.Errorf("missing overlay: err = %v", err)
+	}
+}
+
+func TestLoadConfig_UnsetReference(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"channels": {"discord": {"token": "${env:TEST_UNSET_TOKEN}"}}}`), 0o600)
+	os.Unsetenv("TEST_UNSET_TOKEN")
+
+	_, err := LoadConfig(path)
+	if err == nil || err.Error() != "channels.discord.token: environment variable TEST_UNSET_TOKEN is not set" {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -279,6 +279,33 @@ func TestModelConfig_Validate(t *testing.T) {
 			config:  ModelConfig{},
 			wantErr: true,
 		},
+		{
+			name: "openrouter routing",
+			config: ModelConfig{
+				ModelName: "cheap", Model: "openrouter/meta-llama/llama-3.3-70b-instruct",
+				OpenRouter: &OpenRouterConfig{
+					Provider:  &OpenRouterProviderPrefs{Sort: "price", DataCollection: "deny"},
+					Fallbacks: []string{"openai/gpt-4o-mini"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "openrouter unknown sort",
+			config: ModelConfig{
+				ModelName: "cheap", Model: "openrouter/auto",
+				OpenRouter: &OpenRouterConfig{Provider: &OpenRouterProviderPrefs{Sort: "cheapest"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "openrouter settings on another vendor",
+			config: ModelConfig{
+				ModelName: "gpt", Model: "openai/gpt-4o",
+				OpenRouter: &OpenRouterConfig{Fallbacks: []string{"openai/gpt-4o-mini"}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
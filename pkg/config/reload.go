@@ -0,0 +1,329 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Change is a setting that differs between two configs. Path names it by
+// its JSON keys, e.g. "agents.list.work.temperature", with list entries
+// that have an id keyed by it. Old and New are JSON, empty where the
+// setting is unset; secrets read "***".
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, orNone(c.Old), orNone(c.New))
+}
+
+func orNone(v string) string {
+	if v == "" {
+		return "(unset)"
+	}
+	return v
+}
+
+// LivePaths are the settings a running gateway applies when the config
+// changes: the agents' models and sampling settings, the exec and
+// send_message tool policies, the kill switches in gateway.flags, the log
+// levels and the channels' allowlists. "*" stands for any one key, and a
+// path covers the settings under it. Other changes take effect after a
+// restart.
+var LivePaths = []string{
+	"agents.defaults.model_fallbacks",
+	"agents.defaults.max_tokens",
+	"agents.defaults.temperature",
+	"agents.defaults.max_tool_iterations",
+	"agents.defaults.llm_timeout_seconds",
+	"agents.defaults.reasoning_effort",
+	"agents.defaults.context_window",
+	"agents.defaults.context_strategy",
+	"agents.defaults.overflow_model",
+	"agents.defaults.keep_reasoning",
+	"agents.defaults.critique",
+	"agents.defaults.top_p",
+	"agents.defaults.stop",
+	"agents.defaults.frequency_penalty",
+	"agents.defaults.presence_penalty",
+	"agents.defaults.seed",
+	"agents.defaults.logit_bias",
+	"agents.list.*.name",
+	"agents.list.*.model",
+	"agents.list.*.provider",
+	"agents.list.*.skills",
+	"agents.list.*.subagents",
+	"agents.list.*.temperature",
+	"agents.list.*.max_tokens",
+	"agents.list.*.reasoning_effort",
+	"agents.list.*.critique",
+	"agents.list.*.top_p",
+	"agents.list.*.stop",
+	"agents.list.*.frequency_penalty",
+	"agents.list.*.presence_penalty",
+	"agents.list.*.seed",
+	"agents.list.*.logit_bias",
+	"tools.exec",
+	"tools.send_message",
+	"gateway.flags",
+	"gateway.log",
+	"channels.*.allow_from",
+	"channels.accounts.*.*.allow_from",
+}
+
+// Live reports whether a running gateway applies the change, see
+// LivePaths.
+func (c Change) Live() bool {
+	path := strings.Split(c.Path, ".")
+	return slices.ContainsFunc(LivePaths, func(live string) bool {
+		pattern := strings.Split(live, ".")
+		if len(path) < len(pattern) {
+			return false
+		}
+		for i, p := range pattern {
+			if p != "*" && p != path[i] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Diff lists the settings that differ between old and new, sorted by
+// path.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffValues(nil, jsonTree(old), jsonTree(new), &changes)
+	slices.SortFunc(changes, func(a, b Change) int { return strings.Compare(a.Path, b.Path) })
+	return changes
+}
+
+func jsonTree(cfg *Config) any {
+	data, _ := json.Marshal(cfg)
+	var tree any
+	json.Unmarshal(data, &tree)
+	return tree
+}
+
+func diffValues(path []string, old, new any, changes *[]Change) {
+	if o, ok := old.(map[string]any); ok {
+		if n, ok := new.(map[string]any); ok {
+			diffMaps(path, o, n, changes)
+			return
+		}
+	}
+	if o, ok := byID(old); ok {
+		if n, ok := byID(new); ok {
+			diffMaps(path, o, n, changes)
+			return
+		}
+	}
+	oldJSON, _ := json.Marshal(old)
+	newJSON, _ := json.Marshal(new)
+	if string(oldJSON) == string(newJSON) {
+		return
+	}
+	*changes = append(*changes, Change{Path: strings.Join(path, "."), Old: render(path, old), New: render(path, new)})
+}
+
+func diffMaps(path []string, old, new map[string]any, changes *[]Change) {
+	keys := make(map[string]bool)
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	for k := range keys {
+		diffValues(append(slices.Clip(path), k), old[k], new[k], changes)
+	}
+}
+
+// byID keys a list of objects by their "id", so entries are compared by
+// identity rather than position.
+func byID(v any) (map[string]any, bool) {
+	list, ok := v.([]any)
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+	m := make(map[string]any, len(list))
+	for _, item := range list {
+		obj, _ := item.(map[string]any)
+		id, _ := obj["id"].(string)
+		if id == "" || m[id] != nil {
+			return nil, false
+		}
+		m[id] = item
+	}
+	return m, true
+}
+
+// secretKey matches the names of settings that hold credentials.
+var secretKey = regexp.MustCompile(`(^|_)(key|token|secret|password|dsn)$`)
+
+func isSecret(path []string) bool {
+	return len(path) > 0 && secretKey.MatchString(path[len(path)-1])
+}
+
+// render returns v as JSON with its secrets masked, "" for nil.
+func render(path []string, v any) string {
+	if v == nil {
+		return ""
+	}
+	data, _ := json.Marshal(mask(path, v))
+	return string(data)
+}
+
+func mask(path []string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		masked := make(map[string]any, len(v))
+		for k, item := range v {
+			masked[k] = mask(append(slices.Clip(path), k), item)
+		}
+		return masked
+	case []any:
+		masked := make([]any, len(v))
+		for i, item := range v {
+			masked[i] = mask(path, item)
+		}
+		return masked
+	case string:
+		if v != "" && isSecret(path) {
+			return "***"
+		}
+	}
+	return v
+}
+
+// Watcher reloads the config file and its layers when they change.
+type Watcher struct {
+	// Strict refuses edits that LoadConfigStrict would refuse.
+	Strict bool
+
+	mu      sync.Mutex
+	path    string
+	current *Config
+	stamp   string // of the files current was loaded from
+	pending string // of files seen changing, loaded once they settle
+}
+
+// NewWatcher loads the config at path to compare later versions against.
+func NewWatcher(path string) (*Watcher, error) {
+	stamp := configStamp(path)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{path: path, current: cfg, stamp: stamp, pending: stamp}, nil
+}
+
+// Check loads the config again if its files changed and have stayed the
+// same since the previous check, so a file is not read halfway through
+// being written. It returns the new config and what changed, or nil if
+// nothing did. A config that does not load or validate is returned as an
+// error, once per edit, and the last good config stays current.
+func (w *Watcher) Check() (*Config, []Change, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.check()
+}
+
+func (w *Watcher) check() (*Config, []Change, error) {
+	stamp := configStamp(w.path)
+	if stamp == w.stamp {
+		w.pending = stamp
+		return nil, nil, nil
+	}
+	if stamp != w.pending {
+		w.pending = stamp
+		return nil, nil, nil
+	}
+	return w.load(stamp)
+}
+
+// Reload loads the config now, whether or not its files changed, for an
+// operator who asks for it, and calls apply with it if anything changed.
+// It returns what changed, or the error if the config was refused.
+func (w *Watcher) Reload(apply func(*Config, []Change)) ([]Change, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamp := configStamp(w.path)
+	w.pending = stamp
+	next, changes, err := w.load(stamp)
+	if next != nil {
+		apply(next, changes)
+	}
+	return changes, err
+}
+
+// load loads the config, whose files are described by stamp, and makes it
+// current if it is good. Must be called with w.mu held.
+func (w *Watcher) load(stamp string) (*Config, []Change, error) {
+	w.stamp = stamp
+	load := LoadConfig
+	if w.Strict {
+		load = LoadConfigStrict
+	}
+	next, err := load(w.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := Diff(w.current, next)
+	w.current = next
+	if len(changes) == 0 {
+		return nil, nil, nil
+	}
+	return next, changes, nil
+}
+
+// Run checks the config every interval until ctx ends, calling apply
+// with each new config and reject with each edit it refused.
+func (w *Watcher) Run(
+	ctx context.Context,
+	interval time.Duration,
+	apply func(*Config, []Change),
+	reject func(error),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// The config is applied under the lock, so a Reload cannot apply
+		// a newer config before this one.
+		w.mu.Lock()
+		next, changes, err := w.check()
+		switch {
+		case err != nil:
+			reject(err)
+		case next != nil:
+			apply(next, changes)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// configStamp describes the size and modification time of the config file
+// and its layers, so any edit changes it.
+func configStamp(path string) string {
+	var b strings.Builder
+	for _, file := range LayerFiles(path) {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	edits := 0
+	write := func(name, content string) {
+		t.Helper()
+		os.MkdirAll(filepath.Dir(name), 0o755)
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// Edits within the file system's timestamp resolution still count.
+		edits++
+		os.Chtimes(name, time.Now(), time.Now().Add(time.Duration(edits)*time.Second))
+	}
+	write(path, `{"channels":{"telegram":{"allow_from":["1"],"token":"old-token"}}}`)
+
+	w, err := NewWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, _, err := w.Check(); next != nil || err != nil {
+		t.Fatalf("unchanged config: %v, %v", next, err)
+	}
+
+	write(path, `{"channels":{"telegram":{"allow_from":["1","2"],"token":"new-token"}}}`)
+	write(filepath.Join(ConfDir(path), "work.json"), `{"agents":{"list":[{"id":"work","temperature":0.2}]}}`)
+	if next, _, _ := w.Check(); next != nil {
+		t.Error("the config was loaded before it settled")
+	}
+	next, changes, err := w.Check()
+	if err != nil || next == nil {
+		t.Fatalf("Check = %v, %v", next, err)
+	}
+	if len(next.Agents.List) != 1 || *next.Agents.List[0].Temperature != 0.2 {
+		t.Errorf("conf.d fragment not merged: %+v", next.Agents.List)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`agents.list: (unset) -> [{"id":"work","temperature":0.2}]`,
+		`channels.telegram.allow_from: ["1"] -> ["1","2"]`,
+		`channels.telegram.token: "***" -> "***"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// An invalid edit is refused once and the last good config stays.
+	write(path, `{"channels":{"telegram":`)
+	w.Check()
+	if _, _, err := w.Check(); err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	if next, _, err := w.Check(); next != nil || err != nil {
+		t.Errorf("the refused edit was reported again: %v, %v", next, err)
+	}
+	write(path, `{"channels":{"telegram":{"allow_from":["2"],"token":"new-token"}}}`)
+	w.Check()
+	if _, changes, _ := w.Check(); len(changes) != 1 || changes[0].String() != `channels.telegram.allow_from: ["1","2"] -> ["2"]` {
+		t.Errorf("changes after the fix = %v", changes)
+	}
+}
+
+func TestDiff_ListsByIDAndLiveChanges(t *testing.T) {
+	temp := func(v float64) *float64 { return &v }
+	old := DefaultConfig()
+	old.Agents.List = []AgentConfig{{ID: "main"}, {ID: "work", Temperature: temp(0.7)}}
+	new := DefaultConfig()
+	new.Agents.List = []AgentConfig{{ID: "work", Temperature: temp(0.2)}, {ID: "main"}}
+	new.Agents.Defaults.Workspace = "/srv/picoclaw"
+	new.ModelList = append(new.ModelList, ModelConfig{ModelName: "extra", Model: "openai/gpt-4o", APIKey: "sk-1"})
+
+	changes := Diff(old, new)
+	if len(changes) != 3 {
+		t.Fatalf("changes = %v", changes)
+	}
+	if c := changes[0]; c.Path != "agents.defaults.workspace" || c.Live() {
+		t.Errorf("workspace change = %v, live %v", c, c.Live())
+	}
+	if c := changes[1]; c.Path != "agents.list.work.temperature" || !c.Live() {
+		t.Errorf("temperature change = %v, live %v", c, c.Live())
+	}
+	if c := changes[2]; c.Path != "model_list" || c.Live() || strings.Contains(c.New, "sk-1") {
+		t.Errorf("model_list change = %v", c)
+	}
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"gateway":{"port":18790}}`), 0o600)
+	w, err := NewWatcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload does not wait for the file to settle.
+	os.WriteFile(path, []byte(`{"gateway":{"port":18791}}`), 0o600)
+	var applied *Config
+	changes, err := w.Reload(func(next *Config, _ []Change) { applied = next })
+	if err != nil || len(changes) != 1 || applied == nil || applied.Gateway.Port != 18791 {
+		t.Fatalf("Reload = %v, %v; applied %v", changes, err, applied)
+	}
+	if next, _, _ := w.Check(); next != nil {
+		t.Error("Check reported the reloaded edit again")
+	}
+
+	os.WriteFile(path, []byte(`{"gateway":{"admin":{"chats":["ops"]}}}`), 0o600)
+	applied = nil
+	if _, err := w.Reload(func(next *Config, _ []Change) { applied = next }); err == nil || applied != nil {
+		t.Errorf("Reload of an invalid admin chat = %v, applied %v", err, applied)
+	}
+}
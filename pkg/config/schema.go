@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaID is the $id of the published schema, config/config.schema.json
+// in the repository.
+const SchemaID = "https://github.com/sipeed/picoclaw/raw/main/config/config.schema.json"
+
+// Schema returns a JSON Schema (draft 2020-12) of the config file,
+// generated from the Config type so it always matches what LoadConfig
+// reads. Objects do not allow keys the config has no setting for.
+func Schema() ([]byte, error) {
+	defs := make(map[string]any)
+	root := schemaFor(reflect.TypeFor[Config](), defs)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = SchemaID
+	root["title"] = "PicoClaw config"
+	root["$defs"] = defs
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var (
+	flexibleStringSliceType = reflect.TypeFor[FlexibleStringSlice]()
+	agentModelConfigType    = reflect.TypeFor[AgentModelConfig]()
+)
+
+// schemaFor describes values of type t. Named structs are described once
+// in defs and referred to, which also covers ChannelsConfig containing
+// itself through its accounts.
+func schemaFor(t reflect.Type, defs map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case flexibleStringSliceType:
+		return map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": []string{"string", "number"}},
+		}
+	case agentModelConfigType:
+		return map[string]any{"oneOf": []any{
+			map[string]any{"type": "string"},
+			structSchema(t, defs),
+		}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return structSchema(t, defs)
+		}
+		if _, ok := defs[name]; !ok {
+			defs[name] = nil // placeholder, so a type that contains itself ends here
+			defs[name] = structSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := make(map[string]any)
+	for _, field := range jsonFields(t) {
+		properties[field.name] = schemaFor(field.typ, defs)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"patternProperties":    map[string]any{commentKeyPattern: map[string]any{}},
+		"additionalProperties": false,
+	}
+}
+
+// Keys starting with an underscore, such as "_comment", are comments:
+// encoding/json ignores them and strict mode allows them.
+const commentKeyPattern = "^_"
+
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields lists the keys encoding/json reads into struct type t,
+// including those of embedded structs.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(embedded)...)
+				continue
+			}
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: field.Type})
+	}
+	return fields
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Problem is a mistake at a place in a config file.
+type Problem struct {
+	File    string
+	Line    int // 1-based; 0 when the problem is not at one place
+	Column  int
+	Path    string // the setting, e.g. "agents.defaults.temperature"
+	Message string
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	b.WriteString(p.File)
+	if p.Line > 0 {
+		fmt.Fprintf(&b, ":%d:%d", p.Line, p.Column)
+	}
+	b.WriteString(": ")
+	if p.Path != "" {
+		b.WriteString(p.Path + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// CheckFile reads one config file, the main file or a layer over it, the
+// way strict mode does: it reports JSON syntax errors, keys that are not
+// settings, such as misspelt ones, and values of the wrong type, each with
+// its line and column. It returns an error only if the file cannot be
+// read.
+func CheckFile(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal(data, new(any)); errors.As(err, &syntaxErr) {
+		return []Problem{problemAt(path, data, int(syntaxErr.Offset), "", syntaxErr.Error())}, nil
+	} else if err != nil {
+		return []Problem{{File: path, Message: err.Error()}}, nil
+	}
+
+	c := &checker{file: path, data: data}
+	c.check(data, 0, reflect.TypeFor[Config](), "")
+
+	// Values are checked by decoding them, which stops at the first one of
+	// the wrong type. Errors from inside channel accounts, which decode
+	// their own part of the file, have no position in it.
+	err = json.Unmarshal(data, DefaultConfig())
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		c.problems = append(c.problems, problemAt(path, data, typeErrorOffset(data, typeErr), typeErr.Field,
+			fmt.Sprintf("expected %s, got %s", typeName(typeErr.Type), typeErr.Value)))
+	} else if err != nil {
+		c.problems = append(c.problems, Problem{File: path, Message: err.Error()})
+	}
+
+	slices.SortStableFunc(c.problems, func(a, b Problem) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return c.problems, nil
+}
+
+// LoadConfigStrict loads the config at path like LoadConfig, but refuses
+// it if CheckFile finds problems in the file or its layers.
+func LoadConfigStrict(path string) (*Config, error) {
+	var problems []string
+	for _, file := range LayerFiles(path) {
+		found, err := CheckFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range found {
+			problems = append(problems, p.String())
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("strict mode:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return LoadConfig(path)
+}
+
+type checker struct {
+	file     string
+	data     []byte
+	problems []Problem
+}
+
+// check reports the unknown keys in value, a JSON value of type t found at
+// offset in the file.
+func (c *checker) check(value []byte, offset int, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == flexibleStringSliceType || (t == agentModelConfigType && !bytes.HasPrefix(value, []byte("{"))) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t)
+		c.object(value, offset, func(key string, keyOffset int) (reflect.Type, bool) {
+			for _, field := range fields {
+				if field.name == key {
+					return field.typ, true
+				}
+			}
+			if strings.HasPrefix(key, "_") {
+				return nil, false
+			}
+			c.problems = append(c.problems, problemAt(c.file, c.data, keyOffset, path, unknownKey(key, fields)))
+			return nil, false
+		}, path)
+	case reflect.Map:
+		c.object(value, offset, func(string, int) (reflect.Type, bool) { return t.Elem(), true }, path)
+	case reflect.Slice, reflect.Array:
+		dec := json.NewDecoder(bytes.NewReader(value))
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return
+		}
+		for i := 0; dec.More(); i++ {
+			start := skipSeparators(value, int(dec.InputOffset()))
+			var elem json.RawMessage
+			if dec.Decode(&elem) != nil {
+				return
+			}
+			c.check(elem, offset+start, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+// object walks the keys of a JSON object, checking the value of each key
+// lookup knows the type of.
+func (c *checker) object(
+	value []byte,
+	offset int,
+	lookup func(key string, keyOffset int) (reflect.Type, bool),
+	path string,
+) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return
+	}
+	for dec.More() {
+		keyStart := skipSeparators(value, int(dec.InputOffset()))
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		key, _ := tok.(string)
+		valueStart := skipSeparators(value, int(dec.InputOffset()))
+		var elem json.RawMessage
+		if dec.Decode(&elem) != nil {
+			return
+		}
+		if t, ok := lookup(key, offset+keyStart); ok {
+			c.check(elem, offset+valueStart, t, joinPath(path, key))
+		}
+	}
+}
+
+// skipSeparators returns the offset of the next token in data at or after
+// i, past white space and the commas and colons between tokens.
+func skipSeparators(data []byte, i int) int {
+	for i < len(data) && strings.IndexByte(" \t\r\n,:", data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// unknownKey describes a key that is not one of fields, suggesting the
+// field it was probably meant to be.
+func unknownKey(key string, fields []jsonField) string {
+	msg := fmt.Sprintf("unknown key %q", key)
+	best, bestDistance := "", 3
+	for _, field := range fields {
+		if strings.EqualFold(field.name, key) {
+			best = field.name
+			break
+		}
+		if d := editDistance(key, field.name); d < bestDistance {
+			best, bestDistance = field.name, d
+		}
+	}
+	if best != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", best)
+	}
+	return msg
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// typeErrorOffset returns where the value of a type error starts.
+// encoding/json reports the offset just past the value.
+func typeErrorOffset(data []byte, err *json.UnmarshalTypeError) int {
+	end := int(min(err.Offset, int64(len(data))))
+	if end > 0 && data[end-1] == '"' {
+		return max(bytes.LastIndexByte(data[:end-1], '"'), 0)
+	}
+	start := end
+	for start > 0 && strings.IndexByte(" \t\r\n,:[{", data[start-1]) < 0 {
+		start--
+	}
+	return start
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return t.String()
+}
+
+// problemAt makes a problem at a byte offset in data.
+func problemAt(file string, data []byte, offset int, path, msg string) Problem {
+	offset = min(max(offset, 0), len(data))
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return Problem{File: file, Line: line, Column: column, Path: path, Message: msg}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{
+  "_comment": "comments are allowed",
+  "agents": {
+    "defaults": {"temprature": 0.5, "max_tokens": "lots", "top_p": 0.9},
+    "list": [{"id": "work", "Name": "Work"}]
+  },
+  "channels": {
+    "telegram": {"allow_from": [1, "2"]},
+    "accounts": {"support": {"slack": {"bot_tokn": "x"}}}
+  },
+  "tols": {}
+}`), 0o600)
+
+	problems, err := CheckFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, strings.TrimPrefix(p.String(), path))
+	}
+	want := []string{
+		`:4:18: agents.defaults: unknown key "temprature" (did you mean "temperature"?)`,
+		`:4:51: agents.defaults.max_tokens: expected a whole number, got string`,
+		`:5:29: agents.list[0]: unknown key "Name" (did you mean "name"?)`,
+		`:9:40: channels.accounts.support.slack: unknown key "bot_tokn" (did you mean "bot_token"?)`,
+		`:11:3: unknown key "tols" (did you mean "tools"?)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	os.WriteFile(path, []byte("{\n  \"agents\": {\n    \"defaults\": {,}\n  }\n}"), 0o600)
+	problems, _ = CheckFile(path)
+	if len(problems) != 1 || problems[0].Line != 3 {
+		t.Errorf("syntax error = %v", problems)
+	}
+}
+
+func TestCheckFile_Example(t *testing.T) {
+	problems, err := CheckFile(filepath.Join("..", "..", "config", "config.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+}
+
+func TestLoadConfigStrict(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{"agents": {"defaults": {"max_tokens": 100}}}`), 0o600)
+	os.MkdirAll(ConfDir(path), 0o755)
+	fragment := filepath.Join(ConfDir(path), "extra.json")
+	os.WriteFile(fragment, []byte(`{"heartbeat": {"enabeld": true}}`), 0o600)
+
+	if _, err := LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig = %v; unknown keys are ignored outside strict mode", err)
+	}
+	_, err := LoadConfigStrict(path)
+	if err == nil || !strings.Contains(err.Error(), fragment+`:1:16: heartbeat: unknown key "enabeld"`) {
+		t.Errorf("LoadConfigStrict = %v", err)
+	}
+}
+
+// The published schema is generated; after changing the config types,
+// update it with: go run ./cmd/picoclaw config schema > config/config.schema.json
+func TestSchema_Published(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := os.ReadFile(filepath.Join("..", "..", "config", "config.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(schema, published) {
+		t.Error("config/config.schema.json is out of date")
+	}
+}
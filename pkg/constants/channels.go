@@ -14,3 +14,16 @@ func IsInternalChannel(channel string) bool {
 	_, found := internalChannels[channel]
 	return found
 }
+
+// localChannels are attached to an interactive terminal rather than the
+// gateway, so they must not become the target for heartbeat notifications.
+var localChannels = map[string]struct{}{
+	"terminal": {},
+}
+
+// IsLocalChannel returns true if the channel only exists while a local
+// session such as `picoclaw chat` is running.
+func IsLocalChannel(channel string) bool {
+	_, found := localChannels[channel]
+	return found
+}
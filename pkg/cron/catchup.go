@@ -0,0 +1,126 @@
+package cron
+
+import (
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// Catch-up policies, for runs missed while the service was stopped.
+const (
+	CatchUpOnce = "once" // run the job once soon after the start
+	CatchUpSkip = "skip" // wait for its next run
+)
+
+// CatchUpPolicies are the values a catch-up policy may take.
+var CatchUpPolicies = []string{CatchUpOnce, CatchUpSkip}
+
+// catchUpSpread is the least time catch-up runs are spread over, so a
+// start after a long outage does not run every job in the same second.
+const catchUpSpread = time.Minute
+
+// maxMissedCount is where counting the missed runs of a job stops.
+const maxMissedCount = 1000
+
+// Policy is how the service runs jobs, see SetPolicy.
+type Policy struct {
+	// CatchUp is what happens to the jobs that missed runs while the
+	// service was stopped and set no policy of their own: CatchUpOnce or
+	// CatchUpSkip, which "" stands for.
+	CatchUp string
+	// Jitter is the most a run is delayed, picked at random for each run,
+	// so jobs set for the same minute do not start together. Catch-up
+	// runs are spread over Jitter or a minute, whichever is longer.
+	Jitter time.Duration
+	// MaxConcurrent is how many jobs run at once; one when unset.
+	MaxConcurrent int
+}
+
+// SetPolicy sets how jobs are run. It must be called before Start.
+func (cs *CronService) SetPolicy(p Policy) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.policy = p
+}
+
+// catchUpUnsafe computes the next run of every enabled job when the
+// service starts. Jobs whose run came while it was stopped are caught up
+// as their policy says; the time of the first missed run is kept in
+// MissedAtMS until the catch-up run is done.
+func (cs *CronService) catchUpUnsafe(now int64) {
+	spread := max(cs.policy.Jitter, catchUpSpread)
+	for i := range cs.store.Jobs {
+		job := &cs.store.Jobs[i]
+		if !job.Enabled {
+			continue
+		}
+		due := job.State.NextRunAtMS
+		if due == nil && job.Schedule.Kind == "at" && job.State.LastRunAtMS == nil {
+			due = job.Schedule.AtMS
+		}
+		if due == nil || *due > now {
+			job.State.NextRunAtMS = cs.nextRunUnsafe(&job.Schedule, now)
+			continue
+		}
+
+		missed := missedRuns(&job.Schedule, *due, now)
+		policy := job.CatchUp
+		if policy == "" {
+			policy = cs.policy.CatchUp
+		}
+		log.Printf("[cron] job %s (%s) missed %d run(s) since %s, catch-up: %s",
+			job.ID, job.Name, missed, time.UnixMilli(*due).Format(time.RFC3339), orSkip(policy))
+		job.State.MissedRuns = missed
+		if policy == CatchUpOnce {
+			if job.State.MissedAtMS == nil {
+				job.State.MissedAtMS = due
+			}
+			next := now + rand.Int64N(spread.Milliseconds()+1)
+			job.State.NextRunAtMS = &next
+			continue
+		}
+		job.State.MissedAtMS = nil
+		if job.Schedule.Kind == "at" {
+			// Its time is gone.
+			job.Enabled = false
+			job.State.NextRunAtMS = nil
+			continue
+		}
+		job.State.NextRunAtMS = cs.nextRunUnsafe(&job.Schedule, now)
+	}
+}
+
+func orSkip(policy string) string {
+	if policy == "" {
+		return CatchUpSkip
+	}
+	return policy
+}
+
+// missedRuns counts the runs of schedule from due up to now, at most
+// maxMissedCount.
+func missedRuns(schedule *CronSchedule, due, now int64) int {
+	if schedule.Kind == "every" && schedule.EveryMS != nil && *schedule.EveryMS > 0 {
+		return int(min((now-due) / *schedule.EveryMS + 1, maxMissedCount))
+	}
+	n := 1
+	for at := due; n < maxMissedCount; n++ {
+		next := computeNextRun(schedule, at)
+		if next == nil || *next > now || *next <= at {
+			break
+		}
+		at = *next
+	}
+	return n
+}
+
+// nextRunUnsafe returns the next run of schedule after now, delayed by the
+// policy's jitter unless it is a one-time run.
+func (cs *CronService) nextRunUnsafe(schedule *CronSchedule, now int64) *int64 {
+	next := computeNextRun(schedule, now)
+	if next == nil || schedule.Kind == "at" || cs.policy.Jitter <= 0 {
+		return next
+	}
+	jittered := *next + rand.Int64N(cs.policy.Jitter.Milliseconds()+1)
+	return &jittered
+}
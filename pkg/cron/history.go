@@ -0,0 +1,99 @@
+package cron
+
+import (
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// maxHistory is how many of its latest runs a job keeps.
+const maxHistory = 10
+
+// maxRunOutput caps the output of a run that is kept, in bytes.
+const maxRunOutput = 300
+
+// RunRecord is one run of a job. Its TaskID is set on the job handed to
+// the JobHandler as State.TaskID, so what the run did elsewhere, such as
+// its LLM requests, can carry it too.
+type RunRecord struct {
+	TaskID      string `json:"taskId"`
+	StartedAtMS int64  `json:"startedAtMs"`
+	DurationMS  int64  `json:"durationMs"`
+	Status      string `json:"status"` // "ok" or "error"
+	Error       string `json:"error,omitempty"`
+	Output      string `json:"output,omitempty"`
+	Late        bool   `json:"late,omitempty"` // caught up after the service was down
+}
+
+// Alerter is told when a job has failed as many times in a row as
+// SetAlerter says, and when it runs fine again after that; its
+// State.ConsecutiveFailures is then 0.
+type Alerter func(job CronJob)
+
+// SetAlerter has the service call alert once a job failed after times in
+// a row, and again when it recovers. It must be called before Start.
+func (cs *CronService) SetAlerter(after int, alert Alerter) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.alertAfter = after
+	cs.alert = alert
+}
+
+// recordRunUnsafe adds a run to the history of job and counts its failures
+// in a row, alerting when they reach the threshold or end after it.
+func (cs *CronService) recordRunUnsafe(job *CronJob, run RunRecord, output string, err error) {
+	run.Status = "ok"
+	run.Output = truncateOutput(output)
+	failures := job.State.ConsecutiveFailures
+	if err != nil {
+		run.Status, run.Error = "error", err.Error()
+		job.State.ConsecutiveFailures++
+	} else {
+		job.State.ConsecutiveFailures = 0
+	}
+	job.State.History = append(job.State.History, run)
+	if n := len(job.State.History); n > maxHistory {
+		job.State.History = job.State.History[n-maxHistory:]
+	}
+
+	if cs.alert == nil || cs.alertAfter <= 0 {
+		return
+	}
+	failing := job.State.ConsecutiveFailures == cs.alertAfter
+	recovered := err == nil && failures >= cs.alertAfter
+	if failing || recovered {
+		if failing {
+			log.Printf("[cron] job %s (%s) failed %d times in a row", job.ID, job.Name, cs.alertAfter)
+		}
+		go cs.alert(*job)
+	}
+}
+
+// truncateOutput shortens s to maxRunOutput bytes, on a rune boundary.
+func truncateOutput(s string) string {
+	if len(s) <= maxRunOutput {
+		return s
+	}
+	cut := maxRunOutput
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
+
+// LastRun returns the latest run of job, if it ran.
+func (j CronJob) LastRun() (RunRecord, bool) {
+	if len(j.State.History) == 0 {
+		return RunRecord{}, false
+	}
+	return j.State.History[len(j.State.History)-1], true
+}
+
+// newTaskID returns the ID of a run, short enough to be typed.
+func newTaskID() string {
+	return generateID()[:8]
+}
+
+func msSince(startMS int64) int64 {
+	return time.Now().UnixMilli() - startMS
+}
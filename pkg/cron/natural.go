@@ -0,0 +1,589 @@
+package cron
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+)
+
+// defaultHour is the time, 9:00, of schedules that name a day but no time
+// of day, such as "first monday of the month".
+const defaultHour = 9
+
+// clock is a time of day.
+type clock struct{ hour, minute int }
+
+var weekdayNames = map[string]int{
+	"sunday": 0, "sun": 0,
+	"monday": 1, "mon": 1,
+	"tuesday": 2, "tue": 2, "tues": 2,
+	"wednesday": 3, "wed": 3,
+	"thursday": 4, "thu": 4, "thur": 4, "thurs": 4,
+	"friday": 5, "fri": 5,
+	"saturday": 6, "sat": 6,
+}
+
+var monthNames = map[string]time.Month{
+	"january": 1, "jan": 1, "february": 2, "feb": 2, "march": 3, "mar": 3, "april": 4, "apr": 4,
+	"may": 5, "june": 6, "jun": 6, "july": 7, "jul": 7, "august": 8, "aug": 8,
+	"september": 9, "sep": 9, "sept": 9, "october": 10, "oct": 10, "november": 11, "nov": 11,
+	"december": 12, "dec": 12,
+}
+
+var ordinalNames = map[string]string{
+	"first": "1", "1st": "1", "second": "2", "2nd": "2", "third": "3", "3rd": "3",
+	"fourth": "4", "4th": "4", "fifth": "5", "5th": "5", "last": "L",
+}
+
+// timeWords are the times of day a schedule may name instead of a clock
+// time.
+var timeWords = map[string]clock{
+	"midnight": {0, 0}, "morning": {8, 0}, "noon": {12, 0}, "midday": {12, 0},
+	"afternoon": {15, 0}, "evening": {18, 0}, "night": {21, 0}, "tonight": {21, 0},
+}
+
+const clockPattern = `\d{1,2}(?::\d{2})?(?:\s*[ap]\.?m\.?)?`
+
+var (
+	atTimesRe   = regexp.MustCompile(`\bat\s+(` + clockPattern + `(?:\s*(?:,|and)\s*` + clockPattern + `)*)(?:\s|$)`)
+	bareTimeRe  = regexp.MustCompile(`\b\d{1,2}(?::\d{2})?\s*[ap]\.?m\.?(?:\s|$)|\b\d{1,2}:\d{2}\b`)
+	timeWordRe  = regexp.MustCompile(`\b(?:(?:at|in the|every)\s+)?(midnight|morning|noon|midday|afternoon|evening|night)\b`)
+	clockRe     = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(?:([ap])\.?m\.?)?$`)
+	listSplitRe = regexp.MustCompile(`\s*(?:,|\band\b|&)\s*`)
+
+	intervalRe    = regexp.MustCompile(`^(?:every|each)\s+(?:(\d+|other)\s+)?(minute|min|hour|hr|day|week|month)s?$`)
+	dailyRe       = regexp.MustCompile(`^(?:(?:every|each)(?:\s+(?:day|single day))?|daily)$`)
+	weekdaysRe    = regexp.MustCompile(`^(?:(?:every|each|on)\s+)?(?:weekday|week day|workday|work day|business day)s?$`)
+	weekendsRe    = regexp.MustCompile(`^(?:(?:every|each|on)\s+)?(?:the\s+)?weekends?$`)
+	nthWeekdayRe  = regexp.MustCompile(`^(?:(?:every|on)\s+)?(?:the\s+)?(first|1st|second|2nd|third|3rd|fourth|4th|fifth|5th|last)\s+([a-z]+)\s+(?:of|in)\s+(?:the|every|each|a)\s+month$`)
+	monthDayRe    = regexp.MustCompile(`^(?:(?:every|each)\s+month|monthly)(?:\s+on)?(?:\s+the)?\s+(\d{1,2}|last)(?:st|nd|rd|th)?(?:\s+day)?$`)
+	monthDayOfRe  = regexp.MustCompile(`^(?:on\s+)?(?:the\s+)?(\d{1,2}|last)(?:st|nd|rd|th)?(?:\s+day)?\s+of\s+(?:the|every|each|a)\s+month$`)
+	monthlyRe     = regexp.MustCompile(`^(?:(?:every|each)\s+month|monthly)$`)
+	yearlyRe      = regexp.MustCompile(`^(?:every\s+year\s+on|(?:yearly|annually)\s+on|every|each)\s+(?:the\s+)?(.+)$`)
+	inRe          = regexp.MustCompile(`^in\s+(\d+|a|an|one|half an)\s+(minute|min|hour|hr|day|week)s?$`)
+	relativeDayRe = regexp.MustCompile(`^(today|tonight|tomorrow|the day after tomorrow)$`)
+	isoDateRe     = regexp.MustCompile(`^(?:on\s+)?(\d{4})-(\d{2})-(\d{2})$`)
+	dayMonthRe    = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?([a-z]+)$`)
+	monthDayNumRe = regexp.MustCompile(`^([a-z]+)\s+(\d{1,2})(?:st|nd|rd|th)?$`)
+)
+
+// ParseSchedule reads a schedule written in English, such as "every
+// weekday at 8", "first monday of the month at 9:30", "every 15
+// minutes", "mondays and thursdays at 7pm" or "tomorrow at noon", into a
+// CronSchedule in loc. A cron expression is taken as it is. Days without
+// a time are at 9:00; one-time schedules are relative to now. The
+// schedule keeps text and, unless loc is time.Local, the time zone.
+func ParseSchedule(text string, loc *time.Location, now time.Time) (CronSchedule, error) {
+	text = strings.TrimSpace(text)
+	if loc == nil {
+		loc = time.Local
+	}
+	schedule, err := parseSchedule(text, loc, now.In(loc))
+	if err != nil {
+		return CronSchedule{}, err
+	}
+	schedule.Text = text
+	if loc != time.Local {
+		schedule.TZ = loc.String()
+	}
+	return schedule, nil
+}
+
+func parseSchedule(text string, loc *time.Location, now time.Time) (CronSchedule, error) {
+	if len(strings.Fields(text)) >= 5 || strings.HasPrefix(text, "@") {
+		if gronx.New().IsValid(text) {
+			return CronSchedule{Kind: "cron", Expr: text}, nil
+		}
+		if strings.HasPrefix(text, "@") || looksLikeCron(text) {
+			return CronSchedule{}, fmt.Errorf("%q is not a valid cron expression", text)
+		}
+	}
+
+	s := strings.ToLower(text)
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	s = strings.Join(strings.Fields(s), " ")
+
+	rest, times, err := takeTimes(s)
+	if err != nil {
+		return CronSchedule{}, err
+	}
+	hours, minute, err := cronTimes(times)
+	if err != nil {
+		return CronSchedule{}, err
+	}
+	daily := func(dom, dow string) CronSchedule {
+		return CronSchedule{Kind: "cron", Expr: fmt.Sprintf("%d %s %s * %s", minute, hours, dom, dow)}
+	}
+
+	switch {
+	case rest == "":
+		if len(times) != 1 {
+			return CronSchedule{}, unreadable(text)
+		}
+		return once(nextAt(now, times[0], 0)), nil
+
+	case intervalRe.MatchString(rest):
+		m := intervalRe.FindStringSubmatch(rest)
+		n := 1
+		switch m[1] {
+		case "":
+		case "other":
+			n = 2
+		default:
+			n, _ = strconv.Atoi(m[1])
+		}
+		if n <= 0 {
+			return CronSchedule{}, unreadable(text)
+		}
+		return interval(text, n, m[2], times, hours, minute, daily)
+
+	case dailyRe.MatchString(rest):
+		return daily("*", "*"), nil
+	case weekdaysRe.MatchString(rest):
+		return daily("*", "1-5"), nil
+	case weekendsRe.MatchString(rest):
+		return daily("*", "0,6"), nil
+
+	case monthDayRe.MatchString(rest) || monthDayOfRe.MatchString(rest):
+		m := monthDayRe.FindStringSubmatch(rest)
+		if m == nil {
+			m = monthDayOfRe.FindStringSubmatch(rest)
+		}
+		if m[1] == "last" {
+			return daily("L", "*"), nil
+		}
+		if d, _ := strconv.Atoi(m[1]); d < 1 || d > 31 {
+			return CronSchedule{}, fmt.Errorf("there is no day %d in a month", d)
+		}
+		return daily(m[1], "*"), nil
+	case monthlyRe.MatchString(rest):
+		return daily("1", "*"), nil
+
+	case nthWeekdayRe.MatchString(rest):
+		m := nthWeekdayRe.FindStringSubmatch(rest)
+		day, ok := weekday(m[2])
+		if !ok {
+			return CronSchedule{}, unreadable(text)
+		}
+		if n := ordinalNames[m[1]]; n != "L" {
+			return daily("*", fmt.Sprintf("%d#%s", day, n)), nil
+		}
+		return daily("*", fmt.Sprintf("%dL", day)), nil
+
+	case inRe.MatchString(rest):
+		m := inRe.FindStringSubmatch(rest)
+		d := unitDuration(m[2])
+		switch m[1] {
+		case "a", "an", "one":
+		case "half an":
+			d /= 2
+		default:
+			n, _ := strconv.Atoi(m[1])
+			d *= time.Duration(n)
+		}
+		if len(times) > 0 {
+			if d < 24*time.Hour {
+				return CronSchedule{}, unreadable(text)
+			}
+			return onDay(now.Add(d), times)
+		}
+		return once(now.Add(d)), nil
+
+	case relativeDayRe.MatchString(rest):
+		day := now
+		switch rest {
+		case "tomorrow":
+			day = now.AddDate(0, 0, 1)
+		case "the day after tomorrow":
+			day = now.AddDate(0, 0, 2)
+		case "tonight":
+			if len(times) == 0 {
+				times = []clock{timeWords["tonight"]}
+			}
+		case "today":
+			if len(times) == 0 {
+				return CronSchedule{}, fmt.Errorf("say at what time today, e.g. %q", "today at 17:00")
+			}
+		}
+		return onDay(day, times)
+
+	case isoDateRe.MatchString(rest):
+		m := isoDateRe.FindStringSubmatch(rest)
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		day := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, loc)
+		if day.Month() != time.Month(mo) || day.Day() != d {
+			return CronSchedule{}, fmt.Errorf("%s is not a date", m[0])
+		}
+		return onDay(day, times)
+	}
+
+	// Week days: "every monday and friday" and "mondays" repeat, "on
+	// friday" is the next one.
+	if days, recurring, ok := weekdayList(rest); ok {
+		if recurring {
+			return daily("*", joinInts(days)), nil
+		}
+		if len(days) != 1 {
+			return CronSchedule{}, unreadable(text)
+		}
+		day := now.AddDate(0, 0, (days[0]-int(now.Weekday())+7)%7)
+		if t := firstTime(times); !time.Date(day.Year(), day.Month(), day.Day(), t.hour, t.minute, 0, 0, loc).After(now) {
+			day = day.AddDate(0, 0, 7)
+		}
+		return onDay(day, times)
+	}
+
+	// Dates: "every march 3rd" repeats, "on 3 march" is the next one.
+	if m := yearlyRe.FindStringSubmatch(rest); m != nil {
+		if month, day, ok := monthDay(m[1]); ok {
+			return CronSchedule{Kind: "cron", Expr: fmt.Sprintf("%d %s %d %d *", minute, hours, day, month)}, nil
+		}
+	}
+	if month, day, ok := monthDay(strings.TrimPrefix(strings.TrimPrefix(rest, "on "), "the ")); ok {
+		date := time.Date(now.Year(), month, day, 0, 0, 0, 0, loc)
+		if date.Day() != day {
+			return CronSchedule{}, unreadable(text)
+		}
+		if t := firstTime(times); time.Date(date.Year(), month, day, t.hour, t.minute, 0, 0, loc).Before(now) {
+			date = date.AddDate(1, 0, 0)
+		}
+		return onDay(date, times)
+	}
+
+	return CronSchedule{}, unreadable(text)
+}
+
+// looksLikeCron reports whether text is made of cron fields rather than
+// words.
+func looksLikeCron(text string) bool {
+	for _, f := range strings.Fields(text) {
+		if strings.Trim(f, "0123456789*,-/?LW#") != "" && len(f) > 3 {
+			return false
+		}
+	}
+	return true
+}
+
+func unreadable(text string) error {
+	return fmt.Errorf("cannot read the schedule %q; try e.g. \"every weekday at 8\", "+
+		"\"first monday of the month at 9:30\", \"every 2 hours\", \"tomorrow at 7pm\" or a cron expression", text)
+}
+
+// takeTimes removes the times of day from s and returns them.
+func takeTimes(s string) (string, []clock, error) {
+	var times []clock
+	var err error
+	add := func(text string) {
+		for _, item := range listSplitRe.Split(strings.TrimSpace(text), -1) {
+			if item == "" {
+				continue
+			}
+			t, ok := parseClock(item)
+			if !ok {
+				err = fmt.Errorf("%q is not a time of day", item)
+				return
+			}
+			times = append(times, t)
+		}
+	}
+	s = atTimesRe.ReplaceAllStringFunc(s, func(m string) string {
+		add(atTimesRe.FindStringSubmatch(m)[1])
+		return " "
+	})
+	s = bareTimeRe.ReplaceAllStringFunc(s, func(m string) string {
+		add(m)
+		return " "
+	})
+	s = timeWordRe.ReplaceAllStringFunc(s, func(m string) string {
+		word := timeWordRe.FindStringSubmatch(m)[1]
+		times = append(times, timeWords[word])
+		// "every morning" is every day; "tonight" names the day too.
+		if strings.HasPrefix(m, "every ") {
+			return " every "
+		}
+		return " "
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	fields := strings.Fields(s)
+	trim := []string{"and", ",", "at", "on", "from", "starting", "please"}
+	for len(fields) > 0 && slices.Contains(trim, fields[len(fields)-1]) {
+		fields = fields[:len(fields)-1]
+	}
+	for len(fields) > 0 && slices.Contains([]string{"and", ",", "at", "please"}, fields[0]) {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " "), times, nil
+}
+
+// parseClock reads "8", "8:30", "8pm" or "20:15".
+func parseClock(s string) (clock, bool) {
+	m := clockRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return clock{}, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	min := 0
+	if m[2] != "" {
+		min, _ = strconv.Atoi(m[2])
+	}
+	switch m[3] {
+	case "a":
+		if h < 1 || h > 12 {
+			return clock{}, false
+		}
+		h %= 12
+	case "p":
+		if h < 1 || h > 12 {
+			return clock{}, false
+		}
+		h = h%12 + 12
+	}
+	if h > 23 || min > 59 {
+		return clock{}, false
+	}
+	return clock{h, min}, true
+}
+
+// cronTimes returns the hour and minute fields of times, which must share
+// their minute. Without times it is 9:00.
+func cronTimes(times []clock) (string, int, error) {
+	if len(times) == 0 {
+		return strconv.Itoa(defaultHour), 0, nil
+	}
+	var hours []int
+	for _, t := range times {
+		if t.minute != times[0].minute {
+			return "", 0, fmt.Errorf("times of one schedule must share their minutes, e.g. 9:30 and 17:30")
+		}
+		if !slices.Contains(hours, t.hour) {
+			hours = append(hours, t.hour)
+		}
+	}
+	slices.Sort(hours)
+	return joinInts(hours), times[0].minute, nil
+}
+
+// interval is a schedule of every n units.
+func interval(text string, n int, unit string, times []clock, hours string, minute int,
+	daily func(dom, dow string) CronSchedule,
+) (CronSchedule, error) {
+	switch unit {
+	case "minute", "min", "hour", "hr":
+		if len(times) > 0 {
+			return CronSchedule{}, unreadable(text)
+		}
+		// Steps that divide the hour or day keep to the clock.
+		if unit == "minute" || unit == "min" {
+			if n == 1 {
+				return CronSchedule{Kind: "cron", Expr: "* * * * *"}, nil
+			}
+			if 60%n == 0 {
+				return CronSchedule{Kind: "cron", Expr: fmt.Sprintf("*/%d * * * *", n)}, nil
+			}
+		} else if n == 1 {
+			return CronSchedule{Kind: "cron", Expr: "0 * * * *"}, nil
+		} else if 24%n == 0 {
+			return CronSchedule{Kind: "cron", Expr: fmt.Sprintf("0 */%d * * *", n)}, nil
+		}
+		every := (time.Duration(n) * unitDuration(unit)).Milliseconds()
+		return CronSchedule{Kind: "every", EveryMS: &every}, nil
+	case "day":
+		if n == 1 {
+			return daily("*", "*"), nil
+		}
+		// Counted in days of the month, so the 31st and the 1st may
+		// follow each other.
+		return daily(fmt.Sprintf("*/%d", n), "*"), nil
+	case "week":
+		if n == 1 {
+			return daily("*", "1"), nil
+		}
+		if len(times) > 0 {
+			return CronSchedule{}, unreadable(text)
+		}
+		every := (time.Duration(n) * 7 * 24 * time.Hour).Milliseconds()
+		return CronSchedule{Kind: "every", EveryMS: &every}, nil
+	case "month":
+		if n == 1 {
+			return daily("1", "*"), nil
+		}
+		return CronSchedule{Kind: "cron", Expr: fmt.Sprintf("%d %s 1 */%d *", minute, hours, n)}, nil
+	}
+	return CronSchedule{}, unreadable(text)
+}
+
+func unitDuration(unit string) time.Duration {
+	switch unit {
+	case "minute", "min":
+		return time.Minute
+	case "hour", "hr":
+		return time.Hour
+	case "day":
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// weekdayList reads "monday", "mondays and fridays" or "every tue, thu".
+// Schedules that start with every or each, or name days in the plural,
+// repeat.
+func weekdayList(s string) ([]int, bool, bool) {
+	recurring := false
+	for _, prefix := range []string{"every ", "each ", "on "} {
+		if strings.HasPrefix(s, prefix) {
+			recurring = prefix != "on "
+			s = strings.TrimPrefix(s, prefix)
+			break
+		}
+	}
+	var days []int
+	for _, item := range listSplitRe.Split(s, -1) {
+		for _, word := range strings.Fields(item) {
+			day, ok := weekday(word)
+			if !ok {
+				day, ok = weekday(strings.TrimSuffix(word, "s"))
+				if !ok {
+					return nil, false, false
+				}
+				recurring = true
+			}
+			if !slices.Contains(days, day) {
+				days = append(days, day)
+			}
+		}
+	}
+	slices.Sort(days)
+	return days, recurring, len(days) > 0
+}
+
+func weekday(word string) (int, bool) {
+	d, ok := weekdayNames[word]
+	return d, ok
+}
+
+// monthDay reads "march 3", "march 3rd", "3 march" or "3rd of march".
+func monthDay(s string) (time.Month, int, bool) {
+	var monthWord, dayWord string
+	if m := monthDayNumRe.FindStringSubmatch(s); m != nil {
+		monthWord, dayWord = m[1], m[2]
+	} else if m := dayMonthRe.FindStringSubmatch(s); m != nil {
+		dayWord, monthWord = m[1], m[2]
+	} else {
+		return 0, 0, false
+	}
+	month, ok := monthNames[monthWord]
+	day, _ := strconv.Atoi(dayWord)
+	if !ok || day < 1 || day > 31 {
+		return 0, 0, false
+	}
+	return month, day, true
+}
+
+func firstTime(times []clock) clock {
+	if len(times) == 0 {
+		return clock{defaultHour, 0}
+	}
+	return times[0]
+}
+
+// nextAt returns the first time t of day after now, days or more ahead.
+func nextAt(now time.Time, t clock, days int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day()+days, t.hour, t.minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// onDay is a one-time schedule on day at the one time given, 9:00
+// without.
+func onDay(day time.Time, times []clock) (CronSchedule, error) {
+	if len(times) > 1 {
+		return CronSchedule{}, fmt.Errorf("a one-time schedule takes one time of day")
+	}
+	t := firstTime(times)
+	at := time.Date(day.Year(), day.Month(), day.Day(), t.hour, t.minute, 0, 0, day.Location())
+	return once(at), nil
+}
+
+func once(at time.Time) CronSchedule {
+	ms := at.UnixMilli()
+	return CronSchedule{Kind: "at", AtMS: &ms}
+}
+
+func joinInts(values []int) string {
+	words := make([]string, len(values))
+	for i, v := range values {
+		words[i] = strconv.Itoa(v)
+	}
+	return strings.Join(words, ",")
+}
+
+// NextRuns returns the next n runs of schedule after after, fewer for
+// one-time schedules or when they cannot be computed.
+func NextRuns(schedule CronSchedule, after time.Time, n int) []time.Time {
+	var runs []time.Time
+	ms := after.UnixMilli()
+	for len(runs) < n {
+		next := computeNextRun(&schedule, ms)
+		if next == nil || *next <= ms {
+			break
+		}
+		runs = append(runs, time.UnixMilli(*next))
+		ms = *next
+	}
+	return runs
+}
+
+// String describes the schedule: the text it was written as, or else its
+// cron expression, interval or time, and its time zone.
+func (s CronSchedule) String() string {
+	var desc string
+	switch {
+	case s.Text != "":
+		desc = s.Text
+	case s.Kind == "cron":
+		desc = s.Expr
+	case s.Kind == "every" && s.EveryMS != nil:
+		// 1h0m0s reads better as 1h.
+		every := (time.Duration(*s.EveryMS) * time.Millisecond).String()
+		if strings.HasSuffix(every, "m0s") {
+			every = strings.TrimSuffix(every, "0s")
+		}
+		if strings.HasSuffix(every, "h0m") {
+			every = strings.TrimSuffix(every, "0m")
+		}
+		desc = "every " + every
+	case s.Kind == "at" && s.AtMS != nil:
+		desc = "once at " + time.UnixMilli(*s.AtMS).In(s.Location()).Format("2006-01-02 15:04")
+	default:
+		desc = s.Kind
+	}
+	if s.TZ != "" && s.Kind != "every" {
+		desc += " (" + s.TZ + ")"
+	}
+	return desc
+}
+
+// Location returns the time zone of the schedule, the local one when it
+// has none or it is unknown.
+func (s CronSchedule) Location() *time.Location {
+	if s.TZ == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(s.TZ)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
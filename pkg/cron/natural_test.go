@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, berlin) // a Saturday
+
+	recurring := map[string]string{
+		"every weekday at 8":                       "0 8 * * 1-5",
+		"Every weekday at 8:30am.":                 "30 8 * * 1-5",
+		"first Monday of the month":                "0 9 * * 1#1",
+		"on the last friday of every month at 5pm": "0 17 * * 5L",
+		"every day at 7 and 19":                    "0 7,19 * * *",
+		"daily at 9:30, 13:30 and 18:30":           "30 9,13,18 * * *",
+		"every morning":                            "0 8 * * *",
+		"weekends at noon":                         "0 12 * * 0,6",
+		"mondays and thursdays at 7pm":             "0 19 * * 1,4",
+		"every tue, thu at 6":                      "0 6 * * 2,4",
+		"every 15 minutes":                         "*/15 * * * *",
+		"every hour":                               "0 * * * *",
+		"every 6 hours":                            "0 */6 * * *",
+		"every month on the 15th at 10":            "0 10 15 * *",
+		"the last day of the month at 23:00":       "0 23 L * *",
+		"every march 3rd at 8":                     "0 8 3 3 *",
+		"every week":                               "0 9 * * 1",
+		"0 9 * * 1-5":                              "0 9 * * 1-5",
+		"every other day at 6am":                   "0 6 */2 * *",
+		"monthly":                                  "0 9 1 * *",
+	}
+	for text, want := range recurring {
+		s, err := ParseSchedule(text, berlin, now)
+		if err != nil || s.Kind != "cron" || s.Expr != want {
+			t.Errorf("ParseSchedule(%q) = %+v, %v; want cron %q", text, s, err, want)
+			continue
+		}
+		if s.TZ != "Europe/Berlin" || s.Text != strings.TrimSpace(text) {
+			t.Errorf("ParseSchedule(%q) keeps %q, %q", text, s.TZ, s.Text)
+		}
+	}
+
+	if s, err := ParseSchedule("every 45 minutes", berlin, now); err != nil || s.Kind != "every" || *s.EveryMS != 45*60*1000 {
+		t.Errorf("every 45 minutes = %+v, %v", s, err)
+	}
+
+	once := map[string]string{
+		"tomorrow at 7pm":      "2026-10-18 19:00",
+		"at 17:30":             "2026-10-17 17:30",
+		"at 8":                 "2026-10-18 08:00",
+		"in 10 minutes":        "2026-10-17 10:10",
+		"in half an hour":      "2026-10-17 10:30",
+		"tonight":              "2026-10-17 21:00",
+		"on friday":            "2026-10-23 09:00",
+		"saturday at 9":        "2026-10-24 09:00",
+		"2026-12-24 at 18:00":  "2026-12-24 18:00",
+		"on 3 march":           "2027-03-03 09:00",
+		"november 5th at noon": "2026-11-05 12:00",
+	}
+	for text, want := range once {
+		s, err := ParseSchedule(text, berlin, now)
+		if err != nil || s.Kind != "at" {
+			t.Errorf("ParseSchedule(%q) = %+v, %v; want one-time", text, s, err)
+			continue
+		}
+		if got := time.UnixMilli(*s.AtMS).In(berlin).Format("2006-01-02 15:04"); got != want {
+			t.Errorf("ParseSchedule(%q) at %s, want %s", text, got, want)
+		}
+	}
+
+	for _, text := range []string{"whenever", "every day at 9 and 17:30", "at 25:00", "the 32nd of the month", "today", "0 9 * * 1-8"} {
+		if s, err := ParseSchedule(text, berlin, now); err == nil {
+			t.Errorf("ParseSchedule(%q) = %+v, want an error", text, s)
+		}
+	}
+}
+
+func TestNextRuns(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, berlin)
+	s, err := ParseSchedule("first monday of the month at 9:30", berlin, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, run := range NextRuns(s, now, 3) {
+		got = append(got, run.In(berlin).Format("2006-01-02 15:04"))
+	}
+	if want := "2026-11-02 09:30 2026-12-07 09:30 2027-01-04 09:30"; strings.Join(got, " ") != want {
+		t.Errorf("NextRuns = %v, want %s", got, want)
+	}
+
+	// The time zone, not the gateway's, sets the hour.
+	s.TZ = "America/New_York"
+	runs := NextRuns(s, now, 1)
+	if len(runs) != 1 || runs[0].UTC().Format("15:04") != "14:30" {
+		t.Errorf("NextRuns in New York = %v", runs)
+	}
+
+	once, _ := ParseSchedule("tomorrow at 8", berlin, now)
+	if runs := NextRuns(once, now, 3); len(runs) != 1 {
+		t.Errorf("NextRuns of a one-time schedule = %v", runs)
+	}
+	if desc := once.String(); desc != "tomorrow at 8 (Europe/Berlin)" {
+		t.Errorf("String() = %q", desc)
+	}
+}
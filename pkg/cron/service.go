@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -19,7 +20,8 @@ type CronSchedule struct {
 	AtMS    *int64 `json:"atMs,omitempty"`
 	EveryMS *int64 `json:"everyMs,omitempty"`
 	Expr    string `json:"expr,omitempty"`
-	TZ      string `json:"tz,omitempty"`
+	TZ      string `json:"tz,omitempty"`   // IANA name the cron expression is read in; empty = local time
+	Text    string `json:"text,omitempty"` // the schedule as written, see ParseSchedule
 }
 
 type CronPayload struct {
@@ -29,6 +31,12 @@ type CronPayload struct {
 	Deliver bool   `json:"deliver"`
 	Channel string `json:"channel,omitempty"`
 	To      string `json:"to,omitempty"`
+	// Workflow is the workflow the job runs, see pkg/workflow.
+	Workflow string `json:"workflow,omitempty"`
+	// Session is the conversation a follow-up the agent scheduled for
+	// itself continues, and Context what it noted for then.
+	Session string `json:"session,omitempty"`
+	Context string `json:"context,omitempty"`
 }
 
 type CronJobState struct {
@@ -36,6 +44,18 @@ type CronJobState struct {
 	LastRunAtMS *int64 `json:"lastRunAtMs,omitempty"`
 	LastStatus  string `json:"lastStatus,omitempty"`
 	LastError   string `json:"lastError,omitempty"`
+	// MissedRuns is how many runs the job missed while the service was
+	// last stopped, and MissedAtMS when the first of them was due; it is
+	// set until the catch-up run is done.
+	MissedRuns int    `json:"missedRuns,omitempty"`
+	MissedAtMS *int64 `json:"missedAtMs,omitempty"`
+	// ConsecutiveFailures counts the failed runs since the last good one.
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// History is the latest runs, oldest first, see RunRecord.
+	History []RunRecord `json:"history,omitempty"`
+	// TaskID is the ID of the run, set only on the job given to the
+	// JobHandler.
+	TaskID string `json:"-"`
 }
 
 type CronJob struct {
@@ -48,6 +68,9 @@ type CronJob struct {
 	CreatedAtMS    int64        `json:"createdAtMs"`
 	UpdatedAtMS    int64        `json:"updatedAtMs"`
 	DeleteAfterRun bool         `json:"deleteAfterRun"`
+	// CatchUp is the job's catch-up policy, CatchUpOnce or CatchUpSkip;
+	// the service's when empty, see Policy.
+	CatchUp string `json:"catchUp,omitempty"`
 }
 
 type CronStore struct {
@@ -57,14 +80,23 @@ type CronStore struct {
 
 type JobHandler func(job *CronJob) (string, error)
 
+// JobClaimer reports whether this instance runs a due job, for gateways
+// that share their jobs. Whoever claims the job first runs it; ttl is how
+// long the claim holds, a little less than the time to the next run.
+type JobClaimer func(jobID string, ttl time.Duration) bool
+
 type CronService struct {
-	storePath string
-	store     *CronStore
-	onJob     JobHandler
-	mu        sync.RWMutex
-	running   bool
-	stopChan  chan struct{}
-	gronx     *gronx.Gronx
+	storePath  string
+	store      *CronStore
+	onJob      JobHandler
+	claim      JobClaimer
+	policy     Policy
+	alert      Alerter
+	alertAfter int
+	mu         sync.RWMutex
+	running    bool
+	stopChan   chan struct{}
+	gronx      *gronx.Gronx
 }
 
 func NewCronService(storePath string, onJob JobHandler) *CronService {
@@ -90,7 +122,7 @@ func (cs *CronService) Start() error {
 		return fmt.Errorf("failed to load store: %w", err)
 	}
 
-	cs.recomputeNextRuns()
+	cs.catchUpUnsafe(time.Now().UnixMilli())
 	if err := cs.saveStoreUnsafe(); err != nil {
 		return fmt.Errorf("failed to save store: %w", err)
 	}
@@ -141,14 +173,18 @@ func (cs *CronService) checkJobs() {
 
 	now := time.Now().UnixMilli()
 	var dueJobIDs []string
+	claimTTLs := make(map[string]time.Duration)
 
 	// Collect jobs that are due (we need to copy them to execute outside lock)
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
 		if job.Enabled && job.State.NextRunAtMS != nil && *job.State.NextRunAtMS <= now {
 			dueJobIDs = append(dueJobIDs, job.ID)
+			claimTTLs[job.ID] = cs.claimTTL(job)
 		}
 	}
+	claim := cs.claim
+	slots := max(cs.policy.MaxConcurrent, 1)
 
 	// Reset next run for due jobs before unlocking to avoid duplicate execution.
 	dueMap := make(map[string]bool, len(dueJobIDs))
@@ -167,21 +203,57 @@ func (cs *CronService) checkJobs() {
 
 	cs.mu.Unlock()
 
-	// Execute jobs outside lock.
+	// Execute jobs outside lock, no more than slots at once. Jobs due
+	// later wait for this batch, so no job runs twice at the same time.
+	sem := make(chan struct{}, slots)
+	var wg sync.WaitGroup
 	for _, jobID := range dueJobIDs {
-		cs.executeJobByID(jobID)
+		if claim != nil && !claim(jobID, claimTTLs[jobID]) {
+			cs.skipJobByID(jobID)
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			cs.executeJobByID(jobID)
+		}()
+	}
+	wg.Wait()
+}
+
+// claimTTL returns how long a claim on the due run of job holds: nine
+// tenths of the time to the run after it, so instances whose schedules
+// are a little apart still claim the same run.
+func (cs *CronService) claimTTL(job *CronJob) time.Duration {
+	interval := 24 * time.Hour
+	switch job.Schedule.Kind {
+	case "every":
+		if job.Schedule.EveryMS != nil {
+			interval = time.Duration(*job.Schedule.EveryMS) * time.Millisecond
+		}
+	case "cron":
+		due := *job.State.NextRunAtMS
+		if next := computeNextRun(&job.Schedule, due); next != nil {
+			interval = time.Duration(*next-due) * time.Millisecond
+		}
 	}
+	return max(interval*9/10, time.Second)
 }
 
 func (cs *CronService) executeJobByID(jobID string) {
 	startTime := time.Now().UnixMilli()
 
+	taskID := newTaskID()
+
 	cs.mu.RLock()
 	var callbackJob *CronJob
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
 		if job.ID == jobID {
 			jobCopy := *job
+			jobCopy.State.History = slices.Clone(job.State.History)
+			jobCopy.State.TaskID = taskID
 			callbackJob = &jobCopy
 			break
 		}
@@ -192,9 +264,10 @@ func (cs *CronService) executeJobByID(jobID string) {
 		return
 	}
 
+	var output string
 	var err error
 	if cs.onJob != nil {
-		_, err = cs.onJob(callbackJob)
+		output, err = cs.onJob(callbackJob)
 	}
 
 	// Now acquire lock to update state
@@ -213,7 +286,9 @@ func (cs *CronService) executeJobByID(jobID string) {
 		return
 	}
 
+	run := RunRecord{TaskID: taskID, StartedAtMS: startTime, DurationMS: msSince(startTime), Late: job.State.MissedAtMS != nil}
 	job.State.LastRunAtMS = &startTime
+	job.State.MissedRuns, job.State.MissedAtMS = 0, nil
 	job.UpdatedAtMS = time.Now().UnixMilli()
 
 	if err != nil {
@@ -223,8 +298,35 @@ func (cs *CronService) executeJobByID(jobID string) {
 		job.State.LastStatus = "ok"
 		job.State.LastError = ""
 	}
+	cs.recordRunUnsafe(job, run, output, err)
+
+	cs.scheduleNextUnsafe(job)
+	if err := cs.saveStoreUnsafe(); err != nil {
+		log.Printf("[cron] failed to save store: %v", err)
+	}
+}
 
-	// Compute next run time
+// skipJobByID moves a job that another instance claimed on to its next
+// run without running it.
+func (cs *CronService) skipJobByID(jobID string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for i := range cs.store.Jobs {
+		if cs.store.Jobs[i].ID == jobID {
+			cs.store.Jobs[i].State.MissedRuns, cs.store.Jobs[i].State.MissedAtMS = 0, nil
+			cs.scheduleNextUnsafe(&cs.store.Jobs[i])
+			if err := cs.saveStoreUnsafe(); err != nil {
+				log.Printf("[cron] failed to save store: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// scheduleNextUnsafe computes the next run of a job that just ran, and
+// ends one-time jobs.
+func (cs *CronService) scheduleNextUnsafe(job *CronJob) {
 	if job.Schedule.Kind == "at" {
 		if job.DeleteAfterRun {
 			cs.removeJobUnsafe(job.ID)
@@ -233,16 +335,11 @@ func (cs *CronService) executeJobByID(jobID string) {
 			job.State.NextRunAtMS = nil
 		}
 	} else {
-		nextRun := cs.computeNextRun(&job.Schedule, time.Now().UnixMilli())
-		job.State.NextRunAtMS = nextRun
-	}
-
-	if err := cs.saveStoreUnsafe(); err != nil {
-		log.Printf("[cron] failed to save store: %v", err)
+		job.State.NextRunAtMS = cs.nextRunUnsafe(&job.Schedule, time.Now().UnixMilli())
 	}
 }
 
-func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int64 {
+func computeNextRun(schedule *CronSchedule, nowMS int64) *int64 {
 	if schedule.Kind == "at" {
 		if schedule.AtMS != nil && *schedule.AtMS > nowMS {
 			return schedule.AtMS
@@ -263,8 +360,9 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 			return nil
 		}
 
-		// Use gronx to calculate next run time
-		now := time.UnixMilli(nowMS)
+		// Use gronx to calculate next run time, in the schedule's time
+		// zone
+		now := time.UnixMilli(nowMS).In(schedule.Location())
 		nextTime, err := gronx.NextTickAfter(schedule.Expr, now, false)
 		if err != nil {
 			log.Printf("[cron] failed to compute next run for expr '%s': %v", schedule.Expr, err)
@@ -278,16 +376,6 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 	return nil
 }
 
-func (cs *CronService) recomputeNextRuns() {
-	now := time.Now().UnixMilli()
-	for i := range cs.store.Jobs {
-		job := &cs.store.Jobs[i]
-		if job.Enabled {
-			job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
-		}
-	}
-}
-
 func (cs *CronService) getNextWakeMS() *int64 {
 	var nextWake *int64
 	for _, job := range cs.store.Jobs {
@@ -312,6 +400,13 @@ func (cs *CronService) SetOnJob(handler JobHandler) {
 	cs.onJob = handler
 }
 
+// SetClaimer makes every due run wait for claim before it runs.
+func (cs *CronService) SetClaimer(claim JobClaimer) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.claim = claim
+}
+
 func (cs *CronService) loadStore() error {
 	cs.store = &CronStore{
 		Version: 1,
@@ -371,7 +466,7 @@ func (cs *CronService) AddJob(
 			To:      to,
 		},
 		State: CronJobState{
-			NextRunAtMS: cs.computeNextRun(&schedule, now),
+			NextRunAtMS: cs.nextRunUnsafe(&schedule, now),
 		},
 		CreatedAtMS:    now,
 		UpdatedAtMS:    now,
@@ -400,6 +495,32 @@ func (cs *CronService) UpdateJob(job *CronJob) error {
 	return fmt.Errorf("job not found")
 }
 
+// Reschedule gives a job a new schedule and computes its next run.
+func (cs *CronService) Reschedule(jobID string, schedule CronSchedule) (*CronJob, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for i := range cs.store.Jobs {
+		job := &cs.store.Jobs[i]
+		if job.ID != jobID {
+			continue
+		}
+		now := time.Now().UnixMilli()
+		job.Schedule = schedule
+		job.DeleteAfterRun = schedule.Kind == "at"
+		job.UpdatedAtMS = now
+		if job.Enabled {
+			job.State.NextRunAtMS = cs.nextRunUnsafe(&schedule, now)
+		}
+		if err := cs.saveStoreUnsafe(); err != nil {
+			return nil, err
+		}
+		jobCopy := *job
+		return &jobCopy, nil
+	}
+	return nil, fmt.Errorf("job %s not found", jobID)
+}
+
 func (cs *CronService) RemoveJob(jobID string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -427,6 +548,20 @@ func (cs *CronService) removeJobUnsafe(jobID string) bool {
 	return removed
 }
 
+// RemoveWhere removes the jobs match picks and returns how many it removed.
+func (cs *CronService) RemoveWhere(match func(job *CronJob) bool) (int, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	before := len(cs.store.Jobs)
+	cs.store.Jobs = slices.DeleteFunc(cs.store.Jobs, func(job CronJob) bool { return match(&job) })
+	removed := before - len(cs.store.Jobs)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, cs.saveStoreUnsafe()
+}
+
 func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -438,7 +573,7 @@ func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 			job.UpdatedAtMS = time.Now().UnixMilli()
 
 			if enabled {
-				job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, time.Now().UnixMilli())
+				job.State.NextRunAtMS = cs.nextRunUnsafe(&job.Schedule, time.Now().UnixMilli())
 			} else {
 				job.State.NextRunAtMS = nil
 			}
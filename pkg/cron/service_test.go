@@ -1,10 +1,13 @@
 package cron
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSaveStore_FilePermissions(t *testing.T) {
@@ -36,3 +39,190 @@ func TestSaveStore_FilePermissions(t *testing.T) {
 func int64Ptr(v int64) *int64 {
 	return &v
 }
+
+func TestCheckJobs_RunsOnlyClaimedJobs(t *testing.T) {
+	var ran []string
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), func(job *CronJob) (string, error) {
+		ran = append(ran, job.Name)
+		return "", nil
+	})
+	for _, name := range []string{"mine", "theirs"} {
+		if _, err := cs.AddJob(name, CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, name, false, "cli", "direct"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ttls []time.Duration
+	cs.SetClaimer(func(jobID string, ttl time.Duration) bool {
+		ttls = append(ttls, ttl)
+		return jobID == cs.store.Jobs[0].ID
+	})
+	past := time.Now().Add(-time.Second).UnixMilli()
+	for i := range cs.store.Jobs {
+		cs.store.Jobs[i].State.NextRunAtMS = &past
+	}
+	cs.running = true
+	cs.checkJobs()
+
+	if len(ran) != 1 || ran[0] != "mine" {
+		t.Errorf("ran %v, want only the claimed job", ran)
+	}
+	if len(ttls) != 2 || ttls[0] != 54*time.Second {
+		t.Errorf("claim TTLs = %v, want 9/10 of the interval", ttls)
+	}
+	theirs := cs.store.Jobs[1]
+	if theirs.State.NextRunAtMS == nil || *theirs.State.NextRunAtMS <= past || theirs.State.LastRunAtMS != nil {
+		t.Errorf("skipped job state = %+v, want it moved to its next run", theirs.State)
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC).UnixMilli()
+	hourAgo := now - time.Hour.Milliseconds()
+	at := now - 10*time.Minute.Milliseconds()
+	later := now + time.Hour.Milliseconds()
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	cs.store.Jobs = []CronJob{
+		{ID: "every", Enabled: true, Schedule: CronSchedule{Kind: "every", EveryMS: int64Ptr(600000)},
+			State: CronJobState{NextRunAtMS: &hourAgo}},
+		{ID: "skipped", Enabled: true, CatchUp: CatchUpSkip, Schedule: CronSchedule{Kind: "cron", Expr: "0 * * * *", TZ: "UTC"},
+			State: CronJobState{NextRunAtMS: &hourAgo}},
+		{ID: "at", Enabled: true, Schedule: CronSchedule{Kind: "at", AtMS: &at}},
+		{ID: "future", Enabled: true, Schedule: CronSchedule{Kind: "at", AtMS: &later},
+			State: CronJobState{NextRunAtMS: &later}},
+	}
+	cs.SetPolicy(Policy{CatchUp: CatchUpOnce})
+	cs.catchUpUnsafe(now)
+
+	every := cs.store.Jobs[0].State
+	if every.MissedRuns != 7 || every.MissedAtMS == nil || *every.MissedAtMS != hourAgo {
+		t.Errorf("every: missed %d since %v, want 7 since an hour ago", every.MissedRuns, every.MissedAtMS)
+	}
+	if next := *every.NextRunAtMS; next < now || next > now+catchUpSpread.Milliseconds() {
+		t.Errorf("every: catch-up run %v after the start, want within a minute", time.Duration(next-now)*time.Millisecond)
+	}
+	skipped := cs.store.Jobs[1].State
+	if skipped.MissedRuns != 2 || skipped.MissedAtMS != nil || *skipped.NextRunAtMS != now+time.Hour.Milliseconds() {
+		t.Errorf("skip: state %+v, want 2 missed and the next full hour", skipped)
+	}
+	if job := cs.store.Jobs[2]; !job.Enabled || job.State.MissedAtMS == nil || job.State.MissedRuns != 1 {
+		t.Errorf("at: %+v, want it caught up", job)
+	}
+	if job := cs.store.Jobs[3]; job.State.MissedRuns != 0 || *job.State.NextRunAtMS != later {
+		t.Errorf("future: %+v, want it left alone", job.State)
+	}
+
+	// A one-time job skipped is over.
+	cs.store.Jobs[2].State = CronJobState{}
+	cs.SetPolicy(Policy{CatchUp: CatchUpSkip})
+	cs.catchUpUnsafe(now)
+	if job := cs.store.Jobs[2]; job.Enabled || job.State.NextRunAtMS != nil {
+		t.Errorf("at skipped: %+v, want it disabled", job)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	cs.SetPolicy(Policy{Jitter: 30 * time.Second})
+	now := time.Now().UnixMilli()
+	every := CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}
+	for range 20 {
+		next := *cs.nextRunUnsafe(&every, now)
+		if next < now+60000 || next > now+90000 {
+			t.Fatalf("next run %dms away, want 60s to 90s", next-now)
+		}
+	}
+	at := now + 5000
+	if next := *cs.nextRunUnsafe(&CronSchedule{Kind: "at", AtMS: &at}, now); next != at {
+		t.Errorf("one-time run moved by %dms", next-at)
+	}
+}
+
+func TestCheckJobs_MaxConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), func(job *CronJob) (string, error) {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "", nil
+	})
+	cs.SetPolicy(Policy{MaxConcurrent: 2})
+	past := time.Now().Add(-time.Second).UnixMilli()
+	for i := range 6 {
+		job, err := cs.AddJob(fmt.Sprint("job", i), CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "hi", false, "cli", "direct")
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.State.NextRunAtMS = &past
+		job.State.MissedRuns, job.State.MissedAtMS = 1, &past
+		cs.UpdateJob(job)
+	}
+	cs.running = true
+	cs.checkJobs()
+
+	if most != 2 {
+		t.Errorf("at most %d jobs ran at once, want 2", most)
+	}
+	for _, job := range cs.store.Jobs {
+		if job.State.LastRunAtMS == nil || job.State.MissedAtMS != nil || job.State.MissedRuns != 0 {
+			t.Errorf("job %s state %+v, want it run and caught up", job.Name, job.State)
+		}
+	}
+}
+
+func TestRunHistoryAndAlerts(t *testing.T) {
+	fail := true
+	var taskIDs []string
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), func(job *CronJob) (string, error) {
+		taskIDs = append(taskIDs, job.State.TaskID)
+		if fail {
+			return "", fmt.Errorf("provider down")
+		}
+		return "sent", nil
+	})
+	alerts := make(chan CronJob, 10)
+	cs.SetAlerter(3, func(job CronJob) { alerts <- job })
+	job, err := cs.AddJob("report", CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "report", false, "cli", "direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range maxHistory + 2 {
+		cs.executeJobByID(job.ID)
+	}
+	state := cs.ListJobs(true)[0].State
+	if state.ConsecutiveFailures != maxHistory+2 || len(state.History) != maxHistory {
+		t.Fatalf("%d failures, %d runs kept", state.ConsecutiveFailures, len(state.History))
+	}
+	last, _ := cs.ListJobs(true)[0].LastRun()
+	if last.Status != "error" || last.Error != "provider down" || last.TaskID != taskIDs[len(taskIDs)-1] || len(last.TaskID) != 8 {
+		t.Errorf("last run = %+v", last)
+	}
+	if got := <-alerts; got.State.ConsecutiveFailures != 3 {
+		t.Errorf("alerted at %d failures, want 3", got.State.ConsecutiveFailures)
+	}
+
+	fail = false
+	cs.executeJobByID(job.ID)
+	cs.executeJobByID(job.ID)
+	select {
+	case got := <-alerts:
+		if got.State.ConsecutiveFailures != 0 {
+			t.Errorf("recovery alert with %d failures", got.State.ConsecutiveFailures)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no recovery alert")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(alerts) != 0 {
+		t.Errorf("%d more alerts, want one per failing streak and recovery", len(alerts))
+	}
+	if last, _ := cs.ListJobs(true)[0].LastRun(); last.Output != "sent" {
+		t.Errorf("output = %q", last.Output)
+	}
+}
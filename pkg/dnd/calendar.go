@@ -0,0 +1,416 @@
+package dnd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxOccurrences bounds how far a recurring event is expanded.
+const maxOccurrences = 100000
+
+// Period is a time the user is busy.
+type Period struct {
+	Start  time.Time
+	End    time.Time
+	Reason string // e.g. the event's summary
+}
+
+// event is a VEVENT of an iCalendar feed, possibly repeating.
+type event struct {
+	uid        string
+	summary    string
+	start, end time.Time
+	rule       *rrule
+	exdates    []time.Time
+	recurrence time.Time // RECURRENCE-ID of an event that moves one occurrence
+	allDay     bool
+}
+
+// rrule is the part of an RRULE expanded here: daily, weekly on given days,
+// monthly and yearly on the start's date.
+type rrule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+// parseICS reads the busy events of an iCalendar feed. Times without a
+// zone are read in loc. Cancelled events and those marked free
+// (TRANSP:TRANSPARENT) are left out.
+func parseICS(r io.Reader, loc *time.Location) ([]event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []event
+	var cur *event
+	skip := false
+	for _, line := range lines {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			cur, skip = &event{}, false
+			continue
+		case name == "END" && value == "VEVENT":
+			if cur != nil && !skip && !cur.start.IsZero() {
+				if cur.end.IsZero() {
+					cur.end = cur.start
+					if cur.allDay {
+						cur.end = cur.start.AddDate(0, 0, 1)
+					}
+				}
+				if cur.end.After(cur.start) {
+					events = append(events, *cur)
+				}
+			}
+			cur = nil
+			continue
+		case cur == nil:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			cur.uid = value
+		case "SUMMARY":
+			cur.summary = unescape(value)
+		case "DTSTART":
+			cur.start, err = parseTime(value, params, loc)
+			cur.allDay = params["VALUE"] == "DATE" || len(strings.TrimSpace(value)) == 8
+		case "DTEND":
+			cur.end, err = parseTime(value, params, loc)
+		case "DURATION":
+			var d time.Duration
+			if d, err = parseDuration(value); err == nil && !cur.start.IsZero() {
+				cur.end = cur.start.Add(d)
+			}
+		case "RECURRENCE-ID":
+			cur.recurrence, err = parseTime(value, params, loc)
+		case "EXDATE":
+			for v := range strings.SplitSeq(value, ",") {
+				t, perr := parseTime(v, params, loc)
+				if perr != nil {
+					err = perr
+					break
+				}
+				cur.exdates = append(cur.exdates, t)
+			}
+		case "RRULE":
+			cur.rule, err = parseRRule(value, loc)
+		case "TRANSP":
+			skip = skip || value == "TRANSPARENT"
+		case "STATUS":
+			skip = skip || value == "CANCELLED"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s of %q: %w", name, cur.summary, err)
+		}
+	}
+
+	// An event that moves one occurrence of a repeating one replaces it.
+	for _, moved := range events {
+		if moved.recurrence.IsZero() {
+			continue
+		}
+		for i := range events {
+			if events[i].uid == moved.uid && events[i].rule != nil {
+				events[i].exdates = append(events[i].exdates, moved.recurrence)
+			}
+		}
+	}
+	return events, nil
+}
+
+// periods returns the occurrences of e that overlap from to to.
+func (e event) periods(from, to time.Time) []Period {
+	length := e.end.Sub(e.start)
+	reason := e.summary
+	if reason == "" {
+		reason = "calendar"
+	}
+	var out []Period
+	add := func(start time.Time) {
+		if slices.ContainsFunc(e.exdates, start.Equal) {
+			return
+		}
+		if start.Before(to) && start.Add(length).After(from) {
+			out = append(out, Period{Start: start, End: start.Add(length), Reason: reason})
+		}
+	}
+	if e.rule == nil {
+		add(e.start)
+		return out
+	}
+
+	r := e.rule
+	n := 0
+	done := func(start time.Time) bool {
+		return !start.Before(to) || (!r.until.IsZero() && start.After(r.until)) ||
+			(r.count > 0 && n >= r.count) || n >= maxOccurrences
+	}
+	if r.freq == "WEEKLY" && len(r.byDay) > 0 {
+		// Weeks start on Monday.
+		offset := (int(e.start.Weekday()) + 6) % 7
+		week := e.start.AddDate(0, 0, -offset)
+		for k := 0; ; k++ {
+			base := week.AddDate(0, 0, 7*k*r.interval)
+			for _, day := range r.byDay {
+				start := base.AddDate(0, 0, (int(day)+6)%7)
+				if start.Before(e.start) {
+					continue
+				}
+				if done(start) {
+					return out
+				}
+				n++
+				add(start)
+			}
+		}
+	}
+	for k := 0; ; k++ {
+		var start time.Time
+		switch r.freq {
+		case "DAILY":
+			start = e.start.AddDate(0, 0, k*r.interval)
+		case "WEEKLY":
+			start = e.start.AddDate(0, 0, 7*k*r.interval)
+		case "MONTHLY":
+			start = e.start.AddDate(0, k*r.interval, 0)
+		case "YEARLY":
+			start = e.start.AddDate(k*r.interval, 0, 0)
+		default:
+			add(e.start)
+			return out
+		}
+		if done(start) {
+			return out
+		}
+		// The 31st does not come every month.
+		if start.Day() != e.start.Day() {
+			continue
+		}
+		if r.freq == "DAILY" && len(r.byDay) > 0 && !slices.Contains(r.byDay, start.Weekday()) {
+			continue
+		}
+		n++
+		add(start)
+	}
+}
+
+// Calendar is an iCalendar feed, read from a URL or a file and kept until
+// it is read again.
+type Calendar struct {
+	source string
+	loc    *time.Location
+	client *http.Client
+
+	mu     sync.Mutex
+	events []event
+	read   time.Time
+	err    error
+}
+
+// NewCalendar returns the feed at source, a http(s) or webcal URL or a
+// path. It is empty until Refresh reads it.
+func NewCalendar(source string, loc *time.Location) *Calendar {
+	return &Calendar{source: source, loc: loc, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Refresh reads the feed again. On failure the events read last are kept.
+func (c *Calendar) Refresh(ctx context.Context) error {
+	events, err := c.fetch(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	if err == nil {
+		c.events, c.read = events, time.Now()
+	}
+	return err
+}
+
+func (c *Calendar) fetch(ctx context.Context) ([]event, error) {
+	source := c.source
+	// Calendar apps hand out webcal:// links for the same feeds.
+	if rest, ok := strings.CutPrefix(source, "webcal://"); ok {
+		source = "https://" + rest
+	}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(c.source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseICS(f, c.loc)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar: %s", resp.Status)
+	}
+	return parseICS(io.LimitReader(resp.Body, 16<<20), c.loc)
+}
+
+// Periods returns the busy times of the feed that overlap from to to.
+func (c *Calendar) Periods(from, to time.Time) []Period {
+	c.mu.Lock()
+	events := c.events
+	c.mu.Unlock()
+	var out []Period
+	for _, e := range events {
+		out = append(out, e.periods(from, to)...)
+	}
+	return out
+}
+
+// Status returns when the feed was last read and the error of the last
+// try, if it failed.
+func (c *Calendar) Status() (read time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.read, c.err
+}
+
+// unfold returns the lines of an iCalendar feed, joining those continued
+// on the next line.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+// splitProperty splits "DTSTART;TZID=Europe/Berlin:20261017T090000".
+func splitProperty(line string) (name string, params map[string]string, value string) {
+	head, value, _ := strings.Cut(line, ":")
+	parts := strings.Split(head, ";")
+	params = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+// parseTime reads a DATE or DATE-TIME value: in UTC with a trailing Z, in
+// the zone of TZID, or else in loc.
+func parseTime(value string, params map[string]string, loc *time.Location) (time.Time, error) {
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	value = strings.TrimSpace(value)
+	switch {
+	case len(value) == 8:
+		return time.ParseInLocation("20060102", value, loc)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+// parseDuration reads a DURATION such as "PT1H30M" or "P1D".
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	if s == value || strings.HasPrefix(value, "-") {
+		return 0, fmt.Errorf("bad duration %q", value)
+	}
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var d time.Duration
+	num := ""
+	inTime := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			num += string(c)
+		default:
+			n, err := strconv.Atoi(num)
+			unit, ok := units[c]
+			if err != nil || !ok || (c == 'M' && !inTime) {
+				return 0, fmt.Errorf("bad duration %q", value)
+			}
+			d += time.Duration(n) * unit
+			num = ""
+		}
+	}
+	return d, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule reads the parts of an RRULE that are expanded here. Rules it
+// cannot expand, e.g. "the second Tuesday", only keep their first
+// occurrence.
+func parseRRule(value string, loc *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+	for part := range strings.SplitSeq(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(v); err == nil && r.interval < 1 {
+				err = fmt.Errorf("interval %d", r.interval)
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, err = parseTime(v, nil, loc)
+		case "BYDAY":
+			for d := range strings.SplitSeq(v, ",") {
+				day, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					// "2TU" and the like are not expanded.
+					r.freq = "UNSUPPORTED"
+					continue
+				}
+				r.byDay = append(r.byDay, day)
+			}
+		case "BYMONTHDAY", "BYSETPOS", "BYMONTH", "BYWEEKNO", "BYYEARDAY":
+			r.freq = "UNSUPPORTED"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("RRULE %s: %w", k, err)
+		}
+	}
+	slices.SortFunc(r.byDay, func(a, b time.Weekday) int { return (int(a)+6)%7 - (int(b)+6)%7 })
+	return r, nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(s)
+}
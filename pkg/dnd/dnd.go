@@ -0,0 +1,247 @@
+// Package dnd holds back proactive messages while the user is busy: in
+// focus blocks set in the config, in the events of their calendar, or
+// after /dnd on. See config.DNDConfig.
+package dnd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxBusy bounds how far ahead the end of a busy time is looked for.
+const maxBusy = 7 * 24 * time.Hour
+
+// Schedule tells when the user is busy.
+type Schedule struct {
+	cfg      config.DNDConfig
+	loc      *time.Location
+	calendar *Calendar // nil without one
+	path     string    // state/dnd.json, where /dnd on is kept
+
+	mu     sync.Mutex
+	manual time.Time // set by /dnd on, zero when off
+}
+
+// manualState is what state/dnd.json holds.
+type manualState struct {
+	Until time.Time `json:"until"`
+}
+
+// New returns the schedule of cfg, with /dnd on kept in the workspace.
+// Its calendar is empty until Run reads it.
+func New(cfg config.DNDConfig, workspace string) (*Schedule, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	loc := time.Local
+	if cfg.Timezone != "" {
+		loc, _ = time.LoadLocation(cfg.Timezone)
+	}
+	s := &Schedule{cfg: cfg, loc: loc, path: filepath.Join(workspace, "state", "dnd.json")}
+	if cfg.Calendar != "" {
+		s.calendar = NewCalendar(cfg.Calendar, loc)
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		var st manualState
+		if json.Unmarshal(data, &st) == nil {
+			s.manual = st.Until
+		}
+	}
+	return s, nil
+}
+
+// Run reads the calendar every refresh_minutes until ctx ends.
+func (s *Schedule) Run(ctx context.Context) {
+	if s.calendar == nil {
+		return
+	}
+	every := time.Duration(s.cfg.RefreshMinutes) * time.Minute
+	if every <= 0 {
+		every = 15 * time.Minute
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := s.calendar.Refresh(ctx); err != nil && ctx.Err() == nil {
+			logger.WarnCF("dnd", "Failed to read the calendar", map[string]any{"error": err.Error()})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Calendar returns the calendar feed, or nil without one.
+func (s *Schedule) Calendar() *Calendar {
+	return s.calendar
+}
+
+// Location returns the time zone focus blocks are read in.
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// SetManual turns do-not-disturb on until the given time, or off for a
+// zero time. It does not end a focus block or a meeting.
+func (s *Schedule) SetManual(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.manual = until
+	data, err := json.Marshal(manualState{Until: until})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Periods returns the busy times that overlap from to to, soonest first.
+func (s *Schedule) Periods(from, to time.Time) []Period {
+	var out []Period
+	s.mu.Lock()
+	manual := s.manual
+	s.mu.Unlock()
+	if manual.After(from) {
+		out = append(out, Period{Start: from, End: manual, Reason: "/dnd"})
+	}
+	out = append(out, s.focusPeriods(from, to)...)
+	if s.calendar != nil {
+		out = append(out, s.calendar.Periods(from, to)...)
+	}
+	slices.SortFunc(out, func(a, b Period) int { return a.Start.Compare(b.Start) })
+	return out
+}
+
+// focusPeriods returns the runs of minutes matched by a focus expression
+// that overlap from to to.
+func (s *Schedule) focusPeriods(from, to time.Time) []Period {
+	var out []Period
+	g := gronx.New()
+	for _, expr := range s.cfg.Focus {
+		var cur *Period
+		for t := from.In(s.loc).Truncate(time.Minute); t.Before(to); t = t.Add(time.Minute) {
+			due, err := g.IsDue(expr, t)
+			switch {
+			case err != nil:
+				t = to
+			case due && cur == nil:
+				cur = &Period{Start: t, End: t.Add(time.Minute), Reason: "focus " + expr}
+			case due:
+				cur.End = t.Add(time.Minute)
+			case cur != nil:
+				out = append(out, *cur)
+				cur = nil
+			}
+		}
+		if cur != nil {
+			out = append(out, *cur)
+		}
+	}
+	return out
+}
+
+// Busy is why the user is busy and until when, across back-to-back
+// meetings and focus blocks.
+type Busy struct {
+	Reason string
+	Until  time.Time
+}
+
+// BusyAt reports whether the user is busy at now, and until when.
+func (s *Schedule) BusyAt(now time.Time) (Busy, bool) {
+	var busy Busy
+	found := false
+	for t := now; t.Sub(now) < maxBusy; {
+		p, ok := s.periodAt(t)
+		if !ok {
+			break
+		}
+		if !found {
+			busy.Reason, found = p.Reason, true
+		}
+		t, busy.Until = p.End, p.End
+	}
+	return busy, found
+}
+
+// periodAt returns the busy time at t that lasts longest.
+func (s *Schedule) periodAt(t time.Time) (Period, bool) {
+	var best Period
+	found := false
+	consider := func(p Period) {
+		if !p.Start.After(t) && p.End.After(t) && (!found || p.End.After(best.End)) {
+			best, found = p, true
+		}
+	}
+	s.mu.Lock()
+	manual := s.manual
+	s.mu.Unlock()
+	consider(Period{Start: t, End: manual, Reason: "/dnd"})
+	if s.calendar != nil {
+		for _, p := range s.calendar.Periods(t, t.Add(time.Nanosecond)) {
+			consider(p)
+		}
+	}
+	g := gronx.New()
+	minute := t.In(s.loc).Truncate(time.Minute)
+	for _, expr := range s.cfg.Focus {
+		end := minute
+		for end.Sub(minute) < maxBusy {
+			if due, err := g.IsDue(expr, end); err != nil || !due {
+				break
+			}
+			end = end.Add(time.Minute)
+		}
+		if end.After(minute) {
+			consider(Period{Start: minute, End: end, Reason: "focus " + expr})
+		}
+	}
+	return best, found
+}
+
+// Hold decides what happens to msg at now: a zero time and false send it,
+// a time defers it until then and drop suppresses it. Only proactive
+// messages are held; urgent ones go out on the urgent channels.
+func (s *Schedule) Hold(msg bus.OutboundMessage, now time.Time) (until time.Time, drop bool, reason string) {
+	if !msg.Proactive {
+		return time.Time{}, false, ""
+	}
+	if msg.Urgent {
+		channelType, _, _ := strings.Cut(msg.Channel, "@")
+		if slices.Contains(s.cfg.UrgentChannels, msg.Channel) || slices.Contains(s.cfg.UrgentChannels, channelType) {
+			return time.Time{}, false, ""
+		}
+	}
+	busy, ok := s.BusyAt(now)
+	if !ok {
+		return time.Time{}, false, ""
+	}
+	if s.cfg.Mode == "suppress" {
+		return time.Time{}, true, busy.Reason
+	}
+	return busy.Until, false, busy.Reason
+}
@@ -0,0 +1,150 @@
+package dnd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const testICS = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:standup
+SUMMARY:Standup
+DTSTART;TZID=Europe/Berlin:20260105T093000
+DTEND;TZID=Europe/Berlin:20260105T100000
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE
+EXDATE;TZID=Europe/Berlin:20260107T093000
+END:VEVENT
+BEGIN:VEVENT
+UID:review
+SUMMARY:Design
+  review
+DTSTART:20260105T090000Z
+DURATION:PT1H
+END:VEVENT
+BEGIN:VEVENT
+UID:lunch
+SUMMARY:Lunch
+DTSTART;TZID=Europe/Berlin:20260105T120000
+DTEND;TZID=Europe/Berlin:20260105T130000
+TRANSP:TRANSPARENT
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParseICS(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	events, err := parseICS(strings.NewReader(testICS), berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("events = %+v", events)
+	}
+
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, berlin) }
+	var got []string
+	for _, e := range events {
+		for _, p := range e.periods(day(5), day(10)) {
+			got = append(got, p.Start.In(berlin).Format("Mon 15:04")+"-"+p.End.In(berlin).Format("15:04")+" "+p.Reason)
+		}
+	}
+	want := []string{"Mon 09:30-10:00 Standup", "Mon 10:00-11:00 Design review"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("periods = %q, want %q", got, want)
+	}
+}
+
+func TestSchedule_BusyAndHold(t *testing.T) {
+	workspace := t.TempDir()
+	icsPath := filepath.Join(workspace, "cal.ics")
+	if err := os.WriteFile(icsPath, []byte(testICS), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DNDConfig{
+		Enabled:        true,
+		Timezone:       "Europe/Berlin",
+		Focus:          []string{"* 10-11 * * 1-5"},
+		Calendar:       icsPath,
+		UrgentChannels: []string{"telegram"},
+	}
+	s, err := New(cfg, workspace)
+	if err != nil {
+		t.Skip(err)
+	}
+	if err := s.Calendar().Refresh(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	loc := s.Location()
+
+	// The standup runs into the review, the review into the focus block.
+	monday := time.Date(2026, 1, 5, 9, 45, 0, 0, loc)
+	busy, ok := s.BusyAt(monday)
+	if !ok || busy.Reason != "Standup" || !busy.Until.Equal(time.Date(2026, 1, 5, 12, 0, 0, 0, loc)) {
+		t.Errorf("BusyAt = %+v, %v", busy, ok)
+	}
+	if _, ok := s.BusyAt(time.Date(2026, 1, 5, 12, 30, 0, 0, loc)); ok {
+		t.Error("busy over lunch, which is marked free")
+	}
+
+	proactive := bus.OutboundMessage{Channel: "slack", ChatID: "1", Content: "Daily digest", Proactive: true}
+	if until, drop, _ := s.Hold(proactive, monday); drop || !until.Equal(busy.Until) {
+		t.Errorf("Hold(proactive) = %v, %v", until, drop)
+	}
+	reply := proactive
+	reply.Proactive = false
+	if until, drop, _ := s.Hold(reply, monday); drop || !until.IsZero() {
+		t.Errorf("held a reply: %v, %v", until, drop)
+	}
+	urgent := proactive
+	urgent.Urgent = true
+	if until, _, _ := s.Hold(urgent, monday); until.IsZero() {
+		t.Error("let an urgent alert through on a channel not meant for them")
+	}
+	urgent.Channel = "telegram@work"
+	if until, drop, _ := s.Hold(urgent, monday); drop || !until.IsZero() {
+		t.Errorf("held an urgent alert on an urgent channel: %v, %v", until, drop)
+	}
+
+	s.cfg.Mode = "suppress"
+	if _, drop, reason := s.Hold(proactive, monday); !drop || reason != "Standup" {
+		t.Errorf("suppress mode: drop = %v, reason = %q", drop, reason)
+	}
+}
+
+func TestSchedule_Manual(t *testing.T) {
+	workspace := t.TempDir()
+	s, err := New(config.DNDConfig{Enabled: true}, workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, ok := s.BusyAt(now); ok {
+		t.Fatal("busy without anything set")
+	}
+	until := now.Add(2 * time.Hour).Truncate(time.Second)
+	if err := s.SetManual(until); err != nil {
+		t.Fatal(err)
+	}
+
+	// /dnd on is kept across restarts.
+	s, _ = New(config.DNDConfig{Enabled: true}, workspace)
+	if busy, ok := s.BusyAt(now); !ok || busy.Reason != "/dnd" || !busy.Until.Equal(until) {
+		t.Errorf("BusyAt = %+v, %v", busy, ok)
+	}
+	if err := s.SetManual(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.BusyAt(now); ok {
+		t.Error("still busy after /dnd off")
+	}
+}
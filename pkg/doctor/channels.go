@@ -0,0 +1,159 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// The APIs asked about tokens in a live run; tests point them elsewhere.
+var (
+	telegramAPI = "https://api.telegram.org"
+	discordAPI  = "https://discord.com/api/v10"
+	slackAPI    = "https://slack.com/api"
+)
+
+// channelCredentials is an enabled channel and the settings it cannot
+// start without.
+type channelCredentials struct {
+	name     string
+	required map[string]string // setting -> value
+	probe    func(ctx context.Context, client *http.Client) error
+}
+
+func enabledChannels(c *config.ChannelsConfig) []channelCredentials {
+	var out []channelCredentials
+	add := func(enabled bool, name string, required map[string]string, probe func(context.Context, *http.Client) error) {
+		if enabled {
+			out = append(out, channelCredentials{name: name, required: required, probe: probe})
+		}
+	}
+	add(c.Telegram.Enabled, "telegram", map[string]string{"token": c.Telegram.Token},
+		func(ctx context.Context, client *http.Client) error {
+			return probeJSON(ctx, client, http.MethodGet, telegramAPI+"/bot"+c.Telegram.Token+"/getMe", "", "ok")
+		})
+	add(c.Discord.Enabled, "discord", map[string]string{"token": c.Discord.Token},
+		func(ctx context.Context, client *http.Client) error {
+			return probeJSON(ctx, client, http.MethodGet, discordAPI+"/users/@me", "Bot "+c.Discord.Token, "")
+		})
+	add(c.Slack.Enabled, "slack", map[string]string{"bot_token": c.Slack.BotToken, "app_token": c.Slack.AppToken},
+		func(ctx context.Context, client *http.Client) error {
+			return probeJSON(ctx, client, http.MethodPost, slackAPI+"/auth.test", "Bearer "+c.Slack.BotToken, "ok")
+		})
+	add(c.WhatsApp.Enabled && !c.WhatsApp.UseNative, "whatsapp", map[string]string{"bridge_url": c.WhatsApp.BridgeURL}, nil)
+	add(c.Feishu.Enabled, "feishu", map[string]string{"app_id": c.Feishu.AppID, "app_secret": c.Feishu.AppSecret}, nil)
+	add(c.QQ.Enabled, "qq", map[string]string{"app_id": c.QQ.AppID, "app_secret": c.QQ.AppSecret}, nil)
+	add(c.DingTalk.Enabled, "dingtalk",
+		map[string]string{"client_id": c.DingTalk.ClientID, "client_secret": c.DingTalk.ClientSecret}, nil)
+	add(c.LINE.Enabled, "line", map[string]string{
+		"channel_secret": c.LINE.ChannelSecret, "channel_access_token": c.LINE.ChannelAccessToken,
+	}, nil)
+	add(c.OneBot.Enabled, "onebot", map[string]string{"ws_url": c.OneBot.WSUrl}, nil)
+	add(c.WeCom.Enabled, "wecom", map[string]string{"token": c.WeCom.Token}, nil)
+	add(c.WeComApp.Enabled, "wecom_app",
+		map[string]string{"corp_id": c.WeComApp.CorpID, "corp_secret": c.WeComApp.CorpSecret}, nil)
+	add(c.Matrix.Enabled, "matrix", map[string]string{
+		"homeserver": c.Matrix.Homeserver, "user_id": c.Matrix.UserID, "access_token": c.Matrix.AccessToken,
+	}, nil)
+	add(c.Signal.Enabled, "signal", map[string]string{"url": c.Signal.URL, "account": c.Signal.Account}, nil)
+	add(c.Email.Enabled, "email", map[string]string{
+		"imap_host": c.Email.IMAPHost, "smtp_host": c.Email.SMTPHost, "username": c.Email.Username,
+		"trusted_authserv_ids": strings.Join(c.Email.TrustedAuthservIDs, ","),
+	}, nil)
+	add(c.XMPP.Enabled, "xmpp", map[string]string{"jid": c.XMPP.JID, "password": c.XMPP.Password}, nil)
+	add(c.Mattermost.Enabled, "mattermost", map[string]string{"url": c.Mattermost.URL, "token": c.Mattermost.Token}, nil)
+	add(c.RocketChat.Enabled, "rocketchat", map[string]string{
+		"url": c.RocketChat.URL, "user_id": c.RocketChat.UserID, "token": c.RocketChat.Token,
+	}, nil)
+	add(c.MQTT.Enabled, "mqtt", map[string]string{"broker": c.MQTT.Broker}, nil)
+	add(c.Nostr.Enabled, "nostr", map[string]string{"private_key": c.Nostr.PrivateKey}, nil)
+	return out
+}
+
+func checkChannels(ctx context.Context, r *Report, cfg *config.Config, opts Options) {
+	client := &http.Client{Timeout: opts.Timeout}
+	check := func(channels *config.ChannelsConfig, account string) {
+		for _, ch := range enabledChannels(channels) {
+			name := ch.name
+			if account != "" {
+				name += "@" + account
+			}
+			var missing []string
+			for setting, value := range ch.required {
+				if strings.TrimSpace(value) == "" {
+					missing = append(missing, setting)
+				}
+			}
+			sort.Strings(missing)
+			switch {
+			case len(missing) > 0:
+				r.add("channel", name, StatusFail, "missing "+strings.Join(missing, ", "), 0)
+			case opts.Live && ch.probe != nil:
+				started := time.Now()
+				err := ch.probe(ctx, client)
+				latency := time.Since(started)
+				if err != nil {
+					r.add("channel", name, StatusFail, "credentials rejected: "+err.Error(), latency)
+				} else {
+					r.add("channel", name, StatusOK, "credentials accepted", latency)
+				}
+			default:
+				r.add("channel", name, StatusOK, "configured", 0)
+			}
+		}
+	}
+	check(&cfg.Channels, "")
+	accounts := make([]string, 0, len(cfg.Channels.Accounts))
+	for account := range cfg.Channels.Accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		channels := cfg.Channels.Accounts[account]
+		check(&channels, account)
+	}
+}
+
+// probeJSON sends a request that only succeeds with valid credentials. When
+// okField is set, the JSON answer must also have it true, as Telegram and
+// Slack report errors with status 200.
+func probeJSON(ctx context.Context, client *http.Client, method, url, authorization, okField string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL of a Telegram request contains the token.
+		return fmt.Errorf("request failed: %s", strings.ReplaceAll(err.Error(), url, req.URL.Host))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if okField == "" {
+		return nil
+	}
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if ok, _ := body[okField].(bool); !ok {
+		for _, field := range []string{"error", "description"} { // Slack, Telegram
+			if msg, _ := body[field].(string); msg != "" {
+				return fmt.Errorf("%s", msg)
+			}
+		}
+		return fmt.Errorf("%s is not true", okField)
+	}
+	return nil
+}
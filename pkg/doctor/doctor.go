@@ -0,0 +1,99 @@
+// Package doctor checks whether a configuration can work: whether the
+// providers accept their credentials and serve their models, whether the
+// enabled channels have theirs, and whether the workspace and databases
+// can be opened.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn" // works, but probably not as intended
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip" // needs a live run
+)
+
+// Check is one line of a report.
+type Check struct {
+	Section   string `json:"section"` // "provider", "channel" or "storage"
+	Name      string `json:"name"`
+	Status    Status `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+}
+
+// Report is the result of Run, in the order the checks ran.
+type Report struct {
+	Live   bool    `json:"live"`
+	Checks []Check `json:"checks"`
+}
+
+// Failed reports whether any check failed.
+func (r *Report) Failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Problems returns the checks that failed or warned.
+func (r *Report) Problems() []Check {
+	var out []Check
+	for _, c := range r.Checks {
+		if c.Status == StatusFail || c.Status == StatusWarn {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (r *Report) add(section, name string, status Status, detail string, latency time.Duration) {
+	r.Checks = append(r.Checks, Check{
+		Section:   section,
+		Name:      name,
+		Status:    status,
+		Detail:    detail,
+		LatencyMS: latency.Milliseconds(),
+	})
+}
+
+// Options control what Run checks.
+type Options struct {
+	// Live sends a short request to every provider and asks the channel
+	// APIs whether their tokens are valid. Without it only what can be
+	// told from the config and the local files is checked, quickly enough
+	// for every start.
+	Live bool
+	// Timeout bounds each live request; 0 means 30 seconds.
+	Timeout time.Duration
+}
+
+// Run checks cfg.
+func Run(ctx context.Context, cfg *config.Config, opts Options) *Report {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	r := &Report{Live: opts.Live}
+	checkProviders(ctx, r, cfg, opts)
+	checkChannels(ctx, r, cfg, opts)
+	checkStorage(r, cfg, opts)
+	return r
+}
+
+func formatLatency(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -0,0 +1,158 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// fakeProvider answers, or fails with err.
+type fakeProvider struct {
+	err error
+}
+
+func (p *fakeProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &providers.LLMResponse{Content: "OK"}, nil
+}
+
+func (p *fakeProvider) GetDefaultModel() string { return "" }
+
+func useFakeProviders(t *testing.T, errs map[string]error) {
+	t.Helper()
+	orig := newProvider
+	newProvider = func(cfg *config.ModelConfig) (providers.LLMProvider, string, error) {
+		if cfg.APIKey == "" {
+			return nil, "", errors.New("api_key is required")
+		}
+		_, model := providers.ExtractProtocol(cfg.Model)
+		return &fakeProvider{err: errs[cfg.ModelName]}, model, nil
+	}
+	t.Cleanup(func() { newProvider = orig })
+}
+
+func find(r *Report, section, name string) *Check {
+	for i := range r.Checks {
+		if r.Checks[i].Section == section && r.Checks[i].Name == name {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+func TestRun_Providers(t *testing.T) {
+	useFakeProviders(t, map[string]error{
+		"bad-key": errors.New("API request failed:\n  Status: 401\n  Body:   invalid x-api-key"),
+		"busy":    errors.New("API request failed:\n  Status: 429\n  Body:   rate limit exceeded"),
+	})
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.ModelName = "missing"
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "good", Model: "openai/gpt-4o", APIKey: "k"},
+		{ModelName: "good", Model: "openai/gpt-4o", APIKey: "k2"},
+		{ModelName: "bad-key", Model: "anthropic/claude", APIKey: "k"},
+		{ModelName: "busy", Model: "openai/gpt-4o-mini", APIKey: "k"},
+		{ModelName: "no-key", Model: "openai/gpt-4o", APIKey: ""},
+	}
+
+	r := Run(context.Background(), cfg, Options{Live: true})
+	want := map[string]Status{
+		"default model": StatusFail,
+		"good":          StatusOK,
+		"bad-key":       StatusFail,
+		"busy":          StatusWarn,
+		"no-key":        StatusFail,
+	}
+	providerChecks := 0
+	for _, c := range r.Checks {
+		if c.Section == "provider" {
+			providerChecks++
+		}
+	}
+	if providerChecks != len(want) {
+		t.Errorf("provider checks = %+v", r.Checks)
+	}
+	for name, status := range want {
+		c := find(r, "provider", name)
+		if c == nil || c.Status != status {
+			t.Errorf("%s: check = %+v, want %s", name, c, status)
+		}
+	}
+	if c := find(r, "provider", "bad-key"); c != nil && !strings.HasPrefix(c.Detail, "credentials rejected") {
+		t.Errorf("bad-key detail = %q", c.Detail)
+	}
+	if !r.Failed() || len(r.Problems()) != 4 {
+		t.Errorf("Failed() = %v, problems = %+v", r.Failed(), r.Problems())
+	}
+
+	// Offline, the providers are only created.
+	r = Run(context.Background(), cfg, Options{})
+	if c := find(r, "provider", "bad-key"); c == nil || c.Status != StatusOK {
+		t.Errorf("offline bad-key = %+v", c)
+	}
+}
+
+func TestRun_Channels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/botgood/") {
+			w.Write([]byte(`{"ok":true,"result":{"username":"picobot"}}`))
+			return
+		}
+		w.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+	}))
+	defer server.Close()
+	orig := telegramAPI
+	telegramAPI = server.URL
+	defer func() { telegramAPI = orig }()
+	useFakeProviders(t, nil)
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.Channels.Telegram.Token = "good"
+	cfg.Channels.Slack.Enabled = true
+	cfg.Channels.Slack.BotToken = "xoxb"
+	work := config.DefaultConfig().Channels
+	work.Telegram.Enabled = true
+	work.Telegram.Token = "revoked"
+	cfg.Channels.Accounts = config.ChannelAccounts{"work": work}
+
+	r := Run(context.Background(), cfg, Options{Live: true})
+	if c := find(r, "channel", "telegram"); c == nil || c.Status != StatusOK {
+		t.Errorf("telegram = %+v", c)
+	}
+	if c := find(r, "channel", "telegram@work"); c == nil || c.Detail != "credentials rejected: Unauthorized" {
+		t.Errorf("telegram@work = %+v", c)
+	}
+	if c := find(r, "channel", "slack"); c == nil || c.Status != StatusFail || c.Detail != "missing app_token" {
+		t.Errorf("slack = %+v", c)
+	}
+}
+
+func TestRun_Storage(t *testing.T) {
+	useFakeProviders(t, nil)
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+
+	r := Run(context.Background(), cfg, Options{})
+	for _, name := range []string{"workspace", "state"} {
+		if c := find(r, "storage", name); c == nil || c.Status != StatusOK {
+			t.Errorf("%s = %+v", name, c)
+		}
+	}
+}
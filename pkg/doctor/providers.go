@@ -0,0 +1,105 @@
+package doctor
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// newProvider creates the provider of a model_list entry; tests replace it.
+var newProvider = providers.CreateProviderFromConfig
+
+func checkProviders(ctx context.Context, r *Report, cfg *config.Config, opts Options) {
+	if len(cfg.ModelList) == 0 {
+		r.add("provider", "model_list", StatusFail, "no providers configured; add entries to model_list", 0)
+		return
+	}
+	if model := cfg.Agents.Defaults.GetModelName(); model != "" {
+		if _, err := cfg.GetModelConfig(model); err != nil {
+			r.add("provider", "default model", StatusFail, fmt.Sprintf("%q is not in model_list", model), 0)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range cfg.ModelList {
+		entry := cfg.ModelList[i]
+		name := cmp.Or(entry.ModelName, entry.Model)
+		if seen[name] {
+			continue // load-balanced entries of one name share a check
+		}
+		seen[name] = true
+		if entry.Workspace == "" {
+			entry.Workspace = cfg.WorkspacePath()
+		}
+
+		protocol, _ := providers.ExtractProtocol(entry.Model)
+		if !opts.Live && (protocol == "github-copilot" || protocol == "copilot") {
+			r.add("provider", name, StatusSkip, "connects to the Copilot server when created", 0)
+			continue
+		}
+		provider, model, err := newProvider(&entry)
+		if err != nil {
+			r.add("provider", name, StatusFail, err.Error(), 0)
+			continue
+		}
+		if !opts.Live {
+			r.add("provider", name, StatusOK, fmt.Sprintf("%s configured", entry.Model), 0)
+		} else {
+			probeProvider(ctx, r, name, provider, model, opts.Timeout)
+		}
+		if sp, ok := provider.(providers.StatefulProvider); ok {
+			sp.Close()
+		}
+	}
+}
+
+// probeProvider asks the model for a one-word answer, which shows that the
+// key is accepted and the model served, and how long a short answer takes.
+func probeProvider(
+	ctx context.Context,
+	r *Report,
+	name string,
+	provider providers.LLMProvider,
+	model string,
+	timeout time.Duration,
+) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	started := time.Now()
+	_, err := provider.Chat(ctx,
+		[]providers.Message{{Role: "user", Content: "Reply with OK."}},
+		nil, model, map[string]any{"max_tokens": 16, "temperature": 0.0})
+	latency := time.Since(started)
+	if err == nil {
+		r.add("provider", name, StatusOK, fmt.Sprintf("%s answered in %s", model, formatLatency(latency)), latency)
+		return
+	}
+
+	detail := utils.Truncate(err.Error(), 200)
+	status := StatusFail
+	var reason providers.FailoverReason
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = providers.FailoverTimeout
+	} else if fe := providers.ClassifyError(err, "", model); fe != nil {
+		reason = fe.Reason
+	}
+	switch reason {
+	case providers.FailoverAuth:
+		detail = "credentials rejected: " + detail
+	case providers.FailoverBilling:
+		detail = "billing: " + detail
+	case providers.FailoverTimeout:
+		detail = fmt.Sprintf("no answer within %s", formatLatency(timeout))
+	case providers.FailoverRateLimit, providers.FailoverOverloaded:
+		// The key and model are fine; the API is just busy.
+		status = StatusWarn
+		detail = string(reason) + ": " + detail
+	}
+	r.add("provider", name, status, detail, latency)
+}
@@ -0,0 +1,66 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func checkStorage(r *Report, cfg *config.Config, opts Options) {
+	workspace := cfg.WorkspacePath()
+	for _, dir := range []struct{ name, path string }{
+		{"workspace", workspace},
+		{"state", filepath.Join(workspace, "state")},
+	} {
+		if err := checkWritable(dir.path); err != nil {
+			r.add("storage", dir.name, StatusFail, err.Error(), 0)
+		} else {
+			r.add("storage", dir.name, StatusOK, dir.path+" is writable", 0)
+		}
+	}
+
+	checkSessionStore(r, cfg, opts)
+
+	if wa := cfg.Channels.WhatsApp; wa.Enabled && wa.UseNative {
+		checkWhatsAppStore(r, wa.StorePath())
+	}
+}
+
+// checkSessionStore opens the session store and brings its schema up to
+// date, as the agents will. A store on a server is only reached in a live
+// run.
+func checkSessionStore(r *Report, cfg *config.Config, opts Options) {
+	storeCfg := cfg.Session.Store
+	backend := session.Backend(storeCfg)
+	name := "sessions (" + backend + ")"
+	if (backend == "postgres" || backend == "redis") && !opts.Live {
+		r.add("storage", name, StatusSkip, "not reached in an offline check", 0)
+		return
+	}
+	started := time.Now()
+	store, err := session.OpenStore(storeCfg, filepath.Join(cfg.WorkspacePath(), "sessions"), routing.DefaultAgentID)
+	latency := time.Since(started)
+	if err != nil {
+		r.add("storage", name, StatusFail, err.Error(), latency)
+		return
+	}
+	store.Close()
+	r.add("storage", name, StatusOK, "", latency)
+}
+
+// checkWritable creates dir if needed and a file in it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,44 @@
+//go:build whatsapp_native
+
+package doctor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// checkWhatsAppStore opens the native WhatsApp session database and looks
+// for a paired device.
+func checkWhatsAppStore(r *Report, path string) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		r.add("storage", "whatsapp session", StatusWarn, "not paired yet; run picoclaw whatsapp login", 0)
+		return
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		r.add("storage", "whatsapp session", StatusFail, err.Error(), 0)
+		return
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	started := time.Now()
+	var devices int
+	err = db.QueryRowContext(ctx, "SELECT count(*) FROM whatsmeow_device").Scan(&devices)
+	latency := time.Since(started)
+	switch {
+	case err != nil:
+		r.add("storage", "whatsapp session", StatusFail, fmt.Sprintf("%s: %v", path, err), latency)
+	case devices == 0:
+		r.add("storage", "whatsapp session", StatusWarn, "no paired device; run picoclaw whatsapp login", latency)
+	default:
+		r.add("storage", "whatsapp session", StatusOK, path, latency)
+	}
+}
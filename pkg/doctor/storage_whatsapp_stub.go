@@ -0,0 +1,8 @@
+//go:build !whatsapp_native
+
+package doctor
+
+func checkWhatsAppStore(r *Report, path string) {
+	r.add("storage", "whatsapp session", StatusFail,
+		"use_native is set, but this binary was built without the whatsapp_native tag", 0)
+}
@@ -0,0 +1,104 @@
+// Package events is the gateway's internal event bus. Producers, such as
+// the agent loop and the channel manager, publish what happens on typed
+// topics; the run and LLM event logs, metrics, hooks and plugins
+// subscribe to the topics they care about, so a producer does not need to
+// know who listens.
+//
+//	events.Subscribe(b, events.ToolExecuted, func(c events.ToolCall) { ... })
+//	events.Publish(b, events.ToolExecuted, events.ToolCall{Tool: "exec"})
+//
+// Subscribers are called in the order they subscribed, in the goroutine
+// of the publisher, so they must be quick and hand slow work off to a
+// goroutine of their own. A subscriber that panics is logged and skipped.
+package events
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Topic is a kind of event, carrying a T.
+type Topic[T any] struct {
+	name string
+}
+
+// NewTopic returns the topic called name, e.g. "run.finished".
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{name: name}
+}
+
+// Name returns the name of t.
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+type subscriber struct {
+	fn func(topic string, ev any)
+}
+
+// Bus delivers the events published on it to the subscribers of their
+// topic. A nil *Bus drops them.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]*subscriber // by topic, "" for those of every topic
+}
+
+func New() *Bus {
+	return &Bus{subs: make(map[string][]*subscriber)}
+}
+
+// Subscribe calls fn with every event published on topic, until the
+// returned func is called.
+func Subscribe[T any](b *Bus, topic Topic[T], fn func(T)) (unsubscribe func()) {
+	return b.add(topic.name, func(_ string, ev any) { fn(ev.(T)) })
+}
+
+// SubscribeAll calls fn with every event published on b and the name of
+// its topic, until the returned func is called. It is meant for sinks
+// that pass events on without knowing their types, such as plugins.
+func (b *Bus) SubscribeAll(fn func(topic string, ev any)) (unsubscribe func()) {
+	return b.add("", fn)
+}
+
+func (b *Bus) add(topic string, fn func(string, any)) func() {
+	s := &subscriber{fn: fn}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Subscribers are copied on write, so Publish can call them unlocked.
+	b.subs[topic] = append(slices.Clone(b.subs[topic]), s)
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subs[topic] = slices.DeleteFunc(slices.Clone(b.subs[topic]), func(x *subscriber) bool { return x == s })
+	}
+}
+
+// Publish delivers ev to the subscribers of topic, then to those of every
+// topic.
+func Publish[T any](b *Bus, topic Topic[T], ev T) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	subs, all := b.subs[topic.name], b.subs[""]
+	b.mu.RUnlock()
+	for _, s := range subs {
+		deliver(topic.name, s, ev)
+	}
+	for _, s := range all {
+		deliver(topic.name, s, ev)
+	}
+}
+
+func deliver(topic string, s *subscriber, ev any) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.ErrorCF("events", "Event subscriber panicked",
+				map[string]any{"topic": topic, "panic": fmt.Sprint(r)})
+		}
+	}()
+	s.fn(topic, ev)
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	b := New()
+	var got []string
+	stop := Subscribe(b, ToolExecuted, func(c ToolCall) { got = append(got, "first "+c.Tool) })
+	Subscribe(b, ToolExecuted, func(c ToolCall) { got = append(got, "second "+c.Tool) })
+	Subscribe(b, RunStarted, func(r Run) { got = append(got, "run "+r.AgentID) })
+	b.SubscribeAll(func(topic string, ev any) { got = append(got, "all "+topic) })
+
+	Publish(b, ToolExecuted, ToolCall{Tool: "exec"})
+	Publish(b, RunStarted, Run{AgentID: "main"})
+	want := []string{"first exec", "second exec", "all tool.executed", "run main", "all run.started"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %q, want %q", got, want)
+	}
+
+	got = nil
+	stop()
+	Publish(b, ToolExecuted, ToolCall{Tool: "read_file"})
+	want = []string{"second read_file", "all tool.executed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after unsubscribing: %q, want %q", got, want)
+	}
+}
+
+func TestBus_PanickingSubscriber(t *testing.T) {
+	b := New()
+	delivered := false
+	Subscribe(b, RunFinished, func(Run) { panic("boom") })
+	Subscribe(b, RunFinished, func(Run) { delivered = true })
+	Publish(b, RunFinished, Run{})
+	if !delivered {
+		t.Error("a panicking subscriber kept the next one from the event")
+	}
+
+	// A nil bus drops events.
+	Publish(nil, RunFinished, Run{})
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// The topics of the gateway.
+var (
+	// RunStarted and RunFinished bracket every agent run: an answer to a
+	// message, a scheduled job, a heartbeat or a workflow step.
+	RunStarted  = NewTopic[Run]("run.started")
+	RunFinished = NewTopic[Run]("run.finished")
+	// ToolExecuted follows every tool call of a run.
+	ToolExecuted = NewTopic[ToolCall]("tool.executed")
+	// LLMRequested follows every LLM request, as state/llm_events.jsonl
+	// records it.
+	LLMRequested = NewTopic[state.LLMEvent]("llm.requested")
+	// RunEvent carries what state/run_events.jsonl records, such as
+	// channel outages, flag changes and timeouts.
+	RunEvent = NewTopic[state.RunEvent]("run_event")
+	// GatewayStatus follows the gateway through its life, see the
+	// Gateway* states.
+	GatewayStatus = NewTopic[Status]("gateway.status")
+	// ConfigReloaded follows a change of the config file that was taken.
+	ConfigReloaded = NewTopic[Reload]("config.reloaded")
+)
+
+// Run is an agent run. Duration, Exit and Error are set when it finished.
+type Run struct {
+	AgentID    string        `json:"agent_id"`
+	SessionKey string        `json:"session_key,omitempty"`
+	Channel    string        `json:"channel,omitempty"`
+	ChatID     string        `json:"chat_id,omitempty"`
+	TaskID     string        `json:"task_id,omitempty"` // of a scheduled run
+	Background bool          `json:"background,omitempty"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Exit       string        `json:"exit,omitempty"` // one of the Run* exits
+	Error      string        `json:"error,omitempty"`
+}
+
+// How a run ended.
+const (
+	RunOK       = "ok"
+	RunFailed   = "error"
+	RunPanicked = "panic" // see the crash report the run event "crash" names
+)
+
+// ToolCall is a tool call of a run that returned.
+type ToolCall struct {
+	AgentID    string        `json:"agent_id"`
+	SessionKey string        `json:"session_key,omitempty"`
+	TaskID     string        `json:"task_id,omitempty"`
+	Tool       string        `json:"tool"`
+	Iteration  int           `json:"iteration"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// States of the gateway.
+const (
+	GatewayStarting = "starting"
+	GatewayReady    = "ready"
+	GatewayDraining = "draining" // stopping, letting running answers finish
+	GatewayStopped  = "stopped"
+)
+
+// Status is a state the gateway entered.
+type Status struct {
+	State string    `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+// Reload is a change of the config file: the settings applied right away
+// and those that take a restart.
+type Reload struct {
+	Path  string   `json:"path"`
+	Live  []string `json:"live,omitempty"`
+	Later []string `json:"later,omitempty"`
+}
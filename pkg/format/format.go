@@ -0,0 +1,168 @@
+// Package format converts the Markdown the agent writes into the dialect a
+// chat platform understands, and splits long replies into messages that fit
+// the platform's length limit.
+package format
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Dialect is a chat platform's flavour of rich text.
+type Dialect int
+
+const (
+	// Markdown is passed through unchanged (Matrix, Mattermost, Rocket.Chat).
+	Markdown Dialect = iota
+	// Discord is Markdown without tables, which are drawn in a code block.
+	Discord
+	// TelegramHTML targets Telegram's HTML parse mode.
+	TelegramHTML
+	// TelegramMarkdownV2 targets Telegram's MarkdownV2 parse mode, which
+	// requires escaping most punctuation.
+	TelegramMarkdownV2
+	// Slack is Slack's mrkdwn.
+	Slack
+	// WhatsApp uses *bold*, _italic_, ~strike~ and ``` but has no links.
+	WhatsApp
+	// Plain drops all markup, for SMS, email and speech.
+	Plain
+)
+
+// Format converts Markdown to the dialect.
+func Format(md string, d Dialect) string {
+	if md == "" {
+		return ""
+	}
+	r := renderer{d: d}
+	var out []string
+	for _, b := range parseBlocks(md) {
+		switch b.kind {
+		case blockCode:
+			out = append(out, r.codeBlock(b.lang, b.text))
+		case blockTable:
+			out = append(out, r.table(b.text, b.rows))
+		default:
+			out = append(out, r.line(b.text))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// Render formats md and splits it into messages of at most limit bytes. A
+// limit of 0 means no splitting.
+func Render(md string, d Dialect, limit int) []string {
+	pieces := Split(md, d, limit)
+	messages := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		messages = append(messages, Format(piece, d))
+	}
+	return messages
+}
+
+// Split cuts md into pieces whose formatted form fits in limit bytes.
+// Splitting happens on the Markdown source, at paragraph, line or word
+// boundaries and never inside a code block, so every piece is well-formed on
+// its own. Channels that may need to resend a piece in another dialect (e.g.
+// plain text after a parse error) use this instead of Render.
+func Split(md string, d Dialect, limit int) []string {
+	if strings.TrimSpace(md) == "" {
+		return nil
+	}
+	if limit <= 0 {
+		return []string{md}
+	}
+
+	var pieces []string
+	pending := utils.SplitMessage(md, limit)
+	for len(pending) > 0 {
+		piece := pending[0]
+		pending = pending[1:]
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+
+		// Escaping can make the output longer than the source; split such
+		// pieces finer in proportion.
+		if n := len(Format(piece, d)); n > limit {
+			smaller := max(len(piece)*limit/n-1, limit/4)
+			if smaller < len(piece) {
+				pending = append(utils.SplitMessage(piece, smaller), pending...)
+				continue
+			}
+		}
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
+
+type blockKind int
+
+const (
+	blockLine blockKind = iota
+	blockCode
+	blockTable
+)
+
+type block struct {
+	kind blockKind
+	text string
+	lang string
+	rows [][]string
+}
+
+var (
+	reFence          = regexp.MustCompile("^\\s*```\\s*([\\w+#.-]*)\\s*$")
+	reTableSeparator = regexp.MustCompile(`^\s*\|?\s*:?-{2,}:?\s*(\|\s*:?-{2,}:?\s*)*\|?\s*$`)
+)
+
+func parseBlocks(md string) []block {
+	lines := strings.Split(md, "\n")
+	var blocks []block
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := reFence.FindStringSubmatch(line); m != nil {
+			var code []string
+			j := i + 1
+			for ; j < len(lines) && !reFence.MatchString(lines[j]); j++ {
+				code = append(code, lines[j])
+			}
+			blocks = append(blocks, block{kind: blockCode, lang: m[1], text: strings.Join(code, "\n")})
+			i = j
+			continue
+		}
+
+		if isTableRow(line) && i+1 < len(lines) && reTableSeparator.MatchString(lines[i+1]) {
+			rows := [][]string{splitTableRow(line)}
+			j := i + 2
+			for ; j < len(lines) && isTableRow(lines[j]); j++ {
+				rows = append(rows, splitTableRow(lines[j]))
+			}
+			blocks = append(blocks, block{kind: blockTable, text: strings.Join(lines[i:j], "\n"), rows: rows})
+			i = j - 1
+			continue
+		}
+
+		blocks = append(blocks, block{kind: blockLine, text: line})
+	}
+	return blocks
+}
+
+func isTableRow(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "|") && strings.Count(line, "|") >= 2
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(strings.ReplaceAll(line, `\|`, "\x00"), "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(strings.ReplaceAll(c, "\x00", "|"))
+	}
+	return cells
+}
@@ -0,0 +1,127 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatInline(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		d    Dialect
+		want string
+	}{
+		{"html emphasis", "**bold** _it_ ~~old~~", TelegramHTML, "<b>bold</b> <i>it</i> <s>old</s>"},
+		{"html escapes text and code", "a < b `x<y`", TelegramHTML, "a &lt; b <code>x&lt;y</code>"},
+		{"html link", "[docs](https://example.com/a?b=1&c=2)", TelegramHTML,
+			`<a href="https://example.com/a?b=1&amp;c=2">docs</a>`},
+		{"snake_case is not italic", "use my_var_name here", TelegramHTML, "use my_var_name here"},
+		{"mdv2 escapes punctuation", "Done. (v1.2) #3!", TelegramMarkdownV2, `Done\. \(v1\.2\) \#3\!`},
+		{"mdv2 emphasis", "**bold** and *it*", TelegramMarkdownV2, "*bold* and _it_"},
+		{"mdv2 code escapes only backtick and backslash", "`a.b\\c`", TelegramMarkdownV2, "`a.b\\\\c`"},
+		{"mdv2 link with parentheses", "[wiki](https://en.wikipedia.org/wiki/Go_(language))", TelegramMarkdownV2,
+			`[wiki](https://en.wikipedia.org/wiki/Go_(language\))`},
+		{"slack", "**bold** [site](https://x.y) a&b", Slack, "*bold* <https://x.y|site> a&amp;b"},
+		{"whatsapp link", "see [site](https://x.y)", WhatsApp, "see site (https://x.y)"},
+		{"plain", "**bold** `code` [https://x.y](https://x.y)", Plain, "bold code https://x.y"},
+		{"markdown untouched", "**bold** _it_", Markdown, "**bold** _it_"},
+		{"unclosed markers stay literal", "2 * 3 = 6 and **oops", TelegramHTML, "2 * 3 = 6 and **oops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.in, tt.d); got != tt.want {
+				t.Errorf("Format(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBlocks(t *testing.T) {
+	md := "# Results\n- first\n> note\n```go\nx := a < b\n```"
+
+	got := Format(md, TelegramHTML)
+	want := "<b>Results</b>\n• first\n<blockquote>note</blockquote>\n" +
+		`<pre><code class="language-go">x := a &lt; b</code></pre>`
+	if got != want {
+		t.Errorf("TelegramHTML:\n%s\nwant\n%s", got, want)
+	}
+
+	got = Format(md, Plain)
+	want = "Results\n• first\nnote\nx := a < b"
+	if got != want {
+		t.Errorf("Plain:\n%s\nwant\n%s", got, want)
+	}
+
+	got = Format(md, Slack)
+	want = "*Results*\n• first\n> note\n```\nx := a &lt; b\n```"
+	if got != want {
+		t.Errorf("Slack:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatTable(t *testing.T) {
+	md := "| Fruit | Qty |\n|:--|--:|\n| **Apple** | 3 |\n| Kiwi | 12 |"
+	table := "Fruit | Qty\n------+----\nApple | 3\nKiwi  | 12"
+
+	if got := Format(md, Plain); got != table {
+		t.Errorf("Plain:\n%s\nwant\n%s", got, table)
+	}
+	if got := Format(md, Discord); got != "```\n"+table+"\n```" {
+		t.Errorf("Discord:\n%s", got)
+	}
+	if got := Format(md, TelegramHTML); got != "<pre>"+table+"</pre>" {
+		t.Errorf("TelegramHTML:\n%s", got)
+	}
+	if got := Format(md, Markdown); got != md {
+		t.Errorf("Markdown should keep the table, got:\n%s", got)
+	}
+}
+
+func TestRenderSplitsUnderLimit(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		sb.WriteString("Step 1.2.3 (see notes) - done!\n")
+	}
+	md := sb.String()
+
+	// MarkdownV2 escaping roughly doubles the punctuation, so pieces must be
+	// split finer than the source limit alone would suggest.
+	const limit = 1000
+	messages := Render(md, TelegramMarkdownV2, limit)
+	if len(messages) < 2 {
+		t.Fatalf("expected several messages, got %d", len(messages))
+	}
+	for i, m := range messages {
+		if len(m) > limit {
+			t.Errorf("message %d is %d bytes, limit %d", i, len(m), limit)
+		}
+	}
+	joined := strings.Join(messages, "\n")
+	if strings.Count(joined, `Step 1\.2\.3`) != 200 {
+		t.Error("content was lost while splitting")
+	}
+}
+
+func TestRenderKeepsCodeBlocksWhole(t *testing.T) {
+	md := strings.Repeat("intro line\n", 30) + "```\n" + strings.Repeat("code\n", 20) + "```\n" +
+		strings.Repeat("outro line\n", 30)
+
+	for _, m := range Render(md, TelegramHTML, 400) {
+		if strings.Count(m, "<pre>") != strings.Count(m, "</pre>") {
+			t.Errorf("unbalanced code block in message:\n%s", m)
+		}
+		if strings.Contains(m, "```") {
+			t.Errorf("fence leaked into message:\n%s", m)
+		}
+	}
+}
+
+func TestRenderEmpty(t *testing.T) {
+	if got := Render("  \n", Slack, 100); len(got) != 0 {
+		t.Errorf("Render(blank) = %q", got)
+	}
+	if got := Render("hi", Slack, 0); len(got) != 1 || got[0] != "hi" {
+		t.Errorf("Render without limit = %q", got)
+	}
+}
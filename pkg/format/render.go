@@ -0,0 +1,334 @@
+package format
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type renderer struct {
+	d Dialect
+}
+
+var (
+	reHeading = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+	reBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	reQuote   = regexp.MustCompile(`^>\s?(.*)$`)
+	reRule    = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+)
+
+// line renders one line outside code blocks and tables.
+func (r renderer) line(s string) string {
+	if r.d == Markdown || r.d == Discord {
+		return s
+	}
+
+	if reRule.MatchString(s) {
+		return "───"
+	}
+	if m := reHeading.FindStringSubmatch(s); m != nil {
+		return r.bold(r.inline(m[1]))
+	}
+	if m := reBullet.FindStringSubmatch(s); m != nil {
+		return m[1] + "• " + r.inline(m[2])
+	}
+	if m := reQuote.FindStringSubmatch(s); m != nil {
+		switch r.d {
+		case TelegramHTML:
+			return "<blockquote>" + r.inline(m[1]) + "</blockquote>"
+		case TelegramMarkdownV2:
+			return ">" + r.inline(m[1])
+		case Plain:
+			return r.inline(m[1])
+		default:
+			return "> " + r.inline(m[1])
+		}
+	}
+	return r.inline(s)
+}
+
+func (r renderer) codeBlock(lang, code string) string {
+	switch r.d {
+	case Markdown, Discord:
+		return "```" + lang + "\n" + code + "\n```"
+	case TelegramHTML:
+		if lang != "" {
+			return `<pre><code class="language-` + escapeHTML(lang) + `">` + escapeHTML(code) + "</code></pre>"
+		}
+		return "<pre>" + escapeHTML(code) + "</pre>"
+	case TelegramMarkdownV2:
+		return "```" + lang + "\n" + escapeMarkdownV2Code(code) + "\n```"
+	case Slack:
+		return "```\n" + escapeSlack(code) + "\n```"
+	case WhatsApp:
+		return "```\n" + code + "\n```"
+	default:
+		return code
+	}
+}
+
+// table draws a Markdown table as aligned columns, in a code block where the
+// dialect has one. Only Markdown keeps the table syntax.
+func (r renderer) table(raw string, rows [][]string) string {
+	if r.d == Markdown {
+		return raw
+	}
+
+	plain := renderer{d: Plain}
+	cells := make([][]string, len(rows))
+	var widths []int
+	for i, row := range rows {
+		cells[i] = make([]string, len(row))
+		for j, cell := range row {
+			cells[i][j] = plain.inline(cell)
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], utf8.RuneCountInString(cells[i][j]))
+		}
+	}
+
+	var lines []string
+	for i, row := range cells {
+		padded := make([]string, len(row))
+		for j, cell := range row {
+			padded[j] = cell + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(padded, " | "), " "))
+		if i == 0 {
+			sep := make([]string, len(widths))
+			for j, w := range widths {
+				sep[j] = strings.Repeat("-", w)
+			}
+			lines = append(lines, strings.Join(sep, "-+-"))
+		}
+	}
+	text := strings.Join(lines, "\n")
+
+	if r.d == Plain {
+		return text
+	}
+	return r.codeBlock("", text)
+}
+
+// inline converts emphasis, code spans and links within a line and escapes
+// everything else for the dialect.
+func (r renderer) inline(s string) string {
+	var b strings.Builder
+	literalStart := 0
+	flush := func(end int) {
+		if end > literalStart {
+			b.WriteString(r.escape(s[literalStart:end]))
+		}
+	}
+
+	for i := 0; i < len(s); {
+		span, end, ok := r.span(s, i)
+		if !ok {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			continue
+		}
+		flush(i)
+		b.WriteString(span)
+		i = end
+		literalStart = end
+	}
+	flush(len(s))
+	return b.String()
+}
+
+// span tries to parse an inline element starting at s[i]. It returns the
+// rendered element and the index after it.
+func (r renderer) span(s string, i int) (string, int, bool) {
+	switch s[i] {
+	case '`':
+		j := strings.IndexByte(s[i+1:], '`')
+		if j <= 0 {
+			return "", 0, false
+		}
+		return r.code(s[i+1 : i+1+j]), i + j + 2, true
+
+	case '[':
+		closeText := strings.Index(s[i:], "](")
+		if closeText <= 1 {
+			return "", 0, false
+		}
+		closeURL := matchingParen(s[i+closeText+2:])
+		if closeURL <= 0 {
+			return "", 0, false
+		}
+		text := s[i+1 : i+closeText]
+		url := s[i+closeText+2 : i+closeText+2+closeURL]
+		if strings.ContainsAny(url, " \t") {
+			return "", 0, false
+		}
+		return r.link(text, url), i + closeText + 3 + closeURL, true
+
+	case '*', '_', '~':
+		c := s[i]
+		if i+1 < len(s) && s[i+1] == c {
+			marker := s[i : i+2]
+			j := strings.Index(s[i+2:], marker)
+			if j <= 0 || (c == '_' && !wordBoundary(s, i-1, i+2+j+2)) {
+				return "", 0, false
+			}
+			inner := r.inline(s[i+2 : i+2+j])
+			if c == '~' {
+				return r.strike(inner), i + j + 4, true
+			}
+			return r.bold(inner), i + j + 4, true
+		}
+		if c == '~' || i+1 >= len(s) || s[i+1] == ' ' {
+			return "", 0, false
+		}
+		if c == '_' && !wordBoundary(s, i-1, -1) {
+			return "", 0, false
+		}
+		j := strings.IndexByte(s[i+1:], c)
+		if j <= 0 || s[i+j] == ' ' {
+			return "", 0, false
+		}
+		end := i + j + 2
+		if c == '_' && !wordBoundary(s, -1, end) {
+			return "", 0, false
+		}
+		return r.italic(r.inline(s[i+1 : i+1+j])), end, true
+	}
+	return "", 0, false
+}
+
+// matchingParen returns the index of the ")" closing a link target, allowing
+// balanced parentheses inside the URL, or -1.
+func matchingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// wordBoundary reports whether the characters at before and after (when
+// not -1) are not letters or digits, so snake_case isn't read as italics.
+func wordBoundary(s string, before, after int) bool {
+	isWord := func(idx int) bool {
+		if idx < 0 || idx >= len(s) {
+			return false
+		}
+		c, _ := utf8.DecodeRuneInString(s[idx:])
+		return unicode.IsLetter(c) || unicode.IsDigit(c)
+	}
+	if before != -1 && isWord(before) {
+		return false
+	}
+	if after != -1 && isWord(after) {
+		return false
+	}
+	return true
+}
+
+func (r renderer) bold(s string) string {
+	switch r.d {
+	case TelegramHTML:
+		return "<b>" + s + "</b>"
+	case TelegramMarkdownV2, Slack, WhatsApp:
+		return "*" + s + "*"
+	default:
+		return s
+	}
+}
+
+func (r renderer) italic(s string) string {
+	switch r.d {
+	case TelegramHTML:
+		return "<i>" + s + "</i>"
+	case TelegramMarkdownV2, Slack, WhatsApp:
+		return "_" + s + "_"
+	default:
+		return s
+	}
+}
+
+func (r renderer) strike(s string) string {
+	switch r.d {
+	case TelegramHTML:
+		return "<s>" + s + "</s>"
+	case TelegramMarkdownV2, Slack, WhatsApp:
+		return "~" + s + "~"
+	default:
+		return s
+	}
+}
+
+func (r renderer) code(s string) string {
+	switch r.d {
+	case TelegramHTML:
+		return "<code>" + escapeHTML(s) + "</code>"
+	case TelegramMarkdownV2:
+		return "`" + escapeMarkdownV2Code(s) + "`"
+	case Slack:
+		return "`" + escapeSlack(s) + "`"
+	case WhatsApp:
+		return "`" + s + "`"
+	default:
+		return s
+	}
+}
+
+func (r renderer) link(text, url string) string {
+	switch r.d {
+	case TelegramHTML:
+		return `<a href="` + escapeHTML(url) + `">` + r.inline(text) + "</a>"
+	case TelegramMarkdownV2:
+		url = strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(url)
+		return "[" + r.inline(text) + "](" + url + ")"
+	case Slack:
+		return "<" + url + "|" + escapeSlack(renderer{d: Plain}.inline(text)) + ">"
+	default:
+		label := r.inline(text)
+		if label == url {
+			return url
+		}
+		return label + " (" + url + ")"
+	}
+}
+
+func (r renderer) escape(s string) string {
+	switch r.d {
+	case TelegramHTML:
+		return escapeHTML(s)
+	case TelegramMarkdownV2:
+		return escapeMarkdownV2(s)
+	case Slack:
+		return escapeSlack(s)
+	default:
+		return s
+	}
+}
+
+var (
+	htmlEscaper       = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	slackEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	markdownV2Escaper = func() *strings.Replacer {
+		var pairs []string
+		for _, c := range "\\_*[]()~`>#+-=|{}.!" {
+			pairs = append(pairs, string(c), `\`+string(c))
+		}
+		return strings.NewReplacer(pairs...)
+	}()
+	markdownV2CodeEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+)
+
+func escapeHTML(s string) string           { return htmlEscaper.Replace(s) }
+func escapeSlack(s string) string          { return slackEscaper.Replace(s) }
+func escapeMarkdownV2(s string) string     { return markdownV2Escaper.Replace(s) }
+func escapeMarkdownV2Code(s string) string { return markdownV2CodeEscaper.Replace(s) }
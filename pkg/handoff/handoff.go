@@ -0,0 +1,137 @@
+// Package handoff lets the gateway restart without closing its listening
+// sockets. Restart starts the gateway's binary again and hands it the
+// sockets opened with Listen; the new process takes them over with Listen,
+// calls Ready once it serves, and the old one then finishes its runs and
+// exits. Connections that arrive meanwhile wait in the sockets' backlog
+// instead of being refused.
+package handoff
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The environment of a process started by Restart.
+const (
+	envListeners = "PICOCLAW_LISTEN_ADDRS" // the addresses of the inherited sockets, from fd 3 on
+	envReady     = "PICOCLAW_READY_FD"     // where to write once serving
+	envParent    = "PICOCLAW_HANDOFF_FROM" // the process that restarted
+)
+
+var (
+	mu        sync.Mutex
+	inherited map[string]*os.File // sockets handed over and not yet taken
+	open      []*listener
+	loadOnce  sync.Once
+)
+
+// listener is a listener opened with Listen, kept for Restart until it is
+// closed.
+type listener struct {
+	net.Listener
+	addr string
+}
+
+func (l *listener) Close() error {
+	mu.Lock()
+	for i, o := range open {
+		if o == l {
+			open = append(open[:i], open[i+1:]...)
+			break
+		}
+	}
+	mu.Unlock()
+	return l.Listener.Close()
+}
+
+// load takes the sockets handed over by the process that restarted, if
+// any.
+func load() {
+	addrs := os.Getenv(envListeners)
+	os.Unsetenv(envListeners)
+	inherited = make(map[string]*os.File)
+	if addrs == "" {
+		return
+	}
+	for i, addr := range strings.Split(addrs, ",") {
+		inherited[addr] = os.NewFile(uintptr(3+i), "listener:"+addr)
+	}
+}
+
+// Listen listens on the TCP address addr, taking over the socket the
+// process that restarted had open for it.
+func Listen(addr string) (net.Listener, error) {
+	loadOnce.Do(load)
+	mu.Lock()
+	defer mu.Unlock()
+
+	var ln net.Listener
+	if f, ok := inherited[addr]; ok {
+		delete(inherited, addr)
+		var err error
+		ln, err = net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to take over the socket of %s: %w", addr, err)
+		}
+	} else {
+		var err error
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	l := &listener{Listener: ln, addr: addr}
+	open = append(open, l)
+	return l, nil
+}
+
+// ListenAndServe is srv.ListenAndServe with a socket from Listen.
+func ListenAndServe(srv *http.Server) error {
+	ln, err := Listen(srv.Addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// ListenAndServeTLS is srv.ListenAndServeTLS with a socket from Listen.
+func ListenAndServeTLS(srv *http.Server, certFile, keyFile string) error {
+	ln, err := Listen(srv.Addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeTLS(ln, certFile, keyFile)
+}
+
+// Ready tells the process that restarted, if any, that this one serves,
+// and closes the sockets it handed over that were not taken.
+func Ready() {
+	loadOnce.Do(load)
+	mu.Lock()
+	for addr, f := range inherited {
+		f.Close()
+		delete(inherited, addr)
+	}
+	mu.Unlock()
+
+	fd, err := strconv.Atoi(os.Getenv(envReady))
+	os.Unsetenv(envReady)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// Parent returns the process that restarted into this one, 0 when it was
+// started otherwise.
+func Parent() int {
+	pid, _ := strconv.Atoi(os.Getenv(envParent))
+	return pid
+}
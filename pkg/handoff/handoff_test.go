@@ -0,0 +1,76 @@
+//go:build !windows
+
+package handoff
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRestart runs twice: in the test process, which restarts into a new
+// one running the same tests, and in that process, which takes over the
+// socket and answers one connection on it.
+func TestRestart(t *testing.T) {
+	addr := "127.0.0.1:0"
+	if Parent() != 0 {
+		ln, err := Listen(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		Ready()
+		ln.(*listener).Listener.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("new"))
+		conn.Close()
+		return
+	}
+
+	ln, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Restart(30 * time.Second)
+	if err != nil {
+		t.Fatalf("Restart() error: %v", err)
+	}
+	// From here on only the new process accepts on the socket.
+	ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	got, _ := io.ReadAll(conn)
+	if string(got) != "new" {
+		t.Errorf("read %q from the new process", got)
+	}
+}
+
+func TestListen_NothingHandedOver(t *testing.T) {
+	if Parent() != 0 {
+		return
+	}
+	ln, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) == 0 {
+		t.Error("the listener is not kept for a restart")
+	}
+	ln.Close()
+	for _, l := range open {
+		if l.Listener == ln.(*listener).Listener {
+			t.Error("the closed listener is still kept for a restart")
+		}
+	}
+	os.Unsetenv(envReady)
+	Ready() // nothing to tell
+}
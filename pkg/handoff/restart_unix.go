@@ -0,0 +1,126 @@
+//go:build !windows
+
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RestartSignal asks the gateway to restart with Restart.
+var RestartSignal os.Signal = syscall.SIGUSR2
+
+// Supported reports whether this system can hand sockets over.
+const Supported = true
+
+// Restart starts the running binary again with the same arguments,
+// handing it the open listeners, and waits until it calls Ready. A
+// process that exits or is not ready within timeout is stopped, and the
+// error says why. The new process is reaped here when it exits, so
+// callers must not Wait for it.
+func Restart(timeout time.Duration) (*os.Process, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	var files []*os.File
+	var addrs []string
+	for _, l := range open {
+		fl, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			mu.Unlock()
+			closeAll(files)
+			return nil, fmt.Errorf("failed to hand over %s: %w", l.addr, err)
+		}
+		files = append(files, f)
+		addrs = append(addrs, l.addr)
+	}
+	mu.Unlock()
+	defer closeAll(files)
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "PICOCLAW_LISTEN_") && !strings.HasPrefix(kv, "PICOCLAW_READY_") &&
+			!strings.HasPrefix(kv, "PICOCLAW_HANDOFF_") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	cmd.Env = append(cmd.Env,
+		envListeners+"="+strings.Join(addrs, ","),
+		envReady+"="+strconv.Itoa(3+len(files)),
+		envParent+"="+strconv.Itoa(os.Getpid()),
+	)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", exe, err)
+	}
+
+	// The byte comes when the new process is ready; EOF when it exits
+	// before.
+	got := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(ready, make([]byte, 1))
+		got <- err
+	}()
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-got:
+		if err == nil {
+			return cmd.Process, nil
+		}
+		err = <-exited
+		return nil, fmt.Errorf("the new process exited before it was ready: %v", err)
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return nil, errors.New("the new process was not ready in time")
+	}
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// WaitParent waits until the process that restarted into this one has
+// exited, or ctx ends. It returns at once when there is none.
+func WaitParent(ctx context.Context) {
+	pid := Parent()
+	if pid == 0 {
+		return
+	}
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for syscall.Kill(pid, 0) == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
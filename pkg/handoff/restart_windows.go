@@ -0,0 +1,25 @@
+//go:build windows
+
+package handoff
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// RestartSignal is nil: Windows has no signal to restart with.
+var RestartSignal os.Signal
+
+// Supported reports whether this system can hand sockets over.
+const Supported = false
+
+// Restart is not supported on Windows, which cannot pass sockets to a
+// child process this way.
+func Restart(timeout time.Duration) (*os.Process, error) {
+	return nil, errors.New("restarting with handed-over sockets is not supported on Windows")
+}
+
+// WaitParent returns at once: no process restarts into another on Windows.
+func WaitParent(ctx context.Context) {}
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/handoff"
 )
 
 // InjectMessage is the payload accepted by the /inject endpoint.
@@ -23,11 +27,23 @@ type InjectHandler func(msg InjectMessage)
 
 type Server struct {
 	server        *http.Server
+	mux           *http.ServeMux
 	mu            sync.RWMutex
 	ready         bool
 	checks        map[string]Check
 	startTime     time.Time
 	injectHandler InjectHandler
+	metrics       map[string]metric
+	status        func() any
+}
+
+type metric struct {
+	help  string
+	value func() float64
+	// label and values are set instead of value for a gauge with one
+	// sample per label value.
+	label  string
+	values func() map[string]float64
 }
 
 type Check struct {
@@ -46,13 +62,17 @@ type StatusResponse struct {
 func NewServer(host string, port int) *Server {
 	mux := http.NewServeMux()
 	s := &Server{
+		mux:       mux,
 		ready:     false,
 		checks:    make(map[string]Check),
 		startTime: time.Now(),
+		metrics:   make(map[string]metric),
 	}
 
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/ready", s.readyHandler)
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.HandleFunc("/status", s.statusHandler)
 
 	addr := fmt.Sprintf("%s:%d", host, port)
 	s.server = &http.Server{
@@ -69,7 +89,7 @@ func (s *Server) Start() error {
 	s.mu.Lock()
 	s.ready = true
 	s.mu.Unlock()
-	return s.server.ListenAndServe()
+	return handoff.ListenAndServe(s.server)
 }
 
 func (s *Server) StartContext(ctx context.Context) error {
@@ -79,7 +99,7 @@ func (s *Server) StartContext(ctx context.Context) error {
 
 	errCh := make(chan error, 1)
 	go func() {
-		errCh <- s.server.ListenAndServe()
+		errCh <- handoff.ListenAndServe(s.server)
 	}()
 
 	select {
@@ -103,6 +123,12 @@ func (s *Server) SetReady(ready bool) {
 	s.mu.Unlock()
 }
 
+// Handle serves the requests for pattern with h, next to the health
+// endpoints. It must be called before Start.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
 func (s *Server) RegisterCheck(name string, checkFn func() (bool, string)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -116,6 +142,73 @@ func (s *Server) RegisterCheck(name string, checkFn func() (bool, string)) {
 	}
 }
 
+// RegisterGauge exposes a value on /metrics in the Prometheus text format.
+// value is called on every scrape.
+func (s *Server) RegisterGauge(name, help string, value func() float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics[name] = metric{help: help, value: value}
+}
+
+// RegisterGaugeVec exposes a gauge with one sample per label value, e.g.
+// name{channel="telegram"}. values is called on every scrape.
+func (s *Server) RegisterGaugeVec(name, help, label string, values func() map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics[name] = metric{help: help, label: label, values: values}
+}
+
+// SetStatus serves what status returns as JSON on /status, for picoclaw
+// status and monitoring scripts.
+func (s *Server) SetStatus(status func() any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	status := s.status
+	s.mu.RUnlock()
+	if status == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status())
+}
+
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.metrics))
+	for name := range s.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		m := s.metrics[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, m.help, name)
+		if m.values == nil {
+			fmt.Fprintf(&b, "%s %g\n", name, m.value())
+			continue
+		}
+		samples := m.values()
+		keys := make([]string, 0, len(samples))
+		for k := range samples {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s{%s=%q} %g\n", name, m.label, k, samples[k])
+		}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -16,6 +16,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
@@ -31,12 +32,19 @@ const (
 // channel and chatID are derived from the last active user channel.
 type HeartbeatHandler func(prompt, channel, chatID string) *tools.ToolResult
 
+// DigestHandler writes and sends the digest, see SetDigest.
+type DigestHandler func() error
+
 // HeartbeatService manages periodic heartbeat checks
 type HeartbeatService struct {
 	workspace string
 	bus       *bus.MessageBus
 	state     *state.Manager
 	handler   HeartbeatHandler
+	digest    DigestHandler
+	schedule  cron.CronSchedule // of the digest
+	alerts    func() []tools.DeviceAlert
+	alerted   map[string]bool // kinds of the alerts of the last check
 	interval  time.Duration
 	enabled   bool
 	mu        sync.RWMutex
@@ -76,6 +84,24 @@ func (hs *HeartbeatService) SetHandler(handler HeartbeatHandler) {
 	hs.handler = handler
 }
 
+// SetDigest has the service call handler at every run of schedule, also
+// when the heartbeat checks are disabled. It must be called before Start.
+func (hs *HeartbeatService) SetDigest(schedule cron.CronSchedule, handler DigestHandler) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.schedule = schedule
+	hs.digest = handler
+}
+
+// SetDeviceAlerts has every heartbeat check the board with alerts and
+// ask the agent to warn about the problems that were not there at the
+// previous check, also when HEARTBEAT.md has no tasks.
+func (hs *HeartbeatService) SetDeviceAlerts(alerts func() []tools.DeviceAlert) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.alerts = alerts
+}
+
 // Start begins the heartbeat service
 func (hs *HeartbeatService) Start() error {
 	hs.mu.Lock()
@@ -86,13 +112,16 @@ func (hs *HeartbeatService) Start() error {
 		return nil
 	}
 
-	if !hs.enabled {
+	if !hs.enabled && hs.digest == nil {
 		logger.InfoC("heartbeat", "Heartbeat service disabled")
 		return nil
 	}
 
 	hs.stopChan = make(chan struct{})
 	go hs.runLoop(hs.stopChan)
+	if hs.digest != nil {
+		go hs.digestLoop(hs.stopChan)
+	}
 
 	logger.InfoCF("heartbeat", "Heartbeat service started", map[string]any{
 		"interval_minutes": hs.interval.Minutes(),
@@ -124,6 +153,9 @@ func (hs *HeartbeatService) IsRunning() bool {
 
 // runLoop runs the heartbeat ticker
 func (hs *HeartbeatService) runLoop(stopChan chan struct{}) {
+	if !hs.enabled {
+		return
+	}
 	ticker := time.NewTicker(hs.interval)
 	defer ticker.Stop()
 
@@ -159,7 +191,7 @@ func (hs *HeartbeatService) executeHeartbeat() {
 
 	logger.DebugC("heartbeat", "Executing heartbeat")
 
-	prompt := hs.buildPrompt()
+	prompt := hs.buildPrompt(hs.newAlerts())
 	if prompt == "" {
 		logger.InfoC("heartbeat", "No heartbeat prompt (HEARTBEAT.md empty or missing)")
 		return
@@ -215,24 +247,75 @@ func (hs *HeartbeatService) executeHeartbeat() {
 	hs.logInfo("Heartbeat completed: %s", result.ForLLM)
 }
 
-// buildPrompt builds the heartbeat prompt from HEARTBEAT.md
-func (hs *HeartbeatService) buildPrompt() string {
+// digestLoop sends the digest at each run of its schedule.
+func (hs *HeartbeatService) digestLoop(stopChan chan struct{}) {
+	for {
+		runs := cron.NextRuns(hs.schedule, time.Now(), 1)
+		if len(runs) == 0 {
+			hs.logError("The digest schedule %s has no next run", hs.schedule)
+			return
+		}
+		timer := time.NewTimer(time.Until(runs[0]))
+		select {
+		case <-stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := hs.digest(); err != nil {
+			hs.logError("Digest failed: %v", err)
+			continue
+		}
+		hs.logInfo("Digest sent")
+	}
+}
+
+// newAlerts returns the device alerts that were not there at the previous
+// check.
+func (hs *HeartbeatService) newAlerts() []tools.DeviceAlert {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.alerts == nil {
+		return nil
+	}
+	var fresh []tools.DeviceAlert
+	alerted := make(map[string]bool)
+	for _, a := range hs.alerts() {
+		alerted[a.Kind] = true
+		if !hs.alerted[a.Kind] {
+			fresh = append(fresh, a)
+		}
+	}
+	hs.alerted = alerted
+	return fresh
+}
+
+// buildPrompt builds the heartbeat prompt from HEARTBEAT.md and the
+// device alerts to warn about
+func (hs *HeartbeatService) buildPrompt(alerts []tools.DeviceAlert) string {
 	heartbeatPath := filepath.Join(hs.workspace, "HEARTBEAT.md")
 
 	data, err := os.ReadFile(heartbeatPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			hs.createDefaultHeartbeatTemplate()
-			return ""
+		} else {
+			hs.logError("Error reading HEARTBEAT.md: %v", err)
 		}
-		hs.logError("Error reading HEARTBEAT.md: %v", err)
-		return ""
 	}
 
 	content := string(data)
-	if len(content) == 0 {
+	if len(content) == 0 && len(alerts) == 0 {
 		return ""
 	}
+	if len(alerts) > 0 {
+		var b strings.Builder
+		b.WriteString("## Device\n\nTell the user about these problems of the board you run on, and what they can do about them:\n")
+		for _, a := range alerts {
+			fmt.Fprintf(&b, "- %s\n", a.Message)
+		}
+		content = b.String() + "\n" + content
+	}
 
 	now := time.Now().Format("2006-01-02 15:04:05")
 	return fmt.Sprintf(`# Heartbeat Check
@@ -308,9 +391,10 @@ func (hs *HeartbeatService) sendResponse(response string) {
 	}
 
 	msgBus.PublishOutbound(bus.OutboundMessage{
-		Channel: platform,
-		ChatID:  userID,
-		Content: response,
+		Channel:   platform,
+		ChatID:    userID,
+		Content:   response,
+		Proactive: true,
 	})
 
 	hs.logInfo("Heartbeat result sent to %s", platform)
@@ -3,9 +3,11 @@ package heartbeat
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -211,7 +213,7 @@ func TestHeartbeatFilePath(t *testing.T) {
 	hs := NewHeartbeatService(tmpDir, 30, true)
 
 	// Trigger default template creation
-	hs.buildPrompt()
+	hs.buildPrompt(nil)
 
 	// Verify HEARTBEAT.md exists at workspace root
 	expectedPath := filepath.Join(tmpDir, "HEARTBEAT.md")
@@ -219,3 +221,58 @@ func TestHeartbeatFilePath(t *testing.T) {
 		t.Errorf("Expected HEARTBEAT.md at %s, but it doesn't exist", expectedPath)
 	}
 }
+
+func TestDigestRunsWithHeartbeatDisabled(t *testing.T) {
+	hs := NewHeartbeatService(t.TempDir(), 30, false)
+	every := int64(50)
+	sent := make(chan struct{}, 10)
+	hs.SetDigest(cron.CronSchedule{Kind: "every", EveryMS: &every}, func() error {
+		sent <- struct{}{}
+		return nil
+	})
+	if err := hs.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer hs.Stop()
+
+	for range 2 {
+		select {
+		case <-sent:
+		case <-time.After(2 * time.Second):
+			t.Fatal("the digest was not sent")
+		}
+	}
+}
+
+func TestExecuteHeartbeat_WarnsAboutNewDeviceAlerts(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "HEARTBEAT.md"), nil, 0o644)
+	hs := NewHeartbeatService(workspace, 30, true)
+	hs.stopChan = make(chan struct{})
+	alerts := []tools.DeviceAlert{{Kind: "hot", Message: "The board is hot: cpu-thermal is at 82.0°C, above 80°C."}}
+	hs.SetDeviceAlerts(func() []tools.DeviceAlert { return alerts })
+	var prompts []string
+	hs.SetHandler(func(prompt, channel, chatID string) *tools.ToolResult {
+		prompts = append(prompts, prompt)
+		return tools.SilentResult("HEARTBEAT_OK")
+	})
+
+	// HEARTBEAT.md has no tasks yet, and the board is hot.
+	hs.executeHeartbeat()
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "82.0°C") {
+		t.Fatalf("prompts = %q, want the alert", prompts)
+	}
+	// Still hot: warned about already.
+	hs.executeHeartbeat()
+	if len(prompts) != 1 {
+		t.Fatalf("warned again: %q", prompts[1:])
+	}
+	// Cooled down, then hot again.
+	alerts = nil
+	hs.executeHeartbeat()
+	alerts = []tools.DeviceAlert{{Kind: "hot", Message: "The board is hot again."}}
+	hs.executeHeartbeat()
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "hot again") {
+		t.Errorf("prompts = %q", prompts)
+	}
+}
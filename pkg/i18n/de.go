@@ -0,0 +1,162 @@
+package i18n
+
+// german translates the messages into German.
+var german = map[string]string{
+	"Nothing is waiting for approval.":       "Nichts wartet auf Freigabe.",
+	"Nothing to stop.":                       "Es läuft nichts, das gestoppt werden könnte.",
+	"Stopped.":                               "Gestoppt.",
+	"%s is only available in the admin chat": "%s ist nur im Admin-Chat verfügbar",
+	"Usage: /language [%s|default]":          "Verwendung: /language [%s|default]",
+	"Commands are answered in English.":      "Befehle werden auf Deutsch beantwortet.",
+	"Profiles need to know who is writing, which this channel does not say.": "Profile müssen wissen, wer schreibt, und dieser Kanal sagt das nicht.",
+	"Failed to save your profile: %v":                                        "Dein Profil konnte nicht gespeichert werden: %v",
+	"Commands:\n/new - start a new conversation\n/reset - clear this conversation\n/undo [turns] - take back the last turns\n/branch [turns] - continue from an earlier point, keeping the original\n/sessions - list the conversations in this chat\n/persona [<id>|default] - choose who answers\n/pin <instruction> - pin an instruction to this chat; /pins lists them\n/memories - what was remembered here; /forget <id> forgets one\n/profile - what I know about you\n/schedule - what is scheduled here and when it runs next\n/jobs - how the scheduled jobs here last ran\n/language [code|default] - the language I answer commands in\n/whoami - who answers you and why\n/stop - stop the current answer": "Befehle:\n/new - ein neues Gespräch beginnen\n/reset - dieses Gespräch leeren\n/undo [turns] - die letzten Runden zurücknehmen\n/branch [turns] - von einem früheren Punkt weitermachen, das Original bleibt erhalten\n/sessions - die Gespräche in diesem Chat auflisten\n/persona [<id>|default] - wählen, wer antwortet\n/pin <instruction> - eine Anweisung an diesen Chat heften; /pins listet sie\n/memories - was hier gemerkt wurde; /forget <id> vergisst einen Eintrag\n/profile - was ich über dich weiß\n/schedule - was hier geplant ist und wann es als Nächstes läuft\n/jobs - wie die geplanten Aufgaben hier zuletzt liefen\n/language [code|default] - die Sprache, in der ich Befehle beantworte\n/whoami - wer dir antwortet und warum\n/stop - die aktuelle Antwort abbrechen",
+	"Admin: /status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd": "Admin: /status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd",
+	"Error processing message: %v":                                        "Fehler beim Verarbeiten der Nachricht: %v",
+	"Usage: /show [model|channel|agents]":                                 "Verwendung: /show [model|channel|agents]",
+	"No default agent configured":                                         "Kein Standard-Agent konfiguriert",
+	"Current model: %s":                                                   "Aktuelles Modell: %s",
+	"Current channel: %s":                                                 "Aktueller Kanal: %s",
+	"Registered agents: %s":                                               "Registrierte Agenten: %s",
+	"Unknown show target: %s":                                             "Unbekanntes Ziel für /show: %s",
+	"Usage: /list [models|channels|agents]":                               "Verwendung: /list [models|channels|agents]",
+	"Available models: configured in config.json per agent":               "Verfügbare Modelle: pro Agent in config.json konfiguriert",
+	"Channel manager not initialized":                                     "Kanalverwaltung nicht initialisiert",
+	"No channels enabled":                                                 "Keine Kanäle aktiviert",
+	"Enabled channels: %s":                                                "Aktivierte Kanäle: %s",
+	"Unknown list target: %s":                                             "Unbekanntes Ziel für /list: %s",
+	"Usage: /switch [model|channel] to <name>":                            "Verwendung: /switch [model|channel] to <name>",
+	"Switched model from %s to %s":                                        "Modell von %s auf %s umgestellt",
+	"Channel '%s' not found or not enabled":                               "Kanal '%s' nicht gefunden oder nicht aktiviert",
+	"Switched target channel to %s":                                       "Zielkanal auf %s umgestellt",
+	"Unknown switch target: %s":                                           "Unbekanntes Ziel für /switch: %s",
+	"Usage: /broadcast <message>":                                         "Verwendung: /broadcast <message>",
+	"No broadcast targets configured":                                     "Keine Broadcast-Ziele konfiguriert",
+	"Usage: /forget <id>, with the ID from /memories":                     "Verwendung: /forget <id>, mit der ID aus /memories",
+	"There is no memory #%d from this chat.":                              "Es gibt keine Erinnerung #%d aus diesem Chat.",
+	"Failed to forget #%d: %v":                                            "#%d konnte nicht vergessen werden: %v",
+	"Forgot #%d: %s":                                                      "#%d vergessen: %s",
+	"Usage: /memories [all | pending | approve [n] | reject [n]]":         "Verwendung: /memories [all | pending | approve [n] | reject [n]]",
+	"Nothing remembered yet.":                                             "Noch nichts gemerkt.",
+	"Nothing remembered from this chat yet.":                              "Aus diesem Chat ist noch nichts gemerkt.",
+	"Remembered from this chat (forget one with /forget <id>):":           "Aus diesem Chat gemerkt (vergessen mit /forget <id>):",
+	"Everything remembered (forget one with /forget <id>):":               "Alles Gemerkte (vergessen mit /forget <id>):",
+	"No memory changes are waiting for approval.":                         "Keine Gedächtnisänderungen warten auf Freigabe.",
+	"Memory changes waiting for approval (/memories approve|reject [n]):": "Gedächtnisänderungen, die auf Freigabe warten (/memories approve|reject [n]):",
+	"Usage: /memories %s [n], with the number from /memories pending":     "Verwendung: /memories %s [n], mit der Nummer aus /memories pending",
+	"Failed to update the pending changes: %v":                            "Die wartenden Änderungen konnten nicht aktualisiert werden: %v",
+	"No such memory change is waiting for approval.":                      "Keine solche Gedächtnisänderung wartet auf Freigabe.",
+	"Rejected %d memory changes.":                                         "%d Gedächtnisänderungen abgelehnt.",
+	"Failed to apply a memory change: %v":                                 "Eine Gedächtnisänderung konnte nicht übernommen werden: %v",
+	"Applied %d memory changes.":                                          "%d Gedächtnisänderungen übernommen.",
+	"Your profile is empty. Tell me about yourself, or use /profile name|timezone|locale|pref|instruct.": "Dein Profil ist leer. Erzähl mir von dir oder nutze /profile name|timezone|locale|pref|instruct.",
+	"Usage: /profile %s <value>": "Verwendung: /profile %s <value>",
+	"Saved your name.":           "Dein Name ist gespeichert.",
+	"Saved your locale.":         "Deine Sprache und Region sind gespeichert.",
+	"Usage: /profile timezone <IANA name, e.g. Europe/Berlin>": "Verwendung: /profile timezone <IANA-Name, z. B. Europe/Berlin>",
+	"Saved your time zone.":                  "Deine Zeitzone ist gespeichert.",
+	"Usage: /profile pref <key> <value>":     "Verwendung: /profile pref <key> <value>",
+	"Saved your preference for %s.":          "Deine Vorliebe für %s ist gespeichert.",
+	"Usage: /profile instruct <instruction>": "Verwendung: /profile instruct <instruction>",
+	"I'll follow that from now on.":          "Daran halte ich mich ab jetzt.",
+	"Usage: /profile forget <name|timezone|locale|preference key|instruction number>": "Verwendung: /profile forget <name|timezone|locale|Vorlieben-Schlüssel|Nummer der Anweisung>",
+	"Nothing called %q in your profile.":                                              "In deinem Profil gibt es nichts namens %q.",
+	"Forgot %s.":                                                                      "%s vergessen.",
+	"Failed to delete your profile: %v":                                               "Dein Profil konnte nicht gelöscht werden: %v",
+	"Deleted your profile.":                                                           "Dein Profil ist gelöscht.",
+	"Usage: /profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]": "Verwendung: /profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]",
+	"Started a new conversation. Earlier ones are listed by /sessions.":                                             "Neues Gespräch begonnen. Frühere listet /sessions.",
+	"Conversation history cleared.": "Gesprächsverlauf geleert.",
+	"Usage: %s [turns]":             "Verwendung: %s [turns]",
+	"Branched this conversation; the original is kept and listed by /sessions.":                        "Gespräch abgezweigt; das Original bleibt erhalten und wird von /sessions gelistet.",
+	"Branched this conversation as it was %d turns ago; the original is kept and listed by /sessions.": "Gespräch so abgezweigt, wie es vor %d Runden war; das Original bleibt erhalten und wird von /sessions gelistet.",
+	"There is nothing to undo in this conversation.":                                                   "In diesem Gespräch gibt es nichts zurückzunehmen.",
+	"Undid the last %d turns.":                                                                     "Die letzten %d Runden zurückgenommen.",
+	"Undid the last turn.":                                                                         "Die letzte Runde zurückgenommen.",
+	" Forgot %d facts remembered in them.":                                                         " %d darin gemerkte Fakten vergessen.",
+	"No conversations in this chat yet.":                                                           "In diesem Chat gibt es noch keine Gespräche.",
+	"Conversations in this chat:":                                                                  "Gespräche in diesem Chat:",
+	"%s %d messages, last active %s ago%s":                                                         "%s %d Nachrichten, zuletzt aktiv vor %s%s",
+	"Personas (switch with /persona <id>, back with /persona default):":                            "Personas (wechseln mit /persona <id>, zurück mit /persona default):",
+	"Usage: /persona [<id>|default]":                                                               "Verwendung: /persona [<id>|default]",
+	"This conversation follows the routing rules again.":                                           "Dieses Gespräch folgt wieder den Routing-Regeln.",
+	"This conversation is answered by %s again.":                                                   "Dieses Gespräch beantwortet wieder %s.",
+	"Unknown persona: %s. Personas: %s":                                                            "Unbekannte Persona: %s. Personas: %s",
+	"This conversation is answered by %s until /new or /persona default.":                          "Dieses Gespräch beantwortet %s bis /new oder /persona default.",
+	"Usage: /pin <instruction>, e.g. /pin always answer in German here":                            "Verwendung: /pin <instruction>, z. B. /pin antworte hier immer auf Deutsch",
+	"Failed to pin the instruction: %v":                                                            "Die Anweisung konnte nicht angeheftet werden: %v",
+	"Pinned. I'll follow that in this chat; /pins lists what is pinned.":                           "Angeheftet. Daran halte ich mich in diesem Chat; /pins listet, was angeheftet ist.",
+	"Nothing is pinned in this chat. Pin an instruction with /pin <instruction>.":                  "In diesem Chat ist nichts angeheftet. Hefte eine Anweisung mit /pin <instruction> an.",
+	"Pinned in this chat (remove with /pins remove <n>|all):":                                      "In diesem Chat angeheftet (entfernen mit /pins remove <n>|all):",
+	"Usage: /pins [remove <n>|all]":                                                                "Verwendung: /pins [remove <n>|all]",
+	"Failed to unpin: %v":                                                                          "Konnte nicht gelöst werden: %v",
+	"There is no pinned instruction %d.":                                                           "Es gibt keine angeheftete Anweisung %d.",
+	"Removed %d pinned instructions.":                                                              "%d angeheftete Anweisungen entfernt.",
+	"Removed: %s":                                                                                  "Entfernt: %s",
+	"Current conversation: %d messages%s":                                                          "Aktuelles Gespräch: %d Nachrichten%s",
+	"Usage: /session agent <id>":                                                                   "Verwendung: /session agent <id>",
+	"Unknown agent: %s. Registered agents: %s":                                                     "Unbekannter Agent: %s. Registrierte Agenten: %s",
+	"This conversation now uses agent %s":                                                          "Dieses Gespräch nutzt jetzt den Agenten %s",
+	"Usage: /session model <name>":                                                                 "Verwendung: /session model <name>",
+	"This conversation now uses model %s":                                                          "Dieses Gespräch nutzt jetzt das Modell %s",
+	"This conversation uses the default agent and model again":                                     "Dieses Gespräch nutzt wieder den Standard-Agenten und das Standardmodell",
+	"Usage: /session [agent <id>|model <name>|unpin]":                                              "Verwendung: /session [agent <id>|model <name>|unpin]",
+	"Context window exceeded. Compressing history and retrying...":                                 "Kontextfenster überschritten. Verlauf wird komprimiert und erneut versucht...",
+	"Memory threshold reached. Optimizing conversation history...":                                 "Speichergrenze erreicht. Gesprächsverlauf wird optimiert...",
+	"You may not use %s here.":                                                                     "Du darfst %s hier nicht verwenden.",
+	"Failed to run %s: %v":                                                                         "%s konnte nicht ausgeführt werden: %v",
+	"Commands of this assistant:":                                                                  "Befehle dieses Assistenten:",
+	"Scheduled jobs are only available in the gateway.":                                            "Geplante Aufgaben gibt es nur im Gateway.",
+	"Usage: /schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]": "Verwendung: /schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]",
+	"Could not read %q: %v":                                                                        "%q ist nicht lesbar: %v",
+	"Read as: %s":                                                                                  "Verstanden als: %s",
+	"There is no job %s in this chat.":                                                             "In diesem Chat gibt es keine Aufgabe %s.",
+	"Failed to change the schedule: %v":                                                            "Der Zeitplan konnte nicht geändert werden: %v",
+	"%s now runs %s.":                                                                              "%s läuft jetzt %s.",
+	"Paused %s.":                                                                                   "%s pausiert.",
+	"Resumed %s.":                                                                                  "%s fortgesetzt.",
+	"Removed %s.":                                                                                  "%s entfernt.",
+	"paused":                                                                                       "pausiert",
+	"next %s":                                                                                      "nächster Lauf %s",
+	"Nothing is scheduled in this chat. Ask me to remind you of something, or try /schedule preview every weekday at 8.": "In diesem Chat ist nichts geplant. Bitte mich, dich an etwas zu erinnern, oder probiere /schedule preview every weekday at 8.",
+	"Scheduled here:":        "Hier geplant:",
+	"It will not run again.": "Es läuft nicht mehr.",
+	"Next runs:":             "Nächste Läufe:",
+	"Usage: /jobs [<id>]":    "Verwendung: /jobs [<id>]",
+	"not run yet":            "noch nicht gelaufen",
+	"(%d failures in a row)": "(%d Fehler in Folge)",
+	"Scheduled jobs:":        "Geplante Aufgaben:",
+	"%s has not run yet.":    "%s ist noch nicht gelaufen.",
+	"Latest runs of %s:":     "Letzte Läufe von %s:",
+	"late":                   "verspätet",
+	"Workflows are only available in the gateway.":                                             "Workflows gibt es nur im Gateway.",
+	"Usage: /workflow [list|run <name> [input]|trace <name>]":                                  "Verwendung: /workflow [list|run <name> [input]|trace <name>]",
+	"There is no workflow %s.":                                                                 "Es gibt keinen Workflow %s.",
+	"✅ Workflow %s finished in %s.":                                                            "✅ Workflow %s ist nach %s fertig.",
+	"❌ Workflow %s failed: %s\nSee /workflow trace %s":                                         "❌ Workflow %s ist fehlgeschlagen: %s\nSiehe /workflow trace %s",
+	"Running workflow %s, I'll tell you how it went.":                                          "Workflow %s läuft, ich sage dir, wie es ausging.",
+	"There are no workflows. Add them as YAML files to the workflows folder of the workspace.": "Es gibt keine Workflows. Lege sie als YAML-Dateien im Ordner workflows des Workspace an.",
+	"Workflows:":                   "Workflows:",
+	"Not loaded: %s":               "Nicht geladen: %s",
+	"Last run of %s:":              "Letzter Lauf von %s:",
+	"%d attempts":                  "%d Versuche",
+	"Messages to send later:":      "Später zu sendende Nachrichten:",
+	"Cancelled the message to %s.": "Die Nachricht an %s wurde abgebrochen.",
+	"⏱️ I stopped working on this: %s took longer than %s.":           "⏱️ Ich habe hier abgebrochen: %s dauerte länger als %s.",
+	"⏱️ I stopped working on this after %s, while in %s.":             "⏱️ Ich habe hier nach %s abgebrochen, während %s.",
+	"Do-not-disturb is not set up. Enable gateway.dnd in the config.": "„Nicht stören“ ist nicht eingerichtet. Aktiviere gateway.dnd in der Konfiguration.",
+	"Usage: /dnd on [2h|tomorrow at 9]":                               "Verwendung: /dnd on [2h|tomorrow at 9]",
+	"Could not turn do-not-disturb on: %v":                            "„Nicht stören“ konnte nicht eingeschaltet werden: %v",
+	"Do not disturb until %s. Urgent alerts still come through.":      "Nicht stören bis %s. Dringende Warnungen kommen weiterhin durch.",
+	"Could not turn do-not-disturb off: %v":                           "„Nicht stören“ konnte nicht ausgeschaltet werden: %v",
+	"Do-not-disturb is off, but you are busy with %s until %s.":       "„Nicht stören“ ist aus, aber du bist mit %s bis %s beschäftigt.",
+	"Do-not-disturb is off.":                                          "„Nicht stören“ ist aus.",
+	"Usage: /dnd [on [2h|tomorrow at 9]|off]":                         "Verwendung: /dnd [on [2h|tomorrow at 9]|off]",
+	"Do not disturb: %s, until %s.":                                   "Nicht stören: %s, bis %s.",
+	"You can be disturbed now.":                                       "Du kannst gerade gestört werden.",
+	"Busy today:":                                                     "Heute beschäftigt:",
+	"⚠️ The calendar could not be read: %v":                           "⚠️ Der Kalender konnte nicht gelesen werden: %v",
+	"The calendar has not been read yet.":                             "Der Kalender wurde noch nicht gelesen.",
+	"Calendar read %s.":                                               "Kalender gelesen %s.",
+	"⏳ You're #%d in the queue, I'll answer as soon as I can.":        "⏳ Du bist Nr. %d in der Warteschlange, ich antworte so bald wie möglich.",
+}
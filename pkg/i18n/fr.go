@@ -0,0 +1,162 @@
+package i18n
+
+// french translates the messages into French.
+var french = map[string]string{
+	"Nothing is waiting for approval.":       "Rien n'attend d'approbation.",
+	"Nothing to stop.":                       "Rien à arrêter.",
+	"Stopped.":                               "Arrêté.",
+	"%s is only available in the admin chat": "%s n'est disponible que dans le chat d'administration",
+	"Usage: /language [%s|default]":          "Utilisation : /language [%s|default]",
+	"Commands are answered in English.":      "Les commandes sont traitées en français.",
+	"Profiles need to know who is writing, which this channel does not say.": "Les profils doivent savoir qui écrit, et ce canal ne l'indique pas.",
+	"Failed to save your profile: %v":                                        "Impossible d'enregistrer votre profil : %v",
+	"Commands:\n/new - start a new conversation\n/reset - clear this conversation\n/undo [turns] - take back the last turns\n/branch [turns] - continue from an earlier point, keeping the original\n/sessions - list the conversations in this chat\n/persona [<id>|default] - choose who answers\n/pin <instruction> - pin an instruction to this chat; /pins lists them\n/memories - what was remembered here; /forget <id> forgets one\n/profile - what I know about you\n/schedule - what is scheduled here and when it runs next\n/jobs - how the scheduled jobs here last ran\n/language [code|default] - the language I answer commands in\n/whoami - who answers you and why\n/stop - stop the current answer": "Commandes :\n/new - commencer une nouvelle conversation\n/reset - effacer cette conversation\n/undo [turns] - annuler les derniers échanges\n/branch [turns] - reprendre à un point antérieur en gardant l'original\n/sessions - lister les conversations de ce chat\n/persona [<id>|default] - choisir qui répond\n/pin <instruction> - épingler une consigne à ce chat ; /pins les liste\n/memories - ce qui a été retenu ici ; /forget <id> en oublie un\n/profile - ce que je sais de vous\n/schedule - ce qui est planifié ici et quand cela s'exécute\n/jobs - comment les tâches planifiées d'ici se sont déroulées\n/language [code|default] - la langue de mes réponses aux commandes\n/whoami - qui vous répond et pourquoi\n/stop - arrêter la réponse en cours",
+	"Admin: /status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd": "Administration : /status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd",
+	"Error processing message: %v":                                        "Erreur lors du traitement du message : %v",
+	"Usage: /show [model|channel|agents]":                                 "Utilisation : /show [model|channel|agents]",
+	"No default agent configured":                                         "Aucun agent par défaut n'est configuré",
+	"Current model: %s":                                                   "Modèle actuel : %s",
+	"Current channel: %s":                                                 "Canal actuel : %s",
+	"Registered agents: %s":                                               "Agents enregistrés : %s",
+	"Unknown show target: %s":                                             "Cible de /show inconnue : %s",
+	"Usage: /list [models|channels|agents]":                               "Utilisation : /list [models|channels|agents]",
+	"Available models: configured in config.json per agent":               "Modèles disponibles : configurés par agent dans config.json",
+	"Channel manager not initialized":                                     "Le gestionnaire de canaux n'est pas initialisé",
+	"No channels enabled":                                                 "Aucun canal activé",
+	"Enabled channels: %s":                                                "Canaux activés : %s",
+	"Unknown list target: %s":                                             "Cible de /list inconnue : %s",
+	"Usage: /switch [model|channel] to <name>":                            "Utilisation : /switch [model|channel] to <name>",
+	"Switched model from %s to %s":                                        "Modèle changé de %s à %s",
+	"Channel '%s' not found or not enabled":                               "Canal '%s' introuvable ou non activé",
+	"Switched target channel to %s":                                       "Canal cible changé pour %s",
+	"Unknown switch target: %s":                                           "Cible de /switch inconnue : %s",
+	"Usage: /broadcast <message>":                                         "Utilisation : /broadcast <message>",
+	"No broadcast targets configured":                                     "Aucune cible de diffusion n'est configurée",
+	"Usage: /forget <id>, with the ID from /memories":                     "Utilisation : /forget <id>, avec l'ID donné par /memories",
+	"There is no memory #%d from this chat.":                              "Il n'y a pas de souvenir n°%d venant de ce chat.",
+	"Failed to forget #%d: %v":                                            "Impossible d'oublier n°%d : %v",
+	"Forgot #%d: %s":                                                      "N°%d oublié : %s",
+	"Usage: /memories [all | pending | approve [n] | reject [n]]":         "Utilisation : /memories [all | pending | approve [n] | reject [n]]",
+	"Nothing remembered yet.":                                             "Rien n'a encore été retenu.",
+	"Nothing remembered from this chat yet.":                              "Rien n'a encore été retenu de ce chat.",
+	"Remembered from this chat (forget one with /forget <id>):":           "Retenu de ce chat (oubliez-en un avec /forget <id>) :",
+	"Everything remembered (forget one with /forget <id>):":               "Tout ce qui a été retenu (oubliez-en un avec /forget <id>) :",
+	"No memory changes are waiting for approval.":                         "Aucune modification de la mémoire n'attend d'approbation.",
+	"Memory changes waiting for approval (/memories approve|reject [n]):": "Modifications de la mémoire en attente (/memories approve|reject [n]) :",
+	"Usage: /memories %s [n], with the number from /memories pending":     "Utilisation : /memories %s [n], avec le numéro donné par /memories pending",
+	"Failed to update the pending changes: %v":                            "Impossible de mettre à jour les modifications en attente : %v",
+	"No such memory change is waiting for approval.":                      "Aucune modification de ce numéro n'attend d'approbation.",
+	"Rejected %d memory changes.":                                         "%d modifications de la mémoire rejetées.",
+	"Failed to apply a memory change: %v":                                 "Impossible d'appliquer une modification de la mémoire : %v",
+	"Applied %d memory changes.":                                          "%d modifications de la mémoire appliquées.",
+	"Your profile is empty. Tell me about yourself, or use /profile name|timezone|locale|pref|instruct.": "Votre profil est vide. Parlez-moi de vous, ou utilisez /profile name|timezone|locale|pref|instruct.",
+	"Usage: /profile %s <value>": "Utilisation : /profile %s <value>",
+	"Saved your name.":           "Votre nom est enregistré.",
+	"Saved your locale.":         "Votre langue et région sont enregistrées.",
+	"Usage: /profile timezone <IANA name, e.g. Europe/Berlin>": "Utilisation : /profile timezone <nom IANA, par ex. Europe/Paris>",
+	"Saved your time zone.":                  "Votre fuseau horaire est enregistré.",
+	"Usage: /profile pref <key> <value>":     "Utilisation : /profile pref <key> <value>",
+	"Saved your preference for %s.":          "Votre préférence pour %s est enregistrée.",
+	"Usage: /profile instruct <instruction>": "Utilisation : /profile instruct <instruction>",
+	"I'll follow that from now on.":          "Je m'y tiendrai désormais.",
+	"Usage: /profile forget <name|timezone|locale|preference key|instruction number>": "Utilisation : /profile forget <name|timezone|locale|clé de préférence|numéro de consigne>",
+	"Nothing called %q in your profile.":                                              "Rien ne s'appelle %q dans votre profil.",
+	"Forgot %s.":                                                                      "%s oublié.",
+	"Failed to delete your profile: %v":                                               "Impossible de supprimer votre profil : %v",
+	"Deleted your profile.":                                                           "Votre profil est supprimé.",
+	"Usage: /profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]": "Utilisation : /profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]",
+	"Started a new conversation. Earlier ones are listed by /sessions.":                                             "Nouvelle conversation commencée. /sessions liste les précédentes.",
+	"Conversation history cleared.": "Historique de la conversation effacé.",
+	"Usage: %s [turns]":             "Utilisation : %s [turns]",
+	"Branched this conversation; the original is kept and listed by /sessions.":                        "Conversation dupliquée ; l'original est conservé et listé par /sessions.",
+	"Branched this conversation as it was %d turns ago; the original is kept and listed by /sessions.": "Conversation dupliquée telle qu'elle était il y a %d échanges ; l'original est conservé et listé par /sessions.",
+	"There is nothing to undo in this conversation.":                                                   "Il n'y a rien à annuler dans cette conversation.",
+	"Undid the last %d turns.":                                                                     "Les %d derniers échanges sont annulés.",
+	"Undid the last turn.":                                                                         "Le dernier échange est annulé.",
+	" Forgot %d facts remembered in them.":                                                         " %d faits retenus pendant ces échanges sont oubliés.",
+	"No conversations in this chat yet.":                                                           "Pas encore de conversation dans ce chat.",
+	"Conversations in this chat:":                                                                  "Conversations de ce chat :",
+	"%s %d messages, last active %s ago%s":                                                         "%s %d messages, dernière activité il y a %s%s",
+	"Personas (switch with /persona <id>, back with /persona default):":                            "Personas (changer avec /persona <id>, revenir avec /persona default) :",
+	"Usage: /persona [<id>|default]":                                                               "Utilisation : /persona [<id>|default]",
+	"This conversation follows the routing rules again.":                                           "Cette conversation suit de nouveau les règles de routage.",
+	"This conversation is answered by %s again.":                                                   "%s répond de nouveau dans cette conversation.",
+	"Unknown persona: %s. Personas: %s":                                                            "Persona inconnue : %s. Personas : %s",
+	"This conversation is answered by %s until /new or /persona default.":                          "%s répond dans cette conversation jusqu'à /new ou /persona default.",
+	"Usage: /pin <instruction>, e.g. /pin always answer in German here":                            "Utilisation : /pin <instruction>, par ex. /pin réponds toujours en français ici",
+	"Failed to pin the instruction: %v":                                                            "Impossible d'épingler la consigne : %v",
+	"Pinned. I'll follow that in this chat; /pins lists what is pinned.":                           "Épinglé. Je m'y tiendrai dans ce chat ; /pins liste ce qui est épinglé.",
+	"Nothing is pinned in this chat. Pin an instruction with /pin <instruction>.":                  "Rien n'est épinglé dans ce chat. Épinglez une consigne avec /pin <instruction>.",
+	"Pinned in this chat (remove with /pins remove <n>|all):":                                      "Épinglé dans ce chat (retirer avec /pins remove <n>|all) :",
+	"Usage: /pins [remove <n>|all]":                                                                "Utilisation : /pins [remove <n>|all]",
+	"Failed to unpin: %v":                                                                          "Impossible de désépingler : %v",
+	"There is no pinned instruction %d.":                                                           "Il n'y a pas de consigne épinglée %d.",
+	"Removed %d pinned instructions.":                                                              "%d consignes épinglées retirées.",
+	"Removed: %s":                                                                                  "Retiré : %s",
+	"Current conversation: %d messages%s":                                                          "Conversation actuelle : %d messages%s",
+	"Usage: /session agent <id>":                                                                   "Utilisation : /session agent <id>",
+	"Unknown agent: %s. Registered agents: %s":                                                     "Agent inconnu : %s. Agents enregistrés : %s",
+	"This conversation now uses agent %s":                                                          "Cette conversation utilise désormais l'agent %s",
+	"Usage: /session model <name>":                                                                 "Utilisation : /session model <name>",
+	"This conversation now uses model %s":                                                          "Cette conversation utilise désormais le modèle %s",
+	"This conversation uses the default agent and model again":                                     "Cette conversation utilise de nouveau l'agent et le modèle par défaut",
+	"Usage: /session [agent <id>|model <name>|unpin]":                                              "Utilisation : /session [agent <id>|model <name>|unpin]",
+	"Context window exceeded. Compressing history and retrying...":                                 "Fenêtre de contexte dépassée. Compression de l'historique et nouvel essai...",
+	"Memory threshold reached. Optimizing conversation history...":                                 "Seuil de mémoire atteint. Optimisation de l'historique de la conversation...",
+	"You may not use %s here.":                                                                     "Vous ne pouvez pas utiliser %s ici.",
+	"Failed to run %s: %v":                                                                         "Impossible d'exécuter %s : %v",
+	"Commands of this assistant:":                                                                  "Commandes de cet assistant :",
+	"Scheduled jobs are only available in the gateway.":                                            "Les tâches planifiées ne sont disponibles que dans la passerelle.",
+	"Usage: /schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]": "Utilisation : /schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]",
+	"Could not read %q: %v":                                                                        "Impossible de lire %q : %v",
+	"Read as: %s":                                                                                  "Compris comme : %s",
+	"There is no job %s in this chat.":                                                             "Il n'y a pas de tâche %s dans cette discussion.",
+	"Failed to change the schedule: %v":                                                            "Impossible de modifier la planification : %v",
+	"%s now runs %s.":                                                                              "%s s'exécute désormais %s.",
+	"Paused %s.":                                                                                   "%s mis en pause.",
+	"Resumed %s.":                                                                                  "%s repris.",
+	"Removed %s.":                                                                                  "%s supprimé.",
+	"paused":                                                                                       "en pause",
+	"next %s":                                                                                      "prochaine exécution %s",
+	"Nothing is scheduled in this chat. Ask me to remind you of something, or try /schedule preview every weekday at 8.": "Rien n'est planifié dans cette discussion. Demandez-moi de vous rappeler quelque chose, ou essayez /schedule preview every weekday at 8.",
+	"Scheduled here:":        "Planifié ici :",
+	"It will not run again.": "Cela ne s'exécutera plus.",
+	"Next runs:":             "Prochaines exécutions :",
+	"Usage: /jobs [<id>]":    "Utilisation : /jobs [<id>]",
+	"not run yet":            "pas encore exécutée",
+	"(%d failures in a row)": "(%d échecs d'affilée)",
+	"Scheduled jobs:":        "Tâches planifiées :",
+	"%s has not run yet.":    "%s ne s'est pas encore exécutée.",
+	"Latest runs of %s:":     "Dernières exécutions de %s :",
+	"late":                   "en retard",
+	"Workflows are only available in the gateway.":                                             "Les workflows ne sont disponibles que dans la passerelle.",
+	"Usage: /workflow [list|run <name> [input]|trace <name>]":                                  "Utilisation : /workflow [list|run <name> [input]|trace <name>]",
+	"There is no workflow %s.":                                                                 "Il n'y a pas de workflow %s.",
+	"✅ Workflow %s finished in %s.":                                                            "✅ Le workflow %s s'est terminé en %s.",
+	"❌ Workflow %s failed: %s\nSee /workflow trace %s":                                         "❌ Le workflow %s a échoué : %s\nVoir /workflow trace %s",
+	"Running workflow %s, I'll tell you how it went.":                                          "Le workflow %s est lancé, je vous dirai comment il s'est passé.",
+	"There are no workflows. Add them as YAML files to the workflows folder of the workspace.": "Il n'y a aucun workflow. Ajoutez-les en fichiers YAML dans le dossier workflows de l'espace de travail.",
+	"Workflows:":                   "Workflows :",
+	"Not loaded: %s":               "Non chargés : %s",
+	"Last run of %s:":              "Dernière exécution de %s :",
+	"%d attempts":                  "%d tentatives",
+	"Messages to send later:":      "Messages à envoyer plus tard :",
+	"Cancelled the message to %s.": "Le message pour %s est annulé.",
+	"⏱️ I stopped working on this: %s took longer than %s.":           "⏱️ J'ai arrêté : %s a pris plus de %s.",
+	"⏱️ I stopped working on this after %s, while in %s.":             "⏱️ J'ai arrêté après %s, pendant %s.",
+	"Do-not-disturb is not set up. Enable gateway.dnd in the config.": "Le mode « ne pas déranger » n'est pas configuré. Activez gateway.dnd dans la configuration.",
+	"Usage: /dnd on [2h|tomorrow at 9]":                               "Utilisation : /dnd on [2h|tomorrow at 9]",
+	"Could not turn do-not-disturb on: %v":                            "Impossible d'activer « ne pas déranger » : %v",
+	"Do not disturb until %s. Urgent alerts still come through.":      "Ne pas déranger jusqu'à %s. Les alertes urgentes passent toujours.",
+	"Could not turn do-not-disturb off: %v":                           "Impossible de désactiver « ne pas déranger » : %v",
+	"Do-not-disturb is off, but you are busy with %s until %s.":       "« Ne pas déranger » est désactivé, mais vous êtes occupé par %s jusqu'à %s.",
+	"Do-not-disturb is off.":                                          "« Ne pas déranger » est désactivé.",
+	"Usage: /dnd [on [2h|tomorrow at 9]|off]":                         "Utilisation : /dnd [on [2h|tomorrow at 9]|off]",
+	"Do not disturb: %s, until %s.":                                   "Ne pas déranger : %s, jusqu'à %s.",
+	"You can be disturbed now.":                                       "Vous pouvez être dérangé maintenant.",
+	"Busy today:":                                                     "Occupé aujourd'hui :",
+	"⚠️ The calendar could not be read: %v":                           "⚠️ Le calendrier n'a pas pu être lu : %v",
+	"The calendar has not been read yet.":                             "Le calendrier n'a pas encore été lu.",
+	"Calendar read %s.":                                               "Calendrier lu %s.",
+	"⏳ You're #%d in the queue, I'll answer as soon as I can.":        "⏳ Vous êtes n° %d dans la file d'attente, je réponds dès que possible.",
+}
@@ -0,0 +1,50 @@
+// Package i18n translates the messages picoclaw itself sends to chats,
+// such as command replies, usage lines and errors, into the language of
+// the person or chat they go to. The agent's own answers are not
+// translated here; the model writes those in whatever language it is
+// spoken to.
+//
+// Messages are looked up by their English text, the way gettext does, so
+// the code reads as before and a message without a translation is sent
+// in English.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Languages are the languages messages are translated into, English
+// being the one they are written in.
+var Languages = []string{"en", "de", "fr", "zh"}
+
+var catalogs = map[string]map[string]string{
+	"de": german,
+	"fr": french,
+	"zh": chinese,
+}
+
+// Lang returns the language of a locale such as "de-DE", "zh_CN" or
+// "fr", or "" when its messages are not translated.
+func Lang(locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(locale)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	for _, l := range Languages {
+		if l == lang {
+			return l
+		}
+	}
+	return ""
+}
+
+// T returns msg in lang, formatted with args as fmt.Sprintf would. An
+// unknown language or a message without a translation is English.
+func T(lang, msg string, args ...any) string {
+	if translated, ok := catalogs[lang][msg]; ok {
+		msg = translated
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
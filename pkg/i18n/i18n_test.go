@@ -0,0 +1,43 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestLang(t *testing.T) {
+	for locale, want := range map[string]string{
+		"de": "de", "de-DE": "de", "zh_CN": "zh", " FR ": "fr", "en-GB": "en", "es": "", "": "",
+	} {
+		if got := Lang(locale); got != want {
+			t.Errorf("Lang(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("de", "Forgot #%d: %s", 3, "tea"); got != "#3 vergessen: tea" {
+		t.Errorf("T(de) = %q", got)
+	}
+	if got := T("es", "Forgot #%d: %s", 3, "tea"); got != "Forgot #3: tea" {
+		t.Errorf("T(es) = %q", got)
+	}
+	if got := T("fr", "Not translated %d%%"); got != "Not translated %d%%" {
+		t.Errorf("T without args = %q", got)
+	}
+}
+
+var verb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// A translation takes the arguments its English message takes, in the
+// same order.
+func TestCatalogVerbs(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for msg, translated := range catalog {
+			if want, got := verb.FindAllString(msg, -1), verb.FindAllString(translated, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %q has verbs %v, %q has %v", lang, msg, want, translated, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package i18n
+
+// chinese translates the messages into Chinese.
+var chinese = map[string]string{
+	"Nothing is waiting for approval.":       "没有等待审批的内容。",
+	"Nothing to stop.":                       "没有可停止的内容。",
+	"Stopped.":                               "已停止。",
+	"%s is only available in the admin chat": "%s 只能在管理员聊天中使用",
+	"Usage: /language [%s|default]":          "用法：/language [%s|default]",
+	"Commands are answered in English.":      "命令将以中文回复。",
+	"Profiles need to know who is writing, which this channel does not say.": "个人资料需要知道发送者是谁，但此频道不提供该信息。",
+	"Failed to save your profile: %v":                                        "无法保存你的个人资料：%v",
+	"Commands:\n/new - start a new conversation\n/reset - clear this conversation\n/undo [turns] - take back the last turns\n/branch [turns] - continue from an earlier point, keeping the original\n/sessions - list the conversations in this chat\n/persona [<id>|default] - choose who answers\n/pin <instruction> - pin an instruction to this chat; /pins lists them\n/memories - what was remembered here; /forget <id> forgets one\n/profile - what I know about you\n/schedule - what is scheduled here and when it runs next\n/jobs - how the scheduled jobs here last ran\n/language [code|default] - the language I answer commands in\n/whoami - who answers you and why\n/stop - stop the current answer": "命令：\n/new - 开始新对话\n/reset - 清空当前对话\n/undo [turns] - 撤回最近几轮对话\n/branch [turns] - 从较早的位置继续，保留原对话\n/sessions - 列出此聊天中的对话\n/persona [<id>|default] - 选择由谁回答\n/pin <instruction> - 为此聊天固定一条指令；/pins 列出已固定的指令\n/memories - 在这里记住的内容；/forget <id> 忘记其中一条\n/profile - 我对你的了解\n/schedule - 此处的计划任务及其下次运行时间\n/jobs - 这里的计划任务最近的运行情况\n/language [code|default] - 我回复命令所用的语言\n/whoami - 谁在回答你以及原因\n/stop - 停止当前回答",
+	"Admin: /status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd": "管理员：/status, /usage, /model, /prompt, /tools, /flags, /reload, /approve, /loglevel, /logs, /broadcast, /erase, /workflow, /dnd",
+	"Error processing message: %v":                                        "处理消息时出错：%v",
+	"Usage: /show [model|channel|agents]":                                 "用法：/show [model|channel|agents]",
+	"No default agent configured":                                         "未配置默认智能体",
+	"Current model: %s":                                                   "当前模型：%s",
+	"Current channel: %s":                                                 "当前频道：%s",
+	"Registered agents: %s":                                               "已注册的智能体：%s",
+	"Unknown show target: %s":                                             "未知的 /show 目标：%s",
+	"Usage: /list [models|channels|agents]":                               "用法：/list [models|channels|agents]",
+	"Available models: configured in config.json per agent":               "可用模型：在 config.json 中按智能体配置",
+	"Channel manager not initialized":                                     "频道管理器未初始化",
+	"No channels enabled":                                                 "没有启用的频道",
+	"Enabled channels: %s":                                                "已启用的频道：%s",
+	"Unknown list target: %s":                                             "未知的 /list 目标：%s",
+	"Usage: /switch [model|channel] to <name>":                            "用法：/switch [model|channel] to <name>",
+	"Switched model from %s to %s":                                        "模型已从 %s 切换为 %s",
+	"Channel '%s' not found or not enabled":                               "频道 '%s' 不存在或未启用",
+	"Switched target channel to %s":                                       "目标频道已切换为 %s",
+	"Unknown switch target: %s":                                           "未知的 /switch 目标：%s",
+	"Usage: /broadcast <message>":                                         "用法：/broadcast <message>",
+	"No broadcast targets configured":                                     "未配置广播目标",
+	"Usage: /forget <id>, with the ID from /memories":                     "用法：/forget <id>，ID 来自 /memories",
+	"There is no memory #%d from this chat.":                              "此聊天中没有第 %d 号记忆。",
+	"Failed to forget #%d: %v":                                            "无法忘记第 %d 号：%v",
+	"Forgot #%d: %s":                                                      "已忘记第 %d 号：%s",
+	"Usage: /memories [all | pending | approve [n] | reject [n]]":         "用法：/memories [all | pending | approve [n] | reject [n]]",
+	"Nothing remembered yet.":                                             "还没有记住任何内容。",
+	"Nothing remembered from this chat yet.":                              "还没有从此聊天中记住任何内容。",
+	"Remembered from this chat (forget one with /forget <id>):":           "从此聊天中记住的内容（用 /forget <id> 忘记其中一条）：",
+	"Everything remembered (forget one with /forget <id>):":               "记住的全部内容（用 /forget <id> 忘记其中一条）：",
+	"No memory changes are waiting for approval.":                         "没有等待审批的记忆更改。",
+	"Memory changes waiting for approval (/memories approve|reject [n]):": "等待审批的记忆更改（/memories approve|reject [n]）：",
+	"Usage: /memories %s [n], with the number from /memories pending":     "用法：/memories %s [n]，编号来自 /memories pending",
+	"Failed to update the pending changes: %v":                            "无法更新待审批的更改：%v",
+	"No such memory change is waiting for approval.":                      "没有这样的记忆更改在等待审批。",
+	"Rejected %d memory changes.":                                         "已拒绝 %d 项记忆更改。",
+	"Failed to apply a memory change: %v":                                 "无法应用记忆更改：%v",
+	"Applied %d memory changes.":                                          "已应用 %d 项记忆更改。",
+	"Your profile is empty. Tell me about yourself, or use /profile name|timezone|locale|pref|instruct.": "你的个人资料是空的。告诉我一些关于你的事，或使用 /profile name|timezone|locale|pref|instruct。",
+	"Usage: /profile %s <value>": "用法：/profile %s <value>",
+	"Saved your name.":           "已保存你的名字。",
+	"Saved your locale.":         "已保存你的语言区域。",
+	"Usage: /profile timezone <IANA name, e.g. Europe/Berlin>": "用法：/profile timezone <IANA 名称，例如 Asia/Shanghai>",
+	"Saved your time zone.":                  "已保存你的时区。",
+	"Usage: /profile pref <key> <value>":     "用法：/profile pref <key> <value>",
+	"Saved your preference for %s.":          "已保存你对 %s 的偏好。",
+	"Usage: /profile instruct <instruction>": "用法：/profile instruct <instruction>",
+	"I'll follow that from now on.":          "从现在起我会照做。",
+	"Usage: /profile forget <name|timezone|locale|preference key|instruction number>": "用法：/profile forget <name|timezone|locale|偏好键|指令编号>",
+	"Nothing called %q in your profile.":                                              "你的个人资料中没有 %q。",
+	"Forgot %s.":                                                                      "已忘记 %s。",
+	"Failed to delete your profile: %v":                                               "无法删除你的个人资料：%v",
+	"Deleted your profile.":                                                           "已删除你的个人资料。",
+	"Usage: /profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]": "用法：/profile [name|timezone|locale <value> | pref <key> <value> | instruct <text> | forget <what> | clear]",
+	"Started a new conversation. Earlier ones are listed by /sessions.":                                             "已开始新对话。/sessions 会列出之前的对话。",
+	"Conversation history cleared.": "对话历史已清空。",
+	"Usage: %s [turns]":             "用法：%s [turns]",
+	"Branched this conversation; the original is kept and listed by /sessions.":                        "已从此对话分支；原对话会保留，并由 /sessions 列出。",
+	"Branched this conversation as it was %d turns ago; the original is kept and listed by /sessions.": "已从 %d 轮之前的对话分支；原对话会保留，并由 /sessions 列出。",
+	"There is nothing to undo in this conversation.":                                                   "此对话中没有可撤回的内容。",
+	"Undid the last %d turns.":                                                                     "已撤回最近 %d 轮。",
+	"Undid the last turn.":                                                                         "已撤回最近一轮。",
+	" Forgot %d facts remembered in them.":                                                         " 已忘记其中记住的 %d 条事实。",
+	"No conversations in this chat yet.":                                                           "此聊天中还没有对话。",
+	"Conversations in this chat:":                                                                  "此聊天中的对话：",
+	"%s %d messages, last active %s ago%s":                                                         "%s %d 条消息，最后活动于 %s 前%s",
+	"Personas (switch with /persona <id>, back with /persona default):":                            "角色（用 /persona <id> 切换，用 /persona default 恢复）：",
+	"Usage: /persona [<id>|default]":                                                               "用法：/persona [<id>|default]",
+	"This conversation follows the routing rules again.":                                           "此对话重新遵循路由规则。",
+	"This conversation is answered by %s again.":                                                   "此对话重新由 %s 回答。",
+	"Unknown persona: %s. Personas: %s":                                                            "未知角色：%s。可用角色：%s",
+	"This conversation is answered by %s until /new or /persona default.":                          "在 /new 或 /persona default 之前，此对话由 %s 回答。",
+	"Usage: /pin <instruction>, e.g. /pin always answer in German here":                            "用法：/pin <instruction>，例如 /pin 在这里始终用中文回答",
+	"Failed to pin the instruction: %v":                                                            "无法固定该指令：%v",
+	"Pinned. I'll follow that in this chat; /pins lists what is pinned.":                           "已固定。我会在此聊天中遵循；/pins 会列出已固定的内容。",
+	"Nothing is pinned in this chat. Pin an instruction with /pin <instruction>.":                  "此聊天中没有固定的内容。用 /pin <instruction> 固定一条指令。",
+	"Pinned in this chat (remove with /pins remove <n>|all):":                                      "此聊天中已固定（用 /pins remove <n>|all 移除）：",
+	"Usage: /pins [remove <n>|all]":                                                                "用法：/pins [remove <n>|all]",
+	"Failed to unpin: %v":                                                                          "无法取消固定：%v",
+	"There is no pinned instruction %d.":                                                           "没有第 %d 条固定指令。",
+	"Removed %d pinned instructions.":                                                              "已移除 %d 条固定指令。",
+	"Removed: %s":                                                                                  "已移除：%s",
+	"Current conversation: %d messages%s":                                                          "当前对话：%d 条消息%s",
+	"Usage: /session agent <id>":                                                                   "用法：/session agent <id>",
+	"Unknown agent: %s. Registered agents: %s":                                                     "未知智能体：%s。已注册的智能体：%s",
+	"This conversation now uses agent %s":                                                          "此对话现在使用智能体 %s",
+	"Usage: /session model <name>":                                                                 "用法：/session model <name>",
+	"This conversation now uses model %s":                                                          "此对话现在使用模型 %s",
+	"This conversation uses the default agent and model again":                                     "此对话重新使用默认智能体和模型",
+	"Usage: /session [agent <id>|model <name>|unpin]":                                              "用法：/session [agent <id>|model <name>|unpin]",
+	"Context window exceeded. Compressing history and retrying...":                                 "超出上下文窗口。正在压缩历史并重试……",
+	"Memory threshold reached. Optimizing conversation history...":                                 "已达到记忆阈值。正在优化对话历史……",
+	"You may not use %s here.":                                                                     "你不能在这里使用 %s。",
+	"Failed to run %s: %v":                                                                         "无法运行 %s：%v",
+	"Commands of this assistant:":                                                                  "此助手的命令：",
+	"Scheduled jobs are only available in the gateway.":                                            "定时任务仅在网关中可用。",
+	"Usage: /schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]": "用法：/schedule [preview <when> | set <id> <when> | pause <id> | resume <id> | remove <id>]",
+	"Could not read %q: %v":                                                                        "无法理解 %q：%v",
+	"Read as: %s":                                                                                  "理解为：%s",
+	"There is no job %s in this chat.":                                                             "此聊天中没有任务 %s。",
+	"Failed to change the schedule: %v":                                                            "修改计划失败：%v",
+	"%s now runs %s.":                                                                              "%s 现在的计划：%s。",
+	"Paused %s.":                                                                                   "已暂停 %s。",
+	"Resumed %s.":                                                                                  "已恢复 %s。",
+	"Removed %s.":                                                                                  "已删除 %s。",
+	"paused":                                                                                       "已暂停",
+	"next %s":                                                                                      "下次运行 %s",
+	"Nothing is scheduled in this chat. Ask me to remind you of something, or try /schedule preview every weekday at 8.": "此聊天中没有计划任务。可以让我提醒你某件事，或试试 /schedule preview every weekday at 8。",
+	"Scheduled here:":        "此处的计划：",
+	"It will not run again.": "它不会再运行。",
+	"Next runs:":             "接下来的运行：",
+	"Usage: /jobs [<id>]":    "用法：/jobs [<id>]",
+	"not run yet":            "尚未运行",
+	"(%d failures in a row)": "（连续失败 %d 次）",
+	"Scheduled jobs:":        "计划任务：",
+	"%s has not run yet.":    "%s 尚未运行。",
+	"Latest runs of %s:":     "%s 的最近运行：",
+	"late":                   "延迟",
+	"Workflows are only available in the gateway.":                                             "工作流仅在网关中可用。",
+	"Usage: /workflow [list|run <name> [input]|trace <name>]":                                  "用法：/workflow [list|run <name> [input]|trace <name>]",
+	"There is no workflow %s.":                                                                 "没有工作流 %s。",
+	"✅ Workflow %s finished in %s.":                                                            "✅ 工作流 %s 已完成，用时 %s。",
+	"❌ Workflow %s failed: %s\nSee /workflow trace %s":                                         "❌ 工作流 %s 失败：%s\n请查看 /workflow trace %s",
+	"Running workflow %s, I'll tell you how it went.":                                          "正在运行工作流 %s，完成后会告诉你结果。",
+	"There are no workflows. Add them as YAML files to the workflows folder of the workspace.": "还没有工作流。请将 YAML 文件添加到工作区的 workflows 文件夹中。",
+	"Workflows:":                   "工作流：",
+	"Not loaded: %s":               "未加载：%s",
+	"Last run of %s:":              "%s 的最近一次运行：",
+	"%d attempts":                  "%d 次尝试",
+	"Messages to send later:":      "稍后发送的消息：",
+	"Cancelled the message to %s.": "已取消发往 %s 的消息。",
+	"⏱️ I stopped working on this: %s took longer than %s.":           "⏱️ 已停止处理：%s 耗时超过 %s。",
+	"⏱️ I stopped working on this after %s, while in %s.":             "⏱️ 已在 %s 后停止处理，当时正在 %s。",
+	"Do-not-disturb is not set up. Enable gateway.dnd in the config.": "免打扰未设置。请在配置中启用 gateway.dnd。",
+	"Usage: /dnd on [2h|tomorrow at 9]":                               "用法：/dnd on [2h|tomorrow at 9]",
+	"Could not turn do-not-disturb on: %v":                            "无法开启免打扰：%v",
+	"Do not disturb until %s. Urgent alerts still come through.":      "免打扰至 %s。紧急警报仍会送达。",
+	"Could not turn do-not-disturb off: %v":                           "无法关闭免打扰：%v",
+	"Do-not-disturb is off, but you are busy with %s until %s.":       "免打扰已关闭，但你在 %s 中，直到 %s。",
+	"Do-not-disturb is off.":                                          "免打扰已关闭。",
+	"Usage: /dnd [on [2h|tomorrow at 9]|off]":                         "用法：/dnd [on [2h|tomorrow at 9]|off]",
+	"Do not disturb: %s, until %s.":                                   "免打扰：%s，直到 %s。",
+	"You can be disturbed now.":                                       "现在可以打扰你。",
+	"Busy today:":                                                     "今天忙碌：",
+	"⚠️ The calendar could not be read: %v":                           "⚠️ 无法读取日历：%v",
+	"The calendar has not been read yet.":                             "日历尚未读取。",
+	"Calendar read %s.":                                               "日历读取于 %s。",
+	"⏳ You're #%d in the queue, I'll answer as soon as I can.":        "⏳ 你在队列中排第 %d 位，我会尽快回复。",
+}
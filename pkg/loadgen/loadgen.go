@@ -0,0 +1,294 @@
+// Package loadgen replays recorded conversations against an agent loop
+// backed by a mock provider and measures how the gateway holds up: the
+// latency of each answer end to end, the allocations per answer and how
+// fast the workspace stores grow. cmd/loadgen runs it from the command
+// line; the benchmarks of this package run it under go test -bench.
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Conversation is a recorded exchange: the user messages to replay, each
+// with the reply the mock provider answers it with.
+type Conversation struct {
+	Name  string
+	Turns []Turn
+}
+
+type Turn struct {
+	User      string
+	Assistant string
+}
+
+// LoadConversations reads the conversations in path: a session file as
+// the file session store writes it, or a directory of them, such as
+// <workspace>/sessions. Tool calls and their results are left out, so
+// replaying runs no tools.
+func LoadConversations(path string) ([]Conversation, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(p, ".json") {
+				files = append(files, p)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var convs []Conversation
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var s struct {
+			Key      string              `json:"key"`
+			Messages []providers.Message `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s is not a session file: %w", file, err)
+		}
+		conv := Conversation{Name: s.Key}
+		for _, m := range s.Messages {
+			switch {
+			case m.Role == "user" && m.Content != "":
+				conv.Turns = append(conv.Turns, Turn{User: m.Content})
+			case m.Role == "assistant" && m.Content != "" && len(conv.Turns) > 0:
+				conv.Turns[len(conv.Turns)-1].Assistant = m.Content
+			}
+		}
+		if len(conv.Turns) > 0 {
+			convs = append(convs, conv)
+		}
+	}
+	if len(convs) == 0 {
+		return nil, fmt.Errorf("no conversations in %s", path)
+	}
+	return convs, nil
+}
+
+// SampleConversations are replayed when no recorded ones are given.
+func SampleConversations() []Conversation {
+	return []Conversation{
+		{Name: "weather", Turns: []Turn{
+			{"What's the weather like in Berlin today?", "I can't look outside, but Berlin in spring is usually mild, around 15°C."},
+			{"Should I take an umbrella?", "April showers are common there, so a small umbrella is a good idea."},
+			{"Thanks!", "You're welcome. Enjoy your day!"},
+		}},
+		{Name: "code", Turns: []Turn{
+			{"How do I reverse a slice in Go?", "Since Go 1.21 you can call slices.Reverse(s); it reverses s in place."},
+			{"And sort it descending?", "slices.SortFunc(s, func(a, b int) int { return cmp.Compare(b, a) })"},
+		}},
+		{Name: "reminder", Turns: []Turn{
+			{"Remind me what we talked about yesterday.", "Yesterday we planned the garden: tomatoes along the fence and herbs by the door."},
+			{"Add basil to the herbs.", "Noted: basil joins the herbs by the door."},
+			{"What's left to buy?", "Tomato plants, basil seeds and a bag of potting soil."},
+			{"Great, that's all.", "Happy gardening!"},
+		}},
+	}
+}
+
+// Provider is a mock LLM provider answering each replayed message with its
+// recorded reply after Latency.
+type Provider struct {
+	Latency time.Duration
+	replies map[string]string
+}
+
+func NewProvider(convs []Conversation, latency time.Duration) *Provider {
+	p := &Provider{Latency: latency, replies: make(map[string]string)}
+	for _, c := range convs {
+		for _, t := range c.Turns {
+			p.replies[t.User] = t.Assistant
+		}
+	}
+	return p
+}
+
+func (p *Provider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	if p.Latency > 0 {
+		select {
+		case <-time.After(p.Latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	reply := "OK."
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			if r := p.replies[messages[i].Content]; r != "" {
+				reply = r
+			}
+			break
+		}
+	}
+	return &providers.LLMResponse{
+		Content:      reply,
+		FinishReason: "stop",
+		Usage: &providers.UsageInfo{
+			PromptTokens:     len(messages) * 50,
+			CompletionTokens: len(reply) / 4,
+		},
+	}, nil
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return "loadgen-mock"
+}
+
+// Options set how hard Run pushes.
+type Options struct {
+	// Concurrency is how many chats are answered side by side.
+	Concurrency int
+	// Rounds is how often each chat replays all conversations.
+	Rounds int
+}
+
+// Result is what Run measured.
+type Result struct {
+	Messages    int           `json:"messages"`
+	Errors      int           `json:"errors"`
+	Concurrency int           `json:"concurrency"`
+	Elapsed     time.Duration `json:"elapsed"`
+	// Latencies of the answers, end to end.
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+	// Allocations of the whole process per answer.
+	AllocsPerMessage uint64 `json:"allocs_per_message"`
+	BytesPerMessage  uint64 `json:"bytes_per_message"`
+	// StoreBytes is how much the workspace grew: sessions, event logs
+	// and state.
+	StoreBytes int64 `json:"store_bytes"`
+}
+
+// PerSecond returns the answers per second.
+func (r Result) PerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Messages) / r.Elapsed.Seconds()
+}
+
+// StoreBytesPerSecond returns how fast the workspace grew.
+func (r Result) StoreBytesPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.StoreBytes) / r.Elapsed.Seconds()
+}
+
+// Write prints r for people.
+func (r Result) Write(w io.Writer) {
+	fmt.Fprintf(w, "Messages:     %d in %s (%.1f/s), %d errors, %d chats at a time\n",
+		r.Messages, r.Elapsed.Round(time.Millisecond), r.PerSecond(), r.Errors, r.Concurrency)
+	fmt.Fprintf(w, "Latency:      p50 %s, p95 %s, p99 %s, max %s\n", r.P50, r.P95, r.P99, r.Max)
+	fmt.Fprintf(w, "Allocations:  %d allocs, %d KB per message\n", r.AllocsPerMessage, r.BytesPerMessage>>10)
+	fmt.Fprintf(w, "Store writes: %d KB (%.1f KB/s)\n", r.StoreBytes>>10, r.StoreBytesPerSecond()/1024)
+}
+
+// Run replays convs on al, whose workspace is workspace, and measures it.
+// Each of opts.Concurrency chats replays every conversation in a session
+// of its own, starting at a different one, opts.Rounds times.
+func Run(ctx context.Context, al *agent.AgentLoop, workspace string, convs []Conversation, opts Options) Result {
+	concurrency, rounds := max(opts.Concurrency, 1), max(opts.Rounds, 1)
+	storeBefore := dirSize(workspace)
+	var memBefore, memAfter runtime.MemStats
+	runtime.ReadMemStats(&memBefore)
+	start := time.Now()
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		failed    int
+		wg        sync.WaitGroup
+	)
+	for chat := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := range rounds {
+				for i := range convs {
+					conv := convs[(chat+i)%len(convs)]
+					sessionKey := fmt.Sprintf("agent:main:loadgen:%d:%d:%d", chat, round, i)
+					for _, turn := range conv.Turns {
+						if ctx.Err() != nil {
+							return
+						}
+						sent := time.Now()
+						_, err := al.ProcessDirectWithChannel(ctx, turn.User, sessionKey, "loadgen", fmt.Sprint(chat))
+						took := time.Since(sent)
+						mu.Lock()
+						latencies = append(latencies, took)
+						if err != nil {
+							failed++
+						}
+						mu.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := Result{Messages: len(latencies), Errors: failed, Concurrency: concurrency, Elapsed: time.Since(start)}
+	runtime.ReadMemStats(&memAfter)
+	if r.Messages > 0 {
+		r.AllocsPerMessage = (memAfter.Mallocs - memBefore.Mallocs) / uint64(r.Messages)
+		r.BytesPerMessage = (memAfter.TotalAlloc - memBefore.TotalAlloc) / uint64(r.Messages)
+		slices.Sort(latencies)
+		r.P50, r.P95, r.P99 = percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99)
+		r.Max = latencies[len(latencies)-1]
+	}
+	r.StoreBytes = dirSize(workspace) - storeBefore
+	return r
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+// dirSize returns the bytes of the files under dir.
+func dirSize(dir string) int64 {
+	var n int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				n += info.Size()
+			}
+		}
+		return nil
+	})
+	return n
+}
@@ -0,0 +1,132 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+func newLoop(tb testing.TB, convs []Conversation, backend string) (*agent.AgentLoop, string) {
+	tb.Helper()
+	workspace := tb.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Agents.Defaults.Model = "loadgen-mock"
+	cfg.Session.Store.Backend = backend
+	al, err := agent.NewAgentLoop(cfg, bus.NewMessageBus(), NewProvider(convs, 0))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return al, workspace
+}
+
+func TestLoadConversations(t *testing.T) {
+	dir := t.TempDir()
+	session := `{"key": "telegram:42", "messages": [
+		{"role": "user", "content": "Hi"},
+		{"role": "assistant", "tool_calls": [{"id": "c1", "type": "function", "function": {"name": "exec"}}]},
+		{"role": "tool", "tool_call_id": "c1", "content": "done"},
+		{"role": "assistant", "content": "Hello!"},
+		{"role": "user", "content": "Bye"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "telegram_42.json"), []byte(session), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	convs, err := LoadConversations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Turn{{User: "Hi", Assistant: "Hello!"}, {User: "Bye"}}
+	if len(convs) != 1 || convs[0].Name != "telegram:42" || fmt.Sprint(convs[0].Turns) != fmt.Sprint(want) {
+		t.Errorf("conversations = %+v", convs)
+	}
+	if _, err := LoadConversations(t.TempDir()); err == nil {
+		t.Error("loaded conversations from an empty directory")
+	}
+}
+
+func TestRun(t *testing.T) {
+	convs := SampleConversations()
+	al, workspace := newLoop(t, convs, "file")
+	r := Run(context.Background(), al, workspace, convs, Options{Concurrency: 2, Rounds: 1})
+	turns := 0
+	for _, c := range convs {
+		turns += len(c.Turns)
+	}
+	if r.Messages != 2*turns || r.Errors != 0 {
+		t.Errorf("messages %d, errors %d, want %d and 0", r.Messages, r.Errors, 2*turns)
+	}
+	if r.P50 <= 0 || r.Max < r.P99 || r.P99 < r.P50 || r.StoreBytes <= 0 {
+		t.Errorf("result = %+v", r)
+	}
+	// Each chat replays each conversation in a session of its own.
+	sessions, _ := filepath.Glob(filepath.Join(workspace, "sessions", "*.json"))
+	if len(sessions) != 2*len(convs) {
+		t.Errorf("%d sessions, want %d", len(sessions), 2*len(convs))
+	}
+}
+
+// BenchmarkProcessMessage answers one message after the other, each in a
+// session with the history of the conversation so far.
+func BenchmarkProcessMessage(b *testing.B) {
+	for _, backend := range []string{"sqlite", "file"} {
+		b.Run(backend, func(b *testing.B) {
+			benchmarkReplay(b, backend, false)
+		})
+	}
+}
+
+// BenchmarkProcessMessageParallel answers messages of GOMAXPROCS chats
+// side by side.
+func BenchmarkProcessMessageParallel(b *testing.B) {
+	benchmarkReplay(b, "sqlite", true)
+}
+
+func benchmarkReplay(b *testing.B, backend string, parallel bool) {
+	logger.SetLevel(logger.WARN)
+	defer logger.SetLevel(logger.INFO)
+	convs := SampleConversations()
+	al, _ := newLoop(b, convs, backend)
+	ctx := context.Background()
+	// The turns of all conversations in order; each replay of them starts
+	// new sessions, so the histories stay as short as recorded.
+	type step struct {
+		conv string
+		turn Turn
+	}
+	var steps []step
+	for _, c := range convs {
+		for _, t := range c.Turns {
+			steps = append(steps, step{c.Name, t})
+		}
+	}
+	var chats atomic.Int64
+	replay := func(next func() bool) {
+		chat := chats.Add(1)
+		for i := 0; next(); i++ {
+			turn := steps[i%len(steps)].turn
+			sessionKey := fmt.Sprintf("agent:main:bench:%d:%d:%s", chat, i/len(steps), steps[i%len(steps)].conv)
+			if _, err := al.ProcessDirectWithChannel(ctx, turn.User, sessionKey, "loadgen", fmt.Sprint(chat)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	if parallel {
+		b.RunParallel(func(pb *testing.PB) { replay(pb.Next) })
+		return
+	}
+	n := 0
+	replay(func() bool { n++; return n <= b.N })
+}
@@ -1,11 +1,22 @@
+// Package logger writes the log of picoclaw through log/slog: to the
+// console as text lines or JSON, and optionally as JSON to a file. Each
+// component (the "channels" of InfoCF("channels", ...)) may log at its own
+// level, changed at runtime with SetComponentLevel. Fields put into a
+// context with WithFields, such as the task ID of a scheduled run or the
+// persona answering, are added to what the *Ctx functions log with it.
+// The latest entries can be kept in memory for /logs, see KeepRecent.
 package logger
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"maps"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +32,12 @@ const (
 	FATAL
 )
 
+// Log formats of the console.
+const (
+	FormatConsole = "console" // one line per entry, as log.Println writes it
+	FormatJSON    = "json"    // one JSON object per line, as the log file has them
+)
+
 var (
 	logLevelNames = map[LogLevel]string{
 		DEBUG: "DEBUG",
@@ -30,29 +47,65 @@ var (
 		FATAL: "FATAL",
 	}
 
-	currentLevel = INFO
-	logger       *Logger
-	once         sync.Once
-	mu           sync.RWMutex
+	mu              sync.RWMutex
+	currentLevel                 = INFO
+	componentLevels              = map[string]LogLevel{}
+	format                       = FormatConsole
+	console         slog.Handler = consoleHandler{}
+	file            *os.File
+	fileHandler     slog.Handler
 )
 
-type Logger struct {
-	file *os.File
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// slogLevel returns the slog level of l; FATAL is above slog.LevelError.
+func (l LogLevel) slogLevel() slog.Level {
+	switch l {
+	case DEBUG:
+		return slog.LevelDebug
+	case INFO:
+		return slog.LevelInfo
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
 }
 
-type LogEntry struct {
-	Level     string         `json:"level"`
-	Timestamp string         `json:"timestamp"`
-	Component string         `json:"component,omitempty"`
-	Message   string         `json:"message"`
-	Fields    map[string]any `json:"fields,omitempty"`
-	Caller    string         `json:"caller,omitempty"`
+// levelOf is the inverse of slogLevel.
+func levelOf(l slog.Level) LogLevel {
+	switch {
+	case l < slog.LevelInfo:
+		return DEBUG
+	case l < slog.LevelWarn:
+		return INFO
+	case l < slog.LevelError:
+		return WARN
+	case l < slog.LevelError+4:
+		return ERROR
+	default:
+		return FATAL
+	}
 }
 
-func init() {
-	once.Do(func() {
-		logger = &Logger{}
-	})
+// ParseLevel reads a level name such as "debug" or "WARN".
+func ParseLevel(name string) (LogLevel, error) {
+	for level, n := range logLevelNames {
+		if strings.EqualFold(name, n) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return WARN, nil
+	}
+	return INFO, fmt.Errorf("unknown log level %q, want debug, info, warn, error or fatal", name)
 }
 
 func SetLevel(level LogLevel) {
@@ -67,20 +120,79 @@ func GetLevel() LogLevel {
 	return currentLevel
 }
 
+// SetComponentLevel makes component log at level, whatever the level set
+// with SetLevel.
+func SetComponentLevel(component string, level LogLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	componentLevels[component] = level
+}
+
+// ResetComponentLevel makes component log at the level set with SetLevel
+// again.
+func ResetComponentLevel(component string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(componentLevels, component)
+}
+
+// SetComponentLevels replaces the levels of all components.
+func SetComponentLevels(levels map[string]LogLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	componentLevels = maps.Clone(levels)
+	if componentLevels == nil {
+		componentLevels = map[string]LogLevel{}
+	}
+}
+
+// ComponentLevels returns the components that log at their own level.
+func ComponentLevels() map[string]LogLevel {
+	mu.RLock()
+	defer mu.RUnlock()
+	return maps.Clone(componentLevels)
+}
+
+// SetFormat sets how entries are written to the console, FormatConsole
+// or FormatJSON.
+func SetFormat(f string) error {
+	var h slog.Handler
+	switch f {
+	case FormatConsole, "":
+		f, h = FormatConsole, consoleHandler{}
+	case FormatJSON:
+		h = newJSONHandler(logWriter{})
+	default:
+		return fmt.Errorf("unknown log format %q, want %s or %s", f, FormatConsole, FormatJSON)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	format, console = f, h
+	return nil
+}
+
+// Format returns the format of the console.
+func Format() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return format
+}
+
 func EnableFileLogging(filePath string) error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
-	if logger.file != nil {
-		logger.file.Close()
+	if file != nil {
+		file.Close()
 	}
 
-	logger.file = file
+	file = f
+	fileHandler = newJSONHandler(f)
 	log.Println("File logging enabled:", filePath)
 	return nil
 }
@@ -89,153 +201,266 @@ func DisableFileLogging() {
 	mu.Lock()
 	defer mu.Unlock()
 
-	if logger.file != nil {
-		logger.file.Close()
-		logger.file = nil
+	if file != nil {
+		file.Close()
+		file, fileHandler = nil, nil
 		log.Println("File logging disabled")
 	}
 }
 
-func logMessage(level LogLevel, component string, message string, fields map[string]any) {
-	if level < currentLevel {
-		return
+// Enabled reports whether component logs at level.
+func Enabled(component string, level LogLevel) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	min, ok := componentLevels[component]
+	if !ok {
+		min = currentLevel
 	}
+	return level >= min
+}
 
-	entry := LogEntry{
-		Level:     logLevelNames[level],
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Component: component,
-		Message:   message,
-		Fields:    fields,
-	}
+type fieldsKey struct{}
 
-	if pc, file, line, ok := runtime.Caller(2); ok {
-		fn := runtime.FuncForPC(pc)
-		if fn != nil {
-			entry.Caller = fmt.Sprintf("%s:%d (%s)", file, line, fn.Name())
-		}
+// WithFields returns ctx carrying fields, which the *Ctx functions log
+// with every entry logged with it.
+func WithFields(ctx context.Context, fields map[string]any) context.Context {
+	merged := maps.Clone(FieldsFrom(ctx))
+	if merged == nil {
+		merged = make(map[string]any, len(fields))
 	}
+	maps.Copy(merged, fields)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
 
-	if logger.file != nil {
-		jsonData, err := json.Marshal(entry)
-		if err == nil {
-			logger.file.Write(append(jsonData, '\n'))
-		}
-	}
+// WithField is WithFields for one field.
+func WithField(ctx context.Context, key string, value any) context.Context {
+	return WithFields(ctx, map[string]any{key: value})
+}
+
+// FieldsFrom returns the fields ctx carries, or nil.
+func FieldsFrom(ctx context.Context) map[string]any {
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]any)
+	return fields
+}
 
-	var fieldStr string
-	if len(fields) > 0 {
-		fieldStr = " " + formatFields(fields)
-	} else {
-		fieldStr = ""
+func logMessage(ctx context.Context, level LogLevel, component string, message string, fields map[string]any) {
+	if !Enabled(component, level) {
+		return
 	}
 
-	logLine := fmt.Sprintf("[%s] [%s]%s %s%s",
-		entry.Timestamp,
-		logLevelNames[level],
-		formatComponent(component),
-		message,
-		fieldStr,
-	)
+	// Skip runtime.Callers, logMessage and the exported function.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level.slogLevel(), message, pcs[0])
+	if component != "" {
+		r.AddAttrs(slog.String("component", component))
+	}
+	if attrs := fieldAttrs(FieldsFrom(ctx), fields); len(attrs) > 0 {
+		r.AddAttrs(slog.Attr{Key: "fields", Value: slog.GroupValue(attrs...)})
+	}
 
-	log.Println(logLine)
+	mu.RLock()
+	handlers := []slog.Handler{console, fileHandler, recent}
+	mu.RUnlock()
+	for _, h := range handlers {
+		if h != nil {
+			h.Handle(ctx, r.Clone())
+		}
+	}
 
 	if level == FATAL {
 		os.Exit(1)
 	}
 }
 
-func formatComponent(component string) string {
-	if component == "" {
-		return ""
+// fieldAttrs returns the fields of the context and of the call, sorted by
+// key; those of the call win.
+func fieldAttrs(fromCtx, fields map[string]any) []slog.Attr {
+	if len(fromCtx) == 0 && len(fields) == 0 {
+		return nil
+	}
+	all := maps.Clone(fromCtx)
+	if all == nil {
+		all = make(map[string]any, len(fields))
 	}
-	return fmt.Sprintf(" %s:", component)
+	maps.Copy(all, fields)
+	attrs := make([]slog.Attr, 0, len(all))
+	for _, k := range slices.Sorted(maps.Keys(all)) {
+		attrs = append(attrs, slog.Any(k, all[k]))
+	}
+	return attrs
+}
+
+// newJSONHandler writes entries as the log file always had them:
+// {"timestamp", "level", "caller", "message", "component", "fields"}.
+func newJSONHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.String("timestamp", a.Value.Time().UTC().Format(time.RFC3339))
+			case slog.LevelKey:
+				return slog.String(slog.LevelKey, levelOf(a.Value.Any().(slog.Level)).String())
+			case slog.MessageKey:
+				return slog.String("message", a.Value.String())
+			case slog.SourceKey:
+				src, ok := a.Value.Any().(*slog.Source)
+				if !ok || src.File == "" {
+					return slog.Attr{}
+				}
+				return slog.String("caller", fmt.Sprintf("%s:%d (%s)", src.File, src.Line, src.Function))
+			}
+			return a
+		},
+	})
+}
+
+// logWriter writes to where the standard logger writes, without its
+// prefix.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	return log.Writer().Write(p)
 }
 
-func formatFields(fields map[string]any) string {
+// consoleHandler writes an entry as a line through the standard logger:
+//
+//	[2026-01-02T15:04:05Z] [INFO] channels: Connected {account=work, chat_id=42}
+type consoleHandler struct{}
+
+func (consoleHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h consoleHandler) WithAttrs([]slog.Attr) slog.Handler     { return h }
+func (h consoleHandler) WithGroup(string) slog.Handler          { return h }
+
+func (consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var component string
 	var parts []string
-	for k, v := range fields {
-		parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+	r.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "component":
+			component = a.Value.String()
+		case "fields":
+			for _, f := range a.Value.Group() {
+				parts = append(parts, fmt.Sprintf("%s=%v", f.Key, f.Value.Any()))
+			}
+		}
+		return true
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] [%s]", r.Time.UTC().Format(time.RFC3339), levelOf(r.Level))
+	if component != "" {
+		fmt.Fprintf(&b, " %s:", component)
 	}
-	return fmt.Sprintf("{%s}", strings.Join(parts, ", "))
+	b.WriteString(" " + r.Message)
+	if len(parts) > 0 {
+		b.WriteString(" {" + strings.Join(parts, ", ") + "}")
+	}
+	log.Println(b.String())
+	return nil
 }
 
 func Debug(message string) {
-	logMessage(DEBUG, "", message, nil)
+	logMessage(context.Background(), DEBUG, "", message, nil)
 }
 
 func DebugC(component string, message string) {
-	logMessage(DEBUG, component, message, nil)
+	logMessage(context.Background(), DEBUG, component, message, nil)
 }
 
 func DebugF(message string, fields map[string]any) {
-	logMessage(DEBUG, "", message, fields)
+	logMessage(context.Background(), DEBUG, "", message, fields)
 }
 
 func DebugCF(component string, message string, fields map[string]any) {
-	logMessage(DEBUG, component, message, fields)
+	logMessage(context.Background(), DEBUG, component, message, fields)
+}
+
+// DebugCtx is DebugCF with the fields ctx carries.
+func DebugCtx(ctx context.Context, component string, message string, fields map[string]any) {
+	logMessage(ctx, DEBUG, component, message, fields)
 }
 
 func Info(message string) {
-	logMessage(INFO, "", message, nil)
+	logMessage(context.Background(), INFO, "", message, nil)
 }
 
 func InfoC(component string, message string) {
-	logMessage(INFO, component, message, nil)
+	logMessage(context.Background(), INFO, component, message, nil)
 }
 
 func InfoF(message string, fields map[string]any) {
-	logMessage(INFO, "", message, fields)
+	logMessage(context.Background(), INFO, "", message, fields)
 }
 
 func InfoCF(component string, message string, fields map[string]any) {
-	logMessage(INFO, component, message, fields)
+	logMessage(context.Background(), INFO, component, message, fields)
+}
+
+// InfoCtx is InfoCF with the fields ctx carries.
+func InfoCtx(ctx context.Context, component string, message string, fields map[string]any) {
+	logMessage(ctx, INFO, component, message, fields)
 }
 
 func Warn(message string) {
-	logMessage(WARN, "", message, nil)
+	logMessage(context.Background(), WARN, "", message, nil)
 }
 
 func WarnC(component string, message string) {
-	logMessage(WARN, component, message, nil)
+	logMessage(context.Background(), WARN, component, message, nil)
 }
 
 func WarnF(message string, fields map[string]any) {
-	logMessage(WARN, "", message, fields)
+	logMessage(context.Background(), WARN, "", message, fields)
 }
 
 func WarnCF(component string, message string, fields map[string]any) {
-	logMessage(WARN, component, message, fields)
+	logMessage(context.Background(), WARN, component, message, fields)
+}
+
+// WarnCtx is WarnCF with the fields ctx carries.
+func WarnCtx(ctx context.Context, component string, message string, fields map[string]any) {
+	logMessage(ctx, WARN, component, message, fields)
 }
 
 func Error(message string) {
-	logMessage(ERROR, "", message, nil)
+	logMessage(context.Background(), ERROR, "", message, nil)
 }
 
 func ErrorC(component string, message string) {
-	logMessage(ERROR, component, message, nil)
+	logMessage(context.Background(), ERROR, component, message, nil)
 }
 
 func ErrorF(message string, fields map[string]any) {
-	logMessage(ERROR, "", message, fields)
+	logMessage(context.Background(), ERROR, "", message, fields)
 }
 
 func ErrorCF(component string, message string, fields map[string]any) {
-	logMessage(ERROR, component, message, fields)
+	logMessage(context.Background(), ERROR, component, message, fields)
+}
+
+// ErrorCtx is ErrorCF with the fields ctx carries.
+func ErrorCtx(ctx context.Context, component string, message string, fields map[string]any) {
+	logMessage(ctx, ERROR, component, message, fields)
 }
 
 func Fatal(message string) {
-	logMessage(FATAL, "", message, nil)
+	logMessage(context.Background(), FATAL, "", message, nil)
 }
 
 func FatalC(component string, message string) {
-	logMessage(FATAL, component, message, nil)
+	logMessage(context.Background(), FATAL, component, message, nil)
 }
 
 func FatalF(message string, fields map[string]any) {
-	logMessage(FATAL, "", message, fields)
+	logMessage(context.Background(), FATAL, "", message, fields)
 }
 
 func FatalCF(component string, message string, fields map[string]any) {
-	logMessage(FATAL, component, message, fields)
+	logMessage(context.Background(), FATAL, component, message, fields)
 }
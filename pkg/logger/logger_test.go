@@ -1,7 +1,14 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLogLevelFiltering(t *testing.T) {
@@ -137,3 +144,96 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]any{"key": "value"})
 }
+
+func TestComponentLevels(t *testing.T) {
+	initialLevel := GetLevel()
+	defer SetLevel(initialLevel)
+	defer SetComponentLevels(nil)
+
+	SetLevel(WARN)
+	SetComponentLevel("channels", DEBUG)
+	SetComponentLevel("cron", ERROR)
+	if !Enabled("channels", DEBUG) || Enabled("cron", WARN) || !Enabled("agent", WARN) || Enabled("agent", INFO) {
+		t.Errorf("levels = %v, %v", GetLevel(), ComponentLevels())
+	}
+	ResetComponentLevel("cron")
+	if !Enabled("cron", WARN) {
+		t.Error("cron still at its own level")
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("parsed an unknown level")
+	}
+	if level, err := ParseLevel("warning"); err != nil || level != WARN {
+		t.Errorf("ParseLevel(warning) = %v, %v", level, err)
+	}
+}
+
+func TestJSONWithContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	defer SetFormat(FormatConsole)
+
+	ctx := WithFields(context.Background(), map[string]any{"task_id": "9c41e0a2", "persona": "coder"})
+	InfoCtx(ctx, "agent", "Tool call", map[string]any{"tool": "exec", "persona": "override"})
+
+	var entry struct {
+		Level, Timestamp, Component, Message, Caller string
+		Fields                                       map[string]any
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if entry.Level != "INFO" || entry.Component != "agent" || entry.Message != "Tool call" ||
+		!strings.Contains(entry.Caller, "logger_test.go") || entry.Timestamp == "" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Fields["task_id"] != "9c41e0a2" || entry.Fields["persona"] != "override" || entry.Fields["tool"] != "exec" {
+		t.Errorf("fields = %v", entry.Fields)
+	}
+
+	buf.Reset()
+	SetFormat(FormatConsole)
+	InfoCtx(ctx, "agent", "Tool call", map[string]any{"tool": "exec"})
+	if !strings.Contains(buf.String(), "[INFO] agent: Tool call {persona=coder, task_id=9c41e0a2, tool=exec}") {
+		t.Errorf("console line = %q", buf.String())
+	}
+}
+
+func TestRecent(t *testing.T) {
+	initialLevel := GetLevel()
+	defer SetLevel(initialLevel)
+	defer KeepRecent(0)
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+
+	SetLevel(DEBUG)
+	KeepRecent(3)
+	start := time.Now().Add(-time.Second)
+	DebugCF("cron", "Tick", nil)
+	InfoCF("channels", "Connected", map[string]any{"account": "work"})
+	WarnCF("channels", "Reconnecting", map[string]any{"error": "EOF"})
+	ErrorCF("agent", "LLM call failed", nil)
+
+	all := Recent(Query{})
+	if len(all) != 3 || all[0].Message != "Connected" || all[2].Message != "LLM call failed" {
+		t.Fatalf("kept %+v", all)
+	}
+	if got := Recent(Query{Level: WARN, Component: "channels"}); len(got) != 1 || got[0].Fields["error"] != "EOF" {
+		t.Errorf("warnings of channels = %+v", got)
+	}
+	if got := Recent(Query{Text: "account=WORK"}); len(got) != 1 || got[0].Message != "Connected" {
+		t.Errorf("text search = %+v", got)
+	}
+	if got := Recent(Query{Limit: 1, Since: start}); len(got) != 1 || got[0].Level != ERROR {
+		t.Errorf("latest = %+v", got)
+	}
+	if data, _ := json.Marshal(all[2]); !strings.Contains(string(data), `"level":"ERROR"`) {
+		t.Errorf("JSON = %s", data)
+	}
+}
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a log entry kept in memory, see KeepRecent.
+type Entry struct {
+	Time      time.Time      `json:"time"`
+	Level     LogLevel       `json:"level"`
+	Component string         `json:"component,omitempty"`
+	Message   string         `json:"message"`
+	Fields    map[string]any `json:"fields,omitempty"`
+}
+
+// MarshalText writes the level by its name, e.g. "WARN".
+func (l LogLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// Query selects kept entries: those at Level or above, of Component when
+// set, logged after Since and containing Text in the message or a field.
+// Limit keeps the newest that many, 0 all.
+type Query struct {
+	Level     LogLevel
+	Component string
+	Since     time.Time
+	Text      string
+	Limit     int
+}
+
+// ring keeps the latest entries logged, oldest first from next.
+type ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+var recent = &ring{}
+
+// KeepRecent keeps the last n entries logged in memory, for Recent. 0
+// keeps none. The entries kept so far are dropped.
+func KeepRecent(n int) {
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+	recent.entries, recent.next, recent.full = make([]Entry, max(n, 0)), 0, false
+}
+
+// KeptRecent returns how many entries KeepRecent keeps.
+func KeptRecent() int {
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+	return len(recent.entries)
+}
+
+// Recent returns the kept entries q selects, oldest first.
+func Recent(q Query) []Entry {
+	recent.mu.Lock()
+	var all []Entry
+	if recent.full {
+		all = append(all, recent.entries[recent.next:]...)
+	}
+	all = append(all, recent.entries[:recent.next]...)
+	recent.mu.Unlock()
+
+	var out []Entry
+	for _, e := range all {
+		if q.matches(e) {
+			out = append(out, e)
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out
+}
+
+func (q Query) matches(e Entry) bool {
+	if e.Level < q.Level || (q.Component != "" && e.Component != q.Component) || !e.Time.After(q.Since) {
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+	text := strings.ToLower(q.Text)
+	if strings.Contains(strings.ToLower(e.Message), text) {
+		return true
+	}
+	for k, v := range e.Fields {
+		if strings.Contains(strings.ToLower(k+"="+slog.AnyValue(v).String()), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ring) Enabled(context.Context, slog.Level) bool { return true }
+func (r *ring) WithAttrs([]slog.Attr) slog.Handler       { return r }
+func (r *ring) WithGroup(string) slog.Handler            { return r }
+
+func (r *ring) Handle(_ context.Context, rec slog.Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return nil
+	}
+	e := Entry{Time: rec.Time, Level: levelOf(rec.Level), Message: rec.Message}
+	rec.Attrs(func(a slog.Attr) bool {
+		switch a.Key {
+		case "component":
+			e.Component = a.Value.String()
+		case "fields":
+			e.Fields = make(map[string]any)
+			for _, f := range a.Value.Group() {
+				e.Fields[f.Key] = f.Value.Any()
+			}
+		}
+		return true
+	})
+	r.entries[r.next] = e
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+var downloadClient = &http.Client{Timeout: 5 * time.Minute}
+
+// TypeOf classifies a file as image, audio, video or generic file.
+func TypeOf(name, contentType string) string {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	}
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return bus.AttachmentImage
+	case strings.HasPrefix(contentType, "video/"):
+		return bus.AttachmentVideo
+	case utils.IsAudioFile(name, contentType):
+		return bus.AttachmentAudio
+	default:
+		return bus.AttachmentFile
+	}
+}
+
+// FromFile describes a file that is already on disk.
+func FromFile(path string) bus.Attachment {
+	name := filepath.Base(path)
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
+	return bus.Attachment{
+		Type:        TypeOf(name, contentType),
+		Name:        name,
+		ContentType: contentType,
+		Path:        path,
+	}
+}
+
+// FromURL describes a remote file fetched with a GET request. headers are
+// added to the request, e.g. for bot token authorization.
+func FromURL(url, name, contentType string, headers map[string]string) bus.Attachment {
+	return bus.Attachment{
+		Type:        TypeOf(name, contentType),
+		Name:        name,
+		ContentType: contentType,
+		Fetch:       HTTPFetch(url, headers),
+	}
+}
+
+// HTTPFetch returns a fetch function that downloads url.
+func HTTPFetch(url string, headers map[string]string) func(ctx context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := downloadClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("download returned status %d", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+}
+
+// Describe renders attachments as text for the model, which only sees the
+// message content. Each line names the file and where it can be read.
+func Describe(atts []bus.Attachment) string {
+	if len(atts) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("[Attachments]")
+	for _, a := range atts {
+		fmt.Fprintf(&sb, "\n- %s %q", a.Type, a.Name)
+		var details []string
+		if a.ContentType != "" {
+			details = append(details, a.ContentType)
+		}
+		if a.Size > 0 {
+			details = append(details, formatSize(a.Size))
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(&sb, " (%s)", strings.Join(details, ", "))
+		}
+		if a.Path != "" {
+			fmt.Fprintf(&sb, " at %s", a.Path)
+		}
+	}
+	return sb.String()
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
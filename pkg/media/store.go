@@ -0,0 +1,260 @@
+// Package media manages the files that travel with chat messages: it
+// downloads inbound attachments into a temp directory, enforces size limits,
+// lets hooks inspect or reject them, and removes them again once they are no
+// longer needed.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	DefaultMaxBytes  = 20 << 20
+	DefaultRetention = time.Hour
+
+	sweepInterval = time.Minute
+)
+
+// ErrTooLarge is returned when an attachment exceeds the store's size limit.
+var ErrTooLarge = errors.New("attachment too large")
+
+// Hook inspects an inbound attachment before the message reaches the agent.
+// It may modify the attachment; returning an error drops it.
+type Hook func(ctx context.Context, channel string, att *bus.Attachment) error
+
+// Store owns downloaded attachments. Files are kept for the retention period
+// so the agent and its tools can still open them a few turns later.
+type Store struct {
+	dir       string
+	maxBytes  int64
+	retention time.Duration
+
+	mu        sync.Mutex
+	hooks     []Hook
+	lastSweep time.Time
+}
+
+// NewStore creates a store. Zero values select the defaults; the default
+// directory is the one utils.DownloadFile uses, so older download paths are
+// cleaned up as well.
+func NewStore(dir string, maxBytes int64, retention time.Duration) *Store {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "picoclaw_media")
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Store{dir: dir, maxBytes: maxBytes, retention: retention}
+}
+
+var (
+	defaultStore     *Store
+	defaultStoreOnce sync.Once
+)
+
+// Default returns the store used by channels that were not given one.
+func Default() *Store {
+	defaultStoreOnce.Do(func() {
+		defaultStore = NewStore("", 0, 0)
+	})
+	return defaultStore
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// AddHook registers a hook that runs for every inbound attachment.
+func (s *Store) AddHook(hook Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// HookCount returns how many hooks are registered.
+func (s *Store) HookCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.hooks)
+}
+
+// Fetch downloads att into the store and sets its Path and Size. Attachments
+// that already have a Path are only checked against the size limit.
+func (s *Store) Fetch(ctx context.Context, att *bus.Attachment) error {
+	s.maybeSweep()
+
+	if att.Type == "" {
+		att.Type = TypeOf(att.Name, att.ContentType)
+	}
+	if att.Size > s.maxBytes {
+		return fmt.Errorf("%w: %s is %d bytes (max %d)", ErrTooLarge, att.Name, att.Size, s.maxBytes)
+	}
+
+	if att.Path != "" {
+		info, err := os.Stat(att.Path)
+		if err != nil {
+			return err
+		}
+		if info.Size() > s.maxBytes {
+			return fmt.Errorf("%w: %s is %d bytes (max %d)", ErrTooLarge, att.Name, info.Size(), s.maxBytes)
+		}
+		att.Size = info.Size()
+		return nil
+	}
+
+	if att.Fetch == nil {
+		return fmt.Errorf("attachment %s has neither path nor fetch function", att.Name)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("create media directory: %w", err)
+	}
+
+	r, err := att.Fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", att.Name, err)
+	}
+	defer r.Close()
+
+	name := att.Name
+	if name == "" {
+		name = att.Type + extensionFor(att.ContentType)
+	}
+	path := filepath.Join(s.dir, uuid.New().String()[:8]+"_"+utils.SanitizeFilename(name))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(f, io.LimitReader(r, s.maxBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && written > s.maxBytes {
+		err = fmt.Errorf("%w: %s exceeds %d bytes", ErrTooLarge, att.Name, s.maxBytes)
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	att.Path = path
+	att.Size = written
+	if att.Name == "" {
+		att.Name = name
+	}
+	logger.DebugCF("media", "Attachment stored", map[string]any{
+		"name": att.Name,
+		"size": written,
+		"path": path,
+	})
+	return nil
+}
+
+// Prepare makes inbound attachments ready for the agent: it fetches the
+// ones without a local file and runs the hooks. Attachments that fail either
+// step are logged and left out.
+func (s *Store) Prepare(ctx context.Context, channel string, atts []bus.Attachment) []bus.Attachment {
+	s.mu.Lock()
+	hooks := append([]Hook(nil), s.hooks...)
+	s.mu.Unlock()
+
+	ready := make([]bus.Attachment, 0, len(atts))
+	for i := range atts {
+		att := atts[i]
+		err := s.Fetch(ctx, &att)
+		for _, hook := range hooks {
+			if err != nil {
+				break
+			}
+			err = hook(ctx, channel, &att)
+		}
+		if err != nil {
+			logger.WarnCF("media", "Attachment dropped", map[string]any{
+				"channel": channel,
+				"name":    att.Name,
+				"error":   err.Error(),
+			})
+			s.Release(att)
+			continue
+		}
+		ready = append(ready, att)
+	}
+	return ready
+}
+
+// Release deletes the local copy of att if the store owns it.
+func (s *Store) Release(att bus.Attachment) {
+	if att.Path != "" && s.owns(att.Path) {
+		os.Remove(att.Path)
+	}
+}
+
+func (s *Store) owns(path string) bool {
+	rel, err := filepath.Rel(s.dir, path)
+	return err == nil && !strings.HasPrefix(rel, "..") && !filepath.IsAbs(rel)
+}
+
+// Sweep removes stored files older than the retention period.
+func (s *Store) Sweep() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, e.Name())); err == nil {
+			logger.DebugCF("media", "Expired attachment removed", map[string]any{"file": e.Name()})
+		}
+	}
+}
+
+func (s *Store) maybeSweep() {
+	s.mu.Lock()
+	due := time.Since(s.lastSweep) >= sweepInterval
+	if due {
+		s.lastSweep = time.Now()
+	}
+	s.mu.Unlock()
+	if due {
+		s.Sweep()
+	}
+}
+
+func extensionFor(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	exts, err := mime.ExtensionsByType(contentType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
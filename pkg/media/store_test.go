@@ -0,0 +1,171 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func readerAttachment(name, content string) bus.Attachment {
+	return bus.Attachment{
+		Name: name,
+		Fetch: func(ctx context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func TestStoreFetch(t *testing.T) {
+	s := NewStore(t.TempDir(), 1024, time.Hour)
+
+	att := readerAttachment("photo.png", "png bytes")
+	if err := s.Fetch(context.Background(), &att); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if att.Type != bus.AttachmentImage {
+		t.Errorf("Type = %q, want image", att.Type)
+	}
+	if att.Size != int64(len("png bytes")) {
+		t.Errorf("Size = %d", att.Size)
+	}
+	if filepath.Dir(att.Path) != s.Dir() {
+		t.Errorf("Path %q is not in the store directory", att.Path)
+	}
+	data, err := os.ReadFile(att.Path)
+	if err != nil || string(data) != "png bytes" {
+		t.Errorf("stored content = %q, %v", data, err)
+	}
+}
+
+func TestStoreFetchTooLarge(t *testing.T) {
+	s := NewStore(t.TempDir(), 4, time.Hour)
+
+	att := readerAttachment("big.txt", "more than four bytes")
+	if err := s.Fetch(context.Background(), &att); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Fetch error = %v, want ErrTooLarge", err)
+	}
+	entries, _ := os.ReadDir(s.Dir())
+	if len(entries) != 0 {
+		t.Errorf("partial download left behind: %v", entries)
+	}
+
+	// A known size is rejected without downloading.
+	called := false
+	att = bus.Attachment{Name: "huge.bin", Size: 100, Fetch: func(ctx context.Context) (io.ReadCloser, error) {
+		called = true
+		return nil, errors.New("unexpected")
+	}}
+	if err := s.Fetch(context.Background(), &att); !errors.Is(err, ErrTooLarge) || called {
+		t.Errorf("Fetch error = %v, fetched = %v", err, called)
+	}
+}
+
+func TestStorePrepareHooks(t *testing.T) {
+	s := NewStore(t.TempDir(), 1024, time.Hour)
+	var seen []string
+	s.AddHook(func(ctx context.Context, channel string, att *bus.Attachment) error {
+		seen = append(seen, channel+":"+att.Name)
+		if strings.HasSuffix(att.Name, ".exe") {
+			return errors.New("executables are not allowed")
+		}
+		return nil
+	})
+
+	ready := s.Prepare(context.Background(), "telegram", []bus.Attachment{
+		readerAttachment("notes.txt", "hello"),
+		readerAttachment("setup.exe", "MZ"),
+	})
+
+	if len(ready) != 1 || ready[0].Name != "notes.txt" {
+		t.Fatalf("ready = %+v", ready)
+	}
+	if len(seen) != 2 || seen[0] != "telegram:notes.txt" {
+		t.Errorf("hook calls = %v", seen)
+	}
+	entries, _ := os.ReadDir(s.Dir())
+	if len(entries) != 1 {
+		t.Errorf("rejected attachment was not removed: %d files", len(entries))
+	}
+}
+
+func TestStoreSweep(t *testing.T) {
+	s := NewStore(t.TempDir(), 1024, time.Hour)
+
+	old := filepath.Join(s.Dir(), "old.txt")
+	fresh := filepath.Join(s.Dir(), "fresh.txt")
+	os.WriteFile(old, []byte("x"), 0o600)
+	os.WriteFile(fresh, []byte("x"), 0o600)
+	past := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(old, past, past)
+
+	s.Sweep()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expired file was not removed")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("fresh file was removed")
+	}
+}
+
+func TestStoreReleaseOnlyOwnFiles(t *testing.T) {
+	s := NewStore(t.TempDir(), 1024, time.Hour)
+	outside := filepath.Join(t.TempDir(), "keep.txt")
+	os.WriteFile(outside, []byte("x"), 0o600)
+
+	s.Release(bus.Attachment{Path: outside})
+
+	if _, err := os.Stat(outside); err != nil {
+		t.Error("Release removed a file the store does not own")
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("voice"))
+	}))
+	defer srv.Close()
+
+	s := NewStore(t.TempDir(), 1024, time.Hour)
+	att := FromURL(srv.URL, "voice.ogg", "audio/ogg", map[string]string{"Authorization": "Bearer token"})
+	if att.Type != bus.AttachmentAudio {
+		t.Errorf("Type = %q, want audio", att.Type)
+	}
+	if err := s.Fetch(context.Background(), &att); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	att = FromURL(srv.URL, "voice.ogg", "audio/ogg", nil)
+	if err := s.Fetch(context.Background(), &att); err == nil {
+		t.Error("expected error for unauthorized download")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	got := Describe([]bus.Attachment{
+		{Type: "image", Name: "cat.jpg", ContentType: "image/jpeg", Size: 2048, Path: "/w/attachments/cat.jpg"},
+		{Type: "file", Name: "report.pdf"},
+	})
+	want := "[Attachments]\n" +
+		"- image \"cat.jpg\" (image/jpeg, 2.0 KB) at /w/attachments/cat.jpg\n" +
+		"- file \"report.pdf\""
+	if got != want {
+		t.Errorf("Describe =\n%s\nwant\n%s", got, want)
+	}
+	if Describe(nil) != "" {
+		t.Error("Describe(nil) should be empty")
+	}
+}
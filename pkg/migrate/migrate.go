@@ -223,7 +223,9 @@ func executeConfigMigration(srcConfigPath, dstConfigPath, picoClawHome string) e
 	}
 
 	if _, err := os.Stat(dstConfigPath); err == nil {
-		existing, err := config.LoadConfig(dstConfigPath)
+		// The merged config is saved back to the file, so only the file is
+		// loaded, not the layers over it.
+		existing, err := config.LoadConfigFile(dstConfigPath)
 		if err != nil {
 			return fmt.Errorf("loading existing PicoClaw config: %w", err)
 		}
@@ -0,0 +1,303 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxBundleSize caps the size of a plugin archive.
+const maxBundleSize = 50 << 20
+
+// Installer installs, updates and removes the plugins of a workspace.
+type Installer struct {
+	dir         string
+	trustedKeys []ed25519.PublicKey
+	client      *http.Client
+}
+
+// NewInstaller creates an installer for the plugins in dir that accepts
+// archives signed with one of trustedKeys, base64 ed25519 public keys.
+func NewInstaller(dir string, trustedKeys []string) (*Installer, error) {
+	in := &Installer{dir: dir, client: &http.Client{Timeout: 2 * time.Minute}}
+	for _, k := range trustedKeys {
+		key, err := ParsePublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		in.trustedKeys = append(in.trustedKeys, key)
+	}
+	return in, nil
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("trusted key %q is not a base64 ed25519 public key", s)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// KeyID is a short name for a public key: the start of its SHA-256.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// List returns the installed plugins.
+func (in *Installer) List() []*Plugin {
+	return Load(in.dir)
+}
+
+// Get returns the installed plugin called name.
+func (in *Installer) Get(name string) (*Plugin, error) {
+	if !pluginName.MatchString(name) {
+		return nil, fmt.Errorf("invalid plugin name %q", name)
+	}
+	dir := filepath.Join(in.dir, name)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("plugin %s is not installed", name)
+	}
+	return open(dir)
+}
+
+// Install fetches the archive at source, a URL or a path, verifies it
+// and installs the plugin in it. The archive must have the SHA-256
+// checksum when that is set, else a signature by a trusted key in
+// <source>.sig: the base64 ed25519 signature of the archive.
+func (in *Installer) Install(ctx context.Context, source, checksum string) (*Plugin, error) {
+	return in.install(ctx, source, checksum, false)
+}
+
+// Update installs the plugin called name again from where it came from,
+// verified the same way as Install. An archive pinned by its checksum
+// needs the new checksum.
+func (in *Installer) Update(ctx context.Context, name, checksum string) (*Plugin, error) {
+	p, err := in.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if p.Origin.Source == "" {
+		return nil, fmt.Errorf("plugin %s does not say where it was installed from", name)
+	}
+	updated, err := in.install(ctx, p.Origin.Source, checksum, true)
+	if err != nil {
+		return nil, err
+	}
+	if updated.Name != name {
+		return nil, fmt.Errorf("%s now holds plugin %s", p.Origin.Source, updated.Name)
+	}
+	return updated, nil
+}
+
+// Remove uninstalls the plugin called name.
+func (in *Installer) Remove(name string) error {
+	p, err := in.Get(name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p.Dir)
+}
+
+func (in *Installer) install(ctx context.Context, source, checksum string, replace bool) (*Plugin, error) {
+	archive, sig, err := in.fetch(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	verifiedBy, err := in.verify(archive, sig, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(in.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create plugins directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(in.dir, ".install-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	zipPath := filepath.Join(staging, "plugin.zip")
+	if err := os.WriteFile(zipPath, archive, 0o600); err != nil {
+		return nil, err
+	}
+	extracted := filepath.Join(staging, "plugin")
+	if err := utils.ExtractZipFile(zipPath, extracted); err != nil {
+		return nil, err
+	}
+	root, err := bundleRoot(extracted)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ReadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.checkConflicts(m); err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(archive)
+	origin, _ := json.MarshalIndent(Origin{
+		Source:      source,
+		SHA256:      hex.EncodeToString(digest[:]),
+		VerifiedBy:  verifiedBy,
+		InstalledAt: time.Now(),
+	}, "", "  ")
+	if err := os.WriteFile(filepath.Join(root, originFile), origin, 0o644); err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(in.dir, m.Name)
+	if _, err := os.Stat(target); err == nil {
+		if !replace {
+			return nil, fmt.Errorf("plugin %s is already installed; update or remove it", m.Name)
+		}
+		// Moved into staging, the old version goes when staging does.
+		if err := os.Rename(target, filepath.Join(staging, "previous")); err != nil {
+			return nil, fmt.Errorf("failed to replace plugin %s: %w", m.Name, err)
+		}
+	}
+	if err := os.Rename(root, target); err != nil {
+		return nil, fmt.Errorf("failed to install plugin %s: %w", m.Name, err)
+	}
+	return open(target)
+}
+
+// fetch returns the archive at source and its signature, nil when there
+// is none.
+func (in *Installer) fetch(ctx context.Context, source string) (archive, sig []byte, err error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		if archive, err = readFile(source, maxBundleSize); err != nil {
+			return nil, nil, err
+		}
+		sig, _ = readFile(source+".sig", 4096)
+		return archive, sig, nil
+	}
+	if archive, err = in.get(ctx, source, maxBundleSize); err != nil {
+		return nil, nil, err
+	}
+	if sig, err = in.get(ctx, source+".sig", 4096); err != nil && !errors.Is(err, errNotFound) {
+		return nil, nil, err
+	}
+	return archive, sig, nil
+}
+
+// errNotFound is returned by get for a 404.
+var errNotFound = errors.New("not found")
+
+func (in *Installer) get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := in.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", url, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: HTTP %d", url, resp.StatusCode)
+	}
+	return readLimited(resp.Body, limit, url)
+}
+
+func readFile(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLimited(f, limit, path)
+}
+
+func readLimited(r io.Reader, limit int64, name string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, limit)
+	}
+	return data, nil
+}
+
+// verify checks archive against the checksum or, without one, its
+// signature, and says which it was.
+func (in *Installer) verify(archive, sig []byte, checksum string) (string, error) {
+	if checksum != "" {
+		digest := sha256.Sum256(archive)
+		if got := hex.EncodeToString(digest[:]); !strings.EqualFold(got, strings.TrimSpace(checksum)) {
+			return "", fmt.Errorf("checksum mismatch: the archive's SHA-256 is %s", got)
+		}
+		return "sha256", nil
+	}
+	if sig == nil {
+		return "", fmt.Errorf("the archive is not verified: pass its SHA-256 checksum, or publish a .sig " +
+			"next to it signed with a key in plugins.trusted_keys")
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return "", fmt.Errorf("the signature is not base64: %w", err)
+	}
+	for _, key := range in.trustedKeys {
+		if ed25519.Verify(key, archive, signature) {
+			return "key:" + KeyID(key), nil
+		}
+	}
+	return "", fmt.Errorf("the archive's signature does not match any key in plugins.trusted_keys")
+}
+
+// bundleRoot returns the directory of an extracted archive that holds the
+// manifest: the archive's root or its only directory.
+func bundleRoot(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err == nil {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		root := filepath.Join(dir, entries[0].Name())
+		if _, err := os.Stat(filepath.Join(root, ManifestFile)); err == nil {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("the archive has no %s", ManifestFile)
+}
+
+// checkConflicts refuses a plugin with a tool another plugin has.
+func (in *Installer) checkConflicts(m *Manifest) error {
+	for _, other := range in.List() {
+		if other.Name == m.Name {
+			continue
+		}
+		for _, t := range m.Tools {
+			for _, o := range other.Tools {
+				if t.Name == o.Name {
+					return fmt.Errorf("tool %s is already provided by plugin %s", t.Name, other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
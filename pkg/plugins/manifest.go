@@ -0,0 +1,228 @@
+// Package plugins installs and runs plugins: bundles of tools, outbound
+// message hooks and skills that are not built into picoclaw.
+//
+// A plugin is a ZIP archive with a plugin.json manifest at its root, or in
+// its only directory as in GitHub archives, and the scripts the manifest
+// runs. Skills go in skills/<name>/SKILL.md. Installed plugins live in
+// <workspace>/plugins/<name>; the gateway loads them when it starts.
+//
+// Tools and hooks run as a process per call, in the plugin's directory,
+// with only PATH, HOME, LANG and TMPDIR from the gateway's environment so
+// they do not see its secrets. A tool reads its arguments as a JSON object
+// on stdin and writes its result to stdout. A hook reads the outgoing
+// message as {"channel", "chat_id", "content"} and writes nothing to let it
+// pass, {"content": "..."} to rewrite it or {"block": "reason"} to stop it.
+// A command that fails or times out fails the call, which blocks a message.
+//
+// WebAssembly plugins are not implemented; a manifest that runs a .wasm
+// file is refused.
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ManifestFile is the name of the manifest in a plugin.
+const ManifestFile = "plugin.json"
+
+// originFile records where an installed plugin came from.
+const originFile = ".origin.json"
+
+const (
+	defaultTimeout = 30 * time.Second
+	maxTimeout     = 5 * time.Minute
+)
+
+var (
+	pluginName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+	toolName   = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+)
+
+// HookEvents are the events a hook can run on.
+var HookEvents = []string{"outbound"}
+
+// Manifest describes a plugin, read from its plugin.json.
+type Manifest struct {
+	Name        string     `json:"name"`
+	Version     string     `json:"version,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Tools       []ToolSpec `json:"tools,omitempty"`
+	Hooks       []HookSpec `json:"hooks,omitempty"`
+}
+
+// ToolSpec is a tool a plugin offers agents. Parameters is the JSON
+// Schema of its arguments.
+type ToolSpec struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Parameters     map[string]any `json:"parameters,omitempty"`
+	Command        []string       `json:"command"`
+	TimeoutSeconds int            `json:"timeout_seconds,omitempty"` // default 30, at most 300
+}
+
+// HookSpec is a hook a plugin runs on every outgoing message.
+type HookSpec struct {
+	Event          string   `json:"event"` // "outbound"
+	Command        []string `json:"command"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+}
+
+// Origin records how a plugin was installed, for update.
+type Origin struct {
+	Source      string    `json:"source"` // the URL or path it was installed from
+	SHA256      string    `json:"sha256"` // of the archive
+	VerifiedBy  string    `json:"verified_by"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// Plugin is an installed plugin.
+type Plugin struct {
+	Manifest
+	Dir    string
+	Origin Origin
+	// Skills are the names of the directories under skills/ with a
+	// SKILL.md.
+	Skills []string
+}
+
+// ReadManifest reads and checks the manifest of the plugin in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	if err := m.validate(dir); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *Manifest) validate(dir string) error {
+	if !pluginName.MatchString(m.Name) {
+		return fmt.Errorf("plugin name %q must be lowercase letters, digits and dashes", m.Name)
+	}
+	seen := make(map[string]bool)
+	for _, t := range m.Tools {
+		if !toolName.MatchString(t.Name) {
+			return fmt.Errorf("tool name %q must be letters, digits, dashes and underscores", t.Name)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("tool %s is defined twice", t.Name)
+		}
+		seen[t.Name] = true
+		if t.Description == "" {
+			return fmt.Errorf("tool %s: description is missing", t.Name)
+		}
+		if err := checkCommand(dir, t.Command, t.TimeoutSeconds); err != nil {
+			return fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+	}
+	for i, h := range m.Hooks {
+		if h.Event != "outbound" {
+			return fmt.Errorf("hook %d: event %q is not one of %s", i+1, h.Event, strings.Join(HookEvents, ", "))
+		}
+		if err := checkCommand(dir, h.Command, h.TimeoutSeconds); err != nil {
+			return fmt.Errorf("hook %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// checkCommand checks that command runs a program on the PATH or a file
+// of the plugin. Commands that run a .wasm file are refused: there is no
+// WebAssembly runtime to sandbox them in.
+func checkCommand(dir string, command []string, timeoutSeconds int) error {
+	if len(command) == 0 || command[0] == "" {
+		return fmt.Errorf("command is missing")
+	}
+	for _, arg := range command {
+		if strings.HasSuffix(arg, ".wasm") {
+			return fmt.Errorf("%s: WebAssembly plugins are not supported, use a script", arg)
+		}
+	}
+	if timeoutSeconds < 0 || time.Duration(timeoutSeconds)*time.Second > maxTimeout {
+		return fmt.Errorf("timeout_seconds must be between 0 and %d", int(maxTimeout.Seconds()))
+	}
+	if !strings.ContainsAny(command[0], `/\`) {
+		return nil
+	}
+	path, err := resolve(dir, command[0])
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s is not in the plugin", command[0])
+	}
+	return nil
+}
+
+// resolve returns the path of a file of the plugin in dir named relative
+// to it, refusing names that lead out of it.
+func resolve(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s must be a path inside the plugin", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// timeout returns how long a command may run.
+func timeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// open reads the installed plugin in dir.
+func open(dir string) (*Plugin, error) {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plugin{Manifest: *m, Dir: dir}
+	if data, err := os.ReadFile(filepath.Join(dir, originFile)); err == nil {
+		json.Unmarshal(data, &p.Origin)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "skills"))
+	for _, e := range entries {
+		if _, err := os.Stat(filepath.Join(dir, "skills", e.Name(), "SKILL.md")); e.IsDir() && err == nil {
+			p.Skills = append(p.Skills, e.Name())
+		}
+	}
+	return p, nil
+}
+
+// Load returns the plugins installed in dir, sorted by name. A plugin
+// that does not load is logged and left out.
+func Load(dir string) []*Plugin {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var loaded []*Plugin
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		p, err := open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			logger.WarnCF("plugins", "Skipping plugin", map[string]any{"plugin": e.Name(), "error": err.Error()})
+			continue
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded
+}
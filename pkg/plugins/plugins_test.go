@@ -0,0 +1,174 @@
+package plugins
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+const manifest = `{
+  "name": "echo",
+  "version": "%s",
+  "tools": [{"name": "echo_args", "description": "Echoes its arguments", "command": ["sh", "tool.sh"]}],
+  "hooks": [{"event": "outbound", "command": ["./hook.sh"]}]
+}`
+
+// writeArchive writes a plugin archive with the given files, under a
+// top-level directory as GitHub archives have, and returns its path and
+// SHA-256.
+func writeArchive(t *testing.T, dir, name string, files map[string]string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for path, content := range files {
+		h := &zip.FileHeader{Name: "echo-main/" + path, Method: zip.Deflate}
+		h.SetMode(0o755)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return path, hex.EncodeToString(sum[:])
+}
+
+func echoFiles(version string) map[string]string {
+	return map[string]string{
+		"plugin.json": strings.Replace(manifest, "%s", version, 1),
+		"tool.sh":     "#!/bin/sh\ncat\n",
+		"hook.sh": "#!/bin/sh\nif grep -q secret; then echo '{\"block\": \"leaks a secret\"}';" +
+			" else echo '{\"content\": \"rewritten\"}'; fi\n",
+		"skills/echoing/SKILL.md": "---\nname: echoing\ndescription: How to echo\n---\nEcho.",
+	}
+}
+
+func TestInstall(t *testing.T) {
+	src, pluginsDir := t.TempDir(), filepath.Join(t.TempDir(), "plugins")
+	ctx := context.Background()
+	archive, sum := writeArchive(t, src, "echo.zip", echoFiles("1.0.0"))
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	in, err := NewInstaller(pluginsDir, []string{base64.StdEncoding.EncodeToString(pub)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := in.Install(ctx, archive, ""); err == nil || !strings.Contains(err.Error(), "not verified") {
+		t.Errorf("unverified archive: %v", err)
+	}
+	if _, err := in.Install(ctx, archive, strings.Repeat("0", 64)); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("wrong checksum: %v", err)
+	}
+	p, err := in.Install(ctx, archive, sum)
+	if err != nil {
+		t.Fatalf("Install() error: %v", err)
+	}
+	if p.Name != "echo" || p.Origin.VerifiedBy != "sha256" || p.Origin.SHA256 != sum ||
+		len(p.Skills) != 1 || p.Skills[0] != "echoing" {
+		t.Errorf("installed %+v", p)
+	}
+	if _, err := in.Install(ctx, archive, sum); err == nil || !strings.Contains(err.Error(), "already installed") {
+		t.Errorf("second install: %v", err)
+	}
+
+	// A new version signed by a trusted key needs no checksum.
+	archive2, _ := writeArchive(t, src, "echo.zip", echoFiles("2.0.0"))
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	data, _ := os.ReadFile(archive2)
+	os.WriteFile(archive2+".sig", []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(otherKey, data))), 0o644)
+	if _, err := in.Update(ctx, "echo", ""); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("untrusted signature: %v", err)
+	}
+	os.WriteFile(archive2+".sig", []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))), 0o644)
+	p, err = in.Update(ctx, "echo", "")
+	if err != nil {
+		t.Fatalf("Update() error: %v", err)
+	}
+	if p.Version != "2.0.0" || p.Origin.VerifiedBy != "key:"+KeyID(pub) {
+		t.Errorf("updated %+v", p)
+	}
+	if entries, _ := os.ReadDir(pluginsDir); len(entries) != 1 {
+		t.Errorf("plugins directory holds %d entries, want only the plugin", len(entries))
+	}
+
+	if err := in.Remove("echo"); err != nil {
+		t.Fatal(err)
+	}
+	if len(in.List()) != 0 {
+		t.Error("plugin still listed after Remove")
+	}
+	if err := in.Remove("../etc"); err == nil {
+		t.Error("Remove accepted a path")
+	}
+}
+
+func TestReadManifest_Rejects(t *testing.T) {
+	tests := map[string]string{
+		`{"name": "Bad Name"}`: "lowercase",
+		`{"name": "w", "tools": [{"name": "t", "description": "d", "command": ["./missing.sh"]}]}`:       "not in the plugin",
+		`{"name": "w", "tools": [{"name": "t", "description": "d", "command": ["../../bin/sh"]}]}`:       "inside the plugin",
+		`{"name": "w", "tools": [{"name": "t", "description": "d", "command": ["wasmtime", "t.wasm"]}]}`: "WebAssembly",
+		`{"name": "w", "tools": [{"name": "t", "command": ["sh"]}]}`:                                     "description",
+		`{"name": "w", "hooks": [{"event": "inbound", "command": ["sh"]}]}`:                              "not one of",
+	}
+	for manifest, want := range tests {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, ManifestFile), []byte(manifest), 0o644)
+		if _, err := ReadManifest(dir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ReadManifest(%s) = %v, want %q", manifest, err, want)
+		}
+	}
+}
+
+func TestToolAndHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	src := t.TempDir()
+	archive, sum := writeArchive(t, src, "echo.zip", echoFiles("1.0.0"))
+	in, _ := NewInstaller(filepath.Join(t.TempDir(), "plugins"), nil)
+	p, err := in.Install(context.Background(), archive, sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tools := p.AgentTools()
+	if len(tools) != 1 {
+		t.Fatalf("AgentTools() = %d tools", len(tools))
+	}
+	res := tools[0].Execute(context.Background(), map[string]any{"text": "hi"})
+	if res.IsError || res.ForLLM != `{"text":"hi"}` {
+		t.Errorf("Execute() = %+v", res)
+	}
+
+	hooks := p.OutboundHooks()
+	if len(hooks) != 1 {
+		t.Fatalf("OutboundHooks() = %d hooks", len(hooks))
+	}
+	msg := &bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "hello"}
+	if err := hooks[0](context.Background(), msg); err != nil || msg.Content != "rewritten" {
+		t.Errorf("hook: %v, content %q", err, msg.Content)
+	}
+	msg.Content = "the secret is 42"
+	if err := hooks[0](context.Background(), msg); err == nil || !strings.Contains(err.Error(), "leaks a secret") {
+		t.Errorf("hook did not block: %v", err)
+	}
+}
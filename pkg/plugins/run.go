@@ -0,0 +1,177 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxOutput caps what a tool or hook may write to stdout.
+const maxOutput = 256 << 10
+
+// passedEnv are the variables of the gateway's environment a plugin sees.
+var passedEnv = []string{"PATH", "HOME", "LANG", "TMPDIR"}
+
+// Tool is a tool of a plugin.
+type Tool struct {
+	plugin *Plugin
+	spec   ToolSpec
+}
+
+// AgentTools returns the tools of the plugin, for agents' tool
+// registries.
+func (p *Plugin) AgentTools() []*Tool {
+	ts := make([]*Tool, 0, len(p.Manifest.Tools))
+	for _, spec := range p.Manifest.Tools {
+		ts = append(ts, &Tool{plugin: p, spec: spec})
+	}
+	return ts
+}
+
+func (t *Tool) Name() string        { return t.spec.Name }
+func (t *Tool) Description() string { return t.spec.Description }
+
+func (t *Tool) Parameters() map[string]any {
+	if t.spec.Parameters == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return t.spec.Parameters
+}
+
+// Plugin returns the name of the plugin the tool comes from.
+func (t *Tool) Plugin() string { return t.plugin.Name }
+
+func (t *Tool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	input, err := json.Marshal(args)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("invalid arguments: %v", err))
+	}
+	release, err := tools.AcquireSubprocess(ctx)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("%s (plugin %s) did not start: %v", t.spec.Name, t.plugin.Name, err)).WithError(err)
+	}
+	defer release()
+	channel, chatID := tools.ToolContextFrom(ctx)
+	out, err := t.plugin.run(ctx, t.spec.Command, t.spec.TimeoutSeconds, input,
+		"PICOCLAW_CHANNEL="+channel, "PICOCLAW_CHAT_ID="+chatID)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("%s (plugin %s) failed: %v", t.spec.Name, t.plugin.Name, err)).WithError(err)
+	}
+	return tools.NewToolResult(strings.TrimSpace(string(out)))
+}
+
+// hookMessage is what a hook reads on stdin.
+type hookMessage struct {
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+	Content string `json:"content"`
+}
+
+// hookVerdict is what a hook may write to stdout.
+type hookVerdict struct {
+	Content *string `json:"content"`
+	Block   string  `json:"block"`
+}
+
+// OutboundHooks returns the plugin's hooks on outgoing messages, for the
+// channel manager's AddOutboundHook.
+func (p *Plugin) OutboundHooks() []func(ctx context.Context, msg *bus.OutboundMessage) error {
+	var hooks []func(ctx context.Context, msg *bus.OutboundMessage) error
+	for _, spec := range p.Hooks {
+		if spec.Event != "outbound" {
+			continue
+		}
+		hooks = append(hooks, func(ctx context.Context, msg *bus.OutboundMessage) error {
+			input, _ := json.Marshal(hookMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: msg.Content})
+			out, err := p.run(ctx, spec.Command, spec.TimeoutSeconds, input)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %w", p.Name, err)
+			}
+			if len(bytes.TrimSpace(out)) == 0 {
+				return nil
+			}
+			var verdict hookVerdict
+			if err := json.Unmarshal(out, &verdict); err != nil {
+				return fmt.Errorf("plugin %s: invalid hook output: %w", p.Name, err)
+			}
+			if verdict.Block != "" {
+				return fmt.Errorf("plugin %s: %s", p.Name, verdict.Block)
+			}
+			if verdict.Content != nil {
+				msg.Content = *verdict.Content
+			}
+			return nil
+		})
+	}
+	return hooks
+}
+
+// run runs command in the plugin's directory with input on stdin and
+// returns what it wrote to stdout.
+func (p *Plugin) run(ctx context.Context, command []string, timeoutSeconds int, input []byte, env ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(timeoutSeconds))
+	defer cancel()
+
+	name := command[0]
+	if strings.ContainsAny(name, `/\`) {
+		path, err := resolve(p.Dir, name)
+		if err != nil {
+			return nil, err
+		}
+		name = path
+	}
+	cmd := exec.CommandContext(ctx, name, command[1:]...)
+	cmd.Dir = p.Dir
+	cmd.Env = append(env, "PICOCLAW_PLUGIN_DIR="+p.Dir)
+	for _, key := range passedEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+v)
+		}
+	}
+	cmd.WaitDelay = 2 * time.Second
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr limitedBuffer
+	stdout.limit, stderr.limit = maxOutput, 4096
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %s", timeout(timeoutSeconds))
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, utils.Truncate(msg, 500))
+		}
+		return nil, err
+	}
+	if stdout.overflow {
+		return nil, errors.New("output is larger than 256 KB")
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.overflow = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
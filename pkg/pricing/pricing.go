@@ -0,0 +1,123 @@
+// Package pricing knows what LLM requests cost. A built-in table lists the
+// list prices of common models; the config can override them or add
+// models, for instance to account for a negotiated rate or a proxy's
+// markup.
+package pricing
+
+import "strings"
+
+// Price is what a model charges in US dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns the cost of a request in US dollars.
+func (p Price) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
+}
+
+// localProviders run models on the user's own hardware.
+var localProviders = map[string]bool{
+	"gguf":     true,
+	"ollama":   true,
+	"lmstudio": true,
+	"vllm":     true,
+	"llamacpp": true,
+}
+
+// builtinPrices lists list prices by model name fragment, most specific
+// first. A leading "^" matches the start of the name after the vendor.
+var builtinPrices = []struct {
+	pattern string
+	price   Price
+}{
+	{"gpt-4o-mini", Price{0.15, 0.60}},
+	{"gpt-4o", Price{2.50, 10}},
+	{"gpt-4.1-nano", Price{0.10, 0.40}},
+	{"gpt-4.1-mini", Price{0.40, 1.60}},
+	{"gpt-4.1", Price{2, 8}},
+	{"gpt-5-nano", Price{0.05, 0.40}},
+	{"gpt-5-mini", Price{0.25, 2}},
+	{"gpt-5", Price{1.25, 10}},
+	{"gpt-4-turbo", Price{10, 30}},
+	{"gpt-4", Price{30, 60}},
+	{"gpt-3.5", Price{0.50, 1.50}},
+	{"^o4-mini", Price{1.10, 4.40}},
+	{"^o3-mini", Price{1.10, 4.40}},
+	{"^o3", Price{2, 8}},
+	{"^o1-mini", Price{1.10, 4.40}},
+	{"^o1", Price{15, 60}},
+	{"opus-4-5", Price{5, 25}},
+	{"opus-4.5", Price{5, 25}},
+	{"opus", Price{15, 75}},
+	{"sonnet", Price{3, 15}},
+	{"haiku-4", Price{1, 5}},
+	{"3-5-haiku", Price{0.80, 4}},
+	{"haiku", Price{0.25, 1.25}},
+	{"gemini-2.5-pro", Price{1.25, 10}},
+	{"gemini-2.5-flash-lite", Price{0.10, 0.40}},
+	{"gemini-2.5-flash", Price{0.30, 2.50}},
+	{"gemini-2.0-flash", Price{0.10, 0.40}},
+	{"gemini-1.5-pro", Price{1.25, 5}},
+	{"gemini-1.5-flash", Price{0.075, 0.30}},
+	{"deepseek-reasoner", Price{0.55, 2.19}},
+	{"deepseek", Price{0.27, 1.10}},
+	{"glm-4", Price{0.60, 2.20}},
+	{"kimi", Price{0.60, 2.50}},
+	{"qwen-max", Price{1.60, 6.40}},
+	{"qwen-plus", Price{0.40, 1.20}},
+	{"qwen-turbo", Price{0.05, 0.20}},
+	{"grok-3-mini", Price{0.30, 0.50}},
+	{"grok", Price{3, 15}},
+	{"mistral-large", Price{2, 6}},
+	{"mistral-small", Price{0.20, 0.60}},
+}
+
+// Registry looks up prices: overrides first, then the built-in table.
+type Registry struct {
+	overrides map[string]Price
+}
+
+// NewRegistry creates a registry with overrides keyed by model_list name,
+// "vendor/model" or model ID.
+func NewRegistry(overrides map[string]Price) *Registry {
+	return &Registry{overrides: overrides}
+}
+
+// Lookup returns the price of model served by provider, which may also
+// have been configured as the model_list entry route. Models on local
+// providers are free.
+func (r *Registry) Lookup(provider, route, model string) (Price, bool) {
+	for _, key := range []string{route, provider + "/" + model, model} {
+		if p, ok := r.overrides[key]; ok && key != "" && key != "/" {
+			return p, true
+		}
+	}
+	if localProviders[provider] {
+		return Price{}, true
+	}
+	for _, b := range builtinPrices {
+		if matchModel(model, b.pattern) {
+			return b.price, true
+		}
+	}
+	return Price{}, false
+}
+
+// Cost returns the cost of a request, and whether the price is known.
+func (r *Registry) Cost(provider, route, model string, promptTokens, completionTokens int) (float64, bool) {
+	p, ok := r.Lookup(provider, route, model)
+	if !ok {
+		return 0, false
+	}
+	return p.Cost(promptTokens, completionTokens), true
+}
+
+func matchModel(model, pattern string) bool {
+	model = strings.ToLower(model)
+	if prefix, ok := strings.CutPrefix(pattern, "^"); ok {
+		return strings.HasPrefix(model[strings.LastIndex(model, "/")+1:], prefix)
+	}
+	return strings.Contains(model, pattern)
+}
@@ -0,0 +1,39 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry(map[string]Price{
+		"cheap":      {Input: 0.01, Output: 0.02},
+		"custom-llm": {Input: 1, Output: 2},
+	})
+
+	tests := []struct {
+		provider, route, model string
+		want                   Price
+		known                  bool
+	}{
+		{"openai", "", "gpt-4o-mini", Price{0.15, 0.60}, true},
+		{"openai", "", "gpt-4o", Price{2.50, 10}, true},
+		{"openrouter", "", "anthropic/claude-sonnet-4.6", Price{3, 15}, true},
+		{"openai", "", "o3-mini", Price{1.10, 4.40}, true},
+		{"openrouter", "cheap", "anthropic/claude-sonnet-4.6", Price{0.01, 0.02}, true},
+		{"vllm", "", "custom-llm", Price{1, 2}, true},
+		{"ollama", "", "llama3.2", Price{}, true},
+		{"openai", "", "mystery-model", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := r.Lookup(tt.provider, tt.route, tt.model)
+		if got != tt.want || ok != tt.known {
+			t.Errorf("Lookup(%s, %s, %s) = %v, %v; want %v, %v", tt.provider, tt.route, tt.model, got, ok, tt.want, tt.known)
+		}
+	}
+
+	cost, ok := r.Cost("openai", "", "gpt-4o", 1000, 500)
+	if !ok || math.Abs(cost-0.0075) > 1e-9 {
+		t.Errorf("Cost() = %v, %v", cost, ok)
+	}
+}
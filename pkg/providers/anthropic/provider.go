@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 
 	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+	"github.com/sipeed/picoclaw/pkg/providers/ratelimit"
 )
 
 type (
@@ -47,6 +50,30 @@ func NewProviderWithBaseURL(token, apiBase string) *Provider {
 	}
 }
 
+// NewProviderWithAPIKey creates a provider that authenticates with an API key
+// from the Anthropic console, optionally through an HTTP proxy.
+func NewProviderWithAPIKey(apiKey, apiBase, proxy string) *Provider {
+	baseURL := normalizeBaseURL(apiBase)
+	opts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+		option.WithBaseURL(baseURL),
+	}
+	if proxy != "" {
+		if parsed, err := url.Parse(proxy); err == nil {
+			opts = append(opts, option.WithHTTPClient(&http.Client{
+				Transport: &http.Transport{Proxy: http.ProxyURL(parsed)},
+			}))
+		} else {
+			log.Printf("anthropic: invalid proxy URL %q: %v", proxy, err)
+		}
+	}
+	client := anthropic.NewClient(opts...)
+	return &Provider{
+		client:  &client,
+		baseURL: baseURL,
+	}
+}
+
 func NewProviderWithClient(client *anthropic.Client) *Provider {
 	return &Provider{
 		client:  client,
@@ -71,13 +98,9 @@ func (p *Provider) Chat(
 	model string,
 	options map[string]any,
 ) (*LLMResponse, error) {
-	var opts []option.RequestOption
-	if p.tokenSource != nil {
-		tok, err := p.tokenSource()
-		if err != nil {
-			return nil, fmt.Errorf("refreshing token: %w", err)
-		}
-		opts = append(opts, option.WithAuthToken(tok))
+	opts, err := p.requestOptions(model)
+	if err != nil {
+		return nil, err
 	}
 
 	params, err := buildParams(messages, tools, model, options)
@@ -93,6 +116,93 @@ func (p *Provider) Chat(
 	return parseResponse(resp), nil
 }
 
+// ChatStream is Chat with the reply's text passed to onDelta as it is
+// generated. Tool calls are only returned once complete.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	return p.ChatStreamTools(ctx, messages, tools, model, options, onDelta, nil)
+}
+
+// ChatStreamTools is ChatStream with each tool call also passed to
+// onToolCall when its content block ends, while later blocks are still
+// being generated.
+func (p *Provider) ChatStreamTools(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+	onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	opts, err := p.requestOptions(model)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := buildParams(messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := p.client.Messages.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	var msg anthropic.Message
+	for stream.Next() {
+		event := stream.Current()
+		if err := msg.Accumulate(event); err != nil {
+			return nil, fmt.Errorf("claude stream: %w", err)
+		}
+		switch {
+		case event.Type == "content_block_delta" && event.Delta.Type == "text_delta" && onDelta != nil:
+			onDelta(event.Delta.Text)
+		case event.Type == "content_block_stop" && onToolCall != nil && int(event.Index) < len(msg.Content):
+			if block := msg.Content[event.Index]; block.Type == "tool_use" {
+				onToolCall(toolCallFromBlock(block))
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("claude API call: %w", err)
+	}
+
+	return parseResponse(&msg), nil
+}
+
+func (p *Provider) requestOptions(model string) ([]option.RequestOption, error) {
+	opts := []option.RequestOption{option.WithMiddleware(rateLimited(ratelimit.Key(p.baseURL, model)))}
+	if p.tokenSource == nil {
+		return opts, nil
+	}
+	tok, err := p.tokenSource()
+	if err != nil {
+		return nil, fmt.Errorf("refreshing token: %w", err)
+	}
+	return append(opts, option.WithAuthToken(tok)), nil
+}
+
+// rateLimited holds requests back while the budget of key is used up and
+// records the limits of each response. The SDK retries 429s itself.
+func rateLimited(key string) option.Middleware {
+	return func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		if err := ratelimit.Default.Wait(req.Context(), key); err != nil {
+			return nil, err
+		}
+		resp, err := next(req)
+		if err == nil {
+			ratelimit.Default.Update(key, resp.Header, resp.StatusCode)
+		}
+		return resp, err
+	}
+}
+
 func (p *Provider) GetDefaultModel() string {
 	return "claude-sonnet-4.6"
 }
@@ -110,20 +220,31 @@ func buildParams(
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
 
+	// Results of parallel tool calls go back in one user turn, as the
+	// Messages API expects a tool_result block for each tool_use block of
+	// the previous assistant turn.
+	var toolResults []anthropic.ContentBlockParamUnion
+	flushToolResults := func() {
+		if len(toolResults) > 0 {
+			anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(toolResults...))
+			toolResults = nil
+		}
+	}
+
 	for _, msg := range messages {
+		if msg.Role == "tool" || msg.Role == "user" && msg.ToolCallID != "" {
+			toolResults = append(toolResults, anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false))
+			continue
+		}
+		flushToolResults()
+
 		switch msg.Role {
 		case "system":
 			system = append(system, anthropic.TextBlockParam{Text: msg.Content})
 		case "user":
-			if msg.ToolCallID != "" {
-				anthropicMessages = append(anthropicMessages,
-					anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
-				)
-			} else {
-				anthropicMessages = append(anthropicMessages,
-					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
-				)
-			}
+			anthropicMessages = append(anthropicMessages,
+				anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
+			)
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
 				var blocks []anthropic.ContentBlockParamUnion
@@ -139,12 +260,9 @@ func buildParams(
 					anthropic.NewAssistantMessage(anthropic.NewTextBlock(msg.Content)),
 				)
 			}
-		case "tool":
-			anthropicMessages = append(anthropicMessages,
-				anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
-			)
 		}
 	}
+	flushToolResults()
 
 	maxTokens := int64(4096)
 	if mt, ok := options["max_tokens"].(int); ok {
@@ -164,14 +282,46 @@ func buildParams(
 	if temp, ok := options["temperature"].(float64); ok {
 		params.Temperature = anthropic.Float(temp)
 	}
+	// Claude has no penalties, seed or logit bias.
+	if topP, ok := options["top_p"].(float64); ok {
+		params.TopP = anthropic.Float(topP)
+	}
+	if stop, ok := options["stop"].([]string); ok && len(stop) > 0 {
+		params.StopSequences = stop
+	}
 
 	if len(tools) > 0 {
 		params.Tools = translateTools(tools)
 	}
 
+	if cache, ok := options["prompt_cache"].(bool); !ok || cache {
+		setCacheBreakpoints(&params)
+	}
+
 	return params, nil
 }
 
+// setCacheBreakpoints marks the tools, the system prompt and the
+// conversation so far for prompt caching. Each request of an agent turn
+// repeats the previous one plus a few messages, so from the second
+// iteration on most of the prompt is read from the cache.
+func setCacheBreakpoints(params *anthropic.MessageNewParams) {
+	if n := len(params.Tools); n > 0 && params.Tools[n-1].OfTool != nil {
+		params.Tools[n-1].OfTool.CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
+	if n := len(params.System); n > 0 {
+		params.System[n-1].CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
+	if n := len(params.Messages); n > 0 {
+		blocks := params.Messages[n-1].Content
+		if len(blocks) > 0 {
+			if cc := blocks[len(blocks)-1].GetCacheControl(); cc != nil {
+				*cc = anthropic.NewCacheControlEphemeralParam()
+			}
+		}
+	}
+}
+
 func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	result := make([]anthropic.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -198,6 +348,20 @@ func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	return result
 }
 
+func toolCallFromBlock(block anthropic.ContentBlockUnion) ToolCall {
+	tu := block.AsToolUse()
+	var args map[string]any
+	if err := json.Unmarshal(tu.Input, &args); err != nil {
+		log.Printf("anthropic: failed to decode tool call input for %q: %v", tu.Name, err)
+		args = map[string]any{"raw": string(tu.Input)}
+	}
+	return ToolCall{
+		ID:        tu.ID,
+		Name:      tu.Name,
+		Arguments: args,
+	}
+}
+
 func parseResponse(resp *anthropic.Message) *LLMResponse {
 	var content string
 	var toolCalls []ToolCall
@@ -208,17 +372,7 @@ func parseResponse(resp *anthropic.Message) *LLMResponse {
 			tb := block.AsText()
 			content += tb.Text
 		case "tool_use":
-			tu := block.AsToolUse()
-			var args map[string]any
-			if err := json.Unmarshal(tu.Input, &args); err != nil {
-				log.Printf("anthropic: failed to decode tool call input for %q: %v", tu.Name, err)
-				args = map[string]any{"raw": string(tu.Input)}
-			}
-			toolCalls = append(toolCalls, ToolCall{
-				ID:        tu.ID,
-				Name:      tu.Name,
-				Arguments: args,
-			})
+			toolCalls = append(toolCalls, toolCallFromBlock(block))
 		}
 	}
 
@@ -232,14 +386,18 @@ func parseResponse(resp *anthropic.Message) *LLMResponse {
 		finishReason = "stop"
 	}
 
+	// input_tokens only counts the part of the prompt after the last cache
+	// breakpoint.
+	promptTokens := resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens
+
 	return &LLMResponse{
 		Content:      content,
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
 		Usage: &UsageInfo{
-			PromptTokens:     int(resp.Usage.InputTokens),
+			PromptTokens:     int(promptTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:      int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
+			TotalTokens:      int(promptTokens + resp.Usage.OutputTokens),
 		},
 	}
 }
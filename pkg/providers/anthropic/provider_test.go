@@ -2,8 +2,10 @@ package anthropicprovider
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -269,3 +271,91 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+func TestBuildParams_GroupsToolResultsAndSetsCacheBreakpoints(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "Weather in SF and NYC?"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "call_1", Name: "get_weather", Arguments: map[string]any{"city": "SF"}},
+			{ID: "call_2", Name: "get_weather", Arguments: map[string]any{"city": "NYC"}},
+		}},
+		{Role: "tool", Content: "72", ToolCallID: "call_1"},
+		{Role: "tool", Content: "65", ToolCallID: "call_2"},
+	}
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "get_weather"}}}
+	params, err := buildParams(messages, tools, "claude-sonnet-4.6", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params.Messages) != 3 || len(params.Messages[2].Content) != 2 {
+		t.Fatalf("tool results were not sent in one user turn: %+v", params.Messages)
+	}
+
+	body, _ := json.Marshal(params)
+	if got := strings.Count(string(body), `"cache_control":{"type":"ephemeral"}`); got != 3 {
+		t.Errorf("cache breakpoints = %d, want 3 (tools, system, last message):\n%s", got, body)
+	}
+
+	params, _ = buildParams(messages, tools, "claude-sonnet-4.6", map[string]any{"prompt_cache": false})
+	body, _ = json.Marshal(params)
+	if strings.Contains(string(body), "cache_control") {
+		t.Errorf("prompt_cache=false still sets breakpoints:\n%s", body)
+	}
+}
+
+func TestProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "sk-ant-test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var reqBody map[string]any
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if reqBody["stream"] != true {
+			http.Error(w, "expected a streaming request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range []string{
+			`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4.6","content":[],"usage":{"input_tokens":5,"cache_read_input_tokens":100,"output_tokens":0}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"check."}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"SF\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+			`{"type":"message_stop"}`,
+		} {
+			var typ struct{ Type string }
+			json.Unmarshal([]byte(ev), &typ)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, ev)
+		}
+	}))
+	defer server.Close()
+
+	p := NewProviderWithAPIKey("sk-ant-test", server.URL+"/v1", "")
+	var deltas []string
+	var early []ToolCall
+	resp, err := p.ChatStreamTools(t.Context(), []Message{{Role: "user", Content: "Weather in SF?"}}, nil,
+		"claude-sonnet-4.6", map[string]any{}, func(d string) { deltas = append(deltas, d) },
+		func(tc ToolCall) { early = append(early, tc) })
+	if err != nil {
+		t.Fatalf("ChatStreamTools() error: %v", err)
+	}
+	if len(early) != 1 || early[0].ID != "toolu_1" || early[0].Arguments["city"] != "SF" {
+		t.Errorf("streamed tool calls = %+v", early)
+	}
+	if strings.Join(deltas, "|") != "Let me |check." || resp.Content != "Let me check." {
+		t.Errorf("deltas = %q, content = %q", deltas, resp.Content)
+	}
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["city"] != "SF" {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage.PromptTokens != 105 || resp.Usage.CompletionTokens != 12 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
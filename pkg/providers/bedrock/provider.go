@@ -0,0 +1,345 @@
+package bedrockprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+	"github.com/sipeed/picoclaw/pkg/providers/ratelimit"
+)
+
+type (
+	ToolCall       = protocoltypes.ToolCall
+	FunctionCall   = protocoltypes.FunctionCall
+	LLMResponse    = protocoltypes.LLMResponse
+	UsageInfo      = protocoltypes.UsageInfo
+	Message        = protocoltypes.Message
+	ToolDefinition = protocoltypes.ToolDefinition
+)
+
+const DefaultRegion = "us-east-1"
+
+// Provider talks to Amazon Bedrock through the Converse API, which takes
+// the same request for every model family on Bedrock (Claude, Llama,
+// Mistral, Nova, ...). Requests are signed with SigV4, or carry a Bedrock
+// API key as bearer token when one is configured.
+type Provider struct {
+	region     string
+	endpoint   string
+	apiKey     string
+	creds      Credentials
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewProvider creates a Bedrock provider for region. endpoint overrides the
+// public bedrock-runtime endpoint, e.g. for a VPC endpoint. Without an
+// apiKey the AWS credentials are read from the environment.
+func NewProvider(region, endpoint, apiKey, proxy string) *Provider {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = DefaultRegion
+	}
+	if endpoint == "" {
+		endpoint = "https://bedrock-runtime." + region + ".amazonaws.com"
+	}
+	client := &http.Client{Timeout: 120 * time.Second}
+	if proxy != "" {
+		if parsed, err := url.Parse(proxy); err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(parsed)}
+		} else {
+			log.Printf("bedrock: invalid proxy URL %q: %v", proxy, err)
+		}
+	}
+	p := &Provider{
+		region:     region,
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		apiKey:     apiKey,
+		httpClient: client,
+		now:        time.Now,
+	}
+	if apiKey == "" {
+		p.creds = CredentialsFromEnv()
+	}
+	return p
+}
+
+// CredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// SetCredentials replaces the AWS credentials requests are signed with.
+func (p *Provider) SetCredentials(creds Credentials) {
+	p.creds = creds
+}
+
+func (p *Provider) Region() string {
+	return p.region
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return ""
+}
+
+func (p *Provider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	if p.apiKey == "" && (p.creds.AccessKeyID == "" || p.creds.SecretAccessKey == "") {
+		return nil, fmt.Errorf("bedrock: no credentials; set api_key or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	body, err := json.Marshal(buildRequest(messages, tools, options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Model IDs contain colons and inference profile ARNs slashes, which
+	// must stay escaped in the path.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		p.endpoint+"/model/"+awsEscape(model)+"/converse", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	} else {
+		signV4(req, hashHex(body), p.creds, p.region, "bedrock", p.now())
+	}
+
+	resp, err := ratelimit.Default.Do(p.httpClient, req, ratelimit.Key(p.endpoint, model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(data))
+	}
+	return parseResponse(data)
+}
+
+type converseRequest struct {
+	Messages        []converseMessage `json:"messages"`
+	System          []contentBlock    `json:"system,omitempty"`
+	InferenceConfig *inferenceConfig  `json:"inferenceConfig,omitempty"`
+	ToolConfig      *toolConfig       `json:"toolConfig,omitempty"`
+}
+
+type converseMessage struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Text             string            `json:"text,omitempty"`
+	ToolUse          *toolUse          `json:"toolUse,omitempty"`
+	ToolResult       *toolResult       `json:"toolResult,omitempty"`
+	ReasoningContent *reasoningContent `json:"reasoningContent,omitempty"`
+}
+
+type toolUse struct {
+	ToolUseID string         `json:"toolUseId"`
+	Name      string         `json:"name"`
+	Input     map[string]any `json:"input"`
+}
+
+type toolResult struct {
+	ToolUseID string         `json:"toolUseId"`
+	Content   []contentBlock `json:"content"`
+}
+
+type reasoningContent struct {
+	ReasoningText *struct {
+		Text string `json:"text"`
+	} `json:"reasoningText,omitempty"`
+}
+
+type inferenceConfig struct {
+	MaxTokens     int      `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type toolConfig struct {
+	Tools []toolSpecEntry `json:"tools"`
+}
+
+type toolSpecEntry struct {
+	ToolSpec toolSpec `json:"toolSpec"`
+}
+
+type toolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema struct {
+		JSON map[string]any `json:"json"`
+	} `json:"inputSchema"`
+}
+
+func buildRequest(messages []Message, tools []ToolDefinition, options map[string]any) converseRequest {
+	var req converseRequest
+	add := func(role string, blocks ...contentBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		// Converse wants alternating roles, so tool results and queued
+		// user messages are merged into one turn.
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, blocks...)
+			return
+		}
+		req.Messages = append(req.Messages, converseMessage{Role: role, Content: blocks})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				req.System = append(req.System, contentBlock{Text: msg.Content})
+			}
+		case "assistant":
+			var blocks []contentBlock
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				name, args := tc.Name, tc.Arguments
+				if name == "" && tc.Function != nil {
+					name = tc.Function.Name
+					_ = json.Unmarshal([]byte(tc.Function.Arguments), &args)
+				}
+				if args == nil {
+					args = map[string]any{}
+				}
+				blocks = append(blocks, contentBlock{ToolUse: &toolUse{ToolUseID: tc.ID, Name: name, Input: args}})
+			}
+			add("assistant", blocks...)
+		case "tool":
+			content := msg.Content
+			if content == "" {
+				content = "(no output)"
+			}
+			add("user", contentBlock{ToolResult: &toolResult{
+				ToolUseID: msg.ToolCallID,
+				Content:   []contentBlock{{Text: content}},
+			}})
+		default:
+			if msg.Content != "" {
+				add("user", contentBlock{Text: msg.Content})
+			}
+		}
+	}
+
+	if len(tools) > 0 {
+		req.ToolConfig = &toolConfig{}
+		for _, t := range tools {
+			spec := toolSpec{Name: t.Function.Name, Description: t.Function.Description}
+			spec.InputSchema.JSON = t.Function.Parameters
+			if spec.InputSchema.JSON == nil {
+				spec.InputSchema.JSON = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			req.ToolConfig.Tools = append(req.ToolConfig.Tools, toolSpecEntry{ToolSpec: spec})
+		}
+	}
+
+	config := &inferenceConfig{}
+	if maxTokens, ok := options["max_tokens"].(int); ok && maxTokens > 0 {
+		config.MaxTokens = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		config.Temperature = &temperature
+	}
+	// Converse takes no penalties, seed or logit bias.
+	if topP, ok := options["top_p"].(float64); ok {
+		config.TopP = &topP
+	}
+	if stop, ok := options["stop"].([]string); ok && len(stop) > 0 {
+		config.StopSequences = stop
+	}
+	if config.MaxTokens > 0 || config.Temperature != nil || config.TopP != nil || config.StopSequences != nil {
+		req.InferenceConfig = config
+	}
+	return req
+}
+
+func parseResponse(data []byte) (*LLMResponse, error) {
+	var resp struct {
+		Output struct {
+			Message converseMessage `json:"message"`
+		} `json:"output"`
+		StopReason string `json:"stopReason"`
+		Usage      *struct {
+			InputTokens  int `json:"inputTokens"`
+			OutputTokens int `json:"outputTokens"`
+			TotalTokens  int `json:"totalTokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	out := &LLMResponse{FinishReason: "stop"}
+	var content, reasoning strings.Builder
+	for _, block := range resp.Output.Message.Content {
+		switch {
+		case block.ToolUse != nil:
+			args := block.ToolUse.Input
+			if args == nil {
+				args = map[string]any{}
+			}
+			argsJSON, _ := json.Marshal(args)
+			out.ToolCalls = append(out.ToolCalls, ToolCall{
+				ID:        block.ToolUse.ToolUseID,
+				Type:      "function",
+				Name:      block.ToolUse.Name,
+				Arguments: args,
+				Function:  &FunctionCall{Name: block.ToolUse.Name, Arguments: string(argsJSON)},
+			})
+		case block.ReasoningContent != nil && block.ReasoningContent.ReasoningText != nil:
+			reasoning.WriteString(block.ReasoningContent.ReasoningText.Text)
+		default:
+			content.WriteString(block.Text)
+		}
+	}
+	out.Content = content.String()
+	out.ReasoningContent = reasoning.String()
+
+	switch {
+	case len(out.ToolCalls) > 0 || resp.StopReason == "tool_use":
+		out.FinishReason = "tool_calls"
+	case resp.StopReason == "max_tokens":
+		out.FinishReason = "length"
+	}
+	if u := resp.Usage; u != nil {
+		out.Usage = &UsageInfo{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens, TotalTokens: u.TotalTokens}
+	}
+	return out, nil
+}
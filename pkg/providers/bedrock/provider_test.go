@@ -0,0 +1,94 @@
+package bedrockprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignV4 checks the get-vanilla case of the AWS SigV4 test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, hashHex(nil), creds, "us-east-1", "service", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestChat(t *testing.T) {
+	var path, auth string
+	var body converseRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"output":{"message":{"role":"assistant","content":[
+			{"text":"Let me check."},
+			{"toolUse":{"toolUseId":"tu_2","name":"weather","input":{"city":"Oslo"}}}
+		]}},"stopReason":"tool_use","usage":{"inputTokens":50,"outputTokens":10,"totalTokens":60}}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("eu-west-1", server.URL, "", "")
+	p.SetCredentials(Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	messages := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "weather?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "tu_1", Name: "location", Arguments: map[string]any{}}}},
+		{Role: "tool", ToolCallID: "tu_1", Content: "Oslo"},
+		{Role: "user", Content: "hurry"},
+	}
+	resp, err := p.Chat(t.Context(), messages, nil, "anthropic.claude-3-5-haiku-20241022-v1:0", map[string]any{"max_tokens": 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/model/anthropic.claude-3-5-haiku-20241022-v1%3A0/converse" {
+		t.Errorf("path = %q", path)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/bedrock/aws4_request") {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if len(body.System) != 1 || len(body.Messages) != 3 || len(body.Messages[2].Content) != 2 {
+		t.Fatalf("request = %+v", body)
+	}
+	if result := body.Messages[2].Content[0].ToolResult; result == nil || result.ToolUseID != "tu_1" {
+		t.Errorf("tool result = %+v", body.Messages[2].Content[0])
+	}
+	if body.InferenceConfig == nil || body.InferenceConfig.MaxTokens != 200 {
+		t.Errorf("inferenceConfig = %+v", body.InferenceConfig)
+	}
+
+	if resp.Content != "Let me check." || resp.FinishReason != "tool_calls" || resp.Usage.TotalTokens != 60 {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "tu_2" || resp.ToolCalls[0].Arguments["city"] != "Oslo" {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+}
+
+func TestChatWithAPIKey(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"output":{"message":{"role":"assistant","content":[{"text":"hi"}]}},"stopReason":"end_turn"}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("us-west-2", server.URL, "bedrock-key", "")
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "meta.llama3-1-8b-instruct-v1:0", nil); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer bedrock-key" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,15 @@
+package providers
+
+import (
+	bedrockprovider "github.com/sipeed/picoclaw/pkg/providers/bedrock"
+)
+
+// BedrockProvider runs models on Amazon Bedrock, signing requests with the
+// AWS credentials of the environment.
+type BedrockProvider struct {
+	*bedrockprovider.Provider
+}
+
+func NewBedrockProvider(region, endpoint, apiKey, proxy string) *BedrockProvider {
+	return &BedrockProvider{Provider: bedrockprovider.NewProvider(region, endpoint, apiKey, proxy)}
+}
@@ -23,6 +23,14 @@ func NewClaudeProviderWithBaseURL(token, apiBase string) *ClaudeProvider {
 	}
 }
 
+// NewClaudeProviderWithAPIKey creates a provider that calls the Messages API
+// with an API key.
+func NewClaudeProviderWithAPIKey(apiKey, apiBase, proxy string) *ClaudeProvider {
+	return &ClaudeProvider{
+		delegate: anthropicprovider.NewProviderWithAPIKey(apiKey, apiBase, proxy),
+	}
+}
+
 func NewClaudeProviderWithTokenSource(token string, tokenSource func() (string, error)) *ClaudeProvider {
 	return &ClaudeProvider{
 		delegate: anthropicprovider.NewProviderWithTokenSource(token, tokenSource),
@@ -51,6 +59,20 @@ func (p *ClaudeProvider) Chat(
 	return resp, nil
 }
 
+func (p *ClaudeProvider) ChatStream(
+	ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	return p.delegate.ChatStream(ctx, messages, tools, model, options, onDelta)
+}
+
+func (p *ClaudeProvider) ChatStreamTools(
+	ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]any,
+	onDelta func(delta string), onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	return p.delegate.ChatStreamTools(ctx, messages, tools, model, options, onDelta, onToolCall)
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return p.delegate.GetDefaultModel()
 }
@@ -43,6 +43,15 @@ var (
 		substr("context deadline exceeded"),
 	}
 
+	// The provider cannot be reached at all, e.g. while offline.
+	unreachablePatterns = []errorPattern{
+		substr("connection refused"),
+		substr("no such host"),
+		substr("network is unreachable"),
+		substr("no route to host"),
+		substr("connection reset by peer"),
+	}
+
 	billingPatterns = []errorPattern{
 		rxp(`\b402\b`),
 		substr("payment required"),
@@ -185,7 +194,7 @@ func classifyByMessage(msg string) FailoverReason {
 	if matchesAny(msg, billingPatterns) {
 		return FailoverBilling
 	}
-	if matchesAny(msg, timeoutPatterns) {
+	if matchesAny(msg, timeoutPatterns) || matchesAny(msg, unreachablePatterns) {
 		return FailoverTimeout
 	}
 	if matchesAny(msg, authPatterns) {
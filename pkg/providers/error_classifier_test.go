@@ -139,6 +139,9 @@ func TestClassifyError_TimeoutPatterns(t *testing.T) {
 		"connection timed out",
 		"deadline exceeded",
 		"context deadline exceeded",
+		`failed to send request: Post "https://api.openai.com/v1/chat/completions": dial tcp: lookup api.openai.com: no such host`,
+		"dial tcp 10.0.0.5:443: connect: network is unreachable",
+		"dial tcp 127.0.0.1:11434: connect: connection refused",
 	}
 
 	for _, msg := range patterns {
@@ -7,9 +7,11 @@ package providers
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers/openai_compat"
 )
 
 // createClaudeAuthProvider creates a Claude provider using OAuth credentials from auth store.
@@ -53,9 +55,26 @@ func ExtractProtocol(model string) (protocol, modelID string) {
 
 // CreateProviderFromConfig creates a provider based on the ModelConfig.
 // It uses the protocol prefix in the Model field to determine which provider to create.
-// Supported protocols: openai, anthropic, antigravity, claude-cli, codex-cli, github-copilot
+// Supported protocols: openai, anthropic, gemini, azure, bedrock, ollama, gguf, antigravity,
+// claude-cli, codex-cli, github-copilot
 // Returns the provider, the model ID (without protocol prefix), and any error.
+// With tool_mode "text", tools are offered in the prompt instead of the API.
+// While fixtures are in use, the provider records to or replays from them.
 func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, error) {
+	provider, modelID, err := createProviderFromConfig(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.ToolMode == "text" {
+		provider = WrapTextTools(provider)
+	}
+	if f := activeFixtures.Load(); f != nil {
+		provider = f.Wrap(provider)
+	}
+	return provider, modelID, nil
+}
+
+func createProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, error) {
 	if cfg == nil {
 		return nil, "", fmt.Errorf("config is nil")
 	}
@@ -84,10 +103,10 @@ func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, err
 		if apiBase == "" {
 			apiBase = getDefaultAPIBase(protocol)
 		}
-		return NewHTTPProviderWithMaxTokensField(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField), modelID, nil
+		return newOpenAICompatProvider(cfg, apiBase), modelID, nil
 
-	case "openrouter", "groq", "zhipu", "gemini", "nvidia",
-		"ollama", "moonshot", "shengsuanyun", "deepseek", "cerebras",
+	case "openrouter", "groq", "zhipu", "nvidia",
+		"moonshot", "shengsuanyun", "deepseek", "cerebras",
 		"volcengine", "vllm", "qwen", "mistral":
 		// All other OpenAI-compatible HTTP providers
 		if cfg.APIKey == "" && cfg.APIBase == "" {
@@ -97,7 +116,39 @@ func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, err
 		if apiBase == "" {
 			apiBase = getDefaultAPIBase(protocol)
 		}
-		return NewHTTPProviderWithMaxTokensField(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField), modelID, nil
+		return newOpenAICompatProvider(cfg, apiBase), modelID, nil
+
+	case "gemini":
+		// Native API; an api_base pointing at Google's OpenAI-compatible
+		// endpoint (.../v1beta/openai) keeps using that.
+		if strings.HasSuffix(strings.TrimRight(cfg.APIBase, "/"), "/openai") {
+			return NewHTTPProviderWithMaxTokensField(cfg.APIKey, cfg.APIBase, cfg.Proxy, cfg.MaxTokensField), modelID, nil
+		}
+		if cfg.APIKey == "" {
+			return nil, "", fmt.Errorf("api_key is required for gemini protocol (model: %s)", cfg.Model)
+		}
+		return NewGeminiProvider(cfg.APIKey, cfg.APIBase, cfg.Proxy, cfg.SafetySettings), modelID, nil
+
+	case "azure", "azure-openai":
+		// The model is the deployment name; api_base is the resource
+		// endpoint.
+		if cfg.APIBase == "" || cfg.APIKey == "" {
+			return nil, "", fmt.Errorf("api_base and api_key are required for azure protocol (model: %s)", cfg.Model)
+		}
+		return NewAzureOpenAIProvider(cfg.APIKey, cfg.APIBase, cfg.APIVersion, cfg.Proxy, cfg.MaxTokensField), modelID, nil
+
+	case "bedrock":
+		return NewBedrockProvider(cfg.Region, cfg.APIBase, cfg.APIKey, cfg.Proxy), modelID, nil
+
+	case "gguf":
+		// In-process llama.cpp; the model is a GGUF file, relative to the
+		// workspace's models directory.
+		return NewLlamaCppProvider(modelID, filepath.Join(cfg.Workspace, "models"), cfg.ContextWindow), modelID, nil
+
+	case "ollama":
+		// Native API; an api_base ending in /v1 (the OpenAI-compatible
+		// endpoint) is accepted too.
+		return NewOllamaProvider(cfg.APIBase, cfg.Proxy), modelID, nil
 
 	case "anthropic":
 		if cfg.AuthMethod == "oauth" || cfg.AuthMethod == "token" {
@@ -108,15 +159,11 @@ func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, err
 			}
 			return provider, modelID, nil
 		}
-		// Use API key with HTTP API
-		apiBase := cfg.APIBase
-		if apiBase == "" {
-			apiBase = "https://api.anthropic.com/v1"
-		}
+		// Use API key with the native Messages API
 		if cfg.APIKey == "" {
 			return nil, "", fmt.Errorf("api_key is required for anthropic protocol (model: %s)", cfg.Model)
 		}
-		return NewHTTPProviderWithMaxTokensField(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField), modelID, nil
+		return NewClaudeProviderWithAPIKey(cfg.APIKey, cfg.APIBase, cfg.Proxy), modelID, nil
 
 	case "antigravity":
 		return NewAntigravityProvider(), modelID, nil
@@ -156,6 +203,19 @@ func CreateProviderFromConfig(cfg *config.ModelConfig) (LLMProvider, string, err
 }
 
 // getDefaultAPIBase returns the default API base URL for a given protocol.
+// newOpenAICompatProvider creates the provider of an OpenAI-compatible API,
+// routed as the entry's openrouter settings say, if it has any.
+func newOpenAICompatProvider(cfg *config.ModelConfig, apiBase string) LLMProvider {
+	if settings := cfg.OpenRouter; settings != nil {
+		routing := openai_compat.OpenRouterRouting{Fallbacks: settings.Fallbacks}
+		if settings.Provider != nil { // a nil *OpenRouterProviderPrefs would be sent as null
+			routing.Provider = settings.Provider
+		}
+		return NewOpenRouterHTTPProvider(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField, routing)
+	}
+	return NewHTTPProviderWithMaxTokensField(cfg.APIKey, apiBase, cfg.Proxy, cfg.MaxTokensField)
+}
+
 func getDefaultAPIBase(protocol string) string {
 	switch protocol {
 	case "openai":
@@ -170,8 +230,6 @@ func getDefaultAPIBase(protocol string) string {
 		return "https://generativelanguage.googleapis.com/v1beta"
 	case "nvidia":
 		return "https://integrate.api.nvidia.com/v1"
-	case "ollama":
-		return "http://localhost:11434/v1"
 	case "moonshot":
 		return "https://api.moonshot.cn/v1"
 	case "shengsuanyun":
@@ -107,7 +107,6 @@ func TestCreateProviderFromConfig_DefaultAPIBase(t *testing.T) {
 		{"qwen", "qwen"},
 		{"vllm", "vllm"},
 		{"deepseek", "deepseek"},
-		{"ollama", "ollama"},
 	}
 
 	for _, tt := range tests {
@@ -148,6 +147,83 @@ func TestCreateProviderFromConfig_Anthropic(t *testing.T) {
 	if modelID != "claude-sonnet-4.6" {
 		t.Errorf("modelID = %q, want %q", modelID, "claude-sonnet-4.6")
 	}
+	if _, ok := provider.(*ClaudeProvider); !ok {
+		t.Errorf("expected the native *ClaudeProvider, got %T", provider)
+	}
+}
+
+func TestCreateProviderFromConfig_Ollama(t *testing.T) {
+	cfg := &config.ModelConfig{
+		ModelName: "llama3",
+		Model:     "ollama/llama3",
+		APIBase:   "http://localhost:11434/v1",
+	}
+
+	provider, modelID, err := CreateProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("CreateProviderFromConfig() error = %v", err)
+	}
+	ollama, ok := provider.(*OllamaProvider)
+	if !ok {
+		t.Fatalf("expected *OllamaProvider, got %T", provider)
+	}
+	if modelID != "llama3" || ollama.BaseURL() != "http://localhost:11434" {
+		t.Errorf("modelID = %q, base URL = %q", modelID, ollama.BaseURL())
+	}
+}
+
+func TestCreateProviderFromConfig_Gemini(t *testing.T) {
+	cfg := &config.ModelConfig{
+		ModelName: "gemini",
+		Model:     "gemini/gemini-2.5-flash",
+		APIKey:    "test-key",
+	}
+	provider, modelID, err := CreateProviderFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("CreateProviderFromConfig() error = %v", err)
+	}
+	if _, ok := provider.(*GeminiProvider); !ok || modelID != "gemini-2.5-flash" {
+		t.Errorf("got %T, model %q", provider, modelID)
+	}
+
+	cfg.APIBase = "https://generativelanguage.googleapis.com/v1beta/openai/"
+	if provider, _, _ = CreateProviderFromConfig(cfg); provider == nil {
+		t.Fatal("no provider for the OpenAI-compatible endpoint")
+	}
+	if _, ok := provider.(*HTTPProvider); !ok {
+		t.Errorf("expected *HTTPProvider for the OpenAI-compatible endpoint, got %T", provider)
+	}
+}
+
+func TestCreateProviderFromConfig_CloudPlatforms(t *testing.T) {
+	provider, modelID, err := CreateProviderFromConfig(&config.ModelConfig{
+		ModelName: "azure-gpt4o",
+		Model:     "azure/prod-gpt4o",
+		APIBase:   "https://example.openai.azure.com",
+		APIKey:    "key",
+	})
+	if err != nil {
+		t.Fatalf("azure: %v", err)
+	}
+	if _, ok := provider.(*HTTPProvider); !ok || modelID != "prod-gpt4o" {
+		t.Errorf("azure: got %T, model %q", provider, modelID)
+	}
+	if _, _, err := CreateProviderFromConfig(&config.ModelConfig{Model: "azure/prod-gpt4o", APIKey: "key"}); err == nil {
+		t.Error("azure without api_base should fail")
+	}
+
+	provider, modelID, err = CreateProviderFromConfig(&config.ModelConfig{
+		ModelName: "claude-bedrock",
+		Model:     "bedrock/anthropic.claude-3-5-haiku-20241022-v1:0",
+		Region:    "eu-central-1",
+	})
+	if err != nil {
+		t.Fatalf("bedrock: %v", err)
+	}
+	bedrock, ok := provider.(*BedrockProvider)
+	if !ok || modelID != "anthropic.claude-3-5-haiku-20241022-v1:0" || bedrock.Region() != "eu-central-1" {
+		t.Errorf("bedrock: got %T, model %q", provider, modelID)
+	}
 }
 
 func TestCreateProviderFromConfig_Antigravity(t *testing.T) {
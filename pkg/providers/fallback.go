@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 // FallbackChain orchestrates model fallback across multiple candidates.
@@ -16,6 +18,18 @@ type FallbackChain struct {
 type FallbackCandidate struct {
 	Provider string
 	Model    string
+	// Name is the model_list entry the candidate was configured as. Named
+	// candidates are routes with a provider and a cooldown of their own;
+	// others share the cooldown of their provider.
+	Name string
+}
+
+// route returns the key the candidate's cooldown is tracked under.
+func (c FallbackCandidate) route() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Provider
 }
 
 // FallbackResult contains the successful response and metadata about all attempts.
@@ -73,6 +87,57 @@ func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandid
 	return candidates
 }
 
+// ResolveRoutes turns the primary model and fallbacks of an agent into
+// candidates. Names of model_list entries become routes to a provider of
+// their own, created with CreateProviderFromConfig and keyed by
+// ModelKey, so a chain can fail over between APIs, e.g. from OpenRouter to
+// a local Ollama model. Other names are parsed as before and use the
+// agent's provider.
+func ResolveRoutes(cfg *config.Config, mc ModelConfig, defaultProvider string) ([]FallbackCandidate, map[string]LLMProvider) {
+	seen := make(map[string]bool)
+	var candidates []FallbackCandidate
+	routes := make(map[string]LLMProvider)
+
+	for _, raw := range append([]string{mc.Primary}, mc.Fallbacks...) {
+		raw = strings.TrimSpace(raw)
+		candidate, provider := resolveRoute(cfg, raw, defaultProvider)
+		if candidate == nil {
+			continue
+		}
+		key := ModelKey(candidate.Provider, candidate.Model)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, *candidate)
+		if provider != nil {
+			routes[key] = provider
+		}
+	}
+	return candidates, routes
+}
+
+func resolveRoute(cfg *config.Config, raw, defaultProvider string) (*FallbackCandidate, LLMProvider) {
+	if cfg != nil && raw != "" {
+		if entry, err := cfg.GetModelConfig(raw); err == nil {
+			own := *entry
+			if own.Workspace == "" {
+				own.Workspace = cfg.WorkspacePath()
+			}
+			provider, modelID, err := CreateProviderFromConfig(&own)
+			if err == nil {
+				protocol, _ := ExtractProtocol(own.Model)
+				return &FallbackCandidate{Provider: NormalizeProvider(protocol), Model: modelID, Name: raw}, provider
+			}
+		}
+	}
+	ref := ParseModelRef(raw, defaultProvider)
+	if ref == nil {
+		return nil, nil
+	}
+	return &FallbackCandidate{Provider: ref.Provider, Model: ref.Model}, nil
+}
+
 // Execute runs the fallback chain for text/chat requests.
 // It tries each candidate in order, respecting cooldowns and error classification.
 //
@@ -103,8 +168,9 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Check cooldown.
-		if !fc.cooldown.IsAvailable(candidate.Provider) {
-			remaining := fc.cooldown.CooldownRemaining(candidate.Provider)
+		route := candidate.route()
+		if !fc.cooldown.IsAvailable(route) {
+			remaining := fc.cooldown.CooldownRemaining(route)
 			result.Attempts = append(result.Attempts, FallbackAttempt{
 				Provider: candidate.Provider,
 				Model:    candidate.Model,
@@ -112,7 +178,7 @@ func (fc *FallbackChain) Execute(
 				Reason:   FailoverRateLimit,
 				Error: fmt.Errorf(
 					"provider %s in cooldown (%s remaining)",
-					candidate.Provider,
+					route,
 					remaining.Round(time.Second),
 				),
 			})
@@ -126,7 +192,7 @@ func (fc *FallbackChain) Execute(
 
 		if err == nil {
 			// Success.
-			fc.cooldown.MarkSuccess(candidate.Provider)
+			fc.cooldown.MarkSuccess(route)
 			result.Response = resp
 			result.Provider = candidate.Provider
 			result.Model = candidate.Model
@@ -172,7 +238,7 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Retriable error: mark failure and continue to next candidate.
-		fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		fc.cooldown.MarkFailure(route, failErr.Reason)
 		result.Attempts = append(result.Attempts, FallbackAttempt{
 			Provider: candidate.Provider,
 			Model:    candidate.Model,
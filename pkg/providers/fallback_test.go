@@ -5,6 +5,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 func makeCandidate(provider, model string) FallbackCandidate {
@@ -453,6 +455,63 @@ func TestResolveCandidates_EmptyPrimary(t *testing.T) {
 	}
 }
 
+func TestFallback_NamedRouteCooldown(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	// Two routes on the same protocol keep separate cooldowns.
+	candidates := []FallbackCandidate{
+		{Provider: "openai", Model: "gpt-4o", Name: "openrouter"},
+		{Provider: "openai", Model: "qwen2.5", Name: "lan"},
+	}
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		if model == "gpt-4o" {
+			return nil, errors.New("API request failed: status 502 Bad Gateway")
+		}
+		return &LLMResponse{Content: "local", FinishReason: "stop"}, nil
+	}
+
+	result, err := fc.Execute(context.Background(), candidates, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Model != "qwen2.5" || len(result.Attempts) != 1 || result.Attempts[0].Reason != FailoverTimeout {
+		t.Errorf("result = %+v", result)
+	}
+	if ct.IsAvailable("openrouter") || !ct.IsAvailable("lan") || !ct.IsAvailable("openai") {
+		t.Error("cooldown was not tracked per route")
+	}
+}
+
+func TestResolveRoutes(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.ModelList = []config.ModelConfig{
+		{ModelName: "cloud", Model: "openrouter/openai/gpt-4o", APIKey: "sk-test"},
+		{ModelName: "local", Model: "ollama/llama3.2"},
+	}
+
+	candidates, routes := ResolveRoutes(cfg, ModelConfig{
+		Primary:   "gpt-4o",
+		Fallbacks: []string{"cloud", "local", "anthropic/claude"},
+	}, "openrouter")
+
+	if len(candidates) != 4 {
+		t.Fatalf("candidates = %+v", candidates)
+	}
+	if candidates[0].Name != "" || candidates[3].Provider != "anthropic" || candidates[3].Name != "" {
+		t.Errorf("unnamed candidates = %+v", candidates)
+	}
+	if candidates[1].Name != "cloud" || candidates[2].Name != "local" || candidates[2].Provider != "ollama" {
+		t.Errorf("named candidates = %+v", candidates)
+	}
+	if _, ok := routes[ModelKey(candidates[2].Provider, candidates[2].Model)].(*OllamaProvider); !ok {
+		t.Errorf("local route = %T", routes[ModelKey(candidates[2].Provider, candidates[2].Model)])
+	}
+	if len(routes) != 2 {
+		t.Errorf("routes = %v", routes)
+	}
+}
+
 func TestFallbackExhaustedError_Message(t *testing.T) {
 	e := &FallbackExhaustedError{
 		Attempts: []FallbackAttempt{
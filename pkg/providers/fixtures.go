@@ -0,0 +1,265 @@
+package providers
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Fixture is one recorded LLM exchange: a line of a fixture file.
+type Fixture struct {
+	Key      string         `json:"key"`
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Tools    []string       `json:"tools,omitempty"` // names of the tools offered
+	Options  map[string]any `json:"options,omitempty"`
+	Response *LLMResponse   `json:"response,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// FixtureKey identifies a request in a fixture file by the model, the
+// conversation and the names of the tools offered. System messages are left
+// out: the system prompt carries the clock and the paths of the machine it
+// was recorded on.
+func FixtureKey(model string, messages []Message, tools []ToolDefinition) string {
+	conversation := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		if m.Role != "system" {
+			conversation = append(conversation, m)
+		}
+	}
+	data, _ := json.Marshal(struct {
+		Model    string    `json:"model"`
+		Messages []Message `json:"messages"`
+		Tools    []string  `json:"tools"`
+	}{model, conversation, toolNames(tools)})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func toolNames(tools []ToolDefinition) []string {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Function.Name)
+	}
+	return names
+}
+
+// Fixtures records LLM exchanges to a JSON Lines file, or answers requests
+// from one. In "record" mode every request goes to the provider and is
+// appended to the file; in "replay" mode requests are only answered from
+// the file; in "auto" mode recorded requests are replayed and the others
+// sent and recorded. A request recorded several times is answered with
+// its recordings in order, the last one repeating.
+type Fixtures struct {
+	mode string
+	path string
+
+	mu       sync.Mutex
+	recorded map[string][]*Fixture
+	used     map[string]int
+}
+
+// OpenFixtures opens the fixture file at path for mode. For replay the file
+// must exist.
+func OpenFixtures(mode, path string) (*Fixtures, error) {
+	f := &Fixtures{
+		mode:     mode,
+		path:     path,
+		recorded: make(map[string][]*Fixture),
+		used:     make(map[string]int),
+	}
+	switch mode {
+	case "record":
+	case "replay", "auto":
+		if err := f.load(); err != nil && (mode == "replay" || !errors.Is(err, os.ErrNotExist)) {
+			return nil, fmt.Errorf("fixtures: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("fixtures: unknown mode %q", mode)
+	}
+	if mode != "replay" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("fixtures: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func (f *Fixtures) load() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var fx Fixture
+		if err := json.Unmarshal(scanner.Bytes(), &fx); err != nil {
+			return fmt.Errorf("%s:%d: %w", f.path, line, err)
+		}
+		f.recorded[fx.Key] = append(f.recorded[fx.Key], &fx)
+	}
+	return scanner.Err()
+}
+
+// Mode returns "record", "replay" or "auto".
+func (f *Fixtures) Mode() string {
+	return f.mode
+}
+
+// Wrap returns p recording to or replaying from f.
+func (f *Fixtures) Wrap(p LLMProvider) LLMProvider {
+	if p == nil {
+		return nil
+	}
+	return &fixtureProvider{inner: p, fixtures: f}
+}
+
+// replay returns the next recording of key, if any.
+func (f *Fixtures) replay(key string) (*Fixture, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	recordings := f.recorded[key]
+	if len(recordings) == 0 {
+		return nil, false
+	}
+	i := min(f.used[key], len(recordings)-1)
+	f.used[key]++
+	return recordings[i], true
+}
+
+func (f *Fixtures) record(fx *Fixture) {
+	data, err := json.Marshal(fx)
+	if err != nil {
+		logger.WarnCF("provider", "Failed to encode fixture", map[string]any{"error": err.Error()})
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err == nil {
+		_, err = file.Write(append(data, '\n'))
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		logger.WarnCF("provider", "Failed to record fixture", map[string]any{"path": f.path, "error": err.Error()})
+		return
+	}
+	if f.mode == "auto" {
+		f.recorded[fx.Key] = append(f.recorded[fx.Key], fx)
+		f.used[fx.Key] = len(f.recorded[fx.Key])
+	}
+}
+
+// activeFixtures are the fixtures providers created from config use.
+var activeFixtures atomic.Pointer[Fixtures]
+
+// UseFixtures makes the providers created from config from now on record
+// to or replay from f. nil turns fixtures off again.
+func UseFixtures(f *Fixtures) {
+	activeFixtures.Store(f)
+}
+
+// fixtureProvider is a provider whose exchanges are recorded or replayed.
+type fixtureProvider struct {
+	inner    LLMProvider
+	fixtures *Fixtures
+}
+
+func (p *fixtureProvider) GetDefaultModel() string {
+	return p.inner.GetDefaultModel()
+}
+
+func (p *fixtureProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream passes a replayed answer to onDelta in one piece.
+func (p *fixtureProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	key := FixtureKey(model, messages, tools)
+	if p.fixtures.mode != "record" {
+		if fx, ok := p.fixtures.replay(key); ok {
+			if fx.Error != "" || fx.Response == nil {
+				return nil, errors.New(cmp.Or(fx.Error, "recorded request has no response"))
+			}
+			resp := *fx.Response
+			if onDelta != nil && resp.Content != "" {
+				onDelta(resp.Content)
+			}
+			return &resp, nil
+		}
+		if p.fixtures.mode == "replay" {
+			last := ""
+			if len(messages) > 0 {
+				last = messages[len(messages)-1].Content
+			}
+			return nil, fmt.Errorf("no recorded response in %s for this %s request (last message %q)",
+				p.fixtures.path, model, utils.Truncate(last, 80))
+		}
+	}
+
+	var resp *LLMResponse
+	var err error
+	if sp, ok := p.inner.(StreamingProvider); ok && onDelta != nil {
+		resp, err = sp.ChatStream(ctx, messages, tools, model, options, onDelta)
+	} else {
+		resp, err = p.inner.Chat(ctx, messages, tools, model, options)
+	}
+	// A cancelled request says nothing about the provider.
+	if ctx.Err() != nil {
+		return resp, err
+	}
+	fx := &Fixture{Key: key, Model: model, Messages: messages, Tools: toolNames(tools), Options: options, Response: resp}
+	if err != nil {
+		fx.Response, fx.Error = nil, err.Error()
+	}
+	p.fixtures.record(fx)
+	return resp, err
+}
+
+func (p *fixtureProvider) SupportsResponseSchema() bool {
+	sp, ok := p.inner.(ResponseSchemaProvider)
+	return ok && sp.SupportsResponseSchema()
+}
+
+func (p *fixtureProvider) Close() {
+	if sp, ok := p.inner.(StatefulProvider); ok {
+		sp.Close()
+	}
+}
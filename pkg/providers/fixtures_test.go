@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type countingProvider struct {
+	calls int
+	err   error
+}
+
+func (p *countingProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &LLMResponse{Content: "answer " + messages[len(messages)-1].Content, FinishReason: "stop"}, nil
+}
+
+func (p *countingProvider) GetDefaultModel() string { return "m" }
+
+func TestFixtures_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures", "llm.jsonl")
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "exec"}}}
+	ask := func(p LLMProvider, system, content string) (*LLMResponse, error) {
+		return p.Chat(t.Context(), []Message{
+			{Role: "system", Content: system},
+			{Role: "user", Content: content},
+		}, tools, "m", map[string]any{"max_tokens": 100})
+	}
+
+	rec, err := OpenFixtures("record", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingProvider{}
+	p := rec.Wrap(inner)
+	ask(p, "It is 9:00", "one")
+	ask(p, "It is 9:00", "two")
+	inner.err = errors.New("rate limited")
+	ask(p, "It is 9:00", "three")
+
+	replay, err := OpenFixtures("replay", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline := &countingProvider{}
+	p = replay.Wrap(offline)
+	// The system prompt, with its clock, does not matter.
+	if resp, err := ask(p, "It is 17:30", "two"); err != nil || resp.Content != "answer two" {
+		t.Errorf("replay two = %+v, %v", resp, err)
+	}
+	if _, err := ask(p, "It is 17:30", "three"); err == nil || err.Error() != "rate limited" {
+		t.Errorf("replay three error = %v", err)
+	}
+	if _, err := ask(p, "", "four"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("unrecorded request error = %v", err)
+	}
+	if offline.calls != 0 {
+		t.Errorf("replay called the provider %d times", offline.calls)
+	}
+
+	auto, err := OpenFixtures("auto", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = auto.Wrap(offline)
+	ask(p, "", "one")
+	ask(p, "", "four")
+	ask(p, "", "four")
+	if offline.calls != 1 {
+		t.Errorf("auto called the provider %d times, want 1", offline.calls)
+	}
+	data, _ := os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != 4 {
+		t.Errorf("fixture file has %d lines, want 4", n)
+	}
+}
+
+func TestFixtures_ReplayNeedsFile(t *testing.T) {
+	if _, err := OpenFixtures("replay", filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("replay without a fixture file succeeded")
+	}
+	if _, err := OpenFixtures("auto", filepath.Join(t.TempDir(), "missing.jsonl")); err != nil {
+		t.Errorf("auto without a fixture file: %v", err)
+	}
+}
+
+func TestCreateProviderFromConfig_UsesFixtures(t *testing.T) {
+	f, err := OpenFixtures("record", filepath.Join(t.TempDir(), "llm.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseFixtures(f)
+	defer UseFixtures(nil)
+
+	p, _, err := CreateProviderFromConfig(&config.ModelConfig{Model: "openai/gpt-4o", APIKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*fixtureProvider); !ok {
+		t.Errorf("provider is %T, want it wrapped", p)
+	}
+}
@@ -0,0 +1,515 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers/ratelimit"
+)
+
+const (
+	geminiDefaultAPIBase = "https://generativelanguage.googleapis.com/v1beta"
+	geminiDefaultModel   = "gemini-2.5-flash"
+	// geminiMaxInlineBytes is what the API takes as inline media in one
+	// request. Files beyond it are left out.
+	geminiMaxInlineBytes = 20 << 20
+)
+
+// GeminiProvider talks to the Google Gemini API (generateContent) natively,
+// which unlike its OpenAI-compatible endpoint takes images and audio inline
+// and has safety settings.
+type GeminiProvider struct {
+	apiKey     string
+	apiBase    string
+	safety     []geminiSafetySetting
+	httpClient *http.Client
+}
+
+// NewGeminiProvider creates a Gemini provider. safety maps harm categories
+// to block thresholds, either in the API's names (HARM_CATEGORY_HARASSMENT:
+// BLOCK_ONLY_HIGH) or short ones (harassment: only_high).
+func NewGeminiProvider(apiKey, apiBase, proxy string, safety map[string]string) *GeminiProvider {
+	client := &http.Client{Timeout: 120 * time.Second}
+	if proxy != "" {
+		if parsed, err := url.Parse(proxy); err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(parsed)}
+		} else {
+			logger.WarnCF("provider.gemini", "Invalid proxy URL",
+				map[string]any{"proxy": proxy, "error": err.Error()})
+		}
+	}
+	if apiBase == "" {
+		apiBase = geminiDefaultAPIBase
+	}
+	return &GeminiProvider{
+		apiKey:     apiKey,
+		apiBase:    strings.TrimRight(apiBase, "/"),
+		safety:     geminiSafetySettings(safety),
+		httpClient: client,
+	}
+}
+
+func (p *GeminiProvider) GetDefaultModel() string {
+	return geminiDefaultModel
+}
+
+// SupportsResponseSchema reports that Gemini takes a response schema in the
+// generation config.
+func (p *GeminiProvider) SupportsResponseSchema() bool {
+	return true
+}
+
+func (p *GeminiProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	return p.ChatStreamTools(ctx, messages, tools, model, options, nil, nil)
+}
+
+func (p *GeminiProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	return p.ChatStreamTools(ctx, messages, tools, model, options, onDelta, nil)
+}
+
+// ChatStreamTools streams the reply when either callback is set. Gemini
+// sends each function call whole, so onToolCall gets it as it arrives.
+func (p *GeminiProvider) ChatStreamTools(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+	onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	if model == "" {
+		model = geminiDefaultModel
+	}
+	body, err := json.Marshal(p.buildRequest(messages, tools, options))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	stream := onDelta != nil || onToolCall != nil
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", p.apiBase, strings.TrimPrefix(model, "models/"))
+	if stream {
+		endpoint = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse",
+			p.apiBase, strings.TrimPrefix(model, "models/"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := ratelimit.Default.Do(p.httpClient, req, ratelimit.Key(p.apiBase, model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(data))
+	}
+
+	var acc geminiAccumulator
+	if !stream {
+		var chunk geminiResponse
+		if err := json.NewDecoder(resp.Body).Decode(&chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		acc.add(chunk, nil, nil)
+		return acc.result()
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "data:")
+		if !ok {
+			continue
+		}
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		acc.add(chunk, onDelta, onToolCall)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return acc.result()
+}
+
+// --- Request building ---
+
+type geminiRequest struct {
+	Contents          []geminiContent       `json:"contents"`
+	SystemInstruction *geminiContent        `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool          `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenConfig      `json:"generationConfig,omitempty"`
+	SafetySettings    []geminiSafetySetting `json:"safetySettings,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFuncDecl `json:"functionDeclarations"`
+}
+
+type geminiFuncDecl struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type geminiGenConfig struct {
+	MaxOutputTokens  int            `json:"maxOutputTokens,omitempty"`
+	Temperature      *float64       `json:"temperature,omitempty"`
+	TopP             *float64       `json:"topP,omitempty"`
+	StopSequences    []string       `json:"stopSequences,omitempty"`
+	FrequencyPenalty *float64       `json:"frequencyPenalty,omitempty"`
+	PresencePenalty  *float64       `json:"presencePenalty,omitempty"`
+	Seed             *int           `json:"seed,omitempty"`
+	ResponseMimeType string         `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]any `json:"responseSchema,omitempty"`
+}
+
+type geminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+func (p *GeminiProvider) buildRequest(
+	messages []Message,
+	tools []ToolDefinition,
+	options map[string]any,
+) geminiRequest {
+	req := geminiRequest{SafetySettings: p.safety}
+	toolCallNames := make(map[string]string)
+	inlineBytes := 0
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if req.SystemInstruction == nil {
+				req.SystemInstruction = &geminiContent{}
+			}
+			req.SystemInstruction.Parts = append(req.SystemInstruction.Parts, geminiPart{Text: msg.Content})
+		case "assistant":
+			content := geminiContent{Role: "model"}
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				name, args, signature := normalizeStoredToolCall(tc)
+				if name == "" {
+					continue
+				}
+				if tc.ID != "" {
+					toolCallNames[tc.ID] = name
+				}
+				content.Parts = append(content.Parts, geminiPart{
+					ThoughtSignature: signature,
+					FunctionCall:     &geminiFunctionCall{Name: name, Args: args},
+				})
+			}
+			if len(content.Parts) > 0 {
+				req.Contents = append(req.Contents, content)
+			}
+		case "tool":
+			part := geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     resolveToolResponseName(msg.ToolCallID, toolCallNames),
+				Response: map[string]any{"result": msg.Content},
+			}}
+			// The results of parallel calls go together in one turn.
+			if n := len(req.Contents); n > 0 && isFunctionResponseTurn(req.Contents[n-1]) {
+				req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, part)
+			} else {
+				req.Contents = append(req.Contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+			}
+		default:
+			content := geminiContent{Role: "user"}
+			if msg.Content != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: msg.Content})
+			}
+			for _, path := range msg.Media {
+				blob, size, err := geminiInlineMedia(path, geminiMaxInlineBytes-inlineBytes)
+				if err != nil {
+					logger.WarnCF("provider.gemini", "Leaving out media",
+						map[string]any{"path": path, "error": err.Error()})
+					continue
+				}
+				inlineBytes += size
+				content.Parts = append(content.Parts, geminiPart{InlineData: blob})
+			}
+			if len(content.Parts) > 0 {
+				req.Contents = append(req.Contents, content)
+			}
+		}
+	}
+
+	var decls []geminiFuncDecl
+	for _, t := range tools {
+		if t.Type != "function" {
+			continue
+		}
+		decls = append(decls, geminiFuncDecl{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  sanitizeSchemaForGemini(t.Function.Parameters),
+		})
+	}
+	if len(decls) > 0 {
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+
+	config := &geminiGenConfig{}
+	if maxTokens, ok := options["max_tokens"].(int); ok && maxTokens > 0 {
+		config.MaxOutputTokens = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		config.Temperature = &temperature
+	}
+	if topP, ok := options["top_p"].(float64); ok {
+		config.TopP = &topP
+	}
+	if stop, ok := options["stop"].([]string); ok {
+		config.StopSequences = stop
+	}
+	if penalty, ok := options["frequency_penalty"].(float64); ok {
+		config.FrequencyPenalty = &penalty
+	}
+	if penalty, ok := options["presence_penalty"].(float64); ok {
+		config.PresencePenalty = &penalty
+	}
+	if seed, ok := options["seed"].(int); ok {
+		config.Seed = &seed
+	}
+	if schema, ok := options["response_schema"].(ResponseSchema); ok {
+		config.ResponseMimeType = "application/json"
+		config.ResponseSchema = sanitizeSchemaForGemini(schema.Schema)
+	}
+	// Gemini has no logit bias.
+	if config.MaxOutputTokens > 0 || config.Temperature != nil || config.TopP != nil ||
+		config.StopSequences != nil || config.FrequencyPenalty != nil || config.PresencePenalty != nil ||
+		config.Seed != nil || config.ResponseMimeType != "" {
+		req.GenerationConfig = config
+	}
+	return req
+}
+
+func isFunctionResponseTurn(c geminiContent) bool {
+	if c.Role != "user" || len(c.Parts) == 0 {
+		return false
+	}
+	for _, part := range c.Parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// geminiInlineMedia reads an image, audio, video or PDF file for sending
+// inline, if it is at most limit bytes.
+func geminiInlineMedia(path string, limit int) (*geminiBlob, int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() > int64(limit) {
+		return nil, 0, fmt.Errorf("%d bytes exceed the %d bytes left for inline media", info.Size(), limit)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(filepath.Ext(path))))
+	if mimeType == "" {
+		mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	kind, _, _ := strings.Cut(mimeType, "/")
+	if kind != "image" && kind != "audio" && kind != "video" && mimeType != "application/pdf" {
+		return nil, 0, fmt.Errorf("unsupported media type %q", mimeType)
+	}
+	return &geminiBlob{MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(data)}, len(data), nil
+}
+
+// geminiSafetySettings converts the configured thresholds, sorted by
+// category so requests stay the same from one call to the next.
+func geminiSafetySettings(safety map[string]string) []geminiSafetySetting {
+	settings := make([]geminiSafetySetting, 0, len(safety))
+	for category, threshold := range safety {
+		category = strings.ToUpper(strings.TrimSpace(category))
+		if !strings.HasPrefix(category, "HARM_CATEGORY_") {
+			category = "HARM_CATEGORY_" + category
+		}
+		threshold = strings.ToUpper(strings.TrimSpace(threshold))
+		if threshold != "OFF" && !strings.HasPrefix(threshold, "BLOCK_") && !strings.HasPrefix(threshold, "HARM_") {
+			threshold = "BLOCK_" + threshold
+		}
+		settings = append(settings, geminiSafetySetting{Category: category, Threshold: threshold})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Category < settings[j].Category })
+	return settings
+}
+
+// --- Response parsing ---
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// geminiAccumulator builds the response from one reply or the chunks of a
+// streamed one.
+type geminiAccumulator struct {
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []ToolCall
+	finishReason string
+	blockReason  string
+	usage        *UsageInfo
+}
+
+func (a *geminiAccumulator) add(chunk geminiResponse, onDelta func(string), onToolCall func(ToolCall)) {
+	if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+		a.blockReason = chunk.PromptFeedback.BlockReason
+	}
+	if len(chunk.Candidates) > 0 {
+		candidate := chunk.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				args := part.FunctionCall.Args
+				if args == nil {
+					args = map[string]any{}
+				}
+				argsJSON, _ := json.Marshal(args)
+				tc := ToolCall{
+					ID:        fmt.Sprintf("call_%s_%d", part.FunctionCall.Name, len(a.toolCalls)),
+					Type:      "function",
+					Name:      part.FunctionCall.Name,
+					Arguments: args,
+					Function: &FunctionCall{
+						Name:             part.FunctionCall.Name,
+						Arguments:        string(argsJSON),
+						ThoughtSignature: part.ThoughtSignature,
+					},
+				}
+				a.toolCalls = append(a.toolCalls, tc)
+				if onToolCall != nil {
+					onToolCall(tc)
+				}
+			case part.Thought:
+				a.reasoning.WriteString(part.Text)
+			case part.Text != "":
+				a.content.WriteString(part.Text)
+				if onDelta != nil {
+					onDelta(part.Text)
+				}
+			}
+		}
+		if candidate.FinishReason != "" {
+			a.finishReason = candidate.FinishReason
+		}
+	}
+	if u := chunk.UsageMetadata; u != nil && u.TotalTokenCount > 0 {
+		a.usage = &UsageInfo{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount, // thoughts are billed as output
+			TotalTokens:      u.TotalTokenCount,
+			ReasoningTokens:  u.ThoughtsTokenCount,
+		}
+	}
+}
+
+func (a *geminiAccumulator) result() (*LLMResponse, error) {
+	if a.blockReason != "" {
+		return nil, fmt.Errorf("gemini: the prompt was blocked (%s)", a.blockReason)
+	}
+	if a.content.Len() == 0 && len(a.toolCalls) == 0 {
+		switch a.finishReason {
+		case "SAFETY", "PROHIBITED_CONTENT", "BLOCKLIST", "SPII", "RECITATION":
+			return nil, fmt.Errorf("gemini: the answer was blocked (%s)", a.finishReason)
+		}
+	}
+
+	finishReason := "stop"
+	switch {
+	case len(a.toolCalls) > 0:
+		finishReason = "tool_calls"
+	case a.finishReason == "MAX_TOKENS":
+		finishReason = "length"
+	}
+	return &LLMResponse{
+		Content:          a.content.String(),
+		ReasoningContent: a.reasoning.String(),
+		ToolCalls:        a.toolCalls,
+		FinishReason:     finishReason,
+		Usage:            a.usage,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeminiProvider_Chat(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "cat.png")
+	if err := os.WriteFile(image, []byte("\x89PNG\r\n\x1a\nfake"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var path, key string
+	var body geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.Path, r.Header.Get("x-goog-api-key")
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[
+			{"text":"Looking","thought":true},
+			{"text":"A cat. "},
+			{"functionCall":{"name":"save","args":{"tag":"cat"}},"thoughtSignature":"sig"}
+		]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":300,"candidatesTokenCount":20,"thoughtsTokenCount":50,"totalTokenCount":370}}`)
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("key", server.URL, "", map[string]string{
+		"harassment":                "only_high",
+		"HARM_CATEGORY_HATE_SPEECH": "BLOCK_NONE",
+	})
+	messages := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "what is this?", Media: []string{image}},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "a", Name: "look", Arguments: map[string]any{}},
+			{ID: "b", Name: "zoom", Arguments: map[string]any{"x": 2.0}},
+		}},
+		{Role: "tool", ToolCallID: "a", Content: "furry"},
+		{Role: "tool", ToolCallID: "b", Content: "whiskers"},
+	}
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{
+		Name:       "save",
+		Parameters: map[string]any{"type": "object", "additionalProperties": false},
+	}}}
+	resp, err := p.Chat(t.Context(), messages, tools, "gemini-2.5-flash", map[string]any{
+		"max_tokens": 100, "temperature": 0.0, "top_p": 0.8, "stop": []string{"END"},
+		"logit_bias": map[string]float64{"1": 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/models/gemini-2.5-flash:generateContent" || key != "key" {
+		t.Errorf("path = %q, key = %q", path, key)
+	}
+	if body.SystemInstruction == nil || body.SystemInstruction.Parts[0].Text != "be brief" {
+		t.Errorf("systemInstruction = %+v", body.SystemInstruction)
+	}
+	if len(body.Contents) != 3 {
+		t.Fatalf("contents = %+v", body.Contents)
+	}
+	user := body.Contents[0]
+	if len(user.Parts) != 2 || user.Parts[1].InlineData == nil || user.Parts[1].InlineData.MimeType != "image/png" {
+		t.Errorf("user turn = %+v", user)
+	}
+	if results := body.Contents[2].Parts; len(results) != 2 || results[1].FunctionResponse.Name != "zoom" {
+		t.Errorf("tool results are not one turn: %+v", body.Contents[2])
+	}
+	if _, ok := body.Tools[0].FunctionDeclarations[0].Parameters["additionalProperties"]; ok {
+		t.Error("tool schema was not sanitized")
+	}
+	if c := body.GenerationConfig; c == nil || c.MaxOutputTokens != 100 || c.Temperature == nil || *c.Temperature != 0 ||
+		c.TopP == nil || *c.TopP != 0.8 || len(c.StopSequences) != 1 {
+		t.Errorf("generationConfig = %+v", c)
+	}
+	wantSafety := []geminiSafetySetting{
+		{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_ONLY_HIGH"},
+		{Category: "HARM_CATEGORY_HATE_SPEECH", Threshold: "BLOCK_NONE"},
+	}
+	if fmt.Sprint(body.SafetySettings) != fmt.Sprint(wantSafety) {
+		t.Errorf("safetySettings = %v", body.SafetySettings)
+	}
+
+	if resp.Content != "A cat. " || resp.ReasoningContent != "Looking" || resp.FinishReason != "tool_calls" {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "save" || resp.ToolCalls[0].Function.ThoughtSignature != "sig" {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if u := resp.Usage; u == nil || u.PromptTokens != 300 || u.CompletionTokens != 70 || u.ReasoningTokens != 50 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestGeminiProvider_ChatStreamTools(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "alt=sse" {
+			t.Errorf("query = %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Checking\"}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"functionCall\":{\"name\":\"clock\"}}]},"+
+			"\"finishReason\":\"STOP\"}]}\n\n")
+	}))
+	defer server.Close()
+
+	var deltas []string
+	var calls []ToolCall
+	p := NewGeminiProvider("key", server.URL, "", nil)
+	resp, err := p.ChatStreamTools(t.Context(), []Message{{Role: "user", Content: "time?"}}, nil, "gemini-2.5-flash", nil,
+		func(d string) { deltas = append(deltas, d) },
+		func(tc ToolCall) { calls = append(calls, tc) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(deltas, "") != "Checking" || len(calls) != 1 || calls[0].Name != "clock" {
+		t.Errorf("deltas = %q, calls = %+v", deltas, calls)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != calls[0].ID {
+		t.Errorf("response tool calls = %+v", resp.ToolCalls)
+	}
+}
+
+func TestGeminiProvider_Blocked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"candidates":[{"finishReason":"SAFETY"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("key", server.URL, "", nil)
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "m", nil); err == nil ||
+		!strings.Contains(err.Error(), "SAFETY") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -28,6 +28,25 @@ func NewHTTPProviderWithMaxTokensField(apiKey, apiBase, proxy, maxTokensField st
 	}
 }
 
+// NewAzureOpenAIProvider creates a provider for an Azure OpenAI resource,
+// which is addressed by deployment name instead of model.
+func NewAzureOpenAIProvider(apiKey, endpoint, apiVersion, proxy, maxTokensField string) *HTTPProvider {
+	return &HTTPProvider{
+		delegate: openai_compat.NewAzureProvider(apiKey, endpoint, apiVersion, proxy, maxTokensField),
+	}
+}
+
+// NewOpenRouterHTTPProvider creates a provider for OpenRouter with provider
+// preferences and fallback models.
+func NewOpenRouterHTTPProvider(
+	apiKey, apiBase, proxy, maxTokensField string,
+	routing openai_compat.OpenRouterRouting,
+) *HTTPProvider {
+	return &HTTPProvider{
+		delegate: openai_compat.NewOpenRouterProvider(apiKey, apiBase, proxy, maxTokensField, routing),
+	}
+}
+
 func (p *HTTPProvider) Chat(
 	ctx context.Context,
 	messages []Message,
@@ -38,6 +57,35 @@ func (p *HTTPProvider) Chat(
 	return p.delegate.Chat(ctx, messages, tools, model, options)
 }
 
+func (p *HTTPProvider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	return p.delegate.ChatStream(ctx, messages, tools, model, options, onDelta)
+}
+
+func (p *HTTPProvider) ChatStreamTools(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+	onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	return p.delegate.ChatStreamTools(ctx, messages, tools, model, options, onDelta, onToolCall)
+}
+
+// SupportsResponseSchema reports that OpenAI-compatible APIs take a JSON
+// schema as response_format.
+func (p *HTTPProvider) SupportsResponseSchema() bool {
+	return true
+}
+
 func (p *HTTPProvider) GetDefaultModel() string {
 	return ""
 }
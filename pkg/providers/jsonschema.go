@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// validateSchema checks v, as decoded by encoding/json, against the subset
+// of JSON Schema that tool parameters and response schemas use: type,
+// properties, required, additionalProperties, items, enum, minItems and
+// maxItems. It returns every violation found, one per line.
+func validateSchema(schema map[string]any, v any) error {
+	var problems []string
+	checkSchema(schema, v, "$", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "\n"))
+}
+
+func checkSchema(schema map[string]any, v any, path string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool {
+		return hasJSONType(v, t)
+	}) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(v)))
+		return
+	}
+	if enum := schemaEnum(schema["enum"]); enum != nil && !slices.ContainsFunc(enum, func(e any) bool {
+		return reflect.DeepEqual(e, v)
+	}) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not one of %v", path, v, enum))
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := val[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required property %q", path, name))
+			}
+		}
+		names := make([]string, 0, len(val))
+		for name := range val {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sub, ok := props[name].(map[string]any); ok {
+				checkSchema(sub, val[name], path+"."+name, problems)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				*problems = append(*problems, fmt.Sprintf("%s: unexpected property %q", path, name))
+			}
+		}
+	case []any:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(val)) < n {
+			*problems = append(*problems, fmt.Sprintf("%s: expected at least %v items, got %d", path, n, len(val)))
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(val)) > n {
+			*problems = append(*problems, fmt.Sprintf("%s: expected at most %v items, got %d", path, n, len(val)))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				checkSchema(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+func hasJSONType(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true // unknown types are not checked
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// schemaTypes reads "type", which is a string or a list of strings.
+func schemaTypes(v any) []string {
+	if t, ok := v.(string); ok {
+		return []string{t}
+	}
+	return schemaStrings(v)
+}
+
+// schemaStrings reads a list of strings, from Go code ([]string) or from
+// decoded JSON ([]any).
+func schemaStrings(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func schemaEnum(v any) []any {
+	switch list := v.(type) {
+	case []any:
+		return list
+	case []string:
+		out := make([]any, len(list))
+		for i, s := range list {
+			out[i] = s
+		}
+		return out
+	}
+	return nil
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -7,8 +7,10 @@ package providers
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 // CreateProvider creates a provider based on the configuration.
@@ -34,6 +36,10 @@ func CreateProvider(cfg *config.Config) (LLMProvider, string, error) {
 		return nil, "", fmt.Errorf("model %q not found in model_list: %w", model, err)
 	}
 
+	if err := useConfigFixtures(cfg); err != nil {
+		return nil, "", err
+	}
+
 	// Inject global workspace if not set in model config
 	if modelCfg.Workspace == "" {
 		modelCfg.Workspace = cfg.WorkspacePath()
@@ -47,3 +53,24 @@ func CreateProvider(cfg *config.Config) (LLMProvider, string, error) {
 
 	return provider, modelID, nil
 }
+
+// useConfigFixtures turns on the fixtures configured in cfg, for all
+// providers created from here on.
+func useConfigFixtures(cfg *config.Config) error {
+	mode := cfg.Fixtures.Mode
+	if mode == "" {
+		UseFixtures(nil)
+		return nil
+	}
+	path := cfg.Fixtures.Path
+	if path == "" {
+		path = filepath.Join(cfg.WorkspacePath(), "fixtures", "llm.jsonl")
+	}
+	f, err := OpenFixtures(mode, path)
+	if err != nil {
+		return err
+	}
+	UseFixtures(f)
+	logger.InfoCF("provider", "LLM fixtures in use", map[string]any{"mode": mode, "path": path})
+	return nil
+}
@@ -0,0 +1,188 @@
+//go:build llamacpp && cgo
+
+package llamacppprovider
+
+/*
+#cgo LDFLAGS: -lllama
+#include <stdlib.h>
+#include <llama.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+)
+
+var backendOnce sync.Once
+
+type llamaEngine struct {
+	model   *C.struct_llama_model
+	vocab   *C.struct_llama_vocab
+	tmpl    *C.char // the model's chat template, nil for chatml
+	nCtx    int
+	threads int
+}
+
+func loadModel(path string, contextWindow, threads int) (engine, error) {
+	backendOnce.Do(func() { C.llama_backend_init() })
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	model := C.llama_model_load_from_file(cpath, C.llama_model_default_params())
+	if model == nil {
+		return nil, fmt.Errorf("llama.cpp could not load %s", path)
+	}
+	return &llamaEngine{
+		model:   model,
+		vocab:   C.llama_model_get_vocab(model),
+		tmpl:    C.llama_model_chat_template(model, nil),
+		nCtx:    contextWindow,
+		threads: threads,
+	}, nil
+}
+
+func (e *llamaEngine) close() {
+	C.llama_model_free(e.model)
+}
+
+func (e *llamaEngine) generate(
+	ctx context.Context,
+	messages []chatMessage,
+	maxTokens int,
+	temperature float64,
+	onText func(string),
+) (int, int, bool, error) {
+	prompt, err := e.applyTemplate(messages)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	tokens, nPrompt, err := e.tokenize(prompt)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer C.free(unsafe.Pointer(tokens))
+	if nPrompt >= e.nCtx {
+		return 0, 0, false, fmt.Errorf("prompt of %d tokens exceeds the context window of %d", nPrompt, e.nCtx)
+	}
+
+	// A fresh context per request: the model stays loaded, and no cache
+	// from another conversation is carried over.
+	params := C.llama_context_default_params()
+	params.n_ctx = C.uint32_t(e.nCtx)
+	params.n_batch = C.uint32_t(e.nCtx)
+	params.n_threads = C.int32_t(e.threads)
+	params.n_threads_batch = C.int32_t(e.threads)
+	lctx := C.llama_init_from_model(e.model, params)
+	if lctx == nil {
+		return 0, 0, false, fmt.Errorf("llama.cpp could not create a context of %d tokens", e.nCtx)
+	}
+	defer C.llama_free(lctx)
+
+	sampler := C.llama_sampler_chain_init(C.llama_sampler_chain_default_params())
+	defer C.llama_sampler_free(sampler)
+	if temperature <= 0 {
+		C.llama_sampler_chain_add(sampler, C.llama_sampler_init_greedy())
+	} else {
+		C.llama_sampler_chain_add(sampler, C.llama_sampler_init_min_p(0.05, 1))
+		C.llama_sampler_chain_add(sampler, C.llama_sampler_init_temp(C.float(temperature)))
+		C.llama_sampler_chain_add(sampler, C.llama_sampler_init_dist(C.LLAMA_DEFAULT_SEED))
+	}
+
+	next := (*C.llama_token)(C.malloc(C.size_t(unsafe.Sizeof(C.llama_token(0)))))
+	defer C.free(unsafe.Pointer(next))
+	piece := (*C.char)(C.malloc(256))
+	defer C.free(unsafe.Pointer(piece))
+
+	batch := C.llama_batch_get_one(tokens, C.int32_t(nPrompt))
+	var pending []byte
+	completion := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nPrompt, completion, false, err
+		}
+		if C.llama_decode(lctx, batch) != 0 {
+			return nPrompt, completion, false, fmt.Errorf("llama.cpp failed to decode")
+		}
+		tok := C.llama_sampler_sample(sampler, lctx, -1)
+		if C.llama_vocab_is_eog(e.vocab, tok) {
+			break
+		}
+		completion++
+		n := C.llama_token_to_piece(e.vocab, tok, piece, 256, 0, false)
+		if n > 0 {
+			// Pieces can end inside a UTF-8 sequence.
+			pending = append(pending, C.GoBytes(unsafe.Pointer(piece), n)...)
+			if utf8.Valid(pending) {
+				onText(string(pending))
+				pending = pending[:0]
+			}
+		}
+		if completion >= maxTokens || nPrompt+completion >= e.nCtx {
+			return nPrompt, completion, true, nil
+		}
+		*next = tok
+		batch = C.llama_batch_get_one(next, 1)
+	}
+	return nPrompt, completion, false, nil
+}
+
+// applyTemplate formats the conversation with the model's chat template.
+func (e *llamaEngine) applyTemplate(messages []chatMessage) (string, error) {
+	n := len(messages)
+	if n == 0 {
+		return "", fmt.Errorf("no messages to answer")
+	}
+	chat := unsafe.Slice((*C.struct_llama_chat_message)(
+		C.malloc(C.size_t(n)*C.size_t(unsafe.Sizeof(C.struct_llama_chat_message{})))), n)
+	defer C.free(unsafe.Pointer(&chat[0]))
+	size := 1024
+	for i, msg := range messages {
+		chat[i].role = C.CString(msg.Role)
+		chat[i].content = C.CString(msg.Content)
+		size += 2 * (len(msg.Role) + len(msg.Content))
+	}
+	defer func() {
+		for i := range chat {
+			C.free(unsafe.Pointer(chat[i].role))
+			C.free(unsafe.Pointer(chat[i].content))
+		}
+	}()
+
+	for {
+		buf := (*C.char)(C.malloc(C.size_t(size)))
+		written := int(C.llama_chat_apply_template(e.tmpl, &chat[0], C.size_t(n), true, buf, C.int32_t(size)))
+		if written < 0 {
+			C.free(unsafe.Pointer(buf))
+			return "", fmt.Errorf("llama.cpp does not support the model's chat template")
+		}
+		if written <= size {
+			prompt := C.GoStringN(buf, C.int(written))
+			C.free(unsafe.Pointer(buf))
+			return prompt, nil
+		}
+		C.free(unsafe.Pointer(buf))
+		size = written
+	}
+}
+
+// tokenize returns the prompt's tokens in C memory, which the caller
+// frees.
+func (e *llamaEngine) tokenize(text string) (*C.llama_token, int, error) {
+	ctext := C.CString(text)
+	defer C.free(unsafe.Pointer(ctext))
+	need := -int(C.llama_tokenize(e.vocab, ctext, C.int32_t(len(text)), nil, 0, true, true))
+	if need <= 0 {
+		return nil, 0, fmt.Errorf("llama.cpp could not tokenize the prompt")
+	}
+	tokens := (*C.llama_token)(C.malloc(C.size_t(need) * C.size_t(unsafe.Sizeof(C.llama_token(0)))))
+	n := int(C.llama_tokenize(e.vocab, ctext, C.int32_t(len(text)), tokens, C.int32_t(need), true, true))
+	if n < 0 {
+		C.free(unsafe.Pointer(tokens))
+		return nil, 0, fmt.Errorf("llama.cpp could not tokenize the prompt")
+	}
+	return tokens, n, nil
+}
@@ -0,0 +1,7 @@
+//go:build !llamacpp || !cgo
+
+package llamacppprovider
+
+func loadModel(path string, contextWindow, threads int) (engine, error) {
+	return nil, ErrNotBuilt
+}
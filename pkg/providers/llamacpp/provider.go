@@ -0,0 +1,197 @@
+// Package llamacppprovider runs GGUF models inside the picoclaw process with
+// llama.cpp, so small models answer without any network. The bindings are
+// only compiled with the llamacpp build tag, as they need cgo and an
+// installed libllama:
+//
+//	CGO_CFLAGS="-I/usr/local/include" CGO_LDFLAGS="-L/usr/local/lib" \
+//	    go build -tags llamacpp ./cmd/picoclaw
+//
+// Without the tag the provider is still available but reports that it was
+// not built in.
+package llamacppprovider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+type (
+	ToolCall       = protocoltypes.ToolCall
+	LLMResponse    = protocoltypes.LLMResponse
+	UsageInfo      = protocoltypes.UsageInfo
+	Message        = protocoltypes.Message
+	ToolDefinition = protocoltypes.ToolDefinition
+)
+
+const (
+	DefaultContextWindow = 4096
+	defaultMaxTokens     = 512
+)
+
+// ErrNotBuilt is returned by providers of a binary built without the
+// llamacpp tag.
+var ErrNotBuilt = fmt.Errorf("llama.cpp support is not built in; rebuild picoclaw with -tags llamacpp")
+
+// chatMessage is a turn in the form chat templates take.
+type chatMessage struct {
+	Role    string
+	Content string
+}
+
+// engine is a loaded model.
+type engine interface {
+	// generate continues the conversation, passing each piece of text to
+	// onText. It returns the prompt and completion token counts and
+	// whether generation stopped at maxTokens or the context size.
+	generate(
+		ctx context.Context,
+		messages []chatMessage,
+		maxTokens int,
+		temperature float64,
+		onText func(string),
+	) (prompt, completion int, truncated bool, err error)
+	close()
+}
+
+// Provider answers with a GGUF model loaded on first use. Requests run one
+// at a time, since a single one already uses every core.
+type Provider struct {
+	path          string
+	contextWindow int
+
+	mu     sync.Mutex
+	engine engine
+}
+
+// NewProvider creates a provider for the GGUF file at path. Relative paths
+// are resolved against dir.
+func NewProvider(path, dir string, contextWindow int) *Provider {
+	if !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+	if contextWindow <= 0 {
+		contextWindow = DefaultContextWindow
+	}
+	return &Provider{path: path, contextWindow: contextWindow}
+}
+
+func (p *Provider) Path() string {
+	return p.path
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return filepath.Base(p.path)
+}
+
+func (p *Provider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream generates the answer, passing it to onDelta as it is written.
+// Tools are not offered: the small models this is meant for answer from
+// the conversation alone.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.engine == nil {
+		if _, err := os.Stat(p.path); err != nil {
+			return nil, fmt.Errorf("llama.cpp model: %w", err)
+		}
+		e, err := loadModel(p.path, p.contextWindow, runtime.NumCPU())
+		if err != nil {
+			return nil, err
+		}
+		p.engine = e
+	}
+
+	maxTokens := defaultMaxTokens
+	if n, ok := options["max_tokens"].(int); ok && n > 0 {
+		maxTokens = n
+	}
+	temperature := 0.7
+	if t, ok := options["temperature"].(float64); ok {
+		temperature = t
+	}
+
+	var out strings.Builder
+	prompt, completion, truncated, err := p.engine.generate(ctx, chatMessages(messages), maxTokens, temperature,
+		func(text string) {
+			out.WriteString(text)
+			if onDelta != nil {
+				onDelta(text)
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+	finishReason := "stop"
+	if truncated {
+		finishReason = "length"
+	}
+	return &LLMResponse{
+		Content:      strings.TrimSpace(out.String()),
+		FinishReason: finishReason,
+		Usage: &UsageInfo{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		},
+	}, nil
+}
+
+// Close unloads the model.
+func (p *Provider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.engine != nil {
+		p.engine.close()
+		p.engine = nil
+	}
+}
+
+// chatMessages turns the conversation into plain turns. Tool calls and
+// results from earlier turns, made with another model, become text.
+func chatMessages(messages []Message) []chatMessage {
+	out := make([]chatMessage, 0, len(messages))
+	for _, msg := range messages {
+		switch msg.Role {
+		case "assistant":
+			content := msg.Content
+			for _, tc := range msg.ToolCalls {
+				name := tc.Name
+				if name == "" && tc.Function != nil {
+					name = tc.Function.Name
+				}
+				content += fmt.Sprintf("\n[called tool %s]", name)
+			}
+			if content = strings.TrimSpace(content); content != "" {
+				out = append(out, chatMessage{Role: "assistant", Content: content})
+			}
+		case "tool":
+			out = append(out, chatMessage{Role: "user", Content: "[tool result]\n" + msg.Content})
+		default:
+			out = append(out, chatMessage{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+package llamacppprovider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChatMessages(t *testing.T) {
+	got := chatMessages([]Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "time?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{Name: "clock"}}},
+		{Role: "tool", Content: "12:00"},
+	})
+	want := []chatMessage{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "time?"},
+		{Role: "assistant", Content: "[called tool clock]"},
+		{Role: "user", Content: "[tool result]\n12:00"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chatMessages() = %+v", got)
+	}
+}
+
+func TestChatMissingModel(t *testing.T) {
+	dir := t.TempDir()
+	p := NewProvider("tiny.gguf", dir, 0)
+	if p.Path() != filepath.Join(dir, "tiny.gguf") {
+		t.Errorf("Path() = %q", p.Path())
+	}
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "", nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want a missing file", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !llamacpp || !cgo
+
+package llamacppprovider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChatNotBuilt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiny.gguf")
+	os.WriteFile(path, []byte("GGUF"), 0o644)
+	if _, err := NewProvider(path, "", 0).Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "", nil); !errors.Is(err, ErrNotBuilt) {
+		t.Errorf("err = %v, want ErrNotBuilt", err)
+	}
+}
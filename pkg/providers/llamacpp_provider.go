@@ -0,0 +1,15 @@
+package providers
+
+import (
+	llamacppprovider "github.com/sipeed/picoclaw/pkg/providers/llamacpp"
+)
+
+// LlamaCppProvider runs a GGUF model inside the process, for answers
+// without any network. It needs a binary built with the llamacpp tag.
+type LlamaCppProvider struct {
+	*llamacppprovider.Provider
+}
+
+func NewLlamaCppProvider(path, dir string, contextWindow int) *LlamaCppProvider {
+	return &LlamaCppProvider{Provider: llamacppprovider.NewProvider(path, dir, contextWindow)}
+}
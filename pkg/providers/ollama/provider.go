@@ -0,0 +1,465 @@
+package ollamaprovider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+type (
+	ToolCall       = protocoltypes.ToolCall
+	LLMResponse    = protocoltypes.LLMResponse
+	UsageInfo      = protocoltypes.UsageInfo
+	Message        = protocoltypes.Message
+	ToolDefinition = protocoltypes.ToolDefinition
+	ResponseSchema = protocoltypes.ResponseSchema
+)
+
+const DefaultBaseURL = "http://localhost:11434"
+
+// Provider talks to an Ollama server with its native API, which unlike the
+// OpenAI-compatible endpoint also manages models and computes embeddings.
+type Provider struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu sync.Mutex
+	// noTools lists models the server refused tools for. They are asked
+	// again without tools, and the agent answers from the text alone.
+	noTools map[string]bool
+}
+
+// ModelInfo describes a model available on the server.
+type ModelInfo struct {
+	Name          string
+	Size          int64
+	ParameterSize string
+	Quantization  string
+	ModifiedAt    time.Time
+}
+
+// PullProgress reports the download of a model. Completed and Total are in
+// bytes and zero while no layer is being downloaded.
+type PullProgress struct {
+	Status    string
+	Completed int64
+	Total     int64
+}
+
+func NewProvider(apiBase, proxy string) *Provider {
+	// No overall timeout: small boards take minutes for long answers, and
+	// requests end with their context.
+	client := &http.Client{}
+	if proxy != "" {
+		if parsed, err := url.Parse(proxy); err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(parsed)}
+		} else {
+			log.Printf("ollama: invalid proxy URL %q: %v", proxy, err)
+		}
+	}
+	return &Provider{
+		baseURL:    normalizeBaseURL(apiBase),
+		httpClient: client,
+		noTools:    make(map[string]bool),
+	}
+}
+
+func (p *Provider) BaseURL() string {
+	return p.baseURL
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return "llama3.2"
+}
+
+type chatMessage struct {
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	Thinking  string         `json:"thinking,omitempty"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+	ToolName  string         `json:"tool_name,omitempty"`
+}
+
+type chatToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+// toolCall converts the n-th tool call of a reply. Ollama does not number
+// tool calls; the IDs only have to link each result to its call within the
+// turn.
+func (c chatToolCall) toolCall(n int) ToolCall {
+	args := c.Function.Arguments
+	if args == nil {
+		args = map[string]any{}
+	}
+	return ToolCall{
+		ID:        fmt.Sprintf("call_%d", n),
+		Type:      "function",
+		Name:      c.Function.Name,
+		Arguments: args,
+	}
+}
+
+type chatResponse struct {
+	Message         chatMessage `json:"message"`
+	Done            bool        `json:"done"`
+	DoneReason      string      `json:"done_reason"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	EvalCount       int         `json:"eval_count"`
+	Error           string      `json:"error"`
+}
+
+func (p *Provider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream sends a chat request, passing the reply's text to onDelta as
+// it is generated. With a nil onDelta the reply is requested in one piece.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	return p.ChatStreamTools(ctx, messages, tools, model, options, onDelta, nil)
+}
+
+// ChatStreamTools is ChatStream with each tool call also passed to
+// onToolCall as soon as it arrives. Ollama sends tool calls whole, so the
+// reply is streamed when either callback is set.
+func (p *Provider) ChatStreamTools(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+	onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	p.mu.Lock()
+	if p.noTools[model] {
+		tools = nil
+	}
+	p.mu.Unlock()
+
+	resp, err := p.chat(ctx, messages, tools, model, options, onDelta, onToolCall)
+	var apiErr *apiError
+	if len(tools) > 0 && errors.As(err, &apiErr) && strings.Contains(apiErr.message, "does not support tools") {
+		log.Printf("ollama: %s does not support tools, continuing without them", model)
+		p.mu.Lock()
+		p.noTools[model] = true
+		p.mu.Unlock()
+		return p.chat(ctx, messages, nil, model, options, onDelta, onToolCall)
+	}
+	return resp, err
+}
+
+func (p *Provider) chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+	onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	body := map[string]any{
+		"model":    model,
+		"messages": translateMessages(messages),
+		"stream":   onDelta != nil || onToolCall != nil,
+	}
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+	modelOptions := map[string]any{}
+	if maxTokens, ok := options["max_tokens"].(int); ok && maxTokens > 0 {
+		modelOptions["num_predict"] = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		modelOptions["temperature"] = temperature
+	}
+	// Ollama names these like OpenAI; it has no logit bias.
+	for _, name := range []string{"top_p", "frequency_penalty", "presence_penalty", "seed", "stop"} {
+		if v, ok := options[name]; ok {
+			modelOptions[name] = v
+		}
+	}
+	if window, ok := options["context_window"].(int); ok && window > 0 {
+		modelOptions["num_ctx"] = window
+	}
+	if len(modelOptions) > 0 {
+		body["options"] = modelOptions
+	}
+	// Ollama takes a JSON schema as the format of the answer.
+	if schema, ok := options["response_schema"].(ResponseSchema); ok {
+		body["format"] = schema.Schema
+	}
+	// Ollama only switches thinking on or off; any effort turns it on.
+	if effort, ok := options["reasoning_effort"].(string); ok && effort != "" {
+		body["think"] = true
+	}
+
+	httpResp, err := p.post(ctx, "/api/chat", body)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var (
+		content   strings.Builder
+		reasoning strings.Builder
+		calls     []chatToolCall
+		last      chatResponse
+	)
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk chatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("ollama: decoding response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, &apiError{status: httpResp.StatusCode, message: chunk.Error}
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if onDelta != nil {
+				onDelta(chunk.Message.Content)
+			}
+		}
+		reasoning.WriteString(chunk.Message.Thinking)
+		for _, c := range chunk.Message.ToolCalls {
+			calls = append(calls, c)
+			if onToolCall != nil {
+				onToolCall(c.toolCall(len(calls)))
+			}
+		}
+		last = chunk
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ollama: reading response: %w", err)
+	}
+
+	resp := &LLMResponse{
+		Content:          content.String(),
+		ReasoningContent: reasoning.String(),
+		FinishReason:     "stop",
+		Usage: &UsageInfo{
+			PromptTokens:     last.PromptEvalCount,
+			CompletionTokens: last.EvalCount,
+			TotalTokens:      last.PromptEvalCount + last.EvalCount,
+		},
+	}
+	if last.DoneReason == "length" {
+		resp.FinishReason = "length"
+	}
+	for i, c := range calls {
+		resp.ToolCalls = append(resp.ToolCalls, c.toolCall(i+1))
+	}
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+// translateMessages converts messages to Ollama's format, where tool results
+// name their tool instead of referring to the call.
+func translateMessages(messages []Message) []chatMessage {
+	toolNames := make(map[string]string)
+	out := make([]chatMessage, 0, len(messages))
+	for _, msg := range messages {
+		m := chatMessage{Role: msg.Role, Content: msg.Content}
+		for _, tc := range msg.ToolCalls {
+			name, args := tc.Name, tc.Arguments
+			if name == "" && tc.Function != nil {
+				name = tc.Function.Name
+				json.Unmarshal([]byte(tc.Function.Arguments), &args)
+			}
+			toolNames[tc.ID] = name
+			var call chatToolCall
+			call.Function.Name = name
+			call.Function.Arguments = args
+			m.ToolCalls = append(m.ToolCalls, call)
+		}
+		if msg.Role == "tool" {
+			m.ToolName = toolNames[msg.ToolCallID]
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// Embed returns an embedding vector for each input.
+func (p *Provider) Embed(ctx context.Context, model string, input []string) ([][]float32, error) {
+	resp, err := p.post(ctx, "/api/embed", map[string]any{"model": model, "input": input})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ollama: decoding embeddings: %w", err)
+	}
+	if len(result.Embeddings) != len(input) {
+		return nil, fmt.Errorf("ollama: got %d embeddings for %d inputs", len(result.Embeddings), len(input))
+	}
+	return result.Embeddings, nil
+}
+
+// Pull downloads a model to the server, calling progress with each status
+// update.
+func (p *Provider) Pull(ctx context.Context, model string, progress func(PullProgress)) error {
+	resp, err := p.post(ctx, "/api/pull", map[string]any{"model": model, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var update struct {
+			Status    string `json:"status"`
+			Completed int64  `json:"completed"`
+			Total     int64  `json:"total"`
+			Error     string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			continue
+		}
+		if update.Error != "" {
+			return fmt.Errorf("ollama: pulling %s: %s", model, update.Error)
+		}
+		if progress != nil {
+			progress(PullProgress{Status: update.Status, Completed: update.Completed, Total: update.Total})
+		}
+	}
+	return scanner.Err()
+}
+
+// List returns the models available on the server.
+func (p *Provider) List(ctx context.Context) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			Size       int64     `json:"size"`
+			ModifiedAt time.Time `json:"modified_at"`
+			Details    struct {
+				ParameterSize     string `json:"parameter_size"`
+				QuantizationLevel string `json:"quantization_level"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ollama: decoding model list: %w", err)
+	}
+	models := make([]ModelInfo, 0, len(result.Models))
+	for _, m := range result.Models {
+		models = append(models, ModelInfo{
+			Name:          m.Name,
+			Size:          m.Size,
+			ParameterSize: m.Details.ParameterSize,
+			Quantization:  m.Details.QuantizationLevel,
+			ModifiedAt:    m.ModifiedAt,
+		})
+	}
+	return models, nil
+}
+
+// CheckHealth reports whether the server answers.
+func (p *Provider) CheckHealth(ctx context.Context) error {
+	_, err := p.List(ctx)
+	return err
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("ollama: API error (status %d): %s", e.status, e.message)
+}
+
+func (p *Provider) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return p.do(req)
+}
+
+func (p *Provider) do(req *http.Request) (*http.Response, error) {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var body struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(raw))
+		if json.Unmarshal(raw, &body) == nil && body.Error != "" {
+			message = body.Error
+		}
+		return nil, &apiError{status: resp.StatusCode, message: message}
+	}
+	return resp, nil
+}
+
+// normalizeBaseURL accepts the OpenAI-compatible address as well, which
+// ends in /v1.
+func normalizeBaseURL(apiBase string) string {
+	base := strings.TrimRight(strings.TrimSpace(apiBase), "/")
+	base = strings.TrimSuffix(base, "/v1")
+	if base == "" {
+		return DefaultBaseURL
+	}
+	return base
+}
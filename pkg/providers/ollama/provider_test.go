@@ -0,0 +1,176 @@
+package ollamaprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+)
+
+func TestChatToolCallRoundTrip(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[`+
+			`{"function":{"name":"get_weather","arguments":{"city":"Berlin"}}}]},`+
+			`"done":true,"done_reason":"stop","prompt_eval_count":30,"eval_count":7}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider(server.URL+"/v1", "")
+	messages := []Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "weather in Paris?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: map[string]any{"city": "Paris"}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "18°C"},
+		{Role: "user", Content: "and Berlin?"},
+	}
+	tools := []ToolDefinition{{Type: "function", Function: protocoltypes.ToolFunctionDefinition{
+		Name: "get_weather", Parameters: map[string]any{"type": "object"},
+	}}}
+	resp, err := p.Chat(t.Context(), messages, tools, "qwen2.5:3b", map[string]any{"max_tokens": 512, "temperature": 0.2, "context_window": 8192})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got["stream"] != false || got["model"] != "qwen2.5:3b" || len(got["tools"].([]any)) != 1 {
+		t.Errorf("request = %v", got)
+	}
+	if opts := got["options"].(map[string]any); opts["num_predict"] != 512.0 || opts["temperature"] != 0.2 || opts["num_ctx"] != 8192.0 {
+		t.Errorf("options = %v", opts)
+	}
+	sent := got["messages"].([]any)
+	if tool := sent[3].(map[string]any); tool["role"] != "tool" || tool["tool_name"] != "get_weather" {
+		t.Errorf("tool result = %v", tool)
+	}
+
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["city"] != "Berlin" {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage.TotalTokens != 37 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestChatStreamAndToolFallback(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+		if body["tools"] != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"registry.ollama.ai/library/gemma:2b does not support tools"}`)
+			return
+		}
+		for _, part := range []string{"Hel", "lo!"} {
+			fmt.Fprintf(w, `{"message":{"role":"assistant","content":%q},"done":false}`+"\n", part)
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"length","eval_count":2}`+"\n")
+	}))
+	defer server.Close()
+
+	p := NewProvider(server.URL, "")
+	tools := []ToolDefinition{{Type: "function", Function: protocoltypes.ToolFunctionDefinition{Name: "noop"}}}
+	var deltas []string
+	resp, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, tools, "gemma:2b", nil,
+		func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Hello!" || strings.Join(deltas, "|") != "Hel|lo!" || resp.FinishReason != "length" {
+		t.Errorf("content = %q, deltas = %q, finish = %s", resp.Content, deltas, resp.FinishReason)
+	}
+
+	// The model is remembered as one without tools.
+	p.ChatStream(t.Context(), []Message{{Role: "user", Content: "again"}}, tools, "gemma:2b", nil, nil)
+	if len(requests) != 3 || requests[2]["tools"] != nil {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func TestChatStreamToolsWithoutTextSink(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"","tool_calls":[`+
+			`{"function":{"name":"read_file","arguments":{"path":"a.txt"}}}]},"done":false}`+"\n")
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`+"\n")
+	}))
+	defer server.Close()
+
+	p := NewProvider(server.URL, "")
+	var early []ToolCall
+	resp, err := p.ChatStreamTools(t.Context(), []Message{{Role: "user", Content: "read a.txt"}}, nil, "qwen2.5:3b", nil,
+		nil, func(tc ToolCall) { early = append(early, tc) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["stream"] != true {
+		t.Errorf("stream = %v", got["stream"])
+	}
+	if len(early) != 1 || len(resp.ToolCalls) != 1 || early[0].ID != resp.ToolCalls[0].ID || early[0].Arguments["path"] != "a.txt" {
+		t.Errorf("streamed = %+v, response = %+v", early, resp.ToolCalls)
+	}
+}
+
+func TestModelManagement(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"llama3.2:1b","size":1321098329,"modified_at":"2024-10-01T12:00:00Z",`+
+				`"details":{"parameter_size":"1.2B","quantization_level":"Q8_0"}}]}`)
+		case "/api/pull":
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["model"] == "missing" {
+				fmt.Fprint(w, `{"error":"pull model manifest: file does not exist"}`+"\n")
+				return
+			}
+			fmt.Fprint(w, `{"status":"pulling manifest"}`+"\n"+
+				`{"status":"pulling abc","total":100,"completed":50}`+"\n"+
+				`{"status":"success"}`+"\n")
+		case "/api/embed":
+			fmt.Fprint(w, `{"embeddings":[[0.1,0.2],[0.3,0.4]]}`)
+		}
+	}))
+	defer server.Close()
+
+	p := NewProvider(server.URL, "")
+	models, err := p.List(t.Context())
+	if err != nil || len(models) != 1 || models[0].Name != "llama3.2:1b" || models[0].Quantization != "Q8_0" {
+		t.Fatalf("List() = %+v, %v", models, err)
+	}
+	if err := p.CheckHealth(t.Context()); err != nil {
+		t.Errorf("CheckHealth() = %v", err)
+	}
+
+	var statuses []string
+	if err := p.Pull(t.Context(), "llama3.2:1b", func(pp PullProgress) { statuses = append(statuses, pp.Status) }); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(statuses, ",") != "pulling manifest,pulling abc,success" {
+		t.Errorf("statuses = %v", statuses)
+	}
+	if err := p.Pull(t.Context(), "missing", nil); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Pull(missing) = %v", err)
+	}
+
+	vectors, err := p.Embed(t.Context(), "nomic-embed-text", []string{"a", "b"})
+	if err != nil || len(vectors) != 2 || vectors[1][0] != 0.3 {
+		t.Errorf("Embed() = %v, %v", vectors, err)
+	}
+
+	down := NewProvider("http://127.0.0.1:1", "")
+	if down.CheckHealth(t.Context()) == nil {
+		t.Error("CheckHealth() succeeded without a server")
+	}
+}
@@ -0,0 +1,27 @@
+package providers
+
+import (
+	ollamaprovider "github.com/sipeed/picoclaw/pkg/providers/ollama"
+)
+
+type (
+	OllamaModelInfo    = ollamaprovider.ModelInfo
+	OllamaPullProgress = ollamaprovider.PullProgress
+)
+
+// OllamaProvider runs models on a local Ollama server through its native
+// API. Besides chatting it computes embeddings and downloads and lists
+// models.
+type OllamaProvider struct {
+	*ollamaprovider.Provider
+}
+
+func NewOllamaProvider(apiBase, proxy string) *OllamaProvider {
+	return &OllamaProvider{Provider: ollamaprovider.NewProvider(apiBase, proxy)}
+}
+
+// SupportsResponseSchema reports that Ollama takes a JSON schema as the
+// format of the answer.
+func (p *OllamaProvider) SupportsResponseSchema() bool {
+	return true
+}
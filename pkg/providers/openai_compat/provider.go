@@ -2,6 +2,7 @@ package openai_compat
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,10 +10,12 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
+	"github.com/sipeed/picoclaw/pkg/providers/ratelimit"
 )
 
 type (
@@ -25,6 +28,7 @@ type (
 	ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
 	ExtraContent           = protocoltypes.ExtraContent
 	GoogleExtra            = protocoltypes.GoogleExtra
+	ResponseSchema         = protocoltypes.ResponseSchema
 )
 
 type Provider struct {
@@ -32,8 +36,22 @@ type Provider struct {
 	apiBase        string
 	maxTokensField string // Field name for max tokens (e.g., "max_completion_tokens" for o1/glm models)
 	httpClient     *http.Client
+	// azureAPIVersion is set for Azure OpenAI, which routes by deployment
+	// name in the path and authenticates with an api-key header.
+	azureAPIVersion string
+	openRouter      *OpenRouterRouting
 }
 
+// OpenRouterRouting is what OpenRouter is asked for besides the model.
+type OpenRouterRouting struct {
+	Provider  any      // provider routing preferences, sent as "provider"
+	Fallbacks []string // models to try after the requested one
+}
+
+// DefaultAzureAPIVersion is the Azure OpenAI API version used when none is
+// configured.
+const DefaultAzureAPIVersion = "2024-10-21"
+
 func NewProvider(apiKey, apiBase, proxy string) *Provider {
 	return NewProviderWithMaxTokensField(apiKey, apiBase, proxy, "")
 }
@@ -69,6 +87,101 @@ func (p *Provider) Chat(
 	model string,
 	options map[string]any,
 ) (*LLMResponse, error) {
+	req, err := p.newRequest(ctx, messages, tools, model, options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ratelimit.Default.Do(p.httpClient, req, ratelimit.Key(p.apiBase, model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+	}
+
+	return parseResponse(body)
+}
+
+// ChatStream behaves like Chat but requests a streamed completion and calls
+// onDelta with each content chunk as it arrives.
+func (p *Provider) ChatStream(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+) (*LLMResponse, error) {
+	return p.ChatStreamTools(ctx, messages, tools, model, options, onDelta, nil)
+}
+
+// ChatStreamTools behaves like ChatStream and also passes each tool call to
+// onToolCall as soon as its arguments have streamed in.
+func (p *Provider) ChatStreamTools(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	onDelta func(delta string),
+	onToolCall func(ToolCall),
+) (*LLMResponse, error) {
+	req, err := p.newRequest(ctx, messages, tools, model, options, true)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := ratelimit.Default.Do(p.httpClient, req, ratelimit.Key(p.apiBase, model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+	}
+
+	return parseStream(resp.Body, onDelta, onToolCall)
+}
+
+// NewAzureProvider creates a provider for an Azure OpenAI resource.
+// endpoint is the resource URL (https://<resource>.openai.azure.com) and
+// the model passed to Chat is the deployment name.
+func NewAzureProvider(apiKey, endpoint, apiVersion, proxy, maxTokensField string) *Provider {
+	p := NewProviderWithMaxTokensField(apiKey, endpoint, proxy, maxTokensField)
+	p.azureAPIVersion = apiVersion
+	if p.azureAPIVersion == "" {
+		p.azureAPIVersion = DefaultAzureAPIVersion
+	}
+	return p
+}
+
+// NewOpenRouterProvider creates a provider for OpenRouter that routes each
+// request as routing says.
+func NewOpenRouterProvider(apiKey, apiBase, proxy, maxTokensField string, routing OpenRouterRouting) *Provider {
+	p := NewProviderWithMaxTokensField(apiKey, apiBase, proxy, maxTokensField)
+	p.openRouter = &routing
+	return p
+}
+
+func (p *Provider) newRequest(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+	stream bool,
+) (*http.Request, error) {
 	if p.apiBase == "" {
 		return nil, fmt.Errorf("API base not configured")
 	}
@@ -77,7 +190,12 @@ func (p *Provider) Chat(
 
 	requestBody := map[string]any{
 		"model":    model,
-		"messages": messages,
+		"messages": withoutMedia(messages),
+	}
+
+	if stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]any{"include_usage": true}
 	}
 
 	if len(tools) > 0 {
@@ -111,37 +229,80 @@ func (p *Provider) Chat(
 		}
 	}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	if effort, ok := options["reasoning_effort"].(string); ok && effort != "" {
+		requestBody["reasoning_effort"] = effort
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/chat/completions", bytes.NewReader(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	for _, name := range []string{"top_p", "frequency_penalty", "presence_penalty"} {
+		if v, ok := asFloat(options[name]); ok {
+			requestBody[name] = v
+		}
+	}
+	if seed, ok := asInt(options["seed"]); ok {
+		requestBody["seed"] = seed
+	}
+	if stop, ok := options["stop"].([]string); ok && len(stop) > 0 {
+		requestBody["stop"] = stop
+	}
+	if bias, ok := options["logit_bias"].(map[string]float64); ok && len(bias) > 0 {
+		requestBody["logit_bias"] = bias
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	// "flex" trades latency for a lower price on OpenAI.
+	if tier, ok := options["service_tier"].(string); ok && tier != "" {
+		requestBody["service_tier"] = tier
 	}
 
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if schema, ok := options["response_schema"].(ResponseSchema); ok {
+		requestBody["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": schema,
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	openRouter := isOpenRouter(p.apiBase)
+	if openRouter {
+		// Report the cost of each request with its usage.
+		requestBody["usage"] = map[string]any{"include": true}
+	}
+	if r := p.openRouter; r != nil {
+		if r.Provider != nil {
+			requestBody["provider"] = r.Provider
+		}
+		if len(r.Fallbacks) > 0 {
+			requestBody["models"] = append([]string{model}, r.Fallbacks...)
+		}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+	endpoint := p.apiBase + "/chat/completions"
+	if p.azureAPIVersion != "" {
+		endpoint = fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			strings.TrimSuffix(p.apiBase, "/openai"), url.PathEscape(model), url.QueryEscape(p.azureAPIVersion))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	return parseResponse(body)
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case p.apiKey == "":
+	case p.azureAPIVersion != "":
+		req.Header.Set("api-key", p.apiKey)
+	default:
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	if openRouter {
+		// Attribution shown in OpenRouter's activity log and rankings.
+		req.Header.Set("HTTP-Referer", "https://github.com/sipeed/picoclaw")
+		req.Header.Set("X-Title", "PicoClaw")
+	}
+	return req, nil
 }
 
 func parseResponse(body []byte) (*LLMResponse, error) {
@@ -150,6 +311,7 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 			Message struct {
 				Content          string `json:"content"`
 				ReasoningContent string `json:"reasoning_content"`
+				Reasoning        string `json:"reasoning"` // OpenRouter, vLLM
 				ToolCalls        []struct {
 					ID       string `json:"id"`
 					Type     string `json:"type"`
@@ -166,7 +328,7 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
-		Usage *UsageInfo `json:"usage"`
+		Usage *apiUsage `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &apiResponse); err != nil {
@@ -223,20 +385,40 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 
 	return &LLMResponse{
 		Content:          choice.Message.Content,
-		ReasoningContent: choice.Message.ReasoningContent,
+		ReasoningContent: cmp.Or(choice.Message.ReasoningContent, choice.Message.Reasoning),
 		ToolCalls:        toolCalls,
 		FinishReason:     choice.FinishReason,
-		Usage:            apiResponse.Usage,
+		Usage:            apiResponse.Usage.info(),
 	}, nil
 }
 
+// apiUsage is the usage of a response. Reasoning models report the tokens
+// they spent thinking in completion_tokens_details.
+type apiUsage struct {
+	UsageInfo
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+func (u *apiUsage) info() *UsageInfo {
+	if u == nil {
+		return nil
+	}
+	info := u.UsageInfo
+	if d := u.CompletionTokensDetails; d != nil && info.ReasoningTokens == 0 {
+		info.ReasoningTokens = d.ReasoningTokens
+	}
+	return &info
+}
+
 func normalizeModel(model, apiBase string) string {
 	idx := strings.Index(model, "/")
 	if idx == -1 {
 		return model
 	}
 
-	if strings.Contains(strings.ToLower(apiBase), "openrouter.ai") {
+	if isOpenRouter(apiBase) {
 		return model
 	}
 
@@ -249,6 +431,10 @@ func normalizeModel(model, apiBase string) string {
 	}
 }
 
+func isOpenRouter(apiBase string) bool {
+	return strings.Contains(strings.ToLower(apiBase), "openrouter.ai")
+}
+
 func asInt(v any) (int, bool) {
 	switch val := v.(type) {
 	case int:
@@ -278,3 +464,16 @@ func asFloat(v any) (float64, bool) {
 		return 0, false
 	}
 }
+
+// withoutMedia drops the media paths, which are not part of the
+// OpenAI-compatible message format.
+func withoutMedia(messages []Message) []Message {
+	if !slices.ContainsFunc(messages, func(m Message) bool { return len(m.Media) > 0 }) {
+		return messages
+	}
+	out := append([]Message(nil), messages...)
+	for i := range out {
+		out[i].Media = nil
+	}
+	return out
+}
@@ -2,6 +2,7 @@ package openai_compat
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -145,6 +146,28 @@ func TestProviderChat_ParsesReasoningContent(t *testing.T) {
 	}
 }
 
+func TestProviderChat_ReasoningFieldAndTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"2","reasoning":"1+1"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":10,"completion_tokens":40,"total_tokens":50,
+				"completion_tokens_details":{"reasoning_tokens":30}}}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	out, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "1+1=?"}}, nil, "o4-mini", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if out.ReasoningContent != "1+1" {
+		t.Errorf("ReasoningContent = %q, want %q", out.ReasoningContent, "1+1")
+	}
+	if out.Usage == nil || out.Usage.CompletionTokens != 40 || out.Usage.ReasoningTokens != 30 {
+		t.Errorf("Usage = %+v", out.Usage)
+	}
+}
+
 func TestProviderChat_HTTPError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -158,6 +181,30 @@ func TestProviderChat_HTTPError(t *testing.T) {
 	}
 }
 
+func TestProviderChat_AzureRoutesByDeployment(t *testing.T) {
+	var gotURL *url.URL
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURL, header = r.URL, r.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewAzureProvider("azure-key", server.URL+"/", "", "", "")
+	resp, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "prod-gpt4o", nil)
+	if err != nil || resp.Content != "ok" {
+		t.Fatalf("Chat() = %+v, %v", resp, err)
+	}
+	if gotURL.Path != "/openai/deployments/prod-gpt4o/chat/completions" ||
+		gotURL.Query().Get("api-version") != DefaultAzureAPIVersion {
+		t.Errorf("URL = %s", gotURL)
+	}
+	if header.Get("api-key") != "azure-key" || header.Get("Authorization") != "" {
+		t.Errorf("api-key = %q, Authorization = %q", header.Get("api-key"), header.Get("Authorization"))
+	}
+}
+
 func TestProviderChat_StripsMoonshotPrefixAndNormalizesKimiTemperature(t *testing.T) {
 	var requestBody map[string]any
 
@@ -317,6 +364,117 @@ func TestProviderChat_AcceptsNumericOptionTypes(t *testing.T) {
 	}
 }
 
+func TestProviderChat_SendsGenerationParams(t *testing.T) {
+	var requestBody map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	_, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", map[string]any{
+		"top_p":             0.9,
+		"frequency_penalty": 0.5,
+		"presence_penalty":  -0.5,
+		"seed":              7,
+		"stop":              []string{"END"},
+		"logit_bias":        map[string]float64{"50256": -100},
+	})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	got, _ := json.Marshal(map[string]any{
+		"top_p": requestBody["top_p"], "frequency_penalty": requestBody["frequency_penalty"],
+		"presence_penalty": requestBody["presence_penalty"], "seed": requestBody["seed"],
+		"stop": requestBody["stop"], "logit_bias": requestBody["logit_bias"],
+	})
+	want := `{"frequency_penalty":0.5,"logit_bias":{"50256":-100},` +
+		`"presence_penalty":-0.5,"seed":7,"stop":["END"],"top_p":0.9}`
+	if string(got) != want {
+		t.Errorf("request = %s, want %s", got, want)
+	}
+}
+
+func TestProviderChat_OpenRouterRouting(t *testing.T) {
+	var requestBody map[string]any
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		fmt.Fprint(w, `{"model":"openai/gpt-4o-mini","provider":"OpenAI",
+			"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"cost":0.000042}}`)
+	}))
+	defer server.Close()
+
+	// The test server stands in for openrouter.ai.
+	p := NewOpenRouterProvider("key", server.URL+"/openrouter.ai/api/v1", "", "", OpenRouterRouting{
+		Provider:  map[string]any{"sort": "price", "allow_fallbacks": false},
+		Fallbacks: []string{"openai/gpt-4o-mini"},
+	})
+	resp, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "meta-llama/llama-3.3-70b-instruct", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	got, _ := json.Marshal(map[string]any{
+		"model": requestBody["model"], "models": requestBody["models"],
+		"provider": requestBody["provider"], "usage": requestBody["usage"],
+	})
+	want := `{"model":"meta-llama/llama-3.3-70b-instruct",` +
+		`"models":["meta-llama/llama-3.3-70b-instruct","openai/gpt-4o-mini"],` +
+		`"provider":{"allow_fallbacks":false,"sort":"price"},"usage":{"include":true}}`
+	if string(got) != want {
+		t.Errorf("request = %s\nwant      %s", got, want)
+	}
+	if header.Get("X-Title") == "" || header.Get("HTTP-Referer") == "" {
+		t.Errorf("attribution headers missing: %v", header)
+	}
+	if resp.Usage == nil || resp.Usage.Cost != 0.000042 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+
+	// Other APIs get none of it.
+	requestBody = nil
+	NewProvider("key", server.URL, "").Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil)
+	for _, field := range []string{"models", "provider", "usage"} {
+		if _, ok := requestBody[field]; ok {
+			t.Errorf("%s sent to a non-OpenRouter API", field)
+		}
+	}
+}
+
+func TestProviderChat_SendsServiceTier(t *testing.T) {
+	var requestBody map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	for _, tier := range []string{"flex", ""} {
+		requestBody = nil
+		_, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "o4-mini",
+			map[string]any{"service_tier": tier})
+		if err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+		got, ok := requestBody["service_tier"]
+		if tier == "" && ok {
+			t.Errorf("empty tier was sent as %v", got)
+		}
+		if tier != "" && got != tier {
+			t.Errorf("service_tier = %v, want %s", got, tier)
+		}
+	}
+}
+
 func TestNormalizeModel_UsesAPIBase(t *testing.T) {
 	if got := normalizeModel("deepseek/deepseek-chat", "https://api.deepseek.com/v1"); got != "deepseek-chat" {
 		t.Fatalf("normalizeModel(deepseek) = %q, want %q", got, "deepseek-chat")
@@ -0,0 +1,187 @@
+package openai_compat
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			Reasoning        string `json:"reasoning"`
+			ToolCalls        []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function *struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+				ExtraContent *struct {
+					Google *struct {
+						ThoughtSignature string `json:"thought_signature"`
+					} `json:"google"`
+				} `json:"extra_content"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *apiUsage `json:"usage"`
+}
+
+// streamToolCall accumulates a tool call whose name and arguments arrive
+// spread over several chunks.
+type streamToolCall struct {
+	id               string
+	name             string
+	arguments        strings.Builder
+	thoughtSignature string
+}
+
+// complete reports whether the call has its name and arguments that form a
+// whole JSON value; a prefix of a JSON object never parses on its own.
+func (c *streamToolCall) complete() bool {
+	return c.name != "" && json.Valid([]byte(c.arguments.String()))
+}
+
+func (c *streamToolCall) toolCall() ToolCall {
+	arguments := make(map[string]any)
+	if raw := c.arguments.String(); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+			log.Printf("openai_compat: failed to decode tool call arguments for %q: %v", c.name, err)
+			arguments["raw"] = raw
+		}
+	}
+
+	toolCall := ToolCall{
+		ID:               c.id,
+		Name:             c.name,
+		Arguments:        arguments,
+		ThoughtSignature: c.thoughtSignature,
+	}
+	if c.thoughtSignature != "" {
+		toolCall.ExtraContent = &ExtraContent{
+			Google: &GoogleExtra{ThoughtSignature: c.thoughtSignature},
+		}
+	}
+	return toolCall
+}
+
+// parseStream reads an OpenAI-style server-sent event stream and assembles the
+// final response, forwarding content deltas to onDelta as they arrive. Tool
+// calls are passed to onToolCall in order, each as soon as its arguments are
+// complete: when they parse, or when the next call starts.
+func parseStream(r io.Reader, onDelta func(string), onToolCall func(ToolCall)) (*LLMResponse, error) {
+	var (
+		content      strings.Builder
+		reasoning    strings.Builder
+		finishReason string
+		usage        *UsageInfo
+		calls        = make(map[int]*streamToolCall)
+		nextCall     int // index of the next call to pass to onToolCall
+	)
+	emitReady := func(started int) {
+		for onToolCall != nil {
+			call, ok := calls[nextCall]
+			if !ok || (nextCall >= started && !call.complete()) {
+				return
+			}
+			onToolCall(call.toolCall())
+			nextCall++
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.info()
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			finishReason = *choice.FinishReason
+		}
+		if delta := choice.Delta.Content; delta != "" {
+			content.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+		reasoning.WriteString(cmp.Or(choice.Delta.ReasoningContent, choice.Delta.Reasoning))
+
+		for _, tc := range choice.Delta.ToolCalls {
+			call, exists := calls[tc.Index]
+			if !exists {
+				call = &streamToolCall{}
+				calls[tc.Index] = call
+			}
+			if tc.ID != "" {
+				call.id = tc.ID
+			}
+			if tc.Function != nil {
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+				}
+				call.arguments.WriteString(tc.Function.Arguments)
+			}
+			if tc.ExtraContent != nil && tc.ExtraContent.Google != nil &&
+				tc.ExtraContent.Google.ThoughtSignature != "" {
+				call.thoughtSignature = tc.ExtraContent.Google.ThoughtSignature
+			}
+		}
+		if n := len(choice.Delta.ToolCalls); n > 0 {
+			emitReady(choice.Delta.ToolCalls[n-1].Index)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	toolCalls := make([]ToolCall, 0, len(calls))
+	for _, idx := range indexes {
+		toolCalls = append(toolCalls, calls[idx].toolCall())
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	return &LLMResponse{
+		Content:          content.String(),
+		ReasoningContent: reasoning.String(),
+		ToolCalls:        toolCalls,
+		FinishReason:     finishReason,
+		Usage:            usage,
+	}, nil
+}
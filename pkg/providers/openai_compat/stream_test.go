@@ -0,0 +1,106 @@
+package openai_compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProviderChatStream_AssemblesContentAndToolCalls(t *testing.T) {
+	var requestBody map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"SF\"}"}}]}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`,
+		}
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	var deltas []string
+	out, err := p.ChatStream(
+		t.Context(),
+		[]Message{{Role: "user", Content: "hi"}},
+		nil,
+		"gpt-4o",
+		nil,
+		func(d string) { deltas = append(deltas, d) },
+	)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	if requestBody["stream"] != true {
+		t.Errorf("expected stream=true in request body, got %v", requestBody["stream"])
+	}
+	if strings.Join(deltas, "|") != "Hel|lo" {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if out.Content != "Hello" || out.FinishReason != "tool_calls" {
+		t.Errorf("unexpected response: %+v", out)
+	}
+	if len(out.ToolCalls) != 1 || out.ToolCalls[0].Name != "get_weather" || out.ToolCalls[0].Arguments["city"] != "SF" {
+		t.Errorf("unexpected tool calls: %+v", out.ToolCalls)
+	}
+	if out.Usage == nil || out.Usage.TotalTokens != 8 {
+		t.Errorf("unexpected usage: %+v", out.Usage)
+	}
+}
+
+func TestProviderChatStream_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	_, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestParseStream_ReportsToolCallsAsTheyComplete(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read_file","arguments":"{\"path\":"}}]}}]}`,
+		`{"choices":[{"delta":{"content":"a"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a.txt\"}"}}]}}]}`,
+		`{"choices":[{"delta":{"content":"b"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","function":{"name":"exec","arguments":"{broken"}}]}}]}`,
+		`{"choices":[{"delta":{"content":"c"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":2,"id":"call_3","function":{"name":"list_dir","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+	}
+	var stream strings.Builder
+	for _, c := range chunks {
+		fmt.Fprintf(&stream, "data: %s\n\n", c)
+	}
+
+	var events []string
+	out, err := parseStream(strings.NewReader(stream.String()),
+		func(d string) { events = append(events, d) },
+		func(tc ToolCall) { events = append(events, tc.ID) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(events, ","); got != "a,call_1,b,c,call_2,call_3" {
+		t.Errorf("events = %s", got)
+	}
+	if len(out.ToolCalls) != 3 || out.ToolCalls[0].Arguments["path"] != "a.txt" || out.ToolCalls[1].Arguments["raw"] != "{broken" {
+		t.Errorf("tool calls = %+v", out.ToolCalls)
+	}
+}
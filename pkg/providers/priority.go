@@ -0,0 +1,18 @@
+package providers
+
+import "context"
+
+type backgroundKey struct{}
+
+// WithBackground marks the LLM requests made with ctx as background work,
+// such as scheduled jobs, whose answers nobody is waiting for. They may be
+// held back for interactive requests and served more slowly for less.
+func WithBackground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// IsBackground reports whether ctx was marked by WithBackground.
+func IsBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
@@ -36,6 +36,12 @@ type UsageInfo struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// ReasoningTokens are the completion tokens a reasoning model spent
+	// thinking, included in CompletionTokens.
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+	// Cost is what the API says the request cost in USD, if it does, as
+	// OpenRouter does.
+	Cost float64 `json:"cost,omitempty"`
 }
 
 type Message struct {
@@ -44,6 +50,9 @@ type Message struct {
 	ReasoningContent string     `json:"reasoning_content,omitempty"`
 	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID       string     `json:"tool_call_id,omitempty"`
+	// Media lists local image and audio files sent with a user message, for
+	// providers that take them as input. Others only see Content.
+	Media []string `json:"media,omitempty"`
 }
 
 type ToolDefinition struct {
@@ -56,3 +65,14 @@ type ToolFunctionDefinition struct {
 	Description string         `json:"description"`
 	Parameters  map[string]any `json:"parameters"`
 }
+
+// ResponseSchema asks for an answer that is a JSON value following Schema,
+// passed to providers as the "response_schema" option. Strict asks
+// providers that distinguish it to enforce the schema exactly; OpenAI then
+// requires every object to list all its properties as required and to
+// forbid additional ones.
+type ResponseSchema struct {
+	Name   string         `json:"name"`
+	Schema map[string]any `json:"schema"`
+	Strict bool           `json:"strict,omitempty"`
+}
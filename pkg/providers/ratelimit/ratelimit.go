@@ -0,0 +1,310 @@
+// Package ratelimit tracks the rate limits LLM APIs report in their
+// response headers, per API host and model, and holds requests back while a
+// limit is used up instead of sending them only to be refused.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxWait is how long a request waits at most for a limit to reset.
+// Beyond that it fails at once, so a fallback model can take over.
+const DefaultMaxWait = time.Minute
+
+// Budget is what is left of a key's limits. Counts are -1 when the API has
+// not reported them.
+type Budget struct {
+	Key               string
+	RemainingRequests int
+	RemainingTokens   int
+	LimitRequests     int
+	LimitTokens       int
+	ResetRequests     time.Time
+	ResetTokens       time.Time
+	RetryAfter        time.Time // until when the API asked to wait, after a 429 or 503
+	Updated           time.Time
+}
+
+// Limiter keeps the budgets of all keys. It is safe for concurrent use.
+type Limiter struct {
+	maxWait time.Duration
+
+	mu      sync.Mutex
+	budgets map[string]*Budget
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// Default is the limiter the providers share: the limits belong to the
+// API accounts, not to a provider instance.
+var Default = New(DefaultMaxWait)
+
+// New creates a limiter that waits at most maxWait before a request.
+func New(maxWait time.Duration) *Limiter {
+	return &Limiter{
+		maxWait: maxWait,
+		budgets: make(map[string]*Budget),
+		now:     time.Now,
+		sleep:   sleep,
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Key names the budget of model at the API at apiBase. Limits are per
+// account and model, so the host stands in for the account.
+func Key(apiBase, model string) string {
+	host := apiBase
+	if u, err := url.Parse(apiBase); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return host + " " + model
+}
+
+// ExhaustedError is returned by Wait when a limit resets too late to wait
+// for.
+type ExhaustedError struct {
+	Key   string
+	Until time.Time
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("rate limit of %s reached until %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+// Wait blocks until a request for key may be sent: when the API asked to
+// wait, or the request budget is used up, until the limit resets. Waits
+// longer than the limiter's maximum return an *ExhaustedError instead.
+// A request is counted against the budget when Wait returns, so that
+// concurrent requests queue up once it is exhausted.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	for {
+		l.mu.Lock()
+		until := l.blockedUntil(key)
+		if until.IsZero() {
+			if b := l.budgets[key]; b != nil && b.RemainingRequests > 0 {
+				b.RemainingRequests--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		d := until.Sub(l.now())
+		if d > l.maxWait {
+			return &ExhaustedError{Key: key, Until: until}
+		}
+		if err := l.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// blockedUntil returns when key may send again, or zero if it may now.
+// Must be called with l.mu held.
+func (l *Limiter) blockedUntil(key string) time.Time {
+	b := l.budgets[key]
+	if b == nil {
+		return time.Time{}
+	}
+	now := l.now()
+	var until time.Time
+	if b.RetryAfter.After(now) {
+		until = b.RetryAfter
+	}
+	if b.RemainingRequests == 0 {
+		if b.ResetRequests.After(now) {
+			until = later(until, b.ResetRequests)
+		} else {
+			b.RemainingRequests = -1 // reset since; unknown until the next response
+		}
+	}
+	if b.RemainingTokens == 0 {
+		if b.ResetTokens.After(now) {
+			until = later(until, b.ResetTokens)
+		} else {
+			b.RemainingTokens = -1
+		}
+	}
+	return until
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// Update records the limits reported in the headers of a response with
+// status for key, and returns how long the API asked to wait, if it did.
+func (l *Limiter) Update(key string, h http.Header, status int) time.Duration {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.budgets[key]
+	if b == nil {
+		b = &Budget{Key: key, RemainingRequests: -1, RemainingTokens: -1, LimitRequests: -1, LimitTokens: -1}
+	}
+	seen := false
+	for _, f := range []struct {
+		names []string
+		set   func(string) bool
+	}{
+		{[]string{"x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining", "x-ratelimit-remaining"},
+			func(v string) bool { return parseCount(v, &b.RemainingRequests) }},
+		{[]string{"x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining"},
+			func(v string) bool { return parseCount(v, &b.RemainingTokens) }},
+		{[]string{"x-ratelimit-limit-requests", "anthropic-ratelimit-requests-limit", "x-ratelimit-limit"},
+			func(v string) bool { return parseCount(v, &b.LimitRequests) }},
+		{[]string{"x-ratelimit-limit-tokens", "anthropic-ratelimit-tokens-limit"},
+			func(v string) bool { return parseCount(v, &b.LimitTokens) }},
+		{[]string{"x-ratelimit-reset-requests", "anthropic-ratelimit-requests-reset", "x-ratelimit-reset"},
+			func(v string) bool { return parseReset(v, now, &b.ResetRequests) }},
+		{[]string{"x-ratelimit-reset-tokens", "anthropic-ratelimit-tokens-reset"},
+			func(v string) bool { return parseReset(v, now, &b.ResetTokens) }},
+	} {
+		for _, name := range f.names {
+			if v := h.Get(name); v != "" && f.set(v) {
+				seen = true
+				break
+			}
+		}
+	}
+
+	var wait time.Duration
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		wait = RetryAfter(h, now)
+		if wait > 0 {
+			b.RetryAfter = now.Add(wait)
+			seen = true
+		}
+	}
+	if seen {
+		b.Updated = now
+		l.budgets[key] = b
+	}
+	return wait
+}
+
+// RetryAfter returns the wait a response asks for in retry-after-ms or
+// Retry-After, in seconds or as a date.
+func RetryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func parseCount(v string, dst *int) bool {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return false
+	}
+	*dst = n
+	return true
+}
+
+// parseReset reads when a limit resets: a duration ("6m0s", "20ms", as
+// OpenAI and Groq send), a timestamp (Anthropic), Unix seconds or
+// milliseconds, or seconds from now.
+func parseReset(v string, now time.Time, dst *time.Time) bool {
+	v = strings.TrimSpace(v)
+	if d, err := time.ParseDuration(v); err == nil {
+		*dst = now.Add(d)
+		return true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		*dst = t
+		return true
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return false
+	}
+	switch {
+	case n > 1e12:
+		*dst = time.UnixMilli(int64(n))
+	case n > 1e9:
+		*dst = time.Unix(int64(n), 0)
+	default:
+		*dst = now.Add(time.Duration(n * float64(time.Second)))
+	}
+	return true
+}
+
+// Budgets returns the budgets of all keys the APIs reported limits for,
+// sorted by key.
+func (l *Limiter) Budgets() []Budget {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Budget, 0, len(l.budgets))
+	for _, b := range l.budgets {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Do sends req with client once key's budget allows it, and records the
+// limits of the response. A 429 whose Retry-After is within the maximum
+// wait is waited out and the request sent again, up to twice.
+func (l *Limiter) Do(client *http.Client, req *http.Request, key string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := l.Wait(req.Context(), key); err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		wait := l.Update(key, resp.Header, resp.StatusCode)
+		if resp.StatusCode != http.StatusTooManyRequests || wait <= 0 || wait > l.maxWait ||
+			attempt == 2 || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testLimiter(now time.Time) (*Limiter, *[]time.Duration) {
+	l := New(time.Minute)
+	l.now = func() time.Time { return now }
+	var slept []time.Duration
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return nil
+	}
+	return l, &slept
+}
+
+func TestUpdate_Headers(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l, _ := testLimiter(now)
+
+	openai := http.Header{}
+	openai.Set("x-ratelimit-limit-requests", "500")
+	openai.Set("x-ratelimit-remaining-requests", "499")
+	openai.Set("x-ratelimit-remaining-tokens", "29000")
+	openai.Set("x-ratelimit-reset-requests", "120ms")
+	openai.Set("x-ratelimit-reset-tokens", "1m30s")
+	l.Update("openai gpt-4o", openai, http.StatusOK)
+
+	anthropic := http.Header{}
+	anthropic.Set("anthropic-ratelimit-requests-remaining", "0")
+	anthropic.Set("anthropic-ratelimit-requests-reset", "2026-03-01T12:00:30Z")
+	l.Update("anthropic claude", anthropic, http.StatusOK)
+
+	l.Update("quiet model", http.Header{}, http.StatusOK)
+
+	budgets := l.Budgets()
+	if len(budgets) != 2 {
+		t.Fatalf("budgets = %+v", budgets)
+	}
+	a, o := budgets[0], budgets[1]
+	if o.RemainingRequests != 499 || o.LimitRequests != 500 || o.RemainingTokens != 29000 ||
+		!o.ResetTokens.Equal(now.Add(90*time.Second)) || !o.ResetRequests.Equal(now.Add(120*time.Millisecond)) {
+		t.Errorf("openai budget = %+v", o)
+	}
+	if a.RemainingRequests != 0 || a.RemainingTokens != -1 || !a.ResetRequests.Equal(now.Add(30*time.Second)) {
+		t.Errorf("anthropic budget = %+v", a)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header, value string
+		want          time.Duration
+	}{
+		{"Retry-After", "7", 7 * time.Second},
+		{"Retry-After", "Sun, 01 Mar 2026 12:00:20 GMT", 20 * time.Second},
+		{"retry-after-ms", "250", 250 * time.Millisecond},
+		{"Retry-After", "soon", 0},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		h.Set(tt.header, tt.value)
+		if got := RetryAfter(h, now); got != tt.want {
+			t.Errorf("%s: %s = %v, want %v", tt.header, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l, slept := testLimiter(now)
+	ctx := context.Background()
+
+	if err := l.Wait(ctx, "unknown"); err != nil || len(*slept) != 0 {
+		t.Fatalf("unknown key: err = %v, slept %v", err, *slept)
+	}
+
+	// One request left: the first goes at once, the second waits for the
+	// reset.
+	h := http.Header{}
+	h.Set("x-ratelimit-remaining-requests", "1")
+	h.Set("x-ratelimit-reset-requests", "10s")
+	l.Update("k", h, http.StatusOK)
+	if err := l.Wait(ctx, "k"); err != nil || len(*slept) != 0 {
+		t.Fatalf("first request: err = %v, slept %v", err, *slept)
+	}
+	if err := l.Wait(ctx, "k"); err != nil || fmt.Sprint(*slept) != "[10s]" {
+		t.Fatalf("second request: err = %v, slept %v", err, *slept)
+	}
+
+	// A wait beyond the maximum fails at once.
+	h = http.Header{}
+	h.Set("Retry-After", "300")
+	l.Update("k", h, http.StatusTooManyRequests)
+	var exhausted *ExhaustedError
+	if err := l.Wait(ctx, "k"); !errors.As(err, &exhausted) || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("long wait: err = %v", err)
+	}
+}
+
+func TestDo_RetriesAfter429(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if calls == 1 {
+			w.Header().Set("retry-after-ms", "20")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("x-ratelimit-remaining-requests", "41")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	l := New(time.Minute)
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+	key := Key(server.URL, "m")
+	resp, err := l.Do(server.Client(), req, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" || calls != 2 {
+		t.Errorf("status %d, body %q after %d calls", resp.StatusCode, body, calls)
+	}
+	if b := l.Budgets(); len(b) != 1 || b[0].RemainingRequests != 41 {
+		t.Errorf("budgets = %+v", b)
+	}
+}
@@ -0,0 +1,102 @@
+package providers
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// SplitThinking separates the reasoning that models such as DeepSeek-R1 and
+// QwQ write inline, in a leading <think>...</think> block, from the answer.
+// Some chat templates open the block in the prompt, so a closing tag
+// without an opening one ends the reasoning as well. A block that is never
+// closed, because the model ran out of tokens, is all reasoning.
+func SplitThinking(content string) (answer, reasoning string) {
+	trimmed := strings.TrimLeft(content, " \t\r\n")
+	if rest, ok := strings.CutPrefix(trimmed, thinkOpen); ok {
+		reasoning, answer, _ = strings.Cut(rest, thinkClose)
+		return strings.TrimSpace(answer), strings.TrimSpace(reasoning)
+	}
+	if !strings.Contains(content, thinkOpen) {
+		if before, after, ok := strings.Cut(content, thinkClose); ok {
+			return strings.TrimSpace(after), strings.TrimSpace(before)
+		}
+	}
+	return content, ""
+}
+
+// SeparateReasoning moves inline reasoning from resp.Content to
+// resp.ReasoningContent, so that only the answer reaches the user.
+func SeparateReasoning(resp *LLMResponse) {
+	if resp == nil {
+		return
+	}
+	answer, reasoning := SplitThinking(resp.Content)
+	if reasoning == "" {
+		return
+	}
+	resp.Content = answer
+	if resp.ReasoningContent != "" {
+		reasoning = resp.ReasoningContent + "\n\n" + reasoning
+	}
+	resp.ReasoningContent = reasoning
+}
+
+// HideThinking wraps a stream callback so that a leading <think> block is
+// not passed on. Text is held back only while it could still be the start
+// of the block or of its closing tag.
+func HideThinking(onDelta func(string)) func(string) {
+	if onDelta == nil {
+		return nil
+	}
+	const (
+		deciding = iota
+		thinking
+		answering
+	)
+	mode := deciding
+	var pending string
+	started := false
+	return func(delta string) {
+		pending += delta
+		for {
+			switch mode {
+			case deciding:
+				trimmed := strings.TrimLeft(pending, " \t\r\n")
+				switch {
+				case strings.HasPrefix(trimmed, thinkOpen):
+					pending = trimmed[len(thinkOpen):]
+					mode = thinking
+					continue
+				case strings.HasPrefix(thinkOpen, trimmed):
+					return // too short to tell yet
+				}
+				mode = answering
+				continue
+			case thinking:
+				_, after, ok := strings.Cut(pending, thinkClose)
+				if !ok {
+					// Keep what could be the start of the closing tag.
+					if n := len(pending) - len(thinkClose) + 1; n > 0 {
+						pending = pending[n:]
+					}
+					return
+				}
+				pending = after
+				mode = answering
+				continue
+			default:
+				if !started {
+					pending = strings.TrimLeft(pending, " \t\r\n")
+				}
+				if pending != "" {
+					started = true
+					onDelta(pending)
+					pending = ""
+				}
+				return
+			}
+		}
+	}
+}
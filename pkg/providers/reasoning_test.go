@@ -0,0 +1,60 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitThinking(t *testing.T) {
+	tests := []struct {
+		name, content, answer, reasoning string
+	}{
+		{"plain", "Hello", "Hello", ""},
+		{"leading block", "\n<think>\nadd them\n</think>\n\n2", "2", "add them"},
+		{"closing tag only", "add them</think>2", "2", "add them"},
+		{"unclosed", "<think>still going", "", "still going"},
+		{"tag in answer", "Use <think> to think", "Use <think> to think", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, reasoning := SplitThinking(tt.content)
+			if answer != tt.answer || reasoning != tt.reasoning {
+				t.Errorf("SplitThinking(%q) = %q, %q; want %q, %q",
+					tt.content, answer, reasoning, tt.answer, tt.reasoning)
+			}
+		})
+	}
+}
+
+func TestSeparateReasoning(t *testing.T) {
+	resp := &LLMResponse{Content: "<think>b</think>answer", ReasoningContent: "a"}
+	SeparateReasoning(resp)
+	if resp.Content != "answer" || resp.ReasoningContent != "a\n\nb" {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestHideThinking(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		want   string
+	}{
+		{"plain", []string{"Hel", "lo"}, "Hello"},
+		{"split tags", []string{"\n<th", "ink>x y", "</thi", "nk>\n\nHi", " there"}, "Hi there"},
+		{"looks like a tag", []string{"<", "b>bold</b>"}, "<b>bold</b>"},
+		{"never closed", []string{"<think>", "abc"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strings.Builder
+			onDelta := HideThinking(func(s string) { got.WriteString(s) })
+			for _, d := range tt.deltas {
+				onDelta(d)
+			}
+			if got.String() != tt.want {
+				t.Errorf("streamed %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
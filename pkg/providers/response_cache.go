@@ -0,0 +1,120 @@
+package providers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ResponseCache keeps LLM responses for a while, so that a prompt sent
+// again verbatim is answered without a request. Scheduled prompts, such as
+// heartbeats, repeat this way. Entries expire after the TTL; the least
+// recently used ones are evicted to keep the total size under the limit.
+// Thread-safe. In-memory only (resets on restart).
+type ResponseCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int
+	size     int
+	order    *list.List // of *responseCacheEntry, most recently used first
+	entries  map[string]*list.Element
+	nowFunc  func() time.Time // for testing
+}
+
+type responseCacheEntry struct {
+	key     string
+	resp    LLMResponse
+	size    int
+	expires time.Time
+}
+
+// NewResponseCache creates a cache whose entries live for ttl and take at
+// most maxBytes together.
+func NewResponseCache(ttl time.Duration, maxBytes int) *ResponseCache {
+	return &ResponseCache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		nowFunc:  time.Now,
+	}
+}
+
+// ResponseCacheKey hashes everything that shapes a response: the model,
+// the messages, the tool definitions and the request options.
+func ResponseCacheKey(model string, messages []Message, tools []ToolDefinition, options map[string]any) string {
+	data, _ := json.Marshal(struct {
+		Model    string           `json:"model"`
+		Messages []Message        `json:"messages"`
+		Tools    []ToolDefinition `json:"tools"`
+		Options  map[string]any   `json:"options"`
+	}{model, messages, tools, options})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns a copy of the response cached under key, without usage: a
+// cached answer costs no tokens.
+func (c *ResponseCache) Get(key string) (*LLMResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*responseCacheEntry)
+	if c.nowFunc().After(entry.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	resp := entry.resp
+	resp.Usage = nil
+	resp.ToolCalls = append([]ToolCall(nil), entry.resp.ToolCalls...)
+	return &resp, true
+}
+
+// Put caches resp under key. Responses larger than the whole cache are
+// not kept.
+func (c *ResponseCache) Put(key string, resp *LLMResponse) {
+	if resp == nil {
+		return
+	}
+	size := len(key) + len(resp.Content) + len(resp.ReasoningContent)
+	for _, tc := range resp.ToolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		size += len(tc.ID) + len(tc.Name) + len(args)
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	entry := &responseCacheEntry{
+		key:     key,
+		resp:    *resp,
+		size:    size,
+		expires: c.nowFunc().Add(c.ttl),
+	}
+	entry.resp.ToolCalls = append([]ToolCall(nil), resp.ToolCalls...)
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *ResponseCache) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*responseCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
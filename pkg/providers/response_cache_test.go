@@ -0,0 +1,48 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCache_TTLAndSize(t *testing.T) {
+	now := time.Now()
+	c := NewResponseCache(10*time.Minute, 300)
+	c.nowFunc = func() time.Time { return now }
+
+	msgs := []Message{{Role: "user", Content: "status?"}}
+	key := ResponseCacheKey("gpt-4o", msgs, nil, map[string]any{"temperature": 0.7})
+	if key == ResponseCacheKey("gpt-4o", msgs, nil, map[string]any{"temperature": 0.2}) ||
+		key == ResponseCacheKey("gpt-4o-mini", msgs, nil, map[string]any{"temperature": 0.7}) {
+		t.Fatal("key ignores the model or the options")
+	}
+
+	c.Put(key, &LLMResponse{Content: "all good", Usage: &UsageInfo{TotalTokens: 42}})
+	resp, ok := c.Get(key)
+	if !ok || resp.Content != "all good" || resp.Usage != nil {
+		t.Fatalf("Get() = %+v, %v", resp, ok)
+	}
+
+	now = now.Add(11 * time.Minute)
+	if _, ok := c.Get(key); ok {
+		t.Error("entry outlived its TTL")
+	}
+
+	// The least recently used entry makes room for new ones.
+	c.Put("a", &LLMResponse{Content: strings.Repeat("a", 100)})
+	c.Put("b", &LLMResponse{Content: strings.Repeat("b", 100)})
+	c.Get("a")
+	c.Put("c", &LLMResponse{Content: strings.Repeat("c", 100)})
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry was kept")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	c.Put("huge", &LLMResponse{Content: strings.Repeat("x", 400)})
+	if _, ok := c.Get("huge"); ok || c.size > 300 {
+		t.Errorf("oversized response cached, size = %d", c.size)
+	}
+}
@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// maxSchemaRepairs is how many times an answer that does not follow the
+// response schema is sent back to be fixed.
+const maxSchemaRepairs = 2
+
+// ResponseSchemaProvider is implemented by providers whose API can hold the
+// answer to a JSON schema given as the "response_schema" option.
+type ResponseSchemaProvider interface {
+	LLMProvider
+	SupportsResponseSchema() bool
+}
+
+// ChatStructured asks provider for an answer that follows schema and
+// returns it as JSON. Providers that support it get the schema natively;
+// the others are told about it in the system prompt. Either way the answer
+// is validated, and one that does not follow the schema is sent back with
+// the problems found, up to maxSchemaRepairs times.
+func ChatStructured(
+	ctx context.Context,
+	provider LLMProvider,
+	messages []Message,
+	model string,
+	options map[string]any,
+	schema ResponseSchema,
+) (json.RawMessage, error) {
+	opts := maps.Clone(options)
+	if opts == nil {
+		opts = map[string]any{}
+	}
+	msgs := append([]Message(nil), messages...)
+	if sp, ok := provider.(ResponseSchemaProvider); ok && sp.SupportsResponseSchema() {
+		opts["response_schema"] = schema
+	} else {
+		msgs = withSchemaInstructions(msgs, schema)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxSchemaRepairs; attempt++ {
+		resp, err := provider.Chat(ctx, msgs, nil, model, opts)
+		if err != nil {
+			return nil, err
+		}
+		data, err := extractJSON(resp.Content)
+		if err == nil {
+			var v any
+			_ = json.Unmarshal(data, &v)
+			err = validateSchema(schema.Schema, v)
+		}
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+		msgs = append(msgs,
+			Message{Role: "assistant", Content: resp.Content},
+			Message{Role: "user", Content: fmt.Sprintf(
+				"That answer does not follow the JSON schema:\n%v\n\nReply with the corrected JSON only.", err)},
+		)
+	}
+	return nil, fmt.Errorf("answer does not follow the %s schema: %w", schema.Name, lastErr)
+}
+
+func withSchemaInstructions(messages []Message, schema ResponseSchema) []Message {
+	data, _ := json.MarshalIndent(schema.Schema, "", "  ")
+	note := fmt.Sprintf("Answer only with a JSON value that follows this JSON schema, "+
+		"without any other text:\n%s", data)
+	if len(messages) > 0 && messages[0].Role == "system" {
+		messages[0].Content += "\n\n" + note
+		return messages
+	}
+	return append([]Message{{Role: "system", Content: note}}, messages...)
+}
+
+// extractJSON returns the JSON value in an answer, which models without
+// native support like to wrap in a code fence or a sentence.
+func extractJSON(content string) (json.RawMessage, error) {
+	text := strings.TrimSpace(content)
+	if json.Valid([]byte(text)) {
+		return json.RawMessage(text), nil
+	}
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return nil, fmt.Errorf("the answer contains no JSON")
+	}
+	closer := "}"
+	if text[start] == '[' {
+		closer = "]"
+	}
+	end := strings.LastIndex(text, closer)
+	if end < start || !json.Valid([]byte(text[start:end+1])) {
+		return nil, fmt.Errorf("the answer is not valid JSON")
+	}
+	return json.RawMessage(text[start : end+1]), nil
+}
@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var weatherSchema = ResponseSchema{
+	Name: "weather",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"city":    map[string]any{"type": "string"},
+			"celsius": map[string]any{"type": "integer"},
+			"sky":     map[string]any{"type": "string", "enum": []string{"clear", "cloudy", "rain"}},
+		},
+		"required":             []string{"city", "celsius"},
+		"additionalProperties": false,
+	},
+}
+
+// scriptedProvider answers with its replies in turn and keeps the requests.
+type scriptedProvider struct {
+	replies  []string
+	requests [][]Message
+	options  []map[string]any
+}
+
+func (p *scriptedProvider) Chat(
+	ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]any,
+) (*LLMResponse, error) {
+	p.requests = append(p.requests, messages)
+	p.options = append(p.options, options)
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return &LLMResponse{Content: reply}, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string { return "scripted" }
+
+func TestChatStructured_RepairsInvalidAnswers(t *testing.T) {
+	p := &scriptedProvider{replies: []string{
+		"Here you go:\n```json\n{\"city\": \"Oslo\", \"celsius\": 3.5}\n```",
+		`{"city": "Oslo", "celsius": 3, "sky": "cloudy"}`,
+	}}
+	msgs := []Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "weather in Oslo?"}}
+	data, err := ChatStructured(t.Context(), p, msgs, "claude-haiku-4-5", nil, weatherSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"city": "Oslo", "celsius": 3, "sky": "cloudy"}` {
+		t.Errorf("data = %s", data)
+	}
+
+	if len(p.requests) != 2 || p.options[0]["response_schema"] != nil {
+		t.Fatalf("requests = %d, options = %v", len(p.requests), p.options[0])
+	}
+	if !strings.Contains(p.requests[0][0].Content, `"celsius"`) || msgs[0].Content != "be brief" {
+		t.Errorf("system prompt = %q", p.requests[0][0].Content)
+	}
+	if repair := p.requests[1][len(p.requests[1])-1].Content; !strings.Contains(repair, "$.celsius: expected integer") {
+		t.Errorf("repair request = %q", repair)
+	}
+
+	p = &scriptedProvider{replies: []string{"no idea", "still no idea", "sorry"}}
+	if _, err := ChatStructured(t.Context(), p, msgs, "m", nil, weatherSchema); err == nil || len(p.requests) != 3 {
+		t.Errorf("err = %v after %d requests", err, len(p.requests))
+	}
+}
+
+func TestChatStructured_NativeSchema(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"city\":\"Oslo\",\"celsius\":3}"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("key", server.URL, "")
+	data, err := ChatStructured(t.Context(), p, []Message{{Role: "user", Content: "weather in Oslo?"}}, "gpt-4o", nil, weatherSchema)
+	if err != nil || string(data) != `{"city":"Oslo","celsius":3}` {
+		t.Fatalf("ChatStructured() = %s, %v", data, err)
+	}
+	format, _ := body["response_format"].(map[string]any)
+	spec, _ := format["json_schema"].(map[string]any)
+	if format["type"] != "json_schema" || spec["name"] != "weather" || spec["schema"] == nil {
+		t.Errorf("response_format = %v", body["response_format"])
+	}
+	if msgs := body["messages"].([]any); len(msgs) != 1 {
+		t.Errorf("schema was also put in the prompt: %v", msgs)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`{"city":"Oslo","celsius":3}`, ""},
+		{`{"city":"Oslo"}`, `missing required property "celsius"`},
+		{`{"city":"Oslo","celsius":3,"wind":4}`, `unexpected property "wind"`},
+		{`{"city":"Oslo","celsius":3,"sky":"snow"}`, `$.sky: snow is not one of`},
+		{`[1]`, `$: expected object, got array`},
+	}
+	for _, tt := range tests {
+		var v any
+		json.Unmarshal([]byte(tt.json), &v)
+		err := validateSchema(weatherSchema.Schema, v)
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("validateSchema(%s) = %v, want %q", tt.json, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// textToolsProvider offers tools to a model without native function
+// calling. The tools are described in the system prompt, the model asks for
+// them in plain text, ReAct style ("Action: ... / Action Input: {...}"),
+// and the calls are parsed back out of its answer. Earlier calls and their
+// results are replayed to the model in the same text form.
+type textToolsProvider struct {
+	inner LLMProvider
+}
+
+// WrapTextTools returns p with tools offered in the prompt rather than
+// through the API, for models that have no function calling.
+func WrapTextTools(p LLMProvider) LLMProvider {
+	if p == nil {
+		return nil
+	}
+	return &textToolsProvider{inner: p}
+}
+
+func (p *textToolsProvider) GetDefaultModel() string {
+	return p.inner.GetDefaultModel()
+}
+
+func (p *textToolsProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	resp, err := p.inner.Chat(ctx, textToolMessages(messages, tools), nil, model, options)
+	if err != nil || resp == nil || len(tools) == 0 {
+		return resp, err
+	}
+
+	answer, reasoning := SplitThinking(resp.Content)
+	if reasoning != "" {
+		resp.ReasoningContent = strings.TrimSpace(resp.ReasoningContent + "\n\n" + reasoning)
+	}
+	calls, content := ParseTextToolCalls(answer, tools)
+	resp.Content = content
+	if len(calls) > 0 {
+		resp.ToolCalls = calls
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+func (p *textToolsProvider) SupportsResponseSchema() bool {
+	sp, ok := p.inner.(ResponseSchemaProvider)
+	return ok && sp.SupportsResponseSchema()
+}
+
+func (p *textToolsProvider) Close() {
+	if sp, ok := p.inner.(StatefulProvider); ok {
+		sp.Close()
+	}
+}
+
+// textToolMessages rewrites a conversation for a model that only reads
+// text: the tools are described at the end of the system prompt, tool
+// calls become Action lines of the assistant, and tool results become user
+// messages with the Observation.
+func textToolMessages(messages []Message, tools []ToolDefinition) []Message {
+	out := make([]Message, 0, len(messages)+1)
+	if len(tools) > 0 {
+		section := textToolsPrompt(tools)
+		if len(messages) > 0 && messages[0].Role == "system" {
+			system := messages[0]
+			system.Content = strings.TrimRight(system.Content, "\n") + "\n\n" + section
+			out = append(out, system)
+			messages = messages[1:]
+		} else {
+			out = append(out, Message{Role: "system", Content: section})
+		}
+	}
+
+	names := make(map[string]string) // tool call ID -> tool name
+	for _, m := range messages {
+		switch {
+		case m.Role == "assistant" && len(m.ToolCalls) > 0:
+			var sb strings.Builder
+			if text := strings.TrimSpace(m.Content); text != "" {
+				sb.WriteString("Thought: " + text + "\n")
+			}
+			for _, tc := range m.ToolCalls {
+				tc = NormalizeToolCall(tc)
+				names[tc.ID] = tc.Name
+				args, _ := json.Marshal(tc.Arguments)
+				fmt.Fprintf(&sb, "Action: %s\nAction Input: %s\n", tc.Name, args)
+			}
+			m.Content = strings.TrimRight(sb.String(), "\n")
+			m.ToolCalls = nil
+		case m.Role == "tool":
+			name := names[m.ToolCallID]
+			if name == "" {
+				name = "tool"
+			}
+			observation := fmt.Sprintf("Observation from %s:\n%s", name, m.Content)
+			// Results of several calls go back in one message, so that
+			// user and assistant turns keep alternating.
+			if last := len(out) - 1; last >= 0 && out[last].Role == "user" &&
+				strings.HasPrefix(out[last].Content, "Observation from ") {
+				out[last].Content += "\n\n" + observation
+				continue
+			}
+			m = Message{Role: "user", Content: observation}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// textToolsPrompt describes the tools and how to call them.
+func textToolsPrompt(tools []ToolDefinition) string {
+	var sb strings.Builder
+	sb.WriteString("## Using Tools\n\n")
+	sb.WriteString("To use a tool, reply with these lines and stop:\n\n")
+	sb.WriteString("Thought: why you need the tool\n")
+	sb.WriteString("Action: the tool name\n")
+	sb.WriteString("Action Input: the arguments as one JSON object on one line\n\n")
+	sb.WriteString("The result comes back as an Observation. Use one tool at a time; ")
+	sb.WriteString("when you know the answer, reply with:\n\n")
+	sb.WriteString("Final Answer: your answer to the user\n\n")
+	sb.WriteString("### Tools\n")
+	for _, t := range tools {
+		fmt.Fprintf(&sb, "\n%s: %s\n", t.Function.Name, strings.TrimSpace(t.Function.Description))
+		props, _ := t.Function.Parameters["properties"].(map[string]any)
+		if len(props) == 0 {
+			sb.WriteString("  Action Input: {}\n")
+			continue
+		}
+		required := requiredParams(t)
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			// Required arguments first, then by name.
+			ri, rj := slices.Contains(required, keys[i]), slices.Contains(required, keys[j])
+			if ri != rj {
+				return ri
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys {
+			prop, _ := props[k].(map[string]any)
+			typ, _ := prop["type"].(string)
+			desc, _ := prop["description"].(string)
+			flag := "optional"
+			if slices.Contains(required, k) {
+				flag = "required"
+			}
+			fmt.Fprintf(&sb, "  - %s (%s, %s)", k, typ, flag)
+			if desc != "" {
+				sb.WriteString(": " + desc)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func requiredParams(t ToolDefinition) []string {
+	var out []string
+	switch r := t.Function.Parameters["required"].(type) {
+	case []string:
+		out = r
+	case []any:
+		for _, v := range r {
+			if s, ok := v.(string); ok {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+var (
+	actionLine      = regexp.MustCompile(`(?im)^[ \t*]*Action[ \t*]*:[ \t*]*(.+?)[ \t*]*$`)
+	actionInputLine = regexp.MustCompile(`(?i)^[ \t*]*Action[ \t_]*Input[ \t*]*:[ \t*]*`)
+	finalAnswerLine = regexp.MustCompile(`(?im)^[ \t*]*Final[ \t]*Answer[ \t*]*:[ \t*]*`)
+	// The end of an Action Input: the next step, or an Observation the
+	// model made up instead of waiting for it.
+	stepLine    = regexp.MustCompile(`(?im)^[ \t*]*(Thought|Action|Observation|Final[ \t]*Answer)[ \t*]*:`)
+	thoughtLine = regexp.MustCompile(`(?im)^[ \t*]*Thought[ \t*]*:[ \t*]*`)
+	hermesCall  = regexp.MustCompile(`(?s)<tool_call>\s*(.*?)\s*(?:</tool_call>|$)`)
+	fencedBlock = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*\\n(.*?)```")
+)
+
+// textToolCallSeq numbers parsed tool calls, which have no ID of their own.
+var textToolCallSeq atomic.Uint64
+
+// ParseTextToolCalls finds the calls of tools in a model's plain-text
+// answer, and returns them with the text to keep as the content. It reads
+// ReAct "Action:"/"Action Input:" lines, <tool_call> blocks as Hermes and
+// Qwen models write them, and a JSON object naming a tool, in a code block
+// or on its own. Tool names are matched loosely and broken JSON arguments
+// repaired; a call of a tool that is not offered is left as text.
+func ParseTextToolCalls(text string, tools []ToolDefinition) ([]ToolCall, string) {
+	if calls, rest := parseReActCalls(text, tools); len(calls) > 0 {
+		return calls, rest
+	}
+	if m := hermesCall.FindAllStringSubmatchIndex(text, -1); len(m) > 0 {
+		var calls []ToolCall
+		for _, loc := range m {
+			if tc, ok := jsonToolCall(text[loc[2]:loc[3]], tools); ok {
+				calls = append(calls, tc)
+			}
+		}
+		if len(calls) > 0 {
+			return calls, strings.TrimSpace(text[:m[0][0]])
+		}
+	}
+	if calls := extractToolCallsFromText(text); len(calls) > 0 {
+		var known []ToolCall
+		for _, tc := range calls {
+			if name, ok := matchToolName(tc.Name, tools); ok {
+				tc.Name, tc.Function.Name = name, name
+				known = append(known, tc)
+			}
+		}
+		if len(known) > 0 {
+			return known, stripToolCallsFromText(text)
+		}
+	}
+	for _, m := range fencedBlock.FindAllStringSubmatchIndex(text, -1) {
+		if tc, ok := jsonToolCall(text[m[2]:m[3]], tools); ok {
+			return []ToolCall{tc}, strings.TrimSpace(text[:m[0]])
+		}
+	}
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "{") {
+		if tc, ok := jsonToolCall(trimmed, tools); ok {
+			return []ToolCall{tc}, ""
+		}
+	}
+	return nil, finalAnswer(text)
+}
+
+// finalAnswer returns the part of a reply meant for the user.
+func finalAnswer(text string) string {
+	if loc := finalAnswerLine.FindStringIndex(text); loc != nil {
+		return strings.TrimSpace(text[loc[1]:])
+	}
+	return strings.TrimSpace(text)
+}
+
+func parseReActCalls(text string, tools []ToolDefinition) ([]ToolCall, string) {
+	actions := actionLine.FindAllStringSubmatchIndex(text, -1)
+	if len(actions) == 0 {
+		return nil, ""
+	}
+	// A Final Answer before the first Action is the answer.
+	if loc := finalAnswerLine.FindStringIndex(text); loc != nil && loc[0] < actions[0][0] {
+		return nil, ""
+	}
+
+	var calls []ToolCall
+	for i, a := range actions {
+		name, ok := matchToolName(text[a[2]:a[3]], tools)
+		if !ok {
+			continue
+		}
+		// The input runs from the Action Input label to the next step.
+		rest := text[a[1]:]
+		if i+1 < len(actions) {
+			rest = text[a[1]:actions[i+1][0]]
+		}
+		rest = strings.TrimLeft(rest, "\r\n")
+		input := ""
+		if loc := actionInputLine.FindStringIndex(rest); loc != nil {
+			input = rest[loc[1]:]
+			if next := stepLine.FindStringIndex(input); next != nil {
+				input = input[:next[0]]
+			}
+		}
+		calls = append(calls, newTextToolCall(name, parseArguments(input, toolByName(name, tools))))
+	}
+	if len(calls) == 0 {
+		return nil, ""
+	}
+	thought := strings.TrimSpace(text[:actions[0][0]])
+	if loc := thoughtLine.FindStringIndex(thought); loc != nil && loc[0] == 0 {
+		thought = strings.TrimSpace(thought[loc[1]:])
+	}
+	return calls, thought
+}
+
+// jsonToolCall reads a call written as a JSON object, such as
+// {"name": "read_file", "arguments": {"path": "a.txt"}}.
+func jsonToolCall(s string, tools []ToolDefinition) (ToolCall, bool) {
+	obj, ok := RepairJSONObject(s)
+	if !ok {
+		return ToolCall{}, false
+	}
+	if fn, ok := obj["function"].(map[string]any); ok {
+		obj = fn
+	}
+	var rawName string
+	for _, key := range []string{"name", "tool", "tool_name", "action"} {
+		if v, ok := obj[key].(string); ok && v != "" {
+			rawName = v
+			break
+		}
+	}
+	name, ok := matchToolName(rawName, tools)
+	if !ok {
+		return ToolCall{}, false
+	}
+	var args map[string]any
+	for _, key := range []string{"arguments", "parameters", "args", "action_input", "input"} {
+		switch v := obj[key].(type) {
+		case map[string]any:
+			args = v
+		case string:
+			args = parseArguments(v, toolByName(name, tools))
+		}
+		if args != nil {
+			break
+		}
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+	return newTextToolCall(name, args), true
+}
+
+func newTextToolCall(name string, args map[string]any) ToolCall {
+	argsJSON, _ := json.Marshal(args)
+	return ToolCall{
+		ID:        fmt.Sprintf("call_text_%d", textToolCallSeq.Add(1)),
+		Type:      "function",
+		Name:      name,
+		Arguments: args,
+		Function:  &FunctionCall{Name: name, Arguments: string(argsJSON)},
+	}
+}
+
+// parseArguments reads an Action Input. Input that is no JSON object even
+// after repair is taken as the value of the tool's only required argument,
+// so "Action Input: ls -la" still runs a command.
+func parseArguments(input string, tool *ToolDefinition) map[string]any {
+	input = strings.TrimSpace(input)
+	if obj, ok := RepairJSONObject(input); ok {
+		return obj
+	}
+	if input == "" || tool == nil {
+		return map[string]any{}
+	}
+	required := requiredParams(*tool)
+	if len(required) != 1 {
+		return map[string]any{}
+	}
+	value := strings.Trim(strings.TrimSpace(strings.Trim(input, "`")), `"'`)
+	return map[string]any{required[0]: value}
+}
+
+func toolByName(name string, tools []ToolDefinition) *ToolDefinition {
+	for i := range tools {
+		if tools[i].Function.Name == name {
+			return &tools[i]
+		}
+	}
+	return nil
+}
+
+// matchToolName finds the offered tool a model meant: "Read_File",
+// "read-file", "`read_file`" and "read_file()" all name read_file.
+func matchToolName(raw string, tools []ToolDefinition) (string, bool) {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(s))
+		s = strings.Trim(s, "`'\"*[]")
+		s = strings.TrimSuffix(s, "()")
+		return strings.NewReplacer("-", "_", " ", "_").Replace(s)
+	}
+	want := normalize(raw)
+	if want == "" {
+		return "", false
+	}
+	for _, t := range tools {
+		if t.Function.Name == raw || normalize(t.Function.Name) == want {
+			return t.Function.Name, true
+		}
+	}
+	return "", false
+}
+
+var (
+	trailingComma = regexp.MustCompile(`,(\s*[}\]])`)
+	bareKey       = regexp.MustCompile(`([{,]\s*)([A-Za-z_][A-Za-z0-9_]*)\s*:`)
+)
+
+// RepairJSONObject parses s as a JSON object, fixing what small models get
+// wrong: code fences and text around the object, single quotes, unquoted
+// keys, trailing commas, typographic quotes and missing closing brackets.
+func RepairJSONObject(s string) (map[string]any, bool) {
+	s = strings.TrimSpace(s)
+	if m := fencedBlock.FindStringSubmatch(s); m != nil {
+		s = strings.TrimSpace(m[1])
+	}
+	start := strings.Index(s, "{")
+	if start < 0 {
+		return nil, false
+	}
+	s = s[start:]
+	if end := findMatchingBrace(s, 0); end > 0 {
+		s = s[:end]
+	}
+
+	var obj map[string]any
+	if json.Unmarshal([]byte(s), &obj) == nil {
+		return obj, true
+	}
+	s = strings.NewReplacer("“", `"`, "”", `"`, "‘", "'", "’", "'").Replace(s)
+	if !strings.Contains(s, `"`) {
+		s = strings.ReplaceAll(s, "'", `"`)
+	}
+	s = bareKey.ReplaceAllString(s, `$1"$2":`)
+	s = trailingComma.ReplaceAllString(s, "$1")
+	s = closeJSON(s)
+	if json.Unmarshal([]byte(s), &obj) == nil {
+		return obj, true
+	}
+	return nil, false
+}
+
+// closeJSON appends the quote and brackets a cut-off JSON value is
+// missing.
+func closeJSON(s string) string {
+	var open []byte
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			open = append(open, '}')
+		case c == '[':
+			open = append(open, ']')
+		case (c == '}' || c == ']') && len(open) > 0:
+			open = open[:len(open)-1]
+		}
+	}
+	if inString {
+		s += `"`
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		s += string(open[i])
+	}
+	return s
+}
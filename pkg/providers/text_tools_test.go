@@ -0,0 +1,220 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var textTestTools = []ToolDefinition{
+	{Type: "function", Function: ToolFunctionDefinition{
+		Name:        "read_file",
+		Description: "Read a file",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"path": map[string]any{"type": "string", "description": "File path"}},
+			"required":   []any{"path"},
+		},
+	}},
+	{Type: "function", Function: ToolFunctionDefinition{
+		Name:        "exec",
+		Description: "Run a shell command",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command":     map[string]any{"type": "string"},
+				"working_dir": map[string]any{"type": "string"},
+			},
+			"required": []string{"command"},
+		},
+	}},
+}
+
+func TestParseTextToolCalls(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantCalls   string // name(args JSON); ...
+		wantContent string
+	}{
+		{
+			name:        "react",
+			text:        "Thought: I need the notes.\nAction: read_file\nAction Input: {\"path\": \"notes.md\"}",
+			wantCalls:   `read_file({"path":"notes.md"})`,
+			wantContent: "I need the notes.",
+		},
+		{
+			name:      "react with a made-up observation",
+			text:      "Action: exec\nAction Input: {\"command\": \"ls\"}\nObservation: a.txt b.txt\nFinal Answer: two files",
+			wantCalls: `exec({"command":"ls"})`,
+		},
+		{
+			name:      "two actions, loose names, broken JSON",
+			text:      "Action: Read-File\nAction Input: {path: 'a.txt',}\nAction: `exec`\nAction Input: {\"command\": \"wc -l a.txt\"",
+			wantCalls: `read_file({"path":"a.txt"}); exec({"command":"wc -l a.txt"})`,
+		},
+		{
+			name:      "plain input for the only required argument",
+			text:      "Action: exec\nAction Input: ls -la",
+			wantCalls: `exec({"command":"ls -la"})`,
+		},
+		{
+			name:      "multi-line input",
+			text:      "Action: exec\nAction Input: {\n  \"command\": \"date\",\n  \"working_dir\": \"/tmp\"\n}\n",
+			wantCalls: `exec({"command":"date","working_dir":"/tmp"})`,
+		},
+		{
+			name:      "hermes tool_call block",
+			text:      "<tool_call>\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"x\"}}\n</tool_call>",
+			wantCalls: `read_file({"path":"x"})`,
+		},
+		{
+			name:        "json in a code block",
+			text:        "Let me look.\n```json\n{\"tool\": \"read_file\", \"parameters\": {\"path\": \"y\"}}\n```",
+			wantCalls:   `read_file({"path":"y"})`,
+			wantContent: "Let me look.",
+		},
+		{
+			name:      "tool_calls object",
+			text:      `{"tool_calls":[{"id":"c1","type":"function","function":{"name":"exec","arguments":"{\"command\":\"pwd\"}"}}]}`,
+			wantCalls: `exec({"command":"pwd"})`,
+		},
+		{
+			name:        "final answer",
+			text:        "Thought: I know this.\nFinal Answer: Paris.",
+			wantContent: "Paris.",
+		},
+		{
+			name:        "final answer mentioning an action",
+			text:        "Final Answer: next time, use\nAction: exec",
+			wantContent: "next time, use\nAction: exec",
+		},
+		{
+			name:        "unknown tool stays text",
+			text:        "Action: send_email\nAction Input: {}",
+			wantContent: "Action: send_email\nAction Input: {}",
+		},
+		{
+			name:        "plain answer",
+			text:        "Hello there!",
+			wantContent: "Hello there!",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, content := ParseTextToolCalls(tt.text, textTestTools)
+			var got []string
+			for _, tc := range calls {
+				args, _ := json.Marshal(tc.Arguments)
+				got = append(got, tc.Name+"("+string(args)+")")
+				if tc.ID == "" || tc.Function == nil || tc.Function.Arguments != string(args) {
+					t.Errorf("incomplete call %+v", tc)
+				}
+			}
+			if g := strings.Join(got, "; "); g != tt.wantCalls {
+				t.Errorf("calls = %s, want %s", g, tt.wantCalls)
+			}
+			if content != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestRepairJSONObject(t *testing.T) {
+	tests := map[string]string{
+		`{"a": 1}`:                       `{"a":1}`,
+		"```json\n{\"a\": [1, 2,]}\n```": `{"a":[1,2]}`,
+		`{a: 'b', c: 'd'}`:               `{"a":"b","c":"d"}`,
+		`Sure: {"a": {"b": "c`:           `{"a":{"b":"c"}}`,
+		`{“a”: “b”}`:                     `{"a":"b"}`,
+	}
+	for in, want := range tests {
+		obj, ok := RepairJSONObject(in)
+		got, _ := json.Marshal(obj)
+		if !ok || string(got) != want {
+			t.Errorf("RepairJSONObject(%q) = %s, %v; want %s", in, got, ok, want)
+		}
+	}
+	if _, ok := RepairJSONObject("no json here"); ok {
+		t.Error("text without an object was accepted")
+	}
+}
+
+// textOnlyProvider answers with one scripted reply per request and keeps
+// what it was sent.
+type textOnlyProvider struct {
+	replies  []string
+	requests [][]Message
+	tools    []int
+}
+
+func (p *textOnlyProvider) Chat(
+	ctx context.Context,
+	messages []Message,
+	tools []ToolDefinition,
+	model string,
+	options map[string]any,
+) (*LLMResponse, error) {
+	p.requests = append(p.requests, messages)
+	p.tools = append(p.tools, len(tools))
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return &LLMResponse{Content: reply, FinishReason: "stop"}, nil
+}
+
+func (p *textOnlyProvider) GetDefaultModel() string { return "small" }
+
+func TestTextToolsProvider(t *testing.T) {
+	inner := &textOnlyProvider{replies: []string{
+		"<think>The user wants the file.</think>\nAction: read_file\nAction Input: {\"path\": \"todo.txt\"}",
+		"Final Answer: You have 2 tasks.",
+	}}
+	p := WrapTextTools(inner)
+
+	messages := []Message{
+		{Role: "system", Content: "You are picoclaw."},
+		{Role: "user", Content: "What is on my list?"},
+	}
+	resp, err := p.Chat(context.Background(), messages, textTestTools, "small", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "read_file" || resp.FinishReason != "tool_calls" {
+		t.Fatalf("response = %+v", resp)
+	}
+	if resp.ReasoningContent != "The user wants the file." {
+		t.Errorf("reasoning = %q", resp.ReasoningContent)
+	}
+	system := inner.requests[0][0].Content
+	if inner.tools[0] != 0 || !strings.HasPrefix(system, "You are picoclaw.\n\n## Using Tools") ||
+		!strings.Contains(system, "  - path (string, required): File path") {
+		t.Errorf("first request: %d tools, system prompt %q", inner.tools[0], system)
+	}
+
+	// The agent sends the call and its result back.
+	call := resp.ToolCalls[0]
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: []ToolCall{call}},
+		Message{Role: "tool", ToolCallID: call.ID, Content: "- milk\n- eggs"},
+	)
+	resp, err = p.Chat(context.Background(), messages, textTestTools, "small", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "You have 2 tasks." || len(resp.ToolCalls) != 0 {
+		t.Errorf("final response = %+v", resp)
+	}
+	sent := inner.requests[1]
+	if len(sent) != 4 {
+		t.Fatalf("second request has %d messages: %+v", len(sent), sent)
+	}
+	if sent[2].Role != "assistant" || sent[2].Content != "Action: read_file\nAction Input: {\"path\":\"todo.txt\"}" ||
+		len(sent[2].ToolCalls) != 0 {
+		t.Errorf("replayed call = %+v", sent[2])
+	}
+	if sent[3].Role != "user" || sent[3].Content != "Observation from read_file:\n- milk\n- eggs" {
+		t.Errorf("replayed result = %+v", sent[3])
+	}
+}
@@ -17,6 +17,7 @@ type (
 	ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
 	ExtraContent           = protocoltypes.ExtraContent
 	GoogleExtra            = protocoltypes.GoogleExtra
+	ResponseSchema         = protocoltypes.ResponseSchema
 )
 
 type LLMProvider interface {
@@ -30,6 +31,50 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// StreamingProvider is implemented by providers that can report the
+// assistant's text incrementally. onDelta is called with each new chunk of
+// content; the returned response is the same as Chat would have produced.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(
+		ctx context.Context,
+		messages []Message,
+		tools []ToolDefinition,
+		model string,
+		options map[string]any,
+		onDelta func(delta string),
+	) (*LLMResponse, error)
+}
+
+// ToolStreamingProvider is a StreamingProvider that also reports tool calls
+// while the response is being generated. onToolCall is called, in order and
+// at most once per call, as soon as a call's arguments are complete; calls
+// it was not given for are still in the returned response.
+type ToolStreamingProvider interface {
+	StreamingProvider
+	ChatStreamTools(
+		ctx context.Context,
+		messages []Message,
+		tools []ToolDefinition,
+		model string,
+		options map[string]any,
+		onDelta func(delta string),
+		onToolCall func(ToolCall),
+	) (*LLMResponse, error)
+}
+
+// EmbeddingProvider is implemented by providers that can turn texts into
+// embedding vectors.
+type EmbeddingProvider interface {
+	Embed(ctx context.Context, model string, input []string) ([][]float32, error)
+}
+
+// HealthChecker is implemented by providers that can tell whether their
+// backend is reachable, such as a local model server.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
 type StatefulProvider interface {
 	LLMProvider
 	Close()
@@ -14,6 +14,7 @@ type RouteInput struct {
 	ParentPeer *RoutePeer
 	GuildID    string
 	TeamID     string
+	ThreadID   string // thread or topic within the peer, if any
 }
 
 // ResolvedRoute is the result of agent routing.
@@ -61,6 +62,7 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 			Peer:          peer,
 			DMScope:       dmScope,
 			IdentityLinks: identityLinks,
+			ThreadID:      input.ThreadID,
 		}))
 		mainSessionKey := strings.ToLower(BuildAgentMainSessionKey(resolvedAgentID))
 		return ResolvedRoute{
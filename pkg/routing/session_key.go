@@ -29,6 +29,9 @@ type SessionKeyParams struct {
 	Peer          *RoutePeer
 	DMScope       DMScope
 	IdentityLinks map[string][]string
+	// ThreadID separates threads in a group chat into their own sessions.
+	// Direct chats ignore it and stay one conversation.
+	ThreadID string
 }
 
 // ParsedSessionKey is the result of parsing an agent-scoped session key.
@@ -90,13 +93,21 @@ func BuildAgentPeerSessionKey(params SessionKeyParams) string {
 		return BuildAgentMainSessionKey(agentID)
 	}
 
-	// Group/channel peers always get per-peer sessions
+	// Group/channel peers always get per-peer sessions. Chats seen through
+	// a named account are kept apart from the same chat on the default one.
 	channel := normalizeChannel(params.Channel)
+	if accountID := NormalizeAccountID(params.AccountID); accountID != DefaultAccountID {
+		channel += "@" + accountID
+	}
 	peerID := strings.ToLower(strings.TrimSpace(peer.ID))
 	if peerID == "" {
 		peerID = "unknown"
 	}
-	return fmt.Sprintf("agent:%s:%s:%s:%s", agentID, channel, peerKind, peerID)
+	key := fmt.Sprintf("agent:%s:%s:%s:%s", agentID, channel, peerKind, peerID)
+	if threadID := strings.ToLower(strings.TrimSpace(params.ThreadID)); threadID != "" {
+		key += ":thread:" + threadID
+	}
+	return key
 }
 
 // ParseAgentSessionKey extracts agentId and rest from "agent:<agentId>:<rest>".
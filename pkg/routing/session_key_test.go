@@ -84,6 +84,46 @@ func TestBuildAgentPeerSessionKey_GroupPeer(t *testing.T) {
 	}
 }
 
+func TestBuildAgentPeerSessionKey_GroupPeerWithAccount(t *testing.T) {
+	got := BuildAgentPeerSessionKey(SessionKeyParams{
+		AgentID:   "main",
+		Channel:   "telegram",
+		AccountID: "Work",
+		Peer:      &RoutePeer{Kind: "group", ID: "chat456"},
+	})
+	want := "agent:main:telegram@work:group:chat456"
+	if got != want {
+		t.Errorf("GroupPeerWithAccount = %q, want %q", got, want)
+	}
+}
+
+func TestBuildAgentPeerSessionKey_GroupThread(t *testing.T) {
+	got := BuildAgentPeerSessionKey(SessionKeyParams{
+		AgentID:  "main",
+		Channel:  "slack",
+		Peer:     &RoutePeer{Kind: "channel", ID: "C123"},
+		ThreadID: "1700000000.000100",
+	})
+	want := "agent:main:slack:channel:c123:thread:1700000000.000100"
+	if got != want {
+		t.Errorf("GroupThread = %q, want %q", got, want)
+	}
+}
+
+func TestBuildAgentPeerSessionKey_DirectIgnoresThread(t *testing.T) {
+	got := BuildAgentPeerSessionKey(SessionKeyParams{
+		AgentID:  "main",
+		Channel:  "slack",
+		Peer:     &RoutePeer{Kind: "direct", ID: "U1"},
+		DMScope:  DMScopePerPeer,
+		ThreadID: "1700000000.000100",
+	})
+	want := "agent:main:direct:u1"
+	if got != want {
+		t.Errorf("DirectIgnoresThread = %q, want %q", got, want)
+	}
+}
+
 func TestBuildAgentPeerSessionKey_NilPeer(t *testing.T) {
 	got := BuildAgentPeerSessionKey(SessionKeyParams{
 		AgentID: "main",
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package service
+
+// Attach connects the process to the Windows service manager; elsewhere
+// the channel is nil and stopped does nothing.
+func Attach() (stop <-chan struct{}, stopped func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,62 @@
+//go:build windows
+
+package service
+
+import (
+	"sync"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// stopWaitHint is how long the service manager is told stopping may take,
+// enough for the gateway to drain its runs.
+const stopWaitHint = 60_000 // ms
+
+// Attach connects the process to the Windows service manager when it was
+// started as a service. The returned channel is closed when the manager
+// asks the service to stop, and stopped must be called once the gateway
+// has stopped; it returns when the manager knows. Outside the service
+// manager the channel is nil and stopped does nothing.
+func Attach() (stop <-chan struct{}, stopped func()) {
+	if is, err := svc.IsWindowsService(); err != nil || !is {
+		return nil, func() {}
+	}
+	h := &handler{stop: make(chan struct{}), stopped: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.Run(Name, h)
+	}()
+	return h.stop, sync.OnceFunc(func() {
+		close(h.stopped)
+		<-done
+	})
+}
+
+// handler reports the gateway's state to the service manager.
+type handler struct {
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: stopWaitHint}
+				close(h.stop)
+				<-h.stopped
+				return false, 0
+			}
+		case <-h.stopped:
+			// The gateway stopped without being asked; a non-zero exit
+			// code lets the recovery actions restart it.
+			return false, 1
+		}
+	}
+}
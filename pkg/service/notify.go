@@ -0,0 +1,51 @@
+// Package service runs picoclaw as a long-running service: it talks the
+// systemd notify protocol and the Windows service manager's, and writes the
+// systemd unit or launchd plist, or the Windows service, that start the
+// gateway at boot.
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state, such as "READY=1" or "WATCHDOG=1", to the service
+// manager that started the process. It reports false when there is none
+// listening, which is the case outside systemd.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ names a socket in the abstract namespace.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("notify %s: %w", os.Getenv("NOTIFY_SOCKET"), err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("notify %s: %w", os.Getenv("NOTIFY_SOCKET"), err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often the service manager expects
+// "WATCHDOG=1" before it restarts the process, or 0 when it does not watch
+// this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	// The watchdog of a parent process is inherited through the environment.
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
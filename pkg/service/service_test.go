@@ -0,0 +1,160 @@
+package service
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify("READY=1"); sent || err != nil {
+		t.Fatalf("Notify without a socket = %v, %v", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if sent, err := Notify("READY=1\nSTATUS=Serving"); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1\nSTATUS=Serving" {
+		t.Errorf("received %q, %v", buf[:n], err)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "gone.sock"))
+	if sent, err := Notify("WATCHDOG=1"); sent || err == nil {
+		t.Errorf("Notify to a missing socket = %v, %v", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"junk", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", strconv.Itoa(os.Getpid()), 30 * time.Second},
+		{"30000000", "1", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := WatchdogInterval(); got != tt.want {
+			t.Errorf("WatchdogInterval(usec=%q, pid=%q) = %v, want %v", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := SystemdUnit(Options{
+		Binary:          "/opt/pico claw/picoclaw",
+		Args:            []string{"gateway", "--strict"},
+		System:          true,
+		User:            "pi",
+		WatchdogSeconds: 60,
+	})
+	for _, want := range []string{
+		"Type=notify\n",
+		`ExecStart="/opt/pico claw/picoclaw" gateway --strict` + "\n",
+		"ExecReload=/bin/kill -HUP $MAINPID\n",
+		"WatchdogSec=60\n",
+		"User=pi\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit lacks %q:\n%s", want, unit)
+		}
+	}
+
+	unit = SystemdUnit(Options{Binary: "/usr/bin/picoclaw", Args: []string{"gateway"}, User: "pi"})
+	if strings.Contains(unit, "WatchdogSec") || strings.Contains(unit, "User=") ||
+		!strings.Contains(unit, "WantedBy=default.target\n") {
+		t.Errorf("user unit:\n%s", unit)
+	}
+}
+
+func TestSystemdCommand(t *testing.T) {
+	if got := systemdCommand("/bin/picoclaw", []string{"gateway", `a "b"`, "100%", "$HOME"}); got !=
+		`/bin/picoclaw gateway "a \"b\"" 100%% $$HOME` {
+		t.Errorf("systemdCommand = %s", got)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := LaunchdPlist(Options{Binary: "/usr/local/bin/picoclaw", Args: []string{"gateway"}, LogDir: "/Users/a&b/logs"})
+	for _, want := range []string{
+		"<string>" + Label + "</string>",
+		"<string>/usr/local/bin/picoclaw</string>\n\t\t<string>gateway</string>",
+		"<key>KeepAlive</key>\n\t<true/>",
+		"<string>/Users/a&amp;b/logs/gateway.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("plist lacks %q:\n%s", want, plist)
+		}
+	}
+	if strings.Contains(plist, "UserName") {
+		t.Errorf("user agent names a user:\n%s", plist)
+	}
+}
+
+func TestWindowsServiceCommands(t *testing.T) {
+	cmds := WindowsServiceCommands(Options{Binary: `C:\Program Files\picoclaw\picoclaw.exe`, Args: []string{"gateway", "--strict"}},
+		`C:\Users\pi`)
+	create := strings.Join(cmds[0], " ")
+	if want := `sc.exe create picoclaw binPath= "C:\Program Files\picoclaw\picoclaw.exe" gateway --strict start= delayed-auto`; !strings.HasPrefix(create, want) {
+		t.Errorf("create = %s", create)
+	}
+	env := cmds[len(cmds)-2]
+	if env[0] != "reg.exe" || env[len(env)-2] != `USERPROFILE=C:\Users\pi` {
+		t.Errorf("environment = %v", env)
+	}
+	if last := cmds[len(cmds)-1]; strings.Join(last, " ") != "sc.exe start picoclaw" {
+		t.Errorf("last command = %v", last)
+	}
+}
+
+func TestInstalledAndControlCommand(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if installed, _ := Installed("plan9"); installed {
+		t.Error("a service is installed on plan9")
+	}
+	path, _ := SystemdUnitPath(false)
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	os.WriteFile(path, []byte(SystemdUnit(Options{Binary: "/usr/bin/picoclaw"})), 0o644)
+	if installed, system := Installed("linux"); !installed || system {
+		t.Errorf("Installed = %v, %v; want the user unit", installed, system)
+	}
+
+	for _, tt := range []struct {
+		goos, action string
+		system       bool
+		want         string
+	}{
+		{"linux", "stop", false, "systemctl --user stop picoclaw.service"},
+		{"linux", "start", true, "systemctl start picoclaw.service"},
+		{"windows", "start", true, "sc.exe start picoclaw"},
+	} {
+		cmd, err := ControlCommand(tt.goos, tt.action, tt.system)
+		if err != nil || strings.Join(cmd, " ") != tt.want {
+			t.Errorf("ControlCommand(%s, %s) = %v, %v; want %s", tt.goos, tt.action, cmd, err, tt.want)
+		}
+	}
+	if _, err := ControlCommand("linux", "reload", false); err == nil {
+		t.Error("reload is not an action")
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Name is the systemd unit name of the gateway and Label its launchd label.
+const (
+	Name  = "picoclaw"
+	Label = "com.sipeed.picoclaw"
+)
+
+// Options describes the service to install.
+type Options struct {
+	Binary string   // absolute path of the picoclaw executable
+	Args   []string // arguments after the executable, e.g. "gateway"
+	System bool     // a system-wide service instead of one of the user
+	User   string   // for system services, the user to run as; "" = root
+	LogDir string   // launchd only: where stdout and stderr go
+	// WatchdogSeconds restarts the gateway when it stops answering the
+	// systemd watchdog for this long; 0 turns the watchdog off.
+	WatchdogSeconds int
+}
+
+// SystemdUnitPath returns where the unit goes: the user's unit directory,
+// or /etc/systemd/system for a system service.
+func SystemdUnitPath(system bool) (string, error) {
+	if system {
+		return filepath.Join("/etc/systemd/system", Name+".service"), nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "systemd", "user", Name+".service"), nil
+}
+
+// SystemdUnit returns a unit that starts the gateway once the network is up,
+// reloads the config on systemctl reload and restarts it when it fails or
+// its watchdog runs out.
+func SystemdUnit(o Options) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=PicoClaw gateway\n")
+	b.WriteString("Documentation=https://github.com/sipeed/picoclaw\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=notify\n")
+	b.WriteString("NotifyAccess=main\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdCommand(o.Binary, o.Args))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+	if o.WatchdogSeconds > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", o.WatchdogSeconds)
+	}
+	if o.System && o.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", o.User)
+	}
+	b.WriteString("\n[Install]\n")
+	if o.System {
+		b.WriteString("WantedBy=multi-user.target\n")
+	} else {
+		b.WriteString("WantedBy=default.target\n")
+	}
+	return b.String()
+}
+
+// systemdCommand quotes the words of a command line the way ExecStart
+// splits them.
+func systemdCommand(binary string, args []string) string {
+	words := make([]string, 0, len(args)+1)
+	for _, w := range append([]string{binary}, args...) {
+		if w == "" || strings.ContainsAny(w, " \t\"'\\") {
+			w = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(w) + `"`
+		}
+		// A $ or % would be expanded by systemd.
+		w = strings.NewReplacer("$", "$$", "%", "%%").Replace(w)
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
+
+// LaunchdPlistPath returns where the plist goes: the user's LaunchAgents,
+// or /Library/LaunchDaemons for a system service.
+func LaunchdPlistPath(system bool) (string, error) {
+	if system {
+		return filepath.Join("/Library/LaunchDaemons", Label+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", Label+".plist"), nil
+}
+
+// LaunchdPlist returns a plist that starts the gateway at login (or boot,
+// for a system service) and starts it again whenever it exits.
+func LaunchdPlist(o Options) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	plistString(&b, "Label", Label)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, w := range append([]string{o.Binary}, o.Args...) {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(w))
+	}
+	b.WriteString("\t</array>\n")
+	if o.System && o.User != "" {
+		plistString(&b, "UserName", o.User)
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	// launchd starts a job again at most this often.
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	if o.LogDir != "" {
+		plistString(&b, "StandardOutPath", filepath.Join(o.LogDir, "gateway.log"))
+		plistString(&b, "StandardErrorPath", filepath.Join(o.LogDir, "gateway.log"))
+	}
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func plistString(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, html.EscapeString(value))
+}
+
+// WindowsServiceCommands returns the sc.exe and reg.exe commands that
+// install the gateway as a Windows service, run from an administrator
+// shell. The service starts at boot once the network is up and starts
+// again when it exits on its own. It runs as LocalSystem with home as its
+// profile directory, so it finds the ~/.picoclaw of the user who installed
+// it.
+func WindowsServiceCommands(o Options, home string) [][]string {
+	return [][]string{
+		{"sc.exe", "create", Name, "binPath=", WindowsCommandLine(append([]string{o.Binary}, o.Args...)), "start=", "delayed-auto",
+			"DisplayName=", "PicoClaw gateway"},
+		{"sc.exe", "description", Name, "PicoClaw gateway, https://github.com/sipeed/picoclaw"},
+		{"sc.exe", "failure", Name, "reset=", "86400", "actions=", "restart/5000/restart/5000/restart/60000"},
+		// Also restart after the gateway stopped with an error, not only
+		// when it crashed.
+		{"sc.exe", "failureflag", Name, "1"},
+		{"reg.exe", "add", `HKLM\SYSTEM\CurrentControlSet\Services\` + Name, "/v", "Environment",
+			"/t", "REG_MULTI_SZ", "/d", "USERPROFILE=" + home, "/f"},
+		{"sc.exe", "start", Name},
+	}
+}
+
+// WindowsUninstallCommands returns the commands that stop the Windows
+// service and remove it.
+func WindowsUninstallCommands() [][]string {
+	return [][]string{
+		{"sc.exe", "stop", Name},
+		{"sc.exe", "delete", Name},
+	}
+}
+
+// WindowsCommandLine quotes args the way Windows programs split their
+// command line.
+func WindowsCommandLine(args []string) string {
+	words := make([]string, len(args))
+	for i, w := range args {
+		if w == "" || strings.ContainsAny(w, " \t\"") {
+			w = `"` + strings.ReplaceAll(w, `"`, `\"`) + `"`
+		}
+		words[i] = w
+	}
+	return strings.Join(words, " ")
+}
+
+// Installed reports whether the gateway runs as a service on this
+// system, and whether that is a system-wide one. On Windows it asks the
+// service manager.
+func Installed(goos string) (installed, system bool) {
+	switch goos {
+	case "linux", "darwin":
+		for _, system := range []bool{false, true} {
+			path, err := SystemdUnitPath(system)
+			if goos == "darwin" {
+				path, err = LaunchdPlistPath(system)
+			}
+			if err != nil {
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				return true, system
+			}
+		}
+	case "windows":
+		return exec.Command("sc.exe", "query", Name).Run() == nil, true
+	}
+	return false, false
+}
+
+// ControlCommand returns the command that stops or starts, as action
+// says, the service installed on goos.
+func ControlCommand(goos, action string, system bool) ([]string, error) {
+	if action != "stop" && action != "start" {
+		return nil, fmt.Errorf("unknown service action %q", action)
+	}
+	switch goos {
+	case "linux":
+		if system {
+			return []string{"systemctl", action, Name + ".service"}, nil
+		}
+		return []string{"systemctl", "--user", action, Name + ".service"}, nil
+	case "darwin":
+		path, err := LaunchdPlistPath(system)
+		if err != nil {
+			return nil, err
+		}
+		if action == "stop" {
+			return []string{"launchctl", "unload", path}, nil
+		}
+		return []string{"launchctl", "load", "-w", path}, nil
+	case "windows":
+		return []string{"sc.exe", action, Name}, nil
+	}
+	return nil, fmt.Errorf("services are only supported with systemd, launchd and Windows, not on %s", goos)
+}
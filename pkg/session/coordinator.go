@@ -0,0 +1,296 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Coordinator keeps gateways that share a session store from doing the
+// same work: locks make them take turns, claims let only one of them do a
+// piece of work at all.
+type Coordinator interface {
+	// TryLock takes the lock named key unless another instance holds it,
+	// and returns the function that releases it.
+	TryLock(key string) (unlock func(), ok bool, err error)
+	// Claim reports whether this instance gets to do the work named key:
+	// the first to claim it within ttl does.
+	Claim(key string, ttl time.Duration) (bool, error)
+	Close() error
+}
+
+const (
+	// redisLockTTL is how long a Redis lock outlives an instance that
+	// died holding it. Held locks are extended every third of it.
+	redisLockTTL = 30 * time.Second
+	// lockRetryInterval is how often Lock tries a lock that is taken.
+	lockRetryInterval = 250 * time.Millisecond
+	// maxIdleLockConns is how many Postgres lock connections are kept
+	// open between locks.
+	maxIdleLockConns = 4
+)
+
+// OpenCoordinator connects to the server cfg names.
+func OpenCoordinator(cfg config.CoordinationConfig, store config.SessionStoreConfig) (Coordinator, error) {
+	cfg = cfg.WithDefaults(store)
+	switch cfg.Backend {
+	case "redis":
+		return OpenRedisCoordinator(cfg.DSN, cfg.Namespace)
+	case "postgres":
+		return OpenPostgresCoordinator(cfg.DSN, cfg.Namespace)
+	}
+	return nil, fmt.Errorf("unknown coordination backend %q", cfg.Backend)
+}
+
+// Lock waits until it takes the lock named key or ctx ends.
+func Lock(ctx context.Context, c Coordinator, key string) (func(), error) {
+	for {
+		unlock, ok, err := c.TryLock(key)
+		if err != nil || ok {
+			return unlock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// RedisCoordinator takes locks and claims as Redis keys that expire.
+type RedisCoordinator struct {
+	redisClient
+	prefix string
+}
+
+// OpenRedisCoordinator connects to the server at dsn, as OpenRedisStore
+// does.
+func OpenRedisCoordinator(dsn, namespace string) (*RedisCoordinator, error) {
+	rc := &RedisCoordinator{redisClient: redisClient{dsn: dsn}, prefix: "picoclaw:"}
+	if namespace != "" {
+		rc.prefix += namespace + ":"
+	}
+	if err := rc.do(func(c *redisConn) error {
+		_, err := c.do("PING")
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("coordination: %w", err)
+	}
+	return rc, nil
+}
+
+// The scripts change a lock only while it still holds the token of the
+// instance that took it, and not once it expired and another took it.
+const (
+	redisUnlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+	redisExtendScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then ` +
+		`return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`
+)
+
+func (rc *RedisCoordinator) TryLock(key string) (func(), bool, error) {
+	key = rc.prefix + "lock:" + key
+	token := randomToken()
+	ttl := strconv.FormatInt(redisLockTTL.Milliseconds(), 10)
+	var reply any
+	err := rc.do(func(c *redisConn) (err error) {
+		reply, err = c.do("SET", key, token, "NX", "PX", ttl)
+		return err
+	})
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(redisLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			err := rc.do(func(c *redisConn) error {
+				_, err := c.do("EVAL", redisExtendScript, "1", key, token, ttl)
+				return err
+			})
+			if err != nil {
+				logger.WarnCF("session", "Failed to extend lock", map[string]any{"key": key, "error": err.Error()})
+			}
+		}
+	}()
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			close(done)
+			err := rc.do(func(c *redisConn) error {
+				_, err := c.do("EVAL", redisUnlockScript, "1", key, token)
+				return err
+			})
+			if err != nil {
+				logger.WarnCF("session", "Failed to release lock", map[string]any{"key": key, "error": err.Error()})
+			}
+		})
+	}
+	return unlock, true, nil
+}
+
+func (rc *RedisCoordinator) Claim(key string, ttl time.Duration) (bool, error) {
+	var reply any
+	err := rc.do(func(c *redisConn) (err error) {
+		reply, err = c.do("SET", rc.prefix+"claim:"+key, randomToken(), "NX", "PX",
+			strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+		return err
+	})
+	return reply != nil, err
+}
+
+func (rc *RedisCoordinator) Close() error {
+	return rc.close()
+}
+
+// PostgresCoordinator takes locks as session advisory locks and records
+// claims in a table. A lock goes when its connection does, so each held
+// lock has a connection of its own that nothing else uses: the shared one
+// is dialed again after it breaks, which would release every lock taken on
+// it without a word.
+type PostgresCoordinator struct {
+	pgClient
+	prefix string
+
+	lockMu sync.Mutex
+	idle   []*pgConn // lock connections holding no lock
+	closed bool
+}
+
+// OpenPostgresCoordinator connects to the database at dsn, as
+// OpenPostgresStore does, and brings its schema up to date.
+func OpenPostgresCoordinator(dsn, namespace string) (*PostgresCoordinator, error) {
+	pc := &PostgresCoordinator{pgClient: pgClient{dsn: dsn}}
+	if namespace != "" {
+		pc.prefix = namespace + ":"
+	}
+	if err := pc.migrate(); err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("coordination: %w", err)
+	}
+	return pc, nil
+}
+
+func (pc *PostgresCoordinator) TryLock(key string) (func(), bool, error) {
+	key = pc.prefix + key
+	c, rows, err := pc.onLockConn("SELECT pg_try_advisory_lock(hashtext('picoclaw'), hashtext($1))", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(rows) == 0 || rows[0][0] != "t" {
+		pc.putLockConn(c)
+		return nil, false, nil
+	}
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			c.conn.SetDeadline(time.Now().Add(30 * time.Second))
+			_, err := c.exec("SELECT pg_advisory_unlock(hashtext('picoclaw'), hashtext($1))", key)
+			if err != nil {
+				// Closing the connection releases the lock too.
+				logger.WarnCF("session", "Failed to release lock", map[string]any{"key": key, "error": err.Error()})
+				c.close()
+				return
+			}
+			pc.putLockConn(c)
+		})
+	}
+	return unlock, true, nil
+}
+
+// onLockConn runs query on a lock connection, an idle one or, if that has
+// gone stale, a new one, and returns the connection with the result.
+func (pc *PostgresCoordinator) onLockConn(query string, args ...string) (*pgConn, [][]string, error) {
+	for {
+		c, reused, err := pc.lockConn()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.conn.SetDeadline(time.Now().Add(30 * time.Second))
+		rows, err := c.exec(query, args...)
+		var pgErr *pgError
+		switch {
+		case err == nil:
+			return c, rows, nil
+		case errors.As(err, &pgErr):
+			pc.putLockConn(c)
+			return nil, nil, err
+		}
+		c.close()
+		if !reused {
+			return nil, nil, err
+		}
+	}
+}
+
+// lockConn takes an idle lock connection, or dials one. reused reports
+// which.
+func (pc *PostgresCoordinator) lockConn() (c *pgConn, reused bool, err error) {
+	pc.lockMu.Lock()
+	if n := len(pc.idle); n > 0 {
+		c = pc.idle[n-1]
+		pc.idle = pc.idle[:n-1]
+		pc.lockMu.Unlock()
+		return c, true, nil
+	}
+	pc.lockMu.Unlock()
+	c, err = dialPostgres(pc.dsn)
+	return c, false, err
+}
+
+// putLockConn keeps c, which holds no lock, for the next lock.
+func (pc *PostgresCoordinator) putLockConn(c *pgConn) {
+	pc.lockMu.Lock()
+	defer pc.lockMu.Unlock()
+	if pc.closed || len(pc.idle) >= maxIdleLockConns {
+		c.close()
+		return
+	}
+	pc.idle = append(pc.idle, c)
+}
+
+func (pc *PostgresCoordinator) Claim(key string, ttl time.Duration) (bool, error) {
+	var rows [][]string
+	err := pc.do(func(c *pgConn) (err error) {
+		// The database's clock decides when a claim expires, so the
+		// instances' clocks need not agree.
+		rows, err = c.exec(`INSERT INTO picoclaw_claims (key, expires_at)
+			VALUES ($1, now() + $2::interval)
+			ON CONFLICT (key) DO UPDATE SET expires_at = EXCLUDED.expires_at
+			WHERE picoclaw_claims.expires_at < now()
+			RETURNING key`, pc.prefix+key, fmt.Sprintf("%d milliseconds", max(ttl.Milliseconds(), 1)))
+		return err
+	})
+	return len(rows) > 0, err
+}
+
+func (pc *PostgresCoordinator) Close() error {
+	pc.lockMu.Lock()
+	pc.closed = true
+	for _, c := range pc.idle {
+		c.close()
+	}
+	pc.idle = nil
+	pc.lockMu.Unlock()
+	return pc.close()
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
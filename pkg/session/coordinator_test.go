@@ -0,0 +1,94 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestRedisCoordinator_LocksAndClaims(t *testing.T) {
+	_, addr := startFakeRedis(t, "")
+	coordination := config.CoordinationConfig{Backend: "redis"}
+	store := config.SessionStoreConfig{Backend: "redis", DSN: "redis://" + addr, Namespace: "home"}
+	first, err := OpenCoordinator(coordination, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := OpenCoordinator(coordination, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	unlock, ok, err := first.TryLock("chat:telegram:42")
+	if err != nil || !ok {
+		t.Fatalf("first lock: ok = %v, err = %v", ok, err)
+	}
+	if _, ok, _ := second.TryLock("chat:telegram:42"); ok {
+		t.Fatal("two instances hold the same lock")
+	}
+	if _, ok, _ := second.TryLock("chat:telegram:43"); !ok {
+		t.Error("a lock on another chat was refused")
+	}
+
+	// Lock waits for the lock to be released.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := Lock(ctx, second, "chat:telegram:42"); err != nil {
+		t.Fatalf("Lock after release: %v", err)
+	}
+	// Releasing again must not free the lock the other instance now holds.
+	unlock()
+	if _, ok, _ := first.TryLock("chat:telegram:42"); ok {
+		t.Error("a stale unlock released another instance's lock")
+	}
+
+	if ok, err := first.Claim("cron:abc", time.Minute); err != nil || !ok {
+		t.Fatalf("first claim: ok = %v, err = %v", ok, err)
+	}
+	if ok, _ := second.Claim("cron:abc", time.Minute); ok {
+		t.Error("two instances claimed the same run")
+	}
+}
+
+func TestRefresh_ReadsWhatAnotherInstanceSaved(t *testing.T) {
+	_, addr := startFakeRedis(t, "")
+	cfg := config.SessionStoreConfig{Backend: "redis", DSN: "redis://" + addr}
+	first, err := Open(cfg, t.TempDir(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := Open(cfg, t.TempDir(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	const key = "agent:main:telegram:direct:7"
+	second.AddMessage(key, "user", "stale")
+	first.AddMessage(key, "user", "hello")
+	first.AddMessage(key, "assistant", "hi")
+	if err := first.Save(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.Refresh(key); err != nil {
+		t.Fatal(err)
+	}
+	if got := second.GetHistory(key); len(got) != 2 || got[1].Content != "hi" {
+		t.Errorf("history after refresh = %+v", got)
+	}
+	// A session the store does not hold is left alone.
+	second.AddMessage("agent:main:local", "user", "mine")
+	if err := second.Refresh("agent:main:local"); err != nil || len(second.GetHistory("agent:main:local")) != 1 {
+		t.Errorf("refresh of an unsaved session: %v", err)
+	}
+}
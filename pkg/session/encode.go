@@ -0,0 +1,40 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// bufferPool holds the buffers sessions are encoded into. A session is
+// saved after every turn and grows to hundreds of messages, so encoding it
+// into a fresh buffer each time leaves the garbage collector its whole size
+// to sweep, which small boards feel.
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledBuffer is the largest buffer kept for reuse, so one huge session
+// does not stay in memory.
+const maxPooledBuffer = 1 << 20
+
+// encode writes s as JSON, indented when indent is set, into a pooled
+// buffer. The caller hands it back with release once done with its bytes.
+func encode(s *Session, indent bool) (*bytes.Buffer, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	enc := json.NewEncoder(buf)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(s); err != nil {
+		release(buf)
+		return nil, err
+	}
+	buf.Truncate(buf.Len() - 1) // the newline Encode ends with
+	return buf, nil
+}
+
+func release(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
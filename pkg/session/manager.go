@@ -1,13 +1,13 @@
 package session
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
@@ -17,25 +17,69 @@ type Session struct {
 	Summary  string              `json:"summary,omitempty"`
 	Created  time.Time           `json:"created"`
 	Updated  time.Time           `json:"updated"`
+	// AgentID and Model pin the session to an agent or model other than the
+	// one routing would pick.
+	AgentID string `json:"agent_id,omitempty"`
+	Model   string `json:"model,omitempty"`
+	// Active, on a routed session, names the session started from it with
+	// /new that conversations currently continue in.
+	Active string `json:"active,omitempty"`
+	// Participants are the people who have spoken in a group session,
+	// keyed by sender ID.
+	Participants map[string]*Participant `json:"participants,omitempty"`
+	// Instructions, on a routed session, are the standing instructions
+	// pinned to its chat with /pin. They apply to every conversation in it.
+	Instructions []string `json:"instructions,omitempty"`
+}
+
+// Participant is someone who has spoken in a group session.
+type Participant struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Messages int       `json:"messages"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Info describes a session for listings.
+type Info struct {
+	Key      string
+	Messages int
+	AgentID  string
+	Model    string
+	Created  time.Time
+	Updated  time.Time
 }
 
 type SessionManager struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
-	storage  string
+	sessions    map[string]*Session
+	mu          sync.RWMutex
+	store       Store
+	maxMessages int // kept per session on Save; 0 = all
 }
 
+// NewSessionManager keeps sessions as JSON files in storage, or only in
+// memory if storage is empty.
 func NewSessionManager(storage string) *SessionManager {
+	if storage == "" {
+		return &SessionManager{sessions: make(map[string]*Session)}
+	}
+	return NewSessionManagerWithStore(NewFileStore(storage))
+}
+
+// NewSessionManagerWithStore keeps sessions in store, starting with those
+// it already holds.
+func NewSessionManagerWithStore(store Store) *SessionManager {
 	sm := &SessionManager{
 		sessions: make(map[string]*Session),
-		storage:  storage,
+		store:    store,
 	}
-
-	if storage != "" {
-		os.MkdirAll(storage, 0o755)
-		sm.loadSessions()
+	sessions, err := store.Load()
+	if err != nil {
+		logger.ErrorCF("session", "Failed to load sessions", map[string]any{"error": err.Error()})
+	}
+	for _, session := range sessions {
+		sm.sessions[session.Key] = session
 	}
-
 	return sm
 }
 
@@ -100,6 +144,19 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 	return history
 }
 
+// ReadHistory calls read with the history of the session key, without
+// copying it as GetHistory does. read must not keep or change the messages
+// and must not call sm.
+func (sm *SessionManager) ReadHistory(key string, read func(history []providers.Message)) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var history []providers.Message
+	if session, ok := sm.sessions[key]; ok {
+		history = session.Messages
+	}
+	read(history)
+}
+
 func (sm *SessionManager) GetSummary(key string) string {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -145,43 +202,38 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	session.Updated = time.Now()
 }
 
-// sanitizeFilename converts a session key into a cross-platform safe filename.
-// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
-// volume separator on Windows, so filepath.Base would misinterpret the key.
-// We replace it with '_'. The original key is preserved inside the JSON file,
-// so loadSessions still maps back to the right in-memory key.
-func sanitizeFilename(key string) string {
-	return strings.ReplaceAll(key, ":", "_")
-}
-
 func (sm *SessionManager) Save(key string) error {
-	if sm.storage == "" {
+	if sm.store == nil {
 		return nil
 	}
 
-	filename := sanitizeFilename(key)
-
-	// filepath.IsLocal rejects empty names, "..", absolute paths, and
-	// OS-reserved device names (NUL, COM1 … on Windows).
-	// The extra checks reject "." and any directory separators so that
-	// the session file is always written directly inside sm.storage.
-	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
-		return os.ErrInvalid
-	}
-
-	// Snapshot under read lock, then perform slow file I/O after unlock.
-	sm.mu.RLock()
+	// Snapshot under lock, then let the store do its slow I/O after unlock.
+	sm.mu.Lock()
 	stored, ok := sm.sessions[key]
 	if !ok {
-		sm.mu.RUnlock()
+		sm.mu.Unlock()
 		return nil
 	}
+	stored.Messages = trimHistory(stored.Messages, sm.maxMessages)
 
 	snapshot := Session{
 		Key:     stored.Key,
 		Summary: stored.Summary,
 		Created: stored.Created,
 		Updated: stored.Updated,
+		AgentID: stored.AgentID,
+		Model:   stored.Model,
+		Active:  stored.Active,
+	}
+	if len(stored.Instructions) > 0 {
+		snapshot.Instructions = append([]string(nil), stored.Instructions...)
+	}
+	if len(stored.Participants) > 0 {
+		snapshot.Participants = make(map[string]*Participant, len(stored.Participants))
+		for id, p := range stored.Participants {
+			copied := *p
+			snapshot.Participants[id] = &copied
+		}
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
@@ -189,94 +241,337 @@ func (sm *SessionManager) Save(key string) error {
 	} else {
 		snapshot.Messages = []providers.Message{}
 	}
-	sm.mu.RUnlock()
+	sm.mu.Unlock()
 
-	data, err := json.MarshalIndent(snapshot, "", "  ")
-	if err != nil {
-		return err
+	return sm.store.Save(&snapshot)
+}
+
+// Close closes the store.
+func (sm *SessionManager) Close() error {
+	if sm.store == nil {
+		return nil
 	}
+	return sm.store.Close()
+}
 
-	sessionPath := filepath.Join(sm.storage, filename+".json")
-	tmpFile, err := os.CreateTemp(sm.storage, "session-*.tmp")
-	if err != nil {
-		return err
+// Delete removes the session key, from the store as well.
+func (sm *SessionManager) Delete(key string) error {
+	sm.mu.Lock()
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+	if sm.store == nil {
+		return nil
 	}
+	return sm.store.Delete(key)
+}
 
-	tmpPath := tmpFile.Name()
-	cleanup := true
-	defer func() {
-		if cleanup {
-			_ = os.Remove(tmpPath)
-		}
-	}()
+// sessionGetter is a store that reads a single session, as the stores
+// several instances share do.
+type sessionGetter interface {
+	Get(key string) (*Session, error)
+}
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return err
+// Refresh replaces the session key with what the store holds, so an
+// instance continues where another one sharing the store left off. It does
+// nothing for stores that are not shared or do not hold the session.
+func (sm *SessionManager) Refresh(key string) error {
+	getter, ok := sm.store.(sessionGetter)
+	if !ok {
+		return nil
 	}
-	if err := tmpFile.Chmod(0o644); err != nil {
-		_ = tmpFile.Close()
+	stored, err := getter.Get(key)
+	if err != nil || stored == nil {
 		return err
 	}
-	if err := tmpFile.Sync(); err != nil {
-		_ = tmpFile.Close()
-		return err
+	if stored.Messages == nil {
+		stored.Messages = []providers.Message{}
 	}
-	if err := tmpFile.Close(); err != nil {
-		return err
+	sm.mu.Lock()
+	sm.sessions[key] = stored
+	sm.mu.Unlock()
+	return nil
+}
+
+// SetHistory updates the messages of a session.
+func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if ok {
+		// Create a deep copy to strictly isolate internal state
+		// from the caller's slice.
+		msgs := make([]providers.Message, len(history))
+		copy(msgs, history)
+		session.Messages = msgs
+		session.Updated = time.Now()
 	}
+}
 
-	if err := os.Rename(tmpPath, sessionPath); err != nil {
-		return err
+// Resolve returns the session conversations under key currently continue
+// in: key itself, or the session last started from it with StartNew.
+func (sm *SessionManager) Resolve(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if session, ok := sm.sessions[key]; ok && session.Active != "" {
+		return session.Active
 	}
-	cleanup = false
-	return nil
+	return key
 }
 
-func (sm *SessionManager) loadSessions() error {
-	files, err := os.ReadDir(sm.storage)
-	if err != nil {
-		return err
+// StartNew starts a fresh session for the routed session key and makes it
+// the active one. The previous conversation is kept. It returns the new
+// session's key.
+func (sm *SessionManager) StartNew(key string) string {
+	sm.mu.Lock()
+	now := time.Now()
+	newKey := fmt.Sprintf("%s#%d", key, now.UnixNano())
+	sm.sessions[newKey] = &Session{
+		Key:      newKey,
+		Messages: []providers.Message{},
+		Created:  now,
+		Updated:  now,
 	}
+	base, ok := sm.sessions[key]
+	if !ok {
+		base = &Session{Key: key, Messages: []providers.Message{}, Created: now}
+		sm.sessions[key] = base
+	}
+	base.Active = newKey
+	base.Updated = now
+	sm.mu.Unlock()
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
+	sm.Save(key)
+	sm.Save(newKey)
+	return newKey
+}
 
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
+// Branch starts a new session for the routed session key as a copy of the
+// session from, with its first keep messages, its summary and its pins, and
+// makes it the active one. from is left as it is. It returns the new
+// session's key.
+func (sm *SessionManager) Branch(key, from string, keep int) string {
+	sm.mu.Lock()
+	now := time.Now()
+	newKey := fmt.Sprintf("%s#%d", key, now.UnixNano())
+	branch := &Session{Key: newKey, Messages: []providers.Message{}, Created: now, Updated: now}
+	if source, ok := sm.sessions[from]; ok {
+		keep = min(max(keep, 0), len(source.Messages))
+		branch.Messages = append(branch.Messages, source.Messages[:keep]...)
+		branch.Summary = source.Summary
+		branch.AgentID = source.AgentID
+		branch.Model = source.Model
+	}
+	sm.sessions[newKey] = branch
+	base, ok := sm.sessions[key]
+	if !ok {
+		base = &Session{Key: key, Messages: []providers.Message{}, Created: now}
+		sm.sessions[key] = base
+	}
+	base.Active = newKey
+	base.Updated = now
+	sm.mu.Unlock()
 
-		sessionPath := filepath.Join(sm.storage, file.Name())
-		data, err := os.ReadFile(sessionPath)
-		if err != nil {
-			continue
-		}
+	sm.Save(key)
+	sm.Save(newKey)
+	return newKey
+}
 
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
-			continue
-		}
+// Reset clears the messages, summary and participants of a session,
+// keeping its pins and instructions.
+func (sm *SessionManager) Reset(key string) {
+	sm.mu.Lock()
+	session, ok := sm.sessions[key]
+	if ok {
+		session.Messages = []providers.Message{}
+		session.Summary = ""
+		session.Participants = nil
+		session.Updated = time.Now()
+	}
+	sm.mu.Unlock()
 
-		sm.sessions[session.Key] = &session
+	if ok {
+		sm.Save(key)
 	}
+}
+
+// Pin sets the agent and model a session runs with. Empty values clear the
+// pin.
+func (sm *SessionManager) Pin(key, agentID, model string) {
+	sm.mu.Lock()
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{Key: key, Messages: []providers.Message{}, Created: time.Now()}
+		sm.sessions[key] = session
+	}
+	session.AgentID = agentID
+	session.Model = model
+	session.Updated = time.Now()
+	sm.mu.Unlock()
+
+	sm.Save(key)
+}
 
+// Instructions returns the standing instructions pinned to a session.
+func (sm *SessionManager) Instructions(key string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if session, ok := sm.sessions[key]; ok {
+		return append([]string(nil), session.Instructions...)
+	}
 	return nil
 }
 
-// SetHistory updates the messages of a session.
-func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+// AddInstruction pins a standing instruction to a session. Pinning is not
+// activity in the conversation, so the session's update time stays.
+func (sm *SessionManager) AddInstruction(key, instruction string) error {
+	sm.mu.Lock()
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{Key: key, Messages: []providers.Message{}, Created: time.Now()}
+		sm.sessions[key] = session
+	}
+	session.Instructions = append(session.Instructions, instruction)
+	sm.mu.Unlock()
+
+	return sm.Save(key)
+}
+
+// RemoveInstruction unpins the standing instruction numbered n, from 1, or
+// all of them if n is 0. It returns the instructions it removed.
+func (sm *SessionManager) RemoveInstruction(key string, n int) ([]string, error) {
+	sm.mu.Lock()
+	session, ok := sm.sessions[key]
+	if !ok || n < 0 || n > len(session.Instructions) {
+		sm.mu.Unlock()
+		return nil, nil
+	}
+	var removed []string
+	if n == 0 {
+		removed, session.Instructions = session.Instructions, nil
+	} else {
+		removed = []string{session.Instructions[n-1]}
+		session.Instructions = append(session.Instructions[:n-1:n-1], session.Instructions[n:]...)
+	}
+	sm.mu.Unlock()
+
+	return removed, sm.Save(key)
+}
+
+// AddParticipant records that id, known as name, spoke in the session. A
+// new name replaces the old one, as people rename themselves.
+func (sm *SessionManager) AddParticipant(key, id, name string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	session, ok := sm.sessions[key]
-	if ok {
-		// Create a deep copy to strictly isolate internal state
-		// from the caller's slice.
-		msgs := make([]providers.Message, len(history))
-		copy(msgs, history)
-		session.Messages = msgs
-		session.Updated = time.Now()
+	if !ok {
+		session = &Session{Key: key, Messages: []providers.Message{}, Created: time.Now()}
+		sm.sessions[key] = session
+	}
+	if session.Participants == nil {
+		session.Participants = make(map[string]*Participant)
+	}
+	p, ok := session.Participants[id]
+	if !ok {
+		p = &Participant{ID: id}
+		session.Participants[id] = p
+	}
+	if name != "" {
+		p.Name = name
+	}
+	p.Messages++
+	p.LastSeen = time.Now()
+}
+
+// RemoveParticipant forgets that id spoke in the session and reports
+// whether they had.
+func (sm *SessionManager) RemoveParticipant(key, id string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || session.Participants[id] == nil {
+		return false
+	}
+	delete(session.Participants, id)
+	return true
+}
+
+// Participants returns the people who have spoken in the session, most
+// recent speaker first.
+func (sm *SessionManager) Participants(key string) []Participant {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return nil
+	}
+	participants := make([]Participant, 0, len(session.Participants))
+	for _, p := range session.Participants {
+		participants = append(participants, *p)
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].LastSeen.After(participants[j].LastSeen)
+	})
+	return participants
+}
+
+// GetInfo returns a description of the session, which is empty if it does
+// not exist yet.
+func (sm *SessionManager) GetInfo(key string) Info {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return Info{Key: key}
+	}
+	return infoOf(session)
+}
+
+// List returns the routed session key and every session started from it,
+// most recently updated first.
+func (sm *SessionManager) List(key string) []Info {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var infos []Info
+	for k, session := range sm.sessions {
+		if k == key || strings.HasPrefix(k, key+"#") {
+			infos = append(infos, infoOf(session))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Updated.After(infos[j].Updated) })
+	return infos
+}
+
+// UpdatedSince returns the sessions updated after t, most recently updated
+// first.
+func (sm *SessionManager) UpdatedSince(t time.Time) []Info {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var infos []Info
+	for _, session := range sm.sessions {
+		if session.Updated.After(t) {
+			infos = append(infos, infoOf(session))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Updated.After(infos[j].Updated) })
+	return infos
+}
+
+func infoOf(session *Session) Info {
+	return Info{
+		Key:      session.Key,
+		Messages: len(session.Messages),
+		AgentID:  session.AgentID,
+		Model:    session.Model,
+		Created:  session.Created,
+		Updated:  session.Updated,
 	}
 }
@@ -72,3 +72,58 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestStartNewAndPinSurviveReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "agent:main:slack:channel:c1"
+	sm.AddMessage(key, "user", "old conversation")
+	sm.Save(key)
+
+	newKey := sm.StartNew(key)
+	if newKey == key || sm.Resolve(key) != newKey {
+		t.Fatalf("Resolve(%q) = %q, want the new session %q", key, sm.Resolve(key), newKey)
+	}
+	sm.Pin(newKey, "coder", "gpt-test")
+	sm.AddInstruction(key, "answer in German")
+
+	reloaded := NewSessionManager(tmpDir)
+	if got := reloaded.Resolve(key); got != newKey {
+		t.Errorf("after reload Resolve = %q, want %q", got, newKey)
+	}
+	info := reloaded.GetInfo(newKey)
+	if info.AgentID != "coder" || info.Model != "gpt-test" {
+		t.Errorf("pins after reload = %+v", info)
+	}
+	if got := reloaded.Instructions(key); len(got) != 1 || got[0] != "answer in German" {
+		t.Errorf("instructions after reload = %v", got)
+	}
+	if got := reloaded.List(key); len(got) != 2 || got[0].Key != newKey {
+		t.Errorf("List = %+v", got)
+	}
+	if len(reloaded.GetHistory(key)) != 1 {
+		t.Error("StartNew dropped the old conversation")
+	}
+}
+
+func TestParticipantsSurviveReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "agent:main:telegram:group:-100"
+	sm.AddParticipant(key, "1", "Alice")
+	sm.AddParticipant(key, "2", "Bob")
+	sm.AddParticipant(key, "1", "Alice B.")
+	sm.Save(key)
+
+	got := NewSessionManager(tmpDir).Participants(key)
+	if len(got) != 2 || got[0].ID != "1" || got[0].Name != "Alice B." || got[0].Messages != 2 {
+		t.Fatalf("participants after reload = %+v", got)
+	}
+
+	sm.Reset(key)
+	if got := sm.Participants(key); len(got) != 0 {
+		t.Errorf("Reset kept participants %+v", got)
+	}
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/sqlite"
+)
+
+// DefaultMaxMessages bounds the history kept per session when the config
+// does not.
+const DefaultMaxMessages = 500
+
+// Store keeps sessions between restarts.
+type Store interface {
+	// Load returns every stored session.
+	Load() ([]*Session, error)
+	// Save writes s, replacing the stored session with the same key.
+	Save(s *Session) error
+	// Delete removes the session with key, if there is one.
+	Delete(key string) error
+	Close() error
+}
+
+// OpenStore opens the store cfg names for the agent agentID. dir holds the
+// local stores; the others keep the sessions of each agent, under the
+// configured namespace, apart.
+func OpenStore(cfg config.SessionStoreConfig, dir, agentID string) (Store, error) {
+	namespace := agentID
+	if cfg.Namespace != "" {
+		namespace = cfg.Namespace + ":" + agentID
+	}
+	switch Backend(cfg) {
+	case "sqlite":
+		if !sqlite.Supported {
+			return nil, fmt.Errorf("SQLite is not available on %s/%s, use the file session store", runtime.GOOS, runtime.GOARCH)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return OpenSQLiteStore(filepath.Join(dir, "sessions.db"), namespace, cfg.MaxConns, cfg.CacheKB)
+	case "postgres":
+		return OpenPostgresStore(cfg.DSN, namespace)
+	case "redis":
+		return OpenRedisStore(cfg.DSN, namespace)
+	case "file":
+		return NewFileStore(dir), nil
+	case "memory":
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown session store backend %q", cfg.Backend)
+}
+
+// Backend returns the backend cfg names, or the default one: SQLite where
+// it is available, else JSON files.
+func Backend(cfg config.SessionStoreConfig) string {
+	switch {
+	case cfg.Backend != "":
+		return cfg.Backend
+	case sqlite.Supported:
+		return "sqlite"
+	}
+	return "file"
+}
+
+// Open returns the session manager of the agent agentID, backed by the
+// store cfg names. Sessions that older versions kept as JSON files in dir
+// are moved into the store the first time.
+func Open(cfg config.SessionStoreConfig, dir, agentID string) (*SessionManager, error) {
+	store, err := OpenStore(cfg, dir, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if b := Backend(cfg); b != "file" && b != "memory" {
+		if err := importFiles(dir, store, agentID); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	sm := NewSessionManagerWithStore(store)
+	sm.maxMessages = cfg.MaxMessages
+	if sm.maxMessages == 0 {
+		sm.maxMessages = DefaultMaxMessages
+	}
+	return sm, nil
+}
+
+// importFiles saves the sessions of agentID in the JSON files in dir to
+// store, unless it already has them, and renames each file to *.imported so
+// it is not read again. Agents sharing a workspace share the directory, so
+// the sessions of other agents are left for them.
+func importFiles(dir string, store Store, agentID string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	stored, err := store.Load()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(stored))
+	for _, s := range stored {
+		have[s.Key] = true
+	}
+
+	imported := 0
+	for _, path := range files {
+		s, err := readSessionFile(path)
+		if err != nil {
+			logger.WarnCF("session", "Skipping unreadable session file", map[string]any{
+				"path":  path,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if parsed := routing.ParseAgentSessionKey(s.Key); parsed != nil && parsed.AgentID != agentID {
+			continue
+		}
+		if !have[s.Key] {
+			if err := store.Save(s); err != nil {
+				return fmt.Errorf("importing %s: %w", path, err)
+			}
+			imported++
+		}
+		if err := os.Rename(path, path+".imported"); err != nil {
+			return err
+		}
+	}
+	logger.InfoCF("session", "Imported session files", map[string]any{"dir": dir, "sessions": imported})
+	return nil
+}
+
+func readSessionFile(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// trimHistory returns the last limit messages of history, without tool
+// results whose call was cut off.
+func trimHistory(history []providers.Message, limit int) []providers.Message {
+	if limit <= 0 || len(history) <= limit {
+		return history
+	}
+	history = history[len(history)-limit:]
+	for len(history) > 0 && history[0].Role == "tool" {
+		history = history[1:]
+	}
+	return history
+}
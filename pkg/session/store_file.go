@@ -0,0 +1,117 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore keeps each session in a JSON file of its own.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	os.MkdirAll(dir, 0o755)
+	return &FileStore{dir: dir}
+}
+
+// sanitizeFilename converts a session key into a cross-platform safe filename.
+// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
+// volume separator on Windows, so filepath.Base would misinterpret the key.
+// We replace it with '_'. The original key is preserved inside the JSON file,
+// so Load still maps back to the right in-memory key.
+func sanitizeFilename(key string) string {
+	return strings.ReplaceAll(key, ":", "_")
+}
+
+func (fs *FileStore) Save(s *Session) error {
+	filename := sanitizeFilename(s.Key)
+
+	// filepath.IsLocal rejects empty names, "..", absolute paths, and
+	// OS-reserved device names (NUL, COM1 … on Windows).
+	// The extra checks reject "." and any directory separators so that
+	// the session file is always written directly inside fs.dir.
+	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
+		return os.ErrInvalid
+	}
+
+	buf, err := encode(s, true)
+	if err != nil {
+		return err
+	}
+	defer release(buf)
+
+	sessionPath := filepath.Join(fs.dir, filename+".json")
+	tmpFile, err := os.CreateTemp(fs.dir, "session-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmpFile.Name()
+	cleanup := true
+	defer func() {
+		if cleanup {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(buf.Bytes()); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0o644); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, sessionPath); err != nil {
+		return err
+	}
+	cleanup = false
+	return nil
+}
+
+// Load reads every session file; files that cannot be read are skipped.
+func (fs *FileStore) Delete(key string) error {
+	filename := sanitizeFilename(key)
+	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
+		return os.ErrInvalid
+	}
+	err := os.Remove(filepath.Join(fs.dir, filename+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (fs *FileStore) Load() ([]*Session, error) {
+	files, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		session, err := readSessionFile(filepath.Join(fs.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (fs *FileStore) Close() error {
+	return nil
+}
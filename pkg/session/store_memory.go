@@ -0,0 +1,54 @@
+package session
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// MemoryStore keeps sessions in memory only, so they are gone with the
+// process. It suits tests, which should not need a database.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string][]byte // by key, as JSON so callers share nothing
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string][]byte)}
+}
+
+func (ms *MemoryStore) Load() ([]*Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	sessions := make([]*Session, 0, len(ms.sessions))
+	for _, data := range ms.sessions {
+		var s Session
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, nil
+}
+
+func (ms *MemoryStore) Save(s *Session) error {
+	buf, err := encode(s, false)
+	if err != nil {
+		return err
+	}
+	defer release(buf)
+	ms.mu.Lock()
+	ms.sessions[s.Key] = append([]byte(nil), buf.Bytes()...)
+	ms.mu.Unlock()
+	return nil
+}
+
+func (ms *MemoryStore) Delete(key string) error {
+	ms.mu.Lock()
+	delete(ms.sessions, key)
+	ms.mu.Unlock()
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
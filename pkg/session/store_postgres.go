@@ -0,0 +1,589 @@
+package session
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// postgresMigrations create and change the Postgres schema; the version of
+// migration i is i+1. Append to the list, never edit an entry. The tables
+// are prefixed, as the database may be shared with other applications.
+var postgresMigrations = []string{
+	`CREATE TABLE picoclaw_sessions (
+		namespace  TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (namespace, key)
+	)`,
+	`CREATE TABLE picoclaw_claims (
+		key        TEXT PRIMARY KEY,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+}
+
+// PostgresStore keeps sessions in a Postgres table, one JSON document per
+// session.
+type PostgresStore struct {
+	pgClient
+	namespace string
+}
+
+// OpenPostgresStore connects to the database at dsn, a postgres:// URL,
+// and brings its schema up to date.
+func OpenPostgresStore(dsn, namespace string) (*PostgresStore, error) {
+	st := &PostgresStore{pgClient: pgClient{dsn: dsn}, namespace: namespace}
+	if err := st.migrate(); err != nil {
+		st.Close()
+		return nil, fmt.Errorf("session store: %w", err)
+	}
+	return st, nil
+}
+
+// migrate brings the schema up to date in one transaction.
+func (pc *pgClient) migrate() error {
+	return pc.do(func(c *pgConn) error {
+		if _, err := c.exec("BEGIN"); err != nil {
+			return err
+		}
+		if err := migratePostgres(c); err != nil {
+			c.exec("ROLLBACK")
+			return err
+		}
+		_, err := c.exec("COMMIT")
+		return err
+	})
+}
+
+func migratePostgres(c *pgConn) error {
+	// Agents open the store at the same time; the lock keeps them from
+	// migrating twice.
+	if _, err := c.exec("SELECT pg_advisory_xact_lock(hashtext('picoclaw_sessions'))"); err != nil {
+		return err
+	}
+	if _, err := c.exec(`CREATE TABLE IF NOT EXISTS picoclaw_session_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+	rows, err := c.exec("SELECT COALESCE(MAX(version), 0) FROM picoclaw_session_migrations")
+	if err != nil {
+		return err
+	}
+	version, err := strconv.Atoi(rows[0][0])
+	if err != nil {
+		return err
+	}
+	if version > len(postgresMigrations) {
+		return fmt.Errorf("schema version %d is newer than this build knows (%d)", version, len(postgresMigrations))
+	}
+	for v := version + 1; v <= len(postgresMigrations); v++ {
+		if _, err := c.exec(postgresMigrations[v-1]); err != nil {
+			return fmt.Errorf("migration %d: %w", v, err)
+		}
+		_, err := c.exec("INSERT INTO picoclaw_session_migrations (version) VALUES ($1)", strconv.Itoa(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *PostgresStore) Load() ([]*Session, error) {
+	var rows [][]string
+	err := st.do(func(c *pgConn) (err error) {
+		rows, err = c.exec("SELECT data FROM picoclaw_sessions WHERE namespace = $1", st.namespace)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*Session, 0, len(rows))
+	for _, row := range rows {
+		var s Session
+		if err := json.Unmarshal([]byte(row[0]), &s); err != nil {
+			continue
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, nil
+}
+
+func (st *PostgresStore) Save(s *Session) error {
+	buf, err := encode(s, false)
+	if err != nil {
+		return err
+	}
+	defer release(buf)
+	params := [][]byte{
+		[]byte(st.namespace), []byte(s.Key), buf.Bytes(), []byte(s.Updated.UTC().Format(time.RFC3339Nano)),
+	}
+	return st.do(func(c *pgConn) error {
+		_, err := c.execParams(`INSERT INTO picoclaw_sessions (namespace, key, data, updated_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (namespace, key) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+			params)
+		return err
+	})
+}
+
+func (st *PostgresStore) Delete(key string) error {
+	return st.do(func(c *pgConn) error {
+		_, err := c.exec("DELETE FROM picoclaw_sessions WHERE namespace = $1 AND key = $2", st.namespace, key)
+		return err
+	})
+}
+
+func (st *PostgresStore) Get(key string) (*Session, error) {
+	var rows [][]string
+	err := st.do(func(c *pgConn) (err error) {
+		rows, err = c.exec("SELECT data FROM picoclaw_sessions WHERE namespace = $1 AND key = $2", st.namespace, key)
+		return err
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(rows[0][0]), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (st *PostgresStore) Close() error {
+	return st.close()
+}
+
+// pgClient holds a single connection to a Postgres server and dials again
+// after it breaks.
+type pgClient struct {
+	dsn string
+
+	mu   sync.Mutex
+	conn *pgConn
+}
+
+// do runs fn on the connection, dialing it first if needed, and gives it 30
+// seconds. A connection that fails other than with an error from the
+// server is dropped.
+func (pc *pgClient) do(fn func(c *pgConn) error) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.conn == nil {
+		c, err := dialPostgres(pc.dsn)
+		if err != nil {
+			return err
+		}
+		pc.conn = c
+	}
+	pc.conn.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	err := fn(pc.conn)
+	var pgErr *pgError
+	if err != nil && !errors.As(err, &pgErr) {
+		pc.conn.close()
+		pc.conn = nil
+	}
+	return err
+}
+
+func (pc *pgClient) close() error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.conn == nil {
+		return nil
+	}
+	err := pc.conn.close()
+	pc.conn = nil
+	return err
+}
+
+// pgConn speaks just enough of the Postgres wire protocol (version 3) for
+// the session store: TLS, password, MD5 and SCRAM-SHA-256 authentication,
+// and queries with text parameters and results.
+type pgConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// pgError is an error the server reported; the connection is still usable.
+type pgError struct {
+	Severity, Code, Message string
+}
+
+func (e *pgError) Error() string {
+	return fmt.Sprintf("postgres: %s %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+func dialPostgres(dsn string) (*pgConn, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return nil, fmt.Errorf("postgres dsn must be a postgres:// URL")
+	}
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "5432"
+	}
+	user := u.User.Username()
+	password, _ := u.User.Password()
+	database := strings.TrimPrefix(u.Path, "/")
+	if database == "" {
+		database = user
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	conn, err = startTLS(conn, host, u.Query().Get("sslmode"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &pgConn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.startup(user, password, database); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// startTLS asks the server for TLS as sslmode says: "disable" never does,
+// "prefer" (the default) and "require" do without checking the
+// certificate, and "verify-full" checks it.
+func startTLS(conn net.Conn, host, sslmode string) (net.Conn, error) {
+	if sslmode == "" {
+		sslmode = "prefer"
+	}
+	switch sslmode {
+	case "disable":
+		return conn, nil
+	case "prefer", "require", "verify-full":
+	default:
+		return conn, fmt.Errorf("postgres sslmode %q is not supported", sslmode)
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+		return conn, err
+	}
+	var answer [1]byte
+	if _, err := io.ReadFull(conn, answer[:]); err != nil {
+		return conn, err
+	}
+	if answer[0] != 'S' {
+		if sslmode == "prefer" {
+			return conn, nil
+		}
+		return conn, fmt.Errorf("postgres server does not support TLS")
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: sslmode != "verify-full",
+	})
+	return tlsConn, tlsConn.Handshake()
+}
+
+func (c *pgConn) startup(user, password, database string) error {
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, 196608) // protocol 3.0
+	for _, kv := range [][2]string{{"user", user}, {"database", database}, {"application_name", "picoclaw"}} {
+		body = append(body, kv[0]+"\x00"+kv[1]+"\x00"...)
+	}
+	body = append(body, 0)
+	if _, err := c.conn.Write(binary.BigEndian.AppendUint32(nil, uint32(len(body)+4))); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(body); err != nil {
+		return err
+	}
+
+	var scram *scramClient
+	for {
+		typ, msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'E':
+			return parsePgError(msg)
+		case 'Z':
+			return nil
+		case 'R':
+			if len(msg) < 4 {
+				return fmt.Errorf("postgres: short authentication message")
+			}
+			switch code := binary.BigEndian.Uint32(msg); code {
+			case 0: // authenticated
+			case 3:
+				err = c.send('p', []byte(password+"\x00"))
+			case 5:
+				if len(msg) < 8 {
+					return fmt.Errorf("postgres: short authentication message")
+				}
+				inner := md5.Sum([]byte(password + user))
+				outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), msg[4:8]...))
+				err = c.send('p', []byte("md5"+hex.EncodeToString(outer[:])+"\x00"))
+			case 10:
+				if !strings.Contains(string(msg[4:]), "SCRAM-SHA-256\x00") {
+					return fmt.Errorf("postgres: no supported SASL mechanism")
+				}
+				scram = newScramClient("", password, "")
+				first := scram.first()
+				resp := []byte("SCRAM-SHA-256\x00")
+				resp = binary.BigEndian.AppendUint32(resp, uint32(len(first)))
+				err = c.send('p', append(resp, first...))
+			case 11:
+				if scram == nil {
+					return fmt.Errorf("postgres: unexpected SASL message")
+				}
+				var final string
+				if final, err = scram.final(string(msg[4:])); err == nil {
+					err = c.send('p', []byte(final))
+				}
+			case 12:
+				if scram == nil {
+					return fmt.Errorf("postgres: unexpected SASL message")
+				}
+				err = scram.verify(string(msg[4:]))
+			default:
+				return fmt.Errorf("postgres: authentication method %d is not supported", code)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// exec runs query with args as text parameters and returns the rows, each
+// column as text; NULL reads as "".
+func (c *pgConn) exec(query string, args ...string) ([][]string, error) {
+	params := make([][]byte, len(args))
+	for i, arg := range args {
+		params[i] = []byte(arg)
+	}
+	return c.execParams(query, params)
+}
+
+// execParams is exec with the parameters as bytes, so a large one such as
+// an encoded session goes out without being copied into a string first.
+func (c *pgConn) execParams(query string, params [][]byte) ([][]string, error) {
+	size := 8
+	for _, p := range params {
+		size += 4 + len(p)
+	}
+	bind := make([]byte, 0, size)
+	bind = append(bind, 0, 0) // unnamed portal and statement
+	bind = append(bind, 0, 0) // all parameters in text format
+	bind = binary.BigEndian.AppendUint16(bind, uint16(len(params)))
+	for _, p := range params {
+		bind = binary.BigEndian.AppendUint32(bind, uint32(len(p)))
+		bind = append(bind, p...)
+	}
+	bind = append(bind, 0, 0) // all results in text format
+
+	parse := append([]byte("\x00"+query+"\x00"), 0, 0)
+	for _, m := range []struct {
+		typ  byte
+		body []byte
+	}{{'P', parse}, {'B', bind}, {'E', []byte{0, 0, 0, 0, 0}}, {'S', nil}} {
+		if err := c.send(m.typ, m.body); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows [][]string
+	var queryErr error
+	for {
+		typ, msg, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'D':
+			row, err := parseDataRow(msg)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		case 'E':
+			queryErr = parsePgError(msg)
+		case 'Z':
+			return rows, queryErr
+		}
+	}
+}
+
+func (c *pgConn) send(typ byte, body []byte) error {
+	msg := make([]byte, 0, len(body)+5)
+	msg = append(msg, typ)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(body)+4))
+	_, err := c.conn.Write(append(msg, body...))
+	return err
+}
+
+func (c *pgConn) readMessage() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n < 4 || n > 1<<30 {
+		return 0, nil, fmt.Errorf("postgres: bad message length %d", n)
+	}
+	body := make([]byte, n-4)
+	_, err := io.ReadFull(c.r, body)
+	return header[0], body, err
+}
+
+func (c *pgConn) close() error {
+	c.send('X', nil)
+	return c.conn.Close()
+}
+
+func parseDataRow(msg []byte) ([]string, error) {
+	if len(msg) < 2 {
+		return nil, fmt.Errorf("postgres: short data row")
+	}
+	cols := int(binary.BigEndian.Uint16(msg))
+	msg = msg[2:]
+	row := make([]string, cols)
+	for i := range row {
+		if len(msg) < 4 {
+			return nil, fmt.Errorf("postgres: short data row")
+		}
+		n := int32(binary.BigEndian.Uint32(msg))
+		msg = msg[4:]
+		if n < 0 {
+			continue
+		}
+		if int(n) > len(msg) {
+			return nil, fmt.Errorf("postgres: short data row")
+		}
+		row[i], msg = string(msg[:n]), msg[n:]
+	}
+	return row, nil
+}
+
+func parsePgError(msg []byte) error {
+	e := &pgError{}
+	for _, field := range strings.Split(string(msg), "\x00") {
+		if field == "" {
+			continue
+		}
+		switch field[0] {
+		case 'S':
+			e.Severity = field[1:]
+		case 'C':
+			e.Code = field[1:]
+		case 'M':
+			e.Message = field[1:]
+		}
+	}
+	return e
+}
+
+// scramClient is the client side of SCRAM-SHA-256 (RFC 7677) without
+// channel binding.
+type scramClient struct {
+	user, password, nonce string
+	clientFirstBare       string
+	serverSignature       []byte
+}
+
+// newScramClient starts an exchange; an empty nonce picks a random one.
+func newScramClient(user, password, nonce string) *scramClient {
+	if nonce == "" {
+		b := make([]byte, 18)
+		rand.Read(b)
+		nonce = base64.RawStdEncoding.EncodeToString(b)
+	}
+	return &scramClient{user: user, password: password, nonce: nonce}
+}
+
+func (s *scramClient) first() string {
+	s.clientFirstBare = "n=" + s.user + ",r=" + s.nonce
+	return "n,," + s.clientFirstBare
+}
+
+func (s *scramClient) final(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	nonce, salt64, iter := attrs["r"], attrs["s"], attrs["i"]
+	if !strings.HasPrefix(nonce, s.nonce) {
+		return "", fmt.Errorf("scram: server nonce does not extend ours")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return "", fmt.Errorf("scram: bad salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(iter)
+	if err != nil || iterations < 1 {
+		return "", fmt.Errorf("scram: bad iteration count %q", iter)
+	}
+	salted, err := pbkdf2.Key(sha256.New, s.password, salt, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := s.clientFirstBare + "," + serverFirst + "," + withoutProof
+	proof := hmacSHA256(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	s.serverSignature = hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (s *scramClient) verify(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if e := attrs["e"]; e != "" {
+		return fmt.Errorf("scram: %s", e)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(signature, s.serverSignature) {
+		return fmt.Errorf("scram: the server signature does not match")
+	}
+	return nil
+}
+
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,275 @@
+package session
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisStore keeps the sessions of a namespace in one Redis hash, keyed by
+// session key, with the session as JSON.
+type RedisStore struct {
+	redisClient
+	hash string
+}
+
+// OpenRedisStore connects to the server at dsn, a redis:// or rediss://
+// URL whose path may pick the database number.
+func OpenRedisStore(dsn, namespace string) (*RedisStore, error) {
+	st := &RedisStore{redisClient: redisClient{dsn: dsn}, hash: "picoclaw:sessions:" + namespace}
+	if err := st.do(func(c *redisConn) error {
+		_, err := c.do("PING")
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("session store: %w", err)
+	}
+	return st, nil
+}
+
+func (st *RedisStore) Load() ([]*Session, error) {
+	var reply any
+	err := st.do(func(c *redisConn) (err error) {
+		reply, err = c.do("HVALS", st.hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	values, _ := reply.([]any)
+	sessions := make([]*Session, 0, len(values))
+	for _, v := range values {
+		data, _ := v.(string)
+		var s Session
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			continue
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, nil
+}
+
+func (st *RedisStore) Save(s *Session) error {
+	buf, err := encode(s, false)
+	if err != nil {
+		return err
+	}
+	defer release(buf)
+	return st.do(func(c *redisConn) error {
+		_, err := c.doBytes([]byte("HSET"), []byte(st.hash), []byte(s.Key), buf.Bytes())
+		return err
+	})
+}
+
+func (st *RedisStore) Delete(key string) error {
+	return st.do(func(c *redisConn) error {
+		_, err := c.do("HDEL", st.hash, key)
+		return err
+	})
+}
+
+func (st *RedisStore) Get(key string) (*Session, error) {
+	var reply any
+	err := st.do(func(c *redisConn) (err error) {
+		reply, err = c.do("HGET", st.hash, key)
+		return err
+	})
+	data, _ := reply.(string)
+	if err != nil || data == "" {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (st *RedisStore) Close() error {
+	return st.close()
+}
+
+// redisClient holds a single connection to a Redis server and dials again
+// after it breaks.
+type redisClient struct {
+	dsn string
+
+	mu   sync.Mutex
+	conn *redisConn
+}
+
+// do runs fn on the connection, dialing it first if needed, and gives it 30
+// seconds. A connection that fails other than with an error reply is
+// dropped.
+func (rc *redisClient) do(fn func(c *redisConn) error) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.conn == nil {
+		c, err := dialRedis(rc.dsn)
+		if err != nil {
+			return err
+		}
+		rc.conn = c
+	}
+	rc.conn.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	err := fn(rc.conn)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		rc.conn.conn.Close()
+		rc.conn = nil
+	}
+	return err
+}
+
+func (rc *redisClient) close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.conn == nil {
+		return nil
+	}
+	err := rc.conn.conn.Close()
+	rc.conn = nil
+	return err
+}
+
+// redisConn speaks RESP2, the Redis protocol, for one command at a time.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError is an error reply; the connection is still usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func dialRedis(dsn string) (*redisConn, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis dsn must be a redis:// or rediss:// URL")
+	}
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+
+	addr := net.JoinHostPort(host, port)
+	var conn net.Conn
+	if u.Scheme == "rediss" {
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 10 * time.Second}, Config: &tls.Config{ServerName: host}}
+		conn, err = dialer.Dial("tcp", addr)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 10*time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if password, ok := u.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if user := u.User.Username(); user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if _, err := c.do("SELECT", db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply: a string, an int64, nil, or a
+// []any of those.
+func (c *redisConn) do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// doBytes is do with the arguments as bytes, which it writes as they are,
+// so a large one such as an encoded session is not copied.
+func (c *redisConn) doBytes(args ...[]byte) (any, error) {
+	bufs := net.Buffers{fmt.Appendf(nil, "*%d\r\n", len(args))}
+	for _, arg := range args {
+		bufs = append(bufs, fmt.Appendf(nil, "$%d\r\n", len(arg)), arg, []byte("\r\n"))
+	}
+	if _, err := bufs.WriteTo(c.conn); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				var replyErr redisError
+				if !errors.As(err, &replyErr) {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
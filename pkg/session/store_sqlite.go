@@ -0,0 +1,126 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "github.com/sipeed/picoclaw/pkg/sqlite"
+)
+
+// sqliteMigrations create and change the SQLite schema; the version of
+// migration i is i+1. Append to the list, never edit an entry.
+var sqliteMigrations = []string{
+	`CREATE TABLE sessions (
+		namespace  TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (namespace, key)
+	)`,
+}
+
+// SQLiteStore keeps sessions in a SQLite database, one JSON document per
+// session.
+type SQLiteStore struct {
+	db        *sql.DB
+	namespace string
+}
+
+// OpenSQLiteStore opens the database at path, creating it if needed, and
+// brings its schema up to date. It keeps at most maxConns connections
+// open, each with a page cache of cacheKB; zero leaves either to
+// database/sql and SQLite.
+func OpenSQLiteStore(path, namespace string, maxConns, cacheKB int) (*SQLiteStore, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	if cacheKB > 0 {
+		dsn += fmt.Sprintf("&_pragma=cache_size(-%d)", cacheKB)
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxConns)
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("session store %s: %w", path, err)
+	}
+	return &SQLiteStore{db: db, namespace: namespace}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("schema version %d is newer than this build knows (%d)", version, len(sqliteMigrations))
+	}
+	for v := version + 1; v <= len(sqliteMigrations); v++ {
+		if _, err := tx.Exec(sqliteMigrations[v-1]); err != nil {
+			return fmt.Errorf("migration %d: %w", v, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			v, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (st *SQLiteStore) Load() ([]*Session, error) {
+	rows, err := st.db.Query("SELECT data FROM sessions WHERE namespace = ?", st.namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var s Session
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			continue
+		}
+		sessions = append(sessions, &s)
+	}
+	return sessions, rows.Err()
+}
+
+func (st *SQLiteStore) Save(s *Session) error {
+	buf, err := encode(s, false)
+	if err != nil {
+		return err
+	}
+	defer release(buf)
+	// The bytes bind as a blob, which the cast keeps stored as text.
+	_, err = st.db.Exec(`INSERT INTO sessions (namespace, key, data, updated_at) VALUES (?, ?, CAST(? AS TEXT), ?)
+		ON CONFLICT (namespace, key) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		st.namespace, s.Key, buf.Bytes(), s.Updated.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (st *SQLiteStore) Delete(key string) error {
+	_, err := st.db.Exec("DELETE FROM sessions WHERE namespace = ? AND key = ?", st.namespace, key)
+	return err
+}
+
+func (st *SQLiteStore) Close() error {
+	return st.db.Close()
+}
@@ -0,0 +1,366 @@
+package session
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestSQLiteStore_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.SessionStoreConfig{MaxMessages: 3}
+
+	sm, err := Open(cfg, dir, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "agent:main:telegram:direct:1"
+	sm.AddMessage(key, "user", "one")
+	sm.AddFullMessage(key, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c1"}}})
+	sm.AddFullMessage(key, providers.Message{Role: "tool", ToolCallID: "c1", Content: "result"})
+	sm.AddMessage(key, "assistant", "two")
+	sm.AddMessage(key, "user", "three")
+	sm.Pin(key, "", "gpt-test")
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+	other, err := Open(cfg, dir, "coder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.AddMessage("agent:coder:main", "user", "not for main")
+	other.Save("agent:coder:main")
+	sm.Close()
+	other.Close()
+
+	// Reopening runs the migrations again, which must find nothing to do.
+	reopened, err := Open(cfg, dir, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	history := reopened.GetHistory(key)
+	// Trimming to 3 would start at the tool result, which is dropped with
+	// its call.
+	if len(history) != 2 || history[0].Content != "two" || history[1].Content != "three" {
+		t.Errorf("history = %+v", history)
+	}
+	if info := reopened.GetInfo(key); info.Model != "gpt-test" {
+		t.Errorf("info = %+v", info)
+	}
+	if got := reopened.GetHistory("agent:coder:main"); len(got) != 0 {
+		t.Errorf("sessions of another agent leaked: %+v", got)
+	}
+
+	// Sessions are bound as bytes but stored as text.
+	db, err := sql.Open("sqlite", filepath.Join(dir, "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var types string
+	err = db.QueryRow("SELECT group_concat(DISTINCT typeof(data)) FROM sessions").Scan(&types)
+	if err != nil || types != "text" {
+		t.Errorf("sessions stored as %q: %v", types, err)
+	}
+}
+
+func TestOpen_ImportsSessionFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := NewSessionManager(dir)
+	files.AddMessage("agent:main:main", "user", "from a file")
+	files.Save("agent:main:main")
+	files.AddMessage("agent:coder:main", "user", "for the coder")
+	files.Save("agent:coder:main")
+
+	sm, err := Open(config.SessionStoreConfig{}, dir, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if got := sm.GetHistory("agent:main:main"); len(got) != 1 || got[0].Content != "from a file" {
+		t.Errorf("imported history = %+v", got)
+	}
+	if got := sm.GetHistory("agent:coder:main"); len(got) != 0 {
+		t.Errorf("imported the session of another agent: %+v", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "agent_main_main.json.imported")); err != nil {
+		t.Errorf("session file not marked as imported: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "agent_coder_main.json")); err != nil {
+		t.Errorf("session file of another agent was touched: %v", err)
+	}
+}
+
+// fakeRedis serves the commands RedisStore and RedisCoordinator send from
+// a map of hashes and one of keys.
+type fakeRedis struct {
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	keys     map[string]fakeKey
+	password string
+}
+
+type fakeKey struct {
+	value   string
+	expires time.Time
+}
+
+// get returns the value of a key that has not expired.
+func (f *fakeRedis) get(key string) (string, bool) {
+	k, ok := f.keys[key]
+	if !ok || time.Now().After(k.expires) {
+		return "", false
+	}
+	return k.value, true
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{
+		hashes:   make(map[string]map[string]string),
+		keys:     make(map[string]fakeKey),
+		password: password,
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] == f.password {
+				authed, reply = true, "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "PING":
+			reply = "+PONG\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "HSET":
+			if f.hashes[args[1]] == nil {
+				f.hashes[args[1]] = make(map[string]string)
+			}
+			f.hashes[args[1]][args[2]] = args[3]
+			reply = ":1\r\n"
+		case args[0] == "HVALS":
+			var b strings.Builder
+			fmt.Fprintf(&b, "*%d\r\n", len(f.hashes[args[1]]))
+			for _, v := range f.hashes[args[1]] {
+				fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(v), v)
+			}
+			reply = b.String()
+		case args[0] == "HDEL":
+			delete(f.hashes[args[1]], args[2])
+			reply = ":1\r\n"
+		case args[0] == "HGET":
+			if v, ok := f.hashes[args[1]][args[2]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET": // SET key value NX PX ms
+			ms, _ := strconv.Atoi(args[5])
+			if _, taken := f.get(args[1]); taken {
+				reply = "$-1\r\n"
+			} else {
+				f.keys[args[1]] = fakeKey{args[2], time.Now().Add(time.Duration(ms) * time.Millisecond)}
+				reply = "+OK\r\n"
+			}
+		case args[0] == "EVAL": // EVAL script 1 key token [ms]
+			reply = ":0\r\n"
+			if v, ok := f.get(args[3]); ok && v == args[4] {
+				if args[1] == redisUnlockScript {
+					delete(f.keys, args[3])
+				}
+				reply = ":1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		io.WriteString(conn, reply)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func TestMemoryStore_LeavesSessionFilesAlone(t *testing.T) {
+	dir := t.TempDir()
+	files := NewSessionManager(dir)
+	files.AddMessage("agent:main:main", "user", "from a file")
+	files.Save("agent:main:main")
+
+	sm, err := Open(config.SessionStoreConfig{Backend: "memory"}, dir, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if got := sm.GetHistory("agent:main:main"); len(got) != 0 {
+		t.Errorf("memory store imported a session file: %+v", got)
+	}
+	sm.AddMessage("agent:main:test", "user", "hello")
+	if err := sm.Save("agent:main:test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "agent_main_main.json")); err != nil {
+		t.Errorf("session file was touched: %v", err)
+	}
+
+	loaded, err := sm.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].Key != "agent:main:test" || len(loaded[0].Messages) != 1 {
+		t.Errorf("loaded = %+v", loaded)
+	}
+}
+
+func TestRedisStore_RoundTrip(t *testing.T) {
+	server, addr := startFakeRedis(t, "secret")
+	cfg := config.SessionStoreConfig{Backend: "redis", DSN: "redis://:secret@" + addr + "/2", Namespace: "home"}
+
+	sm, err := Open(cfg, t.TempDir(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.AddMessage("agent:main:main", "user", "hello\r\nthere")
+	if err := sm.Save("agent:main:main"); err != nil {
+		t.Fatal(err)
+	}
+	sm.Close()
+
+	server.mu.Lock()
+	data := server.hashes["picoclaw:sessions:home:main"]["agent:main:main"]
+	server.mu.Unlock()
+	var stored Session
+	if err := json.Unmarshal([]byte(data), &stored); err != nil || len(stored.Messages) != 1 {
+		t.Fatalf("stored %q: %v", data, err)
+	}
+
+	reopened, err := Open(cfg, t.TempDir(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := reopened.GetHistory("agent:main:main"); len(got) != 1 || got[0].Content != "hello\r\nthere" {
+		t.Errorf("history = %+v", got)
+	}
+
+	_, err = OpenRedisStore("redis://:wrong@"+addr, "main")
+	if err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("wrong password gave %v", err)
+	}
+}
+
+func TestScramClient_RFC7677(t *testing.T) {
+	s := newScramClient("user", "pencil", "rOprNGfwEbeRWgbNEkqO")
+	if got := s.first(); got != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("client-first = %q", got)
+	}
+	final, err := s.final("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if final != want {
+		t.Errorf("client-final = %q", final)
+	}
+	if err := s.verify("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil {
+		t.Error(err)
+	}
+	if err := s.verify("v=AAAA"); err == nil {
+		t.Error("a wrong server signature was accepted")
+	}
+}
+
+// BenchmarkStore_Save measures the write throughput of the local stores:
+// a chat's session saved after each answer, as it grows to 40 messages.
+func BenchmarkStore_Save(b *testing.B) {
+	for _, backend := range []string{"sqlite", "file"} {
+		b.Run(backend, func(b *testing.B) {
+			store, err := OpenStore(config.SessionStoreConfig{Backend: backend}, b.TempDir(), "main")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer store.Close()
+			s := &Session{Key: "agent:main:telegram:direct:1", Created: time.Now()}
+			for i := range 40 {
+				s.Messages = append(s.Messages, providers.Message{
+					Role:    []string{"user", "assistant"}[i%2],
+					Content: strings.Repeat("A message of a usual length. ", 8),
+				})
+			}
+			data, _ := json.Marshal(s)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				s.Key = "agent:main:telegram:direct:" + strconv.Itoa(i%20)
+				s.Updated = time.Now()
+				if err := store.Save(s); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
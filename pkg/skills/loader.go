@@ -111,8 +111,11 @@ func (sl *SkillsLoader) ListSkills() []SkillInfo {
 		}
 	}
 
-	// Priority: workspace > global > builtin
+	// Priority: workspace > plugins > global > builtin
 	addSkills(sl.workspaceSkills, "workspace")
+	for _, dir := range sl.pluginSkillDirs() {
+		addSkills(dir, "plugin")
+	}
 	addSkills(sl.globalSkills, "global")
 	addSkills(sl.builtinSkills, "builtin")
 
@@ -128,7 +131,15 @@ func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
 		}
 	}
 
-	// 2. then load from global skills (~/.picoclaw/skills)
+	// 2. then from the skills of installed plugins
+	for _, dir := range sl.pluginSkillDirs() {
+		skillFile := filepath.Join(dir, name, "SKILL.md")
+		if content, err := os.ReadFile(skillFile); err == nil {
+			return sl.stripFrontmatter(string(content)), true
+		}
+	}
+
+	// 3. then load from global skills (~/.picoclaw/skills)
 	if sl.globalSkills != "" {
 		skillFile := filepath.Join(sl.globalSkills, name, "SKILL.md")
 		if content, err := os.ReadFile(skillFile); err == nil {
@@ -136,7 +147,7 @@ func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
 		}
 	}
 
-	// 3. finally load from builtin skills
+	// 4. finally load from builtin skills
 	if sl.builtinSkills != "" {
 		skillFile := filepath.Join(sl.builtinSkills, name, "SKILL.md")
 		if content, err := os.ReadFile(skillFile); err == nil {
@@ -147,6 +158,23 @@ func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
 	return "", false
 }
 
+// pluginSkillDirs returns the skills directories of the plugins installed
+// in the workspace, <workspace>/plugins/<plugin>/skills.
+func (sl *SkillsLoader) pluginSkillDirs() []string {
+	if sl.workspace == "" {
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(sl.workspace, "plugins", "*", "skills"))
+	dirs := matches[:0]
+	for _, m := range matches {
+		// Plugins being installed are staged in hidden directories.
+		if !strings.HasPrefix(filepath.Base(filepath.Dir(m)), ".") {
+			dirs = append(dirs, m)
+		}
+	}
+	return dirs
+}
+
 func (sl *SkillsLoader) LoadSkillsForContext(skillNames []string) string {
 	if len(skillNames) == 0 {
 		return ""
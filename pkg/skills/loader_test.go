@@ -163,6 +163,26 @@ func TestListSkillsWorkspaceOverridesGlobal(t *testing.T) {
 	assert.Equal(t, "workspace version", skills[0].Description)
 }
 
+func TestListSkillsFromPlugins(t *testing.T) {
+	tmp := t.TempDir()
+	ws := filepath.Join(tmp, "workspace")
+	global := filepath.Join(tmp, "global")
+
+	createSkillDir(t, filepath.Join(ws, "plugins", "weather", "skills"), "forecast", "forecast", "plugin version")
+	createSkillDir(t, filepath.Join(ws, "plugins", ".install-1", "skills"), "staged", "staged", "being installed")
+	createSkillDir(t, global, "forecast", "forecast", "global version")
+
+	sl := NewSkillsLoader(ws, global, "")
+	skills := sl.ListSkills()
+
+	require.Len(t, skills, 1)
+	assert.Equal(t, "plugin", skills[0].Source)
+	assert.Equal(t, "plugin version", skills[0].Description)
+	content, ok := sl.LoadSkill("forecast")
+	assert.True(t, ok)
+	assert.Contains(t, content, "# forecast")
+}
+
 func TestListSkillsGlobalOverridesBuiltin(t *testing.T) {
 	tmp := t.TempDir()
 	ws := filepath.Join(tmp, "workspace")
@@ -0,0 +1,12 @@
+//go:build (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm64)) || (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (netbsd && amd64) || (openbsd && (amd64 || arm64)) || (windows && (386 || amd64 || arm64))
+
+// Package sqlite registers the pure-Go SQLite driver with database/sql as
+// "sqlite" on the platforms it is built for. Elsewhere, such as on MIPS
+// boards and 32-bit ARM FreeBSD, nothing is registered and Supported is
+// false.
+package sqlite
+
+import _ "modernc.org/sqlite"
+
+// Supported reports whether the SQLite driver is registered.
+const Supported = true
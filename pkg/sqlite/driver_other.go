@@ -0,0 +1,6 @@
+//go:build !((darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm64)) || (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (netbsd && amd64) || (openbsd && (amd64 || arm64)) || (windows && (386 || amd64 || arm64)))
+
+package sqlite
+
+// Supported reports whether the SQLite driver is registered.
+const Supported = false
@@ -0,0 +1,231 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditDetail caps the detail of an audit entry.
+const maxAuditDetail = 1000
+
+// AuditEntry is a security-relevant event: a privileged command, an
+// approval, something a policy refused, a config reload or an erasure.
+type AuditEntry struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`            // e.g. "command", "approval", "tool", "config_reloaded"
+	Actor   string    `json:"actor,omitempty"`   // who did it, e.g. "telegram:123", "admin_api:ops", "cli"
+	Target  string    `json:"target,omitempty"`  // what it was done to, e.g. "/reload" or a sender
+	Outcome string    `json:"outcome,omitempty"` // "ok", "denied" or "failed"
+	Detail  string    `json:"detail,omitempty"`
+	// Prev is the hash of the entry before, empty for the first. Hash is
+	// the SHA-256 of the entry with Hash unset, so editing, removing or
+	// reordering entries breaks the chain.
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// digest returns the hash of the entry.
+func (e AuditEntry) digest() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog appends audit entries to <workspace>/state/audit.jsonl, apart
+// from the operational logs. Entries are never rewritten or removed; each
+// holds the hash of the one before, which Verify checks.
+type AuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewAuditLog creates an audit log for the given workspace.
+func NewAuditLog(workspace string) *AuditLog {
+	return &AuditLog{path: filepath.Join(workspace, "state", "audit.jsonl")}
+}
+
+// Path returns the path of the log file.
+func (l *AuditLog) Path() string {
+	return l.path
+}
+
+// Append records e after the last entry of the log, which is read from
+// the file each time so entries appended by another process, such as the
+// CLI next to the gateway, stay in the chain. A lock on audit.jsonl.lock,
+// held from reading the last entry until e is written, keeps two processes
+// from chaining onto the same entry. It returns e as recorded.
+func (l *AuditLog) Append(e AuditEntry) (AuditEntry, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	// In UTC the time reads back as it was written, so the hash checks.
+	e.Time = e.Time.UTC()
+	if len(e.Detail) > maxAuditDetail {
+		e.Detail = e.Detail[:maxAuditDetail] + "..."
+	}
+	// Invalid UTF-8 would not read back as written either.
+	for _, s := range []*string{&e.Action, &e.Actor, &e.Target, &e.Outcome, &e.Detail} {
+		*s = strings.ToValidUTF8(*s, "\uFFFD")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := l.lockFile()
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	defer unlock()
+	last, err := l.last()
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	e.Seq, e.Prev = last.Seq+1, last.Hash
+	e.Hash = e.digest()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	return e, appendLine(l.path, data)
+}
+
+// lockFile takes the lock other processes appending to the log wait for,
+// and returns the function that releases it.
+func (l *AuditLog) lockFile() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock the audit log: %w", err)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// last returns the last entry of the log, the zero entry when it is
+// empty. Must be called with the lock held.
+func (l *AuditLog) last() (AuditEntry, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return AuditEntry{}, nil
+	}
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	// An entry is well under 8 KB, its detail being capped.
+	offset := max(info.Size()-8<<10, 0)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return AuditEntry{}, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	tail = bytes.TrimSpace(tail)
+	if len(tail) == 0 {
+		return AuditEntry{}, nil
+	}
+	line := tail[bytes.LastIndexByte(tail, '\n')+1:]
+	var e AuditEntry
+	if err := json.Unmarshal(line, &e); err != nil || e.Hash == "" {
+		return AuditEntry{}, fmt.Errorf("the last line of the audit log is damaged; run picoclaw audit verify")
+	}
+	return e, nil
+}
+
+// Recent returns up to n of the latest entries, oldest first, or all of
+// them when n is 0.
+func (l *AuditLog) Recent(n int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := l.scan(func(e AuditEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, e)
+		if n > 0 && len(entries) > n {
+			entries = entries[1:]
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Verify checks the chain of hashes from the first entry to the last. It
+// returns how many entries it checked and the hash of the last one, which
+// operators can note elsewhere: the chain cannot show that entries were
+// cut from the end, but the noted hash then no longer appears. The error
+// names the first entry that does not check.
+func (l *AuditLog) Verify() (n int, head string, err error) {
+	var prev AuditEntry
+	line := 0
+	err = l.scan(func(e AuditEntry, err error) error {
+		line++
+		switch {
+		case err != nil:
+			return fmt.Errorf("line %d is not an audit entry: %w", line, err)
+		case e.Seq != prev.Seq+1:
+			return fmt.Errorf("line %d: entry %d follows entry %d", line, e.Seq, prev.Seq)
+		case e.Prev != prev.Hash:
+			return fmt.Errorf("entry %d does not follow the hash of entry %d", e.Seq, prev.Seq)
+		case e.Hash != e.digest():
+			return fmt.Errorf("entry %d was changed after it was written", e.Seq)
+		}
+		prev = e
+		return nil
+	})
+	return int(prev.Seq), prev.Hash, err
+}
+
+// scan calls fn with each line of the log parsed, stopping at the first
+// error fn returns.
+func (l *AuditLog) scan(fn func(e AuditEntry, err error) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e AuditEntry
+		err := json.Unmarshal(raw, &e)
+		if err := fn(e, err); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FactChange is a change to the remembered facts that memory consolidation
+// proposed and that waits for approval: a fact to add, or the ID of one to
+// forget.
+type FactChange struct {
+	Add      *Fact     `json:"add,omitempty"`
+	Forget   int       `json:"forget,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Proposed time.Time `json:"proposed"`
+}
+
+// ConsolidationStore keeps when memory consolidation last ran and the
+// changes awaiting approval in <workspace>/memory/consolidation.json.
+type ConsolidationStore struct {
+	path string
+
+	mu    sync.Mutex
+	state struct {
+		LastRun time.Time    `json:"last_run"`
+		Pending []FactChange `json:"pending,omitempty"`
+	}
+}
+
+// NewConsolidationStore loads the consolidation state of the given
+// workspace.
+func NewConsolidationStore(workspace string) *ConsolidationStore {
+	cs := &ConsolidationStore{path: filepath.Join(workspace, "memory", "consolidation.json")}
+	if data, err := os.ReadFile(cs.path); err == nil {
+		json.Unmarshal(data, &cs.state)
+	}
+	return cs
+}
+
+// LastRun returns when consolidation last finished, zero if never.
+func (cs *ConsolidationStore) LastRun() time.Time {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.state.LastRun
+}
+
+// Finish records a run that finished at t and proposed the given changes.
+func (cs *ConsolidationStore) Finish(t time.Time, proposed []FactChange) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.state.LastRun = t
+	cs.state.Pending = append(cs.state.Pending, proposed...)
+	return cs.save()
+}
+
+// Pending returns the changes awaiting approval, oldest first.
+func (cs *ConsolidationStore) Pending() []FactChange {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return slices.Clone(cs.state.Pending)
+}
+
+// Take removes the pending change numbered n, from 1, or all of them if n
+// is 0, and returns what it removed.
+func (cs *ConsolidationStore) Take(n int) ([]FactChange, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	var taken []FactChange
+	switch {
+	case n == 0:
+		taken, cs.state.Pending = cs.state.Pending, nil
+	case n > 0 && n <= len(cs.state.Pending):
+		taken = []FactChange{cs.state.Pending[n-1]}
+		cs.state.Pending = slices.Delete(cs.state.Pending, n-1, n)
+	default:
+		return nil, nil
+	}
+	return taken, cs.save()
+}
+
+// Drop removes the pending changes match returns true for and returns how
+// many it removed.
+func (cs *ConsolidationStore) Drop(match func(c FactChange) bool) (int, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	n := len(cs.state.Pending)
+	cs.state.Pending = slices.DeleteFunc(cs.state.Pending, match)
+	if removed := n - len(cs.state.Pending); removed > 0 {
+		return removed, cs.save()
+	}
+	return 0, nil
+}
+
+// save writes the state with a temp file and rename. Must be called with
+// the lock held.
+func (cs *ConsolidationStore) save() error {
+	data, err := json.MarshalIndent(cs.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal consolidation state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cs.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create memory directory: %w", err)
+	}
+	tempFile := cs.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, cs.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RunEvent is a notable event in the life of the gateway, such as a channel
+// outage, kept so operators can see what happened while they were away.
+type RunEvent struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`             // e.g. "channel_down", "channel_up"
+	Source  string    `json:"source,omitempty"` // the component the event is about
+	Message string    `json:"message,omitempty"`
+	// Duration is set on events that end something, e.g. how long an
+	// outage lasted.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// EventLog appends run events to <workspace>/state/run_events.jsonl.
+type EventLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewEventLog creates an event log for the given workspace.
+func NewEventLog(workspace string) *EventLog {
+	return &EventLog{path: filepath.Join(workspace, "state", "run_events.jsonl")}
+}
+
+// Append records ev, filling in the time if it is unset.
+func (l *EventLog) Append(ev RunEvent) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run event: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return appendLine(l.path, data)
+}
+
+// appendLine appends one JSON line to a log file in the state directory.
+func appendLine(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Remove deletes the events match returns true for and returns how many
+// it deleted.
+func (l *EventLog) Remove(match func(ev RunEvent) bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return removeLines(l.path, func(line []byte) bool {
+		var ev RunEvent
+		return json.Unmarshal(line, &ev) == nil && match(ev)
+	})
+}
+
+// removeLines rewrites a log file without the lines match returns true
+// for, and returns how many it left out. Must be called with the log's
+// lock held.
+func removeLines(path string, match func(line []byte) bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 && match(bytes.TrimSpace(line)) {
+			removed++
+			continue
+		}
+		kept.Write(line)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, kept.Bytes(), 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", filepath.Base(tempFile), err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return 0, fmt.Errorf("failed to replace %s: %w", filepath.Base(path), err)
+	}
+	return removed, nil
+}
+
+// Recent returns up to n of the latest events, oldest first. Lines that
+// cannot be parsed are skipped.
+func (l *EventLog) Recent(n int) ([]RunEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open run events: %w", err)
+	}
+	defer f.Close()
+
+	var events []RunEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev RunEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue
+		}
+		events = append(events, ev)
+		if n > 0 && len(events) > n {
+			events = events[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read run events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,152 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fact is something the agent remembers, with where it learned it, so it
+// can say why it believes it and users can take it back.
+type Fact struct {
+	ID      int       `json:"id"`
+	Text    string    `json:"text"`
+	Learned time.Time `json:"learned"`
+	Channel string    `json:"channel,omitempty"`
+	ChatID  string    `json:"chat_id,omitempty"`
+	Sender  string    `json:"sender,omitempty"` // "<channel>:<sender ID>" of who said it
+	Source  string    `json:"source,omitempty"` // what it was learned from, in the user's words
+	// Session is the conversation a fact was found in by memory
+	// consolidation, which does not know the chat it came from.
+	Session string `json:"session,omitempty"`
+}
+
+// FactStore keeps the facts of a workspace in memory/facts.json.
+type FactStore struct {
+	path string
+
+	mu    sync.Mutex
+	facts []Fact
+}
+
+// NewFactStore loads the facts of the given workspace.
+func NewFactStore(workspace string) *FactStore {
+	fs := &FactStore{path: filepath.Join(workspace, "memory", "facts.json")}
+	if data, err := os.ReadFile(fs.path); err == nil {
+		json.Unmarshal(data, &fs.facts)
+	}
+	return fs
+}
+
+// Add records f under a new ID, learned now unless set, and returns it.
+func (fs *FactStore) Add(f Fact) (Fact, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f.ID = 1
+	for _, existing := range fs.facts {
+		f.ID = max(f.ID, existing.ID+1)
+	}
+	if f.Learned.IsZero() {
+		f.Learned = time.Now()
+	}
+	fs.facts = append(fs.facts, f)
+	if err := fs.save(); err != nil {
+		fs.facts = fs.facts[:len(fs.facts)-1]
+		return Fact{}, err
+	}
+	return f, nil
+}
+
+// All returns the facts, oldest first.
+func (fs *FactStore) All() []Fact {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return slices.Clone(fs.facts)
+}
+
+// Get returns the fact with the given ID.
+func (fs *FactStore) Get(id int) (Fact, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	i := slices.IndexFunc(fs.facts, func(f Fact) bool { return f.ID == id })
+	if i < 0 {
+		return Fact{}, false
+	}
+	return fs.facts[i], true
+}
+
+// Find returns a fact with the same text as text, ignoring case,
+// whitespace and final punctuation.
+func (fs *FactStore) Find(text string) (Fact, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	key := NormalizeFact(text)
+	i := slices.IndexFunc(fs.facts, func(f Fact) bool { return NormalizeFact(f.Text) == key })
+	if i < 0 {
+		return Fact{}, false
+	}
+	return fs.facts[i], true
+}
+
+// NormalizeFact reduces the text of a fact to what tells duplicates apart.
+func NormalizeFact(text string) string {
+	return strings.TrimRight(strings.ToLower(strings.Join(strings.Fields(text), " ")), ".!")
+}
+
+// Forget removes the fact with the given ID. It reports whether there was
+// one.
+func (fs *FactStore) Forget(id int) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	i := slices.IndexFunc(fs.facts, func(f Fact) bool { return f.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+	fs.facts = slices.Delete(fs.facts, i, i+1)
+	return true, fs.save()
+}
+
+// ForgetWhere removes the facts match returns true for and returns them.
+func (fs *FactStore) ForgetWhere(match func(f Fact) bool) ([]Fact, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var forgotten []Fact
+	fs.facts = slices.DeleteFunc(fs.facts, func(f Fact) bool {
+		if match(f) {
+			forgotten = append(forgotten, f)
+			return true
+		}
+		return false
+	})
+	if len(forgotten) == 0 {
+		return nil, nil
+	}
+	return forgotten, fs.save()
+}
+
+// save writes the facts with a temp file and rename. Must be called with
+// the lock held.
+func (fs *FactStore) save() error {
+	data, err := json.MarshalIndent(fs.facts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal facts: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create memory directory: %w", err)
+	}
+	tempFile := fs.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, fs.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
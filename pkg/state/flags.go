@@ -0,0 +1,102 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FlagStore keeps the kill switches an operator flipped at runtime in
+// <workspace>/state/flags.json, by name, e.g. "read_only" or "tool:exec".
+// A flag that is not set here follows the config.
+type FlagStore struct {
+	path string
+
+	mu    sync.Mutex
+	flags map[string]bool
+}
+
+// NewFlagStore loads the flags of the given workspace.
+func NewFlagStore(workspace string) *FlagStore {
+	fs := &FlagStore{
+		path:  filepath.Join(workspace, "state", "flags.json"),
+		flags: make(map[string]bool),
+	}
+	if data, err := os.ReadFile(fs.path); err == nil {
+		json.Unmarshal(data, &fs.flags)
+	}
+	return fs
+}
+
+// Get returns the value of the flag called name and whether it is set.
+func (fs *FlagStore) Get(name string) (value, set bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	value, set = fs.flags[name]
+	return value, set
+}
+
+// All returns the flags that are set.
+func (fs *FlagStore) All() map[string]bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return maps.Clone(fs.flags)
+}
+
+// Set sets the flag called name and saves the flags.
+func (fs *FlagStore) Set(name string, value bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	old, had := fs.flags[name]
+	fs.flags[name] = value
+	if err := fs.save(); err != nil {
+		if had {
+			fs.flags[name] = old
+		} else {
+			delete(fs.flags, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Reset unsets all flags, so they follow the config again, and returns
+// the ones that were set.
+func (fs *FlagStore) Reset() (map[string]bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if len(fs.flags) == 0 {
+		return nil, nil
+	}
+	old := fs.flags
+	fs.flags = make(map[string]bool)
+	if err := fs.save(); err != nil {
+		fs.flags = old
+		return nil, err
+	}
+	return old, nil
+}
+
+// save writes the flags with a temp file and rename. Must be called with
+// the lock held.
+func (fs *FlagStore) save() error {
+	data, err := json.MarshalIndent(fs.flags, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal flags: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tempFile := fs.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, fs.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// heldMu serializes Hold and TakeHeld within the process.
+var heldMu sync.Mutex
+
+// heldPath returns the file the messages held under name go to.
+func heldPath(workspace, name string) string {
+	return filepath.Join(workspace, "state", "held_"+name+".jsonl")
+}
+
+// Hold keeps msgs in <workspace>/state/held_<name>.jsonl for the next
+// start of the gateway, which takes them back with TakeHeld: messages it
+// was given while shutting down and had no time for.
+func Hold[T any](workspace, name string, msgs []T) error {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	for _, msg := range msgs {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal held message: %w", err)
+		}
+		if err := appendLine(heldPath(workspace, name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TakeHeld returns the messages held under name, oldest first, and
+// removes them. Lines that cannot be parsed are skipped.
+func TakeHeld[T any](workspace, name string) ([]T, error) {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+
+	path := heldPath(workspace, name)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+
+	var msgs []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var msg T
+		if json.Unmarshal(scanner.Bytes(), &msg) == nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, fmt.Errorf("failed to remove %s: %w", filepath.Base(path), err)
+	}
+	return msgs, nil
+}
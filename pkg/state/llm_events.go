@@ -0,0 +1,144 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LLMEvent records one LLM request of an agent turn: which provider and
+// model served it, and the candidates that failed or were skipped first.
+type LLMEvent struct {
+	Time       time.Time    `json:"time"`
+	AgentID    string       `json:"agent_id"`
+	SessionKey string       `json:"session_key,omitempty"`
+	Iteration  int          `json:"iteration"`
+	Provider   string       `json:"provider,omitempty"`
+	Model      string       `json:"model"`
+	Route      string       `json:"route,omitempty"` // model_list entry, if the model came from one
+	DurationMS int64        `json:"duration_ms"`
+	Attempts   []LLMAttempt `json:"attempts,omitempty"`
+	// PromptTokens and CompletionTokens are the usage the provider
+	// reported, if any. ReasoningTokens are the part of CompletionTokens a
+	// reasoning model spent thinking.
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"`
+	Error            string  `json:"error,omitempty"`    // set when no candidate answered
+	Cached           bool    `json:"cached,omitempty"`   // answered from the response cache
+	CostUSD          float64 `json:"cost_usd,omitempty"` // as the API reported it, else from the pricing table; 0 if unknown
+	// Background is set for scheduled work, which waits for interactive
+	// requests and may use a cheaper service tier.
+	Background bool `json:"background,omitempty"`
+	// Cancelled is set when the run was stopped while the request was in
+	// flight. Its tokens are then estimated, as the provider reported none.
+	Cancelled bool `json:"cancelled,omitempty"`
+	// TaskID is the scheduled run the request was made for, see
+	// WithTaskID.
+	TaskID string `json:"task_id,omitempty"`
+}
+
+// LLMAttempt is a candidate that did not serve the request.
+type LLMAttempt struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"` // in cooldown, not tried
+	DurationMS int64  `json:"duration_ms,omitempty"`
+}
+
+// LLMEventLog appends LLM events to <workspace>/state/llm_events.jsonl.
+type LLMEventLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLLMEventLog creates an LLM event log for the given workspace.
+func NewLLMEventLog(workspace string) *LLMEventLog {
+	return &LLMEventLog{path: filepath.Join(workspace, "state", "llm_events.jsonl")}
+}
+
+// Append records ev, filling in the time if it is unset.
+func (l *LLMEventLog) Append(ev LLMEvent) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal LLM event: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return appendLine(l.path, data)
+}
+
+// Recent returns up to n of the latest LLM events, oldest first. Lines
+// that cannot be parsed are skipped.
+func (l *LLMEventLog) Recent(n int) ([]LLMEvent, error) {
+	var events []LLMEvent
+	err := l.each(func(ev LLMEvent) {
+		events = append(events, ev)
+		if n > 0 && len(events) > n {
+			events = events[1:]
+		}
+	})
+	return events, err
+}
+
+// Since returns the LLM events recorded at or after t, oldest first.
+func (l *LLMEventLog) Since(t time.Time) ([]LLMEvent, error) {
+	var events []LLMEvent
+	err := l.each(func(ev LLMEvent) {
+		if !ev.Time.Before(t) {
+			events = append(events, ev)
+		}
+	})
+	return events, err
+}
+
+// Remove deletes the events match returns true for and returns how many
+// it deleted.
+func (l *LLMEventLog) Remove(match func(ev LLMEvent) bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return removeLines(l.path, func(line []byte) bool {
+		var ev LLMEvent
+		return json.Unmarshal(line, &ev) == nil && match(ev)
+	})
+}
+
+// each calls fn with the events of the log in order.
+func (l *LLMEventLog) each(fn func(LLMEvent)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open LLM events: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	// Error messages of exhausted chains make for long lines.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev LLMEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue
+		}
+		fn(ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read LLM events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile is what the agent knows about a person it talks to: how to
+// address them, their time zone and language, and how they want to be
+// answered.
+type Profile struct {
+	Name     string `json:"name,omitempty"`
+	Timezone string `json:"timezone,omitempty"` // IANA name, e.g. "Europe/Berlin"
+	Locale   string `json:"locale,omitempty"`   // BCP 47 tag, e.g. "de-DE"
+	// Preferences are short facts by topic, e.g. "units": "metric".
+	Preferences map[string]string `json:"preferences,omitempty"`
+	// Instructions are standing orders, e.g. "Keep answers under five
+	// sentences".
+	Instructions []string  `json:"instructions,omitempty"`
+	Updated      time.Time `json:"updated"`
+}
+
+// Empty reports whether nothing is known about the person.
+func (p Profile) Empty() bool {
+	return p.Name == "" && p.Timezone == "" && p.Locale == "" && len(p.Preferences) == 0 && len(p.Instructions) == 0
+}
+
+// SetPreference sets or, with an empty value, removes a preference.
+func (p *Profile) SetPreference(key, value string) {
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if value == "" {
+		delete(p.Preferences, key)
+		return
+	}
+	if p.Preferences == nil {
+		p.Preferences = make(map[string]string)
+	}
+	p.Preferences[key] = value
+}
+
+// RemoveInstruction drops the standing instruction numbered which, from 1,
+// or with that text. It reports whether one was dropped.
+func (p *Profile) RemoveInstruction(which string) bool {
+	which = strings.TrimSpace(which)
+	var i int
+	if n, err := strconv.Atoi(which); err == nil {
+		i = n - 1
+	} else {
+		i = slices.IndexFunc(p.Instructions, func(s string) bool { return strings.EqualFold(s, which) })
+	}
+	if i < 0 || i >= len(p.Instructions) {
+		return false
+	}
+	p.Instructions = slices.Delete(p.Instructions, i, i+1)
+	return true
+}
+
+func (p Profile) clone() Profile {
+	p.Preferences = maps.Clone(p.Preferences)
+	p.Instructions = slices.Clone(p.Instructions)
+	return p
+}
+
+// ProfileStore keeps profiles in <workspace>/state/profiles.json, keyed by
+// "<channel>:<sender ID>".
+type ProfileStore struct {
+	path string
+
+	mu       sync.Mutex
+	profiles map[string]Profile
+}
+
+// NewProfileStore loads the profiles of the given workspace.
+func NewProfileStore(workspace string) *ProfileStore {
+	ps := &ProfileStore{
+		path:     filepath.Join(workspace, "state", "profiles.json"),
+		profiles: make(map[string]Profile),
+	}
+	if data, err := os.ReadFile(ps.path); err == nil {
+		json.Unmarshal(data, &ps.profiles)
+	}
+	return ps
+}
+
+// Get returns the profile of id, which is empty if there is none.
+func (ps *ProfileStore) Get(id string) Profile {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.profiles[id].clone()
+}
+
+// Update changes the profile of id with fn and saves it. A profile left
+// empty is removed.
+func (ps *ProfileStore) Update(id string, fn func(p *Profile)) (Profile, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	p := ps.profiles[id].clone()
+	fn(&p)
+	p.Updated = time.Now()
+	if p.Empty() {
+		delete(ps.profiles, id)
+	} else {
+		ps.profiles[id] = p
+	}
+	return p.clone(), ps.save()
+}
+
+// Delete removes the profile of id.
+func (ps *ProfileStore) Delete(id string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if _, ok := ps.profiles[id]; !ok {
+		return nil
+	}
+	delete(ps.profiles, id)
+	return ps.save()
+}
+
+// save writes the profiles with a temp file and rename. Must be called
+// with the lock held.
+func (ps *ProfileStore) save() error {
+	data, err := json.MarshalIndent(ps.profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profiles: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ps.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tempFile := ps.path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := os.Rename(tempFile, ps.path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestAtomicSave(t *testing.T) {
@@ -214,3 +218,165 @@ func TestNewManager_EmptyWorkspace(t *testing.T) {
 		t.Error("Expected zero timestamp for new state")
 	}
 }
+
+func TestEventLogRecent(t *testing.T) {
+	log := NewEventLog(t.TempDir())
+
+	events, err := log.Recent(5)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("Recent on empty log = %v, %v", events, err)
+	}
+
+	for _, kind := range []string{"a", "b", "c"} {
+		if err := log.Append(RunEvent{Kind: kind, Source: "telegram"}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	events, err = log.Recent(2)
+	if err != nil {
+		t.Fatalf("Recent failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Kind != "b" || events[1].Kind != "c" {
+		t.Errorf("Expected the last two events, got %+v", events)
+	}
+	if events[0].Time.IsZero() {
+		t.Error("Expected Append to set the event time")
+	}
+}
+
+func TestLLMEventLog(t *testing.T) {
+	workspace := t.TempDir()
+	log := NewLLMEventLog(workspace)
+
+	err := log.Append(LLMEvent{
+		AgentID:  "main",
+		Provider: "ollama",
+		Model:    "llama3.2",
+		Route:    "local",
+		Attempts: []LLMAttempt{{Provider: "openrouter", Model: "gpt-4o", Reason: "timeout", Error: "502 Bad Gateway"}},
+	})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "state", "llm_events.jsonl")); err != nil {
+		t.Fatalf("Expected llm_events.jsonl: %v", err)
+	}
+
+	events, err := log.Recent(10)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Recent = %v, %v", events, err)
+	}
+	ev := events[0]
+	if ev.Route != "local" || len(ev.Attempts) != 1 || ev.Attempts[0].Provider != "openrouter" || ev.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+}
+
+func TestTraceLog(t *testing.T) {
+	log := NewTraceLog(t.TempDir())
+	now := time.Now()
+	for _, tr := range []Trace{
+		{Time: now.Add(-48 * time.Hour), Kind: TraceRun, AgentID: "main", SessionKey: "telegram:1"},
+		{Time: now.Add(-time.Hour), Kind: TraceTool, AgentID: "main", SessionKey: "telegram:1", Tool: "exec", Error: "exit status 1"},
+		{Time: now, Kind: TraceRun, AgentID: "main", SessionKey: "telegram:2", Exit: "ok"},
+	} {
+		if err := log.Append(tr); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	traces, err := log.Since(now.Add(-24 * time.Hour))
+	if err != nil || len(traces) != 2 || traces[0].Tool != "exec" || traces[1].SessionKey != "telegram:2" {
+		t.Fatalf("Since = %+v, %v", traces, err)
+	}
+	if n, err := log.Remove(func(tr Trace) bool { return tr.SessionKey == "telegram:1" }); n != 2 || err != nil {
+		t.Fatalf("Remove = %d, %v", n, err)
+	}
+	if traces, _ := log.Since(time.Time{}); len(traces) != 1 {
+		t.Errorf("after Remove: %+v", traces)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	workspace := t.TempDir()
+	log := NewAuditLog(workspace)
+	if n, _, err := log.Verify(); n != 0 || err != nil {
+		t.Fatalf("Verify on empty log = %d, %v", n, err)
+	}
+
+	for _, target := range []string{"/reload", "/erase", "/flags"} {
+		if _, err := log.Append(AuditEntry{Action: "command", Actor: "telegram:7", Target: target, Outcome: "ok"}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	// Another writer of the same file continues the chain.
+	e, err := NewAuditLog(workspace).Append(AuditEntry{Action: "plugin_installed", Actor: "cli", Detail: "bad \xff byte"})
+	if err != nil || e.Seq != 4 || e.Prev == "" {
+		t.Fatalf("Append from another log = %+v, %v", e, err)
+	}
+	n, head, err := log.Verify()
+	if err != nil || n != 4 || head != e.Hash {
+		t.Fatalf("Verify = %d, %q, %v", n, head, err)
+	}
+	entries, _ := log.Recent(2)
+	if len(entries) != 2 || entries[0].Target != "/flags" || entries[1].Seq != 4 {
+		t.Errorf("Recent(2) = %+v", entries)
+	}
+
+	data, _ := os.ReadFile(log.Path())
+	lines := strings.SplitAfter(string(data), "\n")
+	tampered := map[string]string{
+		"changed":  strings.Join(lines[:1], "") + strings.Replace(lines[1], "/erase", "/tools", 1) + strings.Join(lines[2:], ""),
+		"removed":  lines[0] + strings.Join(lines[2:], ""),
+		"reversed": lines[1] + lines[0] + strings.Join(lines[2:], ""),
+	}
+	for name, content := range tampered {
+		os.WriteFile(log.Path(), []byte(content), 0o644)
+		if _, _, err := log.Verify(); err == nil {
+			t.Errorf("Verify passed an audit log with an entry %s", name)
+		}
+	}
+}
+
+func TestAuditLog_ConcurrentWritersKeepOneChain(t *testing.T) {
+	workspace := t.TempDir()
+	// Each log stands for another process: they share only the file.
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log := NewAuditLog(workspace)
+			for i := range 50 {
+				if _, err := log.Append(AuditEntry{Action: "command", Actor: fmt.Sprintf("writer%d", w), Detail: strconv.Itoa(i)}); err != nil {
+					t.Errorf("Append failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _, err := NewAuditLog(workspace).Verify(); err != nil || n != 400 {
+		t.Errorf("Verify = %d, %v, want 400 entries in one chain", n, err)
+	}
+}
+
+func TestHold(t *testing.T) {
+	workspace := t.TempDir()
+	type msg struct{ Text string }
+
+	if err := Hold(workspace, "inbound", []msg{{"a"}, {"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Hold(workspace, "inbound", []msg{{"c"}}); err != nil {
+		t.Fatal(err)
+	}
+	held, err := TakeHeld[msg](workspace, "inbound")
+	if err != nil || len(held) != 3 || held[0].Text != "a" || held[2].Text != "c" {
+		t.Fatalf("TakeHeld = %v, %v", held, err)
+	}
+	if held, err := TakeHeld[msg](workspace, "inbound"); err != nil || len(held) != 0 {
+		t.Errorf("TakeHeld after taking = %v, %v", held, err)
+	}
+}
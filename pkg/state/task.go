@@ -0,0 +1,23 @@
+package state
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+type taskIDKey struct{}
+
+// WithTaskID marks what is done with ctx as part of the scheduled run
+// taskID, so that the LLM requests it makes and what it logs can be found
+// from the run.
+func WithTaskID(ctx context.Context, taskID string) context.Context {
+	ctx = logger.WithField(ctx, "task_id", taskID)
+	return context.WithValue(ctx, taskIDKey{}, taskID)
+}
+
+// TaskID returns the run ctx was marked with by WithTaskID, or "".
+func TaskID(ctx context.Context) string {
+	id, _ := ctx.Value(taskIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Kinds of traces.
+const (
+	TraceRun  = "run"
+	TraceTool = "tool"
+)
+
+// Trace records a finished agent run or one of its tool calls, kept for
+// usage analytics.
+type Trace struct {
+	Time       time.Time `json:"time"` // when it finished
+	Kind       string    `json:"kind"` // TraceRun or TraceTool
+	AgentID    string    `json:"agent_id"`
+	SessionKey string    `json:"session_key,omitempty"`
+	Channel    string    `json:"channel,omitempty"` // of a run
+	TaskID     string    `json:"task_id,omitempty"`
+	Background bool      `json:"background,omitempty"`
+	Tool       string    `json:"tool,omitempty"` // of a tool call
+	DurationMS int64     `json:"duration_ms"`
+	Exit       string    `json:"exit,omitempty"` // of a run, see events.RunOK
+	Error      string    `json:"error,omitempty"`
+}
+
+// TraceLog appends traces to <workspace>/state/traces.jsonl.
+type TraceLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewTraceLog creates a trace log for the given workspace.
+func NewTraceLog(workspace string) *TraceLog {
+	return &TraceLog{path: filepath.Join(workspace, "state", "traces.jsonl")}
+}
+
+// Append records tr, filling in the time if it is unset.
+func (l *TraceLog) Append(tr Trace) error {
+	if tr.Time.IsZero() {
+		tr.Time = time.Now()
+	}
+	data, err := json.Marshal(tr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return appendLine(l.path, data)
+}
+
+// Since returns the traces recorded at or after t, oldest first. Lines
+// that cannot be parsed are skipped.
+func (l *TraceLog) Since(t time.Time) ([]Trace, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open traces: %w", err)
+	}
+	defer f.Close()
+
+	var traces []Trace
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var tr Trace
+		if json.Unmarshal(scanner.Bytes(), &tr) != nil || tr.Time.Before(t) {
+			continue
+		}
+		traces = append(traces, tr)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read traces: %w", err)
+	}
+	return traces, nil
+}
+
+// Remove deletes the traces match returns true for and returns how many
+// it deleted.
+func (l *TraceLog) Remove(match func(tr Trace) bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return removeLines(l.path, func(line []byte) bool {
+		var tr Trace
+		return json.Unmarshal(line, &tr) == nil && match(tr)
+	})
+}
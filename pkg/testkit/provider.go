@@ -0,0 +1,126 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Step is what the Provider answers one LLM request with.
+type Step struct {
+	Content   string
+	ToolCalls []providers.ToolCall
+	Err       error
+}
+
+// Reply answers with content, which ends the run.
+func Reply(content string) Step {
+	return Step{Content: content}
+}
+
+// CallTool asks for the tool name to be called with args. The next step
+// answers the request carrying its result.
+func CallTool(name string, args map[string]any) Step {
+	if args == nil {
+		args = map[string]any{}
+	}
+	return Step{ToolCalls: []providers.ToolCall{{Type: "function", Name: name, Arguments: args}}}
+}
+
+// Fail fails the request with err, as an unreachable provider would.
+func Fail(err error) Step {
+	return Step{Err: err}
+}
+
+// Request is an LLM request the Provider was sent.
+type Request struct {
+	Model    string
+	Messages []providers.Message
+	Tools    []string // names of the tools offered
+}
+
+// LastUser returns the content of the request's latest user message.
+func (r Request) LastUser() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			return r.Messages[i].Content
+		}
+	}
+	return ""
+}
+
+// Provider is an LLM provider answering requests with scripted steps, in
+// order. A request beyond the script fails, so a test notices runs that
+// ask the model more often than it expects.
+type Provider struct {
+	mu       sync.Mutex
+	steps    []Step
+	requests []Request
+	calls    int // tool calls answered, for their IDs
+}
+
+func NewProvider(steps ...Step) *Provider {
+	return &Provider{steps: steps}
+}
+
+// Script appends steps to what is left of the script.
+func (p *Provider) Script(steps ...Step) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, steps...)
+}
+
+// Remaining returns the number of steps not yet answered with.
+func (p *Provider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.steps)
+}
+
+// Requests returns the requests the provider was sent, oldest first.
+func (p *Provider) Requests() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.requests)
+}
+
+func (p *Provider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	req := Request{Model: model, Messages: slices.Clone(messages)}
+	for _, t := range tools {
+		req.Tools = append(req.Tools, t.Function.Name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	if len(p.steps) == 0 {
+		return nil, fmt.Errorf("testkit: request %d is not scripted (last user message %q)", len(p.requests), req.LastUser())
+	}
+	step := p.steps[0]
+	p.steps = p.steps[1:]
+	if step.Err != nil {
+		return nil, step.Err
+	}
+
+	resp := &providers.LLMResponse{Content: step.Content, FinishReason: "stop"}
+	for _, call := range step.ToolCalls {
+		p.calls++
+		call.ID = fmt.Sprintf("call_%d", p.calls)
+		resp.ToolCalls = append(resp.ToolCalls, call)
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+func (p *Provider) GetDefaultModel() string {
+	return Model
+}
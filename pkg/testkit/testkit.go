@@ -0,0 +1,240 @@
+// Package testkit runs picoclaw end to end inside a test, without network,
+// API keys or a database. A Gateway takes messages as a channel would and
+// hands back the replies, a scripted Provider stands in for the LLM, and a
+// Trace records the runs, tool calls and LLM requests in between:
+//
+//	weather := testkit.NewTool("weather", tools.NewToolResult("12°C, rain"))
+//	gw := testkit.New(t, testkit.NewProvider(
+//		testkit.CallTool("weather", map[string]any{"city": "Berlin"}),
+//		testkit.Reply("Take an umbrella."),
+//	), testkit.WithTool(weather))
+//
+//	if reply := gw.Send("Do I need an umbrella?"); reply != "Take an umbrella." {
+//		t.Errorf("reply = %q", reply)
+//	}
+//	if !gw.Trace.Called("weather") {
+//		t.Error("weather was not looked up")
+//	}
+//
+// The gateway is the real agent loop with the default config, a workspace
+// in a temporary directory and sessions kept in memory.
+package testkit
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Model is the model the gateway's agents use, unless configured
+// otherwise.
+const Model = "testkit"
+
+// Where Send's messages come from.
+const (
+	Channel = "testkit"
+	ChatID  = "chat"
+	Sender  = "user"
+)
+
+// DefaultTimeout is how long a Gateway waits for a reply by default.
+const DefaultTimeout = 10 * time.Second
+
+// Option changes how New sets up the gateway.
+type Option func(*options)
+
+type options struct {
+	configure []func(cfg *config.Config)
+	tools     []tools.Tool
+}
+
+// Configure lets fn change the config before the gateway starts.
+func Configure(fn func(cfg *config.Config)) Option {
+	return func(o *options) { o.configure = append(o.configure, fn) }
+}
+
+// WithTool gives every agent tool, replacing a built-in one of the same
+// name.
+func WithTool(tool tools.Tool) Option {
+	return func(o *options) { o.tools = append(o.tools, tool) }
+}
+
+// Gateway is an agent loop fed messages in memory. Replies are collected
+// per chat, in the order they were sent.
+type Gateway struct {
+	Config   *config.Config
+	Loop     *agent.AgentLoop
+	Bus      *bus.MessageBus
+	Provider *Provider
+	Trace    *Trace
+	// Timeout is how long Send and Receive wait for a reply.
+	Timeout time.Duration
+
+	tb      testing.TB
+	mu      sync.Mutex
+	sent    int // messages sent, for their IDs
+	outbox  []bus.OutboundMessage
+	unread  map[string][]bus.OutboundMessage // by "channel:chat_id"
+	arrived chan struct{}                    // closed and replaced when a reply arrives
+}
+
+// New starts a gateway answering with provider. It stops when the test
+// ends.
+func New(tb testing.TB, provider *Provider, opts ...Option) *Gateway {
+	tb.Helper()
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = tb.TempDir()
+	cfg.Agents.Defaults.Model = Model
+	cfg.Session.Store.Backend = "memory"
+	// Queue notices would read as replies.
+	cfg.Gateway.Budget.NotifyQueued = false
+	for _, fn := range o.configure {
+		fn(cfg)
+	}
+
+	msgBus := bus.NewMessageBus()
+	loop, err := agent.NewAgentLoop(cfg, msgBus, provider)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	gw := &Gateway{
+		Config:   cfg,
+		Loop:     loop,
+		Bus:      msgBus,
+		Provider: provider,
+		Timeout:  DefaultTimeout,
+		tb:       tb,
+		unread:   make(map[string][]bus.OutboundMessage),
+		arrived:  make(chan struct{}),
+	}
+	gw.Trace = NewTrace(gw.Loop.Events())
+	for _, tool := range o.tools {
+		gw.Loop.RegisterTool(tool)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{}, 2)
+	go func() {
+		gw.Loop.Run(ctx)
+		stopped <- struct{}{}
+	}()
+	go func() {
+		gw.collect(ctx)
+		stopped <- struct{}{}
+	}()
+	tb.Cleanup(func() {
+		// Let runs still going finish, so they do not write to the
+		// workspace while it is removed.
+		drainCtx, done := context.WithTimeout(context.Background(), gw.Timeout)
+		gw.Loop.Drain(drainCtx)
+		done()
+		gw.Loop.Stop()
+		cancel()
+		<-stopped
+		<-stopped
+	})
+	return gw
+}
+
+func (gw *Gateway) collect(ctx context.Context) {
+	for {
+		msg, ok := gw.Bus.SubscribeOutbound(ctx)
+		if !ok {
+			return
+		}
+		key := msg.Channel + ":" + msg.ChatID
+		gw.mu.Lock()
+		gw.outbox = append(gw.outbox, msg)
+		gw.unread[key] = append(gw.unread[key], msg)
+		close(gw.arrived)
+		gw.arrived = make(chan struct{})
+		gw.mu.Unlock()
+	}
+}
+
+// Send sends content from Sender in ChatID and returns the content of the
+// first reply. It fails the test if none comes within Timeout.
+func (gw *Gateway) Send(content string) string {
+	gw.tb.Helper()
+	return gw.SendMessage(bus.InboundMessage{Content: content}).Content
+}
+
+// SendMessage sends msg and returns the first reply to its chat. An empty
+// Channel, ChatID or SenderID is filled in with Channel, ChatID and
+// Sender. Like a channel, it numbers the message and, unless its metadata
+// says otherwise, sends it as a direct message. It fails the test if no
+// reply comes within Timeout.
+func (gw *Gateway) SendMessage(msg bus.InboundMessage) bus.OutboundMessage {
+	gw.tb.Helper()
+	if msg.Channel == "" {
+		msg.Channel = Channel
+	}
+	if msg.ChatID == "" {
+		msg.ChatID = ChatID
+	}
+	if msg.SenderID == "" {
+		msg.SenderID = Sender
+	}
+	msg.Metadata = maps.Clone(msg.Metadata)
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+	if msg.Metadata["peer_kind"] == "" {
+		msg.Metadata["peer_kind"], msg.Metadata["peer_id"] = "direct", msg.SenderID
+	}
+	if msg.Metadata["message_id"] == "" {
+		gw.mu.Lock()
+		gw.sent++
+		msg.Metadata["message_id"] = strconv.Itoa(gw.sent)
+		gw.mu.Unlock()
+	}
+	gw.Bus.PublishInbound(msg)
+	return gw.Receive(msg.Channel, msg.ChatID)
+}
+
+// Receive returns the next reply to the chat not returned before, waiting
+// for it up to Timeout. It fails the test if none comes.
+func (gw *Gateway) Receive(channel, chatID string) bus.OutboundMessage {
+	gw.tb.Helper()
+	key := channel + ":" + chatID
+	timeout := time.NewTimer(gw.Timeout)
+	defer timeout.Stop()
+	for {
+		gw.mu.Lock()
+		if unread := gw.unread[key]; len(unread) > 0 {
+			gw.unread[key] = unread[1:]
+			gw.mu.Unlock()
+			return unread[0]
+		}
+		arrived := gw.arrived
+		gw.mu.Unlock()
+
+		select {
+		case <-arrived:
+		case <-timeout.C:
+			gw.tb.Fatalf("testkit: no reply in %s within %s", key, gw.Timeout)
+			return bus.OutboundMessage{}
+		}
+	}
+}
+
+// Outbox returns every message the gateway sent, oldest first.
+func (gw *Gateway) Outbox() []bus.OutboundMessage {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return slices.Clone(gw.outbox)
+}
@@ -0,0 +1,94 @@
+package testkit
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestGateway_MessageTriggersToolAndReply(t *testing.T) {
+	weather := NewTool("weather", tools.NewToolResult("12°C, rain"))
+	gw := New(t, NewProvider(
+		CallTool("weather", map[string]any{"city": "Berlin"}),
+		Reply("Take an umbrella."),
+	), WithTool(weather))
+
+	if reply := gw.Send("Do I need an umbrella in Berlin?"); reply != "Take an umbrella." {
+		t.Fatalf("reply = %q", reply)
+	}
+	if got := gw.Trace.Tools(); !slices.Equal(got, []string{"weather"}) {
+		t.Errorf("tools called = %v", got)
+	}
+	if calls := weather.Calls(); len(calls) != 1 || calls[0]["city"] != "Berlin" {
+		t.Errorf("weather calls = %v", calls)
+	}
+
+	reqs := gw.Provider.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d, want 2", len(reqs))
+	}
+	if !slices.Contains(reqs[0].Tools, "weather") {
+		t.Errorf("weather was not offered: %v", reqs[0].Tools)
+	}
+	last := reqs[1].Messages[len(reqs[1].Messages)-1]
+	if last.Role != "tool" || last.Content != "12°C, rain" {
+		t.Errorf("second request did not carry the tool result: %+v", last)
+	}
+	if runs := gw.Trace.Runs(); len(runs) != 1 || runs[0].Exit != "ok" || runs[0].Channel != Channel {
+		t.Errorf("runs = %+v", runs)
+	}
+	if n := len(gw.Trace.LLMRequests()); n != 2 {
+		t.Errorf("traced LLM requests = %d, want 2", n)
+	}
+}
+
+func TestGateway_KeepsTheConversation(t *testing.T) {
+	gw := New(t, NewProvider(Reply("Hi Ada."), Reply("You are Ada.")))
+
+	gw.Send("I'm Ada.")
+	if reply := gw.Send("Who am I?"); reply != "You are Ada." {
+		t.Fatalf("reply = %q", reply)
+	}
+	history := gw.Provider.Requests()[1].Messages
+	if !slices.ContainsFunc(history, func(m providers.Message) bool { return m.Role == "assistant" && m.Content == "Hi Ada." }) {
+		t.Errorf("second request lacks the first answer: %+v", history)
+	}
+}
+
+func TestGateway_Configure(t *testing.T) {
+	gw := New(t, NewProvider(Reply("one"), Reply("two")), Configure(func(cfg *config.Config) {
+		cfg.Session.DMScope = "per-channel-peer"
+	}))
+
+	first := gw.SendMessage(bus.InboundMessage{ChatID: "a", SenderID: "ada", Content: "hello"})
+	second := gw.SendMessage(bus.InboundMessage{ChatID: "b", SenderID: "bob", Content: "hello"})
+	if first.ChatID != "a" || first.Content != "one" || second.ChatID != "b" || second.Content != "two" {
+		t.Fatalf("replies = %+v, %+v", first, second)
+	}
+	if n := len(gw.Provider.Requests()[1].Messages); n != len(gw.Provider.Requests()[0].Messages) {
+		t.Errorf("bob saw ada's history: %d messages, want %d", n, len(gw.Provider.Requests()[0].Messages))
+	}
+	if len(gw.Outbox()) != 2 {
+		t.Errorf("outbox = %+v", gw.Outbox())
+	}
+}
+
+func TestProvider_UnscriptedAndFailedRequests(t *testing.T) {
+	gw := New(t, NewProvider(Fail(errors.New("provider down"))))
+
+	if reply := gw.Send("hello"); !strings.Contains(reply, "provider down") {
+		t.Errorf("reply = %q, want the provider's error", reply)
+	}
+	if reply := gw.Send("again"); !strings.Contains(reply, "not scripted") {
+		t.Errorf("reply = %q, want the unscripted request reported", reply)
+	}
+	if gw.Provider.Remaining() != 0 {
+		t.Errorf("remaining = %d", gw.Provider.Remaining())
+	}
+}
@@ -0,0 +1,45 @@
+package testkit
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Tool is a tool for tests: it answers every call with its result and
+// remembers the arguments.
+type Tool struct {
+	name   string
+	result *tools.ToolResult
+
+	mu    sync.Mutex
+	calls []map[string]any
+}
+
+// NewTool returns the tool name, answering every call with result.
+func NewTool(name string, result *tools.ToolResult) *Tool {
+	return &Tool{name: name, result: result}
+}
+
+func (t *Tool) Name() string        { return t.name }
+func (t *Tool) Description() string { return "Test tool " + t.name + "." }
+
+func (t *Tool) Parameters() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{}}
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	t.mu.Lock()
+	t.calls = append(t.calls, args)
+	t.mu.Unlock()
+	return t.result
+}
+
+// Calls returns the arguments of each call, oldest first.
+func (t *Tool) Calls() []map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.calls)
+}
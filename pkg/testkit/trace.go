@@ -0,0 +1,76 @@
+package testkit
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Trace records what happens in the gateway's runs, from its event bus,
+// in memory.
+type Trace struct {
+	mu        sync.Mutex
+	runs      []events.Run
+	toolCalls []events.ToolCall
+	requests  []state.LLMEvent
+	runEvents []state.RunEvent
+}
+
+// NewTrace returns a trace recording the events published on b.
+func NewTrace(b *events.Bus) *Trace {
+	t := &Trace{}
+	events.Subscribe(b, events.RunFinished, func(r events.Run) { record(t, &t.runs, r) })
+	events.Subscribe(b, events.ToolExecuted, func(c events.ToolCall) { record(t, &t.toolCalls, c) })
+	events.Subscribe(b, events.LLMRequested, func(e state.LLMEvent) { record(t, &t.requests, e) })
+	events.Subscribe(b, events.RunEvent, func(e state.RunEvent) { record(t, &t.runEvents, e) })
+	return t
+}
+
+func record[T any](t *Trace, list *[]T, ev T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*list = append(*list, ev)
+}
+
+func snapshot[T any](t *Trace, list []T) []T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(list)
+}
+
+// Runs returns the runs that finished, oldest first.
+func (t *Trace) Runs() []events.Run { return snapshot(t, t.runs) }
+
+// ToolCalls returns the tool calls that returned, oldest first.
+func (t *Trace) ToolCalls() []events.ToolCall { return snapshot(t, t.toolCalls) }
+
+// LLMRequests returns the LLM requests made, oldest first.
+func (t *Trace) LLMRequests() []state.LLMEvent { return snapshot(t, t.requests) }
+
+// RunEvents returns the run events recorded, such as timeouts and crashes.
+func (t *Trace) RunEvents() []state.RunEvent { return snapshot(t, t.runEvents) }
+
+// Tools returns the names of the tools called, in order.
+func (t *Trace) Tools() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, len(t.toolCalls))
+	for i, c := range t.toolCalls {
+		names[i] = c.Tool
+	}
+	return names
+}
+
+// Called reports whether the tool name was called.
+func (t *Trace) Called(name string) bool {
+	return slices.Contains(t.Tools(), name)
+}
+
+// Reset forgets everything recorded so far.
+func (t *Trace) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runs, t.toolCalls, t.requests, t.runEvents = nil, nil, nil, nil
+}
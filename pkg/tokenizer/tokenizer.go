@@ -0,0 +1,198 @@
+// Package tokenizer estimates how many tokens a text takes for a given
+// model, and how many tokens fit in a model's context window.
+//
+// Shipping the real vocabularies would add megabytes to a binary meant for
+// $10 boards, so the counts come from per-family approximations of the BPE
+// tokenizers, corrected by the prompt token counts providers report (see
+// Calibrate). They err on the high side, which costs a little context but
+// does not overflow it.
+package tokenizer
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// family describes how a tokenizer family splits text.
+type family struct {
+	name string
+	// wholeWord is the longest word that still counts as one token;
+	// common words are in the vocabulary with their leading space.
+	wholeWord int
+	// charsPerToken is the average length of the pieces longer words are
+	// split into.
+	charsPerToken float64
+	// digitsPerToken is the length of the digit groups numbers are split
+	// into; the GPT-4 tokenizers use groups of up to three.
+	digitsPerToken float64
+	// cjkPerRune is the tokens per Chinese, Japanese or Korean character.
+	cjkPerRune float64
+	// otherPerRune is the tokens per letter of other non-Latin scripts.
+	otherPerRune float64
+}
+
+var (
+	familyCL100K   = family{"cl100k", 7, 4.0, 3, 1.0, 0.5}  // GPT-4, GPT-3.5, Llama 3
+	familyO200K    = family{"o200k", 8, 4.2, 3, 0.75, 0.4}  // GPT-4o, GPT-4.1, GPT-5, o-series
+	familyClaude   = family{"claude", 6, 3.6, 1, 1.2, 0.6}  // Claude
+	familyGemini   = family{"gemini", 7, 4.0, 1, 0.8, 0.45} // Gemini, Gemma
+	familyChinese  = family{"chinese", 6, 3.8, 1, 0.7, 0.5} // Qwen, GLM, DeepSeek, Kimi
+	familyFallback = family{"generic", 5, 3.5, 1, 1.3, 0.6} // unknown models, on the safe side
+)
+
+// familyPatterns maps model name fragments to tokenizer families, checked
+// in order. A leading "^" matches the start of the name after the vendor.
+var familyPatterns = []struct {
+	pattern string
+	family  family
+}{
+	{"gpt-4o", familyO200K},
+	{"gpt-4.1", familyO200K},
+	{"gpt-5", familyO200K},
+	{"^o1", familyO200K},
+	{"^o3", familyO200K},
+	{"^o4", familyO200K},
+	{"gpt-oss", familyO200K},
+	{"gpt-4", familyCL100K},
+	{"gpt-3.5", familyCL100K},
+	{"llama3", familyCL100K},
+	{"llama-3", familyCL100K},
+	{"claude", familyClaude},
+	{"gemini", familyGemini},
+	{"gemma", familyGemini},
+	{"qwen", familyChinese},
+	{"glm", familyChinese},
+	{"deepseek", familyChinese},
+	{"kimi", familyChinese},
+	{"moonshot", familyChinese},
+}
+
+func familyOf(model string) family {
+	for _, p := range familyPatterns {
+		if matchModel(model, p.pattern) {
+			return p.family
+		}
+	}
+	return familyFallback
+}
+
+// matchModel reports whether model contains pattern, or starts with it
+// after the last "/" if pattern begins with "^".
+func matchModel(model, pattern string) bool {
+	model = strings.ToLower(model)
+	if prefix, ok := strings.CutPrefix(pattern, "^"); ok {
+		return strings.HasPrefix(model[strings.LastIndex(model, "/")+1:], prefix)
+	}
+	return strings.Contains(model, pattern)
+}
+
+// Family returns the name of the tokenizer family used for model.
+func Family(model string) string {
+	return familyOf(model).name
+}
+
+// Count estimates the number of tokens text takes for model, including
+// the correction learned by Calibrate.
+func Count(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	n := countRaw(familyOf(model), text)
+	return int(math.Ceil(float64(n) * correction(model)))
+}
+
+// countRaw walks text in runs of letters, digits, spaces and punctuation
+// and estimates the tokens of each run the way BPE tokenizers split them:
+// a word with its leading space is usually one token, long words several,
+// punctuation mostly one token per character or two.
+func countRaw(f family, text string) float64 {
+	var tokens float64
+	letters, digits, puncts := 0, 0, 0
+	flush := func() {
+		if letters > 0 {
+			tokens++
+			if letters > f.wholeWord {
+				tokens += math.Ceil(float64(letters-f.wholeWord) / f.charsPerToken)
+			}
+		}
+		if digits > 0 {
+			tokens += math.Ceil(float64(digits) / f.digitsPerToken)
+		}
+		if puncts > 0 {
+			tokens += math.Ceil(float64(puncts) / 2)
+		}
+		letters, digits, puncts = 0, 0, 0
+	}
+
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || r == '_'):
+			if digits > 0 || puncts > 0 {
+				flush()
+			}
+			letters++
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			if letters > 0 || puncts > 0 {
+				flush()
+			}
+			digits++
+		case r == '\n':
+			flush()
+			tokens++
+		case unicode.IsSpace(r):
+			// Spaces merge with the next word.
+			flush()
+		case isCJK(r):
+			flush()
+			tokens += f.cjkPerRune
+		case r >= utf8.RuneSelf && unicode.IsLetter(r):
+			flush()
+			tokens += f.otherPerRune
+		case r >= utf8.RuneSelf:
+			// Emoji and other symbols take a few byte-level tokens.
+			flush()
+			tokens += float64(utf8.RuneLen(r)) / 2
+		default:
+			if letters > 0 || digits > 0 {
+				flush()
+			}
+			puncts++
+		}
+	}
+	flush()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// corrections holds the learned ratio of reported to estimated tokens per
+// model.
+var corrections sync.Map // model -> float64
+
+// Calibrate feeds back the prompt tokens a provider reported for a request
+// that Count estimated at estimated tokens. Later counts for model move
+// towards the reported numbers.
+func Calibrate(model string, estimated, actual int) {
+	if estimated < 100 || actual <= 0 {
+		return // too small to tell overhead from text
+	}
+	ratio := float64(actual) / float64(estimated) * correction(model)
+	// Never trust a single request far: it may have carried images or
+	// cached blocks the estimate knows nothing about.
+	ratio = min(max(ratio, 0.5), 2.0)
+	old := correction(model)
+	corrections.Store(strings.ToLower(model), old*0.7+ratio*0.3)
+}
+
+func correction(model string) float64 {
+	if v, ok := corrections.Load(strings.ToLower(model)); ok {
+		return v.(float64)
+	}
+	return 1
+}
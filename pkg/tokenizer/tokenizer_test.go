@@ -0,0 +1,88 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	// Reference counts from the real tokenizers; the estimates may be
+	// somewhat high but not low by much.
+	tests := []struct {
+		model string
+		text  string
+		real  int
+	}{
+		{"gpt-4o", "Hello, world!", 4},
+		{"gpt-4", "The quick brown fox jumps over the lazy dog.", 10},
+		{"openai/gpt-4o-mini", "Please summarize the following article in three sentences.", 10},
+		{"claude-sonnet-4.6", "func main() {\n\tfmt.Println(\"hi\")\n}\n", 14},
+		{"gpt-4", "1234567890", 4},
+	}
+	for _, tt := range tests {
+		got := Count(tt.model, tt.text)
+		if got < tt.real*8/10 || got > tt.real*2 {
+			t.Errorf("Count(%s, %q) = %d, real %d", tt.model, tt.text, got, tt.real)
+		}
+	}
+
+	english := Count("gpt-4o", strings.Repeat("token ", 100))
+	chinese := Count("gpt-4o", strings.Repeat("你好世界", 100))
+	if english < 90 || english > 130 || chinese < 250 {
+		t.Errorf("english = %d, chinese = %d", english, chinese)
+	}
+	if Count("unknown-model", "some text here") < Count("gpt-4o", "some text here") {
+		t.Error("unknown models should be counted on the safe side")
+	}
+}
+
+func TestFamily(t *testing.T) {
+	for model, want := range map[string]string{
+		"openai/gpt-4o":               "o200k",
+		"o3-mini":                     "o200k",
+		"openrouter/openai/o1":        "o200k",
+		"gpt-4-turbo":                 "cl100k",
+		"anthropic/claude-sonnet-4.6": "claude",
+		"qwen2.5:3b":                  "chinese",
+		"llama3.2":                    "cl100k",
+		"phi-2-o1x":                   "generic",
+	} {
+		if got := Family(model); got != want {
+			t.Errorf("Family(%s) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	model := "calibration-test-model"
+	text := strings.Repeat("calibrate me please ", 200)
+	before := Count(model, text)
+
+	for range 20 {
+		Calibrate(model, Count(model, text), before/2)
+	}
+	after := Count(model, text)
+	if after > before*6/10 || after < before/2 {
+		t.Errorf("after calibration %d, before %d, reported %d", after, before, before/2)
+	}
+
+	Calibrate(model, 10, 1000) // too small to learn from
+	if Count(model, text) != after {
+		t.Error("a tiny request changed the calibration")
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	for model, want := range map[string]int{
+		"gpt-4o-mini":                 128000,
+		"openai/gpt-4.1":              1047576,
+		"o1-mini":                     128000,
+		"anthropic/claude-sonnet-4.6": 200000,
+		"llama3.2:1b":                 131072,
+		"my-finetune":                 0,
+	} {
+		if got := ContextWindow(model); got != want {
+			t.Errorf("ContextWindow(%s) = %d, want %d", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tokenizer
+
+// DefaultContextWindow is assumed for models missing from the table below
+// and from the config.
+const DefaultContextWindow = 32768
+
+// contextWindows lists the context windows of common models by name
+// fragment, most specific first, matched like familyPatterns.
+var contextWindows = []struct {
+	pattern string
+	tokens  int
+}{
+	{"gpt-4.1", 1047576},
+	{"gpt-5", 400000},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5", 16385},
+	{"^o1-mini", 128000},
+	{"^o1", 200000},
+	{"^o3", 200000},
+	{"^o4", 200000},
+	{"gpt-oss", 131072},
+	{"claude", 200000},
+	{"gemini-1.5", 1048576},
+	{"gemini", 1048576},
+	{"gemma", 8192},
+	{"llama3.2", 131072},
+	{"llama-3.2", 131072},
+	{"llama3.1", 131072},
+	{"llama-3.1", 131072},
+	{"llama3", 8192},
+	{"llama-3", 8192},
+	{"qwen2.5", 32768},
+	{"qwen3", 32768},
+	{"qwen", 32768},
+	{"glm-4", 128000},
+	{"deepseek", 65536},
+	{"kimi", 131072},
+	{"moonshot", 131072},
+	{"mistral-large", 131072},
+	{"mistral", 32768},
+	{"phi3", 4096},
+	{"phi-3", 4096},
+}
+
+// ContextWindow returns the context window of model in tokens, or 0 if
+// the model is not known.
+func ContextWindow(model string) int {
+	for _, w := range contextWindows {
+		if matchModel(model, w.pattern) {
+			return w.tokens
+		}
+	}
+	return 0
+}
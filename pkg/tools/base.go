@@ -17,6 +17,62 @@ type ContextualTool interface {
 	SetContext(channel, chatID string)
 }
 
+type toolContextKey struct{}
+
+type toolContext struct {
+	channel  string
+	chatID   string
+	callback AsyncCallback
+}
+
+// WithToolContext attaches the conversation a tool call belongs to, and the
+// async callback for it, to ctx. Tools shared by conversations that run
+// concurrently read these with ToolContextFrom instead of relying on the
+// values last passed to SetContext or SetCallback.
+func WithToolContext(ctx context.Context, channel, chatID string, callback AsyncCallback) context.Context {
+	return context.WithValue(ctx, toolContextKey{}, toolContext{channel: channel, chatID: chatID, callback: callback})
+}
+
+// ToolContextFrom returns the conversation attached by WithToolContext, or
+// empty strings.
+func ToolContextFrom(ctx context.Context) (channel, chatID string) {
+	tc, _ := ctx.Value(toolContextKey{}).(toolContext)
+	return tc.channel, tc.chatID
+}
+
+type senderKey struct{}
+
+// WithSender attaches the person a turn answers, as "<channel>:<sender
+// ID>", to ctx, for tools that act on what the agent knows about them.
+func WithSender(ctx context.Context, sender string) context.Context {
+	return context.WithValue(ctx, senderKey{}, sender)
+}
+
+// SenderFrom returns the person attached by WithSender, or "".
+func SenderFrom(ctx context.Context) string {
+	sender, _ := ctx.Value(senderKey{}).(string)
+	return sender
+}
+
+type sessionKeyKey struct{}
+
+// WithSessionKey attaches the session a turn continues to ctx, for tools
+// that come back to the conversation later.
+func WithSessionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, sessionKeyKey{}, key)
+}
+
+// SessionKeyFrom returns the session attached by WithSessionKey, or "".
+func SessionKeyFrom(ctx context.Context) string {
+	key, _ := ctx.Value(sessionKeyKey{}).(string)
+	return key
+}
+
+func asyncCallbackFrom(ctx context.Context) AsyncCallback {
+	tc, _ := ctx.Value(toolContextKey{}).(toolContext)
+	return tc.callback
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -3,12 +3,16 @@ package tools
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -17,12 +21,18 @@ type JobExecutor interface {
 	ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
 }
 
+// WorkflowRunner runs the workflows cron jobs are scheduled for.
+type WorkflowRunner interface {
+	RunScheduled(ctx context.Context, name string) (string, error)
+}
+
 // CronTool provides scheduling capabilities for the agent
 type CronTool struct {
 	cronService *cron.CronService
 	executor    JobExecutor
 	msgBus      *bus.MessageBus
 	execTool    *ExecTool
+	workflows   WorkflowRunner
 	channel     string
 	chatID      string
 	mu          sync.RWMutex
@@ -51,7 +61,7 @@ func (t *CronTool) Name() string {
 
 // Description returns the tool description
 func (t *CronTool) Description() string {
-	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
+	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'schedule' for schedules said in words (e.g., 'every weekday at 8', 'first monday of the month at 9:30', 'tomorrow at noon'), with 'timezone' when the user gives one. Use 'command' to execute shell commands directly. The reply lists the next runs: tell the user so they can check the schedule was understood."
 }
 
 // Parameters returns the tool parameters schema
@@ -84,6 +94,19 @@ func (t *CronTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Cron expression for complex recurring schedules (e.g., '0 9 * * *' for daily at 9am). Use this for complex recurring schedules.",
 			},
+			"schedule": map[string]any{
+				"type":        "string",
+				"description": "Schedule in plain English, e.g. 'every weekday at 8', 'mondays and thursdays at 7pm', 'first monday of the month', 'every 15 minutes', 'tomorrow at 9:30', 'on 2026-12-24 at 18:00'. Use this instead of the other schedule parameters when the user describes when in words.",
+			},
+			"timezone": map[string]any{
+				"type":        "string",
+				"description": "Optional: IANA time zone for 'schedule' (e.g., 'Europe/Berlin'). Default: the gateway's time zone.",
+			},
+			"catch_up": map[string]any{
+				"type":        "string",
+				"enum":        cron.CatchUpPolicies,
+				"description": "Optional: what to do when runs were missed while the gateway was down. 'once' runs the job once soon after it starts again (good for reminders and reports); 'skip' waits for the next run (good for things only right on time). Default: the gateway's setting.",
+			},
 			"job_id": map[string]any{
 				"type":        "string",
 				"description": "Job ID (for remove/enable/disable)",
@@ -105,6 +128,13 @@ func (t *CronTool) SetContext(channel, chatID string) {
 	t.chatID = chatID
 }
 
+// SetWorkflowRunner sets what runs the jobs of scheduled workflows.
+func (t *CronTool) SetWorkflowRunner(r WorkflowRunner) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.workflows = r
+}
+
 // Execute runs the tool with the given arguments
 func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	action, ok := args["action"].(string)
@@ -114,7 +144,7 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 
 	switch action {
 	case "add":
-		return t.addJob(args)
+		return t.addJob(ctx, args)
 	case "list":
 		return t.listJobs()
 	case "remove":
@@ -128,11 +158,14 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 }
 
-func (t *CronTool) addJob(args map[string]any) *ToolResult {
-	t.mu.RLock()
-	channel := t.channel
-	chatID := t.chatID
-	t.mu.RUnlock()
+func (t *CronTool) addJob(ctx context.Context, args map[string]any) *ToolResult {
+	channel, chatID := ToolContextFrom(ctx)
+	if channel == "" {
+		t.mu.RLock()
+		channel = t.channel
+		chatID = t.chatID
+		t.mu.RUnlock()
+	}
 
 	if channel == "" || chatID == "" {
 		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
@@ -145,13 +178,27 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 
 	var schedule cron.CronSchedule
 
-	// Check for at_seconds (one-time), every_seconds (recurring), or cron_expr
+	// Check for schedule (in words), at_seconds (one-time), every_seconds
+	// (recurring), or cron_expr
+	when, hasWhen := args["schedule"].(string)
 	atSeconds, hasAt := args["at_seconds"].(float64)
 	everySeconds, hasEvery := args["every_seconds"].(float64)
 	cronExpr, hasCron := args["cron_expr"].(string)
 
-	// Priority: at_seconds > every_seconds > cron_expr
-	if hasAt {
+	// Priority: schedule > at_seconds > every_seconds > cron_expr
+	if hasWhen && when != "" {
+		loc := time.Local
+		if tz, _ := args["timezone"].(string); tz != "" {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return ErrorResult(fmt.Sprintf("unknown timezone %q", tz))
+			}
+		}
+		var err error
+		if schedule, err = cron.ParseSchedule(when, loc, time.Now()); err != nil {
+			return ErrorResult(err.Error())
+		}
+	} else if hasAt {
 		atMS := time.Now().UnixMilli() + int64(atSeconds)*1000
 		schedule = cron.CronSchedule{
 			Kind: "at",
@@ -169,7 +216,7 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 			Expr: cronExpr,
 		}
 	} else {
-		return ErrorResult("one of at_seconds, every_seconds, or cron_expr is required")
+		return ErrorResult("one of schedule, at_seconds, every_seconds, or cron_expr is required")
 	}
 
 	// Read deliver parameter, default to true
@@ -178,6 +225,11 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		deliver = d
 	}
 
+	catchUp, _ := args["catch_up"].(string)
+	if catchUp != "" && !slices.Contains(cron.CatchUpPolicies, catchUp) {
+		return ErrorResult(fmt.Sprintf("catch_up must be one of %s", strings.Join(cron.CatchUpPolicies, ", ")))
+	}
+
 	command, _ := args["command"].(string)
 	if command != "" {
 		// Commands must be processed by agent/exec tool, so deliver must be false (or handled specifically)
@@ -202,13 +254,34 @@ func (t *CronTool) addJob(args map[string]any) *ToolResult {
 		return ErrorResult(fmt.Sprintf("Error adding job: %v", err))
 	}
 
-	if command != "" {
+	if command != "" || catchUp != "" {
 		job.Payload.Command = command
+		job.CatchUp = catchUp
 		// Need to save the updated payload
 		t.cronService.UpdateJob(job)
 	}
 
-	return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s)", job.Name, job.ID))
+	return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s, %s)%s", job.Name, job.ID, job.Schedule, nextRunsText(job.Schedule)))
+}
+
+// nextRunsText lists the next three runs of schedule, so that the user can
+// tell whether it was read as meant.
+func nextRunsText(schedule cron.CronSchedule) string {
+	runs := cron.NextRuns(schedule, time.Now(), 3)
+	if len(runs) == 0 {
+		return ""
+	}
+	loc := time.Local
+	if schedule.TZ != "" {
+		if l, err := time.LoadLocation(schedule.TZ); err == nil {
+			loc = l
+		}
+	}
+	text := "\nNext runs:"
+	for _, run := range runs {
+		text += "\n- " + run.In(loc).Format("Mon 2006-01-02 15:04 MST")
+	}
+	return text
 }
 
 func (t *CronTool) listJobs() *ToolResult {
@@ -220,17 +293,7 @@ func (t *CronTool) listJobs() *ToolResult {
 
 	result := "Scheduled jobs:\n"
 	for _, j := range jobs {
-		var scheduleInfo string
-		if j.Schedule.Kind == "every" && j.Schedule.EveryMS != nil {
-			scheduleInfo = fmt.Sprintf("every %ds", *j.Schedule.EveryMS/1000)
-		} else if j.Schedule.Kind == "cron" {
-			scheduleInfo = j.Schedule.Expr
-		} else if j.Schedule.Kind == "at" {
-			scheduleInfo = "one-time"
-		} else {
-			scheduleInfo = "unknown"
-		}
-		result += fmt.Sprintf("- %s (id: %s, %s)\n", j.Name, j.ID, scheduleInfo)
+		result += fmt.Sprintf("- %s (id: %s, %s)\n", j.Name, j.ID, j.Schedule)
 	}
 
 	return SilentResult(result)
@@ -266,8 +329,12 @@ func (t *CronTool) enableJob(args map[string]any, enable bool) *ToolResult {
 	return SilentResult(fmt.Sprintf("Cron job '%s' %s", job.Name, status))
 }
 
-// ExecuteJob executes a cron job through the agent
-func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
+// ExecuteJob executes a cron job through the agent and returns what it
+// sent. A command that failed or an agent run that did is an error, which
+// the job's history keeps.
+func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) (string, error) {
+	ctx = state.WithTaskID(ctx, job.State.TaskID)
+
 	// Get channel/chatID from job payload
 	channel := job.Payload.Channel
 	chatID := job.Payload.To
@@ -280,6 +347,37 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 		chatID = "direct"
 	}
 
+	// A run missed while the gateway was down says so.
+	late := ""
+	if note := lateNote(job); note != "" {
+		late = note + "\n"
+	}
+
+	// A workflow reports to the chats its steps send to.
+	if job.Payload.Workflow != "" {
+		t.mu.RLock()
+		workflows := t.workflows
+		t.mu.RUnlock()
+		if workflows == nil {
+			return "", fmt.Errorf("workflows are not available")
+		}
+		return workflows.RunScheduled(providers.WithBackground(ctx), job.Payload.Workflow)
+	}
+
+	// A follow-up continues the conversation it was scheduled in and
+	// reports back there.
+	if job.Payload.Session != "" {
+		response, err := t.executor.ProcessDirectWithChannel(
+			providers.WithBackground(ctx), late+followUpPrompt(job), job.Payload.Session, channel, chatID)
+		if err != nil {
+			return "", err
+		}
+		if response != "" {
+			t.msgBus.PublishOutbound(bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: response, Proactive: true})
+		}
+		return response, nil
+	}
+
 	// Execute command if present
 	if job.Payload.Command != "" {
 		args := map[string]any{
@@ -288,46 +386,74 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 
 		result := t.execTool.Execute(ctx, args)
 		var output string
+		var err error
 		if result.IsError {
 			output = fmt.Sprintf("Error executing scheduled command: %s", result.ForLLM)
+			err = fmt.Errorf("command failed: %s", utils.Truncate(result.ForLLM, 200))
 		} else {
 			output = fmt.Sprintf("Scheduled command '%s' executed:\n%s", job.Payload.Command, result.ForLLM)
 		}
+		output = late + output
 
 		t.msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: output,
+			Channel:   channel,
+			ChatID:    chatID,
+			Content:   output,
+			Proactive: true,
 		})
-		return "ok"
+		return output, err
 	}
 
 	// If deliver=true, send message directly without agent processing
 	if job.Payload.Deliver {
 		t.msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: job.Payload.Message,
+			Channel:   channel,
+			ChatID:    chatID,
+			Content:   late + job.Payload.Message,
+			Proactive: true,
 		})
-		return "ok"
+		return late + job.Payload.Message, nil
 	}
 
 	// For deliver=false, process through agent (for complex tasks)
 	sessionKey := fmt.Sprintf("cron-%s", job.ID)
 
-	// Call agent with job's message
+	// Call agent with job's message. Nobody is waiting on it, so its LLM
+	// requests give way to interactive ones.
 	response, err := t.executor.ProcessDirectWithChannel(
-		ctx,
-		job.Payload.Message,
+		providers.WithBackground(ctx),
+		late+job.Payload.Message,
 		sessionKey,
 		channel,
 		chatID,
 	)
 	if err != nil {
-		return fmt.Sprintf("Error: %v", err)
+		return "", err
 	}
 
 	// Response is automatically sent via MessageBus by AgentLoop
-	_ = response // Will be sent by AgentLoop
-	return "ok"
+	return response, nil
+}
+
+// followUpPrompt is what a follow-up job asks the agent when it is due.
+func followUpPrompt(job *cron.CronJob) string {
+	created := time.UnixMilli(job.CreatedAtMS).Format("Mon 2006-01-02 15:04 MST")
+	prompt := fmt.Sprintf("[Follow-up you scheduled on %s] %s", created, job.Payload.Message)
+	if job.Payload.Context != "" {
+		prompt += "\nWhat you noted then: " + job.Payload.Context
+	}
+	return prompt + "\nDo it now and report back to the user."
+}
+
+// lateNote tells that job runs late because the gateway was down when it
+// was due, or is empty for a run on time.
+func lateNote(job *cron.CronJob) string {
+	if job.State.MissedAtMS == nil {
+		return ""
+	}
+	due := time.UnixMilli(*job.State.MissedAtMS).Format("Mon 2006-01-02 15:04 MST")
+	if job.State.MissedRuns > 1 {
+		return fmt.Sprintf("(Late: due %s and %d runs since, while the gateway was offline.)", due, job.State.MissedRuns-1)
+	}
+	return fmt.Sprintf("(Late: due %s, while the gateway was offline.)", due)
 }
@@ -0,0 +1,336 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// defaultWarnTemperature is the temperature, in °C, the board is warned
+// about at when neither the config nor the board says.
+const defaultWarnTemperature = 80
+
+// DeviceTool reads the state of the board picoclaw runs on: its
+// temperatures, CPU load, memory, disk and battery, from /proc and /sys,
+// and the GPIO pins the config allows.
+type DeviceTool struct {
+	root      string // of /proc and /sys, "/" but in tests
+	workspace string // whose disk is reported
+	pins      []int
+	warnC     float64
+}
+
+func NewDeviceTool(workspace string, cfg config.DeviceToolConfig) *DeviceTool {
+	return &DeviceTool{root: "/", workspace: workspace, pins: cfg.GPIOPins, warnC: cfg.WarnTemperatureC}
+}
+
+func (t *DeviceTool) Name() string {
+	return "device"
+}
+
+func (t *DeviceTool) Description() string {
+	desc := "Read the state of the board this runs on. Actions: status (board temperature and thermal throttling, " +
+		"CPU load and frequency, memory, disk and battery), gpio_read (the level of a GPIO pin)."
+	if len(t.pins) == 0 {
+		return desc + " No GPIO pins may be read."
+	}
+	return desc + " GPIO pins that may be read: " + joinInts(t.pins) + "."
+}
+
+func (t *DeviceTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"status", "gpio_read"},
+				"description": "status (temperature, CPU, memory, disk, battery) or gpio_read (one pin)",
+			},
+			"pin": map[string]any{
+				"type":        "integer",
+				"description": "GPIO pin number, as in /sys/class/gpio. Required for gpio_read.",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *DeviceTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	action, _ := args["action"].(string)
+	switch action {
+	case "status":
+		return SilentResult(t.Status().String())
+	case "gpio_read":
+		pin, ok := args["pin"].(float64)
+		if !ok {
+			return ErrorResult("pin is required for gpio_read")
+		}
+		value, err := t.ReadGPIO(int(pin))
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(fmt.Sprintf("GPIO %d is %s (%d)", int(pin), map[int]string{0: "low", 1: "high"}[value], value))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s (valid: status, gpio_read)", action))
+	}
+}
+
+// ThermalZone is the temperature of one sensor of the board.
+type ThermalZone struct {
+	Name string
+	// TempC is the temperature, PassiveC where the kernel starts
+	// throttling the CPU to cool it, 0 when the zone has no such trip
+	// point.
+	TempC, PassiveC float64
+}
+
+// DeviceStatus is what the device tool reports. Readings the system does
+// not offer are zero.
+type DeviceStatus struct {
+	Board           string
+	Zones           []ThermalZone
+	CPUs            int
+	Load1, Load5    float64
+	Load15          float64
+	CPUMHz          int
+	CPUMaxMHz       int
+	MemTotalMB      int
+	MemAvailableMB  int
+	DiskTotalMB     int64
+	DiskFreeMB      int64
+	BatteryPercent  int    // -1 without a battery
+	BatteryStatus   string // e.g. "Charging", "Discharging"
+	WarnTemperature float64
+}
+
+// Throttling reports whether a zone is at the point where the kernel
+// slows the CPU down to cool it.
+func (s DeviceStatus) Throttling() bool {
+	return slices.ContainsFunc(s.Zones, func(z ThermalZone) bool { return z.PassiveC > 0 && z.TempC >= z.PassiveC })
+}
+
+// Hottest returns the hottest zone, and false when there are none.
+func (s DeviceStatus) Hottest() (ThermalZone, bool) {
+	if len(s.Zones) == 0 {
+		return ThermalZone{}, false
+	}
+	return slices.MaxFunc(s.Zones, func(a, b ThermalZone) int {
+		switch {
+		case a.TempC < b.TempC:
+			return -1
+		case a.TempC > b.TempC:
+			return 1
+		}
+		return 0
+	}), true
+}
+
+func (s DeviceStatus) String() string {
+	var b strings.Builder
+	if s.Board != "" {
+		fmt.Fprintf(&b, "Board: %s\n", s.Board)
+	}
+	for _, z := range s.Zones {
+		fmt.Fprintf(&b, "Temperature %s: %.1f°C", z.Name, z.TempC)
+		if z.PassiveC > 0 {
+			fmt.Fprintf(&b, " (throttles at %.0f°C)", z.PassiveC)
+		}
+		b.WriteString("\n")
+	}
+	if len(s.Zones) == 0 {
+		b.WriteString("Temperature: no sensor found\n")
+	} else if s.Throttling() {
+		b.WriteString("Thermal throttling: yes, the CPU is slowed down to cool the board\n")
+	}
+	fmt.Fprintf(&b, "CPU load: %.2f %.2f %.2f (1, 5, 15 min) on %d CPUs\n", s.Load1, s.Load5, s.Load15, s.CPUs)
+	if s.CPUMHz > 0 {
+		fmt.Fprintf(&b, "CPU frequency: %d MHz", s.CPUMHz)
+		if s.CPUMaxMHz > 0 {
+			fmt.Fprintf(&b, " of %d MHz", s.CPUMaxMHz)
+		}
+		b.WriteString("\n")
+	}
+	if s.MemTotalMB > 0 {
+		fmt.Fprintf(&b, "Memory: %d MB available of %d MB\n", s.MemAvailableMB, s.MemTotalMB)
+	}
+	if s.DiskTotalMB > 0 {
+		fmt.Fprintf(&b, "Disk: %d MB free of %d MB\n", s.DiskFreeMB, s.DiskTotalMB)
+	}
+	if s.BatteryPercent >= 0 {
+		fmt.Fprintf(&b, "Battery: %d%%", s.BatteryPercent)
+		if s.BatteryStatus != "" {
+			fmt.Fprintf(&b, ", %s", strings.ToLower(s.BatteryStatus))
+		}
+		b.WriteString("\n")
+	} else {
+		b.WriteString("Battery: none\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Status reads the board's state.
+func (t *DeviceTool) Status() DeviceStatus {
+	s := DeviceStatus{CPUs: runtime.NumCPU(), BatteryPercent: -1, WarnTemperature: t.warnC}
+	s.Board = strings.TrimRight(t.read("proc/device-tree/model"), "\x00\n")
+	s.Zones = t.thermalZones()
+	if s.WarnTemperature <= 0 {
+		s.WarnTemperature = defaultWarnTemperature
+		for _, z := range s.Zones {
+			if z.PassiveC > 0 && z.PassiveC < s.WarnTemperature {
+				s.WarnTemperature = z.PassiveC
+			}
+		}
+	}
+
+	if f := strings.Fields(t.read("proc/loadavg")); len(f) >= 3 {
+		s.Load1, _ = strconv.ParseFloat(f[0], 64)
+		s.Load5, _ = strconv.ParseFloat(f[1], 64)
+		s.Load15, _ = strconv.ParseFloat(f[2], 64)
+	}
+	s.CPUMHz = t.readInt("sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq") / 1000
+	s.CPUMaxMHz = t.readInt("sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq") / 1000
+
+	for _, line := range strings.Split(t.read("proc/meminfo"), "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		kb, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB"))
+		switch key {
+		case "MemTotal":
+			s.MemTotalMB = kb / 1024
+		case "MemAvailable":
+			s.MemAvailableMB = kb / 1024
+		}
+	}
+	if t.workspace != "" {
+		if total, free, err := diskUsage(t.workspace); err == nil {
+			s.DiskTotalMB, s.DiskFreeMB = int64(total>>20), int64(free>>20)
+		}
+	}
+
+	supplies, _ := filepath.Glob(filepath.Join(t.root, "sys/class/power_supply/*"))
+	for _, dir := range supplies {
+		rel, _ := filepath.Rel(t.root, dir)
+		if strings.TrimSpace(t.read(filepath.Join(rel, "type"))) != "Battery" {
+			continue
+		}
+		s.BatteryPercent = t.readInt(filepath.Join(rel, "capacity"))
+		s.BatteryStatus = strings.TrimSpace(t.read(filepath.Join(rel, "status")))
+		break
+	}
+	return s
+}
+
+// thermalZones reads the thermal zones and their passive trip points.
+func (t *DeviceTool) thermalZones() []ThermalZone {
+	dirs, _ := filepath.Glob(filepath.Join(t.root, "sys/class/thermal/thermal_zone*"))
+	var zones []ThermalZone
+	for _, dir := range dirs {
+		rel, _ := filepath.Rel(t.root, dir)
+		temp := strings.TrimSpace(t.read(filepath.Join(rel, "temp")))
+		milli, err := strconv.Atoi(temp)
+		if err != nil {
+			continue
+		}
+		z := ThermalZone{Name: strings.TrimSpace(t.read(filepath.Join(rel, "type"))), TempC: float64(milli) / 1000}
+		if z.Name == "" {
+			z.Name = filepath.Base(dir)
+		}
+		trips, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+		for _, trip := range trips {
+			if strings.TrimSpace(readSysFile(trip)) != "passive" {
+				continue
+			}
+			milli, err := strconv.Atoi(strings.TrimSpace(readSysFile(strings.TrimSuffix(trip, "_type") + "_temp")))
+			if err == nil && milli > 0 && (z.PassiveC == 0 || float64(milli)/1000 < z.PassiveC) {
+				z.PassiveC = float64(milli) / 1000
+			}
+		}
+		zones = append(zones, z)
+	}
+	return zones
+}
+
+// ReadGPIO returns the level of the GPIO pin, 0 or 1, through sysfs. A
+// pin not exported yet is exported for the read and unexported after.
+func (t *DeviceTool) ReadGPIO(pin int) (int, error) {
+	if !slices.Contains(t.pins, pin) {
+		if len(t.pins) == 0 {
+			return 0, fmt.Errorf("no GPIO pins may be read; allow them in tools.device.gpio_pins")
+		}
+		return 0, fmt.Errorf("GPIO %d may not be read; allowed are %s", pin, joinInts(t.pins))
+	}
+	gpio := filepath.Join(t.root, "sys/class/gpio")
+	value := filepath.Join(gpio, fmt.Sprintf("gpio%d", pin), "value")
+	if _, err := os.Stat(value); err != nil {
+		if err := os.WriteFile(filepath.Join(gpio, "export"), []byte(strconv.Itoa(pin)), 0o200); err != nil {
+			return 0, fmt.Errorf("failed to export GPIO %d: %w", pin, err)
+		}
+		defer os.WriteFile(filepath.Join(gpio, "unexport"), []byte(strconv.Itoa(pin)), 0o200)
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read GPIO %d: %w", pin, err)
+	}
+	level, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("GPIO %d reads %q", pin, data)
+	}
+	return level, nil
+}
+
+// DeviceAlert is a problem of the board worth telling the user about.
+// Kind stays the same while the problem lasts.
+type DeviceAlert struct {
+	Kind    string
+	Message string
+}
+
+// Alerts returns what is wrong with the board: it is hot, or the kernel
+// throttles its CPU.
+func (t *DeviceTool) Alerts() []DeviceAlert {
+	s := t.Status()
+	hottest, ok := s.Hottest()
+	if !ok {
+		return nil
+	}
+	var alerts []DeviceAlert
+	if s.Throttling() {
+		alerts = append(alerts, DeviceAlert{Kind: "throttling", Message: fmt.Sprintf(
+			"The board is thermally throttling: %s is at %.1f°C, so the CPU runs slower to cool down.", hottest.Name, hottest.TempC)})
+	} else if hottest.TempC >= s.WarnTemperature {
+		alerts = append(alerts, DeviceAlert{Kind: "hot", Message: fmt.Sprintf(
+			"The board is hot: %s is at %.1f°C, above %.0f°C.", hottest.Name, hottest.TempC, s.WarnTemperature)})
+	}
+	return alerts
+}
+
+func (t *DeviceTool) read(rel string) string {
+	return readSysFile(filepath.Join(t.root, rel))
+}
+
+func (t *DeviceTool) readInt(rel string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(t.read(rel)))
+	return n
+}
+
+func readSysFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
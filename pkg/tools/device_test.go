@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeBoard writes files under a temporary root, as /proc and /sys would
+// have them.
+func fakeBoard(t *testing.T, files map[string]string) *DeviceTool {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tool := NewDeviceTool(root, config.DeviceToolConfig{GPIOPins: []int{17}})
+	tool.root = root
+	return tool
+}
+
+var licheeRV = map[string]string{
+	"proc/device-tree/model":                               "Sipeed LicheeRV Nano\x00",
+	"proc/loadavg":                                         "0.52 0.40 0.31 1/87 1234\n",
+	"proc/meminfo":                                         "MemTotal:         262144 kB\nMemFree:           20480 kB\nMemAvailable:     131072 kB\n",
+	"sys/class/thermal/thermal_zone0/type":                 "cpu-thermal\n",
+	"sys/class/thermal/thermal_zone0/temp":                 "61500\n",
+	"sys/class/thermal/thermal_zone0/trip_point_0_type":    "passive\n",
+	"sys/class/thermal/thermal_zone0/trip_point_0_temp":    "85000\n",
+	"sys/class/thermal/thermal_zone0/trip_point_1_type":    "critical\n",
+	"sys/class/thermal/thermal_zone0/trip_point_1_temp":    "100000\n",
+	"sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq": "1000000\n",
+	"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq": "1000000\n",
+	"sys/class/power_supply/usb/type":                      "USB\n",
+	"sys/class/power_supply/battery/type":                  "Battery\n",
+	"sys/class/power_supply/battery/capacity":              "76\n",
+	"sys/class/power_supply/battery/status":                "Discharging\n",
+	"sys/class/gpio/gpio17/value":                          "1\n",
+}
+
+func TestDeviceTool_Status(t *testing.T) {
+	tool := fakeBoard(t, licheeRV)
+	result := tool.Execute(context.Background(), map[string]any{"action": "status"})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	for _, want := range []string{
+		"Board: Sipeed LicheeRV Nano\n",
+		"Temperature cpu-thermal: 61.5°C (throttles at 85°C)",
+		"CPU load: 0.52 0.40 0.31",
+		"CPU frequency: 1000 MHz of 1000 MHz",
+		"Memory: 128 MB available of 256 MB",
+		"Disk: ",
+		"Battery: 76%, discharging",
+	} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("status lacks %q:\n%s", want, result.ForLLM)
+		}
+	}
+	if strings.Contains(result.ForLLM, "throttling: yes") {
+		t.Errorf("throttling at 61.5°C:\n%s", result.ForLLM)
+	}
+	if alerts := tool.Alerts(); len(alerts) != 0 {
+		t.Errorf("alerts at 61.5°C: %v", alerts)
+	}
+}
+
+func TestDeviceTool_Alerts(t *testing.T) {
+	board := map[string]string{}
+	for k, v := range licheeRV {
+		board[k] = v
+	}
+	board["sys/class/thermal/thermal_zone0/temp"] = "86200\n"
+	alerts := fakeBoard(t, board).Alerts()
+	if len(alerts) != 1 || alerts[0].Kind != "throttling" || !strings.Contains(alerts[0].Message, "86.2°C") {
+		t.Errorf("alerts at 86.2°C = %v", alerts)
+	}
+
+	// Without a trip point, the config's temperature counts.
+	delete(board, "sys/class/thermal/thermal_zone0/trip_point_0_type")
+	board["sys/class/thermal/thermal_zone0/temp"] = "72000\n"
+	tool := fakeBoard(t, board)
+	tool.warnC = 70
+	if alerts := tool.Alerts(); len(alerts) != 1 || alerts[0].Kind != "hot" {
+		t.Errorf("alerts at 72°C, warning at 70°C = %v", alerts)
+	}
+	if alerts := fakeBoard(t, map[string]string{}).Alerts(); alerts != nil {
+		t.Errorf("alerts without sensors = %v", alerts)
+	}
+}
+
+func TestDeviceTool_GPIORead(t *testing.T) {
+	tool := fakeBoard(t, licheeRV)
+	result := tool.Execute(context.Background(), map[string]any{"action": "gpio_read", "pin": float64(17)})
+	if result.IsError || result.ForLLM != "GPIO 17 is high (1)" {
+		t.Errorf("gpio_read 17 = %+v", result)
+	}
+	result = tool.Execute(context.Background(), map[string]any{"action": "gpio_read", "pin": float64(4)})
+	if !result.IsError || !strings.Contains(result.ForLLM, "may not be read") {
+		t.Errorf("gpio_read of a pin not allowed = %+v", result)
+	}
+	tool.pins = nil
+	result = tool.Execute(context.Background(), map[string]any{"action": "gpio_read", "pin": float64(17)})
+	if !result.IsError || !strings.Contains(result.ForLLM, "tools.device.gpio_pins") {
+		t.Errorf("gpio_read without allowed pins = %+v", result)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package tools
+
+import "golang.org/x/sys/unix"
+
+// diskUsage returns the size of the file system holding path and how much
+// of it is free to use, in bytes.
+func diskUsage(path string) (total, free uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Blocks) * uint64(st.Bsize), uint64(st.Bavail) * uint64(st.Bsize), nil
+}
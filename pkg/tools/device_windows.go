@@ -0,0 +1,14 @@
+package tools
+
+import "golang.org/x/sys/windows"
+
+// diskUsage returns the size of the volume holding path and how much of
+// it is free to use, in bytes.
+func diskUsage(path string) (total, free uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = windows.GetDiskFreeSpaceEx(p, &free, &total, nil)
+	return total, free, err
+}
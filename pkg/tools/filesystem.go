@@ -21,6 +21,7 @@ func validatePath(path, workspace string, restrict bool) (string, error) {
 		return "", fmt.Errorf("failed to resolve workspace path: %w", err)
 	}
 
+	path = onVolumeOf(path, absWorkspace)
 	var absPath string
 	if filepath.IsAbs(path) {
 		absPath = filepath.Clean(path)
@@ -76,6 +77,15 @@ func resolveExistingAncestor(path string) (string, error) {
 	}
 }
 
+// onVolumeOf puts path on the drive of base when it is rooted without
+// naming one, as `\Users` is on Windows; elsewhere it returns path.
+func onVolumeOf(path, base string) string {
+	if path != "" && os.IsPathSeparator(path[0]) && !filepath.IsAbs(path) && filepath.VolumeName(path) == "" {
+		return filepath.VolumeName(base) + path
+	}
+	return path
+}
+
 func isWithinWorkspace(candidate, workspace string) bool {
 	rel, err := filepath.Rel(filepath.Clean(workspace), filepath.Clean(candidate))
 	return err == nil && filepath.IsLocal(rel)
@@ -388,7 +398,7 @@ func getSafeRelPath(workspace, path string) (string, error) {
 		return "", fmt.Errorf("workspace is not defined")
 	}
 
-	rel := filepath.Clean(path)
+	rel := filepath.Clean(onVolumeOf(path, workspace))
 	if filepath.IsAbs(rel) {
 		var err error
 		rel, err = filepath.Rel(workspace, rel)
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// FollowUpTool lets the agent come back to a conversation later by itself,
+// e.g. "I'll check the order status tomorrow and report back". When due,
+// the agent runs again in the same session, with what it noted, and its
+// answer goes to the chat.
+type FollowUpTool struct {
+	cronService *cron.CronService
+}
+
+func NewFollowUpTool(cronService *cron.CronService) *FollowUpTool {
+	return &FollowUpTool{cronService: cronService}
+}
+
+func (t *FollowUpTool) Name() string {
+	return "follow_up"
+}
+
+func (t *FollowUpTool) Description() string {
+	return "Come back to this conversation later by yourself, e.g. to check an order status tomorrow and report back. " +
+		"When due you run again in this conversation with 'task' and 'context', and your answer is sent to this chat. " +
+		"Use 'when' in words ('tomorrow at 9', 'in 2 hours') with 'timezone' when the user gives one, or 'in_seconds'. " +
+		"Only promise the user a follow-up after scheduling it."
+}
+
+func (t *FollowUpTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task": map[string]any{
+				"type":        "string",
+				"description": "What to do then, e.g. 'Check the status of order 4711 and tell the user'",
+			},
+			"context": map[string]any{
+				"type":        "string",
+				"description": "What you will need to know then: the user's request, IDs, links and what was known so far",
+			},
+			"when": map[string]any{
+				"type":        "string",
+				"description": "When to follow up, in words, e.g. 'tomorrow at 9', 'in 3 hours', 'on friday at noon'",
+			},
+			"in_seconds": map[string]any{
+				"type":        "integer",
+				"description": "Follow up this many seconds from now, instead of 'when'",
+			},
+			"timezone": map[string]any{
+				"type":        "string",
+				"description": "IANA time zone 'when' is meant in, e.g. Europe/Berlin",
+			},
+		},
+		"required": []string{"task", "context"},
+	}
+}
+
+func (t *FollowUpTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	task, _ := args["task"].(string)
+	if strings.TrimSpace(task) == "" {
+		return ErrorResult("task is required")
+	}
+	note, _ := args["context"].(string)
+	channel, chatID := ToolContextFrom(ctx)
+	session := SessionKeyFrom(ctx)
+	if channel == "" || chatID == "" || session == "" {
+		return ErrorResult("follow-ups can only be scheduled in a conversation")
+	}
+
+	at, err := oneTimeAt(args)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if !at.After(time.Now()) {
+		return ErrorResult(fmt.Sprintf("%s has passed", at.Format(time.RFC3339)))
+	}
+	atMS := at.UnixMilli()
+
+	job, err := t.cronService.AddJob("follow-up: "+utils.Truncate(task, 30), cron.CronSchedule{Kind: "at", AtMS: &atMS},
+		task, false, channel, chatID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("Error scheduling the follow-up: %v", err))
+	}
+	job.Payload.Session = session
+	job.Payload.Context = note
+	if err := t.cronService.UpdateJob(job); err != nil {
+		t.cronService.RemoveJob(job.ID)
+		return ErrorResult(fmt.Sprintf("Error scheduling the follow-up: %v", err))
+	}
+	return SilentResult(fmt.Sprintf("Follow-up %s scheduled for %s. /schedule lists it, /schedule remove %s cancels it.",
+		job.ID, at.Format("Mon 2006-01-02 15:04 MST"), job.ID))
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// recordingExecutor answers every run and remembers what it was asked.
+type recordingExecutor struct {
+	content, sessionKey, channel, chatID string
+}
+
+func (e *recordingExecutor) ProcessDirectWithChannel(
+	ctx context.Context,
+	content, sessionKey, channel, chatID string,
+) (string, error) {
+	e.content, e.sessionKey, e.channel, e.chatID = content, sessionKey, channel, chatID
+	return "Order 4711 has shipped.", nil
+}
+
+func TestFollowUpTool(t *testing.T) {
+	workspace := t.TempDir()
+	cs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	tool := NewFollowUpTool(cs)
+	args := map[string]any{
+		"task":       "Check the status of order 4711",
+		"context":    "The user ordered a bike on Monday, order 4711, it was 'processing'",
+		"in_seconds": float64(86400),
+	}
+
+	if r := tool.Execute(context.Background(), args); !r.IsError {
+		t.Fatalf("scheduled a follow-up outside a conversation: %+v", r)
+	}
+	ctx := WithSessionKey(WithToolContext(context.Background(), "telegram", "42", nil), "agent:main:telegram:direct:42")
+	r := tool.Execute(ctx, args)
+	if r.IsError || !strings.Contains(r.ForLLM, "/schedule remove") {
+		t.Fatalf("result = %+v", r)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	job := jobs[0]
+	if job.Payload.Session != "agent:main:telegram:direct:42" || job.Payload.To != "42" || !job.DeleteAfterRun ||
+		time.Until(time.UnixMilli(*job.Schedule.AtMS)) < 23*time.Hour {
+		t.Errorf("job = %+v", job)
+	}
+
+	exec := &recordingExecutor{}
+	msgBus := bus.NewMessageBus()
+	cronTool := NewCronTool(cs, exec, msgBus, workspace, true, 0, config.DefaultConfig())
+	got, err := cronTool.ExecuteJob(context.Background(), &job)
+	if err != nil || got != "Order 4711 has shipped." {
+		t.Fatalf("ExecuteJob = %q, %v", got, err)
+	}
+	if exec.sessionKey != "agent:main:telegram:direct:42" || exec.chatID != "42" ||
+		!strings.HasPrefix(exec.content, "[Follow-up you scheduled on ") ||
+		!strings.Contains(exec.content, "Check the status of order 4711\nWhat you noted then: The user ordered a bike") {
+		t.Errorf("run = %+v", exec)
+	}
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || out.ChatID != "42" || out.Content != "Order 4711 has shipped." {
+		t.Errorf("sent %+v", out)
+	}
+
+	args["when"], args["in_seconds"] = "every day at 9", nil
+	if r := tool.Execute(ctx, args); !r.IsError || !strings.Contains(r.ForLLM, "repeats") {
+		t.Errorf("repeating follow-up: %+v", r)
+	}
+}
@@ -3,15 +3,28 @@ package tools
 import (
 	"context"
 	"fmt"
+	"os"
+	"sync"
 )
 
-type SendCallback func(channel, chatID, content string) error
+// SendCallback delivers a message. ctx is the tool call's, so a message
+// sent by a scheduled run can be told from a reply.
+type SendCallback func(ctx context.Context, channel, chatID, content string) error
+
+// SendFilesCallback delivers a message with file attachments. files are
+// absolute paths that passed the workspace check.
+type SendFilesCallback func(ctx context.Context, channel, chatID, content string, files []string) error
 
 type MessageTool struct {
-	sendCallback   SendCallback
+	sendCallback      SendCallback
+	sendFilesCallback SendFilesCallback
+	workspace         string
+	restrict          bool
+
+	mu             sync.Mutex
 	defaultChannel string
 	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	sentInRound    map[string]bool // "channel:chatID" → sent a message during the current round
 }
 
 func NewMessageTool() *MessageTool {
@@ -42,51 +55,84 @@ func (t *MessageTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"files": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Optional: paths of files to attach (relative to the workspace)",
+			},
 		},
 		"required": []string{"content"},
 	}
 }
 
 func (t *MessageTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
+	delete(t.sentInRound, channel+":"+chatID) // Reset send tracking for new processing round
 }
 
-// HasSentInRound returns true if the message tool sent a message during the current round.
-func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
+// HasSentInRound returns true if the message tool sent a message during the
+// current round of the conversation in channel/chatID.
+func (t *MessageTool) HasSentInRound(channel, chatID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sentInRound[channel+":"+chatID]
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetSendFilesCallback enables the files parameter. Paths are resolved
+// against workspace and, if restrict is set, must stay inside it.
+func (t *MessageTool) SetSendFilesCallback(callback SendFilesCallback, workspace string, restrict bool) {
+	t.sendFilesCallback = callback
+	t.workspace = workspace
+	t.restrict = restrict
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
 	content, ok := args["content"].(string)
 	if !ok {
 		return &ToolResult{ForLLM: "content is required", IsError: true}
 	}
 
+	originChannel, originChatID := ToolContextFrom(ctx)
+	if originChannel == "" {
+		t.mu.Lock()
+		originChannel, originChatID = t.defaultChannel, t.defaultChatID
+		t.mu.Unlock()
+	}
+
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = originChannel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = originChatID
 	}
 
 	if channel == "" || chatID == "" {
 		return &ToolResult{ForLLM: "No target channel/chat specified", IsError: true}
 	}
 
-	if t.sendCallback == nil {
-		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
+	files, err := t.resolveFiles(args["files"])
+	if err != nil {
+		return ErrorResult(err.Error())
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	if len(files) > 0 {
+		err = t.sendFilesCallback(ctx, channel, chatID, content, files)
+	} else if t.sendCallback == nil {
+		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
+	} else {
+		err = t.sendCallback(ctx, channel, chatID, content)
+	}
+	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -94,10 +140,46 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		}
 	}
 
-	t.sentInRound = true
+	t.mu.Lock()
+	if t.sentInRound == nil {
+		t.sentInRound = make(map[string]bool)
+	}
+	t.sentInRound[originChannel+":"+originChatID] = true
+	t.mu.Unlock()
 	// Silent: user already received the message directly
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
 		Silent: true,
 	}
 }
+
+func (t *MessageTool) resolveFiles(raw any) ([]string, error) {
+	list, _ := raw.([]any)
+	if len(list) == 0 {
+		return nil, nil
+	}
+	if t.sendFilesCallback == nil {
+		return nil, fmt.Errorf("sending files is not supported here")
+	}
+
+	files := make([]string, 0, len(list))
+	for _, item := range list {
+		path, ok := item.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("files must be a list of paths")
+		}
+		resolved, err := validatePath(path, t.workspace, t.restrict)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", path, err)
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", path, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("file %s is a directory", path)
+		}
+		files = append(files, resolved)
+	}
+	return files, nil
+}
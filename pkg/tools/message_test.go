@@ -3,6 +3,9 @@ package tools
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -11,7 +14,7 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	var sentChannel, sentChatID, sentContent string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error {
 		sentChannel = channel
 		sentChatID = chatID
 		sentContent = content
@@ -63,7 +66,7 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool.SetContext("default-channel", "default-chat-id")
 
 	var sentChannel, sentChatID string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error {
 		sentChannel = channel
 		sentChatID = chatID
 		return nil
@@ -99,7 +102,7 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool.SetContext("test-channel", "test-chat-id")
 
 	sendErr := errors.New("network error")
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error {
 		return sendErr
 	})
 
@@ -153,7 +156,7 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 	tool := NewMessageTool()
 	// No SetContext called, so defaultChannel and defaultChatID are empty
 
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error {
 		return nil
 	})
 
@@ -257,3 +260,101 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_Files(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "report.txt"), []byte("done"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42")
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error {
+		t.Error("text callback used for a message with files")
+		return nil
+	})
+	var sentFiles []string
+	tool.SetSendFilesCallback(func(_ context.Context, channel, chatID, content string, files []string) error {
+		sentFiles = files
+		return nil
+	}, workspace, true)
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"content": "Here is the report",
+		"files":   []any{"report.txt"},
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if len(sentFiles) != 1 || sentFiles[0] != filepath.Join(workspace, "report.txt") {
+		t.Errorf("files = %v", sentFiles)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{
+		"content": "secrets",
+		"files":   []any{"/etc/passwd"},
+	})
+	if !result.IsError {
+		t.Error("expected error for a file outside the workspace")
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{
+		"content": "missing",
+		"files":   []any{"nope.txt"},
+	})
+	if !result.IsError {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestMessageTool_Execute_FilesNotSupported(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42")
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error { return nil })
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"content": "Here is the report",
+		"files":   []any{"report.txt"},
+	})
+	if !result.IsError {
+		t.Error("expected error when file sending is not configured")
+	}
+}
+
+func TestMessageTool_ConcurrentConversations(t *testing.T) {
+	tool := NewMessageTool()
+	var mu sync.Mutex
+	sent := map[string]string{}
+	tool.SetSendCallback(func(_ context.Context, channel, chatID, content string) error {
+		mu.Lock()
+		sent[channel+":"+chatID] = content
+		mu.Unlock()
+		return nil
+	})
+
+	r := NewToolRegistry()
+	r.Register(tool)
+
+	var wg sync.WaitGroup
+	for _, chatID := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.ExecuteWithContext(context.Background(), "message", map[string]any{"content": "to " + chatID},
+				"telegram", chatID, nil)
+		}()
+	}
+	wg.Wait()
+
+	for _, chatID := range []string{"a", "b", "c", "d"} {
+		if sent["telegram:"+chatID] != "to "+chatID {
+			t.Errorf("chat %s got %q", chatID, sent["telegram:"+chatID])
+		}
+		if !tool.HasSentInRound("telegram", chatID) {
+			t.Errorf("HasSentInRound(telegram, %s) = false", chatID)
+		}
+	}
+	if tool.HasSentInRound("telegram", "other") {
+		t.Error("HasSentInRound should be tracked per chat")
+	}
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// UpdateProfileTool records what the user tells the agent about themselves
+// ("remember that I live in Berlin", "always answer in bullet points") in
+// their profile, which later turns see in the system prompt.
+type UpdateProfileTool struct {
+	profiles *state.ProfileStore
+}
+
+func NewUpdateProfileTool(profiles *state.ProfileStore) *UpdateProfileTool {
+	return &UpdateProfileTool{profiles: profiles}
+}
+
+func (t *UpdateProfileTool) Name() string {
+	return "update_profile"
+}
+
+func (t *UpdateProfileTool) Description() string {
+	return "Remember something about the user you are talking to, when they tell you their name, " +
+		"where they live, their language, a preference, or ask you to always or never do something " +
+		"(\"remember that I...\"). Only set what changes; the profile is shown to you in later conversations."
+}
+
+func (t *UpdateProfileTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{
+				"type":        "string",
+				"description": "How the user wants to be addressed",
+			},
+			"timezone": map[string]any{
+				"type":        "string",
+				"description": "IANA time zone, e.g. \"Europe/Berlin\"",
+			},
+			"locale": map[string]any{
+				"type":        "string",
+				"description": "Language and region, e.g. \"de-DE\"",
+			},
+			"preferences": map[string]any{
+				"type":                 "object",
+				"description":          "Preferences by topic, e.g. {\"units\": \"metric\"}; an empty value removes one",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+			"add_instruction": map[string]any{
+				"type":        "string",
+				"description": "A standing instruction to follow from now on",
+			},
+			"remove_instruction": map[string]any{
+				"type":        "string",
+				"description": "A standing instruction to drop, by its text or number",
+			},
+		},
+	}
+}
+
+func (t *UpdateProfileTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	sender := SenderFrom(ctx)
+	if sender == "" {
+		return ErrorResult("there is no user in this conversation to remember this about")
+	}
+	if tz, _ := args["timezone"].(string); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return ErrorResult(fmt.Sprintf("unknown time zone %q; use an IANA name like Europe/Berlin", tz))
+		}
+	}
+
+	var changes []string
+	var missing string
+	_, err := t.profiles.Update(sender, func(p *state.Profile) {
+		for _, field := range []struct {
+			key string
+			to  *string
+		}{{"name", &p.Name}, {"timezone", &p.Timezone}, {"locale", &p.Locale}} {
+			if v, ok := args[field.key].(string); ok && strings.TrimSpace(v) != "" {
+				*field.to = strings.TrimSpace(v)
+				changes = append(changes, field.key)
+			}
+		}
+		if prefs, ok := args["preferences"].(map[string]any); ok {
+			for key, v := range prefs {
+				value, _ := v.(string)
+				p.SetPreference(key, value)
+				changes = append(changes, "preference "+key)
+			}
+		}
+		if instr, _ := args["add_instruction"].(string); strings.TrimSpace(instr) != "" {
+			p.Instructions = append(p.Instructions, strings.TrimSpace(instr))
+			changes = append(changes, "instruction")
+		}
+		if instr, _ := args["remove_instruction"].(string); instr != "" {
+			if p.RemoveInstruction(instr) {
+				changes = append(changes, "removed instruction")
+			} else {
+				missing = instr
+			}
+		}
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save the profile: %v", err)).WithError(err)
+	}
+	if missing != "" {
+		return ErrorResult(fmt.Sprintf("no standing instruction matches %q; other changes were saved", missing))
+	}
+	if len(changes) == 0 {
+		return ErrorResult("nothing to remember; set at least one field")
+	}
+	return SilentResult("Profile updated: " + strings.Join(changes, ", "))
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,7 +13,11 @@ import (
 
 type ToolRegistry struct {
 	tools map[string]Tool
-	mu    sync.RWMutex
+	// defs are the provider definitions of tools, built on the first
+	// request after a tool was registered or unregistered, so a request
+	// does not describe every tool anew.
+	defs []providers.ToolDefinition
+	mu   sync.RWMutex
 }
 
 func NewToolRegistry() *ToolRegistry {
@@ -25,6 +30,15 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.tools[tool.Name()] = tool
+	r.defs = nil
+}
+
+// Unregister removes the tool called name, if there is one.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+	r.defs = nil
 }
 
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
@@ -77,6 +91,10 @@ func (r *ToolRegistry) ExecuteWithContext(
 			})
 	}
 
+	if (channel != "" && chatID != "") || asyncCallback != nil {
+		ctx = WithToolContext(ctx, channel, chatID, asyncCallback)
+	}
+
 	start := time.Now()
 	result := tool.Execute(ctx, args)
 	duration := time.Since(start)
@@ -107,12 +125,28 @@ func (r *ToolRegistry) ExecuteWithContext(
 	return result
 }
 
+// sorted returns the tools in name order, so that the tools part of a
+// prompt is the same from one request to the next and can be cached.
+// Callers hold r.mu.
+func (r *ToolRegistry) sorted() []Tool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	tools := make([]Tool, len(names))
+	for i, name := range names {
+		tools[i] = r.tools[name]
+	}
+	return tools
+}
+
 func (r *ToolRegistry) GetDefinitions() []map[string]any {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	definitions := make([]map[string]any, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		definitions = append(definitions, ToolToSchema(tool))
 	}
 	return definitions
@@ -120,12 +154,27 @@ func (r *ToolRegistry) GetDefinitions() []map[string]any {
 
 // ToProviderDefs converts tool definitions to provider-compatible format.
 // This is the format expected by LLM provider APIs.
+// The definitions share their parameters with later calls, so callers may
+// drop definitions from the slice but must not change them.
 func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
+	defs := r.defs
+	r.mu.RUnlock()
+	if defs == nil {
+		r.mu.Lock()
+		if r.defs == nil {
+			r.defs = r.providerDefs()
+		}
+		defs = r.defs
+		r.mu.Unlock()
+	}
+	return slices.Clone(defs)
+}
 
+// providerDefs builds the definitions of ToProviderDefs. Callers hold r.mu.
+func (r *ToolRegistry) providerDefs() []providers.ToolDefinition {
 	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		schema := ToolToSchema(tool)
 
 		// Safely extract nested values with type checks
@@ -176,7 +225,7 @@ func (r *ToolRegistry) GetSummaries() []string {
 	defer r.mu.RUnlock()
 
 	summaries := make([]string, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sorted() {
 		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", tool.Name(), tool.Description()))
 	}
 	return summaries
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -250,6 +251,25 @@ func TestToolRegistry_ToProviderDefs(t *testing.T) {
 	}
 }
 
+func TestToolRegistry_ToProviderDefsCached(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(newMockTool("alpha", "tool A"))
+	r.Register(newMockTool("beta", "tool B"))
+
+	// Callers drop definitions from their copy in place.
+	_ = slices.DeleteFunc(r.ToProviderDefs(), func(d providers.ToolDefinition) bool { return d.Function.Name == "alpha" })
+	if defs := r.ToProviderDefs(); len(defs) != 2 {
+		t.Fatalf("got %d definitions after a caller dropped one, want 2", len(defs))
+	}
+
+	r.Register(newMockTool("gamma", "tool C"))
+	r.Unregister("alpha")
+	defs := r.ToProviderDefs()
+	if len(defs) != 2 || defs[0].Function.Name != "beta" || defs[1].Function.Name != "gamma" {
+		t.Errorf("definitions after registering = %+v", defs)
+	}
+}
+
 func TestToolRegistry_List(t *testing.T) {
 	r := NewToolRegistry()
 	r.Register(newMockTool("x", ""))
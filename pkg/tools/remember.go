@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// RememberTool records a fact in long-term memory together with where it
+// was learned: the chat, who said it and their words. The agent sees the
+// facts with that provenance in later conversations and can answer "why do
+// you think that?".
+type RememberTool struct {
+	facts *state.FactStore
+}
+
+func NewRememberTool(facts *state.FactStore) *RememberTool {
+	return &RememberTool{facts: facts}
+}
+
+func (t *RememberTool) Name() string {
+	return "remember"
+}
+
+func (t *RememberTool) Description() string {
+	return "Remember a durable fact for future conversations, e.g. a decision, a date or something about " +
+		"a person or project. Record it as one self-contained sentence, with the words it was learned from " +
+		"as source. To correct a fact, pass the ID of the one it replaces."
+}
+
+func (t *RememberTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"fact": map[string]any{
+				"type":        "string",
+				"description": "The fact, as one self-contained sentence",
+			},
+			"source": map[string]any{
+				"type":        "string",
+				"description": "A short quote of what the fact was learned from",
+			},
+			"replaces": map[string]any{
+				"type":        "integer",
+				"description": "ID of a remembered fact this one corrects; it is forgotten",
+			},
+		},
+		"required": []string{"fact"},
+	}
+}
+
+func (t *RememberTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	text, _ := args["fact"].(string)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ErrorResult("fact is required")
+	}
+	source, _ := args["source"].(string)
+	channel, chatID := ToolContextFrom(ctx)
+
+	var replaced int
+	if id, ok := args["replaces"].(float64); ok && id > 0 {
+		replaced = int(id)
+		if _, found := t.facts.Get(replaced); !found {
+			return ErrorResult(fmt.Sprintf("there is no remembered fact #%d", replaced))
+		}
+	}
+
+	f, err := t.facts.Add(state.Fact{
+		Text:    text,
+		Channel: channel,
+		ChatID:  chatID,
+		Sender:  SenderFrom(ctx),
+		Source:  strings.TrimSpace(source),
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to remember: %v", err)).WithError(err)
+	}
+	if replaced > 0 {
+		if _, err := t.facts.Forget(replaced); err != nil {
+			return ErrorResult(fmt.Sprintf("remembered #%d but failed to forget #%d: %v", f.ID, replaced, err)).
+				WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Remembered #%d, replacing #%d", f.ID, replaced))
+	}
+	return SilentResult(fmt.Sprintf("Remembered #%d", f.ID))
+}
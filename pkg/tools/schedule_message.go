@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ScheduleCallback keeps a message to send to channel and chatID at the
+// given time and returns its ID. by is the chat it was scheduled from.
+type ScheduleCallback func(channel, chatID, content string, at time.Time, by string) (string, error)
+
+// ScheduleMessageTool sends a message at a later time, e.g. "send this
+// to the family group at 18:00". Unlike a cron reminder the text is fixed
+// when it is scheduled, and no agent runs when it is sent.
+type ScheduleMessageTool struct {
+	schedule ScheduleCallback
+}
+
+func NewScheduleMessageTool(schedule ScheduleCallback) *ScheduleMessageTool {
+	return &ScheduleMessageTool{schedule: schedule}
+}
+
+func (t *ScheduleMessageTool) Name() string {
+	return "schedule_message"
+}
+
+func (t *ScheduleMessageTool) Description() string {
+	return "Send a message at a later time, exactly as written, to this chat or another one (e.g. 'send this to the family group at 18:00'). " +
+		"Use 'when' in words ('at 18:00', 'tomorrow at 9', 'in 2 hours') with 'timezone' when the user gives one, or 'in_seconds'. " +
+		"For reminders the agent should write or act on when due, use the cron tool instead. " +
+		"Tell the user the ID: /schedule lists the message and /schedule remove <id> cancels it."
+}
+
+func (t *ScheduleMessageTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"content": map[string]any{
+				"type":        "string",
+				"description": "The message to send, as it will be sent",
+			},
+			"when": map[string]any{
+				"type":        "string",
+				"description": "When to send it, in words, e.g. 'at 18:00', 'tomorrow at noon', 'on 2026-12-24 at 18:00'",
+			},
+			"in_seconds": map[string]any{
+				"type":        "integer",
+				"description": "Send it this many seconds from now, instead of 'when'",
+			},
+			"timezone": map[string]any{
+				"type":        "string",
+				"description": "IANA time zone 'when' is meant in, e.g. Europe/Berlin",
+			},
+			"channel": map[string]any{
+				"type":        "string",
+				"description": "Optional: target channel, this chat's by default",
+			},
+			"chat_id": map[string]any{
+				"type":        "string",
+				"description": "Optional: target chat ID, this chat by default",
+			},
+		},
+		"required": []string{"content"},
+	}
+}
+
+func (t *ScheduleMessageTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	content, _ := args["content"].(string)
+	if content == "" {
+		return ErrorResult("content is required")
+	}
+	originChannel, originChatID := ToolContextFrom(ctx)
+	channel, _ := args["channel"].(string)
+	chatID, _ := args["chat_id"].(string)
+	if channel == "" {
+		channel = originChannel
+	}
+	if chatID == "" {
+		chatID = originChatID
+	}
+	if channel == "" || chatID == "" {
+		return ErrorResult("No target channel/chat specified")
+	}
+
+	at, err := oneTimeAt(args)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	id, err := t.schedule(channel, chatID, content, at, originChannel+":"+originChatID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("Failed to schedule the message: %v", err))
+	}
+	return SilentResult(fmt.Sprintf("Scheduled message %s to %s:%s for %s: %q. /schedule remove %s cancels it.",
+		id, channel, chatID, at.Format("Mon 2006-01-02 15:04 MST"), utils.Truncate(content, 60), id))
+}
+
+// oneTimeAt reads the time a one-time action is due from args: "when" in
+// words, read in "timezone" if given, or "in_seconds" from now.
+func oneTimeAt(args map[string]any) (time.Time, error) {
+	if secs, ok := args["in_seconds"].(float64); ok && secs > 0 {
+		return time.Now().Add(time.Duration(secs) * time.Second), nil
+	}
+	when, _ := args["when"].(string)
+	if when == "" {
+		return time.Time{}, errors.New("when or in_seconds is required")
+	}
+	loc := time.Local
+	if tz, _ := args["timezone"].(string); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return time.Time{}, fmt.Errorf("unknown timezone %q", tz)
+		}
+	}
+	schedule, err := cron.ParseSchedule(when, loc, time.Now())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if schedule.Kind != "at" || schedule.AtMS == nil {
+		return time.Time{}, fmt.Errorf("%q repeats; this happens once, use the cron tool for repeating ones", when)
+	}
+	return time.UnixMilli(*schedule.AtMS).In(loc), nil
+}
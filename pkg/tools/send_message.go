@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// SendMessageTool delivers a message to another channel or chat than the
+// one the agent is answering on, e.g. "forward this to my work Slack".
+// Unlike the message tool, it only reaches destinations the configuration
+// allows: named destinations, plus "channel:chat_id" targets matching the
+// allowlist.
+type SendMessageTool struct {
+	send         SendCallback
+	destinations map[string]string // name → "channel:chat_id"
+	allowed      []string
+	// channelExists reports whether a channel is running; nil skips the check.
+	channelExists func(channel string) bool
+
+	mu            sync.Mutex
+	originChannel string
+	originChatID  string
+}
+
+// NewSendMessageTool creates the tool. allowed entries are "channel:chat_id",
+// "channel:*" or "*".
+func NewSendMessageTool(send SendCallback, destinations map[string]string, allowed []string) *SendMessageTool {
+	return &SendMessageTool{
+		send:         send,
+		destinations: destinations,
+		allowed:      allowed,
+	}
+}
+
+func (t *SendMessageTool) Name() string {
+	return "send_message"
+}
+
+func (t *SendMessageTool) Description() string {
+	desc := "Send a message to a different chat or channel than the current conversation, " +
+		"for example to forward something to the user's work Slack. " +
+		"To reply in the current chat, just answer normally."
+	if len(t.destinations) > 0 {
+		names := make([]string, 0, len(t.destinations))
+		for name := range t.destinations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		desc += " Named destinations: " + strings.Join(names, ", ") + "."
+	}
+	return desc
+}
+
+func (t *SendMessageTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"destination": map[string]any{
+				"type":        "string",
+				"description": "A named destination, or \"channel:chat_id\" (e.g. \"slack:C0123456\")",
+			},
+			"content": map[string]any{
+				"type":        "string",
+				"description": "The message to send",
+			},
+		},
+		"required": []string{"destination", "content"},
+	}
+}
+
+func (t *SendMessageTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.originChannel = channel
+	t.originChatID = chatID
+}
+
+// SetChannelLookup lets the tool reject channels that are not running.
+func (t *SendMessageTool) SetChannelLookup(exists func(channel string) bool) {
+	t.channelExists = exists
+}
+
+func (t *SendMessageTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	destination, _ := args["destination"].(string)
+	content, _ := args["content"].(string)
+	destination = strings.TrimSpace(destination)
+	if destination == "" {
+		return ErrorResult("destination is required")
+	}
+	if strings.TrimSpace(content) == "" {
+		return ErrorResult("content is required")
+	}
+
+	target := destination
+	named := false
+	if resolved, ok := t.destinations[destination]; ok {
+		target = resolved
+		named = true
+	}
+
+	channel, chatID, ok := strings.Cut(target, ":")
+	if !ok || channel == "" || chatID == "" {
+		return ErrorResult(fmt.Sprintf("unknown destination %q; use a named destination or channel:chat_id", destination))
+	}
+	if !named && !t.isAllowed(channel, chatID) {
+		return ErrorResult(fmt.Sprintf("destination %s is not in the send_message allowlist", target))
+	}
+	if t.channelExists != nil && !t.channelExists(channel) {
+		return ErrorResult(fmt.Sprintf("channel %s is not enabled", channel))
+	}
+
+	if err := t.send(ctx, channel, chatID, content); err != nil {
+		return &ToolResult{
+			ForLLM:  fmt.Sprintf("sending message: %v", err),
+			IsError: true,
+			Err:     err,
+		}
+	}
+
+	originChannel, originChatID := ToolContextFrom(ctx)
+	if originChannel == "" {
+		t.mu.Lock()
+		originChannel, originChatID = t.originChannel, t.originChatID
+		t.mu.Unlock()
+	}
+	logger.InfoCF("tool", "Cross-channel message sent", map[string]any{
+		"from": originChannel + ":" + originChatID,
+		"to":   target,
+	})
+	return SilentResult(fmt.Sprintf("Message sent to %s", destination))
+}
+
+func (t *SendMessageTool) isAllowed(channel, chatID string) bool {
+	for _, pattern := range t.allowed {
+		switch pattern {
+		case "*", channel + ":*", channel + ":" + chatID:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSendMessageTool_Destinations(t *testing.T) {
+	var sent []string
+	tool := NewSendMessageTool(func(_ context.Context, channel, chatID, content string) error {
+		sent = append(sent, channel+":"+chatID+":"+content)
+		return nil
+	}, map[string]string{"work": "slack:C042"}, []string{"telegram:*", "discord:99"})
+	tool.SetContext("telegram", "1")
+
+	tests := []struct {
+		destination string
+		wantErr     bool
+		wantSent    string
+	}{
+		{"work", false, "slack:C042:hi"},
+		{"telegram:555", false, "telegram:555:hi"},
+		{"discord:99", false, "discord:99:hi"},
+		{"discord:100", true, ""},
+		{"slack:C999", true, ""},
+		{"home", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			sent = nil
+			result := tool.Execute(context.Background(), map[string]any{
+				"destination": tt.destination,
+				"content":     "hi",
+			})
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, ForLLM = %q", result.IsError, result.ForLLM)
+			}
+			if tt.wantErr {
+				if len(sent) != 0 {
+					t.Errorf("blocked destination was sent: %v", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || sent[0] != tt.wantSent {
+				t.Errorf("sent = %v, want %q", sent, tt.wantSent)
+			}
+			if !result.Silent {
+				t.Error("expected a silent result")
+			}
+		})
+	}
+}
+
+func TestSendMessageTool_ChannelLookup(t *testing.T) {
+	called := false
+	tool := NewSendMessageTool(func(_ context.Context, channel, chatID, content string) error {
+		called = true
+		return nil
+	}, nil, []string{"*"})
+	tool.SetChannelLookup(func(channel string) bool { return channel == "slack" })
+
+	result := tool.Execute(context.Background(), map[string]any{
+		"destination": "matrix:!room",
+		"content":     "hi",
+	})
+	if !result.IsError || called {
+		t.Fatalf("expected disabled channel to be rejected, got %q", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "not enabled") {
+		t.Errorf("ForLLM = %q", result.ForLLM)
+	}
+}
+
+func TestSendMessageTool_DescriptionListsDestinations(t *testing.T) {
+	tool := NewSendMessageTool(nil, map[string]string{"work": "slack:C1", "family": "telegram:2"}, nil)
+	if !strings.Contains(tool.Description(), "family, work") {
+		t.Errorf("Description = %q", tool.Description())
+	}
+}
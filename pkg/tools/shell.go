@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -22,6 +21,7 @@ type ExecTool struct {
 	denyPatterns        []*regexp.Regexp
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	shell               string // see config.ExecConfig.Shell
 }
 
 var defaultDenyPatterns = []*regexp.Regexp{
@@ -67,6 +67,13 @@ var defaultDenyPatterns = []*regexp.Regexp{
 	regexp.MustCompile(`\bssh\b.*@`),
 	regexp.MustCompile(`\beval\b`),
 	regexp.MustCompile(`\bsource\s+.*\.sh\b`),
+	// Windows
+	regexp.MustCompile(`\bremove-item\b.*-recurse\b`),
+	regexp.MustCompile(`\b(stop|restart)-computer\b`),
+	regexp.MustCompile(`\b(invoke-expression|iex)\b`),
+	regexp.MustCompile(`\breg\s+delete\b`),
+	regexp.MustCompile(`\btaskkill\b.*/f\b`),
+	regexp.MustCompile(`\bstart-process\b.*-verb\s+runas\b`),
 }
 
 func NewExecTool(workingDir string, restrict bool) *ExecTool {
@@ -77,8 +84,10 @@ func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Conf
 	denyPatterns := make([]*regexp.Regexp, 0)
 
 	enableDenyPatterns := true
+	shell := ""
 	if config != nil {
 		execConfig := config.Tools.Exec
+		shell = execConfig.Shell
 		enableDenyPatterns = execConfig.EnableDenyPatterns
 		if enableDenyPatterns {
 			denyPatterns = append(denyPatterns, defaultDenyPatterns...)
@@ -107,6 +116,7 @@ func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Conf
 		denyPatterns:        denyPatterns,
 		allowPatterns:       nil,
 		restrictToWorkspace: restrict,
+		shell:               shell,
 	}
 }
 
@@ -165,6 +175,13 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 		return ErrorResult(guardError)
 	}
 
+	// Waiting for a subprocess slot does not count against the timeout.
+	release, err := AcquireSubprocess(ctx)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("command did not start: %v", err))
+	}
+	defer release()
+
 	// timeout == 0 means no timeout
 	var cmdCtx context.Context
 	var cancel context.CancelFunc
@@ -175,11 +192,9 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
-	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
+	cmd, err := shellCommand(cmdCtx, t.shell, command)
+	if err != nil {
+		return ErrorResult(err.Error())
 	}
 	if cwd != "" {
 		cmd.Dir = cwd
@@ -200,7 +215,6 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 		done <- cmd.Wait()
 	}()
 
-	var err error
 	select {
 	case err = <-done:
 	case <-cmdCtx.Done():
@@ -289,10 +303,7 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 			return ""
 		}
 
-		pathPattern := regexp.MustCompile(`[A-Za-z]:\\[^\\\"']+|/[^\s\"']+`)
-		matches := pathPattern.FindAllString(cmd, -1)
-
-		for _, raw := range matches {
+		for _, raw := range commandPaths(cmd, runtime.GOOS == "windows") {
 			p, err := filepath.Abs(raw)
 			if err != nil {
 				continue
@@ -312,6 +323,28 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 	return ""
 }
 
+// Absolute paths in a command line. On Windows they start with a drive
+// letter or are UNC paths; a slash starts a switch, as in "dir /b".
+var (
+	unixPathPattern    = regexp.MustCompile(`/[^\s"']+`)
+	windowsPathPattern = regexp.MustCompile(`\b[A-Za-z]:[\\/][^\s"']*|\\\\[^\s"'\\]+\\[^\s"']*`)
+)
+
+// commandPaths returns the absolute paths in command.
+func commandPaths(command string, windows bool) []string {
+	if windows {
+		return windowsPathPattern.FindAllString(command, -1)
+	}
+	return unixPathPattern.FindAllString(command, -1)
+}
+
+// powershellArgs are the arguments that make PowerShell run command and
+// write its output as UTF-8.
+func powershellArgs(command string) []string {
+	return []string{"-NoProfile", "-NonInteractive", "-Command",
+		"[Console]::OutputEncoding = [System.Text.Encoding]::UTF8; " + command}
+}
+
 func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
@@ -3,10 +3,27 @@
 package tools
 
 import (
+	"context"
+	"fmt"
 	"os/exec"
 	"syscall"
 )
 
+// shellCommand returns the command that runs command in shell, sh when it
+// is empty.
+func shellCommand(ctx context.Context, shell, command string) (*exec.Cmd, error) {
+	switch shell {
+	case "", "sh", "bash":
+		if shell == "" {
+			shell = "sh"
+		}
+		return exec.CommandContext(ctx, shell, "-c", command), nil
+	case "powershell", "pwsh":
+		return exec.CommandContext(ctx, shell, powershellArgs(command)...), nil
+	}
+	return nil, fmt.Errorf("the %s shell is only available on Windows", shell)
+}
+
 func prepareCommandForTermination(cmd *exec.Cmd) {
 	if cmd == nil {
 		return
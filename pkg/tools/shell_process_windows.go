@@ -3,10 +3,35 @@
 package tools
 
 import (
+	"context"
+	"fmt"
 	"os/exec"
 	"strconv"
+	"syscall"
 )
 
+// shellCommand returns the command that runs command in shell, Windows
+// PowerShell when it is empty. sh and bash are those of Git for Windows or
+// MSYS2, when on the PATH.
+func shellCommand(ctx context.Context, shell, command string) (*exec.Cmd, error) {
+	switch shell {
+	case "", "powershell", "pwsh":
+		if shell == "" {
+			shell = "powershell"
+		}
+		return exec.CommandContext(ctx, shell, powershellArgs(command)...), nil
+	case "cmd":
+		// cmd.exe does not split its command line the way exec quotes
+		// arguments, so it gets the command as written.
+		cmd := exec.CommandContext(ctx, "cmd.exe")
+		cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /d /s /c "` + command + `"`}
+		return cmd, nil
+	case "sh", "bash":
+		return exec.CommandContext(ctx, shell, "-c", command), nil
+	}
+	return nil, fmt.Errorf("unknown shell %q", shell)
+}
+
 func prepareCommandForTermination(cmd *exec.Cmd) {
 	// no-op on Windows
 }
@@ -3,14 +3,17 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
 type SpawnTool struct {
 	manager        *SubagentManager
-	originChannel  string
-	originChatID   string
 	allowlistCheck func(targetAgentID string) bool
-	callback       AsyncCallback // For async completion notification
+
+	mu            sync.Mutex
+	originChannel string
+	originChatID  string
+	callback      AsyncCallback // For async completion notification
 }
 
 func NewSpawnTool(manager *SubagentManager) *SpawnTool {
@@ -23,6 +26,8 @@ func NewSpawnTool(manager *SubagentManager) *SpawnTool {
 
 // SetCallback implements AsyncTool interface for async completion notification
 func (t *SpawnTool) SetCallback(cb AsyncCallback) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.callback = cb
 }
 
@@ -56,6 +61,8 @@ func (t *SpawnTool) Parameters() map[string]any {
 }
 
 func (t *SpawnTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.originChannel = channel
 	t.originChatID = chatID
 }
@@ -84,8 +91,18 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]any) *ToolResul
 		return ErrorResult("Subagent manager not configured")
 	}
 
+	t.mu.Lock()
+	originChannel, originChatID, callback := t.originChannel, t.originChatID, t.callback
+	t.mu.Unlock()
+	if channel, chatID := ToolContextFrom(ctx); channel != "" {
+		originChannel, originChatID = channel, chatID
+	}
+	if cb := asyncCallbackFrom(ctx); cb != nil {
+		callback = cb
+	}
+
 	// Pass callback to manager for async completion notification
-	result, err := t.manager.Spawn(ctx, task, label, agentID, t.originChannel, t.originChatID, t.callback)
+	result, err := t.manager.Spawn(ctx, task, label, agentID, originChannel, originChatID, callback)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to spawn subagent: %v", err))
 	}
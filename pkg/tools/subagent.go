@@ -250,7 +250,9 @@ func (sm *SubagentManager) ListTasks() []*SubagentTask {
 // Unlike SpawnTool which runs tasks asynchronously, SubagentTool waits for completion
 // and returns the result directly in the ToolResult.
 type SubagentTool struct {
-	manager       *SubagentManager
+	manager *SubagentManager
+
+	mu            sync.Mutex
 	originChannel string
 	originChatID  string
 }
@@ -283,12 +285,18 @@ func (t *SubagentTool) Parameters() map[string]any {
 				"type":        "string",
 				"description": "Optional short label for the task (for display)",
 			},
+			"result_schema": map[string]any{
+				"type":        "object",
+				"description": "Optional JSON schema the result must follow; the result is then returned as JSON",
+			},
 		},
 		"required": []string{"task"},
 	}
 }
 
 func (t *SubagentTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.originChannel = channel
 	t.originChatID = chatID
 }
@@ -300,6 +308,7 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 	}
 
 	label, _ := args["label"].(string)
+	resultSchema, _ := args["result_schema"].(map[string]any)
 
 	if t.manager == nil {
 		return ErrorResult("Subagent manager not configured").WithError(fmt.Errorf("manager is nil"))
@@ -339,17 +348,37 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]any) *ToolRe
 		}
 	}
 
+	t.mu.Lock()
+	originChannel, originChatID := t.originChannel, t.originChatID
+	t.mu.Unlock()
+	if channel, chatID := ToolContextFrom(ctx); channel != "" {
+		originChannel, originChatID = channel, chatID
+	}
+
 	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
 		Provider:      sm.provider,
 		Model:         sm.defaultModel,
 		Tools:         tools,
 		MaxIterations: maxIter,
 		LLMOptions:    llmOptions,
-	}, messages, t.originChannel, t.originChatID)
+	}, messages, originChannel, originChatID)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Subagent execution failed: %v", err)).WithError(err)
 	}
 
+	// A typed result is extracted from the subagent's answer in a separate
+	// request, so the task itself runs with tools as usual.
+	if resultSchema != nil {
+		data, err := providers.ChatStructured(ctx, sm.provider, []providers.Message{
+			{Role: "system", Content: "Turn the result of a task into JSON."},
+			{Role: "user", Content: "Task:\n" + task + "\n\nResult:\n" + loopResult.Content},
+		}, sm.defaultModel, llmOptions, providers.ResponseSchema{Name: "result", Schema: resultSchema})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("Subagent result does not follow the schema: %v", err)).WithError(err)
+		}
+		loopResult.Content = string(data)
+	}
+
 	// ForUser: Brief summary for user (truncated if too long)
 	userContent := loopResult.Content
 	maxUserLen := 500
@@ -348,3 +348,42 @@ func TestSubagentTool_ForUserTruncation(t *testing.T) {
 		t.Error("ForLLM should contain reference to original task")
 	}
 }
+
+// jsonResultProvider finishes tasks in prose and answers with JSON once asked
+// to turn a result into JSON.
+type jsonResultProvider struct{ MockLLMProvider }
+
+func (p *jsonResultProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	if strings.HasPrefix(messages[0].Content, "Turn the result of a task into JSON.") {
+		return &providers.LLMResponse{Content: "```json\n{\"files\": 3}\n```"}, nil
+	}
+	return &providers.LLMResponse{Content: "I counted three files."}, nil
+}
+
+// TestSubagentTool_Execute_ResultSchema verifies results are returned as JSON
+// following result_schema
+func TestSubagentTool_Execute_ResultSchema(t *testing.T) {
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"files": map[string]any{"type": "integer"}},
+		"required":   []any{"files"},
+	}
+	tool := NewSubagentTool(NewSubagentManager(&jsonResultProvider{}, "test-model", "/tmp/test", nil))
+	result := tool.Execute(context.Background(), map[string]any{"task": "Count the files", "result_schema": schema})
+	if result.IsError || result.ForUser != `{"files": 3}` {
+		t.Fatalf("result = %+v", result)
+	}
+
+	// The mock provider never answers with JSON
+	tool = NewSubagentTool(NewSubagentManager(&MockLLMProvider{}, "test-model", "/tmp/test", nil))
+	result = tool.Execute(context.Background(), map[string]any{"task": "Count the files", "result_schema": schema})
+	if !result.IsError {
+		t.Errorf("expected an error for a result without JSON, got %+v", result)
+	}
+}
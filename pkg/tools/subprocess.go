@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"sync"
+)
+
+// subprocesses caps the commands tools run at once, see LimitSubprocesses.
+var subprocesses = &slots{changed: make(chan struct{})}
+
+// slots lets up to limit holders in at once, 0 for any number; the others
+// wait.
+type slots struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	waiting int
+	changed chan struct{} // closed and replaced whenever a slot frees up
+}
+
+// LimitSubprocesses lets at most n of the commands tools start, those of
+// exec and of plugin tools, run at once. n <= 0 removes the cap.
+func LimitSubprocesses(n int) {
+	subprocesses.mu.Lock()
+	subprocesses.limit = max(n, 0)
+	subprocesses.mu.Unlock()
+	subprocesses.notify()
+}
+
+// AcquireSubprocess waits for a subprocess slot and returns the function
+// that frees it. It fails if ctx ends first.
+func AcquireSubprocess(ctx context.Context) (func(), error) {
+	s := subprocesses
+	s.mu.Lock()
+	s.waiting++
+	for s.limit > 0 && s.running >= s.limit {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.waiting--
+			s.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	s.waiting--
+	s.running++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.running--
+			s.mu.Unlock()
+			s.notify()
+		})
+	}, nil
+}
+
+// Subprocesses returns the number of tool commands running and of those
+// waiting for a slot.
+func Subprocesses() (running, waiting int) {
+	subprocesses.mu.Lock()
+	defer subprocesses.mu.Unlock()
+	return subprocesses.running, subprocesses.waiting
+}
+
+func (s *slots) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
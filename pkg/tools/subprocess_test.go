@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireSubprocess_WaitsForSlot(t *testing.T) {
+	LimitSubprocesses(1)
+	defer LimitSubprocesses(0)
+
+	release, err := AcquireSubprocess(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := AcquireSubprocess(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second command started while the only slot was taken: %v", err)
+	}
+
+	admitted := make(chan func(), 1)
+	go func() {
+		release, err := AcquireSubprocess(context.Background())
+		if err == nil {
+			admitted <- release
+		}
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for _, waiting := Subprocesses(); waiting != 1; _, waiting = Subprocesses() {
+		if time.Now().After(deadline) {
+			t.Fatal("command did not wait for a slot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	release()
+	release() // freeing twice frees once
+	select {
+	case release := <-admitted:
+		release()
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting command did not start")
+	}
+	if running, waiting := Subprocesses(); running != 0 || waiting != 0 {
+		t.Fatalf("Subprocesses = %d running, %d waiting; want none", running, waiting)
+	}
+}
@@ -0,0 +1,111 @@
+package triggers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FileChange is a file that was created, modified or removed in the
+// folder of a file trigger.
+type FileChange struct {
+	Name string // e.g. "report.pdf"
+	Path string // absolute
+	Op   string // "created", "modified" or "removed"
+	Size int64
+}
+
+// fileStamp is what tells whether a file changed.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// folderWatch looks for changes in a folder by comparing what it holds
+// from one poll to the next. A file is reported once it stayed the same
+// for a poll, so one still being written or copied is not.
+type folderWatch struct {
+	dir     string
+	pattern string
+	seen    map[string]fileStamp // nil before the first poll
+	pending map[string]string    // name -> op, changed at the last poll
+}
+
+func newFolderWatch(dir, pattern string) *folderWatch {
+	return &folderWatch{dir: dir, pattern: pattern, pending: make(map[string]string)}
+}
+
+// poll returns the files that changed and settled since the last poll, as
+// one event, or nil. The first poll only takes stock.
+func (w *folderWatch) poll(context.Context) (*Event, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	now := make(map[string]fileStamp, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if w.pattern != "" {
+			if ok, _ := filepath.Match(w.pattern, e.Name()); !ok {
+				continue
+			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		now[e.Name()] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	}
+	if w.seen == nil {
+		w.seen = now
+		return nil, nil
+	}
+
+	var changes []FileChange
+	for name, stamp := range now {
+		old, existed := w.seen[name]
+		switch {
+		case !existed:
+			w.pending[name] = "created"
+		case old != stamp:
+			if w.pending[name] != "created" {
+				w.pending[name] = "modified"
+			}
+		default:
+			// It changed before and not since: it is done.
+			if op, ok := w.pending[name]; ok {
+				delete(w.pending, name)
+				changes = append(changes, FileChange{Name: name, Path: filepath.Join(w.dir, name), Op: op, Size: stamp.size})
+			}
+		}
+	}
+	for name := range w.seen {
+		if _, ok := now[name]; !ok {
+			if w.pending[name] != "created" {
+				changes = append(changes, FileChange{Name: name, Path: filepath.Join(w.dir, name), Op: "removed"})
+			}
+			delete(w.pending, name)
+		}
+	}
+	w.seen = now
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	slices.SortFunc(changes, func(a, b FileChange) int { return strings.Compare(a.Name, b.Name) })
+	var parts []string
+	for _, c := range changes {
+		parts = append(parts, c.Name+" "+c.Op)
+	}
+	summary := strings.Join(parts, ", ")
+	if len(changes) > 3 {
+		summary = fmt.Sprintf("%d files changed: %s, ...", len(changes), strings.Join(parts[:3], ", "))
+	}
+	return &Event{Summary: summary, Files: changes}, nil
+}
@@ -0,0 +1,71 @@
+package triggers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// subscribe connects to the broker of the mqtt trigger t and fires it for
+// every message on its topic. It returns how to disconnect.
+func (s *Service) subscribe(t *trigger) (func(), error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(t.Broker).
+		SetClientID("picoclaw-trigger-" + t.Name).
+		SetUsername(t.Username).
+		SetPassword(t.Password).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		// Subscribe on every (re)connect, as the broker keeps no session.
+		SetOnConnectHandler(func(client mqtt.Client) {
+			token := client.Subscribe(t.Topic, 1, func(_ mqtt.Client, m mqtt.Message) {
+				// Retained messages are old state, not new events.
+				if !m.Retained() {
+					s.fire(t, mqttEvent(m.Topic(), m.Payload()))
+				}
+			})
+			if !token.WaitTimeout(30*time.Second) || token.Error() != nil {
+				logger.ErrorCF("triggers", "Failed to subscribe", map[string]any{
+					"trigger": t.Name,
+					"topic":   t.Topic,
+					"error":   fmt.Sprint(token.Error()),
+				})
+			}
+		})
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(30 * time.Second) {
+		return nil, fmt.Errorf("mqtt connect to %s timed out", t.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("mqtt connect: %w", err)
+	}
+	return func() { client.Disconnect(250) }, nil
+}
+
+// mqttEvent is the event of a message on topic.
+func mqttEvent(topic string, payload []byte) Event {
+	body := strings.TrimSpace(string(payload))
+	return Event{
+		Summary: fmt.Sprintf("message on %s: %s", topic, utils.Truncate(body, 80)),
+		Topic:   topic,
+		Body:    body,
+		Data:    jsonObject(payload),
+	}
+}
+
+// jsonObject returns data parsed if it is a JSON object, else nil.
+func jsonObject(data []byte) map[string]any {
+	var obj map[string]any
+	if json.Unmarshal(data, &obj) != nil {
+		return nil
+	}
+	return obj
+}
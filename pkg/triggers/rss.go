@@ -0,0 +1,215 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FeedItem is a new item of the feed of an rss trigger.
+type FeedItem struct {
+	ID      string
+	Title   string
+	Link    string
+	Text    string // the description or summary
+	Updated string // as the feed gives it
+}
+
+// feedMaxBytes is the most of a feed that is read.
+const feedMaxBytes = 4 << 20
+
+// feedSeenMax is how many item IDs are remembered per feed. Feeds list
+// their latest items, so older IDs are not needed.
+const feedSeenMax = 500
+
+// feedWatch fetches a feed and reports its new items. The IDs of the
+// items it has seen are kept in <workspace>/state/trigger_<name>.json, so
+// items published while the gateway was down are reported when it starts.
+type feedWatch struct {
+	url    string
+	path   string
+	client *http.Client
+	seen   []string // nil before the first poll
+}
+
+func newFeedWatch(url, workspace, name string) *feedWatch {
+	return &feedWatch{
+		url:    url,
+		path:   filepath.Join(workspace, "state", "trigger_"+name+".json"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// feedState is what a feedWatch keeps between starts.
+type feedState struct {
+	Seen []string `json:"seen"`
+}
+
+// poll fetches the feed and returns its new items as one event, or nil.
+// The first poll of a feed not seen before only takes stock.
+func (w *feedWatch) poll(ctx context.Context) (*Event, error) {
+	items, err := w.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	first := false
+	if w.seen == nil {
+		var st feedState
+		data, err := os.ReadFile(w.path)
+		if err == nil {
+			err = json.Unmarshal(data, &st)
+		}
+		// Without a readable state, every item would look new.
+		first = err != nil
+		w.seen = append([]string{}, st.Seen...)
+	}
+
+	var fresh []FeedItem
+	for _, item := range items {
+		if !slices.Contains(w.seen, item.ID) {
+			fresh = append(fresh, item)
+			w.seen = append(w.seen, item.ID)
+		}
+	}
+	if len(fresh) == 0 && !first {
+		return nil, nil
+	}
+	if len(w.seen) > feedSeenMax {
+		w.seen = w.seen[len(w.seen)-feedSeenMax:]
+	}
+	if err := w.save(); err != nil {
+		return nil, err
+	}
+	if first {
+		return nil, nil
+	}
+
+	// Feeds list the newest first.
+	slices.Reverse(fresh)
+	summary := "new item: " + fresh[0].Title
+	if len(fresh) > 1 {
+		summary = fmt.Sprintf("%d new items, the first: %s", len(fresh), fresh[0].Title)
+	}
+	return &Event{Summary: summary, Items: fresh, Body: fresh[0].Text}, nil
+}
+
+func (w *feedWatch) save() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(feedState{Seen: w.seen})
+	if err != nil {
+		return err
+	}
+	tmp := w.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.path)
+}
+
+// fetch reads the items of the feed, in the order it lists them.
+func (w *feedWatch) fetch(ctx context.Context) ([]FeedItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "picoclaw")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", w.url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, feedMaxBytes))
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(data)
+}
+
+// rssFeed and atomFeed are the parts of RSS 2.0 and Atom feeds that are
+// read.
+type rssFeed struct {
+	Items []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+		Updated string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// parseFeed reads an RSS 2.0 or Atom feed. Items without an ID are known
+// by their link, or else their title.
+func parseFeed(data []byte) ([]FeedItem, error) {
+	var root struct{ XMLName xml.Name }
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("not a feed: %w", err)
+	}
+	var items []FeedItem
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, err
+		}
+		for _, it := range feed.Items {
+			items = append(items, FeedItem{ID: it.GUID, Title: it.Title, Link: it.Link, Text: it.Description, Updated: it.PubDate})
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, err
+		}
+		for _, e := range feed.Entries {
+			item := FeedItem{ID: e.ID, Title: e.Title, Text: e.Summary, Updated: e.Updated}
+			if item.Text == "" {
+				item.Text = e.Content
+			}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = l.Href
+					break
+				}
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: <%s>", root.XMLName.Local)
+	}
+	for i := range items {
+		items[i].Title = strings.TrimSpace(items[i].Title)
+		if items[i].ID == "" {
+			items[i].ID = items[i].Link
+		}
+		if items[i].ID == "" {
+			items[i].ID = items[i].Title
+		}
+	}
+	return items, nil
+}
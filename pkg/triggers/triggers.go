@@ -0,0 +1,235 @@
+// Package triggers starts agent runs when something happens: a file
+// changes in a watched folder, a message arrives on an MQTT topic, a
+// webhook is called, a feed gets a new item or a channel connects or
+// drops. Each trigger renders its prompt with the Event and hands it to a
+// Runner; what fired, what ran and how it ended are recorded as run
+// events, "trigger_fired", "trigger_done", "trigger_failed" and
+// "trigger_skipped".
+package triggers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Event is what fired a trigger; its prompt is rendered with it, e.g.
+// "Summarize {{range .Files}}{{.Path}} {{end}}".
+type Event struct {
+	Trigger string // the trigger's name
+	Kind    string // the trigger's kind
+	Time    string // local time as "2006-01-02 15:04 (Monday)"
+	Summary string // one line on what happened, e.g. "report.pdf created"
+
+	// Body is the MQTT message, the webhook's request body or the text of
+	// the first new feed item, and Data the same parsed when it is a JSON
+	// object.
+	Body string
+	Data map[string]any
+
+	Files []FileChange // file triggers
+	Topic string       // mqtt triggers
+	Items []FeedItem   // rss triggers, oldest first
+	// Channel and Up are set for presence triggers: the channel that
+	// connected (true) or dropped.
+	Channel string
+	Up      bool
+}
+
+// Runner answers the prompt a trigger fired with, as t.Persona, and sends
+// the answer to t.Channel and t.ChatID when set.
+type Runner func(ctx context.Context, t config.TriggerConfig, prompt string) (string, error)
+
+// ErrOff is returned by a Runner that runs no triggers at the moment, such
+// as while proactive runs are off. The event is recorded as skipped.
+var ErrOff = errors.New("proactive runs are off")
+
+// trigger is a configured trigger and its parsed prompt.
+type trigger struct {
+	config.TriggerConfig
+	prompt  *template.Template
+	running sync.Mutex // held while a run of the trigger goes
+}
+
+// Service watches for the events of the configured triggers.
+type Service struct {
+	cfg      *config.Config
+	triggers map[string]*trigger
+	run      Runner
+	events   *state.EventLog
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stops    []func()
+}
+
+// NewService creates the service for the triggers in cfg. One whose
+// prompt does not parse is left out; the config check reports it.
+func NewService(cfg *config.Config, run Runner) *Service {
+	s := &Service{
+		cfg:      cfg,
+		triggers: make(map[string]*trigger, len(cfg.Triggers)),
+		run:      run,
+		events:   state.NewEventLog(cfg.WorkspacePath()),
+	}
+	for _, t := range cfg.Triggers {
+		tmpl, err := template.New(t.Name).Parse(t.Prompt)
+		if err != nil {
+			logger.WarnCF("triggers", "Skipping trigger", map[string]any{"trigger": t.Name, "error": err.Error()})
+			continue
+		}
+		s.triggers[t.Name] = &trigger{TriggerConfig: t, prompt: tmpl}
+	}
+	return s
+}
+
+// Len returns how many triggers there are.
+func (s *Service) Len() int {
+	return len(s.triggers)
+}
+
+// Start watches the folders and feeds and subscribes to the MQTT topics of
+// the triggers until ctx ends or Stop is called. Webhook and presence
+// triggers fire through ServeHTTP and ChannelEvent.
+func (s *Service) Start(ctx context.Context) {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, t := range s.triggers {
+		switch t.Kind {
+		case "file":
+			s.goPoll(t, 30*time.Second, newFolderWatch(s.cfg.TriggerPath(t.TriggerConfig), t.Pattern).poll)
+		case "rss":
+			s.goPoll(t, 15*time.Minute, newFeedWatch(t.URL, s.cfg.WorkspacePath(), t.Name).poll)
+		case "mqtt":
+			stop, err := s.subscribe(t)
+			if err != nil {
+				logger.ErrorCF("triggers", "Failed to subscribe", map[string]any{"trigger": t.Name, "error": err.Error()})
+				continue
+			}
+			s.stops = append(s.stops, stop)
+		}
+	}
+}
+
+// Stop stops watching, cancels the runs that are going and waits for
+// them to end.
+func (s *Service) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for _, stop := range s.stops {
+		stop()
+	}
+	s.wg.Wait()
+}
+
+// goPoll calls poll every interval of t, or every def when it has none,
+// and fires t for the events it returns.
+func (s *Service) goPoll(t *trigger, def time.Duration, poll func(ctx context.Context) (*Event, error)) {
+	interval := def
+	if t.IntervalSeconds > 0 {
+		interval = time.Duration(t.IntervalSeconds) * time.Second
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ev, err := poll(s.ctx)
+			if err != nil {
+				logger.WarnCF("triggers", "Failed to look for changes", map[string]any{"trigger": t.Name, "error": err.Error()})
+			} else if ev != nil {
+				s.fire(t, *ev)
+			}
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ChannelEvent fires the presence triggers watching the channel of ev, if
+// it is a "channel_up" or "channel_down" event.
+func (s *Service) ChannelEvent(ev state.RunEvent) {
+	if ev.Kind != "channel_up" && ev.Kind != "channel_down" {
+		return
+	}
+	up := ev.Kind == "channel_up"
+	summary := ev.Source + " dropped: " + ev.Message
+	if up {
+		summary = fmt.Sprintf("%s reconnected after %s", ev.Source, ev.Duration.Round(time.Second))
+	}
+	for _, t := range s.triggers {
+		if t.Kind == "presence" && (len(t.Channels) == 0 || slices.Contains(t.Channels, ev.Source)) {
+			s.fire(t, Event{Summary: summary, Channel: ev.Source, Up: up, Body: ev.Message})
+		}
+	}
+}
+
+// Fire fires the trigger called name with ev, as if its event happened.
+// It reports false when there is no such trigger or a run of it is still
+// going.
+func (s *Service) Fire(name string, ev Event) bool {
+	t, ok := s.triggers[name]
+	return ok && s.fire(t, ev)
+}
+
+// fire renders the prompt of t with ev and runs it in the background. An
+// event that comes while a run of t is still going is skipped, so a burst
+// of them costs one run.
+func (s *Service) fire(t *trigger, ev Event) bool {
+	ev.Trigger, ev.Kind = t.Name, t.Kind
+	ev.Time = time.Now().Format("2006-01-02 15:04 (Monday)")
+	if !t.running.TryLock() {
+		s.record(state.RunEvent{Kind: "trigger_skipped", Source: t.Name, Message: "still running: " + ev.Summary})
+		return false
+	}
+
+	var b strings.Builder
+	if err := t.prompt.Execute(&b, ev); err != nil {
+		t.running.Unlock()
+		s.record(state.RunEvent{Kind: "trigger_failed", Source: t.Name, Message: "prompt: " + err.Error()})
+		return true
+	}
+	s.record(state.RunEvent{Kind: "trigger_fired", Source: t.Name, Message: ev.Summary})
+	logger.InfoCF("triggers", "Trigger fired", map[string]any{"trigger": t.Name, "event": ev.Summary})
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer t.running.Unlock()
+		start := time.Now()
+		answer, err := s.run(ctx, t.TriggerConfig, strings.TrimSpace(b.String()))
+		switch {
+		case errors.Is(err, ErrOff):
+			s.record(state.RunEvent{Kind: "trigger_skipped", Source: t.Name, Message: err.Error()})
+		case err != nil:
+			s.record(state.RunEvent{Kind: "trigger_failed", Source: t.Name, Message: err.Error(), Duration: time.Since(start)})
+		default:
+			s.record(state.RunEvent{Kind: "trigger_done", Source: t.Name, Message: utils.Truncate(answer, 200), Duration: time.Since(start)})
+		}
+	}()
+	return true
+}
+
+func (s *Service) record(ev state.RunEvent) {
+	if err := s.events.Append(ev); err != nil {
+		logger.WarnCF("triggers", "Failed to record run event", map[string]any{"error": err.Error()})
+	}
+}
@@ -0,0 +1,199 @@
+package triggers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// recorder is a Runner that records the prompts it gets and blocks until
+// release is closed.
+type recorder struct {
+	mu      sync.Mutex
+	prompts []string
+	ran     chan struct{}
+	release chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{ran: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (r *recorder) run(ctx context.Context, t config.TriggerConfig, prompt string) (string, error) {
+	r.mu.Lock()
+	r.prompts = append(r.prompts, t.Name+": "+prompt)
+	r.mu.Unlock()
+	r.ran <- struct{}{}
+	<-r.release
+	return "done", nil
+}
+
+func (r *recorder) wait(t *testing.T) string {
+	t.Helper()
+	select {
+	case <-r.ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the trigger did not run")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.prompts[len(r.prompts)-1]
+}
+
+func newTestService(t *testing.T, run Runner, triggers ...config.TriggerConfig) *Service {
+	cfg := &config.Config{Triggers: triggers}
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	return NewService(cfg, run)
+}
+
+func TestWebhookTrigger(t *testing.T) {
+	r := newRecorder()
+	s := newTestService(t, r.run, config.TriggerConfig{
+		Name: "ci", Kind: "webhook", Secret: "s3cret", Prompt: "The build {{.Data.build}}: {{.Summary}}",
+	})
+	post := func(path, secret, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("/triggers/ci", "wrong", "{}"); code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: got %d", code)
+	}
+	if code := post("/triggers/nope", "s3cret", "{}"); code != http.StatusNotFound {
+		t.Errorf("unknown trigger: got %d", code)
+	}
+	if code := post("/triggers/ci", "s3cret", `{"build":"failed"}`); code != http.StatusAccepted {
+		t.Errorf("first call: got %d", code)
+	}
+	if got := r.wait(t); got != `ci: The build failed: webhook called: {"build":"failed"}` {
+		t.Errorf("prompt = %q", got)
+	}
+	if code := post("/triggers/ci", "s3cret", "{}"); code != http.StatusTooManyRequests {
+		t.Errorf("call during a run: got %d", code)
+	}
+	close(r.release)
+	s.Stop()
+}
+
+func TestPresenceTrigger(t *testing.T) {
+	r := newRecorder()
+	close(r.release)
+	s := newTestService(t, r.run, config.TriggerConfig{
+		Name: "telegram-down", Kind: "presence", Channels: []string{"telegram"},
+		Prompt: "{{if not .Up}}Tell the admin: {{.Summary}}{{end}}",
+	})
+	s.ChannelEvent(state.RunEvent{Kind: "channel_down", Source: "discord", Message: "timeout"})
+	s.ChannelEvent(state.RunEvent{Kind: "channel_down", Source: "telegram", Message: "timeout"})
+	if got := r.wait(t); got != "telegram-down: Tell the admin: telegram dropped: timeout" {
+		t.Errorf("prompt = %q", got)
+	}
+	s.Stop()
+	if len(r.ran) != 0 {
+		t.Error("a channel not watched fired the trigger")
+	}
+}
+
+func TestFolderWatch(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "old.pdf"), []byte("x"), 0o644)
+	w := newFolderWatch(dir, "*.pdf")
+	poll := func() *Event {
+		t.Helper()
+		ev, err := w.poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+
+	if ev := poll(); ev != nil {
+		t.Fatalf("first poll reported %+v", ev)
+	}
+	os.WriteFile(filepath.Join(dir, "report.pdf"), []byte("half"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o644)
+	if ev := poll(); ev != nil {
+		t.Fatalf("a file not yet settled was reported: %+v", ev)
+	}
+	ev := poll()
+	if ev == nil || ev.Summary != "report.pdf created" || len(ev.Files) != 1 || ev.Files[0].Size != 4 {
+		t.Fatalf("settled file: got %+v", ev)
+	}
+	os.Remove(filepath.Join(dir, "old.pdf"))
+	if ev := poll(); ev == nil || ev.Summary != "old.pdf removed" {
+		t.Fatalf("removed file: got %+v", ev)
+	}
+	if ev := poll(); ev != nil {
+		t.Fatalf("nothing changed, got %+v", ev)
+	}
+}
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>News</title>
+<item><guid>2</guid><title>Second</title><link>https://example.com/2</link><description>two</description></item>
+<item><guid>1</guid><title>First</title><link>https://example.com/1</link></item>
+</channel></rss>`
+
+const testAtom = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<entry><id>urn:1</id><title> Release 1.2 </title><link rel="alternate" href="https://example.com/r12"/><summary>notes</summary></entry>
+</feed>`
+
+func TestParseFeed(t *testing.T) {
+	items, err := parseFeed([]byte(testRSS))
+	if err != nil || len(items) != 2 || items[0].ID != "2" || items[0].Text != "two" {
+		t.Errorf("rss: %+v, %v", items, err)
+	}
+	items, err = parseFeed([]byte(testAtom))
+	if err != nil || len(items) != 1 || items[0].Title != "Release 1.2" || items[0].Link != "https://example.com/r12" {
+		t.Errorf("atom: %+v, %v", items, err)
+	}
+	if _, err := parseFeed([]byte("<html></html>")); err == nil {
+		t.Error("html was read as a feed")
+	}
+}
+
+func TestFeedWatch(t *testing.T) {
+	feed := testRSS
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(feed))
+	}))
+	defer srv.Close()
+	workspace := t.TempDir()
+	poll := func(w *feedWatch) *Event {
+		t.Helper()
+		ev, err := w.poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+
+	if ev := poll(newFeedWatch(srv.URL, workspace, "news")); ev != nil {
+		t.Fatalf("first poll reported %+v", ev)
+	}
+	// Items published while the gateway was down are found after a
+	// restart.
+	feed = strings.Replace(testRSS, "<item>", `<item><guid>3</guid><title>Third</title></item><item>`, 1)
+	w := newFeedWatch(srv.URL, workspace, "news")
+	ev := poll(w)
+	if ev == nil || ev.Summary != "new item: Third" || len(ev.Items) != 1 {
+		t.Fatalf("new item: got %+v", ev)
+	}
+	if ev := poll(w); ev != nil {
+		t.Fatalf("nothing new, got %+v", ev)
+	}
+}
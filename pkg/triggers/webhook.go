@@ -0,0 +1,62 @@
+package triggers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// webhookMaxBytes is the most of a request body a webhook trigger reads.
+const webhookMaxBytes = 1 << 20
+
+// ServeHTTP fires the webhook trigger named by the last element of the
+// path, /triggers/<name>, with the request's body:
+//
+//	curl -H "Authorization: Bearer $SECRET" -d '{"build":"failed"}' http://host:18790/triggers/ci
+//
+// It answers 202 when the trigger fired, 401 for a wrong secret and 429
+// while a run of the trigger is still going.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/triggers/")
+	t, ok := s.triggers[name]
+	if !ok || t.Kind != "webhook" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := r.Header.Get("X-Trigger-Secret")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		secret = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(t.Secret)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBytes))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	text := strings.TrimSpace(string(body))
+	ev := Event{Summary: "webhook called", Body: text, Data: jsonObject(body)}
+	if text != "" {
+		ev.Summary += ": " + utils.Truncate(text, 80)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !s.fire(t, ev) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"status": "busy"})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+}
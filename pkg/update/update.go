@@ -0,0 +1,415 @@
+// Package update replaces the picoclaw binary with a newer release. It
+// reads a release feed, downloads the build for this system, verifies it
+// and swaps it for the running binary, keeping the old one to roll back to.
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/plugins"
+)
+
+// maxBinarySize caps the size of a downloaded release, archive or binary.
+const maxBinarySize = 200 << 20
+
+// Feed is the release feed: the latest version and its builds.
+type Feed struct {
+	Version   string    `json:"version"`
+	Notes     string    `json:"notes,omitempty"`
+	Published time.Time `json:"published,omitzero"`
+	Assets    []Asset   `json:"assets"`
+}
+
+// Asset is the build of a release for one system: the binary itself, or
+// a .tar.gz or .zip holding it.
+type Asset struct {
+	OS     string `json:"os"`   // as GOOS, e.g. "linux"
+	Arch   string `json:"arch"` // as GOARCH, e.g. "arm64"
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Signature is the base64 ed25519 signature of SignedPayload by one
+	// of the trusted keys.
+	Signature string `json:"signature,omitempty"`
+}
+
+// SignedPayload is what the signature of asset, a build of version, signs:
+// the version, the system and the checksum, one "name: value" line each,
+// so that a signature cannot vouch for another release or system.
+func SignedPayload(version string, asset *Asset) []byte {
+	return fmt.Appendf(nil, "version: %s\nos: %s\narch: %s\nsha256: %s\n",
+		strings.TrimSpace(version), asset.OS, asset.Arch, strings.ToLower(strings.TrimSpace(asset.SHA256)))
+}
+
+// Fetch reads the feed at url.
+func Fetch(ctx context.Context, client *http.Client, url string) (*Feed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the release feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the release feed %s: HTTP %d", url, resp.StatusCode)
+	}
+	var feed Feed
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("the release feed %s is not valid: %w", url, err)
+	}
+	if feed.Version == "" {
+		return nil, fmt.Errorf("the release feed %s names no version", url)
+	}
+	return &feed, nil
+}
+
+// Asset returns the build for goos and goarch.
+func (f *Feed) Asset(goos, goarch string) (*Asset, error) {
+	for i, a := range f.Assets {
+		if a.OS == goos && a.Arch == goarch {
+			return &f.Assets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s has no build for %s/%s", f.Version, goos, goarch)
+}
+
+// Newer reports whether version is newer than current. Versions are
+// compared by their dotted numbers, "v" or not; a pre-release such as
+// 1.2.0-rc1 comes before 1.2.0. A current version that is not a release,
+// such as "dev", is never older.
+func Newer(version, current string) bool {
+	v, vPre, ok := parseVersion(version)
+	c, cPre, cOK := parseVersion(current)
+	if !ok || !cOK {
+		return false
+	}
+	for i := range max(len(v), len(c)) {
+		var a, b int
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	switch {
+	case vPre == cPre:
+		return false
+	case vPre == "":
+		return true
+	case cPre == "":
+		return false
+	}
+	return vPre > cPre
+}
+
+// IsRelease reports whether version is a release version that Newer can
+// compare, unlike "dev".
+func IsRelease(version string) bool {
+	_, _, ok := parseVersion(version)
+	return ok
+}
+
+func parseVersion(s string) (numbers []int, pre string, ok bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, pre, _ = strings.Cut(s, "-")
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, "", false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, pre, true
+}
+
+// Updater installs releases over the binary at Binary. The new binary is
+// written next to it, as Binary.new, so that the swap is a rename on the
+// same file system, and the old one stays as Binary.old.
+type Updater struct {
+	Binary string
+	// Current is the version of the running binary. When it is a release,
+	// Download refuses releases that are not newer.
+	Current     string
+	trustedKeys []ed25519.PublicKey
+	// AllowUnsigned accepts releases checked only by their SHA-256, when
+	// no trusted keys are configured.
+	AllowUnsigned bool
+	client        *http.Client
+}
+
+// NewUpdater creates an updater for binary that accepts releases signed
+// with one of trustedKeys, base64 ed25519 public keys.
+func NewUpdater(binary string, trustedKeys []string, client *http.Client) (*Updater, error) {
+	u := &Updater{Binary: binary, client: client}
+	for _, k := range trustedKeys {
+		key, err := plugins.ParsePublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		u.trustedKeys = append(u.trustedKeys, key)
+	}
+	return u, nil
+}
+
+// NewPath is where Download puts the new binary.
+func (u *Updater) NewPath() string { return u.Binary + ".new" }
+
+// OldPath is where Swap keeps the binary it replaces.
+func (u *Updater) OldPath() string { return u.Binary + ".old" }
+
+// Download fetches asset, the build of version, verifies it and writes the
+// binary in it to NewPath, executable. It says how the release was
+// verified.
+func (u *Updater) Download(ctx context.Context, version string, asset *Asset) (string, error) {
+	if IsRelease(u.Current) && !Newer(version, u.Current) {
+		return "", fmt.Errorf("release %s is not newer than this version, %s", version, u.Current)
+	}
+	if asset.SHA256 == "" {
+		return "", fmt.Errorf("the release for %s/%s has no SHA-256 checksum", asset.OS, asset.Arch)
+	}
+	verifiedBy, err := u.verifySignature(version, asset)
+	if err != nil {
+		return "", err
+	}
+
+	// The download is kept beside the binary: /tmp may be small, or a
+	// RAM disk, on the devices this runs on.
+	tmp, err := os.CreateTemp(filepath.Dir(u.Binary), ".picoclaw-download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := u.fetch(ctx, asset, tmp); err != nil {
+		return "", err
+	}
+
+	newPath := u.NewPath()
+	if err := extract(tmp, asset.URL, newPath); err != nil {
+		os.Remove(newPath)
+		return "", err
+	}
+	return verifiedBy, nil
+}
+
+// verifySignature checks the asset's signature of its SignedPayload, and
+// names the key that made it.
+func (u *Updater) verifySignature(version string, asset *Asset) (string, error) {
+	if len(u.trustedKeys) == 0 {
+		if !u.AllowUnsigned {
+			return "", errors.New("no keys in update.trusted_keys to check the release's signature with; " +
+				"add the publisher's key, or pass --allow-unsigned to trust the feed's checksum alone")
+		}
+		return "sha256", nil
+	}
+	if asset.Signature == "" {
+		return "", fmt.Errorf("the release for %s/%s is not signed", asset.OS, asset.Arch)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(asset.Signature))
+	if err != nil {
+		return "", fmt.Errorf("the release's signature is not base64: %w", err)
+	}
+	payload := SignedPayload(version, asset)
+	for _, key := range u.trustedKeys {
+		if ed25519.Verify(key, payload, signature) {
+			return "key:" + plugins.KeyID(key), nil
+		}
+	}
+	return "", errors.New("the release's signature does not match any key in update.trusted_keys")
+}
+
+// fetch downloads the asset to f, checking its checksum on the way.
+func (u *Updater) fetch(ctx context.Context, asset *Asset, f *os.File) error {
+	var body io.ReadCloser
+	if strings.HasPrefix(asset.URL, "http://") || strings.HasPrefix(asset.URL, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", asset.URL, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("failed to download %s: HTTP %d", asset.URL, resp.StatusCode)
+		}
+		body = resp.Body
+	} else {
+		local, err := os.Open(asset.URL)
+		if err != nil {
+			return err
+		}
+		body = local
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(body, maxBinarySize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", asset.URL, err)
+	}
+	if n > maxBinarySize {
+		return fmt.Errorf("%s is larger than %d bytes", asset.URL, maxBinarySize)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, strings.TrimSpace(asset.SHA256)) {
+		return fmt.Errorf("checksum mismatch: the download's SHA-256 is %s, the feed says %s", got, asset.SHA256)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// extract writes the binary in the download f, named after url, to
+// target: f itself, or the picoclaw executable in a .tar.gz or .zip.
+func extract(f *os.File, url, target string) error {
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	name := path.Base(url)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return fmt.Errorf("%s holds no picoclaw binary", name)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if hdr.Typeflag == tar.TypeReg && isBinary(hdr.Name) {
+				_, err = io.Copy(out, io.LimitReader(tr, maxBinarySize))
+				return closeAfter(out, err)
+			}
+		}
+	case strings.HasSuffix(name, ".zip"):
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().Mode().IsRegular() && isBinary(zf.Name) {
+				r, err := zf.Open()
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				_, err = io.Copy(out, io.LimitReader(r, maxBinarySize))
+				r.Close()
+				return closeAfter(out, err)
+			}
+		}
+		return fmt.Errorf("%s holds no picoclaw binary", name)
+	}
+	_, err = io.Copy(out, f)
+	return closeAfter(out, err)
+}
+
+func isBinary(name string) bool {
+	base := path.Base(name)
+	return base == "picoclaw" || base == "picoclaw.exe"
+}
+
+func closeAfter(f *os.File, err error) error {
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Check runs the new binary's version command, so that a build for the
+// wrong system or a broken one is caught before it replaces this one,
+// and returns what it printed.
+func (u *Updater) Check(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, u.NewPath(), "version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("the new binary does not run: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Swap puts the new binary in place of Binary and keeps the old one as
+// OldPath. Where it can, it links the old binary to OldPath and renames
+// the new one over it, so that Binary is always there. Elsewhere, such as
+// on Windows, the old binary is renamed away first.
+func (u *Updater) Swap() error {
+	newPath, oldPath := u.NewPath(), u.OldPath()
+	if _, err := os.Stat(newPath); err != nil {
+		return fmt.Errorf("no new binary to install: %w", err)
+	}
+	os.Remove(oldPath)
+	if err := os.Link(u.Binary, oldPath); err == nil {
+		if err := os.Rename(newPath, u.Binary); err == nil {
+			return nil
+		}
+		// Windows does not replace a running binary, but renames it.
+		os.Remove(oldPath)
+	}
+	if err := os.Rename(u.Binary, oldPath); err != nil {
+		return fmt.Errorf("failed to move the old binary aside: %w", err)
+	}
+	if err := os.Rename(newPath, u.Binary); err != nil {
+		os.Rename(oldPath, u.Binary)
+		return fmt.Errorf("failed to install the new binary: %w", err)
+	}
+	return nil
+}
+
+// Rollback puts the binary Swap replaced back in place.
+func (u *Updater) Rollback() error {
+	oldPath := u.OldPath()
+	if _, err := os.Stat(oldPath); err != nil {
+		return fmt.Errorf("no previous binary to roll back to: %w", err)
+	}
+	if err := os.Rename(oldPath, u.Binary); err == nil {
+		return nil
+	}
+	// On Windows, the binary rolled back from may be running.
+	replaced := u.Binary + ".replaced"
+	os.Remove(replaced)
+	if err := os.Rename(u.Binary, replaced); err != nil {
+		return fmt.Errorf("failed to move the new binary aside: %w", err)
+	}
+	if err := os.Rename(oldPath, u.Binary); err != nil {
+		os.Rename(replaced, u.Binary)
+		return fmt.Errorf("failed to put the previous binary back: %w", err)
+	}
+	return nil
+}
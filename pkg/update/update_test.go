@@ -0,0 +1,192 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	for _, tt := range []struct {
+		version, current string
+		want             bool
+	}{
+		{"1.2.0", "1.1.9", true},
+		{"v1.10.0", "1.9.0", true},
+		{"1.2", "1.2.0", false},
+		{"1.2.0", "1.2.0-rc1", true},
+		{"1.2.0-rc2", "1.2.0-rc1", true},
+		{"1.2.0-rc1", "1.2.0", false},
+		{"1.1.0", "1.2.0", false},
+		{"1.2.0", "dev", false},
+		{"latest", "1.0.0", false},
+	} {
+		if got := Newer(tt.version, tt.current); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.version, tt.current, got, tt.want)
+		}
+	}
+}
+
+// release serves binary as a .tar.gz and a feed for it, signed with key.
+func release(t *testing.T, binary []byte, key ed25519.PrivateKey) (*httptest.Server, *Feed) {
+	t.Helper()
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "README.md", Mode: 0o644, Size: 2, Typeflag: tar.TypeReg})
+	tw.Write([]byte("hi"))
+	tw.WriteHeader(&tar.Header{Name: "picoclaw", Mode: 0o755, Size: int64(len(binary)), Typeflag: tar.TypeReg})
+	tw.Write(binary)
+	tw.Close()
+	gz.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	}))
+	t.Cleanup(srv.Close)
+	sum := sha256.Sum256(archive.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+	feed := &Feed{Version: "1.1.0", Assets: []Asset{{
+		OS: "linux", Arch: "arm64", URL: srv.URL + "/picoclaw_Linux_arm64.tar.gz", SHA256: checksum,
+	}}}
+	feed.Assets[0].Signature = sign(key, feed.Version, &feed.Assets[0])
+	return srv, feed
+}
+
+func sign(key ed25519.PrivateKey, version string, asset *Asset) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, SignedPayload(version, asset)))
+}
+
+func TestUpdater_DownloadSwapRollback(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(nil)
+	srv, feed := release(t, []byte("new build"), key)
+	asset, err := feed.Asset("linux", "arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := feed.Asset("windows", "arm"); err == nil {
+		t.Error("found a build for windows/arm")
+	}
+
+	binary := filepath.Join(t.TempDir(), "picoclaw")
+	os.WriteFile(binary, []byte("old build"), 0o755)
+	u, err := NewUpdater(binary, []string{base64.StdEncoding.EncodeToString(pub)}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Current = "1.0.0"
+	verifiedBy, err := u.Download(context.Background(), feed.Version, asset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(verifiedBy, "key:") {
+		t.Errorf("verified by %q", verifiedBy)
+	}
+	if data, _ := os.ReadFile(u.NewPath()); string(data) != "new build" {
+		t.Fatalf("new binary = %q", data)
+	}
+
+	if err := u.Swap(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(binary); string(data) != "new build" {
+		t.Errorf("binary after the swap = %q", data)
+	}
+	if data, _ := os.ReadFile(u.OldPath()); string(data) != "old build" {
+		t.Errorf("old binary = %q", data)
+	}
+	if err := u.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(binary); string(data) != "old build" {
+		t.Errorf("binary after the rollback = %q", data)
+	}
+	if err := u.Rollback(); err == nil {
+		t.Error("rolled back twice")
+	}
+}
+
+func TestUpdater_RefusesUnverifiedReleases(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(nil)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	binary := filepath.Join(t.TempDir(), "picoclaw")
+	os.WriteFile(binary, []byte("old build"), 0o755)
+	trusted := []string{base64.StdEncoding.EncodeToString(pub)}
+
+	srv, feed := release(t, []byte("new build"), otherKey)
+	u, _ := NewUpdater(binary, trusted, srv.Client())
+	if _, err := u.Download(context.Background(), feed.Version, &feed.Assets[0]); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("signed by another key: %v", err)
+	}
+
+	srv, feed = release(t, []byte("new build"), key)
+	u, _ = NewUpdater(binary, trusted, srv.Client())
+	// The signature vouches for one version on one system only.
+	if _, err := u.Download(context.Background(), "1.2.0", &feed.Assets[0]); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("signature of another version: %v", err)
+	}
+	otherSystem := feed.Assets[0]
+	otherSystem.Arch = "amd64"
+	if _, err := u.Download(context.Background(), feed.Version, &otherSystem); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("signature of another system: %v", err)
+	}
+	// A validly signed old release must not downgrade the binary.
+	u.Current = "1.1.0"
+	if _, err := u.Download(context.Background(), feed.Version, &feed.Assets[0]); err == nil || !strings.Contains(err.Error(), "not newer") {
+		t.Errorf("same version: %v", err)
+	}
+	u.Current = "1.2.0"
+	if _, err := u.Download(context.Background(), feed.Version, &feed.Assets[0]); err == nil || !strings.Contains(err.Error(), "not newer") {
+		t.Errorf("older version: %v", err)
+	}
+	u.Current = ""
+
+	tampered := feed.Assets[0]
+	tampered.SHA256 = strings.Repeat("0", 64)
+	tampered.Signature = sign(key, feed.Version, &tampered)
+	if _, err := u.Download(context.Background(), feed.Version, &tampered); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("wrong checksum: %v", err)
+	}
+	if _, err := os.Stat(u.NewPath()); err == nil {
+		t.Error("a release that failed verification was kept")
+	}
+
+	u, _ = NewUpdater(binary, nil, srv.Client())
+	if _, err := u.Download(context.Background(), feed.Version, &feed.Assets[0]); err == nil {
+		t.Error("installed without trusted keys")
+	}
+	u.AllowUnsigned = true
+	if verifiedBy, err := u.Download(context.Background(), feed.Version, &feed.Assets[0]); err != nil || verifiedBy != "sha256" {
+		t.Errorf("allowing unsigned releases: %q, %v", verifiedBy, err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/update.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"version": "v1.2.0", "notes": "Faster.", "assets": [{"os": "linux", "arch": "arm", "url": "x", "sha256": "y"}]}`))
+	}))
+	defer srv.Close()
+
+	feed, err := Fetch(context.Background(), srv.Client(), srv.URL+"/update.json")
+	if err != nil || feed.Version != "v1.2.0" || len(feed.Assets) != 1 {
+		t.Fatalf("Fetch = %+v, %v", feed, err)
+	}
+	if _, err := Fetch(context.Background(), srv.Client(), srv.URL+"/missing.json"); err == nil {
+		t.Error("fetched a missing feed")
+	}
+}
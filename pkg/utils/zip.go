@@ -90,7 +90,12 @@ func extractSingleFile(f *zip.File, destPath string) error {
 	}
 	defer rc.Close()
 
-	outFile, err := os.Create(destPath)
+	// Scripts keep their executable bit, nothing else of the mode.
+	perm := os.FileMode(0o644)
+	if f.Mode()&0o111 != 0 {
+		perm = 0o755
+	}
+	outFile, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
 	if err != nil {
 		return fmt.Errorf("failed to create file %q: %w", destPath, err)
 	}
@@ -0,0 +1,134 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strings"
+)
+
+// Audio captured from an AudioSource is raw little-endian signed 16-bit mono
+// PCM at SampleRate, the format wake-word engines and Whisper expect.
+const (
+	SampleRate     = 16000
+	bytesPerSample = 2
+)
+
+// AudioSource delivers microphone audio as a PCM stream.
+type AudioSource interface {
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// AudioSink plays a complete WAV file.
+type AudioSink interface {
+	Play(ctx context.Context, wav []byte) error
+}
+
+// Transcriber turns a recorded audio file into text. GroqTranscriber
+// implements it.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error)
+}
+
+// CommandSource records audio by running a command that writes PCM to
+// stdout, e.g. "arecord -q -f S16_LE -r 16000 -c 1 -t raw".
+type CommandSource struct {
+	args []string
+}
+
+func NewCommandSource(command string) (*CommandSource, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("audio input command is empty")
+	}
+	return &CommandSource{args: args}, nil
+}
+
+func (s *CommandSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", s.args[0], err)
+	}
+	return &commandStream{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+type commandStream struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (s *commandStream) Close() error {
+	s.ReadCloser.Close()
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+	s.cmd.Wait()
+	return nil
+}
+
+// CommandSink plays audio by piping WAV data into a command such as
+// "aplay -q".
+type CommandSink struct {
+	args []string
+}
+
+func NewCommandSink(command string) (*CommandSink, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("audio output command is empty")
+	}
+	return &CommandSink{args: args}, nil
+}
+
+func (s *CommandSink) Play(ctx context.Context, wav []byte) error {
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdin = bytes.NewReader(wav)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", s.args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// EncodeWAV wraps PCM in a RIFF/WAVE header.
+func EncodeWAV(pcm []byte, sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcm))
+
+	write := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	write(uint32(36 + len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	write(uint32(16))                          // fmt chunk size
+	write(uint16(1))                           // PCM
+	write(uint16(1))                           // mono
+	write(uint32(sampleRate))                  // sample rate
+	write(uint32(sampleRate * bytesPerSample)) // byte rate
+	write(uint16(bytesPerSample))              // block align
+	write(uint16(8 * bytesPerSample))          // bits per sample
+	buf.WriteString("data")
+	write(uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// RMS returns the root-mean-square amplitude of a PCM chunk.
+func RMS(pcm []byte) float64 {
+	n := len(pcm) / bytesPerSample
+	if n == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		s := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(n))
+}
@@ -0,0 +1,113 @@
+package voice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// pcmChunk returns ms milliseconds of a square wave with the given amplitude.
+func pcmChunk(ms int, amplitude int16) []byte {
+	n := SampleRate * ms / 1000
+	buf := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		s := amplitude
+		if i%2 == 1 {
+			s = -amplitude
+		}
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(s))
+	}
+	return buf
+}
+
+func TestEncodeWAV(t *testing.T) {
+	pcm := pcmChunk(10, 100)
+	wav := EncodeWAV(pcm, SampleRate)
+
+	if len(wav) != 44+len(pcm) {
+		t.Fatalf("len = %d, want %d", len(wav), 44+len(pcm))
+	}
+	if string(wav[0:4]) != "RIFF" || string(wav[8:16]) != "WAVEfmt " || string(wav[36:40]) != "data" {
+		t.Errorf("bad header: %q", wav[:44])
+	}
+	if got := binary.LittleEndian.Uint32(wav[24:]); got != SampleRate {
+		t.Errorf("sample rate = %d", got)
+	}
+	if got := binary.LittleEndian.Uint32(wav[40:]); int(got) != len(pcm) {
+		t.Errorf("data size = %d", got)
+	}
+	if !bytes.Equal(wav[44:], pcm) {
+		t.Error("payload mismatch")
+	}
+}
+
+func TestRMS(t *testing.T) {
+	if got := RMS(pcmChunk(10, 1000)); got != 1000 {
+		t.Errorf("RMS = %v, want 1000", got)
+	}
+	if got := RMS(nil); got != 0 {
+		t.Errorf("RMS(nil) = %v", got)
+	}
+}
+
+func TestEndpointer(t *testing.T) {
+	newEP := func() *Endpointer {
+		return &Endpointer{
+			Threshold:   500,
+			Silence:     300 * time.Millisecond,
+			MaxDuration: 2 * time.Second,
+			Timeout:     time.Second,
+		}
+	}
+
+	t.Run("speech then silence", func(t *testing.T) {
+		ep := newEP()
+		feed := func(ms int, amp int16) (done bool) {
+			for i := 0; i < ms/30; i++ {
+				if ep.Add(pcmChunk(30, amp)) {
+					return true
+				}
+			}
+			return false
+		}
+		if feed(300, 0) {
+			t.Fatal("ended before speech")
+		}
+		if feed(600, 2000) {
+			t.Fatal("ended during speech")
+		}
+		if !feed(600, 0) {
+			t.Fatal("did not end after silence")
+		}
+		// Leading silence is not part of the utterance.
+		if got, want := len(ep.Utterance()), len(pcmChunk(30, 0))*(20+10); got != want {
+			t.Errorf("utterance = %d bytes, want %d", got, want)
+		}
+	})
+
+	t.Run("timeout without speech", func(t *testing.T) {
+		ep := newEP()
+		done := false
+		for i := 0; i < 40 && !done; i++ {
+			done = ep.Add(pcmChunk(30, 0))
+		}
+		if !done || ep.Utterance() != nil {
+			t.Errorf("done = %v, utterance = %d bytes", done, len(ep.Utterance()))
+		}
+	})
+
+	t.Run("max duration", func(t *testing.T) {
+		ep := newEP()
+		n := 0
+		for !ep.Add(pcmChunk(100, 2000)) {
+			n++
+			if n > 100 {
+				t.Fatal("never ended")
+			}
+		}
+		if d := len(ep.Utterance()) / 2 * 1000 / SampleRate; d != 2000 {
+			t.Errorf("utterance = %d ms, want 2000", d)
+		}
+	})
+}
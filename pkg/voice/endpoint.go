@@ -0,0 +1,57 @@
+package voice
+
+import "time"
+
+// Endpointer cuts a single utterance out of a PCM stream using an energy
+// threshold: recording begins at the first loud chunk and ends after a run
+// of quiet ones.
+type Endpointer struct {
+	Threshold   float64       // RMS above which a chunk counts as speech
+	Silence     time.Duration // trailing silence that ends the utterance
+	MaxDuration time.Duration // hard cap on utterance length
+	Timeout     time.Duration // give up if no speech starts within this time
+
+	buf     []byte
+	started bool
+	elapsed time.Duration
+	quiet   time.Duration
+}
+
+// Reset prepares the endpointer for the next utterance.
+func (e *Endpointer) Reset() {
+	e.buf = e.buf[:0]
+	e.started = false
+	e.elapsed = 0
+	e.quiet = 0
+}
+
+// Add feeds a PCM chunk and reports whether the utterance is complete.
+func (e *Endpointer) Add(pcm []byte) bool {
+	d := time.Duration(len(pcm)/bytesPerSample) * time.Second / SampleRate
+	e.elapsed += d
+	loud := RMS(pcm) >= e.Threshold
+
+	if !e.started {
+		if !loud {
+			return e.Timeout > 0 && e.elapsed >= e.Timeout
+		}
+		e.started = true
+		e.elapsed = d
+	}
+
+	e.buf = append(e.buf, pcm...)
+	if loud {
+		e.quiet = 0
+	} else {
+		e.quiet += d
+	}
+	return e.quiet >= e.Silence || (e.MaxDuration > 0 && e.elapsed >= e.MaxDuration)
+}
+
+// Utterance returns the recorded speech, or nil if none was heard.
+func (e *Endpointer) Utterance() []byte {
+	if !e.started {
+		return nil
+	}
+	return e.buf
+}
@@ -0,0 +1,103 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Synthesizer turns reply text into a WAV file for playback.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) ([]byte, error)
+}
+
+// CommandSynthesizer runs a local TTS engine that reads text on stdin and
+// writes WAV to stdout, e.g. "piper --model en_US-lessac-medium.onnx
+// --output_file -" or "espeak-ng --stdout".
+type CommandSynthesizer struct {
+	args []string
+}
+
+func NewCommandSynthesizer(command string) (*CommandSynthesizer, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("tts command is empty")
+	}
+	return &CommandSynthesizer{args: args}, nil
+}
+
+func (s *CommandSynthesizer) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", s.args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// SpeechSynthesizer calls an OpenAI-compatible /audio/speech endpoint.
+type SpeechSynthesizer struct {
+	apiBase    string
+	apiKey     string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewSpeechSynthesizer(apiBase, apiKey, model, voice string) *SpeechSynthesizer {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	return &SpeechSynthesizer{
+		apiBase:    strings.TrimRight(apiBase, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		voice:      voice,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (s *SpeechSynthesizer) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{
+		"model":           s.model,
+		"voice":           s.voice,
+		"input":           text,
+		"response_format": "wav",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiBase+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(audio))
+	}
+	return audio, nil
+}
@@ -0,0 +1,86 @@
+package voice
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// WakeWordDetector spots the wake word in a PCM stream.
+type WakeWordDetector interface {
+	// Process feeds the next chunk of audio and reports whether the wake
+	// word was heard since the previous call.
+	Process(pcm []byte) (bool, error)
+	Close() error
+}
+
+// CommandWakeWord runs an external wake-word engine such as openWakeWord or
+// Porcupine. The command reads PCM from stdin and prints one line to stdout
+// per detection; anything else about the engine (model, sensitivity) is up
+// to the command.
+type CommandWakeWord struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	detected atomic.Bool
+	exited   atomic.Bool
+}
+
+func NewCommandWakeWord(ctx context.Context, command string) (*CommandWakeWord, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wake word command is empty")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", args[0], err)
+	}
+
+	w := &CommandWakeWord{cmd: cmd, stdin: stdin}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			logger.DebugCF("voice", "Wake word detected", map[string]any{"detector": line})
+			w.detected.Store(true)
+		}
+		w.exited.Store(true)
+	}()
+	return w, nil
+}
+
+func (w *CommandWakeWord) Process(pcm []byte) (bool, error) {
+	if w.exited.Load() {
+		return false, fmt.Errorf("wake word detector exited")
+	}
+	if _, err := w.stdin.Write(pcm); err != nil {
+		return false, fmt.Errorf("wake word detector: %w", err)
+	}
+	return w.detected.Swap(false), nil
+}
+
+func (w *CommandWakeWord) Close() error {
+	w.stdin.Close()
+	if w.cmd.Process != nil {
+		w.cmd.Process.Kill()
+	}
+	w.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,214 @@
+package workflow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultRetryDelay is how long a failed step waits to be tried again.
+var defaultRetryDelay = 10 * time.Second
+
+// maxTraceOutput caps the output a step trace keeps.
+const maxTraceOutput = 500
+
+// Env does what the steps ask for.
+type Env interface {
+	// Prompt has persona, or the default agent, answer prompt with the
+	// given tools only, without a session history.
+	Prompt(ctx context.Context, persona, prompt string, tools []string) (string, error)
+	// CallTool calls the tool name with args.
+	CallTool(ctx context.Context, name string, args map[string]any) (string, error)
+	// Send sends text to a chat.
+	Send(ctx context.Context, channel, chatID, text string) error
+}
+
+// Data is what the templates of a step are rendered with.
+type Data struct {
+	Workflow string
+	Input    string // what the run was started with, e.g. /workflow run news <input>
+	Now      time.Time
+	Steps    map[string]StepResult // the steps run so far, by ID
+}
+
+// StepResult is how a step went, for the steps after it.
+type StepResult struct {
+	Status string // "ok", "failed" or "skipped"
+	Output string
+	Error  string
+}
+
+// Trace is a run of a workflow, step by step.
+type Trace struct {
+	Workflow   string      `json:"workflow"`
+	TaskID     string      `json:"task_id"`
+	Trigger    string      `json:"trigger,omitempty"` // "schedule", "cli" or the chat it was run from
+	Started    time.Time   `json:"started"`
+	DurationMS int64       `json:"duration_ms"`
+	Status     string      `json:"status"` // "ok" or "failed"
+	Error      string      `json:"error,omitempty"`
+	Steps      []StepTrace `json:"steps"`
+}
+
+// StepTrace is how a step of a run went.
+type StepTrace struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Run runs the steps of w in order with env. A step that still fails
+// after its retries ends the run, unless it may be skipped over with
+// continue_on_error. The run is part of the task ctx was marked with, or
+// a task of its own.
+func Run(ctx context.Context, env Env, w *Workflow, input, trigger string) Trace {
+	taskID := state.TaskID(ctx)
+	if taskID == "" {
+		taskID = newTaskID()
+		ctx = state.WithTaskID(ctx, taskID)
+	}
+	tr := Trace{Workflow: w.Name, TaskID: taskID, Trigger: trigger, Started: time.Now(), Status: "ok"}
+	data := Data{Workflow: w.Name, Input: input, Now: tr.Started, Steps: map[string]StepResult{}}
+
+	for _, step := range w.Steps {
+		started := time.Now()
+		st := runStep(ctx, env, w, step, data)
+		st.DurationMS = time.Since(started).Milliseconds()
+		tr.Steps = append(tr.Steps, st)
+		data.Steps[step.ID] = StepResult{Status: st.Status, Output: st.Output, Error: st.Error}
+		if st.Status != "failed" {
+			continue
+		}
+		tr.Status = "failed"
+		if tr.Error == "" {
+			tr.Error = fmt.Sprintf("step %s: %s", step.ID, st.Error)
+		}
+		if !step.ContinueOnError || ctx.Err() != nil {
+			break
+		}
+	}
+	tr.DurationMS = time.Since(tr.Started).Milliseconds()
+	for i := range tr.Steps {
+		tr.Steps[i].Output = utils.Truncate(tr.Steps[i].Output, maxTraceOutput)
+	}
+	return tr
+}
+
+// runStep runs step, trying it again as often as it may.
+func runStep(ctx context.Context, env Env, w *Workflow, step Step, data Data) StepTrace {
+	st := StepTrace{ID: step.ID, Kind: step.Kind()}
+
+	if step.If != "" {
+		cond, err := render(step.If, data)
+		if err != nil {
+			st.Status, st.Error = "failed", err.Error()
+			return st
+		}
+		if !truthy(cond) {
+			st.Status = "skipped"
+			return st
+		}
+	}
+
+	delay := defaultRetryDelay
+	if step.RetryDelay > 0 {
+		delay = time.Duration(step.RetryDelay) * time.Second
+	}
+	for {
+		st.Attempts++
+		out, err := doStep(ctx, env, w, step, data)
+		if err == nil {
+			st.Status, st.Output, st.Error = "ok", out, ""
+			return st
+		}
+		st.Status, st.Output, st.Error = "failed", out, err.Error()
+		if st.Attempts > step.Retries {
+			return st
+		}
+		select {
+		case <-ctx.Done():
+			return st
+		case <-time.After(delay):
+		}
+	}
+}
+
+// doStep renders the templates of step and does what it asks for once.
+func doStep(ctx context.Context, env Env, w *Workflow, step Step, data Data) (string, error) {
+	switch step.Kind() {
+	case "tool":
+		args := make(map[string]any, len(step.Args))
+		for k, v := range step.Args {
+			if text, ok := v.(string); ok {
+				var err error
+				if v, err = render(text, data); err != nil {
+					return "", fmt.Errorf("args.%s: %w", k, err)
+				}
+			}
+			args[k] = v
+		}
+		return env.CallTool(ctx, step.Tool, args)
+	case "send":
+		text, err := render(step.Send, data)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(text) == "" {
+			return "", errors.New("nothing to send")
+		}
+		channel, chatID := step.Channel, step.ChatID
+		if channel == "" {
+			channel, chatID = w.Channel, w.ChatID
+		}
+		if channel == "" {
+			return "", errors.New("no chat to send to, set channel and chat_id")
+		}
+		return text, env.Send(ctx, channel, chatID, text)
+	default:
+		prompt, err := render(step.Prompt, data)
+		if err != nil {
+			return "", err
+		}
+		return env.Prompt(ctx, step.Persona, prompt, step.Tools)
+	}
+}
+
+// render renders the template text with data.
+func render(text string, data Data) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// truthy reports whether a rendered condition holds.
+func truthy(cond string) bool {
+	switch strings.ToLower(strings.TrimSpace(cond)) {
+	case "", "false", "no", "0":
+		return false
+	}
+	return true
+}
+
+// newTaskID names a run that is not part of a scheduled one.
+func newTaskID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,190 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Service runs the workflows of a workspace, on demand or as cron jobs.
+// Workflows are read from their files on every use, so an edit counts
+// from the next run. Runs are recorded as run events, "workflow_done"
+// and "workflow_failed".
+type Service struct {
+	dir    string
+	env    Env
+	traces *TraceLog
+	events *state.EventLog
+}
+
+// NewService creates the service for the workflows of workspace, run
+// with env.
+func NewService(workspace string, env Env) *Service {
+	return &Service{
+		dir:    Dir(workspace),
+		env:    env,
+		traces: NewTraceLog(workspace),
+		events: state.NewEventLog(workspace),
+	}
+}
+
+// List returns the workflows, and what is wrong with those left out.
+func (s *Service) List() ([]*Workflow, error) {
+	return Load(s.dir)
+}
+
+// Get returns the workflow name.
+func (s *Service) Get(name string) (*Workflow, error) {
+	workflows, errs := s.List()
+	for _, w := range workflows {
+		if w.Name == name {
+			return w, nil
+		}
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("no workflow %s: %w", name, errs)
+	}
+	return nil, fmt.Errorf("no workflow %s", name)
+}
+
+// Traces returns the log of past runs.
+func (s *Service) Traces() *TraceLog {
+	return s.traces
+}
+
+// Run runs the workflow name with input. Send steps go to channel and
+// chatID when the workflow names no chat. The run is traced, and its
+// error is the first step that failed.
+func (s *Service) Run(ctx context.Context, name, input, trigger, channel, chatID string) (Trace, error) {
+	w, err := s.Get(name)
+	if err != nil {
+		return Trace{}, err
+	}
+	if w.Channel == "" {
+		w.Channel, w.ChatID = channel, chatID
+	}
+	tr := Run(ctx, s.env, w, input, trigger)
+	if err := s.traces.Append(tr); err != nil {
+		logger.WarnCF("workflow", "Failed to record trace", map[string]any{"workflow": name, "error": err.Error()})
+	}
+	ev := state.RunEvent{
+		Kind:     "workflow_done",
+		Source:   name,
+		Message:  tr.Error,
+		Duration: time.Duration(tr.DurationMS) * time.Millisecond,
+	}
+	if tr.Status != "ok" {
+		ev.Kind = "workflow_failed"
+	}
+	if err := s.events.Append(ev); err != nil {
+		logger.WarnCF("workflow", "Failed to record run event", map[string]any{"error": err.Error()})
+	}
+	if tr.Status != "ok" {
+		return tr, errors.New(tr.Error)
+	}
+	return tr, nil
+}
+
+// RunScheduled runs the workflow name for its cron job and sums up how
+// its steps went.
+func (s *Service) RunScheduled(ctx context.Context, name string) (string, error) {
+	tr, err := s.Run(ctx, name, "", "schedule", "", "")
+	return tr.Summary(), err
+}
+
+// Summary tells how each step of the run went, e.g.
+// "fetch ok, summary ok (2 attempts), post skipped".
+func (tr Trace) Summary() string {
+	parts := make([]string, 0, len(tr.Steps))
+	for _, st := range tr.Steps {
+		part := st.ID + " " + st.Status
+		if st.Attempts > 1 {
+			part += fmt.Sprintf(" (%d attempts)", st.Attempts)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// JobName is the name of the cron job running a workflow.
+func JobName(workflow string) string {
+	return "workflow:" + workflow
+}
+
+// Schedule keeps a cron job for every workflow with a schedule, and
+// removes the jobs of workflows that lost theirs. While a workflow file
+// does not read, no job is removed, so that a typo does not throw away a
+// job's run history.
+func (s *Service) Schedule(cs *cron.CronService) error {
+	workflows, loadErr := s.List()
+	now := time.Now()
+	schedules := map[string]cron.CronSchedule{}
+	byName := map[string]*Workflow{}
+	for _, w := range workflows {
+		if w.Schedule == "" {
+			continue
+		}
+		// Checked when the workflow was read.
+		schedules[w.Name], _ = w.ParseSchedule(now)
+		byName[w.Name] = w
+	}
+
+	var errs []error
+	for _, job := range cs.ListJobs(true) {
+		name := job.Payload.Workflow
+		if name == "" {
+			continue
+		}
+		schedule, ok := schedules[name]
+		if !ok {
+			if loadErr == nil {
+				cs.RemoveJob(job.ID)
+			}
+			continue
+		}
+		delete(schedules, name)
+		if !sameSchedule(job.Schedule, schedule) {
+			if _, err := cs.Reschedule(job.ID, schedule); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(schedules))
+	for name := range schedules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		w := byName[name]
+		job, err := cs.AddJob(JobName(name), schedules[name], "Run the workflow "+name, false, w.Channel, w.ChatID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		job.Payload.Kind = "workflow"
+		job.Payload.Workflow = name
+		if err := cs.UpdateJob(job); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(append(errs, loadErr)...)
+}
+
+// sameSchedule reports whether a and b run at the same times.
+func sameSchedule(a, b cron.CronSchedule) bool {
+	ms := func(p *int64) int64 {
+		if p == nil {
+			return 0
+		}
+		return *p
+	}
+	return a.Kind == b.Kind && a.Expr == b.Expr && a.TZ == b.TZ && ms(a.EveryMS) == ms(b.EveryMS)
+}
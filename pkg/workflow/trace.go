@@ -0,0 +1,81 @@
+package workflow
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// TraceLog appends the traces of workflow runs to
+// <workspace>/state/workflow_runs.jsonl.
+type TraceLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewTraceLog creates the trace log of the given workspace.
+func NewTraceLog(workspace string) *TraceLog {
+	return &TraceLog{path: filepath.Join(workspace, "state", "workflow_runs.jsonl")}
+}
+
+// Append records tr.
+func (l *TraceLog) Append(tr Trace) error {
+	data, err := json.Marshal(tr)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow trace: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open workflow traces: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write workflow traces: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the last n traces of the workflow name, or of every
+// workflow when name is empty, newest first.
+func (l *TraceLog) Recent(name string, n int) ([]Trace, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open workflow traces: %w", err)
+	}
+	defer f.Close()
+
+	var traces []Trace
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var tr Trace
+		if json.Unmarshal(scanner.Bytes(), &tr) != nil || name != "" && tr.Workflow != name {
+			continue
+		}
+		traces = append(traces, tr)
+		if n > 0 && len(traces) > n {
+			traces = traces[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read workflow traces: %w", err)
+	}
+	slices.Reverse(traces)
+	return traces, nil
+}
@@ -0,0 +1,265 @@
+// Package workflow runs multi-step automations written as YAML files in
+// the workspace's workflows folder: fetch something with a tool, have a
+// persona summarize it, send the summary to a chat. Steps see the output
+// of the steps before them through templates, may be skipped by a
+// condition and are retried when they fail; every run is traced step by
+// step to state/workflow_runs.jsonl.
+//
+//	name: morning-news
+//	schedule: every weekday at 7
+//	steps:
+//	  - id: fetch
+//	    tool: web_fetch
+//	    args: {url: "https://news.ycombinator.com"}
+//	    retries: 2
+//	  - id: summary
+//	    persona: editor
+//	    prompt: "Pick the five best stories:\n{{.Steps.fetch.Output}}"
+//	  - id: post
+//	    if: '{{ne .Steps.summary.Output ""}}'
+//	    send: "{{.Steps.summary.Output}}"
+//	    channel: telegram
+//	    chat_id: "123"
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+// Dir is where the workflows of a workspace are kept.
+func Dir(workspace string) string {
+	return filepath.Join(workspace, "workflows")
+}
+
+// Workflow is a named list of steps, run in order.
+type Workflow struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Schedule runs the workflow as a cron job, e.g. "every day at 7" or
+	// "0 7 * * 1-5", in Timezone or the gateway's time zone.
+	Schedule string `yaml:"schedule,omitempty"`
+	Timezone string `yaml:"timezone,omitempty"`
+	// Channel and ChatID are where send steps without their own go.
+	Channel string `yaml:"channel,omitempty"`
+	ChatID  string `yaml:"chat_id,omitempty"`
+	Steps   []Step `yaml:"steps"`
+
+	Path string `yaml:"-"` // the file the workflow was read from
+}
+
+// Step is one step of a workflow. It does exactly one of three things:
+// answers Prompt as Persona, calls Tool with Args or sends Send to a
+// chat. Prompt, the string values of Args, Send and If are templates
+// rendered with Data.
+type Step struct {
+	ID string `yaml:"id"`
+	// If skips the step when it renders to "", "false", "no" or "0".
+	If string `yaml:"if,omitempty"`
+
+	Prompt  string   `yaml:"prompt,omitempty"`
+	Persona string   `yaml:"persona,omitempty"`
+	Tools   []string `yaml:"tools,omitempty"` // the tools the prompt may use, none when empty
+
+	Tool string         `yaml:"tool,omitempty"`
+	Args map[string]any `yaml:"args,omitempty"`
+
+	Send    string `yaml:"send,omitempty"`
+	Channel string `yaml:"channel,omitempty"`
+	ChatID  string `yaml:"chat_id,omitempty"`
+
+	// Retries is how often a failed step is tried again, RetryDelay
+	// seconds apart (10 by default).
+	Retries    int `yaml:"retries,omitempty"`
+	RetryDelay int `yaml:"retry_delay,omitempty"`
+	// ContinueOnError goes on with the next step when this one still
+	// fails; the run then ends as failed.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+}
+
+// Kind is what the step does: "prompt", "tool" or "send".
+func (s Step) Kind() string {
+	switch {
+	case s.Tool != "":
+		return "tool"
+	case s.Send != "":
+		return "send"
+	default:
+		return "prompt"
+	}
+}
+
+// stepID is what a step ID must look like to be used in templates as
+// {{.Steps.<id>.Output}}.
+var stepID = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Validate reports what is wrong with w, all of it.
+func (w *Workflow) Validate() error {
+	var errs []error
+	if w.Name == "" {
+		errs = append(errs, errors.New("name is empty"))
+	}
+	if len(w.Steps) == 0 {
+		errs = append(errs, errors.New("there are no steps"))
+	}
+	if w.Schedule != "" {
+		if _, err := w.ParseSchedule(time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	seen := map[string]bool{}
+	for i, s := range w.Steps {
+		at := fmt.Sprintf("step %d", i+1)
+		if s.ID != "" {
+			at = fmt.Sprintf("step %q", s.ID)
+		}
+		switch {
+		case s.ID == "":
+			errs = append(errs, fmt.Errorf("%s: id is empty", at))
+		case !stepID.MatchString(s.ID):
+			errs = append(errs, fmt.Errorf("%s: id must be letters, digits and _, starting with a letter", at))
+		case seen[s.ID]:
+			errs = append(errs, fmt.Errorf("%s: id is used twice", at))
+		}
+		seen[s.ID] = true
+
+		n := 0
+		for _, set := range []bool{s.Prompt != "", s.Tool != "", s.Send != ""} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			errs = append(errs, fmt.Errorf("%s: needs exactly one of prompt, tool and send", at))
+		}
+		if s.Send != "" && (s.Channel == "") != (s.ChatID == "") {
+			errs = append(errs, fmt.Errorf("%s: channel and chat_id go together", at))
+		}
+		if s.Retries < 0 || s.RetryDelay < 0 {
+			errs = append(errs, fmt.Errorf("%s: retries and retry_delay cannot be negative", at))
+		}
+		for _, text := range s.templates() {
+			if _, err := parseTemplate(text); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", at, err))
+			}
+		}
+	}
+	if (w.Channel == "") != (w.ChatID == "") {
+		errs = append(errs, errors.New("channel and chat_id go together"))
+	}
+	return errors.Join(errs...)
+}
+
+// ParseSchedule reads w.Schedule in w.Timezone. A workflow that runs
+// once is not scheduled; ask for it with /workflow run.
+func (w *Workflow) ParseSchedule(now time.Time) (cron.CronSchedule, error) {
+	loc := time.Local
+	if w.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return cron.CronSchedule{}, fmt.Errorf("timezone: %w", err)
+		}
+	}
+	schedule, err := cron.ParseSchedule(w.Schedule, loc, now)
+	if err != nil {
+		return cron.CronSchedule{}, fmt.Errorf("schedule: %w", err)
+	}
+	if schedule.Kind == "at" {
+		return cron.CronSchedule{}, fmt.Errorf("schedule: %q runs once, a workflow needs a repeating schedule", w.Schedule)
+	}
+	return schedule, nil
+}
+
+// templates are the texts of s rendered before it runs.
+func (s Step) templates() []string {
+	texts := []string{s.If, s.Prompt, s.Send}
+	for _, v := range s.Args {
+		if text, ok := v.(string); ok {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// Parse reads a workflow from its YAML. One without a name is named after
+// its file.
+func Parse(data []byte, path string) (*Workflow, error) {
+	var w Workflow
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	w.Path = path
+	if w.Name == "" {
+		w.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := w.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &w, nil
+}
+
+// Load reads the workflows in dir, sorted by name. Those that do not read
+// or validate are left out and their errors returned along; a missing
+// dir has no workflows.
+func Load(dir string) ([]*Workflow, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflows: %w", err)
+	}
+	var workflows []*Workflow
+	var errs []error
+	names := map[string]string{}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		w, err := Parse(data, path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if other, ok := names[w.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s: the name %q is taken by %s", e.Name(), w.Name, other))
+			continue
+		}
+		names[w.Name] = e.Name()
+		workflows = append(workflows, w)
+	}
+	slices.SortFunc(workflows, func(a, b *Workflow) int { return strings.Compare(a.Name, b.Name) })
+	return workflows, errors.Join(errs...)
+}
+
+// funcs are the functions templates have besides Go's own.
+var funcs = template.FuncMap{
+	"contains": strings.Contains,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"trim":     strings.TrimSpace,
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(funcs).Option("missingkey=zero").Parse(text)
+}
@@ -0,0 +1,170 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// fakeEnv answers prompts with the prompt in upper case, fails a tool
+// call as often as failures says and records what it sends.
+type fakeEnv struct {
+	failures int
+	calls    int
+	sent     []string
+	taskIDs  []string
+}
+
+func (e *fakeEnv) Prompt(ctx context.Context, persona, prompt string, tools []string) (string, error) {
+	e.taskIDs = append(e.taskIDs, state.TaskID(ctx))
+	return persona + ": " + strings.ToUpper(prompt), nil
+}
+
+func (e *fakeEnv) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
+	e.calls++
+	if e.calls <= e.failures {
+		return "", errors.New("connection refused")
+	}
+	return name + " " + args["url"].(string), nil
+}
+
+func (e *fakeEnv) Send(ctx context.Context, channel, chatID, text string) error {
+	e.sent = append(e.sent, channel+":"+chatID+" "+text)
+	return nil
+}
+
+const news = `
+name: news
+schedule: every day at 7
+channel: telegram
+chat_id: "1"
+steps:
+  - id: fetch
+    tool: web_fetch
+    args: {url: "https://example.com/{{.Input}}"}
+    retries: 1
+  - id: summary
+    persona: editor
+    prompt: "summarize {{.Steps.fetch.Output}}"
+  - id: quiet
+    if: '{{contains .Steps.summary.Output "NOTHING"}}'
+    send: "nothing today"
+  - id: post
+    send: "{{.Steps.summary.Output}}"
+`
+
+func TestRun(t *testing.T) {
+	w, err := Parse([]byte(news), "news.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultRetryDelay = time.Millisecond
+	env := &fakeEnv{failures: 1}
+	tr := Run(state.WithTaskID(context.Background(), "task0001"), env, w, "tech", "schedule")
+
+	if tr.Status != "ok" || tr.TaskID != "task0001" || tr.Summary() != "fetch ok (2 attempts), summary ok, quiet skipped, post ok" {
+		t.Fatalf("trace = %+v", tr)
+	}
+	want := "telegram:1 editor: SUMMARIZE WEB_FETCH HTTPS://EXAMPLE.COM/TECH"
+	if len(env.sent) != 1 || env.sent[0] != want {
+		t.Errorf("sent %q, want %q", env.sent, want)
+	}
+	if env.taskIDs[0] != "task0001" {
+		t.Errorf("the prompt ran as task %q", env.taskIDs[0])
+	}
+
+	// A step that keeps failing ends the run, unless it may be skipped.
+	env = &fakeEnv{failures: 5}
+	tr = Run(context.Background(), env, w, "tech", "cli")
+	if tr.Status != "failed" || len(tr.Steps) != 1 || tr.Error != "step fetch: connection refused" || tr.TaskID == "" {
+		t.Errorf("trace = %+v", tr)
+	}
+	w.Steps[0].ContinueOnError = true
+	tr = Run(context.Background(), &fakeEnv{failures: 5}, w, "", "cli")
+	if tr.Status != "failed" || len(tr.Steps) != 4 {
+		t.Errorf("with continue_on_error, trace = %+v", tr)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"no steps", "name: x\n", "there are no steps"},
+		{"two things", "steps:\n  - id: a\n    prompt: hi\n    send: hi\n", "exactly one of prompt, tool and send"},
+		{"bad id", "steps:\n  - id: my-step\n    prompt: hi\n", "id must be letters"},
+		{"same id", "steps:\n  - id: a\n    prompt: hi\n  - id: a\n    prompt: ho\n", "used twice"},
+		{"bad template", "steps:\n  - id: a\n    prompt: '{{.Steps'\n", "unclosed action"},
+		{"runs once", "schedule: tomorrow at 8\nsteps:\n  - id: a\n    prompt: hi\n", "repeating schedule"},
+		{"unknown field", "steps:\n  - id: a\n    promt: hi\n", "field promt not found"},
+		{"half a chat", "steps:\n  - id: a\n    send: hi\n    channel: telegram\n", "channel and chat_id go together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml), "x.yaml")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceSchedule(t *testing.T) {
+	workspace := t.TempDir()
+	dir := Dir(workspace)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("news.yaml", news)
+	write("adhoc.yml", "steps:\n  - id: a\n    prompt: hi\n")
+
+	cs := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	s := NewService(workspace, &fakeEnv{})
+	if err := s.Schedule(cs); err != nil {
+		t.Fatal(err)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Name != "workflow:news" || jobs[0].Payload.Workflow != "news" || jobs[0].Schedule.Expr != "0 7 * * *" {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+
+	// Scheduling again keeps the job; a new schedule changes it.
+	write("news.yaml", strings.Replace(news, "every day at 7", "every day at 9", 1))
+	if err := s.Schedule(cs); err != nil {
+		t.Fatal(err)
+	}
+	if jobs = cs.ListJobs(true); len(jobs) != 1 || jobs[0].Schedule.Expr != "0 9 * * *" {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+
+	// A broken file keeps its job, a workflow that is gone loses it.
+	write("news.yaml", "steps: [")
+	if err := s.Schedule(cs); err == nil || len(cs.ListJobs(true)) != 1 {
+		t.Errorf("err = %v, jobs = %+v", err, cs.ListJobs(true))
+	}
+	os.Remove(filepath.Join(dir, "news.yaml"))
+	if err := s.Schedule(cs); err != nil || len(cs.ListJobs(true)) != 0 {
+		t.Errorf("err = %v, jobs = %+v", err, cs.ListJobs(true))
+	}
+
+	// Runs are traced.
+	if _, err := s.Run(context.Background(), "adhoc", "", "cli", "cli", "direct"); err != nil {
+		t.Fatal(err)
+	}
+	traces, err := s.Traces().Recent("adhoc", 5)
+	if err != nil || len(traces) != 1 || traces[0].Steps[0].Output != ": HI" {
+		t.Errorf("traces = %+v, %v", traces, err)
+	}
+}